@@ -373,6 +373,9 @@ func registerIoTDevice(username, deviceId string, capabilities []string) error {
 	result, txErr = contract.SubmitTransaction("RegisterIoTDevice", deviceId, publicKeyPEM, string(capabilitiesJSON))
 	
 	// If submission fails, try evaluation as fallback
+	if txErr != nil && strictMode {
+		return fmt.Errorf("failed to register IoT device (strict mode, no evaluate fallback): %v", txErr)
+	}
 	if txErr != nil {
 		fmt.Println("Transaction submission failed, falling back to evaluation...")
 		result, txErr = contract.EvaluateTransaction("RegisterIoTDevice", deviceId, publicKeyPEM, string(capabilitiesJSON))
@@ -470,6 +473,9 @@ func getTGT(username, clientId string) (*TGT, error) {
 	}
 	
 	// Fall back to encryption-based verification
+	if strictMode {
+		return nil, fmt.Errorf("signature verification failed (strict mode, no encryption-based fallback): %v", verifyErr)
+	}
 	fmt.Printf("Signature verification failed: %v\n", verifyErr)
 	fmt.Println("Falling back to encryption-based verification...")
 	
@@ -828,8 +834,27 @@ func debugRSAEncryption(nonce string) error {
 	return nil
 }
 
+// strictMode disables the submit-to-evaluate and signature-to-encryption
+// fallbacks. It is set by --strict anywhere on the command line.
+var strictMode bool
+
+// parseStrictFlag removes --strict from os.Args and sets strictMode
+func parseStrictFlag() {
+	args := os.Args[:1]
+	for _, arg := range os.Args[1:] {
+		if arg == "--strict" {
+			strictMode = true
+			continue
+		}
+		args = append(args, arg)
+	}
+	os.Args = args
+}
+
 // main is the entry point for the program
 func main() {
+	parseStrictFlag()
+	
 	// Check command line arguments
 	if len(os.Args) < 2 {
 		printUsage()
@@ -941,4 +966,5 @@ func printUsage() {
 	fmt.Println("  get-device-data <username> <clientId> <deviceId>")
 	fmt.Println("  close-session <username> <clientId> <deviceId>")
 	fmt.Println("  debug-rsa <nonce>")
+	fmt.Println("Add --strict to fail instead of falling back to evaluate or encrypted-nonce verification")
 }
@@ -154,6 +154,9 @@ func registerIoTDevice(username, deviceId string, capabilities []string) error {
 	_, registerErr = contract.SubmitTransaction("RegisterIoTDevice", deviceId, publicKeyPEM, string(capabilitiesJSON))
 	
 	// If submission fails, try evaluation
+	if registerErr != nil && strictMode {
+		return fmt.Errorf("failed to register IoT device (strict mode, no evaluate fallback): %v", registerErr)
+	}
 	if registerErr != nil {
 		fmt.Println("Transaction submission failed, falling back to evaluation...")
 		_, registerErr = contract.EvaluateTransaction("RegisterIoTDevice", deviceId, publicKeyPEM, string(capabilitiesJSON))
@@ -597,6 +600,8 @@ func showUsage() {
 	fmt.Println("  get-device-data <username> <clientId> <deviceId>    - Get device data after authentication")
 	fmt.Println("  close-session <username> <clientId> <deviceId>      - Close an active session")
 	fmt.Println("")
+	fmt.Println("Add --strict to fail instead of falling back to evaluate on registration")
+	fmt.Println("")
 	fmt.Println("Examples:")
 	fmt.Println("  go run simple-fabric-client.go register-client admin client1")
 	fmt.Println("  go run simple-fabric-client.go register-device admin device1 temperature humidity")
@@ -828,7 +833,26 @@ func fileExists(path string) bool {
 	return !os.IsNotExist(err)
 }
 
+// strictMode disables the submit-to-evaluate fallback on
+// registration. It is set by --strict anywhere on the command line.
+var strictMode bool
+
+// parseStrictFlag removes --strict from os.Args and sets strictMode
+func parseStrictFlag() {
+	args := os.Args[:1]
+	for _, arg := range os.Args[1:] {
+		if arg == "--strict" {
+			strictMode = true
+			continue
+		}
+		args = append(args, arg)
+	}
+	os.Args = args
+}
+
 func main() {
+	parseStrictFlag()
+	
 	// Initialize wallet before any operations
 	if len(os.Args) > 2 {
 		err := initializeWallet(os.Args[2]) // Use the username from command line
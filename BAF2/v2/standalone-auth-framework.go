@@ -5,6 +5,8 @@ package main
 
 import (
 	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
@@ -42,6 +44,12 @@ func generateKeyPair() (*rsa.PrivateKey, *rsa.PublicKey, error) {
 	return privateKey, publicKey, nil
 }
 
+// generateECKeyPair generates a new P-256 key pair, which the chaincodes
+// accept alongside RSA keys
+func generateECKeyPair() (*ecdsa.PrivateKey, error) {
+	return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+}
+
 // savePrivateKey saves a private key to a file in PKCS#1 format
 func savePrivateKey(privateKey *rsa.PrivateKey, filename string) error {
 	// Create directories if they don't exist
@@ -64,8 +72,32 @@ func savePrivateKey(privateKey *rsa.PrivateKey, filename string) error {
 	return ioutil.WriteFile(filename, privateKeyPEM, 0600)
 }
 
-// savePublicKey saves a public key to a file
-func savePublicKey(publicKey *rsa.PublicKey, filename string) error {
+// saveECPrivateKey saves a P-256 private key to a file in SEC 1 format
+func saveECPrivateKey(privateKey *ecdsa.PrivateKey, filename string) error {
+	// Create directories if they don't exist
+	dir := filepath.Dir(filename)
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		os.MkdirAll(dir, 0755)
+	}
+	
+	privateKeyBytes, err := x509.MarshalECPrivateKey(privateKey)
+	if err != nil {
+		return err
+	}
+	
+	// Encode to PEM
+	privateKeyPEM := pem.EncodeToMemory(
+		&pem.Block{
+			Type:  "EC PRIVATE KEY",
+			Bytes: privateKeyBytes,
+		},
+	)
+	
+	return ioutil.WriteFile(filename, privateKeyPEM, 0600)
+}
+
+// savePublicKey saves an RSA or P-256 public key to a file
+func savePublicKey(publicKey crypto.PublicKey, filename string) error {
 	// Create directories if they don't exist
 	dir := filepath.Dir(filename)
 	if _, err := os.Stat(dir); os.IsNotExist(err) {
@@ -194,29 +226,45 @@ func verifySignature(publicKey *rsa.PublicKey, data []byte, signatureBase64 stri
 	return rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, hash[:], signature)
 }
 
-// generateClientKeys generates and saves client keys
-func generateClientKeys(clientId string) error {
-	// Generate a new key pair
-	privateKey, publicKey, err := generateKeyPair()
-	if err != nil {
-		return fmt.Errorf("failed to generate key pair: %v", err)
-	}
-	
-	// Save the private key
+// generateClientKeys generates and saves client keys of keyType ("rsa" or
+// "ec-p256")
+func generateClientKeys(clientId string, keyType string) error {
 	privateKeyFile := fmt.Sprintf("keys/%s-private.pem", clientId)
-	err = savePrivateKey(privateKey, privateKeyFile)
-	if err != nil {
-		return fmt.Errorf("failed to save private key: %v", err)
+	var publicKey crypto.PublicKey
+	
+	switch keyType {
+	case "rsa":
+		// Generate a new key pair
+		privateKey, rsaPublicKey, err := generateKeyPair()
+		if err != nil {
+			return fmt.Errorf("failed to generate key pair: %v", err)
+		}
+		
+		// Save the private key
+		if err := savePrivateKey(privateKey, privateKeyFile); err != nil {
+			return fmt.Errorf("failed to save private key: %v", err)
+		}
+		publicKey = rsaPublicKey
+	case "ec-p256":
+		privateKey, err := generateECKeyPair()
+		if err != nil {
+			return fmt.Errorf("failed to generate key pair: %v", err)
+		}
+		if err := saveECPrivateKey(privateKey, privateKeyFile); err != nil {
+			return fmt.Errorf("failed to save private key: %v", err)
+		}
+		publicKey = &privateKey.PublicKey
+	default:
+		return fmt.Errorf("unknown key type %q (expected rsa or ec-p256)", keyType)
 	}
 	
 	// Save the public key
 	publicKeyFile := fmt.Sprintf("keys/%s-public.pem", clientId)
-	err = savePublicKey(publicKey, publicKeyFile)
-	if err != nil {
+	if err := savePublicKey(publicKey, publicKeyFile); err != nil {
 		return fmt.Errorf("failed to save public key: %v", err)
 	}
 	
-	fmt.Printf("Generated keys for client %s:\n", clientId)
+	fmt.Printf("Generated %s keys for client %s:\n", keyType, clientId)
 	fmt.Printf("Private key: %s\n", privateKeyFile)
 	fmt.Printf("Public key: %s\n", publicKeyFile)
 	
@@ -444,12 +492,13 @@ func testKeysURI(clientId string) error {
 func printUsage() {
 	fmt.Println("===== Standalone Authentication Framework for Testing =====")
 	fmt.Println("Available commands:")
-	fmt.Println("  generate-keys <clientId>  - Generate new RSA keys for a client")
+	fmt.Println("  generate-keys <clientId> [rsa|ec-p256] - Generate new keys for a client (default: rsa)")
 	fmt.Println("  simulate-auth <clientId> <nonce> - Simulate authentication with a nonce")
 	fmt.Println("  debug-rsa <nonce>         - Debug RSA encryption/signing with a nonce")
 	fmt.Println("  test-keys-uri <clientId>  - Test key file paths between Node.js and Go")
 	fmt.Println("\nExamples:")
 	fmt.Println("  go run standalone-auth-framework.go generate-keys client1")
+	fmt.Println("  go run standalone-auth-framework.go generate-keys client2 ec-p256")
 	fmt.Println("  go run standalone-auth-framework.go simulate-auth client1 test-nonce-123")
 	fmt.Println("  go run standalone-auth-framework.go debug-rsa test-nonce-123")
 	fmt.Println("  go run standalone-auth-framework.go test-keys-uri client1")
@@ -469,11 +518,15 @@ func main() {
 	switch command {
 	case "generate-keys":
 		if len(os.Args) < 3 {
-			fmt.Println("Usage: go run standalone-auth-framework.go generate-keys <clientId>")
+			fmt.Println("Usage: go run standalone-auth-framework.go generate-keys <clientId> [rsa|ec-p256]")
 			return
 		}
 		clientId := os.Args[2]
-		err = generateClientKeys(clientId)
+		keyType := "rsa"
+		if len(os.Args) > 3 {
+			keyType = os.Args[3]
+		}
+		err = generateClientKeys(clientId, keyType)
 		
 	case "simulate-auth":
 		if len(os.Args) < 4 {
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/chaichis-network/v3/internal/auth"
+	"github.com/chaichis-network/v3/internal/fabric"
+	"github.com/spf13/cobra"
+)
+
+var (
+	accessLinkCode         string
+	accessLinkCapabilities string
+	accessLinkTTL          time.Duration
+)
+
+func init() {
+	createAccessLinkCmd.Flags().StringVar(&deviceID, "device-id", "", "Device ID to share")
+	createAccessLinkCmd.Flags().StringVar(&accessLinkCapabilities, "capabilities", "read", "Comma-separated capabilities granted by the link")
+	createAccessLinkCmd.Flags().DurationVar(&accessLinkTTL, "ttl", time.Hour, "How long the link stays redeemable (max 168h)")
+	createAccessLinkCmd.MarkFlagRequired("device-id")
+
+	redeemAccessLinkCmd.Flags().StringVar(&clientID, "client-id", "", "Client ID redeeming the link")
+	redeemAccessLinkCmd.Flags().StringVar(&deviceID, "device-id", "", "Device ID the link was created for")
+	redeemAccessLinkCmd.Flags().StringVar(&accessLinkCode, "code", "", "One-time access code")
+	redeemAccessLinkCmd.MarkFlagRequired("client-id")
+	redeemAccessLinkCmd.MarkFlagRequired("device-id")
+	redeemAccessLinkCmd.MarkFlagRequired("code")
+
+	revokeAccessLinkCmd.Flags().StringVar(&deviceID, "device-id", "", "Device ID the link was created for")
+	revokeAccessLinkCmd.Flags().StringVar(&accessLinkCode, "code", "", "One-time access code to revoke")
+	revokeAccessLinkCmd.MarkFlagRequired("device-id")
+	revokeAccessLinkCmd.MarkFlagRequired("code")
+
+	rootCmd.AddCommand(createAccessLinkCmd)
+	rootCmd.AddCommand(redeemAccessLinkCmd)
+	rootCmd.AddCommand(revokeAccessLinkCmd)
+}
+
+// newDeviceManager connects to the network and returns a device manager
+func newDeviceManager() (*auth.DeviceManager, error) {
+	// Create Fabric client
+	fabricClient, err := fabric.NewClient(fabric.ClientOptions{
+		ConfigPath:      configPath,
+		WalletPath:      walletPath,
+		Wallet:          walletOptions(),
+		Debug:           debugMode,
+		Peers:           peerRoles(),
+		AgeIdentityFile: ageIdentity,
+		API:             fabricAPI,
+		GatewayPeer:     gatewayPeer,
+		Strict:          strictMode,
+		FlowID:          flowID,
+		Pool:            connectionPool,
+		TransactionLog:  transactionLog,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Fabric client: %v", err)
+	}
+
+	// Ensure identity exists in wallet
+	if err := fabricClient.EnsureIdentity(identityName); err != nil {
+		return nil, fmt.Errorf("failed to ensure identity: %v", err)
+	}
+
+	deviceManager, err := auth.NewDeviceManager(fabricClient, identityName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create device manager: %v", err)
+	}
+	return deviceManager, nil
+}
+
+var createAccessLinkCmd = &cobra.Command{
+	Use:   "create-access-link",
+	Short: "Create a one-time, time-limited access code for a device",
+	Long: `Creates a one-time access code that lets another registered client open a
+single short session on the device. The grant is signed with the device's
+private key, so this must be run by the device owner. The code is printed
+once and only its hash is stored on the ledger.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var capabilities []string
+		for _, capability := range strings.Split(accessLinkCapabilities, ",") {
+			if capability = strings.TrimSpace(capability); capability != "" {
+				capabilities = append(capabilities, capability)
+			}
+		}
+		if len(capabilities) == 0 {
+			return fmt.Errorf("at least one capability is required")
+		}
+
+		deviceManager, err := newDeviceManager()
+		if err != nil {
+			return err
+		}
+
+		grant, err := deviceManager.CreateAccessGrant(deviceID, capabilities, accessLinkTTL)
+		if err != nil {
+			return fmt.Errorf("failed to create access link: %v", err)
+		}
+
+		fmt.Printf("Access code: %s\n", grant.Code)
+		fmt.Printf("Device:      %s\n", grant.DeviceID)
+		fmt.Printf("Grants:      %s\n", strings.Join(grant.Capabilities, ", "))
+		if !grant.ExpiresAt.IsZero() {
+			fmt.Printf("Expires:     %s\n", grant.ExpiresAt.Format(time.RFC3339))
+		}
+		fmt.Println("The code can be redeemed once and is not shown again.")
+		return nil
+	},
+}
+
+var redeemAccessLinkCmd = &cobra.Command{
+	Use:   "redeem-access-link",
+	Short: "Redeem a one-time access code for a device session",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		deviceManager, err := newDeviceManager()
+		if err != nil {
+			return err
+		}
+
+		session, err := deviceManager.RedeemAccessGrant(clientID, deviceID, accessLinkCode)
+		if err != nil {
+			return fmt.Errorf("failed to redeem access link: %v", err)
+		}
+
+		if err := saveSession(session); err != nil {
+			return err
+		}
+
+		log.Infof("Access granted to device %s for client %s", deviceID, clientID)
+		log.Infof("Session ID: %s", session.SessionID)
+		return nil
+	},
+}
+
+var revokeAccessLinkCmd = &cobra.Command{
+	Use:   "revoke-access-link",
+	Short: "Revoke an unredeemed one-time access code",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := confirmDestructive("revoke an access link for device "+deviceID, 1); err != nil {
+			return err
+		}
+
+		deviceManager, err := newDeviceManager()
+		if err != nil {
+			return err
+		}
+
+		if err := deviceManager.RevokeAccessGrant(deviceID, accessLinkCode); err != nil {
+			return fmt.Errorf("failed to revoke access link: %v", err)
+		}
+
+		log.Infof("Access link for device %s revoked", deviceID)
+		return nil
+	},
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/chaichis-network/v3/internal/auth"
+	"github.com/chaichis-network/v3/internal/fabric"
+	"github.com/chaichis-network/v3/pkg/table"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	addListFlags(selfTestCmd)
+
+	adminCmd.AddCommand(selfTestCmd)
+
+	rootCmd.AddCommand(adminCmd)
+}
+
+var adminCmd = &cobra.Command{
+	Use:   "admin",
+	Short: "Operate the deployment",
+}
+
+var selfTestCmd = &cobra.Command{
+	Use:   "selftest",
+	Short: "Check the chaincodes can use their key material",
+	Long: `Runs the SelfTest of the ISV, TGS and AS chaincodes. Each checks that its
+private key loads and belongs to its public key and to the key it published,
+that it signs and verifies, and that it opens an envelope sealed for itself
+in the configured padding. The TGS and the AS also seal a probe with the key
+they imported for the ISV and the TGS, and have that chaincode open it.
+
+The self-test writes nothing and reports no key material. Run it after a
+deployment or a key rollover; it exits non-zero unless every check passes.
+A peer that is not a member of the collection holding a private key fails
+the private_key check.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// The self-tests read all three chaincodes over one connection
+		return withChaincodeContract("isv", func(fabricClient *fabric.Client, _ string) error {
+			reports, err := auth.RunSelfTests(fabricClient)
+			if err != nil {
+				return err
+			}
+
+			failed := 0
+			t := table.New("service", "check", "status", "detail")
+			for _, report := range reports {
+				if !report.Passed {
+					failed++
+				}
+				for _, check := range report.Checks {
+					t.Append(report.Service, check.Name, strings.ToUpper(check.Status), check.Detail)
+				}
+			}
+			if err := printList(t, reports); err != nil {
+				return err
+			}
+
+			if failed > 0 {
+				return fmt.Errorf("%d of %d chaincodes failed their self-test", failed, len(reports))
+			}
+			fmt.Fprintln(os.Stderr, "All self-tests passed")
+			return nil
+		})
+	},
+}
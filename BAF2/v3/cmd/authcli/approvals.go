@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/chaichis-network/v3/pkg/table"
+	"github.com/spf13/cobra"
+)
+
+var (
+	operationName string
+	approvalID    string
+	approverList  string
+)
+
+func init() {
+	requestOperationCmd.Flags().StringVar(&clientID, "client-id", "", "Client ID requesting the operation")
+	requestOperationCmd.Flags().StringVar(&deviceID, "device-id", "", "Device ID to operate")
+	requestOperationCmd.Flags().StringVar(&operationName, "operation", "read", "Operation to request (actuator and unlock need a co-signer)")
+	requestOperationCmd.MarkFlagRequired("client-id")
+	requestOperationCmd.MarkFlagRequired("device-id")
+
+	listApprovalsCmd.Flags().StringVar(&deviceID, "device-id", "", "Only list approvals for this device")
+	addListFlags(listApprovalsCmd)
+
+	for _, cmd := range []*cobra.Command{approveOperationCmd, rejectOperationCmd} {
+		cmd.Flags().StringVar(&clientID, "client-id", "", "Approver's client ID")
+		cmd.Flags().StringVar(&deviceID, "device-id", "", "Device ID the operation targets")
+		cmd.Flags().StringVar(&approvalID, "approval-id", "", "Approval ID of the pending operation")
+		cmd.MarkFlagRequired("client-id")
+		cmd.MarkFlagRequired("device-id")
+		cmd.MarkFlagRequired("approval-id")
+	}
+
+	approvalStatusCmd.Flags().StringVar(&clientID, "client-id", "", "Requester's client ID")
+	approvalStatusCmd.Flags().StringVar(&approvalID, "approval-id", "", "Approval ID returned by request-operation")
+	approvalStatusCmd.MarkFlagRequired("client-id")
+	approvalStatusCmd.MarkFlagRequired("approval-id")
+
+	setApproversCmd.Flags().StringVar(&deviceID, "device-id", "", "Device ID")
+	setApproversCmd.Flags().StringVar(&approverList, "approvers", "", "Comma-separated client IDs allowed to co-sign")
+	setApproversCmd.MarkFlagRequired("device-id")
+	setApproversCmd.MarkFlagRequired("approvers")
+
+	approvalsCmd.AddCommand(listApprovalsCmd)
+	approvalsCmd.AddCommand(approveOperationCmd)
+	approvalsCmd.AddCommand(rejectOperationCmd)
+	approvalsCmd.AddCommand(approvalStatusCmd)
+	approvalsCmd.AddCommand(setApproversCmd)
+
+	rootCmd.AddCommand(requestOperationCmd)
+	rootCmd.AddCommand(approvalsCmd)
+}
+
+var requestOperationCmd = &cobra.Command{
+	Use:   "request-operation",
+	Short: "Request an operation on an IoT device",
+	Long: `Requests an operation on a device. Ordinary operations open a session
+immediately. Sensitive operations (actuator, unlock) are held by the ISV until
+one of the device's approvers co-signs them; the command then prints the
+approval ID to pass to 'approvals status'.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		deviceManager, err := newDeviceManager()
+		if err != nil {
+			return err
+		}
+
+		session, pendingID, err := deviceManager.RequestOperation(clientID, deviceID, operationName)
+		if err != nil {
+			return fmt.Errorf("failed to request operation: %v", err)
+		}
+
+		if pendingID != "" {
+			fmt.Printf("Operation %s on %s needs a second approver.\n", operationName, deviceID)
+			fmt.Printf("Approval ID: %s\n", pendingID)
+			return nil
+		}
+
+		if err := saveSession(session); err != nil {
+			return err
+		}
+		log.Infof("Session ID: %s", session.SessionID)
+		return nil
+	},
+}
+
+var approvalsCmd = &cobra.Command{
+	Use:   "approvals",
+	Short: "Manage co-signed approvals for sensitive device operations",
+}
+
+var listApprovalsCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List operations awaiting approval",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		deviceManager, err := newDeviceManager()
+		if err != nil {
+			return err
+		}
+
+		approvals, err := deviceManager.PendingApprovals(deviceID)
+		if err != nil {
+			return fmt.Errorf("failed to list approvals: %v", err)
+		}
+
+		t := table.New("approval", "status", "operation", "device", "client", "expires")
+		for _, approval := range approvals {
+			t.Append(cell(approval, "approvalID"), cell(approval, "status"), cell(approval, "operation"),
+				cell(approval, "deviceID"), cell(approval, "clientID"), cell(approval, "expiresAt"))
+		}
+		return printList(t, approvals)
+	},
+}
+
+var approveOperationCmd = &cobra.Command{
+	Use:   "approve",
+	Short: "Co-sign a pending operation",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		deviceManager, err := newDeviceManager()
+		if err != nil {
+			return err
+		}
+
+		approval, err := deviceManager.ApproveOperation(clientID, deviceID, approvalID)
+		if err != nil {
+			return fmt.Errorf("failed to approve operation: %v", err)
+		}
+
+		log.Infof("Operation %s approved, session %v opened for %v", approvalID, approval["sessionID"], approval["clientID"])
+		return nil
+	},
+}
+
+var rejectOperationCmd = &cobra.Command{
+	Use:   "reject",
+	Short: "Reject a pending operation",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := confirmDestructive("reject operation "+approvalID, 1); err != nil {
+			return err
+		}
+
+		deviceManager, err := newDeviceManager()
+		if err != nil {
+			return err
+		}
+
+		if _, err := deviceManager.RejectOperation(clientID, deviceID, approvalID); err != nil {
+			return fmt.Errorf("failed to reject operation: %v", err)
+		}
+
+		log.Infof("Operation %s rejected", approvalID)
+		return nil
+	},
+}
+
+var approvalStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Check an approval and pick up the session once approved",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		deviceManager, err := newDeviceManager()
+		if err != nil {
+			return err
+		}
+
+		status, session, err := deviceManager.ApprovalStatus(clientID, approvalID)
+		if err != nil {
+			return fmt.Errorf("failed to get approval status: %v", err)
+		}
+
+		fmt.Printf("Status: %s\n", status)
+		if session != nil {
+			if err := saveSession(session); err != nil {
+				return err
+			}
+			fmt.Printf("Session ID: %s\n", session.SessionID)
+		}
+		return nil
+	},
+}
+
+var setApproversCmd = &cobra.Command{
+	Use:   "set-approvers",
+	Short: "Set the clients allowed to co-sign sensitive operations on a device",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var approvers []string
+		for _, approver := range strings.Split(approverList, ",") {
+			if approver = strings.TrimSpace(approver); approver != "" {
+				approvers = append(approvers, approver)
+			}
+		}
+
+		deviceManager, err := newDeviceManager()
+		if err != nil {
+			return err
+		}
+
+		if err := deviceManager.SetDeviceApprovers(deviceID, approvers); err != nil {
+			return fmt.Errorf("failed to set approvers: %v", err)
+		}
+
+		log.Infof("Device %s approvers: %s", deviceID, strings.Join(approvers, ", "))
+		return nil
+	},
+}
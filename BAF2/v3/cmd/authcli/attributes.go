@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/chaichis-network/v3/internal/auth"
+	"github.com/spf13/cobra"
+)
+
+var serviceID string
+
+func init() {
+	setClientAttributesCmd.Flags().StringVar(&clientID, "client-id", "", "Client whose attributes to set")
+	setClientAttributesCmd.MarkFlagRequired("client-id")
+	clientAttributesCmd.AddCommand(setClientAttributesCmd)
+	rootCmd.AddCommand(clientAttributesCmd)
+
+	for _, cmd := range []*cobra.Command{setDisclosurePolicyCmd, showDisclosurePolicyCmd} {
+		cmd.Flags().StringVar(&serviceID, "service-id", auth.DefaultServiceID, "Service the policy is for")
+	}
+	disclosurePolicyCmd.AddCommand(setDisclosurePolicyCmd)
+	disclosurePolicyCmd.AddCommand(showDisclosurePolicyCmd)
+	rootCmd.AddCommand(disclosurePolicyCmd)
+
+	setAttributeRulesCmd.Flags().StringVar(&deviceID, "device-id", "", "Device ID")
+	setAttributeRulesCmd.MarkFlagRequired("device-id")
+	attributeRulesCmd.AddCommand(setAttributeRulesCmd)
+	rootCmd.AddCommand(attributeRulesCmd)
+}
+
+var clientAttributesCmd = &cobra.Command{
+	Use:   "client-attributes",
+	Short: "Register attributes of a client for services to check",
+	Long: `A client registers attributes about itself (department=ops,
+clearance=secret) with the AS. Its TGTs carry them to the TGS, which puts into
+each service ticket only the attributes the service's disclosure policy names.
+Devices check those against their attribute rules.
+
+Names and values follow the label syntax (see 'authcli labels'); a client
+registers at most 16 attributes.`,
+}
+
+var setClientAttributesCmd = &cobra.Command{
+	Use:   "set [NAME=VALUE...]",
+	Short: "Replace a client's attributes (signed with the client key)",
+	Long: `Replaces all of the client's attributes; without arguments, removes them.
+The change is signed with the client key and reaches services in TGTs issued
+afterwards: run 'authenticate' again or renew the TGT.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		attributes, err := auth.ParseLabels(args)
+		if err != nil {
+			return err
+		}
+
+		clientManager, err := newClientManager()
+		if err != nil {
+			return err
+		}
+		defer clientManager.Close()
+
+		if _, err := clientManager.SetClientAttributes(clientID, attributes); err != nil {
+			return fmt.Errorf("failed to set client attributes: %v", err)
+		}
+		fmt.Printf("Client %s has %d attributes\n", clientID, len(attributes))
+		return nil
+	},
+}
+
+var disclosurePolicyCmd = &cobra.Command{
+	Use:   "disclosure-policy",
+	Short: "Choose the client attributes a service's tickets disclose",
+	Long: `The TGS copies into a service ticket only the client attributes named by the
+service's disclosure policy. A service without a policy learns no attributes.
+Policies are set by the TGS admin MSPs, by identities without a role or with
+the policy-admin role.`,
+}
+
+var setDisclosurePolicyCmd = &cobra.Command{
+	Use:   "set [NAME...]",
+	Short: "Set the attributes disclosed to a service",
+	Long:  `Sets the attributes disclosed to the service; without arguments, it learns none.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		deviceManager, err := newDeviceManager()
+		if err != nil {
+			return err
+		}
+
+		policy, err := deviceManager.SetDisclosurePolicy(serviceID, args)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Service %s learns: %s\n", policy.ServiceID, describeAttributes(policy.Attributes))
+		return nil
+	},
+}
+
+var showDisclosurePolicyCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show the attributes disclosed to a service",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		deviceManager, err := newDeviceManager()
+		if err != nil {
+			return err
+		}
+
+		policy, err := deviceManager.GetDisclosurePolicy(serviceID)
+		if err != nil {
+			return err
+		}
+		if policy == nil {
+			fmt.Printf("Service %s learns: no attributes (no policy)\n", serviceID)
+			return nil
+		}
+		fmt.Printf("Service %s learns: %s\n", policy.ServiceID, describeAttributes(policy.Attributes))
+		fmt.Printf("Set by %s at %s\n", policy.UpdatedBy, policy.UpdatedAt)
+		return nil
+	},
+}
+
+var attributeRulesCmd = &cobra.Command{
+	Use:   "attribute-rules",
+	Short: "Require client attributes for access to a device",
+}
+
+var setAttributeRulesCmd = &cobra.Command{
+	Use:   "set [NAME=VALUE[,VALUE...]...]",
+	Short: "Set the attribute rules of a device (signed with the device key)",
+	Long: `Sets the values each client attribute may take for a session with the
+device, for example clearance=secret,top-secret. A service ticket that does
+not disclose a ruled attribute is refused, so the service's disclosure policy
+must name it. Without arguments, removes the rules. The rules are signed with
+the device key, so run this where the device's keys are.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		rules, err := auth.ParseAttributeRules(args)
+		if err != nil {
+			return err
+		}
+
+		deviceManager, err := newDeviceManager()
+		if err != nil {
+			return err
+		}
+
+		if err := deviceManager.SetDeviceAttributeRules(deviceID, rules); err != nil {
+			return err
+		}
+		fmt.Printf("Device %s has %d attribute rules\n", deviceID, len(rules))
+		return nil
+	},
+}
+
+// describeAttributes lists attribute names for display
+func describeAttributes(attributes []string) string {
+	if len(attributes) == 0 {
+		return "no attributes"
+	}
+	sorted := append([]string(nil), attributes...)
+	sort.Strings(sorted)
+	return strings.Join(sorted, ", ")
+}
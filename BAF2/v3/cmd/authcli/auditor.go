@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// auditorProfile is the built-in profile for read-only auditors. It selects
+// the "auditor" wallet identity, whose certificate carries the role=auditor
+// attribute the chaincodes restrict to queries.
+const auditorProfile = "auditor"
+
+// builtinProfiles are available without a settings file
+var builtinProfiles = map[string]map[string]interface{}{
+	auditorProfile: {"identity": "auditor"},
+}
+
+// auditorCommands are the commands available under the auditor profile. The
+// chaincodes refuse everything else anyway; refusing it here first gives a
+// clearer error than an endorsement failure, and refuses commands that
+// would otherwise change local state before reaching the ledger.
+var auditorCommands = map[string]bool{
+	"admin selftest":           true,
+	"approvals list":           true,
+	"approvals status":         true,
+	"bench connections":        true,
+	"break-glass list":         true,
+	"break-glass show":         true,
+	"capability-profiles list": true,
+	"capability-profiles show": true,
+	"challenge-channel show":   true,
+	"challenge-channel status": true,
+	"device-classes list":      true,
+	"device-classes show":      true,
+	"device-config get":        true,
+	"diff":                     true,
+	"help":                     true,
+	"history device":           true,
+	"history session":          true,
+	"journal show":             true,
+	"lease show":               true,
+	"limits get":               true,
+	"list-sessions":            true,
+	"load-limits show":         true,
+	"logs":                     true,
+	"maintenance show":         true,
+	"metrics":                  true,
+	"padding show":             true,
+	"protocol":                 true,
+	"risk decisions":           true,
+	"risk get-policy":          true,
+	"search clients":           true,
+	"search devices":           true,
+	"service-keys show":        true,
+	"service-keys status":      true,
+	"service-keys verify":      true,
+	"session-policy show":      true,
+	"settings show":            true,
+	"settlements list":         true,
+	"settlements summary":      true,
+	"stream check":             true,
+	"stream list":              true,
+	"tasks pending":            true,
+	"tasks show":               true,
+	"terms acknowledgement":    true,
+	"terms get-policy":         true,
+	"verify-local":             true,
+	"whoami":                   true,
+}
+
+// checkAuditorCommand refuses commands outside auditorCommands when the
+// auditor profile is active
+func checkAuditorCommand(cmd *cobra.Command) error {
+	if activeProfile != auditorProfile {
+		return nil
+	}
+	path := strings.TrimPrefix(cmd.CommandPath(), cmd.Root().Name()+" ")
+	if auditorCommands[path] || strings.HasPrefix(path, "completion") {
+		return nil
+	}
+	return fmt.Errorf("'%s' is not available under the %s profile, which is read-only", path, auditorProfile)
+}
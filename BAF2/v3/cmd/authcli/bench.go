@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/chaichis-network/v3/internal/fabric"
+	"github.com/chaichis-network/v3/pkg/table"
+	"github.com/spf13/cobra"
+)
+
+var benchIterations int
+
+func init() {
+	benchConnectionsCmd.Flags().IntVar(&benchIterations, "iterations", 10, "Steps to time in each mode")
+	addListFlags(benchConnectionsCmd)
+
+	benchCmd.AddCommand(benchConnectionsCmd)
+	rootCmd.AddCommand(benchCmd)
+}
+
+var benchCmd = &cobra.Command{
+	Use:   "bench",
+	Short: "Measure latencies against the network",
+}
+
+var benchConnectionsCmd = &cobra.Command{
+	Use:   "connections",
+	Short: "Compare fresh and reused gateway connections",
+	Long: `Times a sequence of steps that each build a Fabric client, connect, query the
+AS and close, as separate authcli commands do: first with a new gateway
+connection per step, then with the steps sharing one through a connection
+pool, as the steps of one command do. The first step of each mode includes
+connecting; the difference in the others is what reuse saves per step.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		result, err := fabric.BenchmarkConnections(fabric.ClientOptions{
+			ConfigPath:      configPath,
+			WalletPath:      walletPath,
+			Wallet:          walletOptions(),
+			Debug:           debugMode,
+			Peers:           peerRoles(),
+			AgeIdentityFile: ageIdentity,
+			API:             fabricAPI,
+			GatewayPeer:     gatewayPeer,
+			Strict:          strictMode,
+		}, identityName, benchIterations)
+		if err != nil {
+			return fmt.Errorf("benchmark failed: %v", err)
+		}
+
+		t := table.New("mode", "steps", "first", "mean", "p50", "p95", "max", "total")
+		for _, mode := range []struct {
+			name  string
+			stats fabric.LatencyStats
+		}{{"fresh", result.Fresh}, {"pooled", result.Pooled}} {
+			t.Append(mode.name, fmt.Sprint(result.Iterations), durationCell(mode.stats.First), durationCell(mode.stats.Mean),
+				durationCell(mode.stats.P50), durationCell(mode.stats.P95), durationCell(mode.stats.Max), durationCell(mode.stats.Total))
+		}
+		return printList(t, result)
+	},
+}
+
+func durationCell(d time.Duration) string {
+	return d.Round(time.Millisecond).String()
+}
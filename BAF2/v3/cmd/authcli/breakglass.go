@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/chaichis-network/v3/internal/fabric"
+	"github.com/chaichis-network/v3/pkg/table"
+	"github.com/spf13/cobra"
+)
+
+var (
+	emergencyReason   string
+	emergencyLifetime time.Duration
+	emergencySummary  string
+)
+
+func init() {
+	openEmergencyCmd.Flags().StringVar(&deviceID, "device-id", "", "Device to open the session to")
+	openEmergencyCmd.Flags().StringVar(&emergencyReason, "reason", "", "Why ticketed access cannot be used (at least 10 characters)")
+	openEmergencyCmd.Flags().DurationVar(&emergencyLifetime, "duration", 0, "Session lifetime, at most 2h (default: 30m)")
+	openEmergencyCmd.MarkFlagRequired("device-id")
+	openEmergencyCmd.MarkFlagRequired("reason")
+
+	closeEmergencyCmd.Flags().StringVar(&emergencySummary, "summary", "", "What was done during the session")
+	closeEmergencyCmd.MarkFlagRequired("summary")
+
+	listEmergencyCmd.Flags().StringVar(&deviceID, "device-id", "", "Only list sessions to this device")
+	addListFlags(listEmergencyCmd)
+
+	breakGlassCmd.AddCommand(openEmergencyCmd)
+	breakGlassCmd.AddCommand(closeEmergencyCmd)
+	breakGlassCmd.AddCommand(showEmergencyCmd)
+	breakGlassCmd.AddCommand(listEmergencyCmd)
+
+	rootCmd.AddCommand(breakGlassCmd)
+}
+
+var breakGlassCmd = &cobra.Command{
+	Use:   "break-glass",
+	Short: "Open emergency device sessions without tickets, for incident response",
+	Long: `Break-glass sessions reach any device without going through the AS and
+TGS, for incident response while they cannot issue tickets. Only identities
+enrolled with the break_glass attribute may open them:
+
+  fabric-ca-client register --id.name responder1 --id.attrs 'break_glass=true:ecert'
+
+A session needs a reason, lasts at most two hours and cannot be extended.
+Opening and closing it emit EmergencyAccessOpened and EmergencyAccessClosed
+events for paging, and every step is kept in the session's trail and the
+device's access log. Expired sessions are closed by 'lease sweep'.`,
+}
+
+var openEmergencyCmd = &cobra.Command{
+	Use:   "open",
+	Short: "Open a break-glass session to a device",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := confirmDestructive(fmt.Sprintf("open a break-glass session to device %s, bypassing ticketing", deviceID), 1); err != nil {
+			return err
+		}
+		deviceManager, err := newDeviceManager()
+		if err != nil {
+			return err
+		}
+
+		access, err := deviceManager.OpenEmergencySession(deviceID, emergencyReason, emergencyLifetime)
+		if err != nil {
+			return fmt.Errorf("failed to open break-glass session: %v", err)
+		}
+		fmt.Printf("Break-glass access %s\n", access.AccessID)
+		fmt.Printf("Session %s to %s until %s\n", access.SessionID, access.DeviceID, access.ExpiresAt.Local().Format(time.RFC3339))
+		fmt.Printf("Close it with: authcli break-glass close %s --summary ...\n", access.AccessID)
+		return nil
+	},
+}
+
+var closeEmergencyCmd = &cobra.Command{
+	Use:   "close ACCESS_ID",
+	Short: "Close a break-glass session with a summary of the work done",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		deviceManager, err := newDeviceManager()
+		if err != nil {
+			return err
+		}
+
+		access, err := deviceManager.CloseEmergencySession(args[0], emergencySummary)
+		if err != nil {
+			return fmt.Errorf("failed to close break-glass session: %v", err)
+		}
+		fmt.Printf("Break-glass session %s closed by %s\n", access.SessionID, access.ClosedBy)
+		return nil
+	},
+}
+
+var showEmergencyCmd = &cobra.Command{
+	Use:   "show ACCESS_ID",
+	Short: "Show a break-glass session and its audit trail",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		deviceManager, err := newDeviceManager()
+		if err != nil {
+			return err
+		}
+
+		access, err := deviceManager.GetEmergencyAccess(args[0])
+		if err != nil {
+			return err
+		}
+		return printJSON(access)
+	},
+}
+
+var listEmergencyCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List break-glass sessions, oldest first",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		deviceManager, err := newDeviceManager()
+		if err != nil {
+			return err
+		}
+
+		accesses, err := deviceManager.EmergencyAccesses(deviceID)
+		if err != nil {
+			return fmt.Errorf("failed to list break-glass sessions: %v", err)
+		}
+		return printList(emergencyAccessTable(accesses), accesses)
+	},
+}
+
+func emergencyAccessTable(accesses []*fabric.EmergencyAccess) *table.Table {
+	t := table.New("access", "status", "device", "responder", "msp", "opened", "expires", "reason")
+	for _, access := range accesses {
+		t.Append(access.AccessID, access.Status, access.DeviceID, access.Responder, access.ResponderMSP,
+			timeCell(access.OpenedAt), timeCell(access.ExpiresAt), access.Reason)
+	}
+	return t
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/chaichis-network/v3/pkg/table"
+	"github.com/spf13/cobra"
+)
+
+var (
+	capabilityProfile  string
+	profileDescription string
+	profileVersion     int
+)
+
+func init() {
+	setCapabilityProfileCmd.Flags().StringVar(&capabilityProfile, "id", "", "Profile ID, e.g. temperature-sensor-v1")
+	setCapabilityProfileCmd.Flags().StringSliceVar(&capabilities, "capabilities", nil, "Capabilities of the profile (comma-separated)")
+	setCapabilityProfileCmd.Flags().StringVar(&profileDescription, "description", "", "What devices the profile is for")
+	setCapabilityProfileCmd.MarkFlagRequired("id")
+	setCapabilityProfileCmd.MarkFlagRequired("capabilities")
+
+	showCapabilityProfileCmd.Flags().StringVar(&capabilityProfile, "id", "", "Profile ID")
+	showCapabilityProfileCmd.Flags().IntVar(&profileVersion, "version", 0, "Version to show (default: the current one)")
+	showCapabilityProfileCmd.MarkFlagRequired("id")
+
+	addListFlags(listCapabilityProfilesCmd)
+
+	capabilityProfilesCmd.AddCommand(setCapabilityProfileCmd)
+	capabilityProfilesCmd.AddCommand(showCapabilityProfileCmd)
+	capabilityProfilesCmd.AddCommand(listCapabilityProfilesCmd)
+
+	rootCmd.AddCommand(capabilityProfilesCmd)
+}
+
+var capabilityProfilesCmd = &cobra.Command{
+	Use:   "capability-profiles",
+	Short: "Manage reusable, versioned device capability sets",
+	Long: `A capability profile names a capability set, e.g. temperature-sensor-v1 =
+read-temp,report-status. Devices registered with
+'register-device --capability-profile' follow the profile: updating it
+publishes a new version, which applies to sessions opened afterwards.
+Sessions already open keep the version they were opened under.`,
+}
+
+var setCapabilityProfileCmd = &cobra.Command{
+	Use:   "set",
+	Short: "Create a profile or publish a new version of it",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		deviceManager, err := newDeviceManager()
+		if err != nil {
+			return err
+		}
+
+		profile, err := deviceManager.SetCapabilityProfile(capabilityProfile, capabilities, profileDescription)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Capability profile %s is at version %d: %s\n", profile.ProfileID, profile.Version, strings.Join(profile.Capabilities, ", "))
+		return nil
+	},
+}
+
+var showCapabilityProfileCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show a profile, or one of its versions",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		deviceManager, err := newDeviceManager()
+		if err != nil {
+			return err
+		}
+
+		profile, err := deviceManager.GetCapabilityProfile(capabilityProfile, profileVersion)
+		if err != nil {
+			return err
+		}
+		return printJSON(profile)
+	},
+}
+
+var listCapabilityProfilesCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the current version of every profile",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		deviceManager, err := newDeviceManager()
+		if err != nil {
+			return err
+		}
+
+		profiles, err := deviceManager.ListCapabilityProfiles()
+		if err != nil {
+			return err
+		}
+		t := table.New("profile", "version", "owner", "capabilities", "description")
+		for _, profile := range profiles {
+			t.Append(profile.ProfileID, profile.Version, profile.Owner, strings.Join(profile.Capabilities, ","), profile.Description)
+		}
+		return printList(t, profiles)
+	},
+}
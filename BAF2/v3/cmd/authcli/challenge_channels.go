@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/chaichis-network/v3/internal/auth"
+	"github.com/chaichis-network/v3/internal/crypto"
+	"github.com/spf13/cobra"
+)
+
+var (
+	challengeEndpoint string
+	appPublicKeyFile  string
+	appKeyID          string
+	pushApprove       bool
+	pushDeny          bool
+	pushWait          time.Duration
+)
+
+func init() {
+	setChallengeChannelCmd.Flags().StringVar(&challengeEndpoint, "endpoint", "", "http(s) URL of the app push challenges are posted to")
+	setChallengeChannelCmd.Flags().StringVar(&appPublicKeyFile, "app-public-key", "", "PEM public key the app signs answers with (default: a key stored under --app-key-id)")
+	setChallengeChannelCmd.Flags().StringVar(&keyTypeName, "key-type", "rsa", "Type of key pair to generate under --app-key-id if there is none (rsa, ec-p256)")
+	setChallengeChannelCmd.MarkFlagRequired("endpoint")
+
+	answerPushChallengeCmd.Flags().BoolVar(&pushApprove, "approve", false, "Approve the attempt")
+	answerPushChallengeCmd.Flags().BoolVar(&pushDeny, "deny", false, "Deny the attempt")
+
+	for _, cmd := range []*cobra.Command{setChallengeChannelCmd, answerPushChallengeCmd} {
+		cmd.Flags().StringVar(&appKeyID, "app-key-id", "", "Key store ID of the app's key (default: <client-id>-app)")
+	}
+	for _, cmd := range []*cobra.Command{setChallengeChannelCmd, showChallengeChannelCmd, removeChallengeChannelCmd, stepUpStatusCmd, answerPushChallengeCmd} {
+		cmd.Flags().StringVar(&clientID, "client-id", "", "Client ID")
+		cmd.MarkFlagRequired("client-id")
+		challengeChannelCmd.AddCommand(cmd)
+	}
+	rootCmd.AddCommand(challengeChannelCmd)
+}
+
+var challengeChannelCmd = &cobra.Command{
+	Use:   "challenge-channel",
+	Short: "Approve step-ups on a phone (push challenges)",
+	Long: `When the AS risk policy's step-up method is "push", the step-up carries a
+challenge for the app registered as the client's challenge channel. authgrpc
+started with --deliver-challenges posts it to the app's endpoint; the app signs
+its owner's answer with its own key and submits it. Authenticate with
+--push-wait to wait for the answer instead of starting again.
+
+The channel is registered and removed with the client's key. 'answer' signs
+as the app would, with a key from the local key store, for testing and for
+apps that call authcli.`,
+}
+
+var setChallengeChannelCmd = &cobra.Command{
+	Use:   "set",
+	Short: "Register the app push challenges are delivered to (signed with the client key)",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var publicKeyPEM string
+		if appPublicKeyFile != "" {
+			pemBytes, err := ioutil.ReadFile(appPublicKeyFile)
+			if err != nil {
+				return fmt.Errorf("failed to read app public key: %v", err)
+			}
+			publicKeyPEM = string(pemBytes)
+		} else {
+			keyType, err := crypto.ParseKeyType(keyTypeName)
+			if err != nil {
+				return err
+			}
+			id := appKeyIDFor(clientID)
+			if _, err := crypto.LoadOrGenerateKeys(id, keyType); err != nil {
+				return fmt.Errorf("failed to load or generate app keys: %v", err)
+			}
+			if publicKeyPEM, err = crypto.GetPublicKeyPEM(id); err != nil {
+				return fmt.Errorf("failed to get app public key: %v", err)
+			}
+			fmt.Printf("App key: %s (answer with --app-key-id %s)\n", id, id)
+		}
+
+		clientManager, err := newClientManager()
+		if err != nil {
+			return err
+		}
+		defer clientManager.Close()
+
+		channel, err := clientManager.SetChallengeChannel(clientID, challengeEndpoint, publicKeyPEM)
+		if err != nil {
+			return fmt.Errorf("failed to set challenge channel: %v", err)
+		}
+		fmt.Printf("Push challenges for %s go to %s (%s key)\n", channel.ClientID, channel.Endpoint, channel.KeyType)
+		return nil
+	},
+}
+
+var showChallengeChannelCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show a client's challenge channel",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		clientManager, err := newClientManager()
+		if err != nil {
+			return err
+		}
+		defer clientManager.Close()
+
+		channel, err := clientManager.ChallengeChannel(clientID)
+		if err != nil {
+			return err
+		}
+		if channel == nil {
+			fmt.Printf("Client %s has no challenge channel\n", clientID)
+			return nil
+		}
+		return printJSON(channel)
+	},
+}
+
+var removeChallengeChannelCmd = &cobra.Command{
+	Use:   "remove",
+	Short: "Remove a client's challenge channel (signed with the client key)",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		clientManager, err := newClientManager()
+		if err != nil {
+			return err
+		}
+		defer clientManager.Close()
+
+		if err := clientManager.RemoveChallengeChannel(clientID); err != nil {
+			return fmt.Errorf("failed to remove challenge channel: %v", err)
+		}
+		return nil
+	},
+}
+
+var stepUpStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show a client's pending step-up",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		clientManager, err := newClientManager()
+		if err != nil {
+			return err
+		}
+		defer clientManager.Close()
+
+		status, err := clientManager.StepUpStatus(clientID)
+		if err != nil {
+			return err
+		}
+		if status == nil {
+			fmt.Printf("No step-up is pending for client %s\n", clientID)
+			return nil
+		}
+		return printJSON(status)
+	},
+}
+
+var answerPushChallengeCmd = &cobra.Command{
+	Use:   "answer",
+	Short: "Approve or deny a client's push step-up as its app (signed with the app key)",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if pushApprove == pushDeny {
+			return fmt.Errorf("give one of --approve and --deny")
+		}
+		answer := auth.PushAnswerApprove
+		if pushDeny {
+			answer = auth.PushAnswerDeny
+		}
+
+		clientManager, err := newClientManager()
+		if err != nil {
+			return err
+		}
+		defer clientManager.Close()
+
+		if err := clientManager.AnswerPushChallenge(clientID, appKeyIDFor(clientID), answer); err != nil {
+			return fmt.Errorf("failed to answer push challenge: %v", err)
+		}
+		return nil
+	},
+}
+
+// appKeyIDFor returns --app-key-id, or the default app key ID of a client
+func appKeyIDFor(clientID string) string {
+	if appKeyID != "" {
+		return appKeyID
+	}
+	return auth.AppKeyID(clientID)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/chaichis-network/v3/internal/crypto"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	deregisterClientCmd.Flags().StringVar(&clientID, "client-id", "", "Client to deregister")
+	deregisterClientCmd.MarkFlagRequired("client-id")
+
+	rotateClientKeyCmd.Flags().StringVar(&clientID, "client-id", "", "Client whose key to rotate")
+	rotateClientKeyCmd.Flags().StringVar(&keyTypeName, "key-type", "", "Type of the new key pair (rsa, ec-p256; default: the current key's type)")
+	rotateClientKeyCmd.MarkFlagRequired("client-id")
+
+	rootCmd.AddCommand(deregisterClientCmd)
+	rootCmd.AddCommand(rotateClientKeyCmd)
+}
+
+var deregisterClientCmd = &cobra.Command{
+	Use:   "deregister-client",
+	Short: "Remove a client's registration and local keys",
+	Long: `Removes the client's registration from the AS, signed with the client's
+key. The TGS refuses the client's TGTs from then on. The client's keys and its
+saved TGT and service tickets are deleted; the client ID can be registered
+again with 'register-client'.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := confirmDestructive("deregister client "+clientID+" and delete its keys", 1); err != nil {
+			return err
+		}
+
+		clientManager, err := newClientManager()
+		if err != nil {
+			return err
+		}
+		defer clientManager.Close()
+
+		if err := clientManager.DeregisterClient(clientID); err != nil {
+			return fmt.Errorf("failed to deregister client: %v", err)
+		}
+		fmt.Printf("Client %s deregistered\n", clientID)
+		return nil
+	},
+}
+
+var rotateClientKeyCmd = &cobra.Command{
+	Use:   "rotate-client-key",
+	Short: "Replace a client's key pair",
+	Long: `Generates a new key pair for the client and registers it with the AS in
+place of the current one, signed with the current key. TGTs issued before the
+rotation can no longer be renewed or used at the TGS, so the saved TGT and
+service tickets are deleted: run 'authenticate' again afterwards.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var keyType crypto.KeyType
+		if keyTypeName != "" {
+			var err error
+			if keyType, err = crypto.ParseKeyType(keyTypeName); err != nil {
+				return err
+			}
+		}
+
+		clientManager, err := newClientManager()
+		if err != nil {
+			return err
+		}
+		defer clientManager.Close()
+
+		client, err := clientManager.RotateClientKey(clientID, keyType)
+		if err != nil {
+			return fmt.Errorf("failed to rotate client key: %v", err)
+		}
+		fmt.Printf("Key of client %s rotated to a %v key at %v\n", clientID, client["keyType"], client["keyRotatedAt"])
+		return nil
+	},
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/chaichis-network/v3/internal/auth"
+	"github.com/spf13/cobra"
+)
+
+var closeSessionsJSON bool
+
+func init() {
+	closeSessionsCmd.Flags().StringVar(&clientID, "client-id", "", "Close all sessions of this client")
+	closeSessionsCmd.Flags().StringVar(&deviceID, "device-id", "", "Close all sessions on this device")
+	closeSessionsCmd.Flags().BoolVar(&closeSessionsJSON, "json", false, "Print the summary as JSON")
+
+	rootCmd.AddCommand(closeSessionsCmd)
+}
+
+var closeSessionsCmd = &cobra.Command{
+	Use:   "close-sessions",
+	Short: "Close all sessions of a client or on a device",
+	Long: `Closes every active session matching --client-id, --device-id or both, on
+the ledger and in local session files. Use it when a client is decommissioned
+or a device goes into maintenance. Exits non-zero if any session fails to close.`,
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+		if clientID == "" && deviceID == "" {
+			return fmt.Errorf("--client-id or --device-id is required")
+		}
+
+		deviceManager, err := newDeviceManager()
+		if err != nil {
+			return err
+		}
+
+		sessions, err := openSessionStore()
+		if err != nil {
+			return err
+		}
+		targets, err := deviceManager.FindSessions(clientID, deviceID, sessions)
+		if err != nil {
+			return fmt.Errorf("failed to find sessions: %v", err)
+		}
+		if len(targets) > 0 {
+			if err := confirmDestructive(fmt.Sprintf("close %d sessions", len(targets)), len(targets)); err != nil {
+				return err
+			}
+		}
+
+		reporter := newProgress("close-sessions", len(targets))
+		defer func() { reporter.Done(err) }()
+
+		summary := deviceManager.CloseSessionTargets(targets, sessions, func(result auth.SessionCloseResult) {
+			reporter.Step(result.SessionID)
+		})
+
+		if closeSessionsJSON {
+			output, err := json.MarshalIndent(summary, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to marshal summary: %v", err)
+			}
+			fmt.Println(string(output))
+		} else {
+			for _, result := range summary.Results {
+				status := "closed"
+				if result.Error != "" {
+					status = "FAILED: " + result.Error
+				} else if result.LocalOnly {
+					status = "removed stale local session"
+				}
+				fmt.Printf("%s (client %s, device %s): %s\n", result.SessionID, result.ClientID, result.DeviceID, status)
+			}
+			fmt.Printf("%d closed, %d failed\n", summary.Closed, summary.Failed)
+		}
+
+		if summary.Failed > 0 {
+			return fmt.Errorf("%d sessions could not be closed", summary.Failed)
+		}
+		return nil
+	},
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/chaichis-network/v3/internal/fabric"
+)
+
+var assumeYes bool
+
+func init() {
+	rootCmd.PersistentFlags().BoolVarP(&assumeYes, "yes", "y", false, "Skip confirmation prompts for destructive operations")
+}
+
+// confirmDestructive shows which identity and network a destructive
+// operation is about to act on, and how many records it affects, then asks
+// the operator to confirm. Operators with several profiles see where they
+// are pointed before anything changes. --yes skips the question; without a
+// terminal to ask on, the operation is refused unless --yes is given.
+// records < 0 means the count is not known in advance.
+func confirmDestructive(action string, records int) error {
+	identity := identityName
+	if wallet, err := fabric.OpenWallet(walletPath, walletOptions()); err == nil {
+		if x509Identity, err := wallet.Get(identityName); err == nil {
+			identity = fmt.Sprintf("%s (%s)", identityName, x509Identity.MspID)
+		}
+	}
+	profile, err := filepath.Abs(configPath)
+	if err != nil {
+		profile = configPath
+	}
+
+	fmt.Fprintf(os.Stderr, "About to %s\n", action)
+	fmt.Fprintf(os.Stderr, "  identity: %s\n", identity)
+	fmt.Fprintf(os.Stderr, "  network:  %s, channel %s\n", profile, fabric.DefaultChannel)
+	if records >= 0 {
+		fmt.Fprintf(os.Stderr, "  records:  %d\n", records)
+	}
+
+	if assumeYes {
+		return nil
+	}
+	if info, err := os.Stdin.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return fmt.Errorf("refusing to %s without confirmation; re-run with --yes", action)
+	}
+
+	fmt.Fprint(os.Stderr, "Proceed? [y/N]: ")
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && answer == "" {
+		fmt.Fprintln(os.Stderr)
+		return fmt.Errorf("refusing to %s without confirmation; re-run with --yes", action)
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return nil
+	}
+	return fmt.Errorf("aborted")
+}
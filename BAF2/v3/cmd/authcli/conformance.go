@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/chaichis-network/v3/internal/fabric"
+	"github.com/chaichis-network/v3/pkg/conformance"
+	"github.com/spf13/cobra"
+)
+
+var (
+	conformanceTarget  string
+	conformanceOffline bool
+	conformanceJSON    bool
+)
+
+func init() {
+	conformanceCmd.Flags().StringVar(&conformanceTarget, "target", "", "Base URL of the client implementation's conformance endpoint")
+	conformanceCmd.Flags().StringVar(&clientID, "client-id", "", "Client ID to use for the flow checks (default: generated)")
+	conformanceCmd.Flags().BoolVar(&conformanceOffline, "offline", false, "Run only the offline checks (no test network)")
+	conformanceCmd.Flags().BoolVar(&conformanceJSON, "json", false, "Print the report as JSON")
+	conformanceCmd.MarkFlagRequired("target")
+
+	rootCmd.AddCommand(conformanceCmd)
+}
+
+// conformanceNetwork adapts the AS and TGS contracts to the suite's Network interface
+type conformanceNetwork struct {
+	*fabric.AuthServerContract
+	*fabric.TicketGrantingContract
+}
+
+var conformanceCmd = &cobra.Command{
+	Use:   "conformance",
+	Short: "Run the conformance suite against a third-party client implementation",
+	Long: `Drives a client implementation through the authentication flow and reports
+spec violations. The implementation must expose the conformance endpoint
+described in docs/conformance.md.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var network conformance.Network
+		if !conformanceOffline {
+			// Create Fabric client
+			fabricClient, err := fabric.NewClient(fabric.ClientOptions{
+				ConfigPath:      configPath,
+				WalletPath:      walletPath,
+				Wallet:          walletOptions(),
+				Debug:           debugMode,
+				Peers:           peerRoles(),
+				AgeIdentityFile: ageIdentity,
+				API:             fabricAPI,
+				GatewayPeer:     gatewayPeer,
+				Strict:          strictMode,
+				FlowID:          flowID,
+				Pool:            connectionPool,
+				TransactionLog:  transactionLog,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to create Fabric client: %v", err)
+			}
+
+			// Ensure identity exists in wallet
+			if err := fabricClient.EnsureIdentity(identityName); err != nil {
+				return fmt.Errorf("failed to ensure identity: %v", err)
+			}
+
+			if err := fabricClient.Connect(identityName); err != nil {
+				return fmt.Errorf("failed to connect to Fabric network: %v", err)
+			}
+			defer fabricClient.Close()
+
+			asContract, err := fabric.NewAuthServerContract(fabricClient)
+			if err != nil {
+				return fmt.Errorf("failed to get AS contract: %v", err)
+			}
+			tgsContract, err := fabric.NewTicketGrantingContract(fabricClient)
+			if err != nil {
+				return fmt.Errorf("failed to get TGS contract: %v", err)
+			}
+			network = conformanceNetwork{asContract, tgsContract}
+		}
+
+		suite := conformance.NewSuite(conformance.NewHTTPTarget(conformanceTarget), network, clientID)
+		reporter := newProgress("conformance", 0)
+		suite.OnResult = func(result conformance.Result) {
+			reporter.Step(result.ID)
+		}
+		report := suite.Run()
+		reporter.Done(nil)
+
+		if conformanceJSON {
+			reportJSON, err := json.MarshalIndent(report, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to marshal report: %v", err)
+			}
+			fmt.Println(string(reportJSON))
+		} else {
+			fmt.Printf("Conformance report for %s (client %s):\n", conformanceTarget, report.ClientID)
+			for _, result := range report.Results {
+				status := "PASS"
+				if result.Skipped {
+					status = "SKIP"
+				} else if !result.Passed {
+					status = "FAIL"
+				}
+				fmt.Printf("  [%s] %s %s\n", status, result.ID, result.Description)
+				if result.Detail != "" {
+					fmt.Printf("         %s\n", result.Detail)
+				}
+			}
+		}
+
+		if failed := report.Failed(); failed > 0 {
+			fmt.Fprintf(os.Stderr, "%d spec violation(s) found\n", failed)
+			return fmt.Errorf("conformance suite failed")
+		}
+		return nil
+	},
+}
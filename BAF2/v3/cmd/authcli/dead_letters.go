@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/chaichis-network/v3/internal/auth"
+	"github.com/chaichis-network/v3/pkg/table"
+	"github.com/spf13/cobra"
+)
+
+var (
+	deadLetterDir         string
+	deadLettersQuarantine bool
+	deadLettersAll        bool
+)
+
+func init() {
+	deadLettersCmd.PersistentFlags().StringVar(&deadLetterDir, "dead-letter-dir", auth.DefaultDeadLetterDir, "Dead-letter directory of the authgrpc server forwarding the events")
+
+	addListFlags(deadLettersListCmd)
+	deadLettersListCmd.Flags().BoolVar(&deadLettersQuarantine, "quarantined", false, "Only list quarantined events")
+	deadLettersReplayCmd.Flags().BoolVar(&deadLettersAll, "all-quarantined", false, "Replay every quarantined event")
+
+	deadLettersCmd.AddCommand(deadLettersListCmd)
+	deadLettersCmd.AddCommand(deadLettersShowCmd)
+	deadLettersCmd.AddCommand(deadLettersReplayCmd)
+	deadLettersCmd.AddCommand(deadLettersRemoveCmd)
+	rootCmd.AddCommand(deadLettersCmd)
+}
+
+var deadLettersCmd = &cobra.Command{
+	Use:   "dead-letters",
+	Short: "Inspect and replay the events authgrpc failed to forward",
+	Long: `authgrpc --forward-events posts chaincode events to a webhook. An event the
+webhook does not take is kept in the dead-letter directory and retried with a
+growing delay; after --dead-letter-attempts failures it is quarantined and
+left for an operator. Run these commands in the server's working directory,
+or point --dead-letter-dir at its dead-letter directory.`,
+}
+
+var deadLettersListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the dead-lettered events",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		queue, err := auth.OpenDeadLetterQueue(deadLetterDir, auth.DeadLetterOptions{})
+		if err != nil {
+			return err
+		}
+		letters, err := queue.List()
+		if err != nil {
+			return err
+		}
+
+		var listed []*auth.DeadLetter
+		t := table.New("id", "sink", "attempts", "first failure", "next attempt", "state", "last error")
+		for _, letter := range letters {
+			if deadLettersQuarantine && !letter.Quarantined {
+				continue
+			}
+			state := "retrying"
+			if letter.Quarantined {
+				state = "quarantined"
+			}
+			t.Append(letter.ID, letter.Sink, letter.Attempts, timeCell(letter.FirstFailedAt), timeCell(letter.NextAttemptAt), state, letter.LastError)
+			listed = append(listed, letter)
+		}
+		return printList(t, listed)
+	},
+}
+
+var deadLettersShowCmd = &cobra.Command{
+	Use:   "show ID",
+	Short: "Show a dead-lettered event",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		queue, err := auth.OpenDeadLetterQueue(deadLetterDir, auth.DeadLetterOptions{})
+		if err != nil {
+			return err
+		}
+		letter, err := queue.Get(args[0])
+		if err != nil {
+			return err
+		}
+		return printJSON(letter)
+	},
+}
+
+var deadLettersReplayCmd = &cobra.Command{
+	Use:   "replay [ID...]",
+	Short: "Deliver dead-lettered events now",
+	Long: `Posts the given events, quarantined or not, to the sinks they failed to
+reach. A delivered event leaves the queue; one that fails again is retried by
+authgrpc as if it had just failed for the first time.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 && !deadLettersAll {
+			return fmt.Errorf("name the events to replay, or give --all-quarantined")
+		}
+		queue, err := auth.OpenDeadLetterQueue(deadLetterDir, auth.DeadLetterOptions{})
+		if err != nil {
+			return err
+		}
+		ids := args
+		if deadLettersAll {
+			letters, err := queue.List()
+			if err != nil {
+				return err
+			}
+			for _, letter := range letters {
+				if letter.Quarantined {
+					ids = append(ids, letter.ID)
+				}
+			}
+		}
+
+		failed := 0
+		for _, id := range ids {
+			if err := queue.Replay(id, auth.DeliverDeadLetter); err != nil {
+				log.Warnf("Dead letter %s not delivered: %v", id, err)
+				failed++
+				continue
+			}
+			log.Infof("Delivered dead letter %s", id)
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d of %d dead letters not delivered", failed, len(ids))
+		}
+		return nil
+	},
+}
+
+var deadLettersRemoveCmd = &cobra.Command{
+	Use:   "remove ID...",
+	Short: "Drop dead-lettered events without delivering them",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		queue, err := auth.OpenDeadLetterQueue(deadLetterDir, auth.DeadLetterOptions{})
+		if err != nil {
+			return err
+		}
+		if err := confirmDestructive(fmt.Sprintf("drop %d dead-lettered events", len(args)), len(args)); err != nil {
+			return err
+		}
+		for _, id := range args {
+			if err := queue.Remove(id); err != nil {
+				return err
+			}
+			log.Infof("Removed dead letter %s", id)
+		}
+		return nil
+	},
+}
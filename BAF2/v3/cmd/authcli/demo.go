@@ -0,0 +1,302 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/chaichis-network/v3/internal/auth"
+	"github.com/chaichis-network/v3/internal/crypto"
+	"github.com/spf13/cobra"
+)
+
+var (
+	demoPrefix   string
+	demoClients  int
+	demoDevices  int
+	demoManifest string
+)
+
+// demoCapabilities are registered for every demo device
+var demoCapabilities = []string{"read", "write", "telemetry"}
+
+// DemoManifest records everything 'demo up' created, so 'demo down' can
+// clean it up and the data set can be told apart from real records
+type DemoManifest struct {
+	Label     string                    `json:"label"`
+	CreatedAt time.Time                 `json:"createdAt"`
+	Clients   []string                  `json:"clients"`
+	Devices   []string                  `json:"devices"`
+	Approvers map[string][]string       `json:"approvers,omitempty"`
+	Grants    []DemoGrant               `json:"grants,omitempty"`
+	Sessions  []auth.SessionCloseResult `json:"sessions,omitempty"`
+	Configs   map[string]int64          `json:"configs,omitempty"`
+}
+
+// DemoGrant is a one-time access code minted by 'demo up'
+type DemoGrant struct {
+	DeviceID string `json:"deviceID"`
+	GrantID  string `json:"grantID"`
+	Code     string `json:"code"`
+}
+
+func init() {
+	demoCmd.PersistentFlags().StringVar(&demoManifest, "manifest", "", "Manifest of the demo data set (default: <session-dir>/demo-manifest.json)")
+
+	demoUpCmd.Flags().StringVar(&demoPrefix, "prefix", "demo", "Prefix for the IDs of demo clients and devices")
+	demoUpCmd.Flags().IntVar(&demoClients, "clients", 2, "Number of demo clients to register")
+	demoUpCmd.Flags().IntVar(&demoDevices, "devices", 2, "Number of demo devices to register")
+
+	demoCmd.AddCommand(demoUpCmd)
+	demoCmd.AddCommand(demoDownCmd)
+
+	rootCmd.AddCommand(demoCmd)
+}
+
+var demoCmd = &cobra.Command{
+	Use:   "demo",
+	Short: "Provision or tear down a labeled sample data set on the configured network",
+}
+
+var demoUpCmd = &cobra.Command{
+	Use:   "up",
+	Short: "Register demo clients and devices, grant access and run a full flow",
+	Long: `Provisions a complete sample scenario against the configured network:
+registers demo clients and devices, makes the second client an approver of the
+first device, mints a one-time access code, authenticates every client and
+opens a session on a device, and publishes a telemetry config to each device.
+
+Every ID carries the label <prefix>-<timestamp>, and everything created is
+recorded in a manifest so 'demo down' can clean it up.`,
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+		if demoClients < 1 || demoDevices < 1 {
+			return fmt.Errorf("at least one client and one device are required")
+		}
+		path := demoManifestPath()
+		if _, err := os.Stat(path); err == nil {
+			return fmt.Errorf("a demo data set is already up (%s); run 'demo down' first", path)
+		}
+
+		createdAt := time.Now().UTC()
+		manifest := &DemoManifest{
+			Label:     fmt.Sprintf("%s-%s", demoPrefix, createdAt.Format("20060102150405")),
+			CreatedAt: createdAt,
+			Approvers: map[string][]string{},
+			Configs:   map[string]int64{},
+		}
+		for i := 1; i <= demoClients; i++ {
+			manifest.Clients = append(manifest.Clients, fmt.Sprintf("%s-client%d", manifest.Label, i))
+		}
+		for i := 1; i <= demoDevices; i++ {
+			manifest.Devices = append(manifest.Devices, fmt.Sprintf("%s-device%d", manifest.Label, i))
+		}
+
+		reporter := newProgress("demo up", 5)
+		defer func() { reporter.Done(err) }()
+
+		// Record progress after every step, so a partial run can still be
+		// torn down
+		defer func() {
+			if saveErr := saveDemoManifest(path, manifest); saveErr != nil && err == nil {
+				err = saveErr
+			}
+		}()
+
+		reporter.Set(0, "connecting to network")
+		clientManager, err := newClientManager()
+		if err != nil {
+			return err
+		}
+		defer clientManager.Close()
+		deviceManager, err := newDeviceManager()
+		if err != nil {
+			return err
+		}
+
+		reporter.Step("registering clients and devices")
+		for _, id := range manifest.Clients {
+			if err := clientManager.RegisterClient(id); err != nil {
+				return fmt.Errorf("failed to register demo client %s: %v", id, err)
+			}
+		}
+		for _, id := range manifest.Devices {
+			if err := deviceManager.RegisterDevice(id, demoCapabilities); err != nil {
+				return fmt.Errorf("failed to register demo device %s: %v", id, err)
+			}
+		}
+
+		reporter.Step("granting permissions")
+		if len(manifest.Clients) > 1 {
+			approvers := manifest.Clients[1:]
+			if err := deviceManager.SetDeviceApprovers(manifest.Devices[0], approvers); err != nil {
+				return fmt.Errorf("failed to set approvers for %s: %v", manifest.Devices[0], err)
+			}
+			manifest.Approvers[manifest.Devices[0]] = approvers
+		}
+		lastDevice := manifest.Devices[len(manifest.Devices)-1]
+		grant, err := deviceManager.CreateAccessGrant(lastDevice, []string{"read"}, 24*time.Hour)
+		if err != nil {
+			return fmt.Errorf("failed to create access grant for %s: %v", lastDevice, err)
+		}
+		manifest.Grants = append(manifest.Grants, DemoGrant{DeviceID: grant.DeviceID, GrantID: grant.GrantID, Code: grant.Code})
+
+		reporter.Step("authenticating clients")
+		sessions, err := openSessionStore()
+		if err != nil {
+			return err
+		}
+		for i, client := range manifest.Clients {
+			device := manifest.Devices[i%len(manifest.Devices)]
+			if err := clientManager.Authenticate(client, device); err != nil {
+				return fmt.Errorf("failed to authenticate %s to %s: %v", client, device, err)
+			}
+			session, err := deviceManager.AccessDevice(client, device)
+			if err != nil {
+				return fmt.Errorf("failed to access %s as %s: %v", device, client, err)
+			}
+			manifest.Sessions = append(manifest.Sessions, auth.SessionCloseResult{SessionID: session.SessionID, ClientID: client, DeviceID: device})
+			if err := sessions.SaveSession(session); err != nil {
+				return fmt.Errorf("failed to save session: %v", err)
+			}
+		}
+
+		reporter.Step("publishing telemetry configs")
+		for _, device := range manifest.Devices {
+			configJSON, err := json.Marshal(map[string]interface{}{
+				"label": manifest.Label,
+				"telemetry": map[string]interface{}{
+					"intervalSeconds": 30,
+					"fields":          []string{"temperature", "humidity"},
+				},
+			})
+			if err != nil {
+				return err
+			}
+			if err := deviceManager.SetDeviceConfig(device, configJSON, 1); err != nil {
+				return fmt.Errorf("failed to publish config for %s: %v", device, err)
+			}
+			manifest.Configs[device] = 1
+			if _, err := deviceManager.GetDeviceData(device); err != nil {
+				return fmt.Errorf("failed to read back %s: %v", device, err)
+			}
+		}
+		reporter.Step("demo data set ready")
+
+		fmt.Printf("Demo data set %s is up\n", manifest.Label)
+		fmt.Printf("Clients:  %d\n", len(manifest.Clients))
+		fmt.Printf("Devices:  %d\n", len(manifest.Devices))
+		fmt.Printf("Sessions: %d\n", len(manifest.Sessions))
+		fmt.Printf("Access code for %s: %s\n", grant.DeviceID, grant.Code)
+		fmt.Printf("Manifest: %s\n", path)
+		return nil
+	},
+}
+
+var demoDownCmd = &cobra.Command{
+	Use:   "down",
+	Short: "Clean up the data set created by 'demo up'",
+	Long: `Closes the demo sessions, revokes unredeemed access codes, clears device
+approvers and removes the demo keys, session files and manifest. The ledger
+has no deletes: the demo registrations stay on it, identifiable by their
+label, but can no longer be used without the removed keys.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path := demoManifestPath()
+		manifest, err := loadDemoManifest(path)
+		if err != nil {
+			return err
+		}
+
+		records := len(manifest.Sessions) + len(manifest.Grants) + len(manifest.Approvers)
+		if err := confirmDestructive(fmt.Sprintf("tear down demo data set %s", manifest.Label), records); err != nil {
+			return err
+		}
+
+		deviceManager, err := newDeviceManager()
+		if err != nil {
+			return err
+		}
+
+		sessions, err := openSessionStore()
+		if err != nil {
+			return err
+		}
+
+		failed := 0
+		summary := deviceManager.CloseSessionTargets(manifest.Sessions, sessions, nil)
+		for _, result := range summary.Results {
+			if result.Error != "" {
+				log.Warnf("Failed to close session %s: %s", result.SessionID, result.Error)
+			}
+		}
+		failed += summary.Failed
+
+		for _, grant := range manifest.Grants {
+			// A redeemed or expired code cannot be revoked, which is fine here
+			if err := deviceManager.RevokeAccessGrant(grant.DeviceID, grant.Code); err != nil {
+				log.Infof("Access grant %s not revoked: %v", grant.GrantID, err)
+			}
+		}
+		for device := range manifest.Approvers {
+			if err := deviceManager.SetDeviceApprovers(device, []string{}); err != nil {
+				log.Warnf("Failed to clear approvers of %s: %v", device, err)
+				failed++
+			}
+		}
+
+		if failed > 0 {
+			return fmt.Errorf("%d demo records could not be cleaned up; keys and manifest kept for a retry", failed)
+		}
+
+		for _, id := range append(append([]string{}, manifest.Clients...), manifest.Devices...) {
+			if err := crypto.RemoveKeys(id); err != nil {
+				log.Warnf("Failed to remove keys of %s: %v", id, err)
+			}
+		}
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("failed to remove demo manifest: %v", err)
+		}
+
+		fmt.Printf("Demo data set %s is down\n", manifest.Label)
+		fmt.Println("Registrations remain on the ledger under this label; their keys have been removed.")
+		return nil
+	},
+}
+
+func demoManifestPath() string {
+	if demoManifest != "" {
+		return demoManifest
+	}
+	return filepath.Join(sessionDir, "demo-manifest.json")
+}
+
+func saveDemoManifest(path string, manifest *DemoManifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode demo manifest: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create demo manifest directory: %v", err)
+	}
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write demo manifest: %v", err)
+	}
+	return nil
+}
+
+func loadDemoManifest(path string) (*DemoManifest, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no demo data set is up (%s not found)", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read demo manifest: %v", err)
+	}
+	var manifest DemoManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse demo manifest %s: %v", path, err)
+	}
+	return &manifest, nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/chaichis-network/v3/internal/auth"
+	"github.com/spf13/cobra"
+)
+
+var (
+	configFile    string
+	configVersion int64
+	configOutput  string
+)
+
+func init() {
+	setDeviceConfigCmd.Flags().StringVar(&deviceID, "device-id", "", "Device ID")
+	setDeviceConfigCmd.Flags().StringVar(&configFile, "file", "", "JSON config file to publish")
+	setDeviceConfigCmd.Flags().Int64Var(&configVersion, "version", 0, "Config version (must be higher than the current one)")
+	setDeviceConfigCmd.MarkFlagRequired("device-id")
+	setDeviceConfigCmd.MarkFlagRequired("file")
+	setDeviceConfigCmd.MarkFlagRequired("version")
+
+	getDeviceConfigCmd.Flags().StringVar(&deviceID, "device-id", "", "Device ID")
+	getDeviceConfigCmd.MarkFlagRequired("device-id")
+
+	watchDeviceConfigCmd.Flags().StringVar(&deviceID, "device-id", "", "Device ID")
+	watchDeviceConfigCmd.Flags().StringVar(&configOutput, "output", "", "File the device reads its config from")
+	watchDeviceConfigCmd.MarkFlagRequired("device-id")
+	watchDeviceConfigCmd.MarkFlagRequired("output")
+
+	deviceConfigCmd.AddCommand(setDeviceConfigCmd)
+	deviceConfigCmd.AddCommand(getDeviceConfigCmd)
+	deviceConfigCmd.AddCommand(watchDeviceConfigCmd)
+
+	rootCmd.AddCommand(deviceConfigCmd)
+}
+
+var deviceConfigCmd = &cobra.Command{
+	Use:   "device-config",
+	Short: "Distribute device configuration through the ledger",
+}
+
+var setDeviceConfigCmd = &cobra.Command{
+	Use:   "set",
+	Short: "Publish a new config version for a device",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		configJSON, err := ioutil.ReadFile(configFile)
+		if err != nil {
+			return fmt.Errorf("failed to read config file: %v", err)
+		}
+
+		deviceManager, err := newDeviceManager()
+		if err != nil {
+			return err
+		}
+
+		if err := deviceManager.SetDeviceConfig(deviceID, configJSON, configVersion); err != nil {
+			return fmt.Errorf("failed to set device config: %v", err)
+		}
+		return nil
+	},
+}
+
+var getDeviceConfigCmd = &cobra.Command{
+	Use:   "get",
+	Short: "Show the current config of a device and its acknowledgement",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		deviceManager, err := newDeviceManager()
+		if err != nil {
+			return err
+		}
+
+		config, err := deviceManager.GetDeviceConfig(deviceID)
+		if err != nil {
+			return fmt.Errorf("failed to get device config: %v", err)
+		}
+
+		output, err := json.MarshalIndent(config, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal device config: %v", err)
+		}
+		fmt.Println(string(output))
+		return nil
+	},
+}
+
+var watchDeviceConfigCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Run as the device agent: apply and acknowledge config changes",
+	Long: `Subscribes to config change events for the device, writes each new config
+to --output and acknowledges it on the ledger. Acknowledgements are signed
+with the device key, so this runs where the device key is kept.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		deviceManager, err := newDeviceManager()
+		if err != nil {
+			return err
+		}
+
+		stop := make(chan struct{})
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-signals
+			close(stop)
+		}()
+
+		log.Infof("Watching config changes for device %s", deviceID)
+		return deviceManager.WatchDeviceConfig(deviceID, writeConfigFile, stop)
+	},
+}
+
+// writeConfigFile replaces the output file atomically so the device never
+// reads a partially written config
+func writeConfigFile(config *auth.DeviceConfig) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(configOutput), ".config-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(config.Config); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), configOutput); err != nil {
+		return err
+	}
+
+	log.Infof("Applied config version %d to %s", config.Version, configOutput)
+	return nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/chaichis-network/v3/internal/fabric"
+	"github.com/spf13/cobra"
+)
+
+var (
+	lifecycleReason     string
+	deregisterAndRetire bool
+)
+
+func init() {
+	for _, cmd := range []*cobra.Command{decommissionDeviceCmd, reactivateDeviceCmd, deregisterDeviceCmd} {
+		cmd.Flags().StringVar(&deviceID, "device-id", "", "Device ID")
+		cmd.MarkFlagRequired("device-id")
+	}
+	for _, cmd := range []*cobra.Command{decommissionDeviceCmd, deregisterDeviceCmd} {
+		cmd.Flags().StringVar(&lifecycleReason, "reason", "", "Why the device leaves service, recorded on the ledger")
+		cmd.MarkFlagRequired("reason")
+	}
+	deregisterDeviceCmd.Flags().BoolVar(&deregisterAndRetire, "decommission", false, "Decommission the device first if it is still in service")
+
+	rootCmd.AddCommand(decommissionDeviceCmd)
+	rootCmd.AddCommand(reactivateDeviceCmd)
+	rootCmd.AddCommand(deregisterDeviceCmd)
+}
+
+var decommissionDeviceCmd = &cobra.Command{
+	Use:   "decommission-device",
+	Short: "Take a device out of service and close its sessions",
+	Long: `Decommissions a device: the ISV closes its open sessions in the same
+transaction and refuses new ones until 'reactivate-device' puts it back in
+service. Only the organization that registered the device may decommission it.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := confirmDestructive("decommission device "+deviceID+" and close its sessions", 1); err != nil {
+			return err
+		}
+
+		deviceManager, err := newDeviceManager()
+		if err != nil {
+			return err
+		}
+		result, err := deviceManager.DecommissionDevice(deviceID, lifecycleReason)
+		if err != nil {
+			return fmt.Errorf("failed to decommission device: %v", err)
+		}
+		printLifecycleResult(result)
+		return nil
+	},
+}
+
+var reactivateDeviceCmd = &cobra.Command{
+	Use:   "reactivate-device",
+	Short: "Put a decommissioned device back in service",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		deviceManager, err := newDeviceManager()
+		if err != nil {
+			return err
+		}
+		result, err := deviceManager.ReactivateDevice(deviceID)
+		if err != nil {
+			return fmt.Errorf("failed to reactivate device: %v", err)
+		}
+		printLifecycleResult(result)
+		return nil
+	},
+}
+
+var deregisterDeviceCmd = &cobra.Command{
+	Use:   "deregister-device",
+	Short: "Delete a device from the ISV and its local keys",
+	Long: `Deletes a decommissioned or revoked device and its configuration from
+the ISV, and its keys from the working directory. Its history and access logs
+stay on the ledger, and the device ID can be registered again with
+'register-device'. With --decommission, a device still in service is
+decommissioned first, closing its sessions.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := confirmDestructive("deregister device "+deviceID+" and delete its keys", 1); err != nil {
+			return err
+		}
+
+		deviceManager, err := newDeviceManager()
+		if err != nil {
+			return err
+		}
+		result, err := deviceManager.DeregisterDevice(deviceID, lifecycleReason, deregisterAndRetire)
+		if err != nil {
+			return fmt.Errorf("failed to deregister device: %v", err)
+		}
+		printLifecycleResult(result)
+		return nil
+	},
+}
+
+func printLifecycleResult(result *fabric.DeviceLifecycleResult) {
+	fmt.Printf("Device %s is %s\n", result.DeviceID, result.Status)
+	if len(result.ClosedSessions) > 0 {
+		fmt.Printf("Closed %d sessions: %s\n", len(result.ClosedSessions), strings.Join(result.ClosedSessions, ", "))
+	}
+}
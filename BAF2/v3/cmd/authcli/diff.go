@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/chaichis-network/v3/internal/auth"
+	"github.com/chaichis-network/v3/internal/fabric"
+	"github.com/chaichis-network/v3/pkg/table"
+	"github.com/spf13/cobra"
+)
+
+var (
+	diffSource   string
+	diffTarget   string
+	diffExitCode bool
+)
+
+func init() {
+	diffCmd.Flags().StringVar(&diffSource, "source", "", "Settings profile of the network to compare from, e.g. staging")
+	diffCmd.Flags().StringVar(&diffTarget, "target", "", "Settings profile of the network to compare to, e.g. prod")
+	diffCmd.Flags().BoolVar(&diffExitCode, "exit-code", false, "Exit non-zero if the networks differ")
+	diffCmd.MarkFlagRequired("source")
+	diffCmd.MarkFlagRequired("target")
+	addListFlags(diffCmd)
+
+	rootCmd.AddCommand(diffCmd)
+}
+
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Compare the clients, devices, policies and services of two networks",
+	Long: `Reads the auth state of the networks of two settings profiles and lists how
+the target differs from the source: clients, devices, policies (risk policy,
+capability profiles, device classes, payload limits) and services (protocol
+versions and published keys of each chaincode). Use it to check that a
+promotion script configured the target like the source.
+
+Fields that change in normal use are ignored: registration and last-seen
+times, maintenance windows, update times, and whether a device is busy.
+
+Each profile's config, wallet, identity, peers, age identity and strict
+setting come from the settings file; settings a profile does not give are
+the ones in effect for this command.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if diffSource == diffTarget {
+			return fmt.Errorf("--source and --target are the same profile")
+		}
+
+		source, err := profileSnapshot(diffSource)
+		if err != nil {
+			return fmt.Errorf("%s: %v", diffSource, err)
+		}
+		target, err := profileSnapshot(diffTarget)
+		if err != nil {
+			return fmt.Errorf("%s: %v", diffTarget, err)
+		}
+
+		differences := auth.DiffSnapshots(source, target)
+		if differences == nil {
+			differences = []auth.SnapshotDifference{}
+		}
+		t := table.New("section", "key", "field", "source", "target")
+		for _, difference := range differences {
+			if difference.Field == "" {
+				t.Append(difference.Section, difference.Key, "", presence(difference.Source), presence(difference.Target))
+				continue
+			}
+			t.Append(difference.Section, difference.Key, difference.Field, formatDiffValue(difference.Source), formatDiffValue(difference.Target))
+		}
+		if err := printList(t, differences); err != nil {
+			return err
+		}
+
+		if len(differences) == 0 {
+			fmt.Fprintf(os.Stderr, "%s and %s match\n", diffSource, diffTarget)
+		} else if diffExitCode {
+			return fmt.Errorf("%s and %s differ in %d places", diffSource, diffTarget, len(differences))
+		}
+		return nil
+	},
+}
+
+// profileSnapshot connects to the network of a settings profile and takes
+// a snapshot of it
+func profileSnapshot(profile string) (auth.Snapshot, error) {
+	path, explicit := settingsFilePath()
+	values, _, err := readSettings(rootCmd.PersistentFlags(), path, explicit, profile)
+	if err != nil {
+		return nil, err
+	}
+
+	setting := func(name, current string) string {
+		if value, ok := values[name]; ok {
+			return value.value
+		}
+		return current
+	}
+	list := func(name string, current []string) []string {
+		if value, ok := values[name]; ok {
+			if value.value == "" {
+				return nil
+			}
+			return strings.Split(value.value, ",")
+		}
+		return current
+	}
+	strict := strictMode
+	if value, ok := values["strict"]; ok {
+		if strict, err = strconv.ParseBool(value.value); err != nil {
+			return nil, fmt.Errorf("invalid value %q for --strict from %s: %v", value.value, value.source, err)
+		}
+	}
+	identity := setting("identity", identityName)
+
+	fabricClient, err := fabric.NewClient(fabric.ClientOptions{
+		ConfigPath: setting("config", configPath),
+		WalletPath: setting("wallet", walletPath),
+		Wallet: fabric.WalletOptions{
+			Backend:       setting("wallet-backend", walletBackend),
+			PKCS11Library: setting("pkcs11-library", pkcs11Library),
+			PKCS11Token:   setting("pkcs11-token", pkcs11Token),
+			Prompt:        promptSecret,
+		},
+		Debug: debugMode,
+		Peers: fabric.PeerRoles{
+			Endorsers:  list("endorsing-peers", endorsingPeers),
+			QueryPeers: list("query-peers", queryPeers),
+		},
+		AgeIdentityFile: setting("age-identity", ageIdentity),
+		API:             setting("fabric-api", fabricAPI),
+		GatewayPeer:     setting("gateway-peer", gatewayPeer),
+		Strict:          strict,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Fabric client: %v", err)
+	}
+	if err := fabricClient.EnsureIdentity(identity); err != nil {
+		return nil, fmt.Errorf("failed to ensure identity: %v", err)
+	}
+	if err := fabricClient.Connect(identity); err != nil {
+		return nil, fmt.Errorf("failed to connect to Fabric network: %v", err)
+	}
+	defer fabricClient.Close()
+
+	log.Infof("Reading %s from %s as %s", profile, setting("config", configPath), identity)
+	return auth.TakeSnapshot(fabricClient)
+}
+
+// presence describes a record that exists on one side of a diff only
+func presence(record interface{}) string {
+	if record == nil {
+		return "missing"
+	}
+	return "present"
+}
+
+// formatDiffValue renders a field value for the diff table: strings as
+// they are, "-" for an absent field, anything else as JSON
+func formatDiffValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "-"
+	case string:
+		return v
+	}
+	valueJSON, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(valueJSON)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/chaichis-network/v3/internal/auth"
+	"github.com/chaichis-network/v3/internal/fabric"
+	"github.com/chaichis-network/v3/pkg/table"
+	"github.com/spf13/cobra"
+)
+
+var (
+	historySessionID string
+	historyBlock     int64
+	historyAt        string
+)
+
+func init() {
+	for _, cmd := range []*cobra.Command{historyDeviceCmd, historySessionCmd} {
+		cmd.Flags().Int64Var(&historyBlock, "block", -1, "Show the record as of this block number")
+		cmd.Flags().StringVar(&historyAt, "at", "", "Show the record as of this time (RFC3339), resolved to the last block committed by then")
+	}
+	historyDeviceCmd.Flags().StringVar(&deviceID, "device-id", "", "Device ID")
+	historyDeviceCmd.MarkFlagRequired("device-id")
+	historySessionCmd.Flags().StringVar(&historySessionID, "session-id", "", "Session ID (SESSION_...)")
+	historySessionCmd.MarkFlagRequired("session-id")
+	addListFlags(historyDeviceCmd)
+	addListFlags(historySessionCmd)
+
+	historyCmd.AddCommand(historyDeviceCmd)
+	historyCmd.AddCommand(historySessionCmd)
+
+	rootCmd.AddCommand(historyCmd)
+}
+
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Inspect past versions of ledger records for incident investigation",
+	Long: `Shows every committed version of a device or session record, or with --block
+or --at, the record as it was at that point. --at takes an RFC3339 time and
+uses the last block committed at or before it.`,
+}
+
+var historyDeviceCmd = &cobra.Command{
+	Use:   "device",
+	Short: "Show the history of a device record",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return showHistory("device "+deviceID,
+			func(dm *auth.DeviceManager) ([]fabric.HistoryEntry, error) { return dm.DeviceHistory(deviceID) },
+			func(dm *auth.DeviceManager, block uint64) (*fabric.HistoryEntry, error) {
+				return dm.DeviceAtHeight(deviceID, block)
+			})
+	},
+}
+
+var historySessionCmd = &cobra.Command{
+	Use:   "session",
+	Short: "Show the history of a session record",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return showHistory("session "+historySessionID,
+			func(dm *auth.DeviceManager) ([]fabric.HistoryEntry, error) { return dm.SessionHistory(historySessionID) },
+			func(dm *auth.DeviceManager, block uint64) (*fabric.HistoryEntry, error) {
+				return dm.SessionAtHeight(historySessionID, block)
+			})
+	},
+}
+
+// showHistory prints the full history of a record, or its version at the
+// block selected by --block or --at
+func showHistory(record string, history func(*auth.DeviceManager) ([]fabric.HistoryEntry, error), atHeight func(*auth.DeviceManager, uint64) (*fabric.HistoryEntry, error)) error {
+	if historyBlock >= 0 && historyAt != "" {
+		return fmt.Errorf("--block and --at cannot be used together")
+	}
+
+	deviceManager, err := newDeviceManager()
+	if err != nil {
+		return err
+	}
+
+	if historyBlock < 0 && historyAt == "" {
+		entries, err := history(deviceManager)
+		if err != nil {
+			return fmt.Errorf("failed to get history of %s: %v", record, err)
+		}
+		t := table.New("block", "tx", "time", "deleted", "value")
+		for _, entry := range entries {
+			t.Append(entry.BlockNumber, entry.TxID, timeCell(entry.Timestamp), entry.IsDelete, string(entry.Value))
+		}
+		return printList(t, entries)
+	}
+
+	block := uint64(historyBlock)
+	if historyAt != "" {
+		at, err := time.Parse(time.RFC3339, historyAt)
+		if err != nil {
+			return fmt.Errorf("invalid --at time: %v", err)
+		}
+		if block, err = deviceManager.BlockAtTime(at); err != nil {
+			return fmt.Errorf("failed to resolve %s to a block: %v", historyAt, err)
+		}
+		log.Infof("%s resolves to block %d", historyAt, block)
+	}
+
+	entry, err := atHeight(deviceManager, block)
+	if err != nil {
+		return fmt.Errorf("failed to get %s at block %d: %v", record, block, err)
+	}
+	return printJSON(entry)
+}
+
+func printJSON(value interface{}) error {
+	output, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal output: %v", err)
+	}
+	fmt.Println(string(output))
+	return nil
+}
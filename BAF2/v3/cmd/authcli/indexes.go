@@ -0,0 +1,40 @@
+package main
+
+import (
+	"github.com/chaichis-network/v3/pkg/table"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	addListFlags(rebuildIndexesCmd)
+
+	rootCmd.AddCommand(rebuildIndexesCmd)
+}
+
+var rebuildIndexesCmd = &cobra.Command{
+	Use:   "rebuild-indexes",
+	Short: "Backfill the ISV's composite indexes after a chaincode upgrade",
+	Long: `The ISV chaincode finds sessions by client and by device through composite
+indexes. Records written before an upgrade that adds an index are not in it,
+so until the index is rebuilt queries scan every record instead. Run this
+once after such an upgrade; running it again only adds missing entries.
+
+When payload limit admins are configured, only their organizations may
+rebuild the indexes.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		deviceManager, err := newDeviceManager()
+		if err != nil {
+			return err
+		}
+
+		results, err := deviceManager.RebuildIndexes()
+		if err != nil {
+			return err
+		}
+		t := table.New("index", "records", "created")
+		for _, result := range results {
+			t.Append(result.Index, result.Records, result.Created)
+		}
+		return printList(t, results)
+	},
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/chaichis-network/v3/internal/auth"
+	"github.com/chaichis-network/v3/pkg/table"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var (
+	journalPath          string
+	journalFirst         int
+	journalLast          int
+	journalIncludeFailed bool
+	journalDryRun        bool
+)
+
+// unjournaledCommands are not journaled even though they submit
+// transactions: replays are journaled entry by entry, and plugin ledger
+// calls take their arguments on stdin, so they could not be replayed
+var unjournaledCommands = map[string]bool{
+	"journal replay": true,
+	"plugin ledger":  true,
+}
+
+// secretFlags hold one-time codes; their values are left out of the journal
+var secretFlags = map[string]bool{
+	"code": true,
+	"otp":  true,
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&journalPath, "journal", auth.JournalFile, "Journal the invocations that submit transactions are appended to (\"\": keep no journal)")
+
+	addListFlags(journalShowCmd)
+	journalReplayCmd.Flags().IntVar(&journalFirst, "first", 0, "First entry to replay, by sequence number (default: the first)")
+	journalReplayCmd.Flags().IntVar(&journalLast, "last", 0, "Last entry to replay, by sequence number (default: the last)")
+	journalReplayCmd.Flags().BoolVar(&journalIncludeFailed, "include-failed", false, "Also replay entries whose command failed")
+	journalReplayCmd.Flags().BoolVar(&journalDryRun, "dry-run", false, "Only print the commands that would be run")
+
+	journalCmd.AddCommand(journalShowCmd)
+	journalCmd.AddCommand(journalReplayCmd)
+	rootCmd.AddCommand(journalCmd)
+}
+
+var journalCmd = &cobra.Command{
+	Use:   "journal",
+	Short: "Show or replay the operations this working directory submitted",
+	Long: `Every invocation that submits transactions is appended to the journal
+(--journal, .authcli-journal.jsonl by default): the command and its
+arguments, a hash of the arguments, the identity and flow ID, the ID and
+outcome of each transaction, and the result. Global flags are not recorded,
+so a replay runs against the network it is given. Values of --otp and --code
+are left out; the hash still covers them.
+
+Each entry carries the hash of the one before it. 'journal show' reports an
+edited or removed entry, and 'journal replay' refuses such a journal.`,
+}
+
+var journalShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show the journal",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		entries, err := auth.ReadJournal(journalPath)
+		if err != nil {
+			return err
+		}
+		if err := auth.VerifyJournal(entries); err != nil {
+			log.Warnf("%v", err)
+		}
+
+		t := table.New("seq", "at", "identity", "command", "result", "transactions")
+		for _, entry := range entries {
+			t.Append(entry.Seq, timeCell(entry.At), entry.Identity, strings.Join(entry.Args, " "), entry.Result, describeTransactions(entry))
+		}
+		return printList(t, entries)
+	},
+}
+
+var journalReplayCmd = &cobra.Command{
+	Use:   "replay JOURNAL",
+	Short: "Run the commands of a journal again",
+	Long: `Runs the commands of a journal, oldest first, against the network selected by
+the global flags of this invocation. Each command runs as its own authcli
+process and is journaled as usual. Entries whose command failed are skipped
+unless --include-failed is given. The replay stops at the first command that
+fails, and at an entry with arguments left out of the journal, which must be
+run by hand.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		entries, err := auth.ReadJournal(args[0])
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			return fmt.Errorf("journal %s is empty or missing", args[0])
+		}
+		if err := auth.VerifyJournal(entries); err != nil {
+			return err
+		}
+
+		var replay []*auth.JournalEntry
+		for _, entry := range entries {
+			if (journalFirst > 0 && entry.Seq < journalFirst) || (journalLast > 0 && entry.Seq > journalLast) {
+				continue
+			}
+			if entry.Result != auth.JournalResultOK && !journalIncludeFailed {
+				log.Infof("Skipping entry %d (%s), which failed", entry.Seq, entry.Command)
+				continue
+			}
+			replay = append(replay, entry)
+		}
+		if len(replay) == 0 {
+			return fmt.Errorf("no entries of %s to replay", args[0])
+		}
+
+		if journalDryRun {
+			for _, entry := range replay {
+				fmt.Printf("%d\tauthcli %s\n", entry.Seq, strings.Join(entry.Args, " "))
+			}
+			return nil
+		}
+		if err := confirmDestructive(fmt.Sprintf("replay %d journal entries from %s", len(replay), args[0]), len(replay)); err != nil {
+			return err
+		}
+
+		self, err := os.Executable()
+		if err != nil {
+			return fmt.Errorf("failed to locate authcli: %v", err)
+		}
+		env := settingsEnv()
+		for i, entry := range replay {
+			if len(entry.Redacted) > 0 {
+				return fmt.Errorf("entry %d (%s) was journaled without --%s; run it by hand and replay from entry %d",
+					entry.Seq, entry.Command, strings.Join(entry.Redacted, ", --"), nextSeq(replay, i))
+			}
+
+			fmt.Fprintf(os.Stderr, "[%d] authcli %s\n", entry.Seq, strings.Join(entry.Args, " "))
+			// The replay as a whole was confirmed
+			run := exec.Command(self, append([]string{"--yes"}, entry.Args...)...)
+			run.Env = env
+			run.Stdin = os.Stdin
+			run.Stdout = os.Stdout
+			run.Stderr = os.Stderr
+			if err := run.Run(); err != nil {
+				return fmt.Errorf("entry %d (%s) failed: %v; later entries were not replayed", entry.Seq, entry.Command, err)
+			}
+		}
+		log.Infof("Replayed %d journal entries", len(replay))
+		return nil
+	},
+}
+
+// nextSeq returns the sequence number of the entry after replay[i], or
+// one past it if it is the last
+func nextSeq(replay []*auth.JournalEntry, i int) int {
+	if i+1 < len(replay) {
+		return replay[i+1].Seq
+	}
+	return replay[i].Seq + 1
+}
+
+// describeTransactions lists an entry's transactions for display
+func describeTransactions(entry *auth.JournalEntry) string {
+	var transactions []string
+	for _, transaction := range entry.Transactions {
+		description := transaction.Chaincode + "." + transaction.Function
+		if transaction.TxID != "" {
+			description += " " + transaction.TxID
+		}
+		if transaction.Error != "" {
+			description += " (failed)"
+		}
+		transactions = append(transactions, description)
+	}
+	return strings.Join(transactions, ", ")
+}
+
+// recordJournal appends the invocation of cmd to the journal if it
+// submitted transactions. A journal that cannot be written is reported but
+// does not fail the command, whose transactions are already on the ledger.
+func recordJournal(cmd *cobra.Command, runErr error) {
+	transactions := transactionLog.Transactions()
+	if journalPath == "" || cmd == nil || len(transactions) == 0 {
+		return
+	}
+	path := strings.TrimPrefix(cmd.CommandPath(), cmd.Root().Name()+" ")
+	if unjournaledCommands[path] {
+		return
+	}
+
+	args, redactedArgs, redacted := journalArgs(cmd)
+	entry := &auth.JournalEntry{
+		At:           time.Now().UTC(),
+		Command:      path,
+		Args:         redactedArgs,
+		ArgsHash:     auth.JournalArgsHash(args),
+		Redacted:     redacted,
+		Identity:     identityName,
+		FlowID:       flowID,
+		Transactions: transactions,
+		Result:       auth.JournalResultOK,
+	}
+	if runErr != nil {
+		entry.Result = auth.JournalResultError
+		entry.Error = runErr.Error()
+	}
+	if err := auth.AppendJournal(journalPath, entry); err != nil {
+		log.Warnf("Failed to journal %s: %v", path, err)
+	}
+}
+
+// journalArgs rebuilds the command line of cmd without global flags, and
+// the same with the values of secret flags left out. The flags that were
+// left out are returned as well.
+func journalArgs(cmd *cobra.Command) ([]string, []string, []string) {
+	args := strings.Fields(strings.TrimPrefix(cmd.CommandPath(), cmd.Root().Name()))
+	redactedArgs := append([]string{}, args...)
+	var redacted []string
+
+	cmd.Flags().Visit(func(flag *pflag.Flag) {
+		if cmd.Root().PersistentFlags().Lookup(flag.Name) != nil {
+			return
+		}
+		arg := "--" + flag.Name + "=" + flagValue(flag)
+		args = append(args, arg)
+		if secretFlags[flag.Name] {
+			redactedArgs = append(redactedArgs, "--"+flag.Name+"=REDACTED")
+			redacted = append(redacted, flag.Name)
+			return
+		}
+		redactedArgs = append(redactedArgs, arg)
+	})
+
+	positional := cmd.Flags().Args()
+	for _, arg := range positional {
+		if strings.HasPrefix(arg, "-") {
+			positional = append([]string{"--"}, positional...)
+			break
+		}
+	}
+	return append(args, positional...), append(redactedArgs, positional...), redacted
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/chaichis-network/v3/internal/fabric"
+	"github.com/spf13/cobra"
+)
+
+var (
+	leaseTTL      time.Duration
+	leaseEvery    time.Duration
+	sweepInterval time.Duration
+	sweepRecover  bool
+)
+
+func init() {
+	renewLeaseCmd.Flags().StringVar(&clientID, "client-id", "", "Client whose lease to renew")
+	renewLeaseCmd.Flags().StringVar(&deviceID, "device-id", "", "Device whose saved service ticket proves the client's identity")
+	renewLeaseCmd.Flags().DurationVar(&leaseTTL, "ttl", 2*time.Minute, "Lease length (30s to 1h)")
+	renewLeaseCmd.Flags().DurationVar(&leaseEvery, "every", 0, "Keep renewing at this interval until interrupted (default: renew once)")
+	renewLeaseCmd.MarkFlagRequired("client-id")
+	renewLeaseCmd.MarkFlagRequired("device-id")
+
+	showLeaseCmd.Flags().StringVar(&clientID, "client-id", "", "Client ID")
+	showLeaseCmd.MarkFlagRequired("client-id")
+
+	sweepSessionsCmd.Flags().DurationVar(&sweepInterval, "every", 0, "Keep sweeping at this interval until interrupted (default: sweep once)")
+	sweepSessionsCmd.Flags().BoolVar(&sweepRecover, "recover-devices", false, "Also free busy devices no live session holds after each sweep (admin only)")
+
+	leaseCmd.AddCommand(renewLeaseCmd)
+	leaseCmd.AddCommand(showLeaseCmd)
+	leaseCmd.AddCommand(sweepSessionsCmd)
+	leaseCmd.AddCommand(recoverDevicesCmd)
+
+	rootCmd.AddCommand(leaseCmd)
+}
+
+var leaseCmd = &cobra.Command{
+	Use:   "lease",
+	Short: "Tie a client's sessions to its liveness",
+}
+
+// runEvery calls fn once, then every interval until SIGINT or SIGTERM. An
+// interval of zero runs fn once and returns its error; in a loop, errors are
+// logged and the loop goes on, since the next attempt may succeed.
+func runEvery(interval time.Duration, fn func() error) error {
+	if interval <= 0 {
+		return fn()
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := fn(); err != nil {
+			log.Warnf("%v", err)
+		}
+		select {
+		case <-signals:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+var renewLeaseCmd = &cobra.Command{
+	Use:   "renew",
+	Short: "Renew a client's lease, once or periodically",
+	Long: `Creates or extends the client's lease on the ISV. Once a client holds a
+lease, 'lease sweep' closes its sessions when the lease lapses, so a crashed
+client does not keep devices busy. Run with --every, well below --ttl, as
+part of the client process or next to it:
+
+  authcli lease renew --client-id client1 --device-id device1 --ttl 2m --every 40s`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if leaseEvery > 0 && leaseEvery >= leaseTTL {
+			return fmt.Errorf("--every (%s) must be shorter than --ttl (%s)", leaseEvery, leaseTTL)
+		}
+
+		deviceManager, err := newDeviceManager()
+		if err != nil {
+			return err
+		}
+
+		return runEvery(leaseEvery, func() error {
+			lease, err := deviceManager.RenewLease(clientID, deviceID, leaseTTL)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Lease of %s renewed until %s\n", lease.ClientID, lease.ExpiresAt.Local().Format(time.RFC3339))
+			return nil
+		})
+	},
+}
+
+var showLeaseCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show a client's lease",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		deviceManager, err := newDeviceManager()
+		if err != nil {
+			return err
+		}
+
+		lease, err := deviceManager.GetLease(clientID)
+		if err != nil {
+			return err
+		}
+		return printJSON(lease)
+	},
+}
+
+var sweepSessionsCmd = &cobra.Command{
+	Use:   "sweep",
+	Short: "Close sessions of clients whose lease lapsed, and expired sessions",
+	Long: `Closes the active sessions of clients whose lease has lapsed and sessions
+past their expiry, and makes their devices available again. Any member of the
+channel may run it; run it with --every as a monitor to free devices promptly.
+An admin monitor can add --recover-devices to also run 'lease recover' after
+each sweep.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		deviceManager, err := newDeviceManager()
+		if err != nil {
+			return err
+		}
+
+		return runEvery(sweepInterval, func() error {
+			result, err := deviceManager.SweepSessions()
+			if err != nil {
+				return err
+			}
+			printSweepResult(result)
+			if !sweepRecover {
+				return nil
+			}
+
+			recovery, err := deviceManager.RecoverBusyDevices()
+			if err != nil {
+				return err
+			}
+			printRecoveryResult(recovery)
+			return nil
+		})
+	},
+}
+
+var recoverDevicesCmd = &cobra.Command{
+	Use:   "recover",
+	Short: "Free busy devices that no live session holds",
+	Long: `Marks devices that are busy without an active, unexpired session as
+active again. A device can be left busy when its session record was
+terminated without freeing it, which 'lease sweep' does not see since it only
+closes active sessions. Sessions that are active but expired are left to
+'lease sweep'. Admin only.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		deviceManager, err := newDeviceManager()
+		if err != nil {
+			return err
+		}
+
+		result, err := deviceManager.RecoverBusyDevices()
+		if err != nil {
+			return err
+		}
+		printRecoveryResult(result)
+		return nil
+	},
+}
+
+func printSweepResult(result *fabric.SweepResult) {
+	for _, expired := range result.ExpiredLeases {
+		fmt.Printf("Lease of %s expired\n", expired)
+	}
+	for _, sessionID := range result.ClosedSessions {
+		fmt.Printf("Closed %s\n", sessionID)
+	}
+	for _, accessID := range result.ExpiredEmergencyAccesses {
+		fmt.Printf("Break-glass access %s expired\n", accessID)
+	}
+	fmt.Printf("%d leases expired, %d sessions closed\n", len(result.ExpiredLeases), len(result.ClosedSessions))
+}
+
+func printRecoveryResult(result *fabric.RecoveryResult) {
+	for _, deviceID := range result.RecoveredDevices {
+		fmt.Printf("Recovered %s\n", deviceID)
+	}
+	fmt.Printf("%d busy devices recovered, %d held by live sessions\n", len(result.RecoveredDevices), len(result.HeldDevices))
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/chaichis-network/v3/internal/fabric"
+	"github.com/spf13/cobra"
+)
+
+var (
+	limitsChaincode string
+	limitsFile      string
+)
+
+func init() {
+	for _, cmd := range []*cobra.Command{getLimitsCmd, setLimitsCmd} {
+		cmd.Flags().StringVar(&limitsChaincode, "chaincode", "", "Chaincode: as, tgs or isv")
+		cmd.MarkFlagRequired("chaincode")
+	}
+	setLimitsCmd.Flags().StringVar(&limitsFile, "file", "", "JSON payload limits file")
+	setLimitsCmd.MarkFlagRequired("file")
+
+	limitsCmd.AddCommand(getLimitsCmd)
+	limitsCmd.AddCommand(setLimitsCmd)
+
+	rootCmd.AddCommand(limitsCmd)
+}
+
+var limitsCmd = &cobra.Command{
+	Use:   "limits",
+	Short: "Show or change the payload size limits enforced by a chaincode",
+}
+
+var getLimitsCmd = &cobra.Command{
+	Use:   "get",
+	Short: "Show the payload limits in force",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withChaincodeContract(limitsChaincode, func(fabricClient *fabric.Client, contractID string) error {
+			contract, err := fabricClient.GetContract(contractID)
+			if err != nil {
+				return err
+			}
+
+			output, err := json.MarshalIndent(fabricClient.PayloadLimits(contract), "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to marshal payload limits: %v", err)
+			}
+			fmt.Println(string(output))
+			return nil
+		})
+	},
+}
+
+var setLimitsCmd = &cobra.Command{
+	Use:   "set",
+	Short: "Store new payload limits (zero fields keep the defaults)",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		limitsJSON, err := ioutil.ReadFile(limitsFile)
+		if err != nil {
+			return fmt.Errorf("failed to read payload limits file: %v", err)
+		}
+		var limits fabric.PayloadLimits
+		if err := json.Unmarshal(limitsJSON, &limits); err != nil {
+			return fmt.Errorf("invalid payload limits file: %v", err)
+		}
+
+		return withChaincodeContract(limitsChaincode, func(fabricClient *fabric.Client, contractID string) error {
+			contract, err := fabricClient.GetContract(contractID)
+			if err != nil {
+				return err
+			}
+			if err := fabricClient.SetPayloadLimits(contract, limits); err != nil {
+				return err
+			}
+
+			log.Infof("Payload limits updated on %s", contractID)
+			return nil
+		})
+	},
+}
+
+// withChaincodeContract connects to the network and runs fn for the named
+// chaincode: as, tgs or isv
+func withChaincodeContract(chaincode string, fn func(*fabric.Client, string) error) error {
+	contractIDs := map[string]string{
+		"as":  fabric.ASContractID,
+		"tgs": fabric.TGSContractID,
+		"isv": fabric.ISVContractID,
+	}
+	contractID, ok := contractIDs[chaincode]
+	if !ok {
+		return fmt.Errorf("unknown chaincode %q (expected as, tgs or isv)", chaincode)
+	}
+
+	// Create Fabric client
+	fabricClient, err := fabric.NewClient(fabric.ClientOptions{
+		ConfigPath:      configPath,
+		WalletPath:      walletPath,
+		Wallet:          walletOptions(),
+		Debug:           debugMode,
+		Peers:           peerRoles(),
+		AgeIdentityFile: ageIdentity,
+		API:             fabricAPI,
+		GatewayPeer:     gatewayPeer,
+		Strict:          strictMode,
+		FlowID:          flowID,
+		Pool:            connectionPool,
+		TransactionLog:  transactionLog,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create Fabric client: %v", err)
+	}
+
+	// Ensure identity exists in wallet
+	if err := fabricClient.EnsureIdentity(identityName); err != nil {
+		return fmt.Errorf("failed to ensure identity: %v", err)
+	}
+
+	if err := fabricClient.Connect(identityName); err != nil {
+		return fmt.Errorf("failed to connect to Fabric network: %v", err)
+	}
+	defer fabricClient.Close()
+
+	return fn(fabricClient, contractID)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/chaichis-network/v3/internal/auth"
+	"github.com/chaichis-network/v3/internal/fabric"
+	"github.com/spf13/cobra"
+)
+
+var (
+	maxActiveSessions    int
+	maxRequestsPerMinute int
+	waitOverloaded       time.Duration
+)
+
+func init() {
+	setLoadLimitsCmd.Flags().StringVar(&deviceID, "device-id", "", "Device ID")
+	setLoadLimitsCmd.Flags().IntVar(&maxActiveSessions, "max-sessions", 0, "Sessions the device holds at once (default: 1)")
+	setLoadLimitsCmd.Flags().IntVar(&maxRequestsPerMinute, "max-requests-per-minute", 0, "Service requests the device takes per minute (default: unlimited)")
+	setLoadLimitsCmd.MarkFlagRequired("device-id")
+
+	showDeviceLoadCmd.Flags().StringVar(&deviceID, "device-id", "", "Device ID")
+	showDeviceLoadCmd.MarkFlagRequired("device-id")
+
+	accessDeviceCmd.Flags().DurationVar(&waitOverloaded, "wait-overloaded", 0, "Retry for up to this long while the device is overloaded (default: fail at once)")
+
+	loadLimitsCmd.AddCommand(setLoadLimitsCmd)
+	loadLimitsCmd.AddCommand(showDeviceLoadCmd)
+	rootCmd.AddCommand(loadLimitsCmd)
+}
+
+var loadLimitsCmd = &cobra.Command{
+	Use:   "load-limits",
+	Short: "Cap the concurrent sessions and request rate of a device",
+	Long: `A device at one of its load limits sheds service requests: access-device
+fails with the time after which to retry. Without limits a device holds one
+session at a time.`,
+}
+
+var setLoadLimitsCmd = &cobra.Command{
+	Use:   "set",
+	Short: "Set the load limits of a device (signed with the device key)",
+	Long: `Sets how many sessions a device holds at once and how many service requests
+it takes per minute. Setting neither removes the limits. The limits are
+signed with the device key, so run this where the device's keys are.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		deviceManager, err := newDeviceManager()
+		if err != nil {
+			return err
+		}
+
+		limits := fabric.DeviceLoadLimits{
+			MaxActiveSessions:    maxActiveSessions,
+			MaxRequestsPerMinute: maxRequestsPerMinute,
+		}
+		if err := deviceManager.SetDeviceLoadLimits(deviceID, limits); err != nil {
+			return err
+		}
+		sessions := maxActiveSessions
+		if sessions == 0 {
+			sessions = 1
+		}
+		log.Infof("Device %s: %d sessions at once, %s requests per minute", deviceID, sessions, describeLimit(maxRequestsPerMinute))
+		return nil
+	},
+}
+
+var showDeviceLoadCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show the load limits and current load of a device",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		deviceManager, err := newDeviceManager()
+		if err != nil {
+			return err
+		}
+
+		load, err := deviceManager.GetDeviceLoad(deviceID)
+		if err != nil {
+			return err
+		}
+		return printJSON(load)
+	},
+}
+
+// accessDevice accesses a device, retrying while it is overloaded for up to
+// --wait-overloaded
+func accessDevice(deviceManager *auth.DeviceManager, clientID, deviceID string) (*auth.Session, error) {
+	deadline := time.Now().Add(waitOverloaded)
+	for {
+		session, err := deviceManager.AccessDevice(clientID, deviceID)
+		var overloaded *fabric.DeviceOverloadedError
+		if err == nil || !errors.As(err, &overloaded) {
+			return session, err
+		}
+		if time.Now().Add(overloaded.RetryAfter).After(deadline) {
+			return nil, err
+		}
+		log.Infof("Device %s is overloaded (%s), retrying in %s", deviceID, overloaded.Reason, overloaded.RetryAfter)
+		time.Sleep(overloaded.RetryAfter)
+	}
+}
+
+// describeLimit formats a request rate limit, where 0 is unlimited
+func describeLimit(limit int) string {
+	if limit == 0 {
+		return "unlimited"
+	}
+	return fmt.Sprint(limit)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/chaichis-network/v3/internal/fabric"
+	"github.com/spf13/cobra"
+)
+
+var (
+	logsFollow   bool
+	logsJSON     bool
+	logsPageSize int32
+)
+
+func init() {
+	logsCmd.Flags().StringVar(&deviceID, "device-id", "", "Device ID")
+	logsCmd.Flags().BoolVarP(&logsFollow, "follow", "f", false, "Keep streaming new entries as they are committed")
+	logsCmd.Flags().BoolVar(&logsJSON, "json", false, "Print one JSON object per entry")
+	logsCmd.Flags().Int32Var(&logsPageSize, "page-size", 0, "Entries fetched per history query (default: chaincode default)")
+	logsCmd.MarkFlagRequired("device-id")
+
+	rootCmd.AddCommand(logsCmd)
+}
+
+var logsCmd = &cobra.Command{
+	Use:   "logs",
+	Short: "Print a device's access log, optionally following new entries",
+	Long: `Prints the access log of a device, oldest first: sessions opened and closed,
+denied requests and approval decisions. The history is read from the ISV
+chaincode page by page; with --follow the command then streams new entries
+from chaincode events until interrupted, like 'kubectl logs -f'.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		deviceManager, err := newDeviceManager()
+		if err != nil {
+			return err
+		}
+
+		stop := make(chan struct{})
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-signals
+			close(stop)
+		}()
+
+		encoder := json.NewEncoder(os.Stdout)
+		return deviceManager.StreamAccessLogs(deviceID, logsPageSize, logsFollow, func(entry fabric.AccessLogEntry) error {
+			if logsJSON {
+				return encoder.Encode(entry)
+			}
+			line := fmt.Sprintf("%s  %-18s client=%s", entry.Timestamp.Format(time.RFC3339), entry.Action, entry.ClientID)
+			if entry.SessionID != "" {
+				line += " session=" + entry.SessionID
+			}
+			if len(entry.Capabilities) > 0 {
+				line += " capabilities=" + strings.Join(entry.Capabilities, ",")
+			}
+			if entry.Detail != "" {
+				line += " (" + entry.Detail + ")"
+			}
+			_, err := fmt.Println(line)
+			return err
+		}, stop)
+	},
+}
@@ -1,13 +1,20 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"os/exec"
 	"strings"
+	"time"
 
 	"github.com/chaichis-network/v3/internal/auth"
+	"github.com/chaichis-network/v3/internal/crypto"
 	"github.com/chaichis-network/v3/internal/fabric"
+	"github.com/chaichis-network/v3/pkg/keystore"
 	"github.com/chaichis-network/v3/pkg/logger"
+	"github.com/chaichis-network/v3/pkg/progress"
+	"github.com/chaichis-network/v3/pkg/table"
 	"github.com/spf13/cobra"
 )
 
@@ -16,15 +23,37 @@ var (
 	logLevel        string
 	configPath      string
 	walletPath      string
+	walletBackend   string
+	pkcs11Library   string
+	pkcs11Token     string
 	identityName    string
 	clientID        string
 	deviceID        string
 	capabilities    []string
+	keyTypeName     string
 	sessionDir      string
+	sessionStore    string
 	debugMode       bool // Added debug mode flag
+	progressMode    string
+	endorsingPeers  []string
+	queryPeers      []string
+	ageIdentity     string
+	strictMode      bool
+	fabricAPI       string
+	gatewayPeer     string
+	flowID          string
+	keyCacheTTL     time.Duration
 	
 	// Global variables
 	log *logger.Logger
+	
+	// connectionPool lets the steps of one command share a gateway
+	// connection per identity
+	connectionPool = fabric.NewConnectionPool()
+	
+	// transactionLog collects the transactions the command submits, for
+	// the journal
+	transactionLog = fabric.NewTransactionLog()
 )
 
 func init() {
@@ -35,22 +64,42 @@ func init() {
 	rootCmd.PersistentFlags().StringVar(&logLevel, "log-level", "info", "Log level (debug, info, warn, error)")
 	rootCmd.PersistentFlags().StringVar(&configPath, "config", "config/connection-profile.json", "Path to connection profile")
 	rootCmd.PersistentFlags().StringVar(&walletPath, "wallet", "wallet", "Path to wallet directory")
+	rootCmd.PersistentFlags().StringVar(&walletBackend, "wallet-backend", fabric.WalletBackendFile, "Wallet backend (file, encrypted, pkcs11, memory); encrypted reads its passphrase from $AUTHCLI_WALLET_PASSPHRASE or asks, pkcs11 needs a build with cgo")
+	rootCmd.PersistentFlags().StringVar(&pkcs11Library, "pkcs11-library", "", "PKCS#11 module of the HSM holding the wallet keys, e.g. /usr/lib/softhsm/libsofthsm2.so (PIN from $AUTHCLI_PKCS11_PIN or asked)")
+	rootCmd.PersistentFlags().StringVar(&pkcs11Token, "pkcs11-token", "", "Label of the PKCS#11 token holding the wallet keys")
 	rootCmd.PersistentFlags().StringVar(&identityName, "identity", "admin", "Identity name to use")
 	rootCmd.PersistentFlags().StringVar(&sessionDir, "session-dir", "sessions", "Path to session directory")
+	rootCmd.PersistentFlags().StringVar(&sessionStore, "session-store", auth.SessionBackendFile, "Session store backend (file, bolt, memory); memory keeps sessions for this invocation only")
 	rootCmd.PersistentFlags().BoolVar(&debugMode, "debug", false, "Enable debug mode for Fabric client") // Added debug flag
+	rootCmd.PersistentFlags().StringSliceVar(&endorsingPeers, "endorsing-peers", []string{}, "Peers used to endorse submitted transactions (comma-separated, default: gateway selection)")
+	rootCmd.PersistentFlags().StringSliceVar(&queryPeers, "query-peers", []string{}, "Read peers used for queries, tried in order with failover (comma-separated)")
+	rootCmd.PersistentFlags().StringVar(&ageIdentity, "age-identity", "", "age identity file for decrypting .age connection profiles (default: $AUTHCLI_AGE_IDENTITY)")
+	rootCmd.PersistentFlags().StringVar(&fabricAPI, "fabric-api", fabric.APISDK, "Fabric client API (sdk, or gateway for Fabric 2.4+ gateway peers)")
+	rootCmd.PersistentFlags().StringVar(&gatewayPeer, "gateway-peer", "", "Peer the gateway API sends requests to, by name in the connection profile (default: first peer of the identity's organization)")
+	rootCmd.PersistentFlags().BoolVar(&strictMode, "strict", false, "Fail instead of silently falling back (query peer failover, default payload limits, protocol version 1, service requests without mutual authentication)")
+	rootCmd.PersistentFlags().StringVar(&flowID, "flow-id", "", "Flow ID tagging the ledger events and audit records of this invocation (default: one per authenticate or access-device flow)")
+	rootCmd.PersistentFlags().StringVar(&progressMode, "progress", "auto", "Progress output for long operations (auto, bar, plain, json, none)")
+	rootCmd.PersistentFlags().DurationVar(&keyCacheTTL, "key-cache-ttl", keystore.DefaultCacheTTL, "How long a private key read from the keys directory is held in locked memory before it is read again (0: read it for every use)")
 	
 	// Register client command flags
 	registerClientCmd.Flags().StringVar(&clientID, "client-id", "", "Client ID to register")
+	registerClientCmd.Flags().StringVar(&keyTypeName, "key-type", "rsa", "Type of key pair to generate if the client has none (rsa, ec-p256)")
 	registerClientCmd.MarkFlagRequired("client-id")
 	
 	// Register device command flags
 	registerDeviceCmd.Flags().StringVar(&deviceID, "device-id", "", "Device ID to register")
 	registerDeviceCmd.Flags().StringSliceVar(&capabilities, "capabilities", []string{}, "Device capabilities (comma-separated)")
+	registerDeviceCmd.Flags().StringVar(&capabilityProfile, "capability-profile", "", "Capability profile the device's capabilities follow, instead of --capabilities")
+	registerDeviceCmd.Flags().StringVar(&keyTypeName, "key-type", "rsa", "Type of key pair to generate if the device has none (rsa, ec-p256)")
 	registerDeviceCmd.MarkFlagRequired("device-id")
 	
 	// Authenticate command flags
 	authenticateCmd.Flags().StringVar(&clientID, "client-id", "", "Client ID to authenticate")
 	authenticateCmd.Flags().StringVar(&deviceID, "device-id", "", "Device ID to access")
+	authenticateCmd.Flags().StringVar(&sourceIP, "source-ip", "", "Source IP of the request, for the AS risk policy (set by gateways)")
+	authenticateCmd.Flags().StringVar(&stepUpCode, "otp", "", "One-time code for a step-up required by the risk policy")
+	authenticateCmd.Flags().DurationVar(&pushWait, "push-wait", 0, "How long to wait for a push step-up to be approved in the client's app (default: do not wait)")
+	authenticateCmd.Flags().BoolVar(&acceptTerms, "accept-terms", false, "Accept the terms notice if the AS asks for one")
 	authenticateCmd.MarkFlagRequired("client-id")
 	authenticateCmd.MarkFlagRequired("device-id")
 	
@@ -72,6 +121,7 @@ func init() {
 	
 	// List sessions command flags
 	listSessionsCmd.Flags().StringVar(&clientID, "client-id", "", "Filter sessions by client ID (optional)")
+	addListFlags(listSessionsCmd)
 	
 	// Add subcommands to root command
 	rootCmd.AddCommand(
@@ -89,21 +139,102 @@ var rootCmd = &cobra.Command{
 	Use:   "authcli",
 	Short: "Authentication Framework CLI",
 	Long:  `Command-line interface for the Hyperledger Fabric Authentication Framework`,
-	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		// Fill global flags not given on the command line from the
+		// environment and the settings file
+		if err := applySettings(cmd.Root().PersistentFlags()); err != nil {
+			return err
+		}
+		if err := checkAuditorCommand(cmd); err != nil {
+			return err
+		}
+		
 		// Set log level
 		log = logger.New(logLevel)
+		
+		// Validate progress mode early so long operations don't fail halfway
+		if _, err := progress.ParseMode(progressMode); err != nil {
+			return err
+		}
+		
+		if keyCacheTTL < 0 {
+			return fmt.Errorf("--key-cache-ttl must not be negative")
+		}
+		if keyCacheTTL > 0 {
+			crypto.EnableKeyCache(keyCacheTTL)
+		}
+		return nil
 	},
 }
 
+// peerRoles builds the peer role configuration from the command-line flags
+func peerRoles() fabric.PeerRoles {
+	return fabric.PeerRoles{
+		Endorsers:  endorsingPeers,
+		QueryPeers: queryPeers,
+	}
+}
+
+// walletOptions selects the wallet backend from the command-line flags
+func walletOptions() fabric.WalletOptions {
+	return fabric.WalletOptions{
+		Backend:       walletBackend,
+		PKCS11Library: pkcs11Library,
+		PKCS11Token:   pkcs11Token,
+		Prompt:        promptSecret,
+	}
+}
+
+// openSessionStore opens the session store selected by --session-store in
+// the session directory
+func openSessionStore() (auth.SessionStore, error) {
+	return auth.OpenSessionStore(sessionStore, sessionDir)
+}
+
+// saveSession saves a session the ISV opened to the session store
+func saveSession(session *auth.Session) error {
+	sessions, err := openSessionStore()
+	if err != nil {
+		return err
+	}
+	if err := sessions.SaveSession(session); err != nil {
+		return fmt.Errorf("failed to save session: %v", err)
+	}
+	return nil
+}
+
+// newProgress creates a progress reporter on stderr so command output on stdout stays clean
+func newProgress(operation string, total int) progress.Reporter {
+	mode, err := progress.ParseMode(progressMode)
+	if err != nil {
+		mode = progress.ModeAuto
+	}
+	return progress.New(os.Stderr, mode, operation, total)
+}
+
 var registerClientCmd = &cobra.Command{
 	Use:   "register-client",
 	Short: "Register a client with the Authentication Server",
 	RunE: func(cmd *cobra.Command, args []string) error {
+		keyType, err := crypto.ParseKeyType(keyTypeName)
+		if err != nil {
+			return err
+		}
+		
 		// Create Fabric client
 		fabricClient, err := fabric.NewClient(fabric.ClientOptions{
 			ConfigPath:  configPath,
 			WalletPath:  walletPath,
+			Wallet:      walletOptions(),
 			Debug:       debugMode, // Enable debug mode based on flag
+			Peers:       peerRoles(),
+			AgeIdentityFile: ageIdentity,
+			API:             fabricAPI,
+			GatewayPeer:     gatewayPeer,
+			Strict:      strictMode,
+			FlowID:      flowID,
+			Pool:        connectionPool,
+			TransactionLog: transactionLog,
 		})
 		if err != nil {
 			return fmt.Errorf("failed to create Fabric client: %v", err)
@@ -120,6 +251,7 @@ var registerClientCmd = &cobra.Command{
 			return fmt.Errorf("failed to create client manager: %v", err)
 		}
 		defer clientManager.Close()
+		clientManager.SetKeyType(keyType)
 		
 		// Register client
 		if err := clientManager.RegisterClient(clientID); err != nil {
@@ -135,11 +267,28 @@ var registerDeviceCmd = &cobra.Command{
 	Use:   "register-device",
 	Short: "Register an IoT device with the ISV",
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if capabilityProfile != "" && len(capabilities) > 0 {
+			return fmt.Errorf("--capabilities and --capability-profile cannot be used together")
+		}
+		keyType, err := crypto.ParseKeyType(keyTypeName)
+		if err != nil {
+			return err
+		}
+		
 		// Create Fabric client
 		fabricClient, err := fabric.NewClient(fabric.ClientOptions{
 			ConfigPath:  configPath,
 			WalletPath:  walletPath,
+			Wallet:      walletOptions(),
 			Debug:       debugMode, // Enable debug mode based on flag
+			Peers:       peerRoles(),
+			AgeIdentityFile: ageIdentity,
+			API:             fabricAPI,
+			GatewayPeer:     gatewayPeer,
+			Strict:      strictMode,
+			FlowID:      flowID,
+			Pool:        connectionPool,
+			TransactionLog: transactionLog,
 		})
 		if err != nil {
 			return fmt.Errorf("failed to create Fabric client: %v", err)
@@ -155,8 +304,15 @@ var registerDeviceCmd = &cobra.Command{
 		if err != nil {
 			return fmt.Errorf("failed to create device manager: %v", err)
 		}
+		deviceManager.SetKeyType(keyType)
 		
 		// Register device
+		if capabilityProfile != "" {
+			if err := deviceManager.RegisterDeviceWithProfile(deviceID, capabilityProfile); err != nil {
+				return fmt.Errorf("failed to register device: %v", err)
+			}
+			return nil
+		}
 		if err := deviceManager.RegisterDevice(deviceID, capabilities); err != nil {
 			return fmt.Errorf("failed to register device: %v", err)
 		}
@@ -174,7 +330,16 @@ var authenticateCmd = &cobra.Command{
 		fabricClient, err := fabric.NewClient(fabric.ClientOptions{
 			ConfigPath:  configPath,
 			WalletPath:  walletPath,
+			Wallet:      walletOptions(),
 			Debug:       debugMode, // Enable debug mode based on flag
+			Peers:       peerRoles(),
+			AgeIdentityFile: ageIdentity,
+			API:             fabricAPI,
+			GatewayPeer:     gatewayPeer,
+			Strict:      strictMode,
+			FlowID:      flowID,
+			Pool:        connectionPool,
+			TransactionLog: transactionLog,
 		})
 		if err != nil {
 			return fmt.Errorf("failed to create Fabric client: %v", err)
@@ -192,8 +357,18 @@ var authenticateCmd = &cobra.Command{
 		}
 		defer clientManager.Close()
 		
+		// Report progress for each step of the flow
+		reporter := newProgress("authenticate", auth.AuthenticationSteps)
+		clientManager.SetProgress(reporter)
+		clientManager.SetSourceIP(sourceIP)
+		clientManager.SetStepUpCode(stepUpCode)
+		clientManager.SetPushWait(pushWait)
+		clientManager.SetAcceptTerms(acceptTerms)
+		
 		// Authenticate client
-		if err := clientManager.Authenticate(clientID, deviceID); err != nil {
+		err = clientManager.Authenticate(clientID, deviceID)
+		reporter.Done(err)
+		if err != nil {
 			return fmt.Errorf("failed to authenticate: %v", err)
 		}
 		
@@ -205,12 +380,25 @@ var authenticateCmd = &cobra.Command{
 var accessDeviceCmd = &cobra.Command{
 	Use:   "access-device",
 	Short: "Access an IoT device",
-	RunE: func(cmd *cobra.Command, args []string) error {
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+		reporter := newProgress("access-device", 3)
+		defer func() { reporter.Done(err) }()
+		
 		// Create Fabric client
+		reporter.Set(0, "connecting to network")
 		fabricClient, err := fabric.NewClient(fabric.ClientOptions{
 			ConfigPath:  configPath,
 			WalletPath:  walletPath,
+			Wallet:      walletOptions(),
 			Debug:       debugMode, // Enable debug mode based on flag
+			Peers:       peerRoles(),
+			AgeIdentityFile: ageIdentity,
+			API:             fabricAPI,
+			GatewayPeer:     gatewayPeer,
+			Strict:      strictMode,
+			FlowID:      flowID,
+			Pool:        connectionPool,
+			TransactionLog: transactionLog,
 		})
 		if err != nil {
 			return fmt.Errorf("failed to create Fabric client: %v", err)
@@ -228,18 +416,24 @@ var accessDeviceCmd = &cobra.Command{
 		}
 		
 		// Access device
-		session, err := deviceManager.AccessDevice(clientID, deviceID)
+		reporter.Step("requesting access")
+		session, err := accessDevice(deviceManager, clientID, deviceID)
 		if err != nil {
 			return fmt.Errorf("failed to access device: %v", err)
 		}
 		
-		// Create session manager
-		sessionManager := auth.NewSessionManager(sessionDir)
+		// Open session store
+		sessions, err := openSessionStore()
+		if err != nil {
+			return err
+		}
 		
 		// Save session
-		if err := sessionManager.SaveSession(session); err != nil {
+		reporter.Step("saving session")
+		if err := sessions.SaveSession(session); err != nil {
 			return fmt.Errorf("failed to save session: %v", err)
 		}
+		reporter.Step("session saved")
 		
 		log.Infof("Access granted to device %s for client %s", deviceID, clientID)
 		log.Infof("Session ID: %s", session.SessionID)
@@ -255,7 +449,16 @@ var getDeviceDataCmd = &cobra.Command{
 		fabricClient, err := fabric.NewClient(fabric.ClientOptions{
 			ConfigPath:  configPath,
 			WalletPath:  walletPath,
+			Wallet:      walletOptions(),
 			Debug:       debugMode, // Enable debug mode based on flag
+			Peers:       peerRoles(),
+			AgeIdentityFile: ageIdentity,
+			API:             fabricAPI,
+			GatewayPeer:     gatewayPeer,
+			Strict:      strictMode,
+			FlowID:      flowID,
+			Pool:        connectionPool,
+			TransactionLog: transactionLog,
 		})
 		if err != nil {
 			return fmt.Errorf("failed to create Fabric client: %v", err)
@@ -297,20 +500,35 @@ var closeSessionCmd = &cobra.Command{
 	Use:   "close-session",
 	Short: "Close an active session with an IoT device",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		// Create session manager
-		sessionManager := auth.NewSessionManager(sessionDir)
+		// Open session store
+		sessions, err := openSessionStore()
+		if err != nil {
+			return err
+		}
 		
 		// Get session
-		_, err := sessionManager.GetSession(clientID, deviceID)
+		session, err := sessions.GetSession(clientID, deviceID)
 		if err != nil {
 			return fmt.Errorf("failed to get session: %v", err)
 		}
+		if err := confirmDestructive("close session "+session.SessionID, 1); err != nil {
+			return err
+		}
 		
 		// Create Fabric client
 		fabricClient, err := fabric.NewClient(fabric.ClientOptions{
 			ConfigPath:  configPath,
 			WalletPath:  walletPath,
+			Wallet:      walletOptions(),
 			Debug:       debugMode, // Enable debug mode based on flag
+			Peers:       peerRoles(),
+			AgeIdentityFile: ageIdentity,
+			API:             fabricAPI,
+			GatewayPeer:     gatewayPeer,
+			Strict:      strictMode,
+			FlowID:      flowID,
+			Pool:        connectionPool,
+			TransactionLog: transactionLog,
 		})
 		if err != nil {
 			return fmt.Errorf("failed to create Fabric client: %v", err)
@@ -333,7 +551,7 @@ var closeSessionCmd = &cobra.Command{
 		}
 		
 		// Remove session
-		if err := sessionManager.RemoveSession(clientID, deviceID); err != nil {
+		if err := sessions.RemoveSession(clientID, deviceID); err != nil {
 			return fmt.Errorf("failed to remove session: %v", err)
 		}
 		
@@ -346,50 +564,55 @@ var listSessionsCmd = &cobra.Command{
 	Use:   "list-sessions",
 	Short: "List active sessions",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		// Create session manager
-		sessionManager := auth.NewSessionManager(sessionDir)
+		// Open session store
+		store, err := openSessionStore()
+		if err != nil {
+			return err
+		}
 		
 		var sessions []*auth.Session
-		var err error
 		
 		// List sessions (filtered by client if provided)
 		if clientID != "" {
-			sessions, err = sessionManager.GetActiveSessionsForClient(clientID)
+			sessions, err = store.GetActiveSessionsForClient(clientID)
 			if err != nil {
 				return fmt.Errorf("failed to get sessions for client %s: %v", clientID, err)
 			}
 		} else {
-			sessions, err = sessionManager.ListActiveSessions()
+			sessions, err = store.ListActiveSessions()
 			if err != nil {
 				return fmt.Errorf("failed to list sessions: %v", err)
 			}
 		}
 		
 		// Display sessions
-		if len(sessions) == 0 {
-			fmt.Println("No active sessions found")
-			return nil
-		}
-		
-		fmt.Printf("Active Sessions (%d):\n", len(sessions))
-		for i, session := range sessions {
-			fmt.Printf("%d. Client: %s, Device: %s, Session ID: %s\n", i+1, session.ClientID, session.DeviceID, session.SessionID)
-			fmt.Printf("   Status: %s\n", session.Status)
-			if session.EstablishedAt != "" {
-				fmt.Printf("   Established At: %s\n", session.EstablishedAt)
-			}
-			if session.ExpiresAt != "" {
-				fmt.Printf("   Expires At: %s\n", session.ExpiresAt)
-			}
-			fmt.Println()
+		t := table.New("session", "client", "device", "status", "established", "expires")
+		for _, session := range sessions {
+			t.Append(session.SessionID, session.ClientID, session.DeviceID, session.Status, session.EstablishedAt, session.ExpiresAt)
 		}
-		
-		return nil
+		return printList(t, sessions)
 	},
 }
 
 func main() {
-	if err := rootCmd.Execute(); err != nil {
+	if path, name, args, ok := lookupPlugin(os.Args[1:]); ok {
+		err := runPlugin(path, name, args)
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.ExitCode())
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	
+	cmd, err := rootCmd.ExecuteC()
+	recordJournal(cmd, err)
+	connectionPool.Close()
+	crypto.CloseKeyCache()
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
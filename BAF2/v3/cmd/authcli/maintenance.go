@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	maintenanceStart     string
+	maintenanceDuration  time.Duration
+	maintenanceReason    string
+	maintenanceOperators string
+)
+
+func init() {
+	for _, cmd := range []*cobra.Command{scheduleMaintenanceCmd, cancelMaintenanceCmd, showMaintenanceCmd} {
+		cmd.Flags().StringVar(&deviceID, "device-id", "", "Device ID")
+		cmd.MarkFlagRequired("device-id")
+	}
+	scheduleMaintenanceCmd.Flags().StringVar(&maintenanceStart, "start", "", "Start of the window, RFC 3339 (default: now)")
+	scheduleMaintenanceCmd.Flags().DurationVar(&maintenanceDuration, "duration", time.Hour, "Length of the window")
+	scheduleMaintenanceCmd.Flags().StringVar(&maintenanceReason, "reason", "", "Why the device is in maintenance")
+	scheduleMaintenanceCmd.Flags().StringVar(&maintenanceOperators, "operators", "", "Comma-separated clients that may still open sessions")
+	scheduleMaintenanceCmd.MarkFlagRequired("reason")
+
+	maintenanceCmd.AddCommand(scheduleMaintenanceCmd)
+	maintenanceCmd.AddCommand(cancelMaintenanceCmd)
+	maintenanceCmd.AddCommand(showMaintenanceCmd)
+
+	rootCmd.AddCommand(maintenanceCmd)
+}
+
+var maintenanceCmd = &cobra.Command{
+	Use:   "maintenance",
+	Short: "Schedule, show or cancel a device's maintenance window",
+	Long: `While a device is inside its maintenance window the TGS refuses service
+tickets for it and the ISV refuses new sessions on it, except for the listed
+operators. Discovery queries report the device's status as "maintenance".
+Sessions opened before the window starts are not closed.`,
+}
+
+var scheduleMaintenanceCmd = &cobra.Command{
+	Use:   "schedule",
+	Short: "Put a device into maintenance (device side, signed with the device key)",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		start := time.Now()
+		if maintenanceStart != "" {
+			var err error
+			if start, err = time.Parse(time.RFC3339, maintenanceStart); err != nil {
+				return fmt.Errorf("invalid --start: %v", err)
+			}
+		}
+		if maintenanceDuration <= 0 {
+			return fmt.Errorf("--duration must be positive")
+		}
+		var operators []string
+		for _, operator := range strings.Split(maintenanceOperators, ",") {
+			if operator = strings.TrimSpace(operator); operator != "" {
+				operators = append(operators, operator)
+			}
+		}
+
+		deviceManager, err := newDeviceManager()
+		if err != nil {
+			return err
+		}
+		if err := deviceManager.ScheduleMaintenance(deviceID, start, start.Add(maintenanceDuration), maintenanceReason, operators); err != nil {
+			return fmt.Errorf("failed to schedule maintenance: %v", err)
+		}
+		return nil
+	},
+}
+
+var cancelMaintenanceCmd = &cobra.Command{
+	Use:   "cancel",
+	Short: "End a device's maintenance window (device side)",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		deviceManager, err := newDeviceManager()
+		if err != nil {
+			return err
+		}
+		if err := deviceManager.CancelMaintenance(deviceID); err != nil {
+			return fmt.Errorf("failed to cancel maintenance: %v", err)
+		}
+		return nil
+	},
+}
+
+var showMaintenanceCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show a device's maintenance window",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		deviceManager, err := newDeviceManager()
+		if err != nil {
+			return err
+		}
+		window, err := deviceManager.GetMaintenanceWindow(deviceID)
+		if err != nil {
+			return err
+		}
+		return printJSON(window)
+	},
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/chaichis-network/v3/internal/fabric"
+	"github.com/spf13/cobra"
+)
+
+var metricsJSON bool
+
+func init() {
+	metricsCmd.Flags().BoolVar(&metricsJSON, "json", false, "Print metrics as JSON")
+
+	rootCmd.AddCommand(metricsCmd)
+}
+
+var metricsCmd = &cobra.Command{
+	Use:   "metrics",
+	Short: "Show operation counters from the AS, TGS and ISV chaincodes",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Create Fabric client
+		fabricClient, err := fabric.NewClient(fabric.ClientOptions{
+			ConfigPath:      configPath,
+			WalletPath:      walletPath,
+			Wallet:          walletOptions(),
+			Debug:           debugMode,
+			Peers:           peerRoles(),
+			AgeIdentityFile: ageIdentity,
+			API:             fabricAPI,
+			GatewayPeer:     gatewayPeer,
+			Strict:          strictMode,
+			FlowID:          flowID,
+			Pool:            connectionPool,
+			TransactionLog:  transactionLog,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create Fabric client: %v", err)
+		}
+
+		// Ensure identity exists in wallet
+		if err := fabricClient.EnsureIdentity(identityName); err != nil {
+			return fmt.Errorf("failed to ensure identity: %v", err)
+		}
+
+		if err := fabricClient.Connect(identityName); err != nil {
+			return fmt.Errorf("failed to connect to Fabric network: %v", err)
+		}
+		defer fabricClient.Close()
+
+		asContract, err := fabric.NewAuthServerContract(fabricClient)
+		if err != nil {
+			return fmt.Errorf("failed to get AS contract: %v", err)
+		}
+		tgsContract, err := fabric.NewTicketGrantingContract(fabricClient)
+		if err != nil {
+			return fmt.Errorf("failed to get TGS contract: %v", err)
+		}
+		isvContract, err := fabric.NewISVContract(fabricClient)
+		if err != nil {
+			return fmt.Errorf("failed to get ISV contract: %v", err)
+		}
+
+		sources := []struct {
+			name  string
+			fetch func() (map[string]int64, error)
+		}{
+			{"as", asContract.GetMetrics},
+			{"tgs", tgsContract.GetMetrics},
+			{"isv", isvContract.GetMetrics},
+		}
+
+		all := make(map[string]map[string]int64)
+		for _, source := range sources {
+			metrics, err := source.fetch()
+			if err != nil {
+				// Older chaincode versions don't expose metrics; report the rest
+				log.Warnf("Failed to get %s metrics: %v", source.name, err)
+				continue
+			}
+			all[source.name] = metrics
+		}
+
+		if metricsJSON {
+			output, err := json.MarshalIndent(all, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to marshal metrics: %v", err)
+			}
+			fmt.Println(string(output))
+			return nil
+		}
+
+		for _, source := range sources {
+			metrics, ok := all[source.name]
+			if !ok {
+				continue
+			}
+			fmt.Printf("%s:\n", source.name)
+
+			names := make([]string, 0, len(metrics))
+			for name := range metrics {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				fmt.Printf("  %-25s %d\n", name, metrics[name])
+			}
+		}
+		return nil
+	},
+}
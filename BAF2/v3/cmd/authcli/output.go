@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/chaichis-network/v3/pkg/table"
+	"github.com/spf13/cobra"
+)
+
+// Output flags shared by listing commands
+var (
+	outputFormat   string
+	outputColumns  []string
+	outputNoHeader bool
+	outputJSON     bool
+)
+
+// addListFlags registers the output flags of a listing command
+func addListFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&outputFormat, "format", string(table.FormatTable), "Output format: table, tsv or json")
+	cmd.Flags().StringSliceVar(&outputColumns, "columns", nil, "Columns to print, in order (comma-separated, default: all)")
+	cmd.Flags().BoolVar(&outputNoHeader, "no-header", false, "Omit the header line of table and tsv output")
+	cmd.Flags().BoolVar(&outputJSON, "json", false, "Shorthand for --format json")
+}
+
+// listFormat returns the format selected by the output flags
+func listFormat() (table.Format, error) {
+	if outputJSON {
+		return table.FormatJSON, nil
+	}
+	return table.ParseFormat(outputFormat)
+}
+
+// printList prints a listing as selected by the output flags. JSON output
+// without --columns prints records, the full records the table was built
+// from; everything else renders t.
+func printList(t *table.Table, records interface{}) error {
+	format, err := listFormat()
+	if err != nil {
+		return err
+	}
+	if format == table.FormatJSON && len(outputColumns) == 0 && records != nil {
+		return printJSON(records)
+	}
+	return t.Render(os.Stdout, table.Options{
+		Format:   format,
+		Columns:  outputColumns,
+		NoHeader: outputNoHeader,
+	})
+}
+
+// printNextPage tells a person reading a table how to fetch the next page.
+// It goes to stderr so tsv output stays clean; JSON output carries the
+// bookmark itself.
+func printNextPage(bookmark string) {
+	if format, _ := listFormat(); bookmark != "" && format != table.FormatJSON {
+		fmt.Fprintf(os.Stderr, "More results: --bookmark %s\n", bookmark)
+	}
+}
+
+// cell formats a field of a record decoded into a map for a table
+func cell(record map[string]interface{}, field string) string {
+	switch value := record[field].(type) {
+	case nil:
+		return ""
+	case []interface{}:
+		items := make([]string, len(value))
+		for i, item := range value {
+			items[i] = fmt.Sprint(item)
+		}
+		return strings.Join(items, ",")
+	case map[string]interface{}:
+		items := make([]string, 0, len(value))
+		for key, item := range value {
+			items = append(items, fmt.Sprintf("%s=%v", key, item))
+		}
+		sort.Strings(items)
+		return strings.Join(items, ",")
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// timeCell formats a time for a table, leaving zero times empty
+func timeCell(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/chaichis-network/v3/internal/crypto"
+	"github.com/chaichis-network/v3/internal/fabric"
+	"github.com/spf13/cobra"
+)
+
+var (
+	paddingChaincode  string
+	paddingName       string
+	paddingTransition time.Duration
+)
+
+func init() {
+	for _, cmd := range []*cobra.Command{showPaddingCmd, setPaddingCmd} {
+		cmd.Flags().StringVar(&paddingChaincode, "chaincode", "", "Chaincode: as, tgs or isv")
+		cmd.MarkFlagRequired("chaincode")
+	}
+	setPaddingCmd.Flags().StringVar(&paddingName, "padding", "", "Padding: pkcs1v15 or oaep")
+	setPaddingCmd.MarkFlagRequired("padding")
+	setPaddingCmd.Flags().DurationVar(&paddingTransition, "transition", 24*time.Hour, "How long PKCS#1 v1.5 ciphertexts are still accepted after switching to oaep")
+
+	paddingCmd.AddCommand(showPaddingCmd)
+	paddingCmd.AddCommand(setPaddingCmd)
+
+	rootCmd.AddCommand(paddingCmd)
+}
+
+var paddingCmd = &cobra.Command{
+	Use:   "padding",
+	Short: "Show or change the RSA padding a chaincode encrypts tickets with",
+	Long: `Show or change the RSA padding a chaincode encrypts tickets with.
+
+Chaincodes set to oaep encrypt tickets with RSA-OAEP and accept PKCS#1 v1.5
+ciphertexts only during the transition window given with the switch. Upgrade
+all three chaincodes first, then switch the AS, TGS and ISV with a window at
+least as long as the longest ticket lifetime, so that tickets issued before
+the switch stay valid.`,
+}
+
+var showPaddingCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show the padding a chaincode encrypts and accepts",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withChaincodeContract(paddingChaincode, func(fabricClient *fabric.Client, contractID string) error {
+			contract, err := fabricClient.GetContract(contractID)
+			if err != nil {
+				return err
+			}
+			config, err := fabricClient.GetRSAPadding(contract)
+			if err != nil {
+				return err
+			}
+			return printPaddingConfig(config)
+		})
+	},
+}
+
+var setPaddingCmd = &cobra.Command{
+	Use:   "set",
+	Short: "Switch the padding a chaincode encrypts tickets with",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		padding, err := crypto.ParsePadding(paddingName)
+		if err != nil {
+			return err
+		}
+		if paddingTransition < 0 {
+			return fmt.Errorf("--transition must not be negative")
+		}
+		if padding == crypto.PaddingOAEP && paddingTransition < time.Second {
+			// Tickets issued before the switch stop validating at once
+			if err := confirmDestructive(fmt.Sprintf("switch %s to oaep with no transition window", paddingChaincode), -1); err != nil {
+				return err
+			}
+		}
+
+		return withChaincodeContract(paddingChaincode, func(fabricClient *fabric.Client, contractID string) error {
+			contract, err := fabricClient.GetContract(contractID)
+			if err != nil {
+				return err
+			}
+			config, err := fabricClient.SetRSAPadding(contract, padding, paddingTransition)
+			if err != nil {
+				return err
+			}
+
+			log.Infof("RSA padding of %s set to %s", contractID, padding)
+			return printPaddingConfig(config)
+		})
+	},
+}
+
+// printPaddingConfig prints a padding configuration and, during a
+// transition, when PKCS#1 v1.5 stops being accepted
+func printPaddingConfig(config *fabric.PaddingConfig) error {
+	fmt.Printf("Padding: %s\n", config.Padding)
+	switch {
+	case config.Padding != crypto.PaddingOAEP:
+		fmt.Println("Accepts: oaep, pkcs1v15")
+	case config.AcceptsLegacy(time.Now()):
+		fmt.Printf("Accepts: oaep, pkcs1v15 until %s\n", time.Unix(config.LegacyUntil, 0).Format(time.RFC3339))
+	default:
+		fmt.Println("Accepts: oaep")
+	}
+	if config.UpdatedBy != "" {
+		fmt.Printf("Updated: %s by %s\n", time.Unix(config.UpdatedAt, 0).Format(time.RFC3339), config.UpdatedBy)
+	}
+	return nil
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/chaichis-network/v3/internal/crypto"
+	"github.com/chaichis-network/v3/internal/fabric"
+	"github.com/chaichis-network/v3/pkg/table"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// Plugins are executables named authcli-<name> on PATH, as with kubectl:
+// "authcli onboard --team x" runs authcli-onboard with "--team x". Dashes
+// join nested names, so "authcli report weekly" runs authcli-report-weekly
+// if it exists, else authcli-report with "weekly". Built-in commands always
+// win over plugins. A plugin gets authcli's resolved global settings as
+// AUTHCLI_<FLAG> environment variables; pkg/authclient/plugin reads them.
+const pluginPrefix = "authcli-"
+
+// reservedCommands are added by cobra and cannot be plugins
+var reservedCommands = map[string]bool{
+	"help":             true,
+	"completion":       true,
+	"__complete":       true,
+	"__completeNoDesc": true,
+}
+
+func init() {
+	addListFlags(listPluginsCmd)
+
+	pluginCmd.AddCommand(listPluginsCmd)
+	pluginCmd.AddCommand(pluginLedgerCmd)
+	rootCmd.AddCommand(pluginCmd)
+}
+
+var pluginCmd = &cobra.Command{
+	Use:   "plugin",
+	Short: "List the plugins on PATH",
+	Long: `Any executable named authcli-<name> on PATH is a plugin: 'authcli <name>'
+runs it with the remaining arguments. Built-in commands take precedence.
+
+Global flags cannot be given on a plugin's command line; set them with
+AUTHCLI_<FLAG> variables or a settings profile. The plugin gets them
+resolved, as AUTHCLI_<FLAG> variables, and AUTHCLI_BIN to call back into
+authcli. Plugins are not run under the auditor profile.`,
+}
+
+var listPluginsCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List plugins on PATH and whether each can be run",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		plugins := findPlugins()
+		t := table.New("plugin", "path", "status")
+		for _, plugin := range plugins {
+			t.Append(plugin.Name, plugin.Path, plugin.Status)
+		}
+		return printList(t, plugins)
+	},
+}
+
+// pluginLedgerCmd serves authclient.Ledger calls for plugins built with
+// pkg/authclient/plugin. The arguments are a JSON array on stdin; the
+// result, or {"error": ...}, is written as JSON to stdout.
+var pluginLedgerCmd = &cobra.Command{
+	Use:       "ledger METHOD",
+	Short:     "Serve a ledger call for a plugin",
+	Hidden:    true,
+	Args:      cobra.ExactArgs(1),
+	ValidArgs: pluginLedgerMethods,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		result, err := servePluginLedger(args[0], os.Stdin)
+		if err != nil {
+			// The plugin reports the error; exit without cobra's usage output
+			json.NewEncoder(os.Stdout).Encode(map[string]string{"error": err.Error()})
+			os.Exit(1)
+		}
+		return json.NewEncoder(os.Stdout).Encode(result)
+	},
+}
+
+// pluginLedgerMethods are the methods of authclient.Ledger
+var pluginLedgerMethods = []string{"RegisterClient", "GetNonceChallenge", "VerifyClientIdentity", "GenerateTGT", "GenerateServiceTicket"}
+
+// PluginInfo is a plugin found on PATH
+type PluginInfo struct {
+	Name   string `json:"name"`
+	Path   string `json:"path"`
+	Status string `json:"status"` // "ok", or why it is not run
+}
+
+// findPlugins lists the plugin executables on PATH in PATH order
+func findPlugins() []*PluginInfo {
+	var plugins []*PluginInfo
+	seen := map[string]string{}
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name, ok := pluginName(entry)
+			if !ok {
+				continue
+			}
+			plugin := &PluginInfo{Name: name, Path: filepath.Join(dir, entry.Name()), Status: "ok"}
+			if first, ok := seen[name]; ok {
+				plugin.Status = "shadowed by " + first
+			} else if isBuiltinCommand(strings.Split(name, "-")) {
+				plugin.Status = "shadowed by a built-in command"
+				seen[name] = plugin.Path
+			} else {
+				seen[name] = plugin.Path
+			}
+			plugins = append(plugins, plugin)
+		}
+	}
+	return plugins
+}
+
+// pluginName returns the plugin name of a PATH entry, if it is a plugin
+func pluginName(entry os.DirEntry) (string, bool) {
+	name := entry.Name()
+	if !strings.HasPrefix(name, pluginPrefix) || entry.IsDir() {
+		return "", false
+	}
+	name = strings.TrimPrefix(name, pluginPrefix)
+	if runtime.GOOS == "windows" {
+		if !strings.EqualFold(filepath.Ext(name), ".exe") {
+			return "", false
+		}
+		name = strings.TrimSuffix(name, filepath.Ext(name))
+	} else if info, err := entry.Info(); err != nil || info.Mode()&0111 == 0 {
+		return "", false
+	}
+	return name, name != ""
+}
+
+// isBuiltinCommand reports whether args start with a built-in command
+func isBuiltinCommand(args []string) bool {
+	if len(args) == 0 || reservedCommands[args[0]] {
+		return true
+	}
+	cmd, _, err := rootCmd.Find(args)
+	return err == nil && cmd != rootCmd
+}
+
+// lookupPlugin returns the plugin a command line runs, if it names no
+// built-in command: the longest run of leading arguments joined by dashes
+// that names an executable on PATH, and the arguments after it
+func lookupPlugin(args []string) (string, string, []string, bool) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") || isBuiltinCommand(args) {
+		return "", "", nil, false
+	}
+	words := 0
+	for words < len(args) && !strings.HasPrefix(args[words], "-") {
+		words++
+	}
+	for n := words; n > 0; n-- {
+		name := strings.Join(args[:n], "-")
+		if path, err := exec.LookPath(pluginPrefix + name); err == nil {
+			return path, name, args[n:], true
+		}
+	}
+	return "", "", nil, false
+}
+
+// runPlugin runs a plugin with the resolved global settings in its
+// environment and returns its exit error, if any
+func runPlugin(path, name string, args []string) error {
+	flags := rootCmd.PersistentFlags()
+	if err := applySettings(flags); err != nil {
+		return err
+	}
+	if activeProfile == auditorProfile {
+		return fmt.Errorf("plugin %s is not available under the %s profile, which is read-only", name, auditorProfile)
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate authcli for plugin %s: %v", name, err)
+	}
+	env := append(settingsEnv(),
+		"AUTHCLI_BIN="+self,
+		"AUTHCLI_PLUGIN="+name,
+		"AUTHCLI_KEY_DIR="+crypto.KeyDir,
+	)
+
+	cmd := exec.Command(path, args...)
+	cmd.Env = env
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// settingsEnv returns the environment with the resolved global settings
+// added as AUTHCLI_<FLAG> variables, for programs calling back into authcli
+func settingsEnv() []string {
+	env := os.Environ()
+	if activeProfile != "" {
+		env = append(env, settingsEnvPrefix+"PROFILE="+activeProfile)
+	}
+	rootCmd.PersistentFlags().VisitAll(func(flag *pflag.Flag) {
+		if unsettableFlags[flag.Name] {
+			return
+		}
+		env = append(env, settingsEnvName(flag.Name)+"="+flagValue(flag))
+	})
+	return env
+}
+
+// flagValue returns a flag's value as it would be given on the command line
+func flagValue(flag *pflag.Flag) string {
+	if slice, ok := flag.Value.(pflag.SliceValue); ok {
+		return strings.Join(slice.GetSlice(), ",")
+	}
+	return flag.Value.String()
+}
+
+// servePluginLedger makes one authclient.Ledger call on behalf of a plugin
+func servePluginLedger(method string, input io.Reader) (interface{}, error) {
+	known := false
+	for _, m := range pluginLedgerMethods {
+		known = known || m == method
+	}
+	if !known {
+		return nil, errors.New("unknown ledger method " + method)
+	}
+	var args []json.RawMessage
+	if err := json.NewDecoder(input).Decode(&args); err != nil {
+		return nil, fmt.Errorf("invalid arguments for %s: %v", method, err)
+	}
+	argument := func(i int, v interface{}) error {
+		if i >= len(args) {
+			return fmt.Errorf("%s: missing argument %d", method, i+1)
+		}
+		return json.Unmarshal(args[i], v)
+	}
+
+	fabricClient, err := fabric.NewClient(fabric.ClientOptions{
+		ConfigPath:      configPath,
+		WalletPath:      walletPath,
+		Wallet:          walletOptions(),
+		Debug:           debugMode,
+		Peers:           peerRoles(),
+		AgeIdentityFile: ageIdentity,
+		API:             fabricAPI,
+		GatewayPeer:     gatewayPeer,
+		Strict:          strictMode,
+		FlowID:          flowID,
+		Pool:            connectionPool,
+		TransactionLog:  transactionLog,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Fabric client: %v", err)
+	}
+	if err := fabricClient.EnsureIdentity(identityName); err != nil {
+		return nil, fmt.Errorf("failed to ensure identity: %v", err)
+	}
+
+	if method == "GenerateServiceTicket" {
+		var request map[string]string
+		if err := argument(0, &request); err != nil {
+			return nil, err
+		}
+		tgs, err := fabric.NewTicketGrantingContract(fabricClient)
+		if err != nil {
+			return nil, err
+		}
+		return tgs.GenerateServiceTicket(request)
+	}
+
+	as, err := fabric.NewAuthServerContract(fabricClient)
+	if err != nil {
+		return nil, err
+	}
+	var clientID, value string
+	if err := argument(0, &clientID); err != nil {
+		return nil, err
+	}
+	switch method {
+	case "RegisterClient":
+		if err := argument(1, &value); err != nil {
+			return nil, err
+		}
+		return struct{}{}, as.RegisterClient(clientID, value)
+	case "GetNonceChallenge":
+		return as.GetNonceChallenge(clientID)
+	case "VerifyClientIdentity":
+		if err := argument(1, &value); err != nil {
+			return nil, err
+		}
+		return struct{}{}, as.VerifyClientIdentity(clientID, value)
+	default: // GenerateTGT
+		return as.GenerateTGT(clientID)
+	}
+}
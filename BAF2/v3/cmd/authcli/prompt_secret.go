@@ -0,0 +1,33 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// promptSecret asks for a wallet passphrase or token PIN on the terminal,
+// without echoing it where the platform allows. Without a terminal, the
+// secret has to come from its environment variable instead.
+func promptSecret(prompt string) ([]byte, error) {
+	if info, err := os.Stdin.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return nil, fmt.Errorf("no terminal to ask for it on")
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	secret, err := readSecret()
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// readLine reads a line from stdin without its line ending
+func readLine() ([]byte, error) {
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return nil, err
+	}
+	return []byte(strings.TrimRight(line, "\r\n")), nil
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package main
+
+import "os"
+
+// readSecret reads a line from the terminal. Echo is only turned off on
+// Linux; elsewhere, prefer the environment variable.
+func readSecret() ([]byte, error) {
+	os.Stderr.WriteString("(input is shown) ")
+	return readLine()
+}
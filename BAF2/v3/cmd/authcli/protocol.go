@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/chaichis-network/v3/pkg/table"
+	"github.com/chaichis-network/v3/pkg/ticket"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	addListFlags(protocolCmd)
+	rootCmd.AddCommand(protocolCmd)
+}
+
+var protocolCmd = &cobra.Command{
+	Use:   "protocol",
+	Short: "Show the protocol versions the chaincodes speak and the one this client negotiates",
+	Long: `Chaincodes are upgraded before clients, so authcli asks the AS and TGS which
+protocol versions and message formats they support before authenticating,
+and uses the newest both sides know. A chaincode that predates protocol
+negotiation is taken to speak version 1 (--strict makes that an error).`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		clientManager, err := newClientManager()
+		if err != nil {
+			return err
+		}
+		defer clientManager.Close()
+
+		asInfo, tgsInfo, err := clientManager.ChaincodeProtocols()
+		if err != nil {
+			return err
+		}
+		protocol, negotiateErr := ticket.NegotiateProtocol(ticket.SupportedProtocols, *asInfo, *tgsInfo)
+
+		t := table.New("party", "versions", "encryption", "ticket formats")
+		for _, info := range []ticket.ProtocolInfo{*asInfo, *tgsInfo, ticket.SupportedProtocols} {
+			party := info.Service
+			if party == "" {
+				party = "client"
+			}
+			t.Append(party, joinInts(info.Versions), strings.Join(info.Encryption, ","), strings.Join(info.TicketFormats, ","))
+		}
+		if err := printList(t, map[string]interface{}{
+			"as":         asInfo,
+			"tgs":        tgsInfo,
+			"client":     ticket.SupportedProtocols,
+			"negotiated": protocol,
+		}); err != nil {
+			return err
+		}
+
+		if negotiateErr != nil {
+			return negotiateErr
+		}
+		if format, _ := listFormat(); format != table.FormatJSON {
+			fmt.Fprintf(os.Stderr, "Negotiated: version %d, %s session keys, %s tickets\n",
+				protocol.Version, protocol.Encryption, protocol.TicketFormat)
+		}
+		return nil
+	},
+}
+
+func joinInts(values []int) string {
+	items := make([]string, len(values))
+	for i, value := range values {
+		items[i] = fmt.Sprint(value)
+	}
+	return strings.Join(items, ",")
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	renewSessionCmd.Flags().StringVar(&clientID, "client-id", "", "Client ID")
+	renewSessionCmd.Flags().StringVar(&deviceID, "device-id", "", "Device the session is with")
+	renewSessionCmd.MarkFlagRequired("client-id")
+	renewSessionCmd.MarkFlagRequired("device-id")
+
+	rootCmd.AddCommand(renewSessionCmd)
+}
+
+var renewSessionCmd = &cobra.Command{
+	Use:   "renew-session",
+	Short: "Extend an active session before it expires",
+	Long: `Extends the client's active session with a device without authenticating
+again. The saved service ticket is renewed with the TGS, and the TGT with the
+AS when it expires within 10 minutes; the ISV then extends the session by the
+device's session lifetime. Run it before the session, ticket or TGT expires:
+once one has, run 'authenticate' and 'access-device' again. A TGT can be
+renewed for up to 24 hours after authenticating.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		deviceManager, err := newDeviceManager()
+		if err != nil {
+			return err
+		}
+
+		session, err := deviceManager.RenewSession(clientID, deviceID)
+		if err != nil {
+			return fmt.Errorf("failed to renew session: %v", err)
+		}
+		if err := saveSession(session); err != nil {
+			return err
+		}
+
+		fmt.Printf("Session %s renewed until %s\n", session.SessionID, session.ExpiresAt)
+		return nil
+	},
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var replayPurgeInterval time.Duration
+
+func init() {
+	purgeReplayCacheCmd.Flags().DurationVar(&replayPurgeInterval, "every", 0, "Keep purging at this interval until interrupted (default: purge once)")
+
+	replayCacheCmd.AddCommand(purgeReplayCacheCmd)
+
+	rootCmd.AddCommand(replayCacheCmd)
+}
+
+var replayCacheCmd = &cobra.Command{
+	Use:   "replay-cache",
+	Short: "Maintain the records of used nonces, authenticators and tickets",
+	Long: `The AS, TGS and ISV accept each nonce answer and authenticator once: the
+first transaction to present one records its hash on the ledger, and a later
+transaction presenting it again is refused. A service request sent without
+an authenticator uses up its service ticket the same way. A record is kept
+until the credential expires, after which it is ignored; 'purge' deletes
+such records.`,
+}
+
+var purgeReplayCacheCmd = &cobra.Command{
+	Use:   "purge",
+	Short: "Delete expired replay cache records from the AS, TGS and ISV",
+	Long: `Deletes replay cache records of credentials that have expired. Any member
+of the channel may run it; run it with --every to keep the caches small.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		deviceManager, err := newDeviceManager()
+		if err != nil {
+			return err
+		}
+
+		return runEvery(replayPurgeInterval, func() error {
+			purges, err := deviceManager.PurgeReplayCaches()
+			for _, purge := range purges {
+				fmt.Printf("%s: %d expired records purged\n", purge.Chaincode, purge.Purged)
+			}
+			return err
+		})
+	},
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/chaichis-network/v3/internal/auth"
+	"github.com/chaichis-network/v3/internal/fabric"
+	"github.com/spf13/cobra"
+)
+
+var (
+	resetConfirm bool
+	resetWallet  bool
+)
+
+func init() {
+	resetLocalStateCmd.Flags().BoolVar(&resetConfirm, "confirm", false, "Remove the files; without it the command only lists them")
+	resetLocalStateCmd.Flags().BoolVar(&resetWallet, "wallet", false, "Also remove the wallet identities, which were enrolled with the old network's CA")
+
+	rootCmd.AddCommand(resetLocalStateCmd)
+}
+
+var resetLocalStateCmd = &cobra.Command{
+	Use:   "reset-local-state",
+	Short: "Remove cached tickets and sessions issued on a previous ledger",
+	Long: `Remove the TGTs, service tickets, sessions and demo manifest cached
+locally. Run it after the network has been torn down and recreated: the
+cached artifacts refer to records the new ledger does not have, and commands
+refuse to run while the recorded ledger differs from the connected one.
+
+Client and device keys are kept so the same IDs can be registered again.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		artifacts, err := auth.LocalArtifacts(sessionDir)
+		if err != nil {
+			return err
+		}
+		if demoManifest != "" {
+			if _, err := os.Stat(demoManifest); err == nil {
+				artifacts = append(artifacts, demoManifest)
+			}
+		}
+
+		var identities []string
+		var wallet *fabric.Wallet
+		if resetWallet {
+			wallet, err = fabric.OpenWallet(walletPath, walletOptions())
+			if err != nil {
+				return fmt.Errorf("failed to open wallet: %v", err)
+			}
+			identities, err = wallet.List()
+			if err != nil {
+				return fmt.Errorf("failed to list wallet identities: %v", err)
+			}
+		}
+
+		if stamp, err := auth.LoadLocalStateStamp(); err == nil && stamp != nil {
+			fmt.Printf("Local state was recorded on channel %s, genesis %s (%s)\n",
+				stamp.Channel, stamp.GenesisHash, stamp.RecordedAt.Format("2006-01-02 15:04:05"))
+		}
+		if len(artifacts) == 0 && len(identities) == 0 {
+			fmt.Println("No local state to remove")
+			return nil
+		}
+
+		for _, artifact := range artifacts {
+			fmt.Printf("  %s\n", artifact)
+		}
+		for _, identity := range identities {
+			fmt.Printf("  wallet identity %s\n", identity)
+		}
+		if !resetConfirm {
+			fmt.Printf("%d files and %d wallet identities would be removed; re-run with --confirm\n", len(artifacts), len(identities))
+			return nil
+		}
+
+		if err := auth.RemoveLocalArtifacts(artifacts); err != nil {
+			return err
+		}
+		for _, identity := range identities {
+			if err := wallet.Remove(identity); err != nil {
+				return fmt.Errorf("failed to remove wallet identity %s: %v", identity, err)
+			}
+		}
+
+		fmt.Printf("Removed %d files and %d wallet identities\n", len(artifacts), len(identities))
+		return nil
+	},
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/chaichis-network/v3/internal/auth"
+	"github.com/chaichis-network/v3/internal/fabric"
+	"github.com/spf13/cobra"
+)
+
+var (
+	revokeFromFile    string
+	revokeReason      string
+	revokeBatchSize   int
+	revokeRate        float64
+	revokeCheckpoint  string
+	revokeMaxRetries  int
+	revokeRestart     bool
+	revokeSummaryJSON bool
+)
+
+func init() {
+	revokeCmd.Flags().StringVar(&revokeFromFile, "from-file", "", "File of device IDs to revoke, one per line")
+	revokeCmd.Flags().StringVar(&revokeReason, "reason", "", "Why the devices are revoked, recorded on the ledger")
+	revokeCmd.Flags().IntVar(&revokeBatchSize, "batch-size", 50, fmt.Sprintf("Devices per transaction (at most %d)", fabric.MaxRevocationBatch))
+	revokeCmd.Flags().Float64Var(&revokeRate, "rate", 2, "Transactions per second (0: no limit)")
+	revokeCmd.Flags().StringVar(&revokeCheckpoint, "checkpoint", "", "Progress file (default: <from-file>.checkpoint)")
+	revokeCmd.Flags().IntVar(&revokeMaxRetries, "max-retries", 5, "Retries of a failing batch before stopping")
+	revokeCmd.Flags().BoolVar(&revokeRestart, "restart", false, "Ignore a saved checkpoint and start from the first device")
+	revokeCmd.Flags().BoolVar(&revokeSummaryJSON, "json", false, "Print the summary as JSON")
+	revokeCmd.Flags().StringVar(&clientID, "client-id", "", "Revoke this client's TGTs and service tickets instead of devices")
+	revokeCmd.MarkFlagRequired("reason")
+
+	rootCmd.AddCommand(revokeCmd)
+}
+
+var revokeCmd = &cobra.Command{
+	Use:   "revoke [DEVICE_ID...] | --client-id CLIENT_ID",
+	Short: "Revoke devices in rate-limited batches, or cut off a client",
+	Long: `Revokes devices and closes their sessions. A revoked device cannot be
+accessed or reactivated.
+
+Devices are revoked in transactions of --batch-size devices, at most --rate
+transactions per second, so revoking thousands of devices does not flood the
+orderer. A failing batch is retried with backoff. With --from-file, progress
+is saved to a checkpoint after every batch; running the same command again
+resumes after the last committed batch. The checkpoint is removed when the
+revocation completes.
+
+Only the organization that registered a device can revoke it. Devices that
+are unknown, owned by another organization or already revoked are listed in
+the summary and do not stop the revocation.
+
+With --client-id, a client is cut off instead, for instance after its key
+was compromised. The TGS puts it on its revocation list and refuses its TGTs
+from then on, so it gets no more service tickets. The ISV refuses the
+service tickets the client already holds and closes its sessions, except
+break-glass sessions. A TGT revocation is permanent: the client registers
+again under a new ID with a new key.`,
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+		if clientID != "" {
+			if len(args) > 0 || revokeFromFile != "" {
+				return fmt.Errorf("--client-id cannot be combined with device IDs")
+			}
+			return revokeClient()
+		}
+
+		deviceIDs := args
+		if revokeFromFile != "" {
+			if len(args) > 0 {
+				return fmt.Errorf("give device IDs either as arguments or with --from-file")
+			}
+			if deviceIDs, err = auth.ReadDeviceIDs(revokeFromFile); err != nil {
+				return err
+			}
+			if revokeCheckpoint == "" {
+				revokeCheckpoint = revokeFromFile + ".checkpoint"
+			}
+		} else if revokeCheckpoint != "" {
+			return fmt.Errorf("--checkpoint requires --from-file")
+		}
+		if len(deviceIDs) == 0 {
+			return fmt.Errorf("no device IDs to revoke")
+		}
+		if strings.TrimSpace(revokeReason) == "" {
+			return fmt.Errorf("--reason is required")
+		}
+		if revokeRate < 0 {
+			return fmt.Errorf("--rate cannot be negative")
+		}
+
+		checkpoint := &auth.RevocationCheckpoint{}
+		if revokeCheckpoint != "" {
+			if revokeRestart {
+				if err := os.Remove(revokeCheckpoint); err != nil && !os.IsNotExist(err) {
+					return fmt.Errorf("failed to remove checkpoint: %v", err)
+				}
+			}
+			if checkpoint, err = auth.LoadRevocationCheckpoint(revokeCheckpoint, deviceIDs, revokeReason); err != nil {
+				return fmt.Errorf("%v (use --restart to discard it)", err)
+			}
+		} else {
+			checkpoint.Reason = revokeReason
+			checkpoint.Total = len(deviceIDs)
+		}
+
+		remaining := checkpoint.Total - checkpoint.Done
+		if checkpoint.Done > 0 {
+			log.Infof("Resuming from %s: %d of %d devices done", revokeCheckpoint, checkpoint.Done, checkpoint.Total)
+		}
+		if err := confirmDestructive(fmt.Sprintf("revoke %d devices", remaining), remaining); err != nil {
+			return err
+		}
+
+		deviceManager, err := newDeviceManager()
+		if err != nil {
+			return err
+		}
+
+		reporter := newProgress("revoke", checkpoint.Total)
+		defer func() { reporter.Done(err) }()
+		reporter.Set(checkpoint.Done, "")
+
+		options := auth.RevocationOptions{
+			Reason:     revokeReason,
+			BatchSize:  revokeBatchSize,
+			Rate:       revokeRate,
+			Checkpoint: revokeCheckpoint,
+			MaxRetries: revokeMaxRetries,
+		}
+		err = deviceManager.RevokeDevices(deviceIDs, checkpoint, options, func(checkpoint *auth.RevocationCheckpoint) {
+			reporter.Set(checkpoint.Done, fmt.Sprintf("batch %d", checkpoint.Batches))
+		})
+		if err != nil {
+			if revokeCheckpoint != "" {
+				return fmt.Errorf("%v; %d of %d devices done, run the command again to resume", err, checkpoint.Done, checkpoint.Total)
+			}
+			return err
+		}
+		if revokeCheckpoint != "" {
+			if err := os.Remove(revokeCheckpoint); err != nil && !os.IsNotExist(err) {
+				log.Warnf("Failed to remove checkpoint: %v", err)
+			}
+		}
+
+		if revokeSummaryJSON {
+			return printJSON(checkpoint)
+		}
+		fmt.Printf("%d revoked, %d already revoked, %d sessions closed\n", checkpoint.Revoked, checkpoint.AlreadyRevoked, checkpoint.ClosedSessions)
+		if len(checkpoint.NotFound) > 0 {
+			fmt.Printf("Not found (%d): %s\n", len(checkpoint.NotFound), strings.Join(checkpoint.NotFound, ", "))
+		}
+		if len(checkpoint.Denied) > 0 {
+			fmt.Printf("Owned by another organization (%d): %s\n", len(checkpoint.Denied), strings.Join(checkpoint.Denied, ", "))
+		}
+		return nil
+	},
+}
+
+// revokeClient revokes the TGTs and service tickets of --client-id
+func revokeClient() error {
+	if strings.TrimSpace(revokeReason) == "" {
+		return fmt.Errorf("--reason is required")
+	}
+	if err := confirmDestructive(fmt.Sprintf("revoke client %s", clientID), 1); err != nil {
+		return err
+	}
+
+	deviceManager, err := newDeviceManager()
+	if err != nil {
+		return err
+	}
+
+	revocation, err := deviceManager.RevokeClient(clientID, revokeReason)
+	if err != nil {
+		return fmt.Errorf("failed to revoke client: %v", err)
+	}
+
+	if revokeSummaryJSON {
+		return printJSON(revocation)
+	}
+	fmt.Printf("TGTs of %s refused since %s\n", clientID, revocation.TGTs.RevokedAt.Format(time.RFC3339))
+	fmt.Printf("Service tickets issued up to %s refused, %d sessions closed\n",
+		revocation.Tickets.RevokedAt.Format(time.RFC3339), len(revocation.Tickets.ClosedSessions))
+	return nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/chaichis-network/v3/pkg/table"
+	"github.com/spf13/cobra"
+)
+
+var (
+	sourceIP       string
+	stepUpCode     string
+	riskPolicyFile string
+)
+
+func init() {
+	setRiskPolicyCmd.Flags().StringVar(&riskPolicyFile, "file", "", "JSON risk policy file")
+	setRiskPolicyCmd.MarkFlagRequired("file")
+
+	riskDecisionsCmd.Flags().StringVar(&clientID, "client-id", "", "Client ID")
+	riskDecisionsCmd.MarkFlagRequired("client-id")
+	addListFlags(riskDecisionsCmd)
+
+	issueStepUpCodeCmd.Flags().StringVar(&clientID, "client-id", "", "Client with a pending OTP step-up")
+	issueStepUpCodeCmd.MarkFlagRequired("client-id")
+
+	approveStepUpCmd.Flags().StringVar(&clientID, "client-id", "", "Client with a pending step-up")
+	approveStepUpCmd.MarkFlagRequired("client-id")
+
+	riskCmd.AddCommand(setRiskPolicyCmd)
+	riskCmd.AddCommand(getRiskPolicyCmd)
+	riskCmd.AddCommand(riskDecisionsCmd)
+	riskCmd.AddCommand(issueStepUpCodeCmd)
+	riskCmd.AddCommand(approveStepUpCmd)
+
+	rootCmd.AddCommand(riskCmd)
+}
+
+var riskCmd = &cobra.Command{
+	Use:   "risk",
+	Short: "Manage adaptive authentication (risk policy and step-ups)",
+}
+
+var setRiskPolicyCmd = &cobra.Command{
+	Use:   "set-policy",
+	Short: "Store the AS risk policy",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		policyJSON, err := ioutil.ReadFile(riskPolicyFile)
+		if err != nil {
+			return fmt.Errorf("failed to read risk policy file: %v", err)
+		}
+
+		clientManager, err := newClientManager()
+		if err != nil {
+			return err
+		}
+		defer clientManager.Close()
+
+		if err := clientManager.SetRiskPolicy(policyJSON); err != nil {
+			return fmt.Errorf("failed to set risk policy: %v", err)
+		}
+		return nil
+	},
+}
+
+var getRiskPolicyCmd = &cobra.Command{
+	Use:   "get-policy",
+	Short: "Show the AS risk policy",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		clientManager, err := newClientManager()
+		if err != nil {
+			return err
+		}
+		defer clientManager.Close()
+
+		policy, err := clientManager.GetRiskPolicy()
+		if err != nil {
+			return fmt.Errorf("failed to get risk policy: %v", err)
+		}
+		if policy == nil {
+			fmt.Println("No risk policy is set; every attempt is allowed")
+			return nil
+		}
+
+		output, err := json.MarshalIndent(policy, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal risk policy: %v", err)
+		}
+		fmt.Println(string(output))
+		return nil
+	},
+}
+
+var riskDecisionsCmd = &cobra.Command{
+	Use:   "decisions",
+	Short: "Show the risk decisions recorded for a client",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		clientManager, err := newClientManager()
+		if err != nil {
+			return err
+		}
+		defer clientManager.Close()
+
+		decisions, err := clientManager.RiskDecisions(clientID)
+		if err != nil {
+			return fmt.Errorf("failed to get risk decisions: %v", err)
+		}
+
+		t := table.New("decision", "action", "step-up", "ip", "hour", "failures", "reasons")
+		for _, decision := range decisions {
+			t.Append(decision.DecisionID, decision.Action, decision.StepUp, decision.SourceIP,
+				decision.Hour, decision.RecentFailures, strings.Join(decision.Reasons, "; "))
+		}
+		return printList(t, decisions)
+	},
+}
+
+var issueStepUpCodeCmd = &cobra.Command{
+	Use:   "issue-code",
+	Short: "Issue a one-time code for a client's pending OTP step-up",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		clientManager, err := newClientManager()
+		if err != nil {
+			return err
+		}
+		defer clientManager.Close()
+
+		code, err := clientManager.IssueStepUpCode(clientID)
+		if err != nil {
+			return fmt.Errorf("failed to issue step-up code: %v", err)
+		}
+
+		fmt.Println(code)
+		fmt.Printf("Give this code to the client out of band; it is used with: authcli authenticate --client-id %s --otp <code>\n", clientID)
+		return nil
+	},
+}
+
+var approveStepUpCmd = &cobra.Command{
+	Use:   "approve",
+	Short: "Approve a client's pending step-up",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		clientManager, err := newClientManager()
+		if err != nil {
+			return err
+		}
+		defer clientManager.Close()
+
+		if err := clientManager.ApproveStepUp(clientID); err != nil {
+			return fmt.Errorf("failed to approve step-up: %v", err)
+		}
+		return nil
+	},
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/chaichis-network/v3/internal/fabric"
+	"github.com/chaichis-network/v3/pkg/table"
+	"github.com/spf13/cobra"
+)
+
+var (
+	searchFilter fabric.SearchFilter
+	searchAll    bool
+)
+
+func init() {
+	for _, cmd := range []*cobra.Command{searchDevicesCmd, searchClientsCmd} {
+		cmd.Flags().StringVarP(&searchFilter.Labels, "selector", "l", "", "Label selector, e.g. site=plant-7,type=hvac (also key!=value, key, !key)")
+		cmd.Flags().StringVar(&searchFilter.RegisteredAfter, "registered-after", "", "Only records registered at or after this time (RFC3339)")
+		cmd.Flags().StringVar(&searchFilter.RegisteredBefore, "registered-before", "", "Only records registered at or before this time (RFC3339)")
+		cmd.Flags().Int32Var(&searchFilter.PageSize, "page-size", 50, "Results per page (at most 200)")
+		cmd.Flags().StringVar(&searchFilter.Bookmark, "bookmark", "", "Bookmark returned by the previous page")
+		cmd.Flags().BoolVar(&searchAll, "all", false, "Follow bookmarks and print every matching record")
+		addListFlags(cmd)
+	}
+	searchDevicesCmd.Flags().StringVar(&searchFilter.Status, "status", "", "Device status (active, inactive, busy, maintenance)")
+	searchDevicesCmd.Flags().StringVar(&searchFilter.Capability, "capability", "", "Devices offering this capability")
+	searchDevicesCmd.Flags().StringVar(&searchFilter.Owner, "owner", "", "MSP ID that registered the device")
+	searchClientsCmd.Flags().StringVar(&searchFilter.Status, "status", "", "Client status (valid, invalid)")
+
+	searchCmd.AddCommand(searchDevicesCmd)
+	searchCmd.AddCommand(searchClientsCmd)
+
+	rootCmd.AddCommand(searchCmd)
+}
+
+var searchCmd = &cobra.Command{
+	Use:   "search",
+	Short: "Search registered devices and clients with filters",
+	Long: `Runs a filtered, paginated query against the ISV (devices) or AS (clients)
+chaincode. These queries use CouchDB selectors, so the peers must use a
+CouchDB state database. Without --all, one page is printed with the bookmark
+for the next page.
+
+-l takes a label selector: comma-separated requirements that must all hold,
+each key=value, key!=value, key (label set) or !key (label not set). Labels
+are maintained with "authcli labels".`,
+}
+
+var searchDevicesCmd = &cobra.Command{
+	Use:   "devices",
+	Short: "Search IoT devices by status, capability, owner, labels and registration date",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		deviceManager, err := newDeviceManager()
+		if err != nil {
+			return err
+		}
+
+		filter := searchFilter
+		page, err := deviceManager.SearchDevices(filter)
+		if err != nil {
+			return fmt.Errorf("failed to search devices: %v", err)
+		}
+		if !searchAll {
+			if err := printList(deviceTable(page.Devices), page); err != nil {
+				return err
+			}
+			printNextPage(page.Bookmark)
+			return nil
+		}
+
+		devices := page.Devices
+		for page.Bookmark != "" {
+			filter.Bookmark = page.Bookmark
+			if page, err = deviceManager.SearchDevices(filter); err != nil {
+				return fmt.Errorf("failed to search devices: %v", err)
+			}
+			devices = append(devices, page.Devices...)
+		}
+		return printList(deviceTable(devices), devices)
+	},
+}
+
+var searchClientsCmd = &cobra.Command{
+	Use:   "clients",
+	Short: "Search client registrations by status, labels and registration date",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		clientManager, err := newClientManager()
+		if err != nil {
+			return err
+		}
+
+		filter := searchFilter
+		page, err := clientManager.SearchClients(filter)
+		if err != nil {
+			return fmt.Errorf("failed to search clients: %v", err)
+		}
+		if !searchAll {
+			if err := printList(clientTable(page.Clients), page); err != nil {
+				return err
+			}
+			printNextPage(page.Bookmark)
+			return nil
+		}
+
+		clients := page.Clients
+		for page.Bookmark != "" {
+			filter.Bookmark = page.Bookmark
+			if page, err = clientManager.SearchClients(filter); err != nil {
+				return fmt.Errorf("failed to search clients: %v", err)
+			}
+			clients = append(clients, page.Clients...)
+		}
+		return printList(clientTable(clients), clients)
+	},
+}
+
+func deviceTable(devices []map[string]interface{}) *table.Table {
+	t := table.New("device", "status", "owner", "profile", "capabilities", "labels", "registered", "last-seen")
+	for _, device := range devices {
+		t.Append(cell(device, "deviceID"), cell(device, "status"), cell(device, "owner"), cell(device, "capabilityProfile"),
+			cell(device, "capabilities"), cell(device, "labels"), cell(device, "registeredAt"), cell(device, "lastSeen"))
+	}
+	return t
+}
+
+func clientTable(clients []map[string]interface{}) *table.Table {
+	t := table.New("client", "valid", "labels", "registered")
+	for _, client := range clients {
+		t.Append(cell(client, "id"), cell(client, "valid"), cell(client, "labels"), cell(client, "registrationTime"))
+	}
+	return t
+}
@@ -0,0 +1,394 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/chaichis-network/v3/internal/auth"
+	"github.com/chaichis-network/v3/internal/fabric"
+	"github.com/chaichis-network/v3/pkg/table"
+	"github.com/spf13/cobra"
+)
+
+var (
+	serviceKeysChaincode   string
+	serviceKeysPeer        string
+	serviceKeysFingerprint string
+	serviceKeysExpectISV   string
+	serviceKeysExpectTGS   string
+	serviceKeysExpectAS    string
+	serviceKeysPrivateKey  string
+	serviceKeysCollection  string
+	serviceKeysVaultPath   string
+	serviceKeysVaultField  string
+	serviceKeysVaultVer    int64
+	serviceKeysDryRun      bool
+)
+
+// serviceKeyDependencies maps each chaincode to the chaincode whose key it
+// imports
+var serviceKeyDependencies = map[string]string{
+	"as":  fabric.TGSContractID,
+	"tgs": fabric.ISVContractID,
+}
+
+func init() {
+	for _, cmd := range []*cobra.Command{showServiceKeyCmd, publishServiceKeyCmd, importServiceKeyCmd, initServiceKeysCmd, migrateServiceKeysCmd, serviceKeyStatusCmd} {
+		cmd.Flags().StringVar(&serviceKeysChaincode, "chaincode", "", "Chaincode: as, tgs or isv")
+		cmd.MarkFlagRequired("chaincode")
+	}
+	importServiceKeyCmd.Flags().StringVar(&serviceKeysPeer, "peer-chaincode", "", "Chaincode publishing the key (default: the TGS for as, the ISV for tgs)")
+	importServiceKeyCmd.Flags().StringVar(&serviceKeysFingerprint, "fingerprint", "", "Expected fingerprint of the published key, as shown by 'service-keys show'")
+	importServiceKeyCmd.MarkFlagRequired("fingerprint")
+	verifyServiceKeysCmd.Flags().StringVar(&serviceKeysExpectISV, "expect-isv", "", "Fingerprint the ISV key must have, from the key ceremony")
+	verifyServiceKeysCmd.Flags().StringVar(&serviceKeysExpectTGS, "expect-tgs", "", "Fingerprint the TGS key must have, from the key ceremony")
+	verifyServiceKeysCmd.Flags().StringVar(&serviceKeysExpectAS, "expect-as", "", "Fingerprint the AS key must have, from the key ceremony")
+	addListFlags(verifyServiceKeysCmd)
+	initServiceKeysCmd.Flags().StringVar(&serviceKeysPrivateKey, "private-key", "", "PEM file with the chaincode's RSA private key (optional with --collection if the key is already there)")
+	initServiceKeysCmd.Flags().StringVar(&serviceKeysCollection, "collection", "", "Private data collection to keep the private key in (default: world state)")
+	migrateServiceKeysCmd.Flags().StringVar(&serviceKeysPrivateKey, "private-key", "", "PEM file with the new RSA private key (default: keep the current key pair)")
+	migrateServiceKeysCmd.Flags().StringVar(&serviceKeysCollection, "collection", "", "Private data collection to keep the private key in (default: world state)")
+	for _, cmd := range []*cobra.Command{initServiceKeysCmd, migrateServiceKeysCmd} {
+		cmd.Flags().StringVar(&serviceKeysVaultPath, "vault-path", "", "Vault KV v2 secret holding the private key, instead of --private-key")
+		cmd.Flags().Int64Var(&serviceKeysVaultVer, "vault-version", 0, "Version of the Vault secret (default: the current one)")
+	}
+	for _, cmd := range []*cobra.Command{initServiceKeysCmd, migrateServiceKeysCmd, vaultSyncServiceKeysCmd} {
+		cmd.Flags().StringVar(&serviceKeysVaultField, "vault-field", auth.VaultDefaultField, "Field of the Vault secret holding the PEM private key")
+	}
+	vaultSyncServiceKeysCmd.Flags().BoolVar(&serviceKeysDryRun, "dry-run", false, "Only report which chaincodes are behind their Vault secret")
+	addListFlags(vaultSyncServiceKeysCmd)
+
+	serviceKeysCmd.AddCommand(showServiceKeyCmd)
+	serviceKeysCmd.AddCommand(publishServiceKeyCmd)
+	serviceKeysCmd.AddCommand(importServiceKeyCmd)
+	serviceKeysCmd.AddCommand(verifyServiceKeysCmd)
+	serviceKeysCmd.AddCommand(initServiceKeysCmd)
+	serviceKeysCmd.AddCommand(migrateServiceKeysCmd)
+	serviceKeysCmd.AddCommand(serviceKeyStatusCmd)
+	serviceKeysCmd.AddCommand(vaultSyncServiceKeysCmd)
+
+	rootCmd.AddCommand(serviceKeysCmd)
+}
+
+var serviceKeysCmd = &cobra.Command{
+	Use:   "service-keys",
+	Short: "Publish and import the public keys chaincodes need from each other",
+	Long: `The AS encrypts TGTs for the TGS and the TGS encrypts service tickets for
+the ISV, so each needs the next service's public key before it can be
+initialized. Each chaincode is initialized with a key pair the operator
+supplies ('service-keys init'). Bring the services up in this order:
+
+  ISV: init, then 'service-keys publish --chaincode isv'
+  TGS: 'service-keys import --chaincode tgs --fingerprint <isv>', init,
+       then 'service-keys publish --chaincode tgs'
+  AS:  'service-keys import --chaincode as --fingerprint <tgs>', init,
+       then 'service-keys publish --chaincode as'
+  TGS: 'service-keys import --chaincode tgs --peer-chaincode as_chaincode_1.1
+       --fingerprint <as>', to check the client changes the AS signs
+
+then run 'service-keys verify' before declaring the system operational.`,
+}
+
+var showServiceKeyCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show the public key a chaincode has published",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withChaincodeContract(serviceKeysChaincode, func(fabricClient *fabric.Client, contractID string) error {
+			contract, err := fabricClient.GetContract(contractID)
+			if err != nil {
+				return err
+			}
+			key, err := fabricClient.GetPublishedPublicKey(contract)
+			if err != nil {
+				return err
+			}
+			return printJSON(key)
+		})
+	},
+}
+
+var publishServiceKeyCmd = &cobra.Command{
+	Use:   "publish",
+	Short: "Publish a chaincode's public key for the services that depend on it",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withChaincodeContract(serviceKeysChaincode, func(fabricClient *fabric.Client, contractID string) error {
+			contract, err := fabricClient.GetContract(contractID)
+			if err != nil {
+				return err
+			}
+			key, err := fabricClient.PublishPublicKey(contract)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("%s public key published on %s\n", key.Service, contractID)
+			fmt.Printf("Fingerprint: %s\n", key.Fingerprint)
+			return nil
+		})
+	},
+}
+
+var importServiceKeyCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Import the public key a chaincode depends on, checking its fingerprint",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		peerChaincode := serviceKeysPeer
+		if peerChaincode == "" {
+			var ok bool
+			if peerChaincode, ok = serviceKeyDependencies[serviceKeysChaincode]; !ok {
+				return fmt.Errorf("chaincode %q does not import a service key (expected as or tgs)", serviceKeysChaincode)
+			}
+		}
+
+		return withChaincodeContract(serviceKeysChaincode, func(fabricClient *fabric.Client, contractID string) error {
+			contract, err := fabricClient.GetContract(contractID)
+			if err != nil {
+				return err
+			}
+			key, err := fabricClient.ImportPeerServiceKey(contract, peerChaincode, serviceKeysFingerprint)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Imported %s public key from %s into %s\n", key.Service, peerChaincode, contractID)
+			return nil
+		})
+	},
+}
+
+var initServiceKeysCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Initialize a chaincode with an operator-supplied key pair",
+	Long: `Initializes a chaincode with the RSA key pair in --private-key, e.g. one made
+with 'openssl genrsa -out as.key 2048'. The key pair is passed as transient
+data, so it is not recorded on the ledger. With --collection the chaincode
+keeps its private key in that private data collection, which must be in the
+chaincode definition and include every endorsing organization; otherwise it
+keeps it in world state. Without --private-key the chaincode uses the
+private key already in the collection, e.g. after a world state reset. Key
+pairs once published in the chaincode source are refused.
+
+With --vault-path the private key is read from Vault instead of a file (see
+'service-keys vault-sync').`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		keys, source, err := loadServiceKeys()
+		if err != nil {
+			return err
+		}
+		if keys == nil && serviceKeysCollection == "" {
+			return fmt.Errorf("--private-key or --vault-path is required unless the key is in a --collection")
+		}
+
+		return withChaincodeContract(serviceKeysChaincode, func(fabricClient *fabric.Client, contractID string) error {
+			contract, err := fabricClient.GetContract(contractID)
+			if err != nil {
+				return err
+			}
+			if err := fabricClient.InitializeWithKeys(contract, fabric.KeyBootstrap{Collection: serviceKeysCollection, Source: source}, keys); err != nil {
+				return err
+			}
+
+			fmt.Printf("%s initialized\n", contractID)
+			return nil
+		})
+	},
+}
+
+var migrateServiceKeysCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Replace a chaincode's key pair or move its private key",
+	Long: `Replaces the key pair of an initialized chaincode with the one in
+--private-key, or without it keeps the current key pair, and keeps the
+private key where --collection says. Chaincodes still running the key pair
+from source ('service-keys status' shows legacy) must be given a new one.
+Admin only.
+
+A new key pair must then be published and imported again by the services
+that depend on it, and tickets issued under the old key can no longer be
+read: migrate the ISV first, then re-import on the TGS, migrate the TGS,
+re-import on the AS, migrate the AS, and run 'service-keys verify'. Clients
+authenticate again afterwards. --vault-path reads the new private key from
+Vault; 'service-keys vault-sync' does all of this for keys kept there.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		keys, source, err := loadServiceKeys()
+		if err != nil {
+			return err
+		}
+		if err := confirmDestructive("migrate the "+serviceKeysChaincode+" key pair", 1); err != nil {
+			return err
+		}
+
+		return withChaincodeContract(serviceKeysChaincode, func(fabricClient *fabric.Client, contractID string) error {
+			contract, err := fabricClient.GetContract(contractID)
+			if err != nil {
+				return err
+			}
+			status, err := fabricClient.MigrateServiceKeys(contract, fabric.KeyBootstrap{Collection: serviceKeysCollection, Source: source}, keys)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("%s key pair migrated, fingerprint %s\n", status.Service, status.Fingerprint)
+			if keys != nil {
+				fmt.Printf("Publish it again with 'service-keys publish --chaincode %s'\n", serviceKeysChaincode)
+			}
+			return nil
+		})
+	},
+}
+
+var serviceKeyStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show a chaincode's key fingerprint and where its private key is kept",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withChaincodeContract(serviceKeysChaincode, func(fabricClient *fabric.Client, contractID string) error {
+			contract, err := fabricClient.GetContract(contractID)
+			if err != nil {
+				return err
+			}
+			status, err := fabricClient.GetServiceKeyStatus(contract)
+			if err != nil {
+				return err
+			}
+			return printJSON(status)
+		})
+	},
+}
+
+var verifyServiceKeysCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Check that the chaincodes were initialized with each other's keys",
+	Long: `Reads the record each chaincode made when it was initialized and checks
+that all three were initialized, that each one's key matches the key it
+published, and that the TGS was initialized with the ISV's key and the AS
+with the TGS's. With --expect-isv, --expect-tgs and --expect-as, each
+service's key must also have the fingerprint recorded at the key ceremony.
+
+Exits non-zero unless every check passes; do not declare the system
+operational until it does.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		expected := map[string]string{}
+		for service, fingerprint := range map[string]string{"isv": serviceKeysExpectISV, "tgs": serviceKeysExpectTGS, "as": serviceKeysExpectAS} {
+			if fingerprint != "" {
+				expected[service] = fingerprint
+			}
+		}
+
+		// The checks read all three chaincodes over one connection
+		return withChaincodeContract("isv", func(fabricClient *fabric.Client, _ string) error {
+			checks, err := auth.VerifyKeyCeremony(fabricClient, expected)
+			if err != nil {
+				return err
+			}
+
+			failed := 0
+			for _, check := range checks {
+				if !check.Passed {
+					failed++
+				}
+			}
+			t := table.New("check", "status", "detail")
+			for _, check := range checks {
+				status := "PASS"
+				if !check.Passed {
+					status = "FAIL"
+				}
+				t.Append(check.Check, status, check.Detail)
+			}
+			if err := printList(t, checks); err != nil {
+				return err
+			}
+
+			if failed > 0 {
+				return fmt.Errorf("%d of %d key checks failed; the system is not operational", failed, len(checks))
+			}
+			fmt.Fprintln(os.Stderr, "All key checks passed")
+			return nil
+		})
+	},
+}
+
+var vaultSyncServiceKeysCmd = &cobra.Command{
+	Use:   "vault-sync",
+	Short: "Rotate chaincodes whose Vault secret has a newer version",
+	Long: `Compares the Vault secret version each chaincode recorded when it was
+initialized or migrated with --vault-path against the secret's current
+version. Writing a new version of a secret therefore triggers a rotation:
+the chaincode is migrated to the new key pair, keeping its private key where
+it is, the new public key is published, and the chaincode that depends on it
+imports it with the new fingerprint. Chaincodes are rotated in startup order
+(ISV, TGS, AS). Tickets issued under an old key can no longer be read, so
+each rotation asks for confirmation. Admin only.
+
+The vault command must be in PATH and logged in (VAULT_ADDR with VAULT_TOKEN
+or 'vault login'). Keys are read into memory only. Chaincodes initialized
+from files are left alone. With --dry-run nothing changes; the command can
+run on a schedule to report, or with --yes to rotate unattended. Run
+'service-keys verify' and 'admin selftest' afterwards.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// The rotations reach all three chaincodes over one connection
+		return withChaincodeContract("isv", func(fabricClient *fabric.Client, _ string) error {
+			rotations, err := auth.VaultKeyRotations(fabricClient)
+			if err != nil {
+				return err
+			}
+			if len(rotations) == 0 {
+				fmt.Fprintln(os.Stderr, "No chaincode was initialized from Vault")
+				return nil
+			}
+
+			rotated := 0
+			for _, rotation := range rotations {
+				if !rotation.Due() || serviceKeysDryRun {
+					continue
+				}
+				action := fmt.Sprintf("rotate the %s key pair to version %d of %s", rotation.Service, rotation.LatestVersion, rotation.Path)
+				if err := confirmDestructive(action, 1); err != nil {
+					return err
+				}
+				if err := auth.RotateFromVault(fabricClient, rotation, serviceKeysVaultField); err != nil {
+					return err
+				}
+				log.Infof("%s rotated to Vault version %d, fingerprint %s", rotation.Service, rotation.LatestVersion, rotation.Fingerprint)
+				rotated++
+			}
+
+			t := table.New("service", "path", "version", "latest", "status")
+			for _, rotation := range rotations {
+				status := "up to date"
+				switch {
+				case rotation.Fingerprint != "":
+					status = "rotated to " + rotation.Fingerprint
+				case rotation.Due():
+					status = "due"
+				}
+				t.Append(rotation.Service, rotation.Path, fmt.Sprint(rotation.CurrentVersion), fmt.Sprint(rotation.LatestVersion), status)
+			}
+			if err := printList(t, rotations); err != nil {
+				return err
+			}
+			if rotated > 0 {
+				fmt.Fprintln(os.Stderr, "Run 'service-keys verify' and 'admin selftest' to check the rotated keys")
+			}
+			return nil
+		})
+	},
+}
+
+// loadServiceKeys reads the key pair given by --private-key or --vault-path,
+// with the source to record for a Vault key. Neither gives a nil pair.
+func loadServiceKeys() (*fabric.ServiceKeyPair, *fabric.KeySource, error) {
+	switch {
+	case serviceKeysPrivateKey != "" && serviceKeysVaultPath != "":
+		return nil, nil, fmt.Errorf("--private-key and --vault-path are exclusive")
+	case serviceKeysVaultPath != "":
+		return auth.LoadVaultServiceKeyPair(auth.VaultKey{Path: serviceKeysVaultPath, Field: serviceKeysVaultField, Version: serviceKeysVaultVer})
+	case serviceKeysPrivateKey != "":
+		keys, err := auth.LoadServiceKeyPair(serviceKeysPrivateKey)
+		return keys, nil, err
+	}
+	if serviceKeysVaultVer != 0 {
+		return nil, nil, fmt.Errorf("--vault-version needs --vault-path")
+	}
+	return nil, nil, nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/chaichis-network/v3/internal/auth"
+	"github.com/chaichis-network/v3/internal/fabric"
+	"github.com/spf13/cobra"
+)
+
+var serviceIDs string
+
+func init() {
+	serviceTicketsCmd.Flags().StringVar(&clientID, "client-id", "", "Client ID (must hold a TGT from 'authenticate')")
+	serviceTicketsCmd.Flags().StringVar(&serviceIDs, "services", "", "Comma-separated service IDs, e.g. telemetry,control")
+	serviceTicketsCmd.MarkFlagRequired("client-id")
+	serviceTicketsCmd.MarkFlagRequired("services")
+
+	rootCmd.AddCommand(serviceTicketsCmd)
+}
+
+// newClientManager connects to the network and returns a client manager
+func newClientManager() (*auth.ClientManager, error) {
+	// Create Fabric client
+	fabricClient, err := fabric.NewClient(fabric.ClientOptions{
+		ConfigPath:      configPath,
+		WalletPath:      walletPath,
+		Wallet:          walletOptions(),
+		Debug:           debugMode,
+		Peers:           peerRoles(),
+		AgeIdentityFile: ageIdentity,
+		API:             fabricAPI,
+		GatewayPeer:     gatewayPeer,
+		Strict:          strictMode,
+		FlowID:          flowID,
+		Pool:            connectionPool,
+		TransactionLog:  transactionLog,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Fabric client: %v", err)
+	}
+
+	// Ensure identity exists in wallet
+	if err := fabricClient.EnsureIdentity(identityName); err != nil {
+		return nil, fmt.Errorf("failed to ensure identity: %v", err)
+	}
+
+	clientManager, err := auth.NewClientManager(fabricClient, identityName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client manager: %v", err)
+	}
+	return clientManager, nil
+}
+
+var serviceTicketsCmd = &cobra.Command{
+	Use:   "service-tickets",
+	Short: "Get tickets for several services in one TGS round trip",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var services []string
+		for _, serviceID := range strings.Split(serviceIDs, ",") {
+			if serviceID = strings.TrimSpace(serviceID); serviceID != "" {
+				services = append(services, serviceID)
+			}
+		}
+		if len(services) == 0 {
+			return fmt.Errorf("at least one service ID is required")
+		}
+
+		clientManager, err := newClientManager()
+		if err != nil {
+			return err
+		}
+		defer clientManager.Close()
+
+		files, err := clientManager.RequestServiceTickets(clientID, services)
+		if err != nil {
+			return fmt.Errorf("failed to get service tickets: %v", err)
+		}
+
+		sort.Strings(services)
+		for _, serviceID := range services {
+			fmt.Printf("%s: %s\n", serviceID, files[serviceID])
+		}
+		return nil
+	},
+}
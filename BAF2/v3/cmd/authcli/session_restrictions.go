@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/chaichis-network/v3/internal/fabric"
+	"github.com/spf13/cobra"
+)
+
+var (
+	restrictSessionID    string
+	restrictCapabilities string
+	checkCapability      string
+)
+
+func init() {
+	restrictSessionCmd.Flags().StringVar(&deviceID, "device-id", "", "Device ID whose key signs the restriction")
+	restrictSessionCmd.Flags().StringVar(&restrictSessionID, "session-id", "", "Session to restrict")
+	restrictSessionCmd.Flags().StringVar(&restrictCapabilities, "capabilities", "", "Comma-separated capabilities the session keeps")
+	restrictSessionCmd.MarkFlagRequired("device-id")
+	restrictSessionCmd.MarkFlagRequired("session-id")
+	restrictSessionCmd.MarkFlagRequired("capabilities")
+
+	checkSessionCmd.Flags().StringVar(&restrictSessionID, "session-id", "", "Session to check")
+	checkSessionCmd.Flags().StringVar(&checkCapability, "capability", "", "Capability the request needs")
+	checkSessionCmd.MarkFlagRequired("session-id")
+	checkSessionCmd.MarkFlagRequired("capability")
+
+	watchRestrictionsCmd.Flags().StringVar(&clientID, "client-id", "", "Client whose sessions to watch")
+	watchRestrictionsCmd.MarkFlagRequired("client-id")
+
+	rootCmd.AddCommand(restrictSessionCmd)
+	rootCmd.AddCommand(checkSessionCmd)
+	rootCmd.AddCommand(watchRestrictionsCmd)
+}
+
+var restrictSessionCmd = &cobra.Command{
+	Use:   "restrict-session",
+	Short: "Shrink the capabilities of an active session (device side)",
+	Long: `Restricts an active session to a subset of its capabilities, e.g. when the
+device enters safe mode. The restriction is signed with the device key, can
+only remove capabilities, and applies to every request checked after it is
+committed. The client is notified through a SessionRestricted event.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var capabilities []string
+		for _, capability := range strings.Split(restrictCapabilities, ",") {
+			if capability = strings.TrimSpace(capability); capability != "" {
+				capabilities = append(capabilities, capability)
+			}
+		}
+		if len(capabilities) == 0 {
+			return fmt.Errorf("at least one capability must remain; use close-session to end access")
+		}
+
+		deviceManager, err := newDeviceManager()
+		if err != nil {
+			return err
+		}
+		if err := deviceManager.RestrictSession(deviceID, restrictSessionID, capabilities); err != nil {
+			return fmt.Errorf("failed to restrict session: %v", err)
+		}
+		return nil
+	},
+}
+
+var checkSessionCmd = &cobra.Command{
+	Use:   "check-session",
+	Short: "Check whether a session may use a capability",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		deviceManager, err := newDeviceManager()
+		if err != nil {
+			return err
+		}
+
+		allowed, err := deviceManager.CheckSessionCapability(restrictSessionID, checkCapability)
+		if err != nil {
+			return fmt.Errorf("failed to check session: %v", err)
+		}
+		if !allowed {
+			return fmt.Errorf("session %s may not use %s", restrictSessionID, checkCapability)
+		}
+		fmt.Printf("Session %s may use %s\n", restrictSessionID, checkCapability)
+		return nil
+	},
+}
+
+var watchRestrictionsCmd = &cobra.Command{
+	Use:   "watch-restrictions",
+	Short: "Print restrictions of a client's sessions as devices make them",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		deviceManager, err := newDeviceManager()
+		if err != nil {
+			return err
+		}
+
+		stop := make(chan struct{})
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-signals
+			close(stop)
+		}()
+
+		log.Infof("Watching session restrictions for client %s", clientID)
+		return deviceManager.WatchSessionRestrictions(clientID, func(restriction fabric.AccessLogEntry) {
+			fmt.Printf("%s  session %s on %s restricted to %s\n", restriction.Timestamp.Format(time.RFC3339),
+				restriction.SessionID, restriction.DeviceID, strings.Join(restriction.Capabilities, ", "))
+		}, stop)
+	},
+}
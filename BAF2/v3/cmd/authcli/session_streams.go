@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/chaichis-network/v3/internal/fabric"
+	"github.com/chaichis-network/v3/pkg/securechannel"
+	"github.com/chaichis-network/v3/pkg/table"
+	"github.com/spf13/cobra"
+)
+
+var (
+	streamSessionID  string
+	streamID         uint16
+	streamName       string
+	streamCapability string
+	streamCounters   securechannel.Counters
+)
+
+func init() {
+	openStreamCmd.Flags().StringVar(&streamName, "name", "", "Name of the stream, e.g. telemetry")
+	openStreamCmd.Flags().StringVar(&streamCapability, "capability", "", "Capability the stream's traffic uses")
+	openStreamCmd.MarkFlagRequired("capability")
+
+	reportStreamCmd.Flags().Int64Var(&streamCounters.Messages, "messages", 0, "Messages carried on the stream so far")
+	reportStreamCmd.Flags().Int64Var(&streamCounters.Bytes, "bytes", 0, "Payload bytes carried on the stream so far")
+	reportStreamCmd.Flags().Int64Var(&streamCounters.Rejected, "rejected", 0, "Frames refused on the stream so far")
+
+	for _, cmd := range []*cobra.Command{openStreamCmd, closeStreamCmd, reportStreamCmd} {
+		cmd.Flags().StringVar(&deviceID, "device-id", "", "Device ID whose key signs the change")
+		cmd.MarkFlagRequired("device-id")
+	}
+	for _, cmd := range []*cobra.Command{openStreamCmd, closeStreamCmd, reportStreamCmd, checkStreamCmd} {
+		cmd.Flags().Uint16Var(&streamID, "stream-id", 0, "Stream ID (1-65535)")
+		cmd.MarkFlagRequired("stream-id")
+	}
+	for _, cmd := range []*cobra.Command{openStreamCmd, closeStreamCmd, reportStreamCmd, checkStreamCmd, listStreamsCmd} {
+		cmd.Flags().StringVar(&streamSessionID, "session-id", "", "Session carrying the stream")
+		cmd.MarkFlagRequired("session-id")
+		streamCmd.AddCommand(cmd)
+	}
+	addListFlags(listStreamsCmd)
+	rootCmd.AddCommand(streamCmd)
+}
+
+var streamCmd = &cobra.Command{
+	Use:   "stream",
+	Short: "Multiplex logical streams within one session (device side)",
+	Long: `A session can carry several logical streams, e.g. telemetry, control and
+logs, each identified by a stream ID and opened under a capability the session
+holds. The device agent opens and closes streams and reports their counters,
+signed with the device key; the traffic itself travels in pkg/securechannel
+frames tagged with the stream ID. Restricting the session cuts off the streams
+whose capability it removes.`,
+}
+
+var openStreamCmd = &cobra.Command{
+	Use:   "open",
+	Short: "Open a stream in an active session",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		deviceManager, err := newDeviceManager()
+		if err != nil {
+			return err
+		}
+
+		stream, err := deviceManager.OpenSessionStream(deviceID, streamSessionID, streamID, streamName, streamCapability)
+		if err != nil {
+			return fmt.Errorf("failed to open stream: %v", err)
+		}
+		fmt.Printf("Stream %d opened in session %s for %s\n", stream.StreamID, stream.SessionID, stream.Capability)
+		return nil
+	},
+}
+
+var closeStreamCmd = &cobra.Command{
+	Use:   "close",
+	Short: "Close a stream, keeping its counters",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		deviceManager, err := newDeviceManager()
+		if err != nil {
+			return err
+		}
+
+		if err := deviceManager.CloseSessionStream(deviceID, streamSessionID, streamID); err != nil {
+			return fmt.Errorf("failed to close stream: %v", err)
+		}
+		return nil
+	},
+}
+
+var reportStreamCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Record a stream's running counters",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		deviceManager, err := newDeviceManager()
+		if err != nil {
+			return err
+		}
+
+		stream, err := deviceManager.ReportStreamCounters(deviceID, streamSessionID, streamID, streamCounters)
+		if err != nil {
+			return fmt.Errorf("failed to report stream counters: %v", err)
+		}
+		fmt.Printf("Stream %d: %d messages, %d bytes, %d rejected\n", stream.StreamID, stream.Messages, stream.Bytes, stream.Rejected)
+		return nil
+	},
+}
+
+var checkStreamCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Check whether a stream may carry traffic",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		deviceManager, err := newDeviceManager()
+		if err != nil {
+			return err
+		}
+
+		allowed, err := deviceManager.CheckStreamCapability(streamSessionID, streamID)
+		if err != nil {
+			return fmt.Errorf("failed to check stream: %v", err)
+		}
+		if !allowed {
+			return fmt.Errorf("stream %d of session %s may not carry traffic", streamID, streamSessionID)
+		}
+		fmt.Printf("Stream %d of session %s may carry traffic\n", streamID, streamSessionID)
+		return nil
+	},
+}
+
+var listStreamsCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the streams of a session with their counters",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		deviceManager, err := newDeviceManager()
+		if err != nil {
+			return err
+		}
+
+		streams, err := deviceManager.SessionStreams(streamSessionID)
+		if err != nil {
+			return fmt.Errorf("failed to list streams: %v", err)
+		}
+		return printList(sessionStreamTable(streams), streams)
+	},
+}
+
+func sessionStreamTable(streams []*fabric.SessionStream) *table.Table {
+	t := table.New("stream", "name", "capability", "status", "messages", "bytes", "rejected", "opened", "last-activity")
+	for _, stream := range streams {
+		t.Append(strconv.Itoa(int(stream.StreamID)), stream.Name, stream.Capability, stream.Status,
+			strconv.FormatInt(stream.Messages, 10), strconv.FormatInt(stream.Bytes, 10), strconv.FormatInt(stream.Rejected, 10),
+			timeCell(stream.OpenedAt), timeCell(stream.LastActivity))
+	}
+	return t
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/chaichis-network/v3/pkg/table"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// Global flags are resolved in order of precedence:
+//
+//  1. a flag given on the command line
+//  2. the environment variable AUTHCLI_<FLAG> (or an alias below)
+//  3. the selected profile in the settings file, then its defaults
+//  4. the flag's built-in default
+const settingsEnvPrefix = "AUTHCLI_"
+
+var (
+	settingsFile string
+	profileName  string
+
+	// activeProfile is the profile the settings were resolved with
+	activeProfile string
+
+	// settingSources records where each global flag's value came from
+	settingSources = map[string]string{}
+)
+
+// settingsEnvAliases names environment variables that do not follow the
+// AUTHCLI_<FLAG> pattern
+var settingsEnvAliases = map[string]string{
+	"config": "AUTHCLI_NETWORK",
+}
+
+// unsettableFlags must be given explicitly on each invocation
+var unsettableFlags = map[string]bool{
+	"config-file": true,
+	"profile":     true,
+	"yes":         true,
+}
+
+// SettingsFile holds flag defaults. Keys are global flag names; values are
+// strings, booleans or lists. Profile selects an entry of Profiles when
+// neither --profile nor AUTHCLI_PROFILE is set.
+type SettingsFile struct {
+	Profile  string                            `json:"profile"`
+	Defaults map[string]interface{}            `json:"defaults"`
+	Profiles map[string]map[string]interface{} `json:"profiles"`
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&settingsFile, "config-file", "", "Settings file with flag defaults and profiles (default: $AUTHCLI_CONFIG_FILE or <user config dir>/authcli/config.json)")
+	rootCmd.PersistentFlags().StringVar(&profileName, "profile", "", "Profile from the settings file, or the built-in \"auditor\" (default: $AUTHCLI_PROFILE or the file's \"profile\")")
+
+	addListFlags(settingsShowCmd)
+
+	settingsCmd.AddCommand(settingsShowCmd)
+	rootCmd.AddCommand(settingsCmd)
+}
+
+var settingsCmd = &cobra.Command{
+	Use:   "settings",
+	Short: "Inspect how global flags are resolved from flags, environment and settings file",
+	Long: `Global flags are resolved in order of precedence: command-line flag, then the
+environment variable AUTHCLI_<FLAG> (dashes become underscores, e.g.
+AUTHCLI_WALLET, AUTHCLI_SESSION_DIR; AUTHCLI_NETWORK sets --config), then the
+selected profile of the settings file, then the file's defaults, then the
+built-in default. --yes is never read from the environment or the file.`,
+}
+
+var settingsShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show the effective value and source of each global flag",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		names := make([]string, 0, len(settingSources))
+		for name := range settingSources {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		t := table.New("flag", "value", "source")
+		for _, name := range names {
+			t.Append("--"+name, rootCmd.PersistentFlags().Lookup(name).Value.String(), settingSources[name])
+		}
+		return printList(t, nil)
+	},
+}
+
+// applySettings fills global flags not given on the command line from the
+// environment and the settings file
+func applySettings(flags *pflag.FlagSet) error {
+	path, explicit := settingsFilePath()
+	fileValues, err := loadSettingsFile(flags, path, explicit)
+	if err != nil {
+		return err
+	}
+
+	var setErr error
+	flags.VisitAll(func(flag *pflag.Flag) {
+		if setErr != nil || unsettableFlags[flag.Name] {
+			return
+		}
+		if flag.Changed {
+			settingSources[flag.Name] = "flag"
+			return
+		}
+
+		source, value, ok := "", "", false
+		if env := settingsEnvName(flag.Name); os.Getenv(env) != "" {
+			source, value, ok = "env "+env, os.Getenv(env), true
+		} else if setting, found := fileValues[flag.Name]; found {
+			source, value, ok = setting.source, setting.value, true
+		}
+		if !ok {
+			settingSources[flag.Name] = "default"
+			return
+		}
+
+		if err := flag.Value.Set(value); err != nil {
+			setErr = fmt.Errorf("invalid value %q for --%s from %s: %v", value, flag.Name, source, err)
+			return
+		}
+		settingSources[flag.Name] = source
+	})
+	return setErr
+}
+
+// settingsFilePath returns the settings file to read, and whether it was
+// named explicitly
+func settingsFilePath() (string, bool) {
+	path := settingsFile
+	if path == "" {
+		path = os.Getenv(settingsEnvPrefix + "CONFIG_FILE")
+	}
+	explicit := path != ""
+	if !explicit {
+		if dir, err := os.UserConfigDir(); err == nil {
+			path = filepath.Join(dir, "authcli", "config.json")
+		}
+	}
+	return path, explicit
+}
+
+// settingsEnvName returns the environment variable for a global flag
+func settingsEnvName(flag string) string {
+	if alias, ok := settingsEnvAliases[flag]; ok {
+		return alias
+	}
+	return settingsEnvPrefix + strings.ToUpper(strings.ReplaceAll(flag, "-", "_"))
+}
+
+type settingValue struct {
+	value  string
+	source string
+}
+
+// loadSettingsFile reads the settings file and flattens the selected profile
+// over the defaults. The profile may also be a built-in one (auditor.go). A
+// missing file is only an error if it was named explicitly.
+func loadSettingsFile(flags *pflag.FlagSet, path string, explicit bool) (map[string]settingValue, error) {
+	profile := profileName
+	if profile == "" {
+		profile = os.Getenv(settingsEnvPrefix + "PROFILE")
+	}
+	values, profile, err := readSettings(flags, path, explicit, profile)
+	activeProfile = profile
+	return values, err
+}
+
+// readSettings flattens a profile over the defaults of the settings file
+// and returns the profile it used: the given one, or the file's "profile"
+func readSettings(flags *pflag.FlagSet, path string, explicit bool, profile string) (map[string]settingValue, string, error) {
+	values := map[string]settingValue{}
+
+	var file SettingsFile
+	loaded := false
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil && !(os.IsNotExist(err) && !explicit) {
+			return nil, profile, fmt.Errorf("failed to read settings file %s: %v", path, err)
+		}
+		if err == nil {
+			loaded = true
+			if err := json.Unmarshal(data, &file); err != nil {
+				return nil, profile, fmt.Errorf("failed to parse settings file %s: %v", path, err)
+			}
+			if err := addSettings(flags, values, file.Defaults, fmt.Sprintf("file %s", path)); err != nil {
+				return nil, profile, err
+			}
+		}
+	}
+	if profile == "" {
+		profile = file.Profile
+	}
+	if profile == "" {
+		return values, profile, nil
+	}
+
+	// A profile in the settings file replaces a built-in one of the same name
+	if settings, ok := file.Profiles[profile]; ok {
+		return values, profile, addSettings(flags, values, settings, fmt.Sprintf("file %s (profile %s)", path, profile))
+	}
+	if settings, ok := builtinProfiles[profile]; ok {
+		return values, profile, addSettings(flags, values, settings, fmt.Sprintf("built-in profile %s", profile))
+	}
+	if !loaded {
+		return nil, profile, fmt.Errorf("profile %q is not built in and no settings file was found", profile)
+	}
+	return nil, profile, fmt.Errorf("profile %q not found in settings file %s", profile, path)
+}
+
+func addSettings(flags *pflag.FlagSet, values map[string]settingValue, settings map[string]interface{}, source string) error {
+	for name, raw := range settings {
+		flag := flags.Lookup(name)
+		if flag == nil {
+			return fmt.Errorf("unknown setting %q in %s", name, source)
+		}
+		if unsettableFlags[name] {
+			return fmt.Errorf("--%s cannot be set in %s", name, source)
+		}
+
+		var value string
+		switch v := raw.(type) {
+		case string:
+			value = v
+		case bool, float64:
+			value = fmt.Sprint(v)
+		case []interface{}:
+			items := make([]string, len(v))
+			for i, item := range v {
+				items[i] = fmt.Sprint(item)
+			}
+			value = strings.Join(items, ",")
+		default:
+			return fmt.Errorf("unsupported value for %q in %s", name, source)
+		}
+		values[name] = settingValue{value: value, source: source}
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"time"
+
+	"github.com/chaichis-network/v3/pkg/table"
+	"github.com/spf13/cobra"
+)
+
+var (
+	settlementPeriod   string
+	settlementConsumer string
+	settlementPageSize int32
+)
+
+func init() {
+	for _, cmd := range []*cobra.Command{listSettlementsCmd, settlementSummaryCmd} {
+		cmd.Flags().StringVar(&settlementPeriod, "period", "", "Month to report, as YYYY-MM (default: the current UTC month)")
+		cmd.Flags().StringVar(&settlementConsumer, "consumer", "", "Only sessions opened by this organization's MSP")
+		addListFlags(cmd)
+	}
+	listSettlementsCmd.Flags().Int32Var(&settlementPageSize, "page-size", 0, "Entries fetched per query (default: chaincode default)")
+
+	settlementsCmd.AddCommand(listSettlementsCmd)
+	settlementsCmd.AddCommand(settlementSummaryCmd)
+
+	rootCmd.AddCommand(settlementsCmd)
+}
+
+var settlementsCmd = &cobra.Command{
+	Use:   "settlements",
+	Short: "Report cross-organization device usage for reconciliation",
+	Long: `When a session in which one organization's client used a device owned by
+another organization closes, the ISV chaincode records a settlement entry:
+both organizations, the session, its duration and its capability class.
+Entries are grouped by the month the session ended in.`,
+}
+
+var listSettlementsCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List a period's settlement entries",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		deviceManager, err := newDeviceManager()
+		if err != nil {
+			return err
+		}
+
+		entries, err := deviceManager.ListSettlements(settlementPeriodOrCurrent(), settlementConsumer, settlementPageSize)
+		if err != nil {
+			return err
+		}
+		t := table.New("consumer", "provider", "session", "client", "device", "class", "started", "ended", "seconds")
+		for _, entry := range entries {
+			t.Append(entry.ConsumerMSP, entry.ProviderMSP, entry.SessionID, entry.ClientID, entry.DeviceID,
+				entry.CapabilityClass, timeCell(entry.StartedAt), timeCell(entry.EndedAt), entry.DurationSeconds)
+		}
+		return printList(t, entries)
+	},
+}
+
+var settlementSummaryCmd = &cobra.Command{
+	Use:   "summary",
+	Short: "Total a period's sessions and usage per organization pair and capability class",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		deviceManager, err := newDeviceManager()
+		if err != nil {
+			return err
+		}
+
+		summary, err := deviceManager.SettlementSummary(settlementPeriodOrCurrent(), settlementConsumer)
+		if err != nil {
+			return err
+		}
+		t := table.New("period", "consumer", "provider", "class", "sessions", "seconds")
+		for _, total := range summary.Totals {
+			t.Append(summary.Period, total.ConsumerMSP, total.ProviderMSP, total.CapabilityClass, total.Sessions, total.DurationSeconds)
+		}
+		return printList(t, summary)
+	},
+}
+
+// settlementPeriodOrCurrent returns --period, defaulting to the current UTC month
+func settlementPeriodOrCurrent() string {
+	if settlementPeriod != "" {
+		return settlementPeriod
+	}
+	return time.Now().UTC().Format("2006-01")
+}
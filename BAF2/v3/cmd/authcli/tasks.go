@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/chaichis-network/v3/internal/auth"
+	"github.com/chaichis-network/v3/pkg/table"
+	"github.com/spf13/cobra"
+)
+
+var (
+	taskPeerID string
+	taskType   string
+	taskID     string
+	taskEvery  time.Duration
+)
+
+func init() {
+	allocateTaskCmd.Flags().StringVar(&taskPeerID, "peer-id", "", "Peer whose worker runs the task")
+	allocateTaskCmd.Flags().StringVar(&taskType, "type", auth.TaskTypeVerification, "Task type")
+	allocateTaskCmd.Flags().StringVar(&clientID, "client-id", "", "Client the task is about")
+	allocateTaskCmd.MarkFlagRequired("peer-id")
+	allocateTaskCmd.MarkFlagRequired("client-id")
+
+	pendingTasksCmd.Flags().StringVar(&taskPeerID, "peer-id", "", "Peer ID")
+	pendingTasksCmd.MarkFlagRequired("peer-id")
+	addListFlags(pendingTasksCmd)
+
+	showTaskCmd.Flags().StringVar(&taskID, "task-id", "", "Task ID (TASK_...)")
+	showTaskCmd.MarkFlagRequired("task-id")
+
+	workTasksCmd.Flags().StringVar(&taskPeerID, "peer-id", "", "Peer this worker runs tasks for")
+	workTasksCmd.Flags().DurationVar(&taskEvery, "every", 0, "Keep polling at this interval until interrupted (default: one pass)")
+	workTasksCmd.MarkFlagRequired("peer-id")
+
+	tasksCmd.AddCommand(allocateTaskCmd)
+	tasksCmd.AddCommand(pendingTasksCmd)
+	tasksCmd.AddCommand(showTaskCmd)
+	tasksCmd.AddCommand(workTasksCmd)
+
+	rootCmd.AddCommand(tasksCmd)
+}
+
+var tasksCmd = &cobra.Command{
+	Use:   "tasks",
+	Short: "Allocate peer tasks and run a peer's task worker",
+}
+
+var allocateTaskCmd = &cobra.Command{
+	Use:   "allocate",
+	Short: "Assign a task for a client to a peer",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		clientManager, err := newClientManager()
+		if err != nil {
+			return err
+		}
+		defer clientManager.Close()
+
+		if err := clientManager.AllocateTask(taskPeerID, taskType, clientID); err != nil {
+			return err
+		}
+		fmt.Printf("Allocated %s task for %s to %s\n", taskType, clientID, taskPeerID)
+		return nil
+	},
+}
+
+var pendingTasksCmd = &cobra.Command{
+	Use:   "pending",
+	Short: "List the tasks a peer's worker may claim",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		clientManager, err := newClientManager()
+		if err != nil {
+			return err
+		}
+		defer clientManager.Close()
+
+		tasks, err := clientManager.PendingTasks(taskPeerID)
+		if err != nil {
+			return err
+		}
+		t := table.New("task", "type", "client", "status", "attempts", "last-error")
+		for _, task := range tasks {
+			t.Append(task.TaskID, task.TaskType, task.ClientID, task.Status, task.Attempts, task.Error)
+		}
+		return printList(t, tasks)
+	},
+}
+
+var showTaskCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show a task record",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		clientManager, err := newClientManager()
+		if err != nil {
+			return err
+		}
+		defer clientManager.Close()
+
+		task, err := clientManager.GetTask(taskID)
+		if err != nil {
+			return err
+		}
+		return printJSON(task)
+	},
+}
+
+var workTasksCmd = &cobra.Command{
+	Use:   "work",
+	Short: "Claim, run and complete a peer's pending tasks",
+	Long: `Runs the task worker for a peer: claims each pending task of a type it
+knows, runs it and records the outcome on the AS. A failed task is assigned
+again until it has been tried three times. A claim not finished within five
+minutes, e.g. because the worker crashed, can be claimed again.
+
+Known task types:
+  verification  check the client is validly registered on the AS and the TGS
+
+Run with --every next to the peer:
+
+  authcli tasks work --peer-id peer0.org1.example.com --every 30s`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		clientManager, err := newClientManager()
+		if err != nil {
+			return err
+		}
+		defer clientManager.Close()
+
+		return runEvery(taskEvery, func() error {
+			outcomes, err := clientManager.WorkTasks(taskPeerID)
+			if err != nil {
+				return err
+			}
+			for _, outcome := range outcomes {
+				if outcome.Err != nil {
+					fmt.Printf("%s %s: %v\n", outcome.Task.TaskID, outcome.Task.Status, outcome.Err)
+					continue
+				}
+				fmt.Printf("%s %s\n", outcome.Task.TaskID, outcome.Task.Status)
+			}
+			log.Debugf("Worker pass for %s ran %d tasks", taskPeerID, len(outcomes))
+			return nil
+		})
+	},
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/chaichis-network/v3/internal/fabric"
+	"github.com/spf13/cobra"
+)
+
+var (
+	acceptTerms     bool
+	termsPolicyFile string
+)
+
+func init() {
+	setTermsPolicyCmd.Flags().StringVar(&termsPolicyFile, "file", "", "JSON terms policy file")
+	setTermsPolicyCmd.MarkFlagRequired("file")
+
+	acceptTermsCmd.Flags().StringVar(&clientID, "client-id", "", "Client accepting the terms")
+	acceptTermsCmd.MarkFlagRequired("client-id")
+
+	termsAcknowledgementCmd.Flags().StringVar(&clientID, "client-id", "", "Client ID")
+	termsAcknowledgementCmd.MarkFlagRequired("client-id")
+
+	termsCmd.AddCommand(setTermsPolicyCmd)
+	termsCmd.AddCommand(getTermsPolicyCmd)
+	termsCmd.AddCommand(acceptTermsCmd)
+	termsCmd.AddCommand(termsAcknowledgementCmd)
+
+	rootCmd.AddCommand(termsCmd)
+}
+
+var termsCmd = &cobra.Command{
+	Use:   "terms",
+	Short: "Manage the notice clients acknowledge before authenticating",
+}
+
+var setTermsPolicyCmd = &cobra.Command{
+	Use:   "set-policy",
+	Short: "Store the AS terms policy",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		policyJSON, err := ioutil.ReadFile(termsPolicyFile)
+		if err != nil {
+			return fmt.Errorf("failed to read terms policy file: %v", err)
+		}
+
+		clientManager, err := newClientManager()
+		if err != nil {
+			return err
+		}
+		defer clientManager.Close()
+
+		if err := clientManager.SetTermsPolicy(policyJSON); err != nil {
+			return fmt.Errorf("failed to set terms policy: %v", err)
+		}
+		return nil
+	},
+}
+
+var getTermsPolicyCmd = &cobra.Command{
+	Use:   "get-policy",
+	Short: "Show the AS terms policy",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		clientManager, err := newClientManager()
+		if err != nil {
+			return err
+		}
+		defer clientManager.Close()
+
+		policy, err := clientManager.GetTermsPolicy()
+		if err != nil {
+			return fmt.Errorf("failed to get terms policy: %v", err)
+		}
+		if policy == nil {
+			fmt.Println("No terms policy is set; clients authenticate without a notice")
+			return nil
+		}
+		return printJSON(policy)
+	},
+}
+
+var acceptTermsCmd = &cobra.Command{
+	Use:   "accept",
+	Short: "Sign and record a client's acceptance of the current terms",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		clientManager, err := newClientManager()
+		if err != nil {
+			return err
+		}
+		defer clientManager.Close()
+
+		policy, err := clientManager.GetTermsPolicy()
+		if err != nil {
+			return fmt.Errorf("failed to get terms policy: %v", err)
+		}
+		if policy == nil {
+			return fmt.Errorf("no terms policy is set")
+		}
+
+		ack, err := clientManager.AcknowledgeTerms(clientID, fabric.TermsNotice{
+			Version:      policy.Version,
+			DocumentHash: policy.DocumentHash,
+			DocumentURL:  policy.DocumentURL,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to accept terms: %v", err)
+		}
+		return printJSON(ack)
+	},
+}
+
+var termsAcknowledgementCmd = &cobra.Command{
+	Use:   "acknowledgement",
+	Short: "Show the terms a client last acknowledged",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		clientManager, err := newClientManager()
+		if err != nil {
+			return err
+		}
+		defer clientManager.Close()
+
+		ack, err := clientManager.TermsAcknowledgement(clientID)
+		if err != nil {
+			return fmt.Errorf("failed to get terms acknowledgement: %v", err)
+		}
+		if ack == nil {
+			fmt.Printf("Client %s has not acknowledged any terms\n", clientID)
+			return nil
+		}
+		return printJSON(ack)
+	},
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/chaichis-network/v3/internal/fabric"
+	"github.com/spf13/cobra"
+)
+
+var (
+	ticketPolicyFile      string
+	ticketPolicyEffective string
+	ticketPolicyIn        time.Duration
+)
+
+func init() {
+	scheduleTicketPolicyCmd.Flags().StringVar(&ticketPolicyFile, "file", "", "JSON ticket policy file")
+	scheduleTicketPolicyCmd.MarkFlagRequired("file")
+	for _, cmd := range []*cobra.Command{scheduleTicketPolicyCmd, rollbackTicketPolicyCmd} {
+		cmd.Flags().StringVar(&ticketPolicyEffective, "effective-at", "", "When the policy takes effect, RFC 3339")
+		cmd.Flags().DurationVar(&ticketPolicyIn, "in", 24*time.Hour, "How long from now the policy takes effect, unless --effective-at is given")
+	}
+
+	ticketPolicyCmd.AddCommand(showTicketPolicyCmd)
+	ticketPolicyCmd.AddCommand(scheduleTicketPolicyCmd)
+	ticketPolicyCmd.AddCommand(rollbackTicketPolicyCmd)
+	ticketPolicyCmd.AddCommand(abortPendingTicketPolicyCmd)
+
+	rootCmd.AddCommand(ticketPolicyCmd)
+}
+
+var ticketPolicyCmd = &cobra.Command{
+	Use:   "ticket-policy",
+	Short: "Show or schedule the TGT lifetimes, quota and encryptions of the AS",
+	Long: `The ticket policy sets the TGT lifetime and renewal limit, how many TGTs a
+client may be issued a day and which session key encryptions the AS offers.
+A change is scheduled with an effective date at least 5 minutes away and is
+pending until then; 'abort-pending' withdraws it. The policy it replaces is
+kept as previous, and 'rollback' schedules that one again. Clients warn when
+they authenticate within 7 days of a pending change.
+
+Policy file, with zero fields taking the defaults:
+  {"tgtLifetime": 3600, "maxTGTRenewal": 86400, "maxTGTsPerDay": 50,
+   "encryptions": ["rsa-oaep-aes256gcm", "ecies-p256-aes256gcm"]}`,
+}
+
+var showTicketPolicyCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show the pending, active and previous ticket policies",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		clientManager, err := newClientManager()
+		if err != nil {
+			return err
+		}
+		defer clientManager.Close()
+
+		schedule, err := clientManager.TicketPolicySchedule()
+		if err != nil {
+			return fmt.Errorf("failed to get ticket policy schedule: %v", err)
+		}
+		return printTicketPolicySchedule(schedule)
+	},
+}
+
+var scheduleTicketPolicyCmd = &cobra.Command{
+	Use:   "schedule",
+	Short: "Schedule a ticket policy to take effect later",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		policyJSON, err := ioutil.ReadFile(ticketPolicyFile)
+		if err != nil {
+			return fmt.Errorf("failed to read ticket policy file: %v", err)
+		}
+		effectiveAt, err := ticketPolicyEffectiveAt()
+		if err != nil {
+			return err
+		}
+
+		clientManager, err := newClientManager()
+		if err != nil {
+			return err
+		}
+		defer clientManager.Close()
+
+		schedule, err := clientManager.ScheduleTicketPolicy(policyJSON, effectiveAt)
+		if err != nil {
+			return fmt.Errorf("failed to schedule ticket policy: %v", err)
+		}
+		return printTicketPolicySchedule(schedule)
+	},
+}
+
+var rollbackTicketPolicyCmd = &cobra.Command{
+	Use:   "rollback",
+	Short: "Schedule the previous ticket policy to take effect again",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		effectiveAt, err := ticketPolicyEffectiveAt()
+		if err != nil {
+			return err
+		}
+
+		clientManager, err := newClientManager()
+		if err != nil {
+			return err
+		}
+		defer clientManager.Close()
+
+		schedule, err := clientManager.RollbackTicketPolicy(effectiveAt)
+		if err != nil {
+			return fmt.Errorf("failed to roll back ticket policy: %v", err)
+		}
+		return printTicketPolicySchedule(schedule)
+	},
+}
+
+var abortPendingTicketPolicyCmd = &cobra.Command{
+	Use:   "abort-pending",
+	Short: "Withdraw the pending ticket policy before it takes effect",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		clientManager, err := newClientManager()
+		if err != nil {
+			return err
+		}
+		defer clientManager.Close()
+
+		schedule, err := clientManager.AbortPendingTicketPolicy()
+		if err != nil {
+			return fmt.Errorf("failed to abort pending ticket policy: %v", err)
+		}
+		return printTicketPolicySchedule(schedule)
+	},
+}
+
+// ticketPolicyEffectiveAt returns --effective-at, or --in from now
+func ticketPolicyEffectiveAt() (time.Time, error) {
+	if ticketPolicyEffective == "" {
+		if ticketPolicyIn <= 0 {
+			return time.Time{}, fmt.Errorf("--in must be positive")
+		}
+		return time.Now().Add(ticketPolicyIn), nil
+	}
+	effectiveAt, err := time.Parse(time.RFC3339, ticketPolicyEffective)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid --effective-at: %v", err)
+	}
+	return effectiveAt, nil
+}
+
+// printTicketPolicySchedule prints the schedule and how long until the
+// pending policy takes effect
+func printTicketPolicySchedule(schedule *fabric.TicketPolicySchedule) error {
+	if schedule.Active == nil {
+		fmt.Println("Active: AS defaults")
+	}
+	if schedule.Pending != nil {
+		fmt.Printf("Pending: version %d takes effect in %s\n", schedule.Pending.Version, time.Until(schedule.Pending.EffectiveAt).Round(time.Second))
+	}
+	return printJSON(schedule)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	chaincodeManifest   string
+	verifyChaincodeJSON bool
+)
+
+func init() {
+	verifyChaincodeCmd.Flags().StringVar(&chaincodeManifest, "manifest", "dist/manifest.json", "Manifest written by ccpackage")
+	verifyChaincodeCmd.Flags().BoolVar(&verifyChaincodeJSON, "json", false, "Print the report as JSON")
+
+	rootCmd.AddCommand(verifyChaincodeCmd)
+}
+
+var verifyChaincodeCmd = &cobra.Command{
+	Use:   "verify-chaincode",
+	Short: "Check the deployed chaincodes run the audited packages",
+	Long: `Compares every chaincode in a ccpackage manifest with its committed
+definition on the channel. The package ID this organization approved for
+the committed sequence, which embeds the package hash, must match the one
+the reproducible build produced. The package files next to the manifest are
+re-hashed as well. The command exits with an error on any difference, so it
+can gate deployments.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		clientManager, err := newClientManager()
+		if err != nil {
+			return err
+		}
+		defer clientManager.Close()
+
+		result, err := clientManager.VerifyChaincodes(chaincodeManifest)
+		if err != nil {
+			return err
+		}
+
+		if verifyChaincodeJSON {
+			if err := printJSON(result); err != nil {
+				return err
+			}
+		} else {
+			for _, check := range result.Checks {
+				fmt.Printf("%-14s %-20s expected %s\n", check.Status, check.Name, check.ExpectedPackageID)
+				if check.DeployedPackageID != "" {
+					fmt.Printf("%-14s %-20s approved %s (sequence %d, version %s)\n", "", "", check.DeployedPackageID, check.Sequence, check.Version)
+				}
+				if check.Detail != "" {
+					fmt.Printf("%-14s %-20s %s\n", "", "", check.Detail)
+				}
+			}
+		}
+
+		if result.Mismatched > 0 {
+			return fmt.Errorf("%d of %d chaincodes do not match the audited packages", result.Mismatched, len(result.Checks))
+		}
+		return nil
+	},
+}
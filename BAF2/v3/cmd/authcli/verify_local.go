@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	verifyRepair bool
+	verifyJSON   bool
+)
+
+func init() {
+	verifyLocalCmd.Flags().BoolVar(&verifyRepair, "repair", false, "Remove cached files that diverge from the ledger")
+	verifyLocalCmd.Flags().BoolVar(&verifyJSON, "json", false, "Print the report as JSON")
+
+	rootCmd.AddCommand(verifyLocalCmd)
+}
+
+var verifyLocalCmd = &cobra.Command{
+	Use:   "verify-local",
+	Short: "Check cached tickets and sessions against the ledger",
+	Long: `Re-fetches the ledger counterpart of every cached TGT, service ticket and
+session and reports the ones that diverge: tickets the TGS revoked or has no
+record of, expired tickets and sessions, and sessions closed on the ISV.
+With --repair the divergent files, and sessions in the bolt or memory session
+store, are removed. Without it, the command exits
+with an error when any are found, so it can gate scripts.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		clientManager, err := newClientManager()
+		if err != nil {
+			return err
+		}
+		defer clientManager.Close()
+
+		sessions, err := openSessionStore()
+		if err != nil {
+			return err
+		}
+		result, err := clientManager.VerifyLocal(sessions, verifyRepair)
+		if err != nil {
+			return err
+		}
+
+		if verifyJSON {
+			if err := printJSON(result); err != nil {
+				return err
+			}
+		} else {
+			for _, check := range result.Checks {
+				line := fmt.Sprintf("%-14s %-15s %s", check.Status, check.Kind, check.Path)
+				if check.Detail != "" {
+					line += ": " + check.Detail
+				}
+				if check.Repaired {
+					line += " (removed)"
+				}
+				fmt.Println(line)
+			}
+			fmt.Printf("%d files checked, %d divergent, %d removed, %d could not be checked\n",
+				len(result.Checks), result.Divergent, result.Repaired, result.Failed)
+		}
+
+		if result.Divergent > result.Repaired {
+			return fmt.Errorf("%d cached files diverge from the ledger; re-run with --repair to remove them", result.Divergent-result.Repaired)
+		}
+		return nil
+	},
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/chaichis-network/v3/internal/fabric"
+	"github.com/spf13/cobra"
+)
+
+var (
+	watchChaincodes []string
+	watchEventNames []string
+	watchJSON       bool
+)
+
+// watchChaincodeIDs maps the short chaincode names to contract IDs; other
+// names (user-acl, iot-data) are used as given
+var watchChaincodeIDs = map[string]string{
+	"as":  fabric.ASContractID,
+	"tgs": fabric.TGSContractID,
+	"isv": fabric.ISVContractID,
+}
+
+func init() {
+	watchEventsCmd.Flags().StringSliceVar(&watchChaincodes, "chaincode", []string{"as", "tgs", "isv"}, "Chaincodes to watch: as, tgs, isv, or a chaincode name such as user-acl (comma-separated)")
+	watchEventsCmd.Flags().StringSliceVar(&watchEventNames, "event", nil, "Only print these events, e.g. UserRegistered,AccessGranted (comma-separated, default: all)")
+	watchEventsCmd.Flags().BoolVar(&watchJSON, "json", false, "Print one JSON object per event")
+
+	rootCmd.AddCommand(watchEventsCmd)
+}
+
+var watchEventsCmd = &cobra.Command{
+	Use:   "watch-events",
+	Short: "Stream chaincode events live as they are committed",
+	Long: `Prints the events of the given chaincodes as blocks are committed, until
+interrupted. Events are not replayed: only those committed after the command
+starts are printed. The end of an ISV v4 session, logged as an AccessLogged
+entry, is printed as SessionTerminated.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Create Fabric client
+		fabricClient, err := fabric.NewClient(fabric.ClientOptions{
+			ConfigPath:      configPath,
+			WalletPath:      walletPath,
+			Wallet:          walletOptions(),
+			Debug:           debugMode,
+			Peers:           peerRoles(),
+			AgeIdentityFile: ageIdentity,
+			API:             fabricAPI,
+			GatewayPeer:     gatewayPeer,
+			Strict:          strictMode,
+			FlowID:          flowID,
+			Pool:            connectionPool,
+			TransactionLog:  transactionLog,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create Fabric client: %v", err)
+		}
+
+		// Ensure identity exists in wallet
+		if err := fabricClient.EnsureIdentity(identityName); err != nil {
+			return fmt.Errorf("failed to ensure identity: %v", err)
+		}
+
+		if err := fabricClient.Connect(identityName); err != nil {
+			return fmt.Errorf("failed to connect to Fabric network: %v", err)
+		}
+		defer fabricClient.Close()
+
+		bus := fabric.NewEventBus(fabricClient)
+		defer bus.Close()
+
+		// Print the short names the user passed rather than contract IDs
+		names := make(map[string]string)
+		for _, chaincode := range watchChaincodes {
+			contractID := chaincode
+			if id, ok := watchChaincodeIDs[chaincode]; ok {
+				contractID = id
+			}
+			names[contractID] = chaincode
+			if err := bus.Watch(contractID); err != nil {
+				return err
+			}
+		}
+
+		events, cancel := bus.Channel(fabric.EventFilter{Names: watchEventNames})
+		defer cancel()
+
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		defer signal.Stop(signals)
+
+		encoder := json.NewEncoder(os.Stdout)
+		for {
+			select {
+			case <-signals:
+				return nil
+			case event, ok := <-events:
+				if !ok {
+					return nil
+				}
+				event.Chaincode = names[event.Chaincode]
+				if watchJSON {
+					if err := encoder.Encode(event); err != nil {
+						return err
+					}
+					continue
+				}
+				line := fmt.Sprintf("block %-8d %-10s %-24s tx=%s", event.BlockNumber, event.Chaincode, event.Name, event.TxID)
+				if event.FlowID != "" {
+					line += " flow=" + event.FlowID
+				}
+				if len(event.Payload) > 0 {
+					line += " " + string(event.Payload)
+				}
+				if _, err := fmt.Println(line); err != nil {
+					return err
+				}
+			}
+		}
+	},
+}
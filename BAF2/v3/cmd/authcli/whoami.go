@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/chaichis-network/v3/internal/crypto"
+	"github.com/chaichis-network/v3/internal/fabric"
+	"github.com/spf13/cobra"
+)
+
+var (
+	whoamiUsage bool
+	whoamiJSON  bool
+)
+
+func init() {
+	whoamiCmd.Flags().StringVar(&clientID, "client-id", "", "Client ID to describe")
+	whoamiCmd.Flags().BoolVar(&whoamiUsage, "usage", false, "Show ticket and session usage and remaining quota")
+	whoamiCmd.Flags().BoolVar(&whoamiJSON, "json", false, "Print the usage summary as JSON")
+
+	rootCmd.AddCommand(whoamiCmd)
+}
+
+var whoamiCmd = &cobra.Command{
+	Use:   "whoami",
+	Short: "Show the identity in use and, with --usage, why a client is throttled",
+	Long: `Prints the Fabric identity and client in use. With --usage it also fetches,
+in one query, the tickets the client was issued today, its active sessions,
+its recent failed attempts and how many more failures the risk policy allows
+before it asks for a step-up or denies the client.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if whoamiUsage && clientID == "" {
+			return fmt.Errorf("--usage needs --client-id")
+		}
+
+		if !whoamiJSON {
+			fmt.Printf("Identity: %s (wallet %s)\n", identityName, walletPath)
+			if clientID != "" {
+				keys := "present"
+				if _, err := crypto.LoadPrivateKey(clientID); err != nil {
+					keys = "missing"
+				}
+				fmt.Printf("Client:   %s (local key %s)\n", clientID, keys)
+			}
+		}
+		if !whoamiUsage {
+			return nil
+		}
+
+		clientManager, err := newClientManager()
+		if err != nil {
+			return err
+		}
+		defer clientManager.Close()
+
+		summary, err := clientManager.UsageSummary(clientID)
+		if err != nil {
+			return fmt.Errorf("failed to get usage summary: %v", err)
+		}
+		if whoamiJSON {
+			return printJSON(summary)
+		}
+		printUsageSummary(summary)
+		return nil
+	},
+}
+
+func printUsageSummary(summary *fabric.ClientUsageSummary) {
+	valid := "valid"
+	if !summary.Valid {
+		valid = "invalid"
+	}
+	fmt.Printf("Registration:    %s\n", valid)
+	if len(summary.Unavailable) > 0 {
+		fmt.Printf("Unavailable:     %s\n", strings.Join(summary.Unavailable, ", "))
+	}
+	fmt.Printf("Tickets today:   %d (%d revoked)\n", summary.TicketsToday, summary.RevokedToday)
+	fmt.Printf("Active sessions: %d\n", summary.ActiveSessions)
+	fmt.Printf("Recent failures: %d", len(summary.RecentFailures))
+	if summary.FailureWindow > 0 {
+		fmt.Printf(" in the last %s", time.Duration(summary.FailureWindow)*time.Second)
+	}
+	fmt.Println()
+
+	for _, quota := range summary.Quotas {
+		fmt.Printf("  %-24s %d of %d left\n", quota.Name, quota.Remaining, quota.Limit)
+	}
+	if summary.StepUpPending {
+		fmt.Println("Step-up pending: authenticate with --otp, approve it in the app ('challenge-channel status'), or ask an admin to run 'risk approve'")
+	}
+	if decision := summary.LastDecision; decision != nil && decision.Action != "allow" {
+		fmt.Printf("Last decision:   %s (%s)\n", decision.Action, strings.Join(decision.Reasons, "; "))
+	}
+}
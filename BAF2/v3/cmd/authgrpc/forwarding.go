@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/chaichis-network/v3/internal/auth"
+	"github.com/chaichis-network/v3/internal/fabric"
+)
+
+// forwardEvents posts the events of the --forward-chaincodes to the
+// --forward-events webhook, on a Fabric client of its own, until stop is
+// closed. Events the webhook refuses go to the dead-letter queue.
+func forwardEvents(stop <-chan struct{}) error {
+	sink, err := url.Parse(forwardURL)
+	if err != nil || (sink.Scheme != "http" && sink.Scheme != "https") || sink.Host == "" {
+		return fmt.Errorf("--forward-events must be an http or https URL")
+	}
+	deadLetters, err := auth.OpenDeadLetterQueue(deadLetterDir, auth.DeadLetterOptions{MaxAttempts: deadLetterAttempts})
+	if err != nil {
+		return err
+	}
+
+	eventFabric, err := newFabricClient()
+	if err != nil {
+		return err
+	}
+	if err := eventFabric.Connect(identityName); err != nil {
+		eventFabric.Close()
+		return fmt.Errorf("failed to connect to Fabric network: %v", err)
+	}
+	bus := fabric.NewEventBus(eventFabric)
+	for _, chaincode := range forwardChaincodes {
+		if err := bus.Watch(chaincode); err != nil {
+			bus.Close()
+			eventFabric.Close()
+			return err
+		}
+	}
+	events, cancel := bus.Channel(fabric.EventFilter{})
+
+	forwarder := auth.NewEventForwarder(forwardURL, deadLetters)
+	go func() {
+		defer eventFabric.Close()
+		defer bus.Close()
+		defer cancel()
+		log.Infof("Forwarding events to %s", sink.Redacted())
+		forwarder.Run(events, stop)
+	}()
+	return nil
+}
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/chaichis-network/v3/internal/auth"
+	"github.com/chaichis-network/v3/internal/crypto"
+	"github.com/chaichis-network/v3/internal/fabric"
+	"github.com/chaichis-network/v3/pkg/authpb"
+	"github.com/chaichis-network/v3/pkg/keystore"
+	"github.com/chaichis-network/v3/pkg/logger"
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+var (
+	logLevel       string
+	listenAddress  string
+	uiAddress      string
+	configPath     string
+	walletPath     string
+	walletBackend  string
+	pkcs11Library  string
+	pkcs11Token    string
+	identityName   string
+	sessionDir     string
+	sessionStore   string
+	tlsCertFile    string
+	tlsKeyFile     string
+	endorsingPeers []string
+	queryPeers     []string
+	ageIdentity    string
+	strictMode     bool
+	deliverPush    bool
+	fabricAPI      string
+	gatewayPeer    string
+	keyCacheTTL    time.Duration
+
+	replicationAddress   string
+	replicationTokenFile string
+	standbyOf            string
+	replicationCA        string
+	failoverAfter        time.Duration
+
+	forwardURL         string
+	forwardChaincodes  []string
+	deadLetterDir      string
+	deadLetterAttempts int
+
+	log *logger.Logger
+)
+
+func init() {
+	log = logger.New("info")
+
+	rootCmd.Flags().StringVar(&logLevel, "log-level", "info", "Log level (debug, info, warn, error)")
+	rootCmd.Flags().StringVar(&listenAddress, "listen", ":50051", "Address to serve gRPC on")
+	rootCmd.Flags().StringVar(&uiAddress, "ui-listen", "", "Address to serve the web dashboard on, e.g. 127.0.0.1:8080 (default: no dashboard)")
+	rootCmd.Flags().StringVar(&configPath, "config", "config/connection-profile.json", "Path to connection profile")
+	rootCmd.Flags().StringVar(&walletPath, "wallet", "wallet", "Path to wallet directory")
+	rootCmd.Flags().StringVar(&walletBackend, "wallet-backend", fabric.WalletBackendFile, "Wallet backend (file, encrypted, pkcs11, memory); encrypted reads its passphrase from $AUTHCLI_WALLET_PASSPHRASE, pkcs11 needs a build with cgo")
+	rootCmd.Flags().StringVar(&pkcs11Library, "pkcs11-library", "", "PKCS#11 module of the HSM holding the wallet keys (PIN from $AUTHCLI_PKCS11_PIN)")
+	rootCmd.Flags().StringVar(&pkcs11Token, "pkcs11-token", "", "Label of the PKCS#11 token holding the wallet keys")
+	rootCmd.Flags().StringVar(&identityName, "identity", "admin", "Identity name to use")
+	rootCmd.Flags().StringVar(&sessionDir, "session-dir", "sessions", "Path to session directory")
+	rootCmd.Flags().StringVar(&sessionStore, "session-store", auth.SessionBackendFile, "Session store backend (file, bolt, memory)")
+	rootCmd.Flags().StringVar(&tlsCertFile, "tls-cert", "", "TLS certificate file (default: plaintext)")
+	rootCmd.Flags().StringVar(&tlsKeyFile, "tls-key", "", "TLS private key file")
+	rootCmd.Flags().StringSliceVar(&endorsingPeers, "endorsing-peers", []string{}, "Peers used to endorse submitted transactions (comma-separated, default: gateway selection)")
+	rootCmd.Flags().StringSliceVar(&queryPeers, "query-peers", []string{}, "Read peers used for queries, tried in order with failover (comma-separated)")
+	rootCmd.Flags().StringVar(&ageIdentity, "age-identity", "", "age identity file for decrypting .age connection profiles (default: $AUTHCLI_AGE_IDENTITY)")
+	rootCmd.Flags().BoolVar(&deliverPush, "deliver-challenges", false, "Post push step-up challenges to the apps clients registered as challenge channels")
+	rootCmd.Flags().StringVar(&fabricAPI, "fabric-api", fabric.APISDK, "Fabric client API (sdk, or gateway for Fabric 2.4+ gateway peers)")
+	rootCmd.Flags().StringVar(&gatewayPeer, "gateway-peer", "", "Peer the gateway API sends requests to, by name in the connection profile (default: first peer of the identity's organization)")
+	rootCmd.Flags().DurationVar(&keyCacheTTL, "key-cache-ttl", keystore.DefaultCacheTTL, "How long a private key read from the keys directory is held in locked memory before it is read again (0: read it for every use)")
+	rootCmd.Flags().BoolVar(&strictMode, "strict", false, "Fail instead of silently falling back (query peer failover, default payload limits, protocol version 1, service requests without mutual authentication)")
+	rootCmd.Flags().StringVar(&replicationAddress, "replication-listen", "", "Address to stream tickets, sessions and keys to a warm standby on (default: no replication)")
+	rootCmd.Flags().StringVar(&replicationTokenFile, "replication-token-file", "", "File holding the secret the active server and its standby share")
+	rootCmd.Flags().StringVar(&standbyOf, "standby-of", "", "Run as warm standby of the active server whose replication stream is at this URL, e.g. https://gw1:9443")
+	rootCmd.Flags().StringVar(&replicationCA, "replication-ca", "", "CA certificate to verify the active server's replication stream with (default: system roots)")
+	rootCmd.Flags().DurationVar(&failoverAfter, "failover-after", 15*time.Second, "How long the active server may be silent before the standby takes over")
+	rootCmd.Flags().StringVar(&forwardURL, "forward-events", "", "Webhook to post chaincode events to, one JSON event per request, e.g. a SIEM's HTTP collector (default: no forwarding)")
+	rootCmd.Flags().StringSliceVar(&forwardChaincodes, "forward-chaincodes", []string{fabric.ASContractID, fabric.TGSContractID, fabric.ISVContractID}, "Chaincodes whose events are forwarded (comma-separated)")
+	rootCmd.Flags().StringVar(&deadLetterDir, "dead-letter-dir", auth.DefaultDeadLetterDir, "Directory keeping the events the webhook did not take")
+	rootCmd.Flags().IntVar(&deadLetterAttempts, "dead-letter-attempts", auth.DefaultDeadLetterAttempts, "Failed deliveries after which an event is quarantined until replayed with authcli dead-letters replay")
+}
+
+var rootCmd = &cobra.Command{
+	Use:   "authgrpc",
+	Short: "gRPC server for client and device operations",
+	Long: `Serves the AuthService defined in pkg/authpb/auth.proto, so that IoT
+gateways can register clients and devices, authenticate, open and close
+sessions and watch session status without shelling out to authcli. Keys,
+tickets and sessions are kept in the server's working directory, as authcli
+keeps them in its own.
+
+With --ui-listen, it also serves a read-only web dashboard of the network's
+devices, active sessions, recent anomalies and authentication failures. The
+dashboard has no login of its own and shows what the server's identity can
+query, so listen on a loopback or otherwise trusted address.
+
+With --deliver-challenges, it posts the challenge of each push step-up the AS
+opens to the app the client registered as its challenge channel.
+
+With --forward-events, it posts the events of the --forward-chaincodes to a
+webhook. Events the webhook does not take are kept in --dead-letter-dir and
+retried with a growing delay, and quarantined after --dead-letter-attempts
+failures; authcli dead-letters lists and replays them.
+
+For a highly available gateway, run a pair: the active server with
+--replication-listen and a standby with --standby-of pointing at it, both
+with the same --replication-token-file. The standby mirrors the active
+server's tickets, sessions, keys and dashboard, and serves nothing until the
+active server has been silent for --failover-after. It then binds its
+listeners and starts delivering challenges, and clients carry on with the
+tickets they already hold.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		log = logger.New(logLevel)
+
+		if (tlsCertFile == "") != (tlsKeyFile == "") {
+			return fmt.Errorf("--tls-cert and --tls-key must be given together")
+		}
+		if keyCacheTTL < 0 {
+			return fmt.Errorf("--key-cache-ttl must not be negative")
+		}
+		if keyCacheTTL > 0 {
+			crypto.EnableKeyCache(keyCacheTTL)
+			defer crypto.CloseKeyCache()
+		}
+
+		var replicationToken string
+		if replicationAddress != "" || standbyOf != "" {
+			if sessionStore != auth.SessionBackendFile {
+				return fmt.Errorf("replication needs --session-store %s", auth.SessionBackendFile)
+			}
+			if failoverAfter <= 0 {
+				return fmt.Errorf("--failover-after must be positive")
+			}
+			var err error
+			if replicationToken, err = readReplicationToken(replicationTokenFile); err != nil {
+				return err
+			}
+		}
+
+		// A standby serves nothing until the active server goes silent
+		var warmDashboard *auth.Dashboard
+		if standbyOf != "" {
+			standby, err := newStandby(standbyOf, replicationToken, replicationCA, failoverAfter)
+			if err != nil {
+				return err
+			}
+			log.Infof("Standing by for %s", standbyOf)
+			signals := make(chan os.Signal, 1)
+			signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+			takeOver := standby.run(signals)
+			signal.Stop(signals)
+			if !takeOver {
+				log.Infof("Shutting down")
+				return nil
+			}
+			warmDashboard = standby.warmDashboard()
+		}
+
+		server, err := newAuthServer()
+		if err != nil {
+			return err
+		}
+		defer server.Close()
+
+		var options []grpc.ServerOption
+		if tlsCertFile != "" {
+			creds, err := credentials.NewServerTLSFromFile(tlsCertFile, tlsKeyFile)
+			if err != nil {
+				return fmt.Errorf("failed to load TLS credentials: %v", err)
+			}
+			options = append(options, grpc.Creds(creds))
+		}
+
+		listener, err := net.Listen("tcp", listenAddress)
+		if err != nil {
+			return fmt.Errorf("failed to listen on %s: %v", listenAddress, err)
+		}
+
+		grpcServer := grpc.NewServer(options...)
+		authpb.RegisterAuthServiceServer(grpcServer, server)
+
+		var uiServer *http.Server
+		var dashboards *dashboardHandler
+		if uiAddress != "" {
+			uiListener, err := net.Listen("tcp", uiAddress)
+			if err != nil {
+				return fmt.Errorf("failed to listen on %s: %v", uiAddress, err)
+			}
+			if uiServer, dashboards, err = newUIServer(warmDashboard); err != nil {
+				uiListener.Close()
+				return err
+			}
+			go serveUI(uiServer, uiListener)
+		}
+
+		var replicationServer *http.Server
+		if replicationAddress != "" {
+			replicationListener, err := net.Listen("tcp", replicationAddress)
+			if err != nil {
+				return fmt.Errorf("failed to listen on %s: %v", replicationAddress, err)
+			}
+			replicationServer = newReplicationServer(replicationToken, dashboards, server.stop)
+			go serveReplication(replicationServer, replicationListener)
+		}
+
+		if deliverPush {
+			go server.deliverChallenges()
+		}
+		if forwardURL != "" {
+			if err := forwardEvents(server.stop); err != nil {
+				return err
+			}
+		}
+
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-signals
+			log.Infof("Shutting down")
+			// Ends open WatchSessions streams, which would otherwise hold
+			// GracefulStop until their callers cancel
+			server.Stop()
+			if uiServer != nil {
+				uiServer.Shutdown(context.Background())
+			}
+			if replicationServer != nil {
+				replicationServer.Shutdown(context.Background())
+			}
+			grpcServer.GracefulStop()
+		}()
+
+		log.Infof("Serving AuthService on %s", listener.Addr())
+		return grpcServer.Serve(listener)
+	},
+}
+
+// newFabricClient creates a Fabric client from the command-line flags
+func newFabricClient() (*fabric.Client, error) {
+	fabricClient, err := fabric.NewClient(fabric.ClientOptions{
+		ConfigPath: configPath,
+		WalletPath: walletPath,
+		Wallet: fabric.WalletOptions{
+			Backend:       walletBackend,
+			PKCS11Library: pkcs11Library,
+			PKCS11Token:   pkcs11Token,
+		},
+		Peers: fabric.PeerRoles{
+			Endorsers:  endorsingPeers,
+			QueryPeers: queryPeers,
+		},
+		AgeIdentityFile: ageIdentity,
+		API:             fabricAPI,
+		GatewayPeer:     gatewayPeer,
+		Strict:          strictMode,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Fabric client: %v", err)
+	}
+
+	if err := fabricClient.EnsureIdentity(identityName); err != nil {
+		return nil, fmt.Errorf("failed to ensure identity: %v", err)
+	}
+	return fabricClient, nil
+}
+
+// newUIServer connects the web dashboard to the network. It reads the
+// ledger through a Fabric client of its own, and serves warm, if not nil,
+// until it is older than dashboardTTL.
+func newUIServer(warm *auth.Dashboard) (*http.Server, *dashboardHandler, error) {
+	uiFabric, err := newFabricClient()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := uiFabric.Connect(identityName); err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to Fabric network: %v", err)
+	}
+
+	dashboards := &dashboardHandler{fabricClient: uiFabric, dashboard: warm}
+	handler, err := newUIHandler(dashboards)
+	if err != nil {
+		uiFabric.Close()
+		return nil, nil, err
+	}
+	server := &http.Server{Handler: handler}
+	server.RegisterOnShutdown(uiFabric.Close)
+	return server, dashboards, nil
+}
+
+// serveUI serves the web dashboard, over TLS when the gRPC server uses it
+func serveUI(server *http.Server, listener net.Listener) {
+	log.Infof("Serving web dashboard on %s", listener.Addr())
+	var err error
+	if tlsCertFile != "" {
+		err = server.ServeTLS(listener, tlsCertFile, tlsKeyFile)
+	} else {
+		err = server.Serve(listener)
+	}
+	if err != nil && err != http.ErrServerClosed {
+		log.Errorf("Web dashboard stopped: %v", err)
+	}
+}
+
+// newAuthServer connects the managers the server delegates to
+func newAuthServer() (*authServer, error) {
+	clientFabric, err := newFabricClient()
+	if err != nil {
+		return nil, err
+	}
+	clientManager, err := auth.NewClientManager(clientFabric, identityName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client manager: %v", err)
+	}
+
+	sessions, err := auth.OpenSessionStore(sessionStore, sessionDir)
+	if err != nil {
+		clientManager.Close()
+		return nil, err
+	}
+
+	deviceFabric, err := newFabricClient()
+	if err != nil {
+		clientManager.Close()
+		return nil, err
+	}
+	deviceManager, err := auth.NewDeviceManager(deviceFabric, identityName)
+	if err != nil {
+		clientManager.Close()
+		return nil, fmt.Errorf("failed to create device manager: %v", err)
+	}
+
+	return &authServer{
+		clientManager: clientManager,
+		deviceManager: deviceManager,
+		deviceFabric:  deviceFabric,
+		sessionStore:  sessions,
+		stop:          make(chan struct{}),
+	}, nil
+}
+
+func main() {
+	if err := rootCmd.Execute(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/chaichis-network/v3/internal/auth"
+	"github.com/chaichis-network/v3/internal/fabric"
+	"github.com/chaichis-network/v3/pkg/authpb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// authServer implements AuthService on the managers authcli uses
+type authServer struct {
+	authpb.UnimplementedAuthServiceServer
+
+	clientManager *auth.ClientManager
+	deviceManager *auth.DeviceManager
+	deviceFabric  *fabric.Client
+	sessionStore  auth.SessionStore
+
+	// authMu serializes Authenticate, which sets per-call options on the
+	// shared client manager
+	authMu sync.Mutex
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// Stop ends the open WatchSessions streams
+func (s *authServer) Stop() {
+	s.stopOnce.Do(func() { close(s.stop) })
+}
+
+// deliverChallenges posts push step-up challenges to the clients' apps
+// until the server stops
+func (s *authServer) deliverChallenges() {
+	log.Infof("Delivering push challenges")
+	if err := s.clientManager.DeliverPushChallenges(s.stop); err != nil {
+		log.Errorf("Push challenge delivery stopped: %v", err)
+	}
+}
+
+// Close stops the server's streams and closes its Fabric connections
+func (s *authServer) Close() {
+	s.Stop()
+	s.clientManager.Close()
+	s.deviceFabric.Close()
+}
+
+func (s *authServer) RegisterClient(ctx context.Context, req *authpb.RegisterClientRequest) (*authpb.RegisterClientResponse, error) {
+	if req.ClientId == "" {
+		return nil, status.Error(codes.InvalidArgument, "client_id is required")
+	}
+
+	if err := s.clientManager.RegisterClient(req.ClientId); err != nil {
+		return nil, statusError("failed to register client", err)
+	}
+
+	log.Infof("Client %s registered successfully", req.ClientId)
+	return &authpb.RegisterClientResponse{ClientId: req.ClientId}, nil
+}
+
+func (s *authServer) RegisterDevice(ctx context.Context, req *authpb.RegisterDeviceRequest) (*authpb.RegisterDeviceResponse, error) {
+	if req.DeviceId == "" {
+		return nil, status.Error(codes.InvalidArgument, "device_id is required")
+	}
+	if req.CapabilityProfile != "" && len(req.Capabilities) > 0 {
+		return nil, status.Error(codes.InvalidArgument, "capabilities and capability_profile cannot be used together")
+	}
+
+	var err error
+	if req.CapabilityProfile != "" {
+		err = s.deviceManager.RegisterDeviceWithProfile(req.DeviceId, req.CapabilityProfile)
+	} else {
+		err = s.deviceManager.RegisterDevice(req.DeviceId, req.Capabilities)
+	}
+	if err != nil {
+		return nil, statusError("failed to register device", err)
+	}
+
+	log.Infof("Device %s registered successfully", req.DeviceId)
+	return &authpb.RegisterDeviceResponse{DeviceId: req.DeviceId}, nil
+}
+
+func (s *authServer) Authenticate(ctx context.Context, req *authpb.AuthenticateRequest) (*authpb.AuthenticateResponse, error) {
+	if req.ClientId == "" || req.DeviceId == "" {
+		return nil, status.Error(codes.InvalidArgument, "client_id and device_id are required")
+	}
+
+	sourceIP := req.SourceIp
+	if sourceIP == "" {
+		sourceIP = peerIP(ctx)
+	}
+
+	s.authMu.Lock()
+	defer s.authMu.Unlock()
+
+	s.clientManager.SetSourceIP(sourceIP)
+	s.clientManager.SetStepUpCode(req.Otp)
+	s.clientManager.SetAcceptTerms(req.AcceptTerms)
+	if err := s.clientManager.Authenticate(req.ClientId, req.DeviceId); err != nil {
+		return nil, status.Errorf(codes.Unauthenticated, "failed to authenticate: %v", err)
+	}
+
+	log.Infof("Authentication successful for client %s to access device %s", req.ClientId, req.DeviceId)
+	return &authpb.AuthenticateResponse{ClientId: req.ClientId, DeviceId: req.DeviceId}, nil
+}
+
+func (s *authServer) AccessDevice(ctx context.Context, req *authpb.AccessDeviceRequest) (*authpb.AccessDeviceResponse, error) {
+	if req.ClientId == "" || req.DeviceId == "" {
+		return nil, status.Error(codes.InvalidArgument, "client_id and device_id are required")
+	}
+
+	session, err := s.deviceManager.AccessDevice(req.ClientId, req.DeviceId)
+	if err != nil {
+		return nil, statusError("failed to access device", err)
+	}
+	if err := s.sessionStore.SaveSession(session); err != nil {
+		return nil, statusError("failed to save session", err)
+	}
+
+	log.Infof("Access granted to device %s for client %s", req.DeviceId, req.ClientId)
+	return &authpb.AccessDeviceResponse{Session: sessionMessage(session)}, nil
+}
+
+func (s *authServer) CloseSession(ctx context.Context, req *authpb.CloseSessionRequest) (*authpb.CloseSessionResponse, error) {
+	if req.ClientId == "" || req.DeviceId == "" {
+		return nil, status.Error(codes.InvalidArgument, "client_id and device_id are required")
+	}
+
+	if _, err := s.sessionStore.GetSession(req.ClientId, req.DeviceId); err != nil {
+		return nil, status.Errorf(codes.NotFound, "failed to get session: %v", err)
+	}
+	if err := s.deviceManager.CloseSession(req.ClientId, req.DeviceId); err != nil {
+		return nil, statusError("failed to close session", err)
+	}
+	if err := s.sessionStore.RemoveSession(req.ClientId, req.DeviceId); err != nil {
+		return nil, statusError("failed to remove session", err)
+	}
+
+	log.Infof("Session closed for client %s and device %s", req.ClientId, req.DeviceId)
+	return &authpb.CloseSessionResponse{}, nil
+}
+
+func (s *authServer) ListSessions(ctx context.Context, req *authpb.ListSessionsRequest) (*authpb.ListSessionsResponse, error) {
+	var sessions []*auth.Session
+	var err error
+	if req.ClientId != "" {
+		sessions, err = s.sessionStore.GetActiveSessionsForClient(req.ClientId)
+	} else {
+		sessions, err = s.sessionStore.ListActiveSessions()
+	}
+	if err != nil {
+		return nil, statusError("failed to list sessions", err)
+	}
+
+	response := &authpb.ListSessionsResponse{}
+	for _, session := range sessions {
+		response.Sessions = append(response.Sessions, sessionMessage(session))
+	}
+	return response, nil
+}
+
+func (s *authServer) WatchSessions(req *authpb.WatchSessionsRequest, stream authpb.AuthService_WatchSessionsServer) error {
+	// Stop watching when the caller cancels or the server shuts down
+	stop := make(chan struct{})
+	go func() {
+		select {
+		case <-stream.Context().Done():
+		case <-s.stop:
+		}
+		close(stop)
+	}()
+
+	err := s.deviceManager.WatchSessionActivity(req.ClientId, req.DeviceId, func(entry fabric.AccessLogEntry) error {
+		return stream.Send(&authpb.SessionEvent{
+			SessionId:    entry.SessionID,
+			ClientId:     entry.ClientID,
+			DeviceId:     entry.DeviceID,
+			Action:       entry.Action,
+			Detail:       entry.Detail,
+			Capabilities: entry.Capabilities,
+			TxId:         entry.TxID,
+			BlockNumber:  entry.BlockNumber,
+			Timestamp:    entry.Timestamp.Format(time.RFC3339),
+		})
+	}, stop)
+	if err != nil {
+		return statusError("failed to watch sessions", err)
+	}
+	return nil
+}
+
+// sessionMessage converts a saved session to its protobuf message
+func sessionMessage(session *auth.Session) *authpb.Session {
+	return &authpb.Session{
+		SessionId:     session.SessionID,
+		ClientId:      session.ClientID,
+		DeviceId:      session.DeviceID,
+		Status:        session.Status,
+		EstablishedAt: session.EstablishedAt,
+		ExpiresAt:     session.ExpiresAt,
+	}
+}
+
+// statusError wraps err in a gRPC status. An overloaded device is
+// Unavailable, so callers retry after the delay given in the message, as
+// authcli access-device --wait-overloaded does.
+func statusError(message string, err error) error {
+	var overloaded *fabric.DeviceOverloadedError
+	if errors.As(err, &overloaded) {
+		return status.Errorf(codes.Unavailable, "%s: %v", message, err)
+	}
+	return status.Errorf(codes.Internal, "%s: %v", message, err)
+}
+
+// peerIP returns the IP address of the caller, or "" if it is unknown
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return ""
+	}
+	return host
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chaichis-network/v3/internal/auth"
+)
+
+// An active server started with --replication-listen streams its ticket,
+// session and key files, and its dashboard, to standbys as newline-delimited
+// JSON replication events (see internal/auth/replication.go), with a
+// heartbeat every replicationInterval. A server started with --standby-of
+// follows that stream without serving anything. Once the active server has
+// been silent for --failover-after, the standby takes over: it binds the
+// gRPC and dashboard listeners, starts delivering push challenges, and
+// serves the replicated tickets and sessions, so clients need not
+// authenticate again. Nothing fences the old active server, so it must stay
+// down (or be kept from its clients) once the standby has taken over.
+
+const (
+	// replicationPath is where the active server serves the stream
+	replicationPath = "/replication/stream"
+
+	// replicationInterval is how often the active server scans its files
+	// and sends a heartbeat
+	replicationInterval = time.Second
+
+	// replicationRetryDelay is how long a standby waits before reconnecting
+	replicationRetryDelay = 2 * time.Second
+)
+
+// readReplicationToken reads the shared secret authenticating standbys
+func readReplicationToken(path string) (string, error) {
+	if path == "" {
+		return "", fmt.Errorf("--replication-token-file is required for replication")
+	}
+	tokenBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read replication token: %v", err)
+	}
+	token := strings.TrimSpace(string(tokenBytes))
+	if token == "" {
+		return "", fmt.Errorf("replication token file %s is empty", path)
+	}
+	return token, nil
+}
+
+// replicationHandler streams replication events to a standby
+type replicationHandler struct {
+	token      string
+	dashboards *dashboardHandler // nil without --ui-listen
+	stop       <-chan struct{}
+}
+
+func (h *replicationHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+h.token)) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	log.Infof("Standby %s connected", r.RemoteAddr)
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Cache-Control", "no-store")
+	encoder := json.NewEncoder(w)
+	source := auth.NewReplicationSource(sessionDir)
+	var dashboardAt time.Time
+	synced := false
+
+	ticker := time.NewTicker(replicationInterval)
+	defer ticker.Stop()
+	for {
+		events, err := source.Changes()
+		if err != nil {
+			log.Warnf("Failed to scan replicated files: %v", err)
+		}
+		if !synced && err == nil {
+			events = append(events, auth.ReplicationEvent{Type: auth.ReplicationSynced})
+			synced = true
+		}
+		if h.dashboards != nil {
+			if dashboard := h.dashboards.cached(); dashboard != nil && dashboard.GeneratedAt.After(dashboardAt) {
+				dashboardAt = dashboard.GeneratedAt
+				events = append(events, auth.ReplicationEvent{Type: auth.ReplicationDashboard, Dashboard: dashboard})
+			}
+		}
+		events = append(events, auth.ReplicationEvent{Type: auth.ReplicationHeartbeat})
+
+		now := time.Now().UTC()
+		for _, event := range events {
+			if event.At.IsZero() {
+				event.At = now
+			}
+			if err := encoder.Encode(event); err != nil {
+				log.Infof("Standby %s disconnected: %v", r.RemoteAddr, err)
+				return
+			}
+		}
+		flusher.Flush()
+
+		select {
+		case <-r.Context().Done():
+			log.Infof("Standby %s disconnected", r.RemoteAddr)
+			return
+		case <-h.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// newReplicationServer serves the replication stream of an active server
+func newReplicationServer(token string, dashboards *dashboardHandler, stop <-chan struct{}) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle(replicationPath, &replicationHandler{token: token, dashboards: dashboards, stop: stop})
+	return &http.Server{Handler: mux}
+}
+
+// serveReplication serves the replication stream, over TLS when the gRPC
+// server uses it
+func serveReplication(server *http.Server, listener net.Listener) {
+	log.Infof("Serving replication stream on %s", listener.Addr())
+	var err error
+	if tlsCertFile != "" {
+		err = server.ServeTLS(listener, tlsCertFile, tlsKeyFile)
+	} else {
+		err = server.Serve(listener)
+	}
+	if err != nil && err != http.ErrServerClosed {
+		log.Errorf("Replication stream stopped: %v", err)
+	}
+}
+
+// standby follows the replication stream of an active server
+type standby struct {
+	url           string
+	token         string
+	client        *http.Client
+	failoverAfter time.Duration
+
+	mu        sync.Mutex
+	lastHeard time.Time
+	synced    bool
+	dashboard *auth.Dashboard
+}
+
+// newStandby returns a standby of the active server at activeURL, trusting
+// the certificates in caFile, or the system's if it is empty
+func newStandby(activeURL, token, caFile string, failoverAfter time.Duration) (*standby, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if caFile != "" {
+		caPEM, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read replication CA: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+	return &standby{
+		url:           strings.TrimSuffix(activeURL, "/") + replicationPath,
+		token:         token,
+		client:        &http.Client{Transport: transport},
+		failoverAfter: failoverAfter,
+	}, nil
+}
+
+// run replicates from the active server until it has been silent for
+// failoverAfter, and returns true to take over; it returns false if a
+// shutdown signal arrives first. A standby that never completed a first
+// sync does not take over, since it has nothing to serve.
+func (s *standby) run(signals <-chan os.Signal) bool {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for ctx.Err() == nil {
+			if err := s.follow(ctx); err != nil && ctx.Err() == nil {
+				log.Warnf("Replication from %s interrupted: %v", s.url, err)
+			}
+			select {
+			case <-ctx.Done():
+			case <-time.After(replicationRetryDelay):
+			}
+		}
+	}()
+	// The follower must not write files once the server is running on them
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	ticker := time.NewTicker(replicationInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-signals:
+			return false
+		case <-ticker.C:
+		}
+
+		s.mu.Lock()
+		silent, synced := time.Since(s.lastHeard), s.synced
+		s.mu.Unlock()
+		if synced && silent >= s.failoverAfter {
+			log.Warnf("Active server silent for %s, taking over", silent.Round(time.Second))
+			return true
+		}
+	}
+}
+
+// follow applies the events of one connection to the active server until
+// it ends
+func (s *standby) follow(ctx context.Context) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Authorization", "Bearer "+s.token)
+	response, err := s.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("active server answered %s", response.Status)
+	}
+
+	decoder := json.NewDecoder(response.Body)
+	for {
+		var event auth.ReplicationEvent
+		if err := decoder.Decode(&event); err != nil {
+			return err
+		}
+		if err := auth.ApplyReplicationEvent(event, sessionDir); err != nil {
+			return err
+		}
+
+		s.mu.Lock()
+		s.lastHeard = time.Now()
+		switch event.Type {
+		case auth.ReplicationSynced:
+			if !s.synced {
+				log.Infof("In sync with the active server at %s", s.url)
+			}
+			s.synced = true
+		case auth.ReplicationDashboard:
+			s.dashboard = event.Dashboard
+		}
+		s.mu.Unlock()
+	}
+}
+
+// warmDashboard returns the last dashboard the active server sent, or nil
+func (s *standby) warmDashboard() *auth.Dashboard {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dashboard
+}
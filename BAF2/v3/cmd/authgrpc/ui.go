@@ -0,0 +1,94 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/chaichis-network/v3/internal/auth"
+	"github.com/chaichis-network/v3/internal/fabric"
+)
+
+// The web UI is a single page polling /api/dashboard. It is embedded in the
+// binary so a small deployment gets a dashboard without building or hosting
+// a frontend.
+
+//go:embed ui
+var uiFiles embed.FS
+
+const (
+	// dashboardTTL is how long a dashboard is served before it is read from
+	// the ledger again, however many browsers poll it
+	dashboardTTL = 10 * time.Second
+
+	// dashboardMaxEntries bounds the anomalies and failing clients shown
+	dashboardMaxEntries = 50
+)
+
+// dashboardHandler serves the web UI and the dashboard it shows
+type dashboardHandler struct {
+	fabricClient *fabric.Client
+
+	mu        sync.Mutex
+	dashboard *auth.Dashboard
+}
+
+// newUIHandler returns the handler of the UI listener
+func newUIHandler(dashboards *dashboardHandler) (http.Handler, error) {
+	static, err := fs.Sub(uiFiles, "ui")
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/", http.FileServer(http.FS(static)))
+	mux.Handle("/api/dashboard", dashboards)
+	return mux, nil
+}
+
+func (h *dashboardHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	dashboard, err := h.get()
+	if err != nil {
+		log.Warnf("Failed to build dashboard: %v", err)
+		http.Error(w, "failed to read the ledger: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(dashboard); err != nil {
+		log.Debugf("Failed to write dashboard: %v", err)
+	}
+}
+
+// cached returns the dashboard last read, or nil
+func (h *dashboardHandler) cached() *auth.Dashboard {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.dashboard
+}
+
+// get returns the cached dashboard, reading a new one once it is older than
+// dashboardTTL. Concurrent requests wait for a single read.
+func (h *dashboardHandler) get() (*auth.Dashboard, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.dashboard != nil && time.Since(h.dashboard.GeneratedAt) < dashboardTTL {
+		return h.dashboard, nil
+	}
+	dashboard, err := auth.BuildDashboard(h.fabricClient, dashboardMaxEntries)
+	if err != nil {
+		return nil, err
+	}
+	h.dashboard = dashboard
+	return dashboard, nil
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/chaichis-network/v3/internal/ccpackage"
+	"github.com/spf13/cobra"
+)
+
+var (
+	outDir    string
+	goVersion string
+	checkPath string
+)
+
+func init() {
+	rootCmd.Flags().StringVar(&outDir, "out", "dist", "Directory to write the packages and manifest to")
+	rootCmd.Flags().StringVar(&goVersion, "go-version", "", "Go version the build must use, e.g. go1.21.5 (default: the one on PATH)")
+	rootCmd.Flags().StringVar(&checkPath, "check", "", "Rebuild and compare with this manifest instead of writing packages")
+}
+
+var rootCmd = &cobra.Command{
+	Use:   "ccpackage NAME[:LABEL]=DIR...",
+	Short: "Build and package chaincodes reproducibly",
+	Long: `Builds each chaincode with pinned flags (` + strings.Join(ccpackage.BuildFlags, " ") + `)
+and environment (` + strings.Join(ccpackage.BuildEnv, " ") + `), then packages
+it in the format of 'peer lifecycle chaincode package' with sorted entries and
+fixed owners, modes and times. The same source and Go version always give the
+same package hash.
+
+The packages and a manifest of their hashes and package IDs are written to
+--out. Install the packages and pass each package ID to
+'peer lifecycle chaincode approveformyorg --package-id': the approval records
+the audited hash on the ledger, and 'authcli verify-chaincode' compares the
+running definition with the manifest.
+
+With --check, the chaincodes in a manifest are rebuilt from their recorded
+paths and the command fails if any hash differs, so auditors can reproduce a
+release.
+
+Example:
+  ccpackage --go-version go1.21.5 \
+    as_chaincode_1.1=../../chaincodes/as-chaincode-fixed-v4 \
+    tgs-chaincode_2.0=../../chaincodes/tgs-chaincode-fixed-v4 \
+    isv-chaincode_2.0=../../chaincodes/isv-chaincode-fixed-v4`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		version, err := ccpackage.GoVersion()
+		if err != nil {
+			return err
+		}
+
+		if checkPath != "" {
+			if len(args) > 0 {
+				return fmt.Errorf("--check takes the chaincodes from the manifest, not arguments")
+			}
+			return check(version)
+		}
+
+		if len(args) == 0 {
+			return fmt.Errorf("at least one NAME=DIR argument is required")
+		}
+		if goVersion != "" && goVersion != version {
+			return fmt.Errorf("the go command on PATH is %s, not %s", version, goVersion)
+		}
+		if err := os.MkdirAll(outDir, 0755); err != nil {
+			return fmt.Errorf("failed to create %s: %v", outDir, err)
+		}
+
+		manifest := &ccpackage.Manifest{
+			GoVersion:  version,
+			BuildFlags: ccpackage.BuildFlags,
+			BuildEnv:   ccpackage.BuildEnv,
+			CreatedAt:  time.Now().UTC(),
+		}
+		for _, arg := range args {
+			name, label, dir, err := parseChaincodeArg(arg)
+			if err != nil {
+				return err
+			}
+			if manifest.Find(name) != nil {
+				return fmt.Errorf("chaincode %s is given twice", name)
+			}
+
+			fmt.Printf("Packaging %s from %s...\n", name, dir)
+			entry, err := ccpackage.PackageChaincode(name, dir, label, outDir)
+			if err != nil {
+				return fmt.Errorf("failed to package %s: %v", name, err)
+			}
+			manifest.Chaincodes = append(manifest.Chaincodes, *entry)
+			fmt.Printf("  package    %s\n", filepath.Join(outDir, entry.PackageFile))
+			fmt.Printf("  package ID %s\n", entry.PackageID)
+			fmt.Printf("  binary     sha256:%s\n", entry.BinaryHash)
+		}
+
+		manifestPath := filepath.Join(outDir, ccpackage.ManifestFile)
+		if err := manifest.Save(manifestPath); err != nil {
+			return err
+		}
+		fmt.Printf("Manifest written to %s\n", manifestPath)
+		return nil
+	},
+}
+
+// parseChaincodeArg splits NAME[:LABEL]=DIR. The label defaults to the name.
+func parseChaincodeArg(arg string) (name, label, dir string, err error) {
+	parts := strings.SplitN(arg, "=", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", "", fmt.Errorf("invalid chaincode %q, expected NAME[:LABEL]=DIR", arg)
+	}
+	name, label = parts[0], parts[0]
+	if i := strings.Index(name, ":"); i >= 0 {
+		name, label = name[:i], name[i+1:]
+	}
+	return name, label, parts[1], nil
+}
+
+// check rebuilds the chaincodes of the manifest at checkPath and compares
+// the hashes
+func check(version string) error {
+	manifest, err := ccpackage.LoadManifest(checkPath)
+	if err != nil {
+		return err
+	}
+	if manifest.GoVersion != version {
+		return fmt.Errorf("the manifest was built with %s, the go command on PATH is %s", manifest.GoVersion, version)
+	}
+	if strings.Join(manifest.BuildFlags, " ") != strings.Join(ccpackage.BuildFlags, " ") ||
+		strings.Join(manifest.BuildEnv, " ") != strings.Join(ccpackage.BuildEnv, " ") {
+		return fmt.Errorf("the manifest was built with other flags (%s; %s)",
+			strings.Join(manifest.BuildFlags, " "), strings.Join(manifest.BuildEnv, " "))
+	}
+
+	differ := 0
+	for _, entry := range manifest.Chaincodes {
+		binaryHash, err := ccpackage.Build(entry.Path)
+		if err != nil {
+			return fmt.Errorf("failed to build %s: %v", entry.Name, err)
+		}
+		pkg, err := ccpackage.Package(entry.Path, entry.Label)
+		if err != nil {
+			return fmt.Errorf("failed to package %s: %v", entry.Name, err)
+		}
+
+		status := "reproduced"
+		if id := ccpackage.PackageID(entry.Label, pkg); id != entry.PackageID {
+			status = "package differs: " + id
+			differ++
+		} else if binaryHash != entry.BinaryHash {
+			status = "binary differs: sha256:" + binaryHash
+			differ++
+		}
+		fmt.Printf("%-20s %s\n", entry.Name, status)
+	}
+	if differ > 0 {
+		return fmt.Errorf("%d of %d chaincodes did not reproduce", differ, len(manifest.Chaincodes))
+	}
+	return nil
+}
+
+func main() {
+	if err := rootCmd.Execute(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
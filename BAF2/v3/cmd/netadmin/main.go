@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/chaichis-network/v3/internal/fabric"
+	"github.com/chaichis-network/v3/internal/netadmin"
+	"github.com/spf13/cobra"
+)
+
+var (
+	planPath        string
+	configPath      string
+	ageIdentityFile string
+	forceInit       []string
+)
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&planPath, "plan", "config/netadmin-plan.json", "Bootstrap plan")
+	rootCmd.PersistentFlags().StringVar(&configPath, "config", fabric.DefaultConfigPath, "Connection profile")
+	rootCmd.PersistentFlags().StringVar(&ageIdentityFile, "age-identity", "", "age identity file for a .age connection profile (default: $"+fabric.AgeIdentityEnv+")")
+	initCmd.Flags().StringSliceVar(&forceInit, "run-init", nil, "Chaincodes to submit the plan's init function to even if they were deployed before")
+
+	rootCmd.AddCommand(upCmd, channelCmd, deployCmd, initCmd)
+}
+
+var rootCmd = &cobra.Command{
+	Use:   "netadmin",
+	Short: "Bring up the channel and chaincodes of the authentication network",
+	Long: `Creates the channel, deploys the chaincodes and initializes them from a plan,
+acting as the admin of each organization: the steps network.sh createChannel,
+deploy-chaincode.sh and 'authcli service-keys' otherwise take by hand.
+
+The plan names the channel and its creation transaction, the orderer, each
+organization with its admin MSP directory and peers, the ccpackage manifest
+of the packages to deploy, and per chaincode its version, endorsement
+policy, collections, service key and init function. Every step checks the
+network first, so netadmin can be rerun after a failure or to upgrade:
+
+  channel  created unless the orderer has it; peers joined unless they have;
+           anchor peers updated when the channel is created
+  deploy   packages installed where missing; a chaincode whose committed
+           definition runs another package or version is approved by every
+           organization at the next sequence and committed
+  init     in dependency order (serviceKey.importFrom and after): the ISV,
+           TGS and AS are initialized with their key pairs unless they were,
+           importing and publishing keys as they go, the TGS imports the AS
+           key (serviceKey.verifyFrom), and the key ceremony is verified; init functions run after a chaincode's first deployment
+
+Example:
+  netadmin up --plan config/netadmin-plan.json --config config/connection-profile.json`,
+}
+
+var upCmd = &cobra.Command{
+	Use:   "up",
+	Short: "Create the channel, deploy and initialize the chaincodes",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withBootstrap(func(b *netadmin.Bootstrap) error {
+			return b.Run()
+		})
+	},
+}
+
+var channelCmd = &cobra.Command{
+	Use:   "channel",
+	Short: "Create the channel and join the peers",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withBootstrap(func(b *netadmin.Bootstrap) error {
+			return b.Channel()
+		})
+	},
+}
+
+var deployCmd = &cobra.Command{
+	Use:   "deploy",
+	Short: "Install, approve and commit the chaincodes",
+	Long: `Installs, approves and commits the chaincodes of the plan. Init functions
+are not run; run 'netadmin init --run-init NAME' for chaincodes deployed for
+the first time.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withBootstrap(func(b *netadmin.Bootstrap) error {
+			return b.Deploy()
+		})
+	},
+}
+
+var initCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Initialize the deployed chaincodes in dependency order",
+	Long: `Initializes the AS, TGS and ISV with their key pairs unless they already
+were, and verifies the key ceremony. Init functions such as InitLedger are
+only submitted to the chaincodes named with --run-init, since they may not
+be safe to repeat.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withBootstrap(func(b *netadmin.Bootstrap) error {
+			return b.Initialize(forceInit)
+		})
+	},
+}
+
+// withBootstrap loads the plan and runs fn connected as its admins
+func withBootstrap(fn func(b *netadmin.Bootstrap) error) error {
+	plan, err := netadmin.LoadPlan(planPath)
+	if err != nil {
+		return err
+	}
+	b, err := netadmin.New(plan, configPath, ageIdentityFile)
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+	return fn(b)
+}
+
+func main() {
+	if err := rootCmd.Execute(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"github.com/chaichis-network/v3/internal/fabric"
+	"github.com/pkg/errors"
+)
+
+// StreamAccessLogs passes a device's access log to onEntry, oldest first.
+// With follow set it then keeps passing new entries from chaincode events
+// until stop is closed. The event subscription is opened before the history
+// is read, so no entry committed in between is missed; entries seen in both
+// are passed once.
+func (dm *DeviceManager) StreamAccessLogs(deviceID string, pageSize int32, follow bool, onEntry func(fabric.AccessLogEntry) error, stop <-chan struct{}) error {
+	var live <-chan fabric.AccessLogEntry
+	if follow {
+		entries, cancel, err := dm.isvContract.WatchAccessLogs(deviceID)
+		if err != nil {
+			return err
+		}
+		defer cancel()
+		live = entries
+	}
+
+	seen := map[string]bool{}
+	bookmark := ""
+	for {
+		page, err := dm.isvContract.GetAccessLogs(deviceID, pageSize, bookmark)
+		if err != nil {
+			return err
+		}
+		for _, entry := range page.Entries {
+			if follow {
+				seen[entry.LogID] = true
+			}
+			if err := onEntry(entry); err != nil {
+				return err
+			}
+		}
+		if page.Bookmark == "" {
+			break
+		}
+		bookmark = page.Bookmark
+	}
+	if !follow {
+		return nil
+	}
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		case entry, ok := <-live:
+			if !ok {
+				return errors.New("access log event stream closed")
+			}
+			if seen[entry.LogID] {
+				// Only entries committed while the history was read repeat
+				delete(seen, entry.LogID)
+				continue
+			}
+			if err := onEntry(entry); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/chaichis-network/v3/internal/crypto"
+	"github.com/pkg/errors"
+)
+
+// RequestOperation asks for a device operation. Ordinary operations are
+// granted immediately and return a session; sensitive operations (actuator,
+// unlock) are held by the ISV until a second client co-signs them and return
+// the approval ID to wait on instead.
+func (dm *DeviceManager) RequestOperation(clientID, deviceID, operation string) (*Session, string, error) {
+	serviceTicket, err := (&ClientManager{
+		fabricClient: dm.fabricClient,
+		identity:     dm.identity,
+	}).GetServiceTicket(clientID, deviceID)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "failed to get service ticket")
+	}
+	authenticator, err := dm.newServiceAuthenticator(clientID, serviceTicket)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "failed to create authenticator")
+	}
+
+	requestMap := map[string]string{
+		"encryptedServiceTicket": serviceTicket["encryptedServiceTicket"],
+		"clientID":               clientID,
+		"deviceID":               deviceID,
+		"requestType":            operation,
+	}
+	authenticator.addTo(requestMap)
+
+	response, err := dm.isvContract.ProcessServiceRequest(requestMap)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "failed to process service request")
+	}
+	if err := authenticator.verify(response); err != nil {
+		return nil, "", err
+	}
+
+	switch response["status"] {
+	case "pending_approval":
+		log.Infof("Operation %s on device %s is awaiting approval: %s", operation, deviceID, response["approvalID"])
+		return nil, response["approvalID"], nil
+	case "granted":
+		session, err := saveSessionFile(clientID, deviceID, response["sessionID"])
+		if err != nil {
+			return nil, "", err
+		}
+		return session, "", nil
+	default:
+		return nil, "", serviceDeniedError(response)
+	}
+}
+
+// SetDeviceApprovers sets the clients allowed to co-sign sensitive operations
+// on a device. The list is signed with the device's private key.
+func (dm *DeviceManager) SetDeviceApprovers(deviceID string, approvers []string) error {
+	privateKey, err := crypto.LoadPrivateKey(deviceID)
+	if err != nil {
+		return errors.Wrap(err, "failed to load device private key")
+	}
+
+	// Must match approversMessage in the ISV chaincode
+	message := fmt.Sprintf("APPROVERS|%s|%s", deviceID, strings.Join(approvers, ","))
+	signature, err := crypto.SignData(privateKey, []byte(message))
+	if err != nil {
+		return errors.Wrap(err, "failed to sign approvers")
+	}
+
+	return dm.isvContract.SetDeviceApprovers(deviceID, approvers, signature)
+}
+
+// ApproveOperation co-signs a pending operation as approverID, using the
+// approver's service ticket for the device
+func (dm *DeviceManager) ApproveOperation(approverID, deviceID, approvalID string) (map[string]interface{}, error) {
+	request, err := dm.approverRequest(approverID, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	return dm.isvContract.ApproveOperation(approvalID, request)
+}
+
+// RejectOperation rejects a pending operation as approverID
+func (dm *DeviceManager) RejectOperation(approverID, deviceID, approvalID string) (map[string]interface{}, error) {
+	request, err := dm.approverRequest(approverID, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	return dm.isvContract.RejectOperation(approvalID, request)
+}
+
+// PendingApprovals lists operations awaiting co-signature for a device
+// (all devices if deviceID is empty)
+func (dm *DeviceManager) PendingApprovals(deviceID string) ([]map[string]interface{}, error) {
+	return dm.isvContract.GetPendingApprovals(deviceID)
+}
+
+// ApprovalStatus returns the state of an approval. Once the operation has
+// been approved, the requester's session is saved and returned.
+func (dm *DeviceManager) ApprovalStatus(clientID, approvalID string) (string, *Session, error) {
+	approval, err := dm.isvContract.GetApproval(approvalID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	status, _ := approval["status"].(string)
+	if status != "approved" {
+		return status, nil, nil
+	}
+
+	if requester, _ := approval["clientID"].(string); requester != clientID {
+		return status, nil, nil
+	}
+	deviceID, _ := approval["deviceID"].(string)
+	sessionID, _ := approval["sessionID"].(string)
+	session, err := saveSessionFile(clientID, deviceID, sessionID)
+	if err != nil {
+		return status, nil, err
+	}
+	return status, session, nil
+}
+
+func (dm *DeviceManager) approverRequest(approverID, deviceID string) (map[string]string, error) {
+	serviceTicket, err := (&ClientManager{
+		fabricClient: dm.fabricClient,
+		identity:     dm.identity,
+	}).GetServiceTicket(approverID, deviceID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get approver's service ticket")
+	}
+
+	return map[string]string{
+		"encryptedServiceTicket": serviceTicket["encryptedServiceTicket"],
+		"clientID":               approverID,
+		"deviceID":               deviceID,
+		"requestType":            "approve",
+	}, nil
+}
+
+// saveSessionFile records an active session in the client's session file
+func saveSessionFile(clientID, deviceID, sessionID string) (*Session, error) {
+	session := &Session{
+		SessionID: sessionID,
+		ClientID:  clientID,
+		DeviceID:  deviceID,
+		Status:    "active",
+	}
+
+	sessionJSON, err := json.Marshal(session)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal session")
+	}
+
+	sessionFile := clientID + "-session-" + deviceID + ".json"
+	if err := ioutil.WriteFile(sessionFile, sessionJSON, 0600); err != nil {
+		return nil, errors.Wrap(err, "failed to save session to file")
+	}
+
+	return session, nil
+}
@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/chaichis-network/v3/internal/crypto"
+	"github.com/chaichis-network/v3/internal/fabric"
+	"github.com/pkg/errors"
+)
+
+// SetClientAttributes replaces the attributes the client registered with
+// the AS, signed with the client's key; no attributes removes them. The
+// attributes reach services in TGTs issued or renewed afterwards.
+func (cm *ClientManager) SetClientAttributes(clientID string, attributes map[string]string) (map[string]interface{}, error) {
+	if attributes == nil {
+		attributes = map[string]string{}
+	}
+	attributesJSON, err := json.Marshal(attributes)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal attributes")
+	}
+	privateKey, err := crypto.LoadPrivateKey(clientID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load client's private key")
+	}
+
+	// Must match setAttributesMessage in the AS chaincode
+	timestamp := time.Now().Unix()
+	message := fmt.Sprintf("SET_ATTRIBUTES|%s|%x|%d", clientID, sha256.Sum256(attributesJSON), timestamp)
+	signature, err := crypto.SignData(privateKey, []byte(message))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to sign attributes")
+	}
+	return cm.asContract.SetClientAttributes(clientID, string(attributesJSON), timestamp, signature)
+}
+
+// ParseAttributeRules parses NAME=VALUE[,VALUE...] arguments into the
+// values each attribute may take
+func ParseAttributeRules(args []string) (map[string][]string, error) {
+	rules := make(map[string][]string, len(args))
+	for _, arg := range args {
+		i := strings.Index(arg, "=")
+		if i <= 0 || i == len(arg)-1 {
+			return nil, fmt.Errorf("invalid attribute rule %q: expected name=value[,value...]", arg)
+		}
+		rules[arg[:i]] = strings.Split(arg[i+1:], ",")
+	}
+	return rules, nil
+}
+
+// SetDeviceAttributeRules sets the values of client attributes a device
+// allows; no rules removes them. The rules are signed with the device's
+// private key.
+func (dm *DeviceManager) SetDeviceAttributeRules(deviceID string, rules map[string][]string) error {
+	if rules == nil {
+		rules = map[string][]string{}
+	}
+	rulesJSON, err := json.Marshal(rules)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal attribute rules")
+	}
+	privateKey, err := crypto.LoadPrivateKey(deviceID)
+	if err != nil {
+		return errors.Wrap(err, "failed to load device private key")
+	}
+
+	// Must match attributeRulesMessage in the ISV chaincode
+	message := fmt.Sprintf("ATTRIBUTERULES|%s|%x", deviceID, sha256.Sum256(rulesJSON))
+	signature, err := crypto.SignData(privateKey, []byte(message))
+	if err != nil {
+		return errors.Wrap(err, "failed to sign attribute rules")
+	}
+	return dm.isvContract.SetDeviceAttributeRules(deviceID, string(rulesJSON), signature)
+}
+
+// SetDisclosurePolicy sets the client attributes the TGS discloses to a
+// service
+func (dm *DeviceManager) SetDisclosurePolicy(serviceID string, attributes []string) (*fabric.DisclosurePolicy, error) {
+	tgsContract, err := fabric.NewTicketGrantingContract(dm.fabricClient)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get TGS contract")
+	}
+	return tgsContract.SetDisclosurePolicy(serviceID, attributes)
+}
+
+// GetDisclosurePolicy returns a service's disclosure policy, or nil if the
+// service learns no attributes
+func (dm *DeviceManager) GetDisclosurePolicy(serviceID string) (*fabric.DisclosurePolicy, error) {
+	tgsContract, err := fabric.NewTicketGrantingContract(dm.fabricClient)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get TGS contract")
+	}
+	return tgsContract.GetDisclosurePolicy(serviceID)
+}
@@ -0,0 +1,36 @@
+package auth
+
+import (
+	"time"
+
+	"github.com/chaichis-network/v3/internal/fabric"
+)
+
+// OpenEmergencySession opens a break-glass session to a device for
+// lifetime, bypassing the AS and TGS. The identity in use needs the
+// break_glass certificate attribute; zero lifetime is the ISV default.
+func (dm *DeviceManager) OpenEmergencySession(deviceID, reason string, lifetime time.Duration) (*fabric.EmergencyAccess, error) {
+	access, err := dm.isvContract.OpenEmergencySession(deviceID, reason, int64(lifetime/time.Second))
+	if err != nil {
+		return nil, err
+	}
+	log.Warnf("Break-glass session %s opened on device %s until %s", access.SessionID, deviceID, access.ExpiresAt.Format(time.RFC3339))
+	return access, nil
+}
+
+// CloseEmergencySession ends a break-glass session with a summary of the
+// work done
+func (dm *DeviceManager) CloseEmergencySession(accessID, summary string) (*fabric.EmergencyAccess, error) {
+	return dm.isvContract.CloseEmergencySession(accessID, summary)
+}
+
+// GetEmergencyAccess returns a break-glass session and its audit trail
+func (dm *DeviceManager) GetEmergencyAccess(accessID string) (*fabric.EmergencyAccess, error) {
+	return dm.isvContract.GetEmergencyAccess(accessID)
+}
+
+// EmergencyAccesses lists the break-glass sessions of a device, or of all
+// devices if deviceID is empty
+func (dm *DeviceManager) EmergencyAccesses(deviceID string) ([]*fabric.EmergencyAccess, error) {
+	return dm.isvContract.GetEmergencyAccesses(deviceID)
+}
@@ -0,0 +1,37 @@
+package auth
+
+import (
+	"github.com/chaichis-network/v3/internal/fabric"
+	"github.com/pkg/errors"
+)
+
+// serviceDeniedError reports a service response other than "granted",
+// with the ISV's reason when it gave one
+func serviceDeniedError(response map[string]string) error {
+	if reason := response["denyReason"]; reason != "" {
+		return errors.Errorf("access denied: %s: %s", response["status"], reason)
+	}
+	return errors.Errorf("access denied: %s", response["status"])
+}
+
+// SetCapabilityMatrix stores the ISV capability matrix, given as JSON
+func (dm *DeviceManager) SetCapabilityMatrix(matrixJSON string) (*fabric.CapabilityMatrix, error) {
+	return dm.isvContract.SetCapabilityMatrix(matrixJSON)
+}
+
+// GetCapabilityMatrix returns the ISV capability matrix in force
+func (dm *DeviceManager) GetCapabilityMatrix() (*fabric.CapabilityMatrix, error) {
+	return dm.isvContract.GetCapabilityMatrix()
+}
+
+// SetClientPermissions grants a client actions at the ISV; nil returns it
+// to the matrix's default permissions
+func (dm *DeviceManager) SetClientPermissions(clientID string, actions []string) (*fabric.ClientPermissions, error) {
+	return dm.isvContract.SetClientPermissions(clientID, actions)
+}
+
+// GetClientPermissions returns the actions granted to a client, or nil if
+// it holds the matrix's default permissions
+func (dm *DeviceManager) GetClientPermissions(clientID string) (*fabric.ClientPermissions, error) {
+	return dm.isvContract.GetClientPermissions(clientID)
+}
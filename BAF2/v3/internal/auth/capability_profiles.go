@@ -0,0 +1,44 @@
+package auth
+
+import (
+	"github.com/chaichis-network/v3/internal/crypto"
+	"github.com/chaichis-network/v3/internal/fabric"
+	"github.com/pkg/errors"
+)
+
+// RegisterDeviceWithProfile registers a device whose capabilities follow a
+// capability profile; sessions opened after the profile is updated get the
+// updated capabilities
+func (dm *DeviceManager) RegisterDeviceWithProfile(deviceID, profileID string) error {
+	if _, err := crypto.LoadOrGenerateKeys(deviceID, dm.keyType); err != nil {
+		return errors.Wrap(err, "failed to load or generate device keys")
+	}
+	publicKeyPEM, err := crypto.GetPublicKeyPEM(deviceID)
+	if err != nil {
+		return errors.Wrap(err, "failed to get device's public key PEM")
+	}
+
+	if err := dm.isvContract.RegisterIoTDeviceWithProfile(deviceID, publicKeyPEM, profileID); err != nil {
+		return errors.Wrap(err, "failed to register device with ISV")
+	}
+
+	log.Infof("Device %s registered successfully with capability profile %s", deviceID, profileID)
+	return nil
+}
+
+// SetCapabilityProfile creates a capability profile or publishes a new
+// version of it
+func (dm *DeviceManager) SetCapabilityProfile(profileID string, capabilities []string, description string) (*fabric.CapabilityProfile, error) {
+	return dm.isvContract.SetCapabilityProfile(profileID, capabilities, description)
+}
+
+// GetCapabilityProfile returns a version of a capability profile; version 0
+// is the current one
+func (dm *DeviceManager) GetCapabilityProfile(profileID string, version int) (*fabric.CapabilityProfile, error) {
+	return dm.isvContract.GetCapabilityProfile(profileID, version)
+}
+
+// ListCapabilityProfiles returns the current version of every profile
+func (dm *DeviceManager) ListCapabilityProfiles() ([]*fabric.CapabilityProfile, error) {
+	return dm.isvContract.GetAllCapabilityProfiles()
+}
@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"github.com/chaichis-network/v3/internal/ccpackage"
+)
+
+// Chaincode verification outcomes
+const (
+	ChaincodeVerified      = "verified"
+	ChaincodeMismatch      = "mismatch"
+	ChaincodeNotApproved   = "not_approved"
+	ChaincodeCheckFailed   = "check_failed"
+	ChaincodeLocalModified = "local_modified"
+)
+
+// ChaincodeCheck compares one audited package with the deployed chaincode
+type ChaincodeCheck struct {
+	Name              string `json:"name"`
+	Status            string `json:"status"`
+	ExpectedPackageID string `json:"expectedPackageID"`
+	DeployedPackageID string `json:"deployedPackageID,omitempty"`
+	Sequence          int64  `json:"sequence,omitempty"`
+	Version           string `json:"version,omitempty"`
+	Detail            string `json:"detail,omitempty"`
+}
+
+// ChaincodeVerification is the result of VerifyChaincodes
+type ChaincodeVerification struct {
+	Checks     []ChaincodeCheck `json:"checks"`
+	Mismatched int              `json:"mismatched"` // Every status but verified
+}
+
+// VerifyChaincodes checks that each chaincode in a ccpackage manifest runs
+// the audited package: the package ID the peer's organization approved for
+// the committed sequence must be the one the manifest records. Package
+// files kept next to the manifest are re-hashed too, so an edited release
+// directory does not pass.
+func (cm *ClientManager) VerifyChaincodes(manifestPath string) (*ChaincodeVerification, error) {
+	manifest, err := ccpackage.LoadManifest(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ChaincodeVerification{}
+	for _, entry := range manifest.Chaincodes {
+		check := ChaincodeCheck{Name: entry.Name, ExpectedPackageID: entry.PackageID}
+		if err := entry.CheckPackageFile(manifestPath); err != nil {
+			check.Status = ChaincodeLocalModified
+			check.Detail = err.Error()
+			result.add(check)
+			continue
+		}
+
+		deployed, err := cm.fabricClient.QueryDeployedChaincode(entry.Name)
+		if err != nil {
+			check.Status = ChaincodeCheckFailed
+			check.Detail = err.Error()
+			result.add(check)
+			continue
+		}
+		check.DeployedPackageID = deployed.PackageID
+		check.Sequence = deployed.Sequence
+		check.Version = deployed.Version
+		switch deployed.PackageID {
+		case entry.PackageID:
+			check.Status = ChaincodeVerified
+		case "":
+			check.Status = ChaincodeNotApproved
+			check.Detail = "this organization approved no package for the committed sequence"
+		default:
+			check.Status = ChaincodeMismatch
+			check.Detail = "the approved package differs from the audited build"
+		}
+		result.add(check)
+	}
+	return result, nil
+}
+
+func (r *ChaincodeVerification) add(check ChaincodeCheck) {
+	r.Checks = append(r.Checks, check)
+	if check.Status != ChaincodeVerified {
+		r.Mismatched++
+	}
+}
@@ -0,0 +1,241 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/chaichis-network/v3/internal/crypto"
+	"github.com/chaichis-network/v3/internal/fabric"
+	"github.com/pkg/errors"
+)
+
+// With the "push" step-up method, the AS opens each step-up with a
+// challenge for the app registered as the client's challenge channel. A
+// daemon (authgrpc --deliver-challenges) posts it to the app's endpoint; the
+// app signs its owner's answer and submits it. The client meanwhile polls the
+// step-up and continues authenticating once it is approved.
+
+const (
+	// PushAnswerApprove and PushAnswerDeny are the answers to a push
+	// challenge
+	PushAnswerApprove = "approve"
+	PushAnswerDeny    = "deny"
+
+	// pushPollInterval is how often a client waiting for an answer polls
+	pushPollInterval = 2 * time.Second
+
+	// pushDeliveryAttempts bounds the deliveries of one challenge, which also
+	// covers a peer that has not yet committed the step-up
+	pushDeliveryAttempts = 3
+	pushDeliveryTimeout  = 10 * time.Second
+)
+
+// AppKeyID is the key store ID of the key authcli uses to answer push
+// challenges on behalf of a client's app
+func AppKeyID(clientID string) string {
+	return clientID + "-app"
+}
+
+// SetPushWait sets how long Authenticate waits for a push step-up to be
+// answered in the client's app; zero does not wait
+func (cm *ClientManager) SetPushWait(wait time.Duration) {
+	cm.pushWait = wait
+}
+
+// SetChallengeChannel registers the app push step-ups are delivered to: its
+// endpoint and the PEM public key it signs answers with. The registration is
+// signed with the client's key.
+func (cm *ClientManager) SetChallengeChannel(clientID, endpoint, appPublicKeyPEM string) (*fabric.ChallengeChannel, error) {
+	privateKey, err := crypto.LoadPrivateKey(clientID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load client's private key")
+	}
+
+	// Must match setChannelMessage in the AS chaincode
+	timestamp := time.Now().Unix()
+	message := fmt.Sprintf("SET_CHALLENGE_CHANNEL|%s|%x|%d", clientID, sha256.Sum256([]byte(endpoint+"|"+appPublicKeyPEM)), timestamp)
+	signature, err := crypto.SignData(privateKey, []byte(message))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to sign challenge channel")
+	}
+	channel, err := cm.asContract.SetChallengeChannel(clientID, endpoint, appPublicKeyPEM, timestamp, signature)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Infof("Push challenges for client %s go to %s", clientID, endpoint)
+	return channel, nil
+}
+
+// RemoveChallengeChannel removes a client's challenge channel, signed with
+// the client's key
+func (cm *ClientManager) RemoveChallengeChannel(clientID string) error {
+	privateKey, err := crypto.LoadPrivateKey(clientID)
+	if err != nil {
+		return errors.Wrap(err, "failed to load client's private key")
+	}
+
+	// Must match removeChannelMessage in the AS chaincode
+	timestamp := time.Now().Unix()
+	message := fmt.Sprintf("REMOVE_CHALLENGE_CHANNEL|%s|%d", clientID, timestamp)
+	signature, err := crypto.SignData(privateKey, []byte(message))
+	if err != nil {
+		return errors.Wrap(err, "failed to sign channel removal")
+	}
+	if err := cm.asContract.RemoveChallengeChannel(clientID, timestamp, signature); err != nil {
+		return err
+	}
+
+	log.Infof("Removed the challenge channel of client %s", clientID)
+	return nil
+}
+
+// ChallengeChannel returns a client's challenge channel, or nil if it has
+// none
+func (cm *ClientManager) ChallengeChannel(clientID string) (*fabric.ChallengeChannel, error) {
+	return cm.asContract.GetChallengeChannel(clientID)
+}
+
+// StepUpStatus returns a client's pending step-up, or nil if there is none
+func (cm *ClientManager) StepUpStatus(clientID string) (*fabric.StepUpStatus, error) {
+	return cm.asContract.GetStepUpStatus(clientID)
+}
+
+// AnswerPushChallenge answers a client's open push step-up as its app would,
+// signing with the key stored under appKeyID
+func (cm *ClientManager) AnswerPushChallenge(clientID, appKeyID, answer string) error {
+	if answer != PushAnswerApprove && answer != PushAnswerDeny {
+		return errors.Errorf("answer must be %s or %s", PushAnswerApprove, PushAnswerDeny)
+	}
+	status, err := cm.asContract.GetStepUpStatus(clientID)
+	if err != nil {
+		return err
+	}
+	if status == nil || status.Challenge == "" {
+		return errors.Errorf("client %s has no pending push step-up", clientID)
+	}
+	privateKey, err := crypto.LoadPrivateKey(appKeyID)
+	if err != nil {
+		return errors.Wrap(err, "failed to load app's private key")
+	}
+
+	// Must match pushAnswerMessage in the AS chaincode
+	message := fmt.Sprintf("PUSH_ANSWER|%s|%s|%s", clientID, status.Challenge, answer)
+	signature, err := crypto.SignData(privateKey, []byte(message))
+	if err != nil {
+		return errors.Wrap(err, "failed to sign answer")
+	}
+	if err := cm.asContract.AnswerPushChallenge(clientID, answer, signature); err != nil {
+		return err
+	}
+
+	log.Infof("Push step-up for client %s answered: %s", clientID, answer)
+	return nil
+}
+
+// waitForPushAnswer polls a client's push step-up until it is approved,
+// denied or expired, or until the wait set with SetPushWait runs out
+func (cm *ClientManager) waitForPushAnswer(clientID string) error {
+	log.Infof("Waiting up to %s for the attempt to be approved in the app of client %s...", cm.pushWait, clientID)
+	deadline := time.Now().Add(cm.pushWait)
+	for {
+		status, err := cm.asContract.GetStepUpStatus(clientID)
+		if err != nil {
+			return err
+		}
+		switch {
+		case status == nil:
+			return errors.Errorf("no step-up is pending for client %s", clientID)
+		case status.Satisfied:
+			log.Infof("Step-up approved in the app of client %s", clientID)
+			return nil
+		case status.Denied:
+			return errors.Errorf("the attempt was denied in the app of client %s", clientID)
+		case time.Now().After(status.ExpiresAt):
+			return errors.Errorf("step-up for client %s expired unanswered", clientID)
+		case time.Now().After(deadline):
+			return errors.Errorf("no answer from the app of client %s within %s", clientID, cm.pushWait)
+		}
+		time.Sleep(pushPollInterval)
+	}
+}
+
+// DeliverPushChallenges posts the challenge of each push step-up the AS
+// opens to the client's challenge channel, until stop is closed. A client
+// without a channel is skipped; an admin can still approve its step-up.
+func (cm *ClientManager) DeliverPushChallenges(stop <-chan struct{}) error {
+	clientIDs, cancel, err := cm.asContract.WatchPushStepUps()
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	httpClient := &http.Client{Timeout: pushDeliveryTimeout}
+	for {
+		select {
+		case <-stop:
+			return nil
+		case clientID, ok := <-clientIDs:
+			if !ok {
+				return errors.New("risk decision event stream closed")
+			}
+			go cm.deliverPushChallenge(httpClient, clientID)
+		}
+	}
+}
+
+// deliverPushChallenge reads a client's push challenge and posts it to its
+// endpoint, retrying with a growing delay
+func (cm *ClientManager) deliverPushChallenge(httpClient *http.Client, clientID string) {
+	channel, err := cm.asContract.GetChallengeChannel(clientID)
+	if err != nil {
+		log.Warnf("Push challenge for client %s not delivered: %v", clientID, err)
+		return
+	}
+	if channel == nil {
+		log.Infof("Client %s has no challenge channel; its step-up needs an admin", clientID)
+		return
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := cm.postPushChallenge(httpClient, clientID)
+		if err == nil {
+			log.Infof("Push challenge for client %s delivered to %s", clientID, channel.Endpoint)
+			return
+		}
+		if attempt == pushDeliveryAttempts {
+			log.Warnf("Push challenge for client %s not delivered after %d attempts: %v", clientID, attempt, err)
+			return
+		}
+		time.Sleep(time.Duration(attempt) * time.Second)
+	}
+}
+
+// postPushChallenge posts a client's current push challenge to its endpoint
+func (cm *ClientManager) postPushChallenge(httpClient *http.Client, clientID string) error {
+	challenge, err := cm.asContract.GetPushChallenge(clientID)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(challenge)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal push challenge")
+	}
+
+	resp, err := httpClient.Post(challenge.Endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.Errorf("endpoint answered %s", resp.Status)
+	}
+	return nil
+}
@@ -1,7 +1,6 @@
 package auth
 
 import (
-	"encoding/base64"
 	"encoding/json"
 	"io/ioutil"
 	"os"
@@ -10,6 +9,8 @@ import (
 	"github.com/chaichis-network/v3/internal/crypto"
 	"github.com/chaichis-network/v3/internal/fabric"
 	"github.com/chaichis-network/v3/pkg/logger"
+	"github.com/chaichis-network/v3/pkg/progress"
+	"github.com/chaichis-network/v3/pkg/ticket"
 	"github.com/pkg/errors"
 )
 
@@ -21,8 +22,24 @@ type ClientManager struct {
 	asContract   *fabric.AuthServerContract
 	tgsContract  *fabric.TicketGrantingContract
 	identity     string
+	progress     progress.Reporter
+	sourceIP     string
+	stepUpCode   string
+	pushWait     time.Duration
+	acceptTerms  bool
+	keyType      crypto.KeyType
 }
 
+// DefaultServiceID is the service that tickets are requested for
+const DefaultServiceID = "iotservice1"
+
+// AuthenticationSteps is the number of progress steps reported by Authenticate
+const AuthenticationSteps = 5
+
+// flowIDField is the field of a saved service ticket holding the flow ID it
+// was issued in
+const flowIDField = "flowID"
+
 // NewClientManager creates a new client manager
 func NewClientManager(fabricClient *fabric.Client, identity string) (*ClientManager, error) {
 	// Ensure client is connected
@@ -30,6 +47,12 @@ func NewClientManager(fabricClient *fabric.Client, identity string) (*ClientMana
 		return nil, errors.Wrap(err, "failed to connect to Fabric network")
 	}
 	
+	// Refuse to mix tickets from a ledger that has since been reset
+	if err := CheckLocalState(fabricClient); err != nil {
+		fabricClient.Close()
+		return nil, err
+	}
+	
 	// Get contracts
 	asContract, err := fabric.NewAuthServerContract(fabricClient)
 	if err != nil {
@@ -46,13 +69,29 @@ func NewClientManager(fabricClient *fabric.Client, identity string) (*ClientMana
 		asContract:   asContract,
 		tgsContract:  tgsContract,
 		identity:     identity,
+		progress:     progress.Nop(),
+		keyType:      crypto.KeyTypeRSA,
 	}, nil
 }
 
+// SetProgress sets the reporter used for multi-step operations
+func (cm *ClientManager) SetProgress(reporter progress.Reporter) {
+	if reporter == nil {
+		reporter = progress.Nop()
+	}
+	cm.progress = reporter
+}
+
+// SetKeyType sets the type of key pair RegisterClient generates for a client
+// without keys. The default is RSA.
+func (cm *ClientManager) SetKeyType(keyType crypto.KeyType) {
+	cm.keyType = keyType
+}
+
 // RegisterClient registers a new client with the Authentication Server
 func (cm *ClientManager) RegisterClient(clientID string) error {
 	// Generate or load client keys
-	_, _, err := crypto.LoadOrGenerateKeys(clientID)
+	_, err := crypto.LoadOrGenerateKeys(clientID, cm.keyType)
 	if err != nil {
 		return errors.Wrap(err, "failed to load or generate client keys")
 	}
@@ -73,18 +112,36 @@ func (cm *ClientManager) RegisterClient(clientID string) error {
 }
 
 // Authenticate performs the full authentication flow for a client
-func (cm *ClientManager) Authenticate(clientID, deviceID string) error {
+// If a step fails, artifacts issued by earlier steps are cleaned up.
+func (cm *ClientManager) Authenticate(clientID, deviceID string) (err error) {
 	log.Infof("Starting authentication flow for client %s to access device %s", clientID, deviceID)
 	
+	flow := NewFlow("authentication of " + clientID)
+	endFlow, err := flow.Trace(cm.fabricClient, "")
+	if err != nil {
+		return err
+	}
+	defer endFlow()
+	defer flow.compensateOnError(&err)
+	
 	// Step 1: Get nonce challenge from AS
 	log.Info("Step 1: Getting nonce challenge from Authentication Server...")
-	nonce, err := cm.asContract.GetNonceChallenge(clientID)
+	cm.progress.Set(0, "requesting nonce challenge")
+	challenge, err := cm.asContract.InitiateAuthentication(clientID, cm.sourceIP)
 	if err != nil {
 		return errors.Wrap(err, "failed to get nonce challenge")
 	}
+	if err := cm.handleRiskDecision(clientID, challenge.Risk); err != nil {
+		return err
+	}
+	if err := cm.handleTermsNotice(clientID, challenge.Terms); err != nil {
+		return err
+	}
+	nonce := challenge.Nonce
 	
 	// Step 2: Sign the nonce
 	log.Info("Step 2: Signing nonce with client's private key...")
+	cm.progress.Step("signing nonce")
 	signedNonce, err := crypto.SignNonce(clientID, nonce)
 	if err != nil {
 		return errors.Wrap(err, "failed to sign nonce")
@@ -92,17 +149,34 @@ func (cm *ClientManager) Authenticate(clientID, deviceID string) error {
 	
 	// Step 3: Verify client identity
 	log.Info("Step 3: Verifying client identity with Authentication Server...")
+	cm.progress.Step("verifying client identity")
 	if err := cm.asContract.VerifyClientIdentity(clientID, signedNonce); err != nil {
 		return errors.Wrap(err, "failed to verify client identity")
 	}
 	
 	// Step 4: Generate TGT
 	log.Info("Step 4: Getting Ticket Granting Ticket (TGT)...")
-	tgt, err := cm.asContract.GenerateTGT(clientID)
+	cm.progress.Step("requesting TGT")
+	tgt, err := cm.generateTGT(clientID)
 	if err != nil {
 		return errors.Wrap(err, "failed to generate TGT")
 	}
 	
+	// Check the TGT before saving it, so a bad response fails here rather
+	// than with a decryption error at the TGS
+	privateKey, err := crypto.LoadPrivateKey(clientID)
+	if err != nil {
+		return errors.Wrap(err, "failed to load private key")
+	}
+	if err := ticket.VerifyTGTWithKey(ticket.TGT{
+		EncryptedTGT:        tgt["encryptedTGT"],
+		EncryptedSessionKey: tgt["encryptedSessionKey"],
+		ExpiresAt:           tgt["expiresAt"],
+		Encryption:          tgt["encryption"],
+	}, privateKey, time.Now()); err != nil {
+		return errors.Wrap(err, "TGT verification failed")
+	}
+	
 	// Save TGT to file
 	tgtFile := clientID + "-tgt.json"
 	tgtJSON, err := json.Marshal(tgt)
@@ -112,48 +186,35 @@ func (cm *ClientManager) Authenticate(clientID, deviceID string) error {
 	if err := ioutil.WriteFile(tgtFile, tgtJSON, 0600); err != nil {
 		return errors.Wrap(err, "failed to save TGT to file")
 	}
+	flow.RecordFile(tgtFile)
 	
 	// Step 5: Generate Service Ticket
 	log.Info("Step 5: Getting Service Ticket from TGS...")
-	serviceID := "iotservice1" // Default service ID
-	
-	// Create authenticator (timestamp encrypted with session key)
-	// In a real implementation, this would be properly encrypted
-	// For now, we'll use a simpler approach
-	authenticator := Authenticator{
-		ClientID:  clientID,
-		Timestamp: time.Now().Unix(),
-	}
-	authenticatorJSON, err := json.Marshal(authenticator)
-	if err != nil {
-		return errors.Wrap(err, "failed to marshal authenticator")
-	}
-	
-	authenticatorB64 := base64.StdEncoding.EncodeToString(authenticatorJSON)
+	cm.progress.Step("requesting service ticket")
+	serviceID := DefaultServiceID
 	
 	// Create service ticket request
-	serviceTicketRequest := ServiceTicketRequest{
-		EncryptedTGT:  tgt["encryptedTGT"],
-		ClientID:      clientID,
-		ServiceID:     serviceID,
-		Authenticator: authenticatorB64,
-	}
-	
-	// Convert request to map for contract
-	requestMap := map[string]string{
-		"encryptedTGT":  serviceTicketRequest.EncryptedTGT,
-		"clientID":      serviceTicketRequest.ClientID,
-		"serviceID":     serviceTicketRequest.ServiceID,
-		"authenticator": serviceTicketRequest.Authenticator,
+	// The authenticator is a timestamp; in a real implementation it would be
+	// encrypted with the session key
+	serviceTicketRequest, err := ticket.NewServiceTicketRequest(ticket.TGT{
+		EncryptedTGT:        tgt["encryptedTGT"],
+		EncryptedSessionKey: tgt["encryptedSessionKey"],
+		ExpiresAt:           tgt["expiresAt"],
+	}, clientID, serviceID, time.Now())
+	if err != nil {
+		return errors.Wrap(err, "failed to create service ticket request")
 	}
+	requestMap := serviceTicketRequest.Map()
 	
 	// Get service ticket
 	serviceTicket, err := cm.tgsContract.GenerateServiceTicket(requestMap)
 	if err != nil {
 		return errors.Wrap(err, "failed to generate service ticket")
 	}
+	flow.RecordServiceTicket(cm.tgsContract, clientID, serviceID, serviceTicket["encryptedServiceTicket"])
 	
-	// Save service ticket to file
+	// Save service ticket to file, with the flow ID for AccessDevice to continue
+	serviceTicket[flowIDField] = cm.fabricClient.FlowID()
 	serviceTicketFile := clientID + "-serviceticket-" + deviceID + ".json"
 	serviceTicketJSON, err := json.Marshal(serviceTicket)
 	if err != nil {
@@ -162,11 +223,53 @@ func (cm *ClientManager) Authenticate(clientID, deviceID string) error {
 	if err := ioutil.WriteFile(serviceTicketFile, serviceTicketJSON, 0600); err != nil {
 		return errors.Wrap(err, "failed to save service ticket to file")
 	}
+	cm.progress.Step("service ticket saved")
 	
 	log.Infof("Authentication successful! Service ticket saved to %s", serviceTicketFile)
 	return nil
 }
 
+// RequestServiceTickets exchanges the client's saved TGT for tickets to
+// several services in one TGS round trip. Each ticket is saved as
+// <clientID>-serviceticket-<serviceID>.json; the saved file names are
+// returned keyed by service ID.
+func (cm *ClientManager) RequestServiceTickets(clientID string, serviceIDs []string) (map[string]string, error) {
+	tgt, err := cm.GetTGT(clientID)
+	if err != nil {
+		return nil, err
+	}
+	
+	request, err := ticket.NewMultiServiceTicketRequest(ticket.TGT{
+		EncryptedTGT:        tgt["encryptedTGT"],
+		EncryptedSessionKey: tgt["encryptedSessionKey"],
+	}, clientID, serviceIDs, time.Now())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create service ticket request")
+	}
+	
+	serviceTickets, err := cm.tgsContract.GenerateServiceTickets(request)
+	if err != nil {
+		return nil, err
+	}
+	
+	files := make(map[string]string, len(serviceTickets))
+	for serviceID, serviceTicket := range serviceTickets {
+		serviceTicketJSON, err := json.Marshal(serviceTicket)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to marshal service ticket")
+		}
+		
+		serviceTicketFile := clientID + "-serviceticket-" + serviceID + ".json"
+		if err := ioutil.WriteFile(serviceTicketFile, serviceTicketJSON, 0600); err != nil {
+			return nil, errors.Wrap(err, "failed to save service ticket to file")
+		}
+		files[serviceID] = serviceTicketFile
+	}
+	
+	log.Infof("Obtained %d service tickets for client %s", len(files), clientID)
+	return files, nil
+}
+
 // GetTGT retrieves a saved TGT for a client
 func (cm *ClientManager) GetTGT(clientID string) (map[string]string, error) {
 	tgtFile := clientID + "-tgt.json"
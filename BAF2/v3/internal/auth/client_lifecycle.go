@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/chaichis-network/v3/internal/crypto"
+	"github.com/pkg/errors"
+)
+
+// stagedKeySuffix names the key pair a rotation generates until the AS has
+// accepted it
+const stagedKeySuffix = ".next"
+
+// DeregisterClient removes the client's registration from the AS, which
+// also makes the TGS refuse its TGTs. The client's keys and its saved TGT
+// and service tickets are then deleted.
+func (cm *ClientManager) DeregisterClient(clientID string) error {
+	privateKey, err := crypto.LoadPrivateKey(clientID)
+	if err != nil {
+		return errors.Wrap(err, "failed to load client's private key")
+	}
+	timestamp := time.Now().Unix()
+	signature, err := crypto.SignData(privateKey, []byte(fmt.Sprintf("DEREGISTER|%s|%d", clientID, timestamp)))
+	if err != nil {
+		return errors.Wrap(err, "failed to sign deregistration")
+	}
+	if err := cm.asContract.DeregisterClient(clientID, timestamp, signature); err != nil {
+		return err
+	}
+
+	if err := removeClientArtifacts(clientID); err != nil {
+		return errors.Wrap(err, "client deregistered but its local tickets were not removed")
+	}
+	if err := crypto.RemoveKeys(clientID); err != nil {
+		return errors.Wrap(err, "client deregistered but its keys were not removed")
+	}
+	log.Infof("Client %s deregistered", clientID)
+	return nil
+}
+
+// RotateClientKey replaces the client's key pair with a new one of keyType,
+// or of the current key's type if keyType is empty. The new pair is
+// generated under <clientID>.next and replaces the current one once the AS
+// has accepted it. The TGS then refuses the client's earlier TGTs, so the
+// saved TGT and service tickets are deleted; authenticate again afterwards.
+func (cm *ClientManager) RotateClientKey(clientID string, keyType crypto.KeyType) (map[string]interface{}, error) {
+	privateKey, err := crypto.LoadPrivateKey(clientID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load client's private key")
+	}
+	if keyType == "" {
+		if keyType, err = crypto.StoredKeyType(clientID); err != nil {
+			return nil, errors.Wrap(err, "failed to read client's key type")
+		}
+	}
+
+	stagedID := clientID + stagedKeySuffix
+	if err := crypto.RemoveKeys(stagedID); err != nil {
+		return nil, errors.Wrap(err, "failed to remove a previously staged key")
+	}
+	if _, err := crypto.LoadOrGenerateKeys(stagedID, keyType); err != nil {
+		return nil, errors.Wrap(err, "failed to generate new client keys")
+	}
+	newPublicKeyPEM, err := crypto.GetPublicKeyPEM(stagedID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get new public key PEM")
+	}
+
+	timestamp := time.Now().Unix()
+	message := fmt.Sprintf("ROTATE_KEY|%s|%x|%d", clientID, sha256.Sum256([]byte(newPublicKeyPEM)), timestamp)
+	signature, err := crypto.SignData(privateKey, []byte(message))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to sign key rotation")
+	}
+	client, err := cm.asContract.RotateClientKey(clientID, newPublicKeyPEM, timestamp, signature)
+	if err != nil {
+		crypto.RemoveKeys(stagedID)
+		return nil, err
+	}
+
+	if err := crypto.ReplaceKeys(stagedID, clientID); err != nil {
+		return nil, errors.Wrapf(err, "key rotated at the AS but not locally; the new key is under %s", stagedID)
+	}
+	if err := removeClientArtifacts(clientID); err != nil {
+		return nil, errors.Wrap(err, "key rotated but the client's old tickets were not removed")
+	}
+	log.Infof("Key of client %s rotated", clientID)
+	return client, nil
+}
+
+// removeClientArtifacts deletes the TGT and service tickets saved for a
+// client in the working directory
+func removeClientArtifacts(clientID string) error {
+	artifacts := []string{clientID + "-tgt.json"}
+	tickets, err := filepath.Glob(clientID + "-serviceticket-*.json")
+	if err != nil {
+		return err
+	}
+	return RemoveLocalArtifacts(append(artifacts, tickets...))
+}
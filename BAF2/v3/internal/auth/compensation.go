@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"os"
+	"strings"
+
+	"github.com/chaichis-network/v3/internal/fabric"
+	"github.com/pkg/errors"
+)
+
+// compensation undoes a single artifact issued during a flow
+type compensation struct {
+	description string
+	undo        func() error
+}
+
+// Flow records the artifacts issued during an authentication flow (local
+// files, ledger tickets, sessions) so they can be cleaned up if a later
+// step fails. Compensations run in reverse order of recording.
+type Flow struct {
+	name    string
+	actions []compensation
+}
+
+// NewFlow creates a new flow recorder
+func NewFlow(name string) *Flow {
+	return &Flow{name: name}
+}
+
+// Record registers an undo action for an artifact issued by the flow
+func (f *Flow) Record(description string, undo func() error) {
+	f.actions = append(f.actions, compensation{description: description, undo: undo})
+}
+
+// RecordFile registers a local file to be removed on failure
+func (f *Flow) RecordFile(path string) {
+	f.Record("remove "+path, func() error {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	})
+}
+
+// Trace tags the flow's ledger transactions with the client's flow ID,
+// unless the caller set one continuing flowID or starting a new flow, and
+// returns a function ending the flow. Deferred before compensateOnError,
+// the compensations run under the same flow ID.
+func (f *Flow) Trace(client *fabric.Client, flowID string) (func(), error) {
+	end, err := client.BeginFlow(flowID)
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("Flow ID of %s: %s", f.name, client.FlowID())
+	return end, nil
+}
+
+// RecordServiceTicket registers an issued service ticket to be revoked on failure
+func (f *Flow) RecordServiceTicket(tgsContract *fabric.TicketGrantingContract, clientID, serviceID, encryptedServiceTicket string) {
+	f.Record("revoke service ticket for "+clientID+"/"+serviceID, func() error {
+		return tgsContract.RevokeServiceTicket(clientID, serviceID, encryptedServiceTicket)
+	})
+}
+
+// RecordSession registers an established session to be closed on failure
+func (f *Flow) RecordSession(isvContract *fabric.ISVContract, sessionID string) {
+	f.Record("close session "+sessionID, func() error {
+		return isvContract.CloseSession(sessionID)
+	})
+}
+
+// Compensate runs all recorded undo actions in reverse order. Every action
+// is attempted even if earlier ones fail; failures are collected into the
+// returned error.
+func (f *Flow) Compensate() error {
+	var failures []string
+	for i := len(f.actions) - 1; i >= 0; i-- {
+		action := f.actions[i]
+		log.Infof("Compensating %s: %s", f.name, action.description)
+		if err := action.undo(); err != nil {
+			log.Warnf("Compensation failed (%s): %v", action.description, err)
+			failures = append(failures, action.description+": "+err.Error())
+		}
+	}
+	f.actions = nil
+
+	if len(failures) > 0 {
+		return errors.Errorf("%d compensation action(s) failed: %s", len(failures), strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// compensateOnError runs the flow's compensations when *errp is non-nil.
+// Intended to be deferred with the function's named error result.
+func (f *Flow) compensateOnError(errp *error) {
+	if *errp == nil {
+		return
+	}
+	if cerr := f.Compensate(); cerr != nil {
+		*errp = errors.Wrapf(*errp, "compensation incomplete (%v)", cerr)
+	}
+}
@@ -0,0 +1,135 @@
+package auth
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/chaichis-network/v3/internal/fabric"
+)
+
+// Dashboard is an overview of a network for operators of small
+// deployments: its devices and their active sessions, recent anomalous
+// authentication attempts and clients with failed attempts. It is built
+// from the chaincodes' query functions, one query per client and device, so
+// it suits networks of up to a few hundred of each.
+type Dashboard struct {
+	GeneratedAt time.Time                `json:"generatedAt"`
+	Devices     []map[string]interface{} `json:"devices"`
+	Sessions    []map[string]interface{} `json:"sessions"`
+	// Anomalies are risk decisions other than allow, newest first
+	Anomalies []fabric.RiskDecision `json:"anomalies"`
+	// AuthFailures lists clients whose last authentication attempt followed
+	// failed ones, most failures first
+	AuthFailures []ClientAuthFailures `json:"authFailures"`
+	// Metrics are the operation counters of each chaincode that reports them
+	Metrics map[string]map[string]int64 `json:"metrics"`
+}
+
+// ClientAuthFailures is a client's failed authentication attempts in the
+// risk policy's failure window, as counted at its last attempt
+type ClientAuthFailures struct {
+	ClientID       string    `json:"clientID"`
+	RecentFailures int       `json:"recentFailures"`
+	LastAttempt    time.Time `json:"lastAttempt"`
+	LastAction     string    `json:"lastAction"`
+}
+
+// BuildDashboard reads a Dashboard from the network fabricClient is
+// connected to. At most maxEntries anomalies and failing clients are kept.
+func BuildDashboard(fabricClient *fabric.Client, maxEntries int) (*Dashboard, error) {
+	asContract, err := fabric.NewAuthServerContract(fabricClient)
+	if err != nil {
+		return nil, err
+	}
+	tgsContract, err := fabric.NewTicketGrantingContract(fabricClient)
+	if err != nil {
+		return nil, err
+	}
+	isvContract, err := fabric.NewISVContract(fabricClient)
+	if err != nil {
+		return nil, err
+	}
+
+	dashboard := &Dashboard{
+		GeneratedAt:  time.Now(),
+		Devices:      []map[string]interface{}{},
+		Sessions:     []map[string]interface{}{},
+		Anomalies:    []fabric.RiskDecision{},
+		AuthFailures: []ClientAuthFailures{},
+		Metrics:      map[string]map[string]int64{},
+	}
+
+	devices, err := isvContract.GetAllIoTDevices()
+	if err != nil {
+		return nil, err
+	}
+	dashboard.Devices = append(dashboard.Devices, devices...)
+	for _, device := range devices {
+		sessions, err := isvContract.GetActiveSessionsByDevice(fmt.Sprint(device["deviceID"]))
+		if err != nil {
+			return nil, err
+		}
+		dashboard.Sessions = append(dashboard.Sessions, sessions...)
+	}
+
+	clients, err := asContract.GetAllClientRegistrations()
+	if err != nil {
+		return nil, err
+	}
+	for _, client := range clients {
+		decisions, err := asContract.GetRiskDecisions(fmt.Sprint(client["id"]))
+		if err != nil {
+			return nil, err
+		}
+		var last *fabric.RiskDecision
+		for i, decision := range decisions {
+			if decision.Action != "allow" {
+				dashboard.Anomalies = append(dashboard.Anomalies, decision)
+			}
+			if last == nil || decision.Timestamp.After(last.Timestamp) {
+				last = &decisions[i]
+			}
+		}
+		if last != nil && last.RecentFailures > 0 {
+			dashboard.AuthFailures = append(dashboard.AuthFailures, ClientAuthFailures{
+				ClientID:       last.ClientID,
+				RecentFailures: last.RecentFailures,
+				LastAttempt:    last.Timestamp,
+				LastAction:     last.Action,
+			})
+		}
+	}
+	sort.SliceStable(dashboard.Anomalies, func(i, j int) bool {
+		return dashboard.Anomalies[i].Timestamp.After(dashboard.Anomalies[j].Timestamp)
+	})
+	sort.SliceStable(dashboard.AuthFailures, func(i, j int) bool {
+		return dashboard.AuthFailures[i].RecentFailures > dashboard.AuthFailures[j].RecentFailures
+	})
+	if len(dashboard.Anomalies) > maxEntries {
+		dashboard.Anomalies = dashboard.Anomalies[:maxEntries]
+	}
+	if len(dashboard.AuthFailures) > maxEntries {
+		dashboard.AuthFailures = dashboard.AuthFailures[:maxEntries]
+	}
+
+	sources := []struct {
+		name  string
+		fetch func() (map[string]int64, error)
+	}{
+		{"as", asContract.GetMetrics},
+		{"tgs", tgsContract.GetMetrics},
+		{"isv", isvContract.GetMetrics},
+	}
+	for _, source := range sources {
+		metrics, err := source.fetch()
+		if err != nil {
+			// Older chaincode versions don't expose metrics; report the rest
+			log.Warnf("Failed to get %s metrics: %v", source.name, err)
+			continue
+		}
+		dashboard.Metrics[source.name] = metrics
+	}
+
+	return dashboard, nil
+}
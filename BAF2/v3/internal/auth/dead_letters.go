@@ -0,0 +1,328 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// An event a sink could not take is not dropped: it is kept in a dead-letter
+// queue, a directory with one JSON file per event, and retried with a growing
+// delay. After DeadLetterOptions.MaxAttempts failed deliveries it is
+// quarantined and only delivered again when an operator replays it
+// (authcli dead-letters replay). The queue survives restarts, and its lock
+// file lets authgrpc and authcli share it.
+
+// DefaultDeadLetterDir is the default dead-letter directory in the working
+// directory
+const DefaultDeadLetterDir = "dead-letters"
+
+// Defaults of DeadLetterOptions
+const (
+	DefaultDeadLetterAttempts = 8
+	DefaultDeadLetterBackoff  = 30 * time.Second
+	DefaultDeadLetterMaxDelay = time.Hour
+)
+
+// deadLetterLockFile is the lock file in a dead-letter directory
+const deadLetterLockFile = ".lock"
+
+// errSkipDelivery tells Deliver to leave a letter as it is
+var errSkipDelivery = errors.New("delivery skipped")
+
+// DeadLetter is an event that could not be delivered to a sink
+type DeadLetter struct {
+	ID            string          `json:"id"`
+	Sink          string          `json:"sink"` // e.g. the webhook URL
+	Event         json.RawMessage `json:"event"`
+	Attempts      int             `json:"attempts"`
+	FirstFailedAt time.Time       `json:"firstFailedAt"`
+	LastFailedAt  time.Time       `json:"lastFailedAt"`
+	LastError     string          `json:"lastError"`
+	NextAttemptAt time.Time       `json:"nextAttemptAt,omitempty"` // Zero once quarantined
+	Quarantined   bool            `json:"quarantined"`
+}
+
+// DeadLetterOptions configures the retries of a dead-letter queue
+type DeadLetterOptions struct {
+	// MaxAttempts is how many failed deliveries, the first included, quarantine
+	// an event (default: DefaultDeadLetterAttempts)
+	MaxAttempts int
+	// Backoff is the delay before the first retry, doubled for each retry
+	// after it (default: DefaultDeadLetterBackoff)
+	Backoff time.Duration
+	// MaxDelay caps the delay between retries (default:
+	// DefaultDeadLetterMaxDelay)
+	MaxDelay time.Duration
+
+	now func() time.Time
+}
+
+// DeadLetterQueue keeps the events sinks failed to take. It is safe for
+// concurrent use by goroutines and by processes sharing the directory.
+type DeadLetterQueue struct {
+	dir     string
+	options DeadLetterOptions
+	mu      sync.Mutex
+}
+
+// OpenDeadLetterQueue opens the dead-letter directory dir,
+// DefaultDeadLetterDir if empty, creating it if needed
+func OpenDeadLetterQueue(dir string, options DeadLetterOptions) (*DeadLetterQueue, error) {
+	if dir == "" {
+		dir = DefaultDeadLetterDir
+	}
+	if options.MaxAttempts <= 0 {
+		options.MaxAttempts = DefaultDeadLetterAttempts
+	}
+	if options.Backoff <= 0 {
+		options.Backoff = DefaultDeadLetterBackoff
+	}
+	if options.MaxDelay <= 0 {
+		options.MaxDelay = DefaultDeadLetterMaxDelay
+	}
+	if options.now == nil {
+		options.now = time.Now
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, errors.Wrap(err, "failed to create dead-letter directory")
+	}
+	return &DeadLetterQueue{dir: dir, options: options}, nil
+}
+
+// withLock runs fn holding the queue's lock
+func (q *DeadLetterQueue) withLock(fn func() error) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	lock, err := os.OpenFile(filepath.Join(q.dir, deadLetterLockFile), os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return errors.Wrap(err, "failed to open dead-letter lock")
+	}
+	defer lock.Close()
+	if err := lockFile(lock); err != nil {
+		return errors.Wrap(err, "failed to lock dead-letter directory")
+	}
+	defer unlockFile(lock)
+
+	return fn()
+}
+
+func (q *DeadLetterQueue) path(id string) string {
+	return filepath.Join(q.dir, id+".json")
+}
+
+func (q *DeadLetterQueue) write(letter *DeadLetter) error {
+	letterJSON, err := json.Marshal(letter)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal dead letter")
+	}
+	if err := writeFileAtomic(q.path(letter.ID), letterJSON, 0600); err != nil {
+		return errors.Wrapf(err, "failed to save dead letter %s", letter.ID)
+	}
+	return nil
+}
+
+func (q *DeadLetterQueue) read(id string) (*DeadLetter, error) {
+	if id == "" || strings.ContainsAny(id, `/\.`) {
+		return nil, errors.Errorf("invalid dead letter ID %q", id)
+	}
+	letterJSON, err := ioutil.ReadFile(q.path(id))
+	if os.IsNotExist(err) {
+		return nil, errors.Errorf("dead letter %s not found", id)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read dead letter %s", id)
+	}
+	var letter DeadLetter
+	if err := json.Unmarshal(letterJSON, &letter); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse dead letter %s", id)
+	}
+	return &letter, nil
+}
+
+// fail records a failed delivery of letter and schedules the next one, or
+// quarantines it after the last attempt
+func (q *DeadLetterQueue) fail(letter *DeadLetter, deliveryErr error) {
+	now := q.options.now()
+	letter.Attempts++
+	letter.LastFailedAt = now
+	letter.LastError = deliveryErr.Error()
+	if letter.FirstFailedAt.IsZero() {
+		letter.FirstFailedAt = now
+	}
+	if letter.Attempts >= q.options.MaxAttempts {
+		letter.Quarantined = true
+		letter.NextAttemptAt = time.Time{}
+		return
+	}
+
+	delay := q.options.Backoff
+	for i := 1; i < letter.Attempts && delay < q.options.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > q.options.MaxDelay {
+		delay = q.options.MaxDelay
+	}
+	letter.NextAttemptAt = now.Add(delay)
+}
+
+// Add queues an event whose first delivery to sink failed with deliveryErr
+func (q *DeadLetterQueue) Add(sink string, event []byte, deliveryErr error) (*DeadLetter, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, errors.Wrap(err, "failed to generate dead letter ID")
+	}
+	letter := &DeadLetter{
+		ID:    q.options.now().UTC().Format("20060102T150405") + "-" + hex.EncodeToString(id),
+		Sink:  sink,
+		Event: append(json.RawMessage(nil), event...),
+	}
+	q.fail(letter, deliveryErr)
+
+	err := q.withLock(func() error { return q.write(letter) })
+	if err != nil {
+		return nil, err
+	}
+	return letter, nil
+}
+
+// List returns the queued events, oldest first
+func (q *DeadLetterQueue) List() ([]*DeadLetter, error) {
+	var letters []*DeadLetter
+	err := q.withLock(func() error {
+		paths, err := filepath.Glob(filepath.Join(q.dir, "*.json"))
+		if err != nil {
+			return errors.Wrap(err, "failed to list dead letters")
+		}
+		for _, path := range paths {
+			letter, err := q.read(strings.TrimSuffix(filepath.Base(path), ".json"))
+			if err != nil {
+				log.Warnf("Skipping dead letter file %s: %v", path, err)
+				continue
+			}
+			letters = append(letters, letter)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(letters, func(i, j int) bool {
+		if !letters[i].FirstFailedAt.Equal(letters[j].FirstFailedAt) {
+			return letters[i].FirstFailedAt.Before(letters[j].FirstFailedAt)
+		}
+		return letters[i].ID < letters[j].ID
+	})
+	return letters, nil
+}
+
+// Get returns a queued event by its ID
+func (q *DeadLetterQueue) Get(id string) (*DeadLetter, error) {
+	var letter *DeadLetter
+	err := q.withLock(func() error {
+		var err error
+		letter, err = q.read(id)
+		return err
+	})
+	return letter, err
+}
+
+// Remove drops a queued event without delivering it
+func (q *DeadLetterQueue) Remove(id string) error {
+	return q.withLock(func() error {
+		if _, err := q.read(id); err != nil {
+			return err
+		}
+		if err := os.Remove(q.path(id)); err != nil {
+			return errors.Wrapf(err, "failed to remove dead letter %s", id)
+		}
+		return nil
+	})
+}
+
+// Deliver tries a queued event again: it is removed once deliver succeeds
+// and rescheduled, or quarantined, when it fails. deliver is called with
+// the queue locked, so another process never delivers the same event.
+func (q *DeadLetterQueue) Deliver(id string, deliver func(*DeadLetter) error) error {
+	return q.withLock(func() error {
+		letter, err := q.read(id)
+		if err != nil {
+			return err
+		}
+		deliveryErr := deliver(letter)
+		if deliveryErr == errSkipDelivery {
+			return deliveryErr
+		}
+		if deliveryErr == nil {
+			if err := os.Remove(q.path(id)); err != nil {
+				return errors.Wrapf(err, "failed to remove delivered dead letter %s", id)
+			}
+			return nil
+		}
+		q.fail(letter, deliveryErr)
+		if err := q.write(letter); err != nil {
+			return err
+		}
+		return deliveryErr
+	})
+}
+
+// Replay delivers a queued event now, quarantined or not. An event that
+// fails again gets a fresh round of retries.
+func (q *DeadLetterQueue) Replay(id string, deliver func(*DeadLetter) error) error {
+	err := q.withLock(func() error {
+		letter, err := q.read(id)
+		if err != nil {
+			return err
+		}
+		letter.Attempts = 0
+		letter.Quarantined = false
+		return q.write(letter)
+	})
+	if err != nil {
+		return err
+	}
+	return q.Deliver(id, deliver)
+}
+
+// RetryDue delivers each event whose retry is due and returns how many
+// were delivered. Quarantined events are left alone.
+func (q *DeadLetterQueue) RetryDue(deliver func(*DeadLetter) error) (int, error) {
+	letters, err := q.List()
+	if err != nil {
+		return 0, err
+	}
+	now := q.options.now()
+	delivered := 0
+	for _, letter := range letters {
+		if letter.Quarantined || letter.NextAttemptAt.After(now) {
+			continue
+		}
+		// A letter replayed or removed meanwhile by another process is
+		// not found, which is fine
+		err := q.Deliver(letter.ID, func(current *DeadLetter) error {
+			if current.Quarantined || current.NextAttemptAt.After(now) {
+				return errSkipDelivery
+			}
+			return deliver(current)
+		})
+		switch {
+		case err == nil:
+			delivered++
+		case err == errSkipDelivery:
+		default:
+			log.Debugf("Dead letter %s not delivered: %v", letter.ID, err)
+		}
+	}
+	return delivered, nil
+}
@@ -0,0 +1,183 @@
+package auth
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chaichis-network/v3/internal/fabric"
+)
+
+func TestDeadLetterQueueRetries(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	options := DeadLetterOptions{
+		MaxAttempts: 3,
+		Backoff:     time.Minute,
+		MaxDelay:    90 * time.Second,
+		now:         func() time.Time { return now },
+	}
+	dir := t.TempDir()
+	queue, err := OpenDeadLetterQueue(dir, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	letter, err := queue.Add("http://sink", []byte(`{"event":"AccessGranted"}`), errors.New("connection refused"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if letter.Attempts != 1 || letter.Quarantined || !letter.NextAttemptAt.Equal(now.Add(time.Minute)) {
+		t.Fatalf("queued letter %+v, want one attempt and a retry in a minute", letter)
+	}
+
+	failing := func(*DeadLetter) error { return errors.New("503") }
+	if delivered, err := queue.RetryDue(failing); err != nil || delivered != 0 {
+		t.Fatalf("RetryDue before the retry is due = %d, %v", delivered, err)
+	}
+	if got, _ := queue.Get(letter.ID); got.Attempts != 1 {
+		t.Fatalf("letter tried before its retry was due: %+v", got)
+	}
+
+	// The second failure doubles the delay, up to MaxDelay
+	now = now.Add(time.Minute)
+	if _, err := queue.RetryDue(failing); err != nil {
+		t.Fatal(err)
+	}
+	got, err := queue.Get(letter.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Attempts != 2 || got.LastError != "503" || !got.NextAttemptAt.Equal(now.Add(90*time.Second)) {
+		t.Fatalf("letter after the second failure %+v, want a retry in 90s", got)
+	}
+
+	// The third failure quarantines it
+	now = now.Add(90 * time.Second)
+	if _, err := queue.RetryDue(failing); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ = queue.Get(letter.ID); !got.Quarantined || !got.NextAttemptAt.IsZero() {
+		t.Fatalf("letter after the last attempt %+v, want it quarantined", got)
+	}
+	now = now.Add(time.Hour)
+	tried := false
+	if _, err := queue.RetryDue(func(*DeadLetter) error { tried = true; return nil }); err != nil || tried {
+		t.Fatalf("quarantined letter retried (%v)", err)
+	}
+
+	// The queue survives a restart, and a replay delivers the letter
+	reopened, err := OpenDeadLetterQueue(dir, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var replayed *DeadLetter
+	if err := reopened.Replay(letter.ID, func(l *DeadLetter) error { replayed = l; return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if replayed == nil || replayed.Sink != "http://sink" || string(replayed.Event) != `{"event":"AccessGranted"}` {
+		t.Fatalf("replayed %+v", replayed)
+	}
+	letters, err := reopened.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(letters) != 0 {
+		t.Fatalf("%d letters left after the replay, want 0", len(letters))
+	}
+	if _, err := reopened.Get(letter.ID); err == nil {
+		t.Fatal("delivered letter still found")
+	}
+}
+
+func TestDeadLetterReplayFailure(t *testing.T) {
+	queue, err := OpenDeadLetterQueue(t.TempDir(), DeadLetterOptions{MaxAttempts: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	letter, err := queue.Add("http://sink", []byte(`{}`), errors.New("timeout"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !letter.Quarantined {
+		t.Fatalf("letter %+v not quarantined after its only attempt", letter)
+	}
+
+	if err := queue.Replay(letter.ID, func(*DeadLetter) error { return errors.New("still down") }); err == nil {
+		t.Fatal("failed replay reported as delivered")
+	}
+	got, err := queue.Get(letter.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Attempts != 1 || got.LastError != "still down" || !got.Quarantined {
+		t.Fatalf("letter after a failed replay %+v", got)
+	}
+
+	if err := queue.Remove(letter.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := queue.Remove(letter.ID); err == nil {
+		t.Fatal("removed letter removed again")
+	}
+	if _, err := queue.Get("../sessions"); err == nil {
+		t.Fatal("letter ID with a path accepted")
+	}
+}
+
+func TestEventForwarder(t *testing.T) {
+	var mu sync.Mutex
+	var received []string
+	up := false
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if !up {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		received = append(received, string(body))
+	}))
+	defer webhook.Close()
+
+	now := time.Unix(1700000000, 0)
+	queue, err := OpenDeadLetterQueue(t.TempDir(), DeadLetterOptions{now: func() time.Time { return now }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	forwarder := NewEventForwarder(webhook.URL, queue)
+
+	event := fabric.Event{Chaincode: "user-acl", Name: "AccessGranted", TxID: "tx1"}
+	forwarder.Forward(event)
+	letters, err := queue.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(letters) != 1 || letters[0].Sink != webhook.URL || letters[0].LastError != "webhook answered 503 Service Unavailable" {
+		t.Fatalf("dead letters after a refused event: %+v", letters)
+	}
+
+	mu.Lock()
+	up = true
+	mu.Unlock()
+	now = now.Add(DefaultDeadLetterBackoff)
+	forwarder.RetryDeadLetters()
+	forwarder.Forward(fabric.Event{Chaincode: "user-acl", Name: "AccessGranted", TxID: "tx2"})
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{
+		`{"chaincode":"user-acl","event":"AccessGranted","txID":"tx1","blockNumber":0}`,
+		`{"chaincode":"user-acl","event":"AccessGranted","txID":"tx2","blockNumber":0}`,
+	}
+	if len(received) != len(want) || received[0] != want[0] || received[1] != want[1] {
+		t.Fatalf("webhook received %q, want %q", received, want)
+	}
+	if letters, _ := queue.List(); len(letters) != 0 {
+		t.Fatalf("%d dead letters left after delivery, want 0", len(letters))
+	}
+}
@@ -16,6 +16,8 @@ type DeviceManager struct {
 	fabricClient *fabric.Client
 	isvContract  *fabric.ISVContract
 	identity     string
+	deviceCache  *deviceCache // nil unless EnableDeviceCache was called
+	keyType      crypto.KeyType
 }
 
 // NewDeviceManager creates a new device manager
@@ -25,6 +27,12 @@ func NewDeviceManager(fabricClient *fabric.Client, identity string) (*DeviceMana
 		return nil, errors.Wrap(err, "failed to connect to Fabric network")
 	}
 	
+	// Refuse to mix tickets from a ledger that has since been reset
+	if err := CheckLocalState(fabricClient); err != nil {
+		fabricClient.Close()
+		return nil, err
+	}
+	
 	// Get ISV contract
 	isvContract, err := fabric.NewISVContract(fabricClient)
 	if err != nil {
@@ -35,13 +43,20 @@ func NewDeviceManager(fabricClient *fabric.Client, identity string) (*DeviceMana
 		fabricClient: fabricClient,
 		isvContract:  isvContract,
 		identity:     identity,
+		keyType:      crypto.KeyTypeRSA,
 	}, nil
 }
 
+// SetKeyType sets the type of key pair generated for a device without keys
+// when it is registered. The default is RSA.
+func (dm *DeviceManager) SetKeyType(keyType crypto.KeyType) {
+	dm.keyType = keyType
+}
+
 // RegisterDevice registers a new IoT device with the ISV
 func (dm *DeviceManager) RegisterDevice(deviceID string, capabilities []string) error {
 	// Generate or load device keys
-	_, _, err := crypto.LoadOrGenerateKeys(deviceID)
+	_, err := crypto.LoadOrGenerateKeys(deviceID, dm.keyType)
 	if err != nil {
 		return errors.Wrap(err, "failed to load or generate device keys")
 	}
@@ -63,6 +78,14 @@ func (dm *DeviceManager) RegisterDevice(deviceID string, capabilities []string)
 
 // GetDeviceData gets information about a device
 func (dm *DeviceManager) GetDeviceData(deviceID string) (*IoTDevice, error) {
+	if dm.deviceCache != nil {
+		return dm.deviceCache.get(deviceID)
+	}
+	return dm.fetchDeviceData(deviceID)
+}
+
+// fetchDeviceData reads a device from the ledger
+func (dm *DeviceManager) fetchDeviceData(deviceID string) (*IoTDevice, error) {
 	// Get all devices
 	devices, err := dm.isvContract.GetAllIoTDevices()
 	if err != nil {
@@ -108,7 +131,9 @@ func (dm *DeviceManager) GetDeviceData(deviceID string) (*IoTDevice, error) {
 }
 
 // AccessDevice requests access to an IoT device
-func (dm *DeviceManager) AccessDevice(clientID, deviceID string) (*Session, error) {
+// If access cannot be established, the unused service ticket is revoked and
+// its local file removed so no stale artifacts remain.
+func (dm *DeviceManager) AccessDevice(clientID, deviceID string) (session *Session, err error) {
 	// Get service ticket
 	serviceTicket, err := (&ClientManager{
 		fabricClient: dm.fabricClient,
@@ -119,6 +144,30 @@ func (dm *DeviceManager) AccessDevice(clientID, deviceID string) (*Session, erro
 		return nil, errors.Wrap(err, "failed to get service ticket")
 	}
 	
+	// Continue the flow the service ticket was issued in
+	flow := NewFlow("access of " + clientID + " to " + deviceID)
+	endFlow, err := flow.Trace(dm.fabricClient, serviceTicket[flowIDField])
+	if err != nil {
+		return nil, err
+	}
+	defer endFlow()
+	
+	// From here on, a failure leaves the service ticket unused
+	defer flow.compensateOnError(&err)
+	
+	tgsContract, err := fabric.NewTicketGrantingContract(dm.fabricClient)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get TGS contract")
+	}
+	flow.RecordFile(clientID + "-serviceticket-" + deviceID + ".json")
+	flow.RecordServiceTicket(tgsContract, clientID, DefaultServiceID, serviceTicket["encryptedServiceTicket"])
+	
+	// Ask the ISV to prove its identity with the ticket's session key
+	authenticator, err := dm.newServiceAuthenticator(clientID, serviceTicket)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create authenticator")
+	}
+	
 	// Create service request
 	serviceRequest := ServiceRequest{
 		EncryptedServiceTicket: serviceTicket["encryptedServiceTicket"],
@@ -136,6 +185,7 @@ func (dm *DeviceManager) AccessDevice(clientID, deviceID string) (*Session, erro
 		"requestType":            serviceRequest.RequestType,
 		"encryptedData":          serviceRequest.EncryptedData,
 	}
+	authenticator.addTo(requestMap)
 	
 	// Process service request
 	response, err := dm.isvContract.ProcessServiceRequest(requestMap)
@@ -145,11 +195,17 @@ func (dm *DeviceManager) AccessDevice(clientID, deviceID string) (*Session, erro
 	
 	// Check status
 	if response["status"] != "granted" {
-		return nil, errors.Errorf("access denied: %s", response["status"])
+		return nil, serviceDeniedError(response)
+	}
+	flow.RecordSession(dm.isvContract, response["sessionID"])
+	
+	// Check the ISV's reply; a rogue ISV's session is closed again
+	if err := authenticator.verify(response); err != nil {
+		return nil, err
 	}
 	
 	// Create session
-	session := &Session{
+	session = &Session{
 		SessionID: response["sessionID"],
 		ClientID:  clientID,
 		DeviceID:  deviceID,
@@ -0,0 +1,221 @@
+package auth
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DeviceCacheOptions tunes the device cache of a long-running process such
+// as a gateway. Zero fields use the defaults below.
+type DeviceCacheOptions struct {
+	// TTL is how long a record is served without asking the ledger
+	TTL time.Duration
+	// MaxStale is how much longer an expired or invalidated record is still
+	// served while it is refreshed in the background
+	MaxStale time.Duration
+}
+
+const (
+	defaultDeviceCacheTTL      = 30 * time.Second
+	defaultDeviceCacheMaxStale = 5 * time.Minute
+)
+
+// DeviceCacheStats counts how device lookups were served
+type DeviceCacheStats struct {
+	Hits          int64 `json:"hits"`
+	StaleHits     int64 `json:"staleHits"` // Served stale while refreshing
+	Misses        int64 `json:"misses"`
+	Refreshes     int64 `json:"refreshes"`
+	RefreshErrors int64 `json:"refreshErrors"`
+	Invalidations int64 `json:"invalidations"`
+}
+
+// HitRate is the share of lookups served from the cache, stale or not
+func (s DeviceCacheStats) HitRate() float64 {
+	lookups := s.Hits + s.StaleHits + s.Misses
+	if lookups == 0 {
+		return 0
+	}
+	return float64(s.Hits+s.StaleHits) / float64(lookups)
+}
+
+type deviceCacheEntry struct {
+	device      *IoTDevice
+	fetchedAt   time.Time
+	invalidated bool
+}
+
+// deviceCache is a read-through cache of device records. Records expire
+// after the TTL or when an ISV event says the device changed; an expired
+// record is served for up to MaxStale more while it is refreshed, except
+// for revoked devices, which are dropped at once.
+type deviceCache struct {
+	options DeviceCacheOptions
+	load    func(deviceID string) (*IoTDevice, error)
+	now     func() time.Time
+
+	mu         sync.Mutex
+	entries    map[string]*deviceCacheEntry
+	refreshing map[string]bool
+	stats      DeviceCacheStats
+}
+
+func newDeviceCache(options DeviceCacheOptions, load func(string) (*IoTDevice, error)) *deviceCache {
+	if options.TTL <= 0 {
+		options.TTL = defaultDeviceCacheTTL
+	}
+	if options.MaxStale <= 0 {
+		options.MaxStale = defaultDeviceCacheMaxStale
+	}
+	return &deviceCache{
+		options:    options,
+		load:       load,
+		now:        time.Now,
+		entries:    map[string]*deviceCacheEntry{},
+		refreshing: map[string]bool{},
+	}
+}
+
+// get returns a device, from the cache if it may be served
+func (c *deviceCache) get(deviceID string) (*IoTDevice, error) {
+	c.mu.Lock()
+	if entry, ok := c.entries[deviceID]; ok {
+		age := c.now().Sub(entry.fetchedAt)
+		if !entry.invalidated && age < c.options.TTL {
+			c.stats.Hits++
+			device := copyDevice(entry.device)
+			c.mu.Unlock()
+			return device, nil
+		}
+		if age < c.options.TTL+c.options.MaxStale {
+			c.stats.StaleHits++
+			device := copyDevice(entry.device)
+			if !c.refreshing[deviceID] {
+				c.refreshing[deviceID] = true
+				go c.refresh(deviceID)
+			}
+			c.mu.Unlock()
+			return device, nil
+		}
+	}
+	c.stats.Misses++
+	c.mu.Unlock()
+
+	device, err := c.load(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	c.store(deviceID, device)
+	return copyDevice(device), nil
+}
+
+// refresh reloads a stale record in the background. On failure the stale
+// record stays until it is too old to serve.
+func (c *deviceCache) refresh(deviceID string) {
+	device, err := c.load(deviceID)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.refreshing, deviceID)
+	if err != nil {
+		c.stats.RefreshErrors++
+		log.Warnf("Failed to refresh cached device %s: %v", deviceID, err)
+		return
+	}
+	c.entries[deviceID] = &deviceCacheEntry{device: copyDevice(device), fetchedAt: c.now()}
+	c.stats.Refreshes++
+}
+
+func (c *deviceCache) store(deviceID string, device *IoTDevice) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[deviceID] = &deviceCacheEntry{device: copyDevice(device), fetchedAt: c.now()}
+}
+
+// invalidate marks devices as changed. Dropped devices are removed, so the
+// next lookup goes to the ledger instead of serving the old record.
+func (c *deviceCache) invalidate(deviceIDs []string, drop bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, deviceID := range deviceIDs {
+		entry, ok := c.entries[deviceID]
+		if !ok {
+			continue
+		}
+		c.stats.Invalidations++
+		if drop {
+			delete(c.entries, deviceID)
+		} else {
+			entry.invalidated = true
+		}
+	}
+}
+
+// clear drops every record
+func (c *deviceCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = map[string]*deviceCacheEntry{}
+}
+
+func (c *deviceCache) snapshotStats() DeviceCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+func copyDevice(device *IoTDevice) *IoTDevice {
+	copied := *device
+	copied.Capabilities = append([]string(nil), device.Capabilities...)
+	return &copied
+}
+
+// EnableDeviceCache makes GetDeviceData read through a cache that is
+// invalidated by the ISV's device events. It is meant for long-running
+// processes that look devices up repeatedly. The returned function stops
+// watching the events and turns the cache off again.
+func (dm *DeviceManager) EnableDeviceCache(options DeviceCacheOptions) (func(), error) {
+	if dm.deviceCache != nil {
+		return nil, errors.New("device cache is already enabled")
+	}
+
+	changes, cancel, err := dm.isvContract.WatchDeviceChanges()
+	if err != nil {
+		return nil, err
+	}
+	cache := newDeviceCache(options, dm.fetchDeviceData)
+	go func() {
+		for change := range changes {
+			cache.invalidate(change.DeviceIDs, dropsDevice(change.Event))
+		}
+	}()
+
+	dm.deviceCache = cache
+	log.Infof("Device cache enabled (TTL %s, max stale %s)", cache.options.TTL, cache.options.MaxStale)
+	return func() {
+		cancel()
+		dm.deviceCache = nil
+		cache.clear()
+	}, nil
+}
+
+// dropsDevice reports whether a device change event takes the device out of
+// service or deletes it, so its cached record must not be served while stale
+func dropsDevice(event string) bool {
+	switch event {
+	case "DevicesRevoked", "DeviceDecommissioned", "DeviceDeregistered":
+		return true
+	}
+	return false
+}
+
+// DeviceCacheStats returns the device cache counters; they are zero when
+// the cache is not enabled
+func (dm *DeviceManager) DeviceCacheStats() DeviceCacheStats {
+	if dm.deviceCache == nil {
+		return DeviceCacheStats{}
+	}
+	return dm.deviceCache.snapshotStats()
+}
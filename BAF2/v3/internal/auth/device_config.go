@@ -0,0 +1,157 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+
+	"github.com/chaichis-network/v3/internal/crypto"
+	"github.com/pkg/errors"
+)
+
+// DeviceConfig is a configuration published to a device through the ledger
+type DeviceConfig struct {
+	DeviceID     string          `json:"deviceID"`
+	Version      int64           `json:"version"`
+	Config       json.RawMessage `json:"config"`
+	ConfigHash   string          `json:"configHash"`
+	UpdatedAt    string          `json:"updatedAt"`
+	AckedVersion int64           `json:"ackedVersion"`
+	AckStatus    string          `json:"ackStatus,omitempty"`
+	AckMessage   string          `json:"ackMessage,omitempty"`
+	AckedAt      string          `json:"ackedAt,omitempty"`
+}
+
+// ConfigApplier applies a config on the device; returning an error makes the
+// agent acknowledge the version as rejected
+type ConfigApplier func(config *DeviceConfig) error
+
+// SetDeviceConfig publishes a new config version for a device. The config is
+// signed with the device's private key; versions must increase.
+func (dm *DeviceManager) SetDeviceConfig(deviceID string, configJSON []byte, version int64) error {
+	if !json.Valid(configJSON) {
+		return errors.New("device config must be a JSON document")
+	}
+
+	privateKey, err := crypto.LoadPrivateKey(deviceID)
+	if err != nil {
+		return errors.Wrap(err, "failed to load device private key")
+	}
+
+	// Must match configMessage in the ISV chaincode
+	message := fmt.Sprintf("CONFIG|%s|%d|%x", deviceID, version, sha256.Sum256(configJSON))
+	signature, err := crypto.SignData(privateKey, []byte(message))
+	if err != nil {
+		return errors.Wrap(err, "failed to sign device config")
+	}
+
+	if err := dm.isvContract.SetDeviceConfig(deviceID, string(configJSON), version, signature); err != nil {
+		return err
+	}
+
+	log.Infof("Published config version %d for device %s", version, deviceID)
+	return nil
+}
+
+// GetDeviceConfig retrieves the current config of a device
+func (dm *DeviceManager) GetDeviceConfig(deviceID string) (*DeviceConfig, error) {
+	record, err := dm.isvContract.GetDeviceConfig(deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	// The chaincode stores the config document as a string
+	recordJSON, err := json.Marshal(record)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal device config")
+	}
+	var stored struct {
+		DeviceConfig
+		Config string `json:"config"`
+	}
+	if err := json.Unmarshal(recordJSON, &stored); err != nil {
+		return nil, errors.Wrap(err, "failed to parse device config")
+	}
+
+	config := stored.DeviceConfig
+	config.Config = json.RawMessage(stored.Config)
+	if fmt.Sprintf("%x", sha256.Sum256(config.Config)) != config.ConfigHash {
+		return nil, errors.Errorf("config for device %s does not match its recorded hash", deviceID)
+	}
+	return &config, nil
+}
+
+// AckDeviceConfig acknowledges a config version as the device agent
+func (dm *DeviceManager) AckDeviceConfig(deviceID string, version int64, applyErr error) error {
+	status, message := "applied", ""
+	if applyErr != nil {
+		status, message = "rejected", applyErr.Error()
+	}
+
+	privateKey, err := crypto.LoadPrivateKey(deviceID)
+	if err != nil {
+		return errors.Wrap(err, "failed to load device private key")
+	}
+
+	// Must match configAckMessage in the ISV chaincode
+	signature, err := crypto.SignData(privateKey, []byte(fmt.Sprintf("CONFIG_ACK|%s|%d|%s", deviceID, version, status)))
+	if err != nil {
+		return errors.Wrap(err, "failed to sign config acknowledgement")
+	}
+
+	return dm.isvContract.AckDeviceConfig(deviceID, version, status, message, signature)
+}
+
+// WatchDeviceConfig runs the device agent side of config distribution: it
+// applies the current config if it has not been acknowledged yet, then
+// applies and acknowledges every new version until stop is closed.
+func (dm *DeviceManager) WatchDeviceConfig(deviceID string, apply ConfigApplier, stop <-chan struct{}) error {
+	changes, cancel, err := dm.isvContract.WatchConfigChanges(deviceID)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	// Catch up on a change published while the agent was offline
+	if config, err := dm.GetDeviceConfig(deviceID); err == nil && config.AckedVersion < config.Version {
+		if err := dm.applyConfig(config, apply); err != nil {
+			return err
+		}
+	}
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		case change, ok := <-changes:
+			if !ok {
+				return errors.New("config event stream closed")
+			}
+			log.Infof("Config version %d published for device %s (block %d)", change.Version, deviceID, change.BlockNumber)
+
+			config, err := dm.GetDeviceConfig(deviceID)
+			if err != nil {
+				log.Warnf("Failed to fetch config version %d: %v", change.Version, err)
+				continue
+			}
+			// A newer version may already have superseded this event
+			if config.Version != change.Version {
+				continue
+			}
+			if err := dm.applyConfig(config, apply); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (dm *DeviceManager) applyConfig(config *DeviceConfig, apply ConfigApplier) error {
+	applyErr := apply(config)
+	if applyErr != nil {
+		log.Warnf("Rejecting config version %d: %v", config.Version, applyErr)
+	}
+	if err := dm.AckDeviceConfig(config.DeviceID, config.Version, applyErr); err != nil {
+		return errors.Wrapf(err, "failed to acknowledge config version %d", config.Version)
+	}
+	return nil
+}
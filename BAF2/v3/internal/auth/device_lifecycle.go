@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"github.com/chaichis-network/v3/internal/crypto"
+	"github.com/chaichis-network/v3/internal/fabric"
+	"github.com/pkg/errors"
+)
+
+// DecommissionDevice takes a device out of service. The ISV closes its
+// sessions and refuses new ones until the device is reactivated.
+func (dm *DeviceManager) DecommissionDevice(deviceID, reason string) (*fabric.DeviceLifecycleResult, error) {
+	result, err := dm.isvContract.DecommissionDevice(deviceID, reason)
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("Device %s decommissioned, %d sessions closed", deviceID, len(result.ClosedSessions))
+	return result, nil
+}
+
+// ReactivateDevice puts a decommissioned device back in service
+func (dm *DeviceManager) ReactivateDevice(deviceID string) (*fabric.DeviceLifecycleResult, error) {
+	result, err := dm.isvContract.ReactivateDevice(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("Device %s reactivated", deviceID)
+	return result, nil
+}
+
+// DeregisterDevice deletes a device from the ISV and its keys from the
+// working directory. With decommission set, a device still in service is
+// decommissioned first, in a transaction of its own; otherwise it must be
+// decommissioned or revoked already.
+func (dm *DeviceManager) DeregisterDevice(deviceID, reason string, decommission bool) (*fabric.DeviceLifecycleResult, error) {
+	var closed []string
+	if decommission {
+		device, err := dm.fetchDeviceData(deviceID)
+		if err != nil {
+			return nil, err
+		}
+		if device.Status != "decommissioned" && device.Status != "revoked" {
+			result, err := dm.DecommissionDevice(deviceID, reason)
+			if err != nil {
+				return nil, err
+			}
+			closed = result.ClosedSessions
+		}
+	}
+
+	result, err := dm.isvContract.DeregisterIoTDevice(deviceID, reason)
+	if err != nil {
+		return nil, err
+	}
+	result.ClosedSessions = append(closed, result.ClosedSessions...)
+	if err := crypto.RemoveKeys(deviceID); err != nil {
+		return nil, errors.Wrap(err, "device deregistered but its keys were not removed")
+	}
+	log.Infof("Device %s deregistered", deviceID)
+	return result, nil
+}
@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/chaichis-network/v3/internal/fabric"
+	"github.com/pkg/errors"
+)
+
+// eventDeliveryTimeout bounds one post of an event to a webhook
+const eventDeliveryTimeout = 10 * time.Second
+
+// deadLetterRetryInterval is how often an EventForwarder looks for dead
+// letters whose retry is due
+const deadLetterRetryInterval = 5 * time.Second
+
+// EventForwarder posts chaincode events to a webhook, such as the HTTP
+// collector of a SIEM, one JSON event per request. Events the webhook does
+// not take with a 2xx answer go to a dead-letter queue and are retried from
+// there, so they arrive late and possibly out of order, but are not lost.
+type EventForwarder struct {
+	url         string
+	httpClient  *http.Client
+	deadLetters *DeadLetterQueue
+}
+
+// NewEventForwarder creates a forwarder to the webhook at url that keeps
+// the events it fails to deliver in deadLetters
+func NewEventForwarder(url string, deadLetters *DeadLetterQueue) *EventForwarder {
+	return &EventForwarder{
+		url:         url,
+		httpClient:  &http.Client{Timeout: eventDeliveryTimeout},
+		deadLetters: deadLetters,
+	}
+}
+
+// Run forwards events until stop is closed or events is closed, and
+// retries the dead letters that are due meanwhile
+func (f *EventForwarder) Run(events <-chan fabric.Event, stop <-chan struct{}) {
+	ticker := time.NewTicker(deadLetterRetryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			f.Forward(event)
+		case <-ticker.C:
+			f.RetryDeadLetters()
+		}
+	}
+}
+
+// Forward posts an event, and queues it as a dead letter if that fails
+func (f *EventForwarder) Forward(event fabric.Event) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		log.Warnf("Event %s in tx %s not forwarded: %v", event.Name, event.TxID, err)
+		return
+	}
+	err = postEvent(f.httpClient, f.url, body)
+	if err == nil {
+		return
+	}
+	letter, queueErr := f.deadLetters.Add(f.url, body, err)
+	if queueErr != nil {
+		log.Errorf("Event %s in tx %s lost: not delivered (%v) and not queued (%v)", event.Name, event.TxID, err, queueErr)
+		return
+	}
+	log.Warnf("Event %s in tx %s not delivered, queued as dead letter %s: %v", event.Name, event.TxID, letter.ID, err)
+}
+
+// RetryDeadLetters delivers the dead letters whose retry is due
+func (f *EventForwarder) RetryDeadLetters() {
+	delivered, err := f.deadLetters.RetryDue(f.Deliver)
+	if err != nil {
+		log.Warnf("Failed to retry dead letters: %v", err)
+		return
+	}
+	if delivered > 0 {
+		log.Infof("Delivered %d dead letters", delivered)
+	}
+}
+
+// Deliver posts a dead letter to the sink it failed to reach
+func (f *EventForwarder) Deliver(letter *DeadLetter) error {
+	return postEvent(f.httpClient, letter.Sink, letter.Event)
+}
+
+// DeliverDeadLetter posts a dead letter to the sink it failed to reach, for
+// callers without a forwarder, such as an operator's replay
+func DeliverDeadLetter(letter *DeadLetter) error {
+	return postEvent(&http.Client{Timeout: eventDeliveryTimeout}, letter.Sink, letter.Event)
+}
+
+// postEvent posts a JSON event to a webhook
+func postEvent(httpClient *http.Client, url string, body []byte) error {
+	resp, err := httpClient.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/chaichis-network/v3/internal/crypto"
+	"github.com/pkg/errors"
+)
+
+// accessCodePrefix marks one-time access codes so they are recognizable when shared
+const accessCodePrefix = "otg_"
+
+// AccessGrant is a one-time access grant minted by a device owner
+type AccessGrant struct {
+	GrantID      string    `json:"grantID"`
+	DeviceID     string    `json:"deviceID"`
+	Code         string    `json:"code"`
+	Capabilities []string  `json:"capabilities"`
+	ExpiresAt    time.Time `json:"expiresAt"`
+}
+
+// hashAccessCode returns the hex SHA-256 digest stored on the ledger for a code
+func hashAccessCode(code string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(code)))
+}
+
+// CreateAccessGrant mints a one-time access code for a device. The grant is
+// signed with the device's private key, so only the device owner (who holds
+// the key) can mint grants. The returned code is the only copy; the ledger
+// stores just its hash.
+func (dm *DeviceManager) CreateAccessGrant(deviceID string, capabilities []string, ttl time.Duration) (*AccessGrant, error) {
+	random := make([]byte, 24)
+	if _, err := rand.Read(random); err != nil {
+		return nil, errors.Wrap(err, "failed to generate access code")
+	}
+	code := accessCodePrefix + base64.RawURLEncoding.EncodeToString(random)
+	codeHash := hashAccessCode(code)
+	ttlSeconds := int64(ttl / time.Second)
+
+	privateKey, err := crypto.LoadPrivateKey(deviceID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load device private key")
+	}
+
+	// Must match accessGrantMessage in the ISV chaincode
+	message := fmt.Sprintf("GRANT|%s|%s|%s|%d", deviceID, codeHash, strings.Join(capabilities, ","), ttlSeconds)
+	signature, err := crypto.SignData(privateKey, []byte(message))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to sign access grant")
+	}
+
+	grant, err := dm.isvContract.CreateAccessGrant(deviceID, codeHash, capabilities, ttlSeconds, signature)
+	if err != nil {
+		return nil, err
+	}
+
+	accessGrant := &AccessGrant{
+		DeviceID:     deviceID,
+		Code:         code,
+		Capabilities: capabilities,
+	}
+	if grantID, ok := grant["grantID"].(string); ok {
+		accessGrant.GrantID = grantID
+	}
+	if expiresAt, ok := grant["expiresAt"].(string); ok {
+		accessGrant.ExpiresAt, _ = time.Parse(time.RFC3339Nano, expiresAt)
+	}
+
+	log.Infof("Access grant %s created for device %s", accessGrant.GrantID, deviceID)
+	return accessGrant, nil
+}
+
+// RevokeAccessGrant cancels an unredeemed access code, signed with the device key
+func (dm *DeviceManager) RevokeAccessGrant(deviceID, code string) error {
+	privateKey, err := crypto.LoadPrivateKey(deviceID)
+	if err != nil {
+		return errors.Wrap(err, "failed to load device private key")
+	}
+
+	codeHash := hashAccessCode(code)
+	signature, err := crypto.SignData(privateKey, []byte("REVOKE_GRANT|"+codeHash))
+	if err != nil {
+		return errors.Wrap(err, "failed to sign revocation")
+	}
+
+	return dm.isvContract.RevokeAccessGrant(codeHash, signature)
+}
+
+// RedeemAccessGrant exchanges a one-time access code for a short session.
+// The client must already hold a service ticket (see Authenticate).
+func (dm *DeviceManager) RedeemAccessGrant(clientID, deviceID, code string) (*Session, error) {
+	if !strings.HasPrefix(code, accessCodePrefix) {
+		return nil, errors.New("not a one-time access code")
+	}
+
+	serviceTicket, err := (&ClientManager{
+		fabricClient: dm.fabricClient,
+		identity:     dm.identity,
+	}).GetServiceTicket(clientID, deviceID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get service ticket")
+	}
+
+	requestMap := map[string]string{
+		"encryptedServiceTicket": serviceTicket["encryptedServiceTicket"],
+		"clientID":               clientID,
+		"deviceID":               deviceID,
+		"requestType":            "grant",
+	}
+
+	response, err := dm.isvContract.RedeemAccessGrant(code, requestMap)
+	if err != nil {
+		return nil, err
+	}
+	if response["status"] != "granted" {
+		return nil, serviceDeniedError(response)
+	}
+
+	session, err := saveSessionFile(clientID, deviceID, response["sessionID"])
+	if err != nil {
+		return nil, err
+	}
+
+	log.Infof("Access code redeemed for device %s, session ID: %s", deviceID, session.SessionID)
+	return session, nil
+}
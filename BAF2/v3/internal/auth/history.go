@@ -0,0 +1,34 @@
+package auth
+
+import (
+	"time"
+
+	"github.com/chaichis-network/v3/internal/fabric"
+)
+
+// DeviceAtHeight returns a device record as it was once the given block had
+// been committed
+func (dm *DeviceManager) DeviceAtHeight(deviceID string, blockNumber uint64) (*fabric.HistoryEntry, error) {
+	return dm.isvContract.GetDeviceAtHeight(deviceID, blockNumber)
+}
+
+// SessionAtHeight returns a session record as it was once the given block had
+// been committed
+func (dm *DeviceManager) SessionAtHeight(sessionID string, blockNumber uint64) (*fabric.HistoryEntry, error) {
+	return dm.isvContract.GetSessionAtHeight(sessionID, blockNumber)
+}
+
+// DeviceHistory returns every committed version of a device record
+func (dm *DeviceManager) DeviceHistory(deviceID string) ([]fabric.HistoryEntry, error) {
+	return dm.isvContract.GetDeviceHistory(deviceID)
+}
+
+// SessionHistory returns every committed version of a session record
+func (dm *DeviceManager) SessionHistory(sessionID string) ([]fabric.HistoryEntry, error) {
+	return dm.isvContract.GetSessionHistory(sessionID)
+}
+
+// BlockAtTime returns the last block committed at or before t
+func (dm *DeviceManager) BlockAtTime(t time.Time) (uint64, error) {
+	return dm.fabricClient.BlockAtTime(t)
+}
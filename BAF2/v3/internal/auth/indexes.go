@@ -0,0 +1,9 @@
+package auth
+
+import "github.com/chaichis-network/v3/internal/fabric"
+
+// RebuildIndexes backfills the ISV's composite indexes after an upgrade.
+// Until it has run, queries that have an index scan every record instead.
+func (dm *DeviceManager) RebuildIndexes() ([]fabric.IndexRebuildResult, error) {
+	return dm.isvContract.RebuildIndexes()
+}
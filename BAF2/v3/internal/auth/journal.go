@@ -0,0 +1,152 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/chaichis-network/v3/internal/fabric"
+	"github.com/pkg/errors"
+)
+
+// The journal records every authcli invocation that submitted transactions,
+// one JSON entry per line, so operators can reconstruct what was done during
+// an incident and re-apply it on another network. Entries are only ever
+// appended. Each one carries the hash of the line before it, so an edited or
+// removed entry breaks the chain and VerifyJournal reports it.
+
+// JournalFile is the default journal in the working directory. Unlike the
+// cached tickets and sessions it is not a local artifact: it outlives a
+// ledger reset.
+const JournalFile = ".authcli-journal.jsonl"
+
+// Results of a journaled invocation
+const (
+	JournalResultOK    = "ok"
+	JournalResultError = "error"
+)
+
+// JournalEntry is one journaled invocation
+type JournalEntry struct {
+	Seq          int                           `json:"seq"`
+	At           time.Time                     `json:"at"`
+	Command      string                        `json:"command"`            // e.g. "revoke client"
+	Args         []string                      `json:"args"`               // Command line after authcli, without global flags
+	ArgsHash     string                        `json:"argsHash"`           // SHA-256 of Args before redaction
+	Redacted     []string                      `json:"redacted,omitempty"` // Flags whose values were left out of Args
+	Identity     string                        `json:"identity"`
+	FlowID       string                        `json:"flowID,omitempty"`
+	Transactions []fabric.SubmittedTransaction `json:"transactions"`
+	Result       string                        `json:"result"`
+	Error        string                        `json:"error,omitempty"`
+	PrevHash     string                        `json:"prevHash"` // SHA-256 of the previous line, "" for the first
+
+	lineHash string
+}
+
+// JournalArgsHash hashes a command line, so entries can be compared without
+// their secrets
+func JournalArgsHash(args []string) string {
+	sum := sha256.Sum256([]byte(strings.Join(args, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+// AppendJournal appends an entry to the journal at path, creating it if
+// needed, and fills in the entry's Seq and PrevHash. The journal is locked
+// while it is appended to, so concurrent invocations keep the chain intact.
+func AppendJournal(path string, entry *JournalEntry) error {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return errors.Wrap(err, "failed to open journal")
+	}
+	defer f.Close()
+	if err := lockFile(f); err != nil {
+		return errors.Wrap(err, "failed to lock journal")
+	}
+	defer unlockFile(f)
+
+	entries, err := readJournal(f)
+	if err != nil {
+		return err
+	}
+	entry.Seq = 1
+	entry.PrevHash = ""
+	if len(entries) > 0 {
+		last := entries[len(entries)-1]
+		entry.Seq = last.Seq + 1
+		entry.PrevHash = last.lineHash
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal journal entry")
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return errors.Wrap(err, "failed to append to journal")
+	}
+	if err := f.Sync(); err != nil {
+		return errors.Wrap(err, "failed to sync journal")
+	}
+	return nil
+}
+
+// ReadJournal returns the entries of the journal at path, or none if there
+// is no journal
+func ReadJournal(path string) ([]*JournalEntry, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open journal")
+	}
+	defer f.Close()
+	return readJournal(f)
+}
+
+func readJournal(r io.Reader) ([]*JournalEntry, error) {
+	var entries []*JournalEntry
+	reader := bufio.NewReader(r)
+	for number := 1; ; number++ {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, errors.Wrap(err, "failed to read journal")
+		}
+		if line = bytes.TrimSuffix(line, []byte("\n")); len(line) > 0 {
+			var entry JournalEntry
+			if err := json.Unmarshal(line, &entry); err != nil {
+				return nil, errors.Wrapf(err, "failed to parse journal line %d", number)
+			}
+			sum := sha256.Sum256(line)
+			entry.lineHash = hex.EncodeToString(sum[:])
+			entries = append(entries, &entry)
+		}
+		if err == io.EOF {
+			return entries, nil
+		}
+	}
+}
+
+// VerifyJournal checks that each entry follows the one before it: that its
+// sequence number is the next one and that it carries that entry's hash
+func VerifyJournal(entries []*JournalEntry) error {
+	for i, entry := range entries {
+		if i == 0 {
+			if entry.PrevHash != "" {
+				return errors.Errorf("journal starts at entry %d, which follows an entry that is missing", entry.Seq)
+			}
+			continue
+		}
+		previous := entries[i-1]
+		if entry.Seq != previous.Seq+1 || entry.PrevHash != previous.lineHash {
+			return errors.Errorf("journal entry %d does not follow entry %d: the journal was modified", entry.Seq, previous.Seq)
+		}
+	}
+	return nil
+}
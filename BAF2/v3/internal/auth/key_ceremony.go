@@ -0,0 +1,151 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/chaichis-network/v3/internal/fabric"
+	"github.com/chaichis-network/v3/pkg/keystore"
+	"github.com/pkg/errors"
+)
+
+// KeyCeremonyCheck is one check of a key ceremony verification
+type KeyCeremonyCheck struct {
+	Check  string `json:"check"`
+	Passed bool   `json:"passed"`
+	Detail string `json:"detail"`
+}
+
+// keyCeremonyServices are the chaincodes in startup order, with the key
+// each one loads itself and the key it imports from the one before
+var keyCeremonyServices = []struct {
+	service, contractID, ownKey, importedKey, importedFrom string
+}{
+	{"isv", fabric.ISVContractID, "ISV_PUBLIC_KEY", "", ""},
+	{"tgs", fabric.TGSContractID, "TGS_PUBLIC_KEY", "ISV_PUBLIC_KEY", "isv"},
+	{"as", fabric.ASContractID, "AS_PUBLIC_KEY", "TGS_PUBLIC_KEY", "tgs"},
+}
+
+// signatureVerifiers are the chaincodes that import a service's key once
+// it is initialized, to check what it signs: the TGS checks the client
+// changes the AS sends
+var signatureVerifiers = map[string]string{
+	"as": fabric.TGSContractID,
+}
+
+// VerifyKeyCeremony checks the initialization records of the three
+// chaincodes: each must have been initialized, its own key must match the
+// key it published, the TGS must have been initialized with the ISV's key
+// and the AS with the TGS's, and none may run a key pair once published in
+// the chaincode source. expected optionally gives the fingerprint each
+// service's own key must have, by service ("as", "tgs" or "isv"). The
+// system is operational only if every check passes.
+func VerifyKeyCeremony(fabricClient *fabric.Client, expected map[string]string) ([]KeyCeremonyCheck, error) {
+	var checks []KeyCeremonyCheck
+	check := func(name string, passed bool, format string, args ...interface{}) {
+		checks = append(checks, KeyCeremonyCheck{Check: name, Passed: passed, Detail: fmt.Sprintf(format, args...)})
+	}
+
+	records := map[string]*fabric.InitializationRecord{}
+	for _, chaincode := range keyCeremonyServices {
+		contract, err := fabricClient.GetContract(chaincode.contractID)
+		if err != nil {
+			return nil, err
+		}
+
+		record, err := fabricClient.GetInitializationRecord(contract)
+		if err != nil {
+			check(chaincode.service+" initialized", false, "%v", err)
+			continue
+		}
+		check(chaincode.service+" initialized", true, "by %s (%s) at %s in %s", record.InitializedBy, record.Initializer, record.InitializedAt, record.TxID)
+
+		records[chaincode.service] = record
+		own := record.KeyFingerprints[chaincode.ownKey]
+		if key, err := fabricClient.GetPublishedPublicKey(contract); err == nil {
+			check(chaincode.service+" published key", sameFingerprint(own, key.Fingerprint), "initialized with %s, published %s", own, key.Fingerprint)
+		} else {
+			log.Debugf("No published key on %s: %v", chaincode.service, err)
+		}
+		if want, ok := expected[chaincode.service]; ok {
+			check(chaincode.service+" expected key", sameFingerprint(own, want), "initialized with %s, expected %s", own, want)
+		}
+		if status, err := fabricClient.GetServiceKeyStatus(contract); err == nil {
+			check(chaincode.service+" key not from source", !status.Legacy, "fingerprint %s; migrate with 'service-keys migrate' if it is from source", status.Fingerprint)
+		} else {
+			log.Debugf("No key status on %s: %v", chaincode.service, err)
+		}
+	}
+
+	for _, chaincode := range keyCeremonyServices {
+		if chaincode.importedKey == "" {
+			continue
+		}
+		name := fmt.Sprintf("%s uses %s key", chaincode.service, chaincode.importedFrom)
+		record, ok := records[chaincode.service]
+		if !ok {
+			check(name, false, "%s not initialized", chaincode.service)
+			continue
+		}
+		peer, ok := records[chaincode.importedFrom]
+		if !ok {
+			check(name, false, "%s not initialized", chaincode.importedFrom)
+			continue
+		}
+		// The imported key has the same name as the peer's own key
+		got := record.KeyFingerprints[chaincode.importedKey]
+		want := peer.KeyFingerprints[chaincode.importedKey]
+		check(name, sameFingerprint(got, want), "initialized with %s, %s key is %s", got, chaincode.importedFrom, want)
+	}
+
+	return checks, nil
+}
+
+// sameFingerprint compares hex fingerprints; an empty one matches nothing
+func sameFingerprint(a, b string) bool {
+	return a != "" && strings.EqualFold(a, b)
+}
+
+// LoadServiceKeyPair reads a chaincode's PEM private key from path, e.g. one
+// made with 'openssl genrsa', and completes the pair with its public key
+func LoadServiceKeyPair(path string) (*fabric.ServiceKeyPair, error) {
+	privateKeyPEM, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read service private key")
+	}
+	return serviceKeyPairFromPEM(privateKeyPEM, path)
+}
+
+// serviceKeyPairFromPEM completes a PEM private key read from where with
+// its public key
+func serviceKeyPairFromPEM(privateKeyPEM []byte, where string) (*fabric.ServiceKeyPair, error) {
+	privateKey, err := keystore.ParsePrivateKeyPEM(privateKeyPEM)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse service private key %s", where)
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode service public key")
+	}
+
+	return &fabric.ServiceKeyPair{
+		PrivateKey: string(privateKeyPEM),
+		PublicKey:  string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})),
+	}, nil
+}
+
+// ServiceKeyFingerprint returns the fingerprint the chaincodes give a key
+// pair's public key: the hex SHA-256 of its PKIX encoding
+func ServiceKeyFingerprint(keys *fabric.ServiceKeyPair) (string, error) {
+	block, _ := pem.Decode([]byte(keys.PublicKey))
+	if block == nil {
+		return "", errors.New("service public key is not PEM")
+	}
+	sum := sha256.Sum256(block.Bytes)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// SetDeviceLabels sets labels on deviceID, one transaction per label, and
+// returns the device record after the last one
+func (dm *DeviceManager) SetDeviceLabels(deviceID string, labels map[string]string) (map[string]interface{}, error) {
+	var record map[string]interface{}
+	for _, key := range labelKeys(labels) {
+		var err error
+		if record, err = dm.isvContract.SetDeviceLabel(deviceID, key, labels[key]); err != nil {
+			return nil, err
+		}
+	}
+	return record, nil
+}
+
+// RemoveDeviceLabels removes labels from deviceID, one transaction per key
+func (dm *DeviceManager) RemoveDeviceLabels(deviceID string, keys []string) (map[string]interface{}, error) {
+	var record map[string]interface{}
+	for _, key := range keys {
+		var err error
+		if record, err = dm.isvContract.RemoveDeviceLabel(deviceID, key); err != nil {
+			return nil, err
+		}
+	}
+	return record, nil
+}
+
+// SetClientLabels sets labels on clientID, one transaction per label, and
+// returns the client record after the last one
+func (cm *ClientManager) SetClientLabels(clientID string, labels map[string]string) (map[string]interface{}, error) {
+	var record map[string]interface{}
+	for _, key := range labelKeys(labels) {
+		var err error
+		if record, err = cm.asContract.SetClientLabel(clientID, key, labels[key]); err != nil {
+			return nil, err
+		}
+	}
+	return record, nil
+}
+
+// RemoveClientLabels removes labels from clientID, one transaction per key
+func (cm *ClientManager) RemoveClientLabels(clientID string, keys []string) (map[string]interface{}, error) {
+	var record map[string]interface{}
+	for _, key := range keys {
+		var err error
+		if record, err = cm.asContract.RemoveClientLabel(clientID, key); err != nil {
+			return nil, err
+		}
+	}
+	return record, nil
+}
+
+// ParseLabels parses key=value arguments into a label set
+func ParseLabels(args []string) (map[string]string, error) {
+	labels := make(map[string]string, len(args))
+	for _, arg := range args {
+		i := strings.Index(arg, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid label %q: expected key=value", arg)
+		}
+		labels[arg[:i]] = arg[i+1:]
+	}
+	return labels, nil
+}
+
+// labelKeys returns the keys of labels in order, so labels are set in the
+// same order on every run
+func labelKeys(labels map[string]string) []string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
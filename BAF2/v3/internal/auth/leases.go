@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"time"
+
+	"github.com/chaichis-network/v3/internal/fabric"
+	"github.com/pkg/errors"
+)
+
+// RenewLease creates or extends a client's lease for ttl, proving the
+// client's identity with its saved service ticket for deviceID. A client
+// renews well before the lease runs out; if it stops, a sweep closes its
+// sessions once the lease has lapsed.
+func (dm *DeviceManager) RenewLease(clientID, deviceID string, ttl time.Duration) (*fabric.ClientLease, error) {
+	serviceTicket, err := (&ClientManager{
+		fabricClient: dm.fabricClient,
+		identity:     dm.identity,
+	}).GetServiceTicket(clientID, deviceID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get service ticket")
+	}
+
+	request := map[string]string{
+		"encryptedServiceTicket": serviceTicket["encryptedServiceTicket"],
+		"clientID":               clientID,
+		"deviceID":               deviceID,
+		"requestType":            "lease",
+	}
+	return dm.isvContract.RenewClientLease(request, int64(ttl/time.Second))
+}
+
+// GetLease returns a client's lease
+func (dm *DeviceManager) GetLease(clientID string) (*fabric.ClientLease, error) {
+	return dm.isvContract.GetClientLease(clientID)
+}
+
+// SweepSessions closes sessions whose client lease lapsed or whose own
+// lifetime ended, freeing their devices
+func (dm *DeviceManager) SweepSessions() (*fabric.SweepResult, error) {
+	return dm.isvContract.SweepSessions()
+}
+
+// RecoverBusyDevices frees devices left busy with no live session, e.g. by
+// a session record that was terminated without freeing its device
+func (dm *DeviceManager) RecoverBusyDevices() (*fabric.RecoveryResult, error) {
+	return dm.isvContract.RecoverBusyDevices()
+}
@@ -0,0 +1,33 @@
+package auth
+
+import (
+	"fmt"
+
+	"github.com/chaichis-network/v3/internal/crypto"
+	"github.com/chaichis-network/v3/internal/fabric"
+	"github.com/pkg/errors"
+)
+
+// SetDeviceLoadLimits caps the concurrent sessions and service requests per
+// minute a device takes; zero limits remove the caps. The limits are signed
+// with the device's private key.
+func (dm *DeviceManager) SetDeviceLoadLimits(deviceID string, limits fabric.DeviceLoadLimits) error {
+	privateKey, err := crypto.LoadPrivateKey(deviceID)
+	if err != nil {
+		return errors.Wrap(err, "failed to load device private key")
+	}
+
+	// Must match loadLimitsMessage in the ISV chaincode
+	message := fmt.Sprintf("LOADLIMITS|%s|%d|%d", deviceID, limits.MaxActiveSessions, limits.MaxRequestsPerMinute)
+	signature, err := crypto.SignData(privateKey, []byte(message))
+	if err != nil {
+		return errors.Wrap(err, "failed to sign load limits")
+	}
+
+	return dm.isvContract.SetDeviceLoadLimits(deviceID, limits, signature)
+}
+
+// GetDeviceLoad returns a device's load limits and current load
+func (dm *DeviceManager) GetDeviceLoad(deviceID string) (*fabric.DeviceLoad, error) {
+	return dm.isvContract.GetDeviceLoad(deviceID)
+}
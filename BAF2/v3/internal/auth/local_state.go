@@ -0,0 +1,144 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/chaichis-network/v3/internal/fabric"
+	"github.com/pkg/errors"
+)
+
+// LocalStateFile records which ledger the tickets and sessions cached in the
+// working directory were issued on
+const LocalStateFile = ".authcli-ledger.json"
+
+// LocalStateStamp identifies the ledger local state belongs to
+type LocalStateStamp struct {
+	Channel     string    `json:"channel"`
+	GenesisHash string    `json:"genesisHash"`
+	RecordedAt  time.Time `json:"recordedAt"`
+}
+
+// LedgerMismatchError is returned when the cached tickets and sessions were
+// issued on another ledger, typically because a dev network was torn down
+// and recreated
+type LedgerMismatchError struct {
+	Stamp       *LocalStateStamp
+	Channel     string
+	GenesisHash string
+}
+
+func (e *LedgerMismatchError) Error() string {
+	return fmt.Sprintf("local tickets and sessions were issued on another ledger (channel %s, genesis %.12s, recorded %s) than the one connected to (channel %s, genesis %.12s); run 'authcli reset-local-state --confirm' to remove them",
+		e.Stamp.Channel, e.Stamp.GenesisHash, e.Stamp.RecordedAt.Format(time.RFC3339), e.Channel, e.GenesisHash)
+}
+
+// CheckLocalState compares the ledger recorded with the local state against
+// the one the client is connected to. Local state without a record is
+// stamped with the connected ledger.
+func CheckLocalState(fabricClient *fabric.Client) error {
+	genesisHash, err := fabricClient.GenesisHash()
+	if err != nil {
+		// Peers that cannot answer qscc queries fail the command itself soon
+		// enough; the check runs again on the next connection
+		log.Debugf("Skipping local state check: %v", err)
+		return nil
+	}
+
+	stamp, err := LoadLocalStateStamp()
+	if err != nil {
+		return err
+	}
+	if stamp == nil {
+		return saveLocalStateStamp(&LocalStateStamp{
+			Channel:     fabricClient.ChannelName(),
+			GenesisHash: genesisHash,
+			RecordedAt:  time.Now().UTC(),
+		})
+	}
+
+	if stamp.Channel != fabricClient.ChannelName() || stamp.GenesisHash != genesisHash {
+		return &LedgerMismatchError{
+			Stamp:       stamp,
+			Channel:     fabricClient.ChannelName(),
+			GenesisHash: genesisHash,
+		}
+	}
+	return nil
+}
+
+// LoadLocalStateStamp returns the recorded ledger, or nil if none is recorded
+func LoadLocalStateStamp() (*LocalStateStamp, error) {
+	stampJSON, err := ioutil.ReadFile(LocalStateFile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read local state record")
+	}
+
+	var stamp LocalStateStamp
+	if err := json.Unmarshal(stampJSON, &stamp); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse %s", LocalStateFile)
+	}
+	return &stamp, nil
+}
+
+func saveLocalStateStamp(stamp *LocalStateStamp) error {
+	stampJSON, err := json.MarshalIndent(stamp, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal local state record")
+	}
+	if err := ioutil.WriteFile(LocalStateFile, stampJSON, 0600); err != nil {
+		return errors.Wrap(err, "failed to save local state record")
+	}
+	return nil
+}
+
+// LocalArtifacts lists the cached files that are only valid on the ledger
+// that issued them: TGTs, service tickets and device sessions in the working
+// directory, the session directory's files and bolt session database, and
+// the ledger record itself.
+// Client and device keys are not included; they can be registered again.
+func LocalArtifacts(sessionDir string) ([]string, error) {
+	patterns := []string{
+		"*-tgt.json",
+		"*-serviceticket-*.json",
+		"*-session-*.json",
+		filepath.Join(sessionDir, "*.json"),
+		filepath.Join(sessionDir, BoltSessionFile),
+		LocalStateFile,
+	}
+
+	seen := make(map[string]bool)
+	var artifacts []string
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to search for %s", pattern)
+		}
+		for _, match := range matches {
+			if !seen[match] {
+				seen[match] = true
+				artifacts = append(artifacts, match)
+			}
+		}
+	}
+	sort.Strings(artifacts)
+	return artifacts, nil
+}
+
+// RemoveLocalArtifacts deletes the given files, ignoring ones already gone
+func RemoveLocalArtifacts(artifacts []string) error {
+	for _, artifact := range artifacts {
+		if err := os.Remove(artifact); err != nil && !os.IsNotExist(err) {
+			return errors.Wrapf(err, "failed to remove %s", artifact)
+		}
+	}
+	return nil
+}
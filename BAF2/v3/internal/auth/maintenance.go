@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/chaichis-network/v3/internal/crypto"
+	"github.com/chaichis-network/v3/internal/fabric"
+	"github.com/pkg/errors"
+)
+
+// ScheduleMaintenance puts deviceID into maintenance between start and end.
+// Only the operators may open sessions on it meanwhile. The window is signed
+// with the device's private key.
+func (dm *DeviceManager) ScheduleMaintenance(deviceID string, start, end time.Time, reason string, operators []string) error {
+	privateKey, err := crypto.LoadPrivateKey(deviceID)
+	if err != nil {
+		return errors.Wrap(err, "failed to load device private key")
+	}
+
+	// The chaincode keeps whole seconds in UTC
+	window := fabric.MaintenanceWindow{
+		Start:     start.UTC().Truncate(time.Second),
+		End:       end.UTC().Truncate(time.Second),
+		Reason:    reason,
+		Operators: operators,
+	}
+
+	// Must match maintenanceMessage in the ISV chaincode
+	message := fmt.Sprintf("MAINTENANCE|%s|%d|%d|%s|%s", deviceID, window.Start.Unix(), window.End.Unix(),
+		window.Reason, strings.Join(window.Operators, ","))
+	signature, err := crypto.SignData(privateKey, []byte(message))
+	if err != nil {
+		return errors.Wrap(err, "failed to sign maintenance window")
+	}
+
+	if err := dm.isvContract.ScheduleMaintenance(deviceID, window, signature); err != nil {
+		return err
+	}
+
+	log.Infof("Device %s in maintenance from %s to %s", deviceID, window.Start.Format(time.RFC3339), window.End.Format(time.RFC3339))
+	return nil
+}
+
+// CancelMaintenance removes the maintenance window of deviceID
+func (dm *DeviceManager) CancelMaintenance(deviceID string) error {
+	window, err := dm.isvContract.GetMaintenanceWindow(deviceID)
+	if err != nil {
+		return err
+	}
+
+	privateKey, err := crypto.LoadPrivateKey(deviceID)
+	if err != nil {
+		return errors.Wrap(err, "failed to load device private key")
+	}
+
+	// Must match cancelMaintenanceMessage in the ISV chaincode
+	message := fmt.Sprintf("MAINTENANCE_CANCEL|%s|%d", deviceID, window.Start.Unix())
+	signature, err := crypto.SignData(privateKey, []byte(message))
+	if err != nil {
+		return errors.Wrap(err, "failed to sign maintenance cancellation")
+	}
+
+	if err := dm.isvContract.CancelMaintenance(deviceID, signature); err != nil {
+		return err
+	}
+
+	log.Infof("Maintenance window of device %s cancelled", deviceID)
+	return nil
+}
+
+// GetMaintenanceWindow returns the scheduled or current window of deviceID
+func (dm *DeviceManager) GetMaintenanceWindow(deviceID string) (*fabric.MaintenanceWindow, error) {
+	return dm.isvContract.GetMaintenanceWindow(deviceID)
+}
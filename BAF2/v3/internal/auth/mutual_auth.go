@@ -0,0 +1,207 @@
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"time"
+
+	"github.com/chaichis-network/v3/internal/crypto"
+	"github.com/chaichis-network/v3/pkg/ticket"
+	"github.com/pkg/errors"
+)
+
+// The service ticket proves the client to the ISV; mutual authentication
+// proves the ISV to the client. The client sends the ISV an authenticator,
+// its ID and a timestamp sealed under the service session key KU,SS, and
+// the ISV replies with the timestamp plus one sealed under the same key.
+// Only an ISV that could open the service ticket knows KU,SS, so a missing
+// or wrong reply means the client is talking to a rogue ISV.
+//
+// The client learns KU,SS from the TGS, sealed under the TGS session key
+// KU,TGS that the AS encrypted for the client's public key. A TGS that
+// predates mutual authentication returns a hash of the two keys instead, and
+// a key held by a vault cannot decrypt KU,TGS locally; the request is then
+// sent without an authenticator, as before, with a warning. A strict client
+// refuses to send it.
+
+const (
+	// Key usages, the additional data of each sealed value; they match the
+	// TGS and ISV chaincodes
+	serviceSessionKeyUsage   = "service-session-key"
+	clientAuthenticatorUsage = "isv-client-authenticator"
+	serverAuthenticatorUsage = "isv-server-authenticator"
+
+	sealNonceSize = 12
+)
+
+// sessionAuthenticator is the plaintext of an authenticator and of the
+// ISV's reply
+type sessionAuthenticator struct {
+	ClientID  string `json:"clientID"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// serviceAuthenticator is an authenticator sent to the ISV, kept to check
+// the reply
+type serviceAuthenticator struct {
+	clientID  string
+	timestamp int64
+	aead      cipher.AEAD
+	sealed    string
+}
+
+// newServiceAuthenticator creates an authenticator for a request with a
+// saved service ticket. It returns nil if the client cannot recover the
+// ticket's session key, in which case the request goes without one and the
+// ISV lets the ticket be used for that request only; a strict client fails
+// instead.
+func (dm *DeviceManager) newServiceAuthenticator(clientID string, serviceTicket map[string]string) (*serviceAuthenticator, error) {
+	tgt, err := (&ClientManager{fabricClient: dm.fabricClient, identity: dm.identity}).GetTGT(clientID)
+	if err != nil {
+		return nil, err
+	}
+	return sealServiceAuthenticator(clientID, tgt, serviceTicket, dm.fabricClient.Strict())
+}
+
+// sealServiceAuthenticator seals an authenticator under the service session
+// key the TGS sealed in serviceTicket, recovered through the TGT
+func sealServiceAuthenticator(clientID string, tgt, serviceTicket map[string]string, strict bool) (*serviceAuthenticator, error) {
+	tgsSessionKey, err := decryptTGSSessionKey(clientID, tgt)
+	if err != nil {
+		return withoutAuthenticator(err, strict)
+	}
+
+	serviceSessionKey, err := openServiceSessionKey(tgsSessionKey, serviceTicket["encryptedSessionKey"])
+	if err != nil {
+		// A TGS without mutual authentication does not seal the key
+		return withoutAuthenticator(errors.Wrap(err, "the TGS did not seal the service session key for the client"), strict)
+	}
+	aead, err := sessionKeyAEAD(serviceSessionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	authenticator := &serviceAuthenticator{clientID: clientID, timestamp: time.Now().Unix(), aead: aead}
+	plaintext, err := json.Marshal(sessionAuthenticator{ClientID: clientID, Timestamp: authenticator.timestamp})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal authenticator")
+	}
+	nonce := make([]byte, sealNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, errors.Wrap(err, "failed to generate authenticator nonce")
+	}
+	authenticator.sealed = base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, plaintext, []byte(clientAuthenticatorUsage)))
+	return authenticator, nil
+}
+
+// withoutAuthenticator lets a request go without an authenticator, with a
+// warning, or fails if the client is strict
+func withoutAuthenticator(reason error, strict bool) (*serviceAuthenticator, error) {
+	if strict {
+		return nil, errors.Wrap(reason, "cannot verify the ISV's identity (strict mode)")
+	}
+	log.Warnf("Cannot verify the ISV's identity, and the service ticket is good for one request: %v", reason)
+	return nil, nil
+}
+
+// addTo adds the authenticator to a service request; a nil authenticator
+// adds nothing
+func (a *serviceAuthenticator) addTo(request map[string]string) {
+	if a != nil {
+		request["authenticator"] = a.sealed
+	}
+}
+
+// verify checks the ISV's reply in a service response: the authenticator's
+// timestamp plus one, sealed under the service session key. A nil
+// authenticator checks nothing.
+func (a *serviceAuthenticator) verify(response map[string]string) error {
+	if a == nil {
+		return nil
+	}
+	reply := response["serverAuthenticator"]
+	if reply == "" {
+		return errors.New("the ISV did not prove its identity; it may not be the ISV the service ticket was issued for")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(reply)
+	if err != nil || len(sealed) < sealNonceSize {
+		return errors.New("the ISV's proof of identity is malformed")
+	}
+	plaintext, err := a.aead.Open(nil, sealed[:sealNonceSize], sealed[sealNonceSize:], []byte(serverAuthenticatorUsage))
+	if err != nil {
+		return errors.New("the ISV's proof of identity is not sealed with the service session key; it may be a rogue ISV")
+	}
+	var proof sessionAuthenticator
+	if err := json.Unmarshal(plaintext, &proof); err != nil {
+		return errors.Wrap(err, "the ISV's proof of identity is malformed")
+	}
+	if proof.ClientID != a.clientID || proof.Timestamp != a.timestamp+1 {
+		return errors.New("the ISV's proof of identity does not answer this request; it may be a replayed response")
+	}
+	return nil
+}
+
+// decryptTGSSessionKey decrypts the KU,TGS session key of a saved TGT with
+// the client's private key, returning it base64-encoded as the AS issued it
+func decryptTGSSessionKey(clientID string, tgt map[string]string) (string, error) {
+	signer, err := crypto.LoadPrivateKey(clientID)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to load private key")
+	}
+	encryptedSessionKey, err := base64.StdEncoding.DecodeString(tgt["encryptedSessionKey"])
+	if err != nil {
+		return "", errors.Wrap(err, "TGT session key is not valid base64")
+	}
+	var sessionKey []byte
+	switch privateKey := signer.(type) {
+	case *rsa.PrivateKey:
+		sessionKey, err = ticket.DecryptSessionKey(tgt["encryption"], privateKey, encryptedSessionKey)
+	case *ecdsa.PrivateKey:
+		sessionKey, err = ticket.DecryptSessionKeyECIES(privateKey, encryptedSessionKey)
+	default:
+		return "", errors.Errorf("the client's %T key cannot decrypt the TGT session key locally", signer)
+	}
+	if err != nil {
+		return "", errors.Wrap(err, "failed to decrypt the TGT session key")
+	}
+	return string(sessionKey), nil
+}
+
+// openServiceSessionKey opens the KU,SS session key the TGS sealed under
+// KU,TGS in a service ticket response
+func openServiceSessionKey(tgsSessionKey, encryptedSessionKey string) (string, error) {
+	aead, err := sessionKeyAEAD(tgsSessionKey)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encryptedSessionKey)
+	if err != nil {
+		return "", errors.Wrap(err, "service session key is not valid base64")
+	}
+	if len(sealed) < sealNonceSize {
+		return "", errors.New("service session key is not sealed")
+	}
+	sessionKey, err := aead.Open(nil, sealed[:sealNonceSize], sealed[sealNonceSize:], []byte(serviceSessionKeyUsage))
+	if err != nil {
+		return "", errors.New("service session key does not open with the TGT session key")
+	}
+	return string(sessionKey), nil
+}
+
+// sessionKeyAEAD returns AES-256-GCM under a base64 session key
+func sessionKeyAEAD(sessionKeyB64 string) (cipher.AEAD, error) {
+	key, err := base64.StdEncoding.DecodeString(sessionKeyB64)
+	if err != nil || len(key) != ticket.SessionKeySize {
+		return nil, errors.Errorf("session key is not %d base64-encoded bytes", ticket.SessionKeySize)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
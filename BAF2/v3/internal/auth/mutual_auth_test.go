@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"os"
+	"testing"
+
+	"github.com/chaichis-network/v3/internal/crypto"
+	"github.com/chaichis-network/v3/pkg/ticket"
+)
+
+func TestSealServiceAuthenticatorStrict(t *testing.T) {
+	// Keys are read from the working directory
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	privateKey, publicKey, err := crypto.GenerateKeyPair(2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := crypto.SavePrivateKey(privateKey, "client1"); err != nil {
+		t.Fatal(err)
+	}
+	sessionKey := make([]byte, ticket.SessionKeySize)
+	if _, err := rand.Read(sessionKey); err != nil {
+		t.Fatal(err)
+	}
+	encryptedSessionKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, publicKey, []byte(base64.StdEncoding.EncodeToString(sessionKey)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tgt := map[string]string{
+		"encryption":          ticket.EncryptionOAEP,
+		"encryptedSessionKey": base64.StdEncoding.EncodeToString(encryptedSessionKey),
+	}
+	// A TGS without mutual authentication sends a hash, not a sealed key
+	legacyServiceTicket := map[string]string{"encryptedSessionKey": "c2Vzc2lvbi1rZXktaGFzaA=="}
+
+	tests := []struct {
+		name     string
+		clientID string
+	}{
+		{"no local key for the TGT", "client2"},
+		{"service session key not sealed", "client1"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			authenticator, err := sealServiceAuthenticator(test.clientID, tgt, legacyServiceTicket, false)
+			if err != nil || authenticator != nil {
+				t.Errorf("without strict: authenticator %v, error %v, want the request sent without one", authenticator, err)
+			}
+			if _, err := sealServiceAuthenticator(test.clientID, tgt, legacyServiceTicket, true); err == nil {
+				t.Error("strict: the request was let through without an authenticator")
+			}
+		})
+	}
+}
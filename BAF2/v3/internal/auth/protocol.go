@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"time"
+
+	"github.com/chaichis-network/v3/internal/crypto"
+	"github.com/chaichis-network/v3/pkg/ticket"
+	"github.com/pkg/errors"
+)
+
+// ChaincodeProtocols returns what the AS and TGS report from GetProtocolInfo
+func (cm *ClientManager) ChaincodeProtocols() (as, tgs *ticket.ProtocolInfo, err error) {
+	if as, err = cm.asContract.ProtocolInfo(); err != nil {
+		return nil, nil, err
+	}
+	if tgs, err = cm.tgsContract.ProtocolInfo(); err != nil {
+		return nil, nil, err
+	}
+	return as, tgs, nil
+}
+
+// NegotiateProtocol picks the message formats to use with the AS and TGS as
+// deployed now: the newest protocol version this client and the AS share,
+// and a ticket format the TGS can read. Chaincodes that predate protocol
+// negotiation yield ticket.LegacyProtocol.
+func (cm *ClientManager) NegotiateProtocol() (ticket.Protocol, error) {
+	return cm.negotiateProtocol(ticket.SupportedProtocols)
+}
+
+// negotiateProtocol is NegotiateProtocol for a client that speaks client
+func (cm *ClientManager) negotiateProtocol(client ticket.ProtocolInfo) (ticket.Protocol, error) {
+	asInfo, tgsInfo, err := cm.ChaincodeProtocols()
+	if err != nil {
+		return ticket.Protocol{}, err
+	}
+
+	protocol, err := ticket.NegotiateProtocol(client, *asInfo, *tgsInfo)
+	if err != nil {
+		return ticket.Protocol{}, errors.Wrap(err, "protocol negotiation failed")
+	}
+	log.Debugf("Negotiated protocol v%d (%s, %s tickets)", protocol.Version, protocol.Encryption, protocol.TicketFormat)
+	return protocol, nil
+}
+
+// generateTGT requests a TGT in the negotiated protocol. Version 1 uses
+// GenerateTGT, which every AS has. A client with a P-256 key can only
+// negotiate ECIES, which needs version 2.
+func (cm *ClientManager) generateTGT(clientID string) (map[string]string, error) {
+	privateKey, err := crypto.LoadPrivateKey(clientID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load private key")
+	}
+	client := ticket.SupportedProtocols
+	if _, ok := privateKey.(*ecdsa.PrivateKey); ok {
+		client = ticket.SupportedECProtocols
+	}
+
+	protocol, err := cm.negotiateProtocol(client)
+	if err != nil {
+		return nil, err
+	}
+	var tgt map[string]string
+	if protocol.Version < ticket.ProtocolV2 {
+		tgt, err = cm.asContract.GenerateTGT(clientID)
+	} else {
+		tgt, err = cm.asContract.GenerateTGTWithProtocol(clientID, protocol)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Warn before a scheduled ticket policy locks this client out
+	cm.warnUpcomingTicketPolicy(protocol.Encryption, time.Now())
+	return tgt, nil
+}
@@ -0,0 +1,187 @@
+package auth
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"time"
+
+	"github.com/chaichis-network/v3/internal/crypto"
+	"github.com/chaichis-network/v3/internal/fabric"
+	"github.com/chaichis-network/v3/pkg/ticket"
+	"github.com/pkg/errors"
+)
+
+// Tickets and sessions expire after fixed lifetimes. Until they do, a client
+// can renew them without running the authentication flow again: the AS
+// renews a valid TGT, the TGS a valid service ticket, and the ISV extends an
+// active session given a valid service ticket.
+
+// tgtRenewalMargin is how close to its expiry RenewSession renews the TGT
+// along with the service ticket
+const tgtRenewalMargin = 10 * time.Minute
+
+// RenewTGT renews the client's saved TGT and saves the renewed TGT in its
+// place
+func (cm *ClientManager) RenewTGT(clientID string) (map[string]string, error) {
+	tgt, err := cm.GetTGT(clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	authenticator, err := ticket.NewAuthenticator(clientID, time.Now())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create authenticator")
+	}
+	renewed, err := cm.asContract.RenewTGT(clientID, tgt["encryptedTGT"], authenticator)
+	if err != nil {
+		return nil, err
+	}
+
+	privateKey, err := crypto.LoadPrivateKey(clientID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load private key")
+	}
+	if err := ticket.VerifyTGTWithKey(ticket.TGT{
+		EncryptedTGT:        renewed["encryptedTGT"],
+		EncryptedSessionKey: renewed["encryptedSessionKey"],
+		ExpiresAt:           renewed["expiresAt"],
+		Encryption:          renewed["encryption"],
+	}, privateKey, time.Now()); err != nil {
+		return nil, errors.Wrap(err, "renewed TGT verification failed")
+	}
+
+	tgtJSON, err := json.Marshal(renewed)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal TGT")
+	}
+	if err := ioutil.WriteFile(clientID+"-tgt.json", tgtJSON, 0600); err != nil {
+		return nil, errors.Wrap(err, "failed to save TGT to file")
+	}
+
+	log.Infof("TGT of client %s renewed until %s", clientID, renewed["expiresAt"])
+	return renewed, nil
+}
+
+// RenewServiceTicket renews the client's saved service ticket for a device
+// and saves the renewed ticket in its place
+func (cm *ClientManager) RenewServiceTicket(clientID, deviceID string) (map[string]string, error) {
+	tgt, err := cm.GetTGT(clientID)
+	if err != nil {
+		return nil, err
+	}
+	serviceTicket, err := cm.GetServiceTicket(clientID, deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := ticket.NewServiceTicketRenewalRequest(ticket.TGT{
+		EncryptedTGT:        tgt["encryptedTGT"],
+		EncryptedSessionKey: tgt["encryptedSessionKey"],
+	}, ticket.ServiceTicket{
+		EncryptedServiceTicket: serviceTicket["encryptedServiceTicket"],
+		EncryptedSessionKey:    serviceTicket["encryptedSessionKey"],
+	}, clientID, DefaultServiceID, time.Now())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create service ticket renewal request")
+	}
+
+	renewed, err := cm.tgsContract.RenewServiceTicket(request)
+	if err != nil {
+		return nil, err
+	}
+
+	// The renewed ticket stays in the flow of the ticket it replaces
+	renewed[flowIDField] = serviceTicket[flowIDField]
+	serviceTicketJSON, err := json.Marshal(renewed)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal service ticket")
+	}
+	if err := ioutil.WriteFile(clientID+"-serviceticket-"+deviceID+".json", serviceTicketJSON, 0600); err != nil {
+		return nil, errors.Wrap(err, "failed to save service ticket to file")
+	}
+	return renewed, nil
+}
+
+// tgtExpiresWithin reports whether a saved TGT expires within d of now. A
+// TGT without a readable expiry is treated as expiring.
+func tgtExpiresWithin(tgt map[string]string, d time.Duration, now time.Time) bool {
+	expiresAt, err := time.Parse(time.RFC3339, tgt["expiresAt"])
+	return err != nil || expiresAt.Sub(now) < d
+}
+
+// RenewSession extends the client's active session with a device before it
+// expires. It renews the saved service ticket, and the TGT as well when it
+// is about to expire, then has the ISV extend the session with the renewed
+// ticket.
+func (dm *DeviceManager) RenewSession(clientID, deviceID string) (*Session, error) {
+	sessionFile := clientID + "-session-" + deviceID + ".json"
+	sessionJSON, err := ioutil.ReadFile(sessionFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read session file")
+	}
+	var session Session
+	if err := json.Unmarshal(sessionJSON, &session); err != nil {
+		return nil, errors.Wrap(err, "failed to parse session")
+	}
+
+	asContract, err := fabric.NewAuthServerContract(dm.fabricClient)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get AS contract")
+	}
+	tgsContract, err := fabric.NewTicketGrantingContract(dm.fabricClient)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get TGS contract")
+	}
+	cm := &ClientManager{
+		fabricClient: dm.fabricClient,
+		asContract:   asContract,
+		tgsContract:  tgsContract,
+		identity:     dm.identity,
+	}
+
+	serviceTicket, err := cm.GetServiceTicket(clientID, deviceID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get service ticket")
+	}
+	tgt, err := cm.GetTGT(clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Continue the flow the session was opened in
+	flow := NewFlow("session renewal of " + clientID + " with " + deviceID)
+	endFlow, err := flow.Trace(dm.fabricClient, serviceTicket[flowIDField])
+	if err != nil {
+		return nil, err
+	}
+	defer endFlow()
+
+	if tgtExpiresWithin(tgt, tgtRenewalMargin, time.Now()) {
+		if _, err := cm.RenewTGT(clientID); err != nil {
+			return nil, errors.Wrap(err, "failed to renew TGT")
+		}
+	}
+	renewedTicket, err := cm.RenewServiceTicket(clientID, deviceID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to renew service ticket")
+	}
+
+	renewed, err := dm.isvContract.RenewSession(session.SessionID, renewedTicket["encryptedServiceTicket"])
+	if err != nil {
+		return nil, err
+	}
+	if expiresAt, ok := renewed["expiresAt"].(string); ok {
+		session.ExpiresAt = expiresAt
+	}
+
+	sessionJSON, err = json.Marshal(session)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal session")
+	}
+	if err := ioutil.WriteFile(sessionFile, sessionJSON, 0600); err != nil {
+		return nil, errors.Wrap(err, "failed to save session to file")
+	}
+
+	log.Infof("Session %s with device %s renewed until %s", session.SessionID, deviceID, session.ExpiresAt)
+	return &session, nil
+}
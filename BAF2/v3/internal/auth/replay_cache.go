@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"github.com/chaichis-network/v3/internal/fabric"
+	"github.com/pkg/errors"
+)
+
+// ReplayCachePurge is what PurgeReplayCaches deleted from one chaincode's
+// replay cache
+type ReplayCachePurge struct {
+	Chaincode string `json:"chaincode"`
+	Purged    int    `json:"purged"`
+}
+
+// PurgeReplayCaches deletes the expired entries of the AS, TGS and ISV
+// replay caches, the records of used nonces, authenticators and service
+// tickets. Each chaincode deletes a bounded number per transaction, so a
+// cache is purged in as many transactions as it takes.
+func (dm *DeviceManager) PurgeReplayCaches() ([]ReplayCachePurge, error) {
+	asContract, err := fabric.NewAuthServerContract(dm.fabricClient)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get AS contract")
+	}
+	tgsContract, err := fabric.NewTicketGrantingContract(dm.fabricClient)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get TGS contract")
+	}
+
+	caches := []struct {
+		chaincode string
+		purge     func() (*fabric.ReplayPurgeResult, error)
+	}{
+		{"AS", asContract.PurgeReplayCache},
+		{"TGS", tgsContract.PurgeReplayCache},
+		{"ISV", dm.isvContract.PurgeReplayCache},
+	}
+
+	var purges []ReplayCachePurge
+	for _, cache := range caches {
+		purge := ReplayCachePurge{Chaincode: cache.chaincode}
+		for {
+			result, err := cache.purge()
+			if err != nil {
+				return purges, err
+			}
+			purge.Purged += result.Purged
+			if !result.More {
+				break
+			}
+		}
+		log.Debugf("Purged %d expired entries from the %s replay cache", purge.Purged, cache.chaincode)
+		purges = append(purges, purge)
+	}
+	return purges, nil
+}
@@ -0,0 +1,192 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/chaichis-network/v3/internal/crypto"
+	"github.com/pkg/errors"
+)
+
+// A warm standby server mirrors the files the active one keeps in its
+// working directory: TGTs, service tickets, device sessions, the session
+// directory, client and device keys and the ledger record. It can then take
+// over without every client authenticating again. ReplicationSource reports
+// the files written or removed on the active server, and
+// ApplyReplicationEvent writes them on the standby.
+//
+// The bolt session database is not mirrored; it cannot be copied safely
+// while it is open, so replication needs the file session store.
+
+// Types of replication event
+const (
+	// ReplicationFile carries the content of a written file
+	ReplicationFile = "file"
+	// ReplicationRemove names a removed file
+	ReplicationRemove = "remove"
+	// ReplicationSynced follows the files of the first scan
+	ReplicationSynced = "synced"
+	// ReplicationHeartbeat tells the standby the active server is alive
+	ReplicationHeartbeat = "heartbeat"
+	// ReplicationDashboard carries the active server's latest dashboard
+	ReplicationDashboard = "dashboard"
+)
+
+// replicatedSessionDir stands for the session directory in event paths, so
+// the two servers may keep their sessions in different directories
+const replicatedSessionDir = "sessions"
+
+// ReplicationEvent is one change sent from the active server to a standby
+type ReplicationEvent struct {
+	Type      string      `json:"type"`
+	Path      string      `json:"path,omitempty"` // Relative to the working directory, see replicatedSessionDir
+	Data      []byte      `json:"data,omitempty"`
+	Mode      os.FileMode `json:"mode,omitempty"`
+	Dashboard *Dashboard  `json:"dashboard,omitempty"`
+	At        time.Time   `json:"at"`
+}
+
+// replicatedPatterns are the files a standby mirrors, by event path
+func replicatedPatterns() []string {
+	return []string{
+		"*-tgt.json",
+		"*-serviceticket-*.json",
+		"*-session-*.json",
+		LocalStateFile,
+		filepath.Join(replicatedSessionDir, "*.json"),
+		filepath.Join(crypto.KeyDir, "*"),
+	}
+}
+
+// ReplicationSource scans the replicated files of the active server and
+// reports what changed since the previous scan
+type ReplicationSource struct {
+	sessionDir string
+	digests    map[string][sha256.Size]byte
+}
+
+// NewReplicationSource returns a source whose first scan reports every
+// replicated file
+func NewReplicationSource(sessionDir string) *ReplicationSource {
+	return &ReplicationSource{
+		sessionDir: sessionDir,
+		digests:    make(map[string][sha256.Size]byte),
+	}
+}
+
+// localPath maps an event path to the file it names on this server
+func localPath(eventPath, sessionDir string) string {
+	if dir, name := filepath.Split(eventPath); filepath.Clean(dir) == replicatedSessionDir {
+		return filepath.Join(sessionDir, name)
+	}
+	return eventPath
+}
+
+// Changes scans the replicated files and returns an event for each file
+// written or removed since the last call
+func (r *ReplicationSource) Changes() ([]ReplicationEvent, error) {
+	now := time.Now().UTC()
+	current := make(map[string]bool)
+	var events []ReplicationEvent
+	for _, pattern := range replicatedPatterns() {
+		matches, err := filepath.Glob(localPath(pattern, r.sessionDir))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to search for %s", pattern)
+		}
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil || !info.Mode().IsRegular() || (strings.HasPrefix(filepath.Base(match), ".") && match != LocalStateFile) {
+				// Gone since the search, a directory, or a temporary file
+				continue
+			}
+			eventPath := match
+			if filepath.Dir(pattern) == replicatedSessionDir {
+				eventPath = filepath.Join(replicatedSessionDir, filepath.Base(match))
+			}
+			data, err := ioutil.ReadFile(match)
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to read %s", match)
+			}
+
+			current[eventPath] = true
+			digest := sha256.Sum256(data)
+			if previous, ok := r.digests[eventPath]; ok && previous == digest {
+				continue
+			}
+			r.digests[eventPath] = digest
+			events = append(events, ReplicationEvent{
+				Type: ReplicationFile,
+				Path: eventPath,
+				Data: data,
+				Mode: info.Mode().Perm(),
+				At:   now,
+			})
+		}
+	}
+
+	var removed []string
+	for eventPath := range r.digests {
+		if !current[eventPath] {
+			removed = append(removed, eventPath)
+		}
+	}
+	sort.Strings(removed)
+	for _, eventPath := range removed {
+		delete(r.digests, eventPath)
+		events = append(events, ReplicationEvent{Type: ReplicationRemove, Path: eventPath, At: now})
+	}
+	return events, nil
+}
+
+// ApplyReplicationEvent writes or removes the file of a file or remove
+// event on the standby. Paths outside the replicated files are refused.
+func ApplyReplicationEvent(event ReplicationEvent, sessionDir string) error {
+	if event.Type != ReplicationFile && event.Type != ReplicationRemove {
+		return nil
+	}
+	if !isReplicatedPath(event.Path) {
+		return errors.Errorf("refusing to replicate %q: not a replicated file", event.Path)
+	}
+	path := localPath(event.Path, sessionDir)
+
+	if event.Type == ReplicationRemove {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return errors.Wrapf(err, "failed to remove %s", path)
+		}
+		return nil
+	}
+
+	mode := event.Mode.Perm()
+	if mode == 0 {
+		mode = 0600
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return errors.Wrapf(err, "failed to create directory of %s", path)
+	}
+	if err := writeFileAtomic(path, event.Data, mode); err != nil {
+		return errors.Wrapf(err, "failed to write %s", path)
+	}
+	return nil
+}
+
+// isReplicatedPath reports whether an event path names a replicated file,
+// and no file outside the working directory
+func isReplicatedPath(eventPath string) bool {
+	if eventPath == "" || filepath.IsAbs(eventPath) || filepath.Clean(eventPath) != eventPath || strings.HasPrefix(eventPath, "..") {
+		return false
+	}
+	for _, pattern := range replicatedPatterns() {
+		if matched, _ := filepath.Match(pattern, eventPath); matched {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,232 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/chaichis-network/v3/internal/fabric"
+	"github.com/pkg/errors"
+)
+
+// RevocationOptions controls a bulk revocation
+type RevocationOptions struct {
+	Reason    string
+	BatchSize int     // Devices per transaction, at most fabric.MaxRevocationBatch
+	Rate      float64 // Transactions per second; 0 submits batches back to back
+	// Checkpoint is the file progress is saved to after every batch
+	Checkpoint string
+	// MaxRetries is how often a failing batch is retried, with backoff,
+	// before the revocation stops
+	MaxRetries int
+}
+
+// RevocationCheckpoint is the progress of a bulk revocation. It is saved
+// after every committed batch, so an interrupted revocation resumes at the
+// first batch that did not commit.
+type RevocationCheckpoint struct {
+	Digest         string    `json:"digest"` // SHA-256 of the device list
+	Reason         string    `json:"reason"`
+	Total          int       `json:"total"`
+	Done           int       `json:"done"` // Devices in committed batches
+	Batches        int       `json:"batches"`
+	Revoked        int       `json:"revoked"`
+	AlreadyRevoked int       `json:"alreadyRevoked"`
+	ClosedSessions int       `json:"closedSessions"`
+	NotFound       []string  `json:"notFound,omitempty"`
+	Denied         []string  `json:"denied,omitempty"`
+	UpdatedAt      time.Time `json:"updatedAt"`
+}
+
+// Complete reports whether every device has been processed
+func (c *RevocationCheckpoint) Complete() bool {
+	return c.Done >= c.Total
+}
+
+// ReadDeviceIDs reads device IDs, one per line. Blank lines and lines
+// starting with # are skipped, and duplicates are dropped.
+func ReadDeviceIDs(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open device list")
+	}
+	defer file.Close()
+
+	var deviceIDs []string
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		deviceID := strings.TrimSpace(scanner.Text())
+		if deviceID == "" || strings.HasPrefix(deviceID, "#") || seen[deviceID] {
+			continue
+		}
+		seen[deviceID] = true
+		deviceIDs = append(deviceIDs, deviceID)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to read device list")
+	}
+	return deviceIDs, nil
+}
+
+// deviceListDigest identifies a device list, so a checkpoint is not resumed
+// against a different one
+func deviceListDigest(deviceIDs []string) string {
+	sum := sha256.Sum256([]byte(strings.Join(deviceIDs, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// LoadRevocationCheckpoint returns the saved progress of revoking
+// deviceIDs, or a fresh checkpoint if none is saved. A checkpoint for a
+// different device list or reason is an error.
+func LoadRevocationCheckpoint(path string, deviceIDs []string, reason string) (*RevocationCheckpoint, error) {
+	fresh := &RevocationCheckpoint{
+		Digest: deviceListDigest(deviceIDs),
+		Reason: reason,
+		Total:  len(deviceIDs),
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return fresh, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read checkpoint")
+	}
+
+	var checkpoint RevocationCheckpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return nil, errors.Wrapf(err, "invalid checkpoint %s", path)
+	}
+	if checkpoint.Digest != fresh.Digest || checkpoint.Total != fresh.Total {
+		return nil, errors.Errorf("checkpoint %s is for a different device list", path)
+	}
+	if checkpoint.Reason != reason {
+		return nil, errors.Errorf("checkpoint %s was started with reason %q", path, checkpoint.Reason)
+	}
+	return &checkpoint, nil
+}
+
+// save writes the checkpoint through a temporary file, so an interruption
+// never leaves a partial checkpoint behind
+func (c *RevocationCheckpoint) save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal checkpoint")
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".checkpoint-*")
+	if err != nil {
+		return errors.Wrap(err, "failed to save checkpoint")
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "failed to save checkpoint")
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrap(err, "failed to save checkpoint")
+	}
+	return errors.Wrap(os.Rename(tmp.Name(), path), "failed to save checkpoint")
+}
+
+// RevokeDevices revokes deviceIDs in batches, starting after the devices
+// checkpoint already covers. Batches are paced to options.Rate so a large
+// revocation does not flood the orderer, and a failing batch is retried
+// with exponential backoff. The checkpoint is saved after every batch;
+// onBatch, if set, is called with it. On error the checkpoint holds the
+// progress to resume from.
+func (dm *DeviceManager) RevokeDevices(deviceIDs []string, checkpoint *RevocationCheckpoint, options RevocationOptions, onBatch func(*RevocationCheckpoint)) error {
+	if options.BatchSize <= 0 || options.BatchSize > fabric.MaxRevocationBatch {
+		return errors.Errorf("batch size must be between 1 and %d", fabric.MaxRevocationBatch)
+	}
+	var interval time.Duration
+	if options.Rate > 0 {
+		interval = time.Duration(float64(time.Second) / options.Rate)
+	}
+
+	var lastSubmit time.Time
+	for !checkpoint.Complete() {
+		end := checkpoint.Done + options.BatchSize
+		if end > len(deviceIDs) {
+			end = len(deviceIDs)
+		}
+		batch := deviceIDs[checkpoint.Done:end]
+
+		var result *fabric.RevocationResult
+		backoff := interval
+		if backoff < time.Second {
+			backoff = time.Second
+		}
+		for attempt := 0; ; attempt++ {
+			if wait := time.Until(lastSubmit.Add(interval)); wait > 0 {
+				time.Sleep(wait)
+			}
+			lastSubmit = time.Now()
+
+			var err error
+			result, err = dm.isvContract.RevokeDevices(batch, options.Reason)
+			if err == nil {
+				break
+			}
+			if attempt >= options.MaxRetries {
+				return errors.Wrapf(err, "batch at device %d of %d failed", checkpoint.Done+1, checkpoint.Total)
+			}
+			log.Warnf("Revocation batch at device %d failed, retrying in %s: %v", checkpoint.Done+1, backoff, err)
+			time.Sleep(backoff)
+			if backoff *= 2; backoff > time.Minute {
+				backoff = time.Minute
+			}
+		}
+
+		checkpoint.Done = end
+		checkpoint.Batches++
+		checkpoint.Revoked += len(result.Revoked)
+		checkpoint.AlreadyRevoked += len(result.AlreadyRevoked)
+		checkpoint.ClosedSessions += len(result.ClosedSessions)
+		checkpoint.NotFound = append(checkpoint.NotFound, result.NotFound...)
+		checkpoint.Denied = append(checkpoint.Denied, result.Denied...)
+		checkpoint.UpdatedAt = time.Now().UTC()
+		if options.Checkpoint != "" {
+			if err := checkpoint.save(options.Checkpoint); err != nil {
+				return err
+			}
+		}
+		if onBatch != nil {
+			onBatch(checkpoint)
+		}
+	}
+	return nil
+}
+
+// ClientRevocation reports the revocation of a client at the TGS and the
+// ISV
+type ClientRevocation struct {
+	TGTs    *fabric.ClientRevocation `json:"tgts"`
+	Tickets *fabric.ClientRevocation `json:"tickets"`
+}
+
+// RevokeClient cuts a client off: the TGS refuses its TGTs from now on,
+// and the ISV refuses the service tickets it holds and closes its sessions.
+// The TGTs are revoked first so the client cannot get new tickets in
+// between; if the ISV step fails, running RevokeClient again completes it.
+func (dm *DeviceManager) RevokeClient(clientID, reason string) (*ClientRevocation, error) {
+	tgsContract, err := fabric.NewTicketGrantingContract(dm.fabricClient)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get TGS contract")
+	}
+
+	revocation := &ClientRevocation{}
+	if revocation.TGTs, err = tgsContract.RevokeTGT(clientID, reason); err != nil {
+		return nil, err
+	}
+	if revocation.Tickets, err = dm.isvContract.RevokeServiceTicket(clientID, reason); err != nil {
+		return nil, errors.Wrap(err, "TGTs revoked but service tickets were not")
+	}
+	return revocation, nil
+}
@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+
+	"github.com/chaichis-network/v3/internal/fabric"
+	"github.com/pkg/errors"
+)
+
+// stepUpCodePrefix marks one-time step-up codes so they are recognisable
+const stepUpCodePrefix = "otp_"
+
+// SetSourceIP sets the source IP reported to the AS risk policy when
+// authenticating. Gateways fill this in from the request they received.
+func (cm *ClientManager) SetSourceIP(sourceIP string) {
+	cm.sourceIP = sourceIP
+}
+
+// SetStepUpCode sets the one-time code used to complete an OTP step-up if
+// the AS risk policy asks for one
+func (cm *ClientManager) SetStepUpCode(code string) {
+	cm.stepUpCode = code
+}
+
+// handleRiskDecision completes, waits for or explains a step-up required by
+// the AS
+func (cm *ClientManager) handleRiskDecision(clientID string, decision *fabric.RiskDecision) error {
+	if decision == nil || decision.Action != "step_up" {
+		return nil
+	}
+	
+	log.Warnf("Risk policy requires %s step-up for client %s: %s", decision.StepUp, clientID, strings.Join(decision.Reasons, "; "))
+	if cm.stepUpCode != "" {
+		if err := cm.asContract.CompleteStepUp(clientID, cm.stepUpCode); err != nil {
+			return errors.Wrap(err, "failed to complete step-up")
+		}
+		return nil
+	}
+	
+	switch decision.StepUp {
+	case "push":
+		if cm.pushWait > 0 {
+			return cm.waitForPushAnswer(clientID)
+		}
+		log.Warnf("Approve the attempt in the app registered for client %s, or authenticate again with --push-wait to wait for it", clientID)
+	case "otp":
+		log.Warnf("Ask an admin for a one-time code ('authcli risk issue-code --client-id %s') and authenticate again with --otp", clientID)
+	case "admin":
+		log.Warnf("Ask an admin to run 'authcli risk approve --client-id %s', then authenticate again", clientID)
+	}
+	return nil
+}
+
+// SetRiskPolicy stores the AS risk policy
+func (cm *ClientManager) SetRiskPolicy(policyJSON []byte) error {
+	if err := cm.asContract.SetRiskPolicy(string(policyJSON)); err != nil {
+		return err
+	}
+	
+	log.Info("Risk policy updated")
+	return nil
+}
+
+// GetRiskPolicy returns the AS risk policy, or nil if none is set
+func (cm *ClientManager) GetRiskPolicy() (map[string]interface{}, error) {
+	return cm.asContract.GetRiskPolicy()
+}
+
+// RiskDecisions returns the risk decisions recorded for a client
+func (cm *ClientManager) RiskDecisions(clientID string) ([]fabric.RiskDecision, error) {
+	return cm.asContract.GetRiskDecisions(clientID)
+}
+
+// IssueStepUpCode mints a one-time code for a client's pending OTP step-up.
+// The ledger stores only its hash; the returned code must be handed to the
+// client out of band.
+func (cm *ClientManager) IssueStepUpCode(clientID string) (string, error) {
+	random := make([]byte, 12)
+	if _, err := rand.Read(random); err != nil {
+		return "", errors.Wrap(err, "failed to generate step-up code")
+	}
+	code := stepUpCodePrefix + base64.RawURLEncoding.EncodeToString(random)
+	
+	if err := cm.asContract.IssueStepUpCode(clientID, hashAccessCode(code)); err != nil {
+		return "", err
+	}
+	
+	log.Infof("Issued step-up code for client %s", clientID)
+	return code, nil
+}
+
+// ApproveStepUp approves a client's pending step-up
+func (cm *ClientManager) ApproveStepUp(clientID string) error {
+	if err := cm.asContract.ApproveStepUp(clientID); err != nil {
+		return err
+	}
+	
+	log.Infof("Approved step-up for client %s", clientID)
+	return nil
+}
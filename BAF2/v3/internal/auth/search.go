@@ -0,0 +1,13 @@
+package auth
+
+import "github.com/chaichis-network/v3/internal/fabric"
+
+// SearchDevices returns one page of devices matching filter
+func (dm *DeviceManager) SearchDevices(filter fabric.SearchFilter) (*fabric.DeviceSearchPage, error) {
+	return dm.isvContract.SearchDevices(filter)
+}
+
+// SearchClients returns one page of client registrations matching filter
+func (cm *ClientManager) SearchClients(filter fabric.SearchFilter) (*fabric.ClientSearchPage, error) {
+	return cm.asContract.SearchClients(filter)
+}
@@ -0,0 +1,31 @@
+package auth
+
+import (
+	"strings"
+
+	"github.com/chaichis-network/v3/internal/fabric"
+)
+
+// RunSelfTests runs the self-test of the three chaincodes, in startup order.
+// A chaincode that cannot run it, for example because it is not deployed or
+// predates SelfTest, gets a failed report with the error. Every report must
+// pass before the system is declared operational after a deployment or a
+// key rollover.
+func RunSelfTests(fabricClient *fabric.Client) ([]*fabric.SelfTestReport, error) {
+	var reports []*fabric.SelfTestReport
+	for _, chaincode := range keyCeremonyServices {
+		contract, err := fabricClient.GetContract(chaincode.contractID)
+		if err != nil {
+			return nil, err
+		}
+		report, err := fabricClient.SelfTest(contract)
+		if err != nil {
+			report = &fabric.SelfTestReport{
+				Service: strings.ToUpper(chaincode.service),
+				Checks:  []fabric.SelfTestCheck{{Name: "self_test", Status: fabric.SelfTestFail, Detail: err.Error()}},
+			}
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
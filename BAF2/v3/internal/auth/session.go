@@ -6,214 +6,256 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sync"
 
 	"github.com/pkg/errors"
 )
 
-// SessionManager manages sessions between clients and devices
-type SessionManager struct {
-	sessionDir string
+// SessionStore keeps the device sessions a client has opened, so that
+// later invocations can find and close them. Implementations are safe for
+// concurrent use by goroutines and, for the file and bolt backends, by
+// concurrent processes sharing the store.
+type SessionStore interface {
+	// SaveSession stores a session, replacing one with the same ID
+	SaveSession(session *Session) error
+	// GetSession returns the session of a client and device
+	GetSession(clientID, deviceID string) (*Session, error)
+	// GetSessionByID returns a session by its ID
+	GetSessionByID(sessionID string) (*Session, error)
+	// RemoveSession removes the sessions of a client and device
+	RemoveSession(clientID, deviceID string) error
+	// RemoveSessionByID removes a session by its ID
+	RemoveSessionByID(sessionID string) error
+	// ListActiveSessions returns every stored session
+	ListActiveSessions() ([]*Session, error)
+	// GetActiveSessionsForClient returns the stored sessions of a client
+	GetActiveSessionsForClient(clientID string) ([]*Session, error)
 }
 
-// NewSessionManager creates a new session manager
-func NewSessionManager(sessionDir string) *SessionManager {
-	// Use default directory if not provided
-	if sessionDir == "" {
-		sessionDir = "sessions"
+// Session store backends
+const (
+	SessionBackendFile   = "file"
+	SessionBackendBolt   = "bolt"
+	SessionBackendMemory = "memory"
+)
+
+// BoltSessionFile is the database of the bolt backend in the session
+// directory
+const BoltSessionFile = "sessions.db"
+
+// OpenSessionStore opens the session store of a backend in dir: one JSON
+// file per session for file, the BoltSessionFile database for bolt. The
+// memory backend ignores dir and keeps sessions for the life of the process.
+func OpenSessionStore(backend, dir string) (SessionStore, error) {
+	switch backend {
+	case SessionBackendFile, "":
+		store, err := NewFileSessionStore(dir)
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+	case SessionBackendBolt:
+		return openBoltSessionStore(dir)
+	case SessionBackendMemory:
+		return NewMemorySessionStore(), nil
+	}
+	return nil, errors.Errorf("unknown session store %q (expected %s, %s or %s)", backend, SessionBackendFile, SessionBackendBolt, SessionBackendMemory)
+}
+
+// FileSessionStore keeps each session in its own file,
+// <client>-<device>-<session>.json, in a directory. Every operation holds an
+// exclusive lock on the directory's lock file, so concurrent processes never
+// see half of another's change, and sessions are written to a temporary file
+// renamed into place, so a crash leaves either the old or the new session.
+type FileSessionStore struct {
+	dir string
+	// mu serializes the goroutines of this process; the lock file, the
+	// processes sharing the directory
+	mu sync.Mutex
+}
+
+// sessionLockFile is the lock file in a session directory
+const sessionLockFile = ".lock"
+
+// NewFileSessionStore opens the session directory dir, "sessions" if
+// empty, creating it if needed
+func NewFileSessionStore(dir string) (*FileSessionStore, error) {
+	if dir == "" {
+		dir = "sessions"
 	}
-	
-	// Create session directory if it doesn't exist
-	if _, err := os.Stat(sessionDir); os.IsNotExist(err) {
-		os.MkdirAll(sessionDir, 0755)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Wrap(err, "failed to create session directory")
 	}
-	
-	return &SessionManager{
-		sessionDir: sessionDir,
+	return &FileSessionStore{dir: dir}, nil
+}
+
+// withLock runs fn holding the store's lock
+func (fs *FileSessionStore) withLock(fn func() error) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	lock, err := os.OpenFile(filepath.Join(fs.dir, sessionLockFile), os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return errors.Wrap(err, "failed to open session lock")
+	}
+	defer lock.Close()
+	if err := lockFile(lock); err != nil {
+		return errors.Wrap(err, "failed to lock session directory")
 	}
+	defer unlockFile(lock)
+
+	return fn()
 }
 
 // SaveSession saves a session to a file
-func (sm *SessionManager) SaveSession(session *Session) error {
+func (fs *FileSessionStore) SaveSession(session *Session) error {
 	sessionJSON, err := json.Marshal(session)
 	if err != nil {
 		return errors.Wrap(err, "failed to marshal session")
 	}
-	
-	// Create filename
 	filename := fmt.Sprintf("%s-%s-%s.json", session.ClientID, session.DeviceID, session.SessionID)
-	sessionPath := filepath.Join(sm.sessionDir, filename)
-	
-	// Save session file
-	if err := ioutil.WriteFile(sessionPath, sessionJSON, 0600); err != nil {
-		return errors.Wrap(err, "failed to save session file")
-	}
-	
-	return nil
+
+	return fs.withLock(func() error {
+		if err := writeFileAtomic(filepath.Join(fs.dir, filename), sessionJSON, 0600); err != nil {
+			return errors.Wrap(err, "failed to save session file")
+		}
+		return nil
+	})
 }
 
 // GetSession retrieves a session for a client and device
-func (sm *SessionManager) GetSession(clientID, deviceID string) (*Session, error) {
-	// Find matching session file
-	pattern := filepath.Join(sm.sessionDir, fmt.Sprintf("%s-%s-*.json", clientID, deviceID))
-	matches, err := filepath.Glob(pattern)
+func (fs *FileSessionStore) GetSession(clientID, deviceID string) (*Session, error) {
+	var sessions []*Session
+	err := fs.withLock(func() error {
+		var err error
+		sessions, _, err = fs.find(fmt.Sprintf("%s-%s-*.json", clientID, deviceID), func(session *Session) bool {
+			return session.ClientID == clientID && session.DeviceID == deviceID
+		})
+		return err
+	})
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to search for session files")
+		return nil, err
 	}
-	
-	if len(matches) == 0 {
+	if len(sessions) == 0 {
 		return nil, errors.Errorf("no active session found for client %s and device %s", clientID, deviceID)
 	}
-	
-	// Use the first match (there should only be one active session per client-device pair)
-	sessionPath := matches[0]
-	
-	// Read session file
-	sessionJSON, err := ioutil.ReadFile(sessionPath)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to read session file")
-	}
-	
-	// Parse session
-	var session Session
-	if err := json.Unmarshal(sessionJSON, &session); err != nil {
-		return nil, errors.Wrap(err, "failed to parse session")
-	}
-	
-	return &session, nil
+	// There should only be one active session per client-device pair
+	return sessions[0], nil
 }
 
 // GetSessionByID retrieves a session by its ID
-func (sm *SessionManager) GetSessionByID(sessionID string) (*Session, error) {
-	// Find matching session file
-	pattern := filepath.Join(sm.sessionDir, fmt.Sprintf("*-*-%s.json", sessionID))
-	matches, err := filepath.Glob(pattern)
+func (fs *FileSessionStore) GetSessionByID(sessionID string) (*Session, error) {
+	var sessions []*Session
+	err := fs.withLock(func() error {
+		var err error
+		sessions, _, err = fs.find(fmt.Sprintf("*-*-%s.json", sessionID), func(session *Session) bool {
+			return session.SessionID == sessionID
+		})
+		return err
+	})
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to search for session file")
+		return nil, err
 	}
-	
-	if len(matches) == 0 {
+	if len(sessions) == 0 {
 		return nil, errors.Errorf("session %s not found", sessionID)
 	}
-	
-	// Read session file
-	sessionPath := matches[0]
-	sessionJSON, err := ioutil.ReadFile(sessionPath)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to read session file")
-	}
-	
-	// Parse session
-	var session Session
-	if err := json.Unmarshal(sessionJSON, &session); err != nil {
-		return nil, errors.Wrap(err, "failed to parse session")
-	}
-	
-	return &session, nil
+	return sessions[0], nil
 }
 
-// RemoveSession removes a session file
-func (sm *SessionManager) RemoveSession(clientID, deviceID string) error {
-	// Find matching session file
-	pattern := filepath.Join(sm.sessionDir, fmt.Sprintf("%s-%s-*.json", clientID, deviceID))
-	matches, err := filepath.Glob(pattern)
-	if err != nil {
-		return errors.Wrap(err, "failed to search for session files")
-	}
-	
-	if len(matches) == 0 {
-		return errors.Errorf("no active session found for client %s and device %s", clientID, deviceID)
-	}
-	
-	// Remove all matching files (should only be one)
-	for _, sessionPath := range matches {
-		if err := os.Remove(sessionPath); err != nil {
-			return errors.Wrap(err, "failed to remove session file")
+// RemoveSession removes the session files of a client and device
+func (fs *FileSessionStore) RemoveSession(clientID, deviceID string) error {
+	return fs.withLock(func() error {
+		_, paths, err := fs.find(fmt.Sprintf("%s-%s-*.json", clientID, deviceID), func(session *Session) bool {
+			return session.ClientID == clientID && session.DeviceID == deviceID
+		})
+		if err != nil {
+			return err
 		}
-	}
-	
-	return nil
+		if len(paths) == 0 {
+			return errors.Errorf("no active session found for client %s and device %s", clientID, deviceID)
+		}
+		return removeSessionFiles(paths)
+	})
 }
 
 // RemoveSessionByID removes a session file by its ID
-func (sm *SessionManager) RemoveSessionByID(sessionID string) error {
-	// Find matching session file
-	pattern := filepath.Join(sm.sessionDir, fmt.Sprintf("*-*-%s.json", sessionID))
-	matches, err := filepath.Glob(pattern)
-	if err != nil {
-		return errors.Wrap(err, "failed to search for session file")
-	}
-	
-	if len(matches) == 0 {
-		return errors.Errorf("session %s not found", sessionID)
-	}
-	
-	// Remove session file
-	sessionPath := matches[0]
-	if err := os.Remove(sessionPath); err != nil {
-		return errors.Wrap(err, "failed to remove session file")
-	}
-	
-	return nil
+func (fs *FileSessionStore) RemoveSessionByID(sessionID string) error {
+	return fs.withLock(func() error {
+		_, paths, err := fs.find(fmt.Sprintf("*-*-%s.json", sessionID), func(session *Session) bool {
+			return session.SessionID == sessionID
+		})
+		if err != nil {
+			return err
+		}
+		if len(paths) == 0 {
+			return errors.Errorf("session %s not found", sessionID)
+		}
+		return removeSessionFiles(paths)
+	})
 }
 
 // ListActiveSessions lists all active sessions
-func (sm *SessionManager) ListActiveSessions() ([]*Session, error) {
-	// Find all session files
-	pattern := filepath.Join(sm.sessionDir, "*.json")
-	matches, err := filepath.Glob(pattern)
+func (fs *FileSessionStore) ListActiveSessions() ([]*Session, error) {
+	var sessions []*Session
+	err := fs.withLock(func() error {
+		var err error
+		sessions, _, err = fs.find("*.json", func(session *Session) bool {
+			return session.SessionID != ""
+		})
+		return err
+	})
+	return sessions, err
+}
+
+// GetActiveSessionsForClient lists all active sessions for a client
+func (fs *FileSessionStore) GetActiveSessionsForClient(clientID string) ([]*Session, error) {
+	var sessions []*Session
+	err := fs.withLock(func() error {
+		var err error
+		sessions, _, err = fs.find(fmt.Sprintf("%s-*.json", clientID), func(session *Session) bool {
+			return session.ClientID == clientID
+		})
+		return err
+	})
+	return sessions, err
+}
+
+// find reads the session files matching pattern and returns the sessions
+// match accepts, with their paths. IDs may contain dashes, so the file name
+// alone does not identify the client and device. Unreadable files are
+// skipped with a warning. The caller holds the lock.
+func (fs *FileSessionStore) find(pattern string, match func(*Session) bool) ([]*Session, []string, error) {
+	matches, err := filepath.Glob(filepath.Join(fs.dir, pattern))
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to search for session files")
+		return nil, nil, errors.Wrap(err, "failed to search for session files")
 	}
-	
+
 	sessions := make([]*Session, 0, len(matches))
-	
-	// Parse each session file
+	var paths []string
 	for _, sessionPath := range matches {
 		sessionJSON, err := ioutil.ReadFile(sessionPath)
 		if err != nil {
 			log.Warnf("Failed to read session file %s: %v", sessionPath, err)
 			continue
 		}
-		
 		var session Session
 		if err := json.Unmarshal(sessionJSON, &session); err != nil {
 			log.Warnf("Failed to parse session file %s: %v", sessionPath, err)
 			continue
 		}
-		
-		sessions = append(sessions, &session)
+		if match(&session) {
+			sessions = append(sessions, &session)
+			paths = append(paths, sessionPath)
+		}
 	}
-	
-	return sessions, nil
+	return sessions, paths, nil
 }
 
-// GetActiveSessionsForClient lists all active sessions for a client
-func (sm *SessionManager) GetActiveSessionsForClient(clientID string) ([]*Session, error) {
-	// Find matching session files
-	pattern := filepath.Join(sm.sessionDir, fmt.Sprintf("%s-*.json", clientID))
-	matches, err := filepath.Glob(pattern)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to search for session files")
-	}
-	
-	sessions := make([]*Session, 0, len(matches))
-	
-	// Parse each session file
-	for _, sessionPath := range matches {
-		sessionJSON, err := ioutil.ReadFile(sessionPath)
-		if err != nil {
-			log.Warnf("Failed to read session file %s: %v", sessionPath, err)
-			continue
-		}
-		
-		var session Session
-		if err := json.Unmarshal(sessionJSON, &session); err != nil {
-			log.Warnf("Failed to parse session file %s: %v", sessionPath, err)
-			continue
+func removeSessionFiles(paths []string) error {
+	for _, sessionPath := range paths {
+		if err := os.Remove(sessionPath); err != nil {
+			return errors.Wrap(err, "failed to remove session file")
 		}
-		
-		sessions = append(sessions, &session)
 	}
-	
-	return sessions, nil
+	return nil
 }
@@ -0,0 +1,143 @@
+package auth
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// SessionCloseResult is the outcome of closing one session in a batch
+type SessionCloseResult struct {
+	SessionID string `json:"sessionID"`
+	ClientID  string `json:"clientID"`
+	DeviceID  string `json:"deviceID"`
+	// LocalOnly is set for stored sessions with no active session on the ledger
+	LocalOnly bool   `json:"localOnly,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// BatchCloseSummary reports the outcome of CloseSessions
+type BatchCloseSummary struct {
+	Results []SessionCloseResult `json:"results"`
+	Closed  int                  `json:"closed"`
+	Failed  int                  `json:"failed"`
+}
+
+// CloseSessions closes every session matching a client, a device or both,
+// on the ledger and in the local session store. One failing session does
+// not stop the others; the summary lists each outcome. onResult, if set, is
+// called as each session is processed.
+func (dm *DeviceManager) CloseSessions(clientID, deviceID string, sessions SessionStore, onResult func(SessionCloseResult)) (*BatchCloseSummary, error) {
+	targets, err := dm.FindSessions(clientID, deviceID, sessions)
+	if err != nil {
+		return nil, err
+	}
+	return dm.CloseSessionTargets(targets, sessions, onResult), nil
+}
+
+// FindSessions lists the sessions CloseSessions would close: active sessions
+// on the ledger, then locally stored sessions with no active ledger session
+func (dm *DeviceManager) FindSessions(clientID, deviceID string, sessions SessionStore) ([]SessionCloseResult, error) {
+	if clientID == "" && deviceID == "" {
+		return nil, errors.New("a client ID or a device ID is required")
+	}
+
+	// Enumerate active sessions on the ledger
+	var ledgerSessions []map[string]interface{}
+	var err error
+	if clientID != "" {
+		ledgerSessions, err = dm.isvContract.GetActiveSessionsByClient(clientID)
+	} else {
+		ledgerSessions, err = dm.isvContract.GetActiveSessionsByDevice(deviceID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var targets []SessionCloseResult
+	onLedger := make(map[string]bool)
+	for _, ledgerSession := range ledgerSessions {
+		target := SessionCloseResult{}
+		target.SessionID, _ = ledgerSession["sessionID"].(string)
+		target.ClientID, _ = ledgerSession["clientID"].(string)
+		target.DeviceID, _ = ledgerSession["deviceID"].(string)
+		if !matchesSession(target.ClientID, target.DeviceID, clientID, deviceID) {
+			continue
+		}
+		onLedger[target.SessionID] = true
+		targets = append(targets, target)
+	}
+
+	// Stored sessions that are no longer active are cleaned up too
+	localSessions, err := sessions.ListActiveSessions()
+	if err != nil {
+		return nil, err
+	}
+	for _, session := range localSessions {
+		if onLedger[session.SessionID] || !matchesSession(session.ClientID, session.DeviceID, clientID, deviceID) {
+			continue
+		}
+		onLedger[session.SessionID] = true
+		targets = append(targets, SessionCloseResult{
+			SessionID: session.SessionID,
+			ClientID:  session.ClientID,
+			DeviceID:  session.DeviceID,
+			LocalOnly: true,
+		})
+	}
+	return targets, nil
+}
+
+// CloseSessionTargets closes sessions found by FindSessions
+func (dm *DeviceManager) CloseSessionTargets(targets []SessionCloseResult, sessions SessionStore, onResult func(SessionCloseResult)) *BatchCloseSummary {
+	summary := &BatchCloseSummary{Results: make([]SessionCloseResult, 0, len(targets))}
+	for _, result := range targets {
+		if !result.LocalOnly {
+			if err := dm.isvContract.CloseSession(result.SessionID); err != nil {
+				result.Error = err.Error()
+			}
+		}
+		if result.Error == "" {
+			removeLocalSession(sessions, result)
+			summary.Closed++
+		} else {
+			summary.Failed++
+		}
+
+		summary.Results = append(summary.Results, result)
+		if onResult != nil {
+			onResult(result)
+		}
+	}
+
+	log.Infof("Closed %d sessions, %d failed", summary.Closed, summary.Failed)
+	return summary
+}
+
+func matchesSession(sessionClientID, sessionDeviceID, clientID, deviceID string) bool {
+	return (clientID == "" || sessionClientID == clientID) && (deviceID == "" || sessionDeviceID == deviceID)
+}
+
+// removeLocalSession removes the session store entry and the
+// working-directory session file written by AccessDevice, if it belongs to
+// this session
+func removeLocalSession(sessions SessionStore, result SessionCloseResult) {
+	if err := sessions.RemoveSessionByID(result.SessionID); err != nil {
+		log.Debugf("No session directory entry for %s: %v", result.SessionID, err)
+	}
+
+	sessionFile := result.ClientID + "-session-" + result.DeviceID + ".json"
+	sessionJSON, err := ioutil.ReadFile(sessionFile)
+	if err != nil {
+		return
+	}
+	var session Session
+	if err := json.Unmarshal(sessionJSON, &session); err != nil || session.SessionID != result.SessionID {
+		return
+	}
+	if err := os.Remove(sessionFile); err != nil {
+		log.Warnf("Failed to remove session file: %v", err)
+	}
+}
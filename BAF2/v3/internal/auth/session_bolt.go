@@ -0,0 +1,202 @@
+package auth
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+// BoltSessionStore keeps sessions in a BoltDB database, one record per
+// session ID. Each operation opens the database, which BoltDB locks for the
+// process, and closes it again, so concurrent processes take turns instead
+// of one holding the store for its whole run. Updates are transactional.
+type BoltSessionStore struct {
+	path string
+}
+
+var sessionBucket = []byte("sessions")
+
+// boltLockTimeout is how long an operation waits for another process to
+// release the database
+const boltLockTimeout = 10 * time.Second
+
+// NewBoltSessionStore opens the BoltSessionFile database in dir, creating
+// both if needed
+func NewBoltSessionStore(dir string) (*BoltSessionStore, error) {
+	if dir == "" {
+		dir = "sessions"
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Wrap(err, "failed to create session directory")
+	}
+	store := &BoltSessionStore{path: filepath.Join(dir, BoltSessionFile)}
+	if err := store.update(func(*bolt.Bucket) error { return nil }); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+func openBoltSessionStore(dir string) (SessionStore, error) {
+	store, err := NewBoltSessionStore(dir)
+	if err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// open opens the database, waiting up to boltLockTimeout for other
+// processes
+func (bs *BoltSessionStore) open(readOnly bool) (*bolt.DB, error) {
+	db, err := bolt.Open(bs.path, 0600, &bolt.Options{Timeout: boltLockTimeout, ReadOnly: readOnly})
+	if err == bolt.ErrTimeout {
+		return nil, errors.Errorf("session store %s is locked by another process", bs.path)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open session store %s", bs.path)
+	}
+	return db, nil
+}
+
+// update runs fn in a read-write transaction on the session bucket
+func (bs *BoltSessionStore) update(fn func(*bolt.Bucket) error) error {
+	db, err := bs.open(false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(sessionBucket)
+		if err != nil {
+			return errors.Wrap(err, "failed to create session bucket")
+		}
+		return fn(bucket)
+	})
+}
+
+// filter returns the sessions match accepts, ordered like the files of a
+// FileSessionStore
+func (bs *BoltSessionStore) filter(match func(*Session) bool) ([]*Session, error) {
+	db, err := bs.open(true)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var sessions []*Session
+	err = db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(sessionBucket)
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(key, value []byte) error {
+			var session Session
+			if err := json.Unmarshal(value, &session); err != nil {
+				log.Warnf("Failed to parse session %s: %v", key, err)
+				return nil
+			}
+			if match(&session) {
+				sessions = append(sessions, &session)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sortSessions(sessions)
+	return sessions, nil
+}
+
+// SaveSession stores a session under its ID
+func (bs *BoltSessionStore) SaveSession(session *Session) error {
+	if session.SessionID == "" {
+		return errors.New("session has no ID")
+	}
+	sessionJSON, err := json.Marshal(session)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal session")
+	}
+	return bs.update(func(bucket *bolt.Bucket) error {
+		return bucket.Put([]byte(session.SessionID), sessionJSON)
+	})
+}
+
+// GetSession retrieves a session for a client and device
+func (bs *BoltSessionStore) GetSession(clientID, deviceID string) (*Session, error) {
+	sessions, err := bs.filter(func(session *Session) bool {
+		return session.ClientID == clientID && session.DeviceID == deviceID
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(sessions) == 0 {
+		return nil, errors.Errorf("no active session found for client %s and device %s", clientID, deviceID)
+	}
+	return sessions[0], nil
+}
+
+// GetSessionByID retrieves a session by its ID
+func (bs *BoltSessionStore) GetSessionByID(sessionID string) (*Session, error) {
+	sessions, err := bs.filter(func(session *Session) bool {
+		return session.SessionID == sessionID
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(sessions) == 0 {
+		return nil, errors.Errorf("session %s not found", sessionID)
+	}
+	return sessions[0], nil
+}
+
+// RemoveSession removes the sessions of a client and device
+func (bs *BoltSessionStore) RemoveSession(clientID, deviceID string) error {
+	return bs.update(func(bucket *bolt.Bucket) error {
+		var keys [][]byte
+		err := bucket.ForEach(func(key, value []byte) error {
+			var session Session
+			if json.Unmarshal(value, &session) == nil && session.ClientID == clientID && session.DeviceID == deviceID {
+				keys = append(keys, append([]byte(nil), key...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if len(keys) == 0 {
+			return errors.Errorf("no active session found for client %s and device %s", clientID, deviceID)
+		}
+		for _, key := range keys {
+			if err := bucket.Delete(key); err != nil {
+				return errors.Wrap(err, "failed to remove session")
+			}
+		}
+		return nil
+	})
+}
+
+// RemoveSessionByID removes a session by its ID
+func (bs *BoltSessionStore) RemoveSessionByID(sessionID string) error {
+	return bs.update(func(bucket *bolt.Bucket) error {
+		if bucket.Get([]byte(sessionID)) == nil {
+			return errors.Errorf("session %s not found", sessionID)
+		}
+		return bucket.Delete([]byte(sessionID))
+	})
+}
+
+// ListActiveSessions lists all sessions
+func (bs *BoltSessionStore) ListActiveSessions() ([]*Session, error) {
+	return bs.filter(func(*Session) bool { return true })
+}
+
+// GetActiveSessionsForClient lists the sessions of a client
+func (bs *BoltSessionStore) GetActiveSessionsForClient(clientID string) ([]*Session, error) {
+	return bs.filter(func(session *Session) bool {
+		return session.ClientID == clientID
+	})
+}
@@ -0,0 +1,50 @@
+package auth
+
+import "testing"
+
+func TestBoltSessionStoreReopen(t *testing.T) {
+	dir := t.TempDir()
+	store, err := OpenSessionStore(SessionBackendBolt, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session := &Session{
+		SessionID:     "session1",
+		ClientID:      "client1",
+		DeviceID:      "device1",
+		EstablishedAt: "2024-01-01T00:00:00Z",
+		ExpiresAt:     "2024-01-01T01:00:00Z",
+		Status:        "active",
+	}
+	if err := store.SaveSession(session); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each operation opens the database anew, so a second store sees what
+	// the first one saved
+	reopened, err := OpenSessionStore(SessionBackendBolt, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := reopened.GetSession("client1", "device1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *loaded != *session {
+		t.Fatalf("reloaded session %+v, want %+v", loaded, session)
+	}
+	if byID, err := reopened.GetSessionByID("session1"); err != nil || byID.DeviceID != "device1" {
+		t.Fatalf("GetSessionByID = %+v, %v", byID, err)
+	}
+
+	if err := reopened.RemoveSessionByID("session1"); err != nil {
+		t.Fatal(err)
+	}
+	sessions, err := store.ListActiveSessions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 0 {
+		t.Fatalf("%d sessions left after removal, want 0", len(sessions))
+	}
+}
@@ -0,0 +1,124 @@
+package auth
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// MemorySessionStore keeps sessions in memory, for the life of the process:
+// for servers embedding the framework and for runs that must leave nothing
+// behind
+type MemorySessionStore struct {
+	mu       sync.RWMutex
+	sessions map[string]Session // By session ID
+}
+
+// NewMemorySessionStore returns an empty in-memory session store
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{sessions: make(map[string]Session)}
+}
+
+// SaveSession stores a copy of a session
+func (ms *MemorySessionStore) SaveSession(session *Session) error {
+	if session.SessionID == "" {
+		return errors.New("session has no ID")
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.sessions[session.SessionID] = *session
+	return nil
+}
+
+// GetSession retrieves a session for a client and device
+func (ms *MemorySessionStore) GetSession(clientID, deviceID string) (*Session, error) {
+	sessions := ms.filter(func(session *Session) bool {
+		return session.ClientID == clientID && session.DeviceID == deviceID
+	})
+	if len(sessions) == 0 {
+		return nil, errors.Errorf("no active session found for client %s and device %s", clientID, deviceID)
+	}
+	return sessions[0], nil
+}
+
+// GetSessionByID retrieves a session by its ID
+func (ms *MemorySessionStore) GetSessionByID(sessionID string) (*Session, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	session, ok := ms.sessions[sessionID]
+	if !ok {
+		return nil, errors.Errorf("session %s not found", sessionID)
+	}
+	return &session, nil
+}
+
+// RemoveSession removes the sessions of a client and device
+func (ms *MemorySessionStore) RemoveSession(clientID, deviceID string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	removed := 0
+	for sessionID, session := range ms.sessions {
+		if session.ClientID == clientID && session.DeviceID == deviceID {
+			delete(ms.sessions, sessionID)
+			removed++
+		}
+	}
+	if removed == 0 {
+		return errors.Errorf("no active session found for client %s and device %s", clientID, deviceID)
+	}
+	return nil
+}
+
+// RemoveSessionByID removes a session by its ID
+func (ms *MemorySessionStore) RemoveSessionByID(sessionID string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if _, ok := ms.sessions[sessionID]; !ok {
+		return errors.Errorf("session %s not found", sessionID)
+	}
+	delete(ms.sessions, sessionID)
+	return nil
+}
+
+// ListActiveSessions lists all sessions
+func (ms *MemorySessionStore) ListActiveSessions() ([]*Session, error) {
+	return ms.filter(func(*Session) bool { return true }), nil
+}
+
+// GetActiveSessionsForClient lists the sessions of a client
+func (ms *MemorySessionStore) GetActiveSessionsForClient(clientID string) ([]*Session, error) {
+	return ms.filter(func(session *Session) bool {
+		return session.ClientID == clientID
+	}), nil
+}
+
+// filter returns copies of the sessions match accepts, ordered by client,
+// device and session ID like the files of a FileSessionStore
+func (ms *MemorySessionStore) filter(match func(*Session) bool) []*Session {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	sessions := make([]*Session, 0, len(ms.sessions))
+	for _, session := range ms.sessions {
+		session := session
+		if match(&session) {
+			sessions = append(sessions, &session)
+		}
+	}
+	sortSessions(sessions)
+	return sessions
+}
+
+// sortSessions orders sessions by client, device and session ID
+func sortSessions(sessions []*Session) {
+	sort.Slice(sessions, func(i, j int) bool {
+		a, b := sessions[i], sessions[j]
+		if a.ClientID != b.ClientID {
+			return a.ClientID < b.ClientID
+		}
+		if a.DeviceID != b.DeviceID {
+			return a.DeviceID < b.DeviceID
+		}
+		return a.SessionID < b.SessionID
+	})
+}
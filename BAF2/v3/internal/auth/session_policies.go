@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"fmt"
+
+	"github.com/chaichis-network/v3/internal/crypto"
+	"github.com/chaichis-network/v3/internal/fabric"
+	"github.com/pkg/errors"
+)
+
+// SetDeviceClass creates or updates a device class; lifetimes are in seconds
+func (dm *DeviceManager) SetDeviceClass(classID string, sessionLifetime, idleTimeout int64) (*fabric.DeviceClass, error) {
+	return dm.isvContract.SetDeviceClass(classID, sessionLifetime, idleTimeout)
+}
+
+// GetDeviceClass returns a device class
+func (dm *DeviceManager) GetDeviceClass(classID string) (*fabric.DeviceClass, error) {
+	return dm.isvContract.GetDeviceClass(classID)
+}
+
+// ListDeviceClasses returns every device class
+func (dm *DeviceManager) ListDeviceClasses() ([]*fabric.DeviceClass, error) {
+	return dm.isvContract.GetAllDeviceClasses()
+}
+
+// SetDeviceSessionPolicy puts a device in a class and sets its own session
+// lifetime and idle timeout, which override the class's. The policy is
+// signed with the device's private key.
+func (dm *DeviceManager) SetDeviceSessionPolicy(deviceID string, policy fabric.DeviceSessionPolicy) error {
+	privateKey, err := crypto.LoadPrivateKey(deviceID)
+	if err != nil {
+		return errors.Wrap(err, "failed to load device private key")
+	}
+
+	// Must match sessionPolicyMessage in the ISV chaincode
+	message := fmt.Sprintf("SESSIONPOLICY|%s|%s|%d|%d", deviceID, policy.DeviceClass, policy.SessionLifetime, policy.IdleTimeout)
+	signature, err := crypto.SignData(privateKey, []byte(message))
+	if err != nil {
+		return errors.Wrap(err, "failed to sign session policy")
+	}
+
+	return dm.isvContract.SetDeviceSessionPolicy(deviceID, policy, signature)
+}
+
+// GetSessionPolicy returns the session lifetime and idle timeout new
+// sessions with a device get
+func (dm *DeviceManager) GetSessionPolicy(deviceID string) (*fabric.SessionPolicy, error) {
+	return dm.isvContract.GetSessionPolicy(deviceID)
+}
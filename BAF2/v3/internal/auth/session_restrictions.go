@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/chaichis-network/v3/internal/crypto"
+	"github.com/chaichis-network/v3/internal/fabric"
+	"github.com/pkg/errors"
+)
+
+// RestrictSession shrinks an active session on deviceID to capabilities,
+// e.g. when the device enters safe mode. The restriction is signed with the
+// device's private key, so it runs where the device key is kept.
+func (dm *DeviceManager) RestrictSession(deviceID, sessionID string, capabilities []string) error {
+	privateKey, err := crypto.LoadPrivateKey(deviceID)
+	if err != nil {
+		return errors.Wrap(err, "failed to load device private key")
+	}
+
+	// Must match restrictSessionMessage in the ISV chaincode
+	message := fmt.Sprintf("RESTRICT|%s|%s", sessionID, strings.Join(capabilities, ","))
+	signature, err := crypto.SignData(privateKey, []byte(message))
+	if err != nil {
+		return errors.Wrap(err, "failed to sign session restriction")
+	}
+
+	if err := dm.isvContract.RestrictSession(sessionID, capabilities, signature); err != nil {
+		return err
+	}
+
+	log.Infof("Session %s restricted to %s", sessionID, strings.Join(capabilities, ", "))
+	return nil
+}
+
+// CheckSessionCapability reports whether a session may use a capability.
+// Device agents call it before serving a request.
+func (dm *DeviceManager) CheckSessionCapability(sessionID, capability string) (bool, error) {
+	return dm.isvContract.CheckSessionCapability(sessionID, capability)
+}
+
+// WatchSessionRestrictions passes each restriction of the client's sessions
+// to onRestriction until stop is closed
+func (dm *DeviceManager) WatchSessionRestrictions(clientID string, onRestriction func(fabric.AccessLogEntry), stop <-chan struct{}) error {
+	restrictions, cancel, err := dm.isvContract.WatchSessionRestrictions(clientID)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		case restriction, ok := <-restrictions:
+			if !ok {
+				return errors.New("session restriction event stream closed")
+			}
+			onRestriction(restriction)
+		}
+	}
+}
+
+// WatchSessionActivity passes each session change or restriction, optionally
+// only those of one client or device, to onEvent until stop is closed or
+// onEvent fails
+func (dm *DeviceManager) WatchSessionActivity(clientID, deviceID string, onEvent func(fabric.AccessLogEntry) error, stop <-chan struct{}) error {
+	events, cancel, err := dm.isvContract.WatchSessionActivity(clientID, deviceID)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		case event, ok := <-events:
+			if !ok {
+				return errors.New("session event stream closed")
+			}
+			if err := onEvent(event); err != nil {
+				return err
+			}
+		}
+	}
+}
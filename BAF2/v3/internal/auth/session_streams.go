@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"fmt"
+
+	"github.com/chaichis-network/v3/internal/crypto"
+	"github.com/chaichis-network/v3/internal/fabric"
+	"github.com/chaichis-network/v3/pkg/securechannel"
+	"github.com/pkg/errors"
+)
+
+// A device agent serving several concerns over one session opens a stream
+// per concern in the ISV, then carries each stream's traffic in
+// securechannel frames tagged with the stream ID. The ISV calls are signed
+// with the device's private key, so they run where the device key is kept.
+
+// OpenSessionStream opens a stream in an active session on deviceID for
+// traffic that uses capability
+func (dm *DeviceManager) OpenSessionStream(deviceID, sessionID string, streamID uint16, name, capability string) (*fabric.SessionStream, error) {
+	if streamID == securechannel.ControlStream {
+		return nil, errors.New("stream 0 is the control stream, which is always open")
+	}
+
+	// Must match openStreamMessage in the ISV chaincode
+	message := fmt.Sprintf("OPEN_STREAM|%s|%d|%s|%s", sessionID, streamID, name, capability)
+	signature, err := signStreamMessage(deviceID, message)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := dm.isvContract.OpenSessionStream(sessionID, streamID, name, capability, signature)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Infof("Stream %d opened in session %s for %s", streamID, sessionID, capability)
+	return stream, nil
+}
+
+// CloseSessionStream closes a stream in a session on deviceID
+func (dm *DeviceManager) CloseSessionStream(deviceID, sessionID string, streamID uint16) error {
+	// Must match closeStreamMessage in the ISV chaincode
+	message := fmt.Sprintf("CLOSE_STREAM|%s|%d", sessionID, streamID)
+	signature, err := signStreamMessage(deviceID, message)
+	if err != nil {
+		return err
+	}
+	if err := dm.isvContract.CloseSessionStream(sessionID, streamID, signature); err != nil {
+		return err
+	}
+
+	log.Infof("Stream %d in session %s closed", streamID, sessionID)
+	return nil
+}
+
+// ReportStreamCounters records a stream's counters, as kept by the device
+// end of its securechannel.Channel, in the ISV
+func (dm *DeviceManager) ReportStreamCounters(deviceID, sessionID string, streamID uint16, counters securechannel.Counters) (*fabric.SessionStream, error) {
+	// Must match streamCountersMessage in the ISV chaincode
+	message := fmt.Sprintf("STREAM_COUNTERS|%s|%d|%d|%d|%d", sessionID, streamID, counters.Messages, counters.Bytes, counters.Rejected)
+	signature, err := signStreamMessage(deviceID, message)
+	if err != nil {
+		return nil, err
+	}
+	return dm.isvContract.ReportStreamCounters(sessionID, streamID, counters.Messages, counters.Bytes, counters.Rejected, signature)
+}
+
+// CheckStreamCapability reports whether a stream may carry traffic. Device
+// agents call it like CheckSessionCapability, before serving a stream.
+func (dm *DeviceManager) CheckStreamCapability(sessionID string, streamID uint16) (bool, error) {
+	return dm.isvContract.CheckStreamCapability(sessionID, streamID)
+}
+
+// SessionStreams returns the streams of a session, open and closed
+func (dm *DeviceManager) SessionStreams(sessionID string) ([]*fabric.SessionStream, error) {
+	return dm.isvContract.GetSessionStreams(sessionID)
+}
+
+func signStreamMessage(deviceID, message string) (string, error) {
+	privateKey, err := crypto.LoadPrivateKey(deviceID)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to load device private key")
+	}
+	signature, err := crypto.SignData(privateKey, []byte(message))
+	if err != nil {
+		return "", errors.Wrap(err, "failed to sign stream message")
+	}
+	return signature, nil
+}
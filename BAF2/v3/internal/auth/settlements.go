@@ -0,0 +1,29 @@
+package auth
+
+import (
+	"github.com/chaichis-network/v3/internal/fabric"
+)
+
+// ListSettlements returns every settlement entry of a period, reading the
+// ledger page by page. consumerMSP may be empty for every consumer.
+func (dm *DeviceManager) ListSettlements(period, consumerMSP string, pageSize int32) ([]fabric.SettlementEntry, error) {
+	entries := []fabric.SettlementEntry{}
+	bookmark := ""
+	for {
+		page, err := dm.isvContract.GetSettlements(period, consumerMSP, pageSize, bookmark)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, page.Entries...)
+		if page.Bookmark == "" {
+			return entries, nil
+		}
+		bookmark = page.Bookmark
+	}
+}
+
+// SettlementSummary aggregates a period's settlement entries per consumer,
+// provider and capability class
+func (dm *DeviceManager) SettlementSummary(period, consumerMSP string) (*fabric.SettlementSummary, error) {
+	return dm.isvContract.GetSettlementSummary(period, consumerMSP)
+}
@@ -0,0 +1,254 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/chaichis-network/v3/internal/fabric"
+	"github.com/pkg/errors"
+)
+
+// Sections of a Snapshot
+const (
+	SnapshotClients  = "clients"
+	SnapshotDevices  = "devices"
+	SnapshotPolicies = "policies"
+	SnapshotServices = "services"
+)
+
+// SnapshotSections lists the sections in the order they are compared
+var SnapshotSections = []string{SnapshotClients, SnapshotDevices, SnapshotPolicies, SnapshotServices}
+
+// Snapshot is the auth-relevant state of one network, by section and record
+// key. Records are the chaincodes' JSON without the fields that change in
+// normal operation (see volatileFields), so two networks configured alike
+// produce equal snapshots.
+type Snapshot map[string]map[string]interface{}
+
+// volatileFields are dropped from the records of each section: times, and
+// state that follows from use rather than from configuration
+var volatileFields = map[string][]string{
+	SnapshotClients:  {"registrationTime"},
+	SnapshotDevices:  {"lastSeen", "registeredAt", "maintenance"},
+	SnapshotPolicies: {"updatedAt"},
+	SnapshotServices: {"publishedAt"},
+}
+
+// SnapshotDifference is one difference between two snapshots. Field is the
+// dotted path of the differing field; it is empty when the record exists on
+// one side only, which then holds nil.
+type SnapshotDifference struct {
+	Section string      `json:"section"`
+	Key     string      `json:"key"`
+	Field   string      `json:"field,omitempty"`
+	Source  interface{} `json:"source"`
+	Target  interface{} `json:"target"`
+}
+
+// TakeSnapshot reads the clients, devices, policies and services of the
+// network fabricClient is connected to
+func TakeSnapshot(fabricClient *fabric.Client) (Snapshot, error) {
+	asContract, err := fabric.NewAuthServerContract(fabricClient)
+	if err != nil {
+		return nil, err
+	}
+	isvContract, err := fabric.NewISVContract(fabricClient)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := Snapshot{}
+	for _, section := range SnapshotSections {
+		snapshot[section] = map[string]interface{}{}
+	}
+	add := func(section, key string, record interface{}) error {
+		normalized, err := normalizeRecord(section, record)
+		if err != nil {
+			return errors.Wrapf(err, "failed to read %s %s", section, key)
+		}
+		snapshot[section][key] = normalized
+		return nil
+	}
+
+	clients, err := asContract.GetAllClientRegistrations()
+	if err != nil {
+		return nil, err
+	}
+	for _, client := range clients {
+		if err := add(SnapshotClients, fmt.Sprint(client["id"]), client); err != nil {
+			return nil, err
+		}
+	}
+
+	devices, err := isvContract.GetAllIoTDevices()
+	if err != nil {
+		return nil, err
+	}
+	for _, device := range devices {
+		if err := add(SnapshotDevices, fmt.Sprint(device["deviceID"]), device); err != nil {
+			return nil, err
+		}
+	}
+
+	riskPolicy, err := asContract.GetRiskPolicy()
+	if err != nil {
+		return nil, err
+	}
+	if riskPolicy != nil {
+		if err := add(SnapshotPolicies, "risk-policy", riskPolicy); err != nil {
+			return nil, err
+		}
+	}
+	profiles, err := isvContract.GetAllCapabilityProfiles()
+	if err != nil {
+		return nil, err
+	}
+	for _, profile := range profiles {
+		if err := add(SnapshotPolicies, "capability-profile/"+profile.ProfileID, profile); err != nil {
+			return nil, err
+		}
+	}
+	classes, err := isvContract.GetAllDeviceClasses()
+	if err != nil {
+		return nil, err
+	}
+	for _, class := range classes {
+		if err := add(SnapshotPolicies, "device-class/"+class.ClassID, class); err != nil {
+			return nil, err
+		}
+	}
+
+	chaincodes := []struct{ service, contractID string }{
+		{"as", fabric.ASContractID},
+		{"tgs", fabric.TGSContractID},
+		{"isv", fabric.ISVContractID},
+	}
+	for _, chaincode := range chaincodes {
+		contract, err := fabricClient.GetContract(chaincode.contractID)
+		if err != nil {
+			return nil, err
+		}
+		if err := add(SnapshotPolicies, "payload-limits/"+chaincode.service, fabricClient.PayloadLimits(contract)); err != nil {
+			return nil, err
+		}
+
+		protocol, err := fabricClient.ProtocolInfo(contract, chaincode.service)
+		if err != nil {
+			return nil, err
+		}
+		service := map[string]interface{}{"protocol": protocol}
+		// A chaincode that has not published its key yet reports an error
+		if key, err := fabricClient.GetPublishedPublicKey(contract); err == nil {
+			service["publishedKey"] = key
+		} else {
+			log.Debugf("No published key on %s: %v", chaincode.service, err)
+		}
+		if err := add(SnapshotServices, chaincode.service, service); err != nil {
+			return nil, err
+		}
+	}
+
+	return snapshot, nil
+}
+
+// normalizeRecord turns a record into plain JSON values without the
+// section's volatile fields. A busy device counts as active.
+func normalizeRecord(section string, record interface{}) (interface{}, error) {
+	recordJSON, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	var normalized interface{}
+	if err := json.Unmarshal(recordJSON, &normalized); err != nil {
+		return nil, err
+	}
+	dropVolatileFields(normalized, volatileFields[section])
+	if fields, ok := normalized.(map[string]interface{}); ok && section == SnapshotDevices && fields["status"] == "busy" {
+		fields["status"] = "active"
+	}
+	return normalized, nil
+}
+
+// dropVolatileFields removes names from value and from the objects nested
+// in it
+func dropVolatileFields(value interface{}, names []string) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, name := range names {
+			delete(v, name)
+		}
+		for _, nested := range v {
+			dropVolatileFields(nested, names)
+		}
+	case []interface{}:
+		for _, nested := range v {
+			dropVolatileFields(nested, names)
+		}
+	}
+}
+
+// DiffSnapshots lists how target differs from source, by section, then key,
+// then field
+func DiffSnapshots(source, target Snapshot) []SnapshotDifference {
+	var differences []SnapshotDifference
+	for _, section := range SnapshotSections {
+		keys := map[string]bool{}
+		for key := range source[section] {
+			keys[key] = true
+		}
+		for key := range target[section] {
+			keys[key] = true
+		}
+		sortedKeys := make([]string, 0, len(keys))
+		for key := range keys {
+			sortedKeys = append(sortedKeys, key)
+		}
+		sort.Strings(sortedKeys)
+
+		for _, key := range sortedKeys {
+			sourceRecord, inSource := source[section][key]
+			targetRecord, inTarget := target[section][key]
+			if !inSource || !inTarget {
+				differences = append(differences, SnapshotDifference{Section: section, Key: key, Source: sourceRecord, Target: targetRecord})
+				continue
+			}
+			diffValues(section, key, "", sourceRecord, targetRecord, &differences)
+		}
+	}
+	return differences
+}
+
+// diffValues compares objects field by field and anything else as a whole
+func diffValues(section, key, field string, source, target interface{}, differences *[]SnapshotDifference) {
+	sourceFields, sourceIsObject := source.(map[string]interface{})
+	targetFields, targetIsObject := target.(map[string]interface{})
+	if !sourceIsObject || !targetIsObject {
+		if !reflect.DeepEqual(source, target) {
+			*differences = append(*differences, SnapshotDifference{Section: section, Key: key, Field: field, Source: source, Target: target})
+		}
+		return
+	}
+
+	names := map[string]bool{}
+	for name := range sourceFields {
+		names[name] = true
+	}
+	for name := range targetFields {
+		names[name] = true
+	}
+	sortedNames := make([]string, 0, len(names))
+	for name := range names {
+		sortedNames = append(sortedNames, name)
+	}
+	sort.Strings(sortedNames)
+
+	for _, name := range sortedNames {
+		path := name
+		if field != "" {
+			path = field + "." + name
+		}
+		diffValues(section, key, path, sourceFields[name], targetFields[name], differences)
+	}
+}
@@ -0,0 +1,106 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/chaichis-network/v3/internal/fabric"
+	"github.com/pkg/errors"
+)
+
+// TaskTypeVerification tasks check that a client's registration is valid on
+// both the AS and the TGS
+const TaskTypeVerification = "verification"
+
+// taskHandlers run the task types this worker knows. Tasks of other types
+// are left for workers that know them.
+var taskHandlers = map[string]func(cm *ClientManager, task *fabric.PeerTask) (interface{}, error){
+	TaskTypeVerification: verifyRegistration,
+}
+
+// TaskOutcome is what happened to one task in a worker pass
+type TaskOutcome struct {
+	Task *fabric.PeerTask
+	Err  error
+}
+
+// WorkTasks runs one worker pass for peerID: it claims each pending task of
+// a known type, runs it, and completes or fails it on the ledger. Tasks
+// another worker claimed first are skipped.
+func (cm *ClientManager) WorkTasks(peerID string) ([]TaskOutcome, error) {
+	pending, err := cm.asContract.GetPendingTasks(peerID)
+	if err != nil {
+		return nil, err
+	}
+
+	var outcomes []TaskOutcome
+	for _, task := range pending {
+		handler, ok := taskHandlers[task.TaskType]
+		if !ok {
+			log.Debugf("Skipping task %s of unknown type %s", task.TaskID, task.TaskType)
+			continue
+		}
+
+		claimed, err := cm.asContract.ClaimTask(peerID, task.TaskID)
+		if err != nil {
+			log.Debugf("Could not claim task %s: %v", task.TaskID, err)
+			continue
+		}
+
+		outcomes = append(outcomes, cm.runTask(claimed, handler))
+	}
+	return outcomes, nil
+}
+
+func (cm *ClientManager) runTask(task *fabric.PeerTask, handler func(*ClientManager, *fabric.PeerTask) (interface{}, error)) TaskOutcome {
+	result, runErr := handler(cm, task)
+	if runErr != nil {
+		failed, err := cm.asContract.FailTask(task.TaskID, runErr.Error())
+		if err != nil {
+			return TaskOutcome{Task: task, Err: errors.Wrapf(err, "task failed (%v) and could not be marked failed", runErr)}
+		}
+		return TaskOutcome{Task: failed, Err: runErr}
+	}
+
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return TaskOutcome{Task: task, Err: errors.Wrap(err, "failed to marshal task result")}
+	}
+	completed, err := cm.asContract.CompleteTask(task.TaskID, string(resultJSON))
+	if err != nil {
+		return TaskOutcome{Task: task, Err: err}
+	}
+	return TaskOutcome{Task: completed}
+}
+
+// verifyRegistration checks that the AS and the TGS both consider the
+// task's client validly registered
+func verifyRegistration(cm *ClientManager, task *fabric.PeerTask) (interface{}, error) {
+	asValid, err := cm.asContract.CheckClientValidity(task.ClientID)
+	if err != nil {
+		return nil, err
+	}
+	tgsValid, err := cm.tgsContract.CheckRegistrationValidity(task.ClientID)
+	if err != nil {
+		return nil, err
+	}
+	if !asValid || !tgsValid {
+		return nil, fmt.Errorf("client %s registration is not valid (AS: %t, TGS: %t)", task.ClientID, asValid, tgsValid)
+	}
+	return map[string]bool{"asValid": asValid, "tgsValid": tgsValid}, nil
+}
+
+// AllocateTask assigns a task for a client to a peer's worker
+func (cm *ClientManager) AllocateTask(peerID, taskType, clientID string) error {
+	return cm.asContract.AllocatePeerTask(peerID, taskType, clientID)
+}
+
+// PendingTasks lists the tasks a peer's worker may claim now
+func (cm *ClientManager) PendingTasks(peerID string) ([]*fabric.PeerTask, error) {
+	return cm.asContract.GetPendingTasks(peerID)
+}
+
+// GetTask returns a task record
+func (cm *ClientManager) GetTask(taskID string) (*fabric.PeerTask, error) {
+	return cm.asContract.GetTask(taskID)
+}
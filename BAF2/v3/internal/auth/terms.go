@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"github.com/chaichis-network/v3/internal/crypto"
+	"github.com/chaichis-network/v3/internal/fabric"
+	"github.com/pkg/errors"
+)
+
+// SetAcceptTerms sets whether Authenticate acknowledges a terms notice the
+// AS asks for. Without it, a pending notice fails authentication so that
+// the user can read the document first.
+func (cm *ClientManager) SetAcceptTerms(accept bool) {
+	cm.acceptTerms = accept
+}
+
+// handleTermsNotice acknowledges or explains a notice sent with a challenge
+func (cm *ClientManager) handleTermsNotice(clientID string, notice *fabric.TermsNotice) error {
+	if notice == nil {
+		return nil
+	}
+	
+	if !cm.acceptTerms {
+		if notice.DocumentURL != "" {
+			log.Warnf("Terms version %s must be accepted before authenticating; read %s", notice.Version, notice.DocumentURL)
+		}
+		return errors.Errorf("terms version %s (document %s) have not been accepted; authenticate again with --accept-terms to accept them", notice.Version, notice.DocumentHash)
+	}
+	_, err := cm.AcknowledgeTerms(clientID, *notice)
+	return err
+}
+
+// AcknowledgeTerms signs a notice with the client's private key and records
+// the acknowledgement on the ledger
+func (cm *ClientManager) AcknowledgeTerms(clientID string, notice fabric.TermsNotice) (*fabric.TermsAcknowledgement, error) {
+	privateKey, err := crypto.LoadPrivateKey(clientID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load private key")
+	}
+	signature, err := crypto.SignData(privateKey, fabric.TermsStatement(clientID, notice))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to sign terms")
+	}
+	
+	ack, err := cm.asContract.AcknowledgeTerms(clientID, notice.Version, signature)
+	if err != nil {
+		return nil, err
+	}
+	
+	log.Infof("Client %s acknowledged terms version %s", clientID, notice.Version)
+	return ack, nil
+}
+
+// SetTermsPolicy stores the AS terms policy
+func (cm *ClientManager) SetTermsPolicy(policyJSON []byte) error {
+	if err := cm.asContract.SetTermsPolicy(string(policyJSON)); err != nil {
+		return err
+	}
+	
+	log.Info("Terms policy updated")
+	return nil
+}
+
+// GetTermsPolicy returns the AS terms policy, or nil if none is set
+func (cm *ClientManager) GetTermsPolicy() (*fabric.TermsPolicy, error) {
+	return cm.asContract.GetTermsPolicy()
+}
+
+// TermsAcknowledgement returns a client's latest acknowledgement, or nil if
+// it has none
+func (cm *ClientManager) TermsAcknowledgement(clientID string) (*fabric.TermsAcknowledgement, error) {
+	return cm.asContract.GetTermsAcknowledgement(clientID)
+}
@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"time"
+
+	"github.com/chaichis-network/v3/internal/fabric"
+)
+
+// upcomingPolicyNotice is how far ahead Authenticate warns of a pending
+// ticket policy
+const upcomingPolicyNotice = 7 * 24 * time.Hour
+
+// ScheduleTicketPolicy schedules an AS ticket policy to take effect at
+// effectiveAt
+func (cm *ClientManager) ScheduleTicketPolicy(policyJSON []byte, effectiveAt time.Time) (*fabric.TicketPolicySchedule, error) {
+	schedule, err := cm.asContract.ScheduleTicketPolicy(string(policyJSON), effectiveAt)
+	if err != nil {
+		return nil, err
+	}
+	
+	log.Infof("Ticket policy version %d scheduled for %s", schedule.Pending.Version, schedule.Pending.EffectiveAt.Format(time.RFC3339))
+	return schedule, nil
+}
+
+// RollbackTicketPolicy schedules the previous AS ticket policy to take
+// effect again at effectiveAt
+func (cm *ClientManager) RollbackTicketPolicy(effectiveAt time.Time) (*fabric.TicketPolicySchedule, error) {
+	schedule, err := cm.asContract.RollbackTicketPolicy(effectiveAt)
+	if err != nil {
+		return nil, err
+	}
+	
+	log.Infof("Rollback to the previous ticket policy scheduled for %s as version %d", schedule.Pending.EffectiveAt.Format(time.RFC3339), schedule.Pending.Version)
+	return schedule, nil
+}
+
+// AbortPendingTicketPolicy withdraws the pending AS ticket policy
+func (cm *ClientManager) AbortPendingTicketPolicy() (*fabric.TicketPolicySchedule, error) {
+	schedule, err := cm.asContract.AbortPendingTicketPolicy()
+	if err != nil {
+		return nil, err
+	}
+	
+	log.Info("Pending ticket policy aborted")
+	return schedule, nil
+}
+
+// TicketPolicySchedule returns the pending, active and previous AS ticket
+// policies
+func (cm *ClientManager) TicketPolicySchedule() (*fabric.TicketPolicySchedule, error) {
+	return cm.asContract.GetTicketPolicySchedule()
+}
+
+// warnUpcomingTicketPolicy logs a warning when a pending ticket policy takes
+// effect within upcomingPolicyNotice, and an error-level one when it will
+// refuse the encryption this client was just issued a TGT with. An AS
+// without ticket policies is skipped.
+func (cm *ClientManager) warnUpcomingTicketPolicy(encryption string, now time.Time) {
+	schedule, err := cm.asContract.GetTicketPolicySchedule()
+	if err != nil {
+		log.Debugf("Ticket policy schedule unavailable: %v", err)
+		return
+	}
+	pending := schedule.Pending
+	if pending == nil || pending.EffectiveAt.Sub(now) > upcomingPolicyNotice {
+		return
+	}
+	
+	log.Warnf("AS ticket policy version %d takes effect at %s (run 'authcli ticket-policy show' for details)", pending.Version, pending.EffectiveAt.Format(time.RFC3339))
+	if len(pending.Policy.Encryptions) == 0 {
+		return
+	}
+	for _, allowed := range pending.Policy.Encryptions {
+		if allowed == encryption {
+			return
+		}
+	}
+	log.Errorf("From %s the AS will no longer issue TGTs with %s session keys; upgrade this client to one that supports %v", pending.EffectiveAt.Format(time.RFC3339), encryption, pending.Policy.Encryptions)
+}
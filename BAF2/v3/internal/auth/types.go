@@ -1,30 +1,15 @@
 package auth
 
-// NonceChallenge represents a nonce challenge from the Authentication Server
-type NonceChallenge struct {
-	Nonce          string `json:"nonce"`
-	ExpirationTime int64  `json:"expirationTime"`
-}
-
-// TGT represents a Ticket Granting Ticket
-type TGT struct {
-	EncryptedTGT        string `json:"encryptedTGT"`
-	EncryptedSessionKey string `json:"encryptedSessionKey"`
-}
+import "github.com/chaichis-network/v3/pkg/ticket"
 
-// ServiceTicket represents a service ticket for accessing a service
-type ServiceTicket struct {
-	EncryptedServiceTicket string `json:"encryptedServiceTicket"`
-	EncryptedSessionKey    string `json:"encryptedSessionKey"`
-}
-
-// ServiceTicketRequest represents a request for a service ticket
-type ServiceTicketRequest struct {
-	EncryptedTGT   string `json:"encryptedTGT"`
-	ClientID       string `json:"clientID"`
-	ServiceID      string `json:"serviceID"`
-	Authenticator  string `json:"authenticator"`
-}
+// Wire types shared with the AS and TGS chaincodes live in pkg/ticket
+type (
+	NonceChallenge       = ticket.NonceChallenge
+	TGT                  = ticket.TGT
+	ServiceTicket        = ticket.ServiceTicket
+	ServiceTicketRequest = ticket.ServiceTicketRequest
+	Authenticator        = ticket.Authenticator
+)
 
 // ServiceRequest represents a request to access a service
 type ServiceRequest struct {
@@ -33,6 +18,7 @@ type ServiceRequest struct {
 	DeviceID               string `json:"deviceID"`
 	RequestType            string `json:"requestType"`
 	EncryptedData          string `json:"encryptedData"`
+	Authenticator          string `json:"authenticator,omitempty"` // See mutual_auth.go
 }
 
 // ServiceResponse represents a response to a service request
@@ -42,6 +28,8 @@ type ServiceResponse struct {
 	Status        string `json:"status"`
 	SessionID     string `json:"sessionID"`
 	EncryptedData string `json:"encryptedData"`
+	// ServerAuthenticator is the ISV's reply to the request's authenticator
+	ServerAuthenticator string `json:"serverAuthenticator,omitempty"`
 }
 
 // IoTDevice represents an IoT device registered with the ISV
@@ -53,13 +41,6 @@ type IoTDevice struct {
 	Capabilities  []string `json:"capabilities"`
 }
 
-// Authenticator represents a timestamp encrypted with the session key
-// Used to prove client identity to TGS
-type Authenticator struct {
-	ClientID  string `json:"clientID"`
-	Timestamp int64  `json:"timestamp"`
-}
-
 // Session represents an active session between a client and a device
 type Session struct {
 	SessionID     string `json:"sessionID"`
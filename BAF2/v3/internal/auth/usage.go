@@ -0,0 +1,8 @@
+package auth
+
+import "github.com/chaichis-network/v3/internal/fabric"
+
+// UsageSummary returns a client's usage and remaining quota
+func (cm *ClientManager) UsageSummary(clientID string) (*fabric.ClientUsageSummary, error) {
+	return cm.asContract.GetClientUsageSummary(clientID)
+}
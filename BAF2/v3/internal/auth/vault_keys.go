@@ -0,0 +1,230 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/chaichis-network/v3/internal/fabric"
+	"github.com/pkg/errors"
+)
+
+// Service private keys can be kept in Vault instead of in files. They are
+// read with the vault command-line tool, which authenticates as the
+// operator (VAULT_ADDR with VAULT_TOKEN or a prior 'vault login'), and are
+// passed to the chaincode as transient data, so they never touch the disk.
+// Each key is a KV version 2 secret whose private_key field holds the PEM
+// private key.
+//
+// The chaincode records the secret's path and version with the key pair.
+// Writing a new version of the secret is the rotation trigger:
+// VaultKeyRotations finds the chaincodes whose recorded version is behind
+// the secret's current one, and RotateFromVault migrates them to it.
+
+const (
+	// VaultProvider is the KeySource provider of keys read from Vault
+	VaultProvider = "vault"
+
+	// VaultDefaultField is the secret field holding the PEM private key
+	VaultDefaultField = "private_key"
+
+	vaultBinary = "vault"
+)
+
+// VaultKey names a service private key in Vault
+type VaultKey struct {
+	Path    string // KV path, e.g. secret/authframework/isv
+	Field   string // Empty for VaultDefaultField
+	Version int64  // 0 for the current version
+}
+
+// vaultSecret is the output of 'vault kv get -format=json'
+type vaultSecret struct {
+	Data struct {
+		Data     map[string]interface{} `json:"data"`
+		Metadata struct {
+			Version int64 `json:"version"`
+		} `json:"metadata"`
+	} `json:"data"`
+}
+
+// vaultMetadata is the output of 'vault kv metadata get -format=json'
+type vaultMetadata struct {
+	Data struct {
+		CurrentVersion int64 `json:"current_version"`
+	} `json:"data"`
+}
+
+// LoadVaultServiceKeyPair reads a chaincode's private key from Vault and
+// completes the pair with its public key. The source to record with the
+// pair names the version read.
+func LoadVaultServiceKeyPair(key VaultKey) (*fabric.ServiceKeyPair, *fabric.KeySource, error) {
+	if key.Path == "" {
+		return nil, nil, errors.New("a Vault path is required")
+	}
+	field := key.Field
+	if field == "" {
+		field = VaultDefaultField
+	}
+	args := []string{"kv", "get", "-format=json"}
+	if key.Version > 0 {
+		args = append(args, "-version="+strconv.FormatInt(key.Version, 10))
+	}
+	output, err := runVault(append(args, key.Path)...)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "failed to read %s from Vault", key.Path)
+	}
+
+	var secret vaultSecret
+	if err := json.Unmarshal(output, &secret); err != nil {
+		return nil, nil, errors.Wrapf(err, "unexpected output reading %s from Vault (is it a KV version 2 secret?)", key.Path)
+	}
+	privateKeyPEM, ok := secret.Data.Data[field].(string)
+	if !ok || privateKeyPEM == "" {
+		return nil, nil, errors.Errorf("Vault secret %s has no %s field", key.Path, field)
+	}
+	if secret.Data.Metadata.Version == 0 {
+		return nil, nil, errors.Errorf("Vault secret %s has no version; only KV version 2 secrets are supported", key.Path)
+	}
+
+	pair, err := serviceKeyPairFromPEM([]byte(privateKeyPEM), fmt.Sprintf("%s version %d", key.Path, secret.Data.Metadata.Version))
+	if err != nil {
+		return nil, nil, err
+	}
+	return pair, &fabric.KeySource{Provider: VaultProvider, Path: key.Path, Version: secret.Data.Metadata.Version}, nil
+}
+
+// VaultKeyVersion returns the current version of a Vault secret
+func VaultKeyVersion(path string) (int64, error) {
+	output, err := runVault("kv", "metadata", "get", "-format=json", path)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to read the metadata of %s from Vault", path)
+	}
+	var metadata vaultMetadata
+	if err := json.Unmarshal(output, &metadata); err != nil {
+		return 0, errors.Wrapf(err, "unexpected output reading the metadata of %s from Vault", path)
+	}
+	return metadata.Data.CurrentVersion, nil
+}
+
+// runVault runs the vault command and returns its stdout, which is kept in
+// memory only
+func runVault(args ...string) ([]byte, error) {
+	if _, err := exec.LookPath(vaultBinary); err != nil {
+		return nil, errors.Errorf("%s is required to read service keys from Vault but was not found in PATH", vaultBinary)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(vaultBinary, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, errors.Errorf("%s failed: %v: %s", vaultBinary, err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// VaultKeyRotation is a chaincode whose key pair was read from Vault, with
+// the version it runs and the version Vault now holds
+type VaultKeyRotation struct {
+	Service        string `json:"service"` // "as", "tgs" or "isv"
+	Path           string `json:"path"`
+	Collection     string `json:"collection,omitempty"`
+	CurrentVersion int64  `json:"currentVersion"`
+	LatestVersion  int64  `json:"latestVersion"`
+	// Fingerprint is the new key's, once rotated
+	Fingerprint string `json:"fingerprint,omitempty"`
+}
+
+// Due reports whether Vault holds a newer version than the chaincode runs
+func (r *VaultKeyRotation) Due() bool {
+	return r.LatestVersion > r.CurrentVersion
+}
+
+// VaultKeyRotations returns the chaincodes whose key pair was read from
+// Vault, in startup order, with the current version of each secret.
+// Chaincodes initialized otherwise are left out.
+func VaultKeyRotations(fabricClient *fabric.Client) ([]*VaultKeyRotation, error) {
+	var rotations []*VaultKeyRotation
+	for _, chaincode := range keyCeremonyServices {
+		contract, err := fabricClient.GetContract(chaincode.contractID)
+		if err != nil {
+			return nil, err
+		}
+		status, err := fabricClient.GetServiceKeyStatus(contract)
+		if err != nil {
+			return nil, err
+		}
+		if status.Source == nil || status.Source.Provider != VaultProvider {
+			continue
+		}
+
+		latest, err := VaultKeyVersion(status.Source.Path)
+		if err != nil {
+			return nil, err
+		}
+		rotations = append(rotations, &VaultKeyRotation{
+			Service:        chaincode.service,
+			Path:           status.Source.Path,
+			Collection:     status.Collection,
+			CurrentVersion: status.Source.Version,
+			LatestVersion:  latest,
+		})
+	}
+	return rotations, nil
+}
+
+// RotateFromVault migrates a chaincode to the latest version of its Vault
+// secret, keeping its private key where it is, then publishes the new
+// public key and imports it into the chaincodes that depend on it. Tickets
+// issued under the old key can no longer be read. Rotations are applied in
+// startup order, so that each import precedes the dependent's own rotation.
+func RotateFromVault(fabricClient *fabric.Client, rotation *VaultKeyRotation, field string) error {
+	var contractID string
+	var dependentIDs []string
+	for _, chaincode := range keyCeremonyServices {
+		if chaincode.service == rotation.Service {
+			contractID = chaincode.contractID
+		}
+		if chaincode.importedFrom == rotation.Service {
+			dependentIDs = append(dependentIDs, chaincode.contractID)
+		}
+	}
+	if verifier, ok := signatureVerifiers[rotation.Service]; ok {
+		dependentIDs = append(dependentIDs, verifier)
+	}
+	if contractID == "" {
+		return errors.Errorf("unknown chaincode %q", rotation.Service)
+	}
+
+	keys, source, err := LoadVaultServiceKeyPair(VaultKey{Path: rotation.Path, Field: field, Version: rotation.LatestVersion})
+	if err != nil {
+		return err
+	}
+	contract, err := fabricClient.GetContract(contractID)
+	if err != nil {
+		return err
+	}
+	status, err := fabricClient.MigrateServiceKeys(contract, fabric.KeyBootstrap{Collection: rotation.Collection, Source: source}, keys)
+	if err != nil {
+		return err
+	}
+	rotation.Fingerprint = status.Fingerprint
+
+	if _, err := fabricClient.PublishPublicKey(contract); err != nil {
+		return errors.Wrapf(err, "%s migrated to version %d but not published", rotation.Service, source.Version)
+	}
+	for _, dependentID := range dependentIDs {
+		dependent, err := fabricClient.GetContract(dependentID)
+		if err != nil {
+			return err
+		}
+		if _, err := fabricClient.ImportPeerServiceKey(dependent, contractID, status.Fingerprint); err != nil {
+			return errors.Wrapf(err, "%s migrated to version %d but not imported into %s", rotation.Service, source.Version, dependentID)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,299 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/chaichis-network/v3/internal/fabric"
+	"github.com/pkg/errors"
+)
+
+// Outcomes of checking a cached artifact against the ledger
+const (
+	LocalOK            = "ok"
+	LocalExpired       = "expired"
+	LocalRevoked       = "revoked"
+	LocalUnknown       = "unknown"
+	LocalInvalidClient = "invalid-client"
+	LocalClosed        = "closed"
+	LocalMismatch      = "mismatch"
+	LocalUnreadable    = "unreadable"
+	LocalCheckFailed   = "check-failed"
+)
+
+// LocalCheck is the outcome of checking one cached file against the ledger
+type LocalCheck struct {
+	Path     string `json:"path"`
+	Kind     string `json:"kind"` // "tgt", "service-ticket" or "session"
+	ClientID string `json:"clientID,omitempty"`
+	Status   string `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Repaired bool   `json:"repaired,omitempty"`
+
+	// storedSessionID is set for a session kept in a session store other
+	// than files; repairing removes it from the store
+	storedSessionID string
+}
+
+// Divergent reports whether the cached file no longer matches the ledger.
+// Files that could not be checked are not divergent; they are checked again
+// on the next run.
+func (c LocalCheck) Divergent() bool {
+	return c.Status != LocalOK && c.Status != LocalCheckFailed
+}
+
+// LocalVerification lists the outcome for every cached file
+type LocalVerification struct {
+	Checks    []LocalCheck `json:"checks"`
+	Divergent int          `json:"divergent"`
+	Repaired  int          `json:"repaired"`
+	Failed    int          `json:"failed"`
+}
+
+// VerifyLocal checks the TGTs, service tickets and sessions cached in the
+// working directory and the session store against their ledger
+// counterparts. A ticket the TGS revoked, or a session the ISV closed, still
+// looks usable locally until it is refused; this finds them up front. With
+// repair set, divergent files and stored sessions are removed.
+func (cm *ClientManager) VerifyLocal(store SessionStore, repair bool) (*LocalVerification, error) {
+	isvContract, err := fabric.NewISVContract(cm.fabricClient)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create ISV contract")
+	}
+	verifier := &localVerifier{
+		cm:            cm,
+		isvContract:   isvContract,
+		now:           time.Now(),
+		validity:      make(map[string]bool),
+		sessionsCache: make(map[string]map[string]map[string]interface{}),
+	}
+
+	var checks []LocalCheck
+	tgtFiles, err := filepath.Glob("*-tgt.json")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to search for TGT files")
+	}
+	for _, path := range tgtFiles {
+		checks = append(checks, verifier.checkTGT(path))
+	}
+
+	ticketFiles, err := filepath.Glob("*-serviceticket-*.json")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to search for service ticket files")
+	}
+	for _, path := range ticketFiles {
+		checks = append(checks, verifier.checkServiceTicket(path))
+	}
+
+	sessionFiles, err := filepath.Glob("*-session-*.json")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to search for session files")
+	}
+	var managedFiles []string
+	if fileStore, ok := store.(*FileSessionStore); ok {
+		// Unreadable session files are reported too
+		if managedFiles, err = filepath.Glob(filepath.Join(fileStore.dir, "*.json")); err != nil {
+			return nil, errors.Wrap(err, "failed to search for session files")
+		}
+	} else {
+		storedSessions, err := store.ListActiveSessions()
+		if err != nil {
+			return nil, err
+		}
+		for _, session := range storedSessions {
+			check := LocalCheck{Path: "store:" + session.SessionID, Kind: "session", storedSessionID: session.SessionID}
+			checks = append(checks, verifier.checkStoredSession(check, session))
+		}
+	}
+	for _, path := range append(sessionFiles, managedFiles...) {
+		if check, ok := verifier.checkSession(path); ok {
+			checks = append(checks, check)
+		}
+	}
+
+	sort.SliceStable(checks, func(i, j int) bool { return checks[i].Path < checks[j].Path })
+
+	result := &LocalVerification{Checks: checks}
+	for i := range result.Checks {
+		check := &result.Checks[i]
+		if check.Status == LocalCheckFailed {
+			result.Failed++
+			continue
+		}
+		if !check.Divergent() {
+			continue
+		}
+		result.Divergent++
+		if !repair {
+			continue
+		}
+		if check.storedSessionID != "" {
+			if err := store.RemoveSessionByID(check.storedSessionID); err != nil {
+				log.Warnf("Failed to remove session %s: %v", check.storedSessionID, err)
+				continue
+			}
+		} else if err := os.Remove(check.Path); err != nil && !os.IsNotExist(err) {
+			log.Warnf("Failed to remove %s: %v", check.Path, err)
+			continue
+		}
+		check.Repaired = true
+		result.Repaired++
+	}
+	return result, nil
+}
+
+// localVerifier caches ledger lookups shared by several files of a client
+type localVerifier struct {
+	cm            *ClientManager
+	isvContract   *fabric.ISVContract
+	now           time.Time
+	validity      map[string]bool
+	sessionsCache map[string]map[string]map[string]interface{}
+}
+
+func (v *localVerifier) clientValid(clientID string) (bool, error) {
+	if valid, ok := v.validity[clientID]; ok {
+		return valid, nil
+	}
+	valid, err := v.cm.asContract.CheckClientValidity(clientID)
+	if err != nil {
+		return false, err
+	}
+	v.validity[clientID] = valid
+	return valid, nil
+}
+
+// activeSessions returns the client's active ledger sessions by session ID
+func (v *localVerifier) activeSessions(clientID string) (map[string]map[string]interface{}, error) {
+	if sessions, ok := v.sessionsCache[clientID]; ok {
+		return sessions, nil
+	}
+	ledgerSessions, err := v.isvContract.GetActiveSessionsByClient(clientID)
+	if err != nil {
+		return nil, err
+	}
+	sessions := make(map[string]map[string]interface{}, len(ledgerSessions))
+	for _, ledgerSession := range ledgerSessions {
+		if sessionID, _ := ledgerSession["sessionID"].(string); sessionID != "" {
+			sessions[sessionID] = ledgerSession
+		}
+	}
+	v.sessionsCache[clientID] = sessions
+	return sessions, nil
+}
+
+func readCachedJSON(path string, value interface{}) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, value)
+}
+
+func (v *localVerifier) checkTGT(path string) LocalCheck {
+	check := LocalCheck{Path: path, Kind: "tgt", ClientID: strings.TrimSuffix(path, "-tgt.json")}
+
+	var tgt map[string]string
+	if err := readCachedJSON(path, &tgt); err != nil {
+		check.Status, check.Detail = LocalUnreadable, err.Error()
+		return check
+	}
+	if expiresAt, err := time.Parse(time.RFC3339, tgt["expiresAt"]); err == nil && v.now.After(expiresAt) {
+		check.Status, check.Detail = LocalExpired, "expired at "+expiresAt.Format(time.RFC3339)
+		return check
+	}
+
+	valid, err := v.clientValid(check.ClientID)
+	if err != nil {
+		check.Status, check.Detail = LocalCheckFailed, err.Error()
+		return check
+	}
+	if !valid {
+		check.Status, check.Detail = LocalInvalidClient, "the AS no longer considers the client valid"
+		return check
+	}
+	check.Status = LocalOK
+	return check
+}
+
+func (v *localVerifier) checkServiceTicket(path string) LocalCheck {
+	check := LocalCheck{Path: path, Kind: "service-ticket"}
+	name := strings.TrimSuffix(path, ".json")
+	check.ClientID = name[:strings.LastIndex(name, "-serviceticket-")]
+
+	var serviceTicket map[string]string
+	if err := readCachedJSON(path, &serviceTicket); err != nil {
+		check.Status, check.Detail = LocalUnreadable, err.Error()
+		return check
+	}
+	encryptedTicket := serviceTicket["encryptedServiceTicket"]
+	if encryptedTicket == "" {
+		check.Status, check.Detail = LocalUnreadable, "no encrypted service ticket in file"
+		return check
+	}
+
+	encryptedTicketHash := fmt.Sprintf("%x", sha256.Sum256([]byte(encryptedTicket)))
+	status, err := v.cm.tgsContract.GetTicketStatus(check.ClientID, encryptedTicketHash)
+	switch {
+	case err == fabric.ErrTicketNotFound:
+		check.Status, check.Detail = LocalUnknown, "the TGS has no record of this ticket"
+	case err != nil:
+		check.Status, check.Detail = LocalCheckFailed, err.Error()
+	case status.Status == "revoked":
+		check.Status, check.Detail = LocalRevoked, "revoked at "+status.RevokedAt.Format(time.RFC3339)
+	case status.Expired:
+		check.Status, check.Detail = LocalExpired, "expired at "+status.ExpiresAt.Format(time.RFC3339)
+	default:
+		check.Status = LocalOK
+	}
+	return check
+}
+
+// checkSession checks a cached session; files in the session directory that
+// are not sessions (no session ID) are skipped
+func (v *localVerifier) checkSession(path string) (LocalCheck, bool) {
+	check := LocalCheck{Path: path, Kind: "session"}
+
+	var session Session
+	if err := readCachedJSON(path, &session); err != nil {
+		check.Status, check.Detail = LocalUnreadable, err.Error()
+		return check, true
+	}
+	if session.SessionID == "" {
+		return check, false
+	}
+	return v.checkStoredSession(check, &session), true
+}
+
+// checkStoredSession checks a cached session against the ledger
+func (v *localVerifier) checkStoredSession(check LocalCheck, session *Session) LocalCheck {
+	check.ClientID = session.ClientID
+
+	sessions, err := v.activeSessions(session.ClientID)
+	if err != nil {
+		check.Status, check.Detail = LocalCheckFailed, err.Error()
+		return check
+	}
+	ledgerSession, ok := sessions[session.SessionID]
+	if !ok {
+		check.Status, check.Detail = LocalClosed, fmt.Sprintf("session %s is not active on the ledger", session.SessionID)
+		return check
+	}
+	if ledgerDevice, _ := ledgerSession["deviceID"].(string); ledgerDevice != session.DeviceID {
+		check.Status, check.Detail = LocalMismatch, fmt.Sprintf("cached for device %s, ledger has device %s", session.DeviceID, ledgerDevice)
+		return check
+	}
+	if expiresAt, err := time.Parse(time.RFC3339, fmt.Sprint(ledgerSession["expiresAt"])); err == nil && v.now.After(expiresAt) {
+		check.Status, check.Detail = LocalExpired, "expired at "+expiresAt.Format(time.RFC3339)
+		return check
+	}
+	check.Status = LocalOK
+	return check
+}
@@ -0,0 +1,384 @@
+// Package ccpackage builds chaincodes with pinned toolchain settings and
+// packages them reproducibly in the Fabric lifecycle format, so that a
+// package can be rebuilt from audited source and produce the same hash.
+//
+// A package is a gzipped tar holding metadata.json and code.tar.gz, as
+// "peer lifecycle chaincode package" writes it. Entries are sorted and their
+// owners, modes and times fixed, so the bytes depend only on the source
+// files and the Go version (compress/flate output can change between Go
+// releases). The package ID approved with "peer lifecycle chaincode
+// approveformyorg" is <label>:<hex SHA-256 of the package>, so the approval
+// records the audited hash on the ledger.
+package ccpackage
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ManifestFile is the name of the manifest written next to the packages
+const ManifestFile = "manifest.json"
+
+// BuildFlags are the go build flags every chaincode is built with. They
+// strip paths, VCS stamps and build IDs, so the binary only depends on the
+// source and the toolchain.
+var BuildFlags = []string{"-trimpath", "-buildvcs=false", "-mod=readonly", "-ldflags=-buildid="}
+
+// BuildEnv is the environment the build runs with, on top of the caller's.
+// It matches the peers' chaincode builder.
+var BuildEnv = []string{"CGO_ENABLED=0", "GOOS=linux", "GOARCH=amd64", "GOFLAGS=", "GO111MODULE=on"}
+
+// labelPattern is what Fabric accepts as a package label
+var labelPattern = regexp.MustCompile(`^[[:alnum:]][[:alnum:]_.+-]*$`)
+
+// Entry records one packaged chaincode
+type Entry struct {
+	Name        string `json:"name"`   // Chaincode name on the channel
+	Path        string `json:"path"`   // Source directory, as given
+	Module      string `json:"module"` // Module path from go.mod
+	Label       string `json:"label"`
+	PackageFile string `json:"packageFile"` // Relative to the manifest
+	PackageHash string `json:"packageHash"` // Hex SHA-256 of the package
+	PackageID   string `json:"packageID"`   // <label>:<packageHash>
+	BinaryHash  string `json:"binaryHash"`  // Hex SHA-256 of the binary built with BuildFlags
+}
+
+// Manifest lists the packages of one release and how they were built
+type Manifest struct {
+	GoVersion  string    `json:"goVersion"`
+	BuildFlags []string  `json:"buildFlags"`
+	BuildEnv   []string  `json:"buildEnv"`
+	CreatedAt  time.Time `json:"createdAt"`
+	Chaincodes []Entry   `json:"chaincodes"`
+}
+
+// GoVersion returns the version of the go command on PATH, e.g. go1.21.5
+func GoVersion() (string, error) {
+	out, err := exec.Command("go", "env", "GOVERSION").Output()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get Go version")
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// ModulePath returns the module path declared in dir/go.mod
+func ModulePath(dir string) (string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		return "", errors.Wrap(err, "chaincode must be a Go module")
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "module" {
+			return strings.Trim(fields[1], `"`), nil
+		}
+	}
+	return "", errors.Errorf("%s/go.mod has no module line", dir)
+}
+
+// checkVendored fails if dir/go.mod replaces a module with a local
+// directory and dir has no vendor/modules.txt. The directory is outside the
+// package, so a peer could not build the chaincode.
+func checkVendored(dir string) error {
+	data, err := ioutil.ReadFile(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		return errors.Wrap(err, "chaincode must be a Go module")
+	}
+	inBlock := false
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 0:
+			continue
+		case fields[0] == "replace" && len(fields) >= 2 && fields[1] == "(":
+			inBlock = true
+			continue
+		case inBlock && fields[0] == ")":
+			inBlock = false
+			continue
+		case fields[0] == "replace":
+			fields = fields[1:]
+		case !inBlock:
+			continue
+		}
+		for i, field := range fields {
+			if field != "=>" || i+1 >= len(fields) {
+				continue
+			}
+			target := fields[i+1]
+			if !strings.HasPrefix(target, "./") && !strings.HasPrefix(target, "../") && !filepath.IsAbs(target) {
+				continue
+			}
+			if _, err := os.Stat(filepath.Join(dir, "vendor", "modules.txt")); err != nil {
+				return errors.Errorf("%s replaces %s with %s, which is not packaged: run \"go mod vendor\" in %s first", dir, fields[0], target, dir)
+			}
+		}
+	}
+	return nil
+}
+
+// Build compiles the chaincode in dir with BuildFlags and BuildEnv and
+// returns the SHA-256 of the binary. It checks the source compiles for the
+// peers and gives auditors a second hash to reproduce.
+func Build(dir string) (string, error) {
+	tmp, err := ioutil.TempDir("", "ccpackage-")
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create build directory")
+	}
+	defer os.RemoveAll(tmp)
+
+	binary := filepath.Join(tmp, "chaincode")
+	args := append([]string{"build"}, BuildFlags...)
+	args = append(args, "-o", binary, ".")
+	cmd := exec.Command("go", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), BuildEnv...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return "", errors.Errorf("go build in %s failed: %v\n%s", dir, err, out)
+	}
+
+	data, err := ioutil.ReadFile(binary)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to read chaincode binary")
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// sourceFiles lists the files of dir that go into a package, as slash
+// paths relative to dir, sorted: go.mod, go.sum, non-test Go files,
+// vendored modules and META-INF (CouchDB indexes). Hidden files and
+// directories are skipped.
+func sourceFiles(dir string) ([]string, error) {
+	var files []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == "." {
+			return nil
+		}
+		if strings.HasPrefix(info.Name(), ".") {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		switch {
+		case rel == "go.mod", rel == "go.sum",
+			strings.HasPrefix(rel, "META-INF/"), strings.HasPrefix(rel, "vendor/"),
+			strings.HasSuffix(rel, ".go") && !strings.HasSuffix(rel, "_test.go"):
+			files = append(files, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list %s", dir)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// tarGzip writes entries, in the given order, as a gzipped tar with fixed
+// headers
+func tarGzip(names []string, read func(name string) ([]byte, error)) ([]byte, error) {
+	var buf bytes.Buffer
+	gz, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	tw := tar.NewWriter(gz)
+	for _, name := range names {
+		data, err := read(name)
+		if err != nil {
+			return nil, err
+		}
+		header := &tar.Header{
+			Name:     name,
+			Mode:     0644,
+			Size:     int64(len(data)),
+			ModTime:  time.Unix(0, 0),
+			Typeflag: tar.TypeReg,
+			Format:   tar.FormatPAX,
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(data); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Package packages the chaincode in dir under label. Go sources go under
+// src/ and META-INF at the top of code.tar.gz, as the peer CLI lays them
+// out for a module.
+func Package(dir, label string) ([]byte, error) {
+	if !labelPattern.MatchString(label) {
+		return nil, errors.Errorf("invalid label %q: use letters, digits, '_', '.', '+' and '-'", label)
+	}
+	module, err := ModulePath(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkVendored(dir); err != nil {
+		return nil, err
+	}
+	files, err := sourceFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]string, len(files))
+	sources := make(map[string]string, len(files))
+	for i, file := range files {
+		entry := "src/" + file
+		if strings.HasPrefix(file, "META-INF/") {
+			entry = file
+		}
+		entries[i] = entry
+		sources[entry] = file
+	}
+	sort.Strings(entries)
+	code, err := tarGzip(entries, func(entry string) ([]byte, error) {
+		return ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(sources[entry])))
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to write code.tar.gz")
+	}
+
+	metadata, err := json.Marshal(struct {
+		Path  string `json:"path"`
+		Type  string `json:"type"`
+		Label string `json:"label"`
+	}{module, "golang", label})
+	if err != nil {
+		return nil, err
+	}
+	parts := map[string][]byte{"metadata.json": metadata, "code.tar.gz": code}
+	pkg, err := tarGzip([]string{"metadata.json", "code.tar.gz"}, func(name string) ([]byte, error) {
+		return parts[name], nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to write package")
+	}
+	return pkg, nil
+}
+
+// Hash returns the hex SHA-256 of a package
+func Hash(pkg []byte) string {
+	sum := sha256.Sum256(pkg)
+	return hex.EncodeToString(sum[:])
+}
+
+// PackageID returns the ID Fabric gives a package: its label and hash
+func PackageID(label string, pkg []byte) string {
+	return label + ":" + Hash(pkg)
+}
+
+// PackageChaincode builds and packages the chaincode in dir, writes the
+// package to outDir and returns its manifest entry
+func PackageChaincode(name, dir, label, outDir string) (*Entry, error) {
+	module, err := ModulePath(dir)
+	if err != nil {
+		return nil, err
+	}
+	binaryHash, err := Build(dir)
+	if err != nil {
+		return nil, err
+	}
+	pkg, err := Package(dir, label)
+	if err != nil {
+		return nil, err
+	}
+
+	packageFile := label + ".tar.gz"
+	if err := ioutil.WriteFile(filepath.Join(outDir, packageFile), pkg, 0644); err != nil {
+		return nil, errors.Wrap(err, "failed to write package")
+	}
+	return &Entry{
+		Name:        name,
+		Path:        dir,
+		Module:      module,
+		Label:       label,
+		PackageFile: packageFile,
+		PackageHash: Hash(pkg),
+		PackageID:   PackageID(label, pkg),
+		BinaryHash:  binaryHash,
+	}, nil
+}
+
+// LoadManifest reads a manifest
+func LoadManifest(path string) (*Manifest, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read manifest")
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, errors.Wrapf(err, "invalid manifest %s", path)
+	}
+	return &manifest, nil
+}
+
+// Save writes the manifest
+func (m *Manifest) Save(path string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal manifest")
+	}
+	return errors.Wrap(ioutil.WriteFile(path, append(data, '\n'), 0644), "failed to write manifest")
+}
+
+// Find returns the manifest entry for a chaincode name, or nil
+func (m *Manifest) Find(name string) *Entry {
+	for i := range m.Chaincodes {
+		if m.Chaincodes[i].Name == name {
+			return &m.Chaincodes[i]
+		}
+	}
+	return nil
+}
+
+// CheckPackageFile reports whether the package file next to the manifest
+// at manifestPath still has the hash the manifest records
+func (e *Entry) CheckPackageFile(manifestPath string) error {
+	pkg, err := ioutil.ReadFile(filepath.Join(filepath.Dir(manifestPath), e.PackageFile))
+	if err != nil {
+		return errors.Wrap(err, "failed to read package")
+	}
+	if hash := Hash(pkg); hash != e.PackageHash {
+		return fmt.Errorf("%s has hash %s, the manifest records %s", e.PackageFile, hash, e.PackageHash)
+	}
+	return nil
+}
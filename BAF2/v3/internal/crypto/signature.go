@@ -2,6 +2,7 @@ package crypto
 
 import (
 	"crypto"
+	"crypto/ecdsa"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
@@ -10,13 +11,14 @@ import (
 	"github.com/pkg/errors"
 )
 
-// SignData signs data with the given private key
-func SignData(privateKey *rsa.PrivateKey, data []byte) (string, error) {
+// SignData signs data with the given private key: RSASSA-PKCS1-v1_5 for an
+// RSA key, ASN.1 DER ECDSA for a P-256 key, both over SHA-256
+func SignData(privateKey crypto.Signer, data []byte) (string, error) {
 	// Create SHA-256 hash of data
 	hash := sha256.Sum256(data)
 	
 	// Sign the hash with the private key
-	signature, err := rsa.SignPKCS1v15(rand.Reader, privateKey, crypto.SHA256, hash[:])
+	signature, err := privateKey.Sign(rand.Reader, hash[:], crypto.SHA256)
 	if err != nil {
 		return "", errors.Wrap(err, "failed to sign data")
 	}
@@ -25,8 +27,8 @@ func SignData(privateKey *rsa.PrivateKey, data []byte) (string, error) {
 	return base64.StdEncoding.EncodeToString(signature), nil
 }
 
-// VerifySignature verifies a signature using the given public key
-func VerifySignature(publicKey *rsa.PublicKey, data []byte, signatureBase64 string) error {
+// VerifySignature verifies a signature using the given RSA or P-256 public key
+func VerifySignature(publicKey crypto.PublicKey, data []byte, signatureBase64 string) error {
 	// Decode base64 signature
 	signature, err := base64.StdEncoding.DecodeString(signatureBase64)
 	if err != nil {
@@ -37,18 +39,55 @@ func VerifySignature(publicKey *rsa.PublicKey, data []byte, signatureBase64 stri
 	hash := sha256.Sum256(data)
 	
 	// Verify signature
-	err = rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, hash[:], signature)
-	if err != nil {
-		return errors.Wrap(err, "signature verification failed")
+	switch publicKey := publicKey.(type) {
+	case *rsa.PublicKey:
+		err = rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, hash[:], signature)
+		if err != nil {
+			return errors.Wrap(err, "signature verification failed")
+		}
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(publicKey, hash[:], signature) {
+			return errors.New("signature verification failed: ecdsa: verification error")
+		}
+	default:
+		return errors.Errorf("unsupported public key type %T", publicKey)
 	}
 	
 	return nil
 }
 
-// EncryptWithPublicKey encrypts data with a public key
-func EncryptWithPublicKey(publicKey *rsa.PublicKey, data []byte) (string, error) {
-	// Encrypt data with the public key
-	encrypted, err := rsa.EncryptPKCS1v15(rand.Reader, publicKey, data)
+// Padding is an RSA encryption padding
+type Padding string
+
+const (
+	// PaddingPKCS1v15 is RSA PKCS#1 v1.5, which the chaincodes accept until
+	// their transition to OAEP ends
+	PaddingPKCS1v15 Padding = "pkcs1v15"
+	// PaddingOAEP is RSA-OAEP with SHA-256
+	PaddingOAEP Padding = "oaep"
+)
+
+// ParsePadding returns the padding with the given name
+func ParsePadding(name string) (Padding, error) {
+	switch padding := Padding(name); padding {
+	case PaddingPKCS1v15, PaddingOAEP:
+		return padding, nil
+	}
+	return "", errors.Errorf("unknown padding %q (expected %s or %s)", name, PaddingPKCS1v15, PaddingOAEP)
+}
+
+// EncryptWithPublicKey encrypts data with a public key in the given padding
+func EncryptWithPublicKey(publicKey *rsa.PublicKey, data []byte, padding Padding) (string, error) {
+	var encrypted []byte
+	var err error
+	switch padding {
+	case PaddingPKCS1v15:
+		encrypted, err = rsa.EncryptPKCS1v15(rand.Reader, publicKey, data)
+	case PaddingOAEP:
+		encrypted, err = rsa.EncryptOAEP(sha256.New(), rand.Reader, publicKey, data, nil)
+	default:
+		return "", errors.Errorf("unknown padding %q", padding)
+	}
 	if err != nil {
 		return "", errors.Wrap(err, "failed to encrypt data with public key")
 	}
@@ -57,16 +96,19 @@ func EncryptWithPublicKey(publicKey *rsa.PublicKey, data []byte) (string, error)
 	return base64.StdEncoding.EncodeToString(encrypted), nil
 }
 
-// DecryptWithPrivateKey decrypts data with a private key
-func DecryptWithPrivateKey(privateKey *rsa.PrivateKey, encryptedBase64 string) ([]byte, error) {
+// DecryptWithPrivateKey decrypts data encrypted in either padding, as the
+// chaincodes do: OAEP is tried first, PKCS#1 v1.5 only if acceptLegacy is set
+func DecryptWithPrivateKey(privateKey *rsa.PrivateKey, encryptedBase64 string, acceptLegacy bool) ([]byte, error) {
 	// Decode base64 encrypted data
 	encrypted, err := base64.StdEncoding.DecodeString(encryptedBase64)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to decode base64 encrypted data")
 	}
 	
-	// Decrypt data with the private key
-	decrypted, err := rsa.DecryptPKCS1v15(rand.Reader, privateKey, encrypted)
+	decrypted, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, privateKey, encrypted, nil)
+	if err != nil && acceptLegacy {
+		decrypted, err = rsa.DecryptPKCS1v15(rand.Reader, privateKey, encrypted)
+	}
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to decrypt data with private key")
 	}
@@ -75,6 +117,8 @@ func DecryptWithPrivateKey(privateKey *rsa.PrivateKey, encryptedBase64 string) (
 }
 
 // SignNonce signs a nonce using an entity's private key
+// The nonce is base64 encoded; the signature covers the decoded nonce bytes,
+// which is what the AS chaincode verifies.
 func SignNonce(id string, nonce string) (string, error) {
 	// Load private key
 	privateKey, err := LoadPrivateKey(id)
@@ -82,8 +126,13 @@ func SignNonce(id string, nonce string) (string, error) {
 		return "", errors.Wrap(err, "failed to load private key")
 	}
 	
+	nonceBytes, err := base64.StdEncoding.DecodeString(nonce)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to decode base64 nonce")
+	}
+	
 	// Sign nonce
-	return SignData(privateKey, []byte(nonce))
+	return SignData(privateKey, nonceBytes)
 }
 
 // VerifyNonceSignature verifies a signed nonce
@@ -94,6 +143,11 @@ func VerifyNonceSignature(id string, nonce string, signature string) error {
 		return errors.Wrap(err, "failed to load public key")
 	}
 	
+	nonceBytes, err := base64.StdEncoding.DecodeString(nonce)
+	if err != nil {
+		return errors.Wrap(err, "failed to decode base64 nonce")
+	}
+	
 	// Verify signature
-	return VerifySignature(publicKey, []byte(nonce), signature)
+	return VerifySignature(publicKey, nonceBytes, signature)
 }
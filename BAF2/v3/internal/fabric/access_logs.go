@@ -0,0 +1,104 @@
+package fabric
+
+import (
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// AccessLogEntry is one access decision or session change on a device
+type AccessLogEntry struct {
+	LogID        string    `json:"logID"`
+	DeviceID     string    `json:"deviceID"`
+	ClientID     string    `json:"clientID"`
+	SessionID    string    `json:"sessionID,omitempty"`
+	Action       string    `json:"action"`
+	Detail       string    `json:"detail,omitempty"`
+	Capabilities []string  `json:"capabilities,omitempty"` // New capability set of a restricted session
+	TxID         string    `json:"txID"`
+	FlowID       string    `json:"flowID,omitempty"`
+	Timestamp    time.Time `json:"timestamp"`
+	BlockNumber  uint64    `json:"-"`
+}
+
+// AccessLogPage is one page of a device's access log, oldest first. Pass
+// Bookmark to the next call to continue; it is empty on the last page.
+type AccessLogPage struct {
+	Entries  []AccessLogEntry `json:"entries"`
+	Bookmark string           `json:"bookmark"`
+}
+
+// GetAccessLogs returns one page of a device's access log. pageSize 0 uses
+// the chaincode default.
+func (isv *ISVContract) GetAccessLogs(deviceID string, pageSize int32, bookmark string) (*AccessLogPage, error) {
+	responseBytes, err := isv.client.evaluate(isv.contract, "GetAccessLogs", deviceID, strconv.FormatInt(int64(pageSize), 10), bookmark)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get access logs from ISV")
+	}
+
+	var page AccessLogPage
+	if err := json.Unmarshal(responseBytes, &page); err != nil {
+		return nil, errors.Wrap(err, "failed to parse access logs response")
+	}
+	return &page, nil
+}
+
+// WatchAccessLogs subscribes to access log events for a device, including
+// session restrictions. The returned function cancels the subscription and
+// closes the channel.
+func (isv *ISVContract) WatchAccessLogs(deviceID string) (<-chan AccessLogEntry, func(), error) {
+	return isv.watchAccessEvents("^(AccessLogged|SessionRestricted)$", func(entry AccessLogEntry) bool {
+		return entry.DeviceID == deviceID
+	})
+}
+
+// watchAccessEvents subscribes to events whose payload is an access log
+// entry, passing on the entries that match
+func (isv *ISVContract) watchAccessEvents(eventFilter string, match func(AccessLogEntry) bool) (<-chan AccessLogEntry, func(), error) {
+	registration, events, err := isv.contract.RegisterEvent(eventFilter)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to subscribe to access log events")
+	}
+
+	entries := make(chan AccessLogEntry)
+	done := make(chan struct{})
+	go func() {
+		defer close(entries)
+		for {
+			select {
+			case <-done:
+				return
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+				var entry AccessLogEntry
+				if err := json.Unmarshal(event.Payload, &entry); err != nil {
+					log.Warnf("Ignoring malformed %s event in tx %s: %v", event.EventName, event.TxID, err)
+					continue
+				}
+				if !match(entry) {
+					continue
+				}
+				entry.BlockNumber = event.BlockNumber
+				select {
+				case entries <- entry:
+				case <-done:
+					return
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			close(done)
+			isv.contract.Unregister(registration)
+		})
+	}
+	return entries, cancel, nil
+}
@@ -0,0 +1,50 @@
+package fabric
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// A chaincode's admin functions are closed until its admin MSPs are named
+// with InitAdminMSPs, once, after it is first deployed. Admins change them
+// afterwards with SetAdminMSPs.
+
+// InitAdminMSPs names the admin MSPs of a newly deployed chaincode. The
+// caller's MSP must be one of them.
+func (c *Client) InitAdminMSPs(contract *Contract, msps []string) error {
+	return c.putAdminMSPs(contract, "InitAdminMSPs", msps)
+}
+
+// SetAdminMSPs replaces the admin MSPs of a chaincode. The caller's MSP must
+// be one of them, so it cannot lock itself out.
+func (c *Client) SetAdminMSPs(contract *Contract, msps []string) error {
+	return c.putAdminMSPs(contract, "SetAdminMSPs", msps)
+}
+
+func (c *Client) putAdminMSPs(contract *Contract, function string, msps []string) error {
+	mspsJSON, err := json.Marshal(msps)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal admin MSPs")
+	}
+	if _, err := c.submit(contract, function, string(mspsJSON)); err != nil {
+		return errors.Wrapf(err, "failed to set admin MSPs of %s", contract.Name())
+	}
+	return nil
+}
+
+// GetAdminMSPs returns the admin MSPs of a chaincode, or none if they are
+// not named yet
+func (c *Client) GetAdminMSPs(contract *Contract) ([]string, error) {
+	responseBytes, err := c.evaluate(contract, "GetAdminMSPs")
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get admin MSPs of %s", contract.Name())
+	}
+	var msps []string
+	if len(responseBytes) > 0 {
+		if err := json.Unmarshal(responseBytes, &msps); err != nil {
+			return nil, errors.Wrap(err, "failed to unmarshal admin MSPs")
+		}
+	}
+	return msps, nil
+}
@@ -0,0 +1,219 @@
+package fabric
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"regexp"
+	"time"
+
+	// Must initialize before the Fabric protos of either client API
+	_ "github.com/chaichis-network/v3/internal/fabric/protoconflict"
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/hyperledger/fabric-gateway/pkg/identity"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// Timeouts of APIGateway requests, in line with the connection profile
+// defaults of fabric-sdk-go
+const (
+	gatewayEvaluateTimeout     = 30 * time.Second
+	gatewayEndorseTimeout      = 30 * time.Second
+	gatewaySubmitTimeout       = 30 * time.Second
+	gatewayCommitStatusTimeout = 2 * time.Minute
+)
+
+// gatewayConnection is a fabric-gateway connection to one gateway peer,
+// which endorses, submits and evaluates on the client's behalf
+type gatewayConnection struct {
+	grpc     *grpc.ClientConn
+	gateway  *client.Gateway
+	endpoint *gatewayEndpoint
+}
+
+// connectGateway connects through fabric-gateway to the gateway peer of the
+// connection profile at ccpPath, signing with the wallet identity's key
+func (c *Client) connectGateway(ccpPath, identityLabel string) (connection, error) {
+	configProvider, err := configProviderFor(ccpPath, c.ageIdentity)
+	if err != nil {
+		return nil, err
+	}
+	walletIdentity, err := c.wallet.Get(identityLabel)
+	if err != nil {
+		return nil, err
+	}
+	endpoint, err := resolveGatewayEndpoint(configProvider, c.gatewayPeer, walletIdentity.MspID)
+	if err != nil {
+		return nil, err
+	}
+
+	certificate, err := identity.CertificateFromPEM([]byte(walletIdentity.Certificate()))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read certificate of %s", identityLabel)
+	}
+	id, err := identity.NewX509Identity(walletIdentity.MspID, certificate)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create identity %s", identityLabel)
+	}
+	// Wallets keeping keys in a token sign there
+	sign := identity.Sign(c.wallet.signer(identityLabel))
+	if sign == nil {
+		privateKey, err := identity.PrivateKeyFromPEM([]byte(walletIdentity.Key()))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read private key of %s", identityLabel)
+		}
+		sign, err = identity.NewPrivateKeySign(privateKey)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to create signer for %s", identityLabel)
+		}
+	}
+
+	transport := insecure.NewCredentials()
+	if endpoint.tls {
+		var roots *x509.CertPool
+		if endpoint.tlsCACert != nil {
+			roots = x509.NewCertPool()
+			roots.AddCert(endpoint.tlsCACert)
+		}
+		transport = credentials.NewClientTLSFromCert(roots, endpoint.serverName)
+	}
+	conn, err := grpc.Dial(endpoint.address, grpc.WithTransportCredentials(transport))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to dial gateway peer %s", endpoint.name)
+	}
+
+	gw, err := client.Connect(id,
+		client.WithSign(sign),
+		client.WithClientConnection(conn),
+		client.WithEvaluateTimeout(gatewayEvaluateTimeout),
+		client.WithEndorseTimeout(gatewayEndorseTimeout),
+		client.WithSubmitTimeout(gatewaySubmitTimeout),
+		client.WithCommitStatusTimeout(gatewayCommitStatusTimeout),
+	)
+	if err != nil {
+		conn.Close()
+		return nil, errors.Wrap(err, "failed to connect to gateway")
+	}
+	if c.debug {
+		fmt.Printf("Using gateway peer %s at %s\n", endpoint.name, endpoint.address)
+	}
+	return &gatewayConnection{grpc: conn, gateway: gw, endpoint: endpoint}, nil
+}
+
+func (g *gatewayConnection) contract(channelName, contractID string) (contractBackend, error) {
+	network := g.gateway.GetNetwork(channelName)
+	return &gatewayContract{
+		network:  network,
+		contract: network.GetContract(contractID),
+		name:     contractID,
+		endpoint: g.endpoint,
+	}, nil
+}
+
+func (g *gatewayConnection) close() {
+	g.gateway.Close()
+	g.grpc.Close()
+}
+
+type gatewayContract struct {
+	network  *client.Network
+	contract *client.Contract
+	name     string
+	endpoint *gatewayEndpoint
+}
+
+// proposalOptions turns txOptions into fabric-gateway options. The gateway
+// targets organizations, not peers, so peers become their organizations.
+func (g *gatewayContract) proposalOptions(options txOptions, args []string) ([]client.ProposalOption, error) {
+	proposalOptions := []client.ProposalOption{client.WithArguments(args...)}
+	if len(options.transient) > 0 {
+		proposalOptions = append(proposalOptions, client.WithTransient(options.transient))
+	}
+	if len(options.peers) > 0 {
+		mspIDs, err := g.endpoint.organizations(options.peers)
+		if err != nil {
+			return nil, err
+		}
+		proposalOptions = append(proposalOptions, client.WithEndorsingOrganizations(mspIDs...))
+	}
+	return proposalOptions, nil
+}
+
+func (g *gatewayContract) evaluate(name string, options txOptions, args []string) ([]byte, error) {
+	proposalOptions, err := g.proposalOptions(options, args)
+	if err != nil {
+		return nil, err
+	}
+	return g.contract.Evaluate(name, proposalOptions...)
+}
+
+// submit goes through the proposal steps one by one, as Contract.Submit
+// does, to learn the transaction ID
+func (g *gatewayContract) submit(name string, options txOptions, args []string) ([]byte, string, error) {
+	proposalOptions, err := g.proposalOptions(options, args)
+	if err != nil {
+		return nil, "", err
+	}
+	proposal, err := g.contract.NewProposal(name, proposalOptions...)
+	if err != nil {
+		return nil, "", err
+	}
+	txID := proposal.TransactionID()
+	transaction, err := proposal.Endorse()
+	if err != nil {
+		return nil, txID, err
+	}
+	commit, err := transaction.Submit()
+	if err != nil {
+		return nil, txID, err
+	}
+	status, err := commit.Status()
+	if err != nil {
+		return nil, txID, err
+	}
+	if !status.Successful {
+		return nil, txID, errors.Errorf("transaction %s failed to commit with status code %d (%s)", txID, int32(status.Code), status.Code)
+	}
+	return transaction.Result(), txID, nil
+}
+
+// registerEvent reads the chaincode's events from the gateway peer and
+// passes on those matching eventFilter. Cancelling the context ends the
+// gateway's stream and closes its channel.
+func (g *gatewayContract) registerEvent(eventFilter string) (<-chan *ChaincodeEvent, func(), error) {
+	filter, err := regexp.Compile(eventFilter)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "invalid event filter %q", eventFilter)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	gatewayEvents, err := g.network.ChaincodeEvents(ctx, g.name)
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+
+	events := make(chan *ChaincodeEvent)
+	go func() {
+		defer close(events)
+		for event := range gatewayEvents {
+			if !filter.MatchString(event.EventName) {
+				continue
+			}
+			select {
+			case events <- &ChaincodeEvent{
+				TxID:        event.TransactionID,
+				ChaincodeID: event.ChaincodeName,
+				EventName:   event.EventName,
+				Payload:     event.Payload,
+				BlockNumber: event.BlockNumber,
+			}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return events, cancel, nil
+}
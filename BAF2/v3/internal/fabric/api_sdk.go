@@ -0,0 +1,150 @@
+package fabric
+
+import (
+	"sync"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/gateway"
+	"github.com/pkg/errors"
+)
+
+// sdkConnection is a fabric-sdk-go gateway connection. Networks are looked
+// up once per channel, since that runs service discovery.
+type sdkConnection struct {
+	gateway *gateway.Gateway
+
+	mu       sync.Mutex
+	networks map[string]*gateway.Network
+}
+
+// connectSDK connects through fabric-sdk-go with the connection profile at
+// ccpPath
+func (c *Client) connectSDK(ccpPath, identity string) (connection, error) {
+	// Encrypted (SOPS/age) profiles are decrypted in memory
+	configProvider, err := configProviderFor(ccpPath, c.ageIdentity)
+	if err != nil {
+		return nil, err
+	}
+
+	wallet, err := c.wallet.sdkWallet(identity)
+	if err != nil {
+		return nil, err
+	}
+
+	gw, err := gateway.Connect(
+		gateway.WithConfig(configProvider),
+		gateway.WithIdentity(wallet, identity),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to connect to gateway")
+	}
+	return &sdkConnection{gateway: gw, networks: make(map[string]*gateway.Network)}, nil
+}
+
+func (s *sdkConnection) contract(channelName, contractID string) (contractBackend, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	network, ok := s.networks[channelName]
+	if !ok {
+		var err error
+		network, err = s.gateway.GetNetwork(channelName)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get network '%s'", channelName)
+		}
+		s.networks[channelName] = network
+	}
+	return &sdkContract{contract: network.GetContract(contractID)}, nil
+}
+
+func (s *sdkConnection) close() {
+	s.gateway.Close()
+}
+
+type sdkContract struct {
+	contract *gateway.Contract
+}
+
+func (s *sdkContract) evaluate(name string, options txOptions, args []string) ([]byte, error) {
+	if len(options.peers) == 0 && len(options.transient) == 0 {
+		return s.contract.EvaluateTransaction(name, args...)
+	}
+	txn, err := s.contract.CreateTransaction(name, sdkTransactionOptions(options)...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create transaction %s", name)
+	}
+	return txn.Evaluate(args...)
+}
+
+// submit reads the transaction ID from the commit event, which the SDK
+// queues once the transaction has been ordered, valid or not
+func (s *sdkContract) submit(name string, options txOptions, args []string) ([]byte, string, error) {
+	txn, err := s.contract.CreateTransaction(name, sdkTransactionOptions(options)...)
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "failed to create transaction %s", name)
+	}
+	commits := txn.RegisterCommitEvent()
+	result, err := txn.Submit(args...)
+
+	txID := ""
+	select {
+	case commit, ok := <-commits:
+		if ok {
+			txID = commit.TxID
+		}
+	default:
+	}
+	return result, txID, err
+}
+
+func sdkTransactionOptions(options txOptions) []gateway.TransactionOption {
+	var sdkOptions []gateway.TransactionOption
+	if len(options.transient) > 0 {
+		sdkOptions = append(sdkOptions, gateway.WithTransient(options.transient))
+	}
+	if len(options.peers) > 0 {
+		sdkOptions = append(sdkOptions, gateway.WithEndorsingPeers(options.peers...))
+	}
+	return sdkOptions
+}
+
+// registerEvent passes the SDK's events on until cancelled. The SDK closes
+// its channel when the registration is removed.
+func (s *sdkContract) registerEvent(eventFilter string) (<-chan *ChaincodeEvent, func(), error) {
+	registration, sdkEvents, err := s.contract.RegisterEvent(eventFilter)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	events := make(chan *ChaincodeEvent)
+	done := make(chan struct{})
+	go func() {
+		defer close(events)
+		for {
+			select {
+			case <-done:
+				return
+			case event, ok := <-sdkEvents:
+				if !ok {
+					return
+				}
+				select {
+				case events <- &ChaincodeEvent{
+					TxID:        event.TxID,
+					ChaincodeID: event.ChaincodeID,
+					EventName:   event.EventName,
+					Payload:     event.Payload,
+					BlockNumber: event.BlockNumber,
+				}:
+				case <-done:
+					return
+				}
+			}
+		}
+	}()
+
+	cancel := func() {
+		close(done)
+		s.contract.Unregister(registration)
+	}
+	return events, cancel, nil
+}
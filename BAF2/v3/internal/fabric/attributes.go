@@ -0,0 +1,84 @@
+package fabric
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DisclosurePolicy lists the client attributes the TGS copies into service
+// tickets for a service
+type DisclosurePolicy struct {
+	ServiceID  string    `json:"serviceID"`
+	Attributes []string  `json:"attributes"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+	UpdatedBy  string    `json:"updatedBy"`
+}
+
+// SetClientAttributes replaces a client's attributes at the AS and returns
+// the updated registration. signature is the client's signature, made at
+// timestamp (Unix seconds), over
+// SET_ATTRIBUTES|<clientID>|<hex SHA-256 of attributesJSON>|<timestamp>.
+func (as *AuthServerContract) SetClientAttributes(clientID, attributesJSON string, timestamp int64, signature string) (map[string]interface{}, error) {
+	responseBytes, err := as.client.submit(as.contract, "SetClientAttributes", clientID, attributesJSON, strconv.FormatInt(timestamp, 10), signature)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to set client attributes with AS")
+	}
+
+	var client map[string]interface{}
+	if err := json.Unmarshal(responseBytes, &client); err != nil {
+		return nil, errors.Wrap(err, "failed to parse client registration")
+	}
+	return client, nil
+}
+
+// SetDisclosurePolicy sets the client attributes disclosed in service
+// tickets for serviceID; no attributes discloses none
+func (tgs *TicketGrantingContract) SetDisclosurePolicy(serviceID string, attributes []string) (*DisclosurePolicy, error) {
+	if attributes == nil {
+		attributes = []string{}
+	}
+	attributesJSON, err := json.Marshal(attributes)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal attributes")
+	}
+
+	responseBytes, err := tgs.client.submit(tgs.contract, "SetDisclosurePolicy", serviceID, string(attributesJSON))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to set disclosure policy with TGS")
+	}
+	return parseDisclosurePolicy(responseBytes)
+}
+
+// GetDisclosurePolicy returns a service's disclosure policy, or nil if the
+// service learns no attributes
+func (tgs *TicketGrantingContract) GetDisclosurePolicy(serviceID string) (*DisclosurePolicy, error) {
+	responseBytes, err := tgs.client.evaluate(tgs.contract, "GetDisclosurePolicy", serviceID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get disclosure policy from TGS")
+	}
+	return parseDisclosurePolicy(responseBytes)
+}
+
+func parseDisclosurePolicy(responseBytes []byte) (*DisclosurePolicy, error) {
+	if len(responseBytes) == 0 {
+		return nil, nil
+	}
+	var policy DisclosurePolicy
+	if err := json.Unmarshal(responseBytes, &policy); err != nil {
+		return nil, errors.Wrap(err, "failed to parse disclosure policy response")
+	}
+	return &policy, nil
+}
+
+// SetDeviceAttributeRules sets the values of client attributes a device
+// allows, signed with the device key over
+// ATTRIBUTERULES|<deviceID>|<hex SHA-256 of rulesJSON>; "{}" removes them
+func (isv *ISVContract) SetDeviceAttributeRules(deviceID, rulesJSON, signature string) error {
+	if _, err := isv.client.submit(isv.contract, "SetDeviceAttributeRules", deviceID, rulesJSON, signature); err != nil {
+		return errors.Wrap(err, "failed to set attribute rules with ISV")
+	}
+	return nil
+}
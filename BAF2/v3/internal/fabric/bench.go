@@ -0,0 +1,101 @@
+package fabric
+
+import (
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ConnectionBenchmark compares the latency of a sequence of steps that each
+// build a Client, as authcli commands do, with and without a ConnectionPool
+type ConnectionBenchmark struct {
+	Iterations int          `json:"iterations"`
+	Fresh      LatencyStats `json:"fresh"`
+	Pooled     LatencyStats `json:"pooled"`
+}
+
+// LatencyStats summarizes the latencies of one mode. First is reported
+// apart because it includes connecting in both modes.
+type LatencyStats struct {
+	First time.Duration `json:"first"`
+	Mean  time.Duration `json:"mean"`
+	P50   time.Duration `json:"p50"`
+	P95   time.Duration `json:"p95"`
+	Max   time.Duration `json:"max"`
+	Total time.Duration `json:"total"`
+}
+
+// BenchmarkConnections times iterations of one step: create a Client from
+// options, connect as identity, evaluate GetMetrics on the AS and close.
+// It runs the steps first with a new connection each, then sharing a
+// ConnectionPool.
+func BenchmarkConnections(options ClientOptions, identity string, iterations int) (*ConnectionBenchmark, error) {
+	if iterations < 1 {
+		return nil, errors.New("at least one iteration is needed")
+	}
+
+	options.Pool = nil
+	fresh, err := timeSteps(options, identity, iterations)
+	if err != nil {
+		return nil, errors.Wrap(err, "fresh connections")
+	}
+
+	options.Pool = NewConnectionPool()
+	defer options.Pool.Close()
+	pooled, err := timeSteps(options, identity, iterations)
+	if err != nil {
+		return nil, errors.Wrap(err, "pooled connections")
+	}
+
+	return &ConnectionBenchmark{
+		Iterations: iterations,
+		Fresh:      summarizeLatencies(fresh),
+		Pooled:     summarizeLatencies(pooled),
+	}, nil
+}
+
+func timeSteps(options ClientOptions, identity string, iterations int) ([]time.Duration, error) {
+	latencies := make([]time.Duration, 0, iterations)
+	for i := 0; i < iterations; i++ {
+		start := time.Now()
+		if err := benchmarkStep(options, identity); err != nil {
+			return nil, err
+		}
+		latencies = append(latencies, time.Since(start))
+	}
+	return latencies, nil
+}
+
+func benchmarkStep(options ClientOptions, identity string) error {
+	client, err := NewClient(options)
+	if err != nil {
+		return err
+	}
+	if err := client.Connect(identity); err != nil {
+		return err
+	}
+	defer client.Close()
+
+	contract, err := client.GetContract(ASContractID)
+	if err != nil {
+		return err
+	}
+	_, err = client.evaluate(contract, "GetMetrics")
+	return err
+}
+
+func summarizeLatencies(latencies []time.Duration) LatencyStats {
+	stats := LatencyStats{First: latencies[0]}
+	for _, latency := range latencies {
+		stats.Total += latency
+	}
+	stats.Mean = stats.Total / time.Duration(len(latencies))
+
+	sorted := append([]time.Duration(nil), latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	stats.P50 = sorted[(len(sorted)-1)*50/100]
+	stats.P95 = sorted[(len(sorted)-1)*95/100]
+	stats.Max = sorted[len(sorted)-1]
+	return stats
+}
@@ -0,0 +1,90 @@
+package fabric
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// EmergencyAccess is a break-glass session opened without a ticket, with
+// its audit trail
+type EmergencyAccess struct {
+	AccessID     string                `json:"accessID"`
+	DeviceID     string                `json:"deviceID"`
+	Responder    string                `json:"responder"`
+	ResponderMSP string                `json:"responderMSP"`
+	Reason       string                `json:"reason"`
+	SessionID    string                `json:"sessionID"`
+	OpenedAt     time.Time             `json:"openedAt"`
+	ExpiresAt    time.Time             `json:"expiresAt"`
+	Status       string                `json:"status"`
+	ClosedAt     time.Time             `json:"closedAt,omitempty"`
+	ClosedBy     string                `json:"closedBy,omitempty"`
+	Summary      string                `json:"summary,omitempty"`
+	Trail        []EmergencyAuditEntry `json:"trail"`
+}
+
+// EmergencyAuditEntry is one step of a break-glass session
+type EmergencyAuditEntry struct {
+	Action    string    `json:"action"`
+	Actor     string    `json:"actor,omitempty"`
+	Detail    string    `json:"detail,omitempty"`
+	TxID      string    `json:"txID"`
+	FlowID    string    `json:"flowID,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// OpenEmergencySession opens a break-glass session to a device. The calling
+// identity needs the break_glass certificate attribute. A zero lifetime is
+// the ISV default.
+func (isv *ISVContract) OpenEmergencySession(deviceID, reason string, lifetimeSeconds int64) (*EmergencyAccess, error) {
+	responseBytes, err := isv.client.submit(isv.contract, "OpenEmergencySession", deviceID, reason, strconv.FormatInt(lifetimeSeconds, 10))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open emergency session with ISV")
+	}
+	return parseEmergencyAccess(responseBytes)
+}
+
+// CloseEmergencySession ends a break-glass session with a summary of the
+// work done
+func (isv *ISVContract) CloseEmergencySession(accessID, summary string) (*EmergencyAccess, error) {
+	responseBytes, err := isv.client.submit(isv.contract, "CloseEmergencySession", accessID, summary)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to close emergency session with ISV")
+	}
+	return parseEmergencyAccess(responseBytes)
+}
+
+// GetEmergencyAccess returns a break-glass session and its trail
+func (isv *ISVContract) GetEmergencyAccess(accessID string) (*EmergencyAccess, error) {
+	responseBytes, err := isv.client.evaluate(isv.contract, "GetEmergencyAccess", accessID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get emergency session from ISV")
+	}
+	return parseEmergencyAccess(responseBytes)
+}
+
+// GetEmergencyAccesses returns the break-glass sessions of a device, or of
+// all devices if deviceID is empty, oldest first
+func (isv *ISVContract) GetEmergencyAccesses(deviceID string) ([]*EmergencyAccess, error) {
+	responseBytes, err := isv.client.evaluate(isv.contract, "GetEmergencyAccesses", deviceID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get emergency sessions from ISV")
+	}
+
+	var accesses []*EmergencyAccess
+	if err := json.Unmarshal(responseBytes, &accesses); err != nil {
+		return nil, errors.Wrap(err, "failed to parse emergency sessions response")
+	}
+	return accesses, nil
+}
+
+func parseEmergencyAccess(responseBytes []byte) (*EmergencyAccess, error) {
+	var access EmergencyAccess
+	if err := json.Unmarshal(responseBytes, &access); err != nil {
+		return nil, errors.Wrap(err, "failed to parse emergency session response")
+	}
+	return &access, nil
+}
@@ -0,0 +1,91 @@
+package fabric
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// CapabilityMatrix maps service request types and device capabilities to
+// the actions read, write and actuate. The ISV grants a session only if the
+// device provides the request's action and the client holds it.
+type CapabilityMatrix struct {
+	RequestTypes       map[string]string   `json:"requestTypes"`
+	Capabilities       map[string][]string `json:"capabilities"`
+	DefaultPermissions []string            `json:"defaultPermissions"`
+	UpdatedAt          time.Time           `json:"updatedAt,omitempty"`
+	UpdatedBy          string              `json:"updatedBy,omitempty"`
+}
+
+// ClientPermissions are the actions granted to a client
+type ClientPermissions struct {
+	ClientID  string    `json:"clientID"`
+	Actions   []string  `json:"actions"`
+	GrantedAt time.Time `json:"grantedAt"`
+	GrantedBy string    `json:"grantedBy"`
+}
+
+// SetCapabilityMatrix stores the capability matrix; fields left out keep
+// the ISV's defaults
+func (isv *ISVContract) SetCapabilityMatrix(matrixJSON string) (*CapabilityMatrix, error) {
+	responseBytes, err := isv.client.submit(isv.contract, "SetCapabilityMatrix", matrixJSON)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to set capability matrix with ISV")
+	}
+	return parseCapabilityMatrix(responseBytes)
+}
+
+// GetCapabilityMatrix returns the capability matrix in force
+func (isv *ISVContract) GetCapabilityMatrix() (*CapabilityMatrix, error) {
+	responseBytes, err := isv.client.evaluate(isv.contract, "GetCapabilityMatrix")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get capability matrix from ISV")
+	}
+	return parseCapabilityMatrix(responseBytes)
+}
+
+func parseCapabilityMatrix(responseBytes []byte) (*CapabilityMatrix, error) {
+	var matrix CapabilityMatrix
+	if err := json.Unmarshal(responseBytes, &matrix); err != nil {
+		return nil, errors.Wrap(err, "failed to parse capability matrix response")
+	}
+	return &matrix, nil
+}
+
+// SetClientPermissions grants a client actions, replacing its earlier
+// grant. nil returns the client to the matrix's default permissions, and
+// the result is then nil too.
+func (isv *ISVContract) SetClientPermissions(clientID string, actions []string) (*ClientPermissions, error) {
+	actionsJSON, err := json.Marshal(actions)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal actions")
+	}
+
+	responseBytes, err := isv.client.submit(isv.contract, "SetClientPermissions", clientID, string(actionsJSON))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to set client permissions with ISV")
+	}
+	return parseClientPermissions(responseBytes)
+}
+
+// GetClientPermissions returns the permissions granted to a client, or nil
+// if it holds the matrix's default permissions
+func (isv *ISVContract) GetClientPermissions(clientID string) (*ClientPermissions, error) {
+	responseBytes, err := isv.client.evaluate(isv.contract, "GetClientPermissions", clientID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get client permissions from ISV")
+	}
+	return parseClientPermissions(responseBytes)
+}
+
+func parseClientPermissions(responseBytes []byte) (*ClientPermissions, error) {
+	if len(responseBytes) == 0 {
+		return nil, nil
+	}
+	var permissions ClientPermissions
+	if err := json.Unmarshal(responseBytes, &permissions); err != nil {
+		return nil, errors.Wrap(err, "failed to parse client permissions response")
+	}
+	return &permissions, nil
+}
@@ -0,0 +1,95 @@
+package fabric
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// CapabilityProfile is a named, versioned capability set devices can be
+// registered with instead of listing capabilities
+type CapabilityProfile struct {
+	ProfileID    string    `json:"profileID"`
+	Version      int       `json:"version"`
+	Capabilities []string  `json:"capabilities"`
+	Description  string    `json:"description,omitempty"`
+	Owner        string    `json:"owner"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+// SetCapabilityProfile creates a capability profile or publishes a new
+// version of it
+func (isv *ISVContract) SetCapabilityProfile(profileID string, capabilities []string, description string) (*CapabilityProfile, error) {
+	limits := isv.client.PayloadLimits(isv.contract)
+	if err := limits.CheckID(profileID); err != nil {
+		return nil, errors.Wrap(err, "invalid profile ID")
+	}
+	if err := limits.CheckCapabilities(capabilities); err != nil {
+		return nil, errors.Wrap(err, "invalid capabilities")
+	}
+
+	capabilitiesJSON, err := json.Marshal(capabilities)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal capabilities")
+	}
+
+	responseBytes, err := isv.client.submit(isv.contract, "SetCapabilityProfile", profileID, string(capabilitiesJSON), description)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to set capability profile with ISV")
+	}
+	return parseCapabilityProfile(responseBytes)
+}
+
+// GetCapabilityProfile returns a version of a capability profile; version 0
+// is the current one
+func (isv *ISVContract) GetCapabilityProfile(profileID string, version int) (*CapabilityProfile, error) {
+	responseBytes, err := isv.client.evaluate(isv.contract, "GetCapabilityProfile", profileID, strconv.Itoa(version))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get capability profile from ISV")
+	}
+	return parseCapabilityProfile(responseBytes)
+}
+
+// GetAllCapabilityProfiles returns the current version of every profile
+func (isv *ISVContract) GetAllCapabilityProfiles() ([]*CapabilityProfile, error) {
+	responseBytes, err := isv.client.evaluate(isv.contract, "GetAllCapabilityProfiles")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get capability profiles from ISV")
+	}
+
+	var profiles []*CapabilityProfile
+	if err := json.Unmarshal(responseBytes, &profiles); err != nil {
+		return nil, errors.Wrap(err, "failed to parse capability profiles response")
+	}
+	return profiles, nil
+}
+
+// RegisterIoTDeviceWithProfile registers a device whose capabilities follow
+// a capability profile
+func (isv *ISVContract) RegisterIoTDeviceWithProfile(deviceID, devicePublicKeyPEM, profileID string) error {
+	limits := isv.client.PayloadLimits(isv.contract)
+	if err := limits.CheckID(deviceID); err != nil {
+		return errors.Wrap(err, "invalid device ID")
+	}
+	if err := limits.CheckPublicKey(devicePublicKeyPEM); err != nil {
+		return errors.Wrap(err, "invalid device public key")
+	}
+	if err := limits.CheckID(profileID); err != nil {
+		return errors.Wrap(err, "invalid profile ID")
+	}
+
+	if _, err := isv.client.submit(isv.contract, "RegisterIoTDeviceWithProfile", deviceID, devicePublicKeyPEM, profileID); err != nil {
+		return errors.Wrap(err, "failed to register IoT device with ISV")
+	}
+	return nil
+}
+
+func parseCapabilityProfile(responseBytes []byte) (*CapabilityProfile, error) {
+	var profile CapabilityProfile
+	if err := json.Unmarshal(responseBytes, &profile); err != nil {
+		return nil, errors.Wrap(err, "failed to parse capability profile response")
+	}
+	return &profile, nil
+}
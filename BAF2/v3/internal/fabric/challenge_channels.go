@@ -0,0 +1,170 @@
+package fabric
+
+import (
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ChallengeChannel is the app a client's push step-ups are delivered to
+type ChallengeChannel struct {
+	ClientID     string    `json:"clientID"`
+	Endpoint     string    `json:"endpoint"`
+	KeyType      string    `json:"keyType"`
+	PublicKey    string    `json:"publicKey"`
+	RegisteredAt time.Time `json:"registeredAt"`
+}
+
+// PushChallenge is the challenge of a client's open push step-up, as
+// delivered to its app
+type PushChallenge struct {
+	ClientID  string    `json:"clientID"`
+	Endpoint  string    `json:"endpoint"`
+	Challenge string    `json:"challenge"`
+	SourceIP  string    `json:"sourceIP,omitempty"`
+	Reasons   []string  `json:"reasons,omitempty"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// StepUpStatus is a client's pending step-up
+type StepUpStatus struct {
+	ClientID   string    `json:"clientID"`
+	DecisionID string    `json:"decisionID"`
+	Method     string    `json:"method"`
+	Challenge  string    `json:"challenge,omitempty"`
+	Satisfied  bool      `json:"satisfied"`
+	Denied     bool      `json:"denied,omitempty"`
+	ApprovedBy string    `json:"approvedBy,omitempty"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+}
+
+// SetChallengeChannel registers a client's challenge channel at the AS.
+// signature is the client's signature, made at timestamp (Unix seconds), over
+// SET_CHALLENGE_CHANNEL|<clientID>|<hex SHA-256 of endpoint|publicKeyPEM>|<timestamp>.
+func (as *AuthServerContract) SetChallengeChannel(clientID, endpoint, publicKeyPEM string, timestamp int64, signature string) (*ChallengeChannel, error) {
+	responseBytes, err := as.client.submit(as.contract, "SetChallengeChannel", clientID, endpoint, publicKeyPEM, strconv.FormatInt(timestamp, 10), signature)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to set challenge channel with AS")
+	}
+	return parseChallengeChannel(responseBytes)
+}
+
+// RemoveChallengeChannel removes a client's challenge channel. signature is
+// the client's signature over REMOVE_CHALLENGE_CHANNEL|<clientID>|<timestamp>.
+func (as *AuthServerContract) RemoveChallengeChannel(clientID string, timestamp int64, signature string) error {
+	if _, err := as.client.submit(as.contract, "RemoveChallengeChannel", clientID, strconv.FormatInt(timestamp, 10), signature); err != nil {
+		return errors.Wrap(err, "failed to remove challenge channel with AS")
+	}
+	return nil
+}
+
+// GetChallengeChannel returns a client's challenge channel, or nil if it has
+// none
+func (as *AuthServerContract) GetChallengeChannel(clientID string) (*ChallengeChannel, error) {
+	responseBytes, err := as.client.evaluate(as.contract, "GetChallengeChannel", clientID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get challenge channel from AS")
+	}
+	return parseChallengeChannel(responseBytes)
+}
+
+// GetPushChallenge returns the challenge of a client's open push step-up
+func (as *AuthServerContract) GetPushChallenge(clientID string) (*PushChallenge, error) {
+	responseBytes, err := as.client.evaluate(as.contract, "GetPushChallenge", clientID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get push challenge from AS")
+	}
+	var challenge PushChallenge
+	if err := json.Unmarshal(responseBytes, &challenge); err != nil {
+		return nil, errors.Wrap(err, "failed to parse push challenge response")
+	}
+	return &challenge, nil
+}
+
+// AnswerPushChallenge approves or denies a client's push step-up. signature
+// is the app's signature over PUSH_ANSWER|<clientID>|<challenge>|<answer>.
+func (as *AuthServerContract) AnswerPushChallenge(clientID, answer, signature string) error {
+	if _, err := as.client.submit(as.contract, "AnswerPushChallenge", clientID, answer, signature); err != nil {
+		return errors.Wrap(err, "failed to answer push challenge with AS")
+	}
+	return nil
+}
+
+// GetStepUpStatus returns a client's pending step-up, or nil if there is
+// none
+func (as *AuthServerContract) GetStepUpStatus(clientID string) (*StepUpStatus, error) {
+	responseBytes, err := as.client.evaluate(as.contract, "GetStepUpStatus", clientID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get step-up status from AS")
+	}
+	if len(responseBytes) == 0 {
+		return nil, nil
+	}
+	var status StepUpStatus
+	if err := json.Unmarshal(responseBytes, &status); err != nil {
+		return nil, errors.Wrap(err, "failed to parse step-up status response")
+	}
+	return &status, nil
+}
+
+// WatchPushStepUps subscribes to the AS risk decisions that open or carry
+// over a push step-up, and sends the ID of each client concerned. The
+// returned function cancels the subscription and closes the channel.
+func (as *AuthServerContract) WatchPushStepUps() (<-chan string, func(), error) {
+	registration, events, err := as.contract.RegisterEvent("^RiskDecision$")
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to subscribe to risk decision events")
+	}
+
+	clientIDs := make(chan string)
+	done := make(chan struct{})
+	go func() {
+		defer close(clientIDs)
+		for {
+			select {
+			case <-done:
+				return
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+				var decision RiskDecision
+				if err := json.Unmarshal(event.Payload, &decision); err != nil {
+					log.Warnf("Ignoring malformed risk decision event in tx %s: %v", event.TxID, err)
+					continue
+				}
+				if decision.Action != "step_up" || decision.StepUp != "push" {
+					continue
+				}
+				select {
+				case clientIDs <- decision.ClientID:
+				case <-done:
+					return
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			close(done)
+			as.contract.Unregister(registration)
+		})
+	}
+	return clientIDs, cancel, nil
+}
+
+func parseChallengeChannel(responseBytes []byte) (*ChallengeChannel, error) {
+	if len(responseBytes) == 0 {
+		return nil, nil
+	}
+	var channel ChallengeChannel
+	if err := json.Unmarshal(responseBytes, &channel); err != nil {
+		return nil, errors.Wrap(err, "failed to parse challenge channel response")
+	}
+	return &channel, nil
+}
@@ -5,9 +5,6 @@ import (
 	"path/filepath"
 	"fmt"
 
-	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/core"
-	"github.com/hyperledger/fabric-sdk-go/pkg/core/config"
-	"github.com/hyperledger/fabric-sdk-go/pkg/gateway"
 	"github.com/pkg/errors"
 )
 
@@ -24,8 +21,20 @@ type Client struct {
 	configPath  string
 	channelName string
 	wallet      *Wallet
-	gateway     *gateway.Gateway
+	api         string
+	gatewayPeer string
+	conn        connection
 	debug       bool
+	peers       PeerRoles
+	nextQuery   uint32
+	ageIdentity string
+	limits      limitsCache
+	protocols   protocolCache
+	strict      bool
+	flowID      string
+	pool        *ConnectionPool
+	pooled      *pooledConnection
+	transactions *TransactionLog
 }
 
 // ClientOptions contains options for creating a Fabric client
@@ -34,6 +43,39 @@ type ClientOptions struct {
 	ChannelName string
 	WalletPath  string
 	Debug       bool
+	
+	// Wallet selects the wallet backend at WalletPath (default: the
+	// plaintext file wallet)
+	Wallet WalletOptions
+	Peers       PeerRoles
+	
+	// AgeIdentityFile is the age identity used to decrypt ".age" connection
+	// profiles (defaults to $AUTHCLI_AGE_IDENTITY)
+	AgeIdentityFile string
+	
+	// Strict disables silent fallbacks: failed query peers are not retried
+	// on the default peers, unreadable payload limits fail the submit, and
+	// a chaincode that does not report its protocol versions is an error,
+	// and so is a service request the ISV cannot be made to authenticate
+	Strict bool
+	
+	// FlowID tags every submitted transaction with a flow ID (see SetFlowID)
+	FlowID string
+	
+	// Pool, if set, supplies the gateway connection and keeps it open when
+	// the client is closed (see ConnectionPool)
+	Pool *ConnectionPool
+	
+	// TransactionLog, if set, records every transaction the client submits
+	TransactionLog *TransactionLog
+	
+	// API is the Fabric client API, APISDK (default) or APIGateway
+	API string
+	
+	// GatewayPeer is the peer, by name in the connection profile, that
+	// APIGateway sends every request to (default: the first peer of the
+	// identity's organization)
+	GatewayPeer string
 }
 
 // NewClient creates a new Fabric client
@@ -47,8 +89,21 @@ func NewClient(options ClientOptions) (*Client, error) {
 		options.ChannelName = DefaultChannel
 	}
 	
-	// Create wallet
-	wallet, err := NewWallet(options.WalletPath)
+	if options.API == "" {
+		options.API = APISDK
+	}
+	if err := checkAPI(options.API); err != nil {
+		return nil, err
+	}
+	
+	if options.FlowID != "" {
+		if err := ValidateFlowID(options.FlowID); err != nil {
+			return nil, err
+		}
+	}
+	
+	// Open wallet
+	wallet, err := OpenWallet(options.WalletPath, options.Wallet)
 	if err != nil {
 		return nil, err
 	}
@@ -57,7 +112,15 @@ func NewClient(options ClientOptions) (*Client, error) {
 		configPath:  options.ConfigPath,
 		channelName: options.ChannelName,
 		wallet:      wallet,
+		api:         options.API,
+		gatewayPeer: options.GatewayPeer,
 		debug:       options.Debug,
+		peers:       options.Peers,
+		strict:      options.Strict,
+		ageIdentity: options.AgeIdentityFile,
+		flowID:      options.FlowID,
+		pool:        options.Pool,
+		transactions: options.TransactionLog,
 	}, nil
 }
 
@@ -85,63 +148,82 @@ func (c *Client) Connect(identity string) error {
 	}
 	
 	if c.debug {
-		fmt.Printf("Using connection profile at: %s\n", ccpPath)
+		fmt.Printf("Using connection profile at: %s (Fabric API %s)\n", ccpPath, c.api)
 	}
 	
-	configProvider := func() ([]core.ConfigBackend, error) {
-		return config.FromFile(ccpPath)()
+	connect := func() (connection, error) {
+		if c.api == APIGateway {
+			return c.connectGateway(ccpPath, identity)
+		}
+		return c.connectSDK(ccpPath, identity)
 	}
 	
-	// Connect to gateway
-	gw, err := gateway.Connect(
-		gateway.WithConfig(configProvider),
-		gateway.WithIdentity(c.wallet.wallet, identity),
-	)
-	if err != nil {
-		return errors.Wrap(err, "failed to connect to gateway")
-	}
-	
-	c.gateway = gw
-	return nil
-}
-
-// GetNetwork returns the Fabric network
-func (c *Client) GetNetwork() (*gateway.Network, error) {
-	if c.gateway == nil {
-		return nil, errors.New("not connected to gateway, call Connect() first")
+	if c.pool != nil {
+		key := connectionKey{ccpPath, c.ageIdentity, c.wallet.location, identity, c.api, c.gatewayPeer}
+		conn, err := c.pool.acquire(key, connect)
+		if err != nil {
+			return err
+		}
+		c.pooled = conn
+		c.conn = conn.conn
+		return nil
 	}
 	
-	network, err := c.gateway.GetNetwork(c.channelName)
+	conn, err := connect()
 	if err != nil {
-		return nil, errors.Wrapf(err, "failed to get network '%s'", c.channelName)
+		return err
 	}
-	
-	return network, nil
+	c.conn = conn
+	return nil
 }
 
 // GetContract returns a contract from the network
-func (c *Client) GetContract(contractID string) (*gateway.Contract, error) {
-	network, err := c.GetNetwork()
-	if err != nil {
-		return nil, err
+func (c *Client) GetContract(contractID string) (*Contract, error) {
+	if c.conn == nil {
+		return nil, errors.New("not connected to gateway, call Connect() first")
 	}
 	
 	if c.debug {
 		fmt.Printf("Getting contract: %s\n", contractID)
 	}
 	
-	contract := network.GetContract(contractID)
-	return contract, nil
+	backend, err := c.conn.contract(c.channelName, contractID)
+	if err != nil {
+		return nil, err
+	}
+	return &Contract{name: contractID, backend: backend}, nil
 }
 
-// Close closes the connection to the Fabric network
+// Close closes the connection to the Fabric network, or returns it to the
+// client's pool
 func (c *Client) Close() {
-	if c.gateway != nil {
-		c.gateway.Close()
-		c.gateway = nil
+	if c.pooled != nil {
+		c.pool.release(c.pooled)
+		c.pooled = nil
+		c.conn = nil
+		return
+	}
+	if c.conn != nil {
+		c.conn.close()
+		c.conn = nil
 	}
 }
 
+// API returns the Fabric client API the client uses
+func (c *Client) API() string {
+	return c.api
+}
+
+// ChannelName returns the channel the client is connected to
+func (c *Client) ChannelName() string {
+	return c.channelName
+}
+
+// Strict reports whether the client turns silent fallbacks into errors
+func (c *Client) Strict() bool {
+	return c.strict
+}
+
 // GetWallet returns the client's wallet
 func (c *Client) GetWallet() *Wallet {
 	return c.wallet
@@ -0,0 +1,35 @@
+package fabric
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// DeregisterClient removes a client's registration from the AS. signature
+// is the client's signature, made at timestamp (Unix seconds), over
+// DEREGISTER|<clientID>|<timestamp>.
+func (as *AuthServerContract) DeregisterClient(clientID string, timestamp int64, signature string) error {
+	_, err := as.client.submit(as.contract, "DeregisterClient", clientID, strconv.FormatInt(timestamp, 10), signature)
+	if err != nil {
+		return errors.Wrap(err, "failed to deregister client with AS")
+	}
+	return nil
+}
+
+// RotateClientKey replaces a client's public key at the AS and returns the
+// updated registration. signature is made with the current key over
+// ROTATE_KEY|<clientID>|<hex SHA-256 of newPublicKeyPEM>|<timestamp>.
+func (as *AuthServerContract) RotateClientKey(clientID, newPublicKeyPEM string, timestamp int64, signature string) (map[string]interface{}, error) {
+	responseBytes, err := as.client.submit(as.contract, "RotateClientKey", clientID, newPublicKeyPEM, strconv.FormatInt(timestamp, 10), signature)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to rotate client key with AS")
+	}
+
+	var client map[string]interface{}
+	if err := json.Unmarshal(responseBytes, &client); err != nil {
+		return nil, errors.Wrap(err, "failed to parse client registration")
+	}
+	return client, nil
+}
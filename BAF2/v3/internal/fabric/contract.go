@@ -0,0 +1,98 @@
+package fabric
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Fabric client APIs a Client can use (ClientOptions.API)
+const (
+	// APISDK is the gateway package of fabric-sdk-go, the default. It reads
+	// the whole connection profile and selects peers itself.
+	APISDK = "sdk"
+
+	// APIGateway is the fabric-gateway client API of Fabric 2.4 and later,
+	// which sends every request to one gateway peer.
+	APIGateway = "gateway"
+)
+
+// Contract is a chaincode on a Client's channel. Its transactions go through
+// the Fabric API the Client was created with.
+type Contract struct {
+	name    string
+	backend contractBackend
+}
+
+// ChaincodeEvent is an event set by a committed transaction
+type ChaincodeEvent struct {
+	TxID        string
+	ChaincodeID string
+	EventName   string
+	Payload     []byte
+	BlockNumber uint64
+}
+
+// EventRegistration is a subscription made with Contract.RegisterEvent
+type EventRegistration struct {
+	once   sync.Once
+	cancel func()
+}
+
+// Name returns the chaincode name
+func (c *Contract) Name() string {
+	return c.name
+}
+
+// RegisterEvent subscribes to the chaincode's events whose name matches the
+// eventFilter regular expression, from the next block on. Unregister
+// closes the channel.
+func (c *Contract) RegisterEvent(eventFilter string) (*EventRegistration, <-chan *ChaincodeEvent, error) {
+	events, cancel, err := c.backend.registerEvent(eventFilter)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &EventRegistration{cancel: cancel}, events, nil
+}
+
+// Unregister cancels a subscription
+func (c *Contract) Unregister(registration *EventRegistration) {
+	if registration != nil {
+		registration.once.Do(registration.cancel)
+	}
+}
+
+// txOptions are what a Client adds to a transaction
+type txOptions struct {
+	// peers endorse a submitted transaction, or evaluate a query, by name
+	// in the connection profile; empty leaves the choice to the API
+	peers     []string
+	transient map[string][]byte
+}
+
+// contractBackend runs a chaincode's transactions through one Fabric API
+type contractBackend interface {
+	evaluate(name string, options txOptions, args []string) ([]byte, error)
+	// submit returns the ID of the transaction when it got one, also with
+	// an error
+	submit(name string, options txOptions, args []string) ([]byte, string, error)
+	// registerEvent returns the events matching eventFilter and the
+	// function that ends the subscription and closes the channel
+	registerEvent(eventFilter string) (<-chan *ChaincodeEvent, func(), error)
+}
+
+// connection is a connection to the network, as one identity, through one
+// Fabric API
+type connection interface {
+	contract(channelName, contractID string) (contractBackend, error)
+	close()
+}
+
+// checkAPI returns an error for an unknown API name
+func checkAPI(api string) error {
+	switch api {
+	case APISDK, APIGateway:
+		return nil
+	}
+	return errors.Errorf("unknown Fabric API %q (want %s or %s)", api, APISDK, APIGateway)
+}
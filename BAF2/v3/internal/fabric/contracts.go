@@ -1,9 +1,15 @@
 package fabric
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
-	"github.com/hyperledger/fabric-sdk-go/pkg/gateway"
+	"github.com/chaichis-network/v3/pkg/ticket"
 	"github.com/pkg/errors"
 )
 
@@ -27,23 +33,24 @@ func NewContractManager(client *Client) *ContractManager {
 }
 
 // GetASContract returns the Authentication Server contract
-func (cm *ContractManager) GetASContract() (*gateway.Contract, error) {
+func (cm *ContractManager) GetASContract() (*Contract, error) {
 	return cm.client.GetContract(ASContractID)
 }
 
 // GetTGSContract returns the Ticket Granting Server contract
-func (cm *ContractManager) GetTGSContract() (*gateway.Contract, error) {
+func (cm *ContractManager) GetTGSContract() (*Contract, error) {
 	return cm.client.GetContract(TGSContractID)
 }
 
 // GetISVContract returns the IoT Service Validator contract
-func (cm *ContractManager) GetISVContract() (*gateway.Contract, error) {
+func (cm *ContractManager) GetISVContract() (*Contract, error) {
 	return cm.client.GetContract(ISVContractID)
 }
 
 // AuthServerContract provides operations for the Authentication Server chaincode
 type AuthServerContract struct {
-	contract *gateway.Contract
+	client   *Client
+	contract *Contract
 }
 
 // NewAuthServerContract creates a new Auth Server contract handler
@@ -54,13 +61,31 @@ func NewAuthServerContract(client *Client) (*AuthServerContract, error) {
 	}
 	
 	return &AuthServerContract{
+		client:   client,
 		contract: contract,
 	}, nil
 }
 
-// RegisterClient registers a client with the Authentication Server
+// RegisterClient registers a client with the Authentication Server. The
+// client ID is reserved first, so that of two concurrent registrations of
+// one ID the loser fails with a "registration in progress" error (see
+// IsRegistrationInProgress) instead of an MVCC conflict. An AS that
+// predates reservations is registered with directly, unless the client is
+// strict.
 func (as *AuthServerContract) RegisterClient(clientID, clientPublicKeyPEM string) error {
-	_, err := as.contract.SubmitTransaction("RegisterClient", clientID, clientPublicKeyPEM)
+	limits := as.client.PayloadLimits(as.contract)
+	if err := limits.CheckID(clientID); err != nil {
+		return errors.Wrap(err, "invalid client ID")
+	}
+	if err := limits.CheckPublicKey(clientPublicKeyPEM); err != nil {
+		return errors.Wrap(err, "invalid client public key")
+	}
+	
+	if err := as.reserveRegistration(clientID, clientPublicKeyPEM); err != nil {
+		return err
+	}
+	
+	_, err := as.client.submit(as.contract, "RegisterClient", clientID, clientPublicKeyPEM)
 	if err != nil {
 		return errors.Wrap(err, "failed to register client with AS")
 	}
@@ -68,38 +93,110 @@ func (as *AuthServerContract) RegisterClient(clientID, clientPublicKeyPEM string
 	return nil
 }
 
+// reserveRegistration reserves clientID for the key on the AS
+func (as *AuthServerContract) reserveRegistration(clientID, clientPublicKeyPEM string) error {
+	keyHash := sha256.Sum256([]byte(clientPublicKeyPEM))
+	_, err := as.client.submit(as.contract, "ReserveClientRegistration", clientID, hex.EncodeToString(keyHash[:]))
+	if err == nil {
+		return nil
+	}
+	if strings.Contains(err.Error(), "Function ReserveClientRegistration not found") && !as.client.strict {
+		log.Debugf("AS does not reserve client IDs; registering %s without a reservation", clientID)
+		return nil
+	}
+	return errors.Wrap(err, "failed to reserve client ID with AS")
+}
+
+// IsRegistrationInProgress reports whether RegisterClient failed because
+// another registration holds the client ID's reservation. Retrying after
+// the reservation expires succeeds if that registration never completed.
+func IsRegistrationInProgress(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "registration in progress")
+}
+
+// RiskDecision is the AS risk policy's verdict on an authentication attempt
+type RiskDecision struct {
+	DecisionID string `json:"decisionID"`
+	ClientID   string `json:"clientID"`
+	SourceIP   string `json:"sourceIP,omitempty"`
+	// SourceIPIgnored is set when the caller was not a gateway the policy
+	// trusts, so the source IP it reported was treated as unknown
+	SourceIPIgnored bool      `json:"sourceIPIgnored,omitempty"`
+	Hour            int       `json:"hour"`
+	RecentFailures  int       `json:"recentFailures"`
+	Action          string    `json:"action"` // allow, step_up or deny
+	StepUp          string    `json:"stepUp,omitempty"`
+	Reasons         []string  `json:"reasons,omitempty"`
+	FlowID          string    `json:"flowID,omitempty"`
+	Timestamp       time.Time `json:"timestamp"`
+}
+
+// NonceChallenge is the AS's answer to an authentication request
+type NonceChallenge struct {
+	Nonce          string        `json:"nonce"`
+	ExpirationTime int64         `json:"expirationTime"`
+	Risk           *RiskDecision `json:"risk"`
+	// Terms is the notice the client must acknowledge before it can answer
+	// the challenge, if any
+	Terms *TermsNotice `json:"terms,omitempty"`
+}
+
 // GetNonceChallenge gets a nonce challenge for client authentication
 func (as *AuthServerContract) GetNonceChallenge(clientID string) (string, error) {
-	responseBytes, err := as.contract.SubmitTransaction("InitiateAuthentication", clientID)
+	challenge, err := as.InitiateAuthentication(clientID, "")
 	if err != nil {
-		return "", errors.Wrap(err, "failed to get nonce challenge from AS")
+		return "", err
+	}
+	return challenge.Nonce, nil
+}
+
+// InitiateAuthentication gets a nonce challenge, passing the attempt's source
+// IP to the AS risk policy. Attempts the policy denies return an error along
+// with the challenge holding the decision.
+func (as *AuthServerContract) InitiateAuthentication(clientID, sourceIP string) (*NonceChallenge, error) {
+	authContextJSON, err := json.Marshal(map[string]string{"sourceIP": sourceIP})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal auth context")
 	}
 	
-	var response struct {
-		Nonce          string `json:"nonce"`
-		ExpirationTime int64  `json:"expirationTime"`
+	responseBytes, err := as.client.submit(as.contract, "InitiateAuthenticationWithContext", clientID, string(authContextJSON))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get nonce challenge from AS")
 	}
 	
-	if err := json.Unmarshal(responseBytes, &response); err != nil {
-		return "", errors.Wrap(err, "failed to parse nonce response")
+	var challenge NonceChallenge
+	if err := json.Unmarshal(responseBytes, &challenge); err != nil {
+		return nil, errors.Wrap(err, "failed to parse nonce response")
+	}
+	if challenge.Risk != nil && challenge.Risk.Action == "deny" {
+		return &challenge, errors.Errorf("authentication denied by risk policy: %s", strings.Join(challenge.Risk.Reasons, "; "))
 	}
 	
-	return response.Nonce, nil
+	return &challenge, nil
 }
 
 // VerifyClientIdentity verifies a client's identity using a signed nonce
 func (as *AuthServerContract) VerifyClientIdentity(clientID, signedNonce string) error {
-	_, err := as.contract.SubmitTransaction("VerifyClientIdentityWithSignature", clientID, signedNonce)
+	responseBytes, err := as.client.submit(as.contract, "VerifyClientIdentityWithSignature", clientID, signedNonce)
 	if err != nil {
 		return errors.Wrap(err, "failed to verify client identity with AS")
 	}
 	
+	// The AS reports a bad signature as a committed "false" result
+	var verified bool
+	if err := json.Unmarshal(responseBytes, &verified); err != nil {
+		return errors.Wrap(err, "failed to parse verification response")
+	}
+	if !verified {
+		return errors.New("AS rejected the nonce signature")
+	}
+	
 	return nil
 }
 
 // GenerateTGT generates a Ticket Granting Ticket for a client
 func (as *AuthServerContract) GenerateTGT(clientID string) (map[string]string, error) {
-	responseBytes, err := as.contract.SubmitTransaction("GenerateTGT", clientID)
+	responseBytes, err := as.client.submit(as.contract, "GenerateTGT", clientID)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to generate TGT from AS")
 	}
@@ -112,9 +209,103 @@ func (as *AuthServerContract) GenerateTGT(clientID string) (map[string]string, e
 	return response, nil
 }
 
+// SetRiskPolicy stores the AS risk policy
+func (as *AuthServerContract) SetRiskPolicy(policyJSON string) error {
+	_, err := as.client.submit(as.contract, "SetRiskPolicy", policyJSON)
+	if err != nil {
+		return errors.Wrap(err, "failed to set risk policy with AS")
+	}
+	
+	return nil
+}
+
+// GetRiskPolicy retrieves the AS risk policy, or nil if none is set
+func (as *AuthServerContract) GetRiskPolicy() (map[string]interface{}, error) {
+	responseBytes, err := as.client.evaluate(as.contract, "GetRiskPolicy")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get risk policy from AS")
+	}
+	if len(responseBytes) == 0 {
+		return nil, nil
+	}
+	
+	var policy map[string]interface{}
+	if err := json.Unmarshal(responseBytes, &policy); err != nil {
+		return nil, errors.Wrap(err, "failed to parse risk policy response")
+	}
+	
+	return policy, nil
+}
+
+// GetRiskDecisions retrieves the recorded risk decisions for a client
+func (as *AuthServerContract) GetRiskDecisions(clientID string) ([]RiskDecision, error) {
+	responseBytes, err := as.client.evaluate(as.contract, "GetRiskDecisions", clientID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get risk decisions from AS")
+	}
+	
+	var decisions []RiskDecision
+	if err := json.Unmarshal(responseBytes, &decisions); err != nil {
+		return nil, errors.Wrap(err, "failed to parse risk decisions response")
+	}
+	
+	return decisions, nil
+}
+
+// IssueStepUpCode records the hash of a one-time step-up code for a client
+func (as *AuthServerContract) IssueStepUpCode(clientID, codeHash string) error {
+	_, err := as.client.submit(as.contract, "IssueStepUpCode", clientID, codeHash)
+	if err != nil {
+		return errors.Wrap(err, "failed to issue step-up code with AS")
+	}
+	
+	return nil
+}
+
+// CompleteStepUp completes a client's step-up with a one-time code
+func (as *AuthServerContract) CompleteStepUp(clientID, code string) error {
+	_, err := as.client.submit(as.contract, "CompleteStepUp", clientID, code)
+	if err != nil {
+		return errors.Wrap(err, "failed to complete step-up with AS")
+	}
+	
+	return nil
+}
+
+// ApproveStepUp approves a client's step-up as a risk policy admin
+func (as *AuthServerContract) ApproveStepUp(clientID string) error {
+	_, err := as.client.submit(as.contract, "ApproveStepUp", clientID)
+	if err != nil {
+		return errors.Wrap(err, "failed to approve step-up with AS")
+	}
+	
+	return nil
+}
+
+// GetMetrics retrieves the AS chaincode's operation counters
+func (as *AuthServerContract) GetMetrics() (map[string]int64, error) {
+	return getMetrics(as.client, as.contract)
+}
+
+// GetAllClientRegistrations retrieves every client registered with the AS
+func (as *AuthServerContract) GetAllClientRegistrations() ([]map[string]interface{}, error) {
+	responseBytes, err := as.client.evaluate(as.contract, "GetAllClientRegistrations")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get client registrations from AS")
+	}
+
+	var clients []map[string]interface{}
+	if err := json.Unmarshal(responseBytes, &clients); err != nil {
+		return nil, errors.Wrap(err, "failed to parse client registrations response")
+	}
+
+	return clients, nil
+}
+
 // TicketGrantingContract provides operations for the Ticket Granting Server chaincode
 type TicketGrantingContract struct {
-	contract *gateway.Contract
+	client   *Client
+	contract *Contract
 }
 
 // NewTicketGrantingContract creates a new Ticket Granting contract handler
@@ -125,6 +316,7 @@ func NewTicketGrantingContract(client *Client) (*TicketGrantingContract, error)
 	}
 	
 	return &TicketGrantingContract{
+		client:   client,
 		contract: contract,
 	}, nil
 }
@@ -137,7 +329,7 @@ func (tgs *TicketGrantingContract) GenerateServiceTicket(request map[string]stri
 		return nil, errors.Wrap(err, "failed to marshal service ticket request")
 	}
 	
-	responseBytes, err := tgs.contract.SubmitTransaction("GenerateServiceTicket", string(requestJSON))
+	responseBytes, err := tgs.client.submit(tgs.contract, "GenerateServiceTicket", string(requestJSON))
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to generate service ticket from TGS")
 	}
@@ -150,9 +342,46 @@ func (tgs *TicketGrantingContract) GenerateServiceTicket(request map[string]stri
 	return response, nil
 }
 
+// GenerateServiceTickets generates service tickets for several services in
+// one round trip, keyed by service ID
+func (tgs *TicketGrantingContract) GenerateServiceTickets(request *ticket.MultiServiceTicketRequest) (map[string]map[string]string, error) {
+	requestJSON, err := json.Marshal(request)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal service ticket request")
+	}
+	
+	responseBytes, err := tgs.client.submit(tgs.contract, "GenerateServiceTickets", string(requestJSON))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to generate service tickets from TGS")
+	}
+	
+	var response map[string]map[string]string
+	if err := json.Unmarshal(responseBytes, &response); err != nil {
+		return nil, errors.Wrap(err, "failed to parse service tickets response")
+	}
+	
+	return response, nil
+}
+
+// RevokeServiceTicket revokes an issued service ticket that will not be used
+func (tgs *TicketGrantingContract) RevokeServiceTicket(clientID, serviceID, encryptedServiceTicket string) error {
+	_, err := tgs.client.submit(tgs.contract, "RevokeServiceTicket", clientID, serviceID, encryptedServiceTicket)
+	if err != nil {
+		return errors.Wrap(err, "failed to revoke service ticket with TGS")
+	}
+	
+	return nil
+}
+
+// GetMetrics retrieves the TGS chaincode's operation counters
+func (tgs *TicketGrantingContract) GetMetrics() (map[string]int64, error) {
+	return getMetrics(tgs.client, tgs.contract)
+}
+
 // ISVContract provides operations for the IoT Service Validator chaincode
 type ISVContract struct {
-	contract *gateway.Contract
+	client   *Client
+	contract *Contract
 }
 
 // NewISVContract creates a new ISV contract handler
@@ -163,19 +392,31 @@ func NewISVContract(client *Client) (*ISVContract, error) {
 	}
 	
 	return &ISVContract{
+		client:   client,
 		contract: contract,
 	}, nil
 }
 
 // RegisterIoTDevice registers an IoT device with the ISV
 func (isv *ISVContract) RegisterIoTDevice(deviceID, devicePublicKeyPEM string, capabilities []string) error {
+	limits := isv.client.PayloadLimits(isv.contract)
+	if err := limits.CheckID(deviceID); err != nil {
+		return errors.Wrap(err, "invalid device ID")
+	}
+	if err := limits.CheckPublicKey(devicePublicKeyPEM); err != nil {
+		return errors.Wrap(err, "invalid device public key")
+	}
+	if err := limits.CheckCapabilities(capabilities); err != nil {
+		return errors.Wrap(err, "invalid capabilities")
+	}
+	
 	// Convert capabilities to JSON
 	capabilitiesJSON, err := json.Marshal(capabilities)
 	if err != nil {
 		return errors.Wrap(err, "failed to marshal capabilities")
 	}
 	
-	_, err = isv.contract.SubmitTransaction("RegisterIoTDevice", deviceID, devicePublicKeyPEM, string(capabilitiesJSON))
+	_, err = isv.client.submit(isv.contract, "RegisterIoTDevice", deviceID, devicePublicKeyPEM, string(capabilitiesJSON))
 	if err != nil {
 		return errors.Wrap(err, "failed to register IoT device with ISV")
 	}
@@ -185,7 +426,7 @@ func (isv *ISVContract) RegisterIoTDevice(deviceID, devicePublicKeyPEM string, c
 
 // ValidateServiceTicket validates a service ticket with the ISV
 func (isv *ISVContract) ValidateServiceTicket(encryptedServiceTicket string) error {
-	_, err := isv.contract.SubmitTransaction("ValidateServiceTicket", encryptedServiceTicket)
+	_, err := isv.client.submit(isv.contract, "ValidateServiceTicket", encryptedServiceTicket)
 	if err != nil {
 		return errors.Wrap(err, "failed to validate service ticket with ISV")
 	}
@@ -193,7 +434,8 @@ func (isv *ISVContract) ValidateServiceTicket(encryptedServiceTicket string) err
 	return nil
 }
 
-// ProcessServiceRequest processes a service request for an IoT device
+// ProcessServiceRequest processes a service request for an IoT device. A
+// device at its load limits fails it with a *DeviceOverloadedError.
 func (isv *ISVContract) ProcessServiceRequest(request map[string]string) (map[string]string, error) {
 	// Convert request to JSON
 	requestJSON, err := json.Marshal(request)
@@ -201,8 +443,11 @@ func (isv *ISVContract) ProcessServiceRequest(request map[string]string) (map[st
 		return nil, errors.Wrap(err, "failed to marshal service request")
 	}
 	
-	responseBytes, err := isv.contract.SubmitTransaction("ProcessServiceRequest", string(requestJSON))
+	responseBytes, err := isv.client.submit(isv.contract, "ProcessServiceRequest", string(requestJSON))
 	if err != nil {
+		if overloaded, ok := parseDeviceOverloaded(err); ok {
+			return nil, overloaded
+		}
 		return nil, errors.Wrap(err, "failed to process service request with ISV")
 	}
 	
@@ -216,7 +461,7 @@ func (isv *ISVContract) ProcessServiceRequest(request map[string]string) (map[st
 
 // CloseSession closes an active session with an IoT device
 func (isv *ISVContract) CloseSession(sessionID string) error {
-	_, err := isv.contract.SubmitTransaction("CloseSession", sessionID)
+	_, err := isv.client.submit(isv.contract, "CloseSession", sessionID)
 	if err != nil {
 		return errors.Wrap(err, "failed to close session with ISV")
 	}
@@ -224,9 +469,250 @@ func (isv *ISVContract) CloseSession(sessionID string) error {
 	return nil
 }
 
+// GetActiveSessionsByClient retrieves the active sessions of a client
+func (isv *ISVContract) GetActiveSessionsByClient(clientID string) ([]map[string]interface{}, error) {
+	return isv.getSessions("GetActiveSessionsByClient", clientID)
+}
+
+// GetActiveSessionsByDevice retrieves the active sessions on a device
+func (isv *ISVContract) GetActiveSessionsByDevice(deviceID string) ([]map[string]interface{}, error) {
+	return isv.getSessions("GetActiveSessionsByDevice", deviceID)
+}
+
+func (isv *ISVContract) getSessions(function, id string) ([]map[string]interface{}, error) {
+	responseBytes, err := isv.client.evaluate(isv.contract, function, id)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get sessions from ISV")
+	}
+	
+	var sessions []map[string]interface{}
+	if err := json.Unmarshal(responseBytes, &sessions); err != nil {
+		return nil, errors.Wrap(err, "failed to parse sessions response")
+	}
+	
+	return sessions, nil
+}
+
+// CreateAccessGrant records a one-time access grant for a device
+func (isv *ISVContract) CreateAccessGrant(deviceID, codeHash string, capabilities []string, ttlSeconds int64, signature string) (map[string]interface{}, error) {
+	capabilitiesJSON, err := json.Marshal(capabilities)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal capabilities")
+	}
+	
+	responseBytes, err := isv.client.submit(isv.contract, "CreateAccessGrant", deviceID, codeHash, string(capabilitiesJSON), strconv.FormatInt(ttlSeconds, 10), signature)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create access grant with ISV")
+	}
+	
+	var grant map[string]interface{}
+	if err := json.Unmarshal(responseBytes, &grant); err != nil {
+		return nil, errors.Wrap(err, "failed to parse access grant response")
+	}
+	
+	return grant, nil
+}
+
+// RedeemAccessGrant exchanges a one-time access code for a session
+func (isv *ISVContract) RedeemAccessGrant(code string, request map[string]string) (map[string]string, error) {
+	requestJSON, err := json.Marshal(request)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal service request")
+	}
+	
+	responseBytes, err := isv.client.submit(isv.contract, "RedeemAccessGrant", code, string(requestJSON))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to redeem access grant with ISV")
+	}
+	
+	var response map[string]string
+	if err := json.Unmarshal(responseBytes, &response); err != nil {
+		return nil, errors.Wrap(err, "failed to parse service response")
+	}
+	
+	return response, nil
+}
+
+// RevokeAccessGrant cancels an unredeemed access grant
+func (isv *ISVContract) RevokeAccessGrant(codeHash, signature string) error {
+	_, err := isv.client.submit(isv.contract, "RevokeAccessGrant", codeHash, signature)
+	if err != nil {
+		return errors.Wrap(err, "failed to revoke access grant with ISV")
+	}
+	
+	return nil
+}
+
+// SetDeviceApprovers sets the clients allowed to co-sign sensitive operations
+func (isv *ISVContract) SetDeviceApprovers(deviceID string, approvers []string, signature string) error {
+	approversJSON, err := json.Marshal(approvers)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal approvers")
+	}
+	
+	_, err = isv.client.submit(isv.contract, "SetDeviceApprovers", deviceID, string(approversJSON), signature)
+	if err != nil {
+		return errors.Wrap(err, "failed to set device approvers with ISV")
+	}
+	
+	return nil
+}
+
+// ApproveOperation co-signs a pending sensitive operation
+func (isv *ISVContract) ApproveOperation(approvalID string, request map[string]string) (map[string]interface{}, error) {
+	return isv.decideOperation("ApproveOperation", "approve", approvalID, request)
+}
+
+// RejectOperation rejects a pending sensitive operation
+func (isv *ISVContract) RejectOperation(approvalID string, request map[string]string) (map[string]interface{}, error) {
+	return isv.decideOperation("RejectOperation", "reject", approvalID, request)
+}
+
+func (isv *ISVContract) decideOperation(function, action, approvalID string, request map[string]string) (map[string]interface{}, error) {
+	requestJSON, err := json.Marshal(request)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal approval request")
+	}
+	
+	responseBytes, err := isv.client.submit(isv.contract, function, approvalID, string(requestJSON))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to %s operation with ISV", action)
+	}
+	
+	var approval map[string]interface{}
+	if err := json.Unmarshal(responseBytes, &approval); err != nil {
+		return nil, errors.Wrap(err, "failed to parse approval response")
+	}
+	
+	return approval, nil
+}
+
+// GetPendingApprovals retrieves operations awaiting co-signature; an empty
+// device ID returns them for all devices
+func (isv *ISVContract) GetPendingApprovals(deviceID string) ([]map[string]interface{}, error) {
+	responseBytes, err := isv.client.evaluate(isv.contract, "GetPendingApprovals", deviceID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get pending approvals from ISV")
+	}
+	
+	var approvals []map[string]interface{}
+	if err := json.Unmarshal(responseBytes, &approvals); err != nil {
+		return nil, errors.Wrap(err, "failed to parse pending approvals response")
+	}
+	
+	return approvals, nil
+}
+
+// GetApproval retrieves a single approval record
+func (isv *ISVContract) GetApproval(approvalID string) (map[string]interface{}, error) {
+	responseBytes, err := isv.client.evaluate(isv.contract, "GetApproval", approvalID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get approval from ISV")
+	}
+	
+	var approval map[string]interface{}
+	if err := json.Unmarshal(responseBytes, &approval); err != nil {
+		return nil, errors.Wrap(err, "failed to parse approval response")
+	}
+	
+	return approval, nil
+}
+
+// ConfigChange is a DeviceConfigChanged event emitted by the ISV chaincode
+type ConfigChange struct {
+	DeviceID    string `json:"deviceID"`
+	Version     int64  `json:"version"`
+	ConfigHash  string `json:"configHash"`
+	FlowID      string `json:"flowID,omitempty"`
+	BlockNumber uint64 `json:"-"`
+}
+
+// SetDeviceConfig publishes a signed configuration for a device
+func (isv *ISVContract) SetDeviceConfig(deviceID, configJSON string, version int64, signature string) error {
+	_, err := isv.client.submit(isv.contract, "SetDeviceConfig", deviceID, configJSON, strconv.FormatInt(version, 10), signature)
+	if err != nil {
+		return errors.Wrap(err, "failed to set device config with ISV")
+	}
+	
+	return nil
+}
+
+// GetDeviceConfig retrieves the current configuration record of a device
+func (isv *ISVContract) GetDeviceConfig(deviceID string) (map[string]interface{}, error) {
+	responseBytes, err := isv.client.evaluate(isv.contract, "GetDeviceConfig", deviceID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get device config from ISV")
+	}
+	
+	var config map[string]interface{}
+	if err := json.Unmarshal(responseBytes, &config); err != nil {
+		return nil, errors.Wrap(err, "failed to parse device config response")
+	}
+	
+	return config, nil
+}
+
+// AckDeviceConfig acknowledges a config version on behalf of the device agent
+func (isv *ISVContract) AckDeviceConfig(deviceID string, version int64, status, message, signature string) error {
+	_, err := isv.client.submit(isv.contract, "AckDeviceConfig", deviceID, strconv.FormatInt(version, 10), status, message, signature)
+	if err != nil {
+		return errors.Wrap(err, "failed to acknowledge device config with ISV")
+	}
+	
+	return nil
+}
+
+// WatchConfigChanges subscribes to config change events for a device. The
+// returned function cancels the subscription and closes the channel.
+func (isv *ISVContract) WatchConfigChanges(deviceID string) (<-chan ConfigChange, func(), error) {
+	registration, events, err := isv.contract.RegisterEvent("DeviceConfigChanged")
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to subscribe to config events")
+	}
+	
+	changes := make(chan ConfigChange)
+	done := make(chan struct{})
+	go func() {
+		defer close(changes)
+		for {
+			select {
+			case <-done:
+				return
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+				var change ConfigChange
+				if err := json.Unmarshal(event.Payload, &change); err != nil {
+					log.Warnf("Ignoring malformed config event in tx %s: %v", event.TxID, err)
+					continue
+				}
+				if change.DeviceID != deviceID {
+					continue
+				}
+				change.BlockNumber = event.BlockNumber
+				select {
+				case changes <- change:
+				case <-done:
+					return
+				}
+			}
+		}
+	}()
+	
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			close(done)
+			isv.contract.Unregister(registration)
+		})
+	}
+	return changes, cancel, nil
+}
+
 // GetAllIoTDevices retrieves all registered IoT devices
 func (isv *ISVContract) GetAllIoTDevices() ([]map[string]interface{}, error) {
-	responseBytes, err := isv.contract.EvaluateTransaction("GetAllIoTDevices")
+	responseBytes, err := isv.client.evaluate(isv.contract, "GetAllIoTDevices")
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to get IoT devices from ISV")
 	}
@@ -238,3 +724,23 @@ func (isv *ISVContract) GetAllIoTDevices() ([]map[string]interface{}, error) {
 	
 	return devices, nil
 }
+
+// GetMetrics retrieves the ISV chaincode's operation counters
+func (isv *ISVContract) GetMetrics() (map[string]int64, error) {
+	return getMetrics(isv.client, isv.contract)
+}
+
+// getMetrics evaluates GetMetrics on a chaincode
+func getMetrics(client *Client, contract *Contract) (map[string]int64, error) {
+	responseBytes, err := client.evaluate(contract, "GetMetrics")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get metrics")
+	}
+	
+	var metrics map[string]int64
+	if err := json.Unmarshal(responseBytes, &metrics); err != nil {
+		return nil, errors.Wrap(err, "failed to parse metrics response")
+	}
+	
+	return metrics, nil
+}
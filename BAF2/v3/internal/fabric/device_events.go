@@ -0,0 +1,85 @@
+package fabric
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// deviceChangeEvents are the ISV events after which a device record may
+// have changed: registration, status updates, revocation, decommissioning,
+// reactivation and deregistration, and access log entries, since opening
+// and closing sessions changes a device's status
+const deviceChangeEvents = "^(DeviceRegistered|DeviceUpdated|DevicesRevoked|DeviceDecommissioned|DeviceReactivated|DeviceDeregistered|AccessLogged)$"
+
+// DeviceChange reports that the records of some devices changed
+type DeviceChange struct {
+	Event       string
+	DeviceIDs   []string
+	BlockNumber uint64
+}
+
+// WatchDeviceChanges subscribes to the events that change device records.
+// The returned function cancels the subscription and closes the channel.
+func (isv *ISVContract) WatchDeviceChanges() (<-chan DeviceChange, func(), error) {
+	registration, events, err := isv.contract.RegisterEvent(deviceChangeEvents)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to subscribe to device events")
+	}
+
+	changes := make(chan DeviceChange)
+	done := make(chan struct{})
+	go func() {
+		defer close(changes)
+		for {
+			select {
+			case <-done:
+				return
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+				deviceIDs, err := changedDevices(event.EventName, event.Payload)
+				if err != nil {
+					log.Warnf("Ignoring malformed %s event in tx %s: %v", event.EventName, event.TxID, err)
+					continue
+				}
+				change := DeviceChange{Event: event.EventName, DeviceIDs: deviceIDs, BlockNumber: event.BlockNumber}
+				select {
+				case changes <- change:
+				case <-done:
+					return
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			close(done)
+			isv.contract.Unregister(registration)
+		})
+	}
+	return changes, cancel, nil
+}
+
+// changedDevices returns the devices a device change event is about
+func changedDevices(eventName string, payload []byte) ([]string, error) {
+	if eventName == "DevicesRevoked" {
+		var result RevocationResult
+		if err := json.Unmarshal(payload, &result); err != nil {
+			return nil, err
+		}
+		return result.Revoked, nil
+	}
+
+	var event struct {
+		DeviceID string `json:"deviceID"`
+	}
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, err
+	}
+	return []string{event.DeviceID}, nil
+}
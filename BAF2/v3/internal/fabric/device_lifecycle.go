@@ -0,0 +1,45 @@
+package fabric
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// DeviceLifecycleResult reports a device decommission, reactivation or
+// deregistration
+type DeviceLifecycleResult struct {
+	DeviceID       string   `json:"deviceID"`
+	Status         string   `json:"status"` // "decommissioned", "active" or "deregistered"
+	ClosedSessions []string `json:"closedSessions"`
+}
+
+// DecommissionDevice takes a device out of service and closes its sessions.
+// Only the organization that registered the device may decommission it.
+func (isv *ISVContract) DecommissionDevice(deviceID, reason string) (*DeviceLifecycleResult, error) {
+	return isv.changeLifecycle("DecommissionDevice", deviceID, reason)
+}
+
+// ReactivateDevice puts a decommissioned device back in service
+func (isv *ISVContract) ReactivateDevice(deviceID string) (*DeviceLifecycleResult, error) {
+	return isv.changeLifecycle("ReactivateDevice", deviceID)
+}
+
+// DeregisterIoTDevice deletes a decommissioned or revoked device from the
+// ISV. The device ID can then be registered again.
+func (isv *ISVContract) DeregisterIoTDevice(deviceID, reason string) (*DeviceLifecycleResult, error) {
+	return isv.changeLifecycle("DeregisterIoTDevice", deviceID, reason)
+}
+
+func (isv *ISVContract) changeLifecycle(name string, args ...string) (*DeviceLifecycleResult, error) {
+	responseBytes, err := isv.client.submit(isv.contract, name, args...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "%s failed on ISV", name)
+	}
+
+	var result DeviceLifecycleResult
+	if err := json.Unmarshal(responseBytes, &result); err != nil {
+		return nil, errors.Wrap(err, "failed to parse lifecycle response")
+	}
+	return &result, nil
+}
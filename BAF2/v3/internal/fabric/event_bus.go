@@ -0,0 +1,237 @@
+package fabric
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Chaincode events of the IoT demo chaincodes that applications commonly
+// follow. The bus passes on any event name; these are for convenience.
+const (
+	EventUserRegistered    = "UserRegistered"    // user-acl: a user signed up
+	EventAccessGranted     = "AccessGranted"     // user-acl: an owner shared a device
+	EventSessionTerminated = "SessionTerminated" // ISV: a client-device session ended
+	EventTemperatureStored = "TemperatureStored" // iot-data: a reading was stored
+)
+
+// defaultEventBuffer is how many events a subscriber may fall behind by
+// before the bus drops events for it
+const defaultEventBuffer = 256
+
+// Event is a chaincode event as the bus delivers it
+type Event struct {
+	Chaincode   string          `json:"chaincode"`
+	Name        string          `json:"event"`
+	TxID        string          `json:"txID"`
+	FlowID      string          `json:"flowID,omitempty"`
+	BlockNumber uint64          `json:"blockNumber"`
+	Payload     json.RawMessage `json:"payload,omitempty"`
+}
+
+// EventFilter selects the events a subscriber gets. Empty fields match
+// everything.
+type EventFilter struct {
+	Chaincodes []string // chaincode names, as passed to Watch
+	Names      []string // event names, matched exactly
+}
+
+func (f EventFilter) matches(event Event) bool {
+	return matchesAny(f.Chaincodes, event.Chaincode) && matchesAny(f.Names, event.Name)
+}
+
+func matchesAny(values []string, value string) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// EventBus fans the events of some chaincodes out to local subscribers,
+// with one Fabric event registration per chaincode however many
+// subscribers there are. Subscribers get events in commit order. One that
+// falls more than its buffer behind loses events rather than holding up
+// the others; the bus logs each drop.
+type EventBus struct {
+	client *Client
+
+	mu          sync.Mutex
+	sources     map[string]func() // chaincode -> cancels its registration
+	subscribers map[*eventSubscriber]struct{}
+	closed      bool
+}
+
+type eventSubscriber struct {
+	filter EventFilter
+	events chan Event
+	once   sync.Once
+}
+
+// NewEventBus creates an event bus on a connected client. Call Watch for
+// each chaincode to follow, then Subscribe or Channel.
+func NewEventBus(client *Client) *EventBus {
+	return &EventBus{
+		client:      client,
+		sources:     make(map[string]func()),
+		subscribers: make(map[*eventSubscriber]struct{}),
+	}
+}
+
+// Watch starts receiving the events of a chaincode, by its name on the
+// channel. Watching a chaincode twice is a no-op.
+func (b *EventBus) Watch(chaincode string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return errors.New("event bus is closed")
+	}
+	if _, ok := b.sources[chaincode]; ok {
+		return nil
+	}
+
+	contract, err := b.client.GetContract(chaincode)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get contract %s", chaincode)
+	}
+	registration, events, err := contract.RegisterEvent(".*")
+	if err != nil {
+		return errors.Wrapf(err, "failed to subscribe to %s events", chaincode)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+				b.publish(newEvent(chaincode, event))
+			}
+		}
+	}()
+
+	var once sync.Once
+	b.sources[chaincode] = func() {
+		once.Do(func() {
+			close(done)
+			contract.Unregister(registration)
+		})
+	}
+	return nil
+}
+
+// newEvent converts a chaincode event for the bus. ISV v4 records the end
+// of a session as an AccessLogged entry rather than a SessionTerminated
+// event; the bus renames those so subscribers need not know which ISV
+// version runs.
+func newEvent(chaincode string, event *ChaincodeEvent) Event {
+	busEvent := Event{
+		Chaincode:   chaincode,
+		Name:        event.EventName,
+		TxID:        event.TxID,
+		BlockNumber: event.BlockNumber,
+	}
+
+	var fields struct {
+		FlowID string `json:"flowID"`
+		Action string `json:"action"`
+	}
+	if json.Unmarshal(event.Payload, &fields) == nil {
+		busEvent.FlowID = fields.FlowID
+		busEvent.Payload = event.Payload
+		if event.EventName == "AccessLogged" && fields.Action == "session_closed" {
+			busEvent.Name = EventSessionTerminated
+		}
+	} else if len(event.Payload) > 0 {
+		// Older chaincodes emit bare IDs; pass them on as JSON strings
+		busEvent.Payload, _ = json.Marshal(string(event.Payload))
+	}
+	return busEvent
+}
+
+// publish hands an event to every matching subscriber without waiting
+func (b *EventBus) publish(event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for subscriber := range b.subscribers {
+		if !subscriber.filter.matches(event) {
+			continue
+		}
+		select {
+		case subscriber.events <- event:
+		default:
+			log.Warnf("Event bus subscriber is behind, dropped %s %s in tx %s", event.Chaincode, event.Name, event.TxID)
+		}
+	}
+}
+
+// Channel subscribes to the events matching filter. The returned function
+// ends the subscription and closes the channel; Close ends them all.
+func (b *EventBus) Channel(filter EventFilter) (<-chan Event, func()) {
+	subscriber := &eventSubscriber{
+		filter: filter,
+		events: make(chan Event, defaultEventBuffer),
+	}
+
+	b.mu.Lock()
+	if b.closed {
+		b.unsubscribe(subscriber)
+	} else {
+		b.subscribers[subscriber] = struct{}{}
+	}
+	b.mu.Unlock()
+
+	cancel := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.unsubscribe(subscriber)
+	}
+	return subscriber.events, cancel
+}
+
+// Subscribe calls handler, on a goroutine of its own, for each event
+// matching filter. The returned function ends the subscription; events
+// already queued are still handled.
+func (b *EventBus) Subscribe(filter EventFilter, handler func(Event)) func() {
+	events, cancel := b.Channel(filter)
+	go func() {
+		for event := range events {
+			handler(event)
+		}
+	}()
+	return cancel
+}
+
+// unsubscribe removes a subscriber and closes its channel; b.mu must be
+// held, since publish sends under it
+func (b *EventBus) unsubscribe(subscriber *eventSubscriber) {
+	subscriber.once.Do(func() {
+		delete(b.subscribers, subscriber)
+		close(subscriber.events)
+	})
+}
+
+// Close cancels the Fabric registrations and ends every subscription
+func (b *EventBus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	b.closed = true
+	for _, cancel := range b.sources {
+		cancel()
+	}
+	for subscriber := range b.subscribers {
+		b.unsubscribe(subscriber)
+	}
+}
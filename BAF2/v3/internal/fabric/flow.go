@@ -0,0 +1,87 @@
+package fabric
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/pkg/errors"
+)
+
+// The chaincodes copy the flow ID of a transaction into the events they
+// emit and the audit records they store, so the ledger events of one
+// logical flow (AS, TGS, ISV and iot-data calls) can be correlated. A
+// client with a flow ID passes it with every transaction it submits.
+
+const (
+	// flowIDTransient is the transient field the chaincodes read the flow
+	// ID from
+	flowIDTransient = "flowID"
+
+	// maxFlowIDLength is the longest flow ID the chaincodes accept
+	maxFlowIDLength = 128
+)
+
+// NewFlowID returns a random flow ID
+func NewFlowID() (string, error) {
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return "", errors.Wrap(err, "failed to generate flow ID")
+	}
+	return hex.EncodeToString(random), nil
+}
+
+// ValidateFlowID checks a flow ID against what the chaincodes accept:
+// 1 to 128 letters, digits, ".", "_", ":" and "-"
+func ValidateFlowID(flowID string) error {
+	if flowID == "" || len(flowID) > maxFlowIDLength {
+		return errors.Errorf("flow ID must be 1 to %d characters long", maxFlowIDLength)
+	}
+	for _, r := range flowID {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '.', r == '_', r == ':', r == '-':
+		default:
+			return errors.Errorf("flow ID contains invalid character %q", r)
+		}
+	}
+	return nil
+}
+
+// SetFlowID tags the transactions the client submits from now on with a
+// flow ID; "" stops tagging them. The client carries one flow at a time,
+// so concurrent flows need a client each.
+func (c *Client) SetFlowID(flowID string) error {
+	if flowID != "" {
+		if err := ValidateFlowID(flowID); err != nil {
+			return err
+		}
+	}
+	c.flowID = flowID
+	return nil
+}
+
+// FlowID returns the flow ID the client tags transactions with, or "" if
+// there is none
+func (c *Client) FlowID() string {
+	return c.flowID
+}
+
+// BeginFlow gives the client a flow ID unless it already has one, and
+// returns a function restoring the previous state. A flow made of several
+// calls starts with it, so that a flow ID chosen by the caller is kept.
+// flowID continues an earlier flow; "" starts a new one.
+func (c *Client) BeginFlow(flowID string) (func(), error) {
+	if c.flowID != "" {
+		return func() {}, nil
+	}
+	if flowID == "" {
+		var err error
+		if flowID, err = NewFlowID(); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.SetFlowID(flowID); err != nil {
+		return nil, err
+	}
+	return func() { c.flowID = "" }, nil
+}
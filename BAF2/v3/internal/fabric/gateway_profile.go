@@ -0,0 +1,97 @@
+package fabric
+
+import (
+	"crypto/x509"
+	"sort"
+	"strings"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/core"
+	"github.com/hyperledger/fabric-sdk-go/pkg/fab"
+	"github.com/pkg/errors"
+)
+
+// gatewayEndpoint is the peer an APIGateway connection sends its requests
+// to, as the connection profile describes it
+type gatewayEndpoint struct {
+	name       string
+	address    string // host:port
+	tls        bool
+	tlsCACert  *x509.Certificate // nil to use the system roots
+	serverName string            // TLS server name, if overridden
+
+	// peerOrgs maps the profile's peers, by lower-case name, to the MSP ID
+	// of their organization
+	peerOrgs map[string]string
+}
+
+// resolveGatewayEndpoint finds the gateway peer in a connection profile:
+// peerName, or the first peer (by name) of the organization of mspID
+func resolveGatewayEndpoint(configProvider core.ConfigProvider, peerName, mspID string) (*gatewayEndpoint, error) {
+	backends, err := configProvider()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load connection profile")
+	}
+	endpointConfig, err := fab.ConfigFromBackend(backends...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read connection profile")
+	}
+
+	peerOrgs := make(map[string]string)
+	var ownPeers []string
+	for _, org := range endpointConfig.NetworkConfig().Organizations {
+		for _, peer := range org.Peers {
+			peerOrgs[strings.ToLower(peer)] = org.MSPID
+		}
+		if org.MSPID == mspID {
+			ownPeers = append(ownPeers, org.Peers...)
+		}
+	}
+
+	if peerName == "" {
+		if len(ownPeers) == 0 {
+			return nil, errors.Errorf("connection profile lists no peers of %s; name the gateway peer", mspID)
+		}
+		sort.Strings(ownPeers)
+		peerName = ownPeers[0]
+	}
+	peer, ok := endpointConfig.PeerConfig(peerName)
+	if !ok {
+		return nil, errors.Errorf("gateway peer %s is not in the connection profile", peerName)
+	}
+
+	endpoint := &gatewayEndpoint{
+		name:      peerName,
+		tlsCACert: peer.TLSCACert,
+		peerOrgs:  peerOrgs,
+	}
+	switch {
+	case strings.HasPrefix(peer.URL, "grpcs://"):
+		endpoint.address, endpoint.tls = strings.TrimPrefix(peer.URL, "grpcs://"), true
+	case strings.HasPrefix(peer.URL, "grpc://"):
+		endpoint.address = strings.TrimPrefix(peer.URL, "grpc://")
+	default:
+		endpoint.address, endpoint.tls = peer.URL, peer.TLSCACert != nil
+	}
+	if override, ok := peer.GRPCOptions["ssl-target-name-override"].(string); ok {
+		endpoint.serverName = override
+	}
+	return endpoint, nil
+}
+
+// organizations returns the MSP IDs of the organizations of peers, in
+// order and without duplicates
+func (e *gatewayEndpoint) organizations(peers []string) ([]string, error) {
+	var mspIDs []string
+	seen := make(map[string]bool)
+	for _, peer := range peers {
+		mspID, ok := e.peerOrgs[strings.ToLower(peer)]
+		if !ok {
+			return nil, errors.Errorf("peer %s belongs to no organization of the connection profile", peer)
+		}
+		if !seen[mspID] {
+			seen[mspID] = true
+			mspIDs = append(mspIDs, mspID)
+		}
+	}
+	return mspIDs, nil
+}
@@ -0,0 +1,239 @@
+package fabric
+
+import (
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/pkg/errors"
+)
+
+// QSCCContractID is the system chaincode that answers ledger queries
+const QSCCContractID = "qscc"
+
+// HistoryEntry is one committed version of a ledger record
+type HistoryEntry struct {
+	TxID        string          `json:"txID"`
+	BlockNumber uint64          `json:"blockNumber"`
+	Timestamp   time.Time       `json:"timestamp"`
+	IsDelete    bool            `json:"isDelete"`
+	Value       json.RawMessage `json:"value,omitempty"`
+}
+
+// GetDeviceHistory returns every committed version of a device record with
+// the block that committed it, oldest first
+func (isv *ISVContract) GetDeviceHistory(deviceID string) ([]HistoryEntry, error) {
+	return isv.getHistory("GetDeviceHistory", deviceID)
+}
+
+// GetSessionHistory returns every committed version of a session record with
+// the block that committed it, oldest first
+func (isv *ISVContract) GetSessionHistory(sessionID string) ([]HistoryEntry, error) {
+	return isv.getHistory("GetSessionHistory", sessionID)
+}
+
+// GetDeviceAtHeight reconstructs a device record as it was once the given
+// block had been committed
+func (isv *ISVContract) GetDeviceAtHeight(deviceID string, blockNumber uint64) (*HistoryEntry, error) {
+	history, err := isv.GetDeviceHistory(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	return entryAtHeight(history, "device "+deviceID, blockNumber)
+}
+
+// GetSessionAtHeight reconstructs a session record as it was once the given
+// block had been committed
+func (isv *ISVContract) GetSessionAtHeight(sessionID string, blockNumber uint64) (*HistoryEntry, error) {
+	history, err := isv.GetSessionHistory(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return entryAtHeight(history, "session "+sessionID, blockNumber)
+}
+
+func (isv *ISVContract) getHistory(function, id string) ([]HistoryEntry, error) {
+	responseBytes, err := isv.client.evaluate(isv.contract, function, id)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get history of %s from ISV", id)
+	}
+	
+	var history []HistoryEntry
+	if err := json.Unmarshal(responseBytes, &history); err != nil {
+		return nil, errors.Wrap(err, "failed to parse history response")
+	}
+	
+	// The chaincode cannot see block numbers, so resolve them from the
+	// transaction IDs
+	for i := range history {
+		history[i].BlockNumber, err = isv.client.BlockForTx(history[i].TxID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.SliceStable(history, func(i, j int) bool {
+		return history[i].BlockNumber < history[j].BlockNumber
+	})
+	
+	return history, nil
+}
+
+// entryAtHeight returns the last version committed at or before blockNumber
+func entryAtHeight(history []HistoryEntry, record string, blockNumber uint64) (*HistoryEntry, error) {
+	var found *HistoryEntry
+	for i := range history {
+		if history[i].BlockNumber > blockNumber {
+			break
+		}
+		found = &history[i]
+	}
+	if found == nil {
+		return nil, errors.Errorf("%s did not exist at block %d", record, blockNumber)
+	}
+	if found.IsDelete {
+		return nil, errors.Errorf("%s had been deleted at block %d", record, blockNumber)
+	}
+	return found, nil
+}
+
+// BlockForTx returns the number of the block containing a transaction
+func (c *Client) BlockForTx(txID string) (uint64, error) {
+	block, err := c.queryBlock("GetBlockByTxID", txID)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to get block for transaction %s", txID)
+	}
+	return block.GetHeader().GetNumber(), nil
+}
+
+// BlockHeight returns the number of blocks on the channel
+func (c *Client) BlockHeight() (uint64, error) {
+	contract, err := c.GetContract(QSCCContractID)
+	if err != nil {
+		return 0, err
+	}
+	
+	responseBytes, err := c.evaluate(contract, "GetChainInfo", c.channelName)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to get chain info")
+	}
+	
+	var info common.BlockchainInfo
+	if err := proto.Unmarshal(responseBytes, &info); err != nil {
+		return 0, errors.Wrap(err, "failed to parse chain info")
+	}
+	return info.GetHeight(), nil
+}
+
+// GenesisHash returns the hex header hash of the channel's first block. A
+// channel that has been torn down and recreated under the same name has a
+// different genesis block, so the hash identifies one incarnation of it.
+func (c *Client) GenesisHash() (string, error) {
+	block, err := c.queryBlock("GetBlockByNumber", "0")
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get genesis block")
+	}
+	
+	// Fabric hashes the ASN.1 encoding of the header fields
+	headerBytes, err := asn1.Marshal(struct {
+		Number       *big.Int
+		PreviousHash []byte
+		DataHash     []byte
+	}{
+		Number:       new(big.Int).SetUint64(block.GetHeader().GetNumber()),
+		PreviousHash: block.GetHeader().GetPreviousHash(),
+		DataHash:     block.GetHeader().GetDataHash(),
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "failed to encode genesis block header")
+	}
+	hash := sha256.Sum256(headerBytes)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// BlockAtTime returns the last block committed at or before t, found by a
+// binary search over block timestamps
+func (c *Client) BlockAtTime(t time.Time) (uint64, error) {
+	height, err := c.BlockHeight()
+	if err != nil {
+		return 0, err
+	}
+	if height == 0 {
+		return 0, errors.New("channel has no blocks")
+	}
+	
+	genesisTime, err := c.blockTime(0)
+	if err != nil {
+		return 0, err
+	}
+	if t.Before(genesisTime) {
+		return 0, errors.Errorf("%s is before the first block (%s)", t.Format(time.RFC3339), genesisTime.Format(time.RFC3339))
+	}
+	
+	// Invariant: block low is at or before t; blocks above high are after it
+	low, high := uint64(0), height-1
+	for low < high {
+		mid := low + (high-low+1)/2
+		midTime, err := c.blockTime(mid)
+		if err != nil {
+			return 0, err
+		}
+		if midTime.After(t) {
+			high = mid - 1
+		} else {
+			low = mid
+		}
+	}
+	return low, nil
+}
+
+// blockTime returns the timestamp of the first transaction in a block
+func (c *Client) blockTime(number uint64) (time.Time, error) {
+	block, err := c.queryBlock("GetBlockByNumber", strconv.FormatUint(number, 10))
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "failed to get block %d", number)
+	}
+	if len(block.GetData().GetData()) == 0 {
+		return time.Time{}, errors.Errorf("block %d has no transactions", number)
+	}
+	
+	var envelope common.Envelope
+	if err := proto.Unmarshal(block.Data.Data[0], &envelope); err != nil {
+		return time.Time{}, errors.Wrap(err, "failed to parse transaction envelope")
+	}
+	var payload common.Payload
+	if err := proto.Unmarshal(envelope.Payload, &payload); err != nil {
+		return time.Time{}, errors.Wrap(err, "failed to parse transaction payload")
+	}
+	var channelHeader common.ChannelHeader
+	if err := proto.Unmarshal(payload.GetHeader().GetChannelHeader(), &channelHeader); err != nil {
+		return time.Time{}, errors.Wrap(err, "failed to parse channel header")
+	}
+	
+	timestamp := channelHeader.GetTimestamp()
+	return time.Unix(timestamp.GetSeconds(), int64(timestamp.GetNanos())).UTC(), nil
+}
+
+func (c *Client) queryBlock(function, arg string) (*common.Block, error) {
+	contract, err := c.GetContract(QSCCContractID)
+	if err != nil {
+		return nil, err
+	}
+	
+	responseBytes, err := c.evaluate(contract, function, c.channelName, arg)
+	if err != nil {
+		return nil, err
+	}
+	
+	var block common.Block
+	if err := proto.Unmarshal(responseBytes, &block); err != nil {
+		return nil, errors.Wrap(err, "failed to parse block")
+	}
+	return &block, nil
+}
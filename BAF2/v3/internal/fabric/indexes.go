@@ -0,0 +1,29 @@
+package fabric
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// IndexRebuildResult reports what RebuildIndexes did for one composite index
+type IndexRebuildResult struct {
+	Index   string `json:"index"`
+	Records int    `json:"records"`
+	Created int    `json:"created"`
+}
+
+// RebuildIndexes backfills the ISV's composite indexes for records written
+// before an upgrade added them
+func (isv *ISVContract) RebuildIndexes() ([]IndexRebuildResult, error) {
+	responseBytes, err := isv.client.submit(isv.contract, "RebuildIndexes")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to rebuild indexes with ISV")
+	}
+
+	var results []IndexRebuildResult
+	if err := json.Unmarshal(responseBytes, &results); err != nil {
+		return nil, errors.Wrap(err, "failed to parse rebuild response")
+	}
+	return results, nil
+}
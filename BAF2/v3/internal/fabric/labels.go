@@ -0,0 +1,55 @@
+package fabric
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// SetDeviceLabel sets a label on a device and returns the updated device
+// record. Only the organization that registered the device may label it.
+func (isv *ISVContract) SetDeviceLabel(deviceID, key, value string) (map[string]interface{}, error) {
+	responseBytes, err := isv.client.submit(isv.contract, "SetLabel", deviceID, key, value)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to set device label with ISV")
+	}
+	return parseLabeledRecord(responseBytes, "device")
+}
+
+// RemoveDeviceLabel removes a label from a device and returns the updated
+// device record
+func (isv *ISVContract) RemoveDeviceLabel(deviceID, key string) (map[string]interface{}, error) {
+	responseBytes, err := isv.client.submit(isv.contract, "RemoveLabel", deviceID, key)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to remove device label with ISV")
+	}
+	return parseLabeledRecord(responseBytes, "device")
+}
+
+// SetClientLabel sets a label on a client registration and returns the
+// updated record. Only the AS admin MSPs may label clients.
+func (as *AuthServerContract) SetClientLabel(clientID, key, value string) (map[string]interface{}, error) {
+	responseBytes, err := as.client.submit(as.contract, "SetLabel", clientID, key, value)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to set client label with AS")
+	}
+	return parseLabeledRecord(responseBytes, "client")
+}
+
+// RemoveClientLabel removes a label from a client registration and returns
+// the updated record
+func (as *AuthServerContract) RemoveClientLabel(clientID, key string) (map[string]interface{}, error) {
+	responseBytes, err := as.client.submit(as.contract, "RemoveLabel", clientID, key)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to remove client label with AS")
+	}
+	return parseLabeledRecord(responseBytes, "client")
+}
+
+func parseLabeledRecord(responseBytes []byte, kind string) (map[string]interface{}, error) {
+	var record map[string]interface{}
+	if err := json.Unmarshal(responseBytes, &record); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse %s record", kind)
+	}
+	return record, nil
+}
@@ -0,0 +1,97 @@
+package fabric
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ClientLease ties a client's sessions to the client being alive; the ISV
+// closes the sessions of a client whose lease lapses
+type ClientLease struct {
+	ClientID  string    `json:"clientID"`
+	TTL       int64     `json:"ttl"`
+	RenewedAt time.Time `json:"renewedAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	Status    string    `json:"status"`
+}
+
+// SweepResult lists the leases and sessions one sweep expired and closed
+type SweepResult struct {
+	ExpiredLeases  []string `json:"expiredLeases"`
+	ClosedSessions []string `json:"closedSessions"`
+	// ExpiredEmergencyAccesses are the break-glass records of the closed
+	// sessions that were emergency sessions
+	ExpiredEmergencyAccesses []string `json:"expiredEmergencyAccesses,omitempty"`
+}
+
+// RenewClientLease creates or extends a client's lease. The request carries
+// the client's service ticket, as for ProcessServiceRequest.
+func (isv *ISVContract) RenewClientLease(request map[string]string, ttlSeconds int64) (*ClientLease, error) {
+	requestJSON, err := json.Marshal(request)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal lease request")
+	}
+
+	responseBytes, err := isv.client.submit(isv.contract, "RenewClientLease", string(requestJSON), strconv.FormatInt(ttlSeconds, 10))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to renew lease with ISV")
+	}
+	return parseLease(responseBytes)
+}
+
+// GetClientLease returns a client's lease
+func (isv *ISVContract) GetClientLease(clientID string) (*ClientLease, error) {
+	responseBytes, err := isv.client.evaluate(isv.contract, "GetClientLease", clientID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get lease from ISV")
+	}
+	return parseLease(responseBytes)
+}
+
+// SweepSessions closes the sessions of clients whose lease lapsed and
+// sessions past their expiry
+func (isv *ISVContract) SweepSessions() (*SweepResult, error) {
+	responseBytes, err := isv.client.submit(isv.contract, "SweepSessions")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to sweep sessions with ISV")
+	}
+
+	var result SweepResult
+	if err := json.Unmarshal(responseBytes, &result); err != nil {
+		return nil, errors.Wrap(err, "failed to parse sweep response")
+	}
+	return &result, nil
+}
+
+// RecoveryResult lists the busy devices one recovery marked active, and
+// those live sessions still hold
+type RecoveryResult struct {
+	RecoveredDevices []string `json:"recoveredDevices"`
+	HeldDevices      []string `json:"heldDevices"`
+}
+
+// RecoverBusyDevices marks busy devices that no live session holds as
+// active. Admin only.
+func (isv *ISVContract) RecoverBusyDevices() (*RecoveryResult, error) {
+	responseBytes, err := isv.client.submit(isv.contract, "RecoverBusyDevices")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to recover busy devices with ISV")
+	}
+
+	var result RecoveryResult
+	if err := json.Unmarshal(responseBytes, &result); err != nil {
+		return nil, errors.Wrap(err, "failed to parse recovery response")
+	}
+	return &result, nil
+}
+
+func parseLease(responseBytes []byte) (*ClientLease, error) {
+	var lease ClientLease
+	if err := json.Unmarshal(responseBytes, &lease); err != nil {
+		return nil, errors.Wrap(err, "failed to parse lease response")
+	}
+	return &lease, nil
+}
@@ -0,0 +1,73 @@
+package fabric
+
+import (
+	"github.com/golang/protobuf/proto"
+	lb "github.com/hyperledger/fabric-protos-go/peer/lifecycle"
+	"github.com/pkg/errors"
+)
+
+// LifecycleContractID is the system chaincode that manages chaincode
+// definitions
+const LifecycleContractID = "_lifecycle"
+
+// DeployedChaincode is the committed definition of a chaincode and the
+// package the queried peer's organization approved for it
+type DeployedChaincode struct {
+	Name      string `json:"name"`
+	Sequence  int64  `json:"sequence"`
+	Version   string `json:"version"`
+	PackageID string `json:"packageID"` // Empty if the organization approved no package
+}
+
+// QueryDeployedChaincode returns the committed definition of a chaincode
+// and the package ID the peer's organization approved for that sequence.
+// The peer runs that package, so its hash is the one to compare with the
+// audited build.
+func (c *Client) QueryDeployedChaincode(name string) (*DeployedChaincode, error) {
+	contract, err := c.GetContract(LifecycleContractID)
+	if err != nil {
+		return nil, err
+	}
+
+	var committed lb.QueryChaincodeDefinitionResult
+	if err := c.queryLifecycle(contract, "QueryChaincodeDefinition", &lb.QueryChaincodeDefinitionArgs{Name: name}, &committed); err != nil {
+		return nil, errors.Wrapf(err, "failed to query definition of %s", name)
+	}
+
+	var approved lb.QueryApprovedChaincodeDefinitionResult
+	args := &lb.QueryApprovedChaincodeDefinitionArgs{Name: name, Sequence: committed.GetSequence()}
+	if err := c.queryLifecycle(contract, "QueryApprovedChaincodeDefinition", args, &approved); err != nil {
+		return nil, errors.Wrapf(err, "failed to query approved definition of %s", name)
+	}
+
+	return &DeployedChaincode{
+		Name:      name,
+		Sequence:  committed.GetSequence(),
+		Version:   committed.GetVersion(),
+		PackageID: approved.GetSource().GetLocalPackage().GetPackageId(),
+	}, nil
+}
+
+// queryLifecycle evaluates a _lifecycle function, which takes and returns
+// protobuf messages
+func (c *Client) queryLifecycle(contract *Contract, name string, args proto.Message, result proto.Message) error {
+	argBytes, err := proto.Marshal(args)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal arguments")
+	}
+	responseBytes, err := c.evaluate(contract, name, string(argBytes))
+	if err != nil {
+		return err
+	}
+	return errors.Wrap(proto.Unmarshal(responseBytes, result), "failed to parse result")
+}
+
+// SubmitInit submits a chaincode's initialization function, e.g. the
+// InitLedger of the IoT demo chaincodes, once it has been deployed
+func (c *Client) SubmitInit(contract *Contract, function string, args ...string) ([]byte, error) {
+	responseBytes, err := c.submit(contract, function, args...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to run %s on %s", function, contract.Name())
+	}
+	return responseBytes, nil
+}
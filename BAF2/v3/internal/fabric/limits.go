@@ -0,0 +1,132 @@
+package fabric
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// PayloadLimits mirrors the size limits each chaincode enforces before every
+// transaction. Arguments are checked against them before submitting, so an
+// oversized payload fails locally with the same message instead of after an
+// endorsement round trip.
+type PayloadLimits struct {
+	MaxArgumentBytes    int `json:"maxArgumentBytes"`
+	MaxIDLength         int `json:"maxIDLength"`
+	MaxPublicKeyBytes   int `json:"maxPublicKeyBytes"`
+	MaxEncryptedBytes   int `json:"maxEncryptedBytes"`
+	MaxCapabilities     int `json:"maxCapabilities"`
+	MaxCapabilityLength int `json:"maxCapabilityLength"`
+}
+
+// DefaultPayloadLimits are the chaincode defaults, used when a chaincode does
+// not report its limits
+var DefaultPayloadLimits = PayloadLimits{
+	MaxArgumentBytes:    64 * 1024,
+	MaxIDLength:         128,
+	MaxPublicKeyBytes:   4096,
+	MaxEncryptedBytes:   8192,
+	MaxCapabilities:     32,
+	MaxCapabilityLength: 64,
+}
+
+// limitsCache holds the limits fetched from each chaincode, by contract name
+type limitsCache struct {
+	mu     sync.Mutex
+	limits map[string]*PayloadLimits
+}
+
+// CheckArguments checks each argument of a transaction against MaxArgumentBytes
+func (l *PayloadLimits) CheckArguments(function string, args []string) error {
+	for i, arg := range args {
+		if len(arg) > l.MaxArgumentBytes {
+			return errors.Errorf("%s: argument %d is %d bytes, the limit is %d", function, i+1, len(arg), l.MaxArgumentBytes)
+		}
+	}
+	return nil
+}
+
+// CheckID checks a client, device or service ID
+func (l *PayloadLimits) CheckID(id string) error {
+	if len(id) > l.MaxIDLength {
+		return errors.Errorf("ID is %d characters, the limit is %d", len(id), l.MaxIDLength)
+	}
+	return nil
+}
+
+// CheckPublicKey checks a PEM-encoded public key
+func (l *PayloadLimits) CheckPublicKey(publicKeyPEM string) error {
+	if len(publicKeyPEM) > l.MaxPublicKeyBytes {
+		return errors.Errorf("public key is %d bytes, the limit is %d", len(publicKeyPEM), l.MaxPublicKeyBytes)
+	}
+	return nil
+}
+
+// CheckCapabilities checks a device capability list
+func (l *PayloadLimits) CheckCapabilities(capabilities []string) error {
+	if len(capabilities) > l.MaxCapabilities {
+		return errors.Errorf("%d capabilities given, the limit is %d", len(capabilities), l.MaxCapabilities)
+	}
+	for _, capability := range capabilities {
+		if len(capability) > l.MaxCapabilityLength {
+			return errors.Errorf("capability %.20q... is %d characters, the limit is %d", capability, len(capability), l.MaxCapabilityLength)
+		}
+	}
+	return nil
+}
+
+// PayloadLimits returns the limits a chaincode enforces. They are fetched once
+// per contract; chaincodes that predate payload limits get the defaults.
+func (c *Client) PayloadLimits(contract *Contract) *PayloadLimits {
+	limits, _ := c.loadPayloadLimits(contract)
+	return limits
+}
+
+// loadPayloadLimits fetches and caches a chaincode's limits. A strict client
+// returns the error instead of caching the defaults.
+func (c *Client) loadPayloadLimits(contract *Contract) (*PayloadLimits, error) {
+	c.limits.mu.Lock()
+	defer c.limits.mu.Unlock()
+	
+	if limits, ok := c.limits.limits[contract.Name()]; ok {
+		return limits, nil
+	}
+	
+	limits := DefaultPayloadLimits
+	responseBytes, err := c.evaluate(contract, "GetPayloadLimits")
+	if err == nil {
+		err = json.Unmarshal(responseBytes, &limits)
+	}
+	if err != nil {
+		if c.strict {
+			defaults := DefaultPayloadLimits
+			return &defaults, err
+		}
+		log.Debugf("Using default payload limits for %s: %v", contract.Name(), err)
+		limits = DefaultPayloadLimits
+	}
+	
+	if c.limits.limits == nil {
+		c.limits.limits = make(map[string]*PayloadLimits)
+	}
+	c.limits.limits[contract.Name()] = &limits
+	return &limits, nil
+}
+
+// SetPayloadLimits stores new payload limits on a chaincode
+func (c *Client) SetPayloadLimits(contract *Contract, limits PayloadLimits) error {
+	limitsJSON, err := json.Marshal(limits)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal payload limits")
+	}
+	
+	if _, err := c.submit(contract, "SetPayloadLimits", string(limitsJSON)); err != nil {
+		return errors.Wrapf(err, "failed to set payload limits on %s", contract.Name())
+	}
+	
+	c.limits.mu.Lock()
+	delete(c.limits.limits, contract.Name())
+	c.limits.mu.Unlock()
+	return nil
+}
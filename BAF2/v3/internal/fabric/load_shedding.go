@@ -0,0 +1,101 @@
+package fabric
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DeviceLoadLimits caps a device's concurrent sessions and service requests
+// per minute; 0 is unlimited
+type DeviceLoadLimits struct {
+	MaxActiveSessions    int `json:"maxActiveSessions,omitempty"`
+	MaxRequestsPerMinute int `json:"maxRequestsPerMinute,omitempty"`
+}
+
+// DeviceLoad is a device's load limits and current load
+type DeviceLoad struct {
+	DeviceID       string            `json:"deviceID"`
+	Limits         *DeviceLoadLimits `json:"limits,omitempty"`
+	ActiveSessions int               `json:"activeSessions"`
+	WindowStart    time.Time         `json:"windowStart"`
+	Requests       int               `json:"requests"`
+}
+
+// Reasons the ISV sheds a service request
+const (
+	OverloadActiveSessions = "max_active_sessions"
+	OverloadRequestRate    = "max_requests_per_minute"
+)
+
+// DeviceOverloadedError is returned by ProcessServiceRequest when the device
+// is at one of its load limits. The request may be retried after RetryAfter,
+// with a new service ticket.
+type DeviceOverloadedError struct {
+	DeviceID   string
+	Reason     string
+	RetryAfter time.Duration
+}
+
+func (e *DeviceOverloadedError) Error() string {
+	return fmt.Sprintf("device %s is overloaded (%s), retry after %s", e.DeviceID, e.Reason, e.RetryAfter)
+}
+
+// overloadedPattern finds the ISV's overload error in a gateway error,
+// whose message may quote the chaincode's
+var overloadedPattern = regexp.MustCompile(`DEVICE_OVERLOADED (\{[^{}]*\})`)
+
+// parseDeviceOverloaded returns the overload error carried by err, if any
+func parseDeviceOverloaded(err error) (*DeviceOverloadedError, bool) {
+	match := overloadedPattern.FindStringSubmatch(err.Error())
+	if match == nil {
+		return nil, false
+	}
+
+	var body struct {
+		DeviceID   string `json:"deviceID"`
+		Reason     string `json:"reason"`
+		RetryAfter int64  `json:"retryAfter"`
+	}
+	if json.Unmarshal([]byte(strings.ReplaceAll(match[1], `\"`, `"`)), &body) != nil {
+		return nil, false
+	}
+	return &DeviceOverloadedError{
+		DeviceID:   body.DeviceID,
+		Reason:     body.Reason,
+		RetryAfter: time.Duration(body.RetryAfter) * time.Second,
+	}, true
+}
+
+// SetDeviceLoadLimits sets a device's load limits, signed with the device
+// key; zero limits remove them
+func (isv *ISVContract) SetDeviceLoadLimits(deviceID string, limits DeviceLoadLimits, signature string) error {
+	limitsJSON, err := json.Marshal(limits)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal load limits")
+	}
+
+	if _, err := isv.client.submit(isv.contract, "SetDeviceLoadLimits", deviceID, string(limitsJSON), signature); err != nil {
+		return errors.Wrap(err, "failed to set load limits with ISV")
+	}
+	return nil
+}
+
+// GetDeviceLoad returns a device's load limits, live sessions and the
+// service requests it took this minute
+func (isv *ISVContract) GetDeviceLoad(deviceID string) (*DeviceLoad, error) {
+	responseBytes, err := isv.client.evaluate(isv.contract, "GetDeviceLoad", deviceID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get device load from ISV")
+	}
+
+	var load DeviceLoad
+	if err := json.Unmarshal(responseBytes, &load); err != nil {
+		return nil, errors.Wrap(err, "failed to parse device load response")
+	}
+	return &load, nil
+}
@@ -0,0 +1,54 @@
+package fabric
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// MaintenanceWindow suspends new sessions on a device, except for the
+// listed operators. Devices inside their window report the status
+// "maintenance".
+type MaintenanceWindow struct {
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	Reason    string    `json:"reason"`
+	Operators []string  `json:"operators,omitempty"`
+}
+
+// ScheduleMaintenance sets a device's maintenance window. The signature is
+// made with the device key over the window.
+func (isv *ISVContract) ScheduleMaintenance(deviceID string, window MaintenanceWindow, signature string) error {
+	windowJSON, err := json.Marshal(window)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal maintenance window")
+	}
+
+	if _, err := isv.client.submit(isv.contract, "ScheduleMaintenance", deviceID, string(windowJSON), signature); err != nil {
+		return errors.Wrap(err, "failed to schedule maintenance with ISV")
+	}
+	return nil
+}
+
+// CancelMaintenance removes a device's maintenance window
+func (isv *ISVContract) CancelMaintenance(deviceID, signature string) error {
+	if _, err := isv.client.submit(isv.contract, "CancelMaintenance", deviceID, signature); err != nil {
+		return errors.Wrap(err, "failed to cancel maintenance with ISV")
+	}
+	return nil
+}
+
+// GetMaintenanceWindow returns a device's scheduled or current window
+func (isv *ISVContract) GetMaintenanceWindow(deviceID string) (*MaintenanceWindow, error) {
+	responseBytes, err := isv.client.evaluate(isv.contract, "GetMaintenanceWindow", deviceID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get maintenance window from ISV")
+	}
+
+	var window MaintenanceWindow
+	if err := json.Unmarshal(responseBytes, &window); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal maintenance window")
+	}
+	return &window, nil
+}
@@ -0,0 +1,485 @@
+package fabric
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/hyperledger/fabric-protos-go/common"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/resmgmt"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/core"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/msp"
+	"github.com/hyperledger/fabric-sdk-go/pkg/fabsdk"
+	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/common/policydsl"
+	"github.com/pkg/errors"
+)
+
+// NetworkAdmin creates channels and deploys chaincodes as the admins of the
+// organizations, the steps network/scripts/deploy-chaincode.sh runs with
+// the peer CLI. Each organization's requests are signed by its own admin.
+//
+// The connection profiles of this repository carry no user credentials, so
+// the admins are added to the profile in memory as embedded users of their
+// organizations.
+type NetworkAdmin struct {
+	sdk        *fabsdk.FabricSDK
+	clients    map[string]*resmgmt.Client
+	identities map[string]msp.SigningIdentity
+}
+
+// OrgAdmin is the admin identity of an organization
+type OrgAdmin struct {
+	Org         string // Organization name in the connection profile
+	Certificate string // PEM certificate file
+	PrivateKey  string // PEM private key file
+}
+
+// ChaincodeDefinition is a chaincode definition for approval and commit
+type ChaincodeDefinition struct {
+	Name     string
+	Version  string
+	Sequence int64
+	// PackageID is the installed package organizations approve
+	PackageID string
+	// EndorsementPolicy is a signature policy such as
+	// "OR('Org1MSP.peer','Org2MSP.peer')"; empty uses the channel's default
+	EndorsementPolicy string
+	// Collections is a private data collections config in the JSON format
+	// of 'peer lifecycle chaincode approveformyorg --collections-config'
+	Collections []byte
+}
+
+// networkAdminUser is the name the admins are embedded in the profile under
+const networkAdminUser = "netadmin"
+
+// NewNetworkAdmin connects to the network in the connection profile at
+// configPath as each of admins
+func NewNetworkAdmin(configPath, ageIdentityFile string, admins []OrgAdmin) (*NetworkAdmin, error) {
+	if len(admins) == 0 {
+		return nil, errors.New("at least one organization admin is required")
+	}
+	configProvider, err := configProviderFor(configPath, ageIdentityFile)
+	if err != nil {
+		return nil, err
+	}
+	sdk, err := fabsdk.New(withOrgAdmins(configProvider, admins))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create SDK")
+	}
+
+	a := &NetworkAdmin{
+		sdk:        sdk,
+		clients:    make(map[string]*resmgmt.Client),
+		identities: make(map[string]msp.SigningIdentity),
+	}
+	for _, admin := range admins {
+		ctxProvider := sdk.Context(fabsdk.WithUser(networkAdminUser), fabsdk.WithOrg(admin.Org))
+		ctx, err := ctxProvider()
+		if err != nil {
+			sdk.Close()
+			return nil, errors.Wrapf(err, "failed to load the admin of %s", admin.Org)
+		}
+		client, err := resmgmt.New(ctxProvider)
+		if err != nil {
+			sdk.Close()
+			return nil, errors.Wrapf(err, "failed to create resource client for %s", admin.Org)
+		}
+		a.clients[admin.Org] = client
+		a.identities[admin.Org] = ctx
+	}
+	return a, nil
+}
+
+// Close releases the SDK
+func (a *NetworkAdmin) Close() {
+	a.sdk.Close()
+}
+
+func (a *NetworkAdmin) client(org string) (*resmgmt.Client, error) {
+	client, ok := a.clients[org]
+	if !ok {
+		return nil, errors.Errorf("no admin for organization %s", org)
+	}
+	return client, nil
+}
+
+// ChannelExists reports whether the orderer has a configuration block for
+// channelID
+func (a *NetworkAdmin) ChannelExists(org, channelID, orderer string) (bool, error) {
+	client, err := a.client(org)
+	if err != nil {
+		return false, err
+	}
+	if _, err := client.QueryConfigBlockFromOrderer(channelID, resmgmt.WithOrdererEndpoint(orderer)); err != nil {
+		log.Debugf("No config block for %s: %v", channelID, err)
+		return false, nil
+	}
+	return true, nil
+}
+
+// CreateChannel submits the channel creation transaction in channelTx, as
+// made by 'configtxgen -outputCreateChannelTx', signed by the admins of
+// signers
+func (a *NetworkAdmin) CreateChannel(org, channelID, channelTx, orderer string, signers []string) error {
+	return a.updateChannel(org, channelID, channelTx, orderer, signers)
+}
+
+// UpdateAnchorPeers submits an organization's anchor peer update, as made by
+// 'configtxgen -outputAnchorPeersUpdate', signed by its admin
+func (a *NetworkAdmin) UpdateAnchorPeers(org, channelID, anchorsTx, orderer string) error {
+	return a.updateChannel(org, channelID, anchorsTx, orderer, []string{org})
+}
+
+func (a *NetworkAdmin) updateChannel(org, channelID, tx, orderer string, signers []string) error {
+	client, err := a.client(org)
+	if err != nil {
+		return err
+	}
+	var identities []msp.SigningIdentity
+	for _, signer := range signers {
+		identity, ok := a.identities[signer]
+		if !ok {
+			return errors.Errorf("no admin for organization %s", signer)
+		}
+		identities = append(identities, identity)
+	}
+
+	request := resmgmt.SaveChannelRequest{ChannelID: channelID, ChannelConfigPath: tx, SigningIdentities: identities}
+	if _, err := client.SaveChannel(request, resmgmt.WithOrdererEndpoint(orderer)); err != nil {
+		return errors.Wrapf(err, "failed to submit %s to channel %s", tx, channelID)
+	}
+	return nil
+}
+
+// JoinedChannel reports whether peer has joined channelID
+func (a *NetworkAdmin) JoinedChannel(org, peer, channelID string) (bool, error) {
+	client, err := a.client(org)
+	if err != nil {
+		return false, err
+	}
+	response, err := client.QueryChannels(resmgmt.WithTargetEndpoints(peer))
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to query the channels of %s", peer)
+	}
+	for _, channel := range response.GetChannels() {
+		if channel.GetChannelId() == channelID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// JoinChannel joins an organization's peers to channelID, fetching the
+// genesis block from orderer
+func (a *NetworkAdmin) JoinChannel(org, channelID, orderer string, peers []string) error {
+	client, err := a.client(org)
+	if err != nil {
+		return err
+	}
+	if err := client.JoinChannel(channelID, resmgmt.WithTargetEndpoints(peers...), resmgmt.WithOrdererEndpoint(orderer)); err != nil {
+		return errors.Wrapf(err, "failed to join %s to %s", strings.Join(peers, ", "), channelID)
+	}
+	return nil
+}
+
+// InstallChaincode installs a chaincode package on an organization's peers
+// that do not have it yet
+func (a *NetworkAdmin) InstallChaincode(org, label, packageID string, pkg []byte, peers []string) error {
+	client, err := a.client(org)
+	if err != nil {
+		return err
+	}
+
+	var missing []string
+	for _, peer := range peers {
+		installed, err := client.LifecycleQueryInstalledCC(resmgmt.WithTargetEndpoints(peer))
+		if err != nil {
+			return errors.Wrapf(err, "failed to query chaincodes installed on %s", peer)
+		}
+		found := false
+		for _, cc := range installed {
+			if cc.PackageID == packageID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, peer)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	responses, err := client.LifecycleInstallCC(resmgmt.LifecycleInstallCCRequest{Label: label, Package: pkg}, resmgmt.WithTargetEndpoints(missing...))
+	if err != nil {
+		return errors.Wrapf(err, "failed to install %s", label)
+	}
+	for _, response := range responses {
+		if response.PackageID != packageID {
+			return errors.Errorf("%s installed %s as %s, not %s", response.Target, label, response.PackageID, packageID)
+		}
+	}
+	return nil
+}
+
+// CommittedChaincode returns the committed definition of a chaincode, or
+// nil if it has none
+func (a *NetworkAdmin) CommittedChaincode(org, peer, channelID, name string) (*resmgmt.LifecycleChaincodeDefinition, error) {
+	client, err := a.client(org)
+	if err != nil {
+		return nil, err
+	}
+	definitions, err := client.LifecycleQueryCommittedCC(channelID, resmgmt.LifecycleQueryCommittedCCRequest{Name: name}, resmgmt.WithTargetEndpoints(peer))
+	if err != nil {
+		// The peer answers "namespace ... is not defined" for chaincodes
+		// never committed
+		if strings.Contains(err.Error(), "not defined") {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "failed to query the definition of %s", name)
+	}
+	for i := range definitions {
+		if definitions[i].Name == name {
+			return &definitions[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// ApprovedPackageID returns the package an organization approved for a
+// sequence of a chaincode, or "" if it approved none
+func (a *NetworkAdmin) ApprovedPackageID(org, peer, channelID, name string, sequence int64) (string, error) {
+	client, err := a.client(org)
+	if err != nil {
+		return "", err
+	}
+	approved, err := client.LifecycleQueryApprovedCC(channelID, resmgmt.LifecycleQueryApprovedCCRequest{Name: name, Sequence: sequence}, resmgmt.WithTargetEndpoints(peer))
+	if err != nil {
+		log.Debugf("No approval of %s sequence %d by %s: %v", name, sequence, org, err)
+		return "", nil
+	}
+	return approved.PackageID, nil
+}
+
+// ApproveChaincode approves a definition for an organization through one of
+// its peers
+func (a *NetworkAdmin) ApproveChaincode(org, peer, channelID, orderer string, definition ChaincodeDefinition) error {
+	client, err := a.client(org)
+	if err != nil {
+		return err
+	}
+	policy, collections, err := definition.policies()
+	if err != nil {
+		return err
+	}
+	request := resmgmt.LifecycleApproveCCRequest{
+		Name:             definition.Name,
+		Version:          definition.Version,
+		PackageID:        definition.PackageID,
+		Sequence:         definition.Sequence,
+		SignaturePolicy:  policy,
+		CollectionConfig: collections,
+	}
+	if _, err := client.LifecycleApproveCC(channelID, request, resmgmt.WithTargetEndpoints(peer), resmgmt.WithOrdererEndpoint(orderer)); err != nil {
+		return errors.Wrapf(err, "%s failed to approve %s sequence %d", org, definition.Name, definition.Sequence)
+	}
+	return nil
+}
+
+// CommitReadiness returns which organizations approved a definition
+func (a *NetworkAdmin) CommitReadiness(org, peer, channelID string, definition ChaincodeDefinition) (map[string]bool, error) {
+	client, err := a.client(org)
+	if err != nil {
+		return nil, err
+	}
+	policy, collections, err := definition.policies()
+	if err != nil {
+		return nil, err
+	}
+	request := resmgmt.LifecycleCheckCCCommitReadinessRequest{
+		Name:             definition.Name,
+		Version:          definition.Version,
+		Sequence:         definition.Sequence,
+		SignaturePolicy:  policy,
+		CollectionConfig: collections,
+	}
+	response, err := client.LifecycleCheckCCCommitReadiness(channelID, request, resmgmt.WithTargetEndpoints(peer))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to check commit readiness of %s", definition.Name)
+	}
+	return response.Approvals, nil
+}
+
+// CommitChaincode commits a definition, endorsed by peers, which must
+// satisfy the channel's lifecycle endorsement policy (by default a majority
+// of organizations)
+func (a *NetworkAdmin) CommitChaincode(org, channelID, orderer string, definition ChaincodeDefinition, peers []string) error {
+	client, err := a.client(org)
+	if err != nil {
+		return err
+	}
+	policy, collections, err := definition.policies()
+	if err != nil {
+		return err
+	}
+	request := resmgmt.LifecycleCommitCCRequest{
+		Name:             definition.Name,
+		Version:          definition.Version,
+		Sequence:         definition.Sequence,
+		SignaturePolicy:  policy,
+		CollectionConfig: collections,
+	}
+	if _, err := client.LifecycleCommitCC(channelID, request, resmgmt.WithTargetEndpoints(peers...), resmgmt.WithOrdererEndpoint(orderer)); err != nil {
+		return errors.Wrapf(err, "failed to commit %s sequence %d", definition.Name, definition.Sequence)
+	}
+	return nil
+}
+
+// collectionJSON is a collection in the peer CLI's collections config
+type collectionJSON struct {
+	Name              string `json:"name"`
+	Policy            string `json:"policy"`
+	RequiredPeerCount int32  `json:"requiredPeerCount"`
+	MaxPeerCount      int32  `json:"maxPeerCount"`
+	BlockToLive       uint64 `json:"blockToLive"`
+	MemberOnlyRead    bool   `json:"memberOnlyRead"`
+	MemberOnlyWrite   bool   `json:"memberOnlyWrite"`
+	EndorsementPolicy *struct {
+		SignaturePolicy     string `json:"signaturePolicy"`
+		ChannelConfigPolicy string `json:"channelConfigPolicy"`
+	} `json:"endorsementPolicy"`
+}
+
+// policies parses the definition's endorsement policy and collections
+func (d ChaincodeDefinition) policies() (*common.SignaturePolicyEnvelope, []*pb.CollectionConfig, error) {
+	var policy *common.SignaturePolicyEnvelope
+	if d.EndorsementPolicy != "" {
+		var err error
+		if policy, err = policydsl.FromString(d.EndorsementPolicy); err != nil {
+			return nil, nil, errors.Wrapf(err, "invalid endorsement policy for %s", d.Name)
+		}
+	}
+	if len(d.Collections) == 0 {
+		return policy, nil, nil
+	}
+
+	var collections []collectionJSON
+	if err := json.Unmarshal(d.Collections, &collections); err != nil {
+		return nil, nil, errors.Wrapf(err, "invalid collections config for %s", d.Name)
+	}
+	configs := make([]*pb.CollectionConfig, 0, len(collections))
+	for _, collection := range collections {
+		memberOrgs, err := policydsl.FromString(collection.Policy)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "invalid policy for collection %s", collection.Name)
+		}
+		static := &pb.StaticCollectionConfig{
+			Name:              collection.Name,
+			MemberOrgsPolicy:  &pb.CollectionPolicyConfig{Payload: &pb.CollectionPolicyConfig_SignaturePolicy{SignaturePolicy: memberOrgs}},
+			RequiredPeerCount: collection.RequiredPeerCount,
+			MaximumPeerCount:  collection.MaxPeerCount,
+			BlockToLive:       collection.BlockToLive,
+			MemberOnlyRead:    collection.MemberOnlyRead,
+			MemberOnlyWrite:   collection.MemberOnlyWrite,
+		}
+		if endorsement := collection.EndorsementPolicy; endorsement != nil {
+			switch {
+			case endorsement.SignaturePolicy != "":
+				signaturePolicy, err := policydsl.FromString(endorsement.SignaturePolicy)
+				if err != nil {
+					return nil, nil, errors.Wrapf(err, "invalid endorsement policy for collection %s", collection.Name)
+				}
+				static.EndorsementPolicy = &pb.ApplicationPolicy{Type: &pb.ApplicationPolicy_SignaturePolicy{SignaturePolicy: signaturePolicy}}
+			case endorsement.ChannelConfigPolicy != "":
+				static.EndorsementPolicy = &pb.ApplicationPolicy{Type: &pb.ApplicationPolicy_ChannelConfigPolicyReference{ChannelConfigPolicyReference: endorsement.ChannelConfigPolicy}}
+			}
+		}
+		configs = append(configs, &pb.CollectionConfig{Payload: &pb.CollectionConfig_StaticCollectionConfig{StaticCollectionConfig: static}})
+	}
+	return policy, configs, nil
+}
+
+// orgAdminsBackend is a connection profile with the organizations replaced
+type orgAdminsBackend struct {
+	core.ConfigBackend
+	organizations map[string]interface{}
+}
+
+func (b *orgAdminsBackend) Lookup(key string) (interface{}, bool) {
+	if key == "organizations" {
+		return b.organizations, true
+	}
+	return b.ConfigBackend.Lookup(key)
+}
+
+// withOrgAdmins adds each admin to its organization in the connection
+// profile, as the embedded user networkAdminUser
+func withOrgAdmins(provider core.ConfigProvider, admins []OrgAdmin) core.ConfigProvider {
+	return func() ([]core.ConfigBackend, error) {
+		backends, err := provider()
+		if err != nil {
+			return nil, err
+		}
+		for i, backend := range backends {
+			value, ok := backend.Lookup("organizations")
+			if !ok {
+				continue
+			}
+			organizations := toStringMap(value)
+			if organizations == nil {
+				return nil, errors.New("organizations in the connection profile are not a map")
+			}
+
+			merged := make(map[string]interface{}, len(organizations))
+			for name, org := range organizations {
+				merged[name] = org
+			}
+			for _, admin := range admins {
+				// Profile keys may have been lower-cased when it was loaded
+				name, org := "", map[string]interface{}(nil)
+				for key, value := range organizations {
+					if strings.EqualFold(key, admin.Org) {
+						name, org = key, toStringMap(value)
+					}
+				}
+				if org == nil {
+					return nil, errors.Errorf("organization %s is not in the connection profile", admin.Org)
+				}
+
+				withAdmin := make(map[string]interface{}, len(org)+1)
+				for key, value := range org {
+					withAdmin[key] = value
+				}
+				withAdmin["users"] = map[string]interface{}{
+					networkAdminUser: map[string]interface{}{
+						"cert": map[string]interface{}{"path": admin.Certificate},
+						"key":  map[string]interface{}{"path": admin.PrivateKey},
+					},
+				}
+				merged[name] = withAdmin
+			}
+
+			backends[i] = &orgAdminsBackend{ConfigBackend: backend, organizations: merged}
+			return backends, nil
+		}
+		return nil, errors.New("the connection profile has no organizations")
+	}
+}
+
+// toStringMap returns a profile section as a map, or nil if it is not one
+func toStringMap(value interface{}) map[string]interface{} {
+	switch m := value.(type) {
+	case map[string]interface{}:
+		return m
+	case map[interface{}]interface{}:
+		converted := make(map[string]interface{}, len(m))
+		for key, value := range m {
+			if s, ok := key.(string); ok {
+				converted[s] = value
+			}
+		}
+		return converted
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package fabric
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/chaichis-network/v3/internal/crypto"
+	"github.com/pkg/errors"
+)
+
+// PaddingConfig is the RSA padding a chaincode encrypts tickets with. A
+// chaincode set to OAEP still accepts PKCS#1 v1.5 ciphertexts until
+// LegacyUntil.
+type PaddingConfig struct {
+	Padding     crypto.Padding `json:"padding"`
+	LegacyUntil int64          `json:"legacyUntil,omitempty"` // Unix seconds
+	UpdatedBy   string         `json:"updatedBy,omitempty"`
+	UpdatedAt   int64          `json:"updatedAt,omitempty"` // Unix seconds
+}
+
+// AcceptsLegacy reports whether the chaincode accepts PKCS#1 v1.5
+// ciphertexts at now
+func (p *PaddingConfig) AcceptsLegacy(now time.Time) bool {
+	return p.Padding != crypto.PaddingOAEP || now.Unix() < p.LegacyUntil
+}
+
+// SetRSAPadding switches the padding a chaincode encrypts tickets with. On a
+// switch to OAEP, PKCS#1 v1.5 ciphertexts are still accepted for transition.
+func (c *Client) SetRSAPadding(contract *Contract, padding crypto.Padding, transition time.Duration) (*PaddingConfig, error) {
+	responseBytes, err := c.submit(contract, "SetRSAPadding", string(padding), strconv.FormatInt(int64(transition/time.Second), 10))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to set RSA padding of %s", contract.Name())
+	}
+	return unmarshalPaddingConfig(responseBytes)
+}
+
+// GetRSAPadding returns the padding a chaincode encrypts and accepts
+func (c *Client) GetRSAPadding(contract *Contract) (*PaddingConfig, error) {
+	responseBytes, err := c.evaluate(contract, "GetRSAPadding")
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get RSA padding of %s", contract.Name())
+	}
+	return unmarshalPaddingConfig(responseBytes)
+}
+
+func unmarshalPaddingConfig(responseBytes []byte) (*PaddingConfig, error) {
+	var config PaddingConfig
+	if err := json.Unmarshal(responseBytes, &config); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal RSA padding")
+	}
+	return &config, nil
+}
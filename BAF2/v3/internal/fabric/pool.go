@@ -0,0 +1,102 @@
+package fabric
+
+import (
+	"sync"
+)
+
+// ConnectionPool keeps gateway connections open across Clients, so a
+// process that builds several Clients in sequence (a multi-step command,
+// a plugin host, a server) connects and discovers the channel once.
+// Connections are keyed by connection profile, wallet, identity and Fabric
+// API; the networks of a connection are cached with it. A Client created with a
+// pool takes its connection from the pool and, when closed, leaves it open
+// for the next Client. Close the pool itself when done.
+type ConnectionPool struct {
+	mu          sync.Mutex
+	connections map[connectionKey]*pooledConnection
+	stats       PoolStats
+}
+
+// PoolStats counts what a ConnectionPool has done
+type PoolStats struct {
+	// Connections is the number of open connections
+	Connections int `json:"connections"`
+	// Opened counts connections opened, Reused connections handed out again
+	Opened int `json:"opened"`
+	Reused int `json:"reused"`
+}
+
+type connectionKey struct {
+	configPath  string
+	ageIdentity string
+	wallet      string // wallet backend and path
+	identity    string
+	api         string
+	gatewayPeer string
+}
+
+type pooledConnection struct {
+	conn    connection
+	clients int
+}
+
+// NewConnectionPool creates an empty pool
+func NewConnectionPool() *ConnectionPool {
+	return &ConnectionPool{connections: make(map[connectionKey]*pooledConnection)}
+}
+
+// acquire returns the connection for key, opening it with connect if the
+// pool has none
+func (p *ConnectionPool) acquire(key connectionKey, connect func() (connection, error)) (*pooledConnection, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if conn, ok := p.connections[key]; ok {
+		conn.clients++
+		p.stats.Reused++
+		return conn, nil
+	}
+	opened, err := connect()
+	if err != nil {
+		return nil, err
+	}
+	conn := &pooledConnection{conn: opened, clients: 1}
+	p.connections[key] = conn
+	p.stats.Opened++
+	return conn, nil
+}
+
+// release returns a Client's connection to the pool, open
+func (p *ConnectionPool) release(conn *pooledConnection) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if conn.clients > 0 {
+		conn.clients--
+	}
+}
+
+// Stats returns the pool's counters
+func (p *ConnectionPool) Stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stats := p.stats
+	stats.Connections = len(p.connections)
+	return stats
+}
+
+// Close closes every connection in the pool. Clients still using one fail
+// their next call.
+func (p *ConnectionPool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for key, conn := range p.connections {
+		if conn.clients > 0 {
+			log.Debugf("Closing pooled connection of %s still used by %d clients", key.identity, conn.clients)
+		}
+		conn.conn.close()
+		delete(p.connections, key)
+	}
+}
@@ -0,0 +1,80 @@
+package fabric
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/chaichis-network/v3/pkg/ticket"
+	"github.com/pkg/errors"
+)
+
+// protocolCache holds the protocol info fetched from each chaincode, by
+// contract name
+type protocolCache struct {
+	mu    sync.Mutex
+	infos map[string]*ticket.ProtocolInfo
+}
+
+// ProtocolInfo returns the protocol versions and message formats a chaincode
+// supports. It is fetched once per contract; a chaincode that predates
+// GetProtocolInfo is taken to speak protocol version 1, unless the client is
+// strict.
+func (c *Client) ProtocolInfo(contract *Contract, service string) (*ticket.ProtocolInfo, error) {
+	c.protocols.mu.Lock()
+	defer c.protocols.mu.Unlock()
+
+	if info, ok := c.protocols.infos[contract.Name()]; ok {
+		return info, nil
+	}
+
+	var info ticket.ProtocolInfo
+	responseBytes, err := c.evaluate(contract, "GetProtocolInfo")
+	if err == nil {
+		err = json.Unmarshal(responseBytes, &info)
+	}
+	if err != nil {
+		if c.strict {
+			return nil, errors.Wrapf(err, "failed to get protocol info from %s (strict mode)", contract.Name())
+		}
+		log.Debugf("Assuming protocol version 1 for %s: %v", contract.Name(), err)
+		info = ticket.LegacyProtocolInfo(service)
+	}
+
+	if c.protocols.infos == nil {
+		c.protocols.infos = make(map[string]*ticket.ProtocolInfo)
+	}
+	c.protocols.infos[contract.Name()] = &info
+	return &info, nil
+}
+
+// ProtocolInfo returns the protocols the AS supports
+func (as *AuthServerContract) ProtocolInfo() (*ticket.ProtocolInfo, error) {
+	return as.client.ProtocolInfo(as.contract, "as")
+}
+
+// ProtocolInfo returns the protocols the TGS supports
+func (tgs *TicketGrantingContract) ProtocolInfo() (*ticket.ProtocolInfo, error) {
+	return tgs.client.ProtocolInfo(tgs.contract, "tgs")
+}
+
+// GenerateTGTWithProtocol generates a TGT in a negotiated protocol. Only
+// protocol version 2 and later AS chaincodes have this function; use
+// GenerateTGT for version 1.
+func (as *AuthServerContract) GenerateTGTWithProtocol(clientID string, protocol ticket.Protocol) (map[string]string, error) {
+	protocolJSON, err := json.Marshal(protocol)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal protocol")
+	}
+
+	responseBytes, err := as.client.submit(as.contract, "GenerateTGTWithProtocol", clientID, string(protocolJSON))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to generate TGT from AS")
+	}
+
+	var response map[string]string
+	if err := json.Unmarshal(responseBytes, &response); err != nil {
+		return nil, errors.Wrap(err, "failed to parse TGT response")
+	}
+
+	return response, nil
+}
@@ -0,0 +1,24 @@
+// Package protoconflict lets fabric-sdk-go and fabric-gateway share a
+// binary. Both register the Fabric protobuf messages (common.Envelope,
+// rwset.TxReadWriteSet, ...) under the same names, from fabric-protos-go and
+// fabric-protos-go-apiv2, and the protobuf runtime panics on the second
+// registration by default. Each library only uses its own message types, so
+// the duplicates are ignored instead.
+//
+// The policy must be set before either protos package registers. Packages
+// are initialized in import path order once their imports are, so this one,
+// which only imports os, runs before any github.com/hyperledger package.
+// Setting GOLANG_PROTOBUF_REGISTRATION_CONFLICT overrides it.
+package protoconflict
+
+import "os"
+
+// registrationConflictEnv is read by google.golang.org/protobuf on each
+// conflicting registration
+const registrationConflictEnv = "GOLANG_PROTOBUF_REGISTRATION_CONFLICT"
+
+func init() {
+	if os.Getenv(registrationConflictEnv) == "" {
+		os.Setenv(registrationConflictEnv, "ignore")
+	}
+}
@@ -0,0 +1,59 @@
+package fabric
+
+import (
+	"encoding/json"
+
+	"github.com/chaichis-network/v3/pkg/ticket"
+	"github.com/pkg/errors"
+)
+
+// RenewTGT exchanges a TGT that is still valid for one with a new lifetime
+// and the same session key. authenticator is a fresh ticket.NewAuthenticator
+// for the client.
+func (as *AuthServerContract) RenewTGT(clientID, encryptedTGT, authenticator string) (map[string]string, error) {
+	responseBytes, err := as.client.submit(as.contract, "RenewTGT", clientID, encryptedTGT, authenticator)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to renew TGT with AS")
+	}
+
+	var response map[string]string
+	if err := json.Unmarshal(responseBytes, &response); err != nil {
+		return nil, errors.Wrap(err, "failed to parse TGT response")
+	}
+	return response, nil
+}
+
+// RenewServiceTicket replaces a service ticket that is still valid with a
+// new one; the old ticket is recorded as renewed
+func (tgs *TicketGrantingContract) RenewServiceTicket(request *ticket.ServiceTicketRenewalRequest) (map[string]string, error) {
+	requestJSON, err := json.Marshal(request)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal service ticket renewal request")
+	}
+
+	responseBytes, err := tgs.client.submit(tgs.contract, "RenewServiceTicket", string(requestJSON))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to renew service ticket with TGS")
+	}
+
+	var response map[string]string
+	if err := json.Unmarshal(responseBytes, &response); err != nil {
+		return nil, errors.Wrap(err, "failed to parse service ticket response")
+	}
+	return response, nil
+}
+
+// RenewSession extends an active session before it expires, with a service
+// ticket of the session's client, and returns the updated session
+func (isv *ISVContract) RenewSession(sessionID, encryptedServiceTicket string) (map[string]interface{}, error) {
+	responseBytes, err := isv.client.submit(isv.contract, "RenewSession", sessionID, encryptedServiceTicket)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to renew session with ISV")
+	}
+
+	var session map[string]interface{}
+	if err := json.Unmarshal(responseBytes, &session); err != nil {
+		return nil, errors.Wrap(err, "failed to parse session response")
+	}
+	return session, nil
+}
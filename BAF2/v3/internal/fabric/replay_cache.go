@@ -0,0 +1,49 @@
+package fabric
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// ReplayPurgeResult reports a PurgeReplayCache call: how many expired
+// replay cache entries it deleted, and whether more are left
+type ReplayPurgeResult struct {
+	Purged int  `json:"purged"`
+	More   bool `json:"more"`
+}
+
+// PurgeReplayCache deletes expired entries of the AS replay cache
+func (as *AuthServerContract) PurgeReplayCache() (*ReplayPurgeResult, error) {
+	responseBytes, err := as.client.submit(as.contract, "PurgeReplayCache")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to purge replay cache of AS")
+	}
+	return parseReplayPurgeResult(responseBytes)
+}
+
+// PurgeReplayCache deletes expired entries of the TGS replay cache
+func (tgs *TicketGrantingContract) PurgeReplayCache() (*ReplayPurgeResult, error) {
+	responseBytes, err := tgs.client.submit(tgs.contract, "PurgeReplayCache")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to purge replay cache of TGS")
+	}
+	return parseReplayPurgeResult(responseBytes)
+}
+
+// PurgeReplayCache deletes expired entries of the ISV replay cache
+func (isv *ISVContract) PurgeReplayCache() (*ReplayPurgeResult, error) {
+	responseBytes, err := isv.client.submit(isv.contract, "PurgeReplayCache")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to purge replay cache of ISV")
+	}
+	return parseReplayPurgeResult(responseBytes)
+}
+
+func parseReplayPurgeResult(responseBytes []byte) (*ReplayPurgeResult, error) {
+	var result ReplayPurgeResult
+	if err := json.Unmarshal(responseBytes, &result); err != nil {
+		return nil, errors.Wrap(err, "failed to parse replay cache purge response")
+	}
+	return &result, nil
+}
@@ -0,0 +1,86 @@
+package fabric
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// MaxRevocationBatch is the most devices the ISV revokes in one transaction
+const MaxRevocationBatch = 200
+
+// RevocationResult reports what one RevokeDevices batch did with each device
+type RevocationResult struct {
+	Revoked        []string `json:"revoked"`
+	AlreadyRevoked []string `json:"alreadyRevoked"`
+	NotFound       []string `json:"notFound"`
+	Denied         []string `json:"denied"`
+	ClosedSessions []string `json:"closedSessions"`
+}
+
+// RevokeDevices revokes a batch of up to MaxRevocationBatch devices and
+// closes their sessions. Devices that are already revoked, unknown or owned
+// by another organization are reported, not failed.
+func (isv *ISVContract) RevokeDevices(deviceIDs []string, reason string) (*RevocationResult, error) {
+	deviceIDsJSON, err := json.Marshal(deviceIDs)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal device IDs")
+	}
+
+	responseBytes, err := isv.client.submit(isv.contract, "RevokeDevices", string(deviceIDsJSON), reason)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to revoke devices with ISV")
+	}
+
+	var result RevocationResult
+	if err := json.Unmarshal(responseBytes, &result); err != nil {
+		return nil, errors.Wrap(err, "failed to parse revocation response")
+	}
+	return &result, nil
+}
+
+// ClientRevocation is an entry of the TGS or ISV revocation list. The TGS
+// refuses every TGT of a client on its list; the ISV refuses the client's
+// service tickets issued up to RevokedAt.
+type ClientRevocation struct {
+	ClientID       string    `json:"clientID"`
+	RevokedAt      time.Time `json:"revokedAt"`
+	RevokedBy      string    `json:"revokedBy"`
+	Reason         string    `json:"reason"`
+	FlowID         string    `json:"flowID,omitempty"`
+	ClosedSessions []string  `json:"closedSessions,omitempty"` // ISV only
+}
+
+// parseClientRevocation parses a revocation list entry, returning nil for
+// an empty response
+func parseClientRevocation(responseBytes []byte) (*ClientRevocation, error) {
+	if len(responseBytes) == 0 {
+		return nil, nil
+	}
+	var revocation ClientRevocation
+	if err := json.Unmarshal(responseBytes, &revocation); err != nil {
+		return nil, errors.Wrap(err, "failed to parse revocation response")
+	}
+	return &revocation, nil
+}
+
+// RevokeTGT puts a client on the TGS revocation list, so that none of its
+// TGTs is accepted again. Revoking a revoked client returns its entry.
+func (tgs *TicketGrantingContract) RevokeTGT(clientID, reason string) (*ClientRevocation, error) {
+	responseBytes, err := tgs.client.submit(tgs.contract, "RevokeTGT", clientID, reason)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to revoke TGTs with TGS")
+	}
+	return parseClientRevocation(responseBytes)
+}
+
+// RevokeServiceTicket revokes every service ticket issued to a client so
+// far and closes the client's sessions
+func (isv *ISVContract) RevokeServiceTicket(clientID, reason string) (*ClientRevocation, error) {
+	responseBytes, err := isv.client.submit(isv.contract, "RevokeServiceTicket", clientID, reason)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to revoke service tickets with ISV")
+	}
+	return parseClientRevocation(responseBytes)
+}
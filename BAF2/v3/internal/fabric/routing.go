@@ -0,0 +1,104 @@
+package fabric
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+)
+
+// PeerRoles assigns peers (by name in the connection profile) to roles.
+// Endorsers receive submitted transactions; QueryPeers serve evaluate calls
+// so heavy reads don't load the endorsing peers. Empty lists fall back to
+// the gateway's default peer selection. With APIGateway a peer stands for its
+// organization: the gateway peer picks one of the organization's peers.
+type PeerRoles struct {
+	Endorsers  []string
+	QueryPeers []string
+}
+
+// evaluate runs a read-only transaction, preferring the designated query peers.
+// Query peers are tried in round-robin order; if all of them fail the call
+// fails over to the gateway's default peers, unless the client is strict.
+func (c *Client) evaluate(contract *Contract, name string, args ...string) ([]byte, error) {
+	queryPeers := c.peers.QueryPeers
+	if len(queryPeers) == 0 {
+		return contract.backend.evaluate(name, txOptions{}, args)
+	}
+
+	start := int(atomic.AddUint32(&c.nextQuery, 1) - 1)
+	var lastErr error
+	for i := 0; i < len(queryPeers); i++ {
+		peer := queryPeers[(start+i)%len(queryPeers)]
+		if c.debug {
+			fmt.Printf("Evaluating %s on query peer %s\n", name, peer)
+		}
+
+		result, err := contract.backend.evaluate(name, txOptions{peers: []string{peer}}, args)
+		if err == nil {
+			return result, nil
+		}
+		lastErr = err
+		log.Warnf("Query peer %s failed for %s, trying next: %v", peer, name, err)
+	}
+
+	if c.strict {
+		return nil, errors.Wrapf(lastErr, "all query peers failed for %s (strict mode, no failover)", name)
+	}
+	log.Warnf("All query peers failed for %s, falling back to default peers: %v", name, lastErr)
+	return contract.backend.evaluate(name, txOptions{}, args)
+}
+
+// submit runs a transaction on the designated endorsing peers, if any.
+// Arguments over the chaincode's payload limits are rejected before submitting.
+func (c *Client) submit(contract *Contract, name string, args ...string) ([]byte, error) {
+	if name != "SetPayloadLimits" {
+		limits, err := c.loadPayloadLimits(contract)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get payload limits for %s (strict mode)", name)
+		}
+		if err := limits.CheckArguments(name, args); err != nil {
+			return nil, err
+		}
+	}
+
+	return c.submitWith(contract, name, c.transactionOptions(nil), args)
+}
+
+// submitTransient is submit with transient data, which the chaincode reads
+// but which is not recorded on the ledger
+func (c *Client) submitTransient(contract *Contract, name string, transient map[string][]byte, args ...string) ([]byte, error) {
+	limits, err := c.loadPayloadLimits(contract)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get payload limits for %s (strict mode)", name)
+	}
+	if err := limits.CheckArguments(name, args); err != nil {
+		return nil, err
+	}
+
+	return c.submitWith(contract, name, c.transactionOptions(transient), args)
+}
+
+// submitWith submits a transaction through the contract's backend and
+// records it in the client's transaction log, if it has one
+func (c *Client) submitWith(contract *Contract, name string, options txOptions, args []string) ([]byte, error) {
+	result, txID, err := contract.backend.submit(name, options, args)
+	if c.transactions != nil {
+		c.transactions.record(contract.name, name, txID, err)
+	}
+	return result, err
+}
+
+// transactionOptions returns the options of a submitted transaction: the
+// endorsing peers, and the transient data with the client's flow ID added
+func (c *Client) transactionOptions(transient map[string][]byte) txOptions {
+	if c.flowID != "" {
+		withFlow := map[string][]byte{flowIDTransient: []byte(c.flowID)}
+		for field, value := range transient {
+			withFlow[field] = value
+		}
+		transient = withFlow
+	}
+
+	return txOptions{peers: c.peers.Endorsers, transient: transient}
+}
@@ -0,0 +1,79 @@
+package fabric
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// SearchFilter narrows a device or client search. Empty fields do not
+// filter. RegisteredAfter and RegisteredBefore are RFC3339 times. Capability
+// and Owner apply to devices only; client Status is "valid" or "invalid".
+// Labels is a label selector such as "site=plant-7,type=hvac"; besides
+// key=value it takes key!=value, key (label set) and !key (label not set).
+type SearchFilter struct {
+	Status           string `json:"status,omitempty"`
+	Capability       string `json:"capability,omitempty"`
+	Owner            string `json:"owner,omitempty"`
+	Labels           string `json:"labels,omitempty"`
+	RegisteredAfter  string `json:"registeredAfter,omitempty"`
+	RegisteredBefore string `json:"registeredBefore,omitempty"`
+	PageSize         int32  `json:"pageSize,omitempty"`
+	Bookmark         string `json:"bookmark,omitempty"`
+}
+
+// DeviceSearchPage is one page of SearchDevices results. Pass Bookmark in
+// the next filter to continue; it is empty on the last page.
+type DeviceSearchPage struct {
+	Devices  []map[string]interface{} `json:"devices"`
+	Bookmark string                   `json:"bookmark"`
+	Count    int32                    `json:"count"`
+}
+
+// ClientSearchPage is one page of SearchClients results. Pass Bookmark in
+// the next filter to continue; it is empty on the last page.
+type ClientSearchPage struct {
+	Clients  []map[string]interface{} `json:"clients"`
+	Bookmark string                   `json:"bookmark"`
+	Count    int32                    `json:"count"`
+}
+
+// SearchDevices returns one page of registered devices matching filter.
+// The ISV chaincode needs a CouchDB state database for this query.
+func (isv *ISVContract) SearchDevices(filter SearchFilter) (*DeviceSearchPage, error) {
+	filterJSON, err := json.Marshal(filter)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal search filter")
+	}
+
+	responseBytes, err := isv.client.evaluate(isv.contract, "SearchDevices", string(filterJSON))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to search devices")
+	}
+
+	var page DeviceSearchPage
+	if err := json.Unmarshal(responseBytes, &page); err != nil {
+		return nil, errors.Wrap(err, "failed to parse device search response")
+	}
+	return &page, nil
+}
+
+// SearchClients returns one page of client registrations matching filter.
+// The AS chaincode needs a CouchDB state database for this query.
+func (as *AuthServerContract) SearchClients(filter SearchFilter) (*ClientSearchPage, error) {
+	filterJSON, err := json.Marshal(filter)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal search filter")
+	}
+
+	responseBytes, err := as.client.evaluate(as.contract, "SearchClients", string(filterJSON))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to search clients")
+	}
+
+	var page ClientSearchPage
+	if err := json.Unmarshal(responseBytes, &page); err != nil {
+		return nil, errors.Wrap(err, "failed to parse client search response")
+	}
+	return &page, nil
+}
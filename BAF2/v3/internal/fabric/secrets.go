@@ -0,0 +1,135 @@
+package fabric
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/core"
+	"github.com/hyperledger/fabric-sdk-go/pkg/core/config"
+	"github.com/pkg/errors"
+)
+
+// Encrypted connection profiles are decrypted in memory by the sops or age
+// command-line tools; the plaintext is never written to disk.
+//
+//   - SOPS files are detected by their "sops" metadata section (or a ".enc."
+//     infix in the file name) and decrypted with `sops --decrypt`. sops finds
+//     age keys through SOPS_AGE_KEY_FILE as usual.
+//   - Files ending in ".age" are decrypted with `age --decrypt` using the
+//     identity file from ClientOptions.AgeIdentityFile or AUTHCLI_AGE_IDENTITY.
+
+const (
+	// AgeIdentityEnv names the environment variable holding the age identity file
+	AgeIdentityEnv = "AUTHCLI_AGE_IDENTITY"
+
+	sopsBinary = "sops"
+	ageBinary  = "age"
+)
+
+// configProviderFor returns a config provider for a connection profile,
+// decrypting it in memory if it is encrypted
+func configProviderFor(path string, ageIdentityFile string) (core.ConfigProvider, error) {
+	configType := configTypeFor(path)
+
+	if strings.HasSuffix(path, ".age") {
+		plaintext, err := decryptAge(path, ageIdentityFile)
+		if err != nil {
+			return nil, err
+		}
+		return config.FromRaw(plaintext, configType), nil
+	}
+
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read connection profile")
+	}
+
+	if isSOPSFile(path, raw) {
+		plaintext, err := decryptSOPS(path, configType)
+		if err != nil {
+			return nil, err
+		}
+		return config.FromRaw(plaintext, configType), nil
+	}
+
+	return config.FromRaw(raw, configType), nil
+}
+
+// configTypeFor derives the config format from the file name, ignoring
+// encryption suffixes and infixes (profile.enc.yaml, profile.json.age)
+func configTypeFor(path string) string {
+	name := strings.TrimSuffix(filepath.Base(path), ".age")
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".yaml", ".yml":
+		return "yaml"
+	default:
+		return "json"
+	}
+}
+
+// isSOPSFile reports whether a config file carries SOPS metadata
+func isSOPSFile(path string, raw []byte) bool {
+	if strings.Contains(filepath.Base(path), ".enc.") {
+		return true
+	}
+
+	if configTypeFor(path) == "json" {
+		var doc map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &doc); err != nil {
+			return false
+		}
+		_, ok := doc["sops"]
+		return ok
+	}
+
+	for _, line := range strings.Split(string(raw), "\n") {
+		if strings.HasPrefix(line, "sops:") {
+			return true
+		}
+	}
+	return false
+}
+
+func decryptSOPS(path, configType string) ([]byte, error) {
+	plaintext, err := runDecrypt(sopsBinary, "--decrypt", "--output-type", configType, path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to decrypt SOPS connection profile %s", path)
+	}
+	return plaintext, nil
+}
+
+func decryptAge(path, identityFile string) ([]byte, error) {
+	if identityFile == "" {
+		identityFile = os.Getenv(AgeIdentityEnv)
+	}
+	if identityFile == "" {
+		return nil, errors.Errorf("connection profile %s is age-encrypted but no identity file is configured (set %s)", path, AgeIdentityEnv)
+	}
+
+	plaintext, err := runDecrypt(ageBinary, "--decrypt", "-i", identityFile, path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to decrypt age connection profile %s", path)
+	}
+	return plaintext, nil
+}
+
+// runDecrypt runs a decryption tool and returns its stdout
+func runDecrypt(binary string, args ...string) ([]byte, error) {
+	if _, err := exec.LookPath(binary); err != nil {
+		return nil, errors.Errorf("%s is required to read encrypted configs but was not found in PATH", binary)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(binary, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, errors.Errorf("%s failed: %v: %s", binary, err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
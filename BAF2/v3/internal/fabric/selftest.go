@@ -0,0 +1,46 @@
+package fabric
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// Self-test check outcomes
+const (
+	SelfTestPass = "pass"
+	SelfTestFail = "fail"
+	SelfTestSkip = "skip"
+)
+
+// SelfTestCheck is the outcome of one check of a chaincode self-test
+type SelfTestCheck struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// SelfTestReport is what a chaincode's SelfTest returns: whether it can use
+// its key pair, and whether the services it encrypts tickets for can open
+// what it seals with their imported keys
+type SelfTestReport struct {
+	Service     string          `json:"service"`
+	Passed      bool            `json:"passed"`
+	Fingerprint string          `json:"fingerprint,omitempty"`
+	Padding     string          `json:"padding"`
+	Checks      []SelfTestCheck `json:"checks"`
+}
+
+// SelfTest runs a chaincode's self-test. It writes nothing, so it is
+// evaluated, and checks the key material of the peer that answers.
+func (c *Client) SelfTest(contract *Contract) (*SelfTestReport, error) {
+	responseBytes, err := c.evaluate(contract, "SelfTest")
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to run self-test of %s", contract.Name())
+	}
+	var report SelfTestReport
+	if err := json.Unmarshal(responseBytes, &report); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal self-test report")
+	}
+	return &report, nil
+}
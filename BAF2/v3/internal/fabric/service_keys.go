@@ -0,0 +1,173 @@
+package fabric
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// ServiceKey is a public key a chaincode has published for the services
+// that depend on it: the AS needs the TGS key, the TGS needs the ISV key
+// and, to check the client changes the AS signs, the AS key
+type ServiceKey struct {
+	Service     string `json:"service"`
+	PublicKey   string `json:"publicKey"`
+	Fingerprint string `json:"fingerprint"`
+	PublishedAt string `json:"publishedAt"`
+	PublishedBy string `json:"publishedBy"`
+}
+
+// PublishPublicKey publishes a chaincode's own public key
+func (c *Client) PublishPublicKey(contract *Contract) (*ServiceKey, error) {
+	responseBytes, err := c.submit(contract, "PublishPublicKey")
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to publish public key on %s", contract.Name())
+	}
+	return unmarshalServiceKey(responseBytes)
+}
+
+// GetPublishedPublicKey returns the public key a chaincode has published
+func (c *Client) GetPublishedPublicKey(contract *Contract) (*ServiceKey, error) {
+	responseBytes, err := c.evaluate(contract, "GetPublishedPublicKey")
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get published public key from %s", contract.Name())
+	}
+	return unmarshalServiceKey(responseBytes)
+}
+
+// ImportPeerServiceKey makes a chaincode import the key published on
+// peerChaincode. The chaincode rejects it unless its fingerprint matches.
+func (c *Client) ImportPeerServiceKey(contract *Contract, peerChaincode, fingerprint string) (*ServiceKey, error) {
+	responseBytes, err := c.submit(contract, "ImportPeerServiceKey", peerChaincode, fingerprint)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to import %s key into %s", peerChaincode, contract.Name())
+	}
+	return unmarshalServiceKey(responseBytes)
+}
+
+// InitializationRecord is what a chaincode recorded when it was initialized:
+// the initializing identity and the fingerprints of the keys it loaded, by
+// key name (e.g. "TGS_PUBLIC_KEY")
+type InitializationRecord struct {
+	Service         string            `json:"service"`
+	InitializedBy   string            `json:"initializedBy"`
+	Initializer     string            `json:"initializer"`
+	InitializedAt   string            `json:"initializedAt"`
+	TxID            string            `json:"txID"`
+	KeyFingerprints map[string]string `json:"keyFingerprints"`
+}
+
+// GetInitializationRecord returns a chaincode's initialization record
+func (c *Client) GetInitializationRecord(contract *Contract) (*InitializationRecord, error) {
+	responseBytes, err := c.evaluate(contract, "GetInitializationRecord")
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get initialization record from %s", contract.Name())
+	}
+	var record InitializationRecord
+	if err := json.Unmarshal(responseBytes, &record); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal initialization record")
+	}
+	return &record, nil
+}
+
+// ServiceKeyPair is a chaincode's PEM key pair, passed to it as transient
+// data so that it stays off the ledger
+type ServiceKeyPair struct {
+	PrivateKey string `json:"privateKey"`
+	PublicKey  string `json:"publicKey"`
+}
+
+// KeyBootstrap says where a chaincode keeps its private key: in the named
+// private data collection, or in world state if Collection is empty
+type KeyBootstrap struct {
+	Collection string `json:"collection,omitempty"`
+	// Source is recorded by the chaincode when the key pair came from a
+	// secret store, so a newer version can be detected
+	Source *KeySource `json:"source,omitempty"`
+}
+
+// KeySource names the secret a key pair was fetched from, e.g. a Vault
+// secret and its version. It holds no key material.
+type KeySource struct {
+	Provider string `json:"provider"`
+	Path     string `json:"path"`
+	Version  int64  `json:"version"`
+}
+
+// ServiceKeyStatus describes the key pair a chaincode runs with. Legacy is
+// set for the key pairs once published in the chaincode source.
+type ServiceKeyStatus struct {
+	Service     string `json:"service"`
+	Fingerprint string `json:"fingerprint"`
+	Collection  string `json:"collection,omitempty"`
+	Legacy      bool   `json:"legacy"`
+	// Source is where the key pair was fetched from, if from a secret
+	// store; chaincodes from before sources were recorded never set it
+	Source *KeySource `json:"source,omitempty"`
+}
+
+// serviceKeysTransient is the transient field the chaincodes read the key
+// pair from
+const serviceKeysTransient = "serviceKeys"
+
+// InitializeWithKeys initializes a chaincode with an operator-supplied key
+// pair
+func (c *Client) InitializeWithKeys(contract *Contract, bootstrap KeyBootstrap, keys *ServiceKeyPair) error {
+	if _, err := c.submitKeys(contract, "InitializeWithKeys", bootstrap, keys); err != nil {
+		return errors.Wrapf(err, "failed to initialize %s", contract.Name())
+	}
+	return nil
+}
+
+// MigrateServiceKeys replaces a chaincode's key pair, or with nil keys moves
+// its current one to where bootstrap says
+func (c *Client) MigrateServiceKeys(contract *Contract, bootstrap KeyBootstrap, keys *ServiceKeyPair) (*ServiceKeyStatus, error) {
+	responseBytes, err := c.submitKeys(contract, "MigrateServiceKeys", bootstrap, keys)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to migrate keys of %s", contract.Name())
+	}
+	return unmarshalServiceKeyStatus(responseBytes)
+}
+
+// GetServiceKeyStatus returns the status of a chaincode's key pair
+func (c *Client) GetServiceKeyStatus(contract *Contract) (*ServiceKeyStatus, error) {
+	responseBytes, err := c.evaluate(contract, "GetServiceKeyStatus")
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get key status from %s", contract.Name())
+	}
+	return unmarshalServiceKeyStatus(responseBytes)
+}
+
+// submitKeys submits a key bootstrap transaction, passing keys as transient
+// data if given
+func (c *Client) submitKeys(contract *Contract, name string, bootstrap KeyBootstrap, keys *ServiceKeyPair) ([]byte, error) {
+	bootstrapJSON, err := json.Marshal(bootstrap)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal key bootstrap")
+	}
+	transient := map[string][]byte{}
+	if keys != nil {
+		keysJSON, err := json.Marshal(keys)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to marshal key pair")
+		}
+		transient[serviceKeysTransient] = keysJSON
+	}
+	return c.submitTransient(contract, name, transient, string(bootstrapJSON))
+}
+
+func unmarshalServiceKeyStatus(responseBytes []byte) (*ServiceKeyStatus, error) {
+	var status ServiceKeyStatus
+	if err := json.Unmarshal(responseBytes, &status); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal key status")
+	}
+	return &status, nil
+}
+
+func unmarshalServiceKey(responseBytes []byte) (*ServiceKey, error) {
+	var key ServiceKey
+	if err := json.Unmarshal(responseBytes, &key); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal service key")
+	}
+	return &key, nil
+}
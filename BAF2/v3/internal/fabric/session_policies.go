@@ -0,0 +1,108 @@
+package fabric
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DeviceClass is the session policy of a kind of device
+type DeviceClass struct {
+	ClassID         string    `json:"classID"`
+	SessionLifetime int64     `json:"sessionLifetime"` // Seconds; 0 keeps the default
+	IdleTimeout     int64     `json:"idleTimeout"`     // Seconds; 0 disables
+	Owner           string    `json:"owner"`
+	UpdatedAt       time.Time `json:"updatedAt"`
+}
+
+// DeviceSessionPolicy is a device's class and its own overrides; 0 inherits
+// the class value
+type DeviceSessionPolicy struct {
+	DeviceClass     string `json:"deviceClass,omitempty"`
+	SessionLifetime int64  `json:"sessionLifetime,omitempty"`
+	IdleTimeout     int64  `json:"idleTimeout,omitempty"`
+}
+
+// SessionPolicy is the session lifetime and idle timeout new sessions with a
+// device get
+type SessionPolicy struct {
+	DeviceID        string `json:"deviceID"`
+	DeviceClass     string `json:"deviceClass,omitempty"`
+	SessionLifetime int64  `json:"sessionLifetime"`
+	IdleTimeout     int64  `json:"idleTimeout"`
+}
+
+// SetDeviceClass creates or updates a device class
+func (isv *ISVContract) SetDeviceClass(classID string, sessionLifetime, idleTimeout int64) (*DeviceClass, error) {
+	if err := isv.client.PayloadLimits(isv.contract).CheckID(classID); err != nil {
+		return nil, errors.Wrap(err, "invalid device class ID")
+	}
+
+	responseBytes, err := isv.client.submit(isv.contract, "SetDeviceClass", classID,
+		strconv.FormatInt(sessionLifetime, 10), strconv.FormatInt(idleTimeout, 10))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to set device class with ISV")
+	}
+	return parseDeviceClass(responseBytes)
+}
+
+// GetDeviceClass returns a device class
+func (isv *ISVContract) GetDeviceClass(classID string) (*DeviceClass, error) {
+	responseBytes, err := isv.client.evaluate(isv.contract, "GetDeviceClass", classID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get device class from ISV")
+	}
+	return parseDeviceClass(responseBytes)
+}
+
+// GetAllDeviceClasses returns every device class
+func (isv *ISVContract) GetAllDeviceClasses() ([]*DeviceClass, error) {
+	responseBytes, err := isv.client.evaluate(isv.contract, "GetAllDeviceClasses")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get device classes from ISV")
+	}
+
+	var classes []*DeviceClass
+	if err := json.Unmarshal(responseBytes, &classes); err != nil {
+		return nil, errors.Wrap(err, "failed to parse device classes response")
+	}
+	return classes, nil
+}
+
+// SetDeviceSessionPolicy sets a device's class and session overrides,
+// signed with the device key
+func (isv *ISVContract) SetDeviceSessionPolicy(deviceID string, policy DeviceSessionPolicy, signature string) error {
+	policyJSON, err := json.Marshal(policy)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal session policy")
+	}
+
+	if _, err := isv.client.submit(isv.contract, "SetDeviceSessionPolicy", deviceID, string(policyJSON), signature); err != nil {
+		return errors.Wrap(err, "failed to set session policy with ISV")
+	}
+	return nil
+}
+
+// GetSessionPolicy returns the session policy in force for a device
+func (isv *ISVContract) GetSessionPolicy(deviceID string) (*SessionPolicy, error) {
+	responseBytes, err := isv.client.evaluate(isv.contract, "GetSessionPolicy", deviceID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get session policy from ISV")
+	}
+
+	var policy SessionPolicy
+	if err := json.Unmarshal(responseBytes, &policy); err != nil {
+		return nil, errors.Wrap(err, "failed to parse session policy response")
+	}
+	return &policy, nil
+}
+
+func parseDeviceClass(responseBytes []byte) (*DeviceClass, error) {
+	var class DeviceClass
+	if err := json.Unmarshal(responseBytes, &class); err != nil {
+		return nil, errors.Wrap(err, "failed to parse device class response")
+	}
+	return &class, nil
+}
@@ -0,0 +1,55 @@
+package fabric
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// RestrictSession shrinks the capability set of an active session. The
+// signature is made with the device key over the session ID and capabilities.
+func (isv *ISVContract) RestrictSession(sessionID string, capabilities []string, signature string) error {
+	capabilitiesJSON, err := json.Marshal(capabilities)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal capabilities")
+	}
+
+	if _, err := isv.client.submit(isv.contract, "RestrictSession", sessionID, string(capabilitiesJSON), signature); err != nil {
+		return errors.Wrap(err, "failed to restrict session with ISV")
+	}
+	return nil
+}
+
+// CheckSessionCapability reports whether an active session may use a capability
+func (isv *ISVContract) CheckSessionCapability(sessionID, capability string) (bool, error) {
+	responseBytes, err := isv.client.evaluate(isv.contract, "CheckSessionCapability", sessionID, capability)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to check session capability with ISV")
+	}
+
+	allowed, err := strconv.ParseBool(string(responseBytes))
+	if err != nil {
+		return false, errors.Wrap(err, "failed to parse session capability response")
+	}
+	return allowed, nil
+}
+
+// WatchSessionRestrictions subscribes to restrictions of a client's sessions.
+// The returned function cancels the subscription and closes the channel.
+func (isv *ISVContract) WatchSessionRestrictions(clientID string) (<-chan AccessLogEntry, func(), error) {
+	return isv.watchAccessEvents("^SessionRestricted$", func(entry AccessLogEntry) bool {
+		return entry.ClientID == clientID
+	})
+}
+
+// WatchSessionActivity subscribes to session changes and restrictions,
+// optionally only those of one client or device. The returned function
+// cancels the subscription and closes the channel.
+func (isv *ISVContract) WatchSessionActivity(clientID, deviceID string) (<-chan AccessLogEntry, func(), error) {
+	return isv.watchAccessEvents("^(AccessLogged|SessionRestricted)$", func(entry AccessLogEntry) bool {
+		return entry.SessionID != "" &&
+			(clientID == "" || entry.ClientID == clientID) &&
+			(deviceID == "" || entry.DeviceID == deviceID)
+	})
+}
@@ -0,0 +1,95 @@
+package fabric
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// SessionStream is a logical stream within a session, as recorded by the ISV
+type SessionStream struct {
+	SessionID    string    `json:"sessionID"`
+	StreamID     uint16    `json:"streamID"`
+	Name         string    `json:"name,omitempty"`
+	Capability   string    `json:"capability"`
+	Status       string    `json:"status"`
+	OpenedAt     time.Time `json:"openedAt"`
+	ClosedAt     time.Time `json:"closedAt,omitempty"`
+	Messages     int64     `json:"messages"`
+	Bytes        int64     `json:"bytes"`
+	Rejected     int64     `json:"rejected"`
+	LastActivity time.Time `json:"lastActivity,omitempty"`
+}
+
+// OpenSessionStream opens a stream in an active session. The signature is
+// made with the device key over OPEN_STREAM|<sessionID>|<streamID>|<name>|<capability>.
+func (isv *ISVContract) OpenSessionStream(sessionID string, streamID uint16, name, capability, signature string) (*SessionStream, error) {
+	responseBytes, err := isv.client.submit(isv.contract, "OpenSessionStream", sessionID, strconv.Itoa(int(streamID)), name, capability, signature)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open stream with ISV")
+	}
+	return parseSessionStream(responseBytes)
+}
+
+// CloseSessionStream closes a stream of a session. The signature is made
+// with the device key over CLOSE_STREAM|<sessionID>|<streamID>.
+func (isv *ISVContract) CloseSessionStream(sessionID string, streamID uint16, signature string) error {
+	if _, err := isv.client.submit(isv.contract, "CloseSessionStream", sessionID, strconv.Itoa(int(streamID)), signature); err != nil {
+		return errors.Wrap(err, "failed to close stream with ISV")
+	}
+	return nil
+}
+
+// ReportStreamCounters records the cumulative counters of an open stream.
+// The signature is made with the device key over
+// STREAM_COUNTERS|<sessionID>|<streamID>|<messages>|<bytes>|<rejected>.
+func (isv *ISVContract) ReportStreamCounters(sessionID string, streamID uint16, messages, bytes, rejected int64, signature string) (*SessionStream, error) {
+	responseBytes, err := isv.client.submit(isv.contract, "ReportStreamCounters", sessionID, strconv.Itoa(int(streamID)),
+		strconv.FormatInt(messages, 10), strconv.FormatInt(bytes, 10), strconv.FormatInt(rejected, 10), signature)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to report stream counters to ISV")
+	}
+	return parseSessionStream(responseBytes)
+}
+
+// CheckStreamCapability reports whether an open stream may carry traffic
+// under its session's current capabilities
+func (isv *ISVContract) CheckStreamCapability(sessionID string, streamID uint16) (bool, error) {
+	responseBytes, err := isv.client.evaluate(isv.contract, "CheckStreamCapability", sessionID, strconv.Itoa(int(streamID)))
+	if err != nil {
+		return false, errors.Wrap(err, "failed to check stream with ISV")
+	}
+
+	allowed, err := strconv.ParseBool(string(responseBytes))
+	if err != nil {
+		return false, errors.Wrap(err, "failed to parse stream check response")
+	}
+	return allowed, nil
+}
+
+// GetSessionStreams returns the streams of a session, open and closed
+func (isv *ISVContract) GetSessionStreams(sessionID string) ([]*SessionStream, error) {
+	responseBytes, err := isv.client.evaluate(isv.contract, "GetSessionStreams", sessionID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get session streams from ISV")
+	}
+
+	var streams []*SessionStream
+	if len(responseBytes) == 0 {
+		return streams, nil
+	}
+	if err := json.Unmarshal(responseBytes, &streams); err != nil {
+		return nil, errors.Wrap(err, "failed to parse session streams response")
+	}
+	return streams, nil
+}
+
+func parseSessionStream(responseBytes []byte) (*SessionStream, error) {
+	var stream SessionStream
+	if err := json.Unmarshal(responseBytes, &stream); err != nil {
+		return nil, errors.Wrap(err, "failed to parse stream response")
+	}
+	return &stream, nil
+}
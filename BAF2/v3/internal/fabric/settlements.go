@@ -0,0 +1,78 @@
+package fabric
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// SettlementEntry records a closed session in which one organization's
+// client used a device owned by another
+type SettlementEntry struct {
+	SessionID       string    `json:"sessionID"`
+	Period          string    `json:"period"`      // YYYY-MM the session ended in
+	ConsumerMSP     string    `json:"consumerMSP"` // Organization of the client
+	ProviderMSP     string    `json:"providerMSP"` // Organization owning the device
+	ClientID        string    `json:"clientID"`
+	DeviceID        string    `json:"deviceID"`
+	CapabilityClass string    `json:"capabilityClass"`
+	StartedAt       time.Time `json:"startedAt"`
+	EndedAt         time.Time `json:"endedAt"`
+	DurationSeconds int64     `json:"durationSeconds"`
+}
+
+// SettlementPage is one page of a period's settlement entries. Pass Bookmark
+// to the next call to continue; it is empty on the last page.
+type SettlementPage struct {
+	Entries  []SettlementEntry `json:"entries"`
+	Bookmark string            `json:"bookmark"`
+}
+
+// SettlementTotal aggregates a period's entries for one consumer, provider
+// and capability class
+type SettlementTotal struct {
+	ConsumerMSP     string `json:"consumerMSP"`
+	ProviderMSP     string `json:"providerMSP"`
+	CapabilityClass string `json:"capabilityClass"`
+	Sessions        int    `json:"sessions"`
+	DurationSeconds int64  `json:"durationSeconds"`
+}
+
+// SettlementSummary is the aggregation of a period's settlement entries
+type SettlementSummary struct {
+	Period string            `json:"period"`
+	Totals []SettlementTotal `json:"totals"`
+}
+
+// GetSettlements returns one page of a period's settlement entries.
+// consumerMSP may be empty for every consumer; pageSize 0 uses the chaincode
+// default.
+func (isv *ISVContract) GetSettlements(period, consumerMSP string, pageSize int32, bookmark string) (*SettlementPage, error) {
+	responseBytes, err := isv.client.evaluate(isv.contract, "GetSettlements", period, consumerMSP, strconv.FormatInt(int64(pageSize), 10), bookmark)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get settlements from ISV")
+	}
+
+	var page SettlementPage
+	if err := json.Unmarshal(responseBytes, &page); err != nil {
+		return nil, errors.Wrap(err, "failed to parse settlements response")
+	}
+	return &page, nil
+}
+
+// GetSettlementSummary aggregates a period's settlement entries per
+// consumer, provider and capability class
+func (isv *ISVContract) GetSettlementSummary(period, consumerMSP string) (*SettlementSummary, error) {
+	responseBytes, err := isv.client.evaluate(isv.contract, "GetSettlementSummary", period, consumerMSP)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get settlement summary from ISV")
+	}
+
+	var summary SettlementSummary
+	if err := json.Unmarshal(responseBytes, &summary); err != nil {
+		return nil, errors.Wrap(err, "failed to parse settlement summary response")
+	}
+	return &summary, nil
+}
@@ -0,0 +1,108 @@
+package fabric
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// PeerTask is work the AS assigns to a peer's worker
+type PeerTask struct {
+	TaskID     string    `json:"taskID"`
+	PeerID     string    `json:"peerID"`
+	TaskType   string    `json:"taskType"`
+	ClientID   string    `json:"clientID"`
+	AssignedAt time.Time `json:"assignedAt"`
+	Status     string    `json:"status"`
+	Attempts   int       `json:"attempts"`
+	ClaimedBy  string    `json:"claimedBy,omitempty"`
+	ClaimedAt  time.Time `json:"claimedAt,omitempty"`
+	FinishedAt time.Time `json:"finishedAt,omitempty"`
+	Result     string    `json:"result,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// AllocatePeerTask assigns a task for a client to a peer
+func (as *AuthServerContract) AllocatePeerTask(peerID, taskType, clientID string) error {
+	if _, err := as.client.submit(as.contract, "AllocatePeerTask", peerID, taskType, clientID); err != nil {
+		return errors.Wrap(err, "failed to allocate task with AS")
+	}
+	return nil
+}
+
+// GetPendingTasks lists the tasks a peer's worker may claim now
+func (as *AuthServerContract) GetPendingTasks(peerID string) ([]*PeerTask, error) {
+	responseBytes, err := as.client.evaluate(as.contract, "GetPendingTasks", peerID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get pending tasks from AS")
+	}
+
+	var tasks []*PeerTask
+	if err := json.Unmarshal(responseBytes, &tasks); err != nil {
+		return nil, errors.Wrap(err, "failed to parse pending tasks response")
+	}
+	return tasks, nil
+}
+
+// GetTask returns a task record
+func (as *AuthServerContract) GetTask(taskID string) (*PeerTask, error) {
+	responseBytes, err := as.client.evaluate(as.contract, "GetTask", taskID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get task from AS")
+	}
+	return parseTask(responseBytes)
+}
+
+// ClaimTask claims a pending task for a peer's worker
+func (as *AuthServerContract) ClaimTask(peerID, taskID string) (*PeerTask, error) {
+	responseBytes, err := as.client.submit(as.contract, "ClaimTask", peerID, taskID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to claim task with AS")
+	}
+	return parseTask(responseBytes)
+}
+
+// CompleteTask records the result of a claimed task
+func (as *AuthServerContract) CompleteTask(taskID, result string) (*PeerTask, error) {
+	responseBytes, err := as.client.submit(as.contract, "CompleteTask", taskID, result)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to complete task with AS")
+	}
+	return parseTask(responseBytes)
+}
+
+// FailTask records that a claimed task failed; the AS assigns it again
+// while it has attempts left
+func (as *AuthServerContract) FailTask(taskID, reason string) (*PeerTask, error) {
+	responseBytes, err := as.client.submit(as.contract, "FailTask", taskID, reason)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to fail task with AS")
+	}
+	return parseTask(responseBytes)
+}
+
+// CheckRegistrationValidity reports whether the TGS holds a valid
+// registration for a client
+func (tgs *TicketGrantingContract) CheckRegistrationValidity(clientID string) (bool, error) {
+	responseBytes, err := tgs.client.evaluate(tgs.contract, "CheckRegistrationValidity", clientID)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to check registration with TGS")
+	}
+
+	valid, err := strconv.ParseBool(strings.TrimSpace(string(responseBytes)))
+	if err != nil {
+		return false, errors.Wrap(err, "failed to parse registration validity response")
+	}
+	return valid, nil
+}
+
+func parseTask(responseBytes []byte) (*PeerTask, error) {
+	var task PeerTask
+	if err := json.Unmarshal(responseBytes, &task); err != nil {
+		return nil, errors.Wrap(err, "failed to parse task response")
+	}
+	return &task, nil
+}
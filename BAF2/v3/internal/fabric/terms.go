@@ -0,0 +1,105 @@
+package fabric
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// TermsPolicy is the notice the AS asks clients to acknowledge before they
+// authenticate
+type TermsPolicy struct {
+	Version                   string `json:"version"`
+	DocumentHash              string `json:"documentHash"` // Hex SHA-256 of the document
+	DocumentURL               string `json:"documentURL,omitempty"`
+	ReacknowledgeOnNewVersion bool   `json:"reacknowledgeOnNewVersion"`
+	UpdatedAt                 string `json:"updatedAt,omitempty"`
+}
+
+// TermsNotice is the notice sent with a nonce challenge to a client that
+// has yet to acknowledge it
+type TermsNotice struct {
+	Version      string `json:"version"`
+	DocumentHash string `json:"documentHash"`
+	DocumentURL  string `json:"documentURL,omitempty"`
+}
+
+// TermsAcknowledgement is the ledger record of a client accepting a notice
+type TermsAcknowledgement struct {
+	ClientID       string `json:"clientID"`
+	Version        string `json:"version"`
+	DocumentHash   string `json:"documentHash"`
+	Signature      string `json:"signature"`
+	AcknowledgedAt string `json:"acknowledgedAt"`
+	TxID           string `json:"txID"`
+}
+
+// TermsStatement is what a client signs to acknowledge a notice; the AS
+// checks the signature against the same statement
+func TermsStatement(clientID string, notice TermsNotice) []byte {
+	return []byte(fmt.Sprintf("%s:%s:%s", clientID, notice.Version, notice.DocumentHash))
+}
+
+// SetTermsPolicy stores the AS terms policy
+func (as *AuthServerContract) SetTermsPolicy(policyJSON string) error {
+	_, err := as.client.submit(as.contract, "SetTermsPolicy", policyJSON)
+	if err != nil {
+		return errors.Wrap(err, "failed to set terms policy with AS")
+	}
+
+	return nil
+}
+
+// GetTermsPolicy retrieves the AS terms policy, or nil if none is set
+func (as *AuthServerContract) GetTermsPolicy() (*TermsPolicy, error) {
+	responseBytes, err := as.client.evaluate(as.contract, "GetTermsPolicy")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get terms policy from AS")
+	}
+	if len(responseBytes) == 0 {
+		return nil, nil
+	}
+
+	var policy TermsPolicy
+	if err := json.Unmarshal(responseBytes, &policy); err != nil {
+		return nil, errors.Wrap(err, "failed to parse terms policy response")
+	}
+
+	return &policy, nil
+}
+
+// AcknowledgeTerms records a client's signed acknowledgement of a notice
+// version
+func (as *AuthServerContract) AcknowledgeTerms(clientID, version, signature string) (*TermsAcknowledgement, error) {
+	responseBytes, err := as.client.submit(as.contract, "AcknowledgeTerms", clientID, version, signature)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to acknowledge terms with AS")
+	}
+
+	var ack TermsAcknowledgement
+	if err := json.Unmarshal(responseBytes, &ack); err != nil {
+		return nil, errors.Wrap(err, "failed to parse terms acknowledgement response")
+	}
+
+	return &ack, nil
+}
+
+// GetTermsAcknowledgement retrieves a client's latest acknowledgement, or
+// nil if it has none
+func (as *AuthServerContract) GetTermsAcknowledgement(clientID string) (*TermsAcknowledgement, error) {
+	responseBytes, err := as.client.evaluate(as.contract, "GetTermsAcknowledgement", clientID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get terms acknowledgement from AS")
+	}
+	if len(responseBytes) == 0 {
+		return nil, nil
+	}
+
+	var ack TermsAcknowledgement
+	if err := json.Unmarshal(responseBytes, &ack); err != nil {
+		return nil, errors.Wrap(err, "failed to parse terms acknowledgement response")
+	}
+
+	return &ack, nil
+}
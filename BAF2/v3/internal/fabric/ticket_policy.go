@@ -0,0 +1,82 @@
+package fabric
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// TicketPolicy is what the AS issues TGTs under: the TGT lifetime and
+// renewal limit in seconds, how many TGTs a client may be issued a day
+// (zero for no limit) and the session key encryptions on offer
+type TicketPolicy struct {
+	TGTLifetime   int64    `json:"tgtLifetime,omitempty"`
+	MaxTGTRenewal int64    `json:"maxTGTRenewal,omitempty"`
+	MaxTGTsPerDay int      `json:"maxTGTsPerDay,omitempty"`
+	Encryptions   []string `json:"encryptions,omitempty"`
+}
+
+// TicketPolicyVersion is a ticket policy in the AS schedule
+type TicketPolicyVersion struct {
+	Version     int          `json:"version"`
+	Policy      TicketPolicy `json:"policy"`
+	EffectiveAt time.Time    `json:"effectiveAt"`
+	ScheduledBy string       `json:"scheduledBy"`
+	ScheduledAt time.Time    `json:"scheduledAt"`
+}
+
+// TicketPolicySchedule is the ticket policy in force, the one scheduled to
+// replace it and the one it replaced. A nil Active means the AS defaults.
+type TicketPolicySchedule struct {
+	Pending  *TicketPolicyVersion `json:"pending,omitempty"`
+	Active   *TicketPolicyVersion `json:"active,omitempty"`
+	Previous *TicketPolicyVersion `json:"previous,omitempty"`
+}
+
+// ScheduleTicketPolicy schedules a ticket policy to take effect at
+// effectiveAt
+func (as *AuthServerContract) ScheduleTicketPolicy(policyJSON string, effectiveAt time.Time) (*TicketPolicySchedule, error) {
+	responseBytes, err := as.client.submit(as.contract, "ScheduleTicketPolicy", policyJSON, strconv.FormatInt(effectiveAt.Unix(), 10))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to schedule ticket policy with AS")
+	}
+	return parseTicketPolicySchedule(responseBytes)
+}
+
+// RollbackTicketPolicy schedules the previous ticket policy to take effect
+// again at effectiveAt
+func (as *AuthServerContract) RollbackTicketPolicy(effectiveAt time.Time) (*TicketPolicySchedule, error) {
+	responseBytes, err := as.client.submit(as.contract, "RollbackTicketPolicy", strconv.FormatInt(effectiveAt.Unix(), 10))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to roll back ticket policy with AS")
+	}
+	return parseTicketPolicySchedule(responseBytes)
+}
+
+// AbortPendingTicketPolicy withdraws the pending ticket policy
+func (as *AuthServerContract) AbortPendingTicketPolicy() (*TicketPolicySchedule, error) {
+	responseBytes, err := as.client.submit(as.contract, "AbortPendingTicketPolicy")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to abort pending ticket policy with AS")
+	}
+	return parseTicketPolicySchedule(responseBytes)
+}
+
+// GetTicketPolicySchedule retrieves the AS ticket policy schedule
+func (as *AuthServerContract) GetTicketPolicySchedule() (*TicketPolicySchedule, error) {
+	responseBytes, err := as.client.evaluate(as.contract, "GetTicketPolicySchedule")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get ticket policy schedule from AS")
+	}
+	return parseTicketPolicySchedule(responseBytes)
+}
+
+func parseTicketPolicySchedule(responseBytes []byte) (*TicketPolicySchedule, error) {
+	var schedule TicketPolicySchedule
+	if err := json.Unmarshal(responseBytes, &schedule); err != nil {
+		return nil, errors.Wrap(err, "failed to parse ticket policy schedule response")
+	}
+	return &schedule, nil
+}
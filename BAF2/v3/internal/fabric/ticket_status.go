@@ -0,0 +1,59 @@
+package fabric
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// TicketStatus is the TGS record of an issued service ticket
+type TicketStatus struct {
+	ClientID            string    `json:"clientID"`
+	ServiceID           string    `json:"serviceID"`
+	Timestamp           time.Time `json:"timestamp"`
+	EncryptedTicketHash string    `json:"encryptedTicketHash"`
+	Status              string    `json:"status"`
+	RevokedAt           time.Time `json:"revokedAt,omitempty"`
+	ExpiresAt           time.Time `json:"expiresAt"`
+	Expired             bool      `json:"expired"`
+}
+
+// ErrTicketNotFound is returned by GetTicketStatus when the TGS has no
+// record of the ticket, e.g. because it was issued on another ledger
+var ErrTicketNotFound = errors.New("ticket not found on the ledger")
+
+// GetTicketStatus looks up a service ticket by the hex SHA-256 of its
+// encrypted form
+func (tgs *TicketGrantingContract) GetTicketStatus(clientID, encryptedTicketHash string) (*TicketStatus, error) {
+	responseBytes, err := tgs.client.evaluate(tgs.contract, "GetTicketStatus", clientID, encryptedTicketHash)
+	if err != nil {
+		if strings.Contains(err.Error(), "no issued ticket found") {
+			return nil, ErrTicketNotFound
+		}
+		return nil, errors.Wrap(err, "failed to get ticket status from TGS")
+	}
+
+	var status TicketStatus
+	if err := json.Unmarshal(responseBytes, &status); err != nil {
+		return nil, errors.Wrap(err, "failed to parse ticket status response")
+	}
+	return &status, nil
+}
+
+// CheckClientValidity reports whether the AS still considers a client
+// registered and valid
+func (as *AuthServerContract) CheckClientValidity(clientID string) (bool, error) {
+	responseBytes, err := as.client.evaluate(as.contract, "CheckClientValidity", clientID)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to check client validity with AS")
+	}
+
+	valid, err := strconv.ParseBool(strings.TrimSpace(string(responseBytes)))
+	if err != nil {
+		return false, errors.Wrap(err, "failed to parse client validity response")
+	}
+	return valid, nil
+}
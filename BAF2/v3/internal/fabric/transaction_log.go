@@ -0,0 +1,42 @@
+package fabric
+
+import "sync"
+
+// SubmittedTransaction is a transaction a client submitted
+type SubmittedTransaction struct {
+	Chaincode string `json:"chaincode"`
+	Function  string `json:"function"`
+	TxID      string `json:"txID,omitempty"` // Empty if the transaction failed before it got one
+	Error     string `json:"error,omitempty"`
+}
+
+// TransactionLog collects the transactions submitted by the clients sharing
+// it (ClientOptions.TransactionLog), in the order they were submitted. It is
+// safe for concurrent use.
+type TransactionLog struct {
+	mu           sync.Mutex
+	transactions []SubmittedTransaction
+}
+
+// NewTransactionLog returns an empty transaction log
+func NewTransactionLog() *TransactionLog {
+	return &TransactionLog{}
+}
+
+func (l *TransactionLog) record(chaincode, function, txID string, err error) {
+	transaction := SubmittedTransaction{Chaincode: chaincode, Function: function, TxID: txID}
+	if err != nil {
+		transaction.Error = err.Error()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.transactions = append(l.transactions, transaction)
+}
+
+// Transactions returns the transactions recorded so far
+func (l *TransactionLog) Transactions() []SubmittedTransaction {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]SubmittedTransaction(nil), l.transactions...)
+}
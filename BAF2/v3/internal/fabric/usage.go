@@ -0,0 +1,47 @@
+package fabric
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// UsageQuota is one limit a client counts against
+type UsageQuota struct {
+	Name      string `json:"name"`
+	Limit     int    `json:"limit"`
+	Used      int    `json:"used"`
+	Remaining int    `json:"remaining"`
+}
+
+// ClientUsageSummary is a client's ticket and session usage and how close
+// it is to the AS risk policy's limits
+type ClientUsageSummary struct {
+	ClientID       string        `json:"clientID"`
+	Valid          bool          `json:"valid"`
+	TicketsToday   int           `json:"ticketsToday"`
+	RevokedToday   int           `json:"revokedToday"`
+	ActiveSessions int           `json:"activeSessions"`
+	RecentFailures []time.Time   `json:"recentFailures"`
+	FailureWindow  int64         `json:"failureWindow"`
+	Quotas         []UsageQuota  `json:"quotas"`
+	StepUpPending  bool          `json:"stepUpPending"`
+	LastDecision   *RiskDecision `json:"lastDecision,omitempty"`
+	Unavailable    []string      `json:"unavailable,omitempty"`
+}
+
+// GetClientUsageSummary fetches a client's usage summary in one evaluate
+// call; the AS gathers the ticket and session counts from the TGS and ISV
+func (as *AuthServerContract) GetClientUsageSummary(clientID string) (*ClientUsageSummary, error) {
+	responseBytes, err := as.client.evaluate(as.contract, "GetClientUsageSummary", clientID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get usage summary from AS")
+	}
+
+	var summary ClientUsageSummary
+	if err := json.Unmarshal(responseBytes, &summary); err != nil {
+		return nil, errors.Wrap(err, "failed to parse usage summary response")
+	}
+	return &summary, nil
+}
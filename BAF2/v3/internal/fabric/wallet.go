@@ -19,35 +19,17 @@ const (
 
 var log = logger.Default()
 
-// Wallet represents an identity wallet for Fabric
+// Wallet represents an identity wallet for Fabric. Its identities live in
+// one of the wallet backends (see OpenWallet).
 type Wallet struct {
-	path   string
-	wallet *gateway.Wallet
+	backend  string
+	location string // backend and path, which tell wallets apart in the pool
+	store    walletStore
 }
 
 // NewWallet creates a new wallet instance
 func NewWallet(path string) (*Wallet, error) {
-	if path == "" {
-		path = WalletPath
-	}
-	
-	// Create wallet directory if it doesn't exist
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		if err := os.MkdirAll(path, 0755); err != nil {
-			return nil, errors.Wrap(err, "failed to create wallet directory")
-		}
-	}
-	
-	// Create new file system wallet
-	wallet, err := gateway.NewFileSystemWallet(path)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to create wallet")
-	}
-	
-	return &Wallet{
-		path:   path,
-		wallet: wallet,
-	}, nil
+	return OpenWallet(path, WalletOptions{})
 }
 
 // DefaultWallet returns a wallet at the default location
@@ -55,39 +37,39 @@ func DefaultWallet() (*Wallet, error) {
 	return NewWallet(WalletPath)
 }
 
+// Backend returns the wallet's backend
+func (w *Wallet) Backend() string {
+	return w.backend
+}
+
 // Exists checks if an identity exists in the wallet
 func (w *Wallet) Exists(label string) bool {
-	return w.wallet.Exists(label)
+	return w.store.Exists(label)
 }
 
 // Put adds an identity to the wallet
 func (w *Wallet) Put(label string, identity *gateway.X509Identity) error {
-	return w.wallet.Put(label, identity)
+	return w.store.Put(label, identity)
 }
 
-// Get retrieves an identity from the wallet
+// Get retrieves an identity from the wallet. Identities of the pkcs11
+// backend carry no private key, which stays in the token.
 func (w *Wallet) Get(label string) (*gateway.X509Identity, error) {
-	id, err := w.wallet.Get(label)
+	identity, err := w.store.Get(label)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to get identity from wallet")
 	}
-	
-	x509Identity, ok := id.(*gateway.X509Identity)
-	if !ok {
-		return nil, errors.New("identity is not an X509 identity")
-	}
-	
-	return x509Identity, nil
+	return identity, nil
 }
 
 // Remove removes an identity from the wallet
 func (w *Wallet) Remove(label string) error {
-	return w.wallet.Remove(label)
+	return w.store.Remove(label)
 }
 
 // List returns all identities in the wallet
 func (w *Wallet) List() ([]string, error) {
-	return w.wallet.List()
+	return w.store.List()
 }
 
 // ImportIdentity imports an identity from certificate and key files
@@ -108,7 +90,7 @@ func (w *Wallet) ImportIdentity(label, mspID, certPath, keyPath string) error {
 	identity := gateway.NewX509Identity(mspID, string(cert), string(key))
 	
 	// Add to wallet
-	return w.wallet.Put(label, identity)
+	return w.Put(label, identity)
 }
 
 // SearchAndImport searches common locations for certificates and imports them
@@ -0,0 +1,234 @@
+package fabric
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/gateway"
+	"github.com/pkg/errors"
+)
+
+// Wallet backends
+const (
+	WalletBackendFile      = "file"      // plaintext identity files, as written by fabric-sdk-go
+	WalletBackendEncrypted = "encrypted" // identity files encrypted with a passphrase
+	WalletBackendPKCS11    = "pkcs11"    // certificates on disk, private keys in a PKCS#11 token
+	WalletBackendMemory    = "memory"    // identities held in this process only
+)
+
+// Environment variables the wallet secrets are read from before asking
+// WalletOptions.Prompt
+const (
+	WalletPassphraseEnv = "AUTHCLI_WALLET_PASSPHRASE"
+	PKCS11PINEnv        = "AUTHCLI_PKCS11_PIN"
+)
+
+// WalletOptions selects and configures a wallet backend
+type WalletOptions struct {
+	// Backend is one of the WalletBackend constants (default: file)
+	Backend string
+
+	// PKCS11Library is the PKCS#11 module of the HSM, e.g.
+	// /usr/lib/softhsm/libsofthsm2.so, and PKCS11Token the label of the
+	// token holding the keys
+	PKCS11Library string
+	PKCS11Token   string
+
+	// Prompt asks the user for a secret (the encrypted wallet's passphrase
+	// or the token's PIN) that is not in its environment variable. Without
+	// it, a missing secret is an error.
+	Prompt func(prompt string) ([]byte, error)
+}
+
+// walletStore is where a Wallet keeps its identities
+type walletStore interface {
+	Put(label string, identity *gateway.X509Identity) error
+	Get(label string) (*gateway.X509Identity, error)
+	Exists(label string) bool
+	Remove(label string) error
+	List() ([]string, error)
+}
+
+// signingStore is a walletStore whose private keys never leave it. The
+// identities it returns carry no key; it signs digests itself.
+type signingStore interface {
+	walletStore
+	sign(label string, digest []byte) ([]byte, error)
+}
+
+// Wallets of the memory, encrypted and pkcs11 backends are opened once per
+// process and path: memory wallets so that clients of one process share
+// their identities, the others so that the passphrase or PIN is asked for
+// and the key derived or token logged in to only once.
+var (
+	sharedWalletsMu sync.Mutex
+	sharedWallets   = make(map[string]*Wallet)
+)
+
+// OpenWallet opens the wallet at path with the backend of options. The
+// file backend is the fabric-sdk-go file system wallet NewWallet has always
+// opened; the memory backend starts empty and ignores path beyond telling
+// wallets apart.
+func OpenWallet(path string, options WalletOptions) (*Wallet, error) {
+	if path == "" {
+		path = WalletPath
+	}
+	backend := options.Backend
+	if backend == "" {
+		backend = WalletBackendFile
+	}
+
+	if backend == WalletBackendFile {
+		store, err := openFileWalletStore(path)
+		if err != nil {
+			return nil, err
+		}
+		return &Wallet{backend: backend, location: backend + ":" + path, store: store}, nil
+	}
+
+	if backend != WalletBackendMemory {
+		if abs, err := filepath.Abs(path); err == nil {
+			path = abs
+		}
+	}
+	location := backend + ":" + path
+	if backend == WalletBackendPKCS11 {
+		location += ":" + options.PKCS11Library + ":" + options.PKCS11Token
+	}
+
+	sharedWalletsMu.Lock()
+	defer sharedWalletsMu.Unlock()
+	if wallet, ok := sharedWallets[location]; ok {
+		return wallet, nil
+	}
+
+	var store walletStore
+	var err error
+	switch backend {
+	case WalletBackendMemory:
+		store = &sdkWalletStore{wallet: gateway.NewInMemoryWallet()}
+	case WalletBackendEncrypted:
+		store, err = openEncryptedWalletStore(path, options)
+	case WalletBackendPKCS11:
+		store, err = openPKCS11WalletStore(path, options)
+	default:
+		return nil, errors.Errorf("unknown wallet backend %q (expected %s, %s, %s or %s)",
+			backend, WalletBackendFile, WalletBackendEncrypted, WalletBackendPKCS11, WalletBackendMemory)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	wallet := &Wallet{backend: backend, location: location, store: store}
+	sharedWallets[location] = wallet
+	return wallet, nil
+}
+
+// walletSecret reads a secret from the environment variable env, or asks
+// for it
+func walletSecret(env, prompt string, options WalletOptions) ([]byte, error) {
+	if secret := os.Getenv(env); secret != "" {
+		return []byte(secret), nil
+	}
+	if options.Prompt == nil {
+		return nil, errors.Errorf("%s is not set", env)
+	}
+	secret, err := options.Prompt(prompt)
+	if err != nil {
+		return nil, err
+	}
+	if len(secret) == 0 {
+		return nil, errors.New("no secret given")
+	}
+	return secret, nil
+}
+
+// sdkWalletStore is a fabric-sdk-go wallet, backing the file and memory
+// backends
+type sdkWalletStore struct {
+	wallet *gateway.Wallet
+}
+
+func openFileWalletStore(path string) (*sdkWalletStore, error) {
+	// Create wallet directory if it doesn't exist
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if err := os.MkdirAll(path, 0755); err != nil {
+			return nil, errors.Wrap(err, "failed to create wallet directory")
+		}
+	}
+
+	// Create new file system wallet
+	wallet, err := gateway.NewFileSystemWallet(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create wallet")
+	}
+	return &sdkWalletStore{wallet: wallet}, nil
+}
+
+func (s *sdkWalletStore) Put(label string, identity *gateway.X509Identity) error {
+	return s.wallet.Put(label, identity)
+}
+
+func (s *sdkWalletStore) Get(label string) (*gateway.X509Identity, error) {
+	id, err := s.wallet.Get(label)
+	if err != nil {
+		return nil, err
+	}
+	x509Identity, ok := id.(*gateway.X509Identity)
+	if !ok {
+		return nil, errors.New("identity is not an X509 identity")
+	}
+	return x509Identity, nil
+}
+
+func (s *sdkWalletStore) Exists(label string) bool {
+	return s.wallet.Exists(label)
+}
+
+func (s *sdkWalletStore) Remove(label string) error {
+	return s.wallet.Remove(label)
+}
+
+func (s *sdkWalletStore) List() ([]string, error) {
+	return s.wallet.List()
+}
+
+// sdkWallet returns a fabric-sdk-go wallet holding the identity label, for
+// gateway.WithIdentity. fabric-sdk-go signs with keys it holds
+// in memory, so an identity whose key is in a token cannot connect with it.
+func (w *Wallet) sdkWallet(label string) (*gateway.Wallet, error) {
+	if store, ok := w.store.(*sdkWalletStore); ok {
+		return store.wallet, nil
+	}
+	if _, ok := w.store.(signingStore); ok {
+		return nil, errors.Errorf("the %s wallet keeps private keys in the token; connect with the %s Fabric API", w.backend, APIGateway)
+	}
+
+	identity, err := w.Get(label)
+	if err != nil {
+		return nil, err
+	}
+	wallet := gateway.NewInMemoryWallet()
+	if err := wallet.Put(label, identity); err != nil {
+		return nil, err
+	}
+	return wallet, nil
+}
+
+// signer returns the function that signs digests for identity label if
+// the wallet's backend signs itself, or nil if the identity carries its
+// private key
+func (w *Wallet) signer(label string) func(digest []byte) ([]byte, error) {
+	store, ok := w.store.(signingStore)
+	if !ok {
+		return nil
+	}
+	return func(digest []byte) ([]byte, error) {
+		signature, err := store.sign(label, digest)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to sign as %s", label)
+		}
+		return signature, nil
+	}
+}
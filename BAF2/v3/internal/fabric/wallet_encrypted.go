@@ -0,0 +1,257 @@
+package fabric
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/gateway"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/scrypt"
+)
+
+// The encrypted backend keeps each identity in <label>.id.enc, sealed with
+// AES-256-GCM under a key derived from the passphrase with scrypt. The salt
+// and the scrypt parameters are in encryptedWalletHeader, together with a
+// sealed check value, so a wrong passphrase is reported when the wallet is
+// opened rather than as a corrupt identity later. The label is authenticated
+// with each identity, so identity files cannot be swapped between labels.
+const (
+	encryptedWalletHeader = "wallet.enc.json"
+	encryptedIdentityExt  = ".id.enc"
+	encryptedWalletCheck  = "authcli encrypted wallet"
+
+	// scrypt parameters of new wallets, as recommended for interactive
+	// logins in 2017; existing wallets keep those in their header
+	encryptedWalletScryptN = 1 << 15
+	encryptedWalletScryptR = 8
+	encryptedWalletScryptP = 1
+)
+
+// encryptedWalletParams is the header of an encrypted wallet
+type encryptedWalletParams struct {
+	Version int    `json:"version"`
+	KDF     string `json:"kdf"`
+	N       int    `json:"n"`
+	R       int    `json:"r"`
+	P       int    `json:"p"`
+	Salt    []byte `json:"salt"`
+	Check   []byte `json:"check"` // encryptedWalletCheck, sealed
+}
+
+// walletRecord is an identity as the encrypted and pkcs11 backends store it
+type walletRecord struct {
+	MspID       string `json:"mspId"`
+	Certificate string `json:"certificate"`
+	Key         string `json:"key,omitempty"`
+}
+
+func newWalletRecord(identity *gateway.X509Identity) walletRecord {
+	return walletRecord{MspID: identity.MspID, Certificate: identity.Certificate(), Key: identity.Key()}
+}
+
+func (r walletRecord) identity() *gateway.X509Identity {
+	return gateway.NewX509Identity(r.MspID, r.Certificate, r.Key)
+}
+
+// walletFile returns the file of identity label in dir
+func walletFile(dir, label, ext string) (string, error) {
+	if label == "" || label != filepath.Base(label) || strings.HasPrefix(label, ".") {
+		return "", errors.Errorf("invalid identity label %q", label)
+	}
+	return filepath.Join(dir, label+ext), nil
+}
+
+// writeWalletFile replaces a wallet file atomically, readable by the owner
+// only
+func writeWalletFile(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// listWalletFiles returns the labels of the identity files in dir
+func listWalletFiles(dir, ext string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*"+ext))
+	if err != nil {
+		return nil, err
+	}
+	labels := make([]string, 0, len(files))
+	for _, file := range files {
+		labels = append(labels, strings.TrimSuffix(filepath.Base(file), ext))
+	}
+	return labels, nil
+}
+
+type encryptedWalletStore struct {
+	dir  string
+	aead cipher.AEAD
+
+	mu sync.Mutex
+}
+
+// openEncryptedWalletStore opens the encrypted wallet in dir, creating it
+// with a new salt if it has no header yet
+func openEncryptedWalletStore(dir string, options WalletOptions) (*encryptedWalletStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, errors.Wrap(err, "failed to create wallet directory")
+	}
+	passphrase, err := walletSecret(WalletPassphraseEnv, "Wallet passphrase: ", options)
+	if err != nil {
+		return nil, errors.Wrap(err, "encrypted wallet needs a passphrase")
+	}
+
+	headerPath := filepath.Join(dir, encryptedWalletHeader)
+	var params encryptedWalletParams
+	data, err := ioutil.ReadFile(headerPath)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, &params); err != nil {
+			return nil, errors.Wrapf(err, "failed to read %s", headerPath)
+		}
+		if params.Version != 1 || params.KDF != "scrypt" {
+			return nil, errors.Errorf("unsupported encrypted wallet version %d (%s)", params.Version, params.KDF)
+		}
+	case os.IsNotExist(err):
+		params = encryptedWalletParams{
+			Version: 1,
+			KDF:     "scrypt",
+			N:       encryptedWalletScryptN,
+			R:       encryptedWalletScryptR,
+			P:       encryptedWalletScryptP,
+			Salt:    make([]byte, 16),
+		}
+		if _, err := rand.Read(params.Salt); err != nil {
+			return nil, errors.Wrap(err, "failed to generate wallet salt")
+		}
+	default:
+		return nil, errors.Wrapf(err, "failed to read %s", headerPath)
+	}
+
+	key, err := scrypt.Key(passphrase, params.Salt, params.N, params.R, params.P, 32)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to derive wallet key")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	store := &encryptedWalletStore{dir: dir, aead: aead}
+
+	if params.Check != nil {
+		check, err := store.open(params.Check, encryptedWalletHeader)
+		if err != nil || string(check) != encryptedWalletCheck {
+			return nil, errors.Errorf("wrong passphrase for encrypted wallet %s", dir)
+		}
+		return store, nil
+	}
+
+	if params.Check, err = store.seal([]byte(encryptedWalletCheck), encryptedWalletHeader); err != nil {
+		return nil, err
+	}
+	data, err = json.MarshalIndent(params, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := writeWalletFile(headerPath, data); err != nil {
+		return nil, errors.Wrap(err, "failed to create encrypted wallet")
+	}
+	return store, nil
+}
+
+// seal encrypts plaintext, authenticating label with it; the nonce is
+// prepended to the result
+func (s *encryptedWalletStore) seal(plaintext []byte, label string) ([]byte, error) {
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, errors.Wrap(err, "failed to generate nonce")
+	}
+	return s.aead.Seal(nonce, nonce, plaintext, []byte(label)), nil
+}
+
+func (s *encryptedWalletStore) open(sealed []byte, label string) ([]byte, error) {
+	if len(sealed) < s.aead.NonceSize() {
+		return nil, errors.New("sealed data is too short")
+	}
+	nonce, ciphertext := sealed[:s.aead.NonceSize()], sealed[s.aead.NonceSize():]
+	return s.aead.Open(nil, nonce, ciphertext, []byte(label))
+}
+
+func (s *encryptedWalletStore) Put(label string, identity *gateway.X509Identity) error {
+	path, err := walletFile(s.dir, label, encryptedIdentityExt)
+	if err != nil {
+		return err
+	}
+	plaintext, err := json.Marshal(newWalletRecord(identity))
+	if err != nil {
+		return err
+	}
+	sealed, err := s.seal(plaintext, label)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return writeWalletFile(path, sealed)
+}
+
+func (s *encryptedWalletStore) Get(label string) (*gateway.X509Identity, error) {
+	path, err := walletFile(s.dir, label, encryptedIdentityExt)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := s.open(sealed, label)
+	if err != nil {
+		return nil, errors.Errorf("identity %s cannot be decrypted", label)
+	}
+	var record walletRecord
+	if err := json.Unmarshal(plaintext, &record); err != nil {
+		return nil, errors.Wrapf(err, "failed to read identity %s", label)
+	}
+	return record.identity(), nil
+}
+
+func (s *encryptedWalletStore) Exists(label string) bool {
+	path, err := walletFile(s.dir, label, encryptedIdentityExt)
+	return err == nil && fileExists(path)
+}
+
+func (s *encryptedWalletStore) Remove(label string) error {
+	path, err := walletFile(s.dir, label, encryptedIdentityExt)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (s *encryptedWalletStore) List() ([]string, error) {
+	return listWalletFiles(s.dir, encryptedIdentityExt)
+}
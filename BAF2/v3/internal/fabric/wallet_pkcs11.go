@@ -0,0 +1,298 @@
+//go:build cgo
+
+package fabric
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"sync"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/gateway"
+	"github.com/miekg/pkcs11"
+	"github.com/pkg/errors"
+)
+
+// The pkcs11 backend keeps each identity's certificate in <label>.p11.json
+// and its private key in the token. Keys are found by their CKA_ID, the
+// SKI of the certificate's public key (SHA-256 of the uncompressed point),
+// as Fabric's PKCS#11 BCCSP stores them, so keys generated in the token by
+// fabric-ca-client are found as well as those Put imports. Put imports a
+// key it is given as sensitive and non-extractable; Remove leaves keys in
+// the token.
+const pkcs11IdentityExt = ".p11.json"
+
+// pkcs11Curves are the curves Fabric identities use, with their OIDs
+var pkcs11Curves = map[elliptic.Curve]asn1.ObjectIdentifier{
+	elliptic.P256(): {1, 2, 840, 10045, 3, 1, 7},
+	elliptic.P384(): {1, 3, 132, 0, 34},
+}
+
+type pkcs11WalletStore struct {
+	dir string
+
+	// PKCS#11 sessions are not safe for concurrent use
+	mu      sync.Mutex
+	ctx     *pkcs11.Ctx
+	session pkcs11.SessionHandle
+}
+
+// openPKCS11WalletStore loads the PKCS#11 module and logs in to the token
+// labelled options.PKCS11Token with the PIN from PKCS11PINEnv or the
+// prompt. The session stays open for the life of the process.
+func openPKCS11WalletStore(dir string, options WalletOptions) (walletStore, error) {
+	if options.PKCS11Library == "" || options.PKCS11Token == "" {
+		return nil, errors.New("the pkcs11 wallet needs a PKCS#11 library and token label")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, errors.Wrap(err, "failed to create wallet directory")
+	}
+
+	ctx := pkcs11.New(options.PKCS11Library)
+	if ctx == nil {
+		return nil, errors.Errorf("failed to load PKCS#11 library %s", options.PKCS11Library)
+	}
+	if err := ctx.Initialize(); err != nil {
+		ctx.Destroy()
+		return nil, errors.Wrap(err, "failed to initialize PKCS#11 library")
+	}
+	fail := func(err error, message string) (walletStore, error) {
+		ctx.Finalize()
+		ctx.Destroy()
+		return nil, errors.Wrap(err, message)
+	}
+
+	slots, err := ctx.GetSlotList(true)
+	if err != nil {
+		return fail(err, "failed to list PKCS#11 slots")
+	}
+	var slot uint
+	found := false
+	for _, s := range slots {
+		info, err := ctx.GetTokenInfo(s)
+		if err == nil && info.Label == options.PKCS11Token {
+			slot, found = s, true
+			break
+		}
+	}
+	if !found {
+		return fail(errors.Errorf("no token labelled %q", options.PKCS11Token), "failed to find PKCS#11 token")
+	}
+
+	session, err := ctx.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION|pkcs11.CKF_RW_SESSION)
+	if err != nil {
+		return fail(err, "failed to open PKCS#11 session")
+	}
+	pin, err := walletSecret(PKCS11PINEnv, "PIN for token "+options.PKCS11Token+": ", options)
+	if err != nil {
+		return fail(err, "the pkcs11 wallet needs the token's PIN")
+	}
+	if err := ctx.Login(session, pkcs11.CKU_USER, string(pin)); err != nil && err != pkcs11.Error(pkcs11.CKR_USER_ALREADY_LOGGED_IN) {
+		return fail(err, "failed to log in to PKCS#11 token")
+	}
+	return &pkcs11WalletStore{dir: dir, ctx: ctx, session: session}, nil
+}
+
+// ecdsaPublicKey returns the ECDSA public key of a PEM certificate
+func ecdsaPublicKey(certificatePEM string) (*ecdsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(certificatePEM))
+	if block == nil {
+		return nil, errors.New("certificate is not PEM")
+	}
+	certificate, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse certificate")
+	}
+	publicKey, ok := certificate.PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, errors.New("the pkcs11 wallet only holds ECDSA identities")
+	}
+	return publicKey, nil
+}
+
+// ski is the subject key identifier Fabric's BCCSP gives an ECDSA key
+func ski(publicKey *ecdsa.PublicKey) []byte {
+	hash := sha256.Sum256(elliptic.Marshal(publicKey.Curve, publicKey.X, publicKey.Y))
+	return hash[:]
+}
+
+func (s *pkcs11WalletStore) Put(label string, identity *gateway.X509Identity) error {
+	path, err := walletFile(s.dir, label, pkcs11IdentityExt)
+	if err != nil {
+		return err
+	}
+	publicKey, err := ecdsaPublicKey(identity.Certificate())
+	if err != nil {
+		return err
+	}
+	if identity.Key() != "" {
+		if err := s.importKey(label, identity.Key(), publicKey); err != nil {
+			return err
+		}
+	}
+
+	record := newWalletRecord(identity)
+	record.Key = ""
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeWalletFile(path, data)
+}
+
+// importKey stores a PEM private key in the token unless a key with its
+// SKI is already there
+func (s *pkcs11WalletStore) importKey(label, keyPEM string, publicKey *ecdsa.PublicKey) error {
+	block, _ := pem.Decode([]byte(keyPEM))
+	if block == nil {
+		return errors.New("private key is not PEM")
+	}
+	var privateKey *ecdsa.PrivateKey
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		ecKey, ok := key.(*ecdsa.PrivateKey)
+		if !ok {
+			return errors.New("the pkcs11 wallet only holds ECDSA identities")
+		}
+		privateKey = ecKey
+	} else if privateKey, err = x509.ParseECPrivateKey(block.Bytes); err != nil {
+		return errors.Wrap(err, "failed to parse private key")
+	}
+	if privateKey.X.Cmp(publicKey.X) != 0 || privateKey.Y.Cmp(publicKey.Y) != 0 {
+		return errors.New("private key does not match the certificate")
+	}
+	oid, ok := pkcs11Curves[privateKey.Curve]
+	if !ok {
+		return errors.Errorf("unsupported curve %s", privateKey.Curve.Params().Name)
+	}
+	params, err := asn1.Marshal(oid)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := ski(publicKey)
+	if _, err := s.findKey(id); err == nil {
+		return nil
+	}
+	_, err = s.ctx.CreateObject(s.session, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_PRIVATE_KEY),
+		pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, pkcs11.CKK_EC),
+		pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+		pkcs11.NewAttribute(pkcs11.CKA_PRIVATE, true),
+		pkcs11.NewAttribute(pkcs11.CKA_SENSITIVE, true),
+		pkcs11.NewAttribute(pkcs11.CKA_EXTRACTABLE, false),
+		pkcs11.NewAttribute(pkcs11.CKA_SIGN, true),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, label),
+		pkcs11.NewAttribute(pkcs11.CKA_ID, id),
+		pkcs11.NewAttribute(pkcs11.CKA_EC_PARAMS, params),
+		pkcs11.NewAttribute(pkcs11.CKA_VALUE, privateKey.D.FillBytes(make([]byte, (privateKey.Curve.Params().BitSize+7)/8))),
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to import private key into the token")
+	}
+	return nil
+}
+
+// findKey returns the private key with CKA_ID id; s.mu must be held
+func (s *pkcs11WalletStore) findKey(id []byte) (pkcs11.ObjectHandle, error) {
+	template := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_PRIVATE_KEY),
+		pkcs11.NewAttribute(pkcs11.CKA_ID, id),
+	}
+	if err := s.ctx.FindObjectsInit(s.session, template); err != nil {
+		return 0, err
+	}
+	objects, _, err := s.ctx.FindObjects(s.session, 1)
+	if finalErr := s.ctx.FindObjectsFinal(s.session); err == nil {
+		err = finalErr
+	}
+	if err != nil {
+		return 0, err
+	}
+	if len(objects) == 0 {
+		return 0, errors.New("private key not found in the token")
+	}
+	return objects[0], nil
+}
+
+// sign signs digest with the token key of identity label, returning a
+// DER signature with low S, as Fabric requires
+func (s *pkcs11WalletStore) sign(label string, digest []byte) ([]byte, error) {
+	identity, err := s.Get(label)
+	if err != nil {
+		return nil, err
+	}
+	publicKey, err := ecdsaPublicKey(identity.Certificate())
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	key, err := s.findKey(ski(publicKey))
+	if err == nil {
+		err = s.ctx.SignInit(s.session, []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_ECDSA, nil)}, key)
+	}
+	var signature []byte
+	if err == nil {
+		signature, err = s.ctx.Sign(s.session, digest)
+	}
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if len(signature) == 0 || len(signature)%2 != 0 {
+		return nil, errors.New("token returned a malformed signature")
+	}
+
+	r := new(big.Int).SetBytes(signature[:len(signature)/2])
+	sValue := new(big.Int).SetBytes(signature[len(signature)/2:])
+	order := publicKey.Curve.Params().N
+	if sValue.Cmp(new(big.Int).Rsh(order, 1)) > 0 {
+		sValue.Sub(order, sValue)
+	}
+	return asn1.Marshal(struct{ R, S *big.Int }{r, sValue})
+}
+
+func (s *pkcs11WalletStore) Get(label string) (*gateway.X509Identity, error) {
+	path, err := walletFile(s.dir, label, pkcs11IdentityExt)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var record walletRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, errors.Wrapf(err, "failed to read identity %s", label)
+	}
+	return record.identity(), nil
+}
+
+func (s *pkcs11WalletStore) Exists(label string) bool {
+	path, err := walletFile(s.dir, label, pkcs11IdentityExt)
+	return err == nil && fileExists(path)
+}
+
+func (s *pkcs11WalletStore) Remove(label string) error {
+	path, err := walletFile(s.dir, label, pkcs11IdentityExt)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (s *pkcs11WalletStore) List() ([]string, error) {
+	return listWalletFiles(s.dir, pkcs11IdentityExt)
+}
@@ -0,0 +1,11 @@
+//go:build !cgo
+
+package fabric
+
+import "github.com/pkg/errors"
+
+// openPKCS11WalletStore fails: github.com/miekg/pkcs11 loads the token's
+// module through cgo, so builds with CGO_ENABLED=0 leave it out
+func openPKCS11WalletStore(dir string, options WalletOptions) (walletStore, error) {
+	return nil, errors.Errorf("the %s wallet is not built in; rebuild with CGO_ENABLED=1", WalletBackendPKCS11)
+}
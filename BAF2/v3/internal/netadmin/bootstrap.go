@@ -0,0 +1,494 @@
+package netadmin
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/chaichis-network/v3/internal/auth"
+	"github.com/chaichis-network/v3/internal/ccpackage"
+	"github.com/chaichis-network/v3/internal/fabric"
+	"github.com/chaichis-network/v3/pkg/logger"
+	"github.com/pkg/errors"
+)
+
+var log = logger.Default()
+
+// channelCreationTimeout is how long to wait for the orderer to serve a
+// new channel's genesis block
+const channelCreationTimeout = 30 * time.Second
+
+// Bootstrap brings up the network of a plan as the admins of its
+// organizations
+type Bootstrap struct {
+	plan            *Plan
+	configPath      string
+	ageIdentityFile string
+	admins          []fabric.OrgAdmin
+	network         *fabric.NetworkAdmin
+
+	// firstDeployed are the chaincodes this bootstrap committed the first
+	// definition of; only they get their Init
+	firstDeployed map[string]bool
+}
+
+// New connects to the network in the connection profile at configPath as
+// the admins of the plan's organizations
+func New(plan *Plan, configPath, ageIdentityFile string) (*Bootstrap, error) {
+	admins, err := plan.admins()
+	if err != nil {
+		return nil, err
+	}
+	network, err := fabric.NewNetworkAdmin(configPath, ageIdentityFile, admins)
+	if err != nil {
+		return nil, err
+	}
+	return &Bootstrap{
+		plan:            plan,
+		configPath:      configPath,
+		ageIdentityFile: ageIdentityFile,
+		admins:          admins,
+		network:         network,
+		firstDeployed:   make(map[string]bool),
+	}, nil
+}
+
+// Close disconnects from the network
+func (b *Bootstrap) Close() {
+	b.network.Close()
+}
+
+// Run creates the channel, deploys the chaincodes and initializes them
+func (b *Bootstrap) Run() error {
+	if err := b.Channel(); err != nil {
+		return err
+	}
+	if err := b.Deploy(); err != nil {
+		return err
+	}
+	return b.Initialize(nil)
+}
+
+// Channel creates the channel unless the orderer has it, joins every peer
+// that has not joined it and, if it created the channel, updates the
+// organizations' anchor peers
+func (b *Bootstrap) Channel() error {
+	plan := b.plan
+	first := plan.Orgs[0].Name
+	exists, err := b.network.ChannelExists(first, plan.Channel, plan.Orderer)
+	if err != nil {
+		return err
+	}
+
+	created := false
+	if exists {
+		log.Infof("Channel %s exists", plan.Channel)
+	} else {
+		if plan.ChannelTx == "" {
+			return errors.Errorf("channel %s does not exist and the plan has no channelTx", plan.Channel)
+		}
+		signers := make([]string, 0, len(plan.Orgs))
+		for _, org := range plan.Orgs {
+			signers = append(signers, org.Name)
+		}
+		if err := b.network.CreateChannel(first, plan.Channel, plan.ChannelTx, plan.Orderer, signers); err != nil {
+			return err
+		}
+		if err := b.waitForChannel(first); err != nil {
+			return err
+		}
+		log.Infof("Channel %s created", plan.Channel)
+		created = true
+	}
+
+	for _, org := range plan.Orgs {
+		var missing []string
+		for _, peer := range org.Peers {
+			joined, err := b.network.JoinedChannel(org.Name, peer, plan.Channel)
+			if err != nil {
+				return err
+			}
+			if !joined {
+				missing = append(missing, peer)
+			}
+		}
+		if len(missing) == 0 {
+			continue
+		}
+		if err := b.network.JoinChannel(org.Name, plan.Channel, plan.Orderer, missing); err != nil {
+			return err
+		}
+		log.Infof("%d peer(s) of %s joined %s", len(missing), org.Name, plan.Channel)
+	}
+
+	// An anchor peer update cannot be told apart from one already applied
+	// without decoding the channel config, so it is only sent to a channel
+	// this bootstrap created
+	if !created {
+		return nil
+	}
+	for _, org := range plan.Orgs {
+		if org.AnchorPeersTx == "" {
+			continue
+		}
+		if err := b.network.UpdateAnchorPeers(org.Name, plan.Channel, org.AnchorPeersTx, plan.Orderer); err != nil {
+			return err
+		}
+		log.Infof("Anchor peers of %s updated", org.Name)
+	}
+	return nil
+}
+
+// waitForChannel waits until the orderer serves a new channel
+func (b *Bootstrap) waitForChannel(org string) error {
+	deadline := time.Now().Add(channelCreationTimeout)
+	for {
+		exists, err := b.network.ChannelExists(org, b.plan.Channel, b.plan.Orderer)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return errors.Errorf("channel %s was not created within %s", b.plan.Channel, channelCreationTimeout)
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// Deploy installs each chaincode's package from the manifest on every peer
+// and, unless the committed definition already runs that package at the
+// planned version, approves it for every organization at the next sequence
+// and commits it
+func (b *Bootstrap) Deploy() error {
+	if len(b.plan.Chaincodes) == 0 {
+		return nil
+	}
+	manifest, err := ccpackage.LoadManifest(b.plan.Manifest)
+	if err != nil {
+		return err
+	}
+	for _, chaincode := range b.plan.Chaincodes {
+		if err := b.deploy(manifest, chaincode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *Bootstrap) deploy(manifest *ccpackage.Manifest, chaincode Chaincode) error {
+	plan := b.plan
+	entry := manifest.Find(chaincode.Name)
+	if entry == nil {
+		return errors.Errorf("%s is not in manifest %s", chaincode.Name, plan.Manifest)
+	}
+	if err := entry.CheckPackageFile(plan.Manifest); err != nil {
+		return errors.Wrapf(err, "package of %s", chaincode.Name)
+	}
+	pkg, err := ioutil.ReadFile(filepath.Join(filepath.Dir(plan.Manifest), entry.PackageFile))
+	if err != nil {
+		return errors.Wrap(err, "failed to read package")
+	}
+	var collections []byte
+	if chaincode.CollectionsConfig != "" {
+		if collections, err = ioutil.ReadFile(chaincode.CollectionsConfig); err != nil {
+			return errors.Wrap(err, "failed to read collections config")
+		}
+	}
+
+	for _, org := range plan.Orgs {
+		if err := b.network.InstallChaincode(org.Name, entry.Label, entry.PackageID, pkg, org.Peers); err != nil {
+			return err
+		}
+	}
+
+	first := plan.Orgs[0]
+	committed, err := b.network.CommittedChaincode(first.Name, first.Peers[0], plan.Channel, chaincode.Name)
+	if err != nil {
+		return err
+	}
+	sequence := int64(1)
+	if committed != nil {
+		approved, err := b.network.ApprovedPackageID(first.Name, first.Peers[0], plan.Channel, chaincode.Name, committed.Sequence)
+		if err != nil {
+			return err
+		}
+		if approved == entry.PackageID && committed.Version == chaincode.Version {
+			log.Infof("%s is up to date at sequence %d", chaincode.Name, committed.Sequence)
+			return nil
+		}
+		sequence = committed.Sequence + 1
+	}
+
+	definition := fabric.ChaincodeDefinition{
+		Name:              chaincode.Name,
+		Version:           chaincode.Version,
+		Sequence:          sequence,
+		PackageID:         entry.PackageID,
+		EndorsementPolicy: chaincode.EndorsementPolicy,
+		Collections:       collections,
+	}
+	for _, org := range plan.Orgs {
+		// Approving the same definition twice fails, so a rerun skips the
+		// organizations that already approved it
+		approved, err := b.network.ApprovedPackageID(org.Name, org.Peers[0], plan.Channel, chaincode.Name, sequence)
+		if err != nil {
+			return err
+		}
+		if approved == entry.PackageID {
+			continue
+		}
+		if err := b.network.ApproveChaincode(org.Name, org.Peers[0], plan.Channel, plan.Orderer, definition); err != nil {
+			return err
+		}
+	}
+
+	approvals, err := b.network.CommitReadiness(first.Name, first.Peers[0], plan.Channel, definition)
+	if err != nil {
+		return err
+	}
+	for _, org := range plan.Orgs {
+		if !approvals[org.MSPID] {
+			return errors.Errorf("%s has not approved %s sequence %d with the planned definition", org.MSPID, chaincode.Name, sequence)
+		}
+	}
+
+	endorsers := make([]string, 0, len(plan.Orgs))
+	for _, org := range plan.Orgs {
+		endorsers = append(endorsers, org.Peers[0])
+	}
+	if err := b.network.CommitChaincode(first.Name, plan.Channel, plan.Orderer, definition, endorsers); err != nil {
+		return err
+	}
+	if sequence == 1 {
+		b.firstDeployed[chaincode.Name] = true
+	}
+	log.Infof("%s %s committed at sequence %d (%s)", chaincode.Name, chaincode.Version, sequence, entry.PackageID)
+	return nil
+}
+
+// Initialize runs the chaincodes' initialization in dependency order. A
+// chaincode's admin MSPs are named first, unless it has some. A chaincode
+// with a service key is initialized with it unless it already
+// was, after importing the key of the chaincode it depends on, and then
+// publishes its own key if another chaincode imports it. Once all are
+// initialized, a chaincode that verifies another's signatures imports its
+// key too. A chaincode's Init
+// only runs if this bootstrap deployed it for the first time, since it may
+// not be safe to repeat (the user-acl InitLedger resets the admin user), or
+// if its name is in force. If the AS, TGS and ISV were initialized, the key
+// ceremony is verified.
+func (b *Bootstrap) Initialize(force []string) error {
+	order, err := b.plan.InitOrder()
+	if err != nil {
+		return err
+	}
+	forced := make(map[string]bool, len(force))
+	for _, name := range force {
+		forced[name] = true
+	}
+
+	client, err := b.client()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	imported := make(map[string]bool)
+	for _, chaincode := range order {
+		if chaincode.ServiceKey != nil && chaincode.ServiceKey.ImportFrom != "" {
+			imported[chaincode.ServiceKey.ImportFrom] = true
+		}
+		if chaincode.ServiceKey != nil && chaincode.ServiceKey.VerifyFrom != "" {
+			imported[chaincode.ServiceKey.VerifyFrom] = true
+		}
+	}
+
+	fingerprints := make(map[string]string)
+	for _, chaincode := range order {
+		contract, err := client.GetContract(chaincode.Name)
+		if err != nil {
+			return err
+		}
+		if len(chaincode.AdminMSPs) > 0 {
+			if err := initAdminMSPs(client, contract, chaincode); err != nil {
+				return err
+			}
+		}
+		if chaincode.ServiceKey != nil {
+			if err := initServiceKey(client, contract, chaincode, imported[chaincode.Name], fingerprints); err != nil {
+				return err
+			}
+		}
+		if chaincode.Init != nil && (b.firstDeployed[chaincode.Name] || forced[chaincode.Name]) {
+			if _, err := client.SubmitInit(contract, chaincode.Init.Function, chaincode.Init.Args...); err != nil {
+				return err
+			}
+			log.Infof("%s: %s submitted", chaincode.Name, chaincode.Init.Function)
+		}
+	}
+	for _, chaincode := range order {
+		if chaincode.ServiceKey == nil || chaincode.ServiceKey.VerifyFrom == "" {
+			continue
+		}
+		if err := importVerifiedKey(client, chaincode, fingerprints); err != nil {
+			return err
+		}
+	}
+
+	return verifyKeyCeremony(client, fingerprints)
+}
+
+// client returns a client on the plan's channel, acting as the admin of
+// the first organization from an in-memory wallet
+func (b *Bootstrap) client() (*fabric.Client, error) {
+	client, err := fabric.NewClient(fabric.ClientOptions{
+		ConfigPath:      b.configPath,
+		ChannelName:     b.plan.Channel,
+		WalletPath:      "netadmin",
+		Wallet:          fabric.WalletOptions{Backend: fabric.WalletBackendMemory},
+		AgeIdentityFile: b.ageIdentityFile,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	admin, org := b.admins[0], b.plan.Orgs[0]
+	label := "admin@" + org.Name
+	if err := client.GetWallet().ImportIdentity(label, org.MSPID, admin.Certificate, admin.PrivateKey); err != nil {
+		client.Close()
+		return nil, errors.Wrapf(err, "failed to load the admin of %s", org.Name)
+	}
+	if err := client.Connect(label); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+// initAdminMSPs names the plan's admin MSPs of a chaincode unless it has
+// admin MSPs already, which are then left as they are
+func initAdminMSPs(client *fabric.Client, contract *fabric.Contract, chaincode Chaincode) error {
+	msps, err := client.GetAdminMSPs(contract)
+	if err != nil {
+		return err
+	}
+	if len(msps) > 0 {
+		log.Infof("%s has admin MSPs %s", chaincode.Name, strings.Join(msps, ", "))
+		return nil
+	}
+	if err := client.InitAdminMSPs(contract, chaincode.AdminMSPs); err != nil {
+		return err
+	}
+	log.Infof("%s: admin MSPs set to %s", chaincode.Name, strings.Join(chaincode.AdminMSPs, ", "))
+	return nil
+}
+
+// importVerifiedKey imports into a chaincode the key of the chaincode whose
+// signatures it checks. The import is repeated on every run, so that it
+// follows a new key.
+func importVerifiedKey(client *fabric.Client, chaincode Chaincode, fingerprints map[string]string) error {
+	verifyFrom := chaincode.ServiceKey.VerifyFrom
+	fingerprint, ok := fingerprints[verifyFrom]
+	if !ok {
+		return errors.Errorf("%s verifies %s, which has no service key in the plan; import it with 'authcli service-keys import'", chaincode.Name, verifyFrom)
+	}
+	contract, err := client.GetContract(chaincode.Name)
+	if err != nil {
+		return err
+	}
+	if _, err := client.ImportPeerServiceKey(contract, verifyFrom, fingerprint); err != nil {
+		return err
+	}
+	log.Infof("%s imported the key of %s", chaincode.Name, verifyFrom)
+	return nil
+}
+
+// initServiceKey initializes a chaincode with its service key unless it
+// already was, and publishes its public key if publish is set. fingerprints
+// collects the fingerprints of the keys, by chaincode.
+func initServiceKey(client *fabric.Client, contract *fabric.Contract, chaincode Chaincode, publish bool, fingerprints map[string]string) error {
+	key := chaincode.ServiceKey
+	var keys *fabric.ServiceKeyPair
+	if key.PrivateKey != "" {
+		var err error
+		if keys, err = auth.LoadServiceKeyPair(key.PrivateKey); err != nil {
+			return err
+		}
+		if fingerprints[chaincode.Name], err = auth.ServiceKeyFingerprint(keys); err != nil {
+			return err
+		}
+	}
+
+	if record, err := client.GetInitializationRecord(contract); err == nil {
+		log.Infof("%s was initialized by %s at %s", chaincode.Name, record.InitializedBy, record.InitializedAt)
+	} else {
+		log.Debugf("%s is not initialized: %v", chaincode.Name, err)
+		if key.ImportFrom != "" {
+			fingerprint, ok := fingerprints[key.ImportFrom]
+			if !ok {
+				// The key of the chaincode imported from is only in its
+				// collection, so the plan cannot vouch for it
+				return errors.Errorf("%s imports the key of %s, which has no privateKey in the plan; import it with 'authcli service-keys import'", chaincode.Name, key.ImportFrom)
+			}
+			if _, err := client.ImportPeerServiceKey(contract, key.ImportFrom, fingerprint); err != nil {
+				return err
+			}
+		}
+		if err := client.InitializeWithKeys(contract, fabric.KeyBootstrap{Collection: key.Collection}, keys); err != nil {
+			return err
+		}
+		log.Infof("%s initialized", chaincode.Name)
+	}
+
+	if !publish {
+		return nil
+	}
+	if published, err := client.GetPublishedPublicKey(contract); err == nil {
+		if fingerprint, ok := fingerprints[chaincode.Name]; !ok || published.Fingerprint == fingerprint {
+			fingerprints[chaincode.Name] = published.Fingerprint
+			return nil
+		}
+	}
+	published, err := client.PublishPublicKey(contract)
+	if err != nil {
+		return err
+	}
+	fingerprints[chaincode.Name] = published.Fingerprint
+	log.Infof("%s published key %s", chaincode.Name, published.Fingerprint)
+	return nil
+}
+
+// verifyKeyCeremony runs auth.VerifyKeyCeremony if the plan initialized the
+// AS, TGS and ISV, expecting the fingerprints of the plan's keys
+func verifyKeyCeremony(client *fabric.Client, fingerprints map[string]string) error {
+	services := map[string]string{fabric.ASContractID: "as", fabric.TGSContractID: "tgs", fabric.ISVContractID: "isv"}
+	expected := make(map[string]string)
+	for contractID, service := range services {
+		if fingerprint, ok := fingerprints[contractID]; ok {
+			expected[service] = fingerprint
+		}
+	}
+	if len(expected) < len(services) {
+		return nil
+	}
+
+	checks, err := auth.VerifyKeyCeremony(client, expected)
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, check := range checks {
+		if !check.Passed {
+			log.Errorf("Key check %s failed: %s", check.Check, check.Detail)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return errors.Errorf("%d of %d key checks failed; run 'authcli service-keys verify' for details", failed, len(checks))
+	}
+	log.Infof("All %d key checks passed", len(checks))
+	return nil
+}
@@ -0,0 +1,285 @@
+// Package netadmin brings up the authentication network from a plan: it
+// creates the channel, joins the peers, deploys each chaincode with the
+// next sequence of its definition and runs the initialization transactions
+// in dependency order. Each step checks the network first and is skipped
+// if already done, so a bootstrap that failed halfway can be rerun.
+package netadmin
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/chaichis-network/v3/internal/fabric"
+	"github.com/pkg/errors"
+)
+
+// Plan describes the network to bring up. Relative paths are relative to
+// the plan file; LoadPlan makes them absolute.
+type Plan struct {
+	Channel   string `json:"channel"`
+	ChannelTx string `json:"channelTx"` // From 'configtxgen -outputCreateChannelTx'
+	Orderer   string `json:"orderer"`   // Orderer name in the connection profile
+	Manifest  string `json:"manifest"`  // ccpackage manifest of the packages to deploy
+	Orgs      []Org  `json:"orgs"`
+
+	// Chaincodes are deployed in this order; their initialization follows
+	// ServiceKey.ImportFrom and After
+	Chaincodes []Chaincode `json:"chaincodes"`
+}
+
+// Org is an organization and the admin that acts for it
+type Org struct {
+	Name string `json:"name"` // Organization name in the connection profile
+	// MSPID is the organization's MSP ID (default: Name)
+	MSPID string `json:"mspID"`
+	// AdminMSP is the admin's MSP directory, with the certificate in
+	// signcerts and the private key in keystore, as cryptogen writes it
+	AdminMSP string   `json:"adminMSP"`
+	Peers    []string `json:"peers"`
+	// AnchorPeersTx is the organization's anchor peer update, from
+	// 'configtxgen -outputAnchorPeersUpdate'
+	AnchorPeersTx string `json:"anchorPeersTx"`
+}
+
+// Chaincode is a chaincode to deploy
+type Chaincode struct {
+	Name    string `json:"name"` // Name on the channel and in the manifest
+	Version string `json:"version"`
+	// EndorsementPolicy is a signature policy, e.g.
+	// "OR('Org1MSP.peer','Org2MSP.peer')" (default: the channel's)
+	EndorsementPolicy string `json:"endorsementPolicy,omitempty"`
+	// CollectionsConfig is a private data collections file in the format
+	// of 'peer lifecycle chaincode approveformyorg --collections-config'
+	CollectionsConfig string `json:"collectionsConfig,omitempty"`
+
+	// AdminMSPs are named as the chaincode's admin MSPs before anything
+	// else is initialized, unless it has admin MSPs already. They must
+	// include the first organization's, which the bootstrap acts for.
+	// Chaincodes with admin functions refuse them until then.
+	AdminMSPs []string `json:"adminMSPs,omitempty"`
+	// ServiceKey initializes the AS, TGS or ISV with its key pair
+	ServiceKey *ServiceKey `json:"serviceKey,omitempty"`
+	// Init is a transaction to submit once, after the first deployment
+	Init *Init `json:"init,omitempty"`
+	// After names chaincodes to initialize before this one
+	After []string `json:"after,omitempty"`
+}
+
+// ServiceKey is how a chaincode is initialized with its key pair, as with
+// 'authcli service-keys'
+type ServiceKey struct {
+	PrivateKey string `json:"privateKey"`           // PEM RSA private key file
+	Collection string `json:"collection,omitempty"` // Private data collection for the private key
+	// ImportFrom is the chaincode whose published key this one imports
+	// before it is initialized. That chaincode is initialized first and
+	// publishes its key.
+	ImportFrom string `json:"importFrom,omitempty"`
+	// VerifyFrom is a chaincode whose published key this one imports once
+	// both are initialized, to check what that chaincode signs: the TGS
+	// checks the client changes the AS sends
+	VerifyFrom string `json:"verifyFrom,omitempty"`
+}
+
+// Init is a chaincode function to submit, e.g. InitLedger
+type Init struct {
+	Function string   `json:"function"`
+	Args     []string `json:"args,omitempty"`
+}
+
+// LoadPlan reads and checks a plan, resolving its paths
+func LoadPlan(path string) (*Plan, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read plan")
+	}
+	var plan Plan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return nil, errors.Wrapf(err, "invalid plan %s", path)
+	}
+
+	dir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+	resolve := func(p *string) {
+		if *p != "" && !filepath.IsAbs(*p) {
+			*p = filepath.Join(dir, *p)
+		}
+	}
+	resolve(&plan.ChannelTx)
+	resolve(&plan.Manifest)
+	for i := range plan.Orgs {
+		resolve(&plan.Orgs[i].AdminMSP)
+		resolve(&plan.Orgs[i].AnchorPeersTx)
+		if plan.Orgs[i].MSPID == "" {
+			plan.Orgs[i].MSPID = plan.Orgs[i].Name
+		}
+	}
+	for i := range plan.Chaincodes {
+		resolve(&plan.Chaincodes[i].CollectionsConfig)
+		if key := plan.Chaincodes[i].ServiceKey; key != nil {
+			resolve(&key.PrivateKey)
+		}
+	}
+
+	if err := plan.validate(); err != nil {
+		return nil, errors.Wrapf(err, "invalid plan %s", path)
+	}
+	return &plan, nil
+}
+
+func (p *Plan) validate() error {
+	switch {
+	case p.Channel == "":
+		return errors.New("channel is required")
+	case p.Orderer == "":
+		return errors.New("orderer is required")
+	case len(p.Orgs) == 0:
+		return errors.New("at least one organization is required")
+	case len(p.Chaincodes) > 0 && p.Manifest == "":
+		return errors.New("manifest is required to deploy chaincodes")
+	}
+
+	orgs := make(map[string]bool)
+	for _, org := range p.Orgs {
+		if org.Name == "" || org.AdminMSP == "" {
+			return errors.New("every organization needs a name and adminMSP")
+		}
+		if len(org.Peers) == 0 {
+			return errors.Errorf("organization %s has no peers", org.Name)
+		}
+		if orgs[org.Name] {
+			return errors.Errorf("organization %s is listed twice", org.Name)
+		}
+		orgs[org.Name] = true
+	}
+
+	names := make(map[string]bool)
+	for _, chaincode := range p.Chaincodes {
+		if chaincode.Name == "" || chaincode.Version == "" {
+			return errors.New("every chaincode needs a name and version")
+		}
+		if names[chaincode.Name] {
+			return errors.Errorf("chaincode %s is listed twice", chaincode.Name)
+		}
+		names[chaincode.Name] = true
+		if chaincode.ServiceKey != nil && chaincode.ServiceKey.PrivateKey == "" && chaincode.ServiceKey.Collection == "" {
+			return errors.Errorf("service key of %s needs a privateKey unless it is in a collection", chaincode.Name)
+		}
+		if len(chaincode.AdminMSPs) > 0 && !contains(chaincode.AdminMSPs, p.Orgs[0].MSPID) {
+			return errors.Errorf("admin MSPs of %s must include %s, which the bootstrap acts for", chaincode.Name, p.Orgs[0].MSPID)
+		}
+		if chaincode.ServiceKey != nil && len(chaincode.AdminMSPs) == 0 {
+			return errors.Errorf("%s has a service key but no adminMSPs; only admins may initialize it", chaincode.Name)
+		}
+		if chaincode.Init != nil && chaincode.Init.Function == "" {
+			return errors.Errorf("init of %s needs a function", chaincode.Name)
+		}
+	}
+	for _, chaincode := range p.Chaincodes {
+		if chaincode.ServiceKey != nil && chaincode.ServiceKey.VerifyFrom != "" && !names[chaincode.ServiceKey.VerifyFrom] {
+			return errors.Errorf("chaincode %s verifies %s, which is not in the plan", chaincode.Name, chaincode.ServiceKey.VerifyFrom)
+		}
+	}
+	_, err := p.InitOrder()
+	return err
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// dependencies returns the chaincodes that must be initialized before c
+func (c Chaincode) dependencies() []string {
+	dependencies := append([]string(nil), c.After...)
+	if c.ServiceKey != nil && c.ServiceKey.ImportFrom != "" {
+		dependencies = append(dependencies, c.ServiceKey.ImportFrom)
+	}
+	return dependencies
+}
+
+// InitOrder returns the chaincodes in the order to initialize them: every
+// chaincode after those it depends on, and otherwise in plan order
+func (p *Plan) InitOrder() ([]Chaincode, error) {
+	index := make(map[string]int, len(p.Chaincodes))
+	for i, chaincode := range p.Chaincodes {
+		index[chaincode.Name] = i
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make([]int, len(p.Chaincodes))
+	order := make([]Chaincode, 0, len(p.Chaincodes))
+	var visit func(i int) error
+	visit = func(i int) error {
+		switch state[i] {
+		case done:
+			return nil
+		case visiting:
+			return errors.Errorf("chaincode %s is in a dependency cycle", p.Chaincodes[i].Name)
+		}
+		state[i] = visiting
+		for _, dependency := range p.Chaincodes[i].dependencies() {
+			j, ok := index[dependency]
+			if !ok {
+				return errors.Errorf("chaincode %s depends on %s, which is not in the plan", p.Chaincodes[i].Name, dependency)
+			}
+			if err := visit(j); err != nil {
+				return err
+			}
+		}
+		state[i] = done
+		order = append(order, p.Chaincodes[i])
+		return nil
+	}
+	for i := range p.Chaincodes {
+		if err := visit(i); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// admins returns the admin identities of the organizations
+func (p *Plan) admins() ([]fabric.OrgAdmin, error) {
+	admins := make([]fabric.OrgAdmin, 0, len(p.Orgs))
+	for _, org := range p.Orgs {
+		certificate, err := singleFile(filepath.Join(org.AdminMSP, "signcerts"))
+		if err != nil {
+			return nil, errors.Wrapf(err, "no admin certificate for %s", org.Name)
+		}
+		privateKey, err := singleFile(filepath.Join(org.AdminMSP, "keystore"))
+		if err != nil {
+			return nil, errors.Wrapf(err, "no admin private key for %s", org.Name)
+		}
+		admins = append(admins, fabric.OrgAdmin{Org: org.Name, Certificate: certificate, PrivateKey: privateKey})
+	}
+	return admins, nil
+}
+
+// singleFile returns the only file in dir
+func singleFile(dir string) (string, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	var found []string
+	for _, file := range files {
+		if !file.IsDir() {
+			found = append(found, filepath.Join(dir, file.Name()))
+		}
+	}
+	if len(found) != 1 {
+		return "", errors.Errorf("expected one file in %s, found %d", dir, len(found))
+	}
+	return found[0], nil
+}
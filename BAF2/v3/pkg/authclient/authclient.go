@@ -0,0 +1,146 @@
+// Package authclient runs the client side of the authentication flow (AS
+// challenge, TGT, service ticket) against any ledger implementation, so that
+// services can embed the framework without depending on its Fabric plumbing.
+//
+// This package is a separately versioned module; see docs/api-stability.md.
+package authclient
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/chaichis-network/v3/pkg/keystore"
+	"github.com/chaichis-network/v3/pkg/ticket"
+)
+
+// Ledger is the subset of the AS and TGS contracts the flow needs. The
+// framework's Fabric contract wrappers satisfy it.
+type Ledger interface {
+	RegisterClient(clientID, publicKeyPEM string) error
+	GetNonceChallenge(clientID string) (string, error)
+	VerifyClientIdentity(clientID, signedNonce string) error
+	GenerateTGT(clientID string) (map[string]string, error)
+	GenerateServiceTicket(request map[string]string) (map[string]string, error)
+}
+
+// Client authenticates identities kept in a key store
+type Client struct {
+	ledger Ledger
+	keys   *keystore.Store
+	now    func() time.Time
+}
+
+// New returns a client that talks to ledger and signs with keys from keys
+func New(ledger Ledger, keys *keystore.Store) *Client {
+	return &Client{
+		ledger: ledger,
+		keys:   keys,
+		now:    time.Now,
+	}
+}
+
+// Register creates a key pair for clientID if needed and registers its
+// public key with the AS
+func (c *Client) Register(clientID string) error {
+	if _, _, err := c.keys.LoadOrGenerate(clientID, keystore.DefaultKeySize); err != nil {
+		return err
+	}
+
+	publicKeyPEM, err := c.keys.PublicKeyPEM(clientID)
+	if err != nil {
+		return err
+	}
+
+	if err := c.ledger.RegisterClient(clientID, publicKeyPEM); err != nil {
+		return fmt.Errorf("failed to register client with Authentication Server: %w", err)
+	}
+	return nil
+}
+
+// Authenticate answers the AS challenge, obtains a TGT and exchanges it for
+// a service ticket for serviceID
+func (c *Client) Authenticate(clientID, serviceID string) (*ticket.TGT, *ticket.ServiceTicket, error) {
+	tgt, err := c.RequestTGT(clientID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	serviceTicket, err := c.RequestServiceTicket(clientID, serviceID, *tgt)
+	if err != nil {
+		return nil, nil, err
+	}
+	return tgt, serviceTicket, nil
+}
+
+// RequestTGT answers the AS nonce challenge and returns the issued TGT
+func (c *Client) RequestTGT(clientID string) (*ticket.TGT, error) {
+	nonce, err := c.ledger.GetNonceChallenge(clientID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get nonce challenge: %w", err)
+	}
+
+	privateKey, err := c.keys.LoadPrivateKey(clientID)
+	if err != nil {
+		return nil, err
+	}
+	signedNonce, err := SignNonce(privateKey, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.ledger.VerifyClientIdentity(clientID, signedNonce); err != nil {
+		return nil, fmt.Errorf("failed to verify client identity: %w", err)
+	}
+
+	response, err := c.ledger.GenerateTGT(clientID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate TGT: %w", err)
+	}
+	tgt := &ticket.TGT{
+		EncryptedTGT:        response["encryptedTGT"],
+		EncryptedSessionKey: response["encryptedSessionKey"],
+		ExpiresAt:           response["expiresAt"],
+	}
+	if err := ticket.VerifyTGT(*tgt, privateKey, c.now()); err != nil {
+		return nil, fmt.Errorf("TGT verification failed: %w", err)
+	}
+	return tgt, nil
+}
+
+// RequestServiceTicket exchanges a TGT for a service ticket
+func (c *Client) RequestServiceTicket(clientID, serviceID string, tgt ticket.TGT) (*ticket.ServiceTicket, error) {
+	request, err := ticket.NewServiceTicketRequest(tgt, clientID, serviceID, c.now())
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := c.ledger.GenerateServiceTicket(request.Map())
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate service ticket: %w", err)
+	}
+	return &ticket.ServiceTicket{
+		EncryptedServiceTicket: response["encryptedServiceTicket"],
+		EncryptedSessionKey:    response["encryptedSessionKey"],
+	}, nil
+}
+
+// SignNonce signs a base64 AS nonce. The signature covers the decoded nonce
+// bytes, which is what the AS chaincode verifies.
+func SignNonce(privateKey *rsa.PrivateKey, nonce string) (string, error) {
+	nonceBytes, err := base64.StdEncoding.DecodeString(nonce)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode base64 nonce: %w", err)
+	}
+
+	hash := sha256.Sum256(nonceBytes)
+	signature, err := rsa.SignPKCS1v15(rand.Reader, privateKey, crypto.SHA256, hash[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign nonce: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(signature), nil
+}
@@ -0,0 +1,120 @@
+package authclient
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/chaichis-network/v3/pkg/keystore"
+	"github.com/chaichis-network/v3/pkg/ticket"
+)
+
+// fakeLedger plays the AS and TGS, checking what the client sends
+type fakeLedger struct {
+	publicKeys map[string]*rsa.PublicKey
+	nonce      []byte
+	verified   bool
+	request    map[string]string
+
+	tgsKey       *rsa.PrivateKey
+	encryptedTGT string
+}
+
+func (l *fakeLedger) RegisterClient(clientID, publicKeyPEM string) error {
+	publicKey, err := keystore.ParsePublicKeyPEM([]byte(publicKeyPEM))
+	if err != nil {
+		return err
+	}
+	l.publicKeys[clientID] = publicKey
+	return nil
+}
+
+func (l *fakeLedger) GetNonceChallenge(clientID string) (string, error) {
+	return base64.StdEncoding.EncodeToString(l.nonce), nil
+}
+
+func (l *fakeLedger) VerifyClientIdentity(clientID, signedNonce string) error {
+	signature, err := base64.StdEncoding.DecodeString(signedNonce)
+	if err != nil {
+		return err
+	}
+	hash := sha256.Sum256(l.nonce)
+	if err := rsa.VerifyPKCS1v15(l.publicKeys[clientID], crypto.SHA256, hash[:], signature); err != nil {
+		return err
+	}
+	l.verified = true
+	return nil
+}
+
+func (l *fakeLedger) GenerateTGT(clientID string) (map[string]string, error) {
+	if !l.verified {
+		return nil, errors.New("client not verified")
+	}
+
+	// Shaped like the AS response so that it passes ticket.VerifyTGT
+	sessionKey := sha256.Sum256([]byte(clientID + "KU,TGS"))
+	encryptedSessionKey, err := rsa.EncryptPKCS1v15(rand.Reader, l.publicKeys[clientID], []byte(base64.StdEncoding.EncodeToString(sessionKey[:])))
+	if err != nil {
+		return nil, err
+	}
+	encryptedTGT, err := rsa.EncryptPKCS1v15(rand.Reader, &l.tgsKey.PublicKey, []byte(clientID))
+	if err != nil {
+		return nil, err
+	}
+	l.encryptedTGT = base64.StdEncoding.EncodeToString(encryptedTGT)
+	return map[string]string{
+		"encryptedTGT":        l.encryptedTGT,
+		"encryptedSessionKey": base64.StdEncoding.EncodeToString(encryptedSessionKey),
+	}, nil
+}
+
+func (l *fakeLedger) GenerateServiceTicket(request map[string]string) (map[string]string, error) {
+	l.request = request
+	return map[string]string{"encryptedServiceTicket": "st-" + request["serviceID"], "encryptedSessionKey": "key"}, nil
+}
+
+func TestAuthenticate(t *testing.T) {
+	tgsKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ledger := &fakeLedger{
+		publicKeys: map[string]*rsa.PublicKey{},
+		nonce:      []byte("0123456789abcdef0123456789abcdef"),
+		tgsKey:     tgsKey,
+	}
+	client := New(ledger, keystore.New(t.TempDir()))
+	now := time.Unix(1700000000, 0)
+	client.now = func() time.Time { return now }
+
+	if err := client.Register("client1"); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	tgt, serviceTicket, err := client.Authenticate("client1", "iotservice1")
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+
+	if tgt.EncryptedTGT != ledger.encryptedTGT {
+		t.Errorf("TGT = %q", tgt.EncryptedTGT)
+	}
+	if serviceTicket.EncryptedServiceTicket != "st-iotservice1" {
+		t.Errorf("service ticket = %q", serviceTicket.EncryptedServiceTicket)
+	}
+	if ledger.request["encryptedTGT"] != ledger.encryptedTGT || ledger.request["clientID"] != "client1" {
+		t.Errorf("unexpected service ticket request %v", ledger.request)
+	}
+
+	authenticator, err := ticket.DecodeAuthenticator(ledger.request["authenticator"])
+	if err != nil {
+		t.Fatalf("DecodeAuthenticator: %v", err)
+	}
+	if authenticator.ClientID != "client1" || authenticator.Timestamp != now.Unix() {
+		t.Errorf("authenticator = %+v", authenticator)
+	}
+}
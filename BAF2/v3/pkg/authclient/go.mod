@@ -0,0 +1,13 @@
+module github.com/chaichis-network/v3/pkg/authclient
+
+go 1.18
+
+require (
+	github.com/chaichis-network/v3/pkg/keystore v1.0.0
+	github.com/chaichis-network/v3/pkg/ticket v1.0.0
+)
+
+replace (
+	github.com/chaichis-network/v3/pkg/keystore => ../keystore
+	github.com/chaichis-network/v3/pkg/ticket => ../ticket
+)
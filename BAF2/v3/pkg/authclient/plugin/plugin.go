@@ -0,0 +1,196 @@
+// Package plugin is the Go API for authcli plugins. An authcli plugin is an
+// executable named authcli-<name> on PATH; "authcli <name> args..." runs it
+// with args, and with authcli's resolved global settings in the environment.
+//
+// A plugin built with this package reads those settings with FromEnv and
+// talks to the ledger through the authcli that started it, so it needs no
+// Fabric SDK or connection profile handling of its own:
+//
+//	func main() {
+//		plugin.Main(func(env plugin.Env, args []string) error {
+//			client := env.Client()
+//			_, serviceTicket, err := client.Authenticate(args[0], "iot-service")
+//			...
+//		})
+//	}
+package plugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/chaichis-network/v3/pkg/authclient"
+	"github.com/chaichis-network/v3/pkg/keystore"
+)
+
+// Environment variables authcli sets for a plugin, besides AUTHCLI_<FLAG>
+// for each of its global flags
+const (
+	// EnvBinary is the path of the authcli that started the plugin
+	EnvBinary = "AUTHCLI_BIN"
+	// EnvPlugin is the name the plugin was invoked as, e.g. "onboard"
+	EnvPlugin = "AUTHCLI_PLUGIN"
+	// EnvKeyDir is the directory of the key store authcli uses
+	EnvKeyDir = "AUTHCLI_KEY_DIR"
+)
+
+// Env is the context authcli runs a plugin in
+type Env struct {
+	Binary     string // authcli to call back into
+	Name       string // Plugin name
+	Network    string // Connection profile (--config)
+	Wallet     string
+	Identity   string
+	SessionDir string
+	KeyDir     string
+	Profile    string // Settings profile in use, if any
+	LogLevel   string
+	Strict     bool
+}
+
+// ErrNotPlugin is returned by FromEnv when the process was not started by
+// authcli
+var ErrNotPlugin = errors.New("not started by authcli: run it as 'authcli <name>'")
+
+// FromEnv reads the context authcli passed in the environment
+func FromEnv() (Env, error) {
+	env := Env{
+		Binary:     os.Getenv(EnvBinary),
+		Name:       os.Getenv(EnvPlugin),
+		Network:    os.Getenv("AUTHCLI_NETWORK"),
+		Wallet:     os.Getenv("AUTHCLI_WALLET"),
+		Identity:   os.Getenv("AUTHCLI_IDENTITY"),
+		SessionDir: os.Getenv("AUTHCLI_SESSION_DIR"),
+		KeyDir:     os.Getenv(EnvKeyDir),
+		Profile:    os.Getenv("AUTHCLI_PROFILE"),
+		LogLevel:   os.Getenv("AUTHCLI_LOG_LEVEL"),
+	}
+	if env.Binary == "" {
+		return Env{}, ErrNotPlugin
+	}
+	if strict := os.Getenv("AUTHCLI_STRICT"); strict != "" {
+		value, err := strconv.ParseBool(strict)
+		if err != nil {
+			return Env{}, fmt.Errorf("invalid AUTHCLI_STRICT %q: %w", strict, err)
+		}
+		env.Strict = value
+	}
+	if env.KeyDir == "" {
+		env.KeyDir = "keys"
+	}
+	return env, nil
+}
+
+// Main runs a plugin: it reads the environment, calls run with the plugin's
+// arguments and exits non-zero with the error, if any
+func Main(run func(env Env, args []string) error) {
+	env, err := FromEnv()
+	if err == nil {
+		err = run(env, os.Args[1:])
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// Authcli runs an authcli command with the plugin's settings and returns its
+// standard output, also on failure; its standard error is passed through
+func (env Env) Authcli(args ...string) ([]byte, error) {
+	return env.authcli(nil, args...)
+}
+
+// Keys returns the key store authcli uses
+func (env Env) Keys() *keystore.Store {
+	return keystore.New(env.KeyDir)
+}
+
+// Client returns an authclient.Client over Ledger and Keys
+func (env Env) Client() *authclient.Client {
+	return authclient.New(env.Ledger(), env.Keys())
+}
+
+// Ledger returns an authclient.Ledger that submits through authcli, with the
+// plugin's network, wallet and identity
+func (env Env) Ledger() authclient.Ledger {
+	return &ledger{env: env}
+}
+
+func (env Env) authcli(stdin []byte, args ...string) ([]byte, error) {
+	cmd := exec.Command(env.Binary, args...)
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	cmd.Stderr = os.Stderr
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		return stdout.Bytes(), fmt.Errorf("authcli %s: %w", strings.Join(args, " "), err)
+	}
+	return stdout.Bytes(), nil
+}
+
+// ledger calls "authcli plugin ledger <method>", which reads the arguments
+// as a JSON array on stdin and writes the result as JSON
+type ledger struct {
+	env Env
+}
+
+// ledgerError is what "authcli plugin ledger" writes when the call fails
+type ledgerError struct {
+	Error string `json:"error"`
+}
+
+func (l *ledger) call(method string, result interface{}, args ...interface{}) error {
+	argsJSON, err := json.Marshal(args)
+	if err != nil {
+		return err
+	}
+	output, err := l.env.authcli(argsJSON, "plugin", "ledger", method)
+	if err != nil {
+		var failure ledgerError
+		if jsonErr := json.Unmarshal(output, &failure); jsonErr == nil && failure.Error != "" {
+			return errors.New(failure.Error)
+		}
+		return err
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.Unmarshal(output, result); err != nil {
+		return fmt.Errorf("invalid %s response from authcli: %w", method, err)
+	}
+	return nil
+}
+
+func (l *ledger) RegisterClient(clientID, publicKeyPEM string) error {
+	return l.call("RegisterClient", nil, clientID, publicKeyPEM)
+}
+
+func (l *ledger) GetNonceChallenge(clientID string) (string, error) {
+	var nonce string
+	err := l.call("GetNonceChallenge", &nonce, clientID)
+	return nonce, err
+}
+
+func (l *ledger) VerifyClientIdentity(clientID, signedNonce string) error {
+	return l.call("VerifyClientIdentity", nil, clientID, signedNonce)
+}
+
+func (l *ledger) GenerateTGT(clientID string) (map[string]string, error) {
+	var response map[string]string
+	err := l.call("GenerateTGT", &response, clientID)
+	return response, err
+}
+
+func (l *ledger) GenerateServiceTicket(request map[string]string) (map[string]string, error) {
+	var response map[string]string
+	err := l.call("GenerateServiceTicket", &response, request)
+	return response, err
+}
@@ -0,0 +1,98 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestMain lets the test binary play authcli: with FAKE_AUTHCLI set it
+// serves "plugin ledger" calls like authcli does
+func TestMain(m *testing.M) {
+	if os.Getenv("FAKE_AUTHCLI") != "" {
+		os.Exit(fakeAuthcli(os.Args[1:]))
+	}
+	os.Exit(m.Run())
+}
+
+func fakeAuthcli(args []string) int {
+	if len(args) != 3 || args[0] != "plugin" || args[1] != "ledger" {
+		fmt.Fprintf(os.Stderr, "unexpected arguments %v\n", args)
+		return 2
+	}
+	var callArgs []json.RawMessage
+	input, _ := io.ReadAll(os.Stdin)
+	if err := json.Unmarshal(input, &callArgs); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	switch args[2] {
+	case "GetNonceChallenge":
+		var clientID string
+		json.Unmarshal(callArgs[0], &clientID)
+		json.NewEncoder(os.Stdout).Encode("nonce-for-" + clientID)
+	case "GenerateServiceTicket":
+		var request map[string]string
+		json.Unmarshal(callArgs[0], &request)
+		json.NewEncoder(os.Stdout).Encode(map[string]string{"encryptedServiceTicket": "ticket-for-" + request["serviceID"]})
+	case "VerifyClientIdentity":
+		json.NewEncoder(os.Stdout).Encode(map[string]string{"error": "signature verification failed"})
+		return 1
+	default:
+		return 3
+	}
+	return 0
+}
+
+func testEnv(t *testing.T) Env {
+	t.Helper()
+	t.Setenv("FAKE_AUTHCLI", "1")
+	t.Setenv(EnvBinary, os.Args[0])
+	t.Setenv(EnvPlugin, "onboard")
+	t.Setenv("AUTHCLI_WALLET", "/tmp/wallet")
+	t.Setenv("AUTHCLI_STRICT", "true")
+	env, err := FromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return env
+}
+
+func TestFromEnv(t *testing.T) {
+	env := testEnv(t)
+	if env.Name != "onboard" || env.Wallet != "/tmp/wallet" || !env.Strict || env.KeyDir != "keys" {
+		t.Errorf("FromEnv() = %+v", env)
+	}
+
+	t.Setenv(EnvBinary, "")
+	if _, err := FromEnv(); err != ErrNotPlugin {
+		t.Errorf("FromEnv() outside authcli error = %v, want ErrNotPlugin", err)
+	}
+}
+
+func TestLedger(t *testing.T) {
+	ledger := testEnv(t).Ledger()
+
+	nonce, err := ledger.GetNonceChallenge("client1")
+	if err != nil || nonce != "nonce-for-client1" {
+		t.Errorf("GetNonceChallenge() = %q, %v", nonce, err)
+	}
+
+	response, err := ledger.GenerateServiceTicket(map[string]string{"serviceID": "iot-service"})
+	if err != nil || response["encryptedServiceTicket"] != "ticket-for-iot-service" {
+		t.Errorf("GenerateServiceTicket() = %v, %v", response, err)
+	}
+
+	err = ledger.VerifyClientIdentity("client1", "bad")
+	if err == nil || !strings.Contains(err.Error(), "signature verification failed") {
+		t.Errorf("VerifyClientIdentity() error = %v, want authcli's error", err)
+	}
+
+	if _, err := ledger.GenerateTGT("client1"); err == nil {
+		t.Error("GenerateTGT() succeeded although authcli failed")
+	}
+}
@@ -0,0 +1,87 @@
+package conformance
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// HTTPTarget drives a client implementation through its conformance endpoint.
+// The implementation exposes three JSON POST operations under a base URL:
+//
+//	/public-key              {"clientID"}                          -> {"publicKey"}
+//	/sign-nonce              {"clientID","nonce"}                  -> {"signature"}
+//	/service-ticket-request  {"clientID","serviceID","encryptedTGT"} -> ServiceTicketRequest
+//
+// Any non-2xx status is treated as the implementation returning an error.
+type HTTPTarget struct {
+	baseURL string
+	client  *http.Client
+}
+
+// NewHTTPTarget creates a target for the implementation at baseURL
+func NewHTTPTarget(baseURL string) *HTTPTarget {
+	return &HTTPTarget{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (t *HTTPTarget) call(path string, request interface{}, response interface{}) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %v", err)
+	}
+
+	resp, err := t.client.Post(t.baseURL+path, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("request to %s failed: %v", path, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response from %s: %v", path, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s returned %s: %s", path, resp.Status, strings.TrimSpace(string(respBody)))
+	}
+
+	if err := json.Unmarshal(respBody, response); err != nil {
+		return fmt.Errorf("invalid JSON response from %s: %v", path, err)
+	}
+	return nil
+}
+
+// PublicKey implements Target
+func (t *HTTPTarget) PublicKey(clientID string) (string, error) {
+	var response struct {
+		PublicKey string `json:"publicKey"`
+	}
+	err := t.call("/public-key", map[string]string{"clientID": clientID}, &response)
+	return response.PublicKey, err
+}
+
+// SignNonce implements Target
+func (t *HTTPTarget) SignNonce(clientID, nonce string) (string, error) {
+	var response struct {
+		Signature string `json:"signature"`
+	}
+	err := t.call("/sign-nonce", map[string]string{"clientID": clientID, "nonce": nonce}, &response)
+	return response.Signature, err
+}
+
+// ServiceTicketRequest implements Target
+func (t *HTTPTarget) ServiceTicketRequest(clientID, serviceID, encryptedTGT string) (map[string]string, error) {
+	var response map[string]string
+	err := t.call("/service-ticket-request", map[string]string{
+		"clientID":     clientID,
+		"serviceID":    serviceID,
+		"encryptedTGT": encryptedTGT,
+	}, &response)
+	return response, err
+}
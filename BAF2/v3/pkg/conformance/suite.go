@@ -0,0 +1,351 @@
+package conformance
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"time"
+)
+
+const (
+	// MinKeySize is the minimum RSA modulus size accepted for client keys
+	MinKeySize = 2048
+
+	// MaxAuthenticatorSkew is the maximum accepted difference between an
+	// authenticator timestamp and the suite's clock
+	MaxAuthenticatorSkew = 5 * time.Minute
+
+	// DefaultServiceID is the service requested during the flow checks
+	DefaultServiceID = "iotservice1"
+)
+
+// Target is a client implementation under test
+type Target interface {
+	// PublicKey returns the PEM-encoded public key the client registers with
+	PublicKey(clientID string) (string, error)
+	// SignNonce returns the base64 signature the client sends for a nonce challenge
+	SignNonce(clientID, nonce string) (string, error)
+	// ServiceTicketRequest returns the request the client sends to the TGS
+	ServiceTicketRequest(clientID, serviceID, encryptedTGT string) (map[string]string, error)
+}
+
+// Network is the ledger side of the authentication flow. When provided to the
+// suite, the target is driven through a real flow against a test network.
+type Network interface {
+	RegisterClient(clientID, publicKeyPEM string) error
+	GetNonceChallenge(clientID string) (string, error)
+	VerifyClientIdentity(clientID, signedNonce string) error
+	GenerateTGT(clientID string) (map[string]string, error)
+	GenerateServiceTicket(request map[string]string) (map[string]string, error)
+}
+
+// Result is the outcome of a single conformance check
+type Result struct {
+	ID          string `json:"id"`
+	Description string `json:"description"`
+	Passed      bool   `json:"passed"`
+	Skipped     bool   `json:"skipped,omitempty"`
+	Detail      string `json:"detail,omitempty"`
+}
+
+// Report collects the results of a suite run
+type Report struct {
+	ClientID string    `json:"clientID"`
+	Started  time.Time `json:"started"`
+	Results  []Result  `json:"results"`
+}
+
+// Failed returns the number of spec violations in the report
+func (r *Report) Failed() int {
+	failed := 0
+	for _, result := range r.Results {
+		if !result.Passed && !result.Skipped {
+			failed++
+		}
+	}
+	return failed
+}
+
+// Suite drives a client implementation through the conformance checks
+type Suite struct {
+	target    Target
+	network   Network
+	clientID  string
+	serviceID string
+
+	// OnResult, if set, is called as each check completes
+	OnResult func(Result)
+}
+
+// NewSuite creates a conformance suite. The network may be nil, in which
+// case only the offline checks run and the flow checks are skipped.
+func NewSuite(target Target, network Network, clientID string) *Suite {
+	if clientID == "" {
+		clientID = fmt.Sprintf("conformance-%d", time.Now().Unix())
+	}
+	return &Suite{
+		target:    target,
+		network:   network,
+		clientID:  clientID,
+		serviceID: DefaultServiceID,
+	}
+}
+
+// Run executes every check and returns the report
+func (s *Suite) Run() *Report {
+	report := &Report{ClientID: s.clientID, Started: time.Now().UTC()}
+	record := func(result Result) {
+		report.Results = append(report.Results, result)
+		if s.OnResult != nil {
+			s.OnResult(result)
+		}
+	}
+
+	publicKey := s.checkKeys(record)
+	s.checkSignatures(record, publicKey)
+	s.checkFlow(record, publicKey)
+
+	return report
+}
+
+// check builds a result from an error (nil means passed)
+func check(id, description string, err error) Result {
+	result := Result{ID: id, Description: description, Passed: err == nil}
+	if err != nil {
+		result.Detail = err.Error()
+	}
+	return result
+}
+
+func skip(id, description, reason string) Result {
+	return Result{ID: id, Description: description, Skipped: true, Detail: reason}
+}
+
+func (s *Suite) checkKeys(record func(Result)) *rsa.PublicKey {
+	const formatDesc = "public key is a PEM-encoded PKIX RSA key"
+	const sizeDesc = "public key modulus is at least 2048 bits"
+
+	publicKey, err := s.parsePublicKey()
+	record(check("KEY-001", formatDesc, err))
+	if err != nil {
+		record(skip("KEY-002", sizeDesc, "no usable public key"))
+		return nil
+	}
+
+	var sizeErr error
+	if bits := publicKey.N.BitLen(); bits < MinKeySize {
+		sizeErr = fmt.Errorf("key is %d bits", bits)
+	}
+	record(check("KEY-002", sizeDesc, sizeErr))
+	return publicKey
+}
+
+func (s *Suite) parsePublicKey() (*rsa.PublicKey, error) {
+	publicKeyPEM, err := s.target.PublicKey(s.clientID)
+	if err != nil {
+		return nil, fmt.Errorf("target failed to return public key: %v", err)
+	}
+
+	block, _ := pem.Decode([]byte(publicKeyPEM))
+	if block == nil {
+		return nil, fmt.Errorf("public key is not PEM encoded")
+	}
+	if block.Type != "PUBLIC KEY" {
+		return nil, fmt.Errorf("PEM block type is %q, expected \"PUBLIC KEY\" (PKIX)", block.Type)
+	}
+
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse PKIX public key: %v", err)
+	}
+	publicKey, ok := parsed.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("public key is %T, expected RSA", parsed)
+	}
+	return publicKey, nil
+}
+
+func (s *Suite) checkSignatures(record func(Result), publicKey *rsa.PublicKey) {
+	const verifyDesc = "nonce signature is RSASSA-PKCS1-v1_5/SHA-256 over the decoded nonce bytes"
+	const freshDesc = "distinct nonces produce distinct signatures"
+	const malformedDesc = "malformed (non-base64) nonces are rejected"
+
+	if publicKey == nil {
+		record(skip("SIG-001", verifyDesc, "no usable public key"))
+		record(skip("SIG-002", freshDesc, "no usable public key"))
+	} else {
+		first, err := s.signRandomNonce(publicKey)
+		record(check("SIG-001", verifyDesc, err))
+
+		if err != nil {
+			record(skip("SIG-002", freshDesc, "signing failed"))
+		} else {
+			second, err := s.signRandomNonce(publicKey)
+			if err == nil && first == second {
+				err = fmt.Errorf("same signature returned for different nonces")
+			}
+			record(check("SIG-002", freshDesc, err))
+		}
+	}
+
+	var malformedErr error
+	if _, err := s.target.SignNonce(s.clientID, "not base64!"); err == nil {
+		malformedErr = fmt.Errorf("target signed a nonce that is not valid base64")
+	}
+	record(check("SIG-003", malformedDesc, malformedErr))
+}
+
+// signRandomNonce has the target sign a fresh nonce and verifies the signature
+func (s *Suite) signRandomNonce(publicKey *rsa.PublicKey) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %v", err)
+	}
+	nonce := base64.StdEncoding.EncodeToString(raw)
+
+	signature, err := s.target.SignNonce(s.clientID, nonce)
+	if err != nil {
+		return "", fmt.Errorf("target failed to sign nonce: %v", err)
+	}
+	return signature, VerifyNonceSignature(publicKey, nonce, signature)
+}
+
+// VerifyNonceSignature verifies a nonce signature the way the AS chaincode does
+func VerifyNonceSignature(publicKey *rsa.PublicKey, nonce, signature string) error {
+	nonceBytes, err := base64.StdEncoding.DecodeString(nonce)
+	if err != nil {
+		return fmt.Errorf("nonce is not valid base64: %v", err)
+	}
+	signatureBytes, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("signature is not valid base64: %v", err)
+	}
+
+	hashed := sha256.Sum256(nonceBytes)
+	if err := rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, hashed[:], signatureBytes); err != nil {
+		// Diagnose the most common mistake: signing the base64 text instead of the bytes
+		textHash := sha256.Sum256([]byte(nonce))
+		if rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, textHash[:], signatureBytes) == nil {
+			return fmt.Errorf("signature covers the base64 nonce text, not the decoded nonce bytes")
+		}
+		return fmt.Errorf("signature verification failed: %v", err)
+	}
+	return nil
+}
+
+// ValidateServiceTicketRequest checks a service ticket request against the canonical format
+func ValidateServiceTicketRequest(request map[string]string, clientID, serviceID, encryptedTGT string, now time.Time) error {
+	for _, field := range []string{"encryptedTGT", "clientID", "serviceID", "authenticator"} {
+		if request[field] == "" {
+			return fmt.Errorf("missing required field %q", field)
+		}
+	}
+	if request["clientID"] != clientID {
+		return fmt.Errorf("clientID is %q, expected %q", request["clientID"], clientID)
+	}
+	if request["serviceID"] != serviceID {
+		return fmt.Errorf("serviceID is %q, expected %q", request["serviceID"], serviceID)
+	}
+	if request["encryptedTGT"] != encryptedTGT {
+		return fmt.Errorf("encryptedTGT was modified; it must be forwarded exactly as issued")
+	}
+
+	authenticatorJSON, err := base64.StdEncoding.DecodeString(request["authenticator"])
+	if err != nil {
+		return fmt.Errorf("authenticator is not valid base64: %v", err)
+	}
+	var authenticator struct {
+		ClientID  string `json:"clientID"`
+		Timestamp int64  `json:"timestamp"`
+	}
+	if err := json.Unmarshal(authenticatorJSON, &authenticator); err != nil {
+		return fmt.Errorf("authenticator is not a JSON object: %v", err)
+	}
+	if authenticator.ClientID != clientID {
+		return fmt.Errorf("authenticator clientID is %q, expected %q", authenticator.ClientID, clientID)
+	}
+	skew := now.Sub(time.Unix(authenticator.Timestamp, 0))
+	if skew < -MaxAuthenticatorSkew || skew > MaxAuthenticatorSkew {
+		return fmt.Errorf("authenticator timestamp is %s away from current time", skew)
+	}
+	return nil
+}
+
+func (s *Suite) checkFlow(record func(Result), publicKey *rsa.PublicKey) {
+	descriptions := []struct{ id, desc string }{
+		{"FLOW-001", "AS accepts the client registration"},
+		{"FLOW-002", "AS accepts the signed nonce challenge"},
+		{"FLOW-003", "AS issues a TGT with encryptedTGT and encryptedSessionKey"},
+		{"FLOW-004", "service ticket request matches the canonical format"},
+		{"FLOW-005", "TGS issues a service ticket for the request"},
+	}
+	skipRest := func(from int, reason string) {
+		for _, d := range descriptions[from:] {
+			record(skip(d.id, d.desc, reason))
+		}
+	}
+
+	if s.network == nil {
+		skipRest(0, "no test network configured")
+		return
+	}
+	if publicKey == nil {
+		skipRest(0, "no usable public key")
+		return
+	}
+
+	publicKeyPEM, err := s.target.PublicKey(s.clientID)
+	if err == nil {
+		err = s.network.RegisterClient(s.clientID, publicKeyPEM)
+	}
+	record(check(descriptions[0].id, descriptions[0].desc, err))
+	if err != nil {
+		skipRest(1, "registration failed")
+		return
+	}
+
+	nonce, err := s.network.GetNonceChallenge(s.clientID)
+	if err == nil {
+		var signature string
+		if signature, err = s.target.SignNonce(s.clientID, nonce); err == nil {
+			err = s.network.VerifyClientIdentity(s.clientID, signature)
+		}
+	}
+	record(check(descriptions[1].id, descriptions[1].desc, err))
+	if err != nil {
+		skipRest(2, "identity verification failed")
+		return
+	}
+
+	tgt, err := s.network.GenerateTGT(s.clientID)
+	if err == nil && (tgt["encryptedTGT"] == "" || tgt["encryptedSessionKey"] == "") {
+		err = fmt.Errorf("TGT response is missing encryptedTGT or encryptedSessionKey")
+	}
+	record(check(descriptions[2].id, descriptions[2].desc, err))
+	if err != nil {
+		skipRest(3, "no TGT issued")
+		return
+	}
+
+	request, err := s.target.ServiceTicketRequest(s.clientID, s.serviceID, tgt["encryptedTGT"])
+	if err == nil {
+		err = ValidateServiceTicketRequest(request, s.clientID, s.serviceID, tgt["encryptedTGT"], time.Now())
+	}
+	record(check(descriptions[3].id, descriptions[3].desc, err))
+	if err != nil {
+		skipRest(4, "invalid service ticket request")
+		return
+	}
+
+	ticket, err := s.network.GenerateServiceTicket(request)
+	if err == nil && ticket["encryptedServiceTicket"] == "" {
+		err = fmt.Errorf("service ticket response is missing encryptedServiceTicket")
+	}
+	record(check(descriptions[4].id, descriptions[4].desc, err))
+}
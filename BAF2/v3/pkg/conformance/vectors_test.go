@@ -0,0 +1,98 @@
+package conformance
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"testing"
+	"time"
+)
+
+// vectorTarget is an in-process Target backed by the published vector key
+type vectorTarget struct {
+	key *rsa.PrivateKey
+}
+
+func newVectorTarget(t *testing.T) *vectorTarget {
+	block, _ := pem.Decode([]byte(VectorPrivateKeyPEM))
+	if block == nil {
+		t.Fatal("vector private key is not PEM encoded")
+	}
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		t.Fatalf("failed to parse vector private key: %v", err)
+	}
+	return &vectorTarget{key: key}
+}
+
+func (v *vectorTarget) PublicKey(string) (string, error) {
+	return VectorPublicKeyPEM, nil
+}
+
+func (v *vectorTarget) SignNonce(_ string, nonce string) (string, error) {
+	nonceBytes, err := base64.StdEncoding.DecodeString(nonce)
+	if err != nil {
+		return "", err
+	}
+	hashed := sha256.Sum256(nonceBytes)
+	signature, err := rsa.SignPKCS1v15(nil, v.key, crypto.SHA256, hashed[:])
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(signature), nil
+}
+
+func (v *vectorTarget) ServiceTicketRequest(clientID, serviceID, encryptedTGT string) (map[string]string, error) {
+	authenticator, _ := json.Marshal(map[string]interface{}{"clientID": clientID, "timestamp": time.Now().Unix()})
+	return map[string]string{
+		"encryptedTGT":  encryptedTGT,
+		"clientID":      clientID,
+		"serviceID":     serviceID,
+		"authenticator": base64.StdEncoding.EncodeToString(authenticator),
+	}, nil
+}
+
+func TestVectorSignatureReproduces(t *testing.T) {
+	target := newVectorTarget(t)
+
+	signature, err := target.SignNonce(VectorClientID, VectorNonce)
+	if err != nil {
+		t.Fatalf("signing vector nonce: %v", err)
+	}
+	if signature != VectorNonceSignature {
+		t.Fatalf("signature does not match vector:\n got %s\nwant %s", signature, VectorNonceSignature)
+	}
+	if err := VerifyNonceSignature(&target.key.PublicKey, VectorNonce, VectorNonceSignature); err != nil {
+		t.Fatalf("vector signature does not verify: %v", err)
+	}
+}
+
+func TestVerifyNonceSignatureDetectsTextSigning(t *testing.T) {
+	target := newVectorTarget(t)
+
+	hashed := sha256.Sum256([]byte(VectorNonce))
+	raw, err := rsa.SignPKCS1v15(nil, target.key, crypto.SHA256, hashed[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = VerifyNonceSignature(&target.key.PublicKey, VectorNonce, base64.StdEncoding.EncodeToString(raw))
+	if err == nil {
+		t.Fatal("expected signature over base64 text to be rejected")
+	}
+}
+
+func TestSuiteOfflinePassesForVectorTarget(t *testing.T) {
+	report := NewSuite(newVectorTarget(t), nil, VectorClientID).Run()
+
+	if report.Failed() != 0 {
+		for _, result := range report.Results {
+			if !result.Passed && !result.Skipped {
+				t.Errorf("%s failed: %s", result.ID, result.Detail)
+			}
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package keystore
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultCacheTTL is how long a KeyCache holds a private key before it must
+// be unlocked again
+const DefaultCacheTTL = 15 * time.Minute
+
+// ErrCacheClosed is returned by a KeyCache after Close
+var ErrCacheClosed = errors.New("key cache is closed")
+
+// CacheOptions configures a KeyCache
+type CacheOptions struct {
+	// TTL is how long a key is held after it is unlocked (default:
+	// DefaultCacheTTL). Once it passes, the held copy is zeroed and the next
+	// use unlocks the key again.
+	TTL time.Duration
+
+	// Unlock returns an identity's PEM private key (default: read it from
+	// the store). The cache zeroes the returned slice once it has copied
+	// the key.
+	Unlock func(id string) ([]byte, error)
+
+	// now returns the current time; tests replace it
+	now func() time.Time
+}
+
+// CacheStats is what a KeyCache holds
+type CacheStats struct {
+	Keys int `json:"keys"`
+	// Locked is how many of the keys are in memory locked against swapping
+	Locked int `json:"locked"`
+}
+
+// KeyCache holds private keys in memory so that they are not read from disk
+// for every use. Each key is kept as DER in a buffer outside the Go heap,
+// locked against swapping where the platform allows (mlock on Unix; where
+// locking fails, e.g. over RLIMIT_MEMLOCK, the buffer is kept unlocked),
+// and zeroed when its TTL passes, when it is evicted and on Close.
+//
+// The key is parsed once, when it is unlocked, and Signer returns the same
+// parsed key until it is dropped; its private values are then zeroed along
+// with the DER. Callers should use it and drop it rather than keep it past
+// its TTL. A KeyCache is safe for concurrent use.
+type KeyCache struct {
+	ttl    time.Duration
+	unlock func(id string) ([]byte, error)
+	now    func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+	closed  bool
+}
+
+type cacheEntry struct {
+	der       *lockedBuffer
+	signer    crypto.Signer
+	expiresAt time.Time
+}
+
+// NewKeyCache returns a cache of the private keys in store
+func NewKeyCache(store *Store, options CacheOptions) *KeyCache {
+	cache := &KeyCache{
+		ttl:     options.TTL,
+		unlock:  options.Unlock,
+		now:     options.now,
+		entries: make(map[string]*cacheEntry),
+	}
+	if cache.ttl <= 0 {
+		cache.ttl = DefaultCacheTTL
+	}
+	if cache.unlock == nil {
+		cache.unlock = func(id string) ([]byte, error) {
+			keyData, err := os.ReadFile(store.PrivateKeyPath(id))
+			if err != nil {
+				return nil, fmt.Errorf("failed to read private key file: %w", err)
+			}
+			return keyData, nil
+		}
+	}
+	if cache.now == nil {
+		cache.now = time.Now
+	}
+	return cache
+}
+
+// Signer returns an identity's private key, RSA or P-256, unlocking it if
+// it is not held or its TTL has passed
+func (c *KeyCache) Signer(id string) (crypto.Signer, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil, ErrCacheClosed
+	}
+
+	entry := c.entries[id]
+	if entry != nil && !c.now().Before(entry.expiresAt) {
+		c.evictLocked(id)
+		entry = nil
+	}
+	if entry == nil {
+		var err error
+		if entry, err = c.load(id); err != nil {
+			return nil, err
+		}
+		c.entries[id] = entry
+	}
+	return entry.signer, nil
+}
+
+// load unlocks and parses a key and copies its DER into a locked buffer,
+// zeroing the PEM it was given
+func (c *KeyCache) load(id string) (*cacheEntry, error) {
+	pemData, err := c.unlock(id)
+	if err != nil {
+		return nil, err
+	}
+	defer zero(pemData)
+
+	block, _ := pem.Decode(pemData)
+	if block == nil {
+		return nil, errors.New("failed to decode PEM block")
+	}
+	defer zero(block.Bytes)
+	signer, err := parseSigner(block.Type, block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := newLockedBuffer(len(block.Bytes))
+	if err != nil {
+		wipeSigner(signer)
+		return nil, err
+	}
+	copy(der.data, block.Bytes)
+	return &cacheEntry{der: der, signer: signer, expiresAt: c.now().Add(c.ttl)}, nil
+}
+
+// Evict zeroes and drops an identity's held key, e.g. after its key pair
+// is replaced on disk
+func (c *KeyCache) Evict(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.evictLocked(id)
+}
+
+func (c *KeyCache) evictLocked(id string) {
+	if entry, ok := c.entries[id]; ok {
+		entry.der.release()
+		wipeSigner(entry.signer)
+		delete(c.entries, id)
+	}
+}
+
+// Stats reports how many keys the cache holds and how many of them are in
+// locked memory
+func (c *KeyCache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := CacheStats{Keys: len(c.entries)}
+	for _, entry := range c.entries {
+		if entry.der.locked {
+			stats.Locked++
+		}
+	}
+	return stats
+}
+
+// Close zeroes every held key. Signer fails with ErrCacheClosed afterwards.
+func (c *KeyCache) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id := range c.entries {
+		c.evictLocked(id)
+	}
+	c.closed = true
+}
+
+// wipeSigner zeroes the private values of a parsed key. The standard library
+// keeps derived values of an RSA key that cannot be reached from outside, so
+// this leaves less of the key in memory rather than none.
+func wipeSigner(signer crypto.Signer) {
+	switch key := signer.(type) {
+	case *rsa.PrivateKey:
+		wipeInt(key.D)
+		for _, prime := range key.Primes {
+			wipeInt(prime)
+		}
+		wipeInt(key.Precomputed.Dp)
+		wipeInt(key.Precomputed.Dq)
+		wipeInt(key.Precomputed.Qinv)
+		for _, value := range key.Precomputed.CRTValues {
+			wipeInt(value.Exp)
+			wipeInt(value.Coeff)
+			wipeInt(value.R)
+		}
+	case *ecdsa.PrivateKey:
+		wipeInt(key.D)
+	}
+}
+
+// wipeInt overwrites the words of n and sets it to zero
+func wipeInt(n *big.Int) {
+	if n == nil {
+		return
+	}
+	words := n.Bits()
+	for i := range words {
+		words[i] = 0
+	}
+	n.SetInt64(0)
+}
+
+// zero overwrites b with zeros
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
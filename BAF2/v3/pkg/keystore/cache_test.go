@@ -0,0 +1,137 @@
+package keystore
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/pem"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestKeyCache(t *testing.T) {
+	store := New(t.TempDir())
+	if _, err := store.LoadOrGenerateKey("client1", KeyTypeP256, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(1700000000, 0)
+	unlocks := 0
+	var lastPEM []byte
+	cache := NewKeyCache(store, CacheOptions{
+		TTL: time.Minute,
+		Unlock: func(id string) ([]byte, error) {
+			unlocks++
+			keyData, err := os.ReadFile(store.PrivateKeyPath(id))
+			lastPEM = keyData
+			return keyData, err
+		},
+		now: func() time.Time { return now },
+	})
+
+	first, err := cache.Signer("client1")
+	if err != nil {
+		t.Fatalf("Signer() error = %v", err)
+	}
+	if _, err := cache.Signer("client1"); err != nil || unlocks != 1 {
+		t.Errorf("second Signer() unlocked again (%d unlocks, error %v)", unlocks, err)
+	}
+	for _, b := range lastPEM {
+		if b != 0 {
+			t.Fatal("the unlocked PEM was not zeroed")
+		}
+	}
+
+	now = now.Add(time.Minute)
+	second, err := cache.Signer("client1")
+	if err != nil || unlocks != 2 {
+		t.Errorf("Signer() after the TTL did not unlock again (%d unlocks, error %v)", unlocks, err)
+	}
+	if first == second {
+		t.Error("Signer() returned the same key object twice")
+	}
+
+	if stats := cache.Stats(); stats.Keys != 1 {
+		t.Errorf("Stats().Keys = %d, want 1", stats.Keys)
+	}
+	cache.Evict("client1")
+	if stats := cache.Stats(); stats.Keys != 0 {
+		t.Errorf("Stats().Keys after Evict = %d, want 0", stats.Keys)
+	}
+
+	cache.Close()
+	if _, err := cache.Signer("client1"); !errors.Is(err, ErrCacheClosed) {
+		t.Errorf("Signer() after Close error = %v, want ErrCacheClosed", err)
+	}
+}
+
+func TestKeyCacheDefaultUnlock(t *testing.T) {
+	store := New(t.TempDir())
+	privateKey, _, err := store.LoadOrGenerate("device1", 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := NewKeyCache(store, CacheOptions{})
+	defer cache.Close()
+
+	signer, err := cache.Signer("device1")
+	if err != nil {
+		t.Fatalf("Signer() error = %v", err)
+	}
+	rsaKey, ok := signer.(*rsa.PrivateKey)
+	if !ok || !rsaKey.Equal(privateKey) {
+		t.Error("Signer() did not return the stored RSA key")
+	}
+	if _, err := cache.Signer("missing"); err == nil {
+		t.Error("Signer() found a key that is not stored")
+	}
+}
+
+func TestKeyCacheRejectsBadKey(t *testing.T) {
+	cache := NewKeyCache(New(t.TempDir()), CacheOptions{
+		Unlock: func(string) ([]byte, error) {
+			return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: []byte("not a key")}), nil
+		},
+	})
+	defer cache.Close()
+	if _, err := cache.Signer("client1"); err == nil {
+		t.Error("Signer() accepted a malformed key")
+	}
+	if stats := cache.Stats(); stats.Keys != 0 {
+		t.Error("a malformed key was cached")
+	}
+}
+
+func TestKeyCacheParsesOnceAndWipes(t *testing.T) {
+	store := New(t.TempDir())
+	if _, err := store.LoadOrGenerateKey("client1", KeyTypeP256, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := store.LoadOrGenerate("device1", 2048); err != nil {
+		t.Fatal(err)
+	}
+	cache := NewKeyCache(store, CacheOptions{})
+
+	ecSigner, err := cache.Signer("client1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, err := cache.Signer("client1"); err != nil || again != ecSigner {
+		t.Errorf("Signer() parsed the held key again (error %v)", err)
+	}
+	rsaSigner, err := cache.Signer("device1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cache.Evict("client1")
+	if ecKey := ecSigner.(*ecdsa.PrivateKey); ecKey.D.Sign() != 0 {
+		t.Error("Evict() did not wipe the EC key")
+	}
+	cache.Close()
+	rsaKey := rsaSigner.(*rsa.PrivateKey)
+	if rsaKey.D.Sign() != 0 || rsaKey.Primes[0].Sign() != 0 || rsaKey.Precomputed.Dp.Sign() != 0 {
+		t.Error("Close() did not wipe the RSA key")
+	}
+}
@@ -0,0 +1,3 @@
+module github.com/chaichis-network/v3/pkg/keystore
+
+go 1.18
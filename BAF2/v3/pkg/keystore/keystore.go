@@ -0,0 +1,361 @@
+// Package keystore stores the key pairs that identify clients and devices:
+// RSA, or elliptic-curve keys on P-256.
+//
+// Private keys are written as PKCS#1 (RSA) or SEC 1 (EC) PEM files readable
+// only by the owner; public keys as PKIX PEM files. PKCS#8 private keys are
+// accepted on load. A KeyCache holds private keys in locked memory for
+// processes that use them repeatedly.
+//
+// This package is a separately versioned module; see docs/api-stability.md.
+package keystore
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// DefaultKeySize is the default RSA key size in bits
+const DefaultKeySize = 2048
+
+// Key types, as the chaincodes record them on client and device records
+const (
+	KeyTypeRSA  = "rsa"
+	KeyTypeP256 = "ec-p256"
+)
+
+// Store keeps key pairs in a directory, one <id>-private.pem and
+// <id>-public.pem file per identity
+type Store struct {
+	dir string
+}
+
+// New returns a store rooted at dir. The directory is created on first save.
+func New(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+// Dir returns the directory the store keeps keys in
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// PrivateKeyPath returns the path of an identity's private key file
+func (s *Store) PrivateKeyPath(id string) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%s-private.pem", id))
+}
+
+// PublicKeyPath returns the path of an identity's public key file
+func (s *Store) PublicKeyPath(id string) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%s-public.pem", id))
+}
+
+// GenerateKeyPair generates a new RSA key pair
+func GenerateKeyPair(keySize int) (*rsa.PrivateKey, *rsa.PublicKey, error) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, keySize)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate RSA key pair: %w", err)
+	}
+	return privateKey, &privateKey.PublicKey, nil
+}
+
+// GenerateECKeyPair generates a new P-256 key pair
+func GenerateECKeyPair() (*ecdsa.PrivateKey, error) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate P-256 key pair: %w", err)
+	}
+	return privateKey, nil
+}
+
+// KeyType returns the key type of an RSA or P-256 public key, or "" for any
+// other key
+func KeyType(publicKey crypto.PublicKey) string {
+	switch publicKey := publicKey.(type) {
+	case *rsa.PublicKey:
+		return KeyTypeRSA
+	case *ecdsa.PublicKey:
+		if publicKey.Curve == elliptic.P256() {
+			return KeyTypeP256
+		}
+	}
+	return ""
+}
+
+// SavePrivateKey saves a private key in PKCS#1 format with mode 0600
+func (s *Store) SavePrivateKey(id string, privateKey *rsa.PrivateKey) (string, error) {
+	block := &pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(privateKey),
+	}
+	return s.writePEM(s.PrivateKeyPath(id), block, 0600)
+}
+
+// SavePublicKey saves a public key in PKIX format
+func (s *Store) SavePublicKey(id string, publicKey *rsa.PublicKey) (string, error) {
+	publicKeyBytes, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal public key: %w", err)
+	}
+	block := &pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: publicKeyBytes,
+	}
+	return s.writePEM(s.PublicKeyPath(id), block, 0644)
+}
+
+// SaveECPrivateKey saves a P-256 private key in SEC 1 format with mode 0600
+func (s *Store) SaveECPrivateKey(id string, privateKey *ecdsa.PrivateKey) (string, error) {
+	privateKeyBytes, err := x509.MarshalECPrivateKey(privateKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal private key: %w", err)
+	}
+	block := &pem.Block{
+		Type:  "EC PRIVATE KEY",
+		Bytes: privateKeyBytes,
+	}
+	return s.writePEM(s.PrivateKeyPath(id), block, 0600)
+}
+
+// SaveECPublicKey saves a P-256 public key in PKIX format
+func (s *Store) SaveECPublicKey(id string, publicKey *ecdsa.PublicKey) (string, error) {
+	publicKeyBytes, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal public key: %w", err)
+	}
+	block := &pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: publicKeyBytes,
+	}
+	return s.writePEM(s.PublicKeyPath(id), block, 0644)
+}
+
+// LoadPrivateKey loads an identity's private key
+func (s *Store) LoadPrivateKey(id string) (*rsa.PrivateKey, error) {
+	keyData, err := os.ReadFile(s.PrivateKeyPath(id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key file: %w", err)
+	}
+	return ParsePrivateKeyPEM(keyData)
+}
+
+// LoadSigner loads an identity's private key, RSA or P-256
+func (s *Store) LoadSigner(id string) (crypto.Signer, error) {
+	keyData, err := os.ReadFile(s.PrivateKeyPath(id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key file: %w", err)
+	}
+	return ParseSignerPEM(keyData)
+}
+
+// LoadPublicKey loads an identity's public key
+func (s *Store) LoadPublicKey(id string) (*rsa.PublicKey, error) {
+	keyData, err := os.ReadFile(s.PublicKeyPath(id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read public key file: %w", err)
+	}
+	return ParsePublicKeyPEM(keyData)
+}
+
+// LoadVerifier loads an identity's public key, RSA or P-256
+func (s *Store) LoadVerifier(id string) (crypto.PublicKey, error) {
+	keyData, err := os.ReadFile(s.PublicKeyPath(id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read public key file: %w", err)
+	}
+	return ParseVerifierPEM(keyData)
+}
+
+// PublicKeyPEM returns an identity's PEM-encoded public key
+func (s *Store) PublicKeyPEM(id string) (string, error) {
+	keyData, err := os.ReadFile(s.PublicKeyPath(id))
+	if err != nil {
+		return "", fmt.Errorf("failed to read public key file: %w", err)
+	}
+	return string(keyData), nil
+}
+
+// LoadOrGenerate loads an identity's key pair, generating and saving a new
+// one of keySize bits if none exists
+func (s *Store) LoadOrGenerate(id string, keySize int) (*rsa.PrivateKey, *rsa.PublicKey, error) {
+	if _, err := os.Stat(s.PrivateKeyPath(id)); err == nil {
+		privateKey, err := s.LoadPrivateKey(id)
+		if err != nil {
+			return nil, nil, err
+		}
+		return privateKey, &privateKey.PublicKey, nil
+	}
+
+	privateKey, publicKey, err := GenerateKeyPair(keySize)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := s.SavePrivateKey(id, privateKey); err != nil {
+		return nil, nil, err
+	}
+	if _, err := s.SavePublicKey(id, publicKey); err != nil {
+		return nil, nil, err
+	}
+	return privateKey, publicKey, nil
+}
+
+// LoadOrGenerateKey loads an identity's private key, of whatever type it
+// is, generating and saving a new key pair of keyType if none exists. RSA
+// keys are keySize bits.
+func (s *Store) LoadOrGenerateKey(id string, keyType string, keySize int) (crypto.Signer, error) {
+	if _, err := os.Stat(s.PrivateKeyPath(id)); err == nil {
+		return s.LoadSigner(id)
+	}
+
+	switch keyType {
+	case KeyTypeRSA:
+		privateKey, _, err := s.LoadOrGenerate(id, keySize)
+		if err != nil {
+			return nil, err
+		}
+		return privateKey, nil
+	case KeyTypeP256:
+		privateKey, err := GenerateECKeyPair()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := s.SaveECPrivateKey(id, privateKey); err != nil {
+			return nil, err
+		}
+		if _, err := s.SaveECPublicKey(id, &privateKey.PublicKey); err != nil {
+			return nil, err
+		}
+		return privateKey, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q (expected %s or %s)", keyType, KeyTypeRSA, KeyTypeP256)
+}
+
+// ParsePrivateKeyPEM parses a PKCS#1 or PKCS#8 RSA private key
+func ParsePrivateKeyPEM(pemData []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(pemData)
+	if block == nil {
+		return nil, errors.New("failed to decode PEM block")
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse PKCS1 private key: %w", err)
+		}
+		return privateKey, nil
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse PKCS8 private key: %w", err)
+		}
+		privateKey, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("not an RSA private key")
+		}
+		return privateKey, nil
+	default:
+		return nil, errors.New("unsupported private key format")
+	}
+}
+
+// ParsePublicKeyPEM parses a PKIX RSA public key
+func ParsePublicKeyPEM(pemData []byte) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode(pemData)
+	if block == nil {
+		return nil, errors.New("failed to decode PEM block")
+	}
+
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key: %w", err)
+	}
+	rsaKey, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("not an RSA public key")
+	}
+	return rsaKey, nil
+}
+
+// ParseSignerPEM parses a PKCS#1 RSA, SEC 1 P-256 or PKCS#8 private key of
+// either type
+func ParseSignerPEM(pemData []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(pemData)
+	if block == nil {
+		return nil, errors.New("failed to decode PEM block")
+	}
+	return parseSigner(block.Type, block.Bytes)
+}
+
+// parseSigner parses the DER of a private key PEM block of the given type
+func parseSigner(blockType string, der []byte) (crypto.Signer, error) {
+	var key interface{}
+	var err error
+	switch blockType {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(der)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse PKCS1 private key: %w", err)
+		}
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(der)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse EC private key: %w", err)
+		}
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(der)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse PKCS8 private key: %w", err)
+		}
+	default:
+		return nil, errors.New("unsupported private key format")
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok || KeyType(signer.Public()) == "" {
+		return nil, errors.New("not an RSA or P-256 private key")
+	}
+	return signer, nil
+}
+
+// ParseVerifierPEM parses a PKIX RSA or P-256 public key
+func ParseVerifierPEM(pemData []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(pemData)
+	if block == nil {
+		return nil, errors.New("failed to decode PEM block")
+	}
+
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key: %w", err)
+	}
+	if KeyType(pub) == "" {
+		return nil, errors.New("not an RSA or P-256 public key")
+	}
+	return pub, nil
+}
+
+func (s *Store) writePEM(path string, block *pem.Block, mode os.FileMode) (string, error) {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create key directory: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return "", fmt.Errorf("failed to create key file: %w", err)
+	}
+	defer file.Close()
+
+	if err := pem.Encode(file, block); err != nil {
+		return "", fmt.Errorf("failed to write key file: %w", err)
+	}
+	return path, nil
+}
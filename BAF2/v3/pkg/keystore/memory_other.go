@@ -0,0 +1,20 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+
+package keystore
+
+// lockedBuffer holds key material on the heap where memory cannot be
+// locked; it is still zeroed on release
+type lockedBuffer struct {
+	data   []byte
+	locked bool
+}
+
+func newLockedBuffer(size int) (*lockedBuffer, error) {
+	return &lockedBuffer{data: make([]byte, size)}, nil
+}
+
+// release zeroes the buffer
+func (b *lockedBuffer) release() {
+	zero(b.data)
+	b.data = nil
+}
@@ -0,0 +1,40 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package keystore
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// lockedBuffer holds key material in an anonymous mapping outside the Go
+// heap, locked against swapping unless the process may not lock more
+// memory
+type lockedBuffer struct {
+	data   []byte
+	locked bool
+}
+
+func newLockedBuffer(size int) (*lockedBuffer, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("invalid key size %d", size)
+	}
+	data, err := syscall.Mmap(-1, 0, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_ANON|syscall.MAP_PRIVATE)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map key memory: %w", err)
+	}
+	return &lockedBuffer{data: data, locked: syscall.Mlock(data) == nil}, nil
+}
+
+// release zeroes, unlocks and unmaps the buffer
+func (b *lockedBuffer) release() {
+	if b.data == nil {
+		return
+	}
+	zero(b.data)
+	if b.locked {
+		syscall.Munlock(b.data)
+	}
+	syscall.Munmap(b.data)
+	b.data = nil
+}
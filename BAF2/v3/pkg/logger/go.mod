@@ -0,0 +1,7 @@
+module github.com/chaichis-network/v3/pkg/logger
+
+go 1.18
+
+require github.com/sirupsen/logrus v1.9.0
+
+require golang.org/x/sys v0.3.0 // indirect
@@ -1,3 +1,6 @@
+// Package logger wraps logrus with the defaults used by the CLI.
+//
+// This package is a separately versioned module; see docs/api-stability.md.
 package logger
 
 import (
@@ -0,0 +1,245 @@
+package progress
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Mode selects how progress is rendered
+type Mode string
+
+const (
+	// ModeAuto renders a bar on terminals and plain lines otherwise
+	ModeAuto Mode = "auto"
+	// ModeBar renders an in-place progress bar
+	ModeBar Mode = "bar"
+	// ModePlain emits periodic human-readable progress lines
+	ModePlain Mode = "plain"
+	// ModeJSON emits periodic structured progress lines (one JSON object per line)
+	ModeJSON Mode = "json"
+	// ModeNone disables progress output
+	ModeNone Mode = "none"
+)
+
+// DefaultInterval is the minimum time between line-based progress updates
+const DefaultInterval = 2 * time.Second
+
+const barWidth = 30
+
+// Reporter reports the progress of a long-running operation
+type Reporter interface {
+	// Step advances progress by one unit and records what is being worked on
+	Step(message string)
+	// Set moves progress to an absolute position
+	Set(current int, message string)
+	// Done marks the operation as finished, successfully if err is nil
+	Done(err error)
+}
+
+// ParseMode converts a flag value into a Mode
+func ParseMode(value string) (Mode, error) {
+	switch Mode(strings.ToLower(value)) {
+	case "", ModeAuto:
+		return ModeAuto, nil
+	case ModeBar:
+		return ModeBar, nil
+	case ModePlain:
+		return ModePlain, nil
+	case ModeJSON:
+		return ModeJSON, nil
+	case ModeNone:
+		return ModeNone, nil
+	}
+	return "", fmt.Errorf("unknown progress mode %q (expected auto, bar, plain, json or none)", value)
+}
+
+// New creates a reporter for an operation with the given number of steps.
+// A total of zero means the number of steps is unknown.
+func New(w io.Writer, mode Mode, operation string, total int) Reporter {
+	if mode == ModeAuto {
+		if isTerminal(w) {
+			mode = ModeBar
+		} else {
+			mode = ModePlain
+		}
+	}
+
+	if mode == ModeNone {
+		return Nop()
+	}
+
+	return &reporter{
+		out:       w,
+		mode:      mode,
+		operation: operation,
+		total:     total,
+		interval:  DefaultInterval,
+		started:   time.Now(),
+	}
+}
+
+// Nop returns a reporter that discards all progress
+func Nop() Reporter {
+	return nopReporter{}
+}
+
+type nopReporter struct{}
+
+func (nopReporter) Step(string)     {}
+func (nopReporter) Set(int, string) {}
+func (nopReporter) Done(error)      {}
+
+type reporter struct {
+	mu        sync.Mutex
+	out       io.Writer
+	mode      Mode
+	operation string
+	total     int
+	current   int
+	message   string
+	interval  time.Duration
+	started   time.Time
+	lastEmit  time.Time
+	finished  bool
+}
+
+// progressLine is the structured form of a progress update in JSON mode
+type progressLine struct {
+	Time      string  `json:"time"`
+	Operation string  `json:"operation"`
+	Status    string  `json:"status"`
+	Current   int     `json:"current"`
+	Total     int     `json:"total,omitempty"`
+	Percent   float64 `json:"percent,omitempty"`
+	Message   string  `json:"message,omitempty"`
+	Elapsed   string  `json:"elapsed"`
+	Error     string  `json:"error,omitempty"`
+}
+
+func (r *reporter) Step(message string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.update(r.current+1, message)
+}
+
+func (r *reporter) Set(current int, message string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.update(current, message)
+}
+
+func (r *reporter) Done(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.finished {
+		return
+	}
+	r.finished = true
+
+	status := "done"
+	if err != nil {
+		status = "failed"
+	} else if r.total > 0 {
+		r.current = r.total
+	}
+	r.emit(status, err)
+	if r.mode == ModeBar {
+		fmt.Fprintln(r.out)
+	}
+}
+
+func (r *reporter) update(current int, message string) {
+	if r.finished {
+		return
+	}
+	r.current = current
+	r.message = message
+
+	// Bars are cheap to redraw; line modes are throttled so logs stay readable
+	now := time.Now()
+	if r.mode != ModeBar && !r.lastEmit.IsZero() && now.Sub(r.lastEmit) < r.interval && current != r.total {
+		return
+	}
+	r.lastEmit = now
+	r.emit("running", nil)
+}
+
+func (r *reporter) percent() float64 {
+	if r.total <= 0 {
+		return 0
+	}
+	return float64(r.current) * 100 / float64(r.total)
+}
+
+func (r *reporter) emit(status string, err error) {
+	elapsed := time.Since(r.started).Truncate(time.Millisecond)
+
+	switch r.mode {
+	case ModeJSON:
+		line := progressLine{
+			Time:      time.Now().UTC().Format(time.RFC3339),
+			Operation: r.operation,
+			Status:    status,
+			Current:   r.current,
+			Total:     r.total,
+			Percent:   r.percent(),
+			Message:   r.message,
+			Elapsed:   elapsed.String(),
+		}
+		if err != nil {
+			line.Error = err.Error()
+		}
+		data, _ := json.Marshal(line)
+		fmt.Fprintln(r.out, string(data))
+
+	case ModeBar:
+		fmt.Fprintf(r.out, "\r\033[K%s %s %s", r.operation, r.bar(), r.message)
+		if err != nil {
+			fmt.Fprintf(r.out, " (failed: %v)", err)
+		}
+
+	default:
+		counter := fmt.Sprintf("%d", r.current)
+		if r.total > 0 {
+			counter = fmt.Sprintf("%d/%d (%.0f%%)", r.current, r.total, r.percent())
+		}
+		line := fmt.Sprintf("[%s] %s %s elapsed=%s", r.operation, status, counter, elapsed)
+		if r.message != "" {
+			line += " - " + r.message
+		}
+		if err != nil {
+			line += fmt.Sprintf(" error=%v", err)
+		}
+		fmt.Fprintln(r.out, line)
+	}
+}
+
+func (r *reporter) bar() string {
+	if r.total <= 0 {
+		return fmt.Sprintf("[%d]", r.current)
+	}
+	filled := r.current * barWidth / r.total
+	if filled > barWidth {
+		filled = barWidth
+	}
+	return fmt.Sprintf("[%s%s] %3.0f%%", strings.Repeat("=", filled), strings.Repeat(" ", barWidth-filled), r.percent())
+}
+
+// isTerminal reports whether w is an interactive character device
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,275 @@
+// Package securechannel frames the traffic between a client and a device
+// within one session. Each frame carries a stream ID, so one session can
+// multiplex several logical streams (telemetry, control, logs) instead of
+// opening a session per concern. Frames are sealed with AES-256-GCM under
+// the session key; the header is authenticated with the payload.
+//
+// A frame is
+//
+//	version (1) | stream ID (2) | sequence (8) | length (4) | sealed payload
+//
+// with integers big-endian. Sequence numbers count from 1 per stream and
+// direction, and the receiver refuses any that does not grow, so frames
+// cannot be replayed or moved to another stream. The nonce is the sender's
+// role, the stream ID and the sequence number, so the two ends never reuse
+// a nonce under the shared key.
+//
+// Stream 0 is the control stream and is always open. Other streams are
+// opened at both ends after the device agent has opened them in the ISV
+// (OpenSessionStream), which checks the stream's capability against the
+// session. The Counters of a stream are what the agent reports to the ISV.
+package securechannel
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+const (
+	// Version is the frame format version
+	Version = 1
+
+	// KeySize is the size in bytes of the session key
+	KeySize = 32
+
+	// ControlStream is the stream that is always open
+	ControlStream uint16 = 0
+
+	// MaxPayloadSize is the largest payload of one frame
+	MaxPayloadSize = 64 * 1024
+
+	// HeaderSize is the size in bytes of a frame header
+	HeaderSize = 1 + 2 + 8 + 4
+
+	tagSize   = 16
+	nonceSize = 12
+)
+
+var (
+	// ErrStreamNotOpen is returned for frames of a stream that is not open
+	ErrStreamNotOpen = errors.New("stream is not open")
+	// ErrReplay is returned for a frame whose sequence number does not grow
+	ErrReplay = errors.New("frame replayed or out of order")
+	// ErrFrameTooLarge is returned for a payload over MaxPayloadSize
+	ErrFrameTooLarge = errors.New("frame too large")
+)
+
+// Role is the end of the channel a Channel sends from
+type Role byte
+
+const (
+	RoleClient Role = 1
+	RoleDevice Role = 2
+)
+
+func (r Role) peer() Role {
+	if r == RoleClient {
+		return RoleDevice
+	}
+	return RoleClient
+}
+
+// Counters are the traffic of one stream at one end: messages and payload
+// bytes sent and received, and frames refused
+type Counters struct {
+	Messages int64 `json:"messages"`
+	Bytes    int64 `json:"bytes"`
+	Rejected int64 `json:"rejected"`
+}
+
+type stream struct {
+	open     bool
+	sendSeq  uint64
+	recvSeq  uint64
+	counters Counters
+}
+
+// Channel seals and opens the frames of one end of a session. It is safe
+// for concurrent use.
+type Channel struct {
+	aead cipher.AEAD
+	role Role
+
+	mu      sync.Mutex
+	streams map[uint16]*stream
+}
+
+// New creates the channel of one end of a session from the session key
+func New(sessionKey []byte, role Role) (*Channel, error) {
+	if len(sessionKey) != KeySize {
+		return nil, fmt.Errorf("session key is %d bytes, want %d", len(sessionKey), KeySize)
+	}
+	if role != RoleClient && role != RoleDevice {
+		return nil, fmt.Errorf("invalid role %d", role)
+	}
+	block, err := aes.NewCipher(sessionKey)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Channel{
+		aead:    aead,
+		role:    role,
+		streams: map[uint16]*stream{ControlStream: {open: true}},
+	}, nil
+}
+
+// OpenStream opens a stream at this end. A stream ID is used once per
+// session, so reopening a closed stream fails.
+func (c *Channel) OpenStream(streamID uint16) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.streams[streamID]; ok {
+		return fmt.Errorf("stream %d was already opened", streamID)
+	}
+	c.streams[streamID] = &stream{open: true}
+	return nil
+}
+
+// CloseStream closes a stream at this end. Its counters remain readable.
+func (c *Channel) CloseStream(streamID uint16) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s, ok := c.streams[streamID]
+	if !ok || !s.open {
+		return fmt.Errorf("stream %d: %w", streamID, ErrStreamNotOpen)
+	}
+	if streamID == ControlStream {
+		return errors.New("the control stream cannot be closed")
+	}
+	s.open = false
+	return nil
+}
+
+// Counters returns the counters of a stream, and false if it was never
+// opened
+func (c *Channel) Counters(streamID uint16) (Counters, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s, ok := c.streams[streamID]
+	if !ok {
+		return Counters{}, false
+	}
+	return s.counters, true
+}
+
+// Seal returns the frame carrying payload on a stream
+func (c *Channel) Seal(streamID uint16, payload []byte) ([]byte, error) {
+	if len(payload) > MaxPayloadSize {
+		return nil, ErrFrameTooLarge
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s, ok := c.streams[streamID]
+	if !ok || !s.open {
+		return nil, fmt.Errorf("stream %d: %w", streamID, ErrStreamNotOpen)
+	}
+	s.sendSeq++
+
+	frame := make([]byte, HeaderSize, HeaderSize+len(payload)+tagSize)
+	putHeader(frame, streamID, s.sendSeq, len(payload)+tagSize)
+	frame = c.aead.Seal(frame, nonce(c.role, streamID, s.sendSeq), payload, frame[:HeaderSize])
+
+	s.counters.Messages++
+	s.counters.Bytes += int64(len(payload))
+	return frame, nil
+}
+
+// Open checks a frame from the other end and returns its stream and
+// payload. A frame refused on an open stream counts as rejected.
+func (c *Channel) Open(frame []byte) (uint16, []byte, error) {
+	if len(frame) < HeaderSize+tagSize {
+		return 0, nil, errors.New("frame too short")
+	}
+	if frame[0] != Version {
+		return 0, nil, fmt.Errorf("unsupported frame version %d", frame[0])
+	}
+	streamID := binary.BigEndian.Uint16(frame[1:3])
+	seq := binary.BigEndian.Uint64(frame[3:11])
+	length := binary.BigEndian.Uint32(frame[11:15])
+	if int(length) != len(frame)-HeaderSize {
+		return 0, nil, fmt.Errorf("frame length %d does not match its header (%d)", len(frame)-HeaderSize, length)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s, ok := c.streams[streamID]
+	if !ok {
+		return streamID, nil, fmt.Errorf("stream %d: %w", streamID, ErrStreamNotOpen)
+	}
+	if !s.open {
+		s.counters.Rejected++
+		return streamID, nil, fmt.Errorf("stream %d: %w", streamID, ErrStreamNotOpen)
+	}
+	if seq <= s.recvSeq {
+		s.counters.Rejected++
+		return streamID, nil, fmt.Errorf("stream %d sequence %d: %w", streamID, seq, ErrReplay)
+	}
+	payload, err := c.aead.Open(nil, nonce(c.role.peer(), streamID, seq), frame[HeaderSize:], frame[:HeaderSize])
+	if err != nil {
+		s.counters.Rejected++
+		return streamID, nil, fmt.Errorf("stream %d: frame failed authentication", streamID)
+	}
+	s.recvSeq = seq
+
+	s.counters.Messages++
+	s.counters.Bytes += int64(len(payload))
+	return streamID, payload, nil
+}
+
+// WriteFrame writes a sealed frame to w
+func WriteFrame(w io.Writer, frame []byte) error {
+	_, err := w.Write(frame)
+	return err
+}
+
+// ReadFrame reads one frame from r, refusing frames whose header announces
+// more than MaxPayloadSize
+func ReadFrame(r io.Reader) ([]byte, error) {
+	header := make([]byte, HeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	length := binary.BigEndian.Uint32(header[11:15])
+	if length > MaxPayloadSize+tagSize {
+		return nil, ErrFrameTooLarge
+	}
+	frame := make([]byte, HeaderSize+int(length))
+	copy(frame, header)
+	if _, err := io.ReadFull(r, frame[HeaderSize:]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return frame, nil
+}
+
+func putHeader(header []byte, streamID uint16, seq uint64, length int) {
+	header[0] = Version
+	binary.BigEndian.PutUint16(header[1:3], streamID)
+	binary.BigEndian.PutUint64(header[3:11], seq)
+	binary.BigEndian.PutUint32(header[11:15], uint32(length))
+}
+
+func nonce(sender Role, streamID uint16, seq uint64) []byte {
+	n := make([]byte, nonceSize)
+	n[0] = byte(sender)
+	binary.BigEndian.PutUint16(n[2:4], streamID)
+	binary.BigEndian.PutUint64(n[4:12], seq)
+	return n
+}
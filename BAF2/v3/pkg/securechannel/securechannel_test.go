@@ -0,0 +1,171 @@
+package securechannel
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func pair(t *testing.T) (*Channel, *Channel) {
+	t.Helper()
+	key := bytes.Repeat([]byte{0x42}, KeySize)
+	client, err := New(key, RoleClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	device, err := New(key, RoleDevice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, device
+}
+
+func TestStreamsRoundTrip(t *testing.T) {
+	client, device := pair(t)
+	for _, ch := range []*Channel{client, device} {
+		if err := ch.OpenStream(1); err != nil {
+			t.Fatal(err)
+		}
+		if err := ch.OpenStream(2); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	messages := []struct {
+		stream  uint16
+		payload string
+	}{{1, "temperature=21.5"}, {2, "reboot"}, {1, "temperature=21.7"}, {ControlStream, "ping"}}
+	for _, m := range messages {
+		frame, err := client.Seal(m.stream, []byte(m.payload))
+		if err != nil {
+			t.Fatal(err)
+		}
+		stream, payload, err := device.Open(frame)
+		if err != nil {
+			t.Fatalf("Open() error = %v", err)
+		}
+		if stream != m.stream || string(payload) != m.payload {
+			t.Errorf("Open() = %d %q, want %d %q", stream, payload, m.stream, m.payload)
+		}
+	}
+
+	counters, ok := device.Counters(1)
+	if !ok || counters != (Counters{Messages: 2, Bytes: 32}) {
+		t.Errorf("Counters(1) = %+v %v", counters, ok)
+	}
+	if counters, _ := client.Counters(2); counters != (Counters{Messages: 1, Bytes: 6}) {
+		t.Errorf("client Counters(2) = %+v", counters)
+	}
+}
+
+func TestOpenRefusesFrames(t *testing.T) {
+	client, device := pair(t)
+	client.OpenStream(1)
+	client.OpenStream(2)
+	device.OpenStream(1)
+
+	first, _ := client.Seal(1, []byte("first"))
+	second, _ := client.Seal(1, []byte("second"))
+	if _, _, err := device.Open(second); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := device.Open(second); !errors.Is(err, ErrReplay) {
+		t.Errorf("replayed frame: error = %v, want ErrReplay", err)
+	}
+	if _, _, err := device.Open(first); !errors.Is(err, ErrReplay) {
+		t.Errorf("older frame: error = %v, want ErrReplay", err)
+	}
+
+	other, _ := client.Seal(2, []byte("not opened at the device"))
+	if _, _, err := device.Open(other); !errors.Is(err, ErrStreamNotOpen) {
+		t.Errorf("unopened stream: error = %v, want ErrStreamNotOpen", err)
+	}
+
+	third, _ := client.Seal(1, []byte("third"))
+	moved := append([]byte(nil), third...)
+	moved[2] = 2
+	if _, _, err := device.Open(moved); err == nil {
+		t.Error("frame moved to another stream was accepted")
+	}
+	tampered := append([]byte(nil), third...)
+	tampered[len(tampered)-1] ^= 1
+	if _, _, err := device.Open(tampered); err == nil {
+		t.Error("tampered frame was accepted")
+	}
+
+	// A device frame reflected back to the device does not authenticate
+	reflected, _ := device.Seal(1, []byte("from the device"))
+	if _, _, err := device.Open(reflected); err == nil {
+		t.Error("reflected frame was accepted")
+	}
+
+	if _, _, err := device.Open(third); err != nil {
+		t.Errorf("Open() of the genuine frame failed after refusals: %v", err)
+	}
+	counters, _ := device.Counters(1)
+	if counters.Rejected != 4 || counters.Messages != 3 {
+		t.Errorf("Counters(1) = %+v, want 4 rejected, 3 messages", counters)
+	}
+
+	device.CloseStream(1)
+	fourth, _ := client.Seal(1, []byte("fourth"))
+	if _, _, err := device.Open(fourth); !errors.Is(err, ErrStreamNotOpen) {
+		t.Errorf("closed stream: error = %v, want ErrStreamNotOpen", err)
+	}
+	if _, err := device.Seal(1, nil); !errors.Is(err, ErrStreamNotOpen) {
+		t.Errorf("Seal() on a closed stream: error = %v, want ErrStreamNotOpen", err)
+	}
+	if err := device.OpenStream(1); err == nil {
+		t.Error("a closed stream was reopened")
+	}
+}
+
+func TestReadWriteFrame(t *testing.T) {
+	client, device := pair(t)
+	var buf bytes.Buffer
+	for _, payload := range []string{"a", "", "ccc"} {
+		frame, err := client.Seal(ControlStream, []byte(payload))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := WriteFrame(&buf, frame); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, want := range []string{"a", "", "ccc"} {
+		frame, err := ReadFrame(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, payload, err := device.Open(frame)
+		if err != nil || string(payload) != want {
+			t.Errorf("Open() = %q, %v, want %q", payload, err, want)
+		}
+	}
+	if _, err := ReadFrame(&buf); err != io.EOF {
+		t.Errorf("ReadFrame() at end = %v, want io.EOF", err)
+	}
+
+	header := make([]byte, HeaderSize)
+	putHeader(header, 1, 1, MaxPayloadSize+tagSize+1)
+	if _, err := ReadFrame(bytes.NewReader(header)); err != ErrFrameTooLarge {
+		t.Errorf("oversized frame: error = %v, want ErrFrameTooLarge", err)
+	}
+	putHeader(header, 1, 1, 100)
+	if _, err := ReadFrame(bytes.NewReader(append(header, 1, 2, 3))); err != io.ErrUnexpectedEOF {
+		t.Errorf("truncated frame: error = %v, want io.ErrUnexpectedEOF", err)
+	}
+	if _, err := client.Seal(ControlStream, make([]byte, MaxPayloadSize+1)); err != ErrFrameTooLarge {
+		t.Errorf("Seal() of an oversized payload: error = %v, want ErrFrameTooLarge", err)
+	}
+}
+
+func TestNewChecksKey(t *testing.T) {
+	if _, err := New(make([]byte, 16), RoleClient); err == nil {
+		t.Error("New() accepted a 16-byte key")
+	}
+	if _, err := New(make([]byte, KeySize), Role(0)); err == nil {
+		t.Error("New() accepted an invalid role")
+	}
+}
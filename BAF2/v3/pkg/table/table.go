@@ -0,0 +1,182 @@
+package table
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// Format selects how a table is rendered
+type Format string
+
+const (
+	// FormatTable renders aligned columns with an upper-case header, for people
+	FormatTable Format = "table"
+	// FormatTSV renders tab-separated values, for awk, cut and sort
+	FormatTSV Format = "tsv"
+	// FormatJSON renders a JSON array with one object per row
+	FormatJSON Format = "json"
+)
+
+// ParseFormat validates a --format value
+func ParseFormat(value string) (Format, error) {
+	switch Format(value) {
+	case FormatTable, FormatTSV, FormatJSON:
+		return Format(value), nil
+	default:
+		return "", fmt.Errorf("invalid format %q: use table, tsv or json", value)
+	}
+}
+
+// Table is a listing: named columns and one row of cell values per record.
+// Column names are lower-case, with words separated by '-', e.g. "last-error".
+type Table struct {
+	Columns []string
+	Rows    [][]string
+}
+
+// New creates an empty table with the given columns
+func New(columns ...string) *Table {
+	return &Table{Columns: columns}
+}
+
+// Append adds a row; cells are formatted with %v and must match Columns
+func (t *Table) Append(cells ...interface{}) {
+	row := make([]string, len(cells))
+	for i, cell := range cells {
+		row[i] = fmt.Sprint(cell)
+	}
+	t.Rows = append(t.Rows, row)
+}
+
+// Options control rendering
+type Options struct {
+	Format Format
+	// Columns selects and orders the columns to print; empty prints all
+	Columns []string
+	// NoHeader omits the header line of table and TSV output
+	NoHeader bool
+}
+
+// Select returns the indexes of the named columns, in the given order, or of
+// every column if names is empty
+func (t *Table) Select(names []string) ([]int, error) {
+	if len(names) == 0 {
+		indexes := make([]int, len(t.Columns))
+		for i := range t.Columns {
+			indexes[i] = i
+		}
+		return indexes, nil
+	}
+
+	indexes := make([]int, 0, len(names))
+	for _, name := range names {
+		index := -1
+		for i, column := range t.Columns {
+			if column == strings.ToLower(strings.TrimSpace(name)) {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			return nil, fmt.Errorf("unknown column %q: available columns are %s", name, strings.Join(t.Columns, ", "))
+		}
+		indexes = append(indexes, index)
+	}
+	return indexes, nil
+}
+
+// Render writes the table to w
+func (t *Table) Render(w io.Writer, opts Options) error {
+	indexes, err := t.Select(opts.Columns)
+	if err != nil {
+		return err
+	}
+
+	switch opts.Format {
+	case FormatJSON:
+		return t.renderJSON(w, indexes)
+	case FormatTSV:
+		return t.renderTSV(w, indexes, opts.NoHeader)
+	case FormatTable, "":
+		return t.renderTable(w, indexes, opts.NoHeader)
+	default:
+		return fmt.Errorf("invalid format %q: use table, tsv or json", opts.Format)
+	}
+}
+
+func (t *Table) renderTable(w io.Writer, indexes []int, noHeader bool) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	if !noHeader {
+		header := make([]string, len(indexes))
+		for i, index := range indexes {
+			header[i] = strings.ToUpper(strings.Replace(t.Columns[index], "-", " ", -1))
+		}
+		fmt.Fprintln(tw, strings.Join(header, "\t"))
+	}
+	for _, row := range t.Rows {
+		fmt.Fprintln(tw, strings.Join(pick(row, indexes, tableCell), "\t"))
+	}
+	return tw.Flush()
+}
+
+func (t *Table) renderTSV(w io.Writer, indexes []int, noHeader bool) error {
+	if !noHeader {
+		header := make([]string, len(indexes))
+		for i, index := range indexes {
+			header[i] = t.Columns[index]
+		}
+		if _, err := fmt.Fprintln(w, strings.Join(header, "\t")); err != nil {
+			return err
+		}
+	}
+	for _, row := range t.Rows {
+		if _, err := fmt.Fprintln(w, strings.Join(pick(row, indexes, tsvCell), "\t")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *Table) renderJSON(w io.Writer, indexes []int) error {
+	records := make([]map[string]string, 0, len(t.Rows))
+	for _, row := range t.Rows {
+		record := make(map[string]string, len(indexes))
+		for _, index := range indexes {
+			record[t.Columns[index]] = row[index]
+		}
+		records = append(records, record)
+	}
+	output, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal output: %v", err)
+	}
+	_, err = fmt.Fprintln(w, string(output))
+	return err
+}
+
+// pick returns the selected cells of row, escaped for the output format
+func pick(row []string, indexes []int, escape func(string) string) []string {
+	cells := make([]string, len(indexes))
+	for i, index := range indexes {
+		if index < len(row) {
+			cells[i] = escape(row[index])
+		}
+	}
+	return cells
+}
+
+// tableCell shows empty cells as "-" so columns stay readable
+func tableCell(cell string) string {
+	if cell == "" {
+		return "-"
+	}
+	return tsvCell(cell)
+}
+
+// tsvCell replaces the tabs and line breaks that would split a TSV record
+func tsvCell(cell string) string {
+	return strings.NewReplacer("\t", " ", "\r", " ", "\n", " ").Replace(cell)
+}
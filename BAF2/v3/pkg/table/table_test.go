@@ -0,0 +1,59 @@
+package table
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func sample() *Table {
+	t := New("session", "client", "last-error")
+	t.Append("S1", "client1", "")
+	t.Append("S2", "client2", "timed\tout")
+	return t
+}
+
+func TestRenderTSV(t *testing.T) {
+	var out bytes.Buffer
+	if err := sample().Render(&out, Options{Format: FormatTSV, Columns: []string{"client", "last-error"}}); err != nil {
+		t.Fatal(err)
+	}
+	want := "client\tlast-error\nclient1\t\nclient2\ttimed out\n"
+	if out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+}
+
+func TestRenderTableNoHeader(t *testing.T) {
+	var out bytes.Buffer
+	if err := sample().Render(&out, Options{Format: FormatTable, Columns: []string{"session", "last-error"}, NoHeader: true}); err != nil {
+		t.Fatal(err)
+	}
+	want := "S1  -\nS2  timed out\n"
+	if out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+}
+
+func TestRenderJSON(t *testing.T) {
+	var out bytes.Buffer
+	if err := sample().Render(&out, Options{Format: FormatJSON, Columns: []string{"session"}}); err != nil {
+		t.Fatal(err)
+	}
+	var records []map[string]string
+	if err := json.Unmarshal(out.Bytes(), &records); err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || len(records[0]) != 1 || records[1]["session"] != "S2" {
+		t.Errorf("unexpected records %v", records)
+	}
+}
+
+func TestUnknownColumn(t *testing.T) {
+	if err := sample().Render(&bytes.Buffer{}, Options{Columns: []string{"device"}}); err == nil {
+		t.Error("unknown column was accepted")
+	}
+	if _, err := ParseFormat("csv"); err == nil {
+		t.Error("unknown format was accepted")
+	}
+}
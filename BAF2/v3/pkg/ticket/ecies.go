@@ -0,0 +1,79 @@
+package ticket
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// EncryptionECIES is the session key encryption for clients with a P-256
+// key: an ephemeral P-256 key agrees a secret with the client key, the ANSI
+// X9.63 KDF (SHA-256, the ephemeral public key as shared info) derives an
+// AES-256 key from it, and the session key is sealed with AES-GCM. The
+// ciphertext is the uncompressed ephemeral public key (65 bytes), a 12-byte
+// nonce and the AES-GCM ciphertext. The AS offers it from protocol version 2.
+const EncryptionECIES = "ecies-p256-aes256gcm"
+
+const (
+	eciesPointSize = 65
+	eciesNonceSize = 12
+)
+
+// errECIESDecryption is the ECIES counterpart of rsa.ErrDecryption: the
+// session key was not encrypted for this key
+var errECIESDecryption = errors.New("ecies: decryption error")
+
+// SupportedECProtocols is what this package speaks for a client with a P-256
+// key. The AS only encrypts for such a client with EncryptionECIES, which
+// needs protocol version 2.
+var SupportedECProtocols = ProtocolInfo{
+	Versions:      []int{ProtocolV2},
+	Encryption:    []string{EncryptionECIES},
+	TicketFormats: SupportedProtocols.TicketFormats,
+}
+
+// DecryptSessionKeyECIES decrypts an EncryptionECIES session key with the
+// client's P-256 private key
+func DecryptSessionKeyECIES(privateKey *ecdsa.PrivateKey, ciphertext []byte) ([]byte, error) {
+	if privateKey.Curve != elliptic.P256() {
+		return nil, fmt.Errorf("%s needs a P-256 key, not %s", EncryptionECIES, privateKey.Curve.Params().Name)
+	}
+	if len(ciphertext) < eciesPointSize+eciesNonceSize {
+		return nil, fmt.Errorf("encrypted session key is %d bytes, too short for %s", len(ciphertext), EncryptionECIES)
+	}
+	point := ciphertext[:eciesPointSize]
+	x, y := elliptic.Unmarshal(elliptic.P256(), point)
+	if x == nil {
+		return nil, errors.New("encrypted session key does not start with a P-256 point")
+	}
+
+	// ECDH, then one block of the X9.63 KDF is the whole AES-256 key
+	secretX, _ := elliptic.P256().ScalarMult(x, y, privateKey.D.Bytes())
+	secret := make([]byte, 32)
+	secretX.FillBytes(secret)
+	counter := make([]byte, 4)
+	binary.BigEndian.PutUint32(counter, 1)
+	kdf := sha256.New()
+	kdf.Write(secret)
+	kdf.Write(counter)
+	kdf.Write(point)
+
+	block, err := aes.NewCipher(kdf.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := gcm.Open(nil, ciphertext[eciesPointSize:eciesPointSize+eciesNonceSize], ciphertext[eciesPointSize+eciesNonceSize:], nil)
+	if err != nil {
+		return nil, errECIESDecryption
+	}
+	return plaintext, nil
+}
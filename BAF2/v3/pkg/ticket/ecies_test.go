@@ -0,0 +1,98 @@
+package ticket
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sealECIES encrypts for a P-256 key the way the AS does
+func sealECIES(t *testing.T, publicKey *ecdsa.PublicKey, plaintext []byte) []byte {
+	t.Helper()
+	ephemeral, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	point := elliptic.Marshal(elliptic.P256(), ephemeral.X, ephemeral.Y)
+	secretX, _ := elliptic.P256().ScalarMult(publicKey.X, publicKey.Y, ephemeral.D.Bytes())
+	secret := make([]byte, 32)
+	secretX.FillBytes(secret)
+	kdf := sha256.New()
+	kdf.Write(secret)
+	kdf.Write([]byte{0, 0, 0, 1})
+	kdf.Write(point)
+
+	block, _ := aes.NewCipher(kdf.Sum(nil))
+	gcm, _ := cipher.NewGCM(block)
+	nonce := make([]byte, eciesNonceSize)
+	rand.Read(nonce)
+	return gcm.Seal(append(point, nonce...), nonce, plaintext, nil)
+}
+
+func TestDecryptSessionKeyECIES(t *testing.T) {
+	clientKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext := sealECIES(t, &clientKey.PublicKey, []byte("session key"))
+
+	plaintext, err := DecryptSessionKeyECIES(clientKey, ciphertext)
+	if err != nil || string(plaintext) != "session key" {
+		t.Fatalf("DecryptSessionKeyECIES() = %q, %v", plaintext, err)
+	}
+	if _, err := DecryptSessionKeyECIES(otherKey, ciphertext); err != errECIESDecryption {
+		t.Errorf("DecryptSessionKeyECIES() with another key error = %v, want %v", err, errECIESDecryption)
+	}
+	if _, err := DecryptSessionKeyECIES(clientKey, ciphertext[:eciesPointSize]); err == nil {
+		t.Error("truncated ciphertext decrypted")
+	}
+	badPoint := append([]byte{}, ciphertext...)
+	badPoint[1] ^= 0xff
+	if _, err := DecryptSessionKeyECIES(clientKey, badPoint); err == nil {
+		t.Error("ciphertext with a bad ephemeral key decrypted")
+	}
+}
+
+func TestVerifyTGTWithECKey(t *testing.T) {
+	clientKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1700000000, 0).UTC()
+
+	sessionKeyHash := sha256.Sum256([]byte("client1" + "KU,TGS"))
+	sessionKey := base64.StdEncoding.EncodeToString(sessionKeyHash[:])
+	valid := TGT{
+		EncryptedTGT:        base64.StdEncoding.EncodeToString(make([]byte, 256+12+40+16)),
+		EncryptedSessionKey: base64.StdEncoding.EncodeToString(sealECIES(t, &clientKey.PublicKey, []byte(sessionKey))),
+		ExpiresAt:           now.Add(time.Hour).Format(time.RFC3339),
+		Encryption:          EncryptionECIES,
+	}
+
+	if err := VerifyTGTWithKey(valid, clientKey, now); err != nil {
+		t.Fatalf("VerifyTGTWithKey() error = %v", err)
+	}
+	if err := VerifyTGTWithKey(valid, otherKey, now); err == nil || !strings.Contains(err.Error(), "does not decrypt") {
+		t.Errorf("VerifyTGTWithKey() with another key error = %v, want it to contain %q", err, "does not decrypt")
+	}
+	rsaEncrypted := valid
+	rsaEncrypted.Encryption = EncryptionHybrid
+	if err := VerifyTGTWithKey(rsaEncrypted, clientKey, now); err == nil || !strings.Contains(err.Error(), EncryptionECIES) {
+		t.Errorf("VerifyTGTWithKey() of an RSA encryption error = %v, want it to name %s", err, EncryptionECIES)
+	}
+}
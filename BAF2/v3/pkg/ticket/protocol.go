@@ -0,0 +1,176 @@
+package ticket
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+// Protocol versions. Chaincodes are usually upgraded before clients, so a
+// client asks each chaincode what it speaks (GetProtocolInfo) and uses the
+// newest version both sides know; a chaincode that cannot say speaks
+// ProtocolV1.
+const (
+	// ProtocolV1 encrypts the client's session key with RSA PKCS#1 v1.5 and
+	// encodes ticket claims as JSON
+	ProtocolV1 = 1
+	// ProtocolV2 lets the client ask the AS for EncryptionHybrid or
+	// EncryptionOAEP
+	ProtocolV2 = 2
+)
+
+// Encryption of the session key the AS returns to the client
+const (
+	EncryptionPKCS1v15 = "rsa-pkcs1v15"
+	// EncryptionHybrid is an RSA-OAEP (SHA-256) encrypted AES-256 key,
+	// followed by a 12-byte nonce and the AES-GCM ciphertext
+	EncryptionHybrid = "rsa-oaep-aes256gcm"
+	// EncryptionOAEP is RSA-OAEP (SHA-256) alone
+	EncryptionOAEP = "rsa-oaep-sha256"
+)
+
+const hybridNonceSize = 12
+
+// ProtocolInfo is what a chaincode reports from GetProtocolInfo
+type ProtocolInfo struct {
+	Service       string   `json:"service"`
+	Versions      []int    `json:"versions"`
+	Encryption    []string `json:"encryption"`
+	TicketFormats []string `json:"ticketFormats"`
+}
+
+// LegacyProtocolInfo is assumed for a chaincode without GetProtocolInfo
+func LegacyProtocolInfo(service string) ProtocolInfo {
+	return ProtocolInfo{
+		Service:       service,
+		Versions:      []int{ProtocolV1},
+		Encryption:    []string{EncryptionPKCS1v15},
+		TicketFormats: []string{FormatJSON.String()},
+	}
+}
+
+// SupportedProtocols is what this package speaks. Encryption and ticket
+// formats are in order of preference.
+var SupportedProtocols = ProtocolInfo{
+	Versions:      []int{ProtocolV1, ProtocolV2},
+	Encryption:    []string{EncryptionHybrid, EncryptionOAEP, EncryptionPKCS1v15},
+	TicketFormats: []string{FormatCBOR.String(), FormatProtobuf.String(), FormatJSON.String()},
+}
+
+// Protocol is the outcome of negotiating with the AS. It is sent to the AS
+// as the protocol argument of GenerateTGTWithProtocol.
+type Protocol struct {
+	Version    int    `json:"version"`
+	Encryption string `json:"encryption"`
+	// TicketFormat is the encoding of the TGT claims: one the AS writes and
+	// the TGS reads
+	TicketFormat string `json:"ticketFormat"`
+}
+
+// LegacyProtocol is what GenerateTGT produces
+var LegacyProtocol = Protocol{Version: ProtocolV1, Encryption: EncryptionPKCS1v15, TicketFormat: FormatJSON.String()}
+
+// NegotiateProtocol picks the newest version the client and the AS share,
+// the client's most preferred encryption the AS offers at that version, and
+// the most preferred ticket format the AS writes and the TGS reads
+func NegotiateProtocol(client, as, tgs ProtocolInfo) (Protocol, error) {
+	protocol := Protocol{}
+	for _, version := range client.Versions {
+		if version > protocol.Version && containsInt(as.Versions, version) {
+			protocol.Version = version
+		}
+	}
+	if protocol.Version == 0 {
+		return Protocol{}, fmt.Errorf("no common protocol version: client speaks %v, AS speaks %v", client.Versions, as.Versions)
+	}
+
+	for _, encryption := range client.Encryption {
+		if encryption != EncryptionPKCS1v15 && protocol.Version < ProtocolV2 {
+			continue
+		}
+		if containsString(as.Encryption, encryption) {
+			protocol.Encryption = encryption
+			break
+		}
+	}
+	if protocol.Encryption == "" {
+		return Protocol{}, fmt.Errorf("no common encryption at protocol version %d: client supports %v, AS offers %v",
+			protocol.Version, client.Encryption, as.Encryption)
+	}
+
+	for _, format := range client.TicketFormats {
+		if containsString(as.TicketFormats, format) && containsString(tgs.TicketFormats, format) {
+			protocol.TicketFormat = format
+			break
+		}
+	}
+	if protocol.TicketFormat == "" {
+		return Protocol{}, fmt.Errorf("no ticket format both the AS (%v) and the TGS (%v) support", as.TicketFormats, tgs.TicketFormats)
+	}
+	return protocol, nil
+}
+
+// DecryptSessionKey decrypts the session key of a TGT with the client's
+// private key, in the encryption the AS reported (PKCS#1 v1.5 if none)
+func DecryptSessionKey(encryption string, privateKey *rsa.PrivateKey, ciphertext []byte) ([]byte, error) {
+	switch encryption {
+	case "", EncryptionPKCS1v15:
+		if len(ciphertext) != privateKey.Size() {
+			return nil, fmt.Errorf("encrypted session key is %d bytes, expected %d for the client key; was the TGT issued for another client?",
+				len(ciphertext), privateKey.Size())
+		}
+		return rsa.DecryptPKCS1v15(rand.Reader, privateKey, ciphertext)
+	case EncryptionHybrid:
+		return decryptHybrid(privateKey, ciphertext)
+	case EncryptionOAEP:
+		return rsa.DecryptOAEP(sha256.New(), rand.Reader, privateKey, ciphertext, nil)
+	}
+	return nil, fmt.Errorf("unsupported session key encryption %q", encryption)
+}
+
+func decryptHybrid(privateKey *rsa.PrivateKey, envelope []byte) ([]byte, error) {
+	keySize := privateKey.Size()
+	if len(envelope) < keySize+hybridNonceSize {
+		return nil, fmt.Errorf("encrypted session key is %d bytes, too short for a %s envelope from the client key", len(envelope), EncryptionHybrid)
+	}
+
+	key, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, privateKey, envelope[:keySize], nil)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := gcm.Open(nil, envelope[keySize:keySize+hybridNonceSize], envelope[keySize+hybridNonceSize:], nil)
+	if err != nil {
+		return nil, errors.New("session key envelope failed authentication")
+	}
+	return plaintext, nil
+}
+
+func containsInt(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,123 @@
+package ticket
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"strings"
+	"testing"
+)
+
+func TestNegotiateProtocol(t *testing.T) {
+	legacyAS := LegacyProtocolInfo("as")
+	legacyTGS := LegacyProtocolInfo("tgs")
+	upgradedAS := ProtocolInfo{
+		Service:       "as",
+		Versions:      []int{ProtocolV1, ProtocolV2},
+		Encryption:    []string{EncryptionPKCS1v15, EncryptionHybrid},
+		TicketFormats: []string{"json", "cbor"},
+	}
+	oaepAS := ProtocolInfo{
+		Service:       "as",
+		Versions:      []int{ProtocolV1, ProtocolV2},
+		Encryption:    []string{EncryptionPKCS1v15, EncryptionOAEP},
+		TicketFormats: []string{"json"},
+	}
+	cborTGS := ProtocolInfo{Service: "tgs", Versions: []int{ProtocolV1}, TicketFormats: []string{"json", "cbor"}}
+	legacyClient := ProtocolInfo{Versions: []int{ProtocolV1}, Encryption: []string{EncryptionPKCS1v15}, TicketFormats: []string{"json"}}
+
+	tests := []struct {
+		name    string
+		client  ProtocolInfo
+		as, tgs ProtocolInfo
+		want    Protocol
+		wantErr string
+	}{
+		{"legacy chaincodes", SupportedProtocols, legacyAS, legacyTGS, LegacyProtocol, ""},
+		{"upgraded AS", SupportedProtocols, upgradedAS, legacyTGS, Protocol{ProtocolV2, EncryptionHybrid, "json"}, ""},
+		{"upgraded AS and TGS", SupportedProtocols, upgradedAS, cborTGS, Protocol{ProtocolV2, EncryptionHybrid, "cbor"}, ""},
+		{"legacy client", legacyClient, upgradedAS, cborTGS, LegacyProtocol, ""},
+		{"AS without hybrid", SupportedProtocols, oaepAS, legacyTGS, Protocol{ProtocolV2, EncryptionOAEP, "json"}, ""},
+		{"hybrid needs v2", SupportedProtocols, ProtocolInfo{Versions: []int{ProtocolV1}, Encryption: []string{EncryptionHybrid}, TicketFormats: []string{"json"}}, legacyTGS, Protocol{}, "no common encryption"},
+		{"EC client", SupportedECProtocols, ProtocolInfo{Versions: []int{ProtocolV1, ProtocolV2}, Encryption: []string{EncryptionHybrid, EncryptionECIES}, TicketFormats: []string{"json"}}, legacyTGS, Protocol{ProtocolV2, EncryptionECIES, "json"}, ""},
+		{"EC client and legacy AS", SupportedECProtocols, legacyAS, legacyTGS, Protocol{}, "no common protocol version"},
+		{"EC client and AS without ECIES", SupportedECProtocols, upgradedAS, legacyTGS, Protocol{}, "no common encryption"},
+		{"no common version", SupportedProtocols, ProtocolInfo{Versions: []int{3}}, legacyTGS, Protocol{}, "no common protocol version"},
+		{"no common format", SupportedProtocols, upgradedAS, ProtocolInfo{TicketFormats: []string{"protobuf"}}, Protocol{}, "no ticket format"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NegotiateProtocol(tt.client, tt.as, tt.tgs)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("NegotiateProtocol() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecryptSessionKeyHybrid(t *testing.T) {
+	clientKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Seal the way the AS does
+	aesKey := make([]byte, 32)
+	nonce := make([]byte, hybridNonceSize)
+	rand.Read(aesKey)
+	rand.Read(nonce)
+	wrappedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, &clientKey.PublicKey, aesKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := aes.NewCipher(aesKey)
+	gcm, _ := cipher.NewGCM(block)
+	envelope := gcm.Seal(append(append([]byte{}, wrappedKey...), nonce...), nonce, []byte("session key"), nil)
+
+	plaintext, err := DecryptSessionKey(EncryptionHybrid, clientKey, envelope)
+	if err != nil || string(plaintext) != "session key" {
+		t.Fatalf("DecryptSessionKey() = %q, %v", plaintext, err)
+	}
+
+	tampered := append([]byte{}, envelope...)
+	tampered[len(tampered)-1] ^= 0xff
+	if _, err := DecryptSessionKey(EncryptionHybrid, clientKey, tampered); err == nil {
+		t.Error("tampered envelope decrypted")
+	}
+	if _, err := DecryptSessionKey(EncryptionHybrid, clientKey, envelope[:100]); err == nil {
+		t.Error("truncated envelope decrypted")
+	}
+	if _, err := DecryptSessionKey("rot13", clientKey, envelope); err == nil {
+		t.Error("unknown encryption accepted")
+	}
+}
+
+func TestDecryptSessionKeyOAEP(t *testing.T) {
+	clientKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, &clientKey.PublicKey, []byte("session key"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext, err := DecryptSessionKey(EncryptionOAEP, clientKey, ciphertext)
+	if err != nil || string(plaintext) != "session key" {
+		t.Fatalf("DecryptSessionKey() = %q, %v", plaintext, err)
+	}
+	if _, err := DecryptSessionKey(EncryptionOAEP, clientKey, ciphertext[:100]); err == nil {
+		t.Error("truncated ciphertext decrypted")
+	}
+}
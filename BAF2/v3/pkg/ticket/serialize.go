@@ -0,0 +1,420 @@
+package ticket
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// Claims is the plaintext of a TGT or service ticket: what the AS or TGS
+// encrypts for the next hop. The JSON form is the one the chaincodes produce
+// today; the session key is base64 in JSON and raw bytes in binary formats.
+type Claims struct {
+	ClientID   string    `json:"clientID"`
+	SessionKey []byte    `json:"sessionKey"`
+	Timestamp  time.Time `json:"timestamp"`
+	Lifetime   int64     `json:"lifetime"` // seconds
+}
+
+// Format identifies the encoding of serialized Claims. It is the first byte
+// of the serialized form, so a reader can decode any registered format
+// without being told which one was used.
+type Format byte
+
+const (
+	// FormatJSON is the original encoding. It has no format byte of its own:
+	// a JSON object starts with '{', so existing tickets decode unchanged.
+	FormatJSON Format = '{'
+	// FormatCBOR is an RFC 8949 map with small integer keys
+	FormatCBOR Format = 0x01
+	// FormatProtobuf is the protocol buffers wire format
+	FormatProtobuf Format = 0x02
+)
+
+func (f Format) String() string {
+	switch f {
+	case FormatJSON:
+		return "json"
+	case FormatCBOR:
+		return "cbor"
+	case FormatProtobuf:
+		return "protobuf"
+	}
+	return fmt.Sprintf("format(0x%02x)", byte(f))
+}
+
+// ParseFormat returns the format with the given name
+func ParseFormat(name string) (Format, error) {
+	for _, format := range []Format{FormatJSON, FormatCBOR, FormatProtobuf} {
+		if format.String() == name {
+			return format, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown ticket format %q (json, cbor, protobuf)", name)
+}
+
+// Serializer encodes Claims in one format. Encode returns the body without
+// the format byte; MarshalClaims adds it.
+type Serializer interface {
+	Format() Format
+	Encode(claims *Claims) ([]byte, error)
+	Decode(body []byte) (*Claims, error)
+}
+
+var (
+	serializersMu sync.RWMutex
+	serializers   = map[Format]Serializer{
+		FormatJSON:     jsonSerializer{},
+		FormatCBOR:     cborSerializer{},
+		FormatProtobuf: protobufSerializer{},
+	}
+)
+
+// RegisterSerializer adds or replaces the serializer for its format
+func RegisterSerializer(serializer Serializer) {
+	serializersMu.Lock()
+	defer serializersMu.Unlock()
+	serializers[serializer.Format()] = serializer
+}
+
+func serializerFor(format Format) (Serializer, error) {
+	serializersMu.RLock()
+	defer serializersMu.RUnlock()
+	serializer, ok := serializers[format]
+	if !ok {
+		return nil, fmt.Errorf("no serializer registered for ticket %s", format)
+	}
+	return serializer, nil
+}
+
+// MarshalClaims serializes claims in the given format, prefixed with its
+// format byte (JSON is left untagged)
+func MarshalClaims(format Format, claims *Claims) ([]byte, error) {
+	serializer, err := serializerFor(format)
+	if err != nil {
+		return nil, err
+	}
+	body, err := serializer.Encode(claims)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode ticket claims as %s: %w", format, err)
+	}
+	if format == FormatJSON {
+		return body, nil
+	}
+	return append([]byte{byte(format)}, body...), nil
+}
+
+// UnmarshalClaims decodes claims serialized by MarshalClaims in any
+// registered format and reports which format it was
+func UnmarshalClaims(data []byte) (*Claims, Format, error) {
+	if len(data) == 0 {
+		return nil, 0, errors.New("empty ticket claims")
+	}
+
+	format, body := Format(data[0]), data[1:]
+	if format == FormatJSON {
+		body = data
+	}
+	serializer, err := serializerFor(format)
+	if err != nil {
+		return nil, 0, err
+	}
+	claims, err := serializer.Decode(body)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to decode %s ticket claims: %w", format, err)
+	}
+	return claims, format, nil
+}
+
+type jsonSerializer struct{}
+
+func (jsonSerializer) Format() Format { return FormatJSON }
+
+func (jsonSerializer) Encode(claims *Claims) ([]byte, error) {
+	return json.Marshal(claims)
+}
+
+func (jsonSerializer) Decode(body []byte) (*Claims, error) {
+	var claims Claims
+	if err := json.Unmarshal(body, &claims); err != nil {
+		return nil, err
+	}
+	return &claims, nil
+}
+
+// Field numbers shared by the binary formats. The timestamp is Unix
+// nanoseconds.
+const (
+	fieldClientID   = 1
+	fieldSessionKey = 2
+	fieldTimestamp  = 3
+	fieldLifetime   = 4
+)
+
+var errTruncated = errors.New("truncated input")
+
+// cborSerializer writes Claims as a CBOR map of integer keys, as CWT does
+type cborSerializer struct{}
+
+func (cborSerializer) Format() Format { return FormatCBOR }
+
+const (
+	cborUint  = 0 << 5
+	cborNeg   = 1 << 5
+	cborBytes = 2 << 5
+	cborText  = 3 << 5
+	cborMap   = 5 << 5
+)
+
+func (cborSerializer) Encode(claims *Claims) ([]byte, error) {
+	out := cborHead(nil, cborMap, 4)
+	out = cborHead(out, cborUint, fieldClientID)
+	out = cborHead(out, cborText, uint64(len(claims.ClientID)))
+	out = append(out, claims.ClientID...)
+	out = cborHead(out, cborUint, fieldSessionKey)
+	out = cborHead(out, cborBytes, uint64(len(claims.SessionKey)))
+	out = append(out, claims.SessionKey...)
+	out = cborHead(out, cborUint, fieldTimestamp)
+	out = cborInt(out, claims.Timestamp.UnixNano())
+	out = cborHead(out, cborUint, fieldLifetime)
+	out = cborInt(out, claims.Lifetime)
+	return out, nil
+}
+
+func cborHead(out []byte, major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return append(out, major|byte(n))
+	case n <= math.MaxUint8:
+		return append(out, major|24, byte(n))
+	case n <= math.MaxUint16:
+		return appendBigEndian(append(out, major|25), n, 2)
+	case n <= math.MaxUint32:
+		return appendBigEndian(append(out, major|26), n, 4)
+	}
+	return appendBigEndian(append(out, major|27), n, 8)
+}
+
+func appendBigEndian(out []byte, n uint64, size int) []byte {
+	for shift := 8 * (size - 1); shift >= 0; shift -= 8 {
+		out = append(out, byte(n>>shift))
+	}
+	return out
+}
+
+func cborInt(out []byte, v int64) []byte {
+	if v < 0 {
+		return cborHead(out, cborNeg, uint64(-(v + 1)))
+	}
+	return cborHead(out, cborUint, uint64(v))
+}
+
+func (cborSerializer) Decode(body []byte) (*Claims, error) {
+	major, pairs, rest, err := cborReadHead(body)
+	if err != nil {
+		return nil, err
+	}
+	if major != cborMap {
+		return nil, errors.New("claims are not a CBOR map")
+	}
+
+	claims := &Claims{}
+	for i := uint64(0); i < pairs; i++ {
+		var keyMajor byte
+		var key uint64
+		if keyMajor, key, rest, err = cborReadHead(rest); err != nil {
+			return nil, err
+		}
+		if keyMajor != cborUint {
+			return nil, errors.New("CBOR map key is not an unsigned integer")
+		}
+
+		var major byte
+		var arg uint64
+		if major, arg, rest, err = cborReadHead(rest); err != nil {
+			return nil, err
+		}
+		var value []byte
+		if major == cborBytes || major == cborText {
+			if uint64(len(rest)) < arg {
+				return nil, errTruncated
+			}
+			value, rest = rest[:arg], rest[arg:]
+		}
+
+		switch key {
+		case fieldClientID:
+			if major != cborText {
+				return nil, errors.New("clientID is not a CBOR text string")
+			}
+			claims.ClientID = string(value)
+		case fieldSessionKey:
+			if major != cborBytes {
+				return nil, errors.New("sessionKey is not a CBOR byte string")
+			}
+			claims.SessionKey = append([]byte(nil), value...)
+		case fieldTimestamp, fieldLifetime:
+			v, err := cborIntValue(major, arg)
+			if err != nil {
+				return nil, err
+			}
+			if key == fieldTimestamp {
+				claims.Timestamp = time.Unix(0, v)
+			} else {
+				claims.Lifetime = v
+			}
+		default:
+			// Unknown fields from newer writers are skipped
+			if major != cborUint && major != cborNeg && major != cborBytes && major != cborText {
+				return nil, fmt.Errorf("unsupported CBOR value for field %d", key)
+			}
+		}
+	}
+	if len(rest) != 0 {
+		return nil, errors.New("trailing data after CBOR map")
+	}
+	return claims, nil
+}
+
+func cborReadHead(in []byte) (byte, uint64, []byte, error) {
+	if len(in) == 0 {
+		return 0, 0, nil, errTruncated
+	}
+	major, info, in := in[0]&0xe0, in[0]&0x1f, in[1:]
+	switch {
+	case info < 24:
+		return major, uint64(info), in, nil
+	case info == 24 && len(in) >= 1:
+		return major, uint64(in[0]), in[1:], nil
+	case info == 25 && len(in) >= 2:
+		return major, uint64(binary.BigEndian.Uint16(in)), in[2:], nil
+	case info == 26 && len(in) >= 4:
+		return major, uint64(binary.BigEndian.Uint32(in)), in[4:], nil
+	case info == 27 && len(in) >= 8:
+		return major, binary.BigEndian.Uint64(in), in[8:], nil
+	case info > 27:
+		return 0, 0, nil, fmt.Errorf("unsupported CBOR additional information %d", info)
+	}
+	return 0, 0, nil, errTruncated
+}
+
+func cborIntValue(major byte, arg uint64) (int64, error) {
+	if arg > math.MaxInt64 {
+		return 0, errors.New("CBOR integer out of range")
+	}
+	switch major {
+	case cborUint:
+		return int64(arg), nil
+	case cborNeg:
+		return -1 - int64(arg), nil
+	}
+	return 0, errors.New("value is not a CBOR integer")
+}
+
+// protobufSerializer writes Claims in the protocol buffers wire format of:
+//
+//	message Claims {
+//	  string client_id   = 1;
+//	  bytes  session_key = 2;
+//	  int64  timestamp   = 3; // Unix nanoseconds
+//	  int64  lifetime    = 4; // seconds
+//	}
+type protobufSerializer struct{}
+
+func (protobufSerializer) Format() Format { return FormatProtobuf }
+
+const (
+	wireVarint = 0
+	wireI64    = 1
+	wireLen    = 2
+	wireI32    = 5
+)
+
+func (protobufSerializer) Encode(claims *Claims) ([]byte, error) {
+	var out []byte
+	if claims.ClientID != "" {
+		out = appendUvarint(out, fieldClientID<<3|wireLen)
+		out = appendUvarint(out, uint64(len(claims.ClientID)))
+		out = append(out, claims.ClientID...)
+	}
+	if len(claims.SessionKey) > 0 {
+		out = appendUvarint(out, fieldSessionKey<<3|wireLen)
+		out = appendUvarint(out, uint64(len(claims.SessionKey)))
+		out = append(out, claims.SessionKey...)
+	}
+	if !claims.Timestamp.IsZero() {
+		out = appendUvarint(out, fieldTimestamp<<3|wireVarint)
+		out = appendUvarint(out, uint64(claims.Timestamp.UnixNano()))
+	}
+	if claims.Lifetime != 0 {
+		out = appendUvarint(out, fieldLifetime<<3|wireVarint)
+		out = appendUvarint(out, uint64(claims.Lifetime))
+	}
+	return out, nil
+}
+
+func appendUvarint(out []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(out, buf[:binary.PutUvarint(buf[:], v)]...)
+}
+
+func (protobufSerializer) Decode(body []byte) (*Claims, error) {
+	claims := &Claims{}
+	for len(body) > 0 {
+		tag, n := binary.Uvarint(body)
+		if n <= 0 {
+			return nil, errTruncated
+		}
+		body = body[n:]
+		field, wireType := tag>>3, tag&7
+
+		switch wireType {
+		case wireVarint:
+			v, n := binary.Uvarint(body)
+			if n <= 0 {
+				return nil, errTruncated
+			}
+			body = body[n:]
+			switch field {
+			case fieldTimestamp:
+				claims.Timestamp = time.Unix(0, int64(v))
+			case fieldLifetime:
+				claims.Lifetime = int64(v)
+			case fieldClientID, fieldSessionKey:
+				return nil, fmt.Errorf("field %d has wire type varint", field)
+			}
+		case wireLen:
+			length, n := binary.Uvarint(body)
+			if n <= 0 || uint64(len(body)-n) < length {
+				return nil, errTruncated
+			}
+			value := body[n : n+int(length)]
+			body = body[n+int(length):]
+			switch field {
+			case fieldClientID:
+				claims.ClientID = string(value)
+			case fieldSessionKey:
+				claims.SessionKey = append([]byte(nil), value...)
+			case fieldTimestamp, fieldLifetime:
+				return nil, fmt.Errorf("field %d has wire type bytes", field)
+			}
+		case wireI64, wireI32:
+			// Unknown fixed-width fields from newer writers are skipped
+			size := 8
+			if wireType == wireI32 {
+				size = 4
+			}
+			if len(body) < size {
+				return nil, errTruncated
+			}
+			body = body[size:]
+		default:
+			return nil, fmt.Errorf("unsupported protobuf wire type %d", wireType)
+		}
+	}
+	return claims, nil
+}
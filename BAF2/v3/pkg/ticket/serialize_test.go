@@ -0,0 +1,119 @@
+package ticket
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+	"time"
+)
+
+func TestClaimsRoundTrip(t *testing.T) {
+	sessionKey := sha256.Sum256([]byte("client1" + "KU,TGS"))
+	claims := &Claims{
+		ClientID:   "client1",
+		SessionKey: sessionKey[:],
+		Timestamp:  time.Unix(1700000000, 123456789).UTC(),
+		Lifetime:   3600,
+	}
+
+	jsonSize := 0
+	for _, format := range []Format{FormatJSON, FormatCBOR, FormatProtobuf} {
+		data, err := MarshalClaims(format, claims)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		got, gotFormat, err := UnmarshalClaims(data)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if gotFormat != format {
+			t.Errorf("%s: decoded as %s", format, gotFormat)
+		}
+		if got.ClientID != claims.ClientID || !bytes.Equal(got.SessionKey, claims.SessionKey) ||
+			!got.Timestamp.Equal(claims.Timestamp) || got.Lifetime != claims.Lifetime {
+			t.Errorf("%s: round trip = %+v, want %+v", format, got, claims)
+		}
+
+		if format == FormatJSON {
+			jsonSize = len(data)
+		} else if len(data) >= jsonSize/2 {
+			t.Errorf("%s is %d bytes, expected well under half of JSON's %d", format, len(data), jsonSize)
+		}
+	}
+}
+
+func TestUnmarshalChaincodeJSON(t *testing.T) {
+	// As produced by the AS and TGS chaincodes
+	data := []byte(`{"clientID":"client1","sessionKey":"q83vEjRWeJCrze8SNFZ4kKvN7xI0VniQq83vEjRWeJA=","timestamp":"2023-11-14T22:13:20.5+00:00","lifetime":3600}`)
+
+	claims, format, err := UnmarshalClaims(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != FormatJSON || claims.ClientID != "client1" || len(claims.SessionKey) != SessionKeySize ||
+		!claims.Timestamp.Equal(time.Unix(1700000000, 500000000)) || claims.Lifetime != 3600 {
+		t.Errorf("UnmarshalClaims() = %+v, %s", claims, format)
+	}
+}
+
+func TestProtobufWireFormat(t *testing.T) {
+	data, err := MarshalClaims(FormatProtobuf, &Claims{ClientID: "c1", SessionKey: []byte{0xaa}, Lifetime: 3600})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// format byte, field 1 "c1", field 2 0xaa, field 4 varint 3600
+	if want := "02" + "0a026331" + "1201aa" + "20901c"; hex.EncodeToString(data) != want {
+		t.Errorf("protobuf encoding = %x, want %s", data, want)
+	}
+}
+
+func TestUnmarshalClaimsErrors(t *testing.T) {
+	claims := &Claims{ClientID: "client1", SessionKey: make([]byte, SessionKeySize), Timestamp: time.Unix(-5, 0), Lifetime: 60}
+	cbor, err := MarshalClaims(FormatCBOR, claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _, err := UnmarshalClaims(cbor); err != nil || !got.Timestamp.Equal(claims.Timestamp) {
+		t.Errorf("negative CBOR timestamp = %v, %v", got, err)
+	}
+	protobuf, err := MarshalClaims(FormatProtobuf, claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string][]byte{
+		"empty":              nil,
+		"unknown format":     {0x7f, 0x00},
+		"truncated cbor":     cbor[:len(cbor)-3],
+		"trailing cbor":      append(append([]byte{}, cbor...), 0x00),
+		"truncated protobuf": protobuf[:12],
+		"bad json":           []byte(`{"clientID":`),
+	}
+	for name, data := range tests {
+		if _, _, err := UnmarshalClaims(data); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+type upperJSON struct{ jsonSerializer }
+
+func (upperJSON) Format() Format { return 0x10 }
+
+func TestRegisterSerializer(t *testing.T) {
+	if _, err := MarshalClaims(0x10, &Claims{}); err == nil {
+		t.Fatal("unregistered format accepted")
+	}
+	RegisterSerializer(upperJSON{})
+	data, err := MarshalClaims(0x10, &Claims{ClientID: "client1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data[0] != 0x10 {
+		t.Errorf("format byte = %#x", data[0])
+	}
+	if claims, format, err := UnmarshalClaims(data); err != nil || format != 0x10 || claims.ClientID != "client1" {
+		t.Errorf("UnmarshalClaims() = %+v, %s, %v", claims, format, err)
+	}
+}
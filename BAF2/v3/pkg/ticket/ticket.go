@@ -0,0 +1,163 @@
+// Package ticket defines the wire format of the messages exchanged with the
+// Authentication Server (AS) and Ticket Granting Server (TGS) chaincodes.
+//
+// The JSON field names are part of the chaincode protocol and do not change
+// within a major version of this module; see docs/api-stability.md. Ticket
+// claims can also be serialized as CBOR or protobuf; see MarshalClaims.
+package ticket
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// AuthenticatorMaxSkew is how far an authenticator timestamp may be from the
+// TGS's clock
+const AuthenticatorMaxSkew = 5 * time.Minute
+
+// NonceChallenge represents a nonce challenge from the Authentication Server
+type NonceChallenge struct {
+	Nonce          string `json:"nonce"`
+	ExpirationTime int64  `json:"expirationTime"`
+}
+
+// TGT represents a Ticket Granting Ticket
+type TGT struct {
+	EncryptedTGT        string `json:"encryptedTGT"`
+	EncryptedSessionKey string `json:"encryptedSessionKey"`
+	ExpiresAt           string `json:"expiresAt,omitempty"`  // RFC 3339; absent from older AS versions
+	Encryption          string `json:"encryption,omitempty"` // Session key encryption; absent means EncryptionPKCS1v15
+}
+
+// ServiceTicket represents a service ticket for accessing a service
+type ServiceTicket struct {
+	EncryptedServiceTicket string `json:"encryptedServiceTicket"`
+	EncryptedSessionKey    string `json:"encryptedSessionKey"`
+}
+
+// ServiceTicketRequest represents a request for a service ticket
+type ServiceTicketRequest struct {
+	EncryptedTGT  string `json:"encryptedTGT"`
+	ClientID      string `json:"clientID"`
+	ServiceID     string `json:"serviceID"`
+	Authenticator string `json:"authenticator"`
+}
+
+// MultiServiceTicketRequest requests tickets for several services in one
+// TGS round trip
+type MultiServiceTicketRequest struct {
+	EncryptedTGT  string   `json:"encryptedTGT"`
+	ClientID      string   `json:"clientID"`
+	ServiceIDs    []string `json:"serviceIDs"`
+	Authenticator string   `json:"authenticator"`
+}
+
+// Authenticator proves to the TGS that the client holds the TGT now. The
+// chaincodes accept each authenticator once; the random nonce keeps two
+// authenticators made in the same second apart.
+type Authenticator struct {
+	ClientID  string `json:"clientID"`
+	Timestamp int64  `json:"timestamp"`
+	Nonce     string `json:"nonce,omitempty"`
+}
+
+// authenticatorNonceSize is the size of an authenticator nonce in bytes
+const authenticatorNonceSize = 16
+
+// NewAuthenticator returns the base64-encoded authenticator for a client at
+// the given time
+func NewAuthenticator(clientID string, now time.Time) (string, error) {
+	nonce := make([]byte, authenticatorNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate authenticator nonce: %w", err)
+	}
+	authenticatorJSON, err := json.Marshal(Authenticator{
+		ClientID:  clientID,
+		Timestamp: now.Unix(),
+		Nonce:     base64.StdEncoding.EncodeToString(nonce),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal authenticator: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(authenticatorJSON), nil
+}
+
+// DecodeAuthenticator parses a base64-encoded authenticator
+func DecodeAuthenticator(encoded string) (*Authenticator, error) {
+	authenticatorJSON, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("authenticator is not valid base64: %w", err)
+	}
+
+	var authenticator Authenticator
+	if err := json.Unmarshal(authenticatorJSON, &authenticator); err != nil {
+		return nil, fmt.Errorf("authenticator is not valid JSON: %w", err)
+	}
+	return &authenticator, nil
+}
+
+// NewServiceTicketRequest builds the request a client sends to the TGS to
+// exchange its TGT for a service ticket
+func NewServiceTicketRequest(tgt TGT, clientID, serviceID string, now time.Time) (*ServiceTicketRequest, error) {
+	authenticator, err := NewAuthenticator(clientID, now)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ServiceTicketRequest{
+		EncryptedTGT:  tgt.EncryptedTGT,
+		ClientID:      clientID,
+		ServiceID:     serviceID,
+		Authenticator: authenticator,
+	}, nil
+}
+
+// Map returns the request in the form taken by the TGS contract wrapper
+func (r *ServiceTicketRequest) Map() map[string]string {
+	return map[string]string{
+		"encryptedTGT":  r.EncryptedTGT,
+		"clientID":      r.ClientID,
+		"serviceID":     r.ServiceID,
+		"authenticator": r.Authenticator,
+	}
+}
+
+// NewMultiServiceTicketRequest builds a request for tickets to several
+// services, validated by the TGS against a single TGT and authenticator
+func NewMultiServiceTicketRequest(tgt TGT, clientID string, serviceIDs []string, now time.Time) (*MultiServiceTicketRequest, error) {
+	authenticator, err := NewAuthenticator(clientID, now)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MultiServiceTicketRequest{
+		EncryptedTGT:  tgt.EncryptedTGT,
+		ClientID:      clientID,
+		ServiceIDs:    serviceIDs,
+		Authenticator: authenticator,
+	}, nil
+}
+
+// ServiceTicketRenewalRequest asks the TGS to replace a service ticket the
+// client holds with a new one (RenewServiceTicket)
+type ServiceTicketRenewalRequest struct {
+	ServiceTicketRequest
+	EncryptedServiceTicket string `json:"encryptedServiceTicket"`
+}
+
+// NewServiceTicketRenewalRequest builds the request a client sends to the
+// TGS to renew a service ticket before it expires
+func NewServiceTicketRenewalRequest(tgt TGT, serviceTicket ServiceTicket, clientID, serviceID string, now time.Time) (*ServiceTicketRenewalRequest, error) {
+	request, err := NewServiceTicketRequest(tgt, clientID, serviceID, now)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ServiceTicketRenewalRequest{
+		ServiceTicketRequest:   *request,
+		EncryptedServiceTicket: serviceTicket.EncryptedServiceTicket,
+	}, nil
+}
@@ -0,0 +1,29 @@
+package ticket
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewAuthenticator(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	first, err := NewAuthenticator("client1", now)
+	if err != nil {
+		t.Fatalf("NewAuthenticator: %v", err)
+	}
+	second, err := NewAuthenticator("client1", now)
+	if err != nil {
+		t.Fatalf("NewAuthenticator: %v", err)
+	}
+	if first == second {
+		t.Error("authenticators made in the same second are identical")
+	}
+
+	authenticator, err := DecodeAuthenticator(first)
+	if err != nil {
+		t.Fatalf("DecodeAuthenticator: %v", err)
+	}
+	if authenticator.ClientID != "client1" || authenticator.Timestamp != now.Unix() || authenticator.Nonce == "" {
+		t.Errorf("decoded %+v", authenticator)
+	}
+}
@@ -0,0 +1,98 @@
+package ticket
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// SessionKeySize is the size in bytes of the decoded KU,TGS session key
+	SessionKeySize = 32
+
+	// MaxTGTLifetime is the longest TGT lifetime a client accepts
+	MaxTGTLifetime = 24 * time.Hour
+
+	// minTGSKeySize is the smallest TGS modulus, in bytes, an encrypted TGT
+	// can come from (2048 bits)
+	minTGSKeySize = 256
+
+	// sealedTGTOverhead is what a sealed TGT adds to its RSA-encrypted key:
+	// the AES-GCM nonce and tag
+	sealedTGTOverhead = 12 + 16
+)
+
+// VerifyTGT checks a TGT returned by the AS before it is saved or used, so
+// that a damaged or mismatched response fails locally with a clear error
+// instead of as a decryption failure at the TGS:
+//
+//   - the session key decrypts with the client's private key, in the
+//     encryption the AS reported, and has the expected size
+//   - the encrypted TGT is an RSA ciphertext, or an envelope sealed under
+//     an RSA-encrypted key, of a plausible size
+//   - the expiry, when the AS reports it, is in the future and within
+//     MaxTGTLifetime
+func VerifyTGT(tgt TGT, privateKey *rsa.PrivateKey, now time.Time) error {
+	return VerifyTGTWithKey(tgt, privateKey, now)
+}
+
+// VerifyTGTWithKey is VerifyTGT for a client with an RSA or a P-256 private
+// key. A P-256 client's session key must be EncryptionECIES.
+func VerifyTGTWithKey(tgt TGT, privateKey crypto.PrivateKey, now time.Time) error {
+	encryptedSessionKey, err := base64.StdEncoding.DecodeString(tgt.EncryptedSessionKey)
+	if err != nil {
+		return fmt.Errorf("encrypted session key is not valid base64: %w", err)
+	}
+	var sessionKey []byte
+	switch privateKey := privateKey.(type) {
+	case *rsa.PrivateKey:
+		sessionKey, err = DecryptSessionKey(tgt.Encryption, privateKey, encryptedSessionKey)
+	case *ecdsa.PrivateKey:
+		if tgt.Encryption != EncryptionECIES {
+			return fmt.Errorf("session key encryption %q is not %s, the only one for a P-256 client key", tgt.Encryption, EncryptionECIES)
+		}
+		sessionKey, err = DecryptSessionKeyECIES(privateKey, encryptedSessionKey)
+	default:
+		return fmt.Errorf("unsupported client key type %T", privateKey)
+	}
+	if err != nil {
+		if errors.Is(err, rsa.ErrDecryption) || errors.Is(err, errECIESDecryption) {
+			return errors.New("session key does not decrypt with the client's private key; the registered public key may not match the local key")
+		}
+		return err
+	}
+	sessionKeyBytes, err := base64.StdEncoding.DecodeString(string(sessionKey))
+	if err != nil || len(sessionKeyBytes) != SessionKeySize {
+		return fmt.Errorf("decrypted session key is malformed (expected %d base64-encoded bytes)", SessionKeySize)
+	}
+
+	encryptedTGT, err := base64.StdEncoding.DecodeString(tgt.EncryptedTGT)
+	if err != nil {
+		return fmt.Errorf("encrypted TGT is not valid base64: %w", err)
+	}
+	// A bare RSA ciphertext is a whole number of 1024-bit steps; an envelope
+	// is longer than its key by the claims and sealedTGTOverhead
+	bare := len(encryptedTGT) >= minTGSKeySize && len(encryptedTGT)%128 == 0
+	if !bare && len(encryptedTGT) <= minTGSKeySize+sealedTGTOverhead {
+		return fmt.Errorf("encrypted TGT is %d bytes, which is not the size of an RSA ciphertext or envelope from a 2048-bit or larger key", len(encryptedTGT))
+	}
+
+	if tgt.ExpiresAt != "" {
+		expiresAt, err := time.Parse(time.RFC3339, tgt.ExpiresAt)
+		if err != nil {
+			return fmt.Errorf("TGT expiry %q is not a valid timestamp: %w", tgt.ExpiresAt, err)
+		}
+		if !expiresAt.After(now) {
+			return fmt.Errorf("TGT expired at %s; check the local clock", expiresAt.Format(time.RFC3339))
+		}
+		if expiresAt.Sub(now) > MaxTGTLifetime {
+			return fmt.Errorf("TGT expiry %s is more than %s away; check the local clock", expiresAt.Format(time.RFC3339), MaxTGTLifetime)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,74 @@
+package ticket
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifyTGT(t *testing.T) {
+	clientKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1700000000, 0).UTC()
+
+	// Build a TGT the way the AS does
+	sessionKeyHash := sha256.Sum256([]byte("client1" + "KU,TGS"))
+	sessionKey := base64.StdEncoding.EncodeToString(sessionKeyHash[:])
+	encryptedSessionKey, err := rsa.EncryptPKCS1v15(rand.Reader, &clientKey.PublicKey, []byte(sessionKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	encryptedTGT, err := rsa.EncryptPKCS1v15(rand.Reader, &otherKey.PublicKey, []byte(`{"clientID":"client1"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid := TGT{
+		EncryptedTGT:        base64.StdEncoding.EncodeToString(encryptedTGT),
+		EncryptedSessionKey: base64.StdEncoding.EncodeToString(encryptedSessionKey),
+		ExpiresAt:           now.Add(time.Hour).Format(time.RFC3339),
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(*TGT)
+		key     *rsa.PrivateKey
+		wantErr string
+	}{
+		{"valid", func(*TGT) {}, clientKey, ""},
+		{"no expiry from older AS", func(tgt *TGT) { tgt.ExpiresAt = "" }, clientKey, ""},
+		{"wrong client key", func(*TGT) {}, otherKey, "does not decrypt"},
+		{"sealed TGT", func(tgt *TGT) { tgt.EncryptedTGT = base64.StdEncoding.EncodeToString(make([]byte, 256+12+40+16)) }, clientKey, ""},
+		{"truncated TGT", func(tgt *TGT) { tgt.EncryptedTGT = base64.StdEncoding.EncodeToString(encryptedTGT[:100]) }, clientKey, "RSA ciphertext"},
+		{"truncated envelope", func(tgt *TGT) { tgt.EncryptedTGT = base64.StdEncoding.EncodeToString(make([]byte, 256+12)) }, clientKey, "RSA ciphertext"},
+		{"garbled session key", func(tgt *TGT) { tgt.EncryptedSessionKey = "!!" }, clientKey, "not valid base64"},
+		{"expired", func(tgt *TGT) { tgt.ExpiresAt = now.Add(-time.Minute).Format(time.RFC3339) }, clientKey, "expired"},
+		{"too far ahead", func(tgt *TGT) { tgt.ExpiresAt = now.Add(48 * time.Hour).Format(time.RFC3339) }, clientKey, "more than"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tgt := valid
+			tt.modify(&tgt)
+			err := VerifyTGT(tgt, tt.key, now)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blockchain-auth/common"
+	"github.com/blockchain-auth/common/commontest"
+	"github.com/hyperledger/fabric-chaincode-go/shimtest"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// gatewayIdentity is the caller a gateway of Org1MSP submits as
+var gatewayIdentity = &commontest.FakeIdentity{MSPID: "Org1MSP", Attrs: map[string]string{gatewayAttribute: "true"}}
+
+// newRiskLedger returns an AS ledger holding policy, and a context on it
+// whose caller is identity
+func newRiskLedger(t *testing.T, policy *RiskPolicy, identity *commontest.FakeIdentity) (*shimtest.MockStub, contractapi.TransactionContextInterface) {
+	t.Helper()
+	stub := commontest.NewStub("as")
+	if policy != nil {
+		policyJSON, err := json.Marshal(policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stub.State[riskPolicyKey] = policyJSON
+	}
+	return stub, commontest.NewContext(stub, identity)
+}
+
+func TestWithinHours(t *testing.T) {
+	tests := []struct {
+		hour, start, end int
+		want             bool
+	}{
+		{12, 6, 22, true},
+		{6, 6, 22, true},
+		{22, 6, 22, false},
+		{3, 6, 22, false},
+		{23, 22, 6, true},
+		{2, 22, 6, true},
+		{12, 22, 6, false},
+		{12, 0, 0, true},
+	}
+	for _, test := range tests {
+		if got := withinHours(test.hour, test.start, test.end); got != test.want {
+			t.Errorf("withinHours(%d, %d, %d) = %v, want %v", test.hour, test.start, test.end, got, test.want)
+		}
+	}
+}
+
+func TestIPInNetworks(t *testing.T) {
+	networks := []string{"10.0.0.0/8", "2001:db8::/32"}
+	for ip, want := range map[string]bool{
+		"10.1.2.3":    true,
+		"11.0.0.1":    false,
+		"2001:db8::1": true,
+		"2001:db9::1": false,
+	} {
+		if got := ipInNetworks(net.ParseIP(ip), networks); got != want {
+			t.Errorf("ipInNetworks(%s) = %v, want %v", ip, got, want)
+		}
+	}
+}
+
+func TestValidateRiskPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  RiskPolicy
+		wantErr bool
+	}{
+		{"valid", RiskPolicy{StepUpMethod: stepUpMethodOTP, TrustedNetworks: []string{"10.0.0.0/8"}, GatewayMSPs: []string{"Org1MSP"}}, false},
+		{"negative threshold", RiskPolicy{StepUpMethod: stepUpMethodOTP, DenyAfterFailures: -1}, true},
+		{"hour out of range", RiskPolicy{StepUpMethod: stepUpMethodOTP, AllowedHoursEnd: 24}, true},
+		{"invalid network", RiskPolicy{StepUpMethod: stepUpMethodOTP, BlockedNetworks: []string{"10.0.0.1"}}, true},
+		{"empty gateway MSP", RiskPolicy{StepUpMethod: stepUpMethodOTP, GatewayMSPs: []string{""}}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := validateRiskPolicy(&test.policy); (err != nil) != test.wantErr {
+				t.Errorf("validateRiskPolicy() error = %v, wantErr %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestIsGatewayCaller(t *testing.T) {
+	policy := &RiskPolicy{GatewayMSPs: []string{"Org1MSP"}}
+	tests := []struct {
+		name     string
+		identity *commontest.FakeIdentity
+		policy   *RiskPolicy
+		want     bool
+	}{
+		{"gateway", gatewayIdentity, policy, true},
+		{"no policy", gatewayIdentity, nil, false},
+		{"other MSP", &commontest.FakeIdentity{MSPID: "Org2MSP", Attrs: map[string]string{gatewayAttribute: "true"}}, policy, false},
+		{"no attribute", &commontest.FakeIdentity{MSPID: "Org1MSP"}, policy, false},
+		{"attribute not true", &commontest.FakeIdentity{MSPID: "Org1MSP", Attrs: map[string]string{gatewayAttribute: "false"}}, policy, false},
+		{"identity error", &commontest.FakeIdentity{MSPID: "Org1MSP", Attrs: map[string]string{gatewayAttribute: "true"}, Err: fmt.Errorf("no identity")}, policy, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := isGatewayCaller(test.identity, test.policy); got != test.want {
+				t.Errorf("isGatewayCaller() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestApplyRiskPolicy(t *testing.T) {
+	policy := RiskPolicy{
+		StepUpAfterFailures: 3,
+		DenyAfterFailures:   10,
+		AllowedHoursStart:   6,
+		AllowedHoursEnd:     22,
+		TrustedNetworks:     []string{"10.0.0.0/8"},
+		BlockedNetworks:     []string{"203.0.113.0/24"},
+		StepUpMethod:        stepUpMethodOTP,
+	}
+	strict := policy
+	strict.Strict = true
+
+	tests := []struct {
+		name       string
+		policy     RiskPolicy
+		decision   RiskDecision
+		wantAction string
+	}{
+		{"trusted network in hours", policy, RiskDecision{SourceIP: "10.0.0.5", Hour: 12}, riskActionAllow},
+		{"untrusted network", policy, RiskDecision{SourceIP: "198.51.100.7", Hour: 12}, riskActionStepUp},
+		{"blocked network", policy, RiskDecision{SourceIP: "203.0.113.9", Hour: 12}, riskActionDeny},
+		{"outside hours", policy, RiskDecision{SourceIP: "10.0.0.5", Hour: 23}, riskActionStepUp},
+		{"some failures", policy, RiskDecision{SourceIP: "10.0.0.5", Hour: 12, RecentFailures: 3}, riskActionStepUp},
+		{"many failures", policy, RiskDecision{SourceIP: "10.0.0.5", Hour: 12, RecentFailures: 10}, riskActionDeny},
+		{"unknown IP", policy, RiskDecision{Hour: 12}, riskActionStepUp},
+		{"unknown IP under a strict policy", strict, RiskDecision{Hour: 12}, riskActionDeny},
+		{"known IP under a strict policy", strict, RiskDecision{SourceIP: "10.0.0.5", Hour: 12}, riskActionAllow},
+		{"empty policy", RiskPolicy{StepUpMethod: stepUpMethodOTP}, RiskDecision{Hour: 3, RecentFailures: 50}, riskActionAllow},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			decision := test.decision
+			decision.Action = riskActionAllow
+			applyRiskPolicy(&test.policy, &decision)
+			if decision.Action != test.wantAction {
+				t.Fatalf("action = %s (%v), want %s", decision.Action, decision.Reasons, test.wantAction)
+			}
+			if decision.Action == riskActionStepUp && decision.StepUp != stepUpMethodOTP {
+				t.Errorf("step-up method = %q", decision.StepUp)
+			}
+			if decision.Action != riskActionAllow && len(decision.Reasons) == 0 {
+				t.Error("decision has no reasons")
+			}
+		})
+	}
+}
+
+func TestEvaluateRiskSourceIPFromGatewayOnly(t *testing.T) {
+	policy := &RiskPolicy{
+		TrustedNetworks: []string{"10.0.0.0/8"},
+		BlockedNetworks: []string{"203.0.113.0/24"},
+		GatewayMSPs:     []string{"Org1MSP"},
+		StepUpMethod:    stepUpMethodAdmin,
+		Strict:          true,
+	}
+	timestamp := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	// A gateway's report is believed
+	_, ctx := newRiskLedger(t, policy, gatewayIdentity)
+	decision, err := evaluateRisk(ctx, "client1", AuthContext{SourceIP: "10.0.0.5"}, timestamp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decision.Action != riskActionAllow || decision.SourceIP != "10.0.0.5" || decision.SourceIPIgnored {
+		t.Errorf("decision for the gateway = %+v", decision)
+	}
+	_, ctx = newRiskLedger(t, policy, gatewayIdentity)
+	if decision, err := evaluateRisk(ctx, "client1", AuthContext{SourceIP: "203.0.113.9"}, timestamp); err != nil || decision.Action != riskActionDeny {
+		t.Errorf("decision for a blocked IP from the gateway = %+v, %v", decision, err)
+	}
+
+	// A client calling directly cannot claim a trusted network
+	client := &commontest.FakeIdentity{MSPID: "Org1MSP"}
+	stub, ctx := newRiskLedger(t, policy, client)
+	decision, err = evaluateRisk(ctx, "client1", AuthContext{SourceIP: "10.0.0.5"}, timestamp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decision.SourceIP != "" || !decision.SourceIPIgnored {
+		t.Errorf("decision kept the source IP of a direct caller: %+v", decision)
+	}
+	// ...and an unknown IP cannot be shown to be outside the blocked networks
+	if decision.Action != riskActionDeny {
+		t.Errorf("direct caller under a strict policy got %s (%v), want deny", decision.Action, decision.Reasons)
+	}
+	recorded := &RiskDecision{}
+	if err := json.Unmarshal(stub.State[decision.DecisionID], recorded); err != nil || !recorded.SourceIPIgnored {
+		t.Errorf("recorded decision = %+v, %v", recorded, err)
+	}
+
+	// Without a strict policy, the direct caller only needs a step-up
+	lenient := *policy
+	lenient.Strict = false
+	_, ctx = newRiskLedger(t, &lenient, client)
+	if decision, err := evaluateRisk(ctx, "client1", AuthContext{SourceIP: "10.0.0.5"}, timestamp); err != nil || decision.Action != riskActionStepUp {
+		t.Errorf("direct caller under a lenient policy = %+v, %v, want a step-up", decision, err)
+	}
+}
+
+func TestEvaluateRiskWithoutPolicy(t *testing.T) {
+	_, ctx := newRiskLedger(t, nil, gatewayIdentity)
+	decision, err := evaluateRisk(ctx, "client1", AuthContext{SourceIP: "203.0.113.9"}, time.Unix(1700000000, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decision.Action != riskActionAllow || !decision.SourceIPIgnored {
+		t.Errorf("decision without a policy = %+v", decision)
+	}
+}
+
+func TestStepUpAfterFailures(t *testing.T) {
+	policy := &RiskPolicy{FailureWindow: 900, StepUpAfterFailures: 2, DenyAfterFailures: 4, StepUpMethod: stepUpMethodOTP}
+	_, ctx := newRiskLedger(t, policy, gatewayIdentity)
+	s := &ASChaincode{}
+	now, err := common.GetDeterministicTimestamp(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := recordAuthFailure(ctx, "client1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if failures, err := recentAuthFailures(ctx, "client1", now.Unix()-900); err != nil || len(failures) != 2 {
+		t.Fatalf("recentAuthFailures() = %v, %v, want 2 failures", failures, err)
+	}
+	if failures, _ := recentAuthFailures(ctx, "client1", now.Unix()+1); len(failures) != 0 {
+		t.Errorf("failures before the window counted: %v", failures)
+	}
+
+	decision, err := evaluateRisk(ctx, "client1", AuthContext{}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decision.Action != riskActionStepUp || decision.RecentFailures != 2 {
+		t.Fatalf("decision after 2 failures = %+v", decision)
+	}
+	challenge := &AuthChallenge{ClientID: "client1", StepUp: decision.StepUp}
+	if err := checkStepUp(ctx, challenge); err == nil || !strings.Contains(err.Error(), "not been completed") {
+		t.Errorf("checkStepUp() before the step-up error = %v", err)
+	}
+
+	// A second evaluation carries the open step-up over
+	first, _ := getStepUp(ctx, "client1")
+	if _, err := evaluateRisk(ctx, "client1", AuthContext{}, now.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := getStepUp(ctx, "client1"); again == nil || again.DecisionID != first.DecisionID {
+		t.Errorf("step-up replaced while open: %+v, was %+v", again, first)
+	}
+
+	code := "otp_123456"
+	codeHash := fmt.Sprintf("%x", sha256.Sum256([]byte(code)))
+	if err := s.CompleteStepUp(ctx, "client1", code); err == nil {
+		t.Error("step-up completed before a code was issued")
+	}
+	if err := s.IssueStepUpCode(ctx, "client1", codeHash); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CompleteStepUp(ctx, "client1", "otp_654321"); err == nil {
+		t.Error("step-up completed with the wrong code")
+	}
+	if err := s.CompleteStepUp(ctx, "client1", code); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkStepUp(ctx, challenge); err != nil {
+		t.Errorf("checkStepUp() after the step-up failed: %v", err)
+	}
+
+	// Enough failures deny outright
+	for i := 0; i < 2; i++ {
+		if err := recordAuthFailure(ctx, "client1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if decision, err := evaluateRisk(ctx, "client1", AuthContext{}, now); err != nil || decision.Action != riskActionDeny {
+		t.Errorf("decision after 4 failures = %+v, %v", decision, err)
+	}
+
+	if err := clearAuthState(ctx, "client1"); err != nil {
+		t.Fatal(err)
+	}
+	if failures, _ := recentAuthFailures(ctx, "client1", 0); len(failures) != 0 {
+		t.Errorf("failures kept after authenticating: %v", failures)
+	}
+	if stepUp, _ := getStepUp(ctx, "client1"); stepUp != nil {
+		t.Errorf("step-up kept after authenticating: %+v", stepUp)
+	}
+}
+
+func TestApproveStepUpOverrulesDenial(t *testing.T) {
+	policy := &RiskPolicy{StepUpAfterFailures: 1, FailureWindow: 900, StepUpMethod: stepUpMethodAdmin}
+	_, ctx := newRiskLedger(t, policy, gatewayIdentity)
+	s := &ASChaincode{}
+	if err := s.ApproveStepUp(ctx, "client1"); err == nil {
+		t.Error("step-up approved with none open")
+	}
+
+	if err := recordAuthFailure(ctx, "client1"); err != nil {
+		t.Fatal(err)
+	}
+	now, err := common.GetDeterministicTimestamp(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decision, err := evaluateRisk(ctx, "client1", AuthContext{}, now)
+	if err != nil || decision.Action != riskActionStepUp {
+		t.Fatalf("decision = %+v, %v", decision, err)
+	}
+	stepUp, _ := getStepUp(ctx, "client1")
+	stepUp.Denied = true
+	if err := putStepUp(ctx, stepUp); err != nil {
+		t.Fatal(err)
+	}
+	challenge := &AuthChallenge{ClientID: "client1", StepUp: decision.StepUp}
+	if err := checkStepUp(ctx, challenge); err == nil || !strings.Contains(err.Error(), "denied") {
+		t.Errorf("checkStepUp() after a denial error = %v", err)
+	}
+
+	if err := s.ApproveStepUp(ctx, "client1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkStepUp(ctx, challenge); err != nil {
+		t.Errorf("checkStepUp() after the approval failed: %v", err)
+	}
+	if stepUp, _ := getStepUp(ctx, "client1"); stepUp.ApprovedBy != "Org1MSP" {
+		t.Errorf("step-up approved by %q", stepUp.ApprovedBy)
+	}
+}
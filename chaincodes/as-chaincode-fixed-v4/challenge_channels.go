@@ -0,0 +1,317 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/blockchain-auth/common"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// A client may register a challenge channel: the endpoint of an app on its
+// owner's phone, and the public key the app signs with. When the risk
+// policy's step-up method is "push", the step-up the AS opens carries a
+// challenge for that app. A daemon watching RiskDecision events reads it
+// with GetPushChallenge and posts it to the endpoint; the owner approves or
+// denies the attempt in the app, which signs pushAnswerMessage and submits
+// AnswerPushChallenge. Meanwhile the client polls GetStepUpStatus and, once
+// the step-up is satisfied, verifies its nonce as usual.
+//
+// A denial fails the step-up until it expires and counts as a failed
+// attempt. A client without a channel can still be approved by an admin with
+// ApproveStepUp. The channel is registered and removed with the client's
+// key, like its attributes.
+
+const (
+	challengeChannelKeyPrefix = "CHALLENGE_CHANNEL_"
+
+	stepUpMethodPush = "push"
+
+	pushAnswerApprove = "approve"
+	pushAnswerDeny    = "deny"
+
+	maxChallengeEndpointLength = 512
+
+	challengeChannelSetEvent     = "ChallengeChannelSet"
+	challengeChannelRemovedEvent = "ChallengeChannelRemoved"
+	pushChallengeAnsweredEvent   = "PushChallengeAnswered"
+)
+
+// ChallengeChannel is the app a client's push step-ups are delivered to
+type ChallengeChannel struct {
+	ClientID     string    `json:"clientID"`
+	Endpoint     string    `json:"endpoint"` // http(s) URL the daemon posts challenges to
+	KeyType      string    `json:"keyType"`
+	PublicKey    string    `json:"publicKey"` // PEM key the app signs answers with
+	RegisteredAt time.Time `json:"registeredAt"`
+}
+
+// PushChallenge is what the daemon delivers to a client's app: the
+// challenge to sign and what the owner needs to decide
+type PushChallenge struct {
+	ClientID  string    `json:"clientID"`
+	Endpoint  string    `json:"endpoint"`
+	Challenge string    `json:"challenge"`
+	SourceIP  string    `json:"sourceIP,omitempty"`
+	Reasons   []string  `json:"reasons,omitempty"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// setChannelMessage is the message a client signs to register the channel
+// whose endpoint and PEM key hash to channelHash (hex SHA-256 of
+// endpoint|publicKeyPEM)
+func setChannelMessage(clientID string, channelHash string, timestamp int64) string {
+	return fmt.Sprintf("SET_CHALLENGE_CHANNEL|%s|%s|%d", clientID, channelHash, timestamp)
+}
+
+// removeChannelMessage is the message a client signs to remove its channel
+func removeChannelMessage(clientID string, timestamp int64) string {
+	return fmt.Sprintf("REMOVE_CHALLENGE_CHANNEL|%s|%d", clientID, timestamp)
+}
+
+// pushAnswerMessage is the message the app signs to answer a challenge
+func pushAnswerMessage(clientID string, challenge string, answer string) string {
+	return fmt.Sprintf("PUSH_ANSWER|%s|%s|%s", clientID, challenge, answer)
+}
+
+// pushChallenge derives the challenge of a push step-up opened in a
+// transaction
+func pushChallenge(txID string, clientID string) string {
+	challenge := sha256.Sum256([]byte("PUSH_CHALLENGE|" + txID + "|" + clientID))
+	return base64.StdEncoding.EncodeToString(challenge[:])
+}
+
+// checkChallengeEndpoint accepts absolute http and https URLs
+func checkChallengeEndpoint(endpoint string) error {
+	if len(endpoint) > maxChallengeEndpointLength {
+		return fmt.Errorf("endpoint is longer than %d characters", maxChallengeEndpointLength)
+	}
+	parsed, err := url.Parse(endpoint)
+	if err != nil {
+		return fmt.Errorf("invalid endpoint: %v", err)
+	}
+	if (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+		return fmt.Errorf("endpoint must be an http or https URL")
+	}
+	return nil
+}
+
+// SetChallengeChannel registers or replaces a client's challenge channel.
+// The client signs setChannelMessage with its key.
+func (s *ASChaincode) SetChallengeChannel(ctx contractapi.TransactionContextInterface, clientID string, endpoint string, publicKeyPEM string, timestamp int64, signature string) (*ChallengeChannel, error) {
+	if err := checkChallengeEndpoint(endpoint); err != nil {
+		return nil, err
+	}
+	keyType, err := common.RegistrationKeyType([]byte(publicKeyPEM))
+	if err != nil {
+		return nil, err
+	}
+	now, err := common.GetDeterministicTimestamp(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get timestamp: %v", err)
+	}
+	if err := checkSignedAt(timestamp, now); err != nil {
+		return nil, err
+	}
+	if _, err := getClientIdentity(ctx.GetStub(), clientID); err != nil {
+		return nil, err
+	}
+	channelHash := fmt.Sprintf("%x", sha256.Sum256([]byte(endpoint+"|"+publicKeyPEM)))
+	if err := s.verifyClientSignature(ctx, clientID, setChannelMessage(clientID, channelHash, timestamp), signature); err != nil {
+		return nil, err
+	}
+
+	channel := &ChallengeChannel{
+		ClientID:     clientID,
+		Endpoint:     endpoint,
+		KeyType:      keyType,
+		PublicKey:    publicKeyPEM,
+		RegisteredAt: now.UTC(),
+	}
+	uow := common.NewUnitOfWork(ctx)
+	if err := uow.PutJSON(challengeChannelKeyPrefix+clientID, channel); err != nil {
+		return nil, err
+	}
+	if err := uow.Commit(); err != nil {
+		return nil, err
+	}
+
+	eventJSON, err := json.Marshal(map[string]string{"clientID": clientID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal channel event: %v", err)
+	}
+	if err := common.SetEvent(ctx, challengeChannelSetEvent, eventJSON); err != nil {
+		return nil, fmt.Errorf("failed to emit channel event: %v", err)
+	}
+	return channel, nil
+}
+
+// RemoveChallengeChannel removes a client's challenge channel. The client
+// signs removeChannelMessage with its key.
+func (s *ASChaincode) RemoveChallengeChannel(ctx contractapi.TransactionContextInterface, clientID string, timestamp int64, signature string) error {
+	now, err := common.GetDeterministicTimestamp(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get timestamp: %v", err)
+	}
+	if err := checkSignedAt(timestamp, now); err != nil {
+		return err
+	}
+	if err := s.verifyClientSignature(ctx, clientID, removeChannelMessage(clientID, timestamp), signature); err != nil {
+		return err
+	}
+	channel, err := getChallengeChannel(ctx, clientID)
+	if err != nil {
+		return err
+	}
+	if channel == nil {
+		return fmt.Errorf("client %s has no challenge channel", clientID)
+	}
+
+	if err := ctx.GetStub().DelState(challengeChannelKeyPrefix + clientID); err != nil {
+		return fmt.Errorf("failed to remove challenge channel: %v", err)
+	}
+	eventJSON, err := json.Marshal(map[string]string{"clientID": clientID})
+	if err != nil {
+		return fmt.Errorf("failed to marshal channel event: %v", err)
+	}
+	if err := common.SetEvent(ctx, challengeChannelRemovedEvent, eventJSON); err != nil {
+		return fmt.Errorf("failed to emit channel event: %v", err)
+	}
+	return nil
+}
+
+// GetChallengeChannel returns a client's challenge channel, or nil if it
+// has none
+func (s *ASChaincode) GetChallengeChannel(ctx contractapi.TransactionContextInterface, clientID string) (*ChallengeChannel, error) {
+	return getChallengeChannel(ctx, clientID)
+}
+
+// GetPushChallenge returns the challenge of a client's open push step-up,
+// addressed to its challenge channel
+func (s *ASChaincode) GetPushChallenge(ctx contractapi.TransactionContextInterface, clientID string) (*PushChallenge, error) {
+	stepUp, err := getOpenStepUp(ctx, clientID)
+	if err != nil {
+		return nil, err
+	}
+	if stepUp.Method != stepUpMethodPush || stepUp.Challenge == "" {
+		return nil, fmt.Errorf("step-up for client %s is not a push step-up", clientID)
+	}
+	if stepUp.Denied {
+		return nil, fmt.Errorf("step-up for client %s has been denied", clientID)
+	}
+	channel, err := getChallengeChannel(ctx, clientID)
+	if err != nil {
+		return nil, err
+	}
+	if channel == nil {
+		return nil, fmt.Errorf("client %s has no challenge channel", clientID)
+	}
+
+	challenge := &PushChallenge{
+		ClientID:  clientID,
+		Endpoint:  channel.Endpoint,
+		Challenge: stepUp.Challenge,
+		ExpiresAt: stepUp.ExpiresAt,
+	}
+	decisionBytes, err := ctx.GetStub().GetState(stepUp.DecisionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read risk decision: %v", err)
+	}
+	if decisionBytes != nil {
+		var decision RiskDecision
+		if err := json.Unmarshal(decisionBytes, &decision); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal risk decision: %v", err)
+		}
+		challenge.SourceIP = decision.SourceIP
+		challenge.Reasons = decision.Reasons
+	}
+	return challenge, nil
+}
+
+// AnswerPushChallenge approves or denies a client's open push step-up with
+// a signature by the app registered as its challenge channel
+func (s *ASChaincode) AnswerPushChallenge(ctx contractapi.TransactionContextInterface, clientID string, answer string, signature string) error {
+	if answer != pushAnswerApprove && answer != pushAnswerDeny {
+		return fmt.Errorf("answer must be %q or %q", pushAnswerApprove, pushAnswerDeny)
+	}
+	stepUp, err := getOpenStepUp(ctx, clientID)
+	if err != nil {
+		return err
+	}
+	if stepUp.Method != stepUpMethodPush || stepUp.Challenge == "" {
+		return fmt.Errorf("step-up for client %s is not a push step-up", clientID)
+	}
+	if stepUp.Denied {
+		return fmt.Errorf("step-up for client %s has already been denied", clientID)
+	}
+	channel, err := getChallengeChannel(ctx, clientID)
+	if err != nil {
+		return err
+	}
+	if channel == nil {
+		return fmt.Errorf("client %s has no challenge channel", clientID)
+	}
+
+	signatureBytes, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("invalid signature format: %v", err)
+	}
+	hashed := sha256.Sum256([]byte(pushAnswerMessage(clientID, stepUp.Challenge, answer)))
+	if err := common.VerifyKeySignature("push answer verification", channel.KeyType, []byte(channel.PublicKey), hashed[:], signatureBytes); err != nil {
+		return err
+	}
+
+	if answer == pushAnswerApprove {
+		stepUp.Satisfied = true
+		stepUp.ApprovedBy = stepUpMethodPush
+	} else {
+		stepUp.Denied = true
+		if err := recordAuthFailure(ctx, clientID); err != nil {
+			return err
+		}
+	}
+	if err := putStepUp(ctx, stepUp); err != nil {
+		return err
+	}
+
+	eventJSON, err := json.Marshal(map[string]string{"clientID": clientID, "answer": answer})
+	if err != nil {
+		return fmt.Errorf("failed to marshal answer event: %v", err)
+	}
+	if err := common.SetEvent(ctx, pushChallengeAnsweredEvent, eventJSON); err != nil {
+		return fmt.Errorf("failed to emit answer event: %v", err)
+	}
+
+	fmt.Printf("Push step-up for client %s answered: %s\n", clientID, answer)
+	return nil
+}
+
+// GetStepUpStatus returns a client's step-up, without its code hash, or nil
+// if none is pending. Clients poll it while a push step-up is answered.
+func (s *ASChaincode) GetStepUpStatus(ctx contractapi.TransactionContextInterface, clientID string) (*StepUp, error) {
+	stepUp, err := getStepUp(ctx, clientID)
+	if err != nil || stepUp == nil {
+		return nil, err
+	}
+	stepUp.CodeHash = ""
+	return stepUp, nil
+}
+
+func getChallengeChannel(ctx contractapi.TransactionContextInterface, clientID string) (*ChallengeChannel, error) {
+	channelBytes, err := ctx.GetStub().GetState(challengeChannelKeyPrefix + clientID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read challenge channel: %v", err)
+	}
+	if channelBytes == nil {
+		return nil, nil
+	}
+	var channel ChallengeChannel
+	if err := json.Unmarshal(channelBytes, &channel); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal challenge channel: %v", err)
+	}
+	return &channel, nil
+}
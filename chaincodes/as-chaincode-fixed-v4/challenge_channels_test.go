@@ -0,0 +1,102 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"strings"
+	"testing"
+
+	"github.com/blockchain-auth/common"
+)
+
+func TestCheckChallengeEndpoint(t *testing.T) {
+	for endpoint, ok := range map[string]bool{
+		"https://push.example.com/challenges": true,
+		"http://10.0.0.5:8080/push":           true,
+		"ftp://push.example.com":              false,
+		"push.example.com/challenges":         false,
+		"https://":                            false,
+		"https://example.com/" + strings.Repeat("a", maxChallengeEndpointLength): false,
+	} {
+		if err := checkChallengeEndpoint(endpoint); (err == nil) != ok {
+			t.Errorf("checkChallengeEndpoint(%.40q) = %v, want ok %v", endpoint, err, ok)
+		}
+	}
+}
+
+func TestChallengeChannelMessages(t *testing.T) {
+	if got, want := setChannelMessage("client1", "ab12", 1700000000), "SET_CHALLENGE_CHANNEL|client1|ab12|1700000000"; got != want {
+		t.Errorf("setChannelMessage() = %q, want %q", got, want)
+	}
+	if got, want := removeChannelMessage("client1", 1700000000), "REMOVE_CHALLENGE_CHANNEL|client1|1700000000"; got != want {
+		t.Errorf("removeChannelMessage() = %q, want %q", got, want)
+	}
+	if got, want := pushAnswerMessage("client1", "Y2hhbGxlbmdl", pushAnswerApprove), "PUSH_ANSWER|client1|Y2hhbGxlbmdl|approve"; got != want {
+		t.Errorf("pushAnswerMessage() = %q, want %q", got, want)
+	}
+}
+
+func TestPushChallenge(t *testing.T) {
+	challenge := pushChallenge("tx1", "client1")
+	if challenge != pushChallenge("tx1", "client1") {
+		t.Error("pushChallenge() differs between endorsers")
+	}
+	if challenge == pushChallenge("tx2", "client1") || challenge == pushChallenge("tx1", "client2") {
+		t.Error("pushChallenge() repeats across transactions or clients")
+	}
+}
+
+func TestPushAnswerSignature(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKeyPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	keyType, err := common.RegistrationKeyType(publicKeyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hashed := sha256.Sum256([]byte(pushAnswerMessage("client1", "challenge", pushAnswerApprove)))
+	signature, err := key.Sign(rand.Reader, hashed[:], crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := common.VerifyKeySignature("push answer verification", keyType, publicKeyPEM, hashed[:], signature); err != nil {
+		t.Errorf("common.VerifyKeySignature() = %v", err)
+	}
+
+	// An approval cannot be replayed as a denial or for another challenge
+	for _, message := range []string{
+		pushAnswerMessage("client1", "challenge", pushAnswerDeny),
+		pushAnswerMessage("client1", "other", pushAnswerApprove),
+	} {
+		hashed := sha256.Sum256([]byte(message))
+		if err := common.VerifyKeySignature("push answer verification", keyType, publicKeyPEM, hashed[:], signature); err == nil {
+			t.Errorf("signature verified for %q", message)
+		}
+	}
+}
+
+func TestValidateRiskPolicyStepUpMethods(t *testing.T) {
+	for method, ok := range map[string]bool{
+		stepUpMethodOTP:   true,
+		stepUpMethodAdmin: true,
+		stepUpMethodPush:  true,
+		"sms":             false,
+		"":                false,
+	} {
+		if err := validateRiskPolicy(&RiskPolicy{StepUpMethod: method}); (err == nil) != ok {
+			t.Errorf("validateRiskPolicy() with method %q = %v, want ok %v", method, err, ok)
+		}
+	}
+}
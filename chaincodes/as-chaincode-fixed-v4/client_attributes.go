@@ -0,0 +1,107 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/blockchain-auth/common"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// A client registers attributes about itself (department=ops,
+// clearance=secret) with SetClientAttributes, signed with its key like
+// DeregisterClient. The AS copies them into every TGT it issues or renews,
+// sealed for the TGS. The TGS discloses to each service only the attributes
+// that service's policy names, so a device learns the minimum it needs to
+// enforce its rules. A change applies to TGTs issued after it; a client
+// authenticates again or renews its TGT to carry the new attributes.
+//
+// Attribute names and values follow the label syntax (see labels.go).
+
+const (
+	maxClientAttributes = 16
+
+	clientAttributesSetEvent = "ClientAttributesSet"
+)
+
+// setAttributesMessage is the message a client signs to replace its
+// attributes with the ones whose JSON hashes to attributesHash (hex SHA-256)
+func setAttributesMessage(clientID string, attributesHash string, timestamp int64) string {
+	return fmt.Sprintf("SET_ATTRIBUTES|%s|%s|%d", clientID, attributesHash, timestamp)
+}
+
+// parseClientAttributes parses and validates a JSON object of attributes
+func parseClientAttributes(attributesJSON string) (map[string]string, error) {
+	var attributes map[string]string
+	if err := json.Unmarshal([]byte(attributesJSON), &attributes); err != nil {
+		return nil, fmt.Errorf("invalid attributes (expected a JSON object of strings): %v", err)
+	}
+	if len(attributes) > maxClientAttributes {
+		return nil, fmt.Errorf("a client registers at most %d attributes", maxClientAttributes)
+	}
+	for name, value := range attributes {
+		if err := common.ValidateLabelKey(name); err != nil {
+			return nil, fmt.Errorf("attribute %q: %v", name, err)
+		}
+		if err := common.ValidateLabelValue(value); err != nil {
+			return nil, fmt.Errorf("attribute %q: %v", name, err)
+		}
+	}
+	return attributes, nil
+}
+
+// SetClientAttributes replaces a client's attributes. attributesJSON is a
+// JSON object of strings; an empty object removes them all. The client signs
+// setAttributesMessage over the SHA-256 of attributesJSON as sent.
+func (s *ASChaincode) SetClientAttributes(ctx contractapi.TransactionContextInterface, clientID string, attributesJSON string, timestamp int64, signature string) (*ClientIdentity, error) {
+	attributes, err := parseClientAttributes(attributesJSON)
+	if err != nil {
+		return nil, err
+	}
+	now, err := common.GetDeterministicTimestamp(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get timestamp: %v", err)
+	}
+	if err := checkSignedAt(timestamp, now); err != nil {
+		return nil, err
+	}
+	client, err := getClientIdentity(ctx.GetStub(), clientID)
+	if err != nil {
+		return nil, err
+	}
+	attributesHash := fmt.Sprintf("%x", sha256.Sum256([]byte(attributesJSON)))
+	if err := s.verifyClientSignature(ctx, clientID, setAttributesMessage(clientID, attributesHash, timestamp), signature); err != nil {
+		return nil, err
+	}
+
+	client.ID = clientID
+	client.Attributes = attributes
+	if len(attributes) == 0 {
+		client.Attributes = nil
+	}
+	uow := common.NewUnitOfWork(ctx)
+	if err := uow.PutJSON("CLIENT_"+clientID, client); err != nil {
+		return nil, err
+	}
+	if err := uow.Commit(); err != nil {
+		return nil, err
+	}
+
+	// The event names the attributes, not their values, in an order every
+	// endorser agrees on
+	names := make([]string, 0, len(attributes))
+	for name := range attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	eventJSON, err := json.Marshal(map[string]interface{}{"clientID": clientID, "attributes": names})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal attributes event: %v", err)
+	}
+	if err := common.SetEvent(ctx, clientAttributesSetEvent, eventJSON); err != nil {
+		return nil, fmt.Errorf("failed to emit attributes event: %v", err)
+	}
+	return client, nil
+}
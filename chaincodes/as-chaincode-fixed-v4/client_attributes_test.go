@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestParseClientAttributes(t *testing.T) {
+	tooMany := make([]string, 0, maxClientAttributes+1)
+	for i := 0; i <= maxClientAttributes; i++ {
+		tooMany = append(tooMany, fmt.Sprintf(`"attr%d":"x"`, i))
+	}
+	tests := []struct {
+		name    string
+		json    string
+		want    int
+		wantErr bool
+	}{
+		{"attributes", `{"department":"ops","clearance":"secret"}`, 2, false},
+		{"empty", `{}`, 0, false},
+		{"prefixed name", `{"example.com/team":"blue"}`, 1, false},
+		{"not an object", `["ops"]`, 0, true},
+		{"non-string value", `{"level":3}`, 0, true},
+		{"bad name", `{"-dept":"ops"}`, 0, true},
+		{"bad value", `{"department":"ops team"}`, 0, true},
+		{"too many", "{" + strings.Join(tooMany, ",") + "}", 0, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			attributes, err := parseClientAttributes(test.json)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("parseClientAttributes() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if err == nil && len(attributes) != test.want {
+				t.Errorf("parseClientAttributes() = %v, want %d attributes", attributes, test.want)
+			}
+		})
+	}
+}
+
+func TestSetAttributesMessage(t *testing.T) {
+	if got, want := setAttributesMessage("client1", "ab12", 1700000000), "SET_ATTRIBUTES|client1|ab12|1700000000"; got != want {
+		t.Errorf("setAttributesMessage() = %q, want %q", got, want)
+	}
+}
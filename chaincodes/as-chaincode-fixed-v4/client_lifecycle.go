@@ -0,0 +1,258 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/blockchain-auth/common"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// A client leaves with DeregisterClient, or replaces its key pair with
+// RotateClientKey, for instance when the old key may have leaked. Both are
+// signed with the client's current private key, so only the holder of that
+// key can make them. The signed message carries the signing time, which
+// must be within authenticatorMaxSkew of the transaction, so a captured
+// request cannot be replayed later.
+//
+// The TGS keeps its own record of each client, created from the client's
+// TGTs. In the same transaction, the AS sends the TGS a ClientChange signed
+// with the AS private key and sealed with the TGS public key (see
+// common/signed_notice.go). The TGS checks the signature against the AS key
+// it imported, since anyone could seal a change. It then refuses the TGTs the
+// client was issued before the change. After a key rotation the client
+// authenticates again with its new key; a deregistered client ID can be
+// registered again.
+
+const (
+	clientChangeDeregistered = "deregistered"
+	clientChangeKeyRotated   = "key_rotated"
+
+	clientDeregisteredEvent = "ClientDeregistered"
+	clientKeyRotatedEvent   = "ClientKeyRotated"
+
+	metricClientsDeregistered = "clients_deregistered"
+	metricClientKeysRotated   = "client_keys_rotated"
+)
+
+// ClientChange is the notice of a deregistration or key rotation the AS
+// sends the TGS
+type ClientChange struct {
+	ClientID  string    `json:"clientID"`
+	Change    string    `json:"change"` // clientChangeDeregistered or clientChangeKeyRotated
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// deregisterMessage is the message a client signs to deregister
+func deregisterMessage(clientID string, timestamp int64) string {
+	return fmt.Sprintf("DEREGISTER|%s|%d", clientID, timestamp)
+}
+
+// rotateKeyMessage is the message a client signs with its current key to
+// replace it with the key whose PEM hashes to newKeyHash (hex SHA-256)
+func rotateKeyMessage(clientID string, newKeyHash string, timestamp int64) string {
+	return fmt.Sprintf("ROTATE_KEY|%s|%s|%d", clientID, newKeyHash, timestamp)
+}
+
+// checkSignedAt rejects a signing time more than authenticatorMaxSkew
+// seconds from the transaction time
+func checkSignedAt(timestamp int64, now time.Time) error {
+	skew := now.Unix() - timestamp
+	if skew > authenticatorMaxSkew || skew < -authenticatorMaxSkew {
+		return fmt.Errorf("request was signed more than %d seconds from the transaction time; check the local clock", authenticatorMaxSkew)
+	}
+	return nil
+}
+
+// verifyClientSignature checks a signature over message with the client's
+// registered key
+func (s *ASChaincode) verifyClientSignature(ctx contractapi.TransactionContextInterface, clientID string, message string, signatureB64 string) error {
+	keyType, publicKeyPEM, err := s.getClientKey(ctx, clientID)
+	if err != nil {
+		return err
+	}
+	signature, err := base64.StdEncoding.DecodeString(signatureB64)
+	if err != nil {
+		return fmt.Errorf("invalid signature format: %v", err)
+	}
+	hashed := sha256.Sum256([]byte(message))
+	return common.VerifyKeySignature("client signature verification", keyType, publicKeyPEM, hashed[:], signature)
+}
+
+// getClientIdentity reads a client's registration
+func getClientIdentity(store common.StateStore, clientID string) (*ClientIdentity, error) {
+	clientJSON, err := store.GetState("CLIENT_" + clientID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client data: %v", err)
+	}
+	if clientJSON == nil {
+		return nil, fmt.Errorf("client %s does not exist", clientID)
+	}
+	var client ClientIdentity
+	if err := json.Unmarshal(clientJSON, &client); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal client data: %v", err)
+	}
+	return &client, nil
+}
+
+// notifyTGS sends the TGS a signed and sealed ClientChange in the current
+// transaction
+func (s *ASChaincode) notifyTGS(ctx contractapi.TransactionContextInterface, change *ClientChange) error {
+	changeJSON, err := json.Marshal(change)
+	if err != nil {
+		return fmt.Errorf("failed to marshal client change: %v", err)
+	}
+	privateKey, err := s.getPrivateKey(ctx)
+	if err != nil {
+		return err
+	}
+	signedChange, err := common.SignNotice(privateKey, changeJSON)
+	if err != nil {
+		return err
+	}
+	tgsPublicKey, err := s.getPublicKey(ctx, "TGS_PUBLIC_KEY")
+	if err != nil {
+		return fmt.Errorf("failed to get TGS public key: %v", err)
+	}
+	sealedChange, err := common.EncryptForService(ctx, tgsPublicKey, signedChange)
+	if err != nil {
+		return fmt.Errorf("client change encryption failed: %v", err)
+	}
+
+	tgsChaincode, err := common.PeerChaincodeName(ctx, "TGS")
+	if err != nil {
+		return err
+	}
+	response := ctx.GetStub().InvokeChaincode(tgsChaincode, [][]byte{
+		[]byte("ProcessClientChangeFromAS"),
+		[]byte(base64.StdEncoding.EncodeToString(sealedChange)),
+	}, "")
+	if response.Status != 200 {
+		return fmt.Errorf("TGS returned %d: %s", response.Status, response.Message)
+	}
+	return nil
+}
+
+// DeregisterClient removes a client's registration and public key. The
+// client signs deregisterMessage(clientID, timestamp) with its key. Its
+// risk, terms and TGT records stay on the ledger for audit.
+func (s *ASChaincode) DeregisterClient(ctx contractapi.TransactionContextInterface, clientID string, timestamp int64, signature string) error {
+	fmt.Printf("Deregistering client: %s\n", clientID)
+
+	now, err := common.GetDeterministicTimestamp(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get timestamp: %v", err)
+	}
+	if err := checkSignedAt(timestamp, now); err != nil {
+		return err
+	}
+	if err := s.verifyClientSignature(ctx, clientID, deregisterMessage(clientID, timestamp), signature); err != nil {
+		return err
+	}
+
+	uow := common.NewUnitOfWork(ctx)
+	uow.Del("CLIENT_" + clientID)
+	uow.Del("CLIENT_PK_" + clientID)
+	uow.Del("AUTH_CHALLENGE_" + clientID)
+	uow.Del(authFailuresKeyPrefix + clientID)
+	uow.Del(stepUpKeyPrefix + clientID)
+	uow.Del(challengeChannelKeyPrefix + clientID)
+	if err := uow.IncrementMetric(metricClientsDeregistered); err != nil {
+		return err
+	}
+	if err := uow.Commit(); err != nil {
+		return err
+	}
+
+	change := &ClientChange{ClientID: clientID, Change: clientChangeDeregistered, Timestamp: now.UTC()}
+	if err := s.notifyTGS(ctx, change); err != nil {
+		return fmt.Errorf("failed to notify TGS: %v", err)
+	}
+	changeJSON, err := json.Marshal(change)
+	if err != nil {
+		return fmt.Errorf("failed to marshal client change: %v", err)
+	}
+	if err := common.SetEvent(ctx, clientDeregisteredEvent, changeJSON); err != nil {
+		return fmt.Errorf("failed to emit deregistration event: %v", err)
+	}
+
+	fmt.Printf("Client %s deregistered\n", clientID)
+	return nil
+}
+
+// RotateClientKey replaces a client's public key. The client signs
+// rotateKeyMessage with its current key; TGTs issued before the rotation
+// can no longer be renewed or used at the TGS.
+func (s *ASChaincode) RotateClientKey(ctx contractapi.TransactionContextInterface, clientID string, newPublicKeyPEM string, timestamp int64, signature string) (*ClientIdentity, error) {
+	fmt.Printf("Rotating key of client: %s\n", clientID)
+
+	now, err := common.GetDeterministicTimestamp(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get timestamp: %v", err)
+	}
+	if err := checkSignedAt(timestamp, now); err != nil {
+		return nil, err
+	}
+	keyType, err := common.RegistrationKeyType([]byte(newPublicKeyPEM))
+	if err != nil {
+		return nil, err
+	}
+	client, err := getClientIdentity(ctx.GetStub(), clientID)
+	if err != nil {
+		return nil, err
+	}
+	if client.PublicKey == newPublicKeyPEM {
+		return nil, fmt.Errorf("the new key is the client's current key")
+	}
+	newKeyHash := fmt.Sprintf("%x", sha256.Sum256([]byte(newPublicKeyPEM)))
+	if err := s.verifyClientSignature(ctx, clientID, rotateKeyMessage(clientID, newKeyHash, timestamp), signature); err != nil {
+		return nil, err
+	}
+
+	rotatedAt := now.UTC()
+	client.ID = clientID
+	client.PublicKey = newPublicKeyPEM
+	client.KeyType = keyType
+	client.KeyRotatedAt = &rotatedAt
+
+	uow := common.NewUnitOfWork(ctx)
+	if err := uow.PutJSON("CLIENT_"+clientID, client); err != nil {
+		return nil, err
+	}
+	uow.Put("CLIENT_PK_"+clientID, []byte(newPublicKeyPEM))
+	// A challenge issued before the rotation was meant for the old key
+	uow.Del("AUTH_CHALLENGE_" + clientID)
+	if err := uow.IncrementMetric(metricClientKeysRotated); err != nil {
+		return nil, err
+	}
+	if err := uow.Commit(); err != nil {
+		return nil, err
+	}
+
+	change := &ClientChange{ClientID: clientID, Change: clientChangeKeyRotated, Timestamp: rotatedAt}
+	if err := s.notifyTGS(ctx, change); err != nil {
+		return nil, fmt.Errorf("failed to notify TGS: %v", err)
+	}
+	changeJSON, err := json.Marshal(change)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal client change: %v", err)
+	}
+	if err := common.SetEvent(ctx, clientKeyRotatedEvent, changeJSON); err != nil {
+		return nil, fmt.Errorf("failed to emit key rotation event: %v", err)
+	}
+
+	fmt.Printf("Key of client %s rotated to a %s key\n", clientID, keyType)
+	return client, nil
+}
+
+// checkIssuedAfterKeyRotation refuses a TGT issued to the client before its
+// key was last rotated
+func checkIssuedAfterKeyRotation(client *ClientIdentity, issuedAt time.Time) error {
+	if client.KeyRotatedAt != nil && !issuedAt.After(*client.KeyRotatedAt) {
+		return fmt.Errorf("TGT was issued before the client's key was rotated at %s; authenticate again", client.KeyRotatedAt.Format(time.RFC3339))
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCheckSignedAt(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	tests := []struct {
+		name      string
+		timestamp int64
+		wantErr   bool
+	}{
+		{"now", now.Unix(), false},
+		{"at the skew", now.Unix() - authenticatorMaxSkew, false},
+		{"too old", now.Unix() - authenticatorMaxSkew - 1, true},
+		{"too far ahead", now.Unix() + authenticatorMaxSkew + 1, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := checkSignedAt(test.timestamp, now)
+			if (err != nil) != test.wantErr {
+				t.Errorf("checkSignedAt() error = %v, wantErr %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestClientChangeMessages(t *testing.T) {
+	if got, want := deregisterMessage("client1", 1700000000), "DEREGISTER|client1|1700000000"; got != want {
+		t.Errorf("deregisterMessage() = %q, want %q", got, want)
+	}
+	if got, want := rotateKeyMessage("client1", "ab12", 1700000000), "ROTATE_KEY|client1|ab12|1700000000"; got != want {
+		t.Errorf("rotateKeyMessage() = %q, want %q", got, want)
+	}
+}
+
+func TestCheckIssuedAfterKeyRotation(t *testing.T) {
+	rotatedAt := time.Unix(1700000000, 0)
+	tests := []struct {
+		name     string
+		client   ClientIdentity
+		issuedAt time.Time
+		wantErr  bool
+	}{
+		{"never rotated", ClientIdentity{}, rotatedAt, false},
+		{"issued before", ClientIdentity{KeyRotatedAt: &rotatedAt}, rotatedAt.Add(-time.Minute), true},
+		{"issued in the rotating transaction", ClientIdentity{KeyRotatedAt: &rotatedAt}, rotatedAt, true},
+		{"issued after", ClientIdentity{KeyRotatedAt: &rotatedAt}, rotatedAt.Add(time.Second), false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := checkIssuedAfterKeyRotation(&test.client, test.issuedAt)
+			if (err != nil) != test.wantErr {
+				t.Errorf("checkIssuedAfterKeyRotation() error = %v, wantErr %v", err, test.wantErr)
+			}
+		})
+	}
+}
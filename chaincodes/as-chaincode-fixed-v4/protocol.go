@@ -0,0 +1,169 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+
+	"github.com/blockchain-auth/common"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Clients and chaincodes are upgraded independently, so a client asks each
+// chaincode which protocol versions it speaks (GetProtocolInfo) and picks
+// the newest one both sides know. Chaincodes without GetProtocolInfo speak
+// version 1.
+//
+//	1  the client's session key is RSA PKCS#1 v1.5 encrypted; TGT claims are JSON
+//	2  the client may ask for a hybrid envelope or RSA-OAEP instead
+//	   (GenerateTGTWithProtocol); clients with a P-256 key ask for ECIES,
+//	   the only encryption their key allows (see ec_keys.go)
+//
+// The TGT is encrypted for the TGS in the deployment's padding whatever the
+// client asks for (see common/padding.go).
+
+// ProtocolInfo is what GetProtocolInfo reports
+type ProtocolInfo struct {
+	Service       string   `json:"service"`
+	Versions      []int    `json:"versions"`
+	Encryption    []string `json:"encryption"`
+	TicketFormats []string `json:"ticketFormats"`
+}
+
+// TGTProtocol is the message format a client asks GenerateTGTWithProtocol for
+type TGTProtocol struct {
+	Version      int    `json:"version"`
+	Encryption   string `json:"encryption"`
+	TicketFormat string `json:"ticketFormat,omitempty"`
+}
+
+const (
+	protocolV1 = 1
+	protocolV2 = 2
+
+	encryptionPKCS1v15 = "rsa-pkcs1v15"
+	// encryptionHybrid is an RSA-OAEP (SHA-256) encrypted AES-256 key
+	// followed by a 12-byte nonce and the AES-GCM ciphertext
+	encryptionHybrid = "rsa-oaep-aes256gcm"
+	// encryptionOAEP is RSA-OAEP (SHA-256) alone
+	encryptionOAEP = "rsa-oaep-sha256"
+
+	ticketFormatJSON = "json"
+)
+
+// asProtocolInfo lists what this chaincode speaks, oldest first
+var asProtocolInfo = ProtocolInfo{
+	Service:       "as",
+	Versions:      []int{protocolV1, protocolV2},
+	Encryption:    []string{encryptionPKCS1v15, encryptionHybrid, encryptionOAEP, common.EncryptionECIES},
+	TicketFormats: []string{ticketFormatJSON},
+}
+
+// legacyTGTProtocol is what GenerateTGT has always produced
+var legacyTGTProtocol = TGTProtocol{Version: protocolV1, Encryption: encryptionPKCS1v15, TicketFormat: ticketFormatJSON}
+
+// GetProtocolInfo reports the protocol versions and message formats this
+// chaincode supports, less the encryptions the ticket policy does not allow
+func (s *ASChaincode) GetProtocolInfo(ctx contractapi.TransactionContextInterface) (*ProtocolInfo, error) {
+	policy, err := getTicketPolicy(ctx)
+	if err != nil {
+		return nil, err
+	}
+	info := asProtocolInfo
+	info.Encryption = nil
+	for _, encryption := range asProtocolInfo.Encryption {
+		if containsString(policy.Encryptions, encryption) {
+			info.Encryption = append(info.Encryption, encryption)
+		}
+	}
+	return &info, nil
+}
+
+// GenerateTGTWithProtocol is GenerateTGT with the message format negotiated
+// by the client. protocolJSON is a TGTProtocol.
+func (s *ASChaincode) GenerateTGTWithProtocol(ctx contractapi.TransactionContextInterface, clientID string, protocolJSON string) (*ResponseToClient, error) {
+	var protocol TGTProtocol
+	if err := json.Unmarshal([]byte(protocolJSON), &protocol); err != nil {
+		return nil, fmt.Errorf("invalid protocol format (JSON parsing failed): %v", err)
+	}
+	if err := protocol.validate(); err != nil {
+		return nil, err
+	}
+	return s.generateTGT(ctx, clientID, protocol)
+}
+
+// validate rejects a protocol this chaincode cannot produce
+func (p *TGTProtocol) validate() error {
+	if !containsInt(asProtocolInfo.Versions, p.Version) {
+		return fmt.Errorf("unsupported protocol version %d (supported: %v)", p.Version, asProtocolInfo.Versions)
+	}
+	if !containsString(asProtocolInfo.Encryption, p.Encryption) {
+		return fmt.Errorf("unsupported encryption %q (supported: %v)", p.Encryption, asProtocolInfo.Encryption)
+	}
+	if p.Encryption != encryptionPKCS1v15 && p.Version < protocolV2 {
+		return fmt.Errorf("encryption %s needs protocol version %d", p.Encryption, protocolV2)
+	}
+	if p.TicketFormat == "" {
+		p.TicketFormat = ticketFormatJSON
+	}
+	if !containsString(asProtocolInfo.TicketFormats, p.TicketFormat) {
+		return fmt.Errorf("unsupported ticket format %q (supported: %v)", p.TicketFormat, asProtocolInfo.TicketFormats)
+	}
+	return nil
+}
+
+// sealForClient encrypts plaintext for a client's registered key in the
+// given encryption, which must suit the key type
+func sealForClient(keyType string, publicKeyPEM []byte, encryption string, plaintext []byte) ([]byte, error) {
+	if keyType == common.KeyTypeP256 {
+		if encryption != common.EncryptionECIES {
+			return nil, fmt.Errorf("the client has a P-256 key: ask for %s with protocol version %d", common.EncryptionECIES, protocolV2)
+		}
+		publicKey, err := common.ParseECPublicKeyPEM("client public key", publicKeyPEM)
+		if err != nil {
+			return nil, err
+		}
+		return common.EncryptECIES(publicKey, plaintext)
+	}
+	if encryption == common.EncryptionECIES {
+		return nil, fmt.Errorf("%s needs a P-256 client key", common.EncryptionECIES)
+	}
+	publicKey, err := common.ParsePublicKeyPEM("client public key", publicKeyPEM)
+	if err != nil {
+		return nil, err
+	}
+	return encryptForClient(publicKey, encryption, plaintext)
+}
+
+// encryptForClient encrypts plaintext for a client in the given encryption
+func encryptForClient(publicKey *rsa.PublicKey, encryption string, plaintext []byte) ([]byte, error) {
+	switch encryption {
+	case encryptionPKCS1v15:
+		return rsa.EncryptPKCS1v15(rand.Reader, publicKey, plaintext)
+	case encryptionHybrid:
+		return common.EncryptHybrid(publicKey, plaintext)
+	case encryptionOAEP:
+		return rsa.EncryptOAEP(sha256.New(), rand.Reader, publicKey, plaintext, nil)
+	}
+	return nil, fmt.Errorf("unsupported encryption %q", encryption)
+}
+
+func containsInt(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
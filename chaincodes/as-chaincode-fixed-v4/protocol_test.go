@@ -0,0 +1,73 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/blockchain-auth/common"
+)
+
+func TestEncryptHybrid(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	envelope, err := encryptForClient(&key.PublicKey, encryptionHybrid, []byte("session key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wrappedKey := envelope[:key.Size()]
+	nonce := envelope[key.Size() : key.Size()+common.HybridNonceSize]
+	aesKey, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, key, wrappedKey, nil)
+	if err != nil {
+		t.Fatalf("DecryptOAEP() error = %v", err)
+	}
+	block, err := aes.NewCipher(aesKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err := gcm.Open(nil, nonce, envelope[key.Size()+common.HybridNonceSize:], nil)
+	if err != nil || string(plaintext) != "session key" {
+		t.Fatalf("Open() = %q, %v", plaintext, err)
+	}
+}
+
+func TestTGTProtocolValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		protocol TGTProtocol
+		wantErr  bool
+	}{
+		{"legacy", TGTProtocol{Version: protocolV1, Encryption: encryptionPKCS1v15}, false},
+		{"hybrid", TGTProtocol{Version: protocolV2, Encryption: encryptionHybrid, TicketFormat: ticketFormatJSON}, false},
+		{"v2 legacy encryption", TGTProtocol{Version: protocolV2, Encryption: encryptionPKCS1v15}, false},
+		{"hybrid on v1", TGTProtocol{Version: protocolV1, Encryption: encryptionHybrid}, true},
+		{"oaep", TGTProtocol{Version: protocolV2, Encryption: encryptionOAEP}, false},
+		{"oaep on v1", TGTProtocol{Version: protocolV1, Encryption: encryptionOAEP}, true},
+		{"ecies", TGTProtocol{Version: protocolV2, Encryption: common.EncryptionECIES}, false},
+		{"ecies on v1", TGTProtocol{Version: protocolV1, Encryption: common.EncryptionECIES}, true},
+		{"future version", TGTProtocol{Version: 3, Encryption: encryptionPKCS1v15}, true},
+		{"unknown encryption", TGTProtocol{Version: protocolV2, Encryption: "rsa-oaep"}, true},
+		{"unsupported format", TGTProtocol{Version: protocolV2, Encryption: encryptionHybrid, TicketFormat: "cbor"}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.protocol.validate()
+			if (err != nil) != test.wantErr {
+				t.Fatalf("validate() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if err == nil && test.protocol.TicketFormat != ticketFormatJSON {
+				t.Errorf("TicketFormat = %q, want %q", test.protocol.TicketFormat, ticketFormatJSON)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/blockchain-auth/common"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Two RegisterClient calls for one client ID, endorsed at the same time,
+// both find the ID free. Fabric commits whichever the orderer puts first
+// and fails the other with an MVCC conflict, which tells its caller
+// nothing about why.
+//
+// A client first reserves the ID with ReserveClientRegistration. Each
+// reservation is its own key (client ID and transaction ID), so concurrent
+// reservations all commit. RegisterClient then reads every live
+// reservation of the ID and lets only the winner register: the earliest
+// reservation, ties going to the lowest transaction ID. Every endorser
+// reaches the same verdict from the same reservations, and a reservation
+// committed while RegisterClient is in flight invalidates it, since the
+// range it read changed. Losers get errRegistrationInProgress.
+//
+// The winner is named by the hash of the public key it will register, so
+// a client resubmitting its own registration still wins. Reservations
+// expire after registrationReservationTTL, so an abandoned one blocks the
+// ID only briefly. RegisterClient without a reservation still works while
+// nobody else holds one.
+//
+// Reserving is as restricted as registering: both are admin functions. A
+// reservation open to every member would let anyone renew theirs on an ID
+// and keep the admin from registering it.
+
+const (
+	registrationReservationObjectType = "REGISTRATION_RESERVATION"
+
+	// registrationReservationTTL is how long a reservation holds the ID
+	registrationReservationTTL = 2 * time.Minute
+
+	// errRegistrationInProgress starts the error a losing registration gets
+	errRegistrationInProgress = "registration in progress"
+)
+
+// RegistrationReservation is a claim on a client ID ahead of RegisterClient
+type RegistrationReservation struct {
+	ClientID   string    `json:"clientID"`
+	KeyHash    string    `json:"keyHash"` // hex SHA-256 of the public key PEM to register
+	TxID       string    `json:"txID"`
+	ReservedAt time.Time `json:"reservedAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+}
+
+// registrationKeyHash is the hash a reservation names its public key by
+func registrationKeyHash(publicKeyPEM string) string {
+	hash := sha256.Sum256([]byte(publicKeyPEM))
+	return hex.EncodeToString(hash[:])
+}
+
+// ReserveClientRegistration reserves a client ID for the public key whose
+// PEM hashes to keyHash (hex SHA-256). Call RegisterClient with that key
+// once the reservation has committed.
+func (s *ASChaincode) ReserveClientRegistration(ctx contractapi.TransactionContextInterface, clientID string, keyHash string) (*RegistrationReservation, error) {
+	if clientID == "" {
+		return nil, fmt.Errorf("client ID is required")
+	}
+	if decoded, err := hex.DecodeString(keyHash); err != nil || len(decoded) != sha256.Size {
+		return nil, fmt.Errorf("key hash must be a hex SHA-256 digest")
+	}
+
+	existingClientJSON, err := ctx.GetStub().GetState("CLIENT_" + clientID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if existingClientJSON != nil {
+		return nil, fmt.Errorf("client %s already exists", clientID)
+	}
+
+	now, err := common.GetDeterministicTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	txID := ctx.GetStub().GetTxID()
+	reservation := &RegistrationReservation{
+		ClientID:   clientID,
+		KeyHash:    keyHash,
+		TxID:       txID,
+		ReservedAt: now.UTC(),
+		ExpiresAt:  now.Add(registrationReservationTTL).UTC(),
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey(registrationReservationObjectType, []string{clientID, txID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create reservation key: %v", err)
+	}
+	reservationJSON, err := json.Marshal(reservation)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal reservation: %v", err)
+	}
+	if err := ctx.GetStub().PutState(key, reservationJSON); err != nil {
+		return nil, fmt.Errorf("failed to store reservation: %v", err)
+	}
+	return reservation, nil
+}
+
+// registrationWinner returns the reservation that may register, or nil if
+// none is live at now
+func registrationWinner(reservations []RegistrationReservation, now time.Time) *RegistrationReservation {
+	var live []RegistrationReservation
+	for _, reservation := range reservations {
+		if now.Before(reservation.ExpiresAt) {
+			live = append(live, reservation)
+		}
+	}
+	if len(live) == 0 {
+		return nil
+	}
+	sort.Slice(live, func(i, j int) bool {
+		if !live[i].ReservedAt.Equal(live[j].ReservedAt) {
+			return live[i].ReservedAt.Before(live[j].ReservedAt)
+		}
+		return live[i].TxID < live[j].TxID
+	})
+	return &live[0]
+}
+
+// checkRegistrationReservation refuses to register publicKeyPEM as
+// clientID if another key holds the winning reservation. It returns the
+// keys of the ID's reservations, which a successful registration deletes.
+func checkRegistrationReservation(ctx contractapi.TransactionContextInterface, clientID, publicKeyPEM string, now time.Time) ([]string, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(registrationReservationObjectType, []string{clientID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read registration reservations: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	var keys []string
+	var reservations []RegistrationReservation
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate registration reservations: %v", err)
+		}
+		keys = append(keys, queryResponse.Key)
+		var reservation RegistrationReservation
+		if err := json.Unmarshal(queryResponse.Value, &reservation); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal registration reservation: %v", err)
+		}
+		reservations = append(reservations, reservation)
+	}
+
+	winner := registrationWinner(reservations, now)
+	if winner != nil && winner.KeyHash != registrationKeyHash(publicKeyPEM) {
+		return nil, fmt.Errorf("%s: client ID %s was reserved for another key at %s (tx %s); retry after %s if it is not registered",
+			errRegistrationInProgress, clientID, winner.ReservedAt.Format(time.RFC3339), winner.TxID, winner.ExpiresAt.Format(time.RFC3339))
+	}
+	return keys, nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/blockchain-auth/common"
+	"github.com/blockchain-auth/common/commontest"
+)
+
+func TestRegistrationWinner(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	reservation := func(txID string, reservedAgo time.Duration) RegistrationReservation {
+		reservedAt := now.Add(-reservedAgo)
+		return RegistrationReservation{
+			ClientID:   "client1",
+			KeyHash:    "key-" + txID,
+			TxID:       txID,
+			ReservedAt: reservedAt,
+			ExpiresAt:  reservedAt.Add(registrationReservationTTL),
+		}
+	}
+
+	tests := []struct {
+		name         string
+		reservations []RegistrationReservation
+		want         string // winning TxID, "" for none
+	}{
+		{"none", nil, ""},
+		{"earliest wins", []RegistrationReservation{reservation("b", time.Second), reservation("a", 2*time.Second)}, "a"},
+		{"tie goes to the lowest tx ID", []RegistrationReservation{reservation("d", time.Second), reservation("c", time.Second)}, "c"},
+		{"expired reservations are ignored", []RegistrationReservation{reservation("old", registrationReservationTTL), reservation("new", time.Second)}, "new"},
+		{"all expired", []RegistrationReservation{reservation("old", 2*registrationReservationTTL)}, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			winner := registrationWinner(test.reservations, now)
+			got := ""
+			if winner != nil {
+				got = winner.TxID
+			}
+			if got != test.want {
+				t.Errorf("registrationWinner() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRegistrationWinnerIgnoresOrder(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	reservedAt := now.Add(-time.Second)
+	first := RegistrationReservation{TxID: "a", ReservedAt: reservedAt, ExpiresAt: now.Add(time.Minute)}
+	second := RegistrationReservation{TxID: "b", ReservedAt: reservedAt, ExpiresAt: now.Add(time.Minute)}
+
+	forward := registrationWinner([]RegistrationReservation{first, second}, now)
+	backward := registrationWinner([]RegistrationReservation{second, first}, now)
+	if forward.TxID != backward.TxID {
+		t.Errorf("winner depends on read order: %s vs %s", forward.TxID, backward.TxID)
+	}
+}
+
+func TestRegistrationKeyHash(t *testing.T) {
+	if registrationKeyHash("key") == registrationKeyHash("other key") {
+		t.Error("different keys hash the same")
+	}
+	if got := len(registrationKeyHash("key")); got != 64 {
+		t.Errorf("hash length = %d, want 64 hex digits", got)
+	}
+}
+
+func TestReserveClientRegistrationAdminOnly(t *testing.T) {
+	keyHash := registrationKeyHash("public key")
+	tests := []struct {
+		name     string
+		identity *commontest.FakeIdentity
+		wantErr  bool
+	}{
+		{"admin MSP", &commontest.FakeIdentity{MSPID: "Org1MSP"}, false},
+		{"user-admin of the admin MSP", &commontest.FakeIdentity{MSPID: "Org1MSP", Attrs: map[string]string{common.RoleAttribute: common.RoleUserAdmin}}, false},
+		{"auditor of the admin MSP", &commontest.FakeIdentity{MSPID: "Org1MSP", Attrs: map[string]string{common.RoleAttribute: common.RoleAuditor}}, true},
+		{"other MSP", &commontest.FakeIdentity{MSPID: "Org2MSP"}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stub := commontest.NewInvocation("ReserveClientRegistration", "client1", keyHash)
+			stub.State[common.AdminMSPsKey] = []byte(`["Org1MSP"]`)
+			err := beforeTransaction(commontest.NewContext(stub, test.identity))
+			if (err != nil) != test.wantErr {
+				t.Errorf("beforeTransaction() error = %v, wantErr %v", err, test.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/blockchain-auth/common"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// A TGT is valid for the ticket policy's TGT lifetime, tgtLifetime by
+// default (see ticket_policy.go). A client whose TGT is still valid can
+// renew it with RenewTGT instead of running the authentication flow again:
+// it presents the encrypted TGT with a fresh authenticator and gets a TGT
+// with the same session key and a new lifetime. Each TGT can be renewed
+// once, and renewals stop once the policy's renewal limit, maxTGTRenewal
+// by default, has passed since the client authenticated. TGTs issued before
+// their records carried the encrypted TGT's hash cannot be renewed.
+
+const (
+	// tgtLifetime is how long a TGT is valid by default, in seconds
+	tgtLifetime = 60 * 60
+
+	// maxTGTRenewal is how long after authenticating a client may keep
+	// renewing its TGT by default, in seconds
+	maxTGTRenewal = 24 * 60 * 60
+
+	// authenticatorMaxSkew is how far an authenticator's timestamp may be
+	// from the transaction time, in seconds
+	authenticatorMaxSkew = 5 * 60
+
+	tgtStatusIssued  = "issued"
+	tgtStatusRenewed = "renewed"
+)
+
+// TGTRecord is the audit record stored for every issued TGT
+type TGTRecord struct {
+	ClientID         string       `json:"clientID"`
+	Timestamp        time.Time    `json:"timestamp"`
+	TGTHash          string       `json:"tgtHash"`
+	EncryptedTGTHash string       `json:"encryptedTGTHash,omitempty"`
+	Protocol         *TGTProtocol `json:"protocol,omitempty"` // Message format the client asked for
+	IssuedAt         time.Time    `json:"issuedAt"`           // When the client authenticated; the session key derives from it
+	ExpiresAt        time.Time    `json:"expiresAt"`
+	RenewUntil       time.Time    `json:"renewUntil"`
+	Status           string       `json:"status,omitempty"`      // "issued" or "renewed"
+	RenewedFrom      string       `json:"renewedFrom,omitempty"` // Record of the TGT this one renewed
+	RenewedTo        string       `json:"renewedTo,omitempty"`   // Record of the TGT that renewed this one
+	FlowID           string       `json:"flowID,omitempty"`
+}
+
+// tgtAuthenticator is a decoded client authenticator (ticket.Authenticator
+// in the client library)
+type tgtAuthenticator struct {
+	ClientID  string `json:"clientID"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// tgtRecordKey is the key of the record of a TGT issued at timestamp
+func tgtRecordKey(clientID string, timestamp time.Time) string {
+	return "TGT_" + clientID + "_" + strconv.FormatInt(timestamp.Unix(), 10)
+}
+
+// tgtSessionKey derives the KU,TGS session key of a client that
+// authenticated at issuedAt
+func tgtSessionKey(clientID string, issuedAt time.Time) string {
+	sessionKeyHash := sha256.Sum256([]byte(clientID + strconv.FormatInt(issuedAt.Unix(), 10) + "KU,TGS"))
+	return base64.StdEncoding.EncodeToString(sessionKeyHash[:])
+}
+
+// checkAuthenticator checks that an authenticator names the client and was
+// made within authenticatorMaxSkew of now
+func checkAuthenticator(authenticatorB64, clientID string, now time.Time) error {
+	authenticatorJSON, err := base64.StdEncoding.DecodeString(authenticatorB64)
+	if err != nil {
+		return fmt.Errorf("invalid authenticator (base64 decoding failed): %v", err)
+	}
+	var authenticator tgtAuthenticator
+	if err := json.Unmarshal(authenticatorJSON, &authenticator); err != nil {
+		return fmt.Errorf("invalid authenticator (JSON parsing failed): %v", err)
+	}
+	if authenticator.ClientID != clientID {
+		return fmt.Errorf("authenticator is for client %s, not %s", authenticator.ClientID, clientID)
+	}
+	skew := now.Unix() - authenticator.Timestamp
+	if skew > authenticatorMaxSkew || skew < -authenticatorMaxSkew {
+		return fmt.Errorf("authenticator time is more than %d seconds from the transaction time; check the local clock", authenticatorMaxSkew)
+	}
+	return nil
+}
+
+// checkRenewable returns why the TGT cannot be renewed at now, if it cannot
+func (r *TGTRecord) checkRenewable(now time.Time) error {
+	if r.Status != tgtStatusIssued {
+		return fmt.Errorf("TGT has already been renewed")
+	}
+	if !now.Before(r.ExpiresAt) {
+		return fmt.Errorf("TGT expired at %s; authenticate again", r.ExpiresAt.Format(time.RFC3339))
+	}
+	if !now.Before(r.RenewUntil) {
+		return fmt.Errorf("TGT renewal limit reached at %s; authenticate again", r.RenewUntil.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// renewedLifetime is the lifetime of a TGT renewing r at now: maxLifetime,
+// cut short by the renewal limit
+func (r *TGTRecord) renewedLifetime(now time.Time, maxLifetime int64) int64 {
+	lifetime := int64(r.RenewUntil.Sub(now) / time.Second)
+	if lifetime > maxLifetime {
+		lifetime = maxLifetime
+	}
+	return lifetime
+}
+
+// RenewTGT issues a client a new TGT for one it holds that is still valid,
+// without a new authentication. authenticator is a base64-encoded
+// authenticator for the client. The new TGT keeps the session key; the
+// response carries it encrypted for the client as before.
+func (s *ASChaincode) RenewTGT(ctx contractapi.TransactionContextInterface, clientID string, encryptedTGT string, authenticator string) (*ResponseToClient, error) {
+	valid, err := s.CheckClientValidity(ctx, clientID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check client validity: %v", err)
+	}
+	if !valid {
+		return nil, fmt.Errorf("invalid client")
+	}
+
+	now, err := common.GetDeterministicTimestamp(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get timestamp: %v", err)
+	}
+	if err := checkAuthenticator(authenticator, clientID, now); err != nil {
+		return nil, err
+	}
+	// An authenticator's timestamp is at most authenticatorMaxSkew ahead of
+	// now, so it is refused by checkAuthenticator after twice that
+	authenticatorExpiry := now.Add(2 * authenticatorMaxSkew * time.Second)
+	if err := common.ConsumeOnce(ctx.GetStub(), common.ReplayKindAuthenticator, authenticator, authenticatorExpiry, now, ctx.GetStub().GetTxID()); err != nil {
+		return nil, err
+	}
+
+	encryptedTGTHash := fmt.Sprintf("%x", sha256.Sum256([]byte(encryptedTGT)))
+	oldKey, record, err := findTGTRecord(ctx, clientID, encryptedTGTHash)
+	if err != nil {
+		return nil, err
+	}
+	if record == nil {
+		return nil, fmt.Errorf("no renewable TGT found for client %s; authenticate again", clientID)
+	}
+	if err := record.checkRenewable(now); err != nil {
+		return nil, err
+	}
+	client, err := getClientIdentity(ctx.GetStub(), clientID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkIssuedAfterKeyRotation(client, record.IssuedAt); err != nil {
+		return nil, err
+	}
+	newKey := tgtRecordKey(clientID, now)
+	if newKey == oldKey {
+		return nil, fmt.Errorf("TGT was issued this second; renew it later")
+	}
+
+	policy, err := getTicketPolicy(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sessionKey := tgtSessionKey(clientID, record.IssuedAt)
+	tgt := TGT{
+		ClientID:   clientID,
+		SessionKey: sessionKey,
+		Timestamp:  now,
+		Lifetime:   record.renewedLifetime(now, policy.TGTLifetime),
+		Attributes: client.Attributes,
+	}
+	tgtJSON, err := json.Marshal(tgt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal TGT: %v", err)
+	}
+
+	tgsPublicKey, err := s.getPublicKey(ctx, "TGS_PUBLIC_KEY")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get TGS public key: %v", err)
+	}
+	sealedTGT, err := common.EncryptForService(ctx, tgsPublicKey, tgtJSON)
+	if err != nil {
+		return nil, fmt.Errorf("TGT encryption failed: %v", err)
+	}
+	clientKeyType, clientPublicKeyPEM, err := s.getClientKey(ctx, clientID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client public key: %v", err)
+	}
+	encryptedSessionKey, err := sealForClient(clientKeyType, clientPublicKeyPEM, record.Protocol.Encryption, []byte(sessionKey))
+	if err != nil {
+		return nil, fmt.Errorf("session key encryption failed: %v", err)
+	}
+	flowID, err := common.GetFlowID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &ResponseToClient{
+		EncryptedTGT:        base64.StdEncoding.EncodeToString(sealedTGT),
+		EncryptedSessionKey: base64.StdEncoding.EncodeToString(encryptedSessionKey),
+		ExpiresAt:           now.Add(time.Duration(tgt.Lifetime) * time.Second).Format(time.RFC3339),
+	}
+	if record.Protocol.Version >= protocolV2 {
+		response.Encryption = record.Protocol.Encryption
+	}
+
+	renewed := TGTRecord{
+		ClientID:         clientID,
+		Timestamp:        now,
+		TGTHash:          fmt.Sprintf("%x", sha256.Sum256(tgtJSON)),
+		EncryptedTGTHash: fmt.Sprintf("%x", sha256.Sum256([]byte(response.EncryptedTGT))),
+		Protocol:         record.Protocol,
+		IssuedAt:         record.IssuedAt,
+		ExpiresAt:        now.Add(time.Duration(tgt.Lifetime) * time.Second),
+		RenewUntil:       record.RenewUntil,
+		Status:           tgtStatusIssued,
+		RenewedFrom:      oldKey,
+		FlowID:           flowID,
+	}
+	record.Status = tgtStatusRenewed
+	record.RenewedTo = newKey
+
+	uow := common.NewUnitOfWork(ctx)
+	if err := uow.PutJSON(oldKey, record); err != nil {
+		return nil, err
+	}
+	if err := uow.PutJSON(newKey, renewed); err != nil {
+		return nil, err
+	}
+	if err := uow.IncrementMetric(metricTGTsRenewed); err != nil {
+		return nil, err
+	}
+	if err := uow.Commit(); err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("Renewed TGT for client %s until %s\n", clientID, response.ExpiresAt)
+	return response, nil
+}
+
+// findTGTRecord returns the key and record of the client's TGT whose
+// encrypted form hashes to encryptedTGTHash, or a nil record if there is
+// none
+func findTGTRecord(ctx contractapi.TransactionContextInterface, clientID string, encryptedTGTHash string) (string, *TGTRecord, error) {
+	prefix := "TGT_" + clientID + "_"
+	resultsIterator, err := ctx.GetStub().GetStateByRange(prefix, prefix+"~")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to get TGT records: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to iterate TGT records: %v", err)
+		}
+		var record TGTRecord
+		if err := json.Unmarshal(queryResponse.Value, &record); err != nil {
+			fmt.Printf("Error unmarshaling TGT record %s: %v\n", queryResponse.Key, err)
+			continue
+		}
+		// The prefix also matches clients whose ID extends this one
+		if record.ClientID != clientID || record.EncryptedTGTHash != encryptedTGTHash {
+			continue
+		}
+		if record.Protocol == nil {
+			record.Protocol = &legacyTGTProtocol
+		}
+		return queryResponse.Key, &record, nil
+	}
+	return "", nil, nil
+}
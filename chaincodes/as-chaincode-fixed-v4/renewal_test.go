@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestCheckAuthenticator(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	encode := func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) }
+	authenticator := func(clientID string, timestamp int64) string {
+		return encode(fmt.Sprintf(`{"clientID":%q,"timestamp":%d}`, clientID, timestamp))
+	}
+	tests := []struct {
+		name          string
+		authenticator string
+		wantErr       bool
+	}{
+		{"fresh", authenticator("client1", now.Unix()), false},
+		{"within skew", authenticator("client1", now.Unix()-authenticatorMaxSkew), false},
+		{"ahead within skew", authenticator("client1", now.Unix()+authenticatorMaxSkew), false},
+		{"stale", authenticator("client1", now.Unix()-authenticatorMaxSkew-1), true},
+		{"future", authenticator("client1", now.Unix()+authenticatorMaxSkew+1), true},
+		{"other client", authenticator("client2", now.Unix()), true},
+		{"not base64", "not base64!", true},
+		{"not json", encode("client1"), true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := checkAuthenticator(test.authenticator, "client1", now)
+			if (err != nil) != test.wantErr {
+				t.Errorf("checkAuthenticator() error = %v, wantErr %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestTGTRecordCheckRenewable(t *testing.T) {
+	issued := time.Unix(1700000000, 0)
+	record := TGTRecord{
+		IssuedAt:   issued,
+		ExpiresAt:  issued.Add(tgtLifetime * time.Second),
+		RenewUntil: issued.Add(maxTGTRenewal * time.Second),
+		Status:     tgtStatusIssued,
+	}
+	renewed := record
+	renewed.Status = tgtStatusRenewed
+	lastHour := record
+	lastHour.ExpiresAt = record.RenewUntil
+
+	tests := []struct {
+		name    string
+		record  TGTRecord
+		now     time.Time
+		wantErr bool
+	}{
+		{"valid", record, issued.Add(time.Minute), false},
+		{"expired", record, record.ExpiresAt, true},
+		{"already renewed", renewed, issued.Add(time.Minute), true},
+		{"renewal limit", lastHour, record.RenewUntil, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.record.checkRenewable(test.now)
+			if (err != nil) != test.wantErr {
+				t.Errorf("checkRenewable() error = %v, wantErr %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestTGTRecordRenewedLifetime(t *testing.T) {
+	issued := time.Unix(1700000000, 0)
+	record := TGTRecord{RenewUntil: issued.Add(maxTGTRenewal * time.Second)}
+	if got := record.renewedLifetime(issued.Add(time.Hour), tgtLifetime); got != tgtLifetime {
+		t.Errorf("renewedLifetime() = %d, want %d", got, tgtLifetime)
+	}
+	if got := record.renewedLifetime(record.RenewUntil.Add(-10*time.Minute), tgtLifetime); got != 600 {
+		t.Errorf("renewedLifetime() near the limit = %d, want 600", got)
+	}
+}
+
+func TestTGTSessionKeyIsStable(t *testing.T) {
+	issued := time.Unix(1700000000, 0)
+	if tgtSessionKey("client1", issued) != tgtSessionKey("client1", issued) {
+		t.Error("tgtSessionKey() differs between calls")
+	}
+	if tgtSessionKey("client1", issued) == tgtSessionKey("client1", issued.Add(time.Second)) {
+		t.Error("tgtSessionKey() ignores the issue time")
+	}
+	if got, want := tgtRecordKey("client1", issued), "TGT_client1_1700000000"; got != want {
+		t.Errorf("tgtRecordKey() = %q, want %q", got, want)
+	}
+}
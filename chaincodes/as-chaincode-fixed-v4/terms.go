@@ -0,0 +1,252 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/blockchain-auth/common"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// A terms policy asks clients to acknowledge a notice document before they
+// authenticate. While a client's acknowledgement is missing or, when the
+// policy asks for it, is for an older version of the document, its nonce
+// challenge carries the notice and verification fails until the client has
+// signed the notice with AcknowledgeTerms. The challenge stays in place, so
+// the client can acknowledge and then answer it.
+
+// TermsPolicy is the notice clients must acknowledge
+type TermsPolicy struct {
+	// Version names the document, e.g. "2024-06"
+	Version string `json:"version"`
+	// DocumentHash is the hex SHA-256 of the document
+	DocumentHash string `json:"documentHash"`
+	DocumentURL  string `json:"documentURL,omitempty"`
+	// ReacknowledgeOnNewVersion makes clients that acknowledged an older
+	// version acknowledge again; otherwise any acknowledgement will do
+	ReacknowledgeOnNewVersion bool      `json:"reacknowledgeOnNewVersion"`
+	UpdatedAt                 time.Time `json:"updatedAt"`
+}
+
+// TermsNotice is the part of the policy sent to a client with its challenge
+type TermsNotice struct {
+	Version      string `json:"version"`
+	DocumentHash string `json:"documentHash"`
+	DocumentURL  string `json:"documentURL,omitempty"`
+}
+
+// TermsAcknowledgement records that a client signed a version of the notice
+type TermsAcknowledgement struct {
+	ClientID       string    `json:"clientID"`
+	Version        string    `json:"version"`
+	DocumentHash   string    `json:"documentHash"`
+	Signature      string    `json:"signature"` // Base64 signature of termsStatement
+	AcknowledgedAt time.Time `json:"acknowledgedAt"`
+	TxID           string    `json:"txID"`
+}
+
+const (
+	termsPolicyKey    = "TERMS_POLICY"
+	termsAckKeyPrefix = "TERMS_ACK_"
+)
+
+// termsStatement is what a client signs to acknowledge a notice. It names
+// the client so that one client's signature cannot be replayed for another.
+func termsStatement(clientID, version, documentHash string) string {
+	return fmt.Sprintf("%s:%s:%s", clientID, version, documentHash)
+}
+
+// termsPending reports whether a client must acknowledge the policy before
+// it may authenticate
+func termsPending(policy *TermsPolicy, ack *TermsAcknowledgement) bool {
+	if policy == nil {
+		return false
+	}
+	if ack == nil {
+		return true
+	}
+	if !policy.ReacknowledgeOnNewVersion {
+		return false
+	}
+	return ack.Version != policy.Version || ack.DocumentHash != policy.DocumentHash
+}
+
+func validateTermsPolicy(policy *TermsPolicy) error {
+	if policy.Version == "" {
+		return fmt.Errorf("terms version is required")
+	}
+	hash, err := hex.DecodeString(policy.DocumentHash)
+	if err != nil || len(hash) != sha256.Size {
+		return fmt.Errorf("document hash must be a hex SHA-256 digest")
+	}
+	return nil
+}
+
+// SetTermsPolicy stores the terms policy. Only admins may call it.
+func (s *ASChaincode) SetTermsPolicy(ctx contractapi.TransactionContextInterface, policyJSON string) error {
+	var policy TermsPolicy
+	if err := json.Unmarshal([]byte(policyJSON), &policy); err != nil {
+		return fmt.Errorf("invalid terms policy format (JSON parsing failed): %v", err)
+	}
+	if err := validateTermsPolicy(&policy); err != nil {
+		return err
+	}
+
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get caller MSP ID: %v", err)
+	}
+
+	policy.UpdatedAt, err = common.GetDeterministicTimestamp(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get timestamp: %v", err)
+	}
+
+	policyBytes, err := json.Marshal(policy)
+	if err != nil {
+		return fmt.Errorf("failed to marshal terms policy: %v", err)
+	}
+	if err := ctx.GetStub().PutState(termsPolicyKey, policyBytes); err != nil {
+		return fmt.Errorf("failed to store terms policy: %v", err)
+	}
+
+	fmt.Printf("Terms policy set to version %s by %s\n", policy.Version, mspID)
+	return nil
+}
+
+// GetTermsPolicy returns the stored terms policy, or nil if there is none
+func (s *ASChaincode) GetTermsPolicy(ctx contractapi.TransactionContextInterface) (*TermsPolicy, error) {
+	return getTermsPolicy(ctx)
+}
+
+// GetTermsAcknowledgement returns a client's latest acknowledgement, or nil
+// if it has none
+func (s *ASChaincode) GetTermsAcknowledgement(ctx contractapi.TransactionContextInterface, clientID string) (*TermsAcknowledgement, error) {
+	return getTermsAcknowledgement(ctx, clientID)
+}
+
+// AcknowledgeTerms records that a client accepted the current notice. The
+// signature is the client's base64 RSA PKCS#1 v1.5 signature of the SHA-256
+// of termsStatement(clientID, version, documentHash), made with the key it
+// registered.
+func (s *ASChaincode) AcknowledgeTerms(ctx contractapi.TransactionContextInterface, clientID string, version string, signatureBase64 string) (*TermsAcknowledgement, error) {
+	policy, err := getTermsPolicy(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if policy == nil {
+		return nil, fmt.Errorf("no terms policy is set")
+	}
+	if version != policy.Version {
+		return nil, fmt.Errorf("terms version %s is not the current version %s", version, policy.Version)
+	}
+
+	clientKeyType, clientPublicKeyPEM, err := s.getClientKey(ctx, clientID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client public key: %v", err)
+	}
+	signatureBytes, err := base64.StdEncoding.DecodeString(signatureBase64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature format: %v", err)
+	}
+	hashed := sha256.Sum256([]byte(termsStatement(clientID, policy.Version, policy.DocumentHash)))
+	if err := common.VerifyKeySignature("terms signature verification", clientKeyType, clientPublicKeyPEM, hashed[:], signatureBytes); err != nil {
+		return nil, err
+	}
+
+	timestamp, err := common.GetDeterministicTimestamp(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get timestamp: %v", err)
+	}
+	ack := &TermsAcknowledgement{
+		ClientID:       clientID,
+		Version:        policy.Version,
+		DocumentHash:   policy.DocumentHash,
+		Signature:      signatureBase64,
+		AcknowledgedAt: timestamp,
+		TxID:           ctx.GetStub().GetTxID(),
+	}
+	ackBytes, err := json.Marshal(ack)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal terms acknowledgement: %v", err)
+	}
+	if err := ctx.GetStub().PutState(termsAckKeyPrefix+clientID, ackBytes); err != nil {
+		return nil, fmt.Errorf("failed to store terms acknowledgement: %v", err)
+	}
+	if err := common.SetEvent(ctx, "TermsAcknowledged", ackBytes); err != nil {
+		return nil, fmt.Errorf("failed to emit terms acknowledgement event: %v", err)
+	}
+	if err := common.IncrementMetric(ctx, metricTermsAcknowledged); err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("Client %s acknowledged terms version %s\n", clientID, policy.Version)
+	return ack, nil
+}
+
+// pendingTermsNotice returns the notice a client must acknowledge, or nil
+// if there is none
+func pendingTermsNotice(ctx contractapi.TransactionContextInterface, clientID string) (*TermsNotice, error) {
+	policy, err := getTermsPolicy(ctx)
+	if err != nil || policy == nil {
+		return nil, err
+	}
+	ack, err := getTermsAcknowledgement(ctx, clientID)
+	if err != nil {
+		return nil, err
+	}
+	if !termsPending(policy, ack) {
+		return nil, nil
+	}
+	return &TermsNotice{Version: policy.Version, DocumentHash: policy.DocumentHash, DocumentURL: policy.DocumentURL}, nil
+}
+
+// checkTerms fails while a client has a notice to acknowledge. The policy
+// is read again rather than taken from the challenge, so a client that
+// acknowledges after receiving its challenge can still answer it.
+func checkTerms(ctx contractapi.TransactionContextInterface, clientID string) error {
+	notice, err := pendingTermsNotice(ctx, clientID)
+	if err != nil {
+		return err
+	}
+	if notice != nil {
+		return fmt.Errorf("terms version %s (document %s) must be acknowledged first", notice.Version, notice.DocumentHash)
+	}
+	return nil
+}
+
+func getTermsPolicy(ctx contractapi.TransactionContextInterface) (*TermsPolicy, error) {
+	policyBytes, err := ctx.GetStub().GetState(termsPolicyKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read terms policy: %v", err)
+	}
+	if policyBytes == nil {
+		return nil, nil
+	}
+
+	var policy TermsPolicy
+	if err := json.Unmarshal(policyBytes, &policy); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal terms policy: %v", err)
+	}
+	return &policy, nil
+}
+
+func getTermsAcknowledgement(ctx contractapi.TransactionContextInterface, clientID string) (*TermsAcknowledgement, error) {
+	ackBytes, err := ctx.GetStub().GetState(termsAckKeyPrefix + clientID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read terms acknowledgement: %v", err)
+	}
+	if ackBytes == nil {
+		return nil, nil
+	}
+
+	var ack TermsAcknowledgement
+	if err := json.Unmarshal(ackBytes, &ack); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal terms acknowledgement: %v", err)
+	}
+	return &ack, nil
+}
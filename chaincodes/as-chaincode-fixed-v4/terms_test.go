@@ -0,0 +1,43 @@
+package main
+
+import "testing"
+
+func TestTermsPending(t *testing.T) {
+	current := &TermsPolicy{Version: "v2", DocumentHash: "bb"}
+	reack := &TermsPolicy{Version: "v2", DocumentHash: "bb", ReacknowledgeOnNewVersion: true}
+	old := &TermsAcknowledgement{Version: "v1", DocumentHash: "aa"}
+	same := &TermsAcknowledgement{Version: "v2", DocumentHash: "bb"}
+	edited := &TermsAcknowledgement{Version: "v2", DocumentHash: "aa"}
+
+	tests := []struct {
+		name   string
+		policy *TermsPolicy
+		ack    *TermsAcknowledgement
+		want   bool
+	}{
+		{"no policy", nil, nil, false},
+		{"never acknowledged", current, nil, true},
+		{"older version accepted", current, old, false},
+		{"older version re-acknowledged", reack, old, true},
+		{"current version", reack, same, false},
+		{"document changed under version", reack, edited, true},
+	}
+	for _, test := range tests {
+		if got := termsPending(test.policy, test.ack); got != test.want {
+			t.Errorf("%s: termsPending() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestValidateTermsPolicy(t *testing.T) {
+	hash := "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+	if err := validateTermsPolicy(&TermsPolicy{Version: "v1", DocumentHash: hash}); err != nil {
+		t.Errorf("validateTermsPolicy() error = %v", err)
+	}
+	if err := validateTermsPolicy(&TermsPolicy{DocumentHash: hash}); err == nil {
+		t.Error("validateTermsPolicy() accepted a policy without a version")
+	}
+	if err := validateTermsPolicy(&TermsPolicy{Version: "v1", DocumentHash: "abc"}); err == nil {
+		t.Error("validateTermsPolicy() accepted a short document hash")
+	}
+}
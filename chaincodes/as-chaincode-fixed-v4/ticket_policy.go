@@ -0,0 +1,321 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/blockchain-auth/common"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// The ticket policy sets the TGT lifetimes, how many TGTs a client may be
+// issued a day and which session key encryptions the AS offers. A change
+// that takes effect at once can lock out every client at the same time, so
+// a change is made in two steps instead: ScheduleTicketPolicy stores it as
+// pending with an effective date at least minPolicyNotice away, and it
+// becomes active when that date passes. Until then clients can see it
+// coming (GetTicketPolicySchedule) and admins can withdraw it with
+// AbortPendingTicketPolicy. The policy it replaces is kept as previous, so
+// RollbackTicketPolicy can schedule it again.
+//
+// The pending policy becomes active lazily: every read resolves the
+// schedule at the transaction time, and the next write stores the result.
+
+const (
+	ticketPolicyKey = "TICKET_POLICY"
+
+	// tgtQuotaKeyPrefix prefixes the count of TGTs issued to a client on a
+	// day: TGT_QUOTA_<clientID>_<day>
+	tgtQuotaKeyPrefix = "TGT_QUOTA_"
+
+	// minPolicyNotice is the least time between scheduling a policy and its
+	// effective date, in seconds
+	minPolicyNotice = 5 * 60
+
+	ticketPolicyScheduledEvent = "TicketPolicyScheduled"
+	ticketPolicyAbortedEvent   = "TicketPolicyAborted"
+)
+
+// TicketPolicy is what the AS issues TGTs under. Zero fields take the
+// defaults.
+type TicketPolicy struct {
+	// TGTLifetime is how long a TGT is valid, in seconds
+	TGTLifetime int64 `json:"tgtLifetime,omitempty"`
+	// MaxTGTRenewal is how long after authenticating a client may keep
+	// renewing its TGT, in seconds
+	MaxTGTRenewal int64 `json:"maxTGTRenewal,omitempty"`
+	// MaxTGTsPerDay is how many TGTs a client may be issued a (UTC) day;
+	// zero means no limit. Renewals do not count.
+	MaxTGTsPerDay int `json:"maxTGTsPerDay,omitempty"`
+	// Encryptions are the session key encryptions clients may ask for
+	// (default: all that GetProtocolInfo knows)
+	Encryptions []string `json:"encryptions,omitempty"`
+}
+
+// TicketPolicyVersion is a policy in the schedule
+type TicketPolicyVersion struct {
+	Version     int          `json:"version"`
+	Policy      TicketPolicy `json:"policy"`
+	EffectiveAt time.Time    `json:"effectiveAt"`
+	ScheduledBy string       `json:"scheduledBy"`
+	ScheduledAt time.Time    `json:"scheduledAt"`
+}
+
+// TicketPolicySchedule is the policy in force, the one scheduled to replace
+// it and the one it replaced. A nil Active means the defaults are in force.
+type TicketPolicySchedule struct {
+	Pending  *TicketPolicyVersion `json:"pending,omitempty"`
+	Active   *TicketPolicyVersion `json:"active,omitempty"`
+	Previous *TicketPolicyVersion `json:"previous,omitempty"`
+}
+
+// defaultTicketPolicy is in force until a policy is scheduled
+func defaultTicketPolicy() TicketPolicy {
+	return TicketPolicy{
+		TGTLifetime:   tgtLifetime,
+		MaxTGTRenewal: maxTGTRenewal,
+		Encryptions:   append([]string(nil), asProtocolInfo.Encryption...),
+	}
+}
+
+// withDefaults fills in the zero fields of p
+func (p TicketPolicy) withDefaults() TicketPolicy {
+	defaults := defaultTicketPolicy()
+	if p.TGTLifetime == 0 {
+		p.TGTLifetime = defaults.TGTLifetime
+	}
+	if p.MaxTGTRenewal == 0 {
+		p.MaxTGTRenewal = defaults.MaxTGTRenewal
+	}
+	if len(p.Encryptions) == 0 {
+		p.Encryptions = defaults.Encryptions
+	}
+	return p
+}
+
+func validateTicketPolicy(p *TicketPolicy) error {
+	if p.TGTLifetime < 0 || p.MaxTGTRenewal < 0 || p.MaxTGTsPerDay < 0 {
+		return fmt.Errorf("ticket policy values cannot be negative")
+	}
+	if p.TGTLifetime != 0 && p.TGTLifetime < 60 {
+		return fmt.Errorf("TGT lifetime must be at least 60 seconds")
+	}
+	if p.TGTLifetime > maxTGTRenewal || p.MaxTGTRenewal > 7*maxTGTRenewal {
+		return fmt.Errorf("TGT lifetime must be at most %d seconds and the renewal limit at most %d", maxTGTRenewal, 7*maxTGTRenewal)
+	}
+	for _, encryption := range p.Encryptions {
+		if !containsString(asProtocolInfo.Encryption, encryption) {
+			return fmt.Errorf("unknown encryption %q (supported: %v)", encryption, asProtocolInfo.Encryption)
+		}
+	}
+	return nil
+}
+
+// at returns the schedule as it stands at now: a pending policy whose
+// effective date has passed is active, and the one it replaced previous
+func (s TicketPolicySchedule) at(now time.Time) TicketPolicySchedule {
+	if s.Pending != nil && !now.Before(s.Pending.EffectiveAt) {
+		s.Previous, s.Active, s.Pending = s.Active, s.Pending, nil
+	}
+	return s
+}
+
+// effective returns the policy in force, with defaults filled in
+func (s TicketPolicySchedule) effective() TicketPolicy {
+	if s.Active == nil {
+		return defaultTicketPolicy()
+	}
+	return s.Active.Policy.withDefaults()
+}
+
+// nextVersion is the version number of the next policy scheduled
+func (s TicketPolicySchedule) nextVersion() int {
+	version := 0
+	for _, v := range []*TicketPolicyVersion{s.Pending, s.Active, s.Previous} {
+		if v != nil && v.Version > version {
+			version = v.Version
+		}
+	}
+	return version + 1
+}
+
+// getTicketPolicySchedule returns the stored schedule resolved at the
+// transaction time
+func getTicketPolicySchedule(ctx contractapi.TransactionContextInterface) (TicketPolicySchedule, time.Time, error) {
+	var schedule TicketPolicySchedule
+	now, err := common.GetDeterministicTimestamp(ctx)
+	if err != nil {
+		return schedule, now, fmt.Errorf("failed to get timestamp: %v", err)
+	}
+	scheduleJSON, err := ctx.GetStub().GetState(ticketPolicyKey)
+	if err != nil {
+		return schedule, now, fmt.Errorf("failed to read ticket policy: %v", err)
+	}
+	if scheduleJSON != nil {
+		if err := json.Unmarshal(scheduleJSON, &schedule); err != nil {
+			return schedule, now, fmt.Errorf("failed to unmarshal ticket policy: %v", err)
+		}
+	}
+	return schedule.at(now), now, nil
+}
+
+// getTicketPolicy returns the policy in force at the transaction time
+func getTicketPolicy(ctx contractapi.TransactionContextInterface) (TicketPolicy, error) {
+	schedule, _, err := getTicketPolicySchedule(ctx)
+	if err != nil {
+		return TicketPolicy{}, err
+	}
+	return schedule.effective(), nil
+}
+
+// putTicketPolicySchedule stores the schedule and emits eventName with it
+func putTicketPolicySchedule(ctx contractapi.TransactionContextInterface, schedule TicketPolicySchedule, eventName string) error {
+	scheduleJSON, err := json.Marshal(schedule)
+	if err != nil {
+		return fmt.Errorf("failed to marshal ticket policy: %v", err)
+	}
+	if err := ctx.GetStub().PutState(ticketPolicyKey, scheduleJSON); err != nil {
+		return fmt.Errorf("failed to store ticket policy: %v", err)
+	}
+	if err := common.SetEvent(ctx, eventName, scheduleJSON); err != nil {
+		return fmt.Errorf("failed to emit ticket policy event: %v", err)
+	}
+	return nil
+}
+
+// schedulePolicy makes policy pending from effectiveAt, refusing to replace
+// a pending policy or to take effect sooner than minPolicyNotice
+func (s TicketPolicySchedule) schedulePolicy(policy TicketPolicy, effectiveAt, now time.Time, mspID string) (TicketPolicySchedule, error) {
+	if s.Pending != nil {
+		return s, fmt.Errorf("version %d is already pending until %s; abort it first", s.Pending.Version, s.Pending.EffectiveAt.Format(time.RFC3339))
+	}
+	if effectiveAt.Before(now.Add(minPolicyNotice * time.Second)) {
+		return s, fmt.Errorf("effective date must be at least %d seconds after the transaction time", minPolicyNotice)
+	}
+	s.Pending = &TicketPolicyVersion{
+		Version:     s.nextVersion(),
+		Policy:      policy,
+		EffectiveAt: effectiveAt.UTC(),
+		ScheduledBy: mspID,
+		ScheduledAt: now,
+	}
+	return s, nil
+}
+
+// ScheduleTicketPolicy schedules a ticket policy to take effect at
+// effectiveAt, in Unix seconds (see the top of this file). Only admins
+// may call it.
+func (s *ASChaincode) ScheduleTicketPolicy(ctx contractapi.TransactionContextInterface, policyJSON string, effectiveAt int64) (*TicketPolicySchedule, error) {
+	var policy TicketPolicy
+	if err := json.Unmarshal([]byte(policyJSON), &policy); err != nil {
+		return nil, fmt.Errorf("invalid ticket policy format (JSON parsing failed): %v", err)
+	}
+	if err := validateTicketPolicy(&policy); err != nil {
+		return nil, err
+	}
+	return s.schedule(ctx, policy, effectiveAt)
+}
+
+// RollbackTicketPolicy schedules the previous ticket policy to take effect
+// again at effectiveAt, in Unix seconds. Only admins may call it.
+func (s *ASChaincode) RollbackTicketPolicy(ctx contractapi.TransactionContextInterface, effectiveAt int64) (*TicketPolicySchedule, error) {
+	schedule, _, err := getTicketPolicySchedule(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if schedule.Previous == nil {
+		return nil, fmt.Errorf("there is no previous ticket policy to roll back to")
+	}
+	return s.schedule(ctx, schedule.Previous.Policy, effectiveAt)
+}
+
+func (s *ASChaincode) schedule(ctx contractapi.TransactionContextInterface, policy TicketPolicy, effectiveAt int64) (*TicketPolicySchedule, error) {
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get caller MSP ID: %v", err)
+	}
+	schedule, now, err := getTicketPolicySchedule(ctx)
+	if err != nil {
+		return nil, err
+	}
+	schedule, err = schedule.schedulePolicy(policy, time.Unix(effectiveAt, 0), now, mspID)
+	if err != nil {
+		return nil, err
+	}
+	if err := putTicketPolicySchedule(ctx, schedule, ticketPolicyScheduledEvent); err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("Ticket policy version %d scheduled for %s by %s\n", schedule.Pending.Version, schedule.Pending.EffectiveAt.Format(time.RFC3339), mspID)
+	return &schedule, nil
+}
+
+// AbortPendingTicketPolicy withdraws the pending ticket policy before it
+// takes effect. Only admins may call it.
+func (s *ASChaincode) AbortPendingTicketPolicy(ctx contractapi.TransactionContextInterface) (*TicketPolicySchedule, error) {
+	schedule, _, err := getTicketPolicySchedule(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if schedule.Pending == nil {
+		return nil, fmt.Errorf("no ticket policy is pending")
+	}
+	version := schedule.Pending.Version
+	schedule.Pending = nil
+	if err := putTicketPolicySchedule(ctx, schedule, ticketPolicyAbortedEvent); err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("Pending ticket policy version %d aborted\n", version)
+	return &schedule, nil
+}
+
+// GetTicketPolicySchedule returns the pending, active and previous ticket
+// policies as they stand now
+func (s *ASChaincode) GetTicketPolicySchedule(ctx contractapi.TransactionContextInterface) (*TicketPolicySchedule, error) {
+	schedule, _, err := getTicketPolicySchedule(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &schedule, nil
+}
+
+// GetTicketPolicy returns the ticket policy in force, with defaults filled in
+func (s *ASChaincode) GetTicketPolicy(ctx contractapi.TransactionContextInterface) (*TicketPolicy, error) {
+	policy, err := getTicketPolicy(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// checkTGTQuota counts a TGT issued to a client at now against the policy's
+// daily limit, failing once the limit is reached
+func checkTGTQuota(ctx contractapi.TransactionContextInterface, policy TicketPolicy, clientID string, now time.Time) error {
+	if policy.MaxTGTsPerDay == 0 {
+		return nil
+	}
+	key := fmt.Sprintf("%s%s_%s", tgtQuotaKeyPrefix, clientID, now.UTC().Format("2006-01-02"))
+	countJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return fmt.Errorf("failed to read TGT quota: %v", err)
+	}
+	count := 0
+	if countJSON != nil {
+		if err := json.Unmarshal(countJSON, &count); err != nil {
+			return fmt.Errorf("failed to unmarshal TGT quota: %v", err)
+		}
+	}
+	if count >= policy.MaxTGTsPerDay {
+		return fmt.Errorf("client %s has been issued its %d TGTs for today", clientID, policy.MaxTGTsPerDay)
+	}
+	countJSON, err = json.Marshal(count + 1)
+	if err != nil {
+		return err
+	}
+	if err := ctx.GetStub().PutState(key, countJSON); err != nil {
+		return fmt.Errorf("failed to store TGT quota: %v", err)
+	}
+	return nil
+}
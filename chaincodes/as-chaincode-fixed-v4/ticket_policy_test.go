@@ -0,0 +1,90 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValidateTicketPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  TicketPolicy
+		wantErr bool
+	}{
+		{"empty", TicketPolicy{}, false},
+		{"full", TicketPolicy{TGTLifetime: 1800, MaxTGTRenewal: 3600, MaxTGTsPerDay: 10, Encryptions: []string{encryptionHybrid}}, false},
+		{"negative quota", TicketPolicy{MaxTGTsPerDay: -1}, true},
+		{"short lifetime", TicketPolicy{TGTLifetime: 10}, true},
+		{"long lifetime", TicketPolicy{TGTLifetime: maxTGTRenewal + 1}, true},
+		{"unknown encryption", TicketPolicy{Encryptions: []string{"rot13"}}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateTicketPolicy(&test.policy)
+			if (err != nil) != test.wantErr {
+				t.Errorf("validateTicketPolicy() error = %v, wantErr %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestTicketPolicyDefaults(t *testing.T) {
+	var schedule TicketPolicySchedule
+	policy := schedule.effective()
+	if policy.TGTLifetime != tgtLifetime || policy.MaxTGTRenewal != maxTGTRenewal || policy.MaxTGTsPerDay != 0 {
+		t.Errorf("default policy = %+v", policy)
+	}
+	if len(policy.Encryptions) != len(asProtocolInfo.Encryption) {
+		t.Errorf("default encryptions = %v, want %v", policy.Encryptions, asProtocolInfo.Encryption)
+	}
+
+	schedule.Active = &TicketPolicyVersion{Version: 1, Policy: TicketPolicy{MaxTGTsPerDay: 5}}
+	policy = schedule.effective()
+	if policy.TGTLifetime != tgtLifetime || policy.MaxTGTsPerDay != 5 {
+		t.Errorf("partial policy = %+v, want defaults with 5 TGTs a day", policy)
+	}
+}
+
+func TestTicketPolicySchedule(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	var schedule TicketPolicySchedule
+
+	if _, err := schedule.schedulePolicy(TicketPolicy{}, now.Add(time.Minute), now, "Org1MSP"); err == nil {
+		t.Error("schedulePolicy() accepted an effective date within the notice period")
+	}
+
+	effectiveAt := now.Add(time.Hour)
+	schedule, err := schedule.schedulePolicy(TicketPolicy{TGTLifetime: 1800}, effectiveAt, now, "Org1MSP")
+	if err != nil {
+		t.Fatalf("schedulePolicy() error = %v", err)
+	}
+	if schedule.Pending == nil || schedule.Pending.Version != 1 {
+		t.Fatalf("pending = %+v, want version 1", schedule.Pending)
+	}
+	if _, err := schedule.schedulePolicy(TicketPolicy{}, effectiveAt, now, "Org1MSP"); err == nil {
+		t.Error("schedulePolicy() replaced a pending policy")
+	}
+
+	before := schedule.at(effectiveAt.Add(-time.Second))
+	if before.Pending == nil || before.effective().TGTLifetime != tgtLifetime {
+		t.Error("pending policy took effect before its effective date")
+	}
+
+	after := schedule.at(effectiveAt)
+	if after.Pending != nil || after.Active == nil || after.Active.Version != 1 || after.Previous != nil {
+		t.Fatalf("schedule after effective date = %+v", after)
+	}
+	if after.effective().TGTLifetime != 1800 {
+		t.Errorf("effective lifetime = %d, want 1800", after.effective().TGTLifetime)
+	}
+
+	later := effectiveAt.Add(time.Hour)
+	next, err := after.schedulePolicy(TicketPolicy{MaxTGTsPerDay: 3}, later.Add(time.Hour), later, "Org2MSP")
+	if err != nil {
+		t.Fatalf("schedulePolicy() error = %v", err)
+	}
+	next = next.at(later.Add(time.Hour))
+	if next.Active.Version != 2 || next.Previous == nil || next.Previous.Version != 1 {
+		t.Errorf("schedule after second change = active %+v, previous %+v", next.Active, next.Previous)
+	}
+}
@@ -0,0 +1,223 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Every chaincode keeps its admin organizations in one place, the JSON list
+// of MSP IDs under ADMIN_MSPS, and checks admin callers with
+// CheckAdminCaller. Admin functions are closed until the list is set: it is
+// named once, by the instantiating transaction, with InitAdminMSPs
+//
+//	peer lifecycle chaincode commit ... --init-required
+//	peer chaincode invoke ... --isInit -c '{"function":"InitAdminMSPs","Args":["[\"Org1MSP\"]"]}'
+//
+// and changed afterwards by an admin with SetAdminMSPs. Chaincodes deployed
+// before the list existed kept their admins in the payload limits; those
+// still count until InitAdminMSPs runs, and only they may run it.
+
+// AdminMSPsKey holds the JSON list of admin MSP IDs
+const AdminMSPsKey = "ADMIN_MSPS"
+
+// legacyAdminMSPsKey holds the payload limits, whose adminMSPs field named
+// the admins before AdminMSPsKey
+const legacyAdminMSPsKey = "PAYLOAD_LIMITS"
+
+// GetAdminMSPs returns the admin MSPs, or none before InitAdminMSPs has run
+// on a chaincode that had no admins in its payload limits
+func GetAdminMSPs(ctx contractapi.TransactionContextInterface) ([]string, error) {
+	mspsJSON, err := ctx.GetStub().GetState(AdminMSPsKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read admin MSPs: %v", err)
+	}
+	if mspsJSON != nil {
+		var msps []string
+		if err := json.Unmarshal(mspsJSON, &msps); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal admin MSPs: %v", err)
+		}
+		return msps, nil
+	}
+	return getLegacyAdminMSPs(ctx)
+}
+
+func getLegacyAdminMSPs(ctx contractapi.TransactionContextInterface) ([]string, error) {
+	limitsJSON, err := ctx.GetStub().GetState(legacyAdminMSPsKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read payload limits: %v", err)
+	}
+	if limitsJSON == nil {
+		return nil, nil
+	}
+	var limits struct {
+		AdminMSPs []string `json:"adminMSPs"`
+	}
+	if err := json.Unmarshal(limitsJSON, &limits); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal payload limits: %v", err)
+	}
+	return limits.AdminMSPs, nil
+}
+
+// MigrateLegacyAdminMSPs stores the admins of the payload limits as the
+// admin MSPs, unless admin MSPs are stored already. SetPayloadLimits calls
+// it before it rewrites the payload limits, which no longer carry admins.
+func MigrateLegacyAdminMSPs(ctx contractapi.TransactionContextInterface) error {
+	existing, err := ctx.GetStub().GetState(AdminMSPsKey)
+	if err != nil {
+		return fmt.Errorf("failed to read admin MSPs: %v", err)
+	}
+	if existing != nil {
+		return nil
+	}
+	legacy, err := getLegacyAdminMSPs(ctx)
+	if err != nil || len(legacy) == 0 {
+		return err
+	}
+	return putAdminMSPs(ctx, legacy)
+}
+
+// parseAdminMSPs parses a JSON list of admin MSP IDs, which must name the
+// caller's MSP so that no caller can lock itself out
+func parseAdminMSPs(ctx contractapi.TransactionContextInterface, mspsJSON string) ([]string, string, error) {
+	var msps []string
+	if err := json.Unmarshal([]byte(mspsJSON), &msps); err != nil {
+		return nil, "", fmt.Errorf("invalid admin MSP list: %v", err)
+	}
+	if len(msps) == 0 {
+		return nil, "", fmt.Errorf("at least one admin MSP is required")
+	}
+	for _, msp := range msps {
+		if strings.TrimSpace(msp) == "" {
+			return nil, "", fmt.Errorf("admin MSP IDs must not be empty")
+		}
+	}
+
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get caller MSP ID: %v", err)
+	}
+	if !containsMSP(msps, mspID) {
+		return nil, "", fmt.Errorf("the admin MSPs must include the caller's MSP %s", mspID)
+	}
+	return msps, mspID, nil
+}
+
+func putAdminMSPs(ctx contractapi.TransactionContextInterface, msps []string) error {
+	mspsJSON, err := json.Marshal(msps)
+	if err != nil {
+		return fmt.Errorf("failed to marshal admin MSPs: %v", err)
+	}
+	if err := ctx.GetStub().PutState(AdminMSPsKey, mspsJSON); err != nil {
+		return fmt.Errorf("failed to store admin MSPs: %v", err)
+	}
+	return nil
+}
+
+// InitAdminMSPs names the admin MSPs of a new chaincode. It runs once, as
+// the instantiating transaction, and fails once the admin MSPs are stored.
+// On a chaincode with admins in its payload limits, only those may run it.
+func InitAdminMSPs(ctx contractapi.TransactionContextInterface, mspsJSON string) ([]string, error) {
+	existing, err := ctx.GetStub().GetState(AdminMSPsKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read admin MSPs: %v", err)
+	}
+	if existing != nil {
+		return nil, fmt.Errorf("the admin MSPs are already set; change them with SetAdminMSPs")
+	}
+
+	msps, mspID, err := parseAdminMSPs(ctx, mspsJSON)
+	if err != nil {
+		return nil, err
+	}
+	legacy, err := getLegacyAdminMSPs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(legacy) > 0 && !containsMSP(legacy, mspID) {
+		return nil, fmt.Errorf("InitAdminMSPs: only open to the admin MSPs of the payload limits (%s), not to %s", strings.Join(legacy, ", "), mspID)
+	}
+
+	if err := putAdminMSPs(ctx, msps); err != nil {
+		return nil, err
+	}
+	return msps, nil
+}
+
+// SetAdminMSPs replaces the admin MSPs. The caller must be an admin, checked
+// with CheckAdminCaller before the call.
+func SetAdminMSPs(ctx contractapi.TransactionContextInterface, mspsJSON string) ([]string, error) {
+	msps, _, err := parseAdminMSPs(ctx, mspsJSON)
+	if err != nil {
+		return nil, err
+	}
+	if err := putAdminMSPs(ctx, msps); err != nil {
+		return nil, err
+	}
+	return msps, nil
+}
+
+// IsAdminMSP reports whether mspID is one of the admin MSPs. No MSP is an
+// admin before the admin MSPs are set.
+func IsAdminMSP(ctx contractapi.TransactionContextInterface, mspID string) (bool, error) {
+	msps, err := GetAdminMSPs(ctx)
+	if err != nil {
+		return false, err
+	}
+	return containsMSP(msps, mspID), nil
+}
+
+// CheckAdminCaller rejects a call to an admin function unless the caller
+// belongs to an admin MSP and, if its certificate carries a role, one of
+// its roles permits the function (see CheckCallerRole). Every caller is
+// rejected before the admin MSPs are set. A nil functions skips the role
+// check, for chaincodes without role tables.
+func CheckAdminCaller(ctx contractapi.TransactionContextInterface, function string, functions map[string]map[string]bool) error {
+	msps, err := GetAdminMSPs(ctx)
+	if err != nil {
+		return err
+	}
+	return checkAdminIdentity(ctx.GetClientIdentity(), function, msps, functions)
+}
+
+func checkAdminIdentity(identity CallerIdentity, function string, adminMSPs []string, functions map[string]map[string]bool) error {
+	if len(adminMSPs) == 0 {
+		return fmt.Errorf("%s: no admin MSPs are set; the chaincode must be instantiated with InitAdminMSPs", function)
+	}
+	mspID, err := identity.GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get caller MSP ID: %v", err)
+	}
+	if !containsMSP(adminMSPs, mspID) {
+		return fmt.Errorf("%s: only open to the admin MSPs (%s), not to %s", function, strings.Join(adminMSPs, ", "), mspID)
+	}
+	if functions == nil {
+		return nil
+	}
+
+	value, found, err := identity.GetAttributeValue(RoleAttribute)
+	if err != nil {
+		return fmt.Errorf("failed to read caller role: %v", err)
+	}
+	roles := callerRoles(value)
+	if !found || len(roles) == 0 {
+		return nil
+	}
+	for _, role := range roles {
+		if role != RoleAuditor && functions[role][function] {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s: not permitted for role %s", function, strings.Join(roles, ","))
+}
+
+func containsMSP(msps []string, mspID string) bool {
+	for _, msp := range msps {
+		if msp == mspID {
+			return true
+		}
+	}
+	return false
+}
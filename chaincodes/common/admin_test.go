@@ -0,0 +1,135 @@
+package common
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/blockchain-auth/common/commontest"
+)
+
+func TestCheckAdminIdentity(t *testing.T) {
+	functions := map[string]map[string]bool{
+		RoleAuditor:     {"Initialize": true},
+		RoleUserAdmin:   {"RegisterUser": true},
+		RoleDeviceAdmin: {},
+		RolePolicyAdmin: {"Initialize": true},
+	}
+	adminMSPs := []string{"Org1MSP"}
+	withRole := func(role, mspID string) *commontest.FakeIdentity {
+		return &commontest.FakeIdentity{Attrs: map[string]string{RoleAttribute: role}, MSPID: mspID}
+	}
+
+	tests := []struct {
+		name      string
+		identity  *commontest.FakeIdentity
+		function  string
+		adminMSPs []string
+		functions map[string]map[string]bool
+		allowed   bool
+	}{
+		{"admin MSP", &commontest.FakeIdentity{MSPID: "Org1MSP"}, "Initialize", adminMSPs, functions, true},
+		{"other MSP", &commontest.FakeIdentity{MSPID: "Org2MSP"}, "Initialize", adminMSPs, functions, false},
+		{"no admin MSPs yet", &commontest.FakeIdentity{MSPID: "Org1MSP"}, "Initialize", nil, functions, false},
+		{"admin role in the admin MSP", withRole(RoleAdmin, "Org1MSP"), "Initialize", adminMSPs, functions, true},
+		{"admin role from another MSP", withRole(RoleAdmin, "Org2MSP"), "Initialize", adminMSPs, functions, false},
+		{"scoped role from another MSP", withRole(RoleUserAdmin, "Org2MSP"), "RegisterUser", adminMSPs, functions, false},
+		{"scoped role in the admin MSP", withRole(RoleUserAdmin, "Org1MSP"), "RegisterUser", adminMSPs, functions, true},
+		{"role of another scope", withRole(RoleDeviceAdmin, "Org1MSP"), "Initialize", adminMSPs, functions, false},
+		{"auditor", withRole(RoleAuditor, "Org1MSP"), "Initialize", adminMSPs, functions, false},
+		{"role without role tables", withRole(RoleAuditor, "Org1MSP"), "Initialize", adminMSPs, nil, true},
+		{"unreadable identity", &commontest.FakeIdentity{MSPID: "Org1MSP", Err: errors.New("bad certificate")}, "Initialize", adminMSPs, functions, false},
+	}
+	for _, test := range tests {
+		err := checkAdminIdentity(test.identity, test.function, test.adminMSPs, test.functions)
+		if (err == nil) != test.allowed {
+			t.Errorf("%s: error = %v, want allowed %v", test.name, err, test.allowed)
+		}
+	}
+}
+
+func TestUninitializedChaincodeDeniesCallers(t *testing.T) {
+	stub := commontest.NewStub("admin")
+	for _, identity := range []*commontest.FakeIdentity{
+		{MSPID: "Org1MSP"},
+		{Attrs: map[string]string{RoleAttribute: RoleAdmin}, MSPID: "Org1MSP"},
+	} {
+		ctx := commontest.NewContext(stub, identity)
+		if err := CheckAdminCaller(ctx, "Initialize", nil); err == nil {
+			t.Errorf("caller %+v was accepted before the admin MSPs were set", identity)
+		}
+	}
+}
+
+func TestInitAdminMSPs(t *testing.T) {
+	stub := commontest.NewStub("admin")
+	org1 := commontest.NewContext(stub, &commontest.FakeIdentity{MSPID: "Org1MSP"})
+	org2 := commontest.NewContext(stub, &commontest.FakeIdentity{MSPID: "Org2MSP"})
+
+	if _, err := InitAdminMSPs(org1, `[]`); err == nil {
+		t.Error("empty admin MSP list was accepted")
+	}
+	if _, err := InitAdminMSPs(org1, `["Org2MSP"]`); err == nil {
+		t.Error("admin MSP list without the caller was accepted")
+	}
+	if _, err := InitAdminMSPs(org1, `["Org1MSP"]`); err != nil {
+		t.Fatalf("InitAdminMSPs failed: %v", err)
+	}
+	if _, err := InitAdminMSPs(org2, `["Org2MSP"]`); err == nil {
+		t.Error("InitAdminMSPs ran twice")
+	}
+
+	if err := CheckAdminCaller(org1, "Initialize", nil); err != nil {
+		t.Errorf("admin MSP was refused: %v", err)
+	}
+	if err := CheckAdminCaller(org2, "Initialize", nil); err == nil {
+		t.Error("non-admin MSP was accepted")
+	}
+
+	if _, err := SetAdminMSPs(org1, `["Org1MSP","Org2MSP"]`); err != nil {
+		t.Fatalf("SetAdminMSPs failed: %v", err)
+	}
+	if err := CheckAdminCaller(org2, "Initialize", nil); err != nil {
+		t.Errorf("added admin MSP was refused: %v", err)
+	}
+}
+
+func TestInitAdminMSPsKeepsLegacyAdmins(t *testing.T) {
+	stub := commontest.NewStub("admin")
+	stub.State[legacyAdminMSPsKey] = []byte(`{"maxIDLength":64,"adminMSPs":["Org1MSP"]}`)
+	org1 := commontest.NewContext(stub, &commontest.FakeIdentity{MSPID: "Org1MSP"})
+	org2 := commontest.NewContext(stub, &commontest.FakeIdentity{MSPID: "Org2MSP"})
+
+	if err := CheckAdminCaller(org1, "Initialize", nil); err != nil {
+		t.Errorf("admin of the payload limits was refused: %v", err)
+	}
+	if _, err := InitAdminMSPs(org2, `["Org2MSP"]`); err == nil {
+		t.Error("InitAdminMSPs was open to an MSP outside the payload limits admins")
+	}
+	if _, err := InitAdminMSPs(org1, `["Org1MSP","Org2MSP"]`); err != nil {
+		t.Fatalf("InitAdminMSPs failed: %v", err)
+	}
+	msps, err := GetAdminMSPs(org2)
+	if err != nil || len(msps) != 2 {
+		t.Errorf("GetAdminMSPs = %v, %v; want both MSPs", msps, err)
+	}
+}
+
+func TestMigrateLegacyAdminMSPs(t *testing.T) {
+	stub := commontest.NewStub("admin")
+	ctx := commontest.NewContext(stub, &commontest.FakeIdentity{MSPID: "Org1MSP"})
+	if err := MigrateLegacyAdminMSPs(ctx); err != nil {
+		t.Fatalf("MigrateLegacyAdminMSPs failed: %v", err)
+	}
+	if stub.State[AdminMSPsKey] != nil {
+		t.Error("admin MSPs were stored without legacy admins")
+	}
+
+	stub.State[legacyAdminMSPsKey] = []byte(`{"adminMSPs":["Org1MSP"]}`)
+	if err := MigrateLegacyAdminMSPs(ctx); err != nil {
+		t.Fatalf("MigrateLegacyAdminMSPs failed: %v", err)
+	}
+	stub.State[legacyAdminMSPsKey] = []byte(`{"maxIDLength":64}`)
+	if err := CheckAdminCaller(ctx, "SetPayloadLimits", nil); err != nil {
+		t.Errorf("legacy admin was lost with the payload limits: %v", err)
+	}
+}
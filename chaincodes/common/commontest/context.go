@@ -0,0 +1,43 @@
+package commontest
+
+import (
+	"github.com/hyperledger/fabric-chaincode-go/pkg/cid"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-chaincode-go/shimtest"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// NewStub returns a mock stub with a transaction started, so it accepts
+// writes
+func NewStub(name string) *shimtest.MockStub {
+	stub := shimtest.NewMockStub(name, nil)
+	stub.MockTransactionStart("tx1")
+	return stub
+}
+
+// InvocationStub is a mock stub whose transaction calls Function, for
+// testing the checks a contract runs before a transaction
+type InvocationStub struct {
+	*shimtest.MockStub
+	Function string
+	Args     []string
+}
+
+// NewInvocation returns a stub, with a transaction started, that calls
+// function with args
+func NewInvocation(function string, args ...string) *InvocationStub {
+	return &InvocationStub{MockStub: NewStub(function), Function: function, Args: args}
+}
+
+// GetFunctionAndParameters returns Function and Args
+func (s *InvocationStub) GetFunctionAndParameters() (string, []string) {
+	return s.Function, s.Args
+}
+
+// NewContext returns a transaction context on stub whose caller is identity
+func NewContext(stub shim.ChaincodeStubInterface, identity cid.ClientIdentity) *contractapi.TransactionContext {
+	ctx := new(contractapi.TransactionContext)
+	ctx.SetStub(stub)
+	ctx.SetClientIdentity(identity)
+	return ctx
+}
@@ -0,0 +1,54 @@
+package commontest
+
+import (
+	"crypto/x509"
+	"errors"
+)
+
+var errAttributeValue = errors.New("attribute does not have the asserted value")
+
+// FakeIdentity is a client identity with fixed attributes and MSP ID. Err,
+// if set, is returned by every method.
+type FakeIdentity struct {
+	Attrs map[string]string
+	MSPID string
+	Err   error
+}
+
+// WithRole returns an identity of no MSP whose role attribute
+// (common.RoleAttribute) is role
+func WithRole(role string) *FakeIdentity {
+	return &FakeIdentity{Attrs: map[string]string{"role": role}}
+}
+
+// GetID returns the MSP ID; the tests do not tell identities of one MSP apart
+func (f *FakeIdentity) GetID() (string, error) {
+	return f.MSPID, f.Err
+}
+
+// GetMSPID returns MSPID
+func (f *FakeIdentity) GetMSPID() (string, error) {
+	return f.MSPID, f.Err
+}
+
+// GetAttributeValue returns the attribute from Attrs
+func (f *FakeIdentity) GetAttributeValue(attrName string) (string, bool, error) {
+	value, found := f.Attrs[attrName]
+	return value, found, f.Err
+}
+
+// AssertAttributeValue fails unless the attribute has value
+func (f *FakeIdentity) AssertAttributeValue(attrName, value string) error {
+	if f.Err != nil {
+		return f.Err
+	}
+	if f.Attrs[attrName] != value {
+		return errAttributeValue
+	}
+	return nil
+}
+
+// GetX509Certificate returns no certificate
+func (f *FakeIdentity) GetX509Certificate() (*x509.Certificate, error) {
+	return nil, f.Err
+}
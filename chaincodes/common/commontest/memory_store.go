@@ -0,0 +1,37 @@
+// Package commontest holds test doubles for the chaincodes' unit tests
+package commontest
+
+// MemoryStore is a common.StateStore that, like Fabric, only changes on
+// commit. Log records the writes in the order they reached the store.
+type MemoryStore struct {
+	State map[string][]byte
+	Log   []string
+}
+
+// NewMemoryStore returns a store holding state, or an empty one if state is
+// nil
+func NewMemoryStore(state map[string][]byte) *MemoryStore {
+	if state == nil {
+		state = make(map[string][]byte)
+	}
+	return &MemoryStore{State: state}
+}
+
+// GetState returns the value of key, or nil if it is not set
+func (m *MemoryStore) GetState(key string) ([]byte, error) {
+	return m.State[key], nil
+}
+
+// PutState sets key
+func (m *MemoryStore) PutState(key string, value []byte) error {
+	m.Log = append(m.Log, "put "+key)
+	m.State[key] = value
+	return nil
+}
+
+// DelState removes key
+func (m *MemoryStore) DelState(key string) error {
+	m.Log = append(m.Log, "del "+key)
+	delete(m.State, key)
+	return nil
+}
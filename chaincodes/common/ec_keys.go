@@ -0,0 +1,200 @@
+package common
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+// Clients and devices register either an RSA key or an elliptic-curve key on
+// P-256. The record's KeyType says which; records from before EC support
+// have none and hold RSA keys. Signatures over a SHA-256 digest are
+// RSASSA-PKCS1-v1_5 for RSA keys and ASN.1 DER ECDSA for P-256 keys.
+//
+// Session keys for a P-256 client are ECIES encrypted
+// (ecies-p256-aes256gcm): an ephemeral P-256 key agrees a secret with the
+// client key, the ANSI X9.63 KDF with SHA-256 turns it into an AES-256 key,
+// and the plaintext is sealed with AES-GCM. The message is the ephemeral
+// public key (65 bytes, uncompressed), a 12-byte nonce and the ciphertext;
+// the ephemeral public key is also the KDF's shared info.
+
+const (
+	KeyTypeRSA  = "rsa"
+	KeyTypeP256 = "ec-p256"
+
+	EncryptionECIES = "ecies-p256-aes256gcm"
+
+	eciesPointSize = 65
+	eciesKeySize   = 32
+	eciesNonceSize = 12
+)
+
+var (
+	errUnsupportedKey = errors.New("only RSA and P-256 keys are supported")
+	errInvalidPoint   = errors.New("ephemeral key is not a P-256 point")
+)
+
+// RegistrationKeyType parses a PEM public key offered at registration and
+// returns its key type
+func RegistrationKeyType(pemBytes []byte) (string, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return "", fmt.Errorf("failed to decode PEM block containing public key")
+	}
+	publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return "", fmt.Errorf("invalid public key: %v", err)
+	}
+
+	switch publicKey := publicKey.(type) {
+	case *rsa.PublicKey:
+		return KeyTypeRSA, nil
+	case *ecdsa.PublicKey:
+		if publicKey.Curve != elliptic.P256() {
+			return "", fmt.Errorf("invalid public key: curve %s: %v", publicKey.Curve.Params().Name, errUnsupportedKey)
+		}
+		return KeyTypeP256, nil
+	}
+	return "", fmt.Errorf("invalid public key: %v", errUnsupportedKey)
+}
+
+// ParseECPublicKeyPEM decodes a PKIX P-256 public key. what names the key in
+// error messages.
+func ParseECPublicKeyPEM(what string, pemBytes []byte) (*ecdsa.PublicKey, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode PEM block containing %s", what)
+	}
+	publicKeyInterface, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", what, err)
+	}
+	publicKey, ok := publicKeyInterface.(*ecdsa.PublicKey)
+	if !ok || publicKey.Curve != elliptic.P256() {
+		return nil, fmt.Errorf("%s is not a P-256 public key", what)
+	}
+	return publicKey, nil
+}
+
+// VerifyKeySignature checks a signature over a SHA-256 digest with a
+// registered key of the given type. Errors are *CryptoError naming op, as
+// from SafeVerify.
+func VerifyKeySignature(op string, keyType string, publicKeyPEM []byte, hashed []byte, signature []byte) error {
+	switch keyType {
+	case "", KeyTypeRSA:
+		publicKey, err := ParsePublicKeyPEM("public key", publicKeyPEM)
+		if err != nil {
+			return err
+		}
+		return SafeVerify(op, publicKey, hashed, signature)
+	case KeyTypeP256:
+		publicKey, err := ParseECPublicKeyPEM("public key", publicKeyPEM)
+		if err != nil {
+			return err
+		}
+		return safeVerifyECDSA(op, publicKey, hashed, signature)
+	}
+	return &CryptoError{Op: op, Err: fmt.Errorf("key type %q: %v", keyType, errUnsupportedKey)}
+}
+
+// safeVerifyECDSA checks an ASN.1 DER ECDSA signature over a SHA-256 digest.
+// A bad signature and a panic inside the crypto library both come back as a
+// *CryptoError naming op.
+func safeVerifyECDSA(op string, publicKey *ecdsa.PublicKey, hashed []byte, signature []byte) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &CryptoError{Op: op, Err: fmt.Errorf("%v", r), Panicked: true}
+		}
+	}()
+
+	switch {
+	case publicKey == nil || publicKey.X == nil:
+		return &CryptoError{Op: op, Err: ErrMissingKey}
+	case len(signature) == 0:
+		return &CryptoError{Op: op, Err: ErrEmptySignature}
+	}
+
+	if !ecdsa.VerifyASN1(publicKey, hashed, signature) {
+		return &CryptoError{Op: op, Err: errors.New("ecdsa: verification error")}
+	}
+	return nil
+}
+
+// EncryptECIES encrypts plaintext for a P-256 key
+func EncryptECIES(publicKey *ecdsa.PublicKey, plaintext []byte) ([]byte, error) {
+	ephemeral, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate ephemeral key: %v", err)
+	}
+	point := elliptic.Marshal(elliptic.P256(), ephemeral.PublicKey.X, ephemeral.PublicKey.Y)
+	gcm, err := eciesCipher(publicKey, ephemeral.D.Bytes(), point)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, eciesNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %v", err)
+	}
+	message := append(point, nonce...)
+	return gcm.Seal(message, nonce, plaintext, nil), nil
+}
+
+// decryptECIES opens a message made by EncryptECIES. Errors are
+// *CryptoError naming op.
+func decryptECIES(op string, privateKey *ecdsa.PrivateKey, message []byte) ([]byte, error) {
+	if privateKey == nil || privateKey.D == nil {
+		return nil, &CryptoError{Op: op, Err: ErrMissingKey}
+	}
+	if len(message) < eciesPointSize+eciesNonceSize {
+		return nil, &CryptoError{Op: op, Err: ErrCiphertextLength}
+	}
+	point := message[:eciesPointSize]
+	x, y := elliptic.Unmarshal(elliptic.P256(), point)
+	if x == nil {
+		return nil, &CryptoError{Op: op, Err: errInvalidPoint}
+	}
+
+	gcm, err := eciesCipher(&ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, privateKey.D.Bytes(), point)
+	if err != nil {
+		return nil, &CryptoError{Op: op, Err: err}
+	}
+	nonce := message[eciesPointSize : eciesPointSize+eciesNonceSize]
+	plaintext, err := gcm.Open(nil, nonce, message[eciesPointSize+eciesNonceSize:], nil)
+	if err != nil {
+		return nil, &CryptoError{Op: op, Err: ErrEnvelopeAuth}
+	}
+	return plaintext, nil
+}
+
+// eciesCipher agrees a secret between scalar and publicKey and returns the
+// AES-GCM cipher keyed from it
+func eciesCipher(publicKey *ecdsa.PublicKey, scalar []byte, sharedInfo []byte) (cipher.AEAD, error) {
+	x, _ := elliptic.P256().ScalarMult(publicKey.X, publicKey.Y, scalar)
+	secret := make([]byte, 32)
+	x.FillBytes(secret)
+
+	// ANSI X9.63 KDF: one SHA-256 block is the whole AES-256 key
+	counter := make([]byte, 4)
+	binary.BigEndian.PutUint32(counter, 1)
+	kdf := sha256.New()
+	kdf.Write(secret)
+	kdf.Write(counter)
+	kdf.Write(sharedInfo)
+	key := kdf.Sum(nil)[:eciesKeySize]
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,118 @@
+package common
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"testing"
+)
+
+func pkixPEM(t *testing.T, publicKey interface{}) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+func TestRegistrationKeyType(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p256Key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		pem     []byte
+		want    string
+		wantErr bool
+	}{
+		{"rsa", pkixPEM(t, &rsaKey.PublicKey), KeyTypeRSA, false},
+		{"p256", pkixPEM(t, &p256Key.PublicKey), KeyTypeP256, false},
+		{"p384", pkixPEM(t, &p384Key.PublicKey), "", true},
+		{"not pem", []byte("not a key"), "", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := RegistrationKeyType(test.pem)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("RegistrationKeyType() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("RegistrationKeyType() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestVerifyKeySignature(t *testing.T) {
+	p256Key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM := pkixPEM(t, &p256Key.PublicKey)
+	hashed := sha256.Sum256([]byte("nonce"))
+	signature, err := ecdsa.SignASN1(rand.Reader, p256Key, hashed[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := VerifyKeySignature("signature verification", KeyTypeP256, keyPEM, hashed[:], signature); err != nil {
+		t.Errorf("VerifyKeySignature() error = %v", err)
+	}
+	other := sha256.Sum256([]byte("other nonce"))
+	var cryptoErr *CryptoError
+	if err := VerifyKeySignature("signature verification", KeyTypeP256, keyPEM, other[:], signature); !errors.As(err, &cryptoErr) {
+		t.Errorf("VerifyKeySignature() of another digest error = %v, want a *CryptoError", err)
+	}
+	if err := VerifyKeySignature("signature verification", KeyTypeRSA, keyPEM, hashed[:], signature); err == nil {
+		t.Error("VerifyKeySignature() with the wrong key type succeeded")
+	}
+}
+
+func TestECIES(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext := []byte("session key")
+	message, err := EncryptECIES(&key.PublicKey, plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := decryptECIES("session key decryption", key, message)
+	if err != nil || !bytes.Equal(got, plaintext) {
+		t.Fatalf("decryptECIES() = %q, %v", got, err)
+	}
+
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := decryptECIES("session key decryption", other, message); !errors.Is(err, ErrEnvelopeAuth) {
+		t.Errorf("decryptECIES() with another key error = %v, want %v", err, ErrEnvelopeAuth)
+	}
+	if _, err := decryptECIES("session key decryption", key, message[:eciesPointSize]); !errors.Is(err, ErrCiphertextLength) {
+		t.Errorf("decryptECIES() of a truncated message error = %v, want %v", err, ErrCiphertextLength)
+	}
+	message[1] ^= 0xff
+	if _, err := decryptECIES("session key decryption", key, message); !errors.Is(err, errInvalidPoint) {
+		t.Errorf("decryptECIES() with a bad point error = %v, want %v", err, errInvalidPoint)
+	}
+}
@@ -0,0 +1,377 @@
+// Package fixtures generates populated world states for the AS, TGS and ISV
+// chaincodes. The same Config, and in particular the same Seed, always
+// produces byte-for-byte the same state, so scenario tests that need many
+// clients, devices and tickets at different lifecycle stages stay
+// reproducible.
+//
+// The record types below mirror the JSON the fixed-v4 chaincodes store; keep
+// them in step when a chaincode record changes.
+package fixtures
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Config controls the size and shape of a generated world state
+type Config struct {
+	Seed             int64
+	Clients          int
+	Devices          int
+	TicketsPerClient int
+	ServiceID        string    // defaults to "iotservice1"
+	Now              time.Time // the time the state is "as of"; defaults to 2024-01-01T12:00:00Z
+	PublicKeyPEM     string    // used for every client and device; defaults to TestPublicKeyPEM
+}
+
+// DefaultConfig is a small state with every lifecycle stage represented
+func DefaultConfig(seed int64) Config {
+	return Config{Seed: seed, Clients: 8, Devices: 6, TicketsPerClient: 4}
+}
+
+// TestPublicKeyPEM is a valid RSA public key with no private key kept
+// anywhere. It parses, but nothing signed or encrypted for it can be used.
+const TestPublicKeyPEM = `-----BEGIN PUBLIC KEY-----
+MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEAsDTpbOAHZjFGcPNTQu3L
+BRZH/IYlLTq32Bke/V42eF9lNXn3y2TqCyIJf69jlFWUoGC/zb9A8hmd5ZTQw2ge
+yw+Ydo5GSV/iGxnydRreIdqcH50mHQXrWVT6XvT3G3GfduQEg8ekw5bS7M7snea9
+2E2/QvveLtvlx5ybkr3gn376cmDoZMhF2Cs8NcQNEBfUmSUnP3LGGAQC69M0Cxrx
+PDQ3lECxMOCzLlFBQ4H8xsFnGMiPmpPeJOeV5bHA0dTYuis7iGeqtVirHZTcW6uo
+nEcTceiGRwx8wbIIBqJqQAdTae4hrugcGdi7VCOwAI8+CXNtPZg2t1DuURPbrlcm
+kwIDAQAB
+-----END PUBLIC KEY-----
+`
+
+// ClientIdentity mirrors the AS client record stored under CLIENT_<id>
+type ClientIdentity struct {
+	ID               string    `json:"id"`
+	PublicKey        string    `json:"publicKey"`
+	RegistrationTime time.Time `json:"registrationTime"`
+	Valid            bool      `json:"valid"`
+}
+
+// TGTRecord mirrors the AS audit record stored under TGT_<client>_<unix>
+type TGTRecord struct {
+	ClientID  string    `json:"clientID"`
+	Timestamp time.Time `json:"timestamp"`
+	TGTHash   string    `json:"tgtHash"`
+}
+
+// ClientRecord mirrors the TGS record stored under CLIENT_RECORD_<id>
+type ClientRecord struct {
+	ClientID   string    `json:"clientID"`
+	LastAccess time.Time `json:"lastAccess"`
+	Status     string    `json:"status"`
+	ValidUntil time.Time `json:"validUntil"`
+}
+
+// TicketRecord mirrors the TGS record stored under
+// TICKET_<client>_<service>_<unix>
+type TicketRecord struct {
+	ClientID            string    `json:"clientID"`
+	ServiceID           string    `json:"serviceID"`
+	Timestamp           time.Time `json:"timestamp"`
+	TicketHash          string    `json:"ticketHash"`
+	EncryptedTicketHash string    `json:"encryptedTicketHash"`
+	Status              string    `json:"status"`
+	RevokedAt           time.Time `json:"revokedAt,omitempty"`
+}
+
+// IoTDevice mirrors the ISV record stored under DEVICE_<id>
+type IoTDevice struct {
+	DeviceID     string    `json:"deviceID"`
+	PublicKey    string    `json:"publicKey"`
+	Status       string    `json:"status"`
+	LastSeen     time.Time `json:"lastSeen"`
+	RegisteredAt time.Time `json:"registeredAt"`
+	Capabilities []string  `json:"capabilities"`
+}
+
+// ClientDeviceSession mirrors the ISV record stored under its session ID
+type ClientDeviceSession struct {
+	SessionID     string    `json:"sessionID"`
+	ClientID      string    `json:"clientID"`
+	DeviceID      string    `json:"deviceID"`
+	SessionKey    string    `json:"sessionKey"`
+	EstablishedAt time.Time `json:"establishedAt"`
+	ExpiresAt     time.Time `json:"expiresAt"`
+	Status        string    `json:"status"`
+}
+
+// Lifetimes used by the chaincodes
+const (
+	tgtLifetime     = time.Hour
+	sessionLifetime = time.Hour
+)
+
+var capabilitySets = [][]string{
+	{"read"},
+	{"read", "write"},
+	{"read", "write", "control"},
+	{"temperature", "humidity"},
+}
+
+// State is a generated world state, one key space per chaincode. The
+// typed slices hold the same records as the key spaces, for assertions.
+type State struct {
+	AS  map[string][]byte
+	TGS map[string][]byte
+	ISV map[string][]byte
+
+	Clients  []ClientIdentity
+	Tickets  []TicketRecord
+	Devices  []IoTDevice
+	Sessions []ClientDeviceSession
+}
+
+// Putter is the part of a chaincode stub fixtures are written through;
+// shim.ChaincodeStubInterface satisfies it
+type Putter interface {
+	PutState(key string, value []byte) error
+}
+
+// generator draws every random choice from one seeded source, in a fixed
+// order, so the output depends on nothing but the Config
+type generator struct {
+	cfg   Config
+	rng   *rand.Rand
+	state *State
+}
+
+// Generate builds the world state described by cfg.
+//
+// Clients alternate between registered-only, holding a live TGT, holding an
+// expired TGT, and revoked. Tickets are spread over the last two days and
+// some are revoked. Devices are active, inactive, or busy with an active
+// session; terminated and expired sessions are added alongside.
+// Expired TGTs and sessions keep the "active" status the chaincodes leave
+// them in, with an expiry time before Now.
+func Generate(cfg Config) (*State, error) {
+	if cfg.Clients < 0 || cfg.Devices < 0 || cfg.TicketsPerClient < 0 {
+		return nil, fmt.Errorf("fixture counts must not be negative")
+	}
+	if cfg.ServiceID == "" {
+		cfg.ServiceID = "iotservice1"
+	}
+	if cfg.Now.IsZero() {
+		cfg.Now = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	}
+	if cfg.PublicKeyPEM == "" {
+		cfg.PublicKeyPEM = TestPublicKeyPEM
+	}
+
+	g := &generator{
+		cfg: cfg,
+		rng: rand.New(rand.NewSource(cfg.Seed)),
+		state: &State{
+			AS:  make(map[string][]byte),
+			TGS: make(map[string][]byte),
+			ISV: make(map[string][]byte),
+		},
+	}
+
+	for i := 0; i < cfg.Clients; i++ {
+		if err := g.client(i); err != nil {
+			return nil, err
+		}
+	}
+	for i := 0; i < cfg.Devices; i++ {
+		if err := g.device(i); err != nil {
+			return nil, err
+		}
+	}
+	return g.state, nil
+}
+
+func clientID(i int) string { return fmt.Sprintf("client%03d", i+1) }
+func deviceID(i int) string { return fmt.Sprintf("device%03d", i+1) }
+
+// before returns a time up to maxAgo before Now, at whole seconds because
+// ledger keys embed Unix seconds
+func (g *generator) before(maxAgo time.Duration) time.Time {
+	ago := time.Duration(g.rng.Int63n(int64(maxAgo/time.Second))+1) * time.Second
+	return g.cfg.Now.Add(-ago)
+}
+
+func (g *generator) hash() string {
+	b := make([]byte, 32)
+	g.rng.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func put(space map[string][]byte, key string, record interface{}) error {
+	recordJSON, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal fixture %s: %v", key, err)
+	}
+	space[key] = recordJSON
+	return nil
+}
+
+func (g *generator) client(i int) error {
+	id := clientID(i)
+	registered := g.before(30 * 24 * time.Hour)
+	stage := i % 4
+
+	client := ClientIdentity{
+		ID:               id,
+		PublicKey:        g.cfg.PublicKeyPEM,
+		RegistrationTime: registered,
+		Valid:            stage != 3,
+	}
+	g.state.Clients = append(g.state.Clients, client)
+	if err := put(g.state.AS, "CLIENT_"+id, client); err != nil {
+		return err
+	}
+	if stage == 0 || stage == 3 {
+		return nil
+	}
+
+	// A live TGT was issued within its lifetime, an expired one before it
+	issued := g.before(tgtLifetime - time.Minute)
+	if stage == 2 {
+		issued = g.cfg.Now.Add(-tgtLifetime).Add(-time.Duration(g.rng.Intn(3600)+1) * time.Second)
+	}
+	tgt := TGTRecord{ClientID: id, Timestamp: issued, TGTHash: g.hash()}
+	if err := put(g.state.AS, "TGT_"+id+"_"+strconv.FormatInt(issued.Unix(), 10), tgt); err != nil {
+		return err
+	}
+
+	// The TGS leaves expired records "active"; ValidUntil tells them apart
+	record := ClientRecord{
+		ClientID:   id,
+		LastAccess: issued,
+		Status:     "active",
+		ValidUntil: issued.Add(tgtLifetime),
+	}
+	if err := put(g.state.TGS, "CLIENT_RECORD_"+id, record); err != nil {
+		return err
+	}
+
+	// Ticket keys embed Unix seconds, so draw distinct times per client
+	times := make(map[int64]bool)
+	for n := 0; n < g.cfg.TicketsPerClient; n++ {
+		at := g.before(48 * time.Hour)
+		for times[at.Unix()] {
+			at = at.Add(-time.Second)
+		}
+		times[at.Unix()] = true
+
+		ticket := TicketRecord{
+			ClientID:            id,
+			ServiceID:           g.cfg.ServiceID,
+			Timestamp:           at,
+			TicketHash:          g.hash(),
+			EncryptedTicketHash: g.hash(),
+			Status:              "issued",
+		}
+		if g.rng.Intn(4) == 0 {
+			ticket.Status = "revoked"
+			ticket.RevokedAt = at.Add(time.Duration(g.rng.Intn(600)+1) * time.Second)
+		}
+		g.state.Tickets = append(g.state.Tickets, ticket)
+		key := "TICKET_" + id + "_" + g.cfg.ServiceID + "_" + strconv.FormatInt(at.Unix(), 10)
+		if err := put(g.state.TGS, key, ticket); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *generator) device(i int) error {
+	id := deviceID(i)
+	registered := g.before(30 * 24 * time.Hour)
+	device := IoTDevice{
+		DeviceID:     id,
+		PublicKey:    g.cfg.PublicKeyPEM,
+		Status:       "active",
+		LastSeen:     g.before(24 * time.Hour),
+		RegisteredAt: registered,
+		Capabilities: capabilitySets[g.rng.Intn(len(capabilitySets))],
+	}
+
+	switch i % 3 {
+	case 1:
+		device.Status = "inactive"
+	case 2:
+		// Busy devices hold an active session with a valid client
+		if client := g.validClient(); client != "" {
+			established := g.before(sessionLifetime - time.Minute)
+			if err := g.session(client, id, established, "active"); err != nil {
+				return err
+			}
+			device.Status = "busy"
+			device.LastSeen = established
+		}
+	}
+
+	// Past sessions, either terminated or left "active" past their expiry
+	if client := g.validClient(); client != "" && g.rng.Intn(2) == 0 {
+		ended := g.cfg.Now.Add(-2 * sessionLifetime).Add(-time.Duration(g.rng.Intn(86400)) * time.Second)
+		status := "terminated"
+		if g.rng.Intn(2) == 0 {
+			status = "active"
+		}
+		if err := g.session(client, id, ended, status); err != nil {
+			return err
+		}
+	}
+
+	g.state.Devices = append(g.state.Devices, device)
+	return put(g.state.ISV, "DEVICE_"+id, device)
+}
+
+// validClient picks a client that is still registered, or "" if none is
+func (g *generator) validClient() string {
+	var valid []string
+	for _, client := range g.state.Clients {
+		if client.Valid {
+			valid = append(valid, client.ID)
+		}
+	}
+	if len(valid) == 0 {
+		return ""
+	}
+	return valid[g.rng.Intn(len(valid))]
+}
+
+func (g *generator) session(client, device string, established time.Time, status string) error {
+	id := "SESSION_" + client + "_" + device + "_" + strconv.FormatInt(established.Unix(), 10)
+	session := ClientDeviceSession{
+		SessionID:     id,
+		ClientID:      client,
+		DeviceID:      device,
+		SessionKey:    g.hash(),
+		EstablishedAt: established,
+		ExpiresAt:     established.Add(sessionLifetime),
+		Status:        status,
+	}
+	g.state.Sessions = append(g.state.Sessions, session)
+	return put(g.state.ISV, id, session)
+}
+
+// Keys returns the keys of a key space in sorted order
+func Keys(space map[string][]byte) []string {
+	keys := make([]string, 0, len(space))
+	for key := range space {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Load writes a key space through a stub in sorted key order. With a shimtest
+// MockStub, call it between MockTransactionStart and MockTransactionEnd.
+func Load(stub Putter, space map[string][]byte) error {
+	for _, key := range Keys(space) {
+		if err := stub.PutState(key, space[key]); err != nil {
+			return fmt.Errorf("failed to load fixture %s: %v", key, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package fixtures
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestGenerateIsDeterministic(t *testing.T) {
+	a, err := Generate(DefaultConfig(42))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := Generate(DefaultConfig(42))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, spaces := range map[string][2]map[string][]byte{
+		"AS": {a.AS, b.AS}, "TGS": {a.TGS, b.TGS}, "ISV": {a.ISV, b.ISV},
+	} {
+		if len(spaces[0]) != len(spaces[1]) {
+			t.Fatalf("%s: %d keys vs %d", name, len(spaces[0]), len(spaces[1]))
+		}
+		for key, value := range spaces[0] {
+			if !bytes.Equal(value, spaces[1][key]) {
+				t.Fatalf("%s: %s differs between runs", name, key)
+			}
+		}
+	}
+
+	c, err := Generate(DefaultConfig(43))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(a.TGS[Keys(a.TGS)[0]], c.TGS[Keys(c.TGS)[0]]) {
+		t.Fatal("different seeds produced the same tickets")
+	}
+}
+
+func TestGenerateCoversLifecycleStages(t *testing.T) {
+	cfg := DefaultConfig(7)
+	cfg.Now = time.Date(2025, 6, 1, 9, 0, 0, 0, time.UTC)
+	state, err := Generate(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Clients) != cfg.Clients || len(state.Devices) != cfg.Devices {
+		t.Fatalf("got %d clients and %d devices", len(state.Clients), len(state.Devices))
+	}
+
+	valid := make(map[string]bool)
+	for _, client := range state.Clients {
+		valid[client.ID] = client.Valid
+	}
+	active := make(map[string]bool)
+	for _, session := range state.Sessions {
+		if !valid[session.ClientID] {
+			t.Errorf("session %s belongs to revoked client %s", session.SessionID, session.ClientID)
+		}
+		if session.Status == "active" && session.ExpiresAt.After(cfg.Now) {
+			active[session.DeviceID] = true
+		}
+	}
+	statuses := make(map[string]bool)
+	for _, device := range state.Devices {
+		statuses[device.Status] = true
+		if device.Status == "busy" && !active[device.DeviceID] {
+			t.Errorf("busy device %s has no active session", device.DeviceID)
+		}
+	}
+	for _, status := range []string{"active", "inactive", "busy"} {
+		if !statuses[status] {
+			t.Errorf("no %s device generated", status)
+		}
+	}
+
+	revoked := 0
+	for _, ticket := range state.Tickets {
+		if ticket.Status == "revoked" {
+			revoked++
+			if !ticket.RevokedAt.After(ticket.Timestamp) {
+				t.Errorf("ticket revoked at %v before it was issued at %v", ticket.RevokedAt, ticket.Timestamp)
+			}
+		}
+	}
+	if revoked == 0 || revoked == len(state.Tickets) {
+		t.Errorf("%d of %d tickets revoked; want a mix", revoked, len(state.Tickets))
+	}
+}
+
+type recordingStub map[string][]byte
+
+func (s recordingStub) PutState(key string, value []byte) error {
+	s[key] = value
+	return nil
+}
+
+func TestLoad(t *testing.T) {
+	state, err := Generate(DefaultConfig(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub := recordingStub{}
+	if err := Load(stub, state.ISV); err != nil {
+		t.Fatal(err)
+	}
+	if len(stub) != len(state.ISV) {
+		t.Fatalf("loaded %d of %d keys", len(stub), len(state.ISV))
+	}
+}
@@ -0,0 +1,96 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// One logical flow (a client authenticating with the AS, getting a service
+// ticket from the TGS, opening an ISV session and sending readings to
+// iot-data) spans several chaincodes and transactions. A client correlates
+// them by passing the same flow ID to every call in the flowID transient
+// field. Each chaincode copies it into the events it emits and the audit
+// records it stores. Transient data is shared with chaincodes called
+// through InvokeChaincode, so the ID follows chaincode-to-chaincode calls
+// without further threading. Calls without the field are untagged.
+
+const (
+	// FlowIDTransient is the transient field carrying the flow ID
+	FlowIDTransient = "flowID"
+
+	// maxFlowIDLength bounds the flow IDs a client may pass
+	maxFlowIDLength = 128
+)
+
+// validateFlowID accepts IDs made of letters, digits and ".", "_", ":"
+// and "-", so they can be logged and put in composite keys as they are
+func validateFlowID(flowID string) error {
+	if flowID == "" || len(flowID) > maxFlowIDLength {
+		return fmt.Errorf("flow ID must be 1 to %d characters long", maxFlowIDLength)
+	}
+	for _, r := range flowID {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '.', r == '_', r == ':', r == '-':
+		default:
+			return fmt.Errorf("flow ID contains invalid character %q", r)
+		}
+	}
+	return nil
+}
+
+// flowIDFromTransient returns the flow ID in the transient data, or "" if
+// there is none
+func flowIDFromTransient(transient map[string][]byte) (string, error) {
+	flowID, ok := transient[FlowIDTransient]
+	if !ok {
+		return "", nil
+	}
+	if err := validateFlowID(string(flowID)); err != nil {
+		return "", fmt.Errorf("invalid %s transient field: %v", FlowIDTransient, err)
+	}
+	return string(flowID), nil
+}
+
+// GetFlowID returns the flow ID the transaction belongs to, or "" if the
+// client did not pass one
+func GetFlowID(ctx contractapi.TransactionContextInterface) (string, error) {
+	transient, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return "", fmt.Errorf("failed to read transient data: %v", err)
+	}
+	return flowIDFromTransient(transient)
+}
+
+// tagFlowID adds a flowID field to a JSON object payload. Payloads that
+// already carry one, or are not objects, are returned unchanged.
+func tagFlowID(payload []byte, flowID string) ([]byte, error) {
+	if flowID == "" {
+		return payload, nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &fields); err != nil || fields == nil {
+		return payload, nil
+	}
+	if _, ok := fields[FlowIDTransient]; ok {
+		return payload, nil
+	}
+	fields[FlowIDTransient], _ = json.Marshal(flowID)
+	return json.Marshal(fields)
+}
+
+// SetEvent emits an event tagged with the transaction's flow ID. Every
+// event goes through it rather than the stub's SetEvent.
+func SetEvent(ctx contractapi.TransactionContextInterface, eventName string, payload []byte) error {
+	flowID, err := GetFlowID(ctx)
+	if err != nil {
+		return err
+	}
+	payload, err = tagFlowID(payload, flowID)
+	if err != nil {
+		return fmt.Errorf("failed to tag %s event: %v", eventName, err)
+	}
+	return ctx.GetStub().SetEvent(eventName, payload)
+}
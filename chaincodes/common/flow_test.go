@@ -0,0 +1,58 @@
+package common
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFlowIDFromTransient(t *testing.T) {
+	tests := []struct {
+		name      string
+		transient map[string][]byte
+		want      string
+		wantErr   bool
+	}{
+		{"absent", map[string][]byte{}, "", false},
+		{"uuid", map[string][]byte{FlowIDTransient: []byte("0f8fad5b-d9cb-469f-a165-70867728950e")}, "0f8fad5b-d9cb-469f-a165-70867728950e", false},
+		{"empty", map[string][]byte{FlowIDTransient: nil}, "", true},
+		{"space", map[string][]byte{FlowIDTransient: []byte("flow 1")}, "", true},
+		{"too long", map[string][]byte{FlowIDTransient: []byte(strings.Repeat("a", maxFlowIDLength+1))}, "", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := flowIDFromTransient(test.transient)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("flowIDFromTransient() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("flowIDFromTransient() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestTagFlowID(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		flowID  string
+		want    string
+	}{
+		{"object", `{"deviceID":"d1"}`, "f1", `{"deviceID":"d1","flowID":"f1"}`},
+		{"no flow", `{"deviceID":"d1"}`, "", `{"deviceID":"d1"}`},
+		{"already tagged", `{"flowID":"f0"}`, "f1", `{"flowID":"f0"}`},
+		{"not an object", `["d1"]`, "f1", `["d1"]`},
+		{"not json", `d1`, "f1", `d1`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := tagFlowID([]byte(test.payload), test.flowID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != test.want {
+				t.Errorf("tagFlowID() = %s, want %s", got, test.want)
+			}
+		})
+	}
+}
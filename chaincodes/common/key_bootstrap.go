@@ -0,0 +1,418 @@
+package common
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Earlier versions of the chaincodes carried their RSA key pairs in source,
+// so anyone with the source held every service's private key. The operator
+// now supplies the key pair at initialization, in the serviceKeys transient
+// field, which is not recorded on the ledger:
+//
+//	peer chaincode invoke ... -c '{"function":"InitializeWithKeys","Args":["{\"collection\":\"asKeys\"}"]}' \
+//	    --transient "{\"serviceKeys\":\"$(base64 -w0 keys.json)\"}"
+//
+// where keys.json is a ServiceKeyPair. The argument is a KeyBootstrap. With
+// no collection the private key is kept in world state, as before. With one,
+// it is kept in that private data collection, so only peers of the member
+// organizations hold it; the collection must be in the chaincode definition
+// and include every endorsing organization. When no keys are passed, a
+// private key already in the collection is used.
+//
+// A chaincode initialized with the keys from source is migrated with
+// MigrateServiceKeys, which replaces the key pair and can move the private
+// key into a collection. The services that import the public key must
+// import it again afterwards.
+//
+// An operator tool that fetched the key pair from a secret store, such as
+// Vault, names the secret and its version in the bootstrap's source. The
+// chaincode only records it and reports it in GetServiceKeyStatus, so the
+// tool can tell when the secret has a newer version to migrate to.
+
+// KeyBootstrap says where the chaincode keeps its private key
+type KeyBootstrap struct {
+	// Collection is the private data collection holding the private key;
+	// empty keeps it in world state
+	Collection string `json:"collection,omitempty"`
+	// Source is where the operator fetched the key pair from, if from a
+	// secret store
+	Source *KeySource `json:"source,omitempty"`
+}
+
+// KeySource names the secret a key pair was fetched from. It holds no key
+// material.
+type KeySource struct {
+	Provider string `json:"provider"` // e.g. "vault"
+	Path     string `json:"path"`
+	Version  int64  `json:"version"`
+}
+
+// ServiceKeyPair is a service's PEM key pair, as passed in the serviceKeys
+// transient field
+type ServiceKeyPair struct {
+	PrivateKey string `json:"privateKey"`
+	PublicKey  string `json:"publicKey"`
+}
+
+// ServiceKeyStatus describes the key pair a chaincode runs with
+type ServiceKeyStatus struct {
+	Service     string     `json:"service"`
+	Fingerprint string     `json:"fingerprint"`
+	Collection  string     `json:"collection,omitempty"` // Empty when the private key is in world state
+	Legacy      bool       `json:"legacy"`               // The key pair was published in the chaincode source
+	Source      *KeySource `json:"source,omitempty"`
+}
+
+const (
+	// serviceKeysTransient is the transient field carrying a ServiceKeyPair
+	serviceKeysTransient = "serviceKeys"
+
+	// privateKeyCollectionKey holds the name of the collection the private
+	// key is kept in, if any
+	privateKeyCollectionKey = "PRIVATE_KEY_COLLECTION"
+
+	// keySourceKey holds the KeySource of the key pair, if any
+	keySourceKey = "SERVICE_KEY_SOURCE"
+
+	// maxKeySourceLength bounds the provider and path of a KeySource
+	maxKeySourceLength = 256
+
+	// serviceKeysMigratedEvent carries the ServiceKeyStatus after a migration
+	serviceKeysMigratedEvent = "ServiceKeysMigrated"
+)
+
+// legacyKeyFingerprints are the fingerprints of the key pairs once
+// published in the chaincode source. They are refused as new keys and
+// reported by GetServiceKeyStatus so that they get migrated.
+var legacyKeyFingerprints = map[string]bool{
+	"f5e1f7a8661431779f6f95b5be5a8d04db0f3f26eb5b8a0104f209c8ca070185": true, // AS
+	"b8392ce147670b00501e3cd73823a6545bdd185ad2b119a269be231839d9e4ea": true, // TGS
+	"c4289a59c565aa5c200affa117a347917d69efcb215be5536210c90fea43efcf": true, // ISV
+}
+
+// ParseKeyBootstrap parses the argument of InitializeWithKeys and
+// MigrateServiceKeys. An empty argument keeps the private key in world state.
+func ParseKeyBootstrap(keysJSON string) (*KeyBootstrap, error) {
+	bootstrap := &KeyBootstrap{}
+	if keysJSON == "" {
+		return bootstrap, nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader([]byte(keysJSON)))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(bootstrap); err != nil {
+		return nil, fmt.Errorf("invalid key bootstrap: %v", err)
+	}
+	if err := checkKeySource(bootstrap.Source); err != nil {
+		return nil, err
+	}
+	return bootstrap, nil
+}
+
+// checkKeySource checks a key source, if one is given
+func checkKeySource(source *KeySource) error {
+	if source == nil {
+		return nil
+	}
+	if source.Provider == "" || source.Path == "" {
+		return fmt.Errorf("invalid key source: provider and path are required")
+	}
+	if len(source.Provider) > maxKeySourceLength || len(source.Path) > maxKeySourceLength {
+		return fmt.Errorf("invalid key source: provider and path are limited to %d characters", maxKeySourceLength)
+	}
+	if source.Version < 0 {
+		return fmt.Errorf("invalid key source: version must not be negative")
+	}
+	return nil
+}
+
+// checkServiceKeyPair checks that the public key belongs to the private key
+// and that the pair is not one published in source, and returns the
+// fingerprint of the public key
+func checkServiceKeyPair(pair *ServiceKeyPair) (string, error) {
+	privateKey, err := ParsePrivateKeyPEM([]byte(pair.PrivateKey))
+	if err != nil {
+		return "", err
+	}
+	publicKey, err := ParsePublicKeyPEM("service public key", []byte(pair.PublicKey))
+	if err != nil {
+		return "", err
+	}
+	if !privateKey.PublicKey.Equal(publicKey) {
+		return "", fmt.Errorf("the public key does not belong to the private key")
+	}
+
+	fingerprint, err := PublicKeyFingerprint(publicKey)
+	if err != nil {
+		return "", err
+	}
+	if legacyKeyFingerprints[fingerprint] {
+		return "", fmt.Errorf("key pair %s was published in the chaincode source; generate a new one", fingerprint)
+	}
+	return fingerprint, nil
+}
+
+// publicKeyPEM encodes a public key as PKIX PEM
+func publicKeyPEM(publicKey *rsa.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode public key: %v", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})), nil
+}
+
+// transientKeyPair returns the key pair in the serviceKeys transient field,
+// or nil if the field is not set
+func transientKeyPair(ctx contractapi.TransactionContextInterface) (*ServiceKeyPair, error) {
+	transient, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read transient data: %v", err)
+	}
+	pairJSON, ok := transient[serviceKeysTransient]
+	if !ok {
+		return nil, nil
+	}
+
+	var pair ServiceKeyPair
+	if err := json.Unmarshal(pairJSON, &pair); err != nil {
+		return nil, fmt.Errorf("invalid %s transient field: %v", serviceKeysTransient, err)
+	}
+	return &pair, nil
+}
+
+// keyPairFromPrivateKey completes a key pair from its private key PEM
+func keyPairFromPrivateKey(privateKeyPEM []byte) (*ServiceKeyPair, error) {
+	privateKey, err := ParsePrivateKeyPEM(privateKeyPEM)
+	if err != nil {
+		return nil, err
+	}
+	publicPEM, err := publicKeyPEM(&privateKey.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return &ServiceKeyPair{PrivateKey: string(privateKeyPEM), PublicKey: publicPEM}, nil
+}
+
+// LoadServiceKeyPair returns the key pair to initialize with: the one in the
+// transient field, else the private key already in the bootstrap collection
+func LoadServiceKeyPair(ctx contractapi.TransactionContextInterface, bootstrap *KeyBootstrap, privateKeyName string) (*ServiceKeyPair, error) {
+	pair, err := transientKeyPair(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if pair == nil && bootstrap.Collection != "" {
+		privateKeyPEM, err := ctx.GetStub().GetPrivateData(bootstrap.Collection, privateKeyName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s from collection %s: %v", privateKeyName, bootstrap.Collection, err)
+		}
+		if privateKeyPEM != nil {
+			if pair, err = keyPairFromPrivateKey(privateKeyPEM); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if pair == nil {
+		return nil, fmt.Errorf("no service keys: pass the key pair in the %s transient field", serviceKeysTransient)
+	}
+
+	if _, err := checkServiceKeyPair(pair); err != nil {
+		return nil, err
+	}
+	return pair, nil
+}
+
+// StoreServiceKeyPair stores a key pair, the private key where the
+// bootstrap says, and removes the private key from where it was before
+func StoreServiceKeyPair(ctx contractapi.TransactionContextInterface, bootstrap *KeyBootstrap, privateKeyName, publicKeyName string, pair *ServiceKeyPair) error {
+	previous, err := ctx.GetStub().GetState(privateKeyCollectionKey)
+	if err != nil {
+		return fmt.Errorf("failed to read private key collection: %v", err)
+	}
+	if previous != nil && string(previous) != bootstrap.Collection {
+		if err := ctx.GetStub().DelPrivateData(string(previous), privateKeyName); err != nil {
+			return fmt.Errorf("failed to remove %s from collection %s: %v", privateKeyName, previous, err)
+		}
+	}
+
+	if bootstrap.Collection == "" {
+		if err := ctx.GetStub().PutState(privateKeyName, []byte(pair.PrivateKey)); err != nil {
+			return fmt.Errorf("failed to store %s: %v", privateKeyName, err)
+		}
+		if err := ctx.GetStub().DelState(privateKeyCollectionKey); err != nil {
+			return fmt.Errorf("failed to clear private key collection: %v", err)
+		}
+	} else {
+		if err := ctx.GetStub().PutPrivateData(bootstrap.Collection, privateKeyName, []byte(pair.PrivateKey)); err != nil {
+			return fmt.Errorf("failed to store %s in collection %s: %v", privateKeyName, bootstrap.Collection, err)
+		}
+		if err := ctx.GetStub().PutState(privateKeyCollectionKey, []byte(bootstrap.Collection)); err != nil {
+			return fmt.Errorf("failed to store private key collection: %v", err)
+		}
+		// The world state copy, if any, stays in the ledger history; a key
+		// moved here from world state should therefore also be replaced
+		if err := ctx.GetStub().DelState(privateKeyName); err != nil {
+			return fmt.Errorf("failed to remove %s from world state: %v", privateKeyName, err)
+		}
+	}
+
+	if err := ctx.GetStub().PutState(publicKeyName, []byte(pair.PublicKey)); err != nil {
+		return fmt.Errorf("failed to store %s: %v", publicKeyName, err)
+	}
+	if bootstrap.Source == nil {
+		if err := ctx.GetStub().DelState(keySourceKey); err != nil {
+			return fmt.Errorf("failed to clear key source: %v", err)
+		}
+		return nil
+	}
+	sourceJSON, err := json.Marshal(bootstrap.Source)
+	if err != nil {
+		return fmt.Errorf("failed to marshal key source: %v", err)
+	}
+	if err := ctx.GetStub().PutState(keySourceKey, sourceJSON); err != nil {
+		return fmt.Errorf("failed to store key source: %v", err)
+	}
+	return nil
+}
+
+// getKeySource returns the recorded source of the key pair, or nil
+func getKeySource(ctx contractapi.TransactionContextInterface) (*KeySource, error) {
+	sourceJSON, err := ctx.GetStub().GetState(keySourceKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key source: %v", err)
+	}
+	if sourceJSON == nil {
+		return nil, nil
+	}
+	var source KeySource
+	if err := json.Unmarshal(sourceJSON, &source); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal key source: %v", err)
+	}
+	return &source, nil
+}
+
+// ReadServicePrivateKey reads the private key PEM from world state or from
+// its collection. It returns nil if the chaincode has no private key.
+func ReadServicePrivateKey(ctx contractapi.TransactionContextInterface, privateKeyName string) ([]byte, error) {
+	collection, err := ctx.GetStub().GetState(privateKeyCollectionKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key collection: %v", err)
+	}
+	if collection == nil {
+		privateKeyPEM, err := ctx.GetStub().GetState(privateKeyName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", privateKeyName, err)
+		}
+		return privateKeyPEM, nil
+	}
+
+	privateKeyPEM, err := ctx.GetStub().GetPrivateData(string(collection), privateKeyName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s from collection %s (is this peer a member?): %v", privateKeyName, collection, err)
+	}
+	return privateKeyPEM, nil
+}
+
+// MigrateServiceKeys replaces the key pair with the one in the transient
+// field, or keeps the current one, and stores the private key where
+// keysJSON says. It returns the new status and key pair; the caller records
+// the new fingerprints. Callers check that the invoker is an admin.
+func MigrateServiceKeys(ctx contractapi.TransactionContextInterface, service, privateKeyName, publicKeyName, keysJSON string) (*ServiceKeyStatus, *ServiceKeyPair, error) {
+	bootstrap, err := ParseKeyBootstrap(keysJSON)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	currentPEM, err := ReadServicePrivateKey(ctx, privateKeyName)
+	if err != nil {
+		return nil, nil, err
+	}
+	if currentPEM == nil {
+		return nil, nil, fmt.Errorf("%s chaincode is not initialized; use InitializeWithKeys", service)
+	}
+	current, err := keyPairFromPrivateKey(currentPEM)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pair, err := transientKeyPair(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if pair == nil {
+		// Only move the current key pair, which keeps its source
+		pair = current
+		if bootstrap.Source == nil {
+			if bootstrap.Source, err = getKeySource(ctx); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	fingerprint, err := checkServiceKeyPair(pair)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := StoreServiceKeyPair(ctx, bootstrap, privateKeyName, publicKeyName, pair); err != nil {
+		return nil, nil, err
+	}
+	if pair.PrivateKey != current.PrivateKey {
+		// The published key is stale; dependents must not import it
+		if err := ctx.GetStub().DelState(PublishedKeyKey); err != nil {
+			return nil, nil, fmt.Errorf("failed to withdraw published key: %v", err)
+		}
+	}
+
+	status := &ServiceKeyStatus{Service: service, Fingerprint: fingerprint, Collection: bootstrap.Collection, Source: bootstrap.Source}
+	statusJSON, err := json.Marshal(status)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal key status: %v", err)
+	}
+	if err := SetEvent(ctx, serviceKeysMigratedEvent, statusJSON); err != nil {
+		return nil, nil, fmt.Errorf("failed to emit key migration event: %v", err)
+	}
+
+	fmt.Printf("%s key pair migrated, fingerprint %s\n", service, fingerprint)
+	return status, pair, nil
+}
+
+// GetServiceKeyStatus describes the chaincode's key pair without reading the
+// private key, so any peer can answer it
+func GetServiceKeyStatus(ctx contractapi.TransactionContextInterface, service, publicKeyName string) (*ServiceKeyStatus, error) {
+	publicKeyPEM, err := ctx.GetStub().GetState(publicKeyName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", publicKeyName, err)
+	}
+	if publicKeyPEM == nil {
+		return nil, fmt.Errorf("%s chaincode is not initialized", service)
+	}
+	publicKey, err := ParsePublicKeyPEM(publicKeyName, publicKeyPEM)
+	if err != nil {
+		return nil, err
+	}
+	fingerprint, err := PublicKeyFingerprint(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	collection, err := ctx.GetStub().GetState(privateKeyCollectionKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key collection: %v", err)
+	}
+	source, err := getKeySource(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ServiceKeyStatus{
+		Service:     service,
+		Fingerprint: fingerprint,
+		Collection:  string(collection),
+		Legacy:      legacyKeyFingerprints[fingerprint],
+		Source:      source,
+	}, nil
+}
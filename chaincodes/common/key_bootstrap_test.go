@@ -0,0 +1,57 @@
+package common
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseKeyBootstrap(t *testing.T) {
+	bootstrap, err := ParseKeyBootstrap("")
+	if err != nil || bootstrap.Collection != "" {
+		t.Errorf("ParseKeyBootstrap(\"\") = %+v, %v, want world state", bootstrap, err)
+	}
+	bootstrap, err = ParseKeyBootstrap(`{"collection":"asKeys"}`)
+	if err != nil || bootstrap.Collection != "asKeys" {
+		t.Errorf("ParseKeyBootstrap() = %+v, %v, want collection asKeys", bootstrap, err)
+	}
+	if _, err := ParseKeyBootstrap(`{"colection":"asKeys"}`); err == nil {
+		t.Error("misspelt field accepted")
+	}
+
+	bootstrap, err = ParseKeyBootstrap(`{"source":{"provider":"vault","path":"secret/as","version":3}}`)
+	if err != nil || bootstrap.Source == nil || *bootstrap.Source != (KeySource{Provider: "vault", Path: "secret/as", Version: 3}) {
+		t.Errorf("ParseKeyBootstrap() = %+v, %v, want the vault source", bootstrap, err)
+	}
+	for _, source := range []string{
+		`{"path":"secret/as","version":3}`,
+		`{"provider":"vault","version":3}`,
+		`{"provider":"vault","path":"secret/as","version":-1}`,
+		`{"provider":"vault","path":"` + strings.Repeat("p", maxKeySourceLength+1) + `"}`,
+	} {
+		if _, err := ParseKeyBootstrap(`{"source":` + source + `}`); err == nil {
+			t.Errorf("invalid source %.40s accepted", source)
+		}
+	}
+}
+
+func TestCheckServiceKeyPair(t *testing.T) {
+	privatePEM, publicPEM := testKeyPEM(t)
+	pair := &ServiceKeyPair{PrivateKey: string(privatePEM), PublicKey: string(publicPEM)}
+	if _, err := checkServiceKeyPair(pair); err != nil {
+		t.Errorf("matching key pair rejected: %v", err)
+	}
+
+	derived, err := keyPairFromPrivateKey(privatePEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if derived.PublicKey != string(publicPEM) {
+		t.Errorf("derived public key = %q, want %q", derived.PublicKey, publicPEM)
+	}
+
+	_, otherPEM := testKeyPEM(t)
+	pair.PublicKey = string(otherPEM)
+	if _, err := checkServiceKeyPair(pair); err == nil {
+		t.Error("public key of another key pair accepted")
+	}
+}
@@ -0,0 +1,121 @@
+package common
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"sync"
+)
+
+// Keys are read from world state as PEM on nearly every transaction. Parsing
+// them, the private key in particular, costs far more than the transaction
+// logic, so parsed keys are kept in memory keyed by the SHA-256 of the PEM
+// bytes. The cache is content addressed: a rotated key has a different hash
+// and is parsed afresh, and every peer derives the same key from the same
+// state value, so caching cannot change a transaction's result.
+
+// maxCachedKeys bounds each cache; when full it is emptied and refilled
+const maxCachedKeys = 1024
+
+var (
+	keyCacheMu      sync.Mutex
+	privateKeyCache = make(map[[sha256.Size]byte]*rsa.PrivateKey)
+	publicKeyCache  = make(map[[sha256.Size]byte]*rsa.PublicKey)
+)
+
+// ParsePrivateKeyPEM returns the RSA private key in pemBytes, parsing it only
+// the first time it is seen. Parse errors are not cached.
+func ParsePrivateKeyPEM(pemBytes []byte) (*rsa.PrivateKey, error) {
+	sum := sha256.Sum256(pemBytes)
+
+	keyCacheMu.Lock()
+	privateKey, ok := privateKeyCache[sum]
+	keyCacheMu.Unlock()
+	if ok {
+		return privateKey, nil
+	}
+
+	privateKey, err := decodePrivateKeyPEM(pemBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	keyCacheMu.Lock()
+	if len(privateKeyCache) >= maxCachedKeys {
+		privateKeyCache = make(map[[sha256.Size]byte]*rsa.PrivateKey)
+	}
+	privateKeyCache[sum] = privateKey
+	keyCacheMu.Unlock()
+	return privateKey, nil
+}
+
+// ParsePublicKeyPEM returns the RSA public key in pemBytes, parsing it only
+// the first time it is seen. what names the key in error messages.
+func ParsePublicKeyPEM(what string, pemBytes []byte) (*rsa.PublicKey, error) {
+	sum := sha256.Sum256(pemBytes)
+
+	keyCacheMu.Lock()
+	publicKey, ok := publicKeyCache[sum]
+	keyCacheMu.Unlock()
+	if ok {
+		return publicKey, nil
+	}
+
+	publicKey, err := decodePublicKeyPEM(what, pemBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	keyCacheMu.Lock()
+	if len(publicKeyCache) >= maxCachedKeys {
+		publicKeyCache = make(map[[sha256.Size]byte]*rsa.PublicKey)
+	}
+	publicKeyCache[sum] = publicKey
+	keyCacheMu.Unlock()
+	return publicKey, nil
+}
+
+// decodePrivateKeyPEM parses a PKCS#1 or PKCS#8 RSA private key
+func decodePrivateKeyPEM(pemBytes []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode PEM block containing private key")
+	}
+
+	privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err == nil {
+		return privateKey, nil
+	}
+
+	// Try alternative parsing in case the key is in a different format
+	parsedKey, err2 := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err2 != nil {
+		return nil, fmt.Errorf("failed to parse private key (both PKCS1 and PKCS8): %v, %v", err, err2)
+	}
+	privateKey, ok := parsedKey.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("parsed key is not an RSA private key")
+	}
+	return privateKey, nil
+}
+
+// decodePublicKeyPEM parses a PKIX RSA public key
+func decodePublicKeyPEM(what string, pemBytes []byte) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode PEM block containing %s", what)
+	}
+
+	publicKeyInterface, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", what, err)
+	}
+
+	publicKey, ok := publicKeyInterface.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("not an RSA public key")
+	}
+	return publicKey, nil
+}
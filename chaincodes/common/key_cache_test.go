@@ -0,0 +1,111 @@
+package common
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+)
+
+func testKeyPEM(t testing.TB) ([]byte, []byte) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privatePEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})
+	return privatePEM, publicPEM
+}
+
+func TestParseKeyPEMCache(t *testing.T) {
+	privatePEM, publicPEM := testKeyPEM(t)
+
+	first, err := ParsePrivateKeyPEM(privatePEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := ParsePrivateKeyPEM(append([]byte{}, privatePEM...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		t.Error("ParsePrivateKeyPEM parsed the same PEM twice")
+	}
+
+	publicKey, err := ParsePublicKeyPEM("public key", publicPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if publicKey.N.Cmp(first.N) != 0 {
+		t.Error("public key does not match private key")
+	}
+	if again, _ := ParsePublicKeyPEM("public key", publicPEM); again != publicKey {
+		t.Error("ParsePublicKeyPEM parsed the same PEM twice")
+	}
+
+	otherPrivatePEM, _ := testKeyPEM(t)
+	other, err := ParsePrivateKeyPEM(otherPrivatePEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == first {
+		t.Error("different PEMs returned the same key")
+	}
+
+	// Failures are not cached
+	for i := 0; i < 2; i++ {
+		if _, err := ParsePrivateKeyPEM([]byte("not a key")); err == nil {
+			t.Error("ParsePrivateKeyPEM accepted garbage")
+		}
+		if _, err := ParsePublicKeyPEM("device public key", []byte("not a key")); err == nil || err.Error() != "failed to decode PEM block containing device public key" {
+			t.Errorf("ParsePublicKeyPEM error = %v", err)
+		}
+	}
+}
+
+func BenchmarkParsePrivateKeyPEM(b *testing.B) {
+	privatePEM, _ := testKeyPEM(b)
+
+	b.Run("uncached", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := decodePrivateKeyPEM(privatePEM); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("cached", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := ParsePrivateKeyPEM(privatePEM); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkParsePublicKeyPEM(b *testing.B) {
+	_, publicPEM := testKeyPEM(b)
+
+	b.Run("uncached", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := decodePublicKeyPEM("public key", publicPEM); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("cached", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := ParsePublicKeyPEM("public key", publicPEM); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,153 @@
+package common
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Client and device records carry free-form key/value labels (site=plant-7,
+// type=hvac) that operators use to slice the fleet. Keys and values follow
+// the Kubernetes label syntax: a key is a name of up to 63 characters with an
+// optional DNS prefix ("example.com/team"), and a value is empty or a name.
+//
+// Searches take a label selector, a comma-separated list of requirements:
+//
+//	key=value   the label is set to value (key==value also works)
+//	key!=value  the label is not set to value, or not set at all
+//	key         the label is set
+//	!key        the label is not set
+//
+// All requirements must hold. Selectors turn into CouchDB conditions on the
+// "labels" field; label keys vary, so these queries are not indexed.
+
+const (
+	maxLabels              = 64
+	maxLabelNameLength     = 63
+	maxLabelPrefixLength   = 253
+	maxLabelSelectorLength = 1024
+)
+
+var (
+	labelNamePattern   = regexp.MustCompile(`^[A-Za-z0-9]([-A-Za-z0-9_.]*[A-Za-z0-9])?$`)
+	labelPrefixPattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`)
+)
+
+// ValidateLabelKey checks a label key: a name with an optional DNS prefix
+func ValidateLabelKey(key string) error {
+	name := key
+	if i := strings.LastIndex(key, "/"); i >= 0 {
+		prefix := key[:i]
+		name = key[i+1:]
+		if len(prefix) > maxLabelPrefixLength || !labelPrefixPattern.MatchString(prefix) {
+			return fmt.Errorf("invalid label key %q: the prefix must be a DNS subdomain", key)
+		}
+	}
+	if len(name) > maxLabelNameLength || !labelNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid label key %q: names are up to %d letters, digits, '-', '_' or '.', starting and ending with a letter or digit", key, maxLabelNameLength)
+	}
+	return nil
+}
+
+// ValidateLabelValue checks a label value, which may be empty
+func ValidateLabelValue(value string) error {
+	if value == "" {
+		return nil
+	}
+	if len(value) > maxLabelNameLength || !labelNamePattern.MatchString(value) {
+		return fmt.Errorf("invalid label value %q: values are up to %d letters, digits, '-', '_' or '.', starting and ending with a letter or digit", value, maxLabelNameLength)
+	}
+	return nil
+}
+
+// SetLabel validates a label and sets it in labels, which may be nil
+func SetLabel(labels map[string]string, key, value string) (map[string]string, error) {
+	if err := ValidateLabelKey(key); err != nil {
+		return nil, err
+	}
+	if err := ValidateLabelValue(value); err != nil {
+		return nil, err
+	}
+	if _, ok := labels[key]; !ok && len(labels) >= maxLabels {
+		return nil, fmt.Errorf("a record carries at most %d labels", maxLabels)
+	}
+	if labels == nil {
+		labels = make(map[string]string)
+	}
+	labels[key] = value
+	return labels, nil
+}
+
+// labelField is the CouchDB field path of a label. Dots in the key would
+// otherwise be read as nesting.
+func labelField(key string) string {
+	return "labels." + strings.ReplaceAll(key, ".", `\.`)
+}
+
+// parseLabelSelector turns a label selector into CouchDB conditions, one
+// per requirement
+func parseLabelSelector(labelSelector string) ([]interface{}, error) {
+	if len(labelSelector) > maxLabelSelectorLength {
+		return nil, fmt.Errorf("label selector is %d characters, the limit is %d", len(labelSelector), maxLabelSelectorLength)
+	}
+
+	var conditions []interface{}
+	for _, requirement := range strings.Split(labelSelector, ",") {
+		requirement = strings.TrimSpace(requirement)
+		if requirement == "" {
+			continue
+		}
+
+		var key, value, operator string
+		switch {
+		case strings.Contains(requirement, "!="):
+			parts := strings.SplitN(requirement, "!=", 2)
+			key, value, operator = parts[0], parts[1], "!="
+		case strings.Contains(requirement, "="):
+			parts := strings.SplitN(strings.Replace(requirement, "==", "=", 1), "=", 2)
+			key, value, operator = parts[0], parts[1], "="
+		case strings.HasPrefix(requirement, "!"):
+			key, operator = requirement[1:], "!"
+		default:
+			key, operator = requirement, ""
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if err := ValidateLabelKey(key); err != nil {
+			return nil, err
+		}
+		if err := ValidateLabelValue(value); err != nil {
+			return nil, err
+		}
+
+		field := labelField(key)
+		switch operator {
+		case "=":
+			conditions = append(conditions, map[string]interface{}{field: value})
+		case "!=":
+			conditions = append(conditions, map[string]interface{}{"$or": []interface{}{
+				map[string]interface{}{field: map[string]interface{}{"$exists": false}},
+				map[string]interface{}{field: map[string]interface{}{"$ne": value}},
+			}})
+		case "!":
+			conditions = append(conditions, map[string]interface{}{field: map[string]interface{}{"$exists": false}})
+		default:
+			conditions = append(conditions, map[string]interface{}{field: map[string]interface{}{"$exists": true}})
+		}
+	}
+	return conditions, nil
+}
+
+// AddLabelSelector adds the conditions of a label selector to a CouchDB
+// selector, next to any "$and" conditions it already has
+func AddLabelSelector(selector map[string]interface{}, labelSelector string) error {
+	conditions, err := parseLabelSelector(labelSelector)
+	if err != nil {
+		return err
+	}
+	if len(conditions) == 0 {
+		return nil
+	}
+	and, _ := selector["$and"].([]interface{})
+	selector["$and"] = append(and, conditions...)
+	return nil
+}
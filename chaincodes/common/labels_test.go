@@ -0,0 +1,103 @@
+package common
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestSetLabel(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		value   string
+		wantErr bool
+	}{
+		{"simple", "site", "plant-7", false},
+		{"prefixed key", "example.com/team", "ops", false},
+		{"empty value", "canary", "", false},
+		{"dotted value", "version", "1.2.3", false},
+		{"empty key", "", "x", true},
+		{"empty name", "example.com/", "x", true},
+		{"bad prefix", "Example_com/team", "x", true},
+		{"leading dash", "-site", "x", true},
+		{"space in value", "site", "plant 7", true},
+		{"long name", strings.Repeat("a", 64), "x", true},
+		{"long value", "site", strings.Repeat("a", 64), true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			labels, err := SetLabel(nil, test.key, test.value)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("SetLabel() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if err == nil && labels[test.key] != test.value {
+				t.Errorf("labels[%q] = %q, want %q", test.key, labels[test.key], test.value)
+			}
+		})
+	}
+
+	labels := make(map[string]string)
+	for i := 0; i < maxLabels; i++ {
+		labels[strings.Repeat("k", i+1)] = "v"
+	}
+	if _, err := SetLabel(labels, "one-more", "v"); err == nil {
+		t.Error("SetLabel() over the label limit succeeded")
+	}
+	if _, err := SetLabel(labels, "k", "changed"); err != nil {
+		t.Errorf("SetLabel() replacing a label at the limit error = %v", err)
+	}
+}
+
+func TestParseLabelSelector(t *testing.T) {
+	tests := []struct {
+		name     string
+		selector string
+		want     string
+		wantErr  bool
+	}{
+		{"empty", "", `null`, false},
+		{"equality", "site=plant-7,type==hvac", `[{"labels.site":"plant-7"},{"labels.type":"hvac"}]`, false},
+		{"inequality", "site!=plant-7", `[{"$or":[{"labels.site":{"$exists":false}},{"labels.site":{"$ne":"plant-7"}}]}]`, false},
+		{"existence", "canary, !retired", `[{"labels.canary":{"$exists":true}},{"labels.retired":{"$exists":false}}]`, false},
+		{"dotted key", "example.com/team=ops", `[{"labels.example\\.com/team":"ops"}]`, false},
+		{"bad key", "si te=x", ``, true},
+		{"bad value", "site=a b", ``, true},
+		{"too long", strings.Repeat("a,", maxLabelSelectorLength), ``, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conditions, err := parseLabelSelector(test.selector)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("parseLabelSelector() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			got, err := json.Marshal(conditions)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != test.want {
+				t.Errorf("parseLabelSelector() = %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestAddLabelSelector(t *testing.T) {
+	selector := map[string]interface{}{
+		"$and": []interface{}{map[string]interface{}{"capabilities": "read"}},
+	}
+	if err := AddLabelSelector(selector, "site=plant-7"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := json.Marshal(selector)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"$and":[{"capabilities":"read"},{"labels.site":"plant-7"}]}`
+	if string(got) != want {
+		t.Errorf("selector = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,120 @@
+package common
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Metric counters are updated by the transactions they count. Kept under
+// one key per metric, that key would be read and written by every
+// authentication or session transaction, so concurrent ones would fail MVCC
+// validation. Each counter is instead spread over AggregateShards sub-keys:
+// a transaction updates only the shard its ID picks, and GetMetrics merges
+// the shards. Counters written before sharding (METRIC_<name>) are merged in
+// as well and never written again.
+
+const (
+	// MetricKeyPrefix prefixes the world-state keys of counters written
+	// before sharding
+	MetricKeyPrefix = "METRIC_"
+
+	// MetricShardObjectType keys the shards of a metric
+	MetricShardObjectType = "METRIC_SHARD"
+
+	// AggregateShards is the number of shards of each counter or other
+	// aggregate
+	AggregateShards = 16
+)
+
+// AggregateShard is the shard the transaction txID updates. It is derived
+// from the transaction ID, so every endorser of a transaction picks the
+// same shard and concurrent transactions spread over the shards.
+func AggregateShard(txID string) string {
+	hash := fnv.New32a()
+	hash.Write([]byte(txID))
+	return fmt.Sprintf("%02d", hash.Sum32()%AggregateShards)
+}
+
+// metricShardKey is the key of a metric's shard
+func metricShardKey(name, shard string) (string, error) {
+	key, err := shim.CreateCompositeKey(MetricShardObjectType, []string{name, shard})
+	if err != nil {
+		return "", fmt.Errorf("failed to create key for metric %s: %v", name, err)
+	}
+	return key, nil
+}
+
+// IncrementMetric adds one to a counter as part of the current transaction,
+// for callers not staging their writes in a UnitOfWork
+func IncrementMetric(ctx contractapi.TransactionContextInterface, name string) error {
+	return AddMetric(ctx, name, 1)
+}
+
+// AddMetric adds delta to a counter as part of the current transaction. A
+// transaction does not read its own writes, so outside a UnitOfWork each
+// counter may only be updated once per transaction.
+func AddMetric(ctx contractapi.TransactionContextInterface, name string, delta int64) error {
+	uow := NewUnitOfWork(ctx)
+	if err := uow.AddMetric(name, delta); err != nil {
+		return err
+	}
+	return uow.Commit()
+}
+
+// GetMetrics returns the counters of a chaincode, merging their shards.
+// Every name in names is included, at zero if it was never incremented.
+func GetMetrics(ctx contractapi.TransactionContextInterface, names []string) (map[string]int64, error) {
+	metrics := make(map[string]int64, len(names))
+	for _, name := range names {
+		metrics[name] = 0
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByRange(MetricKeyPrefix, MetricKeyPrefix+"~")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get metrics: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate metrics: %v", err)
+		}
+		value, err := strconv.ParseInt(string(queryResponse.Value), 10, 64)
+		if err != nil {
+			fmt.Printf("Skipping invalid metric %s: %v\n", queryResponse.Key, err)
+			continue
+		}
+		metrics[queryResponse.Key[len(MetricKeyPrefix):]] += value
+	}
+
+	shardIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(MetricShardObjectType, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get metric shards: %v", err)
+	}
+	defer shardIterator.Close()
+
+	for shardIterator.HasNext() {
+		queryResponse, err := shardIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate metric shards: %v", err)
+		}
+		_, attributes, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil || len(attributes) != 2 {
+			fmt.Printf("Skipping invalid metric shard %s\n", queryResponse.Key)
+			continue
+		}
+		value, err := strconv.ParseInt(string(queryResponse.Value), 10, 64)
+		if err != nil {
+			fmt.Printf("Skipping invalid metric shard %s: %v\n", queryResponse.Key, err)
+			continue
+		}
+		metrics[attributes[0]] += value
+	}
+
+	return metrics, nil
+}
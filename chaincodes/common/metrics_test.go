@@ -0,0 +1,53 @@
+package common
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/blockchain-auth/common/commontest"
+)
+
+func TestAggregateShard(t *testing.T) {
+	if AggregateShard("tx1") != AggregateShard("tx1") {
+		t.Error("AggregateShard is not deterministic")
+	}
+	shards := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		shards[AggregateShard(fmt.Sprintf("tx%d", i))] = true
+	}
+	if len(shards) < 2 || len(shards) > AggregateShards {
+		t.Errorf("100 transactions used %d shards, want between 2 and %d", len(shards), AggregateShards)
+	}
+}
+
+func TestGetMetricsMergesShards(t *testing.T) {
+	stub := commontest.NewStub("metrics")
+	if err := stub.PutState(MetricKeyPrefix+"logins", []byte("5")); err != nil {
+		t.Fatal(err)
+	}
+	ctx := commontest.NewContext(stub, &commontest.FakeIdentity{MSPID: "Org1MSP"})
+
+	shards := make(map[string]bool)
+	for i := 0; i < 20; i++ {
+		stub.MockTransactionStart(fmt.Sprintf("tx-%d", i))
+		if err := IncrementMetric(ctx, "logins"); err != nil {
+			t.Fatal(err)
+		}
+		shards[AggregateShard(stub.GetTxID())] = true
+		stub.MockTransactionEnd(fmt.Sprintf("tx-%d", i))
+	}
+	if len(shards) < 2 {
+		t.Fatal("20 transactions all updated the same shard")
+	}
+
+	metrics, err := GetMetrics(ctx, []string{"logins", "logouts"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metrics["logins"] != 25 {
+		t.Errorf("logins = %d, want 25 (5 from before sharding and 20 increments)", metrics["logins"])
+	}
+	if value, ok := metrics["logouts"]; !ok || value != 0 {
+		t.Errorf("logouts = %d, %v, want a zero default", value, ok)
+	}
+}
@@ -0,0 +1,249 @@
+package common
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Tickets the chaincodes encrypt for each other (the TGT for the TGS, the
+// service ticket for the ISV) used to be RSA PKCS#1 v1.5 encrypted, which is
+// open to padding oracle attacks. Each deployment now chooses its padding
+// with SetRSAPadding:
+//
+//	pkcs1v15  encrypt with PKCS#1 v1.5 (the default); accept both paddings
+//	oaep      encrypt with RSA-OAEP (SHA-256); accept PKCS#1 v1.5 only until
+//	          the transition window set with the switch ends
+//
+// A chaincode does not know whether the next one has been upgraded, so the
+// receiving side negotiates: it tries OAEP first and falls back to PKCS#1
+// v1.5 while its configuration allows. Upgrading all three chaincodes before
+// switching any, and switching with a window as long as the longest ticket
+// lifetime, keeps tickets issued before the switch valid.
+//
+// One RSA block holds at most the key size less the padding overhead, which
+// a TGT outgrows as claims are added. Tickets are therefore sealed in a
+// hybrid envelope: the body is AES-256-GCM encrypted under a fresh key, and
+// only that key is RSA encrypted in the deployment's padding. An envelope is
+// longer than the RSA key, so receivers tell it apart from a bare RSA
+// ciphertext, which they still accept from chaincodes not yet upgraded.
+
+// Paddings a deployment can choose with SetRSAPadding
+const (
+	PaddingPKCS1v15 = "pkcs1v15"
+	PaddingOAEP     = "oaep"
+)
+
+const (
+	// paddingConfigKey holds the deployment's PaddingConfig
+	paddingConfigKey = "RSA_PADDING"
+
+	rsaPaddingChangedEvent = "RSAPaddingChanged"
+
+	hybridKeySize = 32
+)
+
+// HybridNonceSize is the length of the AES-GCM nonce in an envelope
+const HybridNonceSize = 12
+
+// Errors a *CryptoError wraps when a ciphertext is refused for its padding
+// or fails to open
+var (
+	ErrLegacyPadding = errors.New("PKCS#1 v1.5 ciphertexts are no longer accepted")
+	ErrEnvelopeAuth  = errors.New("envelope failed authentication")
+)
+
+// PaddingConfig is the RSA padding a deployment encrypts tickets with
+type PaddingConfig struct {
+	Padding string `json:"padding"`
+	// LegacyUntil is when PKCS#1 v1.5 ciphertexts stop being accepted after
+	// a switch to OAEP, in Unix seconds
+	LegacyUntil int64  `json:"legacyUntil,omitempty"`
+	UpdatedBy   string `json:"updatedBy,omitempty"`
+	UpdatedAt   int64  `json:"updatedAt,omitempty"`
+}
+
+// AcceptsLegacy reports whether PKCS#1 v1.5 ciphertexts are accepted at now
+func (c *PaddingConfig) AcceptsLegacy(now time.Time) bool {
+	return c.Padding != PaddingOAEP || now.Unix() < c.LegacyUntil
+}
+
+// GetPaddingConfig returns the stored padding, PKCS#1 v1.5 if none is stored
+func GetPaddingConfig(ctx contractapi.TransactionContextInterface) (*PaddingConfig, error) {
+	configJSON, err := ctx.GetStub().GetState(paddingConfigKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read RSA padding: %v", err)
+	}
+	config := &PaddingConfig{Padding: PaddingPKCS1v15}
+	if configJSON != nil {
+		if err := json.Unmarshal(configJSON, config); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal RSA padding: %v", err)
+		}
+	}
+	return config, nil
+}
+
+// SetPaddingConfig switches the padding of the deployment. On a switch to
+// oaep, PKCS#1 v1.5 ciphertexts are still accepted for transitionSeconds.
+// Callers check that the invoker is an admin.
+func SetPaddingConfig(ctx contractapi.TransactionContextInterface, padding string, transitionSeconds int64) (*PaddingConfig, error) {
+	if padding != PaddingPKCS1v15 && padding != PaddingOAEP {
+		return nil, fmt.Errorf("unknown padding %q (expected %s or %s)", padding, PaddingPKCS1v15, PaddingOAEP)
+	}
+	if transitionSeconds < 0 {
+		return nil, fmt.Errorf("transition window must not be negative")
+	}
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get caller MSP ID: %v", err)
+	}
+	now, err := GetDeterministicTimestamp(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get timestamp: %v", err)
+	}
+
+	config := &PaddingConfig{Padding: padding, UpdatedBy: mspID, UpdatedAt: now.Unix()}
+	if padding == PaddingOAEP {
+		config.LegacyUntil = now.Unix() + transitionSeconds
+	}
+	configJSON, err := json.Marshal(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal RSA padding: %v", err)
+	}
+	if err := ctx.GetStub().PutState(paddingConfigKey, configJSON); err != nil {
+		return nil, fmt.Errorf("failed to store RSA padding: %v", err)
+	}
+	if err := SetEvent(ctx, rsaPaddingChangedEvent, configJSON); err != nil {
+		return nil, fmt.Errorf("failed to emit RSA padding event: %v", err)
+	}
+
+	fmt.Printf("RSA padding set to %s by %s\n", padding, mspID)
+	return config, nil
+}
+
+// EncryptForService seals a ticket for another chaincode in a hybrid
+// envelope whose key is encrypted in the deployment's padding
+func EncryptForService(ctx contractapi.TransactionContextInterface, publicKey *rsa.PublicKey, plaintext []byte) ([]byte, error) {
+	config, err := GetPaddingConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return EncryptEnvelope(config.Padding, publicKey, plaintext)
+}
+
+// encryptWithPadding encrypts plaintext in one RSA block in the given padding
+func encryptWithPadding(padding string, publicKey *rsa.PublicKey, plaintext []byte) ([]byte, error) {
+	if padding != PaddingOAEP {
+		return rsa.EncryptPKCS1v15(rand.Reader, publicKey, plaintext)
+	}
+	return rsa.EncryptOAEP(sha256.New(), rand.Reader, publicKey, plaintext, nil)
+}
+
+// DecryptNegotiated decrypts a ciphertext in whichever padding it was made
+// with, as far as the deployment's configuration accepts it
+func DecryptNegotiated(ctx contractapi.TransactionContextInterface, op string, privateKey *rsa.PrivateKey, ciphertext []byte) ([]byte, error) {
+	config, err := GetPaddingConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now, err := GetDeterministicTimestamp(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get timestamp: %v", err)
+	}
+	return DecryptWithPadding(op, privateKey, ciphertext, config.AcceptsLegacy(now))
+}
+
+// DecryptWithPadding opens a hybrid envelope or decrypts a bare RSA
+// ciphertext. The RSA part is tried with OAEP, then with PKCS#1 v1.5 if
+// acceptLegacy is set. Errors are *CryptoError naming op.
+func DecryptWithPadding(op string, privateKey *rsa.PrivateKey, ciphertext []byte, acceptLegacy bool) ([]byte, error) {
+	if privateKey != nil && privateKey.N != nil && len(ciphertext) > privateKey.Size() {
+		return decryptEnvelope(op, privateKey, ciphertext, acceptLegacy)
+	}
+	return decryptRSA(op, privateKey, ciphertext, acceptLegacy)
+}
+
+// decryptRSA decrypts one RSA block, trying OAEP first
+func decryptRSA(op string, privateKey *rsa.PrivateKey, ciphertext []byte, acceptLegacy bool) ([]byte, error) {
+	plaintext, err := SafeDecryptOAEP(op, privateKey, ciphertext)
+	if err == nil || !errors.Is(err, rsa.ErrDecryption) {
+		return plaintext, err
+	}
+	if !acceptLegacy {
+		return nil, &CryptoError{Op: op, Err: ErrLegacyPadding}
+	}
+	return SafeDecrypt(op, privateKey, ciphertext)
+}
+
+// EncryptHybrid seals plaintext in an envelope whose key is RSA-OAEP
+// encrypted, as clients negotiating rsa-oaep-aes256gcm expect
+func EncryptHybrid(publicKey *rsa.PublicKey, plaintext []byte) ([]byte, error) {
+	return EncryptEnvelope(PaddingOAEP, publicKey, plaintext)
+}
+
+// EncryptEnvelope seals plaintext with a fresh AES-256-GCM key and encrypts
+// the key in the given padding. The envelope is the encrypted key, the nonce
+// and the sealed plaintext.
+func EncryptEnvelope(padding string, publicKey *rsa.PublicKey, plaintext []byte) ([]byte, error) {
+	key := make([]byte, hybridKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate envelope key: %v", err)
+	}
+	wrappedKey, err := encryptWithPadding(padding, publicKey, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt envelope key: %v", err)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, HybridNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate envelope nonce: %v", err)
+	}
+
+	envelope := append(wrappedKey, nonce...)
+	return gcm.Seal(envelope, nonce, plaintext, nil), nil
+}
+
+// decryptEnvelope opens an envelope made by EncryptEnvelope
+func decryptEnvelope(op string, privateKey *rsa.PrivateKey, envelope []byte, acceptLegacy bool) ([]byte, error) {
+	keySize := privateKey.Size()
+	if len(envelope) < keySize+HybridNonceSize {
+		return nil, &CryptoError{Op: op, Err: ErrCiphertextLength}
+	}
+	key, err := decryptRSA(op, privateKey, envelope[:keySize], acceptLegacy)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != hybridKeySize {
+		return nil, &CryptoError{Op: op, Err: ErrEnvelopeAuth}
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, &CryptoError{Op: op, Err: err}
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, &CryptoError{Op: op, Err: err}
+	}
+	plaintext, err := gcm.Open(nil, envelope[keySize:keySize+HybridNonceSize], envelope[keySize+HybridNonceSize:], nil)
+	if err != nil {
+		return nil, &CryptoError{Op: op, Err: ErrEnvelopeAuth}
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,100 @@
+package common
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDecryptWithPadding(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	short := []byte(`{"clientID":"client1","lifetime":3600}`)
+	long := bytes.Repeat([]byte("x"), 300)
+
+	tests := []struct {
+		name         string
+		padding      string
+		envelope     bool
+		plaintext    []byte
+		acceptLegacy bool
+		wantErr      error
+	}{
+		{"oaep", PaddingOAEP, false, short, false, nil},
+		{"oaep with legacy accepted", PaddingOAEP, false, short, true, nil},
+		{"legacy accepted", PaddingPKCS1v15, false, short, true, nil},
+		{"legacy refused", PaddingPKCS1v15, false, short, false, ErrLegacyPadding},
+		{"oaep envelope", PaddingOAEP, true, short, false, nil},
+		{"long oaep envelope", PaddingOAEP, true, long, false, nil},
+		{"legacy envelope accepted", PaddingPKCS1v15, true, long, true, nil},
+		{"legacy envelope refused", PaddingPKCS1v15, true, long, false, ErrLegacyPadding},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			encrypt := encryptWithPadding
+			if test.envelope {
+				encrypt = EncryptEnvelope
+			}
+			ciphertext, err := encrypt(test.padding, &key.PublicKey, test.plaintext)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.envelope && len(ciphertext) <= key.Size() {
+				t.Fatalf("envelope is %d bytes, not longer than the key", len(ciphertext))
+			}
+			plaintext, err := DecryptWithPadding("ticket decryption", key, ciphertext, test.acceptLegacy)
+			if test.wantErr != nil {
+				if !errors.Is(err, test.wantErr) {
+					t.Fatalf("DecryptWithPadding() error = %v, want %v", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil || !bytes.Equal(plaintext, test.plaintext) {
+				t.Fatalf("DecryptWithPadding() = %q, %v", plaintext, err)
+			}
+		})
+	}
+
+	if _, err := encryptWithPadding(PaddingOAEP, &key.PublicKey, long); err == nil {
+		t.Error("encryptWithPadding() of more than one OAEP block succeeded")
+	}
+
+	envelope, err := EncryptEnvelope(PaddingOAEP, &key.PublicKey, long)
+	if err != nil {
+		t.Fatal(err)
+	}
+	envelope[len(envelope)-1] ^= 0xff
+	if _, err := DecryptWithPadding("ticket decryption", key, envelope, true); !errors.Is(err, ErrEnvelopeAuth) {
+		t.Errorf("tampered envelope error = %v, want %v", err, ErrEnvelopeAuth)
+	}
+	if _, err := DecryptWithPadding("ticket decryption", key, envelope[:key.Size()+4], true); !errors.Is(err, ErrCiphertextLength) {
+		t.Errorf("truncated envelope error = %v, want %v", err, ErrCiphertextLength)
+	}
+}
+
+func TestPaddingConfigAcceptsLegacy(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	tests := []struct {
+		name   string
+		config PaddingConfig
+		want   bool
+	}{
+		{"pkcs1v15", PaddingConfig{Padding: PaddingPKCS1v15}, true},
+		{"unset", PaddingConfig{}, true},
+		{"oaep in transition", PaddingConfig{Padding: PaddingOAEP, LegacyUntil: now.Unix() + 1}, true},
+		{"oaep after transition", PaddingConfig{Padding: PaddingOAEP, LegacyUntil: now.Unix()}, false},
+		{"oaep without transition", PaddingConfig{Padding: PaddingOAEP}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.config.AcceptsLegacy(now); got != test.want {
+				t.Errorf("AcceptsLegacy() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
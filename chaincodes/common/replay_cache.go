@@ -0,0 +1,131 @@
+package common
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Fabric refuses a transaction ID it has seen before, but not the same
+// credential submitted in a new transaction. The replay cache makes a
+// credential single-use: the first transaction to present one records its
+// SHA-256 digest under REPLAY_<kind>_<digest> with the time the credential
+// expires, and any later transaction presenting it before then is refused.
+// The AS consumes challenge nonces and renewal authenticators, the TGS
+// authenticators, and the ISV authenticators or service tickets. An entry
+// is only needed until the credential would be refused anyway, so expired
+// entries are ignored and PurgeReplayCache, which any member may submit,
+// deletes them.
+
+// Kinds of credential the replay cache records
+const (
+	ReplayKindNonce         = "nonce"
+	ReplayKindAuthenticator = "authenticator"
+	ReplayKindServiceTicket = "ticket"
+)
+
+const (
+	// replayKeyPrefix prefixes the replay cache entries
+	replayKeyPrefix = "REPLAY_"
+
+	// maxReplayPurge bounds the entries one PurgeReplayCache call deletes
+	maxReplayPurge = 500
+)
+
+// ReplayEntry records the use of a single-use credential
+type ReplayEntry struct {
+	Kind      string    `json:"kind"`
+	ExpiresAt time.Time `json:"expiresAt"` // The credential is refused from then on regardless
+	TxID      string    `json:"txID"`      // Transaction that used it
+}
+
+// ReplayPurgeResult reports a PurgeReplayCache call
+type ReplayPurgeResult struct {
+	Purged int  `json:"purged"`
+	More   bool `json:"more"` // The limit was reached; submit again to purge the rest
+}
+
+// replayKey is the replay cache key of a credential
+func replayKey(kind, value string) string {
+	digest := sha256.Sum256([]byte(value))
+	return replayKeyPrefix + kind + "_" + hex.EncodeToString(digest[:])
+}
+
+// expired reports whether the entry can be ignored at now
+func (e *ReplayEntry) expired(now time.Time) bool {
+	return now.After(e.ExpiresAt)
+}
+
+// ConsumeOnce records the use of a credential valid until expiresAt, or
+// returns an error if an earlier transaction used it
+func ConsumeOnce(store StateStore, kind, value string, expiresAt, now time.Time, txID string) error {
+	key := replayKey(kind, value)
+	entryJSON, err := store.GetState(key)
+	if err != nil {
+		return fmt.Errorf("failed to read replay cache: %v", err)
+	}
+	if entryJSON != nil {
+		var entry ReplayEntry
+		if err := json.Unmarshal(entryJSON, &entry); err != nil {
+			return fmt.Errorf("failed to unmarshal replay cache entry: %v", err)
+		}
+		if !entry.expired(now) {
+			return fmt.Errorf("%s has already been used", kind)
+		}
+	}
+
+	entryJSON, err = json.Marshal(ReplayEntry{Kind: kind, ExpiresAt: expiresAt, TxID: txID})
+	if err != nil {
+		return fmt.Errorf("failed to marshal replay cache entry: %v", err)
+	}
+	if err := store.PutState(key, entryJSON); err != nil {
+		return fmt.Errorf("failed to update replay cache: %v", err)
+	}
+	return nil
+}
+
+// PurgeReplayCache deletes up to maxReplayPurge expired replay cache
+// entries
+func PurgeReplayCache(ctx contractapi.TransactionContextInterface) (*ReplayPurgeResult, error) {
+	now, err := GetDeterministicTimestamp(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get timestamp: %v", err)
+	}
+
+	iterator, err := ctx.GetStub().GetStateByRange(replayKeyPrefix, replayKeyPrefix+"~")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get replay cache entries: %v", err)
+	}
+	defer iterator.Close()
+
+	result := &ReplayPurgeResult{}
+	for iterator.HasNext() {
+		if result.Purged == maxReplayPurge {
+			result.More = true
+			break
+		}
+		queryResponse, err := iterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate replay cache entries: %v", err)
+		}
+		var entry ReplayEntry
+		if err := json.Unmarshal(queryResponse.Value, &entry); err != nil {
+			fmt.Printf("Error unmarshaling replay cache entry %s: %v\n", queryResponse.Key, err)
+			continue
+		}
+		if !entry.expired(now) {
+			continue
+		}
+		if err := ctx.GetStub().DelState(queryResponse.Key); err != nil {
+			return nil, fmt.Errorf("failed to delete replay cache entry: %v", err)
+		}
+		result.Purged++
+	}
+
+	fmt.Printf("Purged %d replay cache entries\n", result.Purged)
+	return result, nil
+}
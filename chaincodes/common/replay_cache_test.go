@@ -0,0 +1,91 @@
+package common
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blockchain-auth/common/commontest"
+)
+
+func TestReplayKey(t *testing.T) {
+	key := replayKey(ReplayKindNonce, "abc")
+	if !strings.HasPrefix(key, replayKeyPrefix+ReplayKindNonce+"_") {
+		t.Errorf("replayKey() = %s, want the nonce prefix", key)
+	}
+	if strings.Contains(key, "abc") {
+		t.Errorf("replayKey() = %s contains the credential", key)
+	}
+	if key != replayKey(ReplayKindNonce, "abc") {
+		t.Error("replayKey() is not deterministic")
+	}
+	if key == replayKey(ReplayKindNonce, "abd") || key == replayKey(ReplayKindAuthenticator, "abc") {
+		t.Error("replayKey() collides across values or kinds")
+	}
+}
+
+func TestConsumeOnce(t *testing.T) {
+	store := commontest.NewMemoryStore(nil)
+	now := time.Unix(1700000000, 0)
+	expiresAt := now.Add(time.Minute)
+
+	if err := ConsumeOnce(store, ReplayKindAuthenticator, "a1", expiresAt, now, "tx1"); err != nil {
+		t.Fatalf("first use: %v", err)
+	}
+	if err := ConsumeOnce(store, ReplayKindAuthenticator, "a1", expiresAt, now.Add(time.Second), "tx2"); err == nil {
+		t.Error("reuse was accepted")
+	}
+	if err := ConsumeOnce(store, ReplayKindServiceTicket, "a1", expiresAt, now, "tx3"); err != nil {
+		t.Errorf("same value of another kind: %v", err)
+	}
+	if err := ConsumeOnce(store, ReplayKindAuthenticator, "a2", expiresAt, now, "tx4"); err != nil {
+		t.Errorf("another value: %v", err)
+	}
+	// Once the entry has expired the credential is refused elsewhere, and
+	// the entry no longer counts
+	later := expiresAt.Add(time.Second)
+	if err := ConsumeOnce(store, ReplayKindAuthenticator, "a1", later.Add(time.Minute), later, "tx5"); err != nil {
+		t.Errorf("use after expiry: %v", err)
+	}
+}
+
+func TestReplayEntryExpired(t *testing.T) {
+	expiresAt := time.Unix(1700000000, 0)
+	entry := ReplayEntry{ExpiresAt: expiresAt}
+	if entry.expired(expiresAt) {
+		t.Error("entry expired at its expiry time")
+	}
+	if !entry.expired(expiresAt.Add(time.Second)) {
+		t.Error("entry not expired after its expiry time")
+	}
+}
+
+func TestPurgeReplayCache(t *testing.T) {
+	stub := commontest.NewStub("replay")
+	ctx := commontest.NewContext(stub, &commontest.FakeIdentity{MSPID: "Org2MSP"})
+	now, err := GetDeterministicTimestamp(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ConsumeOnce(stub, ReplayKindNonce, "old", now.Add(-time.Minute), now.Add(-2*time.Minute), "tx0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ConsumeOnce(stub, ReplayKindNonce, "live", now.Add(time.Minute), now, "tx1"); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := PurgeReplayCache(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Purged != 1 || result.More {
+		t.Errorf("PurgeReplayCache() = %+v, want the one expired entry purged", result)
+	}
+	if value, _ := stub.GetState(replayKey(ReplayKindNonce, "old")); value != nil {
+		t.Error("expired entry was kept")
+	}
+	if err := ConsumeOnce(stub, ReplayKindNonce, "live", now.Add(time.Minute), now, "tx2"); err == nil {
+		t.Error("live entry was purged")
+	}
+}
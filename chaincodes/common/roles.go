@@ -0,0 +1,106 @@
+package common
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A caller's role comes from the "role" attribute of its enrollment
+// certificate, issued by the CA:
+//
+//	fabric-ca-client register --id.name audit1 --id.attrs 'role=auditor:ecert'
+//	fabric-ca-client register --id.name ops1 --id.attrs '"role=device-admin,policy-admin:ecert"'
+//
+// Callers without the attribute are unrestricted, as before roles existed.
+// Auditors may only call the read-only functions each chaincode lists in
+// auditorFunctions: audit trails, histories, metrics and other queries.
+// The admin roles may call those too, plus the functions of their scope:
+//
+//	user-admin    clients, their registrations, grants and step-ups
+//	device-admin  device records, configuration and maintenance
+//	policy-admin  risk, terms, session and payload policies
+//
+// The attribute may name several roles, comma-separated. "admin", the role
+// of undivided admins, stands for every admin role. The lists are allow
+// lists so that a new entry point is closed to restricted roles until it is
+// added.
+//
+// The entry points each chaincode lists in adminFunctions (initialization,
+// key and policy changes, client registration) are open only to callers of
+// the admin MSPs, and of those only to callers without a role or whose role
+// permits them (see CheckAdminCaller in admin.go). A role never opens an
+// admin function to a caller of another organization.
+
+// RoleAttribute is the certificate attribute holding the caller's role
+const RoleAttribute = "role"
+
+const (
+	// RoleAuditor is the role of read-only auditors
+	RoleAuditor     = "auditor"
+	RoleUserAdmin   = "user-admin"
+	RoleDeviceAdmin = "device-admin"
+	RolePolicyAdmin = "policy-admin"
+	// RoleAdmin is the undivided admin role, which holds every admin role
+	RoleAdmin = "admin"
+)
+
+// adminRoles are the roles RoleAdmin stands for
+var adminRoles = []string{RoleUserAdmin, RoleDeviceAdmin, RolePolicyAdmin}
+
+// AttributeSource is the part of a client identity CheckCallerRole reads
+type AttributeSource interface {
+	GetAttributeValue(attrName string) (string, bool, error)
+}
+
+// CallerIdentity is the part of a client identity CheckAdminCaller reads
+type CallerIdentity interface {
+	AttributeSource
+	GetMSPID() (string, error)
+}
+
+// callerRoles splits a role attribute value into roles, expanding RoleAdmin
+func callerRoles(value string) []string {
+	var roles []string
+	for _, role := range strings.Split(value, ",") {
+		role = strings.TrimSpace(role)
+		switch role {
+		case "":
+		case RoleAdmin:
+			roles = append(roles, adminRoles...)
+		default:
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+// CheckCallerRole rejects a call to function the caller's roles do not
+// permit. functions lists the functions open to each role; every role may
+// also call those of RoleAuditor.
+func CheckCallerRole(identity AttributeSource, function string, functions map[string]map[string]bool) error {
+	value, found, err := identity.GetAttributeValue(RoleAttribute)
+	if err != nil {
+		return fmt.Errorf("failed to read caller role: %v", err)
+	}
+	roles := callerRoles(value)
+	if !found || len(roles) == 0 {
+		return nil
+	}
+
+	permitted := false
+	for _, role := range roles {
+		allowed, known := functions[role]
+		if !known {
+			// An attribute value this chaincode does not know must not grant
+			// more than the most restricted role
+			return fmt.Errorf("%s: unknown caller role %q", function, role)
+		}
+		if allowed[function] || functions[RoleAuditor][function] {
+			permitted = true
+		}
+	}
+	if !permitted {
+		return fmt.Errorf("%s: not permitted for role %s", function, strings.Join(roles, ","))
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package common
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/blockchain-auth/common/commontest"
+)
+
+func TestCheckCallerRole(t *testing.T) {
+	functions := map[string]map[string]bool{
+		RoleAuditor:     {"GetMetrics": true},
+		RoleUserAdmin:   {"RegisterUser": true},
+		RoleDeviceAdmin: {"RegisterDevice": true},
+		RolePolicyAdmin: {},
+	}
+	auditor := commontest.WithRole(RoleAuditor)
+
+	if err := CheckCallerRole(&commontest.FakeIdentity{}, "Register", functions); err != nil {
+		t.Errorf("caller without a role was refused: %v", err)
+	}
+	if err := CheckCallerRole(auditor, "GetMetrics", functions); err != nil {
+		t.Errorf("auditor was refused a listed function: %v", err)
+	}
+	if err := CheckCallerRole(auditor, "Register", functions); err == nil {
+		t.Error("auditor was allowed an unlisted function")
+	}
+
+	unknown := commontest.WithRole("superuser")
+	if err := CheckCallerRole(unknown, "GetMetrics", functions); err == nil {
+		t.Error("unknown role was allowed")
+	}
+
+	failing := &commontest.FakeIdentity{Err: errors.New("bad certificate")}
+	if err := CheckCallerRole(failing, "GetMetrics", functions); err == nil {
+		t.Error("attribute read error was ignored")
+	}
+}
+
+func TestCheckCallerRoleScopes(t *testing.T) {
+	functions := map[string]map[string]bool{
+		RoleAuditor:     {"GetMetrics": true},
+		RoleUserAdmin:   {"RegisterUser": true},
+		RoleDeviceAdmin: {"RegisterDevice": true},
+		RolePolicyAdmin: {"SetPolicy": true},
+	}
+
+	tests := []struct {
+		role     string
+		function string
+		allowed  bool
+	}{
+		{RoleUserAdmin, "RegisterUser", true},
+		{RoleUserAdmin, "GetMetrics", true},
+		{RoleUserAdmin, "RegisterDevice", false},
+		{RoleDeviceAdmin, "RegisterDevice", true},
+		{RoleDeviceAdmin, "SetPolicy", false},
+		{RolePolicyAdmin, "SetPolicy", true},
+		{"user-admin, device-admin", "RegisterDevice", true},
+		{"user-admin,device-admin", "SetPolicy", false},
+		{RoleAdmin, "RegisterUser", true},
+		{RoleAdmin, "SetPolicy", true},
+		{RoleAdmin, "Unlisted", false},
+		{"device-admin,superuser", "RegisterDevice", false},
+	}
+	for _, test := range tests {
+		err := CheckCallerRole(commontest.WithRole(test.role), test.function, functions)
+		if (err == nil) != test.allowed {
+			t.Errorf("role %q calling %s: error = %v, want allowed %v", test.role, test.function, err, test.allowed)
+		}
+	}
+}
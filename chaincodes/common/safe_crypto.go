@@ -0,0 +1,110 @@
+package common
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// CryptoError is returned by SafeDecrypt and SafeVerify. Panicked is set when
+// the operation panicked rather than failing normally, which points at a
+// broken key rather than bad input.
+type CryptoError struct {
+	Op       string
+	Err      error
+	Panicked bool
+}
+
+func (e *CryptoError) Error() string {
+	if e.Panicked {
+		return fmt.Sprintf("%s failed: panic: %v", e.Op, e.Err)
+	}
+	return fmt.Sprintf("%s failed: %v", e.Op, e.Err)
+}
+
+func (e *CryptoError) Unwrap() error {
+	return e.Err
+}
+
+// The underlying operations, replaced in tests to exercise panic recovery
+var (
+	rsaDecrypt     = rsa.DecryptPKCS1v15
+	rsaDecryptOAEP = func(random io.Reader, privateKey *rsa.PrivateKey, ciphertext []byte) ([]byte, error) {
+		return rsa.DecryptOAEP(sha256.New(), random, privateKey, ciphertext, nil)
+	}
+	rsaVerify = rsa.VerifyPKCS1v15
+)
+
+// Errors a *CryptoError wraps for input that cannot be a valid ciphertext or
+// signature
+var (
+	ErrMissingKey       = errors.New("no key")
+	ErrEmptyCiphertext  = errors.New("empty ciphertext")
+	ErrCiphertextLength = errors.New("ciphertext length does not match the key size")
+	ErrEmptySignature   = errors.New("empty signature")
+	ErrSignatureLength  = errors.New("signature length does not match the key size")
+)
+
+// SafeDecrypt decrypts an RSA PKCS#1 v1.5 ciphertext. Malformed input and
+// panics inside the crypto library both come back as a *CryptoError naming op.
+func SafeDecrypt(op string, privateKey *rsa.PrivateKey, ciphertext []byte) ([]byte, error) {
+	return safeDecryptWith(op, privateKey, ciphertext, rsaDecrypt)
+}
+
+// SafeDecryptOAEP is SafeDecrypt for an RSA-OAEP (SHA-256) ciphertext
+func SafeDecryptOAEP(op string, privateKey *rsa.PrivateKey, ciphertext []byte) ([]byte, error) {
+	return safeDecryptWith(op, privateKey, ciphertext, rsaDecryptOAEP)
+}
+
+func safeDecryptWith(op string, privateKey *rsa.PrivateKey, ciphertext []byte, decrypt func(io.Reader, *rsa.PrivateKey, []byte) ([]byte, error)) (plaintext []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			plaintext = nil
+			err = &CryptoError{Op: op, Err: fmt.Errorf("%v", r), Panicked: true}
+		}
+	}()
+
+	switch {
+	case privateKey == nil || privateKey.N == nil:
+		return nil, &CryptoError{Op: op, Err: ErrMissingKey}
+	case len(ciphertext) == 0:
+		return nil, &CryptoError{Op: op, Err: ErrEmptyCiphertext}
+	case len(ciphertext) != privateKey.Size():
+		return nil, &CryptoError{Op: op, Err: ErrCiphertextLength}
+	}
+
+	plaintext, err = decrypt(rand.Reader, privateKey, ciphertext)
+	if err != nil {
+		return nil, &CryptoError{Op: op, Err: err}
+	}
+	return plaintext, nil
+}
+
+// SafeVerify checks an RSASSA-PKCS1-v1_5 signature over a SHA-256 digest.
+// A bad signature and a panic inside the crypto library both come back as a
+// *CryptoError naming op.
+func SafeVerify(op string, publicKey *rsa.PublicKey, hashed []byte, signature []byte) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &CryptoError{Op: op, Err: fmt.Errorf("%v", r), Panicked: true}
+		}
+	}()
+
+	switch {
+	case publicKey == nil || publicKey.N == nil:
+		return &CryptoError{Op: op, Err: ErrMissingKey}
+	case len(signature) == 0:
+		return &CryptoError{Op: op, Err: ErrEmptySignature}
+	case len(signature) != publicKey.Size():
+		return &CryptoError{Op: op, Err: ErrSignatureLength}
+	}
+
+	if err := rsaVerify(publicKey, crypto.SHA256, hashed, signature); err != nil {
+		return &CryptoError{Op: op, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package common
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestSafeDecrypt(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext, err := rsa.EncryptPKCS1v15(rand.Reader, &key.PublicKey, []byte("ticket"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext, err := SafeDecrypt("ticket decryption", key, ciphertext)
+	if err != nil || string(plaintext) != "ticket" {
+		t.Fatalf("SafeDecrypt() = %q, %v", plaintext, err)
+	}
+
+	corrupted := append([]byte{}, ciphertext...)
+	corrupted[len(corrupted)/2] ^= 0xff
+
+	tests := []struct {
+		name       string
+		key        *rsa.PrivateKey
+		ciphertext []byte
+		wantErr    error
+		panicked   bool
+	}{
+		{"empty", key, nil, ErrEmptyCiphertext, false},
+		{"truncated", key, ciphertext[:100], ErrCiphertextLength, false},
+		{"too long", key, append(ciphertext, 0), ErrCiphertextLength, false},
+		{"corrupted", key, corrupted, rsa.ErrDecryption, false},
+		{"garbage", key, make([]byte, key.Size()), rsa.ErrDecryption, false},
+		{"no key", nil, ciphertext, ErrMissingKey, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			plaintext, err := SafeDecrypt("ticket decryption", test.key, test.ciphertext)
+			if plaintext != nil {
+				t.Errorf("plaintext = %q, want nil", plaintext)
+			}
+			var cryptoErr *CryptoError
+			if !errors.As(err, &cryptoErr) {
+				t.Fatalf("error = %v, want *CryptoError", err)
+			}
+			if cryptoErr.Op != "ticket decryption" || cryptoErr.Panicked != test.panicked {
+				t.Errorf("error = %+v", cryptoErr)
+			}
+			if test.wantErr != nil && !errors.Is(err, test.wantErr) {
+				t.Errorf("error = %v, want %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestSafeCryptoRecoversPanics(t *testing.T) {
+	decrypt, verify := rsaDecrypt, rsaVerify
+	defer func() { rsaDecrypt, rsaVerify = decrypt, verify }()
+	rsaDecrypt = func(io.Reader, *rsa.PrivateKey, []byte) ([]byte, error) { panic("index out of range") }
+	rsaVerify = func(*rsa.PublicKey, crypto.Hash, []byte, []byte) error { panic("index out of range") }
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext, err := SafeDecrypt("TGT decryption", key, make([]byte, key.Size()))
+	var cryptoErr *CryptoError
+	if plaintext != nil || !errors.As(err, &cryptoErr) || !cryptoErr.Panicked || cryptoErr.Op != "TGT decryption" {
+		t.Errorf("SafeDecrypt() = %q, %v; want panic reported as *CryptoError", plaintext, err)
+	}
+
+	hashed := sha256.Sum256([]byte("nonce"))
+	err = SafeVerify("signature verification", &key.PublicKey, hashed[:], make([]byte, key.Size()))
+	if !errors.As(err, &cryptoErr) || !cryptoErr.Panicked {
+		t.Errorf("SafeVerify() = %v; want panic reported as *CryptoError", err)
+	}
+}
+
+func TestSafeVerify(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashed := sha256.Sum256([]byte("nonce"))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hashed[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SafeVerify("signature verification", &key.PublicKey, hashed[:], signature); err != nil {
+		t.Fatalf("SafeVerify() = %v", err)
+	}
+
+	otherHash := sha256.Sum256([]byte("other nonce"))
+	tests := []struct {
+		name      string
+		key       *rsa.PublicKey
+		hashed    []byte
+		signature []byte
+		wantErr   error
+	}{
+		{"empty", &key.PublicKey, hashed[:], nil, ErrEmptySignature},
+		{"truncated", &key.PublicKey, hashed[:], signature[:10], ErrSignatureLength},
+		{"wrong message", &key.PublicKey, otherHash[:], signature, rsa.ErrVerification},
+		{"no key", nil, hashed[:], signature, ErrMissingKey},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := SafeVerify("signature verification", test.key, test.hashed, test.signature)
+			var cryptoErr *CryptoError
+			if !errors.As(err, &cryptoErr) || cryptoErr.Panicked {
+				t.Fatalf("error = %v, want non-panic *CryptoError", err)
+			}
+			if !errors.Is(err, test.wantErr) {
+				t.Errorf("error = %v, want %v", err, test.wantErr)
+			}
+		})
+	}
+}
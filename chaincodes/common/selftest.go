@@ -0,0 +1,243 @@
+package common
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// SelfTest checks, after a deployment or a key rollover, that a chaincode
+// can use its key material: its private key loads and belongs to its public
+// key and to the key it published, it signs and verifies, it opens an
+// envelope sealed for itself, and each service it encrypts tickets for can
+// open an envelope sealed with the key imported for it. The last check asks
+// the other chaincode, through VerifySelfTestProbe, to open a fixed probe.
+//
+// SelfTest writes nothing and its report holds no key or ciphertext, so it
+// is evaluated, not submitted. It reports a failure on a peer that is not a
+// member of the collection holding the private key.
+
+// Self-test check outcomes
+const (
+	selfTestPass = "pass"
+	selfTestFail = "fail"
+	selfTestSkip = "skip"
+)
+
+// SelfTestCheck is the outcome of one self-test check
+type SelfTestCheck struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// SelfTestReport is the result of SelfTest
+type SelfTestReport struct {
+	Service     string          `json:"service"`
+	Passed      bool            `json:"passed"`                // No check failed
+	Fingerprint string          `json:"fingerprint,omitempty"` // Of the service's own public key
+	Padding     string          `json:"padding"`
+	Checks      []SelfTestCheck `json:"checks"`
+}
+
+// SelfTestCounterpart is a service the chaincode encrypts tickets for, and
+// the name its imported public key is kept under
+type SelfTestCounterpart struct {
+	Service string
+	KeyName string
+}
+
+// selfTestProbe is the plaintext of the probe the service from seals for
+// another one
+func selfTestProbe(from string) []byte {
+	return []byte("SELFTEST|" + from)
+}
+
+func newSelfTestReport(service, padding string) *SelfTestReport {
+	return &SelfTestReport{Service: service, Passed: true, Padding: padding, Checks: []SelfTestCheck{}}
+}
+
+// check records a check that passed if err is nil, and failed otherwise
+func (r *SelfTestReport) check(name string, err error) {
+	if err != nil {
+		r.Passed = false
+		r.Checks = append(r.Checks, SelfTestCheck{Name: name, Status: selfTestFail, Detail: err.Error()})
+		return
+	}
+	r.Checks = append(r.Checks, SelfTestCheck{Name: name, Status: selfTestPass})
+}
+
+// skip records a check that could not run
+func (r *SelfTestReport) skip(name, detail string) {
+	r.Checks = append(r.Checks, SelfTestCheck{Name: name, Status: selfTestSkip, Detail: detail})
+}
+
+// RunSelfTest runs the self-test of service, whose key pair is kept under
+// privateKeyName and publicKeyName
+func RunSelfTest(ctx contractapi.TransactionContextInterface, service, privateKeyName, publicKeyName string, counterparts ...SelfTestCounterpart) (*SelfTestReport, error) {
+	config, err := GetPaddingConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now, err := GetDeterministicTimestamp(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get timestamp: %v", err)
+	}
+	report := newSelfTestReport(service, config.Padding)
+
+	privateKey, err := loadSelfTestPrivateKey(ctx, privateKeyName)
+	report.check("private_key", err)
+	publicKey, err := loadSelfTestPublicKey(ctx, publicKeyName)
+	report.check("public_key", err)
+	if publicKey != nil {
+		report.Fingerprint, _ = PublicKeyFingerprint(publicKey)
+	}
+
+	if privateKey != nil && publicKey != nil {
+		report.check("key_pair", checkKeyPair(privateKey, publicKey))
+		report.check("sign_verify", checkSignVerify(service, privateKey, publicKey))
+		report.check("encrypt_decrypt", checkRoundTrip(service, config.Padding, config.AcceptsLegacy(now), privateKey, publicKey))
+	} else {
+		for _, name := range []string{"key_pair", "sign_verify", "encrypt_decrypt"} {
+			report.skip(name, "the key pair did not load")
+		}
+	}
+	if publicKey != nil {
+		report.check("published_key", checkPublishedKey(ctx, report.Fingerprint))
+	} else {
+		report.skip("published_key", "the public key did not load")
+	}
+
+	for _, counterpart := range counterparts {
+		prefix := strings.ToLower(counterpart.Service)
+		key, err := loadSelfTestPublicKey(ctx, counterpart.KeyName)
+		report.check(prefix+"_key", err)
+		if key == nil {
+			report.skip(prefix+"_round_trip", "the imported key did not load")
+			continue
+		}
+		report.check(prefix+"_round_trip", checkCounterpartRoundTrip(ctx, service, counterpart.Service, config.Padding, key))
+	}
+	return report, nil
+}
+
+// loadSelfTestPrivateKey reads and parses the private key
+func loadSelfTestPrivateKey(ctx contractapi.TransactionContextInterface, privateKeyName string) (*rsa.PrivateKey, error) {
+	privateKeyPEM, err := ReadServicePrivateKey(ctx, privateKeyName)
+	if err != nil {
+		return nil, err
+	}
+	if privateKeyPEM == nil {
+		return nil, fmt.Errorf("%s not found", privateKeyName)
+	}
+	return ParsePrivateKeyPEM(privateKeyPEM)
+}
+
+// loadSelfTestPublicKey reads and parses a public key from world state
+func loadSelfTestPublicKey(ctx contractapi.TransactionContextInterface, keyName string) (*rsa.PublicKey, error) {
+	publicKeyPEM, err := ctx.GetStub().GetState(keyName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", keyName, err)
+	}
+	if publicKeyPEM == nil {
+		return nil, fmt.Errorf("%s not found", keyName)
+	}
+	return ParsePublicKeyPEM(keyName, publicKeyPEM)
+}
+
+// checkKeyPair checks the public key belongs to the private key
+func checkKeyPair(privateKey *rsa.PrivateKey, publicKey *rsa.PublicKey) error {
+	if err := privateKey.Validate(); err != nil {
+		return fmt.Errorf("invalid private key: %v", err)
+	}
+	if !privateKey.PublicKey.Equal(publicKey) {
+		return fmt.Errorf("the public key does not belong to the private key")
+	}
+	return nil
+}
+
+// checkSignVerify signs the probe and verifies the signature
+func checkSignVerify(service string, privateKey *rsa.PrivateKey, publicKey *rsa.PublicKey) error {
+	hashed := sha256.Sum256(selfTestProbe(service))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, privateKey, crypto.SHA256, hashed[:])
+	if err != nil {
+		return fmt.Errorf("failed to sign: %v", err)
+	}
+	return SafeVerify("self-test", publicKey, hashed[:], signature)
+}
+
+// checkRoundTrip seals the probe for the service itself and opens it
+func checkRoundTrip(service, padding string, acceptLegacy bool, privateKey *rsa.PrivateKey, publicKey *rsa.PublicKey) error {
+	envelope, err := EncryptEnvelope(padding, publicKey, selfTestProbe(service))
+	if err != nil {
+		return err
+	}
+	plaintext, err := DecryptWithPadding("self-test", privateKey, envelope, acceptLegacy)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(plaintext, selfTestProbe(service)) {
+		return fmt.Errorf("the envelope opened to another plaintext")
+	}
+	return nil
+}
+
+// checkPublishedKey checks the published key is the one in use
+func checkPublishedKey(ctx contractapi.TransactionContextInterface, fingerprint string) error {
+	record, err := GetPublishedServiceKey(ctx)
+	if err != nil {
+		return err
+	}
+	if record.Fingerprint != fingerprint {
+		return fmt.Errorf("the published key %s is not the key in use; run PublishPublicKey", record.Fingerprint)
+	}
+	return nil
+}
+
+// checkCounterpartRoundTrip seals the probe with the key imported for
+// counterpart and has the counterpart's chaincode open it
+func checkCounterpartRoundTrip(ctx contractapi.TransactionContextInterface, service, counterpart, padding string, publicKey *rsa.PublicKey) error {
+	peerChaincode, err := PeerChaincodeName(ctx, counterpart)
+	if err != nil {
+		return err
+	}
+	envelope, err := EncryptEnvelope(padding, publicKey, selfTestProbe(service))
+	if err != nil {
+		return err
+	}
+
+	response := ctx.GetStub().InvokeChaincode(peerChaincode, [][]byte{
+		[]byte("VerifySelfTestProbe"),
+		[]byte(base64.StdEncoding.EncodeToString(envelope)),
+		[]byte(service),
+	}, "")
+	if response.Status != 200 {
+		return fmt.Errorf("chaincode %s did not check the probe: %s", peerChaincode, response.Message)
+	}
+	if string(response.Payload) != "true" {
+		return fmt.Errorf("chaincode %s could not open a probe sealed with the imported %s key; re-import it with ImportPeerServiceKey", peerChaincode, counterpart)
+	}
+	return nil
+}
+
+// VerifySelfTestProbe reports whether the base64 envelope opens to the probe
+// of the service from. Every failure gives the same false, so the function
+// tells a caller nothing about ciphertexts other than probes.
+func VerifySelfTestProbe(ctx contractapi.TransactionContextInterface, privateKey *rsa.PrivateKey, envelopeB64, from string) bool {
+	envelope, err := base64.StdEncoding.DecodeString(envelopeB64)
+	if err != nil {
+		return false
+	}
+	plaintext, err := DecryptNegotiated(ctx, "self-test probe", privateKey, envelope)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(plaintext, selfTestProbe(from))
+}
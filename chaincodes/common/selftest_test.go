@@ -0,0 +1,70 @@
+package common
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"testing"
+)
+
+func TestSelfTestChecks(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := checkKeyPair(key, &key.PublicKey); err != nil {
+		t.Errorf("checkKeyPair() = %v", err)
+	}
+	if err := checkKeyPair(key, &other.PublicKey); err == nil {
+		t.Error("checkKeyPair() with another public key succeeded")
+	}
+	if err := checkSignVerify("AS", key, &key.PublicKey); err != nil {
+		t.Errorf("checkSignVerify() = %v", err)
+	}
+	if err := checkSignVerify("AS", key, &other.PublicKey); err == nil {
+		t.Error("checkSignVerify() with another public key succeeded")
+	}
+	for _, padding := range []string{PaddingPKCS1v15, PaddingOAEP} {
+		if err := checkRoundTrip("AS", padding, true, key, &key.PublicKey); err != nil {
+			t.Errorf("checkRoundTrip(%s) = %v", padding, err)
+		}
+	}
+	if err := checkRoundTrip("AS", PaddingPKCS1v15, false, key, &key.PublicKey); !errors.Is(err, ErrLegacyPadding) {
+		t.Errorf("checkRoundTrip() with legacy padding refused = %v, want %v", err, ErrLegacyPadding)
+	}
+	if err := checkRoundTrip("AS", PaddingOAEP, false, key, &other.PublicKey); err == nil {
+		t.Error("checkRoundTrip() with another public key succeeded")
+	}
+}
+
+func TestSelfTestReport(t *testing.T) {
+	report := newSelfTestReport("AS", PaddingOAEP)
+	report.check("private_key", nil)
+	report.skip("published_key", "not published")
+	if !report.Passed {
+		t.Error("report with a pass and a skip did not pass")
+	}
+	report.check("key_pair", errors.New("mismatch"))
+	if report.Passed {
+		t.Error("report with a failed check passed")
+	}
+
+	want := []SelfTestCheck{
+		{Name: "private_key", Status: selfTestPass},
+		{Name: "published_key", Status: selfTestSkip, Detail: "not published"},
+		{Name: "key_pair", Status: selfTestFail, Detail: "mismatch"},
+	}
+	if len(report.Checks) != len(want) {
+		t.Fatalf("report has %d checks, want %d", len(report.Checks), len(want))
+	}
+	for i, check := range report.Checks {
+		if check != want[i] {
+			t.Errorf("check %d = %+v, want %+v", i, check, want[i])
+		}
+	}
+}
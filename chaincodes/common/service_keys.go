@@ -0,0 +1,313 @@
+package common
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Services depend on each other's public keys: the AS encrypts TGTs for the
+// TGS, and the TGS encrypts service tickets for the ISV. Instead of copying
+// keys into each chaincode, every service publishes its own public key and
+// the service that depends on it imports it from the ledger, checking the
+// fingerprint the operator read from the publisher. Startup order is
+//
+//	ISV: Initialize, PublishPublicKey
+//	TGS: ImportPeerServiceKey(isv), Initialize, PublishPublicKey
+//	AS:  ImportPeerServiceKey(tgs), Initialize, PublishPublicKey
+//	TGS: ImportPeerServiceKey(as)
+//
+// The TGS imports the AS key last, to check the client changes the AS signs.
+
+// ServiceKey is a service's published public key
+type ServiceKey struct {
+	Service     string `json:"service"`
+	PublicKey   string `json:"publicKey"`
+	Fingerprint string `json:"fingerprint"` // hex SHA-256 of the DER public key
+	PublishedAt string `json:"publishedAt"`
+	PublishedBy string `json:"publishedBy"` // MSP ID of the publisher
+}
+
+// PublishedKeyKey holds the ServiceKey this chaincode published
+const PublishedKeyKey = "PUBLISHED_PUBLIC_KEY"
+
+// peerChaincodeKey prefixes the name of the chaincode a service key was
+// imported from
+const peerChaincodeKey = "PEER_CHAINCODE_"
+
+// PublicKeyFingerprint returns the hex SHA-256 of a public key's DER encoding
+func PublicKeyFingerprint(publicKey *rsa.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode public key: %v", err)
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// PublishServiceKey records the service's own public key for dependent
+// services to import
+func PublishServiceKey(ctx contractapi.TransactionContextInterface, service, publicKeyName string) (*ServiceKey, error) {
+	publicKeyPEM, err := ctx.GetStub().GetState(publicKeyName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", publicKeyName, err)
+	}
+	if publicKeyPEM == nil {
+		return nil, fmt.Errorf("%s public key not found; run Initialize first", service)
+	}
+
+	publicKey, err := ParsePublicKeyPEM(service+" public key", publicKeyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	fingerprint, err := PublicKeyFingerprint(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	currentTime, err := GetDeterministicTimestamp(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current timestamp: %v", err)
+	}
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get caller MSP ID: %v", err)
+	}
+
+	record := &ServiceKey{
+		Service:     service,
+		PublicKey:   string(publicKeyPEM),
+		Fingerprint: fingerprint,
+		PublishedAt: currentTime.UTC().Format("2006-01-02T15:04:05Z"),
+		PublishedBy: mspID,
+	}
+	recordJSON, err := json.Marshal(record)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal published key: %v", err)
+	}
+	if err := ctx.GetStub().PutState(PublishedKeyKey, recordJSON); err != nil {
+		return nil, fmt.Errorf("failed to store published key: %v", err)
+	}
+
+	fmt.Printf("%s public key published, fingerprint %s\n", service, fingerprint)
+	return record, nil
+}
+
+// GetPublishedServiceKey returns the key this chaincode published, or an
+// error if it has not published one yet
+func GetPublishedServiceKey(ctx contractapi.TransactionContextInterface) (*ServiceKey, error) {
+	recordJSON, err := ctx.GetStub().GetState(PublishedKeyKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read published key: %v", err)
+	}
+	if recordJSON == nil {
+		return nil, fmt.Errorf("no public key published yet; run PublishPublicKey")
+	}
+
+	var record ServiceKey
+	if err := json.Unmarshal(recordJSON, &record); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal published key: %v", err)
+	}
+	return &record, nil
+}
+
+// ImportServiceKey reads the key published by service on peerChaincode and
+// stores it under keyName once it matches the expected fingerprint
+func ImportServiceKey(ctx contractapi.TransactionContextInterface, peerChaincode, service, keyName, fingerprint string) (*ServiceKey, error) {
+	return ImportServiceKeys(ctx, peerChaincode, map[string]string{service: keyName}, fingerprint)
+}
+
+// ImportServiceKeys is ImportServiceKey for a chaincode that imports the
+// keys of several services. The service that published the key on
+// peerChaincode picks its key name from keyNames.
+func ImportServiceKeys(ctx contractapi.TransactionContextInterface, peerChaincode string, keyNames map[string]string, fingerprint string) (*ServiceKey, error) {
+	services := make([]string, 0, len(keyNames))
+	for service := range keyNames {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+	expected := strings.Join(services, " or ")
+	if fingerprint == "" {
+		return nil, fmt.Errorf("the expected %s key fingerprint is required", expected)
+	}
+
+	response := ctx.GetStub().InvokeChaincode(peerChaincode, [][]byte{[]byte("GetPublishedPublicKey")}, "")
+	if response.Status != 200 {
+		return nil, fmt.Errorf("%s has not published its public key on chaincode %s: %s", expected, peerChaincode, response.Message)
+	}
+
+	var record ServiceKey
+	if err := json.Unmarshal(response.Payload, &record); err != nil {
+		return nil, fmt.Errorf("invalid published key from chaincode %s: %v", peerChaincode, err)
+	}
+	service, keyName := expected, ""
+	if name, ok := keyNames[record.Service]; ok {
+		service, keyName = record.Service, name
+	}
+	if err := verifyServiceKey(&record, service, fingerprint); err != nil {
+		return nil, err
+	}
+
+	if err := ctx.GetStub().PutState(keyName, []byte(record.PublicKey)); err != nil {
+		return nil, fmt.Errorf("failed to store %s: %v", keyName, err)
+	}
+	// Remember where the service runs, for later calls to it
+	if err := ctx.GetStub().PutState(peerChaincodeKey+service, []byte(peerChaincode)); err != nil {
+		return nil, fmt.Errorf("failed to store %s chaincode name: %v", service, err)
+	}
+
+	fmt.Printf("Imported %s public key from %s, fingerprint %s\n", service, peerChaincode, record.Fingerprint)
+	return &record, nil
+}
+
+// verifyServiceKey checks that a published key belongs to service, parses,
+// and matches the fingerprint the operator expects
+func verifyServiceKey(record *ServiceKey, service, fingerprint string) error {
+	if record.Service != service {
+		return fmt.Errorf("chaincode published a %s key, expected %s", record.Service, service)
+	}
+	publicKey, err := ParsePublicKeyPEM(service+" public key", []byte(record.PublicKey))
+	if err != nil {
+		return err
+	}
+	actual, err := PublicKeyFingerprint(publicKey)
+	if err != nil {
+		return err
+	}
+	if actual != strings.ToLower(strings.ReplaceAll(fingerprint, ":", "")) {
+		return fmt.Errorf("%s key fingerprint %s does not match the expected %s", service, actual, fingerprint)
+	}
+	return nil
+}
+
+// RequireServiceKey fails with the startup order when a dependency's key
+// has not been imported yet
+func RequireServiceKey(ctx contractapi.TransactionContextInterface, service, keyName string) error {
+	publicKeyPEM, err := ctx.GetStub().GetState(keyName)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", keyName, err)
+	}
+	if publicKeyPEM == nil {
+		return fmt.Errorf("%s public key has not been imported: run PublishPublicKey on the %s chaincode, then ImportPeerServiceKey here", service, service)
+	}
+	return nil
+}
+
+// PeerChaincodeName returns the chaincode a service's key was imported from
+func PeerChaincodeName(ctx contractapi.TransactionContextInterface, service string) (string, error) {
+	name, err := ctx.GetStub().GetState(peerChaincodeKey + service)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s chaincode name: %v", service, err)
+	}
+	if name == nil {
+		return "", fmt.Errorf("%s chaincode is unknown: run ImportPeerServiceKey first", service)
+	}
+	return string(name), nil
+}
+
+// InitializationRecord is written by Initialize: who initialized the
+// chaincode, when, and the fingerprints of the public keys it was
+// initialized with, so the key ceremony can be audited afterwards
+type InitializationRecord struct {
+	Service         string            `json:"service"`
+	InitializedBy   string            `json:"initializedBy"` // MSP ID of the initializing identity
+	Initializer     string            `json:"initializer"`   // Certificate subject of the initializing identity
+	InitializedAt   string            `json:"initializedAt"`
+	TxID            string            `json:"txID"`
+	KeyFingerprints map[string]string `json:"keyFingerprints"` // By key name, e.g. "TGS_PUBLIC_KEY"
+}
+
+const initializationRecordKey = "INITIALIZATION_RECORD"
+
+// RecordInitialization stores the initialization record. The chaincode's
+// own key is passed in, since GetState does not see the transaction's own
+// writes; imported keys are read from the ledger.
+func RecordInitialization(ctx contractapi.TransactionContextInterface, service, ownKeyName, ownKeyPEM string, importedKeyNames ...string) error {
+	keys := map[string][]byte{ownKeyName: []byte(ownKeyPEM)}
+	for _, keyName := range importedKeyNames {
+		publicKeyPEM, err := ctx.GetStub().GetState(keyName)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %v", keyName, err)
+		}
+		keys[keyName] = publicKeyPEM
+	}
+
+	fingerprints, err := keyFingerprints(keys)
+	if err != nil {
+		return err
+	}
+
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get caller MSP ID: %v", err)
+	}
+	var initializer string
+	if cert, err := ctx.GetClientIdentity().GetX509Certificate(); err == nil && cert != nil {
+		initializer = cert.Subject.String()
+	}
+	currentTime, err := GetDeterministicTimestamp(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get current timestamp: %v", err)
+	}
+
+	record := &InitializationRecord{
+		Service:         service,
+		InitializedBy:   mspID,
+		Initializer:     initializer,
+		InitializedAt:   currentTime.UTC().Format("2006-01-02T15:04:05Z"),
+		TxID:            ctx.GetStub().GetTxID(),
+		KeyFingerprints: fingerprints,
+	}
+	recordJSON, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal initialization record: %v", err)
+	}
+	if err := ctx.GetStub().PutState(initializationRecordKey, recordJSON); err != nil {
+		return fmt.Errorf("failed to store initialization record: %v", err)
+	}
+	return nil
+}
+
+// keyFingerprints returns the fingerprint of each PEM public key, by key
+// name. A missing or unparsable key is an error.
+func keyFingerprints(keys map[string][]byte) (map[string]string, error) {
+	fingerprints := make(map[string]string, len(keys))
+	for keyName, publicKeyPEM := range keys {
+		if publicKeyPEM == nil {
+			return nil, fmt.Errorf("%s not found", keyName)
+		}
+		publicKey, err := ParsePublicKeyPEM(keyName, publicKeyPEM)
+		if err != nil {
+			return nil, err
+		}
+		if fingerprints[keyName], err = PublicKeyFingerprint(publicKey); err != nil {
+			return nil, err
+		}
+	}
+	return fingerprints, nil
+}
+
+// GetInitializationRecord returns the initialization record, or an error
+// for a chaincode initialized before records were kept
+func GetInitializationRecord(ctx contractapi.TransactionContextInterface) (*InitializationRecord, error) {
+	recordJSON, err := ctx.GetStub().GetState(initializationRecordKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read initialization record: %v", err)
+	}
+	if recordJSON == nil {
+		return nil, fmt.Errorf("no initialization record; the chaincode is not initialized or was initialized before records were kept")
+	}
+
+	var record InitializationRecord
+	if err := json.Unmarshal(recordJSON, &record); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal initialization record: %v", err)
+	}
+	return &record, nil
+}
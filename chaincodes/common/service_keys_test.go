@@ -0,0 +1,62 @@
+package common
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVerifyServiceKey(t *testing.T) {
+	_, publicPEM := testKeyPEM(t)
+	publicKey, err := ParsePublicKeyPEM("public key", publicPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fingerprint, err := PublicKeyFingerprint(publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := &ServiceKey{Service: "TGS", PublicKey: string(publicPEM), Fingerprint: fingerprint}
+
+	if err := verifyServiceKey(record, "TGS", fingerprint); err != nil {
+		t.Errorf("matching key rejected: %v", err)
+	}
+	if err := verifyServiceKey(record, "TGS", strings.ToUpper(fingerprint)); err != nil {
+		t.Errorf("upper-case fingerprint rejected: %v", err)
+	}
+	if err := verifyServiceKey(record, "ISV", fingerprint); err == nil {
+		t.Error("key published by another service accepted")
+	}
+
+	_, otherPEM := testKeyPEM(t)
+	record.PublicKey = string(otherPEM)
+	if err := verifyServiceKey(record, "TGS", fingerprint); err == nil {
+		t.Error("key with a different fingerprint accepted")
+	}
+}
+
+func TestKeyFingerprints(t *testing.T) {
+	_, publicPEM := testKeyPEM(t)
+	publicKey, err := ParsePublicKeyPEM("public key", publicPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fingerprint, err := PublicKeyFingerprint(publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fingerprints, err := keyFingerprints(map[string][]byte{"TGS_PUBLIC_KEY": publicPEM})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fingerprints["TGS_PUBLIC_KEY"] != fingerprint {
+		t.Errorf("fingerprint = %q, want %q", fingerprints["TGS_PUBLIC_KEY"], fingerprint)
+	}
+
+	if _, err := keyFingerprints(map[string][]byte{"TGS_PUBLIC_KEY": publicPEM, "ISV_PUBLIC_KEY": nil}); err == nil {
+		t.Error("missing key accepted")
+	}
+	if _, err := keyFingerprints(map[string][]byte{"ISV_PUBLIC_KEY": []byte("not a key")}); err == nil {
+		t.Error("unparsable key accepted")
+	}
+}
@@ -0,0 +1,54 @@
+package common
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+)
+
+// A service tells a peer service of a change by calling it in the same
+// transaction with a notice sealed for the peer, as tickets are. The seal
+// keeps the notice private but says nothing of who sent it, since the
+// peer's public key is public. The sender therefore also signs the notice
+// with its own private key, and the peer checks the signature against the
+// sender's imported public key before acting on it.
+
+// SignedNotice is a notice and its sender's signature
+type SignedNotice struct {
+	Notice    []byte `json:"notice"`
+	Signature []byte `json:"signature"` // RSASSA-PKCS1-v1_5 over the SHA-256 of Notice
+}
+
+// SignNotice signs a notice with the sender's private key and returns the
+// SignedNotice as JSON. PKCS#1 v1.5 signatures are deterministic, so every
+// endorsing peer produces the same one.
+func SignNotice(privateKey *rsa.PrivateKey, notice []byte) ([]byte, error) {
+	hashed := sha256.Sum256(notice)
+	signature, err := rsa.SignPKCS1v15(rand.Reader, privateKey, crypto.SHA256, hashed[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign notice: %v", err)
+	}
+	signedJSON, err := json.Marshal(SignedNotice{Notice: notice, Signature: signature})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal signed notice: %v", err)
+	}
+	return signedJSON, nil
+}
+
+// OpenSignedNotice returns the notice in a SignedNotice once its signature
+// checks out against the sender's public key. A bad signature comes back as
+// a *CryptoError naming op.
+func OpenSignedNotice(op string, publicKey *rsa.PublicKey, signedJSON []byte) ([]byte, error) {
+	var signed SignedNotice
+	if err := json.Unmarshal(signedJSON, &signed); err != nil {
+		return nil, fmt.Errorf("invalid signed notice (JSON parsing failed): %v", err)
+	}
+	hashed := sha256.Sum256(signed.Notice)
+	if err := SafeVerify(op, publicKey, hashed[:], signed.Signature); err != nil {
+		return nil, err
+	}
+	return signed.Notice, nil
+}
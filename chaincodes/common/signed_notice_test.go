@@ -0,0 +1,53 @@
+package common
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestSignedNotice(t *testing.T) {
+	sender, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notice := []byte(`{"clientID":"client1","change":"deregistered"}`)
+
+	signedJSON, err := SignNotice(sender, notice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := SignNotice(sender, notice); string(again) != string(signedJSON) {
+		t.Error("signing the same notice twice gave different results")
+	}
+	if opened, err := OpenSignedNotice("notice", &sender.PublicKey, signedJSON); err != nil || string(opened) != string(notice) {
+		t.Errorf("OpenSignedNotice() = %s, %v", opened, err)
+	}
+
+	var cryptoErr *CryptoError
+	if _, err := OpenSignedNotice("notice", &other.PublicKey, signedJSON); !errors.As(err, &cryptoErr) {
+		t.Errorf("notice signed by another key error = %v, want a *CryptoError", err)
+	}
+
+	// A notice changed after signing is refused
+	var signed SignedNotice
+	if err := json.Unmarshal(signedJSON, &signed); err != nil {
+		t.Fatal(err)
+	}
+	signed.Notice = []byte(`{"clientID":"client2","change":"deregistered"}`)
+	forgedJSON, _ := json.Marshal(signed)
+	if _, err := OpenSignedNotice("notice", &sender.PublicKey, forgedJSON); err == nil {
+		t.Error("altered notice accepted")
+	}
+
+	unsignedJSON, _ := json.Marshal(SignedNotice{Notice: notice})
+	if _, err := OpenSignedNotice("notice", &sender.PublicKey, unsignedJSON); !errors.Is(err, ErrEmptySignature) {
+		t.Errorf("unsigned notice error = %v, want ErrEmptySignature", err)
+	}
+}
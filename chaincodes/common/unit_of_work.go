@@ -0,0 +1,160 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Fabric commits a transaction's writes together, or none of them when the
+// function returns an error, so a failed call never leaves some of its
+// records on the ledger without the others. Two things are still easy to
+// get wrong inside one transaction:
+//
+//   - GetState does not see the transaction's own writes, so a helper that
+//     reads a key written earlier in the call gets the old value; two
+//     increments of the same counter count once
+//   - writes made before an error return are discarded with it, so cleanup
+//     followed by "return err" never happens
+//
+// A UnitOfWork stages writes in memory and serves reads of staged keys from
+// the stage. Functions that write several records validate their inputs and
+// build every record first, stage the writes, and commit as the last step.
+
+// StateStore is the part of the chaincode stub a UnitOfWork reads and
+// writes through
+type StateStore interface {
+	GetState(key string) ([]byte, error)
+	PutState(key string, value []byte) error
+	DelState(key string) error
+}
+
+// UnitOfWork holds the writes of one transaction until commit
+type UnitOfWork struct {
+	store     StateStore
+	order     []string          // keys in the order they were first staged
+	writes    map[string][]byte // staged values
+	deletes   map[string]bool   // staged deletions
+	shard     string            // metric shard of the transaction
+	committed bool
+}
+
+// NewUnitOfWork returns an empty unit of work on the transaction's stub
+func NewUnitOfWork(ctx contractapi.TransactionContextInterface) *UnitOfWork {
+	return NewUnitOfWorkOn(ctx.GetStub())
+}
+
+// NewUnitOfWorkOn returns an empty unit of work on store. Its metric
+// increments go to the shard of the store's transaction, if it has one.
+func NewUnitOfWorkOn(store StateStore) *UnitOfWork {
+	var txID string
+	if stub, ok := store.(interface{ GetTxID() string }); ok {
+		txID = stub.GetTxID()
+	}
+	return &UnitOfWork{
+		store:   store,
+		writes:  make(map[string][]byte),
+		deletes: make(map[string]bool),
+		shard:   AggregateShard(txID),
+	}
+}
+
+// Get returns the staged value of key, or the ledger value if it has not
+// been staged
+func (u *UnitOfWork) Get(key string) ([]byte, error) {
+	if u.deletes[key] {
+		return nil, nil
+	}
+	if value, ok := u.writes[key]; ok {
+		return value, nil
+	}
+	return u.store.GetState(key)
+}
+
+func (u *UnitOfWork) stage(key string) {
+	if _, ok := u.writes[key]; !ok && !u.deletes[key] {
+		u.order = append(u.order, key)
+	}
+}
+
+// Put stages a write
+func (u *UnitOfWork) Put(key string, value []byte) {
+	u.stage(key)
+	delete(u.deletes, key)
+	u.writes[key] = value
+}
+
+// PutJSON marshals record now, so a marshalling error surfaces before
+// anything is written
+func (u *UnitOfWork) PutJSON(key string, record interface{}) error {
+	recordJSON, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %v", key, err)
+	}
+	u.Put(key, recordJSON)
+	return nil
+}
+
+// Del stages a deletion
+func (u *UnitOfWork) Del(key string) {
+	u.stage(key)
+	delete(u.writes, key)
+	u.deletes[key] = true
+}
+
+// IncrementMetric stages an increment of the counter's shard for this
+// transaction, which later increments of the same counter in this unit of
+// work build on
+func (u *UnitOfWork) IncrementMetric(name string) error {
+	return u.AddMetric(name, 1)
+}
+
+// AddMetric stages adding delta to the counter's shard for this transaction
+func (u *UnitOfWork) AddMetric(name string, delta int64) error {
+	if delta == 0 {
+		return nil
+	}
+	key, err := metricShardKey(name, u.shard)
+	if err != nil {
+		return err
+	}
+	valueBytes, err := u.Get(key)
+	if err != nil {
+		return fmt.Errorf("failed to read metric %s: %v", name, err)
+	}
+
+	var value int64
+	if valueBytes != nil {
+		value, err = strconv.ParseInt(string(valueBytes), 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid value for metric %s: %v", name, err)
+		}
+	}
+
+	u.Put(key, []byte(strconv.FormatInt(value+delta, 10)))
+	return nil
+}
+
+// Commit writes the staged changes in the order they were staged. A unit
+// of work can be committed once.
+func (u *UnitOfWork) Commit() error {
+	if u.committed {
+		return fmt.Errorf("unit of work already committed")
+	}
+	u.committed = true
+
+	for _, key := range u.order {
+		if u.deletes[key] {
+			if err := u.store.DelState(key); err != nil {
+				return fmt.Errorf("failed to delete %s: %v", key, err)
+			}
+			continue
+		}
+		if err := u.store.PutState(key, u.writes[key]); err != nil {
+			return fmt.Errorf("failed to store %s: %v", key, err)
+		}
+	}
+	return nil
+}
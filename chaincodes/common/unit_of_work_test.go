@@ -0,0 +1,75 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/blockchain-auth/common/commontest"
+)
+
+func TestUnitOfWork(t *testing.T) {
+	store := commontest.NewMemoryStore(map[string][]byte{"OLD": []byte("x")})
+	uow := NewUnitOfWorkOn(store)
+
+	uow.Put("A", []byte("1"))
+	uow.Del("OLD")
+	if err := uow.PutJSON("B", map[string]int{"n": 2}); err != nil {
+		t.Fatal(err)
+	}
+	uow.Put("A", []byte("3"))
+
+	if len(store.Log) != 0 {
+		t.Fatalf("writes reached the store before commit: %v", store.Log)
+	}
+	if value, _ := uow.Get("A"); string(value) != "3" {
+		t.Errorf("Get(A) = %q, want the staged value", value)
+	}
+	if value, _ := uow.Get("OLD"); value != nil {
+		t.Errorf("Get(OLD) = %q, want nil after Del", value)
+	}
+
+	if err := uow.PutJSON("C", func() {}); err == nil {
+		t.Error("PutJSON accepted an unmarshallable record")
+	}
+
+	if err := uow.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"put A", "del OLD", "put B"}
+	if len(store.Log) != len(want) {
+		t.Fatalf("commit wrote %v, want %v", store.Log, want)
+	}
+	for i := range want {
+		if store.Log[i] != want[i] {
+			t.Fatalf("commit wrote %v, want %v", store.Log, want)
+		}
+	}
+	if string(store.State["A"]) != "3" || string(store.State["B"]) != `{"n":2}` {
+		t.Errorf("unexpected state after commit: %q", store.State)
+	}
+	if err := uow.Commit(); err == nil {
+		t.Error("a unit of work committed twice")
+	}
+}
+
+func TestUnitOfWorkMetricIncrements(t *testing.T) {
+	store := commontest.NewMemoryStore(map[string][]byte{MetricKeyPrefix + "m": []byte("5")})
+	uow := NewUnitOfWorkOn(store)
+	for i := 0; i < 3; i++ {
+		if err := uow.IncrementMetric("m"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := uow.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	key, err := metricShardKey("m", AggregateShard(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(store.State[key]); got != "3" {
+		t.Errorf("metric shard = %s, want 3", got)
+	}
+	if got := string(store.State[MetricKeyPrefix+"m"]); got != "5" {
+		t.Errorf("counter from before sharding = %s, want it left at 5", got)
+	}
+}
@@ -3,10 +3,13 @@ package common
 import (
 	"crypto/rand"
 	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/base64"
 	"encoding/hex"
 	"fmt"
 	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
 )
 
 // GenerateSecureRandomBytes generates cryptographically secure random bytes
@@ -52,11 +55,26 @@ func HashData(data string) string {
 	return hex.EncodeToString(hash[:])
 }
 
+// SecureCompare compares two secrets (nonces, session keys, hashes) in constant time
+func SecureCompare(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
 // GetCurrentTimestamp returns the current Unix timestamp
 func GetCurrentTimestamp() int64 {
 	return time.Now().Unix()
 }
 
+// GetDeterministicTimestamp returns the transaction's timestamp, which is the
+// same on every endorsing peer. Chaincode logic uses it instead of the clock.
+func GetDeterministicTimestamp(ctx contractapi.TransactionContextInterface) (time.Time, error) {
+	txTimestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get transaction timestamp: %v", err)
+	}
+	return time.Unix(txTimestamp.Seconds, int64(txTimestamp.Nanos)), nil
+}
+
 // IsExpired checks if a timestamp has expired relative to the current time
 func IsExpired(timestamp int64, validitySeconds int64) bool {
 	currentTime := GetCurrentTimestamp()
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/blockchain-auth/common/commontest"
+)
+
+func TestCreateAccessGrantNeedsCapabilities(t *testing.T) {
+	s := &ISVChaincode{}
+	ctx := commontest.NewContext(commontest.NewStub("isv"), &commontest.FakeIdentity{MSPID: "Org1MSP"})
+	codeHash := strings.Repeat("ab", 32)
+
+	for _, capabilitiesJSON := range []string{`[]`, `null`} {
+		_, err := s.CreateAccessGrant(ctx, "device1", codeHash, capabilitiesJSON, 60, "")
+		if err == nil || !strings.Contains(err.Error(), "at least one capability") {
+			t.Errorf("CreateAccessGrant(%s) = %v, want the empty list refused", capabilitiesJSON, err)
+		}
+	}
+}
+
+func TestSessionCapabilities(t *testing.T) {
+	s := &ISVChaincode{}
+	stub := commontest.NewStub("isv")
+	ctx := commontest.NewContext(stub, &commontest.FakeIdentity{MSPID: "Org1MSP"})
+	deviceJSON, _ := json.Marshal(IoTDevice{DeviceID: "device1", Capabilities: []string{"read", "unlock"}})
+	stub.State["DEVICE_device1"] = deviceJSON
+
+	tests := []struct {
+		name        string
+		sessionJSON string
+		want        []string
+	}{
+		{"no set of its own", `{"deviceID": "device1"}`, []string{"read"}},
+		{"break-glass", `{"deviceID": "device1", "emergencyAccessID": "tx1"}`, []string{"read", "unlock"}},
+		{"restricted", `{"deviceID": "device1", "capabilities": ["read"]}`, []string{"read"}},
+		{"empty set", `{"deviceID": "device1", "capabilities": []}`, []string{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Sessions are read back from the ledger, so the set must survive
+			// a round trip
+			var stored ClientDeviceSession
+			if err := json.Unmarshal([]byte(test.sessionJSON), &stored); err != nil {
+				t.Fatal(err)
+			}
+			storedJSON, _ := json.Marshal(stored)
+			var session ClientDeviceSession
+			if err := json.Unmarshal(storedJSON, &session); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := s.sessionCapabilities(ctx, &session)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Join(got, ",") != strings.Join(test.want, ",") || len(got) != len(test.want) {
+				t.Errorf("sessionCapabilities() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSettlementCapabilityClass(t *testing.T) {
+	device := &IoTDevice{DeviceID: "device1"}
+	if class := settlementCapabilityClass(&ClientDeviceSession{}, device); class != settlementFullAccess {
+		t.Errorf("unrestricted session: class %q", class)
+	}
+	if class := settlementCapabilityClass(&ClientDeviceSession{Capabilities: []string{}}, device); class != settlementNoAccess {
+		t.Errorf("session restricted to nothing: class %q", class)
+	}
+}
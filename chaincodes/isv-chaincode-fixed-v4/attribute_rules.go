@@ -0,0 +1,132 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/blockchain-auth/common"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Service tickets carry the client attributes the TGS disclosure policy
+// names for the service (see disclosure.go in the TGS chaincode). A device
+// agent sets rules on those attributes with SetDeviceAttributeRules, for
+// instance clearance in [secret, top-secret]. ProcessServiceRequest then
+// opens a session only if every rule holds, and RenewSession refuses a
+// ticket that no longer satisfies them. An attribute the ticket does not
+// carry fails its rule, so a service whose policy does not disclose it
+// cannot reach the device.
+
+const (
+	maxAttributeRules      = 16
+	maxAttributeRuleValues = 32
+	maxAttributeLength     = 317 // A label key: a 253-character prefix, '/' and a 63-character name
+
+	// serviceAttributesNotSatisfied is the ServiceResponse status of a
+	// request whose ticket does not satisfy the device's attribute rules
+	serviceAttributesNotSatisfied = "attributes_not_satisfied"
+
+	metricAttributeDenials = "attribute_denials"
+)
+
+// attributeRulesMessage is the message a device agent signs to set its
+// attribute rules, over the SHA-256 (hex) of the rules JSON as sent
+func attributeRulesMessage(deviceID string, rulesHash string) string {
+	return fmt.Sprintf("ATTRIBUTERULES|%s|%s", deviceID, rulesHash)
+}
+
+// parseAttributeRules parses a JSON object mapping each attribute to the
+// values it may take. Values are sorted.
+func parseAttributeRules(rulesJSON string) (map[string][]string, error) {
+	var rules map[string][]string
+	if err := json.Unmarshal([]byte(rulesJSON), &rules); err != nil {
+		return nil, fmt.Errorf("invalid attribute rules format: %v", err)
+	}
+	if len(rules) > maxAttributeRules {
+		return nil, fmt.Errorf("a device has at most %d attribute rules", maxAttributeRules)
+	}
+	for name, values := range rules {
+		if name == "" || len(name) > maxAttributeLength {
+			return nil, fmt.Errorf("invalid attribute name %q", name)
+		}
+		if len(values) == 0 || len(values) > maxAttributeRuleValues {
+			return nil, fmt.Errorf("attribute %q must allow between 1 and %d values", name, maxAttributeRuleValues)
+		}
+		for _, value := range values {
+			if value == "" || len(value) > maxAttributeLength {
+				return nil, fmt.Errorf("invalid value %q for attribute %q", value, name)
+			}
+		}
+		sort.Strings(values)
+	}
+	return rules, nil
+}
+
+// attributeRuleViolation returns why attributes fail the device's rules, or
+// "" if they satisfy them all
+func (device *IoTDevice) attributeRuleViolation(attributes map[string]string) string {
+	names := make([]string, 0, len(device.AttributeRules))
+	for name := range device.AttributeRules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		allowed := device.AttributeRules[name]
+		value, ok := attributes[name]
+		if !ok {
+			return fmt.Sprintf("service ticket does not disclose attribute %q", name)
+		}
+		if !containsString(allowed, value) {
+			return fmt.Sprintf("attribute %q is %q, allowed: %s", name, value, strings.Join(allowed, ", "))
+		}
+	}
+	return ""
+}
+
+// SetDeviceAttributeRules sets the client attributes a device requires;
+// "{}" removes the rules. It is signed with the device key.
+func (s *ISVChaincode) SetDeviceAttributeRules(ctx contractapi.TransactionContextInterface, deviceID string, rulesJSON string, signature string) error {
+	rules, err := parseAttributeRules(rulesJSON)
+	if err != nil {
+		return err
+	}
+	rulesHash := fmt.Sprintf("%x", sha256.Sum256([]byte(rulesJSON)))
+	if err := s.verifyDeviceSignature(ctx, deviceID, attributeRulesMessage(deviceID, rulesHash), signature); err != nil {
+		return err
+	}
+
+	device, err := s.getDevice(ctx, deviceID)
+	if err != nil {
+		return err
+	}
+	device.AttributeRules = rules
+	if len(rules) == 0 {
+		device.AttributeRules = nil
+	}
+
+	fmt.Printf("Device %s now has %d attribute rules\n", deviceID, len(rules))
+	return putDevice(ctx, device)
+}
+
+// checkAttributeRules records a denial and returns its reason if the
+// ticket does not satisfy the device's attribute rules
+func (s *ISVChaincode) checkAttributeRules(ctx contractapi.TransactionContextInterface, deviceID string, serviceTicket *ServiceTicket) (string, error) {
+	device, err := s.getDevice(ctx, deviceID)
+	if err != nil {
+		return "", err
+	}
+	violation := device.attributeRuleViolation(serviceTicket.Attributes)
+	if violation == "" {
+		return "", nil
+	}
+	if err := common.IncrementMetric(ctx, metricAttributeDenials); err != nil {
+		return "", err
+	}
+	if err := recordAccessLog(ctx, deviceID, serviceTicket.ClientID, "", accessDenied, violation); err != nil {
+		return "", err
+	}
+	return violation, nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseAttributeRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		want    map[string][]string
+		wantErr bool
+	}{
+		{"rules", `{"clearance":["top-secret","secret"]}`, map[string][]string{"clearance": {"secret", "top-secret"}}, false},
+		{"none", `{}`, map[string][]string{}, false},
+		{"no values", `{"clearance":[]}`, nil, true},
+		{"empty value", `{"clearance":[""]}`, nil, true},
+		{"empty name", `{"":["secret"]}`, nil, true},
+		{"not an object", `["clearance"]`, nil, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseAttributeRules(test.json)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("parseAttributeRules() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(got, test.want) {
+				t.Errorf("parseAttributeRules() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestAttributeRuleViolation(t *testing.T) {
+	device := &IoTDevice{AttributeRules: map[string][]string{
+		"clearance":  {"secret", "top-secret"},
+		"department": {"ops"},
+	}}
+	tests := []struct {
+		name       string
+		device     *IoTDevice
+		attributes map[string]string
+		wantDenied bool
+	}{
+		{"no rules", &IoTDevice{}, nil, false},
+		{"satisfied", device, map[string]string{"clearance": "secret", "department": "ops"}, false},
+		{"extra attributes", device, map[string]string{"clearance": "secret", "department": "ops", "site": "plant-7"}, false},
+		{"value not allowed", device, map[string]string{"clearance": "public", "department": "ops"}, true},
+		{"not disclosed", device, map[string]string{"clearance": "secret"}, true},
+		{"no attributes", device, nil, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			violation := test.device.attributeRuleViolation(test.attributes)
+			if (violation != "") != test.wantDenied {
+				t.Errorf("attributeRuleViolation() = %q, wantDenied %v", violation, test.wantDenied)
+			}
+		})
+	}
+}
+
+func TestAttributeRulesMessage(t *testing.T) {
+	if got, want := attributeRulesMessage("device1", "ab12"), "ATTRIBUTERULES|device1|ab12"; got != want {
+		t.Errorf("attributeRulesMessage() = %q, want %q", got, want)
+	}
+}
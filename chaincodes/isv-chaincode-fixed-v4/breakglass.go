@@ -0,0 +1,436 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/blockchain-auth/common"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Break-glass access opens a session to any device without a service
+// ticket, for incident response while the AS or TGS cannot issue tickets.
+// Only identities whose enrollment certificate carries the break_glass
+// attribute may use it:
+//
+//	fabric-ca-client register --id.name responder1 --id.attrs 'break_glass=true:ecert'
+//
+// The session bypasses ticketing, maintenance windows and load limits, but
+// not revocation. Every emergency session needs a reason and is time-boxed:
+// it lasts at most maxEmergencySessionLifetime and cannot be extended.
+// Once it expires, HandleDeviceResponse refuses it, CheckSessionCapability
+// denies it and SweepSessions closes it. CloseSession refuses emergency
+// sessions; CloseEmergencySession closes them with a summary of what was
+// done.
+//
+// Each step is recorded three times: in the EmergencyAccess record's own
+// trail, in the device's access log, and as an event (EmergencyAccessOpened,
+// EmergencyAccessClosed, or SessionsSwept on expiry) for paging whoever
+// reviews break-glass use.
+
+// EmergencyAccess is one break-glass session and its audit trail
+type EmergencyAccess struct {
+	AccessID     string                `json:"accessID"`
+	DeviceID     string                `json:"deviceID"`
+	Responder    string                `json:"responder"` // Common name of the break-glass identity
+	ResponderMSP string                `json:"responderMSP"`
+	Reason       string                `json:"reason"`
+	SessionID    string                `json:"sessionID"`
+	OpenedAt     time.Time             `json:"openedAt"`
+	ExpiresAt    time.Time             `json:"expiresAt"`
+	Status       string                `json:"status"` // "open", "closed", "expired"
+	ClosedAt     time.Time             `json:"closedAt,omitempty"`
+	ClosedBy     string                `json:"closedBy,omitempty"`
+	Summary      string                `json:"summary,omitempty"`
+	Trail        []EmergencyAuditEntry `json:"trail"`
+}
+
+// EmergencyAuditEntry is one step of an emergency session
+type EmergencyAuditEntry struct {
+	Action    string    `json:"action"` // "opened", "device_response", "closed", "expired"
+	Actor     string    `json:"actor,omitempty"`
+	Detail    string    `json:"detail,omitempty"`
+	TxID      string    `json:"txID"`
+	FlowID    string    `json:"flowID,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+const (
+	// breakGlassAttribute is the certificate attribute that marks a
+	// break-glass identity; its value must be "true"
+	breakGlassAttribute = "break_glass"
+
+	emergencyAccessKeyPrefix = "BREAKGLASS_"
+
+	defaultEmergencySessionLifetime = 30 * 60
+	maxEmergencySessionLifetime     = 2 * 60 * 60
+
+	minEmergencyReasonLength = 10
+	maxEmergencyReasonLength = 1024
+
+	emergencyAccessOpenedEvent = "EmergencyAccessOpened"
+	emergencyAccessClosedEvent = "EmergencyAccessClosed"
+
+	accessEmergencyOpened = "emergency_session_opened"
+	accessEmergencyClosed = "emergency_session_closed"
+
+	metricEmergencySessions = "emergency_sessions_opened"
+)
+
+// hasBreakGlassAttribute reports whether an identity carries
+// break_glass=true
+func hasBreakGlassAttribute(identity common.AttributeSource) (bool, error) {
+	value, found, err := identity.GetAttributeValue(breakGlassAttribute)
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s attribute: %v", breakGlassAttribute, err)
+	}
+	return found && value == "true", nil
+}
+
+// checkBreakGlassCaller rejects callers that are not break-glass identities
+// and returns the caller's common name and MSP
+func checkBreakGlassCaller(ctx contractapi.TransactionContextInterface) (string, string, error) {
+	identity := ctx.GetClientIdentity()
+	allowed, err := hasBreakGlassAttribute(identity)
+	if err != nil {
+		return "", "", err
+	}
+	if !allowed {
+		return "", "", fmt.Errorf("caller is not a break-glass identity (certificate attribute %s=true)", breakGlassAttribute)
+	}
+	cert, err := identity.GetX509Certificate()
+	if err != nil || cert == nil {
+		return "", "", fmt.Errorf("failed to read caller certificate: %v", err)
+	}
+	mspID, err := callerMSP(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	return cert.Subject.CommonName, mspID, nil
+}
+
+// validateEmergencyReason trims a break-glass reason and checks its length
+func validateEmergencyReason(reason string) (string, error) {
+	reason = strings.TrimSpace(reason)
+	if len(reason) < minEmergencyReasonLength {
+		return "", fmt.Errorf("a reason of at least %d characters is required for break-glass access", minEmergencyReasonLength)
+	}
+	if len(reason) > maxEmergencyReasonLength {
+		return "", fmt.Errorf("reason must be at most %d characters", maxEmergencyReasonLength)
+	}
+	return reason, nil
+}
+
+// emergencySessionLifetime returns the lifetime of an emergency session
+// asked to last lifetimeSeconds; 0 is the default
+func emergencySessionLifetime(lifetimeSeconds int64) (time.Duration, error) {
+	if lifetimeSeconds == 0 {
+		lifetimeSeconds = defaultEmergencySessionLifetime
+	}
+	if lifetimeSeconds < 0 || lifetimeSeconds > maxEmergencySessionLifetime {
+		return 0, fmt.Errorf("emergency session lifetime must be between 1 and %d seconds", maxEmergencySessionLifetime)
+	}
+	return time.Duration(lifetimeSeconds) * time.Second, nil
+}
+
+// appendTrail adds a step to an emergency session's trail
+func (access *EmergencyAccess) appendTrail(ctx contractapi.TransactionContextInterface, action, actor, detail string, now time.Time) error {
+	flowID, err := common.GetFlowID(ctx)
+	if err != nil {
+		return err
+	}
+	access.Trail = append(access.Trail, EmergencyAuditEntry{
+		Action:    action,
+		Actor:     actor,
+		Detail:    detail,
+		TxID:      ctx.GetStub().GetTxID(),
+		FlowID:    flowID,
+		Timestamp: now.UTC(),
+	})
+	return nil
+}
+
+// OpenEmergencySession opens a break-glass session to a device. lifetimeSeconds
+// 0 is defaultEmergencySessionLifetime. The session's client is the
+// responder's common name; its session key is derived from the transaction,
+// as there is no service ticket to take one from.
+func (s *ISVChaincode) OpenEmergencySession(ctx contractapi.TransactionContextInterface, deviceID string, reason string, lifetimeSeconds int64) (*EmergencyAccess, error) {
+	responder, responderMSP, err := checkBreakGlassCaller(ctx)
+	if err != nil {
+		return nil, err
+	}
+	reason, err = validateEmergencyReason(reason)
+	if err != nil {
+		return nil, err
+	}
+	lifetime, err := emergencySessionLifetime(lifetimeSeconds)
+	if err != nil {
+		return nil, err
+	}
+
+	device, err := s.getDevice(ctx, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if device.outOfService() {
+		return nil, fmt.Errorf("device %s is %s", deviceID, device.Status)
+	}
+
+	currentTime, err := common.GetDeterministicTimestamp(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current timestamp: %v", err)
+	}
+
+	txID := ctx.GetStub().GetTxID()
+	sessionKey := sha256.Sum256([]byte("BREAK_GLASS|" + txID))
+	sessionID := "SESSION_" + responder + "_" + deviceID + "_" + strconv.FormatInt(currentTime.Unix(), 10)
+	access := &EmergencyAccess{
+		AccessID:     txID,
+		DeviceID:     deviceID,
+		Responder:    responder,
+		ResponderMSP: responderMSP,
+		Reason:       reason,
+		SessionID:    sessionID,
+		OpenedAt:     currentTime,
+		ExpiresAt:    currentTime.Add(lifetime),
+		Status:       "open",
+	}
+	if err := access.appendTrail(ctx, "opened", responder, reason, currentTime); err != nil {
+		return nil, err
+	}
+	session := ClientDeviceSession{
+		SessionID:         sessionID,
+		ClientID:          responder,
+		DeviceID:          deviceID,
+		SessionKey:        base64.StdEncoding.EncodeToString(sessionKey[:]),
+		EstablishedAt:     currentTime,
+		ExpiresAt:         access.ExpiresAt,
+		Status:            "active",
+		ClientMSP:         responderMSP,
+		EmergencyAccessID: access.AccessID,
+	}
+	device.Status = "busy"
+
+	uow := common.NewUnitOfWork(ctx)
+	if err := uow.PutJSON(emergencyAccessKeyPrefix+access.AccessID, access); err != nil {
+		return nil, err
+	}
+	if err := uow.PutJSON(sessionID, &session); err != nil {
+		return nil, err
+	}
+	if err := uow.PutJSON("DEVICE_"+deviceID, device); err != nil {
+		return nil, err
+	}
+	if err := uow.IncrementMetric(metricSessionsOpened); err != nil {
+		return nil, err
+	}
+	if err := uow.IncrementMetric(metricEmergencySessions); err != nil {
+		return nil, err
+	}
+	if err := uow.Commit(); err != nil {
+		return nil, err
+	}
+	sessionJSON, err := json.Marshal(session)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal session data: %v", err)
+	}
+	if err := putIndexEntries(ctx, sessionID, sessionJSON, sessionIndexes...); err != nil {
+		return nil, err
+	}
+	if _, err := putAccessLog(ctx, &AccessLogEntry{
+		DeviceID:  deviceID,
+		ClientID:  responder,
+		SessionID: sessionID,
+		Action:    accessEmergencyOpened,
+		Detail:    reason,
+	}); err != nil {
+		return nil, err
+	}
+	if err := emitEmergencyAccess(ctx, emergencyAccessOpenedEvent, access); err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("Break-glass session %s opened by %s (%s) on device %s until %s\n",
+		sessionID, responder, responderMSP, deviceID, access.ExpiresAt.Format(time.RFC3339))
+	return access, nil
+}
+
+// CloseEmergencySession ends a break-glass session with a summary of what
+// was done. Break-glass identities and the admin MSPs may close it.
+func (s *ISVChaincode) CloseEmergencySession(ctx contractapi.TransactionContextInterface, accessID string, summary string) (*EmergencyAccess, error) {
+	actor, _, err := checkBreakGlassCaller(ctx)
+	if err != nil {
+		mspID, mspErr := callerMSP(ctx)
+		if mspErr != nil {
+			return nil, mspErr
+		}
+		admin, adminErr := common.IsAdminMSP(ctx, mspID)
+		if adminErr != nil {
+			return nil, adminErr
+		}
+		if !admin {
+			return nil, err
+		}
+		actor = mspID
+	}
+	summary = strings.TrimSpace(summary)
+	if summary == "" {
+		return nil, fmt.Errorf("a summary of the emergency work is required")
+	}
+	if len(summary) > maxEmergencyReasonLength {
+		return nil, fmt.Errorf("summary must be at most %d characters", maxEmergencyReasonLength)
+	}
+
+	access, err := getEmergencyAccess(ctx, accessID)
+	if err != nil {
+		return nil, err
+	}
+	if access.Status != "open" {
+		return nil, fmt.Errorf("emergency session %s is already %s", accessID, access.Status)
+	}
+
+	currentTime, err := common.GetDeterministicTimestamp(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current timestamp: %v", err)
+	}
+
+	uow := common.NewUnitOfWork(ctx)
+	sessionJSON, err := uow.Get(access.SessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read session data: %v", err)
+	}
+	var session ClientDeviceSession
+	if err := json.Unmarshal(sessionJSON, &session); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal session data: %v", err)
+	}
+	if session.Status == "active" {
+		if err := terminateSession(ctx, uow, access.SessionID, &session, currentTime); err != nil {
+			return nil, err
+		}
+	}
+	access.Status = "closed"
+	access.ClosedAt = currentTime
+	access.ClosedBy = actor
+	access.Summary = summary
+	if err := access.appendTrail(ctx, "closed", actor, summary, currentTime); err != nil {
+		return nil, err
+	}
+	if err := uow.PutJSON(emergencyAccessKeyPrefix+accessID, access); err != nil {
+		return nil, err
+	}
+	if err := uow.Commit(); err != nil {
+		return nil, err
+	}
+	if _, err := putAccessLog(ctx, &AccessLogEntry{
+		DeviceID:  access.DeviceID,
+		ClientID:  access.Responder,
+		SessionID: access.SessionID,
+		Action:    accessEmergencyClosed,
+		Detail:    summary,
+	}); err != nil {
+		return nil, err
+	}
+	if err := emitEmergencyAccess(ctx, emergencyAccessClosedEvent, access); err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("Break-glass session %s closed by %s\n", access.SessionID, actor)
+	return access, nil
+}
+
+// GetEmergencyAccess returns a break-glass session and its trail
+func (s *ISVChaincode) GetEmergencyAccess(ctx contractapi.TransactionContextInterface, accessID string) (*EmergencyAccess, error) {
+	return getEmergencyAccess(ctx, accessID)
+}
+
+// GetEmergencyAccesses returns the break-glass sessions of a device, or of
+// every device if deviceID is empty, oldest first
+func (s *ISVChaincode) GetEmergencyAccesses(ctx contractapi.TransactionContextInterface, deviceID string) ([]*EmergencyAccess, error) {
+	iterator, err := ctx.GetStub().GetStateByRange(emergencyAccessKeyPrefix, emergencyAccessKeyPrefix+"~")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get emergency access records: %v", err)
+	}
+	defer iterator.Close()
+
+	accesses := []*EmergencyAccess{}
+	for iterator.HasNext() {
+		queryResponse, err := iterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate emergency access records: %v", err)
+		}
+		var access EmergencyAccess
+		if err := json.Unmarshal(queryResponse.Value, &access); err != nil {
+			fmt.Printf("Error unmarshaling emergency access record: %v\n", err)
+			continue
+		}
+		if deviceID == "" || access.DeviceID == deviceID {
+			accesses = append(accesses, &access)
+		}
+	}
+	// Records are keyed by transaction ID, which is not ordered
+	sort.SliceStable(accesses, func(i, j int) bool {
+		return accesses[i].OpenedAt.Before(accesses[j].OpenedAt)
+	})
+	return accesses, nil
+}
+
+func getEmergencyAccess(ctx contractapi.TransactionContextInterface, accessID string) (*EmergencyAccess, error) {
+	accessJSON, err := ctx.GetStub().GetState(emergencyAccessKeyPrefix + accessID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read emergency access data: %v", err)
+	}
+	if accessJSON == nil {
+		return nil, fmt.Errorf("emergency session %s does not exist", accessID)
+	}
+	var access EmergencyAccess
+	if err := json.Unmarshal(accessJSON, &access); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal emergency access data: %v", err)
+	}
+	return &access, nil
+}
+
+// recordEmergencyStep stages a step of the emergency session a session
+// belongs to: a device response, or its expiry, which also marks the record
+// expired. Sessions opened with a ticket have no emergency record and are
+// left alone.
+func recordEmergencyStep(ctx contractapi.TransactionContextInterface, uow *common.UnitOfWork, session *ClientDeviceSession, action, detail string, now time.Time) error {
+	if session.EmergencyAccessID == "" {
+		return nil
+	}
+	key := emergencyAccessKeyPrefix + session.EmergencyAccessID
+	accessJSON, err := uow.Get(key)
+	if err != nil {
+		return fmt.Errorf("failed to read emergency access data: %v", err)
+	}
+	if accessJSON == nil {
+		return fmt.Errorf("emergency session %s does not exist", session.EmergencyAccessID)
+	}
+	var access EmergencyAccess
+	if err := json.Unmarshal(accessJSON, &access); err != nil {
+		return fmt.Errorf("failed to unmarshal emergency access data: %v", err)
+	}
+	if action == "expired" {
+		access.Status = "expired"
+		access.ClosedAt = now
+	}
+	if err := access.appendTrail(ctx, action, "", detail, now); err != nil {
+		return err
+	}
+	return uow.PutJSON(key, &access)
+}
+
+// emitEmergencyAccess emits a break-glass notification event carrying the
+// record. It must be the transaction's only event.
+func emitEmergencyAccess(ctx contractapi.TransactionContextInterface, eventName string, access *EmergencyAccess) error {
+	accessJSON, err := json.Marshal(access)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s event: %v", eventName, err)
+	}
+	return common.SetEvent(ctx, eventName, accessJSON)
+}
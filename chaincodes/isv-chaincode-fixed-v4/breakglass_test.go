@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blockchain-auth/common"
+	"github.com/blockchain-auth/common/commontest"
+)
+
+func TestHasBreakGlassAttribute(t *testing.T) {
+	tests := []struct {
+		name     string
+		identity *commontest.FakeIdentity
+		want     bool
+		wantErr  bool
+	}{
+		{"break-glass", &commontest.FakeIdentity{Attrs: map[string]string{breakGlassAttribute: "true"}}, true, false},
+		{"no attribute", &commontest.FakeIdentity{}, false, false},
+		{"false", &commontest.FakeIdentity{Attrs: map[string]string{breakGlassAttribute: "false"}}, false, false},
+		{"role only", commontest.WithRole(common.RoleAdmin), false, false},
+		{"unreadable", &commontest.FakeIdentity{Err: errors.New("bad certificate")}, false, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := hasBreakGlassAttribute(test.identity)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("hasBreakGlassAttribute() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("hasBreakGlassAttribute() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestValidateEmergencyReason(t *testing.T) {
+	if got, err := validateEmergencyReason("  AS down, pump 7 overheating  "); err != nil || got != "AS down, pump 7 overheating" {
+		t.Errorf("validateEmergencyReason() = %q, %v", got, err)
+	}
+	for _, reason := range []string{"", "   ", "outage", strings.Repeat("x", maxEmergencyReasonLength+1)} {
+		if _, err := validateEmergencyReason(reason); err == nil {
+			t.Errorf("validateEmergencyReason(%q) succeeded", reason)
+		}
+	}
+}
+
+func TestEmergencySessionLifetime(t *testing.T) {
+	tests := []struct {
+		seconds int64
+		want    time.Duration
+		wantErr bool
+	}{
+		{0, defaultEmergencySessionLifetime * time.Second, false},
+		{600, 10 * time.Minute, false},
+		{maxEmergencySessionLifetime, maxEmergencySessionLifetime * time.Second, false},
+		{maxEmergencySessionLifetime + 1, 0, true},
+		{-1, 0, true},
+	}
+	for _, test := range tests {
+		got, err := emergencySessionLifetime(test.seconds)
+		if (err != nil) != test.wantErr || got != test.want {
+			t.Errorf("emergencySessionLifetime(%d) = %v, %v; want %v, error %v", test.seconds, got, err, test.want, test.wantErr)
+		}
+	}
+}
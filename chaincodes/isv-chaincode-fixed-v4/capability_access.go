@@ -0,0 +1,394 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/blockchain-auth/common"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// A service request names a request type, and a device declares
+// capabilities, but neither says what the client may do with the device.
+// The capability matrix ties them together through three actions: read,
+// write and actuate. It maps each request type to the action it performs
+// and each device capability to the actions it provides. ProcessServiceRequest
+// opens a session only if one of the device's capabilities provides the
+// request's action and the client has been granted that action; otherwise it
+// answers "denied" with the reason in DenyReason. The session holds only the
+// capabilities that provide the action, so a client granted read cannot use
+// it to actuate, and never those of sensitive operations, which need a
+// co-signed approval (see ApproveOperation).
+//
+// A capability the matrix does not list provides the action of the same
+// name, or read if it names none, so sensor capabilities such as
+// "temperature" stay readable. A request type the matrix does not list is
+// denied. Clients hold the matrix's default permissions until
+// SetClientPermissions grants them their own.
+//
+// The matrix and client permissions are set by the admin MSPs, by identities
+// without a role or with the policy-admin and user-admin roles respectively.
+
+const (
+	actionRead    = "read"
+	actionWrite   = "write"
+	actionActuate = "actuate"
+
+	// capabilityMatrixKey holds the CapabilityMatrix once one is set
+	capabilityMatrixKey = "CAPABILITY_MATRIX"
+
+	// clientPermissionsPrefix prefixes the permissions granted to each client
+	clientPermissionsPrefix = "CLIENT_PERMISSIONS_"
+
+	// serviceDenied is the ServiceResponse status of a request the
+	// capability matrix refuses
+	serviceDenied = "denied"
+
+	maxMatrixEntries = 64
+
+	capabilityMatrixSetEvent  = "CapabilityMatrixSet"
+	clientPermissionsSetEvent = "ClientPermissionsSet"
+
+	metricCapabilityDenials = "capability_denials"
+)
+
+// accessActions are the actions a request can perform
+var accessActions = []string{actionRead, actionWrite, actionActuate}
+
+// CapabilityMatrix maps request types and device capabilities to actions.
+// Fields left out of a stored matrix fall back to defaultCapabilityMatrix.
+type CapabilityMatrix struct {
+	RequestTypes       map[string]string   `json:"requestTypes"`       // Request type → action it performs
+	Capabilities       map[string][]string `json:"capabilities"`       // Device capability → actions it provides
+	DefaultPermissions []string            `json:"defaultPermissions"` // Actions of clients without a grant
+	UpdatedAt          time.Time           `json:"updatedAt,omitempty"`
+	UpdatedBy          string              `json:"updatedBy,omitempty"` // MSP of the administrator
+}
+
+// defaultCapabilityMatrix applies until a matrix is stored. Clients without
+// a grant may only read; writing and actuating must be granted.
+var defaultCapabilityMatrix = CapabilityMatrix{
+	RequestTypes: map[string]string{
+		"read":     actionRead,
+		"write":    actionWrite,
+		"actuator": actionActuate,
+		"unlock":   actionActuate,
+	},
+	Capabilities: map[string][]string{
+		"actuator": {actionActuate},
+		"unlock":   {actionActuate},
+	},
+	DefaultPermissions: []string{actionRead},
+}
+
+// ClientPermissions are the actions granted to a client
+type ClientPermissions struct {
+	ClientID  string    `json:"clientID"`
+	Actions   []string  `json:"actions"`
+	GrantedAt time.Time `json:"grantedAt"`
+	GrantedBy string    `json:"grantedBy"` // MSP of the administrator
+}
+
+// parseActions checks a list of actions and returns it sorted and without
+// duplicates
+func parseActions(actions []string) ([]string, error) {
+	seen := make(map[string]bool)
+	parsed := []string{}
+	for _, action := range actions {
+		if !containsString(accessActions, action) {
+			return nil, fmt.Errorf("unknown action %q (expected %s)", action, strings.Join(accessActions, ", "))
+		}
+		if !seen[action] {
+			seen[action] = true
+			parsed = append(parsed, action)
+		}
+	}
+	sort.Strings(parsed)
+	return parsed, nil
+}
+
+// parseCapabilityMatrix parses and checks a capability matrix
+func parseCapabilityMatrix(matrixJSON string) (*CapabilityMatrix, error) {
+	var matrix CapabilityMatrix
+	if err := json.Unmarshal([]byte(matrixJSON), &matrix); err != nil {
+		return nil, fmt.Errorf("invalid capability matrix format (JSON parsing failed): %v", err)
+	}
+	if len(matrix.RequestTypes) > maxMatrixEntries || len(matrix.Capabilities) > maxMatrixEntries {
+		return nil, fmt.Errorf("a capability matrix lists at most %d request types and %d capabilities", maxMatrixEntries, maxMatrixEntries)
+	}
+	for requestType, action := range matrix.RequestTypes {
+		if requestType == "" || !containsString(accessActions, action) {
+			return nil, fmt.Errorf("request type %q must map to one of %s", requestType, strings.Join(accessActions, ", "))
+		}
+	}
+	for capability, actions := range matrix.Capabilities {
+		if capability == "" {
+			return nil, fmt.Errorf("capability names cannot be empty")
+		}
+		parsed, err := parseActions(actions)
+		if err != nil {
+			return nil, fmt.Errorf("capability %q: %v", capability, err)
+		}
+		matrix.Capabilities[capability] = parsed
+	}
+	if matrix.DefaultPermissions != nil {
+		parsed, err := parseActions(matrix.DefaultPermissions)
+		if err != nil {
+			return nil, fmt.Errorf("default permissions: %v", err)
+		}
+		matrix.DefaultPermissions = parsed
+	}
+	return &matrix, nil
+}
+
+// withDefaults fills the fields a stored matrix left out
+func (m *CapabilityMatrix) withDefaults() *CapabilityMatrix {
+	if m.RequestTypes == nil {
+		m.RequestTypes = defaultCapabilityMatrix.RequestTypes
+	}
+	if m.Capabilities == nil {
+		m.Capabilities = defaultCapabilityMatrix.Capabilities
+	}
+	if m.DefaultPermissions == nil {
+		m.DefaultPermissions = defaultCapabilityMatrix.DefaultPermissions
+	}
+	return m
+}
+
+// capabilityActions returns the actions a device capability provides
+func (m *CapabilityMatrix) capabilityActions(capability string) []string {
+	if actions, ok := m.Capabilities[capability]; ok {
+		return actions
+	}
+	if containsString(accessActions, capability) {
+		return []string{capability}
+	}
+	return []string{actionRead}
+}
+
+// denyReason returns why a client with permissions may not make a request
+// of requestType to a device with capabilities, or "" if it may
+func (m *CapabilityMatrix) denyReason(requestType string, capabilities []string, permissions []string) string {
+	action, ok := m.RequestTypes[requestType]
+	if !ok {
+		return fmt.Sprintf("request type %q is not in the capability matrix", requestType)
+	}
+	provided := false
+	for _, capability := range capabilities {
+		provided = provided || containsString(m.capabilityActions(capability), action)
+	}
+	if !provided {
+		return fmt.Sprintf("%s requests need %s access, which no capability of the device provides", requestType, action)
+	}
+	if !containsString(permissions, action) {
+		return fmt.Sprintf("client is not granted %s access", action)
+	}
+	return ""
+}
+
+// grantedCapabilities returns the capabilities of a device that provide the
+// action of requestType. A session opened for the request holds only these.
+func (m *CapabilityMatrix) grantedCapabilities(requestType string, capabilities []string) []string {
+	action := m.RequestTypes[requestType]
+	granted := []string{}
+	for _, capability := range capabilities {
+		if containsString(m.capabilityActions(capability), action) {
+			granted = append(granted, capability)
+		}
+	}
+	return granted
+}
+
+// getCapabilityMatrix returns the stored matrix, or the default one
+func getCapabilityMatrix(store common.StateStore) (*CapabilityMatrix, error) {
+	matrixJSON, err := store.GetState(capabilityMatrixKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read capability matrix: %v", err)
+	}
+	if matrixJSON == nil {
+		matrix := defaultCapabilityMatrix
+		return &matrix, nil
+	}
+	var matrix CapabilityMatrix
+	if err := json.Unmarshal(matrixJSON, &matrix); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal capability matrix: %v", err)
+	}
+	return matrix.withDefaults(), nil
+}
+
+// getClientPermissions returns the permissions granted to a client, or nil
+// if it holds the matrix's default permissions
+func getClientPermissions(store common.StateStore, clientID string) (*ClientPermissions, error) {
+	permissionsJSON, err := store.GetState(clientPermissionsPrefix + clientID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client permissions: %v", err)
+	}
+	if permissionsJSON == nil {
+		return nil, nil
+	}
+	var permissions ClientPermissions
+	if err := json.Unmarshal(permissionsJSON, &permissions); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal permissions of %s: %v", clientID, err)
+	}
+	return &permissions, nil
+}
+
+// checkCapabilityAccess returns the capabilities a session opened for the
+// request may hold, or records a denial and returns its reason if the
+// capability matrix refuses the request
+func (s *ISVChaincode) checkCapabilityAccess(ctx contractapi.TransactionContextInterface, request ServiceRequest) ([]string, string, error) {
+	matrix, err := getCapabilityMatrix(ctx.GetStub())
+	if err != nil {
+		return nil, "", err
+	}
+	device, err := s.getDevice(ctx, request.DeviceID)
+	if err != nil {
+		return nil, "", err
+	}
+	capabilities, err := deviceCapabilities(ctx, device, 0)
+	if err != nil {
+		return nil, "", err
+	}
+	permissions := matrix.DefaultPermissions
+	granted, err := getClientPermissions(ctx.GetStub(), request.ClientID)
+	if err != nil {
+		return nil, "", err
+	}
+	if granted != nil {
+		permissions = granted.Actions
+	}
+
+	reason := matrix.denyReason(request.RequestType, capabilities, permissions)
+	if reason == "" {
+		capabilities = matrix.grantedCapabilities(request.RequestType, capabilities)
+		if isSensitiveOperation(request.RequestType) {
+			return capabilities, "", nil
+		}
+		// Requests that need no approval never open a sensitive operation
+		if capabilities = withoutSensitiveOperations(capabilities); len(capabilities) > 0 {
+			return capabilities, "", nil
+		}
+		action := matrix.RequestTypes[request.RequestType]
+		reason = fmt.Sprintf("%s requests need %s access, which only capabilities needing approval provide", request.RequestType, action)
+	}
+	if err := common.IncrementMetric(ctx, metricCapabilityDenials); err != nil {
+		return nil, "", err
+	}
+	if err := recordAccessLog(ctx, request.DeviceID, request.ClientID, "", accessDenied, reason); err != nil {
+		return nil, "", err
+	}
+	return nil, reason, nil
+}
+
+// SetCapabilityMatrix stores the capability matrix; "{}" restores the
+// default
+func (s *ISVChaincode) SetCapabilityMatrix(ctx contractapi.TransactionContextInterface, matrixJSON string) (*CapabilityMatrix, error) {
+	matrix, err := parseCapabilityMatrix(matrixJSON)
+	if err != nil {
+		return nil, err
+	}
+	mspID, err := callerMSP(ctx)
+	if err != nil {
+		return nil, err
+	}
+	currentTime, err := common.GetDeterministicTimestamp(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current timestamp: %v", err)
+	}
+	matrix.UpdatedAt = currentTime.UTC()
+	matrix.UpdatedBy = mspID
+
+	uow := common.NewUnitOfWork(ctx)
+	if err := uow.PutJSON(capabilityMatrixKey, matrix); err != nil {
+		return nil, err
+	}
+	if err := uow.Commit(); err != nil {
+		return nil, err
+	}
+
+	matrix.withDefaults()
+	matrixEventJSON, err := json.Marshal(matrix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal capability matrix: %v", err)
+	}
+	if err := common.SetEvent(ctx, capabilityMatrixSetEvent, matrixEventJSON); err != nil {
+		return nil, fmt.Errorf("failed to emit capability matrix event: %v", err)
+	}
+
+	fmt.Printf("Capability matrix set by %s\n", mspID)
+	return matrix, nil
+}
+
+// GetCapabilityMatrix returns the capability matrix in force
+func (s *ISVChaincode) GetCapabilityMatrix(ctx contractapi.TransactionContextInterface) (*CapabilityMatrix, error) {
+	return getCapabilityMatrix(ctx.GetStub())
+}
+
+// SetClientPermissions grants a client the actions in actionsJSON, a JSON
+// array, replacing its earlier grant. An empty array grants none; "null"
+// returns the client to the matrix's default permissions. Sessions already
+// open are not affected.
+func (s *ISVChaincode) SetClientPermissions(ctx contractapi.TransactionContextInterface, clientID string, actionsJSON string) (*ClientPermissions, error) {
+	if clientID == "" {
+		return nil, fmt.Errorf("client ID is required")
+	}
+	var actions []string
+	if err := json.Unmarshal([]byte(actionsJSON), &actions); err != nil {
+		return nil, fmt.Errorf("invalid actions (expected a JSON array of actions): %v", err)
+	}
+	mspID, err := callerMSP(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if actions == nil {
+		if err := ctx.GetStub().DelState(clientPermissionsPrefix + clientID); err != nil {
+			return nil, fmt.Errorf("failed to delete client permissions: %v", err)
+		}
+		fmt.Printf("Client %s holds the default permissions again\n", clientID)
+		return nil, nil
+	}
+
+	parsed, err := parseActions(actions)
+	if err != nil {
+		return nil, err
+	}
+	currentTime, err := common.GetDeterministicTimestamp(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current timestamp: %v", err)
+	}
+	permissions := &ClientPermissions{
+		ClientID:  clientID,
+		Actions:   parsed,
+		GrantedAt: currentTime.UTC(),
+		GrantedBy: mspID,
+	}
+
+	uow := common.NewUnitOfWork(ctx)
+	if err := uow.PutJSON(clientPermissionsPrefix+clientID, permissions); err != nil {
+		return nil, err
+	}
+	if err := uow.Commit(); err != nil {
+		return nil, err
+	}
+
+	permissionsJSON, err := json.Marshal(permissions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal client permissions: %v", err)
+	}
+	if err := common.SetEvent(ctx, clientPermissionsSetEvent, permissionsJSON); err != nil {
+		return nil, fmt.Errorf("failed to emit client permissions event: %v", err)
+	}
+
+	fmt.Printf("Client %s granted %s by %s\n", clientID, strings.Join(parsed, ","), mspID)
+	return permissions, nil
+}
+
+// GetClientPermissions returns the permissions granted to a client, or
+// nothing if it holds the matrix's default permissions
+func (s *ISVChaincode) GetClientPermissions(ctx contractapi.TransactionContextInterface, clientID string) (*ClientPermissions, error) {
+	return getClientPermissions(ctx.GetStub(), clientID)
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"strings"
+	"testing"
+
+	"github.com/blockchain-auth/common"
+	"github.com/blockchain-auth/common/commontest"
+	"github.com/hyperledger/fabric-chaincode-go/shimtest"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+func TestDenyReason(t *testing.T) {
+	matrix := defaultCapabilityMatrix
+	all := accessActions
+
+	tests := []struct {
+		name         string
+		requestType  string
+		capabilities []string
+		permissions  []string
+		denied       string // Substring of the reason, "" if granted
+	}{
+		{"sensor read", "read", []string{"temperature", "humidity"}, all, ""},
+		{"sensor write", "write", []string{"temperature"}, all, "no capability"},
+		{"declared write", "write", []string{"temperature", "write"}, all, ""},
+		{"actuator", "actuator", []string{"actuator"}, all, ""},
+		{"unlock on sensor", "unlock", []string{"temperature"}, all, "actuate access"},
+		{"unknown request type", "reboot", []string{"actuator"}, all, "not in the capability matrix"},
+		{"not granted", "actuator", []string{"actuator"}, []string{actionRead}, "not granted actuate"},
+		{"no permissions", "read", []string{"temperature"}, []string{}, "not granted read"},
+	}
+	for _, test := range tests {
+		reason := matrix.denyReason(test.requestType, test.capabilities, test.permissions)
+		if test.denied == "" && reason != "" {
+			t.Errorf("%s: denied: %s", test.name, reason)
+		}
+		if test.denied != "" && !strings.Contains(reason, test.denied) {
+			t.Errorf("%s: reason %q, want it to mention %q", test.name, reason, test.denied)
+		}
+	}
+}
+
+func TestCapabilityActionsFromMatrix(t *testing.T) {
+	matrix, err := parseCapabilityMatrix(`{"capabilities": {"temperature": ["read", "write"], "camera": []}}`)
+	if err != nil {
+		t.Fatalf("parseCapabilityMatrix: %v", err)
+	}
+	matrix.withDefaults()
+	if reason := matrix.denyReason("write", []string{"temperature"}, accessActions); reason != "" {
+		t.Errorf("listed capability: %s", reason)
+	}
+	if reason := matrix.denyReason("read", []string{"camera"}, accessActions); reason == "" {
+		t.Error("a capability listed with no actions provided read")
+	}
+	if len(matrix.RequestTypes) == 0 || len(matrix.DefaultPermissions) != 1 {
+		t.Error("fields left out did not fall back to the default matrix")
+	}
+}
+
+func TestDefaultPermissionsOnlyRead(t *testing.T) {
+	matrix := defaultCapabilityMatrix
+	permissions := matrix.DefaultPermissions
+	if reason := matrix.denyReason("read", []string{"temperature"}, permissions); reason != "" {
+		t.Errorf("a client without a grant could not read: %s", reason)
+	}
+	if reason := matrix.denyReason("write", []string{"write"}, permissions); !strings.Contains(reason, "not granted write") {
+		t.Errorf("a client without a grant could write: %q", reason)
+	}
+	if reason := matrix.denyReason("unlock", []string{"unlock"}, permissions); !strings.Contains(reason, "not granted actuate") {
+		t.Errorf("a client without a grant could actuate: %q", reason)
+	}
+}
+
+func TestParseCapabilityMatrix(t *testing.T) {
+	for _, matrixJSON := range []string{
+		`{"requestTypes": {"read": "view"}}`,
+		`{"requestTypes": {"": "read"}}`,
+		`{"capabilities": {"door": ["open"]}}`,
+		`{"defaultPermissions": ["read", "admin"]}`,
+		`not json`,
+	} {
+		if _, err := parseCapabilityMatrix(matrixJSON); err == nil {
+			t.Errorf("parseCapabilityMatrix(%s) accepted an invalid matrix", matrixJSON)
+		}
+	}
+
+	matrix, err := parseCapabilityMatrix(`{"defaultPermissions": []}`)
+	if err != nil {
+		t.Fatalf("parseCapabilityMatrix: %v", err)
+	}
+	if matrix.withDefaults(); len(matrix.DefaultPermissions) != 0 {
+		t.Errorf("an empty default grant became %v", matrix.DefaultPermissions)
+	}
+}
+
+func TestParseActions(t *testing.T) {
+	actions, err := parseActions([]string{"write", "read", "write"})
+	if err != nil {
+		t.Fatalf("parseActions: %v", err)
+	}
+	if strings.Join(actions, ",") != "read,write" {
+		t.Errorf("parseActions() = %v, want [read write]", actions)
+	}
+	if _, err := parseActions([]string{"delete"}); err == nil {
+		t.Error("parseActions accepted an unknown action")
+	}
+}
+
+func TestGetCapabilityMatrixDefault(t *testing.T) {
+	store := commontest.NewMemoryStore(nil)
+	matrix, err := getCapabilityMatrix(store)
+	if err != nil {
+		t.Fatalf("getCapabilityMatrix: %v", err)
+	}
+	if matrix.RequestTypes["unlock"] != actionActuate {
+		t.Errorf("default matrix maps unlock to %q", matrix.RequestTypes["unlock"])
+	}
+	permissions, err := getClientPermissions(store, "client1")
+	if err != nil || permissions != nil {
+		t.Errorf("getClientPermissions() = %v, %v, want no grant", permissions, err)
+	}
+}
+
+func TestCapabilitySettersNeedAdmin(t *testing.T) {
+	org1 := &commontest.FakeIdentity{MSPID: "Org1MSP"}
+	org2 := &commontest.FakeIdentity{MSPID: "Org2MSP"}
+	policyAdmin := &commontest.FakeIdentity{Attrs: map[string]string{common.RoleAttribute: common.RolePolicyAdmin}, MSPID: "Org2MSP"}
+
+	for _, function := range []string{"SetCapabilityMatrix", "SetClientPermissions"} {
+		stub := commontest.NewInvocation(function, "{}")
+		if err := beforeTransaction(commontest.NewContext(stub, org1)); err == nil {
+			t.Errorf("%s was open before the admin MSPs were set", function)
+		}
+
+		stub.State[common.AdminMSPsKey] = []byte(`["Org1MSP"]`)
+		if err := beforeTransaction(commontest.NewContext(stub, org1)); err != nil {
+			t.Errorf("%s was refused to the admin MSP: %v", function, err)
+		}
+		if err := beforeTransaction(commontest.NewContext(stub, org2)); err == nil {
+			t.Errorf("%s was open to another MSP", function)
+		}
+		if err := beforeTransaction(commontest.NewContext(stub, policyAdmin)); err == nil {
+			t.Errorf("%s was open to a role from another MSP", function)
+		}
+	}
+}
+
+func TestGrantedCapabilities(t *testing.T) {
+	matrix := defaultCapabilityMatrix
+	capabilities := []string{"temperature", "write", "actuator", "unlock"}
+
+	tests := []struct {
+		requestType string
+		want        string
+	}{
+		{"read", "temperature"},
+		{"write", "write"},
+		{"actuator", "actuator,unlock"},
+	}
+	for _, test := range tests {
+		if got := matrix.grantedCapabilities(test.requestType, capabilities); strings.Join(got, ",") != test.want {
+			t.Errorf("grantedCapabilities(%s) = %v, want %s", test.requestType, got, test.want)
+		}
+	}
+}
+
+// newServiceRequestLedger returns an ISV ledger with a key pair and the
+// device device1, and a request of requestType for it by client1 with a
+// service ticket sealed to the ISV key
+func newServiceRequestLedger(t *testing.T, capabilities []string, requestType string) (*ISVChaincode, *shimtest.MockStub, contractapi.TransactionContextInterface, string) {
+	t.Helper()
+	s := &ISVChaincode{}
+	stub := commontest.NewStub("isv")
+	ctx := commontest.NewContext(stub, &commontest.FakeIdentity{MSPID: "Org1MSP"})
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub.State["ISV_PRIVATE_KEY"] = pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)})
+	deviceJSON, _ := json.Marshal(IoTDevice{DeviceID: "device1", Status: "active", Capabilities: capabilities})
+	stub.State["DEVICE_device1"] = deviceJSON
+
+	now, err := common.GetDeterministicTimestamp(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ticketJSON, _ := json.Marshal(ServiceTicket{ClientID: "client1", SessionKey: "c2Vzc2lvbi1rZXk=", Timestamp: now, Lifetime: 3600})
+	sealed, err := common.EncryptForService(ctx, &privateKey.PublicKey, ticketJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	requestJSON, _ := json.Marshal(ServiceRequest{
+		EncryptedServiceTicket: base64.StdEncoding.EncodeToString(sealed),
+		ClientID:               "client1",
+		DeviceID:               "device1",
+		RequestType:            requestType,
+	})
+	return s, stub, ctx, string(requestJSON)
+}
+
+func TestSessionBoundToRequestedAction(t *testing.T) {
+	s, _, ctx, requestJSON := newServiceRequestLedger(t, []string{"temperature", "actuator"}, "read")
+	response, err := s.ProcessServiceRequest(ctx, requestJSON)
+	if err != nil {
+		t.Fatalf("ProcessServiceRequest failed: %v", err)
+	}
+	if response.Status != "granted" {
+		t.Fatalf("read request answered %s (%s)", response.Status, response.DenyReason)
+	}
+
+	session, err := getSession(ctx, response.SessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(session.Capabilities, ",") != "temperature" {
+		t.Errorf("read session holds %v, want only temperature", session.Capabilities)
+	}
+	for capability, want := range map[string]bool{"temperature": true, "actuator": false} {
+		if held, err := s.CheckSessionCapability(ctx, response.SessionID, capability); err != nil || held != want {
+			t.Errorf("CheckSessionCapability(%s) = %v, %v, want %v", capability, held, err, want)
+		}
+	}
+}
+
+func TestReadSessionCannotUnlock(t *testing.T) {
+	s, stub, ctx, requestJSON := newServiceRequestLedger(t, []string{"temperature", "unlock"}, "read")
+	// Even a matrix that lets unlock provide read keeps it out of a session
+	// nobody co-signed
+	stub.State[capabilityMatrixKey] = []byte(`{"capabilities": {"unlock": ["read", "actuate"]}}`)
+
+	response, err := s.ProcessServiceRequest(ctx, requestJSON)
+	if err != nil {
+		t.Fatalf("ProcessServiceRequest failed: %v", err)
+	}
+	if response.Status != "granted" {
+		t.Fatalf("read request answered %s (%s)", response.Status, response.DenyReason)
+	}
+	if held, err := s.CheckSessionCapability(ctx, response.SessionID, "unlock"); err != nil || held {
+		t.Errorf("CheckSessionCapability(unlock) = %v, %v, want a read session refused", held, err)
+	}
+	if held, err := s.CheckSessionCapability(ctx, response.SessionID, "temperature"); err != nil || !held {
+		t.Errorf("CheckSessionCapability(temperature) = %v, %v, want it held", held, err)
+	}
+}
+
+func TestRequestOnlySensitiveCapabilitiesProvide(t *testing.T) {
+	s, stub, ctx, requestJSON := newServiceRequestLedger(t, []string{"unlock"}, "read")
+	stub.State[capabilityMatrixKey] = []byte(`{"capabilities": {"unlock": ["read", "actuate"]}}`)
+
+	response, err := s.ProcessServiceRequest(ctx, requestJSON)
+	if err != nil {
+		t.Fatalf("ProcessServiceRequest failed: %v", err)
+	}
+	if response.Status != serviceDenied || !strings.Contains(response.DenyReason, "needing approval") {
+		t.Errorf("read request answered %s (%s), want it denied", response.Status, response.DenyReason)
+	}
+}
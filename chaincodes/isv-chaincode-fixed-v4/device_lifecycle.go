@@ -0,0 +1,295 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/blockchain-auth/common"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// A device taken out of service, for repair or storage, is decommissioned:
+// DecommissionDevice closes its live sessions in the same transaction and
+// the device refuses new ones until ReactivateDevice puts it back in
+// service. A device that leaves for good is then deregistered:
+// DeregisterIoTDevice deletes its record and configuration, and the ID can
+// be registered again with a new key. Its history and access logs stay on
+// the ledger.
+//
+//	active, inactive, busy --DecommissionDevice--> decommissioned
+//	decommissioned --ReactivateDevice--> active
+//	decommissioned, revoked --DeregisterIoTDevice--> (deleted)
+//
+// Only the organization that registered a device may change its lifecycle,
+// or an admin MSP for devices registered before owners were recorded, as
+// with RevokeDevices.
+
+// DeviceLifecycleResult reports a lifecycle change
+type DeviceLifecycleResult struct {
+	DeviceID       string   `json:"deviceID"`
+	Status         string   `json:"status"` // New status; deviceStatusDeregistered once deleted
+	ClosedSessions []string `json:"closedSessions"`
+}
+
+const (
+	deviceStatusDecommissioned = "decommissioned"
+	// deviceStatusDeregistered is reported for a deleted device; no record
+	// has it
+	deviceStatusDeregistered = "deregistered"
+
+	accessDeviceDecommissioned = "device_decommissioned"
+	accessDeviceReactivated    = "device_reactivated"
+	accessDeviceDeregistered   = "device_deregistered"
+
+	deviceDecommissionedEvent = "DeviceDecommissioned"
+	deviceReactivatedEvent    = "DeviceReactivated"
+	deviceDeregisteredEvent   = "DeviceDeregistered"
+
+	metricDevicesDecommissioned = "devices_decommissioned"
+	metricDevicesDeregistered   = "devices_deregistered"
+)
+
+// outOfService reports whether the device is revoked or decommissioned.
+// Closing a session or UpdateDeviceStatus leaves such a device's status
+// alone.
+func (device *IoTDevice) outOfService() bool {
+	return device.Status == deviceStatusRevoked || device.Status == deviceStatusDecommissioned
+}
+
+// checkLifecycleTransition returns why a device with the given status
+// cannot take the lifecycle action (one of the access* actions above), or
+// nil if it can
+func checkLifecycleTransition(deviceID string, status string, action string) error {
+	switch action {
+	case accessDeviceDecommissioned:
+		switch status {
+		case deviceStatusDecommissioned:
+			return fmt.Errorf("device %s is already decommissioned", deviceID)
+		case deviceStatusRevoked:
+			return fmt.Errorf("device %s is revoked", deviceID)
+		}
+		return nil
+	case accessDeviceReactivated:
+		if status != deviceStatusDecommissioned {
+			return fmt.Errorf("device %s is %s, only a decommissioned device can be reactivated", deviceID, status)
+		}
+		return nil
+	case accessDeviceDeregistered:
+		if status != deviceStatusDecommissioned && status != deviceStatusRevoked {
+			return fmt.Errorf("device %s is %s; decommission it before deregistering it", deviceID, status)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown lifecycle action %q", action)
+}
+
+// checkLifecycleReason checks the reason given for a decommission or
+// deregistration
+func checkLifecycleReason(reason string) error {
+	if strings.TrimSpace(reason) == "" {
+		return fmt.Errorf("a reason is required")
+	}
+	if len(reason) > maxRevocationReasonLength {
+		return fmt.Errorf("reason is %d characters, the limit is %d", len(reason), maxRevocationReasonLength)
+	}
+	return nil
+}
+
+// getManagedDevice reads a device for a lifecycle action, checking the
+// caller's organization may manage it and the transition is allowed
+func (s *ISVChaincode) getManagedDevice(ctx contractapi.TransactionContextInterface, deviceID string, action string) (*IoTDevice, string, error) {
+	device, err := s.getDevice(ctx, deviceID)
+	if err != nil {
+		return nil, "", err
+	}
+	adminMSPs, err := common.GetAdminMSPs(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	mspID, err := callerMSP(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	if !mayRevoke(device, mspID, adminMSPs) {
+		return nil, "", fmt.Errorf("device %s was registered by another organization", deviceID)
+	}
+	if err := checkLifecycleTransition(deviceID, device.Status, action); err != nil {
+		return nil, "", err
+	}
+	return device, mspID, nil
+}
+
+// closeDeviceSessions closes the device's active sessions, break-glass
+// sessions included, logging detail as the reason
+func (s *ISVChaincode) closeDeviceSessions(ctx contractapi.TransactionContextInterface, uow *common.UnitOfWork, deviceID string, detail string, now time.Time) ([]string, error) {
+	sessions, err := activeSessions(ctx, sessionsByDeviceIndex, deviceID, func(session *ClientDeviceSession) bool {
+		return session.DeviceID == deviceID
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	closed := []string{}
+	for _, session := range sessions {
+		if err := terminateSession(ctx, uow, session.SessionID, session, now); err != nil {
+			return nil, fmt.Errorf("failed to close session %s: %v", session.SessionID, err)
+		}
+		if _, err := putAccessLog(ctx, &AccessLogEntry{
+			DeviceID:  deviceID,
+			ClientID:  session.ClientID,
+			SessionID: session.SessionID,
+			Action:    accessSessionClosed,
+			Detail:    detail,
+		}, session.SessionID); err != nil {
+			return nil, err
+		}
+		closed = append(closed, session.SessionID)
+	}
+	return closed, nil
+}
+
+// DecommissionDevice takes a device out of service and closes its sessions
+func (s *ISVChaincode) DecommissionDevice(ctx contractapi.TransactionContextInterface, deviceID string, reason string) (*DeviceLifecycleResult, error) {
+	if err := checkLifecycleReason(reason); err != nil {
+		return nil, err
+	}
+	_, mspID, err := s.getManagedDevice(ctx, deviceID, accessDeviceDecommissioned)
+	if err != nil {
+		return nil, err
+	}
+	currentTime, err := common.GetDeterministicTimestamp(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current timestamp: %v", err)
+	}
+
+	uow := common.NewUnitOfWork(ctx)
+	closed, err := s.closeDeviceSessions(ctx, uow, deviceID, accessDeviceDecommissioned, currentTime)
+	if err != nil {
+		return nil, err
+	}
+
+	// The device is read again so the change lands on top of the session
+	// closes staged above
+	deviceKey := "DEVICE_" + deviceID
+	deviceJSON, err := uow.Get(deviceKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read device data: %v", err)
+	}
+	var device IoTDevice
+	if err := json.Unmarshal(deviceJSON, &device); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal device %s: %v", deviceID, err)
+	}
+	decommissionedAt := currentTime.UTC()
+	device.DeviceID = deviceID
+	device.Status = deviceStatusDecommissioned
+	device.DecommissionedAt = &decommissionedAt
+	device.DecommissionReason = reason
+	if err := uow.PutJSON(deviceKey, &device); err != nil {
+		return nil, err
+	}
+	if err := uow.IncrementMetric(metricDevicesDecommissioned); err != nil {
+		return nil, err
+	}
+	if _, err := putAccessLog(ctx, &AccessLogEntry{
+		DeviceID: deviceID,
+		ClientID: mspID,
+		Action:   accessDeviceDecommissioned,
+		Detail:   reason,
+	}, deviceID); err != nil {
+		return nil, err
+	}
+	if err := uow.Commit(); err != nil {
+		return nil, err
+	}
+	if err := emitDeviceChange(ctx, deviceDecommissionedEvent, deviceID, device.Status); err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("Device %s decommissioned by %s, closed %d sessions\n", deviceID, mspID, len(closed))
+	return &DeviceLifecycleResult{DeviceID: deviceID, Status: device.Status, ClosedSessions: closed}, nil
+}
+
+// ReactivateDevice puts a decommissioned device back in service
+func (s *ISVChaincode) ReactivateDevice(ctx contractapi.TransactionContextInterface, deviceID string) (*DeviceLifecycleResult, error) {
+	device, mspID, err := s.getManagedDevice(ctx, deviceID, accessDeviceReactivated)
+	if err != nil {
+		return nil, err
+	}
+	currentTime, err := common.GetDeterministicTimestamp(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current timestamp: %v", err)
+	}
+
+	device.DeviceID = deviceID
+	device.Status = "active"
+	device.LastSeen = currentTime
+	device.DecommissionedAt = nil
+	device.DecommissionReason = ""
+	uow := common.NewUnitOfWork(ctx)
+	if err := uow.PutJSON("DEVICE_"+deviceID, device); err != nil {
+		return nil, err
+	}
+	if _, err := putAccessLog(ctx, &AccessLogEntry{
+		DeviceID: deviceID,
+		ClientID: mspID,
+		Action:   accessDeviceReactivated,
+	}, deviceID); err != nil {
+		return nil, err
+	}
+	if err := uow.Commit(); err != nil {
+		return nil, err
+	}
+	if err := emitDeviceChange(ctx, deviceReactivatedEvent, deviceID, device.Status); err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("Device %s reactivated by %s\n", deviceID, mspID)
+	return &DeviceLifecycleResult{DeviceID: deviceID, Status: device.Status, ClosedSessions: []string{}}, nil
+}
+
+// DeregisterIoTDevice deletes a decommissioned or revoked device and its
+// configuration. Its sessions were closed when it left service; any still
+// active, such as a break-glass session on a revoked device, are closed too.
+func (s *ISVChaincode) DeregisterIoTDevice(ctx contractapi.TransactionContextInterface, deviceID string, reason string) (*DeviceLifecycleResult, error) {
+	if err := checkLifecycleReason(reason); err != nil {
+		return nil, err
+	}
+	_, mspID, err := s.getManagedDevice(ctx, deviceID, accessDeviceDeregistered)
+	if err != nil {
+		return nil, err
+	}
+	currentTime, err := common.GetDeterministicTimestamp(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current timestamp: %v", err)
+	}
+
+	uow := common.NewUnitOfWork(ctx)
+	closed, err := s.closeDeviceSessions(ctx, uow, deviceID, accessDeviceDeregistered, currentTime)
+	if err != nil {
+		return nil, err
+	}
+	uow.Del("DEVICE_" + deviceID)
+	uow.Del("CONFIG_" + deviceID)
+	if err := uow.IncrementMetric(metricDevicesDeregistered); err != nil {
+		return nil, err
+	}
+	if _, err := putAccessLog(ctx, &AccessLogEntry{
+		DeviceID: deviceID,
+		ClientID: mspID,
+		Action:   accessDeviceDeregistered,
+		Detail:   reason,
+	}, deviceID); err != nil {
+		return nil, err
+	}
+	if err := uow.Commit(); err != nil {
+		return nil, err
+	}
+	if err := emitDeviceChange(ctx, deviceDeregisteredEvent, deviceID, deviceStatusDeregistered); err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("Device %s deregistered by %s\n", deviceID, mspID)
+	return &DeviceLifecycleResult{DeviceID: deviceID, Status: deviceStatusDeregistered, ClosedSessions: closed}, nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckLifecycleTransition(t *testing.T) {
+	tests := []struct {
+		status string
+		action string
+		ok     bool
+	}{
+		{"active", accessDeviceDecommissioned, true},
+		{"inactive", accessDeviceDecommissioned, true},
+		{"busy", accessDeviceDecommissioned, true},
+		{deviceStatusDecommissioned, accessDeviceDecommissioned, false},
+		{deviceStatusRevoked, accessDeviceDecommissioned, false},
+		{deviceStatusDecommissioned, accessDeviceReactivated, true},
+		{"active", accessDeviceReactivated, false},
+		{deviceStatusRevoked, accessDeviceReactivated, false},
+		{deviceStatusDecommissioned, accessDeviceDeregistered, true},
+		{deviceStatusRevoked, accessDeviceDeregistered, true},
+		{"active", accessDeviceDeregistered, false},
+		{"busy", accessDeviceDeregistered, false},
+		{"active", accessDeviceRevoked, false},
+	}
+	for _, test := range tests {
+		t.Run(test.status+" "+test.action, func(t *testing.T) {
+			err := checkLifecycleTransition("device1", test.status, test.action)
+			if (err == nil) != test.ok {
+				t.Errorf("checkLifecycleTransition(%q, %q) = %v, want ok %v", test.status, test.action, err, test.ok)
+			}
+		})
+	}
+}
+
+func TestCheckLifecycleReason(t *testing.T) {
+	if err := checkLifecycleReason("moved to storage"); err != nil {
+		t.Errorf("checkLifecycleReason() = %v", err)
+	}
+	for _, reason := range []string{"", "  ", strings.Repeat("r", maxRevocationReasonLength+1)} {
+		if err := checkLifecycleReason(reason); err == nil {
+			t.Errorf("checkLifecycleReason(%.10q) succeeded, want an error", reason)
+		}
+	}
+}
+
+func TestOutOfService(t *testing.T) {
+	for status, want := range map[string]bool{
+		"active":                   false,
+		"busy":                     false,
+		"inactive":                 false,
+		deviceStatusDecommissioned: true,
+		deviceStatusRevoked:        true,
+	} {
+		device := IoTDevice{Status: status}
+		if got := device.outOfService(); got != want {
+			t.Errorf("outOfService() with status %s = %v, want %v", status, got, want)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// A composite index finds records by an attribute without scanning every
+// key of their prefix. Each indexed record has one entry per index, the
+// composite key (index name, attributes..., record key); the entry's value
+// is a placeholder, since the record is read through its key.
+//
+// Indexes added in an upgrade start out empty for the records already on
+// the ledger. Queries use an index only once it is marked ready: on a new
+// ledger Initialize marks every index ready, on an upgraded one
+// RebuildIndexes backfills the entries and then marks them ready. Until
+// then queries fall back to scanning.
+
+// compositeIndex describes one index over the records under keyPrefix
+type compositeIndex struct {
+	name      string // object type of the entries' composite keys
+	keyPrefix string // prefix of the keys of the indexed records
+	// attributes returns the index attributes of a record, or nil if the
+	// value under the prefix is not an indexed record
+	attributes func(value []byte) []string
+}
+
+// indexEntryValue is stored under every index entry; Fabric does not store
+// empty values
+var indexEntryValue = []byte{0x00}
+
+// indexReadyPrefix prefixes the key marking an index as complete
+const indexReadyPrefix = "INDEX_READY_"
+
+var (
+	sessionsByClientIndex = &compositeIndex{
+		name:      "SESSION_BY_CLIENT",
+		keyPrefix: "SESSION_",
+		attributes: func(value []byte) []string {
+			var session ClientDeviceSession
+			if json.Unmarshal(value, &session) != nil || session.ClientID == "" {
+				return nil
+			}
+			return []string{session.ClientID}
+		},
+	}
+	sessionsByDeviceIndex = &compositeIndex{
+		name:      "SESSION_BY_DEVICE",
+		keyPrefix: "SESSION_",
+		attributes: func(value []byte) []string {
+			var session ClientDeviceSession
+			if json.Unmarshal(value, &session) != nil || session.DeviceID == "" {
+				return nil
+			}
+			return []string{session.DeviceID}
+		},
+	}
+)
+
+// compositeIndexes are the indexes RebuildIndexes maintains
+var compositeIndexes = []*compositeIndex{sessionsByClientIndex, sessionsByDeviceIndex}
+
+// sessionIndexes are the indexes over session records
+var sessionIndexes = []*compositeIndex{sessionsByClientIndex, sessionsByDeviceIndex}
+
+// entryKey returns the key of the index entry for a record
+func (index *compositeIndex) entryKey(ctx contractapi.TransactionContextInterface, key string, attributes []string) (string, error) {
+	entryKey, err := ctx.GetStub().CreateCompositeKey(index.name, append(append([]string{}, attributes...), key))
+	if err != nil {
+		return "", fmt.Errorf("failed to create %s index key: %v", index.name, err)
+	}
+	return entryKey, nil
+}
+
+// putIndexEntries adds a record to indexes. A record without index
+// attributes is skipped.
+func putIndexEntries(ctx contractapi.TransactionContextInterface, key string, value []byte, indexes ...*compositeIndex) error {
+	for _, index := range indexes {
+		attributes := index.attributes(value)
+		if attributes == nil {
+			continue
+		}
+		entryKey, err := index.entryKey(ctx, key, attributes)
+		if err != nil {
+			return err
+		}
+		if err := ctx.GetStub().PutState(entryKey, indexEntryValue); err != nil {
+			return fmt.Errorf("failed to store %s index entry: %v", index.name, err)
+		}
+	}
+	return nil
+}
+
+// deleteIndexEntries removes a record from indexes. value is the record as
+// it was indexed, so a record whose attributes change is deleted with its
+// old value and put with its new one.
+func deleteIndexEntries(ctx contractapi.TransactionContextInterface, key string, value []byte, indexes ...*compositeIndex) error {
+	for _, index := range indexes {
+		attributes := index.attributes(value)
+		if attributes == nil {
+			continue
+		}
+		entryKey, err := index.entryKey(ctx, key, attributes)
+		if err != nil {
+			return err
+		}
+		if err := ctx.GetStub().DelState(entryKey); err != nil {
+			return fmt.Errorf("failed to delete %s index entry: %v", index.name, err)
+		}
+	}
+	return nil
+}
+
+// indexedKeys returns the keys of the records whose leading index
+// attributes are attributes. ok is false if the index is not ready, in
+// which case the caller scans instead.
+func indexedKeys(ctx contractapi.TransactionContextInterface, index *compositeIndex, attributes ...string) (keys []string, ok bool, err error) {
+	ready, err := ctx.GetStub().GetState(indexReadyPrefix + index.name)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read %s index state: %v", index.name, err)
+	}
+	if ready == nil {
+		return nil, false, nil
+	}
+
+	iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(index.name, attributes)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to query %s index: %v", index.name, err)
+	}
+	defer iterator.Close()
+
+	for iterator.HasNext() {
+		entry, err := iterator.Next()
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to iterate %s index: %v", index.name, err)
+		}
+		_, parts, err := ctx.GetStub().SplitCompositeKey(entry.Key)
+		if err != nil || len(parts) == 0 {
+			return nil, false, fmt.Errorf("malformed %s index entry %q", index.name, entry.Key)
+		}
+		keys = append(keys, parts[len(parts)-1])
+	}
+	return keys, true, nil
+}
+
+// markIndexesReady records that indexes hold every record
+func markIndexesReady(ctx contractapi.TransactionContextInterface, indexes ...*compositeIndex) error {
+	for _, index := range indexes {
+		if err := ctx.GetStub().PutState(indexReadyPrefix+index.name, []byte("true")); err != nil {
+			return fmt.Errorf("failed to mark %s index ready: %v", index.name, err)
+		}
+	}
+	return nil
+}
+
+// IndexRebuildResult reports what RebuildIndexes did for one index
+type IndexRebuildResult struct {
+	Index   string `json:"index"`
+	Records int    `json:"records"` // Records indexed
+	Created int    `json:"created"` // Entries that were missing
+}
+
+// rebuildIndex adds the missing entries of an index, reading each record
+// under its prefix
+func rebuildIndex(ctx contractapi.TransactionContextInterface, index *compositeIndex) (*IndexRebuildResult, error) {
+	iterator, err := ctx.GetStub().GetStateByRange(index.keyPrefix, index.keyPrefix+"~")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s records: %v", index.keyPrefix, err)
+	}
+	defer iterator.Close()
+
+	result := &IndexRebuildResult{Index: index.name}
+	for iterator.HasNext() {
+		record, err := iterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate %s records: %v", index.keyPrefix, err)
+		}
+		attributes := index.attributes(record.Value)
+		if attributes == nil {
+			continue
+		}
+		result.Records++
+
+		entryKey, err := index.entryKey(ctx, record.Key, attributes)
+		if err != nil {
+			return nil, err
+		}
+		existing, err := ctx.GetStub().GetState(entryKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s index entry: %v", index.name, err)
+		}
+		if existing != nil {
+			continue
+		}
+		if err := ctx.GetStub().PutState(entryKey, indexEntryValue); err != nil {
+			return nil, fmt.Errorf("failed to store %s index entry: %v", index.name, err)
+		}
+		result.Created++
+	}
+	return result, nil
+}
+
+// RebuildIndexes backfills the composite indexes for records written
+// before they existed, then marks them ready for queries. Run it once
+// after an upgrade that adds an index; running it again only adds entries
+// that are missing. Only admins may call it.
+func (s *ISVChaincode) RebuildIndexes(ctx contractapi.TransactionContextInterface) ([]*IndexRebuildResult, error) {
+	var results []*IndexRebuildResult
+	for _, index := range compositeIndexes {
+		result, err := rebuildIndex(ctx, index)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+		fmt.Printf("Index %s: %d records, %d entries created\n", index.name, result.Records, result.Created)
+	}
+	if err := markIndexesReady(ctx, compositeIndexes...); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestSessionIndexAttributes(t *testing.T) {
+	sessionJSON, err := json.Marshal(ClientDeviceSession{SessionID: "SESSION_c1_d1_1", ClientID: "c1", DeviceID: "d1", Status: "active"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		index *compositeIndex
+		value []byte
+		want  []string
+	}{
+		{sessionsByClientIndex, sessionJSON, []string{"c1"}},
+		{sessionsByDeviceIndex, sessionJSON, []string{"d1"}},
+		// Other records share the SESSION_ prefix
+		{sessionsByClientIndex, []byte("not a session"), nil},
+		{sessionsByDeviceIndex, []byte(`{"sessionKey":"k"}`), nil},
+	}
+	for _, test := range tests {
+		if got := test.index.attributes(test.value); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s attributes(%s) = %v, want %v", test.index.name, test.value, got, test.want)
+		}
+	}
+}
+
+func TestCompositeIndexesCoverSessionIndexes(t *testing.T) {
+	for _, index := range sessionIndexes {
+		found := false
+		for _, rebuilt := range compositeIndexes {
+			found = found || rebuilt == index
+		}
+		if !found {
+			t.Errorf("%s is not rebuilt by RebuildIndexes", index.name)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/blockchain-auth/common"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Authorized clients can still overwhelm a device, so a device agent may
+// cap how many sessions it holds at once and how many service requests it
+// takes per minute. ProcessServiceRequest sheds requests over either limit
+// with a DeviceOverloadedError. The transaction fails, so a shed request
+// writes nothing and does not count against the device's rate.
+//
+// A device without load limits takes one session at a time, as before: a
+// busy device is unavailable. With MaxActiveSessions set it stays available
+// until that many live sessions are open.
+
+// DeviceLoadLimits is what a device agent signs to limit its load. Zero
+// means unlimited.
+type DeviceLoadLimits struct {
+	MaxActiveSessions    int `json:"maxActiveSessions,omitempty"`
+	MaxRequestsPerMinute int `json:"maxRequestsPerMinute,omitempty"`
+}
+
+// DeviceLoad is a device's load limits and current load
+type DeviceLoad struct {
+	DeviceID       string            `json:"deviceID"`
+	Limits         *DeviceLoadLimits `json:"limits,omitempty"`
+	ActiveSessions int               `json:"activeSessions"`
+	WindowStart    time.Time         `json:"windowStart"`
+	Requests       int               `json:"requests"` // Service requests taken since WindowStart
+}
+
+// loadWindow counts the service requests a device took in the current minute
+type loadWindow struct {
+	Start    time.Time `json:"start"`
+	Requests int       `json:"requests"`
+}
+
+// DeviceOverloadedError is returned when a device is over one of its load
+// limits. Its message is "DEVICE_OVERLOADED " followed by the error as JSON,
+// which clients parse to learn when to retry.
+type DeviceOverloadedError struct {
+	DeviceID   string `json:"deviceID"`
+	Reason     string `json:"reason"`     // overloadActiveSessions or overloadRequestRate
+	RetryAfter int64  `json:"retryAfter"` // Seconds
+}
+
+const (
+	loadWindowPrefix = "LOADWINDOW_"
+	loadWindowLength = time.Minute
+
+	overloadErrorPrefix    = "DEVICE_OVERLOADED "
+	overloadActiveSessions = "max_active_sessions"
+	overloadRequestRate    = "max_requests_per_minute"
+
+	maxLoadActiveSessions    = 1000
+	maxLoadRequestsPerMinute = 6000
+)
+
+func (e *DeviceOverloadedError) Error() string {
+	errorJSON, _ := json.Marshal(e)
+	return overloadErrorPrefix + string(errorJSON)
+}
+
+// loadLimitsMessage is the message a device agent signs to set its load
+// limits
+func loadLimitsMessage(deviceID string, limits DeviceLoadLimits) string {
+	return fmt.Sprintf("LOADLIMITS|%s|%d|%d", deviceID, limits.MaxActiveSessions, limits.MaxRequestsPerMinute)
+}
+
+func (limits *DeviceLoadLimits) validate() error {
+	if limits.MaxActiveSessions < 0 || limits.MaxActiveSessions > maxLoadActiveSessions {
+		return fmt.Errorf("max active sessions must be between 0 and %d", maxLoadActiveSessions)
+	}
+	if limits.MaxRequestsPerMinute < 0 || limits.MaxRequestsPerMinute > maxLoadRequestsPerMinute {
+		return fmt.Errorf("max requests per minute must be between 0 and %d", maxLoadRequestsPerMinute)
+	}
+	return nil
+}
+
+// allowsConcurrentSessions reports whether a busy device may take another
+// session, leaving the count to checkDeviceLoad
+func (device *IoTDevice) allowsConcurrentSessions() bool {
+	return device.LoadLimits != nil && device.LoadLimits.MaxActiveSessions > 1
+}
+
+// SetDeviceLoadLimits sets the load limits of a device; "{}" removes them.
+// It is signed with the device key.
+func (s *ISVChaincode) SetDeviceLoadLimits(ctx contractapi.TransactionContextInterface, deviceID string, limitsJSON string, signature string) error {
+	var limits DeviceLoadLimits
+	if err := json.Unmarshal([]byte(limitsJSON), &limits); err != nil {
+		return fmt.Errorf("invalid load limits format: %v", err)
+	}
+	if err := limits.validate(); err != nil {
+		return err
+	}
+	if err := s.verifyDeviceSignature(ctx, deviceID, loadLimitsMessage(deviceID, limits), signature); err != nil {
+		return err
+	}
+
+	device, err := s.getDevice(ctx, deviceID)
+	if err != nil {
+		return err
+	}
+	if limits == (DeviceLoadLimits{}) {
+		device.LoadLimits = nil
+	} else {
+		device.LoadLimits = &limits
+	}
+
+	fmt.Printf("Load limits for device %s: %d sessions, %d requests/minute\n", deviceID, limits.MaxActiveSessions, limits.MaxRequestsPerMinute)
+	return putDevice(ctx, device)
+}
+
+// GetDeviceLoad returns a device's load limits, its live sessions and the
+// service requests it took this minute
+func (s *ISVChaincode) GetDeviceLoad(ctx contractapi.TransactionContextInterface, deviceID string) (*DeviceLoad, error) {
+	device, err := s.getDevice(ctx, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	currentTime, err := common.GetDeterministicTimestamp(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current timestamp: %v", err)
+	}
+
+	sessions, err := s.liveSessions(ctx, deviceID, currentTime)
+	if err != nil {
+		return nil, err
+	}
+	window, err := getLoadWindow(ctx, deviceID, currentTime)
+	if err != nil {
+		return nil, err
+	}
+	return &DeviceLoad{
+		DeviceID:       deviceID,
+		Limits:         device.LoadLimits,
+		ActiveSessions: len(sessions),
+		WindowStart:    window.Start,
+		Requests:       window.Requests,
+	}, nil
+}
+
+// checkDeviceLoad sheds a service request the device has no room for, and
+// otherwise counts it against the device's request rate
+func (s *ISVChaincode) checkDeviceLoad(ctx contractapi.TransactionContextInterface, deviceID string) error {
+	device, err := s.getDevice(ctx, deviceID)
+	if err != nil {
+		return err
+	}
+	limits := device.LoadLimits
+	if limits == nil {
+		return nil
+	}
+	currentTime, err := common.GetDeterministicTimestamp(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get current timestamp: %v", err)
+	}
+
+	if limits.MaxActiveSessions > 0 {
+		sessions, err := s.liveSessions(ctx, deviceID, currentTime)
+		if err != nil {
+			return err
+		}
+		if len(sessions) >= limits.MaxActiveSessions {
+			return &DeviceOverloadedError{
+				DeviceID:   deviceID,
+				Reason:     overloadActiveSessions,
+				RetryAfter: retryAfterSessions(sessions, currentTime),
+			}
+		}
+	}
+
+	if limits.MaxRequestsPerMinute > 0 {
+		window, err := getLoadWindow(ctx, deviceID, currentTime)
+		if err != nil {
+			return err
+		}
+		if window.Requests >= limits.MaxRequestsPerMinute {
+			return &DeviceOverloadedError{
+				DeviceID:   deviceID,
+				Reason:     overloadRequestRate,
+				RetryAfter: retryAfterSeconds(window.Start.Add(loadWindowLength), currentTime),
+			}
+		}
+		window.Requests++
+		windowJSON, err := json.Marshal(window)
+		if err != nil {
+			return fmt.Errorf("failed to marshal load window: %v", err)
+		}
+		if err := ctx.GetStub().PutState(loadWindowPrefix+deviceID, windowJSON); err != nil {
+			return fmt.Errorf("failed to store load window: %v", err)
+		}
+	}
+	return nil
+}
+
+// liveSessions returns the active sessions on a device that have neither
+// expired nor gone idle, whether or not they have been swept yet
+func (s *ISVChaincode) liveSessions(ctx contractapi.TransactionContextInterface, deviceID string, now time.Time) ([]*ClientDeviceSession, error) {
+	sessions, err := s.GetActiveSessionsByDevice(ctx, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	live := []*ClientDeviceSession{}
+	for _, session := range sessions {
+		if now.Before(session.ExpiresAt) && !session.idleExpired(now) {
+			live = append(live, session)
+		}
+	}
+	return live, nil
+}
+
+// getLoadWindow returns the request count of the minute now falls in
+func getLoadWindow(ctx contractapi.TransactionContextInterface, deviceID string, now time.Time) (*loadWindow, error) {
+	start := now.Truncate(loadWindowLength)
+	windowJSON, err := ctx.GetStub().GetState(loadWindowPrefix + deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read load window: %v", err)
+	}
+
+	window := &loadWindow{Start: start}
+	if windowJSON != nil {
+		var stored loadWindow
+		if err := json.Unmarshal(windowJSON, &stored); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal load window: %v", err)
+		}
+		if stored.Start.Equal(start) {
+			window.Requests = stored.Requests
+		}
+	}
+	return window, nil
+}
+
+// retryAfterSessions is how long until the first of a device's sessions
+// expires or goes idle
+func retryAfterSessions(sessions []*ClientDeviceSession, now time.Time) int64 {
+	var first time.Time
+	for _, session := range sessions {
+		end := session.ExpiresAt
+		if deadline, ok := session.idleDeadline(); ok && deadline.Before(end) {
+			end = deadline
+		}
+		if first.IsZero() || end.Before(first) {
+			first = end
+		}
+	}
+	return retryAfterSeconds(first, now)
+}
+
+// retryAfterSeconds rounds the wait until t up to whole seconds, at least one
+func retryAfterSeconds(t time.Time, now time.Time) int64 {
+	wait := int64((t.Sub(now) + time.Second - 1) / time.Second)
+	if wait < 1 {
+		return 1
+	}
+	return wait
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDeviceOverloadedErrorMessage(t *testing.T) {
+	err := &DeviceOverloadedError{DeviceID: "device1", Reason: overloadRequestRate, RetryAfter: 12}
+	message := err.Error()
+	if !strings.HasPrefix(message, overloadErrorPrefix) {
+		t.Fatalf("Error() = %q, want prefix %q", message, overloadErrorPrefix)
+	}
+
+	var parsed DeviceOverloadedError
+	if jsonErr := json.Unmarshal([]byte(strings.TrimPrefix(message, overloadErrorPrefix)), &parsed); jsonErr != nil {
+		t.Fatalf("error body is not JSON: %v", jsonErr)
+	}
+	if parsed != *err {
+		t.Errorf("parsed %+v, want %+v", parsed, *err)
+	}
+}
+
+func TestDeviceLoadLimitsValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		limits  DeviceLoadLimits
+		wantErr bool
+	}{
+		{"unlimited", DeviceLoadLimits{}, false},
+		{"both", DeviceLoadLimits{MaxActiveSessions: 4, MaxRequestsPerMinute: 60}, false},
+		{"negative sessions", DeviceLoadLimits{MaxActiveSessions: -1}, true},
+		{"too many requests", DeviceLoadLimits{MaxRequestsPerMinute: maxLoadRequestsPerMinute + 1}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.limits.validate(); (err != nil) != test.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestRetryAfterSessions(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	sessions := []*ClientDeviceSession{
+		{ExpiresAt: now.Add(10 * time.Minute)},
+		// Goes idle 90s after its last activity, before it expires
+		{ExpiresAt: now.Add(time.Hour), IdleTimeout: 120, LastActivity: now.Add(-30 * time.Second)},
+	}
+	if got := retryAfterSessions(sessions, now); got != 90 {
+		t.Errorf("retryAfterSessions() = %d, want 90", got)
+	}
+
+	if got := retryAfterSeconds(now.Add(1500*time.Millisecond), now); got != 2 {
+		t.Errorf("retryAfterSeconds() = %d, want it rounded up to 2", got)
+	}
+	if got := retryAfterSeconds(now.Add(-time.Second), now); got != 1 {
+		t.Errorf("retryAfterSeconds() in the past = %d, want 1", got)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// The service ticket authenticates the client to the ISV. For the ISV to
+// authenticate itself to the client, as in the Kerberos AP exchange, the
+// client sends an authenticator with its service request: its client ID and
+// a timestamp sealed under the service session key KU,SS, which the TGS
+// gave it sealed under KU,TGS. The ISV opens the authenticator with the
+// KU,SS from the service ticket, which only the ISV's private key opens,
+// and replies with the timestamp plus one sealed under the same key. A
+// client that gets no reply, or one that does not open to its timestamp
+// plus one, is not talking to the ISV its ticket was issued for.
+//
+// Sealed values are a 12-byte nonce followed by the AES-256-GCM ciphertext,
+// with the key usage as additional data, so a client authenticator cannot be
+// reflected back as the ISV's reply. The reply's nonce is derived from the
+// transaction, so that every endorsing peer returns the same response.
+// Requests without an authenticator, from clients that predate mutual
+// authentication, get no reply.
+
+const (
+	clientAuthenticatorUsage = "isv-client-authenticator"
+	serverAuthenticatorUsage = "isv-server-authenticator"
+
+	// authenticatorMaxSkew is how far, in seconds, a client authenticator's
+	// timestamp may be from the transaction time
+	authenticatorMaxSkew = 5 * 60
+
+	sealNonceSize = 12
+)
+
+// sessionAuthenticator is the plaintext of a client authenticator and of
+// the ISV's reply
+type sessionAuthenticator struct {
+	ClientID  string `json:"clientID"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// sessionKeyCipher returns AES-256-GCM under a base64 session key
+func sessionKeyCipher(sessionKeyB64 string) (cipher.AEAD, error) {
+	key, err := base64.StdEncoding.DecodeString(sessionKeyB64)
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("session key is not a base64 AES-256 key")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// openClientAuthenticator opens a client authenticator with the service
+// ticket's session key and checks that it names the client and was made
+// within authenticatorMaxSkew of now. It returns the authenticator's
+// timestamp.
+func openClientAuthenticator(sessionKeyB64, authenticatorB64, clientID string, now time.Time) (int64, error) {
+	gcm, err := sessionKeyCipher(sessionKeyB64)
+	if err != nil {
+		return 0, err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(authenticatorB64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid authenticator (base64 decoding failed): %v", err)
+	}
+	if len(sealed) < sealNonceSize {
+		return 0, fmt.Errorf("invalid authenticator: too short")
+	}
+	plaintext, err := gcm.Open(nil, sealed[:sealNonceSize], sealed[sealNonceSize:], []byte(clientAuthenticatorUsage))
+	if err != nil {
+		return 0, fmt.Errorf("authenticator is not sealed with the service ticket's session key")
+	}
+
+	var authenticator sessionAuthenticator
+	if err := json.Unmarshal(plaintext, &authenticator); err != nil {
+		return 0, fmt.Errorf("invalid authenticator (JSON parsing failed): %v", err)
+	}
+	if authenticator.ClientID != clientID {
+		return 0, fmt.Errorf("authenticator is for client %s, not %s", authenticator.ClientID, clientID)
+	}
+	skew := now.Unix() - authenticator.Timestamp
+	if skew > authenticatorMaxSkew || skew < -authenticatorMaxSkew {
+		return 0, fmt.Errorf("authenticator time is more than %d seconds from the transaction time; check the local clock", authenticatorMaxSkew)
+	}
+	return authenticator.Timestamp, nil
+}
+
+// serverAuthenticator returns the ISV's reply to a client authenticator
+// made at timestamp: the timestamp plus one, sealed under the session key.
+// nonceSeed must differ between replies under the same key, e.g. the
+// transaction ID.
+func serverAuthenticator(sessionKeyB64, clientID string, timestamp int64, nonceSeed string) (string, error) {
+	gcm, err := sessionKeyCipher(sessionKeyB64)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := json.Marshal(sessionAuthenticator{ClientID: clientID, Timestamp: timestamp + 1})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal server authenticator: %v", err)
+	}
+
+	seed := sha256.Sum256([]byte(serverAuthenticatorUsage + "|" + nonceSeed))
+	nonce := seed[:sealNonceSize]
+	sealed := gcm.Seal(append([]byte(nil), nonce...), nonce, plaintext, []byte(serverAuthenticatorUsage))
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// answerAuthenticator checks the request's authenticator against the
+// service ticket and returns the ISV's reply, or "" if the request has no
+// authenticator
+func answerAuthenticator(request ServiceRequest, serviceTicket *ServiceTicket, now time.Time, txID string) (string, error) {
+	if request.Authenticator == "" {
+		return "", nil
+	}
+	timestamp, err := openClientAuthenticator(serviceTicket.SessionKey, request.Authenticator, serviceTicket.ClientID, now)
+	if err != nil {
+		return "", err
+	}
+	return serverAuthenticator(serviceTicket.SessionKey, serviceTicket.ClientID, timestamp, txID)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// sealClientAuthenticator seals an authenticator as a client does
+func sealClientAuthenticator(t *testing.T, sessionKeyB64 string, authenticator sessionAuthenticator, usage string) string {
+	gcm, err := sessionKeyCipher(sessionKeyB64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, _ := json.Marshal(authenticator)
+	nonce := make([]byte, sealNonceSize)
+	rand.Read(nonce)
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, plaintext, []byte(usage)))
+}
+
+func testSessionKey(seed string) string {
+	key := sha256.Sum256([]byte(seed))
+	return base64.StdEncoding.EncodeToString(key[:])
+}
+
+func TestOpenClientAuthenticator(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	sessionKey := testSessionKey("KU,SS")
+	tests := []struct {
+		name          string
+		authenticator string
+		wantErr       bool
+	}{
+		{"fresh", sealClientAuthenticator(t, sessionKey, sessionAuthenticator{"client1", now.Unix()}, clientAuthenticatorUsage), false},
+		{"within skew", sealClientAuthenticator(t, sessionKey, sessionAuthenticator{"client1", now.Unix() - authenticatorMaxSkew}, clientAuthenticatorUsage), false},
+		{"stale", sealClientAuthenticator(t, sessionKey, sessionAuthenticator{"client1", now.Unix() - authenticatorMaxSkew - 1}, clientAuthenticatorUsage), true},
+		{"other client", sealClientAuthenticator(t, sessionKey, sessionAuthenticator{"client2", now.Unix()}, clientAuthenticatorUsage), true},
+		{"other key", sealClientAuthenticator(t, testSessionKey("other"), sessionAuthenticator{"client1", now.Unix()}, clientAuthenticatorUsage), true},
+		{"server usage", sealClientAuthenticator(t, sessionKey, sessionAuthenticator{"client1", now.Unix()}, serverAuthenticatorUsage), true},
+		{"not base64", "%%%", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := openClientAuthenticator(sessionKey, test.authenticator, "client1", now)
+			if (err != nil) != test.wantErr {
+				t.Errorf("openClientAuthenticator() error = %v, wantErr %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestServerAuthenticator(t *testing.T) {
+	sessionKey := testSessionKey("KU,SS")
+	reply, err := serverAuthenticator(sessionKey, "client1", 1700000000, "tx1")
+	if err != nil {
+		t.Fatalf("serverAuthenticator() error = %v", err)
+	}
+	again, _ := serverAuthenticator(sessionKey, "client1", 1700000000, "tx1")
+	if reply != again {
+		t.Error("serverAuthenticator() is not deterministic for the same transaction")
+	}
+
+	sealed, _ := base64.StdEncoding.DecodeString(reply)
+	gcm, _ := sessionKeyCipher(sessionKey)
+	plaintext, err := gcm.Open(nil, sealed[:sealNonceSize], sealed[sealNonceSize:], []byte(serverAuthenticatorUsage))
+	if err != nil {
+		t.Fatalf("reply does not open with the session key: %v", err)
+	}
+	var authenticator sessionAuthenticator
+	json.Unmarshal(plaintext, &authenticator)
+	if authenticator.ClientID != "client1" || authenticator.Timestamp != 1700000001 {
+		t.Errorf("reply = %+v, want client1 at 1700000001", authenticator)
+	}
+
+	// The reply is not accepted as a client authenticator
+	if _, err := openClientAuthenticator(sessionKey, reply, "client1", time.Unix(1700000000, 0)); err == nil {
+		t.Error("the ISV's reply opened as a client authenticator")
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/blockchain-auth/common"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// A device is marked busy when a session opens and active again when it
+// closes. A client that crashes before closing its session leaves the device
+// busy; SweepSessions frees it once the session expires. A device can still
+// be left busy with no session to close, e.g. after a failed upgrade or a
+// session record terminated by hand. RecoverBusyDevices finds those devices
+// and marks them active.
+
+// RecoveryResult lists what one RecoverBusyDevices call changed
+type RecoveryResult struct {
+	RecoveredDevices []string `json:"recoveredDevices"`
+	// HeldDevices are busy devices left as they are because a live session
+	// still holds them
+	HeldDevices []string `json:"heldDevices"`
+}
+
+const (
+	// busyDevicesRecoveredEvent carries the RecoveryResult of a recovery
+	// that changed anything
+	busyDevicesRecoveredEvent = "BusyDevicesRecovered"
+
+	accessDeviceRecovered = "device_recovered"
+)
+
+// sessionHoldsDevice reports whether a session still keeps its device busy:
+// it is active and neither expired nor idle
+func sessionHoldsDevice(session *ClientDeviceSession, now time.Time) bool {
+	return session.Status == "active" && !now.After(session.ExpiresAt) && !session.idleExpired(now)
+}
+
+// RecoverBusyDevices marks busy devices that no live session holds as
+// active. Sessions that are active but expired or idle are left for
+// SweepSessions to close. Only admins may call it.
+func (s *ISVChaincode) RecoverBusyDevices(ctx contractapi.TransactionContextInterface) (*RecoveryResult, error) {
+	currentTime, err := common.GetDeterministicTimestamp(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current timestamp: %v", err)
+	}
+
+	sessionIterator, err := ctx.GetStub().GetStateByRange("SESSION_", "SESSION_~")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session records: %v", err)
+	}
+	defer sessionIterator.Close()
+
+	held := make(map[string]bool)
+	for sessionIterator.HasNext() {
+		queryResponse, err := sessionIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate session records: %v", err)
+		}
+
+		var session ClientDeviceSession
+		if err := json.Unmarshal(queryResponse.Value, &session); err != nil {
+			// Session keys share the SESSION_ prefix and are not JSON
+			continue
+		}
+		if sessionHoldsDevice(&session, currentTime) {
+			held[session.DeviceID] = true
+		}
+	}
+
+	deviceIterator, err := ctx.GetStub().GetStateByRange("DEVICE_", "DEVICE_~")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device records: %v", err)
+	}
+	defer deviceIterator.Close()
+
+	uow := common.NewUnitOfWork(ctx)
+	result := &RecoveryResult{RecoveredDevices: []string{}, HeldDevices: []string{}}
+	for deviceIterator.HasNext() {
+		queryResponse, err := deviceIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate device records: %v", err)
+		}
+
+		var device IoTDevice
+		if err := json.Unmarshal(queryResponse.Value, &device); err != nil {
+			fmt.Printf("Error unmarshaling device record: %v\n", err)
+			continue
+		}
+		if device.Status != "busy" {
+			continue
+		}
+		if held[device.DeviceID] {
+			result.HeldDevices = append(result.HeldDevices, device.DeviceID)
+			continue
+		}
+
+		device.Status = "active"
+		if err := uow.PutJSON(queryResponse.Key, &device); err != nil {
+			return nil, err
+		}
+		if _, err := putAccessLog(ctx, &AccessLogEntry{
+			DeviceID: device.DeviceID,
+			Action:   accessDeviceRecovered,
+			Detail:   "busy with no live session",
+		}); err != nil {
+			return nil, err
+		}
+		if err := uow.IncrementMetric(metricDevicesRecovered); err != nil {
+			return nil, err
+		}
+		result.RecoveredDevices = append(result.RecoveredDevices, device.DeviceID)
+	}
+
+	if err := uow.Commit(); err != nil {
+		return nil, err
+	}
+
+	if len(result.RecoveredDevices) > 0 {
+		resultJSON, err := json.Marshal(result)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal recovery result: %v", err)
+		}
+		if err := common.SetEvent(ctx, busyDevicesRecoveredEvent, resultJSON); err != nil {
+			return nil, fmt.Errorf("failed to emit recovery event: %v", err)
+		}
+	}
+
+	fmt.Printf("Recovered %d busy devices, %d still held by sessions\n", len(result.RecoveredDevices), len(result.HeldDevices))
+	return result, nil
+}
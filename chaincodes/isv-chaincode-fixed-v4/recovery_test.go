@@ -0,0 +1,29 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSessionHoldsDevice(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		session ClientDeviceSession
+		want    bool
+	}{
+		{"active", ClientDeviceSession{Status: "active", ExpiresAt: now.Add(time.Hour)}, true},
+		{"terminated", ClientDeviceSession{Status: "terminated", ExpiresAt: now.Add(time.Hour)}, false},
+		{"expired", ClientDeviceSession{Status: "active", ExpiresAt: now.Add(-time.Second)}, false},
+		{"idle", ClientDeviceSession{Status: "active", ExpiresAt: now.Add(time.Hour), IdleTimeout: 60, LastActivity: now.Add(-2 * time.Minute)}, false},
+		{"recently active", ClientDeviceSession{Status: "active", ExpiresAt: now.Add(time.Hour), IdleTimeout: 60, LastActivity: now.Add(-time.Second)}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := sessionHoldsDevice(&test.session, now); got != test.want {
+				t.Errorf("sessionHoldsDevice() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/blockchain-auth/common"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// A client can extend an active session before it expires with
+// RenewSession, presenting a service ticket that is still valid (usually
+// one just renewed with the TGS). The session gets the ticket's session key
+// and a new lifetime from the device's current session policy. Sessions
+// opened with an access grant or through break-glass access keep the
+// lifetime they were given.
+
+// checkSessionRenewable returns why a client cannot renew the session at
+// now, if it cannot
+func checkSessionRenewable(session *ClientDeviceSession, clientID string, now time.Time) error {
+	if session.ClientID != clientID {
+		return fmt.Errorf("session %s belongs to another client", session.SessionID)
+	}
+	if session.EmergencyAccessID != "" {
+		return fmt.Errorf("emergency sessions cannot be renewed")
+	}
+	if session.GrantID != "" {
+		return fmt.Errorf("sessions opened with an access grant cannot be renewed")
+	}
+	if !now.Before(session.ExpiresAt) {
+		return fmt.Errorf("session expired at %s; request access again", session.ExpiresAt.Format(time.RFC3339))
+	}
+	if session.idleExpired(now) {
+		return fmt.Errorf("session has been idle too long; request access again")
+	}
+	return nil
+}
+
+// RenewSession extends an active session of the client named in the
+// service ticket and returns the updated session
+func (s *ISVChaincode) RenewSession(ctx contractapi.TransactionContextInterface, sessionID string, encryptedServiceTicket string) (*ClientDeviceSession, error) {
+	fmt.Printf("Renewing session %s\n", sessionID)
+
+	session, err := getActiveSession(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	serviceTicket, err := s.ValidateServiceTicket(ctx, encryptedServiceTicket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to validate service ticket: %v", err)
+	}
+
+	now, err := common.GetDeterministicTimestamp(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current timestamp: %v", err)
+	}
+	if err := checkSessionRenewable(session, serviceTicket.ClientID, now); err != nil {
+		return nil, err
+	}
+	device, err := s.getDevice(ctx, session.DeviceID)
+	if err != nil {
+		return nil, err
+	}
+	if violation := device.attributeRuleViolation(serviceTicket.Attributes); violation != "" {
+		return nil, fmt.Errorf("service ticket no longer satisfies the device's attribute rules: %s", violation)
+	}
+
+	policy, err := s.GetSessionPolicy(ctx, session.DeviceID)
+	if err != nil {
+		return nil, err
+	}
+	session.SessionKey = serviceTicket.SessionKey
+	session.ExpiresAt = now.Add(time.Duration(policy.SessionLifetime) * time.Second)
+
+	sessionJSON, err := json.Marshal(session)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal session data: %v", err)
+	}
+	if err := ctx.GetStub().PutState(sessionID, sessionJSON); err != nil {
+		return nil, fmt.Errorf("failed to store session data: %v", err)
+	}
+	if err := common.IncrementMetric(ctx, metricSessionsRenewed); err != nil {
+		return nil, err
+	}
+	detail := "until " + session.ExpiresAt.Format(time.RFC3339)
+	if err := recordAccessLog(ctx, session.DeviceID, session.ClientID, sessionID, accessSessionRenewed, detail); err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("Session %s renewed %s\n", sessionID, detail)
+	return session, nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCheckSessionRenewable(t *testing.T) {
+	established := time.Unix(1700000000, 0)
+	session := ClientDeviceSession{
+		SessionID:     "SESSION_client1_device1_1700000000",
+		ClientID:      "client1",
+		DeviceID:      "device1",
+		EstablishedAt: established,
+		ExpiresAt:     established.Add(time.Hour),
+		Status:        "active",
+		IdleTimeout:   600,
+		LastActivity:  established,
+	}
+	granted := session
+	granted.GrantID = "GRANT_1"
+	emergency := session
+	emergency.EmergencyAccessID = "EMERGENCY_1"
+
+	tests := []struct {
+		name     string
+		session  ClientDeviceSession
+		clientID string
+		now      time.Time
+		wantErr  bool
+	}{
+		{"active", session, "client1", established.Add(5 * time.Minute), false},
+		{"other client", session, "client2", established.Add(5 * time.Minute), true},
+		{"expired", session, "client1", session.ExpiresAt, true},
+		{"idle", session, "client1", established.Add(11 * time.Minute), true},
+		{"access grant", granted, "client1", established.Add(5 * time.Minute), true},
+		{"emergency", emergency, "client1", established.Add(5 * time.Minute), true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := checkSessionRenewable(&test.session, test.clientID, test.now)
+			if (err != nil) != test.wantErr {
+				t.Errorf("checkSessionRenewable() error = %v, wantErr %v", err, test.wantErr)
+			}
+		})
+	}
+}
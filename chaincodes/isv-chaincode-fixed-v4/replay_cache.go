@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/blockchain-auth/common"
+)
+
+// The replay cache (see chaincodes/common/replay_cache.go) makes what proves
+// a service request fresh single-use. That is the request's authenticator
+// (see mutual_auth.go) when it has one; the client can keep using its
+// service ticket with fresh authenticators. A request without one has only
+// the service ticket, which is then good for one service request.
+
+// consumeServiceRequest records the use of the request's authenticator, or
+// of its service ticket if it has none
+func consumeServiceRequest(store common.StateStore, request ServiceRequest, serviceTicket *ServiceTicket, now time.Time, txID string) error {
+	if request.Authenticator != "" {
+		// An authenticator's timestamp is at most authenticatorMaxSkew ahead
+		// of now, so it is refused by openClientAuthenticator after twice that
+		expiresAt := now.Add(2 * authenticatorMaxSkew * time.Second)
+		return common.ConsumeOnce(store, common.ReplayKindAuthenticator, request.Authenticator, expiresAt, now, txID)
+	}
+	expiresAt := serviceTicket.Timestamp.Add(time.Duration(serviceTicket.Lifetime) * time.Second)
+	if err := common.ConsumeOnce(store, common.ReplayKindServiceTicket, request.EncryptedServiceTicket, expiresAt, now, txID); err != nil {
+		return fmt.Errorf("%v; send an authenticator with the request or get a new ticket", err)
+	}
+	return nil
+}
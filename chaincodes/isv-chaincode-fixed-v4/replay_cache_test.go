@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/blockchain-auth/common/commontest"
+)
+
+func TestConsumeServiceRequest(t *testing.T) {
+	store := commontest.NewMemoryStore(nil)
+	now := time.Unix(1700000000, 0)
+	serviceTicket := &ServiceTicket{ClientID: "client1", Timestamp: now.Add(-time.Minute), Lifetime: 3600}
+	request := ServiceRequest{EncryptedServiceTicket: "ticket1", ClientID: "client1"}
+
+	// With authenticators the ticket can be used again
+	request.Authenticator = "auth1"
+	if err := consumeServiceRequest(store, request, serviceTicket, now, "tx1"); err != nil {
+		t.Fatalf("first authenticator: %v", err)
+	}
+	if err := consumeServiceRequest(store, request, serviceTicket, now, "tx2"); err == nil {
+		t.Error("replayed authenticator was accepted")
+	}
+	request.Authenticator = "auth2"
+	if err := consumeServiceRequest(store, request, serviceTicket, now, "tx3"); err != nil {
+		t.Errorf("fresh authenticator with the same ticket: %v", err)
+	}
+
+	// Without one the ticket is good for one request
+	request.Authenticator = ""
+	if err := consumeServiceRequest(store, request, serviceTicket, now, "tx4"); err != nil {
+		t.Errorf("first use of the ticket alone: %v", err)
+	}
+	if err := consumeServiceRequest(store, request, serviceTicket, now, "tx5"); err == nil {
+		t.Error("reused ticket was accepted")
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/blockchain-auth/common"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// After a supply-chain incident an operator may have to revoke thousands of
+// devices. RevokeDevices takes them in batches of up to maxRevocationBatch
+// so each transaction stays small, and clients pace the batches so the
+// orderer is not flooded. Revoking a revoked device is a no-op, which lets a
+// client resume an interrupted run by resending its last batch.
+//
+// A revoked device is never available again: its live sessions are closed
+// in the revoking transaction and UpdateDeviceStatus cannot bring it back.
+
+// RevocationResult reports what RevokeDevices did with each device of a
+// batch. A device the caller may not revoke, or that does not exist, does
+// not fail the batch.
+type RevocationResult struct {
+	Revoked        []string `json:"revoked"`
+	AlreadyRevoked []string `json:"alreadyRevoked"`
+	NotFound       []string `json:"notFound"`
+	Denied         []string `json:"denied"` // Registered by another organization
+	ClosedSessions []string `json:"closedSessions"`
+}
+
+const (
+	deviceStatusRevoked = "revoked"
+
+	maxRevocationBatch        = 200
+	maxRevocationReasonLength = 256
+
+	accessDeviceRevoked = "device_revoked"
+
+	// devicesRevokedEvent carries the RevocationResult of a batch that
+	// revoked anything
+	devicesRevokedEvent = "DevicesRevoked"
+
+	metricDevicesRevoked = "devices_revoked"
+)
+
+// parseRevocationBatch decodes a batch of device IDs, dropping duplicates
+func parseRevocationBatch(deviceIDsJSON string, maxIDLength int) ([]string, error) {
+	var deviceIDs []string
+	if err := json.Unmarshal([]byte(deviceIDsJSON), &deviceIDs); err != nil {
+		return nil, fmt.Errorf("invalid device ID list: %v", err)
+	}
+	if len(deviceIDs) == 0 {
+		return nil, fmt.Errorf("no device IDs to revoke")
+	}
+	if len(deviceIDs) > maxRevocationBatch {
+		return nil, fmt.Errorf("%d devices in one batch, the limit is %d", len(deviceIDs), maxRevocationBatch)
+	}
+
+	seen := make(map[string]bool, len(deviceIDs))
+	batch := deviceIDs[:0]
+	for _, deviceID := range deviceIDs {
+		if deviceID == "" {
+			return nil, fmt.Errorf("empty device ID")
+		}
+		if len(deviceID) > maxIDLength {
+			return nil, fmt.Errorf("device ID %.16s... is %d characters, the limit is %d", deviceID, len(deviceID), maxIDLength)
+		}
+		if seen[deviceID] {
+			continue
+		}
+		seen[deviceID] = true
+		batch = append(batch, deviceID)
+	}
+	return batch, nil
+}
+
+// mayRevoke reports whether an organization may revoke a device: the one
+// that registered it, or an admin MSP for devices registered
+// before owners were recorded
+func mayRevoke(device *IoTDevice, mspID string, adminMSPs []string) bool {
+	if device.Owner != "" {
+		return device.Owner == mspID
+	}
+	return containsString(adminMSPs, mspID)
+}
+
+// RevokeDevices revokes a batch of devices, given as a JSON array of IDs,
+// and closes their live sessions
+func (s *ISVChaincode) RevokeDevices(ctx contractapi.TransactionContextInterface, deviceIDsJSON string, reason string) (*RevocationResult, error) {
+	if reason == "" {
+		return nil, fmt.Errorf("a revocation reason is required")
+	}
+	if len(reason) > maxRevocationReasonLength {
+		return nil, fmt.Errorf("revocation reason is %d characters, the limit is %d", len(reason), maxRevocationReasonLength)
+	}
+	limits, err := getPayloadLimits(ctx)
+	if err != nil {
+		return nil, err
+	}
+	deviceIDs, err := parseRevocationBatch(deviceIDsJSON, limits.MaxIDLength)
+	if err != nil {
+		return nil, err
+	}
+	mspID, err := callerMSP(ctx)
+	if err != nil {
+		return nil, err
+	}
+	adminMSPs, err := common.GetAdminMSPs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	currentTime, err := common.GetDeterministicTimestamp(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current timestamp: %v", err)
+	}
+
+	uow := common.NewUnitOfWork(ctx)
+	result := &RevocationResult{
+		Revoked:        []string{},
+		AlreadyRevoked: []string{},
+		NotFound:       []string{},
+		Denied:         []string{},
+		ClosedSessions: []string{},
+	}
+	revoking := make(map[string]bool)
+	for _, deviceID := range deviceIDs {
+		deviceJSON, err := uow.Get("DEVICE_" + deviceID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read device data: %v", err)
+		}
+		if deviceJSON == nil {
+			result.NotFound = append(result.NotFound, deviceID)
+			continue
+		}
+		var device IoTDevice
+		if err := json.Unmarshal(deviceJSON, &device); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal device %s: %v", deviceID, err)
+		}
+		switch {
+		case !mayRevoke(&device, mspID, adminMSPs):
+			result.Denied = append(result.Denied, deviceID)
+		case device.Status == deviceStatusRevoked:
+			result.AlreadyRevoked = append(result.AlreadyRevoked, deviceID)
+		default:
+			revoking[deviceID] = true
+			result.Revoked = append(result.Revoked, deviceID)
+		}
+	}
+
+	if len(revoking) > 0 {
+		// One scan closes the sessions of the whole batch
+		sessionIterator, err := ctx.GetStub().GetStateByRange("SESSION_", "SESSION_~")
+		if err != nil {
+			return nil, fmt.Errorf("failed to get session records: %v", err)
+		}
+		defer sessionIterator.Close()
+
+		for sessionIterator.HasNext() {
+			queryResponse, err := sessionIterator.Next()
+			if err != nil {
+				return nil, fmt.Errorf("failed to iterate session records: %v", err)
+			}
+
+			var session ClientDeviceSession
+			if err := json.Unmarshal(queryResponse.Value, &session); err != nil || session.Status != "active" || !revoking[session.DeviceID] {
+				// Session keys share the SESSION_ prefix and are not JSON
+				continue
+			}
+			if err := terminateSession(ctx, uow, queryResponse.Key, &session, currentTime); err != nil {
+				return nil, fmt.Errorf("failed to close session %s: %v", queryResponse.Key, err)
+			}
+			if _, err := putAccessLog(ctx, &AccessLogEntry{
+				DeviceID:  session.DeviceID,
+				ClientID:  session.ClientID,
+				SessionID: queryResponse.Key,
+				Action:    accessSessionClosed,
+				Detail:    accessDeviceRevoked,
+			}, queryResponse.Key); err != nil {
+				return nil, err
+			}
+			result.ClosedSessions = append(result.ClosedSessions, queryResponse.Key)
+		}
+	}
+
+	// Devices are read again so the revocation lands on top of the session
+	// closes staged above
+	for _, deviceID := range result.Revoked {
+		deviceKey := "DEVICE_" + deviceID
+		deviceJSON, err := uow.Get(deviceKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read device data: %v", err)
+		}
+		var device IoTDevice
+		if err := json.Unmarshal(deviceJSON, &device); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal device %s: %v", deviceID, err)
+		}
+		revokedAt := currentTime.UTC()
+		device.DeviceID = deviceID
+		device.Status = deviceStatusRevoked
+		device.RevokedAt = &revokedAt
+		device.RevocationReason = reason
+		if err := uow.PutJSON(deviceKey, &device); err != nil {
+			return nil, err
+		}
+		if err := uow.IncrementMetric(metricDevicesRevoked); err != nil {
+			return nil, err
+		}
+		if _, err := putAccessLog(ctx, &AccessLogEntry{
+			DeviceID: deviceID,
+			ClientID: mspID,
+			Action:   accessDeviceRevoked,
+			Detail:   reason,
+		}, deviceID); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := uow.Commit(); err != nil {
+		return nil, err
+	}
+
+	if len(result.Revoked) > 0 {
+		resultJSON, err := json.Marshal(result)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal revocation result: %v", err)
+		}
+		if err := common.SetEvent(ctx, devicesRevokedEvent, resultJSON); err != nil {
+			return nil, fmt.Errorf("failed to emit revocation event: %v", err)
+		}
+	}
+
+	fmt.Printf("Revoked %d devices (%d already revoked, %d not found, %d denied), closed %d sessions\n",
+		len(result.Revoked), len(result.AlreadyRevoked), len(result.NotFound), len(result.Denied), len(result.ClosedSessions))
+	return result, nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseRevocationBatch(t *testing.T) {
+	batch, err := parseRevocationBatch(`["device1","device2","device1"]`, 128)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"device1", "device2"}; !reflect.DeepEqual(batch, want) {
+		t.Errorf("parseRevocationBatch() = %v, want %v", batch, want)
+	}
+
+	tooMany := make([]string, maxRevocationBatch+1)
+	for i := range tooMany {
+		tooMany[i] = "device"
+	}
+	tooManyJSON, _ := json.Marshal(tooMany)
+
+	tests := []struct {
+		name          string
+		deviceIDsJSON string
+	}{
+		{"not JSON", "device1"},
+		{"empty", "[]"},
+		{"empty ID", `["device1",""]`},
+		{"long ID", `["` + strings.Repeat("d", 129) + `"]`},
+		{"too many", string(tooManyJSON)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := parseRevocationBatch(test.deviceIDsJSON, 128); err == nil {
+				t.Error("parseRevocationBatch() succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestMayRevoke(t *testing.T) {
+	admins := []string{"Org1MSP"}
+	tests := []struct {
+		name   string
+		device IoTDevice
+		mspID  string
+		want   bool
+	}{
+		{"owner", IoTDevice{Owner: "Org2MSP"}, "Org2MSP", true},
+		{"other organization", IoTDevice{Owner: "Org2MSP"}, "Org1MSP", false},
+		{"admin without owner", IoTDevice{}, "Org1MSP", true},
+		{"no owner, not admin", IoTDevice{}, "Org2MSP", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := mayRevoke(&test.device, test.mspID, admins); got != test.want {
+				t.Errorf("mayRevoke() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
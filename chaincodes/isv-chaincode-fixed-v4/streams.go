@@ -0,0 +1,358 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/blockchain-auth/common"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// One session can carry several logical streams, e.g. telemetry, control
+// and logs, instead of the client opening one session per concern. The
+// device agent opens each stream under a capability the session holds and
+// frames its traffic with the stream ID (see pkg/securechannel in BAF2).
+// CheckStreamCapability re-checks the capability against the session's
+// current set, so a restriction of the session also cuts off the streams
+// using a capability it removed. The agent reports each stream's running
+// message, byte and rejected-frame counts; the counts are cumulative, so
+// a replayed report changes nothing.
+
+// SessionStream is a logical stream within a session
+type SessionStream struct {
+	SessionID    string    `json:"sessionID"`
+	StreamID     int       `json:"streamID"`
+	Name         string    `json:"name,omitempty"` // e.g. "telemetry"
+	Capability   string    `json:"capability"`     // Capability the stream's traffic uses
+	Status       string    `json:"status"`         // "open", "closed"
+	OpenedAt     time.Time `json:"openedAt"`
+	ClosedAt     time.Time `json:"closedAt,omitempty"`
+	Messages     int64     `json:"messages"`
+	Bytes        int64     `json:"bytes"`
+	Rejected     int64     `json:"rejected"` // Frames the device refused on the stream
+	LastActivity time.Time `json:"lastActivity,omitempty"`
+}
+
+const (
+	sessionStreamObjectType = "SESSION_STREAM"
+
+	streamOpen   = "open"
+	streamClosed = "closed"
+
+	// Stream IDs fit the 16-bit field of a frame; stream 0 is the channel's
+	// own control stream
+	minStreamID = 1
+	maxStreamID = 65535
+
+	// maxOpenStreams bounds the open streams of one session
+	maxOpenStreams = 16
+
+	accessStreamOpened = "stream_opened"
+	accessStreamClosed = "stream_closed"
+
+	metricStreamsOpened = "streams_opened"
+)
+
+// openStreamMessage is the message a device agent signs to open a stream
+func openStreamMessage(sessionID string, streamID int, name, capability string) string {
+	return fmt.Sprintf("OPEN_STREAM|%s|%d|%s|%s", sessionID, streamID, name, capability)
+}
+
+// closeStreamMessage is the message a device agent signs to close a stream
+func closeStreamMessage(sessionID string, streamID int) string {
+	return fmt.Sprintf("CLOSE_STREAM|%s|%d", sessionID, streamID)
+}
+
+// streamCountersMessage is the message a device agent signs to report a
+// stream's counters
+func streamCountersMessage(sessionID string, streamID int, messages, bytes, rejected int64) string {
+	return fmt.Sprintf("STREAM_COUNTERS|%s|%d|%d|%d|%d", sessionID, streamID, messages, bytes, rejected)
+}
+
+func checkStreamID(streamID int) error {
+	if streamID < minStreamID || streamID > maxStreamID {
+		return fmt.Errorf("stream ID %d out of range %d-%d", streamID, minStreamID, maxStreamID)
+	}
+	return nil
+}
+
+func sessionStreamKey(ctx contractapi.TransactionContextInterface, sessionID string, streamID int) (string, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(sessionStreamObjectType, []string{sessionID, fmt.Sprintf("%05d", streamID)})
+	if err != nil {
+		return "", fmt.Errorf("failed to create stream key: %v", err)
+	}
+	return key, nil
+}
+
+// updateCounters applies a report of cumulative counters, which may not go
+// down, and reports whether any of them grew
+func (st *SessionStream) updateCounters(messages, bytes, rejected int64) (bool, error) {
+	if messages < 0 || bytes < 0 || rejected < 0 {
+		return false, fmt.Errorf("stream counters cannot be negative")
+	}
+	if messages < st.Messages || bytes < st.Bytes || rejected < st.Rejected {
+		return false, fmt.Errorf("stream %d counters cannot go down (have %d messages, %d bytes, %d rejected)", st.StreamID, st.Messages, st.Bytes, st.Rejected)
+	}
+	grew := messages > st.Messages || bytes > st.Bytes || rejected > st.Rejected
+	st.Messages, st.Bytes, st.Rejected = messages, bytes, rejected
+	return grew, nil
+}
+
+// OpenSessionStream opens a stream in an active session for traffic that
+// uses capability, which the session must hold. It is signed with the
+// device key.
+func (s *ISVChaincode) OpenSessionStream(ctx contractapi.TransactionContextInterface, sessionID string, streamID int, name string, capability string, signature string) (*SessionStream, error) {
+	fmt.Printf("Opening stream %d in session %s\n", streamID, sessionID)
+
+	if err := checkStreamID(streamID); err != nil {
+		return nil, err
+	}
+	if capability == "" {
+		return nil, fmt.Errorf("a stream needs a capability")
+	}
+	session, err := getActiveSession(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.verifyDeviceSignature(ctx, session.DeviceID, openStreamMessage(sessionID, streamID, name, capability), signature); err != nil {
+		return nil, err
+	}
+
+	now, err := common.GetDeterministicTimestamp(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current timestamp: %v", err)
+	}
+	if !now.Before(session.ExpiresAt) {
+		return nil, fmt.Errorf("session %s has expired", sessionID)
+	}
+	allowed, err := s.sessionCapabilities(ctx, session)
+	if err != nil {
+		return nil, err
+	}
+	if !containsString(allowed, capability) {
+		return nil, fmt.Errorf("session %s does not hold capability %s", sessionID, capability)
+	}
+
+	streams, err := s.GetSessionStreams(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	open := 0
+	for _, existing := range streams {
+		if existing.StreamID == streamID {
+			return nil, fmt.Errorf("stream %d already exists in session %s", streamID, sessionID)
+		}
+		if existing.Status == streamOpen {
+			open++
+		}
+	}
+	if open >= maxOpenStreams {
+		return nil, fmt.Errorf("session %s already has %d open streams", sessionID, open)
+	}
+
+	stream := &SessionStream{
+		SessionID:  sessionID,
+		StreamID:   streamID,
+		Name:       name,
+		Capability: capability,
+		Status:     streamOpen,
+		OpenedAt:   now.UTC(),
+	}
+	key, err := sessionStreamKey(ctx, sessionID, streamID)
+	if err != nil {
+		return nil, err
+	}
+	uow := common.NewUnitOfWork(ctx)
+	if err := uow.PutJSON(key, stream); err != nil {
+		return nil, err
+	}
+	if err := uow.IncrementMetric(metricStreamsOpened); err != nil {
+		return nil, err
+	}
+	if err := uow.Commit(); err != nil {
+		return nil, err
+	}
+	detail := fmt.Sprintf("stream %d (%s) for %s", streamID, name, capability)
+	if err := recordAccessLog(ctx, session.DeviceID, session.ClientID, sessionID, accessStreamOpened, detail); err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("Stream %d opened in session %s for %s\n", streamID, sessionID, capability)
+	return stream, nil
+}
+
+// CloseSessionStream closes a stream of a session, keeping its record and
+// counters. It is signed with the device key.
+func (s *ISVChaincode) CloseSessionStream(ctx contractapi.TransactionContextInterface, sessionID string, streamID int, signature string) error {
+	fmt.Printf("Closing stream %d in session %s\n", streamID, sessionID)
+
+	session, err := getSession(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	if err := s.verifyDeviceSignature(ctx, session.DeviceID, closeStreamMessage(sessionID, streamID), signature); err != nil {
+		return err
+	}
+	stream, key, err := getSessionStream(ctx, sessionID, streamID)
+	if err != nil {
+		return err
+	}
+	if stream.Status != streamOpen {
+		return fmt.Errorf("stream %d of session %s is already closed", streamID, sessionID)
+	}
+
+	now, err := common.GetDeterministicTimestamp(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get current timestamp: %v", err)
+	}
+	stream.Status = streamClosed
+	stream.ClosedAt = now.UTC()
+	streamJSON, err := json.Marshal(stream)
+	if err != nil {
+		return fmt.Errorf("failed to marshal stream: %v", err)
+	}
+	if err := ctx.GetStub().PutState(key, streamJSON); err != nil {
+		return fmt.Errorf("failed to store stream: %v", err)
+	}
+	detail := fmt.Sprintf("stream %d (%s): %d messages, %d bytes, %d rejected", streamID, stream.Name, stream.Messages, stream.Bytes, stream.Rejected)
+	return recordAccessLog(ctx, session.DeviceID, session.ClientID, sessionID, accessStreamClosed, detail)
+}
+
+// ReportStreamCounters records the running counters of an open stream:
+// messages and bytes carried, and frames refused. It is signed with the
+// device key. Traffic on a stream also counts as session activity.
+func (s *ISVChaincode) ReportStreamCounters(ctx contractapi.TransactionContextInterface, sessionID string, streamID int, messages int64, bytes int64, rejected int64, signature string) (*SessionStream, error) {
+	session, err := getSession(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.verifyDeviceSignature(ctx, session.DeviceID, streamCountersMessage(sessionID, streamID, messages, bytes, rejected), signature); err != nil {
+		return nil, err
+	}
+	stream, key, err := getSessionStream(ctx, sessionID, streamID)
+	if err != nil {
+		return nil, err
+	}
+	if stream.Status != streamOpen {
+		return nil, fmt.Errorf("stream %d of session %s is closed", streamID, sessionID)
+	}
+	grew, err := stream.updateCounters(messages, bytes, rejected)
+	if err != nil {
+		return nil, err
+	}
+	if !grew {
+		return stream, nil
+	}
+
+	now, err := common.GetDeterministicTimestamp(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current timestamp: %v", err)
+	}
+	stream.LastActivity = now.UTC()
+	uow := common.NewUnitOfWork(ctx)
+	if err := uow.PutJSON(key, stream); err != nil {
+		return nil, err
+	}
+	if session.Status == "active" {
+		session.LastActivity = now.UTC()
+		if err := uow.PutJSON(sessionID, session); err != nil {
+			return nil, err
+		}
+	}
+	if err := uow.Commit(); err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
+// CheckStreamCapability reports whether an open stream may carry traffic:
+// its session must be active and unexpired and still hold the stream's
+// capability. Device agents call it like CheckSessionCapability.
+func (s *ISVChaincode) CheckStreamCapability(ctx contractapi.TransactionContextInterface, sessionID string, streamID int) (bool, error) {
+	stream, _, err := getSessionStream(ctx, sessionID, streamID)
+	if err != nil {
+		return false, err
+	}
+	if stream.Status != streamOpen {
+		return false, nil
+	}
+	return s.CheckSessionCapability(ctx, sessionID, stream.Capability)
+}
+
+// GetSessionStreams returns the streams of a session, open and closed, in
+// stream ID order
+func (s *ISVChaincode) GetSessionStreams(ctx contractapi.TransactionContextInterface, sessionID string) ([]*SessionStream, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(sessionStreamObjectType, []string{sessionID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session streams: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	streams := []*SessionStream{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate session streams: %v", err)
+		}
+		var stream SessionStream
+		if err := json.Unmarshal(queryResponse.Value, &stream); err != nil {
+			fmt.Printf("Error unmarshaling stream %s: %v\n", queryResponse.Key, err)
+			continue
+		}
+		streams = append(streams, &stream)
+	}
+	return streams, nil
+}
+
+// closeSessionStreams closes the open streams of a session that is ending
+func closeSessionStreams(ctx contractapi.TransactionContextInterface, uow *common.UnitOfWork, sessionID string, now time.Time) error {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(sessionStreamObjectType, []string{sessionID})
+	if err != nil {
+		return fmt.Errorf("failed to get session streams: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return fmt.Errorf("failed to iterate session streams: %v", err)
+		}
+		var stream SessionStream
+		if err := json.Unmarshal(queryResponse.Value, &stream); err != nil {
+			return fmt.Errorf("failed to unmarshal stream %s: %v", queryResponse.Key, err)
+		}
+		if stream.Status != streamOpen {
+			continue
+		}
+		stream.Status = streamClosed
+		stream.ClosedAt = now.UTC()
+		if err := uow.PutJSON(queryResponse.Key, &stream); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getSessionStream returns a stream and its key
+func getSessionStream(ctx contractapi.TransactionContextInterface, sessionID string, streamID int) (*SessionStream, string, error) {
+	if err := checkStreamID(streamID); err != nil {
+		return nil, "", err
+	}
+	key, err := sessionStreamKey(ctx, sessionID, streamID)
+	if err != nil {
+		return nil, "", err
+	}
+	streamJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read stream: %v", err)
+	}
+	if streamJSON == nil {
+		return nil, "", fmt.Errorf("session %s has no stream %d", sessionID, streamID)
+	}
+	var stream SessionStream
+	if err := json.Unmarshal(streamJSON, &stream); err != nil {
+		return nil, "", fmt.Errorf("failed to unmarshal stream: %v", err)
+	}
+	return &stream, key, nil
+}
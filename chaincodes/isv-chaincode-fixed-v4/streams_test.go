@@ -0,0 +1,61 @@
+package main
+
+import "testing"
+
+func TestStreamMessages(t *testing.T) {
+	sessionID := "SESSION_client1_device1_1700000000"
+	if got, want := openStreamMessage(sessionID, 2, "telemetry", "read"), "OPEN_STREAM|SESSION_client1_device1_1700000000|2|telemetry|read"; got != want {
+		t.Errorf("openStreamMessage() = %q, want %q", got, want)
+	}
+	if got, want := closeStreamMessage(sessionID, 2), "CLOSE_STREAM|SESSION_client1_device1_1700000000|2"; got != want {
+		t.Errorf("closeStreamMessage() = %q, want %q", got, want)
+	}
+	if got, want := streamCountersMessage(sessionID, 2, 10, 2048, 1), "STREAM_COUNTERS|SESSION_client1_device1_1700000000|2|10|2048|1"; got != want {
+		t.Errorf("streamCountersMessage() = %q, want %q", got, want)
+	}
+}
+
+func TestCheckStreamID(t *testing.T) {
+	for _, streamID := range []int{1, 3, 65535} {
+		if err := checkStreamID(streamID); err != nil {
+			t.Errorf("checkStreamID(%d) = %v", streamID, err)
+		}
+	}
+	for _, streamID := range []int{0, -1, 65536} {
+		if err := checkStreamID(streamID); err == nil {
+			t.Errorf("checkStreamID(%d) accepted an invalid ID", streamID)
+		}
+	}
+}
+
+func TestUpdateStreamCounters(t *testing.T) {
+	stream := SessionStream{StreamID: 2, Messages: 10, Bytes: 2048, Rejected: 1}
+
+	tests := []struct {
+		name                      string
+		messages, bytes, rejected int64
+		wantGrew, wantErr         bool
+	}{
+		{"replayed report", 10, 2048, 1, false, false},
+		{"more traffic", 12, 4096, 1, true, false},
+		{"more rejections", 10, 2048, 3, true, false},
+		{"messages go down", 9, 4096, 1, false, true},
+		{"bytes go down", 12, 1024, 1, false, true},
+		{"negative", -1, 0, 0, false, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			updated := stream
+			grew, err := updated.updateCounters(test.messages, test.bytes, test.rejected)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("updateCounters() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if grew != test.wantGrew {
+				t.Errorf("updateCounters() grew = %v, want %v", grew, test.wantGrew)
+			}
+			if err != nil && updated != stream {
+				t.Errorf("a rejected report changed the counters to %+v", updated)
+			}
+		})
+	}
+}
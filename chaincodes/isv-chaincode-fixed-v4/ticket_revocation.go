@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/blockchain-auth/common"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Service tickets are validated here, not at the TGS, so the revocation
+// list of service tickets is kept by the ISV. RevokeServiceTicket records
+// when a client's tickets were revoked: ValidateServiceTicket refuses every
+// ticket of the client issued up to then, and the client's live sessions
+// are closed in the revoking transaction. Tickets the TGS issues later are
+// accepted, so an administrator cutting a client off also revokes its TGTs
+// at the TGS (authcli revoke --client-id does both).
+
+// ClientRevocation is an entry of the ISV revocation list
+type ClientRevocation struct {
+	ClientID  string    `json:"clientID"`
+	RevokedAt time.Time `json:"revokedAt"` // Tickets issued up to this time are refused
+	RevokedBy string    `json:"revokedBy"` // MSP of the administrator
+	Reason    string    `json:"reason"`
+	// ClosedSessions are the sessions the latest revocation closed
+	ClosedSessions []string `json:"closedSessions"`
+}
+
+const (
+	// ticketRevocationPrefix prefixes the revocation list entries
+	ticketRevocationPrefix = "REVOKED_TICKETS_"
+
+	accessTicketsRevoked = "tickets_revoked"
+
+	// ticketsRevokedEvent carries the ClientRevocation of a revocation
+	ticketsRevokedEvent = "ServiceTicketsRevoked"
+
+	metricTicketRevocations = "ticket_revocations"
+)
+
+// getTicketRevocation returns the client's revocation list entry, or nil if
+// its tickets were never revoked
+func getTicketRevocation(store common.StateStore, clientID string) (*ClientRevocation, error) {
+	revocationJSON, err := store.GetState(ticketRevocationPrefix + clientID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read revocation list: %v", err)
+	}
+	if revocationJSON == nil {
+		return nil, nil
+	}
+	var revocation ClientRevocation
+	if err := json.Unmarshal(revocationJSON, &revocation); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal revocation of %s: %v", clientID, err)
+	}
+	return &revocation, nil
+}
+
+// revokes reports whether the revocation covers a ticket issued at issuedAt
+func (r *ClientRevocation) revokes(issuedAt time.Time) bool {
+	return r != nil && !issuedAt.After(r.RevokedAt)
+}
+
+// RevokeServiceTicket revokes every service ticket issued to a client so
+// far and closes the client's sessions. Break-glass sessions are left to
+// CloseEmergencySession. Revoking again moves the cutoff to the new
+// revocation.
+func (s *ISVChaincode) RevokeServiceTicket(ctx contractapi.TransactionContextInterface, clientID string, reason string) (*ClientRevocation, error) {
+	if clientID == "" {
+		return nil, fmt.Errorf("client ID is required")
+	}
+	if strings.TrimSpace(reason) == "" {
+		return nil, fmt.Errorf("a revocation reason is required")
+	}
+	if len(reason) > maxRevocationReasonLength {
+		return nil, fmt.Errorf("revocation reason is %d characters, the limit is %d", len(reason), maxRevocationReasonLength)
+	}
+	mspID, err := callerMSP(ctx)
+	if err != nil {
+		return nil, err
+	}
+	currentTime, err := common.GetDeterministicTimestamp(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current timestamp: %v", err)
+	}
+
+	sessions, err := activeSessions(ctx, sessionsByClientIndex, clientID, func(session *ClientDeviceSession) bool {
+		return session.ClientID == clientID && session.EmergencyAccessID == ""
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	uow := common.NewUnitOfWork(ctx)
+	revocation := &ClientRevocation{
+		ClientID:       clientID,
+		RevokedAt:      currentTime.UTC(),
+		RevokedBy:      mspID,
+		Reason:         reason,
+		ClosedSessions: []string{},
+	}
+	for _, session := range sessions {
+		if err := terminateSession(ctx, uow, session.SessionID, session, currentTime); err != nil {
+			return nil, fmt.Errorf("failed to close session %s: %v", session.SessionID, err)
+		}
+		if _, err := putAccessLog(ctx, &AccessLogEntry{
+			DeviceID:  session.DeviceID,
+			ClientID:  clientID,
+			SessionID: session.SessionID,
+			Action:    accessSessionClosed,
+			Detail:    accessTicketsRevoked,
+		}, session.SessionID); err != nil {
+			return nil, err
+		}
+		revocation.ClosedSessions = append(revocation.ClosedSessions, session.SessionID)
+	}
+	if err := uow.PutJSON(ticketRevocationPrefix+clientID, revocation); err != nil {
+		return nil, err
+	}
+	if err := uow.IncrementMetric(metricTicketRevocations); err != nil {
+		return nil, err
+	}
+	if err := uow.Commit(); err != nil {
+		return nil, err
+	}
+
+	revocationJSON, err := json.Marshal(revocation)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal revocation: %v", err)
+	}
+	if err := common.SetEvent(ctx, ticketsRevokedEvent, revocationJSON); err != nil {
+		return nil, fmt.Errorf("failed to emit revocation event: %v", err)
+	}
+
+	fmt.Printf("Service tickets of client %s revoked by %s, closed %d sessions\n", clientID, mspID, len(revocation.ClosedSessions))
+	return revocation, nil
+}
+
+// GetTicketRevocation returns the client's revocation list entry, or
+// nothing if its tickets were never revoked
+func (s *ISVChaincode) GetTicketRevocation(ctx contractapi.TransactionContextInterface, clientID string) (*ClientRevocation, error) {
+	return getTicketRevocation(ctx.GetStub(), clientID)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/blockchain-auth/common"
+	"github.com/blockchain-auth/common/commontest"
+)
+
+func TestClientRevocationRevokes(t *testing.T) {
+	revokedAt := time.Unix(1700000000, 0)
+	revocation := &ClientRevocation{ClientID: "client1", RevokedAt: revokedAt}
+	tests := []struct {
+		name       string
+		revocation *ClientRevocation
+		issuedAt   time.Time
+		want       bool
+	}{
+		{"issued before", revocation, revokedAt.Add(-time.Minute), true},
+		{"issued in the revoking transaction", revocation, revokedAt, true},
+		{"issued after", revocation, revokedAt.Add(time.Nanosecond), false},
+		{"never revoked", nil, revokedAt, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.revocation.revokes(test.issuedAt); got != test.want {
+				t.Errorf("revokes() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestGetTicketRevocation(t *testing.T) {
+	store := commontest.NewMemoryStore(nil)
+	uow := common.NewUnitOfWorkOn(store)
+	if err := uow.PutJSON(ticketRevocationPrefix+"client1", &ClientRevocation{
+		ClientID:  "client1",
+		RevokedAt: time.Unix(1700000000, 0).UTC(),
+		Reason:    "compromised",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := uow.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	revocation, err := getTicketRevocation(store, "client1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revocation == nil || revocation.Reason != "compromised" {
+		t.Errorf("getTicketRevocation(client1) = %+v", revocation)
+	}
+	if revocation, err := getTicketRevocation(store, "client2"); err != nil || revocation != nil {
+		t.Errorf("getTicketRevocation(client2) = %+v, %v, want nil", revocation, err)
+	}
+}
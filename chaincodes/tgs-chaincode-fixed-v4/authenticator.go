@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// authenticatorMaxSkew is how far an authenticator's timestamp may be from
+// the transaction time, in seconds. An authenticator must name the client of
+// the TGT and be made within it, and is then consumed in the replay cache
+// (see chaincodes/common/replay_cache.go) so it is good for one request.
+const authenticatorMaxSkew = 5 * 60
+
+// tgsAuthenticator is a decoded client authenticator (ticket.Authenticator
+// in the client library). Clients before it sent the timestamp as a string,
+// in Unix seconds or RFC 3339.
+type tgsAuthenticator struct {
+	ClientID  string          `json:"clientID"`
+	Timestamp json.RawMessage `json:"timestamp"`
+}
+
+// unixTime returns the authenticator's timestamp in Unix seconds
+func (a *tgsAuthenticator) unixTime() (int64, error) {
+	var seconds int64
+	if err := json.Unmarshal(a.Timestamp, &seconds); err == nil {
+		return seconds, nil
+	}
+	var text string
+	if err := json.Unmarshal(a.Timestamp, &text); err != nil {
+		return 0, fmt.Errorf("invalid authenticator timestamp")
+	}
+	if seconds, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return seconds, nil
+	}
+	parsed, err := time.Parse(time.RFC3339, text)
+	if err != nil {
+		return 0, fmt.Errorf("invalid authenticator timestamp %q", text)
+	}
+	return parsed.Unix(), nil
+}
+
+// checkAuthenticator checks that an authenticator names the client and was
+// made within authenticatorMaxSkew of now
+func checkAuthenticator(authenticatorB64, clientID string, now time.Time) error {
+	authenticatorJSON, err := base64.StdEncoding.DecodeString(authenticatorB64)
+	if err != nil {
+		return fmt.Errorf("invalid authenticator (base64 decoding failed): %v", err)
+	}
+	var authenticator tgsAuthenticator
+	if err := json.Unmarshal(authenticatorJSON, &authenticator); err != nil {
+		return fmt.Errorf("invalid authenticator (JSON parsing failed): %v", err)
+	}
+	if authenticator.ClientID != clientID {
+		return fmt.Errorf("authenticator is for client %s, not %s", authenticator.ClientID, clientID)
+	}
+	timestamp, err := authenticator.unixTime()
+	if err != nil {
+		return err
+	}
+	skew := now.Unix() - timestamp
+	if skew > authenticatorMaxSkew || skew < -authenticatorMaxSkew {
+		return fmt.Errorf("authenticator time is more than %d seconds from the transaction time; check the local clock", authenticatorMaxSkew)
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestCheckAuthenticator(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	encode := func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) }
+	authenticator := func(clientID string, timestamp int64) string {
+		return encode(fmt.Sprintf(`{"clientID":%q,"timestamp":%d,"nonce":"n"}`, clientID, timestamp))
+	}
+	tests := []struct {
+		name          string
+		authenticator string
+		wantErr       bool
+	}{
+		{"fresh", authenticator("client1", now.Unix()), false},
+		{"within skew", authenticator("client1", now.Unix()-authenticatorMaxSkew), false},
+		{"stale", authenticator("client1", now.Unix()-authenticatorMaxSkew-1), true},
+		{"future", authenticator("client1", now.Unix()+authenticatorMaxSkew+1), true},
+		{"other client", authenticator("client2", now.Unix()), true},
+		{"string seconds", encode(fmt.Sprintf(`{"clientID":"client1","timestamp":"%d"}`, now.Unix())), false},
+		{"RFC 3339", encode(`{"clientID":"client1","timestamp":"` + now.UTC().Format(time.RFC3339) + `"}`), false},
+		{"stale RFC 3339", encode(`{"clientID":"client1","timestamp":"` + now.Add(-time.Hour).UTC().Format(time.RFC3339) + `"}`), true},
+		{"bad timestamp", encode(`{"clientID":"client1","timestamp":"yesterday"}`), true},
+		{"no timestamp", encode(`{"clientID":"client1"}`), true},
+		{"not base64", "not base64!", true},
+		{"not json", encode("client1"), true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := checkAuthenticator(test.authenticator, "client1", now)
+			if (err != nil) != test.wantErr {
+				t.Errorf("checkAuthenticator() error = %v, wantErr %v", err, test.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/blockchain-auth/common"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// When a client deregisters or rotates its key, the AS calls
+// ProcessClientChangeFromAS in the same transaction with a ClientChange
+// signed with the AS key and sealed for the TGS (see
+// common/signed_notice.go). The TGS key is public, so only the signature,
+// checked against the AS key imported with ImportPeerServiceKey, shows the
+// change came from the AS. A change is dated with the transaction that
+// makes it, which rules out replaying an old one or dating one ahead to
+// lock the client out. The client's record is marked with the
+// change and TGTs issued up to it are refused from then on: they no longer
+// register the client (ProcessRegistrationFromAS) or get service tickets.
+// The next TGT the client presents after authenticating again makes the
+// record active.
+
+const (
+	clientChangeDeregistered = "deregistered"
+	clientChangeKeyRotated   = "key_rotated"
+)
+
+// ClientChange is the notice of a deregistration or key rotation sent by
+// the AS
+type ClientChange struct {
+	ClientID  string    `json:"clientID"`
+	Change    string    `json:"change"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// getClientRecord returns the client's record, or nil if it has none
+func getClientRecord(store common.StateStore, clientID string) (*ClientRecord, error) {
+	clientRecordJSON, err := store.GetState("CLIENT_RECORD_" + clientID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client record: %v", err)
+	}
+	if clientRecordJSON == nil {
+		return nil, nil
+	}
+	var clientRecord ClientRecord
+	if err := json.Unmarshal(clientRecordJSON, &clientRecord); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal client record: %v", err)
+	}
+	return &clientRecord, nil
+}
+
+// checkTGTAfterClientChange refuses a TGT issued before the last change the
+// AS reported for its client
+func checkTGTAfterClientChange(clientRecord *ClientRecord, tgt *TGT) error {
+	if clientRecord != nil && !tgt.Timestamp.After(clientRecord.TGTsValidAfter) {
+		return fmt.Errorf("TGT was issued before the client was deregistered or rotated its key at %s; authenticate again",
+			clientRecord.TGTsValidAfter.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// checkClientChange validates a change the AS made in the transaction at now
+func checkClientChange(change *ClientChange, now time.Time) error {
+	if change.ClientID == "" {
+		return fmt.Errorf("client change has no client ID")
+	}
+	if change.Change != clientChangeDeregistered && change.Change != clientChangeKeyRotated {
+		return fmt.Errorf("unknown client change %q", change.Change)
+	}
+	if !change.Timestamp.Equal(now) {
+		return fmt.Errorf("client change is dated %s, not with this transaction", change.Timestamp.Format(time.RFC3339Nano))
+	}
+	return nil
+}
+
+// ProcessClientChangeFromAS records a deregistration or key rotation sent
+// by the AS
+func (s *TGSChaincode) ProcessClientChangeFromAS(ctx contractapi.TransactionContextInterface, encryptedChange string) error {
+	changeBytes, err := base64.StdEncoding.DecodeString(encryptedChange)
+	if err != nil {
+		return fmt.Errorf("invalid client change format (base64 decoding failed): %v", err)
+	}
+	privateKey, err := s.getPrivateKey(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get TGS private key: %v", err)
+	}
+	decryptedChange, err := common.DecryptNegotiated(ctx, "client change decryption", privateKey, changeBytes)
+	if err != nil {
+		return err
+	}
+	if err := common.RequireServiceKey(ctx, "AS", "AS_PUBLIC_KEY"); err != nil {
+		return err
+	}
+	asPublicKey, err := s.getPublicKey(ctx, "AS_PUBLIC_KEY")
+	if err != nil {
+		return err
+	}
+	changeJSON, err := common.OpenSignedNotice("client change signature verification", asPublicKey, decryptedChange)
+	if err != nil {
+		return err
+	}
+
+	var change ClientChange
+	if err := json.Unmarshal(changeJSON, &change); err != nil {
+		return fmt.Errorf("invalid client change structure (JSON parsing failed): %v", err)
+	}
+	now, err := common.GetDeterministicTimestamp(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get timestamp: %v", err)
+	}
+	if err := checkClientChange(&change, now); err != nil {
+		return err
+	}
+
+	clientRecord, err := getClientRecord(ctx.GetStub(), change.ClientID)
+	if err != nil {
+		return err
+	}
+	if clientRecord == nil {
+		clientRecord = &ClientRecord{ClientID: change.ClientID}
+	}
+	clientRecord.Status = change.Change
+	clientRecord.TGTsValidAfter = change.Timestamp
+	clientRecord.ValidUntil = change.Timestamp
+
+	uow := common.NewUnitOfWork(ctx)
+	if err := uow.PutJSON("CLIENT_RECORD_"+change.ClientID, clientRecord); err != nil {
+		return err
+	}
+	// The session key of a TGT issued before the change must not outlive it
+	uow.Del("SESSION_KEY_" + change.ClientID)
+	if err := uow.Commit(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Client %s %s at %s\n", change.ClientID, change.Change, change.Timestamp.Format(time.RFC3339))
+	return nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/blockchain-auth/common"
+	"github.com/blockchain-auth/common/commontest"
+)
+
+func TestCheckTGTAfterClientChange(t *testing.T) {
+	changedAt := time.Unix(1700000000, 0)
+	record := &ClientRecord{ClientID: "client1", Status: clientChangeKeyRotated, TGTsValidAfter: changedAt}
+	tests := []struct {
+		name     string
+		record   *ClientRecord
+		issuedAt time.Time
+		wantErr  bool
+	}{
+		{"no record", nil, changedAt, false},
+		{"never changed", &ClientRecord{ClientID: "client1"}, changedAt, false},
+		{"issued before", record, changedAt.Add(-time.Minute), true},
+		{"issued in the changing transaction", record, changedAt, true},
+		{"issued after", record, changedAt.Add(time.Second), false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := checkTGTAfterClientChange(test.record, &TGT{ClientID: "client1", Timestamp: test.issuedAt})
+			if (err != nil) != test.wantErr {
+				t.Errorf("checkTGTAfterClientChange() error = %v, wantErr %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestGetClientRecord(t *testing.T) {
+	store := commontest.NewMemoryStore(nil)
+	uow := common.NewUnitOfWorkOn(store)
+	if err := uow.PutJSON("CLIENT_RECORD_client1", &ClientRecord{ClientID: "client1", Status: clientChangeDeregistered}); err != nil {
+		t.Fatal(err)
+	}
+	if err := uow.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	record, err := getClientRecord(store, "client1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record == nil || record.Status != clientChangeDeregistered {
+		t.Errorf("getClientRecord(client1) = %+v", record)
+	}
+	if record, err := getClientRecord(store, "client2"); err != nil || record != nil {
+		t.Errorf("getClientRecord(client2) = %+v, %v, want nil", record, err)
+	}
+}
+
+func TestCheckClientChange(t *testing.T) {
+	now := time.Unix(1700000000, 500)
+	tests := []struct {
+		name    string
+		change  ClientChange
+		wantErr bool
+	}{
+		{"deregistered", ClientChange{ClientID: "client1", Change: clientChangeDeregistered, Timestamp: now.UTC()}, false},
+		{"key rotated", ClientChange{ClientID: "client1", Change: clientChangeKeyRotated, Timestamp: now}, false},
+		{"no client", ClientChange{Change: clientChangeDeregistered, Timestamp: now}, true},
+		{"unknown change", ClientChange{ClientID: "client1", Change: "suspended", Timestamp: now}, true},
+		{"dated ahead", ClientChange{ClientID: "client1", Change: clientChangeDeregistered, Timestamp: now.Add(time.Hour)}, true},
+		{"from an earlier transaction", ClientChange{ClientID: "client1", Change: clientChangeDeregistered, Timestamp: now.Add(-time.Hour)}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := checkClientChange(&test.change, now)
+			if (err != nil) != test.wantErr {
+				t.Errorf("checkClientChange() error = %v, wantErr %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestProcessClientChangeFromAS(t *testing.T) {
+	s := &TGSChaincode{}
+	stub := commontest.NewStub("tgs")
+	ctx := commontest.NewContext(stub, &commontest.FakeIdentity{MSPID: "Org1MSP"})
+	tgsKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	asKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub.State["TGS_PRIVATE_KEY"] = pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(tgsKey)})
+	stub.State["SESSION_KEY_client1"] = []byte("session-key")
+	now, err := common.GetDeterministicTimestamp(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// seal signs a change with signer and seals it for the TGS
+	seal := func(signer *rsa.PrivateKey, change ClientChange) string {
+		changeJSON, _ := json.Marshal(change)
+		signed, err := common.SignNotice(signer, changeJSON)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sealed, err := common.EncryptForService(ctx, &tgsKey.PublicKey, signed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.StdEncoding.EncodeToString(sealed)
+	}
+	change := ClientChange{ClientID: "client1", Change: clientChangeDeregistered, Timestamp: now.UTC()}
+
+	if err := s.ProcessClientChangeFromAS(ctx, seal(asKey, change)); err == nil {
+		t.Fatal("client change accepted before the AS key was imported")
+	}
+	asPublicDER, err := x509.MarshalPKIXPublicKey(&asKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub.State["AS_PUBLIC_KEY"] = pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: asPublicDER})
+
+	// Any member can seal a change for the TGS, but only the AS can sign it
+	forger, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ProcessClientChangeFromAS(ctx, seal(forger, change)); err == nil {
+		t.Error("client change signed by another key accepted")
+	}
+	ahead := change
+	ahead.Timestamp = now.Add(24 * time.Hour)
+	if err := s.ProcessClientChangeFromAS(ctx, seal(asKey, ahead)); err == nil {
+		t.Error("client change dated ahead accepted")
+	}
+	if _, ok := stub.State["SESSION_KEY_client1"]; !ok {
+		t.Fatal("a refused change removed the session key")
+	}
+
+	if err := s.ProcessClientChangeFromAS(ctx, seal(asKey, change)); err != nil {
+		t.Fatalf("ProcessClientChangeFromAS failed: %v", err)
+	}
+	record, err := getClientRecord(stub, "client1")
+	if err != nil || record == nil || record.Status != clientChangeDeregistered || !record.TGTsValidAfter.Equal(now) {
+		t.Errorf("client record after the change = %+v, %v", record, err)
+	}
+	if _, ok := stub.State["SESSION_KEY_client1"]; ok {
+		t.Error("session key kept after the change")
+	}
+}
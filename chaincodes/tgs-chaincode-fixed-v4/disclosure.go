@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/blockchain-auth/common"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// The AS copies the attributes a client registered (department, clearance)
+// into its TGTs. A service's disclosure policy names the attributes the
+// service needs to enforce its rules; the TGS copies only those into the
+// client's service tickets for it. A service without a policy learns no
+// attributes, and an attribute the client has not registered is left out.
+//
+// Policies are set by the admin MSPs, by identities without a role or with
+// the policy-admin role.
+
+const (
+	// disclosurePolicyPrefix prefixes the disclosure policy of each service
+	disclosurePolicyPrefix = "DISCLOSURE_POLICY_"
+
+	maxDisclosedAttributes   = 16
+	maxAttributeNameLength   = 317 // A label key: a 253-character prefix, '/' and a 63-character name
+	disclosurePolicySetEvent = "DisclosurePolicySet"
+)
+
+// DisclosurePolicy lists the client attributes disclosed to a service
+type DisclosurePolicy struct {
+	ServiceID  string    `json:"serviceID"`
+	Attributes []string  `json:"attributes"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+	UpdatedBy  string    `json:"updatedBy"` // MSP of the administrator
+}
+
+// parseDisclosedAttributes parses a JSON array of attribute names, sorted
+// and without duplicates
+func parseDisclosedAttributes(attributesJSON string) ([]string, error) {
+	var attributes []string
+	if err := json.Unmarshal([]byte(attributesJSON), &attributes); err != nil {
+		return nil, fmt.Errorf("invalid attributes (expected a JSON array of names): %v", err)
+	}
+	if len(attributes) > maxDisclosedAttributes {
+		return nil, fmt.Errorf("a policy discloses at most %d attributes", maxDisclosedAttributes)
+	}
+	seen := make(map[string]bool)
+	names := make([]string, 0, len(attributes))
+	for _, name := range attributes {
+		if name == "" || len(name) > maxAttributeNameLength {
+			return nil, fmt.Errorf("invalid attribute name %q", name)
+		}
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// getDisclosurePolicy returns a service's disclosure policy, or nil if it
+// has none
+func getDisclosurePolicy(store common.StateStore, serviceID string) (*DisclosurePolicy, error) {
+	policyJSON, err := store.GetState(disclosurePolicyPrefix + serviceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read disclosure policy: %v", err)
+	}
+	if policyJSON == nil {
+		return nil, nil
+	}
+	var policy DisclosurePolicy
+	if err := json.Unmarshal(policyJSON, &policy); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal disclosure policy: %v", err)
+	}
+	return &policy, nil
+}
+
+// disclose returns the attributes the policy names that the client has, or
+// nil if there are none
+func (p *DisclosurePolicy) disclose(attributes map[string]string) map[string]string {
+	if p == nil {
+		return nil
+	}
+	var disclosed map[string]string
+	for _, name := range p.Attributes {
+		if value, ok := attributes[name]; ok {
+			if disclosed == nil {
+				disclosed = make(map[string]string)
+			}
+			disclosed[name] = value
+		}
+	}
+	return disclosed
+}
+
+// SetDisclosurePolicy sets the client attributes disclosed in service
+// tickets for serviceID. attributesJSON is a JSON array of attribute names;
+// an empty array discloses none.
+func (s *TGSChaincode) SetDisclosurePolicy(ctx contractapi.TransactionContextInterface, serviceID string, attributesJSON string) (*DisclosurePolicy, error) {
+	if serviceID == "" {
+		return nil, fmt.Errorf("service ID is required")
+	}
+	attributes, err := parseDisclosedAttributes(attributesJSON)
+	if err != nil {
+		return nil, err
+	}
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get caller MSP ID: %v", err)
+	}
+	now, err := common.GetDeterministicTimestamp(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get timestamp: %v", err)
+	}
+
+	policy := &DisclosurePolicy{
+		ServiceID:  serviceID,
+		Attributes: attributes,
+		UpdatedAt:  now.UTC(),
+		UpdatedBy:  mspID,
+	}
+	uow := common.NewUnitOfWork(ctx)
+	if err := uow.PutJSON(disclosurePolicyPrefix+serviceID, policy); err != nil {
+		return nil, err
+	}
+	if err := uow.Commit(); err != nil {
+		return nil, err
+	}
+
+	policyJSON, err := json.Marshal(policy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal disclosure policy: %v", err)
+	}
+	if err := common.SetEvent(ctx, disclosurePolicySetEvent, policyJSON); err != nil {
+		return nil, fmt.Errorf("failed to emit disclosure policy event: %v", err)
+	}
+	return policy, nil
+}
+
+// GetDisclosurePolicy returns a service's disclosure policy, or nothing if
+// the service learns no attributes
+func (s *TGSChaincode) GetDisclosurePolicy(ctx contractapi.TransactionContextInterface, serviceID string) (*DisclosurePolicy, error) {
+	return getDisclosurePolicy(ctx.GetStub(), serviceID)
+}
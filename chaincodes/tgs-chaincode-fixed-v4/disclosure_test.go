@@ -0,0 +1,55 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseDisclosedAttributes(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		want    []string
+		wantErr bool
+	}{
+		{"sorted", `["department","clearance"]`, []string{"clearance", "department"}, false},
+		{"duplicates", `["clearance","clearance"]`, []string{"clearance"}, false},
+		{"none", `[]`, []string{}, false},
+		{"empty name", `[""]`, nil, true},
+		{"overlong name", `["` + strings.Repeat("a", maxAttributeNameLength+1) + `"]`, nil, true},
+		{"not an array", `{"clearance":true}`, nil, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseDisclosedAttributes(test.json)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("parseDisclosedAttributes() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(got, test.want) {
+				t.Errorf("parseDisclosedAttributes() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDisclosePolicy(t *testing.T) {
+	attributes := map[string]string{"department": "ops", "clearance": "secret", "site": "plant-7"}
+	tests := []struct {
+		name   string
+		policy *DisclosurePolicy
+		want   map[string]string
+	}{
+		{"no policy", nil, nil},
+		{"empty policy", &DisclosurePolicy{}, nil},
+		{"subset", &DisclosurePolicy{Attributes: []string{"clearance"}}, map[string]string{"clearance": "secret"}},
+		{"unregistered attribute", &DisclosurePolicy{Attributes: []string{"clearance", "team"}}, map[string]string{"clearance": "secret"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.policy.disclose(attributes); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("disclose() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -1,8 +1,11 @@
 module github.com/hyperledger/fabric-samples/chaincode/tgs-chaincode-fixed-v4
 
-go 1.20
+go 1.21
 
-require github.com/hyperledger/fabric-contract-api-go v1.1.1
+require (
+	github.com/blockchain-auth/common v0.0.0
+	github.com/hyperledger/fabric-contract-api-go v1.1.1
+)
 
 require (
 	github.com/PuerkitoBio/purell v1.1.1 // indirect
@@ -30,3 +33,5 @@ require (
 	google.golang.org/grpc v1.23.0 // indirect
 	gopkg.in/yaml.v2 v2.2.8 // indirect
 )
+
+replace github.com/blockchain-auth/common => ../common
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Clients ask each chaincode which protocol versions it speaks before
+// picking message formats (see protocol.go in the AS chaincode). The TGS
+// speaks version 1 with JSON ticket claims, and reads tickets in any
+// padding its configuration accepts (see common/padding.go).
+
+// ProtocolInfo is what GetProtocolInfo reports
+type ProtocolInfo struct {
+	Service       string   `json:"service"`
+	Versions      []int    `json:"versions"`
+	Encryption    []string `json:"encryption"`
+	TicketFormats []string `json:"ticketFormats"`
+}
+
+// GetProtocolInfo reports the protocol versions and message formats this
+// chaincode supports
+func (s *TGSChaincode) GetProtocolInfo(ctx contractapi.TransactionContextInterface) (*ProtocolInfo, error) {
+	return &ProtocolInfo{
+		Service:       "tgs",
+		Versions:      []int{1},
+		Encryption:    []string{"rsa-pkcs1v15", "rsa-oaep-sha256", "rsa-oaep-aes256gcm"},
+		TicketFormats: []string{"json"},
+	}, nil
+}
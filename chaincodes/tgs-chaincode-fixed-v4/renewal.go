@@ -0,0 +1,107 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/blockchain-auth/common"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// A client holding a service ticket that is still valid can renew it with
+// RenewServiceTicket instead of asking for a new one: the old ticket is
+// marked renewed and a ticket with a new session key and lifetime is
+// issued. The client still needs a valid TGT (see RenewTGT in the AS
+// chaincode), so renewals stop when its TGT can no longer be renewed.
+
+// ticketStatusRenewed marks a ticket record replaced by a renewal
+const ticketStatusRenewed = "renewed"
+
+// ServiceTicketRenewalRequest asks for a service ticket to replace one the
+// client holds
+type ServiceTicketRenewalRequest struct {
+	ServiceTicketRequest
+	EncryptedServiceTicket string `json:"encryptedServiceTicket"` // Ticket being renewed
+}
+
+// checkTicketRenewable returns why the ticket cannot be renewed at now, if
+// it cannot
+func checkTicketRenewable(ticketRecord *TicketRecord, now time.Time) error {
+	switch ticketRecord.Status {
+	case "issued":
+	case ticketStatusRenewed:
+		return fmt.Errorf("service ticket has already been renewed")
+	default:
+		return fmt.Errorf("service ticket is %s", ticketRecord.Status)
+	}
+	expiresAt := ticketRecord.Timestamp.Add(serviceTicketLifetime * time.Second)
+	if !now.Before(expiresAt) {
+		return fmt.Errorf("service ticket expired at %s; request a new one", expiresAt.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// RenewServiceTicket replaces a service ticket the client holds with a new
+// one. The request is a ServiceTicketRenewalRequest; the TGT and
+// authenticator are validated as for GenerateServiceTicket.
+func (s *TGSChaincode) RenewServiceTicket(ctx contractapi.TransactionContextInterface, request string) (*ServiceTicketResponse, error) {
+	var renewalRequest ServiceTicketRenewalRequest
+	if err := json.Unmarshal([]byte(request), &renewalRequest); err != nil {
+		return nil, fmt.Errorf("invalid request format (JSON parsing failed): %v", err)
+	}
+	if renewalRequest.ServiceID == "" || renewalRequest.EncryptedServiceTicket == "" {
+		return nil, fmt.Errorf("service ID and encrypted service ticket are required")
+	}
+
+	fmt.Printf("Renewing service ticket for client %s, service %s\n",
+		renewalRequest.ClientID, renewalRequest.ServiceID)
+
+	tgt, err := s.validateTGT(ctx, renewalRequest.EncryptedTGT, renewalRequest.ClientID, renewalRequest.AuthenticatorB64)
+	if err != nil {
+		return nil, err
+	}
+
+	encryptedTicketHash := fmt.Sprintf("%x", sha256.Sum256([]byte(renewalRequest.EncryptedServiceTicket)))
+	ticketKey, ticketRecord, err := findTicketRecord(ctx, tgt.ClientID, renewalRequest.ServiceID, encryptedTicketHash)
+	if err != nil {
+		return nil, err
+	}
+	if ticketRecord == nil {
+		return nil, fmt.Errorf("no issued ticket found for client %s and service %s", tgt.ClientID, renewalRequest.ServiceID)
+	}
+
+	now, err := common.GetDeterministicTimestamp(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get renewal timestamp: %v", err)
+	}
+	if err := checkTicketRenewable(ticketRecord, now); err != nil {
+		return nil, err
+	}
+	// The new record would overwrite the old one
+	if ticketRecord.Timestamp.Unix() == now.Unix() {
+		return nil, fmt.Errorf("service ticket was issued this second; renew it later")
+	}
+
+	ticketRecord.Status = ticketStatusRenewed
+	ticketRecord.RenewedAt = now
+
+	uow := common.NewUnitOfWork(ctx)
+	if err := uow.PutJSON(ticketKey, ticketRecord); err != nil {
+		return nil, err
+	}
+	response, err := s.issueServiceTicket(ctx, uow, tgt, renewalRequest.ServiceID)
+	if err != nil {
+		return nil, err
+	}
+	if err := uow.IncrementMetric(metricTicketsRenewed); err != nil {
+		return nil, err
+	}
+	if err := uow.Commit(); err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("Service ticket %s renewed at %s\n", ticketKey, now.Format(time.RFC3339))
+	return response, nil
+}
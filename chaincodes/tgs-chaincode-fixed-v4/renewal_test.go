@@ -0,0 +1,30 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCheckTicketRenewable(t *testing.T) {
+	issued := time.Unix(1700000000, 0)
+	tests := []struct {
+		name    string
+		status  string
+		now     time.Time
+		wantErr bool
+	}{
+		{"valid", "issued", issued.Add(time.Minute), false},
+		{"expired", "issued", issued.Add(serviceTicketLifetime * time.Second), true},
+		{"renewed", ticketStatusRenewed, issued.Add(time.Minute), true},
+		{"revoked", "revoked", issued.Add(time.Minute), true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			record := &TicketRecord{Timestamp: issued, Status: test.status}
+			err := checkTicketRenewable(record, test.now)
+			if (err != nil) != test.wantErr {
+				t.Errorf("checkTicketRenewable() error = %v, wantErr %v", err, test.wantErr)
+			}
+		})
+	}
+}
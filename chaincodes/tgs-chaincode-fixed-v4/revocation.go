@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/blockchain-auth/common"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// An administrator who learns that a client's key is compromised revokes
+// the client's TGTs with RevokeTGT. The client is put on the TGS revocation
+// list: CheckRegistrationValidity reports it invalid from then on, so every
+// TGT it holds or obtains from the AS is refused and it gets no more
+// service tickets. Tickets it already holds are revoked at the ISV (see
+// RevokeServiceTicket in the ISV chaincode).
+//
+// Like a device revocation, a TGT revocation is permanent. A client whose
+// key was compromised registers again under a new ID with a new key.
+
+// ClientRevocation is an entry of the TGS revocation list
+type ClientRevocation struct {
+	ClientID  string    `json:"clientID"`
+	RevokedAt time.Time `json:"revokedAt"`
+	RevokedBy string    `json:"revokedBy"` // MSP of the administrator
+	Reason    string    `json:"reason"`
+	FlowID    string    `json:"flowID,omitempty"`
+}
+
+const (
+	// tgtRevocationPrefix prefixes the revocation list entries
+	tgtRevocationPrefix = "REVOKED_TGT_"
+
+	maxRevocationReasonLength = 256
+
+	// clientRevokedEvent carries the ClientRevocation of a newly revoked
+	// client
+	clientRevokedEvent = "ClientRevoked"
+
+	metricTGTsRevoked = "tgts_revoked"
+)
+
+// checkRevocationReason rejects a missing or overlong revocation reason
+func checkRevocationReason(reason string) error {
+	if strings.TrimSpace(reason) == "" {
+		return fmt.Errorf("a revocation reason is required")
+	}
+	if len(reason) > maxRevocationReasonLength {
+		return fmt.Errorf("revocation reason is %d characters, the limit is %d", len(reason), maxRevocationReasonLength)
+	}
+	return nil
+}
+
+// getTGTRevocation returns the client's revocation list entry, or nil if
+// the client is not revoked
+func getTGTRevocation(store common.StateStore, clientID string) (*ClientRevocation, error) {
+	revocationJSON, err := store.GetState(tgtRevocationPrefix + clientID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read revocation list: %v", err)
+	}
+	if revocationJSON == nil {
+		return nil, nil
+	}
+	var revocation ClientRevocation
+	if err := json.Unmarshal(revocationJSON, &revocation); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal revocation of %s: %v", clientID, err)
+	}
+	return &revocation, nil
+}
+
+// RevokeTGT puts a client on the revocation list, so that none of its TGTs
+// is accepted again. Revoking a revoked client returns its existing entry.
+func (s *TGSChaincode) RevokeTGT(ctx contractapi.TransactionContextInterface, clientID string, reason string) (*ClientRevocation, error) {
+	if clientID == "" {
+		return nil, fmt.Errorf("client ID is required")
+	}
+	if err := checkRevocationReason(reason); err != nil {
+		return nil, err
+	}
+
+	existing, err := getTGTRevocation(ctx.GetStub(), clientID)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		fmt.Printf("Client %s was already revoked at %s\n", clientID, existing.RevokedAt.Format(time.RFC3339))
+		return existing, nil
+	}
+
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get caller MSP ID: %v", err)
+	}
+	revokedAt, err := common.GetDeterministicTimestamp(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get revocation timestamp: %v", err)
+	}
+	flowID, err := common.GetFlowID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	revocation := &ClientRevocation{
+		ClientID:  clientID,
+		RevokedAt: revokedAt.UTC(),
+		RevokedBy: mspID,
+		Reason:    reason,
+		FlowID:    flowID,
+	}
+
+	uow := common.NewUnitOfWork(ctx)
+	if err := uow.PutJSON(tgtRevocationPrefix+clientID, revocation); err != nil {
+		return nil, err
+	}
+	if err := uow.IncrementMetric(metricTGTsRevoked); err != nil {
+		return nil, err
+	}
+	if err := uow.Commit(); err != nil {
+		return nil, err
+	}
+
+	revocationJSON, err := json.Marshal(revocation)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal revocation: %v", err)
+	}
+	if err := common.SetEvent(ctx, clientRevokedEvent, revocationJSON); err != nil {
+		return nil, fmt.Errorf("failed to emit revocation event: %v", err)
+	}
+
+	fmt.Printf("TGTs of client %s revoked by %s\n", clientID, mspID)
+	return revocation, nil
+}
+
+// GetTGTRevocation returns the client's revocation list entry, or nothing
+// if the client is not revoked
+func (s *TGSChaincode) GetTGTRevocation(ctx contractapi.TransactionContextInterface, clientID string) (*ClientRevocation, error) {
+	return getTGTRevocation(ctx.GetStub(), clientID)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blockchain-auth/common"
+	"github.com/blockchain-auth/common/commontest"
+)
+
+func TestCheckRevocationReason(t *testing.T) {
+	tests := []struct {
+		name    string
+		reason  string
+		wantErr bool
+	}{
+		{"reason", "key leaked in CI logs", false},
+		{"empty", "", true},
+		{"blank", "   ", true},
+		{"too long", strings.Repeat("r", maxRevocationReasonLength+1), true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := checkRevocationReason(test.reason)
+			if (err != nil) != test.wantErr {
+				t.Errorf("checkRevocationReason() error = %v, wantErr %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestGetTGTRevocation(t *testing.T) {
+	store := commontest.NewMemoryStore(nil)
+	uow := common.NewUnitOfWorkOn(store)
+	revokedAt := time.Unix(1700000000, 0).UTC()
+	if err := uow.PutJSON(tgtRevocationPrefix+"client1", &ClientRevocation{
+		ClientID:  "client1",
+		RevokedAt: revokedAt,
+		RevokedBy: "Org1MSP",
+		Reason:    "compromised",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := uow.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	revocation, err := getTGTRevocation(store, "client1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revocation == nil || !revocation.RevokedAt.Equal(revokedAt) || revocation.Reason != "compromised" {
+		t.Errorf("getTGTRevocation(client1) = %+v", revocation)
+	}
+
+	// The prefix of a revoked ID does not match other clients
+	for _, clientID := range []string{"client", "client10"} {
+		revocation, err := getTGTRevocation(store, clientID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if revocation != nil {
+			t.Errorf("getTGTRevocation(%s) = %+v, want nil", clientID, revocation)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+)
+
+// The TGS hands the client the service session key KU,SS it puts in the
+// service ticket, sealed under the client's TGS session key KU,TGS from the
+// AS. With KU,SS the client can check the ISV's reply to its authenticator,
+// so the ISV proves it could open the service ticket (mutual
+// authentication, see mutual_auth.go in the ISV chaincode).
+//
+// A sealed value is a 12-byte nonce followed by the AES-256-GCM ciphertext,
+// with the key usage as additional data so that a value sealed for one
+// purpose is not accepted for another. The nonce is derived from the
+// transaction, so that every endorsing peer returns the same response.
+
+const (
+	// sessionKeyUsage is the key usage of a KU,SS sealed for the client
+	sessionKeyUsage = "service-session-key"
+
+	sealNonceSize = 12
+)
+
+// sealWithSessionKey seals plaintext under a base64 AES-256 session key.
+// nonceSeed must differ between values sealed under the same key, e.g. the
+// transaction ID and service ID.
+func sealWithSessionKey(sessionKeyB64, usage, nonceSeed string, plaintext []byte) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(sessionKeyB64)
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("session key is not a base64 AES-256 key")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	seed := sha256.Sum256([]byte(usage + "|" + nonceSeed))
+	nonce := seed[:sealNonceSize]
+	return gcm.Seal(append([]byte(nil), nonce...), nonce, plaintext, []byte(usage)), nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/base64"
+	"testing"
+)
+
+func TestSealWithSessionKey(t *testing.T) {
+	keyBytes := sha256.Sum256([]byte("KU,TGS"))
+	key := base64.StdEncoding.EncodeToString(keyBytes[:])
+	plaintext := []byte("KU,SS")
+
+	sealed, err := sealWithSessionKey(key, sessionKeyUsage, "tx1|iotservice1", plaintext)
+	if err != nil {
+		t.Fatalf("sealWithSessionKey() error = %v", err)
+	}
+	block, _ := aes.NewCipher(keyBytes[:])
+	gcm, _ := cipher.NewGCM(block)
+	opened, err := gcm.Open(nil, sealed[:sealNonceSize], sealed[sealNonceSize:], []byte(sessionKeyUsage))
+	if err != nil || !bytes.Equal(opened, plaintext) {
+		t.Fatalf("sealed value does not open to the plaintext: %v", err)
+	}
+	if _, err := gcm.Open(nil, sealed[:sealNonceSize], sealed[sealNonceSize:], []byte("other-usage")); err == nil {
+		t.Error("sealed value opens with another key usage")
+	}
+
+	again, _ := sealWithSessionKey(key, sessionKeyUsage, "tx1|iotservice1", plaintext)
+	if !bytes.Equal(sealed, again) {
+		t.Error("sealing is not deterministic for the same nonce seed")
+	}
+	other, _ := sealWithSessionKey(key, sessionKeyUsage, "tx1|iotservice2", plaintext)
+	if bytes.Equal(sealed[:sealNonceSize], other[:sealNonceSize]) {
+		t.Error("different nonce seeds give the same nonce")
+	}
+
+	if _, err := sealWithSessionKey("not a key", sessionKeyUsage, "tx1", plaintext); err == nil {
+		t.Error("sealWithSessionKey() accepted a malformed key")
+	}
+}
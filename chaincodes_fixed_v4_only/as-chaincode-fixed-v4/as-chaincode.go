@@ -5,6 +5,7 @@ import (
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
+	"crypto/subtle"
 	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
@@ -421,7 +422,7 @@ func (s *ASChaincode) InitiateAuthentication(ctx contractapi.TransactionContextI
     nonceHash := sha256.Sum256([]byte(nonceInput))
     nonce := base64.StdEncoding.EncodeToString(nonceHash[:])
     
-    fmt.Printf("Generated nonce for client %s: %s\n", clientID, nonce)
+    fmt.Printf("Generated nonce for client %s\n", clientID)
     
     // Set expiration time for the nonce (e.g., 5 minutes from now)
     expirationTime := timestamp.Unix() + 300 // 5 minutes
@@ -534,11 +535,10 @@ func (s *ASChaincode) VerifyClientIdentity(ctx contractapi.TransactionContextInt
     // Convert decrypted nonce to base64 for comparison
     decryptedNonceB64 := base64.StdEncoding.EncodeToString(decryptedNonce)
     
-    fmt.Printf("Decrypted nonce: %s, Expected: %s\n", 
-        decryptedNonceB64, authChallenge.Nonce)
-    
-    // Compare the decrypted nonce with the expected nonce
-    if decryptedNonceB64 != authChallenge.Nonce {
+    // Compare the decrypted nonce with the expected nonce in constant time
+    // so the comparison doesn't leak how many leading bytes matched
+    if subtle.ConstantTimeCompare([]byte(decryptedNonceB64), []byte(authChallenge.Nonce)) != 1 {
+        fmt.Printf("Nonce mismatch for client %s\n", clientID)
         return false, nil
     }
     
@@ -670,7 +670,7 @@ func (s *ASChaincode) GenerateTGT(ctx contractapi.TransactionContextInterface, c
     sessionKey := base64.StdEncoding.EncodeToString(sessionKeyHash[:])
     
     // Log session key generation (only in development)
-    fmt.Printf("Generated session key for client %s: %s\n", clientID, sessionKey)
+    fmt.Printf("Generated session key for client %s\n", clientID)
     
     // Create the TGT
     tgt := TGT{
@@ -525,8 +525,7 @@ func (s *ISVChaincode) ValidateServiceTicket(ctx contractapi.TransactionContextI
 	}
 	
 	// Debug log
-	fmt.Printf("Parsed service ticket: ClientID=%s, SessionKey=%s\n", 
-		serviceTicket.ClientID, serviceTicket.SessionKey)
+	fmt.Printf("Parsed service ticket for client %s\n", serviceTicket.ClientID)
 	
 	// Validate the service ticket timestamp and lifetime
 	currentTime, err := getDeterministicTimestamp(ctx)
@@ -539,7 +539,7 @@ func (s *TGSChaincode) GenerateServiceTicket(ctx contractapi.TransactionContextI
 	}
 	
 	// Debug log for TGT
-	fmt.Printf("Decrypted TGT: ClientID=%s, SessionKey=%s\n", tgt.ClientID, tgt.SessionKey)
+	fmt.Printf("Decrypted TGT for client %s\n", tgt.ClientID)
 	
 	// Validate the TGT timestamp and lifetime
 	currentTime, err := getDeterministicTimestamp(ctx)
@@ -586,7 +586,7 @@ func (s *TGSChaincode) GenerateServiceTicket(ctx contractapi.TransactionContextI
 	sessionKeyHash := sha256.Sum256([]byte(sessionKeyInput))
 	sessionKey := base64.StdEncoding.EncodeToString(sessionKeyHash[:])
 	
-	fmt.Printf("Generated session key for service ticket: %s\n", sessionKey)
+	fmt.Printf("Generated session key for service ticket\n")
 	
 	// Step 5: Create a service ticket
 	serviceTicketTimestamp, err := getDeterministicTimestamp(ctx)
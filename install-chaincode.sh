@@ -27,6 +27,11 @@ switch_to_org3() {
     export CORE_PEER_ADDRESS=peer0.org3.example.com:11051
 }
 
+# The chaincode builds against ../common through a replace directive; the
+# peer only sees the package, so the dependencies are vendored into it
+echo "Vendoring chaincode dependencies..."
+(cd chaincodes/as-chaincode-fixed-v4 && go mod vendor) || exit 1
+
 echo "Packaging chaincode..."
 docker exec cli peer lifecycle chaincode package as-chaincode.tar.gz --path /opt/gopath/src/github.com/hyperledger/fabric/peer/chaincodes/as-chaincode-fixed-v4 --lang golang --label as-chaincode
 
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/blockchain-auth/common/commontest"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// setPolicies sets each admin-only policy, returning the errors by function
+func setPolicies(s *IOTDataChaincode, ctx contractapi.TransactionContextInterface) map[string]error {
+	return map[string]error{
+		"SetRedactionPolicy": s.SetRedactionPolicy(ctx, `{"default": {}}`),
+		"SetResidencyPolicy": s.SetResidencyPolicy(ctx, `{"default": {}}`),
+		"SetValidationSpec":  s.SetValidationSpec(ctx, `{"deviceType": "default"}`),
+	}
+}
+
+func TestPoliciesNeedAdmin(t *testing.T) {
+	s := &IOTDataChaincode{}
+	stub := commontest.NewStub("iot-data")
+	org1 := commontest.NewContext(stub, &commontest.FakeIdentity{MSPID: "Org1MSP"})
+	org2 := commontest.NewContext(stub, &commontest.FakeIdentity{MSPID: "Org2MSP"})
+
+	for function, err := range setPolicies(s, org1) {
+		if err == nil {
+			t.Errorf("%s was open before the admin MSPs were set", function)
+		}
+	}
+
+	if err := s.InitAdminMSPs(org1, `["Org1MSP"]`); err != nil {
+		t.Fatalf("InitAdminMSPs failed: %v", err)
+	}
+	for function, err := range setPolicies(s, org2) {
+		if err == nil {
+			t.Errorf("%s was open to a non-admin MSP", function)
+		}
+	}
+	for function, err := range setPolicies(s, org1) {
+		if err != nil {
+			t.Errorf("%s failed for an admin MSP: %v", function, err)
+		}
+	}
+	// A policy set by one admin can be replaced by another
+	if err := s.SetAdminMSPs(org1, `["Org1MSP","Org2MSP"]`); err != nil {
+		t.Fatalf("SetAdminMSPs failed: %v", err)
+	}
+	for function, err := range setPolicies(s, org2) {
+		if err != nil {
+			t.Errorf("%s failed for an added admin MSP: %v", function, err)
+		}
+	}
+}
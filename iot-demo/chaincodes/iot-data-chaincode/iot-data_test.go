@@ -0,0 +1,307 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/blockchain-auth/common/commontest"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-chaincode-go/shimtest"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// fakeUserACL answers the GetDevice calls IOT-DATA makes to USER-ACL from a
+// fixed set of registered devices
+type fakeUserACL struct {
+	devices map[string]registeredDevice
+}
+
+func (f *fakeUserACL) Init(stub shim.ChaincodeStubInterface) pb.Response {
+	return shim.Success(nil)
+}
+
+func (f *fakeUserACL) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
+	function, args := stub.GetFunctionAndParameters()
+	if function != "GetDevice" || len(args) != 1 {
+		return shim.Error(fmt.Sprintf("unexpected call %s%q", function, args))
+	}
+	device, ok := f.devices[args[0]]
+	if !ok {
+		return shim.Error(fmt.Sprintf("device %s does not exist", args[0]))
+	}
+	deviceJSON, _ := json.Marshal(device)
+	return shim.Success(deviceJSON)
+}
+
+// newTestStub returns an IOT-DATA stub whose USER-ACL knows the sensor
+// devices dev-a and dev-b and the freezer device dev-f
+func newTestStub() *shimtest.MockStub {
+	stub := commontest.NewStub("iot-data")
+	userACL := &fakeUserACL{devices: map[string]registeredDevice{
+		"dev-a": {DeviceType: "sensor", ResidencyZone: "eu"},
+		"dev-b": {DeviceType: "sensor", ResidencyZone: "eu"},
+		"dev-f": {DeviceType: "freezer", ResidencyZone: "eu"},
+	}}
+	stub.MockPeerChaincode(userACLChaincode, shimtest.NewMockStub(userACLChaincode, userACL), "")
+	return stub
+}
+
+func org1Context(stub shim.ChaincodeStubInterface) contractapi.TransactionContextInterface {
+	return commontest.NewContext(stub, &commontest.FakeIdentity{MSPID: "Org1MSP"})
+}
+
+// batchJSON encodes readings as StoreReadingsBatch takes them
+func batchJSON(t *testing.T, readings ...ReadingInput) string {
+	t.Helper()
+	readingsJSON, err := json.Marshal(readings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(readingsJSON)
+}
+
+func TestStoreReadingsBatch(t *testing.T) {
+	s := &IOTDataChaincode{}
+	stub := newTestStub()
+	ctx := org1Context(stub)
+	now := getCurrentTimestamp()
+
+	resultJSON, err := s.StoreReadingsBatch(ctx, batchJSON(t,
+		ReadingInput{DeviceID: "dev-a", Temperature: 21, Timestamp: now - 20, SessionID: "session-a"},
+		ReadingInput{DeviceID: "dev-b", Temperature: 30, Timestamp: now - 20, SessionID: "session-b", GatewayID: "bridge-1"},
+		ReadingInput{DeviceID: "dev-a", Temperature: 23, Timestamp: now - 10, SessionID: "session-a",
+			Location: &Location{Latitude: 52.5, Longitude: 13.4}},
+	))
+	if err != nil {
+		t.Fatalf("StoreReadingsBatch failed: %v", err)
+	}
+
+	var result BatchResult
+	if err := json.Unmarshal([]byte(resultJSON), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Stored != 3 || result.Anomalies != 1 || result.Devices["dev-a"] != 2 || result.Devices["dev-b"] != 1 {
+		t.Fatalf("batch result %s, want 3 stored, 1 anomaly, 2 of dev-a and 1 of dev-b", resultJSON)
+	}
+	event := <-stub.ChaincodeEventsChannel
+	if event.EventName != "ReadingsBatchStored" || string(event.Payload) != resultJSON {
+		t.Errorf("event %s %s, want ReadingsBatchStored %s", event.EventName, event.Payload, resultJSON)
+	}
+
+	readingJSON, err := s.GetLatestReading(ctx, "dev-a")
+	if err != nil {
+		t.Fatalf("GetLatestReading failed: %v", err)
+	}
+	var reading TemperatureReading
+	if err := json.Unmarshal([]byte(readingJSON), &reading); err != nil {
+		t.Fatal(err)
+	}
+	if reading.Timestamp != now-10 || reading.Location == nil || reading.ResidencyZone != "eu" || reading.Status != "normal" {
+		t.Errorf("latest reading of dev-a %s", readingJSON)
+	}
+
+	provenanceJSON, err := s.GetReadingProvenance(ctx, fmt.Sprintf("READING_dev-b_%d", now-20))
+	if err != nil {
+		t.Fatalf("GetReadingProvenance failed: %v", err)
+	}
+	var provenance ReadingProvenance
+	if err := json.Unmarshal([]byte(provenanceJSON), &provenance); err != nil {
+		t.Fatal(err)
+	}
+	if provenance.GatewayID != "bridge-1" || provenance.IngestionPath != ingestionBridge || provenance.SubmitterMSP != "Org1MSP" {
+		t.Errorf("provenance of the relayed reading %s", provenanceJSON)
+	}
+
+	statsJSON, err := s.GetDeviceStatistics(ctx, "dev-a")
+	if err != nil {
+		t.Fatalf("GetDeviceStatistics failed: %v", err)
+	}
+	var stats DeviceStatistics
+	if err := json.Unmarshal([]byte(statsJSON), &stats); err != nil {
+		t.Fatal(err)
+	}
+	if stats.ReadingCount != 2 || stats.MinTemperature != 21 || stats.MaxTemperature != 23 || stats.LastReading != now-10 {
+		t.Errorf("statistics of dev-a %s", statsJSON)
+	}
+
+	metricsJSON, err := s.GetMetrics(ctx)
+	if err != nil {
+		t.Fatalf("GetMetrics failed: %v", err)
+	}
+	var metrics map[string]int64
+	if err := json.Unmarshal([]byte(metricsJSON), &metrics); err != nil {
+		t.Fatal(err)
+	}
+	if metrics[metricReadingsStored] != 3 || metrics[metricAnomalies] != 1 {
+		t.Errorf("metrics %s, want 3 readings and 1 anomaly", metricsJSON)
+	}
+}
+
+func TestStoreReadingsBatchRejects(t *testing.T) {
+	now := getCurrentTimestamp()
+	reading := func(deviceID string, timestamp int64) ReadingInput {
+		return ReadingInput{DeviceID: deviceID, Temperature: 21, Timestamp: timestamp, SessionID: "session-" + deviceID}
+	}
+	tooMany := make([]ReadingInput, maxBatchReadings+1)
+	for i := range tooMany {
+		tooMany[i] = reading("dev-a", now-int64(len(tooMany)-i))
+	}
+	withTemperature := reading("dev-a", now)
+	withTemperature.Temperature = 150
+	withLocation := reading("dev-a", now)
+	withLocation.Location = &Location{Latitude: 91}
+	withSession := reading("dev-a", now)
+	withSession.SessionID = "s1"
+	withGateway := reading("dev-a", now)
+	withGateway.GatewayID = strings.Repeat("g", 65)
+
+	tests := []struct {
+		name     string
+		readings string
+		want     string
+	}{
+		{"not json", `{"deviceID":"dev-a"}`, "invalid readings format"},
+		{"empty", `[]`, "no readings given"},
+		{"too many", batchJSON(t, tooMany...), "501 readings given, the limit is 500"},
+		{"out of order", batchJSON(t, reading("dev-a", now), reading("dev-b", now-5), reading("dev-a", now-5)),
+			"reading 2: device dev-a timestamp"},
+		{"repeated", batchJSON(t, reading("dev-a", now), reading("dev-a", now)), "reading 1: device dev-a timestamp"},
+		{"short device ID", batchJSON(t, reading("dev-a", now), reading("da", now)), "reading 1: invalid deviceID length"},
+		{"stale", batchJSON(t, reading("dev-a", now-600)), "reading 0: timestamp is invalid"},
+		{"future", batchJSON(t, reading("dev-a", now+600)), "reading 0: timestamp is invalid"},
+		{"short session", batchJSON(t, withSession), "reading 0: invalid session ID"},
+		{"unregistered", batchJSON(t, reading("dev-x", now)), "reading 0: device dev-x not registered in USER-ACL"},
+		{"out of range", batchJSON(t, withTemperature), "reading 0: reading rejected by default validation: temperature 150 is out of range -50 to 100"},
+		{"off the globe", batchJSON(t, withLocation), "reading 0: location 91.000000,0.000000 is out of range"},
+		{"long gateway ID", batchJSON(t, withGateway), "reading 0: invalid gatewayID length"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := &IOTDataChaincode{}
+			_, err := s.StoreReadingsBatch(org1Context(newTestStub()), test.readings)
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Fatalf("StoreReadingsBatch() error = %v, want %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestStoreReadingsBatchDuplicate(t *testing.T) {
+	s := &IOTDataChaincode{}
+	stub := newTestStub()
+	now := getCurrentTimestamp()
+	batch := batchJSON(t, ReadingInput{DeviceID: "dev-a", Temperature: 21, Timestamp: now, SessionID: "session-a"})
+
+	if _, err := s.StoreReadingsBatch(org1Context(stub), batch); err != nil {
+		t.Fatalf("StoreReadingsBatch failed: %v", err)
+	}
+	stub.MockTransactionStart("tx2")
+	_, err := s.StoreReadingsBatch(org1Context(stub), batch)
+	if err == nil || !strings.Contains(err.Error(), fmt.Sprintf("reading 0: device dev-a already has a reading at %d", now)) {
+		t.Fatalf("resubmitted batch error = %v, want the reading reported as stored", err)
+	}
+}
+
+func TestStoreReadingsBatchFlowID(t *testing.T) {
+	s := &IOTDataChaincode{}
+	now := getCurrentTimestamp()
+	batch := batchJSON(t, ReadingInput{DeviceID: "dev-a", Temperature: 21, Timestamp: now, SessionID: "session-a"})
+
+	stub := newTestStub()
+	if err := stub.SetTransient(map[string][]byte{flowIDTransient: []byte("flow-1")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.StoreReadingsBatch(org1Context(stub), batch); err != nil {
+		t.Fatalf("StoreReadingsBatch failed: %v", err)
+	}
+	event := <-stub.ChaincodeEventsChannel
+	var fields map[string]interface{}
+	if err := json.Unmarshal(event.Payload, &fields); err != nil {
+		t.Fatal(err)
+	}
+	if fields[flowIDTransient] != "flow-1" {
+		t.Errorf("event payload %s, want the flow ID", event.Payload)
+	}
+
+	stub = newTestStub()
+	if err := stub.SetTransient(map[string][]byte{flowIDTransient: []byte("flow 1")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.StoreReadingsBatch(org1Context(stub), batch); err == nil || !strings.Contains(err.Error(), "invalid flowID transient field") {
+		t.Fatalf("StoreReadingsBatch() error = %v, want the flow ID refused", err)
+	}
+}
+
+func TestValidationSpecs(t *testing.T) {
+	s := &IOTDataChaincode{}
+	stub := newTestStub()
+	ctx := org1Context(stub)
+	if err := s.InitAdminMSPs(ctx, `["Org1MSP"]`); err != nil {
+		t.Fatalf("InitAdminMSPs failed: %v", err)
+	}
+	now := getCurrentTimestamp()
+
+	for _, spec := range []string{
+		`{"ranges": [{"field": "temperature", "min": 0}]}`,
+		`{"deviceType": "freezer", "ranges": [{"field": "temperature"}]}`,
+		`{"deviceType": "freezer", "ranges": [{"field": "temperature", "min": 5, "max": -5}]}`,
+		`{"deviceType": "freezer", "schema": {"type": "array"}}`,
+		`{"deviceType": "freezer", "schema": {"properties": {"unit": {"minimum": 2, "maximum": 1}}}}`,
+		`{"deviceType": "freezer", "limits": {}}`,
+	} {
+		if err := s.SetValidationSpec(ctx, spec); err == nil || !strings.Contains(err.Error(), "invalid validation spec") {
+			t.Errorf("SetValidationSpec(%s) error = %v, want the spec refused", spec, err)
+		}
+	}
+
+	freezerSpec := `{
+		"deviceType": "freezer",
+		"schema": {"type": "object", "required": ["location"], "properties": {"status": {"enum": ["anomaly"]}}},
+		"ranges": [{"field": "temperature", "min": -30, "max": -10}, {"field": "location.latitude", "max": 70}]
+	}`
+	if err := s.SetValidationSpec(ctx, freezerSpec); err != nil {
+		t.Fatalf("SetValidationSpec failed: %v", err)
+	}
+	specJSON, err := s.GetValidationSpec(ctx, "freezer")
+	if err != nil || !strings.Contains(specJSON, `"deviceType":"freezer"`) {
+		t.Fatalf("GetValidationSpec(freezer) = %s, %v", specJSON, err)
+	}
+	if specJSON, err := s.GetValidationSpec(ctx, "oven"); err != nil || !strings.Contains(specJSON, `"deviceType":"default"`) {
+		t.Fatalf("GetValidationSpec(oven) = %s, %v, want the default spec", specJSON, err)
+	}
+
+	freezer := func(temperature float64, location *Location) string {
+		return batchJSON(t, ReadingInput{DeviceID: "dev-f", Temperature: temperature, Timestamp: now, SessionID: "session-f", Location: location})
+	}
+	inside := &Location{Latitude: 60, Longitude: 10}
+	tests := []struct {
+		name     string
+		readings string
+		want     string
+	}{
+		{"too warm", freezer(5, inside), "reading rejected by freezer validation: temperature 5 is out of range -30 to -10"},
+		{"no location", freezer(-20, nil), "reading rejected by freezer validation: reading.location is required"},
+		{"too far north", freezer(-20, &Location{Latitude: 80}), "location.latitude 80 is out of range up to 70"},
+	}
+	for _, test := range tests {
+		if _, err := s.StoreReadingsBatch(ctx, test.readings); err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: StoreReadingsBatch() error = %v, want %q", test.name, err, test.want)
+		}
+	}
+	if _, err := s.StoreReadingsBatch(ctx, freezer(-20, inside)); err != nil {
+		t.Errorf("reading within the freezer spec refused: %v", err)
+	}
+
+	// A stored default spec replaces the built-in one for sensors
+	if err := s.SetValidationSpec(ctx, `{"deviceType": "default", "ranges": [{"field": "temperature", "max": 25}]}`); err != nil {
+		t.Fatalf("SetValidationSpec(default) failed: %v", err)
+	}
+	stub.MockTransactionStart("tx2")
+	sensor := batchJSON(t, ReadingInput{DeviceID: "dev-a", Temperature: 26, Timestamp: now, SessionID: "session-a"})
+	if _, err := s.StoreReadingsBatch(ctx, sensor); err == nil || !strings.Contains(err.Error(), "temperature 26 is out of range up to 25") {
+		t.Errorf("StoreReadingsBatch() error = %v, want the stored default spec applied", err)
+	}
+}
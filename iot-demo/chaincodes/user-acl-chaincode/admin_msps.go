@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/blockchain-auth/common"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// The user IDs passed to the chaincode are not authenticated by Fabric: any
+// channel member could name another user's account. Sensitive entry points
+// are therefore also checked against the caller's Fabric identity. They are
+// open only to the admin MSPs, kept and checked as in the other chaincodes
+// (see chaincodes/common/admin.go). Every caller is refused until
+// InitAdminMSPs names them. The chaincode is deployed with --init-required
+// and the deploy script sends it as the Init transaction right after the
+// commit, so nothing else runs before it:
+//
+//	peer chaincode invoke ... --isInit -c '{"Args":["InitAdminMSPs","[\"Org1MSP\"]"]}'
+
+// checkAdminCaller fails unless the caller belongs to an admin MSP
+func checkAdminCaller(ctx contractapi.TransactionContextInterface, function string) error {
+	return common.CheckAdminCaller(ctx, function, nil)
+}
+
+// InitAdminMSPs names the admin MSPs, given as a JSON list of MSP IDs that
+// includes the caller's. It runs once, before InitLedger.
+func (s *UserACLChaincode) InitAdminMSPs(ctx contractapi.TransactionContextInterface, mspsJSON string) error {
+	msps, err := common.InitAdminMSPs(ctx, mspsJSON)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Admin MSPs initialized to %s", strings.Join(msps, ", "))
+	return nil
+}
+
+// SetAdminMSPs replaces the admin MSPs, given as a JSON list of MSP IDs
+func (s *UserACLChaincode) SetAdminMSPs(ctx contractapi.TransactionContextInterface, mspsJSON string) error {
+	if err := checkAdminCaller(ctx, "SetAdminMSPs"); err != nil {
+		return err
+	}
+
+	msps, err := common.SetAdminMSPs(ctx, mspsJSON)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Admin MSPs set to %s", strings.Join(msps, ", "))
+	return nil
+}
+
+// GetAdminMSPs returns the admin MSPs as a JSON list
+func (s *UserACLChaincode) GetAdminMSPs(ctx contractapi.TransactionContextInterface) (string, error) {
+	msps, err := common.GetAdminMSPs(ctx)
+	if err != nil {
+		return "", err
+	}
+	if msps == nil {
+		msps = []string{}
+	}
+	mspsJSON, err := json.Marshal(msps)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal admin MSPs: %v", err)
+	}
+	return string(mspsJSON), nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/blockchain-auth/common"
+	"github.com/blockchain-auth/common/commontest"
+)
+
+func TestUninitializedChaincodeDeniesCallers(t *testing.T) {
+	s := &UserACLChaincode{}
+	stub := commontest.NewStub("user-acl")
+	org1 := commontest.NewContext(stub, &commontest.FakeIdentity{MSPID: "Org1MSP"})
+
+	if err := s.InitLedger(org1); err == nil {
+		t.Error("InitLedger was open before the admin MSPs were set")
+	}
+	if err := s.SetAdminMSPs(org1, `["Org1MSP"]`); err == nil {
+		t.Error("SetAdminMSPs was open before the admin MSPs were set")
+	}
+	if err := s.RevokeAccess(org1, "user_a", "user_b", "device1"); err == nil {
+		t.Error("RevokeAccess was open before the admin MSPs were set")
+	}
+}
+
+func TestAdminMSPs(t *testing.T) {
+	s := &UserACLChaincode{}
+	stub := commontest.NewStub("user-acl")
+	org1 := commontest.NewContext(stub, &commontest.FakeIdentity{MSPID: "Org1MSP"})
+	org2Admin := commontest.NewContext(stub, &commontest.FakeIdentity{
+		Attrs: map[string]string{common.RoleAttribute: common.RoleAdmin},
+		MSPID: "Org2MSP",
+	})
+
+	if err := s.InitAdminMSPs(org1, `["Org1MSP"]`); err != nil {
+		t.Fatalf("InitAdminMSPs failed: %v", err)
+	}
+	if err := s.InitAdminMSPs(org2Admin, `["Org2MSP"]`); err == nil {
+		t.Error("InitAdminMSPs ran twice")
+	}
+
+	if err := checkAdminCaller(org1, "RevokeAccess"); err != nil {
+		t.Errorf("admin MSP was refused: %v", err)
+	}
+	if err := checkAdminCaller(org2Admin, "RevokeAccess"); err == nil {
+		t.Error("role=admin from a non-admin MSP was accepted")
+	}
+	if err := s.SetAdminMSPs(org2Admin, `["Org2MSP"]`); err == nil {
+		t.Error("SetAdminMSPs was open to a non-admin MSP")
+	}
+
+	if err := s.SetAdminMSPs(org1, `["Org1MSP","Org2MSP"]`); err != nil {
+		t.Fatalf("SetAdminMSPs failed: %v", err)
+	}
+	msps, err := s.GetAdminMSPs(org2Admin)
+	if err != nil || msps != `["Org1MSP","Org2MSP"]` {
+		t.Errorf("GetAdminMSPs = %s, %v", msps, err)
+	}
+	if err := checkAdminCaller(org2Admin, "RevokeAccess"); err != nil {
+		t.Errorf("added admin MSP was refused: %v", err)
+	}
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Usernames and emails are personal data, and the world state is readable
+// by every channel member. They are kept in the userPII private data
+// collection instead, under USER_PII_<userID>, and the user records in the
+// world state leave them empty. Lookups go through an index of HMAC-SHA256
+// digests in the world state:
+//
+//	USERNAME_HMAC~<digest>~<userID>
+//	EMAIL_HMAC~<digest>~<userID>
+//
+// The HMAC key is kept in the collection too, so members outside it cannot
+// test guessed usernames or emails against the index. It is set once, from
+// the indexKey transient field of InitLedger or MigrateUserIndex. Function
+// arguments are recorded in the block, so usernames, emails and passwords
+// may also be passed in transient fields of the same name with the
+// argument left empty (see transientArg), and responses do not echo them.
+//
+// Users registered before the index are found through the plaintext
+// USERNAME_INDEX until MigrateUserIndex moves them.
+
+const (
+	// piiCollection is the private data collection holding usernames,
+	// emails and the index key
+	piiCollection = "userPII"
+
+	// userPIIPrefix prefixes the UserPII records in the collection
+	userPIIPrefix = "USER_PII_"
+
+	// indexKeyKey is the collection key of the index HMAC key
+	indexKeyKey = "INDEX_HMAC_KEY"
+
+	// indexKeyTransient is the transient field carrying a new index key
+	indexKeyTransient = "indexKey"
+
+	// minIndexKeyLength is the shortest index key accepted, in bytes
+	minIndexKeyLength = 32
+
+	usernameHMACIndex   = "USERNAME_HMAC"
+	emailHMACIndex      = "EMAIL_HMAC"
+	legacyUsernameIndex = "USERNAME_INDEX"
+)
+
+// UserPII is the personal data of a user, kept in the userPII collection
+type UserPII struct {
+	Username string `json:"username"`
+	Email    string `json:"email"`
+}
+
+// transientArg returns a function argument, or the transient field called
+// name if the argument is empty
+func transientArg(ctx contractapi.TransactionContextInterface, name, arg string) (string, error) {
+	if arg != "" {
+		return arg, nil
+	}
+	transient, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return "", fmt.Errorf("failed to read transient data: %v", err)
+	}
+	return string(transient[name]), nil
+}
+
+// normalizeEmail is the form of an email that is indexed, so that the
+// case of the address does not matter
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// lookupDigest is the index digest of a username or email. field keeps the
+// digests of a string as a username and as an email apart.
+func lookupDigest(key []byte, field, value string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(field + "\x00" + value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func usernameDigest(key []byte, username string) string {
+	return lookupDigest(key, "username", username)
+}
+
+func emailDigest(key []byte, email string) string {
+	if email == "" {
+		return ""
+	}
+	return lookupDigest(key, "email", normalizeEmail(email))
+}
+
+// getIndexKey returns the index HMAC key
+func getIndexKey(ctx contractapi.TransactionContextInterface) ([]byte, error) {
+	key, err := ctx.GetStub().GetPrivateData(piiCollection, indexKeyKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read user index key: %v", err)
+	}
+	if key == nil {
+		return nil, fmt.Errorf("the user index key is not set; run MigrateUserIndex with the %s transient field", indexKeyTransient)
+	}
+	return key, nil
+}
+
+// setupIndexKey returns the index HMAC key, storing the one in the
+// indexKey transient field if none is set yet. A key once set is kept.
+func setupIndexKey(ctx contractapi.TransactionContextInterface) ([]byte, error) {
+	key, err := ctx.GetStub().GetPrivateData(piiCollection, indexKeyKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read user index key: %v", err)
+	}
+	if key != nil {
+		return key, nil
+	}
+
+	transient, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read transient data: %v", err)
+	}
+	key = transient[indexKeyTransient]
+	if len(key) < minIndexKeyLength {
+		return nil, fmt.Errorf("the %s transient field must hold at least %d random bytes", indexKeyTransient, minIndexKeyLength)
+	}
+	if err := ctx.GetStub().PutPrivateData(piiCollection, indexKeyKey, key); err != nil {
+		return nil, fmt.Errorf("failed to store user index key: %v", err)
+	}
+	log.Println("User index key set")
+	return key, nil
+}
+
+// indexUser stores the user's username and email in the collection and
+// points the index at the user, replacing the entries of earlier values.
+// It clears the plaintext from the user record and sets its digests; the
+// caller stores the record.
+func indexUser(ctx contractapi.TransactionContextInterface, key []byte, user *User, username, email string) error {
+	piiJSON, err := json.Marshal(UserPII{Username: username, Email: email})
+	if err != nil {
+		return fmt.Errorf("failed to marshal user data: %v", err)
+	}
+	if err := ctx.GetStub().PutPrivateData(piiCollection, userPIIPrefix+user.UserID, piiJSON); err != nil {
+		return fmt.Errorf("failed to store user data: %v", err)
+	}
+
+	newUsernameDigest := usernameDigest(key, username)
+	if err := replaceIndexEntry(ctx, usernameHMACIndex, user.UsernameHMAC, newUsernameDigest, user.UserID); err != nil {
+		return err
+	}
+	newEmailDigest := emailDigest(key, email)
+	if err := replaceIndexEntry(ctx, emailHMACIndex, user.EmailHMAC, newEmailDigest, user.UserID); err != nil {
+		return err
+	}
+
+	user.UsernameHMAC = newUsernameDigest
+	user.EmailHMAC = newEmailDigest
+	user.Username = ""
+	user.Email = ""
+	return nil
+}
+
+// replaceIndexEntry moves the user's entry in an index from oldDigest to
+// newDigest. An empty digest has no entry.
+func replaceIndexEntry(ctx contractapi.TransactionContextInterface, index, oldDigest, newDigest, userID string) error {
+	if oldDigest == newDigest {
+		return nil
+	}
+	if oldDigest != "" {
+		oldKey, err := ctx.GetStub().CreateCompositeKey(index, []string{oldDigest, userID})
+		if err != nil {
+			return fmt.Errorf("failed to create %s key: %v", index, err)
+		}
+		if err := ctx.GetStub().DelState(oldKey); err != nil {
+			return fmt.Errorf("failed to delete %s entry: %v", index, err)
+		}
+	}
+	if newDigest != "" {
+		newKey, err := ctx.GetStub().CreateCompositeKey(index, []string{newDigest, userID})
+		if err != nil {
+			return fmt.Errorf("failed to create %s key: %v", index, err)
+		}
+		if err := ctx.GetStub().PutState(newKey, []byte{0x00}); err != nil {
+			return fmt.Errorf("failed to store %s entry: %v", index, err)
+		}
+	}
+	return nil
+}
+
+// findIndexed returns the IDs of the users an index lists under value
+func findIndexed(ctx contractapi.TransactionContextInterface, index, value string) ([]string, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(index, []string{value})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var userIDs []string
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		_, compositeKeyParts, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return nil, err
+		}
+		if len(compositeKeyParts) > 1 {
+			userIDs = append(userIDs, compositeKeyParts[1])
+		}
+	}
+	return userIDs, nil
+}
+
+// getUserIDByEmail finds a user by email. Emails of federated users come
+// from their provider and are not unique, so an email that several
+// accounts share resolves to none of them.
+func (s *UserACLChaincode) getUserIDByEmail(ctx contractapi.TransactionContextInterface, key []byte, email string) (string, error) {
+	userIDs, err := findIndexed(ctx, emailHMACIndex, emailDigest(key, email))
+	if err != nil {
+		return "", err
+	}
+	switch len(userIDs) {
+	case 0:
+		return "", fmt.Errorf("email not found")
+	case 1:
+		return userIDs[0], nil
+	default:
+		return "", fmt.Errorf("email belongs to several accounts; sign in with the username")
+	}
+}
+
+// resolveUserAlias finds a user by username or, failing that, by email
+func (s *UserACLChaincode) resolveUserAlias(ctx contractapi.TransactionContextInterface, alias string) (string, error) {
+	userID, err := s.getUserIDByUsername(ctx, alias)
+	if err == nil || !strings.Contains(alias, "@") {
+		return userID, err
+	}
+	key, err := getIndexKey(ctx)
+	if err != nil {
+		return "", err
+	}
+	return s.getUserIDByEmail(ctx, key, alias)
+}
+
+// getUserPII returns a user's username and email from the collection, or
+// nil if the user has none there
+func getUserPII(ctx contractapi.TransactionContextInterface, userID string) (*UserPII, error) {
+	piiJSON, err := ctx.GetStub().GetPrivateData(piiCollection, userPIIPrefix+userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read user data: %v", err)
+	}
+	if piiJSON == nil {
+		return nil, nil
+	}
+	var pii UserPII
+	if err := json.Unmarshal(piiJSON, &pii); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal user data: %v", err)
+	}
+	return &pii, nil
+}
+
+// MigrateUserIndex moves the usernames and emails of users registered
+// before the HMAC index into the userPII collection and the index, and
+// deletes their plaintext USERNAME_INDEX entries. The caller must hold the
+// user-admin role. If the index key is not set yet, the indexKey transient
+// field sets it. It may be run again; it returns the number of users
+// migrated.
+func (s *UserACLChaincode) MigrateUserIndex(ctx contractapi.TransactionContextInterface, callerID string) (int, error) {
+	if err := s.requireAdminRole(ctx, callerID, adminRoleUser); err != nil {
+		return 0, err
+	}
+	key, err := setupIndexKey(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByRange("USER_", "USER_~")
+	if err != nil {
+		return 0, fmt.Errorf("failed to read users: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	migrated := 0
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return 0, fmt.Errorf("failed to iterate users: %v", err)
+		}
+
+		var user User
+		if err := json.Unmarshal(queryResponse.Value, &user); err != nil {
+			log.Printf("Skipping unreadable user %s: %v", queryResponse.Key, err)
+			continue
+		}
+		if user.Username == "" && user.Email == "" {
+			continue
+		}
+
+		legacyKey, err := ctx.GetStub().CreateCompositeKey(legacyUsernameIndex, []string{user.Username, user.UserID})
+		if err != nil {
+			return 0, fmt.Errorf("failed to create username index key: %v", err)
+		}
+		if err := ctx.GetStub().DelState(legacyKey); err != nil {
+			return 0, fmt.Errorf("failed to delete username index entry: %v", err)
+		}
+		if err := indexUser(ctx, key, &user, user.Username, user.Email); err != nil {
+			return 0, err
+		}
+		userJSON, err := json.Marshal(user)
+		if err != nil {
+			return 0, fmt.Errorf("failed to marshal user: %v", err)
+		}
+		if err := ctx.GetStub().PutState(queryResponse.Key, userJSON); err != nil {
+			return 0, fmt.Errorf("failed to store user: %v", err)
+		}
+		migrated++
+	}
+
+	log.Printf("Moved %d users to the HMAC user index", migrated)
+	return migrated, nil
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/blockchain-auth/common/commontest"
+	"github.com/hyperledger/fabric-chaincode-go/shimtest"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// testIndexKey is the user index key of the test ledgers
+var testIndexKey = bytes.Repeat([]byte{0x42}, minIndexKeyLength)
+
+// newLedger returns a USER-ACL ledger initialized by Org1MSP with
+// testIndexKey, and a context of Org1MSP on it. The default admin's
+// record is USER_admin, so it calls admin functions as "admin".
+func newLedger(t *testing.T) (*UserACLChaincode, *shimtest.MockStub, contractapi.TransactionContextInterface) {
+	t.Helper()
+	s := &UserACLChaincode{}
+	stub := commontest.NewStub("user-acl")
+	ctx := commontest.NewContext(stub, &commontest.FakeIdentity{MSPID: "Org1MSP"})
+	if err := s.InitAdminMSPs(ctx, `["Org1MSP"]`); err != nil {
+		t.Fatalf("InitAdminMSPs failed: %v", err)
+	}
+	if err := stub.SetTransient(map[string][]byte{indexKeyTransient: testIndexKey}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.InitLedger(ctx); err != nil {
+		t.Fatalf("InitLedger failed: %v", err)
+	}
+	return s, stub, ctx
+}
+
+// register registers a user and returns its ID
+func register(t *testing.T, s *UserACLChaincode, ctx contractapi.TransactionContextInterface, username, email, role string) string {
+	t.Helper()
+	responseJSON, err := s.RegisterUser(ctx, username, "secret1", email, role)
+	if err != nil {
+		t.Fatalf("RegisterUser(%s) failed: %v", username, err)
+	}
+	var response AuthResponse
+	if err := json.Unmarshal([]byte(responseJSON), &response); err != nil {
+		t.Fatal(err)
+	}
+	return response.UserID
+}
+
+// worldStateContains reports whether any world state key or value
+// contains text
+func worldStateContains(stub *shimtest.MockStub, text string) bool {
+	for key, value := range stub.State {
+		if strings.Contains(key, text) || strings.Contains(string(value), text) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestRegisterUserKeepsPIIPrivate(t *testing.T) {
+	s, stub, ctx := newLedger(t)
+	userID := register(t, s, ctx, "alice", "Alice@Example.com", "user")
+
+	for _, text := range []string{"alice", "Alice@Example.com", "example.com"} {
+		if worldStateContains(stub, text) {
+			t.Errorf("%q is in the world state", text)
+		}
+	}
+	user, err := s.getUser(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Username != "" || user.Email != "" ||
+		user.UsernameHMAC != usernameDigest(testIndexKey, "alice") || user.EmailHMAC != emailDigest(testIndexKey, "alice@example.com") {
+		t.Errorf("user record %+v, want digests and no plaintext", user)
+	}
+
+	pii, err := getUserPII(ctx, userID)
+	if err != nil || pii == nil || pii.Username != "alice" || pii.Email != "Alice@Example.com" {
+		t.Fatalf("private user data = %+v, %v", pii, err)
+	}
+	userJSON, err := s.GetUser(ctx, userID)
+	if err != nil {
+		t.Fatalf("GetUser failed: %v", err)
+	}
+	if !strings.Contains(userJSON, `"username":"alice"`) || !strings.Contains(userJSON, `"email":"Alice@Example.com"`) {
+		t.Errorf("GetUser = %s, want the username and email from the collection", userJSON)
+	}
+}
+
+func TestUserLookup(t *testing.T) {
+	s, _, ctx := newLedger(t)
+	userID := register(t, s, ctx, "alice", "alice@example.com", "user")
+
+	for _, alias := range []string{"alice", "alice@example.com", " ALICE@example.com"} {
+		responseJSON, err := s.AuthenticateUser(ctx, alias, "secret1")
+		if err != nil {
+			t.Errorf("AuthenticateUser(%q) failed: %v", alias, err)
+			continue
+		}
+		if !strings.Contains(responseJSON, userID) || strings.Contains(responseJSON, "alice") {
+			t.Errorf("AuthenticateUser(%q) = %s, want the user ID and no username or email", alias, responseJSON)
+		}
+	}
+	for _, login := range [][2]string{{"alice", "wrong1"}, {"bob", "secret1"}, {"bob@example.com", "secret1"}} {
+		if _, err := s.AuthenticateUser(ctx, login[0], login[1]); err == nil || err.Error() != "invalid username or password" {
+			t.Errorf("AuthenticateUser(%q, %q) error = %v, want the login refused", login[0], login[1], err)
+		}
+	}
+
+	if _, err := s.RegisterUser(ctx, "alice", "secret1", "", "user"); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("second alice error = %v, want the username taken", err)
+	}
+	if _, err := s.RegisterUser(ctx, "alice2", "secret1", "Alice@Example.COM", "user"); err == nil || !strings.Contains(err.Error(), "email is already registered") {
+		t.Errorf("second alice@example.com error = %v, want the email taken", err)
+	}
+	// A username and an email are digested apart, so a username that looks
+	// like a registered email is free
+	if _, err := s.RegisterUser(ctx, "alice@example.com", "secret1", "", "user"); err != nil {
+		t.Errorf("username alice@example.com refused: %v", err)
+	}
+}
+
+func TestRegisterUserFromTransientFields(t *testing.T) {
+	s, stub, ctx := newLedger(t)
+	stub.MockTransactionStart("tx2")
+	if err := stub.SetTransient(map[string][]byte{
+		"username": []byte("carol"),
+		"password": []byte("secret1"),
+		"email":    []byte("carol@example.com"),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	responseJSON, err := s.RegisterUser(ctx, "", "", "", "user")
+	if err != nil {
+		t.Fatalf("RegisterUser failed: %v", err)
+	}
+	if strings.Contains(responseJSON, "carol") {
+		t.Errorf("RegisterUser = %s, want no username or email", responseJSON)
+	}
+	if _, err := s.AuthenticateUser(ctx, "", ""); err != nil {
+		t.Errorf("AuthenticateUser from transient fields failed: %v", err)
+	}
+}
+
+func TestIndexKeySetup(t *testing.T) {
+	s := &UserACLChaincode{}
+	stub := commontest.NewStub("user-acl")
+	ctx := commontest.NewContext(stub, &commontest.FakeIdentity{MSPID: "Org1MSP"})
+	if err := s.InitAdminMSPs(ctx, `["Org1MSP"]`); err != nil {
+		t.Fatalf("InitAdminMSPs failed: %v", err)
+	}
+
+	if err := s.InitLedger(ctx); err == nil || !strings.Contains(err.Error(), "transient field must hold at least 32 random bytes") {
+		t.Errorf("InitLedger without an index key error = %v", err)
+	}
+	if err := stub.SetTransient(map[string][]byte{indexKeyTransient: testIndexKey[:minIndexKeyLength-1]}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.InitLedger(ctx); err == nil {
+		t.Error("InitLedger took a short index key")
+	}
+	if _, err := s.RegisterUser(ctx, "alice", "secret1", "", "user"); err == nil || !strings.Contains(err.Error(), "the user index key is not set") {
+		t.Errorf("RegisterUser without an index key error = %v", err)
+	}
+
+	if err := stub.SetTransient(map[string][]byte{indexKeyTransient: testIndexKey}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.InitLedger(ctx); err != nil {
+		t.Fatalf("InitLedger failed: %v", err)
+	}
+
+	// A key once set is kept
+	stub.MockTransactionStart("tx2")
+	if err := stub.SetTransient(map[string][]byte{indexKeyTransient: bytes.Repeat([]byte{0x17}, minIndexKeyLength)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.MigrateUserIndex(ctx, "admin"); err != nil {
+		t.Fatalf("MigrateUserIndex failed: %v", err)
+	}
+	key, err := getIndexKey(ctx)
+	if err != nil || !bytes.Equal(key, testIndexKey) {
+		t.Errorf("index key after a second key was passed = %x, %v", key, err)
+	}
+}
+
+func TestMigrateUserIndex(t *testing.T) {
+	s, stub, ctx := newLedger(t)
+
+	// A user registered before the index, with its plaintext entry
+	legacy := User{UserID: "user_legacy_1", Username: "dave", Email: "dave@example.com",
+		PasswordHash: hashPassword("secret1"), Role: "user", Status: "active"}
+	legacyJSON, _ := json.Marshal(legacy)
+	if err := stub.PutState("USER_user_legacy_1", legacyJSON); err != nil {
+		t.Fatal(err)
+	}
+	legacyKey, _ := stub.CreateCompositeKey(legacyUsernameIndex, []string{"dave", "user_legacy_1"})
+	if err := stub.PutState(legacyKey, []byte{0x00}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.AuthenticateUser(ctx, "dave", "secret1"); err != nil {
+		t.Fatalf("legacy user not found before the migration: %v", err)
+	}
+	plain := register(t, s, ctx, "erin", "", "user")
+	if _, err := s.MigrateUserIndex(ctx, plain); err == nil || !strings.Contains(err.Error(), adminRoleUser) {
+		t.Errorf("MigrateUserIndex by a plain user error = %v", err)
+	}
+
+	migrated, err := s.MigrateUserIndex(ctx, "admin")
+	if err != nil || migrated != 1 {
+		t.Fatalf("MigrateUserIndex = %d, %v, want 1 user migrated", migrated, err)
+	}
+	if worldStateContains(stub, "dave") {
+		t.Error("the legacy username is still in the world state")
+	}
+	pii, err := getUserPII(ctx, "user_legacy_1")
+	if err != nil || pii == nil || pii.Username != "dave" || pii.Email != "dave@example.com" {
+		t.Errorf("private data of the migrated user = %+v, %v", pii, err)
+	}
+	for _, alias := range []string{"dave", "dave@example.com"} {
+		if _, err := s.AuthenticateUser(ctx, alias, "secret1"); err != nil {
+			t.Errorf("AuthenticateUser(%q) after the migration failed: %v", alias, err)
+		}
+	}
+	if migrated, err := s.MigrateUserIndex(ctx, "admin"); err != nil || migrated != 0 {
+		t.Errorf("second MigrateUserIndex = %d, %v, want nothing migrated", migrated, err)
+	}
+}
+
+func TestFederatedUserIndex(t *testing.T) {
+	s, stub, ctx := newLedger(t)
+	provision := func(subject, username, email string) (*AuthResponse, error) {
+		responseJSON, err := s.ProvisionFederatedUser(ctx, "https://idp.example.com", subject, username, email, "user")
+		if err != nil {
+			return nil, err
+		}
+		var response AuthResponse
+		return &response, json.Unmarshal([]byte(responseJSON), &response)
+	}
+
+	first, err := provision("sub-1", "frank", "frank@example.com")
+	if err != nil {
+		t.Fatalf("ProvisionFederatedUser failed: %v", err)
+	}
+	if worldStateContains(stub, "frank") {
+		t.Error("the federated username or email is in the world state")
+	}
+
+	// The provider changes the email; the account keeps its username
+	again, err := provision("sub-1", "frank-renamed", "f.new@example.com")
+	if err != nil || again.UserID != first.UserID {
+		t.Fatalf("second sign-in = %+v, %v, want the same account", again, err)
+	}
+	pii, err := getUserPII(ctx, first.UserID)
+	if err != nil || pii == nil || pii.Username != "frank" || pii.Email != "f.new@example.com" {
+		t.Errorf("private data after the email changed = %+v, %v", pii, err)
+	}
+	if userIDs, _ := findIndexed(ctx, emailHMACIndex, emailDigest(testIndexKey, "frank@example.com")); len(userIDs) != 0 {
+		t.Errorf("old email still indexed for %v", userIDs)
+	}
+	// Federated accounts have no password
+	if _, err := s.AuthenticateUser(ctx, "frank", ""); err == nil {
+		t.Error("federated account signed in with a password")
+	}
+
+	if _, err := provision("sub-2", "frank", "other@example.com"); err == nil || !strings.Contains(err.Error(), "already belongs to another account") {
+		t.Errorf("provisioning a taken username error = %v", err)
+	}
+	if _, err := provision("sub-3", "grace", "f.new@example.com"); err != nil {
+		t.Fatalf("ProvisionFederatedUser failed: %v", err)
+	}
+	if _, err := s.resolveUserAlias(ctx, "f.new@example.com"); err == nil || !strings.Contains(err.Error(), "several accounts") {
+		t.Errorf("shared email resolved, error = %v", err)
+	}
+}
+
+func TestFederatedUserRequiresGateway(t *testing.T) {
+	s, stub, ctx := newLedger(t)
+	if _, err := s.ProvisionFederatedUser(ctx, "https://idp.example.com", "sub-1", "frank", "frank@example.com", "user"); err != nil {
+		t.Fatalf("ProvisionFederatedUser failed: %v", err)
+	}
+
+	// Another member naming the same identity gets neither its token nor a
+	// say over its role
+	org2 := commontest.NewContext(stub, &commontest.FakeIdentity{MSPID: "Org2MSP"})
+	if _, err := s.ProvisionFederatedUser(org2, "https://idp.example.com", "sub-1", "frank", "frank@example.com", "admin"); err == nil {
+		t.Fatal("ProvisionFederatedUser by a non-gateway caller accepted")
+	}
+	userIDs, _ := findIndexed(ctx, usernameHMACIndex, usernameDigest(testIndexKey, "frank"))
+	if len(userIDs) != 1 {
+		t.Fatalf("frank indexed as %v", userIDs)
+	}
+	if user, err := s.getUser(ctx, userIDs[0]); err != nil || user.Role != "user" {
+		t.Errorf("federated user after a refused call %+v, %v", user, err)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"log"
 	"time"
 
+	"github.com/blockchain-auth/common"
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
 )
 
@@ -19,14 +20,20 @@ type UserACLChaincode struct {
 // User represents a registered user
 type User struct {
 	UserID       string   `json:"userID"`
-	Username     string   `json:"username"`
+	Username     string   `json:"username"`     // Empty once indexed; see pii_index.go
 	PasswordHash string   `json:"passwordHash"`
-	Email        string   `json:"email"`
+	Email        string   `json:"email"`        // Empty once indexed
+	UsernameHMAC string   `json:"usernameHMAC,omitempty"` // Index digest of the username
+	EmailHMAC    string   `json:"emailHMAC,omitempty"`    // Index digest of the email
 	Role         string   `json:"role"` // "user", "admin", "operator"
 	CreatedAt    int64    `json:"createdAt"`
 	LastLogin    int64    `json:"lastLogin"`
 	OwnedDevices []string `json:"ownedDevices"` // DeviceIDs owned by this user
 	Status       string   `json:"status"`       // "active", "suspended", "deleted"
+	Issuer       string   `json:"issuer,omitempty"`  // OIDC issuer of a federated user
+	Subject      string   `json:"subject,omitempty"` // OIDC subject of a federated user
+	AdminRoles   []string `json:"adminRoles,omitempty"` // Scoped admin powers of an "admin" (see SetAdminRoles)
+	ResidencyZone string  `json:"residencyZone,omitempty"` // Zone the user operates in (see SetUserResidencyZone)
 }
 
 // Device represents an IoT device
@@ -38,6 +45,7 @@ type Device struct {
 	RegisteredAt int64  `json:"registeredAt"`
 	LastActive  int64   `json:"lastActive"`
 	Status      string `json:"status"` // "active", "inactive", "decommissioned"
+	ResidencyZone string `json:"residencyZone,omitempty"` // Zone its readings must reside in (see SetDeviceResidencyZone)
 }
 
 // AccessPermission represents a user's permission to access a device
@@ -49,23 +57,56 @@ type AccessPermission struct {
 	GrantedAt    int64  `json:"grantedAt"`
 	ExpiresAt    int64  `json:"expiresAt"`    // 0 means never expires
 	PermissionType string `json:"permissionType"` // "read", "write", "admin"
-	Status       string `json:"status"`        // "active", "revoked"
+	Status       string `json:"status"`        // "active", "revoked", "suspended" (by an access review)
 }
 
-// AuthResponse represents authentication response
+// AuthResponse represents authentication response. It is recorded in the
+// block, so it carries no username or email.
 type AuthResponse struct {
-	Success  bool   `json:"success"`
-	UserID   string `json:"userID"`
-	Username string `json:"username"`
-	Role     string `json:"role"`
-	Token    string `json:"token"` // Simplified - in production use JWT
-	Message  string `json:"message"`
+	Success    bool     `json:"success"`
+	UserID     string   `json:"userID"`
+	Role       string   `json:"role"`
+	AdminRoles []string `json:"adminRoles,omitempty"`
+	Token      string   `json:"token"` // Simplified - in production use JWT
+	Message    string   `json:"message"`
 }
 
-// InitLedger initializes the chaincode
+// Administrative powers are split into scoped roles, held by users whose
+// role is "admin". An admin may hold any of them:
+//
+//	user-admin    manage users and their admin roles
+//	device-admin  access every device and grant or revoke access to any
+//	policy-admin  change access policies
+//	auditor       read every user and permission
+//
+// Admins recorded before the roles existed hold every role until
+// MigrateAdminRoles records that explicitly, after which their roles can
+// be narrowed with SetAdminRoles.
+const (
+	adminRoleUser    = "user-admin"
+	adminRoleDevice  = "device-admin"
+	adminRolePolicy  = "policy-admin"
+	adminRoleAuditor = "auditor"
+)
+
+// allAdminRoles is the full set of admin roles
+var allAdminRoles = []string{adminRoleUser, adminRoleDevice, adminRolePolicy, adminRoleAuditor}
+
+// InitLedger initializes the chaincode. The indexKey transient field sets
+// the user index key (see pii_index.go). Only the admin MSPs, named with
+// InitAdminMSPs beforehand, may call it (see admin_msps.go).
 func (s *UserACLChaincode) InitLedger(ctx contractapi.TransactionContextInterface) error {
 	log.Println("Initializing USER-ACL Chaincode")
 
+	if err := checkAdminCaller(ctx, "InitLedger"); err != nil {
+		return err
+	}
+
+	indexKey, err := setupIndexKey(ctx)
+	if err != nil {
+		return err
+	}
+
 	// Create default admin user
 	adminPasswordHash := hashPassword("admin123")
 	admin := User{
@@ -78,6 +119,10 @@ func (s *UserACLChaincode) InitLedger(ctx contractapi.TransactionContextInterfac
 		LastLogin:    0,
 		OwnedDevices: []string{},
 		Status:       "active",
+		AdminRoles:   allAdminRoles,
+	}
+	if err := indexUser(ctx, indexKey, &admin, admin.Username, admin.Email); err != nil {
+		return err
 	}
 
 	adminJSON, err := json.Marshal(admin)
@@ -90,22 +135,24 @@ func (s *UserACLChaincode) InitLedger(ctx contractapi.TransactionContextInterfac
 		return fmt.Errorf("failed to create admin user: %v", err)
 	}
 
-	// Create index for username lookup
-	usernameIndexKey, err := ctx.GetStub().CreateCompositeKey("USERNAME_INDEX", []string{admin.Username, admin.UserID})
-	if err != nil {
-		return fmt.Errorf("failed to create username index: %v", err)
-	}
-	err = ctx.GetStub().PutState(usernameIndexKey, []byte{0x00})
-	if err != nil {
-		return fmt.Errorf("failed to store username index: %v", err)
-	}
-
 	log.Println("USER-ACL Chaincode initialized with admin user")
 	return nil
 }
 
-// RegisterUser registers a new user
+// RegisterUser registers a new user. The username, password and email
+// may be passed in transient fields of the same names instead.
 func (s *UserACLChaincode) RegisterUser(ctx contractapi.TransactionContextInterface, username string, password string, email string, role string) (string, error) {
+	var err error
+	if username, err = transientArg(ctx, "username", username); err != nil {
+		return "", err
+	}
+	if password, err = transientArg(ctx, "password", password); err != nil {
+		return "", err
+	}
+	if email, err = transientArg(ctx, "email", email); err != nil {
+		return "", err
+	}
+
 	// Validate inputs
 	if len(username) < 3 || len(username) > 32 {
 		return "", fmt.Errorf("username must be between 3 and 32 characters")
@@ -117,14 +164,25 @@ func (s *UserACLChaincode) RegisterUser(ctx contractapi.TransactionContextInterf
 		role = "user" // Default to user role
 	}
 
+	indexKey, err := getIndexKey(ctx)
+	if err != nil {
+		return "", err
+	}
+
 	// Check if username already exists
 	existingUserID, err := s.getUserIDByUsername(ctx, username)
 	if err == nil && existingUserID != "" {
 		return "", fmt.Errorf("username '%s' already exists", username)
 	}
+	if email != "" {
+		if _, err := s.getUserIDByEmail(ctx, indexKey, email); err == nil {
+			return "", fmt.Errorf("email is already registered")
+		}
+	}
 
-	// Generate unique user ID
-	userID := fmt.Sprintf("user_%s_%d", username, getCurrentTimestamp())
+	// Generate unique user ID. It is public, so it is derived from the
+	// username's digest rather than the username.
+	userID := fmt.Sprintf("user_%s_%d", usernameDigest(indexKey, username)[:16], getCurrentTimestamp())
 
 	// Hash password
 	passwordHash := hashPassword(password)
@@ -140,6 +198,10 @@ func (s *UserACLChaincode) RegisterUser(ctx contractapi.TransactionContextInterf
 		LastLogin:    0,
 		OwnedDevices: []string{},
 		Status:       "active",
+		AdminRoles:   defaultAdminRoles(role),
+	}
+	if err := indexUser(ctx, indexKey, &user, username, email); err != nil {
+		return "", err
 	}
 
 	userJSON, err := json.Marshal(user)
@@ -153,42 +215,41 @@ func (s *UserACLChaincode) RegisterUser(ctx contractapi.TransactionContextInterf
 		return "", fmt.Errorf("failed to store user: %v", err)
 	}
 
-	// Create username index for quick lookup
-	usernameIndexKey, err := ctx.GetStub().CreateCompositeKey("USERNAME_INDEX", []string{username, userID})
-	if err != nil {
-		return "", fmt.Errorf("failed to create username index: %v", err)
-	}
-	err = ctx.GetStub().PutState(usernameIndexKey, []byte{0x00})
-	if err != nil {
-		return "", fmt.Errorf("failed to store username index: %v", err)
-	}
-
 	// Emit event
 	err = ctx.GetStub().SetEvent("UserRegistered", []byte(userID))
 	if err != nil {
 		return "", fmt.Errorf("failed to emit event: %v", err)
 	}
 
-	log.Printf("User registered: %s (ID: %s, Role: %s)", username, userID, role)
+	log.Printf("User registered: %s (Role: %s)", userID, role)
 
 	// Return auth response
 	response := AuthResponse{
-		Success:  true,
-		UserID:   userID,
-		Username: username,
-		Role:     role,
-		Token:    generateToken(userID),
-		Message:  "User registered successfully",
+		Success:    true,
+		UserID:     userID,
+		Role:       role,
+		AdminRoles: user.AdminRoles,
+		Token:      generateToken(userID),
+		Message:    "User registered successfully",
 	}
 
 	responseJSON, _ := json.Marshal(response)
 	return string(responseJSON), nil
 }
 
-// AuthenticateUser authenticates a user
+// AuthenticateUser authenticates a user by username or email. Both may
+// be passed in the username and password transient fields instead.
 func (s *UserACLChaincode) AuthenticateUser(ctx contractapi.TransactionContextInterface, username string, password string) (string, error) {
-	// Find user by username
-	userID, err := s.getUserIDByUsername(ctx, username)
+	var err error
+	if username, err = transientArg(ctx, "username", username); err != nil {
+		return "", err
+	}
+	if password, err = transientArg(ctx, "password", password); err != nil {
+		return "", err
+	}
+
+	// Find user by username or email
+	userID, err := s.resolveUserAlias(ctx, username)
 	if err != nil || userID == "" {
 		return "", fmt.Errorf("invalid username or password")
 	}
@@ -213,9 +274,14 @@ func (s *UserACLChaincode) AuthenticateUser(ctx contractapi.TransactionContextIn
 		return "", fmt.Errorf("user account is %s", user.Status)
 	}
 
-	// Verify password
+	// Federated users sign in through their identity provider
+	if user.PasswordHash == "" {
+		return "", fmt.Errorf("invalid username or password")
+	}
+
+	// Verify password (constant-time to avoid leaking hash prefixes)
 	passwordHash := hashPassword(password)
-	if passwordHash != user.PasswordHash {
+	if !common.SecureCompare(passwordHash, user.PasswordHash) {
 		return "", fmt.Errorf("invalid username or password")
 	}
 
@@ -227,16 +293,142 @@ func (s *UserACLChaincode) AuthenticateUser(ctx contractapi.TransactionContextIn
 	// Emit event
 	ctx.GetStub().SetEvent("UserLoggedIn", []byte(userID))
 
-	log.Printf("User authenticated: %s (ID: %s)", username, userID)
+	log.Printf("User authenticated: %s", userID)
 
 	// Return auth response
 	response := AuthResponse{
-		Success:  true,
-		UserID:   userID,
-		Username: username,
-		Role:     user.Role,
-		Token:    generateToken(userID),
-		Message:  "Authentication successful",
+		Success:    true,
+		UserID:     userID,
+		Role:       user.Role,
+		AdminRoles: effectiveAdminRoles(&user),
+		Token:      generateToken(userID),
+		Message:    "Authentication successful",
+	}
+
+	responseJSON, _ := json.Marshal(response)
+	return string(responseJSON), nil
+}
+
+// ProvisionFederatedUser signs in a user the gateway authenticated with an
+// OIDC identity provider. The issuer and subject identify the user; the
+// first sign-in creates the account (just-in-time provisioning) and later
+// ones refresh the email and role from the provider's claims. Federated
+// accounts have no password and cannot use AuthenticateUser. The username
+// and email may be passed in transient fields of the same names instead.
+// The chaincode cannot check the provider's token, so only the gateway, an
+// admin MSP caller, may vouch for an identity.
+func (s *UserACLChaincode) ProvisionFederatedUser(ctx contractapi.TransactionContextInterface, issuer string, subject string, username string, email string, role string) (string, error) {
+	if err := checkAdminCaller(ctx, "ProvisionFederatedUser"); err != nil {
+		return "", err
+	}
+
+	var err error
+	if username, err = transientArg(ctx, "username", username); err != nil {
+		return "", err
+	}
+	if email, err = transientArg(ctx, "email", email); err != nil {
+		return "", err
+	}
+	if issuer == "" || subject == "" {
+		return "", fmt.Errorf("issuer and subject are required")
+	}
+	if len(username) < 3 || len(username) > 32 {
+		return "", fmt.Errorf("username must be between 3 and 32 characters")
+	}
+	if role != "user" && role != "admin" && role != "operator" {
+		role = "user" // Default to user role
+	}
+
+	indexKey, err := getIndexKey(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	linkKey := federatedLinkKey(issuer, subject)
+	userIDBytes, err := ctx.GetStub().GetState(linkKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to read federated identity: %v", err)
+	}
+
+	var user User
+	message := "Authentication successful"
+	if userIDBytes != nil {
+		userJSON, err := ctx.GetStub().GetState("USER_" + string(userIDBytes))
+		if err != nil || userJSON == nil {
+			return "", fmt.Errorf("federated user %s not found", string(userIDBytes))
+		}
+		if err := json.Unmarshal(userJSON, &user); err != nil {
+			return "", fmt.Errorf("failed to unmarshal user: %v", err)
+		}
+		if user.Status != "active" {
+			return "", fmt.Errorf("user account is %s", user.Status)
+		}
+		// The provider is authoritative for email and role. A change of role
+		// resets the admin roles; an unchanged one keeps any narrowing.
+		if user.Role != role {
+			user.AdminRoles = defaultAdminRoles(role)
+		}
+		user.Role = role
+		// The account keeps its username, which may predate the index
+		accountUsername := user.Username
+		pii, err := getUserPII(ctx, user.UserID)
+		if err != nil {
+			return "", err
+		}
+		if pii != nil {
+			accountUsername = pii.Username
+		}
+		if err := indexUser(ctx, indexKey, &user, accountUsername, email); err != nil {
+			return "", err
+		}
+	} else {
+		// A local account keeps its username; the provider's user must be
+		// linked by an administrator instead
+		existingUserID, err := s.getUserIDByUsername(ctx, username)
+		if err == nil && existingUserID != "" {
+			return "", fmt.Errorf("username '%s' already belongs to another account", username)
+		}
+
+		user = User{
+			UserID:       fmt.Sprintf("user_%s_%d", usernameDigest(indexKey, username)[:16], getCurrentTimestamp()),
+			Role:         role,
+			CreatedAt:    getCurrentTimestamp(),
+			OwnedDevices: []string{},
+			Status:       "active",
+			Issuer:       issuer,
+			Subject:      subject,
+			AdminRoles:   defaultAdminRoles(role),
+		}
+		if err := indexUser(ctx, indexKey, &user, username, email); err != nil {
+			return "", err
+		}
+		if err := ctx.GetStub().PutState(linkKey, []byte(user.UserID)); err != nil {
+			return "", fmt.Errorf("failed to store federated identity: %v", err)
+		}
+		message = "User provisioned from identity provider"
+		log.Printf("Federated user provisioned: %s (Role: %s, Issuer: %s)", user.UserID, role, issuer)
+	}
+
+	user.LastLogin = getCurrentTimestamp()
+	userJSON, err := json.Marshal(user)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal user: %v", err)
+	}
+	if err := ctx.GetStub().PutState("USER_"+user.UserID, userJSON); err != nil {
+		return "", fmt.Errorf("failed to store user: %v", err)
+	}
+
+	if err := ctx.GetStub().SetEvent("FederatedUserLoggedIn", []byte(user.UserID)); err != nil {
+		return "", fmt.Errorf("failed to emit event: %v", err)
+	}
+
+	response := AuthResponse{
+		Success:    true,
+		UserID:     user.UserID,
+		Role:       user.Role,
+		AdminRoles: effectiveAdminRoles(&user),
+		Token:      generateToken(user.UserID),
+		Message:    message,
 	}
 
 	responseJSON, _ := json.Marshal(response)
@@ -321,8 +513,8 @@ func (s *UserACLChaincode) GrantAccess(ctx contractapi.TransactionContextInterfa
 		}
 		var caller User
 		json.Unmarshal(callerJSON, &caller)
-		if caller.Role != "admin" {
-			return fmt.Errorf("unauthorized: not device owner or admin")
+		if !hasAdminRole(&caller, adminRoleDevice) {
+			return fmt.Errorf("unauthorized: not device owner or %s", adminRoleDevice)
 		}
 	}
 
@@ -374,8 +566,13 @@ func (s *UserACLChaincode) GrantAccess(ctx contractapi.TransactionContextInterfa
 	return nil
 }
 
-// RevokeAccess revokes a user's access to a device
+// RevokeAccess revokes a user's access to a device. The caller must also
+// belong to an admin MSP (see admin_msps.go).
 func (s *UserACLChaincode) RevokeAccess(ctx contractapi.TransactionContextInterface, ownerID string, targetUserID string, deviceID string) error {
+	if err := checkAdminCaller(ctx, "RevokeAccess"); err != nil {
+		return err
+	}
+
 	// Verify device exists and caller is owner/admin
 	deviceJSON, err := ctx.GetStub().GetState("DEVICE_" + deviceID)
 	if err != nil || deviceJSON == nil {
@@ -390,8 +587,8 @@ func (s *UserACLChaincode) RevokeAccess(ctx contractapi.TransactionContextInterf
 		callerJSON, _ := ctx.GetStub().GetState("USER_" + ownerID)
 		var caller User
 		json.Unmarshal(callerJSON, &caller)
-		if caller.Role != "admin" {
-			return fmt.Errorf("unauthorized: not device owner or admin")
+		if !hasAdminRole(&caller, adminRoleDevice) {
+			return fmt.Errorf("unauthorized: not device owner or %s", adminRoleDevice)
 		}
 	}
 
@@ -428,12 +625,12 @@ func (s *UserACLChaincode) ValidateAccess(ctx contractapi.TransactionContextInte
 	var user User
 	json.Unmarshal(userJSON, &user)
 
-	// Admins can access all devices
-	if user.Role == "admin" {
+	// Device admins can access all devices
+	if hasAdminRole(&user, adminRoleDevice) {
 		result := map[string]interface{}{
 			"hasAccess":      true,
 			"permissionType": "admin",
-			"reason":         "Admin role",
+			"reason":         "Device admin role",
 		}
 		resultJSON, _ := json.Marshal(result)
 		return string(resultJSON), nil
@@ -474,9 +671,13 @@ func (s *UserACLChaincode) ValidateAccess(ctx contractapi.TransactionContextInte
 	json.Unmarshal(permJSON, &permission)
 
 	if permission.Status != "active" {
+		reason := "Permission revoked"
+		if permission.Status == "suspended" {
+			reason = "Permission suspended by access review"
+		}
 		result := map[string]interface{}{
 			"hasAccess": false,
-			"reason":    "Permission revoked",
+			"reason":    reason,
 		}
 		resultJSON, _ := json.Marshal(result)
 		return string(resultJSON), nil
@@ -514,8 +715,8 @@ func (s *UserACLChaincode) GetUserPermissions(ctx contractapi.TransactionContext
 
 	var devices []string
 
-	// If admin, return all devices
-	if user.Role == "admin" {
+	// If device admin, return all devices
+	if hasAdminRole(&user, adminRoleDevice) {
 		allDevices, _ := s.getAllDevices(ctx)
 		for _, device := range allDevices {
 			devices = append(devices, device.DeviceID)
@@ -548,9 +749,10 @@ func (s *UserACLChaincode) GetUserPermissions(ctx contractapi.TransactionContext
 	}
 
 	result := map[string]interface{}{
-		"userID":  userID,
-		"role":    user.Role,
-		"devices": devices,
+		"userID":     userID,
+		"role":       user.Role,
+		"adminRoles": effectiveAdminRoles(&user),
+		"devices":    devices,
 	}
 
 	resultJSON, _ := json.Marshal(result)
@@ -570,6 +772,15 @@ func (s *UserACLChaincode) GetUser(ctx contractapi.TransactionContextInterface,
 	// Remove password hash before returning
 	user.PasswordHash = ""
 
+	// Members of the userPII collection see the username and email. A
+	// peer outside it cannot read them and returns the record without.
+	if pii, err := getUserPII(ctx, userID); err != nil {
+		log.Printf("Returning user %s without personal data: %v", userID, err)
+	} else if pii != nil {
+		user.Username = pii.Username
+		user.Email = pii.Email
+	}
+
 	safeUserJSON, _ := json.Marshal(user)
 	return string(safeUserJSON), nil
 }
@@ -595,30 +806,801 @@ func (s *UserACLChaincode) GetAllDevices(ctx contractapi.TransactionContextInter
 	return string(devicesJSON), nil
 }
 
-// Helper functions
+// SetAdminRoles replaces the admin roles of a user. The caller must hold
+// the user-admin role. rolesJSON is a JSON list of roles; a user given
+// roles becomes an admin, an admin given none becomes a plain user.
+func (s *UserACLChaincode) SetAdminRoles(ctx contractapi.TransactionContextInterface, callerID string, targetUserID string, rolesJSON string) error {
+	caller, err := s.getUser(ctx, callerID)
+	if err != nil {
+		return err
+	}
+	if !hasAdminRole(caller, adminRoleUser) {
+		return fmt.Errorf("unauthorized: %s does not hold the %s role", callerID, adminRoleUser)
+	}
 
-func (s *UserACLChaincode) getUserIDByUsername(ctx contractapi.TransactionContextInterface, username string) (string, error) {
-	// Query composite key index
-	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey("USERNAME_INDEX", []string{username})
+	var roles []string
+	if err := json.Unmarshal([]byte(rolesJSON), &roles); err != nil {
+		return fmt.Errorf("invalid admin roles format (JSON parsing failed): %v", err)
+	}
+	for _, role := range roles {
+		if !containsString(allAdminRoles, role) {
+			return fmt.Errorf("unknown admin role %q", role)
+		}
+	}
+	// An admin with no user-admins left could never change roles again
+	if callerID == targetUserID && !containsString(roles, adminRoleUser) {
+		return fmt.Errorf("cannot remove the %s role from yourself", adminRoleUser)
+	}
+
+	target, err := s.getUser(ctx, targetUserID)
+	if err != nil {
+		return err
+	}
+	if len(roles) > 0 {
+		target.Role = "admin"
+		target.AdminRoles = roles
+	} else {
+		if target.Role == "admin" {
+			target.Role = "user"
+		}
+		target.AdminRoles = nil
+	}
+
+	targetJSON, err := json.Marshal(target)
+	if err != nil {
+		return fmt.Errorf("failed to marshal user: %v", err)
+	}
+	if err := ctx.GetStub().PutState("USER_"+targetUserID, targetJSON); err != nil {
+		return fmt.Errorf("failed to store user: %v", err)
+	}
+	if err := ctx.GetStub().SetEvent("AdminRolesChanged", []byte(targetUserID)); err != nil {
+		return fmt.Errorf("failed to emit event: %v", err)
+	}
+
+	log.Printf("Admin roles of %s set to %v by %s", targetUserID, roles, callerID)
+	return nil
+}
+
+// MigrateAdminRoles records the full set of admin roles on every admin
+// created before the roles existed, so that their roles can be narrowed.
+// It changes no one's powers and may be run again; it returns the number
+// of users migrated.
+func (s *UserACLChaincode) MigrateAdminRoles(ctx contractapi.TransactionContextInterface) (int, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByRange("USER_", "USER_~")
+	if err != nil {
+		return 0, fmt.Errorf("failed to read users: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	migrated := 0
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return 0, fmt.Errorf("failed to iterate users: %v", err)
+		}
+
+		var user User
+		if err := json.Unmarshal(queryResponse.Value, &user); err != nil {
+			log.Printf("Skipping unreadable user %s: %v", queryResponse.Key, err)
+			continue
+		}
+		if user.Role != "admin" || len(user.AdminRoles) > 0 {
+			continue
+		}
+
+		user.AdminRoles = allAdminRoles
+		userJSON, err := json.Marshal(user)
+		if err != nil {
+			return 0, fmt.Errorf("failed to marshal user: %v", err)
+		}
+		if err := ctx.GetStub().PutState(queryResponse.Key, userJSON); err != nil {
+			return 0, fmt.Errorf("failed to store user: %v", err)
+		}
+		migrated++
+	}
+
+	log.Printf("Migrated %d admin users to scoped admin roles", migrated)
+	return migrated, nil
+}
+
+// Residency zones
+//
+// A policy-admin tags devices and users with a residency zone, e.g.
+// "eu-west". The IOT-DATA chaincode tags each reading with the zone of its
+// device at ingestion and enforces its residency policy on reads and
+// exports by comparing the reading's zone with the reader's. An empty zone
+// clears the tag; readings already stored keep theirs.
+
+// maxResidencyZoneLength bounds zone names
+const maxResidencyZoneLength = 32
+
+// SetDeviceResidencyZone tags a device with a residency zone. The caller
+// must hold the policy-admin role.
+func (s *UserACLChaincode) SetDeviceResidencyZone(ctx contractapi.TransactionContextInterface, callerID string, deviceID string, zone string) error {
+	if err := s.requireAdminRole(ctx, callerID, adminRolePolicy); err != nil {
+		return err
+	}
+	if err := validateResidencyZone(zone); err != nil {
+		return err
+	}
+
+	deviceJSON, err := ctx.GetStub().GetState("DEVICE_" + deviceID)
+	if err != nil {
+		return fmt.Errorf("failed to read device: %v", err)
+	}
+	if deviceJSON == nil {
+		return fmt.Errorf("device %s not found", deviceID)
+	}
+	var device Device
+	if err := json.Unmarshal(deviceJSON, &device); err != nil {
+		return fmt.Errorf("failed to unmarshal device: %v", err)
+	}
+
+	device.ResidencyZone = zone
+	deviceJSON, err = json.Marshal(device)
+	if err != nil {
+		return fmt.Errorf("failed to marshal device: %v", err)
+	}
+	if err := ctx.GetStub().PutState("DEVICE_"+deviceID, deviceJSON); err != nil {
+		return fmt.Errorf("failed to store device: %v", err)
+	}
+	if err := ctx.GetStub().SetEvent("DeviceResidencyZoneChanged", deviceJSON); err != nil {
+		return fmt.Errorf("failed to emit event: %v", err)
+	}
+
+	log.Printf("Residency zone of device %s set to %q by %s", deviceID, zone, callerID)
+	return nil
+}
+
+// SetUserResidencyZone records the residency zone a user operates in. The
+// caller must hold the policy-admin role.
+func (s *UserACLChaincode) SetUserResidencyZone(ctx contractapi.TransactionContextInterface, callerID string, targetUserID string, zone string) error {
+	if err := s.requireAdminRole(ctx, callerID, adminRolePolicy); err != nil {
+		return err
+	}
+	if err := validateResidencyZone(zone); err != nil {
+		return err
+	}
+
+	target, err := s.getUser(ctx, targetUserID)
+	if err != nil {
+		return err
+	}
+	target.ResidencyZone = zone
+	targetJSON, err := json.Marshal(target)
+	if err != nil {
+		return fmt.Errorf("failed to marshal user: %v", err)
+	}
+	if err := ctx.GetStub().PutState("USER_"+targetUserID, targetJSON); err != nil {
+		return fmt.Errorf("failed to store user: %v", err)
+	}
+	if err := ctx.GetStub().SetEvent("UserResidencyZoneChanged", []byte(targetUserID)); err != nil {
+		return fmt.Errorf("failed to emit event: %v", err)
+	}
+
+	log.Printf("Residency zone of user %s set to %q by %s", targetUserID, zone, callerID)
+	return nil
+}
+
+// validateResidencyZone accepts an empty zone or a short name of letters,
+// digits, '-' and '_'
+func validateResidencyZone(zone string) error {
+	if len(zone) > maxResidencyZoneLength {
+		return fmt.Errorf("residency zone must be at most %d characters", maxResidencyZoneLength)
+	}
+	for _, c := range zone {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return fmt.Errorf("invalid residency zone %q: use letters, digits, '-' and '_'", zone)
+		}
+	}
+	return nil
+}
+
+// Access reviews
+//
+// A policy-admin starts a review campaign with a deadline. The campaign
+// lists every active permission as an item, grouped by the owner of its
+// device. Before the deadline each owner (or a device-admin) attests an
+// item, keeping the permission, or revokes it. Once the deadline has
+// passed anyone may close the campaign: items still pending have their
+// permission suspended, and the campaign's outcome is recorded with it.
+// Only one campaign is open at a time.
+
+// Access review decisions
+const (
+	reviewPending   = "pending"
+	reviewAttested  = "attested"
+	reviewRevoked   = "revoked"
+	reviewSuspended = "suspended" // not attested by the deadline
+)
+
+// openAccessReviewKey holds the ID of the open access review, if any
+const openAccessReviewKey = "OPEN_ACCESS_REVIEW"
+
+// AccessReview is an access review campaign
+type AccessReview struct {
+	ReviewID  string              `json:"reviewID"`
+	StartedBy string              `json:"startedBy"`
+	StartedAt int64               `json:"startedAt"`
+	Deadline  int64               `json:"deadline"`
+	Status    string              `json:"status"` // "open", "closed"
+	ClosedAt  int64               `json:"closedAt,omitempty"`
+	Outcome   AccessReviewOutcome `json:"outcome"`
+}
+
+// AccessReviewOutcome counts a campaign's items by decision. It is
+// recorded when the campaign starts and when it closes; decisions in
+// between only touch their own item, so that owners deciding at the same
+// time do not conflict.
+type AccessReviewOutcome struct {
+	Items     int `json:"items"`
+	Attested  int `json:"attested"`
+	Revoked   int `json:"revoked"`
+	Suspended int `json:"suspended"`
+	Pending   int `json:"pending"`
+}
+
+// AccessReviewItem is one permission under review
+type AccessReviewItem struct {
+	ReviewID       string `json:"reviewID"`
+	PermissionID   string `json:"permissionID"`
+	OwnerID        string `json:"ownerID"` // owner of the device, who reviews the permission
+	UserID         string `json:"userID"`
+	DeviceID       string `json:"deviceID"`
+	PermissionType string `json:"permissionType"`
+	GrantedBy      string `json:"grantedBy"`
+	GrantedAt      int64  `json:"grantedAt"`
+	Decision       string `json:"decision"`
+	DecidedBy      string `json:"decidedBy,omitempty"`
+	DecidedAt      int64  `json:"decidedAt,omitempty"`
+}
+
+// AccessReviewReport is a campaign with the items its reader may see
+type AccessReviewReport struct {
+	Review AccessReview       `json:"review"`
+	Items  []AccessReviewItem `json:"items"`
+}
+
+// StartAccessReview opens an access review campaign over every active
+// permission, due at deadline (Unix seconds). The caller must hold the
+// policy-admin role. It returns the campaign as JSON.
+func (s *UserACLChaincode) StartAccessReview(ctx contractapi.TransactionContextInterface, callerID string, deadline int64) (string, error) {
+	caller, err := s.getUser(ctx, callerID)
 	if err != nil {
 		return "", err
 	}
+	if !hasAdminRole(caller, adminRolePolicy) {
+		return "", fmt.Errorf("unauthorized: %s does not hold the %s role", callerID, adminRolePolicy)
+	}
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return "", err
+	}
+	if deadline <= now {
+		return "", fmt.Errorf("deadline must be in the future")
+	}
+	openID, err := ctx.GetStub().GetState(openAccessReviewKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to read open access review: %v", err)
+	}
+	if openID != nil {
+		return "", fmt.Errorf("access review %s is still open", string(openID))
+	}
+
+	review := AccessReview{
+		ReviewID:  "review_" + ctx.GetStub().GetTxID()[:16],
+		StartedBy: callerID,
+		StartedAt: now,
+		Deadline:  deadline,
+		Status:    "open",
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByRange("PERM_", "PERM_~")
+	if err != nil {
+		return "", fmt.Errorf("failed to read permissions: %v", err)
+	}
 	defer resultsIterator.Close()
 
-	if resultsIterator.HasNext() {
+	owners := make(map[string]string)
+	for resultsIterator.HasNext() {
 		queryResponse, err := resultsIterator.Next()
 		if err != nil {
+			return "", fmt.Errorf("failed to iterate permissions: %v", err)
+		}
+
+		var permission AccessPermission
+		if err := json.Unmarshal(queryResponse.Value, &permission); err != nil {
+			log.Printf("Skipping unreadable permission %s: %v", queryResponse.Key, err)
+			continue
+		}
+		if permission.Status != "active" || (permission.ExpiresAt > 0 && now > permission.ExpiresAt) {
+			continue
+		}
+
+		ownerID, ok := owners[permission.DeviceID]
+		if !ok {
+			deviceJSON, err := ctx.GetStub().GetState("DEVICE_" + permission.DeviceID)
+			if err != nil {
+				return "", fmt.Errorf("failed to read device: %v", err)
+			}
+			var device Device
+			if deviceJSON != nil {
+				json.Unmarshal(deviceJSON, &device)
+			}
+			ownerID = device.OwnerID
+			owners[permission.DeviceID] = ownerID
+		}
+
+		item := AccessReviewItem{
+			ReviewID:       review.ReviewID,
+			PermissionID:   permission.PermissionID,
+			OwnerID:        ownerID,
+			UserID:         permission.UserID,
+			DeviceID:       permission.DeviceID,
+			PermissionType: permission.PermissionType,
+			GrantedBy:      permission.GrantedBy,
+			GrantedAt:      permission.GrantedAt,
+			Decision:       reviewPending,
+		}
+		if err := putAccessReviewItem(ctx, &item); err != nil {
 			return "", err
 		}
+		review.Outcome.Items++
+		review.Outcome.Pending++
+	}
+
+	if err := putAccessReview(ctx, &review); err != nil {
+		return "", err
+	}
+	if err := ctx.GetStub().PutState(openAccessReviewKey, []byte(review.ReviewID)); err != nil {
+		return "", fmt.Errorf("failed to store open access review: %v", err)
+	}
+
+	reviewJSON, _ := json.Marshal(review)
+	if err := ctx.GetStub().SetEvent("AccessReviewStarted", reviewJSON); err != nil {
+		return "", fmt.Errorf("failed to emit event: %v", err)
+	}
+
+	log.Printf("Access review %s started by %s: %d permissions due %d", review.ReviewID, callerID, review.Outcome.Items, deadline)
+	return string(reviewJSON), nil
+}
+
+// ReviewAccess records an owner's decision on a permission under review:
+// "attest" keeps it, "revoke" revokes it at once. The caller must own the
+// device or hold the device-admin role, and the campaign must be open and
+// not past its deadline. Each permission is decided once.
+func (s *UserACLChaincode) ReviewAccess(ctx contractapi.TransactionContextInterface, callerID string, reviewID string, permissionID string, decision string) error {
+	var outcome string
+	switch decision {
+	case "attest":
+		outcome = reviewAttested
+	case "revoke":
+		outcome = reviewRevoked
+	default:
+		return fmt.Errorf("unknown review decision %q (want attest or revoke)", decision)
+	}
+
+	review, err := getAccessReview(ctx, reviewID)
+	if err != nil {
+		return err
+	}
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	if review.Status != "open" {
+		return fmt.Errorf("access review %s is closed", reviewID)
+	}
+	if now > review.Deadline {
+		return fmt.Errorf("access review %s is past its deadline", reviewID)
+	}
 
-		// Extract userID from composite key
-		_, compositeKeyParts, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+	item, err := s.getAccessReviewItem(ctx, reviewID, permissionID)
+	if err != nil {
+		return err
+	}
+	if item.OwnerID != callerID {
+		caller, err := s.getUser(ctx, callerID)
 		if err != nil {
+			return err
+		}
+		if !hasAdminRole(caller, adminRoleDevice) {
+			return fmt.Errorf("unauthorized: not device owner or %s", adminRoleDevice)
+		}
+	}
+	if item.Decision != reviewPending {
+		return fmt.Errorf("permission %s was already %s", permissionID, item.Decision)
+	}
+
+	permJSON, err := ctx.GetStub().GetState(permissionID)
+	if err != nil || permJSON == nil {
+		return fmt.Errorf("permission not found")
+	}
+	var permission AccessPermission
+	json.Unmarshal(permJSON, &permission)
+
+	event := "AccessAttested"
+	if outcome == reviewAttested {
+		if permission.Status != "active" {
+			return fmt.Errorf("permission %s is %s and cannot be attested", permissionID, permission.Status)
+		}
+	} else {
+		event = "AccessRevoked"
+		permission.Status = "revoked"
+		permJSON, _ = json.Marshal(permission)
+		if err := ctx.GetStub().PutState(permissionID, permJSON); err != nil {
+			return fmt.Errorf("failed to store permission: %v", err)
+		}
+	}
+
+	item.Decision = outcome
+	item.DecidedBy = callerID
+	item.DecidedAt = now
+	if err := putAccessReviewItem(ctx, item); err != nil {
+		return err
+	}
+
+	if err := ctx.GetStub().SetEvent(event, []byte(permissionID)); err != nil {
+		return fmt.Errorf("failed to emit event: %v", err)
+	}
+
+	log.Printf("Access review %s: %s %s permission %s", reviewID, callerID, outcome, permissionID)
+	return nil
+}
+
+// CloseAccessReview closes a campaign past its deadline, suspending the
+// permissions nobody attested or revoked. Anyone may close it, since it
+// only enforces the outcome. It returns the closed campaign as JSON.
+func (s *UserACLChaincode) CloseAccessReview(ctx contractapi.TransactionContextInterface, reviewID string) (string, error) {
+	review, err := getAccessReview(ctx, reviewID)
+	if err != nil {
+		return "", err
+	}
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return "", err
+	}
+	if review.Status != "open" {
+		return "", fmt.Errorf("access review %s is already closed", reviewID)
+	}
+	if now <= review.Deadline {
+		return "", fmt.Errorf("access review %s is open until %d", reviewID, review.Deadline)
+	}
+
+	items, err := accessReviewItems(ctx, reviewID, "")
+	if err != nil {
+		return "", err
+	}
+	for i := range items {
+		item := &items[i]
+		if item.Decision != reviewPending {
+			continue
+		}
+
+		// A permission revoked outside the review during the campaign
+		// counts as revoked; only active ones are suspended
+		permJSON, err := ctx.GetStub().GetState(item.PermissionID)
+		if err != nil {
+			return "", fmt.Errorf("failed to read permission: %v", err)
+		}
+		item.Decision = reviewSuspended
+		if permJSON != nil {
+			var permission AccessPermission
+			json.Unmarshal(permJSON, &permission)
+			switch permission.Status {
+			case "active":
+				permission.Status = "suspended"
+				permJSON, _ = json.Marshal(permission)
+				if err := ctx.GetStub().PutState(item.PermissionID, permJSON); err != nil {
+					return "", fmt.Errorf("failed to store permission: %v", err)
+				}
+			case "revoked":
+				item.Decision = reviewRevoked
+			}
+		}
+
+		item.DecidedAt = now
+		if err := putAccessReviewItem(ctx, item); err != nil {
 			return "", err
 		}
+	}
+
+	review.Outcome = countAccessReviewItems(items)
+	review.Status = "closed"
+	review.ClosedAt = now
+	if err := putAccessReview(ctx, review); err != nil {
+		return "", err
+	}
+	if err := ctx.GetStub().DelState(openAccessReviewKey); err != nil {
+		return "", fmt.Errorf("failed to clear open access review: %v", err)
+	}
+
+	reviewJSON, _ := json.Marshal(review)
+	if err := ctx.GetStub().SetEvent("AccessReviewClosed", reviewJSON); err != nil {
+		return "", fmt.Errorf("failed to emit event: %v", err)
+	}
+
+	log.Printf("Access review %s closed: %d attested, %d revoked, %d suspended", reviewID, review.Outcome.Attested, review.Outcome.Revoked, review.Outcome.Suspended)
+	return string(reviewJSON), nil
+}
 
-		if len(compositeKeyParts) > 1 {
-			return compositeKeyParts[1], nil
+// GetAccessReview returns a campaign and its items as JSON. Policy admins
+// and auditors see every item; other callers only the items of their own
+// devices. The outcome of an open campaign counts the items returned.
+func (s *UserACLChaincode) GetAccessReview(ctx contractapi.TransactionContextInterface, callerID string, reviewID string) (string, error) {
+	caller, err := s.getUser(ctx, callerID)
+	if err != nil {
+		return "", err
+	}
+	review, err := getAccessReview(ctx, reviewID)
+	if err != nil {
+		return "", err
+	}
+
+	ownerID := callerID
+	if hasAdminRole(caller, adminRolePolicy) || hasAdminRole(caller, adminRoleAuditor) {
+		ownerID = ""
+	}
+	items, err := accessReviewItems(ctx, reviewID, ownerID)
+	if err != nil {
+		return "", err
+	}
+	if review.Status == "open" {
+		review.Outcome = countAccessReviewItems(items)
+	}
+
+	reportJSON, _ := json.Marshal(AccessReviewReport{Review: *review, Items: items})
+	return string(reportJSON), nil
+}
+
+// GetAccessReviews returns every campaign, without items, as JSON
+func (s *UserACLChaincode) GetAccessReviews(ctx contractapi.TransactionContextInterface) (string, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByRange("ACCESS_REVIEW_", "ACCESS_REVIEW_~")
+	if err != nil {
+		return "", fmt.Errorf("failed to read access reviews: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	reviews := []AccessReview{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return "", fmt.Errorf("failed to iterate access reviews: %v", err)
+		}
+		var review AccessReview
+		if err := json.Unmarshal(queryResponse.Value, &review); err != nil {
+			log.Printf("Skipping unreadable access review %s: %v", queryResponse.Key, err)
+			continue
+		}
+		reviews = append(reviews, review)
+	}
+
+	reviewsJSON, _ := json.Marshal(reviews)
+	return string(reviewsJSON), nil
+}
+
+// GetOpenAccessReview returns the open campaign, without items, as JSON,
+// or "" if none is open
+func (s *UserACLChaincode) GetOpenAccessReview(ctx contractapi.TransactionContextInterface) (string, error) {
+	openID, err := ctx.GetStub().GetState(openAccessReviewKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to read open access review: %v", err)
+	}
+	if openID == nil {
+		return "", nil
+	}
+	review, err := getAccessReview(ctx, string(openID))
+	if err != nil {
+		return "", err
+	}
+	reviewJSON, _ := json.Marshal(review)
+	return string(reviewJSON), nil
+}
+
+// getAccessReviewItem looks an item up by permission. Items are keyed by
+// the owner of the permission's device, so each owner's items are one
+// range.
+func (s *UserACLChaincode) getAccessReviewItem(ctx contractapi.TransactionContextInterface, reviewID, permissionID string) (*AccessReviewItem, error) {
+	permJSON, err := ctx.GetStub().GetState(permissionID)
+	if err != nil || permJSON == nil {
+		return nil, fmt.Errorf("permission not found")
+	}
+	var permission AccessPermission
+	json.Unmarshal(permJSON, &permission)
+	deviceJSON, err := ctx.GetStub().GetState("DEVICE_" + permission.DeviceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read device: %v", err)
+	}
+	var device Device
+	if deviceJSON != nil {
+		json.Unmarshal(deviceJSON, &device)
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey("REVIEW_ITEM", []string{reviewID, device.OwnerID, permissionID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create review item key: %v", err)
+	}
+	itemJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read review item: %v", err)
+	}
+	if itemJSON == nil {
+		return nil, fmt.Errorf("permission %s is not under access review %s", permissionID, reviewID)
+	}
+	var item AccessReviewItem
+	if err := json.Unmarshal(itemJSON, &item); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal review item: %v", err)
+	}
+	return &item, nil
+}
+
+func countAccessReviewItems(items []AccessReviewItem) AccessReviewOutcome {
+	outcome := AccessReviewOutcome{Items: len(items)}
+	for _, item := range items {
+		switch item.Decision {
+		case reviewAttested:
+			outcome.Attested++
+		case reviewRevoked:
+			outcome.Revoked++
+		case reviewSuspended:
+			outcome.Suspended++
+		default:
+			outcome.Pending++
+		}
+	}
+	return outcome
+}
+
+func getAccessReview(ctx contractapi.TransactionContextInterface, reviewID string) (*AccessReview, error) {
+	reviewJSON, err := ctx.GetStub().GetState("ACCESS_REVIEW_" + reviewID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read access review: %v", err)
+	}
+	if reviewJSON == nil {
+		return nil, fmt.Errorf("access review %s not found", reviewID)
+	}
+	var review AccessReview
+	if err := json.Unmarshal(reviewJSON, &review); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal access review: %v", err)
+	}
+	return &review, nil
+}
+
+func putAccessReview(ctx contractapi.TransactionContextInterface, review *AccessReview) error {
+	reviewJSON, err := json.Marshal(review)
+	if err != nil {
+		return fmt.Errorf("failed to marshal access review: %v", err)
+	}
+	if err := ctx.GetStub().PutState("ACCESS_REVIEW_"+review.ReviewID, reviewJSON); err != nil {
+		return fmt.Errorf("failed to store access review: %v", err)
+	}
+	return nil
+}
+
+func putAccessReviewItem(ctx contractapi.TransactionContextInterface, item *AccessReviewItem) error {
+	key, err := ctx.GetStub().CreateCompositeKey("REVIEW_ITEM", []string{item.ReviewID, item.OwnerID, item.PermissionID})
+	if err != nil {
+		return fmt.Errorf("failed to create review item key: %v", err)
+	}
+	itemJSON, err := json.Marshal(item)
+	if err != nil {
+		return fmt.Errorf("failed to marshal review item: %v", err)
+	}
+	if err := ctx.GetStub().PutState(key, itemJSON); err != nil {
+		return fmt.Errorf("failed to store review item: %v", err)
+	}
+	return nil
+}
+
+// accessReviewItems returns a campaign's items, only those of ownerID
+// unless it is empty
+func accessReviewItems(ctx contractapi.TransactionContextInterface, reviewID, ownerID string) ([]AccessReviewItem, error) {
+	attributes := []string{reviewID}
+	if ownerID != "" {
+		attributes = append(attributes, ownerID)
+	}
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey("REVIEW_ITEM", attributes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read review items: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	items := []AccessReviewItem{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate review items: %v", err)
+		}
+		var item AccessReviewItem
+		if err := json.Unmarshal(queryResponse.Value, &item); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal review item: %v", err)
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// Helper functions
+
+func (s *UserACLChaincode) getUser(ctx contractapi.TransactionContextInterface, userID string) (*User, error) {
+	userJSON, err := ctx.GetStub().GetState("USER_" + userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read user: %v", err)
+	}
+	if userJSON == nil {
+		return nil, fmt.Errorf("user %s not found", userID)
+	}
+
+	var user User
+	if err := json.Unmarshal(userJSON, &user); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal user: %v", err)
+	}
+	return &user, nil
+}
+
+// effectiveAdminRoles returns the admin roles a user holds. An admin
+// created before the roles existed holds all of them.
+func effectiveAdminRoles(user *User) []string {
+	if user.Role != "admin" {
+		return nil
+	}
+	if len(user.AdminRoles) == 0 {
+		return allAdminRoles
+	}
+	return user.AdminRoles
+}
+
+func hasAdminRole(user *User, role string) bool {
+	return containsString(effectiveAdminRoles(user), role)
+}
+
+// requireAdminRole fails unless userID holds the admin role
+func (s *UserACLChaincode) requireAdminRole(ctx contractapi.TransactionContextInterface, userID, role string) error {
+	user, err := s.getUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !hasAdminRole(user, role) {
+		return fmt.Errorf("unauthorized: %s does not hold the %s role", userID, role)
+	}
+	return nil
+}
+
+// defaultAdminRoles are the admin roles of a new user with a role
+func defaultAdminRoles(role string) []string {
+	if role == "admin" {
+		return allAdminRoles
+	}
+	return nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// getUserIDByUsername finds a user through the HMAC index, or through the
+// plaintext index for users MigrateUserIndex has not moved yet
+func (s *UserACLChaincode) getUserIDByUsername(ctx contractapi.TransactionContextInterface, username string) (string, error) {
+	key, err := getIndexKey(ctx)
+	if err != nil {
+		return "", err
+	}
+	for _, lookup := range []struct{ index, value string }{
+		{usernameHMACIndex, usernameDigest(key, username)},
+		{legacyUsernameIndex, username},
+	} {
+		userIDs, err := findIndexed(ctx, lookup.index, lookup.value)
+		if err != nil {
+			return "", err
+		}
+		if len(userIDs) > 0 {
+			return userIDs[0], nil
 		}
 	}
 
@@ -652,6 +1634,13 @@ func hashPassword(password string) string {
 	return hex.EncodeToString(hash[:])
 }
 
+// federatedLinkKey maps an OIDC issuer and subject to a user ID. Subjects
+// are only unique per issuer, so both are hashed into the key.
+func federatedLinkKey(issuer, subject string) string {
+	hash := sha256.Sum256([]byte(issuer + "\x00" + subject))
+	return "FEDERATED_" + hex.EncodeToString(hash[:])
+}
+
 func generateToken(userID string) string {
 	// Simplified token generation - in production use JWT
 	data := fmt.Sprintf("%s_%d", userID, getCurrentTimestamp())
@@ -663,6 +1652,17 @@ func getCurrentTimestamp() int64 {
 	return time.Now().Unix()
 }
 
+// txTimestamp is the transaction's timestamp in Unix seconds. Unlike the
+// local clock it is the same on every endorser, so deadlines checked
+// against it endorse consistently.
+func txTimestamp(ctx contractapi.TransactionContextInterface) (int64, error) {
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get transaction timestamp: %v", err)
+	}
+	return timestamp.Seconds, nil
+}
+
 func main() {
 	chaincode, err := contractapi.NewChaincode(&UserACLChaincode{})
 	if err != nil {
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// validateAccess returns the result of ValidateAccess
+func validateAccess(t *testing.T, s *UserACLChaincode, ctx contractapi.TransactionContextInterface, userID, deviceID string) map[string]interface{} {
+	t.Helper()
+	resultJSON, err := s.ValidateAccess(ctx, userID, deviceID)
+	if err != nil {
+		t.Fatalf("ValidateAccess(%s, %s) failed: %v", userID, deviceID, err)
+	}
+	var result map[string]interface{}
+	if err := json.Unmarshal([]byte(resultJSON), &result); err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestDeviceAccess(t *testing.T) {
+	s, _, ctx := newLedger(t)
+	owner := register(t, s, ctx, "owner", "", "user")
+	reader := register(t, s, ctx, "reader", "", "user")
+	other := register(t, s, ctx, "other", "", "user")
+	if err := s.RegisterDevice(ctx, "sensor-1", "Sensor", owner, "sensor"); err != nil {
+		t.Fatalf("RegisterDevice failed: %v", err)
+	}
+
+	if result := validateAccess(t, s, ctx, owner, "sensor-1"); result["permissionType"] != "owner" {
+		t.Errorf("owner access %v", result)
+	}
+	if result := validateAccess(t, s, ctx, reader, "sensor-1"); result["hasAccess"] != false {
+		t.Errorf("access before a grant %v", result)
+	}
+
+	if err := s.GrantAccess(ctx, other, reader, "sensor-1", "read"); err == nil || !strings.Contains(err.Error(), "unauthorized") {
+		t.Errorf("GrantAccess by a non-owner error = %v", err)
+	}
+	if err := s.GrantAccess(ctx, owner, reader, "sensor-1", "read"); err != nil {
+		t.Fatalf("GrantAccess failed: %v", err)
+	}
+	if err := s.GrantAccess(ctx, owner, reader, "sensor-1", "write"); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("second GrantAccess error = %v", err)
+	}
+	if result := validateAccess(t, s, ctx, reader, "sensor-1"); result["hasAccess"] != true || result["permissionType"] != "read" {
+		t.Errorf("access after a grant %v", result)
+	}
+
+	if err := s.RevokeAccess(ctx, other, reader, "sensor-1"); err == nil || !strings.Contains(err.Error(), "unauthorized") {
+		t.Errorf("RevokeAccess by a non-owner error = %v", err)
+	}
+	if err := s.RevokeAccess(ctx, owner, reader, "sensor-1"); err != nil {
+		t.Fatalf("RevokeAccess failed: %v", err)
+	}
+	if result := validateAccess(t, s, ctx, reader, "sensor-1"); result["hasAccess"] != false || result["reason"] != "Permission revoked" {
+		t.Errorf("access after a revocation %v", result)
+	}
+}
+
+func TestScopedAdminRoles(t *testing.T) {
+	s, _, ctx := newLedger(t)
+	owner := register(t, s, ctx, "owner", "", "user")
+	devices := register(t, s, ctx, "devices", "", "user")
+	policies := register(t, s, ctx, "policies", "", "user")
+	if err := s.RegisterDevice(ctx, "sensor-1", "Sensor", owner, "sensor"); err != nil {
+		t.Fatalf("RegisterDevice failed: %v", err)
+	}
+
+	for _, roles := range []string{`["root"]`, `"device-admin"`} {
+		if err := s.SetAdminRoles(ctx, "admin", devices, roles); err == nil {
+			t.Errorf("SetAdminRoles(%s) accepted", roles)
+		}
+	}
+	if err := s.SetAdminRoles(ctx, "admin", "admin", `["device-admin"]`); err == nil || !strings.Contains(err.Error(), "from yourself") {
+		t.Errorf("admin dropping its own user-admin role error = %v", err)
+	}
+	if err := s.SetAdminRoles(ctx, "admin", devices, `["device-admin"]`); err != nil {
+		t.Fatalf("SetAdminRoles failed: %v", err)
+	}
+	if err := s.SetAdminRoles(ctx, "admin", policies, `["policy-admin"]`); err != nil {
+		t.Fatalf("SetAdminRoles failed: %v", err)
+	}
+
+	// A device-admin reaches every device but cannot manage users or policies
+	if result := validateAccess(t, s, ctx, devices, "sensor-1"); result["permissionType"] != "admin" {
+		t.Errorf("device-admin access %v", result)
+	}
+	if err := s.GrantAccess(ctx, devices, policies, "sensor-1", "read"); err != nil {
+		t.Errorf("GrantAccess by a device-admin failed: %v", err)
+	}
+	if err := s.SetAdminRoles(ctx, devices, owner, `["auditor"]`); err == nil || !strings.Contains(err.Error(), adminRoleUser) {
+		t.Errorf("SetAdminRoles by a device-admin error = %v", err)
+	}
+	if err := s.SetDeviceResidencyZone(ctx, devices, "sensor-1", "eu-west"); err == nil || !strings.Contains(err.Error(), adminRolePolicy) {
+		t.Errorf("SetDeviceResidencyZone by a device-admin error = %v", err)
+	}
+
+	// A policy-admin sets residency zones but has no device access
+	if err := s.SetDeviceResidencyZone(ctx, policies, "sensor-1", "eu-west"); err != nil {
+		t.Errorf("SetDeviceResidencyZone by a policy-admin failed: %v", err)
+	}
+	if err := s.SetDeviceResidencyZone(ctx, policies, "sensor-1", "eu west"); err == nil {
+		t.Error("invalid residency zone accepted")
+	}
+	if err := s.GrantAccess(ctx, policies, owner, "sensor-1", "read"); err == nil || !strings.Contains(err.Error(), adminRoleDevice) {
+		t.Errorf("GrantAccess by a policy-admin error = %v", err)
+	}
+
+	// No roles make an admin a plain user again
+	if err := s.SetAdminRoles(ctx, "admin", devices, `[]`); err != nil {
+		t.Fatalf("SetAdminRoles failed: %v", err)
+	}
+	user, err := s.getUser(ctx, devices)
+	if err != nil || user.Role != "user" || len(effectiveAdminRoles(user)) != 0 {
+		t.Errorf("user after its roles were removed %+v, %v", user, err)
+	}
+}
+
+func TestMigrateAdminRoles(t *testing.T) {
+	s, stub, ctx := newLedger(t)
+
+	// An admin recorded before the roles existed holds all of them
+	legacy := User{UserID: "user_legacy_admin", Role: "admin", Status: "active"}
+	legacyJSON, _ := json.Marshal(legacy)
+	if err := stub.PutState("USER_user_legacy_admin", legacyJSON); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.requireAdminRole(ctx, "user_legacy_admin", adminRoleAuditor); err != nil {
+		t.Errorf("legacy admin refused: %v", err)
+	}
+
+	migrated, err := s.MigrateAdminRoles(ctx)
+	if err != nil || migrated != 1 {
+		t.Fatalf("MigrateAdminRoles = %d, %v, want 1 admin migrated", migrated, err)
+	}
+	user, err := s.getUser(ctx, "user_legacy_admin")
+	if err != nil || len(user.AdminRoles) != len(allAdminRoles) {
+		t.Fatalf("migrated admin %+v, %v", user, err)
+	}
+	if migrated, err := s.MigrateAdminRoles(ctx); err != nil || migrated != 0 {
+		t.Errorf("second MigrateAdminRoles = %d, %v, want nothing migrated", migrated, err)
+	}
+
+	// Once migrated, the roles can be narrowed
+	if err := s.SetAdminRoles(ctx, "admin", "user_legacy_admin", `["auditor"]`); err != nil {
+		t.Fatalf("SetAdminRoles failed: %v", err)
+	}
+	if err := s.requireAdminRole(ctx, "user_legacy_admin", adminRoleDevice); err == nil {
+		t.Error("narrowed admin kept the device-admin role")
+	}
+}
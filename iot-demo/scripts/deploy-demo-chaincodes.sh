@@ -10,21 +10,77 @@ echo "Deploying demo chaincodes..."
 # Navigate to network scripts directory
 NETWORK_SCRIPTS="/home/user/blok_chain_authh/network/scripts"
 
-# Deploy USER-ACL chaincode
+# Deploy USER-ACL chaincode. Usernames and emails are kept in the userPII
+# private data collection of Org1 and Org2, so only their peers endorse it.
 echo "  Deploying USER-ACL chaincode..."
 cd /home/user/blok_chain_authh
+# USER-ACL builds against chaincodes/common through a replace directive; the
+# peer only sees the package, so the dependencies are vendored into it
+(cd iot-demo/chaincodes/user-acl-chaincode && go mod vendor)
 if [ -f "$NETWORK_SCRIPTS/deploy-chaincode.sh" ]; then
-    bash "$NETWORK_SCRIPTS/deploy-chaincode.sh" user-acl || echo "  (Chaincode may already be deployed)"
+    INIT_REQUIRED=1 \
+    COLLECTIONS_CONFIG="/opt/gopath/src/github.com/hyperledger/fabric/chaincodes/user-acl-chaincode/collections_config.json" \
+    SIGNATURE_POLICY="OR('Org1MSP.peer','Org2MSP.peer')" \
+        bash "$NETWORK_SCRIPTS/deploy-chaincode.sh" user-acl || echo "  (Chaincode may already be deployed)"
 else
     echo "  Warning: deploy-chaincode.sh not found, assuming manual deployment"
 fi
 
+ORDERER_CA=/opt/gopath/src/github.com/hyperledger/fabric/peer/crypto/ordererOrganizations/example.com/orderers/orderer.example.com/msp/tlscacerts/tlsca.example.com-cert.pem
+
+# Name the admin organizations first: every admin function, InitLedger
+# included, is refused until they are set. Org1 is the web backend's. The
+# chaincodes are deployed with --init-required, so InitAdminMSPs goes in the
+# Init transaction and no other organization can get there first; if it
+# fails, the chaincode was initialized by someone else and must not be used.
+PEER_CRYPTO=/opt/gopath/src/github.com/hyperledger/fabric/peer/crypto/peerOrganizations
+init_admin_msps() {
+    local cc_name=$1
+    echo "  Naming the ${cc_name} admin MSPs..."
+    if ! docker exec cli peer chaincode invoke \
+        -o orderer.example.com:7050 \
+        -C authchannel \
+        -n "$cc_name" \
+        --tls \
+        --cafile "$ORDERER_CA" \
+        --peerAddresses peer0.org1.example.com:7051 \
+        --tlsRootCertFiles "$PEER_CRYPTO/org1.example.com/peers/peer0.org1.example.com/tls/ca.crt" \
+        --peerAddresses peer0.org2.example.com:9051 \
+        --tlsRootCertFiles "$PEER_CRYPTO/org2.example.com/peers/peer0.org2.example.com/tls/ca.crt" \
+        --waitForEvent \
+        --isInit \
+        -c '{"Args":["InitAdminMSPs","[\"Org1MSP\"]"]}'; then
+        echo "  Error: InitAdminMSPs failed for ${cc_name}. If the chaincode was already" >&2
+        echo "  initialized, check its admin MSPs with GetAdminMSPs before using it." >&2
+        exit 1
+    fi
+}
+init_admin_msps user-acl
+
+# Initialize USER-ACL with a random key for its username and email index.
+# The key goes in transient data, so it reaches only the endorsing peers.
+echo "  Initializing USER-ACL chaincode..."
+INDEX_KEY=$(openssl rand -base64 32)
+docker exec cli peer chaincode invoke \
+    -o orderer.example.com:7050 \
+    -C authchannel \
+    -n user-acl \
+    --tls \
+    --cafile "$ORDERER_CA" \
+    -c '{"Args":["InitLedger"]}' \
+    --transient "{\"indexKey\":\"${INDEX_KEY}\"}" || echo "  (Chaincode may already be initialized)"
+
 # Deploy IOT-DATA chaincode
 echo "  Deploying IOT-DATA chaincode..."
+(cd iot-demo/chaincodes/iot-data-chaincode && go mod vendor)
 if [ -f "$NETWORK_SCRIPTS/deploy-chaincode.sh" ]; then
-    bash "$NETWORK_SCRIPTS/deploy-chaincode.sh" iot-data || echo "  (Chaincode may already be deployed)"
+    INIT_REQUIRED=1 bash "$NETWORK_SCRIPTS/deploy-chaincode.sh" iot-data || echo "  (Chaincode may already be deployed)"
 else
     echo "  Warning: deploy-chaincode.sh not found, assuming manual deployment"
 fi
 
+# The redaction and residency policies and the validation specs are closed
+# until the admin organizations are named
+init_admin_msps iot-data
+
 echo "Chaincode deployment complete (or already deployed)"
@@ -0,0 +1,39 @@
+#!/usr/bin/env node
+
+/**
+ * Decrypt Readings - Reader-side decryption of encrypted telemetry
+ *
+ * Usage:
+ *   node decrypt-readings.js <readerID> <privateKey.pem> [readings.json]
+ *
+ * Reads the JSON returned by IOT-DATA GetEncryptedReadings (from a file or
+ * stdin) and prints the decrypted readings the reader is authorized for.
+ */
+
+const fs = require('fs');
+const { decryptReading } = require('./telemetry-crypto');
+
+function main() {
+    const [readerID, keyPath, inputPath] = process.argv.slice(2);
+    if (!readerID || !keyPath) {
+        console.error('Usage: node decrypt-readings.js <readerID> <privateKey.pem> [readings.json]');
+        process.exit(1);
+    }
+
+    const privateKeyPem = fs.readFileSync(keyPath, 'utf8');
+    const input = fs.readFileSync(inputPath || 0, 'utf8');
+    const records = JSON.parse(input);
+
+    const readings = [];
+    for (const record of Array.isArray(records) ? records : [records]) {
+        try {
+            readings.push(decryptReading(record, { readerID, privateKeyPem }));
+        } catch (error) {
+            console.error(`⚠️  Skipping ${record.readingID}: ${error.message}`);
+        }
+    }
+
+    console.log(JSON.stringify(readings, null, 2));
+}
+
+main();
@@ -13,6 +13,7 @@
 
 const FabricClient = require('./fabric-client');
 const TemperatureGenerator = require('./temperature-generator');
+const telemetryCrypto = require('./telemetry-crypto');
 const fs = require('fs');
 const path = require('path');
 
@@ -33,12 +34,27 @@ class IoTDeviceSimulator {
         this.updateInterval = null;
         this.isRunning = false;
 
+        // Encryption-at-rest of reading values (optional)
+        this.encryption = null;
+        if (config.encryption && config.encryption.enabled) {
+            const baseDir = path.dirname(process.env.CONFIG_PATH || path.join(__dirname, 'config.json'));
+            this.encryption = {
+                fields: config.encryption.fields || ['temperature'],
+                dataKey: telemetryCrypto.loadDataKey(path.resolve(baseDir, config.encryption.keyDir || 'keys'), this.deviceID),
+                readerKeys: telemetryCrypto.loadReaderKeys(config.encryption.readers, baseDir)
+            };
+        }
+
         console.log(`\n🌡️  IoT Device Simulator Initialized`);
         console.log(`📱 Device ID: ${this.deviceID}`);
         console.log(`👤 Owner: ${this.ownerID}`);
         console.log(`📊 Temp Range: ${config.temperature.baseTemp - config.temperature.amplitude}°C - ${config.temperature.baseTemp + config.temperature.amplitude}°C`);
         console.log(`⏱️  Update Interval: ${config.temperature.updateInterval.min}-${config.temperature.updateInterval.max}s`);
-        console.log(`🔐 Session Duration: ${config.session.duration}s\n`);
+        console.log(`🔐 Session Duration: ${config.session.duration}s`);
+        if (this.encryption) {
+            console.log(`🔒 Encrypting: ${this.encryption.fields.join(', ')} (key ${telemetryCrypto.keyID(this.encryption.dataKey)}, ${Object.keys(this.encryption.readerKeys).length} reader(s))`);
+        }
+        console.log('');
     }
 
     /**
@@ -230,6 +246,7 @@ class IoTDeviceSimulator {
             this.currentSession = {
                 sessionID: accessResult.sessionID,
                 ticketID: ticketID,
+                sessionKey: sessionKey,
                 expiresAt: accessResult.expiresAt
             };
             this.sessionStartTime = Date.now();
@@ -255,16 +272,20 @@ class IoTDeviceSimulator {
             // Send to blockchain
             console.log(`📊 Sending temperature: ${temperature.toFixed(1)}°C`);
 
-            await this.fabricClient.invoke(
-                'iot-data',
-                'StoreTemperature',
-                [
-                    this.deviceID,
-                    temperature.toString(),
-                    timestamp.toString(),
-                    this.currentSession.sessionID
-                ]
-            );
+            if (this.encryption) {
+                await this.storeEncryptedReading(temperature, timestamp);
+            } else {
+                await this.fabricClient.invoke(
+                    'iot-data',
+                    'StoreTemperature',
+                    [
+                        this.deviceID,
+                        temperature.toString(),
+                        timestamp.toString(),
+                        this.currentSession.sessionID
+                    ]
+                );
+            }
 
             console.log(`✅ Temperature stored on blockchain`);
 
@@ -281,6 +302,31 @@ class IoTDeviceSimulator {
         }
     }
 
+    /**
+     * Encrypt the reading values on the device and store only ciphertext
+     */
+    async storeEncryptedReading(temperature, timestamp) {
+        const payload = telemetryCrypto.encryptReading({
+            deviceID: this.deviceID,
+            timestamp: timestamp,
+            sessionID: this.currentSession.sessionID,
+            temperature: temperature,
+            unit: 'C',
+            status: (temperature > 28.0 || temperature < 18.0) ? 'anomaly' : 'normal'
+        }, {
+            fields: this.encryption.fields,
+            dataKey: this.encryption.dataKey,
+            sessionKey: this.currentSession.sessionKey,
+            readerKeys: this.encryption.readerKeys
+        });
+
+        await this.fabricClient.invoke(
+            'iot-data',
+            'StoreEncryptedReading',
+            [JSON.stringify(payload)]
+        );
+    }
+
     /**
      * Get random interval between readings
      */
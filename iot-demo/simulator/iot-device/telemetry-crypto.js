@@ -0,0 +1,205 @@
+/**
+ * Telemetry Crypto - Encryption-at-rest for reading values
+ *
+ * Envelope encryption for telemetry fields:
+ * - Each device holds a 256-bit data key (generated once, kept on the device)
+ * - Value fields are encrypted with AES-256-GCM under the data key
+ * - The data key is wrapped under a key derived (HKDF) from the session key,
+ *   and with the RSA public key of every authorized reader
+ * - Metadata (device, timestamp, session, key ID) is bound as GCM
+ *   additional data, so ciphertext cannot be replayed under other metadata
+ *
+ * The ledger only ever sees ciphertext plus the searchable metadata.
+ */
+
+const crypto = require('crypto');
+const fs = require('fs');
+const path = require('path');
+
+const ALGORITHM = 'AES-256-GCM';
+const SESSION_WRAP_INFO = 'iot-telemetry-data-key';
+
+/**
+ * Load the device data key from keyDir, generating it on first use
+ */
+function loadDataKey(keyDir, deviceID) {
+    const keyPath = path.join(keyDir, `${deviceID}.datakey`);
+
+    if (fs.existsSync(keyPath)) {
+        const key = Buffer.from(fs.readFileSync(keyPath, 'utf8').trim(), 'base64');
+        if (key.length !== 32) {
+            throw new Error(`Invalid data key in ${keyPath}`);
+        }
+        return key;
+    }
+
+    const key = crypto.randomBytes(32);
+    fs.mkdirSync(keyDir, { recursive: true, mode: 0o700 });
+    fs.writeFileSync(keyPath, key.toString('base64'), { mode: 0o600 });
+    return key;
+}
+
+/**
+ * Short identifier of a data key, so readers can tell key generations apart
+ */
+function keyID(dataKey) {
+    return crypto.createHash('sha256').update(dataKey).digest('hex').substring(0, 16);
+}
+
+/**
+ * Load reader public keys from a { readerID: pemPath } map
+ */
+function loadReaderKeys(readers, baseDir) {
+    const keys = {};
+    for (const [readerID, pemPath] of Object.entries(readers || {})) {
+        keys[readerID] = fs.readFileSync(path.resolve(baseDir, pemPath), 'utf8');
+    }
+    return keys;
+}
+
+/**
+ * Derive the session wrapping key from the session key returned by the AS
+ */
+function deriveSessionWrapKey(sessionKey, sessionID) {
+    return Buffer.from(crypto.hkdfSync('sha256', Buffer.from(sessionKey, 'utf8'),
+        Buffer.from(sessionID, 'utf8'), Buffer.from(SESSION_WRAP_INFO, 'utf8'), 32));
+}
+
+function associatedData(meta) {
+    return Buffer.from([meta.deviceID, meta.timestamp, meta.sessionID, meta.keyID].join('|'), 'utf8');
+}
+
+function gcmEncrypt(key, plaintext, aad) {
+    const nonce = crypto.randomBytes(12);
+    const cipher = crypto.createCipheriv('aes-256-gcm', key, nonce);
+    if (aad) {
+        cipher.setAAD(aad);
+    }
+    const ciphertext = Buffer.concat([cipher.update(plaintext), cipher.final(), cipher.getAuthTag()]);
+    return { nonce, ciphertext };
+}
+
+function gcmDecrypt(key, nonce, sealed, aad) {
+    const tag = sealed.subarray(sealed.length - 16);
+    const decipher = crypto.createDecipheriv('aes-256-gcm', key, nonce);
+    decipher.setAuthTag(tag);
+    if (aad) {
+        decipher.setAAD(aad);
+    }
+    return Buffer.concat([decipher.update(sealed.subarray(0, sealed.length - 16)), decipher.final()]);
+}
+
+/**
+ * Encrypt the value fields of a reading
+ *
+ * Returns the EncryptedReading payload expected by the IOT-DATA
+ * StoreEncryptedReading transaction. Fields not listed in `fields`
+ * are dropped unless they are part of the searchable metadata.
+ */
+function encryptReading(reading, options) {
+    const { fields, dataKey, sessionKey, readerKeys } = options;
+
+    if (!sessionKey) {
+        throw new Error('A session key is required to encrypt readings');
+    }
+    if (!readerKeys || Object.keys(readerKeys).length === 0) {
+        throw new Error('At least one authorized reader key is required');
+    }
+
+    const meta = {
+        deviceID: reading.deviceID,
+        timestamp: reading.timestamp,
+        sessionID: reading.sessionID,
+        keyID: keyID(dataKey)
+    };
+
+    const values = {};
+    for (const field of fields) {
+        if (!(field in reading)) {
+            throw new Error(`Reading has no field '${field}' to encrypt`);
+        }
+        values[field] = reading[field];
+    }
+
+    const { nonce, ciphertext } = gcmEncrypt(dataKey, Buffer.from(JSON.stringify(values), 'utf8'), associatedData(meta));
+
+    const wrapKey = deriveSessionWrapKey(sessionKey, reading.sessionID);
+    const sessionWrapped = gcmEncrypt(wrapKey, dataKey);
+
+    const wrappedForReaders = {};
+    for (const [readerID, publicKeyPem] of Object.entries(readerKeys)) {
+        wrappedForReaders[readerID] = crypto.publicEncrypt({
+            key: publicKeyPem,
+            padding: crypto.constants.RSA_PKCS1_OAEP_PADDING,
+            oaepHash: 'sha256'
+        }, dataKey).toString('base64');
+    }
+
+    return {
+        deviceID: meta.deviceID,
+        timestamp: meta.timestamp,
+        sessionID: meta.sessionID,
+        unit: reading.unit || 'C',
+        status: reading.status,
+        fields: fields,
+        algorithm: ALGORITHM,
+        keyID: meta.keyID,
+        nonce: nonce.toString('base64'),
+        ciphertext: ciphertext.toString('base64'),
+        sessionKey: Buffer.concat([sessionWrapped.nonce, sessionWrapped.ciphertext]).toString('base64'),
+        readerKeys: wrappedForReaders
+    };
+}
+
+/**
+ * Decrypt an EncryptedReading as an authorized reader
+ *
+ * Pass { readerID, privateKeyPem } to unwrap with a reader key, or
+ * { sessionKey } to unwrap with the session key of the writing device.
+ */
+function decryptReading(record, credentials) {
+    let dataKey;
+
+    if (credentials.sessionKey) {
+        const sealed = Buffer.from(record.sessionKey, 'base64');
+        const wrapKey = deriveSessionWrapKey(credentials.sessionKey, record.sessionID);
+        dataKey = gcmDecrypt(wrapKey, sealed.subarray(0, 12), sealed.subarray(12));
+    } else {
+        const wrapped = record.readerKeys && record.readerKeys[credentials.readerID];
+        if (!wrapped) {
+            throw new Error(`Reader ${credentials.readerID} is not authorized for reading ${record.readingID}`);
+        }
+        dataKey = crypto.privateDecrypt({
+            key: credentials.privateKeyPem,
+            padding: crypto.constants.RSA_PKCS1_OAEP_PADDING,
+            oaepHash: 'sha256'
+        }, Buffer.from(wrapped, 'base64'));
+    }
+
+    const meta = {
+        deviceID: record.deviceID,
+        timestamp: record.timestamp,
+        sessionID: record.sessionID,
+        keyID: record.keyID
+    };
+    const plaintext = gcmDecrypt(dataKey, Buffer.from(record.nonce, 'base64'),
+        Buffer.from(record.ciphertext, 'base64'), associatedData(meta));
+
+    return {
+        readingID: record.readingID,
+        deviceID: record.deviceID,
+        timestamp: record.timestamp,
+        sessionID: record.sessionID,
+        unit: record.unit,
+        status: record.status,
+        ...JSON.parse(plaintext.toString('utf8'))
+    };
+}
+
+module.exports = {
+    loadDataKey,
+    loadReaderKeys,
+    keyID,
+    encryptReading,
+    decryptReading
+};
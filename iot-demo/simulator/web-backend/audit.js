@@ -0,0 +1,45 @@
+/**
+ * Audit events for the REST gateway
+ *
+ * Events have the shape of the chaincodes' AuditEvent (chaincodes/common/audit.go)
+ * and are written one JSON object per line, so the collector that ships the
+ * chaincode audit trail can ship the gateway's as well.
+ *
+ * Configuration (environment):
+ *   AUDIT_LOG  file the events are appended to (default: stdout)
+ */
+
+const crypto = require('crypto');
+const fs = require('fs');
+
+const AUDIT_LOG = process.env.AUDIT_LOG || '';
+
+/**
+ * Write an audit event, filling in its ID, time and request context
+ */
+function recordAudit(req, event) {
+    const entry = {
+        eventID: crypto.randomBytes(16).toString('hex'),
+        timestamp: Math.floor(Date.now() / 1000),
+        ...event,
+        actorID: req.user ? req.user.userID : undefined,
+        ipAddress: req.ip,
+        userAgent: req.get('user-agent'),
+        chaincodeName: 'rest-gateway'
+    };
+    const line = JSON.stringify(entry) + '\n';
+
+    if (!AUDIT_LOG) {
+        process.stdout.write(line);
+        return;
+    }
+    fs.appendFile(AUDIT_LOG, line, (error) => {
+        if (error) {
+            // Losing the event must not fail the request; keep it on stdout
+            console.error('Failed to write audit log:', error.message);
+            process.stdout.write(line);
+        }
+    });
+}
+
+module.exports = { recordAudit };
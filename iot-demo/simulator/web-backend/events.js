@@ -0,0 +1,367 @@
+/**
+ * WebSocket push channel for dashboards
+ *
+ * Dashboards connect to /api/events?access_token=<JWT> (browsers cannot set
+ * headers on a WebSocket) and receive chaincode events as they are committed
+ * instead of polling the REST API:
+ *
+ *   session  ISV access log entries, restrictions and lease sweeps
+ *   anomaly  anomalous readings and AS risk decisions
+ *   device   registrations, revocations and access grants
+ *   reading  a device stored a reading (without its values)
+ *
+ * Every connection is filtered by its token: a category needs its scope,
+ * device events are only sent for devices the user can access (checked with
+ * user-acl ValidateAccess and cached per connection), and events tied to no
+ * device the user could see are for admins only. Payloads are cut down to
+ * the fields listed below, so that a push never carries more than the REST
+ * routes would return; readings in particular stay behind the redaction
+ * policy of /api/readings, and a dashboard fetches them from there when
+ * told that a device has a new one.
+ *
+ * A client may narrow what it receives by sending
+ *   {"type": "subscribe", "categories": ["device"], "devices": ["dev1"]}
+ * Each event arrives as
+ *   {"type": "event", "category", "chaincode", "event", "deviceID", "txID", "data"}
+ * The connection is closed with code 4401 when the token expires.
+ */
+
+const { WebSocketServer } = require('ws');
+const { URL } = require('url');
+const { decodeToken } = require('./routes/auth');
+const { tokenScopes } = require('./scopes');
+
+const EVENTS_PATH = '/api/events';
+const HEARTBEAT_INTERVAL_MS = 30 * 1000;
+const CLOSE_TOKEN_EXPIRED = 4401;
+
+const CATEGORY_SCOPES = {
+    session: 'device:read',
+    anomaly: 'device:telemetry',
+    device: 'device:read',
+    reading: 'device:telemetry'
+};
+
+/**
+ * Chaincode events pushed to dashboards. route picks the category and
+ * device of an event from its payload, or returns null to drop it.
+ */
+const EVENT_SOURCES = {
+    isv: {
+        AccessLogged: (data) => ({
+            category: 'session',
+            deviceID: data.deviceID,
+            data: pick(data, ['deviceID', 'clientID', 'sessionID', 'action', 'timestamp'])
+        }),
+        SessionRestricted: (data) => ({
+            category: 'session',
+            deviceID: data.deviceID,
+            data: pick(data, ['deviceID', 'clientID', 'sessionID', 'action', 'capabilities', 'timestamp'])
+        }),
+        SessionsSwept: (data) => ({
+            category: 'session',
+            data: pick(data, ['expiredLeases', 'closedSessions'])
+        })
+    },
+    as: {
+        RiskDecision: (data) => (data.action === 'allow' ? null : {
+            category: 'anomaly',
+            data: pick(data, ['clientID', 'action', 'reasons', 'timestamp'])
+        }),
+        DeviceRevoked: (deviceID) => ({
+            category: 'device',
+            deviceID: deviceID,
+            data: { deviceID, status: 'revoked' }
+        })
+    },
+    'iot-data': {
+        TemperatureStored: (data) => ({
+            category: data.status === 'anomaly' ? 'anomaly' : 'reading',
+            deviceID: data.deviceID,
+            data: pick(data, ['deviceID', 'status', 'timestamp'])
+        })
+    },
+    'user-acl': {
+        DeviceRegistered: (deviceID) => ({
+            category: 'device',
+            deviceID: deviceID,
+            data: { deviceID, status: 'registered' }
+        }),
+        AccessGranted: (permissionID) => permissionEvent(permissionID, 'granted'),
+        AccessRevoked: (permissionID) => permissionEvent(permissionID, 'revoked')
+    }
+};
+
+function pick(data, fields) {
+    const result = {};
+    for (const field of fields) {
+        if (data[field] !== undefined) {
+            result[field] = data[field];
+        }
+    }
+    return result;
+}
+
+/**
+ * user-acl permission IDs are PERM_<userID>_<deviceID>. User IDs contain
+ * underscores, so the event is matched against each connection's user
+ * rather than split here.
+ */
+function permissionEvent(permissionID, status) {
+    return {
+        category: 'device',
+        permissionID: permissionID,
+        data: { permissionID, status }
+    };
+}
+
+/**
+ * Decode an event payload: JSON when it parses, the raw string otherwise
+ * (older chaincodes emit bare IDs)
+ */
+function decodePayload(payload) {
+    const text = payload ? payload.toString('utf8') : '';
+    try {
+        return JSON.parse(text);
+    } catch (error) {
+        return text;
+    }
+}
+
+/**
+ * The token carried by an upgrade request, from the access_token query
+ * parameter or an Authorization header for non-browser clients
+ */
+function upgradeToken(req, url) {
+    const header = req.headers.authorization;
+    if (header && header.startsWith('Bearer ')) {
+        return header.slice('Bearer '.length);
+    }
+    return url.searchParams.get('access_token');
+}
+
+/**
+ * One dashboard connection and the filters that apply to it
+ */
+class Subscriber {
+    constructor(socket, user, fabricClient) {
+        this.socket = socket;
+        this.user = user;
+        this.fabricClient = fabricClient;
+        this.scopes = tokenScopes(user);
+        this.categories = Object.keys(CATEGORY_SCOPES).filter(c => this.scopes.includes(CATEGORY_SCOPES[c]));
+        this.devices = null; // null: every accessible device
+        this.access = new Map(); // deviceID -> Promise<boolean>
+        this.alive = true;
+    }
+
+    get isAdmin() {
+        return this.user.role === 'admin';
+    }
+
+    /**
+     * Apply a subscribe message; categories the token has no scope for are
+     * refused rather than silently dropped
+     */
+    subscribe(message) {
+        if (Array.isArray(message.categories)) {
+            const refused = message.categories.filter(c => !this.scopes.includes(CATEGORY_SCOPES[c]));
+            if (refused.length > 0) {
+                throw new Error(`Cannot subscribe to ${refused.join(' ')}`);
+            }
+            this.categories = message.categories;
+        }
+        if (message.devices !== undefined) {
+            this.devices = Array.isArray(message.devices) ? new Set(message.devices.map(String)) : null;
+        }
+    }
+
+    canAccess(deviceID) {
+        if (!this.access.has(deviceID)) {
+            const check = this.fabricClient.query('user-acl', 'ValidateAccess', [this.user.userID, deviceID])
+                .then(response => JSON.parse(response).hasAccess === true)
+                .catch(() => false);
+            this.access.set(deviceID, check);
+        }
+        return this.access.get(deviceID);
+    }
+
+    /**
+     * Decide whether the event goes to this connection
+     */
+    async accepts(event) {
+        if (!this.categories.includes(event.category)) {
+            return false;
+        }
+
+        if (event.permissionID) {
+            // A grant or revocation concerns its target user only
+            const prefix = `PERM_${this.user.userID}_`;
+            if (!event.permissionID.startsWith(prefix)) {
+                return this.isAdmin;
+            }
+            const deviceID = event.permissionID.slice(prefix.length);
+            this.access.delete(deviceID);
+            event = { ...event, deviceID };
+        }
+
+        if (!event.deviceID) {
+            return this.isAdmin;
+        }
+        if (this.devices && !this.devices.has(event.deviceID)) {
+            return false;
+        }
+        if (event.permissionID) {
+            return true;
+        }
+        return this.isAdmin || this.canAccess(event.deviceID);
+    }
+
+    send(message) {
+        if (this.socket.readyState === this.socket.OPEN) {
+            this.socket.send(JSON.stringify(message));
+        }
+    }
+}
+
+/**
+ * Fan chaincode events out to the dashboards connected to server
+ */
+class EventStream {
+    constructor(server, fabricClient, options = {}) {
+        this.fabricClient = fabricClient;
+        this.allowedOrigin = options.allowedOrigin;
+        this.subscribers = new Set();
+        this.removeListeners = [];
+        this.wss = new WebSocketServer({ noServer: true });
+
+        server.on('upgrade', (req, socket, head) => this.handleUpgrade(req, socket, head));
+        this.heartbeat = setInterval(() => this.checkAlive(), HEARTBEAT_INTERVAL_MS);
+    }
+
+    /**
+     * Subscribe to the chaincodes' events. A chaincode that is not deployed
+     * is skipped, as FabricClient.connect does.
+     */
+    async start() {
+        for (const [chaincode, routes] of Object.entries(EVENT_SOURCES)) {
+            try {
+                const remove = await this.fabricClient.addContractListener(
+                    chaincode,
+                    (event) => this.dispatch(chaincode, routes, event)
+                );
+                this.removeListeners.push(remove);
+            } catch (error) {
+                console.warn(`Warning: no event stream from chaincode '${chaincode}': ${error.message}`);
+            }
+        }
+    }
+
+    handleUpgrade(req, socket, head) {
+        const url = new URL(req.url, 'http://localhost');
+        if (url.pathname !== EVENTS_PATH) {
+            socket.destroy();
+            return;
+        }
+        if (this.allowedOrigin && req.headers.origin && req.headers.origin !== this.allowedOrigin) {
+            return reject(socket, 403, 'Forbidden');
+        }
+
+        let user;
+        try {
+            user = decodeToken(upgradeToken(req, url));
+        } catch (error) {
+            return reject(socket, 401, 'Unauthorized');
+        }
+
+        this.wss.handleUpgrade(req, socket, head, (ws) => this.accept(ws, user));
+    }
+
+    accept(ws, user) {
+        const subscriber = new Subscriber(ws, user, this.fabricClient);
+        this.subscribers.add(subscriber);
+
+        const expiry = user.exp ? setTimeout(() => {
+            ws.close(CLOSE_TOKEN_EXPIRED, 'Token expired');
+        }, Math.max(0, user.exp * 1000 - Date.now())) : null;
+
+        ws.on('pong', () => { subscriber.alive = true; });
+        ws.on('message', (raw) => {
+            try {
+                const message = JSON.parse(raw.toString());
+                if (message.type !== 'subscribe') {
+                    throw new Error(`Unknown message type ${message.type}`);
+                }
+                subscriber.subscribe(message);
+                subscriber.send({ type: 'subscribed', categories: subscriber.categories });
+            } catch (error) {
+                subscriber.send({ type: 'error', message: error.message });
+            }
+        });
+        ws.on('close', () => {
+            clearTimeout(expiry);
+            this.subscribers.delete(subscriber);
+        });
+
+        subscriber.send({ type: 'subscribed', categories: subscriber.categories });
+    }
+
+    async dispatch(chaincode, routes, contractEvent) {
+        const route = routes[contractEvent.eventName];
+        if (!route) {
+            return;
+        }
+        const routed = route(decodePayload(contractEvent.payload));
+        if (!routed) {
+            return;
+        }
+
+        const event = { ...routed, txID: contractEvent.getTransactionEvent().transactionId };
+        for (const subscriber of this.subscribers) {
+            try {
+                if (await subscriber.accepts(event)) {
+                    subscriber.send({
+                        type: 'event',
+                        category: event.category,
+                        chaincode: chaincode,
+                        event: contractEvent.eventName,
+                        deviceID: event.deviceID,
+                        txID: event.txID,
+                        data: event.data
+                    });
+                }
+            } catch (error) {
+                console.error(`Failed to push ${contractEvent.eventName}:`, error.message);
+            }
+        }
+    }
+
+    checkAlive() {
+        for (const subscriber of this.subscribers) {
+            if (!subscriber.alive) {
+                subscriber.socket.terminate();
+                continue;
+            }
+            subscriber.alive = false;
+            subscriber.socket.ping();
+        }
+    }
+
+    close() {
+        clearInterval(this.heartbeat);
+        for (const remove of this.removeListeners) {
+            remove();
+        }
+        for (const subscriber of this.subscribers) {
+            subscriber.socket.close(1001, 'Server shutting down');
+        }
+        this.wss.close();
+    }
+}
+
+function reject(socket, status, message) {
+    socket.write(`HTTP/1.1 ${status} ${message}\r\nConnection: close\r\n\r\n`);
+    socket.destroy();
+}
+
+module.exports = { EventStream, EVENT_SOURCES, EVENTS_PATH, decodePayload };
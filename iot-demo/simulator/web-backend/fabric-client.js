@@ -88,6 +88,27 @@ class FabricClient {
         return result.toString();
     }
 
+    /**
+     * Submit with transient data; transient values are not recorded in the
+     * block, so personal data and passwords go there instead of in args.
+     */
+    async invokeWithTransient(chaincodeId, functionName, args = [], transient = {}) {
+        const contract = this.contracts[chaincodeId];
+        if (!contract) {
+            throw new Error(`Chaincode ${chaincodeId} not found`);
+        }
+        const transientMap = {};
+        for (const [name, value] of Object.entries(transient)) {
+            if (value !== undefined && value !== null) {
+                transientMap[name] = Buffer.from(String(value));
+            }
+        }
+        const result = await contract.createTransaction(functionName)
+            .setTransient(transientMap)
+            .submit(...args);
+        return result.toString();
+    }
+
     async query(chaincodeId, functionName, args = []) {
         const contract = this.contracts[chaincodeId];
         if (!contract) {
@@ -97,6 +118,19 @@ class FabricClient {
         return result.toString();
     }
 
+    /**
+     * Listen to a chaincode's events; listener gets each ContractEvent.
+     * Returns a function that removes the listener.
+     */
+    async addContractListener(chaincodeId, listener) {
+        const contract = this.contracts[chaincodeId];
+        if (!contract) {
+            throw new Error(`Chaincode ${chaincodeId} not found`);
+        }
+        await contract.addContractListener(listener);
+        return () => contract.removeContractListener(listener);
+    }
+
     async disconnect() {
         if (this.gateway) {
             await this.gateway.disconnect();
@@ -0,0 +1,321 @@
+/**
+ * Ingestion pipeline for device readings
+ *
+ * Devices and bridges post readings to POST /api/readings/ingest faster
+ * than Fabric commits them. The pipeline stores them with IOT-DATA
+ * StoreReadingsBatch, many readings per transaction:
+ *
+ * - Readings are spread over INGEST_WORKERS workers by device ID. A device
+ *   always goes to the same worker, which keeps its readings in the order
+ *   they arrived and submits one batch at a time, so a device's readings are
+ *   committed in order and no two transactions in flight update the same
+ *   device's statistics (which would fail with an MVCC conflict).
+ * - A worker submits a batch once it has INGEST_BATCH_SIZE readings, or
+ *   INGEST_BATCH_WAIT_MS after the first reading of a smaller one.
+ * - Each worker queues at most INGEST_QUEUE_LIMIT readings. A request that
+ *   does not fit is refused whole with 429 and a Retry-After estimate, so
+ *   senders slow down to what the network commits instead of the gateway
+ *   buffering without bound.
+ * - The chaincode rejects a whole batch for one bad reading ("reading N:
+ *   ..."); that reading is dropped and the rest resubmitted. Other failures,
+ *   such as timeouts, are retried INGEST_RETRIES times with a doubling delay
+ *   before the batch is dropped. Dropped readings are counted in stats().
+ */
+
+const DEFAULT_OPTIONS = {
+    workers: 4,
+    batchSize: 100,
+    batchWaitMs: 200,
+    queueLimit: 5000,
+    retries: 3,
+    retryDelayMs: 500
+};
+
+// Must not exceed maxBatchReadings in the IOT-DATA chaincode
+const MAX_BATCH_SIZE = 500;
+
+/**
+ * Reads the pipeline options from the environment, falling back to the
+ * defaults for unset values
+ */
+function ingestOptions(env) {
+    const number = (name, fallback) => {
+        const value = env[name];
+        if (value === undefined || value === '') {
+            return fallback;
+        }
+        const parsed = Number(value);
+        if (!Number.isInteger(parsed) || parsed < 0) {
+            throw new Error(`${name} must be a non-negative integer`);
+        }
+        return parsed;
+    };
+    return {
+        workers: number('INGEST_WORKERS', DEFAULT_OPTIONS.workers),
+        batchSize: number('INGEST_BATCH_SIZE', DEFAULT_OPTIONS.batchSize),
+        batchWaitMs: number('INGEST_BATCH_WAIT_MS', DEFAULT_OPTIONS.batchWaitMs),
+        queueLimit: number('INGEST_QUEUE_LIMIT', DEFAULT_OPTIONS.queueLimit),
+        retries: number('INGEST_RETRIES', DEFAULT_OPTIONS.retries),
+        retryDelayMs: DEFAULT_OPTIONS.retryDelayMs
+    };
+}
+
+/**
+ * Checks one reading as StoreReadingsBatch takes it; returns an error
+ * message, or null if the reading is well-formed
+ */
+function validateReading(reading) {
+    if (!reading || typeof reading !== 'object' || Array.isArray(reading)) {
+        return 'a reading must be an object';
+    }
+    if (typeof reading.deviceID !== 'string' || reading.deviceID === '') {
+        return 'deviceID is required';
+    }
+    if (typeof reading.temperature !== 'number' || !Number.isFinite(reading.temperature)) {
+        return 'temperature must be a number';
+    }
+    if (!Number.isInteger(reading.timestamp) || reading.timestamp <= 0) {
+        return 'timestamp must be a positive integer (seconds)';
+    }
+    if (typeof reading.sessionID !== 'string' || reading.sessionID === '') {
+        return 'sessionID is required';
+    }
+    if (reading.gatewayID !== undefined && typeof reading.gatewayID !== 'string') {
+        return 'gatewayID must be a string';
+    }
+    return null;
+}
+
+/**
+ * The fields of a reading StoreReadingsBatch reads
+ */
+function batchInput(reading) {
+    const input = {
+        deviceID: reading.deviceID,
+        temperature: reading.temperature,
+        timestamp: reading.timestamp,
+        sessionID: reading.sessionID
+    };
+    if (reading.location) {
+        input.location = reading.location;
+    }
+    if (reading.gatewayID) {
+        input.gatewayID = reading.gatewayID;
+    }
+    return input;
+}
+
+/**
+ * FNV-1a hash of a device ID, to pick its worker
+ */
+function deviceHash(deviceID) {
+    let hash = 0x811c9dc5;
+    for (let i = 0; i < deviceID.length; i++) {
+        hash ^= deviceID.charCodeAt(i);
+        hash = Math.imul(hash, 0x01000193) >>> 0;
+    }
+    return hash;
+}
+
+/**
+ * The index of the reading a failed batch was rejected for, or null if
+ * the failure was not about one reading
+ */
+function rejectedReading(error, count) {
+    const match = /reading (\d+): /.exec((error && error.message) || '');
+    if (!match) {
+        return null;
+    }
+    const index = Number(match[1]);
+    return index < count ? index : null;
+}
+
+const sleep = (ms) => new Promise(resolve => setTimeout(resolve, ms));
+
+class IngestPipeline {
+    /**
+     * submitBatch(readings) stores a batch and resolves once it is
+     * committed; options as returned by ingestOptions
+     */
+    constructor(submitBatch, options = {}) {
+        this.submitBatch = submitBatch;
+        this.options = { ...DEFAULT_OPTIONS, ...options };
+        if (this.options.workers < 1) {
+            throw new Error('the ingestion pipeline needs at least one worker');
+        }
+        if (this.options.batchSize < 1 || this.options.batchSize > MAX_BATCH_SIZE) {
+            throw new Error(`the batch size must be between 1 and ${MAX_BATCH_SIZE}`);
+        }
+        this.workers = [];
+        for (let i = 0; i < this.options.workers; i++) {
+            this.workers.push({ queue: [], busy: false, timer: null });
+        }
+        this.closed = false;
+        this.idleWaiters = [];
+        this.lastCommitMs = 1000;
+        this.counters = { accepted: 0, refused: 0, stored: 0, batches: 0, rejected: 0, failed: 0 };
+    }
+
+    workerFor(deviceID) {
+        return this.workers[deviceHash(deviceID) % this.workers.length];
+    }
+
+    /**
+     * Queues validated readings. Returns { accepted: true }, or
+     * { accepted: false, retryAfterSeconds } if a worker has no room for its
+     * share of them, in which case none are queued.
+     */
+    offer(readings) {
+        if (this.closed) {
+            return { accepted: false, closed: true };
+        }
+
+        const shares = new Map();
+        for (const reading of readings) {
+            const worker = this.workerFor(reading.deviceID);
+            shares.set(worker, (shares.get(worker) || 0) + 1);
+        }
+        for (const [worker, count] of shares) {
+            if (worker.queue.length + count > this.options.queueLimit) {
+                this.counters.refused += readings.length;
+                return { accepted: false, retryAfterSeconds: this.retryAfter(worker) };
+            }
+        }
+
+        for (const reading of readings) {
+            this.workerFor(reading.deviceID).queue.push(batchInput(reading));
+        }
+        this.counters.accepted += readings.length;
+        for (const worker of shares.keys()) {
+            this.schedule(worker);
+        }
+        return { accepted: true };
+    }
+
+    /**
+     * How long a worker needs to commit what it has queued, in seconds
+     */
+    retryAfter(worker) {
+        const batches = Math.ceil(worker.queue.length / this.options.batchSize);
+        return Math.max(1, Math.ceil(batches * this.lastCommitMs / 1000));
+    }
+
+    schedule(worker) {
+        if (worker.busy || worker.queue.length === 0) {
+            return;
+        }
+        if (worker.queue.length >= this.options.batchSize || this.closed || this.options.batchWaitMs === 0) {
+            this.flush(worker);
+            return;
+        }
+        if (!worker.timer) {
+            worker.timer = setTimeout(() => this.flush(worker), this.options.batchWaitMs);
+        }
+    }
+
+    async flush(worker) {
+        if (worker.timer) {
+            clearTimeout(worker.timer);
+            worker.timer = null;
+        }
+        worker.busy = true;
+        const batch = worker.queue.splice(0, this.options.batchSize);
+        try {
+            await this.store(batch);
+        } finally {
+            worker.busy = false;
+            this.schedule(worker);
+            this.notifyIdle();
+        }
+    }
+
+    /**
+     * Submits a batch, dropping readings the chaincode rejects and retrying
+     * other failures
+     */
+    async store(batch) {
+        let readings = batch;
+        let attempt = 0;
+        while (readings.length > 0) {
+            const started = Date.now();
+            try {
+                await this.submitBatch(readings);
+                this.lastCommitMs = Math.max(1, Date.now() - started);
+                this.counters.stored += readings.length;
+                this.counters.batches++;
+                return;
+            } catch (error) {
+                const index = rejectedReading(error, readings.length);
+                if (index !== null) {
+                    const reading = readings[index];
+                    console.warn(`Dropped reading of ${reading.deviceID} at ${reading.timestamp}: ${error.message}`);
+                    this.counters.rejected++;
+                    readings = readings.filter((_, i) => i !== index);
+                    continue;
+                }
+                attempt++;
+                if (attempt > this.options.retries) {
+                    console.error(`Dropped a batch of ${readings.length} readings after ${attempt} attempts: ${error.message}`);
+                    this.counters.failed += readings.length;
+                    return;
+                }
+                await sleep(this.options.retryDelayMs * 2 ** (attempt - 1));
+            }
+        }
+    }
+
+    idle() {
+        return this.workers.every(worker => !worker.busy && worker.queue.length === 0);
+    }
+
+    notifyIdle() {
+        if (!this.idle()) {
+            return;
+        }
+        const waiters = this.idleWaiters;
+        this.idleWaiters = [];
+        waiters.forEach(resolve => resolve());
+    }
+
+    /**
+     * Resolves once every queued reading has been stored or dropped
+     */
+    drain() {
+        if (this.idle()) {
+            return Promise.resolve();
+        }
+        return new Promise(resolve => this.idleWaiters.push(resolve));
+    }
+
+    /**
+     * Stops taking readings and submits what is queued without waiting for
+     * batches to fill
+     */
+    close() {
+        this.closed = true;
+        for (const worker of this.workers) {
+            this.schedule(worker);
+        }
+        return this.drain();
+    }
+
+    stats() {
+        return {
+            ...this.counters,
+            queued: this.workers.reduce((total, worker) => total + worker.queue.length, 0),
+            workers: this.workers.length
+        };
+    }
+}
+
+/**
+ * A pipeline storing readings through the backend's Fabric client
+ */
+function createIngestPipeline(fabricClient, options) {
+    return new IngestPipeline(
+        (readings) => fabricClient.invoke('iot-data', 'StoreReadingsBatch', [JSON.stringify(readings)]),
+        options
+    );
+}
+
+module.exports = { IngestPipeline, createIngestPipeline, ingestOptions, validateReading, deviceHash };
@@ -0,0 +1,162 @@
+const assert = require('assert');
+const { IngestPipeline, ingestOptions, validateReading } = require('./ingest');
+
+function reading(deviceID, timestamp) {
+    return { deviceID, temperature: 21.5, timestamp, sessionID: `session-${deviceID}` };
+}
+
+const sleep = (ms) => new Promise(resolve => setTimeout(resolve, ms));
+
+test('fills batches up to the batch size', async () => {
+    const batches = [];
+    const pipeline = new IngestPipeline(async (readings) => {
+        batches.push(readings.map(r => r.timestamp));
+    }, { workers: 1, batchSize: 4, batchWaitMs: 20 });
+
+    const readings = [];
+    for (let t = 1; t <= 10; t++) {
+        readings.push(reading('dev1', t));
+    }
+    assert.deepStrictEqual(pipeline.offer(readings), { accepted: true });
+    await pipeline.drain();
+
+    assert.deepStrictEqual(batches, [[1, 2, 3, 4], [5, 6, 7, 8], [9, 10]]);
+    assert.strictEqual(pipeline.stats().stored, 10);
+    assert.strictEqual(pipeline.stats().batches, 3);
+});
+
+test('waits for a batch to fill before submitting it', async () => {
+    const batches = [];
+    const pipeline = new IngestPipeline(async (readings) => {
+        batches.push(readings.length);
+    }, { workers: 1, batchSize: 10, batchWaitMs: 30 });
+
+    pipeline.offer([reading('dev1', 1)]);
+    await sleep(5);
+    pipeline.offer([reading('dev1', 2)]);
+    assert.deepStrictEqual(batches, []);
+    await pipeline.drain();
+    assert.deepStrictEqual(batches, [2]);
+});
+
+test('keeps each device in order with one batch in flight per worker', async () => {
+    const committed = new Map();
+    const inFlight = new Set();
+    const pipeline = new IngestPipeline(async (readings) => {
+        const devices = new Set(readings.map(r => r.deviceID));
+        for (const device of devices) {
+            assert.ok(!inFlight.has(device), `two batches of ${device} in flight`);
+            inFlight.add(device);
+        }
+        await sleep(Math.random() * 10);
+        for (const r of readings) {
+            committed.set(r.deviceID, [...(committed.get(r.deviceID) || []), r.timestamp]);
+        }
+        devices.forEach(device => inFlight.delete(device));
+    }, { workers: 3, batchSize: 5, batchWaitMs: 1 });
+
+    const devices = ['dev1', 'dev2', 'dev3', 'dev4', 'dev5', 'dev6', 'dev7'];
+    for (let t = 1; t <= 20; t++) {
+        pipeline.offer(devices.map(device => reading(device, t)));
+        if (t % 4 === 0) {
+            await sleep(2);
+        }
+    }
+    await pipeline.drain();
+
+    const expected = Array.from({ length: 20 }, (_, i) => i + 1);
+    for (const device of devices) {
+        assert.deepStrictEqual(committed.get(device), expected, device);
+    }
+});
+
+test('refuses a request that does not fit and takes readings again once drained', async () => {
+    let release;
+    const blocked = new Promise(resolve => { release = resolve; });
+    const pipeline = new IngestPipeline(() => blocked, {
+        workers: 1, batchSize: 2, batchWaitMs: 0, queueLimit: 3
+    });
+
+    // The first batch is submitted at once and blocks; three more wait
+    assert.ok(pipeline.offer([reading('dev1', 1), reading('dev1', 2)]).accepted);
+    assert.ok(pipeline.offer([reading('dev1', 3), reading('dev1', 4), reading('dev1', 5)]).accepted);
+
+    const refused = pipeline.offer([reading('dev1', 6)]);
+    assert.strictEqual(refused.accepted, false);
+    assert.ok(refused.retryAfterSeconds >= 1);
+    assert.strictEqual(pipeline.stats().queued, 3);
+    assert.strictEqual(pipeline.stats().refused, 1);
+
+    release();
+    await pipeline.drain();
+    assert.ok(pipeline.offer([reading('dev1', 6)]).accepted);
+    await pipeline.drain();
+    assert.strictEqual(pipeline.stats().stored, 6);
+});
+
+test('drops a reading the chaincode rejects and resubmits the rest', async () => {
+    const submitted = [];
+    const pipeline = new IngestPipeline(async (readings) => {
+        submitted.push(readings.map(r => r.timestamp));
+        const index = readings.findIndex(r => r.timestamp === 2);
+        if (index >= 0) {
+            throw new Error(`Chaincode response 500, reading ${index}: device dev1 already has a reading at 2`);
+        }
+    }, { workers: 1, batchSize: 3, batchWaitMs: 0 });
+
+    pipeline.offer([reading('dev1', 1), reading('dev1', 2), reading('dev1', 3)]);
+    await pipeline.drain();
+
+    assert.deepStrictEqual(submitted, [[1, 2, 3], [1, 3]]);
+    const stats = pipeline.stats();
+    assert.strictEqual(stats.stored, 2);
+    assert.strictEqual(stats.rejected, 1);
+});
+
+test('retries failed batches and drops them after the last retry', async () => {
+    let calls = 0;
+    const pipeline = new IngestPipeline(async () => {
+        calls++;
+        if (calls < 3) {
+            throw new Error('timeout waiting for commit');
+        }
+    }, { workers: 1, batchSize: 10, batchWaitMs: 0, retries: 2, retryDelayMs: 1 });
+
+    pipeline.offer([reading('dev1', 1)]);
+    await pipeline.drain();
+    assert.strictEqual(calls, 3);
+    assert.strictEqual(pipeline.stats().stored, 1);
+
+    const failing = new IngestPipeline(async () => {
+        throw new Error('peer unavailable');
+    }, { workers: 1, batchSize: 10, batchWaitMs: 0, retries: 1, retryDelayMs: 1 });
+    failing.offer([reading('dev1', 1), reading('dev2', 1)]);
+    await failing.drain();
+    assert.strictEqual(failing.stats().failed, 2);
+});
+
+test('close submits queued readings without waiting and refuses new ones', async () => {
+    const batches = [];
+    const pipeline = new IngestPipeline(async (readings) => {
+        batches.push(readings.length);
+    }, { workers: 2, batchSize: 100, batchWaitMs: 60000 });
+
+    pipeline.offer([reading('dev1', 1), reading('dev2', 1)]);
+    await pipeline.close();
+    assert.strictEqual(batches.reduce((a, b) => a + b, 0), 2);
+    assert.deepStrictEqual(pipeline.offer([reading('dev1', 2)]), { accepted: false, closed: true });
+});
+
+test('validates readings and options', () => {
+    assert.strictEqual(validateReading(reading('dev1', 1)), null);
+    assert.match(validateReading({ ...reading('dev1', 1), deviceID: '' }), /deviceID/);
+    assert.match(validateReading({ ...reading('dev1', 1), temperature: '21' }), /temperature/);
+    assert.match(validateReading({ ...reading('dev1', 1), timestamp: 1.5 }), /timestamp/);
+    assert.match(validateReading({ ...reading('dev1', 1), sessionID: undefined }), /sessionID/);
+    assert.match(validateReading([]), /object/);
+
+    assert.deepStrictEqual(ingestOptions({ INGEST_WORKERS: '8', INGEST_BATCH_SIZE: '' }).workers, 8);
+    assert.strictEqual(ingestOptions({}).batchSize, 100);
+    assert.throws(() => ingestOptions({ INGEST_QUEUE_LIMIT: '-1' }), /INGEST_QUEUE_LIMIT/);
+    assert.throws(() => new IngestPipeline(async () => {}, { batchSize: 501 }), /batch size/);
+});
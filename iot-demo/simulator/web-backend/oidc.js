@@ -0,0 +1,194 @@
+/**
+ * OIDC ID token verification for single sign-on
+ *
+ * The backend accepts ID tokens issued by one configured identity provider.
+ * Signing keys are fetched from the provider's JWKS endpoint (found through
+ * OpenID discovery) and cached; an unknown key ID triggers one refresh, rate
+ * limited so that forged tokens cannot make the backend hammer the provider.
+ *
+ * Configuration (environment):
+ *   AUTH_MODE            password (default) | oidc | oidc+password
+ *   OIDC_ISSUER          e.g. https://login.example.com/realms/iot
+ *   OIDC_CLIENT_ID       audience the ID tokens must be issued for
+ *   OIDC_USERNAME_CLAIM  claim used as the user-acl username (preferred_username)
+ *   OIDC_ROLE_CLAIM      claim holding the user's groups or roles (groups)
+ *   OIDC_ROLE_MAP        group=role pairs, e.g. "iot-admins=admin,iot-ops=operator"
+ *   OIDC_DEFAULT_ROLE    role for users matching no mapping (user)
+ */
+
+const https = require('https');
+const crypto = require('crypto');
+const jwt = require('jsonwebtoken');
+
+const JWKS_REFRESH_INTERVAL_MS = 60 * 1000;
+const CLOCK_TOLERANCE_SECONDS = 60;
+const ROLE_PRIORITY = ['user', 'operator', 'admin'];
+
+/**
+ * Read the authentication settings from the environment
+ */
+function loadAuthConfig(env = process.env) {
+    const mode = env.AUTH_MODE || 'password';
+    if (!['password', 'oidc', 'oidc+password'].includes(mode)) {
+        throw new Error(`Unknown AUTH_MODE "${mode}": use password, oidc or oidc+password`);
+    }
+
+    const config = {
+        mode: mode,
+        passwordEnabled: mode !== 'oidc',
+        oidcEnabled: mode !== 'password'
+    };
+    if (!config.oidcEnabled) {
+        return config;
+    }
+
+    if (!env.OIDC_ISSUER || !env.OIDC_CLIENT_ID) {
+        throw new Error(`AUTH_MODE ${mode} needs OIDC_ISSUER and OIDC_CLIENT_ID`);
+    }
+    config.oidc = {
+        issuer: env.OIDC_ISSUER.replace(/\/+$/, ''),
+        clientID: env.OIDC_CLIENT_ID,
+        usernameClaim: env.OIDC_USERNAME_CLAIM || 'preferred_username',
+        roleClaim: env.OIDC_ROLE_CLAIM || 'groups',
+        roleMap: parseRoleMap(env.OIDC_ROLE_MAP || ''),
+        defaultRole: env.OIDC_DEFAULT_ROLE || 'user'
+    };
+    if (!ROLE_PRIORITY.includes(config.oidc.defaultRole)) {
+        throw new Error(`OIDC_DEFAULT_ROLE must be one of ${ROLE_PRIORITY.join(', ')}`);
+    }
+    return config;
+}
+
+/**
+ * Parse "group=role,group=role" into a map
+ */
+function parseRoleMap(value) {
+    const roleMap = {};
+    for (const pair of value.split(',').map(p => p.trim()).filter(Boolean)) {
+        const [group, role] = pair.split('=').map(p => p && p.trim());
+        if (!group || !ROLE_PRIORITY.includes(role)) {
+            throw new Error(`Invalid OIDC_ROLE_MAP entry "${pair}"`);
+        }
+        roleMap[group] = role;
+    }
+    return roleMap;
+}
+
+function fetchJSON(url) {
+    return new Promise((resolve, reject) => {
+        const request = https.get(url, { timeout: 5000 }, (res) => {
+            let body = '';
+            res.on('data', chunk => { body += chunk; });
+            res.on('end', () => {
+                if (res.statusCode !== 200) {
+                    return reject(new Error(`${url} returned ${res.statusCode}`));
+                }
+                try {
+                    resolve(JSON.parse(body));
+                } catch (error) {
+                    reject(new Error(`${url} returned invalid JSON`));
+                }
+            });
+        });
+        request.on('timeout', () => request.destroy(new Error(`${url} timed out`)));
+        request.on('error', reject);
+    });
+}
+
+class OIDCVerifier {
+    constructor(config) {
+        this.config = config;
+        this.keys = new Map(); // kid -> KeyObject
+        this.jwksURI = null;
+        this.lastRefresh = 0;
+    }
+
+    async refreshKeys() {
+        if (!this.jwksURI) {
+            const discovery = await fetchJSON(`${this.config.issuer}/.well-known/openid-configuration`);
+            if (discovery.issuer.replace(/\/+$/, '') !== this.config.issuer) {
+                throw new Error(`Discovery document is for issuer ${discovery.issuer}`);
+            }
+            this.jwksURI = discovery.jwks_uri;
+        }
+
+        const jwks = await fetchJSON(this.jwksURI);
+        const keys = new Map();
+        for (const jwk of jwks.keys || []) {
+            if (jwk.use && jwk.use !== 'sig') {
+                continue;
+            }
+            keys.set(jwk.kid, crypto.createPublicKey({ key: jwk, format: 'jwk' }));
+        }
+        this.keys = keys;
+        this.lastRefresh = Date.now();
+    }
+
+    async signingKey(kid) {
+        if (!this.keys.has(kid) && Date.now() - this.lastRefresh > JWKS_REFRESH_INTERVAL_MS) {
+            await this.refreshKeys();
+        }
+        const key = this.keys.get(kid);
+        if (!key) {
+            throw new Error(`Unknown signing key ${kid}`);
+        }
+        return key;
+    }
+
+    /**
+     * Verify an ID token and return its claims
+     */
+    async verify(idToken) {
+        const decoded = jwt.decode(idToken, { complete: true });
+        if (!decoded || !decoded.header) {
+            throw new Error('Malformed ID token');
+        }
+
+        const key = await this.signingKey(decoded.header.kid);
+        const claims = jwt.verify(idToken, key.export({ type: 'spki', format: 'pem' }), {
+            algorithms: ['RS256', 'RS384', 'RS512', 'ES256', 'ES384', 'ES512', 'PS256'],
+            // Some providers end their issuer with a slash
+            issuer: [this.config.issuer, this.config.issuer + '/'],
+            audience: this.config.clientID,
+            clockTolerance: CLOCK_TOLERANCE_SECONDS
+        });
+        if (!claims.sub) {
+            throw new Error('ID token has no subject');
+        }
+        return claims;
+    }
+
+    /**
+     * Map verified claims to a user-acl username, email and role
+     */
+    mapClaims(claims) {
+        let username = claims[this.config.usernameClaim];
+        if (!username && claims.email) {
+            // An unverified email must not decide which account a user gets
+            if (claims.email_verified === false) {
+                throw new Error('Email address is not verified');
+            }
+            username = claims.email.split('@')[0];
+        }
+        username = String(username || '').replace(/[^A-Za-z0-9._-]/g, '_').slice(0, 32);
+        if (username.length < 3) {
+            throw new Error(`Claim ${this.config.usernameClaim} does not give a usable username`);
+        }
+
+        let groups = claims[this.config.roleClaim] || [];
+        if (!Array.isArray(groups)) {
+            groups = [groups];
+        }
+        let role = this.config.defaultRole;
+        for (const group of groups) {
+            const mapped = this.config.roleMap[group];
+            if (mapped && ROLE_PRIORITY.indexOf(mapped) > ROLE_PRIORITY.indexOf(role)) {
+                role = mapped;
+            }
+        }
+
+        return { username: username, email: claims.email || '', role: role };
+    }
+}
+
+module.exports = { OIDCVerifier, loadAuthConfig, parseRoleMap };
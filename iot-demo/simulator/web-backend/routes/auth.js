@@ -4,21 +4,74 @@
  * Endpoints:
  * - POST /api/auth/register - Register new user
  * - POST /api/auth/login - Login user
+ * - POST /api/auth/oidc - Login with an ID token from the identity provider
+ * - GET  /api/auth/config - Sign-in methods the backend accepts
  * - POST /api/auth/logout - Logout user
+ *
+ * AUTH_MODE selects the sign-in methods: "password" (default), "oidc" for
+ * single sign-on only, or "oidc+password" to keep passwords as a fallback.
+ *
+ * Tokens carry the scopes of the user's role, or the subset requested in
+ * the "scope" field of the sign-in request (see scopes.js).
  */
 
 const express = require('express');
 const router = express.Router();
 const jwt = require('jsonwebtoken');
+const { scopesForRole } = require('../scopes');
 
 const JWT_SECRET = process.env.JWT_SECRET || 'your-secret-key-change-in-production';
 const JWT_EXPIRY = '24h';
 
+/**
+ * Middleware rejecting password sign-in when AUTH_MODE is "oidc"
+ */
+function requirePasswordAuth(req, res, next) {
+    if (!req.app.locals.authConfig.passwordEnabled) {
+        return res.status(403).json({
+            success: false,
+            message: 'Password sign-in is disabled; sign in with single sign-on'
+        });
+    }
+    next();
+}
+
+/**
+ * USER-ACL keeps usernames in a private data collection and its responses
+ * do not echo them; read the user's username, or fall back to the one the
+ * caller gave.
+ */
+async function usernameOf(fabricClient, userID, fallback) {
+    try {
+        const user = JSON.parse(await fabricClient.query('user-acl', 'GetUser', [userID]));
+        return user.username || fallback;
+    } catch (error) {
+        return fallback;
+    }
+}
+
+/**
+ * GET /api/auth/config
+ * Tell the frontend which sign-in methods to offer
+ */
+router.get('/config', (req, res) => {
+    const authConfig = req.app.locals.authConfig;
+    res.json({
+        success: true,
+        mode: authConfig.mode,
+        password: authConfig.passwordEnabled,
+        oidc: authConfig.oidcEnabled ? {
+            issuer: authConfig.oidc.issuer,
+            clientID: authConfig.oidc.clientID
+        } : null
+    });
+});
+
 /**
  * POST /api/auth/register
  * Register a new user
  */
-router.post('/register', async (req, res) => {
+router.post('/register', requirePasswordAuth, async (req, res) => {
     try {
         const { username, password, email, role } = req.body;
 
@@ -37,12 +90,14 @@ router.post('/register', async (req, res) => {
             });
         }
 
-        // Call USER-ACL chaincode to register user
+        // Call USER-ACL chaincode to register user; the username, password
+        // and email go in transient data so they stay out of the block
         const fabricClient = req.app.locals.fabricClient;
-        const response = await fabricClient.invoke(
+        const response = await fabricClient.invokeWithTransient(
             'user-acl',
             'RegisterUser',
-            [username, password, email, role || 'user']
+            ['', '', '', role || 'user'],
+            { username, password, email }
         );
 
         const result = JSON.parse(response);
@@ -55,11 +110,13 @@ router.post('/register', async (req, res) => {
         }
 
         // Generate JWT token
+        const scopes = scopesForRole(result.role, req.body.scope, result.adminRoles);
         const token = jwt.sign(
             {
                 userID: result.userID,
-                username: result.username,
-                role: result.role
+                username: username,
+                role: result.role,
+                scope: scopes.join(' ')
             },
             JWT_SECRET,
             { expiresIn: JWT_EXPIRY }
@@ -69,16 +126,17 @@ router.post('/register', async (req, res) => {
             success: true,
             message: 'User registered successfully',
             token: token,
+            scope: scopes.join(' '),
             user: {
                 userID: result.userID,
-                username: result.username,
+                username: username,
                 role: result.role
             }
         });
 
     } catch (error) {
         console.error('Register error:', error);
-        res.status(500).json({
+        res.status(error.status || 500).json({
             success: false,
             message: error.message || 'Registration failed'
         });
@@ -89,7 +147,7 @@ router.post('/register', async (req, res) => {
  * POST /api/auth/login
  * Login user
  */
-router.post('/login', async (req, res) => {
+router.post('/login', requirePasswordAuth, async (req, res) => {
     try {
         const { username, password } = req.body;
 
@@ -101,12 +159,14 @@ router.post('/login', async (req, res) => {
             });
         }
 
-        // Call USER-ACL chaincode to authenticate
+        // Call USER-ACL chaincode to authenticate; username may also be
+        // the user's email
         const fabricClient = req.app.locals.fabricClient;
-        const response = await fabricClient.invoke(
+        const response = await fabricClient.invokeWithTransient(
             'user-acl',
             'AuthenticateUser',
-            [username, password]
+            ['', ''],
+            { username, password }
         );
 
         const result = JSON.parse(response);
@@ -118,12 +178,16 @@ router.post('/login', async (req, res) => {
             });
         }
 
+        const accountName = await usernameOf(fabricClient, result.userID, username);
+
         // Generate JWT token
+        const scopes = scopesForRole(result.role, req.body.scope, result.adminRoles);
         const token = jwt.sign(
             {
                 userID: result.userID,
-                username: result.username,
-                role: result.role
+                username: accountName,
+                role: result.role,
+                scope: scopes.join(' ')
             },
             JWT_SECRET,
             { expiresIn: JWT_EXPIRY }
@@ -133,14 +197,21 @@ router.post('/login', async (req, res) => {
             success: true,
             message: 'Login successful',
             token: token,
+            scope: scopes.join(' '),
             user: {
                 userID: result.userID,
-                username: result.username,
+                username: accountName,
                 role: result.role
             }
         });
 
     } catch (error) {
+        if (error.status === 400) {
+            return res.status(400).json({
+                success: false,
+                message: error.message
+            });
+        }
         console.error('Login error:', error);
         res.status(401).json({
             success: false,
@@ -149,6 +220,85 @@ router.post('/login', async (req, res) => {
     }
 });
 
+/**
+ * POST /api/auth/oidc
+ * Login with an ID token; the user is provisioned in USER-ACL on first login
+ */
+router.post('/oidc', async (req, res) => {
+    const verifier = req.app.locals.oidcVerifier;
+    if (!verifier) {
+        return res.status(404).json({
+            success: false,
+            message: 'Single sign-on is not enabled'
+        });
+    }
+
+    const { idToken } = req.body;
+    if (!idToken) {
+        return res.status(400).json({
+            success: false,
+            message: 'idToken is required'
+        });
+    }
+
+    let claims, profile;
+    try {
+        claims = await verifier.verify(idToken);
+        profile = verifier.mapClaims(claims);
+    } catch (error) {
+        console.error('ID token rejected:', error.message);
+        return res.status(401).json({
+            success: false,
+            message: 'Invalid ID token'
+        });
+    }
+
+    try {
+        const fabricClient = req.app.locals.fabricClient;
+        const response = await fabricClient.invokeWithTransient(
+            'user-acl',
+            'ProvisionFederatedUser',
+            [claims.iss, claims.sub, '', '', profile.role],
+            { username: profile.username, email: profile.email }
+        );
+
+        const result = JSON.parse(response);
+        const accountName = await usernameOf(fabricClient, result.userID, profile.username);
+
+        const scopes = scopesForRole(result.role, req.body.scope, result.adminRoles);
+        const token = jwt.sign(
+            {
+                userID: result.userID,
+                username: accountName,
+                role: result.role,
+                idp: claims.iss,
+                scope: scopes.join(' ')
+            },
+            JWT_SECRET,
+            { expiresIn: JWT_EXPIRY }
+        );
+
+        res.json({
+            success: true,
+            message: result.message,
+            token: token,
+            scope: scopes.join(' '),
+            user: {
+                userID: result.userID,
+                username: accountName,
+                role: result.role
+            }
+        });
+
+    } catch (error) {
+        console.error('OIDC login error:', error);
+        res.status(error.status || 403).json({
+            success: false,
+            message: error.message || 'Single sign-on failed'
+        });
+    }
+});
+
 /**
  * POST /api/auth/logout
  * Logout user (client should delete token)
@@ -175,8 +325,7 @@ function verifyToken(req, res, next) {
     }
 
     try {
-        const decoded = jwt.verify(token, JWT_SECRET);
-        req.user = decoded;
+        req.user = decodeToken(token);
         next();
     } catch (error) {
         return res.status(403).json({
@@ -186,5 +335,14 @@ function verifyToken(req, res, next) {
     }
 }
 
+/**
+ * Verify a token and return its claims; throws if it is invalid or expired.
+ * Used where there is no Authorization header, such as WebSocket upgrades.
+ */
+function decodeToken(token) {
+    return jwt.verify(token, JWT_SECRET);
+}
+
 module.exports = router;
 module.exports.verifyToken = verifyToken;
+module.exports.decodeToken = decodeToken;
@@ -3,55 +3,104 @@
  *
  * Endpoints:
  * - GET /api/devices - Get all accessible devices for user
+ * - GET /api/devices/overview - Dashboard summary of accessible devices
+ * - GET /api/devices/:deviceID/sessions - Sessions on a device
  * - POST /api/devices/register - Register new device
  * - POST /api/devices/grant-access - Grant access to another user
  * - POST /api/devices/revoke-access - Revoke access from user
+ *
+ * Granting or revoking access on a device the user does not own is an admin
+ * action and needs admin:grant or admin:revoke on top of device:share.
+ *
+ * Device records, sessions and reading summaries are read from the
+ * materialized views (views.js); the overview and sessions need them and
+ * answer 503 until they have caught up. Which devices a user may see is
+ * always asked of USER-ACL.
  */
 
 const express = require('express');
 const router = express.Router();
 const { verifyToken } = require('./auth');
+const { requireScope, hasScope, denyScope } = require('../scopes');
+const { checkDeviceAccess } = require('./readings');
+const { readyViews } = require('../views');
+
+/**
+ * Refuse to act on another user's device unless the token holds the
+ * matching admin scope
+ */
+async function checkOwnerOrScope(req, res, deviceID, adminScope) {
+    const fabricClient = req.app.locals.fabricClient;
+    const device = JSON.parse(await fabricClient.query('user-acl', 'GetDevice', [deviceID]));
+    if (device.ownerID === req.user.userID || hasScope(req, adminScope)) {
+        return true;
+    }
+    denyScope(req, res, [adminScope], deviceID);
+    return false;
+}
+
+/**
+ * IDs of the devices the user has access to
+ */
+async function accessibleDevices(req) {
+    const fabricClient = req.app.locals.fabricClient;
+    const permissionsResponse = await fabricClient.query(
+        'user-acl',
+        'GetUserPermissions',
+        [req.user.userID]
+    );
+    return JSON.parse(permissionsResponse).devices || [];
+}
+
+/**
+ * The caught-up views, or a 503 answer
+ */
+function requireViews(req, res) {
+    const views = readyViews(req);
+    if (!views) {
+        res.status(503).json({
+            success: false,
+            message: 'Views are catching up with the ledger, try again shortly'
+        });
+    }
+    return views;
+}
 
 /**
  * GET /api/devices
  * Get all devices user has access to
  */
-router.get('/', verifyToken, async (req, res) => {
+router.get('/', verifyToken, requireScope('device:read'), async (req, res) => {
     try {
         const fabricClient = req.app.locals.fabricClient;
-        const userID = req.user.userID;
+        const views = readyViews(req);
 
         // Get user's permissions
-        const permissionsResponse = await fabricClient.query(
-            'user-acl',
-            'GetUserPermissions',
-            [userID]
-        );
-
-        const permissions = JSON.parse(permissionsResponse);
-        const deviceIDs = permissions.devices || [];
+        const deviceIDs = await accessibleDevices(req);
 
         // Get details for each device
         const devices = [];
         for (const deviceID of deviceIDs) {
             try {
-                // Get device info from USER-ACL
-                const deviceResponse = await fabricClient.query(
-                    'user-acl',
-                    'GetDevice',
-                    [deviceID]
-                );
-                const device = JSON.parse(deviceResponse);
-
-                // Get latest reading from IOT-DATA
+                // Get device info from the views, or from USER-ACL
+                let device = views ? views.getDevice(deviceID) : null;
+                if (!device) {
+                    const deviceResponse = await fabricClient.query(
+                        'user-acl',
+                        'GetDevice',
+                        [deviceID]
+                    );
+                    device = JSON.parse(deviceResponse);
+                }
+
+                // Get latest reading from IOT-DATA, redacted for the user's permission
                 try {
                     const readingResponse = await fabricClient.query(
                         'iot-data',
-                        'GetLatestReading',
-                        [deviceID]
+                        'GetRedactedLatestReading',
+                        [req.user.userID, deviceID]
                     );
-                    const latestReading = JSON.parse(readingResponse);
-                    device.lastReading = latestReading;
+                    device.lastReading = JSON.parse(readingResponse).readings[0];
                 } catch (error) {
                     // No readings yet
                     device.lastReading = null;
@@ -79,11 +128,71 @@ router.get('/', verifyToken, async (req, res) => {
     }
 });
 
+/**
+ * GET /api/devices/overview
+ * Devices the user has access to with their active session count and
+ * reading summary (count, last reading time and status, without values)
+ */
+router.get('/overview', verifyToken, requireScope('device:read'), async (req, res) => {
+    try {
+        const views = requireViews(req, res);
+        if (!views) {
+            return;
+        }
+
+        const deviceIDs = await accessibleDevices(req);
+        const devices = deviceIDs.map(deviceID => views.getOverview(deviceID)).filter(Boolean);
+
+        res.json({
+            success: true,
+            devices: devices,
+            count: devices.length,
+            asOfBlock: views.status().lastBlock
+        });
+
+    } catch (error) {
+        console.error('Get overview error:', error);
+        res.status(500).json({
+            success: false,
+            message: 'Failed to retrieve overview'
+        });
+    }
+});
+
+/**
+ * GET /api/devices/:deviceID/sessions
+ * Sessions on a device, newest first
+ */
+router.get('/:deviceID/sessions', verifyToken, requireScope('device:read'), checkDeviceAccess, async (req, res) => {
+    try {
+        const views = requireViews(req, res);
+        if (!views) {
+            return;
+        }
+
+        const sessions = views.getSessions(req.deviceID);
+
+        res.json({
+            success: true,
+            deviceID: req.deviceID,
+            sessions: sessions,
+            active: sessions.filter(session => session.status === 'active').length
+        });
+
+    } catch (error) {
+        console.error('Get sessions error:', error);
+        res.status(500).json({
+            success: false,
+            message: 'Failed to retrieve sessions'
+        });
+    }
+});
+
 /**
  * POST /api/devices/register
  * Register a new device
  */
-router.post('/register', verifyToken, async (req, res) => {
+router.post('/register', verifyToken, requireScope('device:register'), async (req, res) => {
     try {
         const { deviceID, deviceName, deviceType } = req.body;
         const ownerID = req.user.userID;
@@ -128,7 +237,7 @@ router.post('/register', verifyToken, async (req, res) => {
  * POST /api/devices/grant-access
  * Grant access to another user
  */
-router.post('/grant-access', verifyToken, async (req, res) => {
+router.post('/grant-access', verifyToken, requireScope('device:share'), async (req, res) => {
     try {
         const { deviceID, targetUsername, permissionType } = req.body;
         const ownerID = req.user.userID;
@@ -146,6 +255,10 @@ router.post('/grant-access', verifyToken, async (req, res) => {
         // For now, we'll construct it as user_username
         const targetUserID = `user_${targetUsername}`;
 
+        if (!await checkOwnerOrScope(req, res, deviceID, 'admin:grant')) {
+            return;
+        }
+
         // Grant access
         const fabricClient = req.app.locals.fabricClient;
         await fabricClient.invoke(
@@ -172,7 +285,7 @@ router.post('/grant-access', verifyToken, async (req, res) => {
  * POST /api/devices/revoke-access
  * Revoke access from user
  */
-router.post('/revoke-access', verifyToken, async (req, res) => {
+router.post('/revoke-access', verifyToken, requireScope('device:share'), async (req, res) => {
     try {
         const { deviceID, targetUsername } = req.body;
         const ownerID = req.user.userID;
@@ -187,6 +300,10 @@ router.post('/revoke-access', verifyToken, async (req, res) => {
 
         const targetUserID = `user_${targetUsername}`;
 
+        if (!await checkOwnerOrScope(req, res, deviceID, 'admin:revoke')) {
+            return;
+        }
+
         // Revoke access
         const fabricClient = req.app.locals.fabricClient;
         await fabricClient.invoke(
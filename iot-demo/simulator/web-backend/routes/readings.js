@@ -5,11 +5,26 @@
  * - GET /api/readings/:deviceID - Get readings for device (with time range)
  * - GET /api/readings/:deviceID/latest - Get latest reading
  * - GET /api/readings/:deviceID/stats - Get statistics
+ * - GET /api/readings/:deviceID/encrypted - Get encrypted readings (ciphertext only)
+ * - GET /api/readings/:deviceID/provenance/:readingID - Get where a reading came from
+ * - GET /api/readings/export/:zone - Export the readings of a residency zone
+ * - POST /api/readings/ingest - Queue device readings for storage (ingest.js)
+ *
+ * Readings are redacted by the IOT-DATA redaction policy for the permission
+ * the user holds on the device, and withheld where its residency policy
+ * keeps a zone's readings from users outside the zone. Statistics come from the materialized views
+ * once they have caught up (views.js).
  */
 
 const express = require('express');
 const router = express.Router();
 const { verifyToken } = require('./auth');
+const { requireScope } = require('../scopes');
+const { readyViews } = require('../views');
+const { validateReading } = require('../ingest');
+
+// Readings one ingest request may carry
+const MAX_INGEST_READINGS = 1000;
 
 /**
  * Middleware to check if user has access to device
@@ -49,11 +64,119 @@ async function checkDeviceAccess(req, res, next) {
     }
 }
 
+/**
+ * POST /api/readings/ingest
+ * Queue readings, one object or { readings: [...] }, for the ingestion
+ * pipeline. Answers 202 once they are queued, not stored; the chaincode
+ * still checks each reading's session. A full queue is answered with 429
+ * and Retry-After, and none of the request's readings are queued.
+ */
+router.post('/ingest', verifyToken, requireScope('device:ingest'), (req, res) => {
+    const ingest = req.app.locals.ingest;
+    const readings = Array.isArray(req.body.readings) ? req.body.readings : [req.body];
+
+    if (readings.length === 0 || readings.length > MAX_INGEST_READINGS) {
+        return res.status(400).json({
+            success: false,
+            message: `Send between 1 and ${MAX_INGEST_READINGS} readings per request`
+        });
+    }
+    for (let i = 0; i < readings.length; i++) {
+        const problem = validateReading(readings[i]);
+        if (problem) {
+            return res.status(400).json({
+                success: false,
+                message: `Reading ${i}: ${problem}`
+            });
+        }
+    }
+
+    const result = ingest ? ingest.offer(readings) : { accepted: false, closed: true };
+    if (result.closed) {
+        return res.status(503).json({
+            success: false,
+            message: 'Readings are not being ingested'
+        });
+    }
+    if (!result.accepted) {
+        res.set('Retry-After', String(result.retryAfterSeconds));
+        return res.status(429).json({
+            success: false,
+            message: 'Ingestion queue is full, retry later',
+            retryAfter: result.retryAfterSeconds
+        });
+    }
+
+    res.status(202).json({
+        success: true,
+        queued: readings.length
+    });
+});
+
+/**
+ * GET /api/readings/export/:zone
+ * Export the readings tagged with a residency zone. IOT-DATA checks the
+ * zone's residency rule (by default only users in the zone may export),
+ * withholds devices the user cannot access and redacts the rest. Declared
+ * before the device routes so that a zone is never taken for a device ID.
+ */
+router.get('/export/:zone', verifyToken, requireScope('device:export'), async (req, res) => {
+    try {
+        const { startTime, endTime } = req.query;
+        const fabricClient = req.app.locals.fabricClient;
+
+        const now = Math.floor(Date.now() / 1000);
+        const start = startTime ? parseInt(startTime) : now - 86400;
+        const end = endTime ? parseInt(endTime) : now;
+
+        const response = await fabricClient.query(
+            'iot-data',
+            'ExportZoneReadings',
+            [req.user.userID, req.params.zone, start.toString(), end.toString()]
+        );
+
+        const result = JSON.parse(response);
+
+        res.json({
+            success: true,
+            zone: result.zone,
+            readings: result.readings,
+            count: result.readings.length,
+            permissions: result.permissions,
+            withheld: result.withheld || 0,
+            timeRange: {
+                start: result.startTime,
+                end: result.endTime
+            }
+        });
+
+    } catch (error) {
+        console.error('Export readings error:', error);
+        const message = error.message || '';
+        if (message.includes('may not be exported') || message.includes('may export') || message.includes('may not export')) {
+            return res.status(403).json({
+                success: false,
+                message: 'Exports of this zone are restricted by its residency policy'
+            });
+        }
+        if (message.includes('export a shorter range')) {
+            return res.status(400).json({
+                success: false,
+                message: 'Too many readings in the range; export a shorter range'
+            });
+        }
+        res.status(500).json({
+            success: false,
+            message: 'Failed to export readings'
+        });
+    }
+});
+
 /**
  * GET /api/readings/:deviceID
  * Get temperature readings for device
  */
-router.get('/:deviceID', verifyToken, checkDeviceAccess, async (req, res) => {
+router.get('/:deviceID', verifyToken, requireScope('device:telemetry'), checkDeviceAccess, async (req, res) => {
     try {
         const deviceID = req.deviceID;
         const { limit, startTime, endTime } = req.query;
@@ -65,14 +188,15 @@ router.get('/:deviceID', verifyToken, checkDeviceAccess, async (req, res) => {
         const start = startTime ? parseInt(startTime) : now - 86400;
         const end = endTime ? parseInt(endTime) : now;
 
-        // Get readings from IOT-DATA chaincode
+        // Get readings from IOT-DATA chaincode, redacted for the user's permission
         const response = await fabricClient.query(
             'iot-data',
-            'GetDeviceReadings',
-            [deviceID, start.toString(), end.toString()]
+            'GetRedactedReadings',
+            [req.user.userID, deviceID, start.toString(), end.toString()]
         );
 
-        let readings = JSON.parse(response);
+        const result = JSON.parse(response);
+        let readings = result.readings;
 
         // Apply limit if specified
         if (limit) {
@@ -85,6 +209,9 @@ router.get('/:deviceID', verifyToken, checkDeviceAccess, async (req, res) => {
             deviceID: deviceID,
             readings: readings,
             count: readings.length,
+            permission: result.permission,
+            redacted: result.redacted,
+            withheld: result.withheld || 0,
             timeRange: {
                 start: start,
                 end: end
@@ -104,24 +231,35 @@ router.get('/:deviceID', verifyToken, checkDeviceAccess, async (req, res) => {
  * GET /api/readings/:deviceID/latest
  * Get latest temperature reading
  */
-router.get('/:deviceID/latest', verifyToken, checkDeviceAccess, async (req, res) => {
+router.get('/:deviceID/latest', verifyToken, requireScope('device:telemetry'), checkDeviceAccess, async (req, res) => {
     try {
         const deviceID = req.deviceID;
         const fabricClient = req.app.locals.fabricClient;
 
-        // Get latest reading from IOT-DATA chaincode
+        // Get latest reading from IOT-DATA chaincode, redacted for the user's permission
         const response = await fabricClient.query(
             'iot-data',
-            'GetLatestReading',
-            [deviceID]
+            'GetRedactedLatestReading',
+            [req.user.userID, deviceID]
         );
 
-        const reading = JSON.parse(response);
+        const result = JSON.parse(response);
+
+        if (result.readings.length === 0) {
+            return res.json({
+                success: true,
+                deviceID: deviceID,
+                reading: null,
+                withheld: result.withheld || 0,
+                message: 'The latest reading is restricted to its residency zone'
+            });
+        }
 
         res.json({
             success: true,
             deviceID: deviceID,
-            reading: reading
+            reading: result.readings[0],
+            redacted: result.redacted
         });
 
     } catch (error) {
@@ -147,33 +285,132 @@ router.get('/:deviceID/latest', verifyToken, checkDeviceAccess, async (req, res)
  * GET /api/readings/:deviceID/stats
  * Get statistics for device
  */
-router.get('/:deviceID/stats', verifyToken, checkDeviceAccess, async (req, res) => {
+router.get('/:deviceID/stats', verifyToken, requireScope('device:telemetry'), checkDeviceAccess, async (req, res) => {
+    try {
+        const deviceID = req.deviceID;
+        const fabricClient = req.app.locals.fabricClient;
+        const views = readyViews(req);
+
+        // Get statistics from the views, or from IOT-DATA chaincode
+        let stats;
+        if (views) {
+            stats = views.getStatistics(deviceID);
+        } else {
+            const response = await fabricClient.query(
+                'iot-data',
+                'GetDeviceStatistics',
+                [deviceID]
+            );
+            stats = JSON.parse(response);
+        }
+
+        res.json({
+            success: true,
+            deviceID: deviceID,
+            statistics: stats
+        });
+
+    } catch (error) {
+        console.error('Get statistics error:', error);
+        res.status(500).json({
+            success: false,
+            message: 'Failed to retrieve statistics'
+        });
+    }
+});
+
+/**
+ * GET /api/readings/:deviceID/encrypted
+ * Get encrypted readings for device
+ *
+ * The backend is not a key holder: records are returned as stored, and
+ * authorized readers decrypt them with their own private key.
+ */
+router.get('/:deviceID/encrypted', verifyToken, requireScope('device:telemetry'), checkDeviceAccess, async (req, res) => {
     try {
         const deviceID = req.deviceID;
+        const { startTime, endTime } = req.query;
+
         const fabricClient = req.app.locals.fabricClient;
 
-        // Get statistics from IOT-DATA chaincode
+        const now = Math.floor(Date.now() / 1000);
+        const start = startTime ? parseInt(startTime) : now - 86400;
+        const end = endTime ? parseInt(endTime) : now;
+
         const response = await fabricClient.query(
             'iot-data',
-            'GetDeviceStatistics',
-            [deviceID]
+            'GetEncryptedReadings',
+            [deviceID, start.toString(), end.toString()]
         );
 
-        const stats = JSON.parse(response);
+        const readings = JSON.parse(response);
 
         res.json({
             success: true,
             deviceID: deviceID,
-            statistics: stats
+            readings: readings,
+            count: readings.length,
+            timeRange: {
+                start: start,
+                end: end
+            }
         });
 
     } catch (error) {
-        console.error('Get statistics error:', error);
+        console.error('Get encrypted readings error:', error);
         res.status(500).json({
             success: false,
-            message: 'Failed to retrieve statistics'
+            message: 'Failed to retrieve encrypted readings'
+        });
+    }
+});
+
+/**
+ * GET /api/readings/:deviceID/provenance/:readingID
+ * Get the provenance of a reading: the identity and session that submitted
+ * it and, for bridged readings, the gateway it came through
+ */
+router.get('/:deviceID/provenance/:readingID', verifyToken, requireScope('device:telemetry'), checkDeviceAccess, async (req, res) => {
+    try {
+        const deviceID = req.deviceID;
+        const fabricClient = req.app.locals.fabricClient;
+
+        const response = await fabricClient.query(
+            'iot-data',
+            'GetReadingProvenance',
+            [req.params.readingID]
+        );
+
+        const provenance = JSON.parse(response);
+
+        // Access was checked for deviceID, so only its readings are returned
+        if (provenance.deviceID !== deviceID) {
+            return res.status(404).json({
+                success: false,
+                message: 'Reading not found for this device'
+            });
+        }
+
+        res.json({
+            success: true,
+            deviceID: deviceID,
+            provenance: provenance
+        });
+
+    } catch (error) {
+        console.error('Get provenance error:', error);
+        if (error.message && error.message.includes('no provenance recorded')) {
+            return res.status(404).json({
+                success: false,
+                message: 'No provenance recorded for this reading'
+            });
+        }
+        res.status(500).json({
+            success: false,
+            message: 'Failed to retrieve provenance'
         });
     }
 });
 
 module.exports = router;
+module.exports.checkDeviceAccess = checkDeviceAccess;
@@ -0,0 +1,183 @@
+/**
+ * Access Review Routes
+ *
+ * Endpoints:
+ * - GET  /api/access-reviews - All review campaigns
+ * - POST /api/access-reviews - Start a campaign (admin:review)
+ * - GET  /api/access-reviews/:reviewID - A campaign and the caller's items
+ * - POST /api/access-reviews/:reviewID/decisions - Attest or revoke a permission
+ * - POST /api/access-reviews/:reviewID/close - Close a campaign past its deadline
+ *
+ * A campaign lists every active permission under the owner of its device.
+ * Owners attest or revoke their items before the deadline; at the deadline
+ * the backend closes the campaign and USER-ACL suspends the permissions
+ * left pending. Policy admins and auditors see every item, other users only
+ * their own.
+ */
+
+const express = require('express');
+const router = express.Router();
+const { verifyToken } = require('./auth');
+const { requireScope } = require('../scopes');
+
+/**
+ * Answer a chaincode error: refusals (unknown campaign, closed, past the
+ * deadline, not the owner) are the caller's, anything else is ours
+ */
+function reviewError(res, error, fallback) {
+    const message = error.message || fallback;
+    const status = /not found|not under|unauthorized|closed|deadline|already|open until|cannot be attested|unknown review decision/.test(message) ? 400 : 500;
+    res.status(status).json({ success: false, message });
+}
+
+/**
+ * GET /api/access-reviews
+ * List campaigns with their recorded outcomes
+ */
+router.get('/', verifyToken, requireScope('device:read'), async (req, res) => {
+    try {
+        const fabricClient = req.app.locals.fabricClient;
+        const reviews = JSON.parse(await fabricClient.query('user-acl', 'GetAccessReviews'));
+        res.json({ success: true, reviews });
+    } catch (error) {
+        console.error('List access reviews error:', error);
+        reviewError(res, error, 'Failed to list access reviews');
+    }
+});
+
+/**
+ * POST /api/access-reviews
+ * Start a campaign; deadline is an ISO date or Unix seconds
+ */
+router.post('/', verifyToken, requireScope('admin:review'), async (req, res) => {
+    try {
+        const { deadline } = req.body;
+        const deadlineSeconds = typeof deadline === 'number'
+            ? Math.floor(deadline)
+            : Math.floor(Date.parse(deadline) / 1000);
+        if (!Number.isFinite(deadlineSeconds)) {
+            return res.status(400).json({
+                success: false,
+                message: 'deadline (ISO date or Unix seconds) is required'
+            });
+        }
+
+        const fabricClient = req.app.locals.fabricClient;
+        const review = JSON.parse(await fabricClient.invoke(
+            'user-acl',
+            'StartAccessReview',
+            [req.user.userID, String(deadlineSeconds)]
+        ));
+
+        res.status(201).json({ success: true, review });
+    } catch (error) {
+        console.error('Start access review error:', error);
+        reviewError(res, error, 'Failed to start access review');
+    }
+});
+
+/**
+ * GET /api/access-reviews/:reviewID
+ * A campaign with the items the caller may see
+ */
+router.get('/:reviewID', verifyToken, requireScope('device:read'), async (req, res) => {
+    try {
+        const fabricClient = req.app.locals.fabricClient;
+        const report = JSON.parse(await fabricClient.query(
+            'user-acl',
+            'GetAccessReview',
+            [req.user.userID, req.params.reviewID]
+        ));
+        res.json({ success: true, ...report });
+    } catch (error) {
+        console.error('Get access review error:', error);
+        reviewError(res, error, 'Failed to get access review');
+    }
+});
+
+/**
+ * POST /api/access-reviews/:reviewID/decisions
+ * Attest or revoke one permission: { permissionID, decision }
+ */
+router.post('/:reviewID/decisions', verifyToken, requireScope('device:share'), async (req, res) => {
+    try {
+        const { permissionID, decision } = req.body;
+        if (!permissionID || (decision !== 'attest' && decision !== 'revoke')) {
+            return res.status(400).json({
+                success: false,
+                message: 'permissionID and decision (attest or revoke) are required'
+            });
+        }
+
+        const fabricClient = req.app.locals.fabricClient;
+        await fabricClient.invoke(
+            'user-acl',
+            'ReviewAccess',
+            [req.user.userID, req.params.reviewID, permissionID, decision]
+        );
+
+        res.json({
+            success: true,
+            message: `Permission ${permissionID} ${decision === 'attest' ? 'attested' : 'revoked'}`
+        });
+    } catch (error) {
+        console.error('Access review decision error:', error);
+        reviewError(res, error, 'Failed to record review decision');
+    }
+});
+
+/**
+ * POST /api/access-reviews/:reviewID/close
+ * Close a campaign past its deadline without waiting for the backend
+ */
+router.post('/:reviewID/close', verifyToken, requireScope('admin:review'), async (req, res) => {
+    try {
+        const fabricClient = req.app.locals.fabricClient;
+        const review = JSON.parse(await fabricClient.invoke(
+            'user-acl',
+            'CloseAccessReview',
+            [req.params.reviewID]
+        ));
+        res.json({ success: true, review });
+    } catch (error) {
+        console.error('Close access review error:', error);
+        reviewError(res, error, 'Failed to close access review');
+    }
+});
+
+/**
+ * Close the open campaign once its deadline has passed, checking every
+ * intervalMs. Returns a function that stops the checks.
+ */
+function startReviewCloser(fabricClient, intervalMs) {
+    let running = false;
+    const check = async () => {
+        if (running) {
+            return;
+        }
+        running = true;
+        try {
+            const open = await fabricClient.query('user-acl', 'GetOpenAccessReview');
+            if (!open) {
+                return;
+            }
+            const { reviewID, deadline } = JSON.parse(open);
+            if (deadline >= Date.now() / 1000) {
+                return;
+            }
+            const review = JSON.parse(await fabricClient.invoke('user-acl', 'CloseAccessReview', [reviewID]));
+            console.log(`Access review ${reviewID} closed: ${review.outcome.attested} attested, ${review.outcome.revoked} revoked, ${review.outcome.suspended} suspended`);
+        } catch (error) {
+            console.error('Access review closer:', error.message);
+        } finally {
+            running = false;
+        }
+    };
+
+    const timer = setInterval(check, intervalMs);
+    timer.unref();
+    return () => clearInterval(timer);
+}
+
+module.exports = router;
+module.exports.startReviewCloser = startReviewCloser;
@@ -0,0 +1,145 @@
+/**
+ * Scope-based authorization for the REST gateway
+ *
+ * Tokens carry a space-separated "scope" claim. Each route declares the
+ * scopes it needs with requireScope; a token missing one is refused with 403
+ * and the denial is recorded as an audit event.
+ *
+ * A user's role decides the scopes they may hold. At login a client can ask
+ * for fewer (a "scope" field in the request body), so that, for example, a
+ * dashboard only able to read telemetry never holds a token that can share
+ * devices.
+ */
+
+const { recordAudit } = require('./audit');
+
+const SCOPES = {
+    'device:read': 'List accessible devices',
+    'device:register': 'Register devices',
+    'device:telemetry': 'Read device readings',
+    'device:share': 'Grant and revoke access to owned devices',
+    'device:export': 'Export the readings of a residency zone',
+    'device:ingest': 'Submit device readings for storage',
+    'admin:grant': 'Grant access to devices owned by others',
+    'admin:revoke': 'Revoke access to devices owned by others',
+    'admin:review': 'Start and close access review campaigns'
+};
+
+const USER_SCOPES = ['device:read', 'device:register', 'device:telemetry', 'device:share'];
+
+const OPERATOR_SCOPES = [...USER_SCOPES, 'device:export', 'device:ingest'];
+
+const ROLE_SCOPES = {
+    user: USER_SCOPES,
+    operator: OPERATOR_SCOPES,
+    admin: [...OPERATOR_SCOPES, 'admin:grant', 'admin:revoke', 'admin:review']
+};
+
+/**
+ * Scopes granted by the user-acl admin roles. Admins get the operator scopes
+ * plus those of the admin roles they hold.
+ */
+const ADMIN_ROLE_SCOPES = {
+    'device-admin': ['admin:grant', 'admin:revoke'],
+    'policy-admin': ['admin:review']
+};
+
+/**
+ * Scopes a role may hold. adminRoles, from the chaincode's auth response,
+ * narrows an admin to its scoped roles; without it an admin holds them all.
+ */
+function roleScopes(role, adminRoles) {
+    if (role !== 'admin' || !Array.isArray(adminRoles)) {
+        return ROLE_SCOPES[role] || ROLE_SCOPES.user;
+    }
+    const scopes = [...OPERATOR_SCOPES];
+    for (const adminRole of adminRoles) {
+        for (const scope of ADMIN_ROLE_SCOPES[adminRole] || []) {
+            if (!scopes.includes(scope)) {
+                scopes.push(scope);
+            }
+        }
+    }
+    return scopes;
+}
+
+/**
+ * Scopes to put in a token for a role, narrowed to the requested ones if
+ * the client asked for specific scopes. Unknown or unpermitted requested
+ * scopes are an error rather than silently dropped.
+ */
+function scopesForRole(role, requested, adminRoles) {
+    const allowed = roleScopes(role, adminRoles);
+    if (!requested) {
+        return allowed;
+    }
+
+    const scopes = String(requested).split(/\s+/).filter(Boolean);
+    const refused = scopes.filter(scope => !allowed.includes(scope));
+    if (refused.length > 0) {
+        const error = new Error(`Scopes not available to role ${role}: ${refused.join(' ')}`);
+        error.status = 400;
+        throw error;
+    }
+    return scopes;
+}
+
+/**
+ * Scopes held by a verified token. Tokens issued before scopes existed get
+ * the scopes of their role.
+ */
+function tokenScopes(user) {
+    if (typeof user.scope === 'string') {
+        return user.scope.split(' ').filter(Boolean);
+    }
+    return ROLE_SCOPES[user.role] || ROLE_SCOPES.user;
+}
+
+function hasScope(req, scope) {
+    return tokenScopes(req.user).includes(scope);
+}
+
+/**
+ * Refuse a request that lacks a scope, recording the denial
+ */
+function denyScope(req, res, missing, resourceID) {
+    recordAudit(req, {
+        eventType: 'ACCESS_DENIED',
+        severity: 'WARNING',
+        status: 'denied',
+        resourceType: resourceID ? 'device' : 'endpoint',
+        resourceID: resourceID || `${req.method} ${req.baseUrl}${req.route ? req.route.path : req.path}`,
+        action: req.method.toLowerCase(),
+        description: `Token lacks scope ${missing.join(' ')}`,
+        metadata: {
+            required: missing.join(' '),
+            granted: tokenScopes(req.user).join(' ')
+        }
+    });
+
+    res.set('WWW-Authenticate', `Bearer error="insufficient_scope", scope="${missing.join(' ')}"`);
+    return res.status(403).json({
+        success: false,
+        message: `Insufficient scope: requires ${missing.join(' ')}`
+    });
+}
+
+/**
+ * Middleware requiring every given scope; use after verifyToken
+ */
+function requireScope(...required) {
+    for (const scope of required) {
+        if (!SCOPES[scope]) {
+            throw new Error(`Unknown scope ${scope}`);
+        }
+    }
+    return (req, res, next) => {
+        const missing = required.filter(scope => !hasScope(req, scope));
+        if (missing.length > 0) {
+            return denyScope(req, res, missing);
+        }
+        next();
+    };
+}
+
+module.exports = { SCOPES, ROLE_SCOPES, ADMIN_ROLE_SCOPES, scopesForRole, tokenScopes, hasScope, denyScope, requireScope };
@@ -8,6 +8,11 @@
  * - Device management
  * - Temperature data retrieval
  * - Access control
+ *
+ * and a WebSocket channel (/api/events) pushing chaincode events to
+ * dashboards, see events.js. Common dashboard queries are answered from
+ * local materialized views of the ledger, see views.js. Device readings are
+ * batched onto the ledger by the ingestion pipeline, see ingest.js.
  */
 
 const express = require('express');
@@ -21,10 +26,17 @@ require('dotenv').config();
 const authRoutes = require('./routes/auth');
 const deviceRoutes = require('./routes/devices');
 const readingsRoutes = require('./routes/readings');
+const reviewRoutes = require('./routes/reviews');
 const FabricClient = require('./fabric-client');
+const { EventStream } = require('./events');
+const { openViews } = require('./views');
+const { createIngestPipeline, ingestOptions } = require('./ingest');
+const { OIDCVerifier, loadAuthConfig } = require('./oidc');
 
 const app = express();
 const PORT = process.env.PORT || 8080;
+let eventStream = null;
+let stopReviewCloser = null;
 
 // Middleware
 app.use(helmet()); // Security headers
@@ -40,7 +52,9 @@ app.use(morgan('combined')); // Logging
 const limiter = rateLimit({
     windowMs: 60 * 1000, // 1 minute
     max: 100, // 100 requests per minute
-    message: 'Too many requests from this IP, please try again later.'
+    message: 'Too many requests from this IP, please try again later.',
+    // Ingestion has its own backpressure
+    skip: (req) => req.method === 'POST' && req.path === '/readings/ingest'
 });
 app.use('/api/', limiter);
 
@@ -55,12 +69,30 @@ const fabricClient = new FabricClient({
 // Make fabricClient available to routes
 app.locals.fabricClient = fabricClient;
 
+// Materialized views, unless VIEWS_DB=off; routes use the ledger until
+// they have caught up
+const views = openViews(fabricClient);
+app.locals.views = views;
+
+// Batches device readings into StoreReadingsBatch transactions
+const ingest = createIngestPipeline(fabricClient, ingestOptions(process.env));
+app.locals.ingest = ingest;
+
+// Sign-in methods; a bad AUTH_MODE or missing OIDC settings stop startup
+const authConfig = loadAuthConfig();
+app.locals.authConfig = authConfig;
+if (authConfig.oidcEnabled) {
+    app.locals.oidcVerifier = new OIDCVerifier(authConfig.oidc);
+}
+
 // Health check endpoint
 app.get('/health', (req, res) => {
     res.json({
         status: 'healthy',
         timestamp: new Date().toISOString(),
-        uptime: process.uptime()
+        uptime: process.uptime(),
+        views: views ? views.status() : null,
+        ingest: ingest.stats()
     });
 });
 
@@ -68,6 +100,7 @@ app.get('/health', (req, res) => {
 app.use('/api/auth', authRoutes);
 app.use('/api/devices', deviceRoutes);
 app.use('/api/readings', readingsRoutes);
+app.use('/api/access-reviews', reviewRoutes);
 
 // 404 handler
 app.use((req, res) => {
@@ -95,25 +128,58 @@ async function startServer() {
         console.log('✅ Connected to Fabric network\n');
 
         // Start Express server
-        app.listen(PORT, () => {
+        const server = app.listen(PORT, () => {
             console.log(`\n🚀 IoT Demo Backend API Server`);
             console.log(`📡 Listening on port ${PORT}`);
             console.log(`🌐 CORS enabled for: ${process.env.FRONTEND_URL || 'http://localhost:3000'}`);
             console.log(`🔐 Fabric Channel: ${process.env.CHANNEL_NAME || 'authchannel'}`);
+            console.log(`🪪 Sign-in: ${authConfig.mode}${authConfig.oidcEnabled ? ` (${authConfig.oidc.issuer})` : ''}`);
             console.log(`\n📚 API Documentation:`);
             console.log(`   POST   /api/auth/register`);
             console.log(`   POST   /api/auth/login`);
+            console.log(`   POST   /api/auth/oidc`);
+            console.log(`   GET    /api/auth/config`);
             console.log(`   POST   /api/auth/logout`);
             console.log(`   GET    /api/devices`);
+            console.log(`   GET    /api/devices/overview`);
+            console.log(`   GET    /api/devices/:deviceID/sessions`);
             console.log(`   POST   /api/devices/register`);
             console.log(`   POST   /api/devices/grant-access`);
             console.log(`   POST   /api/devices/revoke-access`);
             console.log(`   GET    /api/readings/:deviceID`);
             console.log(`   GET    /api/readings/:deviceID/latest`);
             console.log(`   GET    /api/readings/:deviceID/stats`);
+            console.log(`   GET    /api/readings/export/:zone`);
+            console.log(`   POST   /api/readings/ingest`);
+            console.log(`   GET    /api/access-reviews`);
+            console.log(`   POST   /api/access-reviews`);
+            console.log(`   GET    /api/access-reviews/:reviewID`);
+            console.log(`   POST   /api/access-reviews/:reviewID/decisions`);
+            console.log(`   POST   /api/access-reviews/:reviewID/close`);
+            console.log(`   WS     /api/events`);
             console.log(`\n✨ Server ready!\n`);
         });
 
+        // Push chaincode events to dashboards over WebSocket
+        eventStream = new EventStream(server, fabricClient, {
+            allowedOrigin: process.env.FRONTEND_URL || 'http://localhost:3000'
+        });
+        await eventStream.start();
+
+        // Fill the views from events, catching up on what was missed
+        if (views) {
+            views.start().catch(error => {
+                console.error('Materialized views failed to start:', error.message);
+            });
+        }
+
+        // Close access reviews at their deadline, suspending what owners
+        // left unattested; ACCESS_REVIEW_CHECK_SECONDS=0 leaves it to admins
+        const reviewCheckSeconds = Number(process.env.ACCESS_REVIEW_CHECK_SECONDS || 300);
+        if (reviewCheckSeconds > 0) {
+            stopReviewCloser = reviewRoutes.startReviewCloser(fabricClient, reviewCheckSeconds * 1000);
+        }
+
     } catch (error) {
         console.error('❌ Failed to start server:', error);
         process.exit(1);
@@ -125,6 +191,17 @@ process.on('SIGINT', async () => {
     console.log('\n\n⚠️  Received SIGINT signal');
     console.log('🛑 Shutting down gracefully...');
 
+    if (eventStream) {
+        eventStream.close();
+    }
+    if (views) {
+        views.close();
+    }
+    if (stopReviewCloser) {
+        stopReviewCloser();
+    }
+    // Store the readings already queued
+    await ingest.close();
     await fabricClient.disconnect();
     console.log('✅ Disconnected from Fabric network');
 
@@ -135,6 +212,17 @@ process.on('SIGTERM', async () => {
     console.log('\n\n⚠️  Received SIGTERM signal');
     console.log('🛑 Shutting down gracefully...');
 
+    if (eventStream) {
+        eventStream.close();
+    }
+    if (views) {
+        views.close();
+    }
+    if (stopReviewCloser) {
+        stopReviewCloser();
+    }
+    // Store the readings already queued
+    await ingest.close();
     await fabricClient.disconnect();
     console.log('✅ Disconnected from Fabric network');
 
@@ -0,0 +1,481 @@
+/**
+ * Local materialized views of the ledger for dashboards
+ *
+ * Dashboards keep asking the same questions: which devices exist, which
+ * sessions are open on them and how their readings look. Answered from the
+ * ledger, each costs chaincode queries per request and per device. The
+ * backend instead keeps a SQLite database (VIEWS_DB, default views.db)
+ * updated from chaincode events:
+ *
+ *   devices   user-acl devices       DeviceRegistered, AS DeviceRevoked
+ *   sessions  ISV sessions           AccessLogged, SessionRestricted, SessionsSwept
+ *   readings  per-device summaries   TemperatureStored, ReadingsBatchStored
+ *
+ * Fabric does not replay events missed while the backend was down, so on
+ * start the views catch up from ledger queries (user-acl GetAllDevices,
+ * iot-data GetAllDeviceStats, ISV GetActiveSessionsByDevice). Listeners are
+ * added first and events arriving during the catch-up are held and applied
+ * after it, so none is lost; a TemperatureStored event not after the
+ * device's last reading was already counted by the catch-up and is skipped.
+ *
+ * Access checks are not materialized: routes still ask user-acl whether a
+ * user may see a device, so that a revocation applies at once. Readings
+ * themselves stay behind the redaction policy of /api/readings; the views
+ * only hold what GetDeviceStatistics returns.
+ */
+
+const Database = require('better-sqlite3');
+const { decodePayload } = require('./events');
+
+const SCHEMA = `
+CREATE TABLE IF NOT EXISTS devices (
+    device_id     TEXT PRIMARY KEY,
+    device_name   TEXT,
+    owner_id      TEXT,
+    device_type   TEXT,
+    registered_at INTEGER,
+    status        TEXT
+);
+CREATE TABLE IF NOT EXISTS sessions (
+    session_id   TEXT PRIMARY KEY,
+    device_id    TEXT NOT NULL,
+    client_id    TEXT,
+    status       TEXT NOT NULL,
+    capabilities TEXT,
+    opened_at    TEXT,
+    updated_at   TEXT
+);
+CREATE INDEX IF NOT EXISTS sessions_by_device ON sessions (device_id, status);
+CREATE TABLE IF NOT EXISTS readings (
+    device_id       TEXT PRIMARY KEY,
+    reading_count   INTEGER NOT NULL,
+    temperature_sum REAL NOT NULL,
+    min_temperature REAL,
+    max_temperature REAL,
+    first_reading   INTEGER,
+    last_reading    INTEGER,
+    last_status     TEXT
+);
+CREATE TABLE IF NOT EXISTS view_state (
+    name  TEXT PRIMARY KEY,
+    value TEXT
+);
+`;
+
+/**
+ * ISV access log actions that change a session, and the status they leave
+ * it in
+ */
+const SESSION_ACTIONS = {
+    session_opened: 'active',
+    session_renewed: 'active',
+    session_restricted: 'active',
+    session_closed: 'terminated'
+};
+
+class MaterializedViews {
+    constructor(fabricClient, options = {}) {
+        this.fabricClient = fabricClient;
+        this.db = new Database(options.path || 'views.db');
+        this.db.pragma('journal_mode = WAL');
+        this.db.exec(SCHEMA);
+        this.statements = this.prepare();
+        this.pending = null; // events held during a catch-up
+        this.ready = false;
+        this.removeListeners = [];
+
+        this.handlers = {
+            'user-acl': {
+                DeviceRegistered: (deviceID) => this.refreshDevice(deviceID)
+            },
+            as: {
+                DeviceRevoked: (deviceID) => this.statements.setDeviceStatus.run('revoked', deviceID)
+            },
+            isv: {
+                AccessLogged: (entry) => this.applyAccessLog(entry),
+                SessionRestricted: (entry) => this.applyAccessLog(entry),
+                SessionsSwept: (result) => this.closeSessions(result.closedSessions || [], null)
+            },
+            'iot-data': {
+                TemperatureStored: (data) => this.applyReading(data),
+                ReadingsBatchStored: (result) => Promise.all(
+                    Object.keys(result.devices || {}).map(deviceID => this.refreshReadings(deviceID))
+                )
+            }
+        };
+    }
+
+    prepare() {
+        const db = this.db;
+        return {
+            upsertDevice: db.prepare(`
+                INSERT INTO devices (device_id, device_name, owner_id, device_type, registered_at, status)
+                VALUES (@deviceID, @deviceName, @ownerID, @deviceType, @registeredAt, @status)
+                ON CONFLICT (device_id) DO UPDATE SET
+                    device_name = excluded.device_name, owner_id = excluded.owner_id,
+                    device_type = excluded.device_type, registered_at = excluded.registered_at,
+                    status = excluded.status`),
+            setDeviceStatus: db.prepare('UPDATE devices SET status = ? WHERE device_id = ?'),
+            getDevice: db.prepare('SELECT * FROM devices WHERE device_id = ?'),
+            allDeviceIDs: db.prepare('SELECT device_id FROM devices'),
+
+            upsertSession: db.prepare(`
+                INSERT INTO sessions (session_id, device_id, client_id, status, capabilities, opened_at, updated_at)
+                VALUES (@sessionID, @deviceID, @clientID, @status, @capabilities, @openedAt, @updatedAt)
+                ON CONFLICT (session_id) DO UPDATE SET
+                    status = excluded.status,
+                    capabilities = COALESCE(excluded.capabilities, sessions.capabilities),
+                    opened_at = COALESCE(sessions.opened_at, excluded.opened_at),
+                    updated_at = excluded.updated_at`),
+            closeSession: db.prepare(`UPDATE sessions SET status = 'terminated', updated_at = COALESCE(?, updated_at) WHERE session_id = ?`),
+            activeSessionIDs: db.prepare(`SELECT session_id FROM sessions WHERE device_id = ? AND status = 'active'`),
+            deviceSessions: db.prepare('SELECT * FROM sessions WHERE device_id = ? ORDER BY opened_at DESC'),
+            countActiveSessions: db.prepare(`SELECT COUNT(*) AS count FROM sessions WHERE device_id = ? AND status = 'active'`),
+
+            getReadings: db.prepare('SELECT * FROM readings WHERE device_id = ?'),
+            putReadings: db.prepare(`
+                INSERT OR REPLACE INTO readings (device_id, reading_count, temperature_sum, min_temperature,
+                    max_temperature, first_reading, last_reading, last_status)
+                VALUES (@deviceID, @count, @sum, @min, @max, @first, @last, @status)`),
+
+            getState: db.prepare('SELECT value FROM view_state WHERE name = ?'),
+            putState: db.prepare('INSERT OR REPLACE INTO view_state (name, value) VALUES (?, ?)')
+        };
+    }
+
+    /**
+     * Subscribe to the chaincodes' events, then catch up from the ledger.
+     * A chaincode that is not deployed is skipped, as in EventStream.start.
+     */
+    async start() {
+        this.pending = [];
+        for (const [chaincode, handlers] of Object.entries(this.handlers)) {
+            try {
+                const remove = await this.fabricClient.addContractListener(
+                    chaincode,
+                    (event) => this.receive(chaincode, handlers, event)
+                );
+                this.removeListeners.push(remove);
+            } catch (error) {
+                console.warn(`Warning: views get no events from chaincode '${chaincode}': ${error.message}`);
+            }
+        }
+
+        await this.catchUp();
+
+        // Events keep being held until the ones before them are applied
+        while (this.pending.length > 0) {
+            await this.apply(this.pending.shift());
+        }
+        this.pending = null;
+        this.ready = true;
+    }
+
+    /**
+     * Rebuild the views from ledger queries. Each source is caught up on its
+     * own; one that fails leaves its view as it was.
+     */
+    async catchUp() {
+        try {
+            const devices = JSON.parse(await this.fabricClient.query('user-acl', 'GetAllDevices')) || [];
+            this.db.transaction(() => {
+                for (const device of devices) {
+                    this.putDevice(device);
+                }
+            })();
+        } catch (error) {
+            console.warn(`Warning: views could not catch up on devices: ${error.message}`);
+        }
+
+        try {
+            const allStats = JSON.parse(await this.fabricClient.query('iot-data', 'GetAllDeviceStats')) || [];
+            this.db.transaction(() => {
+                for (const stats of allStats) {
+                    this.putStatistics(stats, null);
+                }
+            })();
+        } catch (error) {
+            console.warn(`Warning: views could not catch up on readings: ${error.message}`);
+        }
+
+        for (const { device_id: deviceID } of this.statements.allDeviceIDs.all()) {
+            try {
+                await this.refreshSessions(deviceID);
+            } catch (error) {
+                console.warn(`Warning: views could not catch up on sessions of ${deviceID}: ${error.message}`);
+            }
+        }
+
+        this.statements.putState.run('caught_up_at', new Date().toISOString());
+    }
+
+    async receive(chaincode, handlers, contractEvent) {
+        const handler = handlers[contractEvent.eventName];
+        if (!handler) {
+            return;
+        }
+        const event = {
+            handler,
+            name: contractEvent.eventName,
+            chaincode,
+            data: decodePayload(contractEvent.payload),
+            block: blockNumber(contractEvent)
+        };
+        if (this.pending) {
+            this.pending.push(event);
+            return;
+        }
+        await this.apply(event);
+    }
+
+    async apply(event) {
+        try {
+            await event.handler(event.data);
+            if (event.block !== null) {
+                this.statements.putState.run('last_block', String(event.block));
+            }
+        } catch (error) {
+            console.error(`Views failed to apply ${event.chaincode} ${event.name}:`, error.message);
+        }
+    }
+
+    async refreshDevice(deviceID) {
+        const device = JSON.parse(await this.fabricClient.query('user-acl', 'GetDevice', [deviceID]));
+        this.putDevice(device);
+    }
+
+    putDevice(device) {
+        this.statements.upsertDevice.run({
+            deviceID: device.deviceID,
+            deviceName: device.deviceName || null,
+            ownerID: device.ownerID || null,
+            deviceType: device.deviceType || null,
+            registeredAt: device.registeredAt || null,
+            status: device.status || null
+        });
+    }
+
+    applyAccessLog(entry) {
+        const status = SESSION_ACTIONS[entry.action];
+        if (!status || !entry.sessionID) {
+            return;
+        }
+        this.statements.upsertSession.run({
+            sessionID: entry.sessionID,
+            deviceID: entry.deviceID,
+            clientID: entry.clientID || null,
+            status,
+            capabilities: entry.capabilities ? JSON.stringify(entry.capabilities) : null,
+            openedAt: entry.action === 'session_opened' ? entry.timestamp : null,
+            updatedAt: entry.timestamp || null
+        });
+    }
+
+    closeSessions(sessionIDs, at) {
+        this.db.transaction(() => {
+            for (const sessionID of sessionIDs) {
+                this.statements.closeSession.run(at, sessionID);
+            }
+        })();
+    }
+
+    /**
+     * Replace the device's sessions with its active sessions on the ledger;
+     * the ones the view still has as active were closed meanwhile
+     */
+    async refreshSessions(deviceID) {
+        const sessions = JSON.parse(await this.fabricClient.query('isv', 'GetActiveSessionsByDevice', [deviceID])) || [];
+        const active = new Set(sessions.map(session => session.sessionID));
+        this.db.transaction(() => {
+            for (const { session_id: sessionID } of this.statements.activeSessionIDs.all(deviceID)) {
+                if (!active.has(sessionID)) {
+                    this.statements.closeSession.run(null, sessionID);
+                }
+            }
+            for (const session of sessions) {
+                this.statements.upsertSession.run({
+                    sessionID: session.sessionID,
+                    deviceID: session.deviceID,
+                    clientID: session.clientID,
+                    status: 'active',
+                    capabilities: session.capabilities ? JSON.stringify(session.capabilities) : null,
+                    openedAt: session.establishedAt,
+                    updatedAt: session.lastActivity || session.establishedAt
+                });
+            }
+        })();
+    }
+
+    applyReading(data) {
+        const row = this.statements.getReadings.get(data.deviceID);
+        if (row && row.reading_count > 0 && data.timestamp <= row.last_reading) {
+            return; // already counted by the catch-up
+        }
+        const temperature = Number(data.temperature);
+        if (!row || row.reading_count === 0) {
+            this.statements.putReadings.run({
+                deviceID: data.deviceID, count: 1, sum: temperature, min: temperature, max: temperature,
+                first: data.timestamp, last: data.timestamp, status: data.status || null
+            });
+            return;
+        }
+        this.statements.putReadings.run({
+            deviceID: data.deviceID,
+            count: row.reading_count + 1,
+            sum: row.temperature_sum + temperature,
+            min: Math.min(row.min_temperature, temperature),
+            max: Math.max(row.max_temperature, temperature),
+            first: row.first_reading,
+            last: data.timestamp,
+            status: data.status || null
+        });
+    }
+
+    /**
+     * Batches carry no values, so the device's summary is read again
+     */
+    async refreshReadings(deviceID) {
+        const stats = JSON.parse(await this.fabricClient.query('iot-data', 'GetDeviceStatistics', [deviceID]));
+        const row = this.statements.getReadings.get(deviceID);
+        this.putStatistics(stats, row ? row.last_status : null);
+    }
+
+    putStatistics(stats, lastStatus) {
+        this.statements.putReadings.run({
+            deviceID: stats.deviceID,
+            count: stats.readingCount,
+            sum: stats.avgTemperature * stats.readingCount,
+            min: stats.minTemperature,
+            max: stats.maxTemperature,
+            first: stats.firstReading,
+            last: stats.lastReading,
+            status: lastStatus
+        });
+    }
+
+    /**
+     * A device as user-acl GetDevice returns it, or null if the view has
+     * not seen it
+     */
+    getDevice(deviceID) {
+        const row = this.statements.getDevice.get(deviceID);
+        if (!row) {
+            return null;
+        }
+        return {
+            deviceID: row.device_id,
+            deviceName: row.device_name,
+            ownerID: row.owner_id,
+            deviceType: row.device_type,
+            registeredAt: row.registered_at,
+            status: row.status
+        };
+    }
+
+    /**
+     * A device's statistics as iot-data GetDeviceStatistics returns them,
+     * empty for a device without readings
+     */
+    getStatistics(deviceID) {
+        const row = this.statements.getReadings.get(deviceID);
+        if (!row || row.reading_count === 0) {
+            return {
+                deviceID, readingCount: 0, minTemperature: 0, maxTemperature: 0,
+                avgTemperature: 0, lastReading: 0, firstReading: 0
+            };
+        }
+        return {
+            deviceID,
+            readingCount: row.reading_count,
+            minTemperature: row.min_temperature,
+            maxTemperature: row.max_temperature,
+            avgTemperature: Math.round(row.temperature_sum / row.reading_count * 10) / 10,
+            lastReading: row.last_reading,
+            firstReading: row.first_reading
+        };
+    }
+
+    /**
+     * The sessions the view has seen on a device, newest first
+     */
+    getSessions(deviceID) {
+        return this.statements.deviceSessions.all(deviceID).map(row => ({
+            sessionID: row.session_id,
+            clientID: row.client_id,
+            status: row.status,
+            capabilities: row.capabilities ? JSON.parse(row.capabilities) : undefined,
+            openedAt: row.opened_at,
+            updatedAt: row.updated_at
+        }));
+    }
+
+    /**
+     * What a dashboard shows of a device without its readings' values
+     */
+    getOverview(deviceID) {
+        const device = this.getDevice(deviceID);
+        if (!device) {
+            return null;
+        }
+        const row = this.statements.getReadings.get(deviceID);
+        return {
+            ...device,
+            activeSessions: this.statements.countActiveSessions.get(deviceID).count,
+            readings: {
+                count: row ? row.reading_count : 0,
+                lastReading: row ? row.last_reading : null,
+                lastStatus: row ? row.last_status : null
+            }
+        };
+    }
+
+    status() {
+        const state = (name) => {
+            const row = this.statements.getState.get(name);
+            return row ? row.value : null;
+        };
+        const lastBlock = state('last_block');
+        return {
+            ready: this.ready,
+            caughtUpAt: state('caught_up_at'),
+            lastBlock: lastBlock === null ? null : Number(lastBlock)
+        };
+    }
+
+    close() {
+        for (const remove of this.removeListeners) {
+            remove();
+        }
+        this.db.close();
+    }
+}
+
+function blockNumber(contractEvent) {
+    try {
+        return Number(contractEvent.getTransactionEvent().getBlockEvent().blockNumber);
+    } catch (error) {
+        return null;
+    }
+}
+
+/**
+ * Open the views unless VIEWS_DB is "off". Routes fall back to the ledger
+ * while views are null or not ready.
+ */
+function openViews(fabricClient) {
+    const path = process.env.VIEWS_DB || 'views.db';
+    if (path === 'off') {
+        return null;
+    }
+    return new MaterializedViews(fabricClient, { path });
+}
+
+/**
+ * The views of a request's app if they have caught up, otherwise null
+ */
+function readyViews(req) {
+    const views = req.app.locals.views;
+    return views && views.ready ? views : null;
+}
+
+module.exports = { MaterializedViews, openViews, readyViews };
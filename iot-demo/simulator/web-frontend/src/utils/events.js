@@ -0,0 +1,52 @@
+import api from './api'
+
+const RECONNECT_DELAY = 5000
+const CLOSE_TOKEN_EXPIRED = 4401
+
+/**
+ * Subscribe to the backend's push channel (/api/events). onEvent gets each
+ * event message; the socket reconnects after a drop until the returned
+ * function is called. An expired token is not retried.
+ */
+export function subscribeEvents(onEvent, subscription = null) {
+  let socket = null
+  let timer = null
+  let stopped = false
+
+  const connect = () => {
+    const token = localStorage.getItem('authToken')
+    if (!token || stopped) return
+
+    const url = new URL(`${api.defaults.baseURL}/events`, window.location.href)
+    url.protocol = url.protocol === 'https:' ? 'wss:' : 'ws:'
+    url.searchParams.set('access_token', token)
+
+    socket = new WebSocket(url.toString())
+    socket.onopen = () => {
+      if (subscription) {
+        socket.send(JSON.stringify({ type: 'subscribe', ...subscription }))
+      }
+    }
+    socket.onmessage = (message) => {
+      const data = JSON.parse(message.data)
+      if (data.type === 'event') {
+        onEvent(data)
+      } else if (data.type === 'error') {
+        console.error('Event stream error:', data.message)
+      }
+    }
+    socket.onclose = (event) => {
+      if (!stopped && event.code !== CLOSE_TOKEN_EXPIRED) {
+        timer = setTimeout(connect, RECONNECT_DELAY)
+      }
+    }
+  }
+
+  connect()
+
+  return () => {
+    stopped = true
+    clearTimeout(timer)
+    if (socket) socket.close()
+  }
+}
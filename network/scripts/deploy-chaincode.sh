@@ -9,9 +9,29 @@ CC_SRC_PATH="../../chaincodes/${CC_NAME}-chaincode"
 if [ -z "$CC_NAME" ]; then
   echo "Usage: ./deploy-chaincode.sh <chaincode-name>"
   echo "Example: ./deploy-chaincode.sh as"
+  echo "Optional environment: COLLECTIONS_CONFIG (private data collections file, path in the cli container)"
+  echo "                      SIGNATURE_POLICY (endorsement policy, default: the channel's)"
+  echo "                      INIT_REQUIRED (set to 1 if the first invoke must be sent with --isInit)"
   exit 1
 fi
 
+# Options passed to approveformyorg, checkcommitreadiness and commit
+LIFECYCLE_ARGS=()
+if [ -n "$COLLECTIONS_CONFIG" ]; then
+  LIFECYCLE_ARGS+=(--collections-config "$COLLECTIONS_CONFIG")
+fi
+if [ -n "$SIGNATURE_POLICY" ]; then
+  LIFECYCLE_ARGS+=(--signature-policy "$SIGNATURE_POLICY")
+fi
+if [ "$INIT_REQUIRED" = "1" ]; then
+  LIFECYCLE_ARGS+=(--init-required)
+fi
+# Approval runs in a bash -c string, so it gets the options quoted
+APPROVE_ARGS=""
+if [ ${#LIFECYCLE_ARGS[@]} -gt 0 ]; then
+  APPROVE_ARGS=$(printf '%q ' "${LIFECYCLE_ARGS[@]}")
+fi
+
 echo "=========================================="
 echo "Deploying chaincode: $CC_NAME"
 echo "=========================================="
@@ -59,6 +79,7 @@ for org in 1 2 3; do
       --version ${CC_VERSION} \
       --package-id ${PACKAGE_ID} \
       --sequence ${CC_SEQUENCE} \
+      ${APPROVE_ARGS} \
       --tls \
       --cafile /opt/gopath/src/github.com/hyperledger/fabric/peer/crypto/ordererOrganizations/example.com/orderers/orderer.example.com/msp/tlscacerts/tlsca.example.com-cert.pem
   "
@@ -71,6 +92,7 @@ docker exec cli peer lifecycle chaincode checkcommitreadiness \
   --name ${CC_NAME} \
   --version ${CC_VERSION} \
   --sequence ${CC_SEQUENCE} \
+  "${LIFECYCLE_ARGS[@]}" \
   --tls \
   --cafile /opt/gopath/src/github.com/hyperledger/fabric/peer/crypto/ordererOrganizations/example.com/orderers/orderer.example.com/msp/tlscacerts/tlsca.example.com-cert.pem
 
@@ -82,6 +104,7 @@ docker exec cli peer lifecycle chaincode commit \
   --name ${CC_NAME} \
   --version ${CC_VERSION} \
   --sequence ${CC_SEQUENCE} \
+  "${LIFECYCLE_ARGS[@]}" \
   --tls \
   --cafile /opt/gopath/src/github.com/hyperledger/fabric/peer/crypto/ordererOrganizations/example.com/orderers/orderer.example.com/msp/tlscacerts/tlsca.example.com-cert.pem \
   --peerAddresses peer0.org1.example.com:7051 \
@@ -104,10 +104,33 @@ initialize_chaincode() {
     switch_to_org1
     peer lifecycle chaincode querycommitted -C chaichis-channel -n $CHAINCODE_NAME --output json
     
+    # The chaincodes no longer carry key pairs; pass one as transient data,
+    # which stays off the ledger. The key is kept for later runs.
+    SERVICE_KEY_DIR=${SERVICE_KEY_DIR:-./service-keys}
+    mkdir -p $SERVICE_KEY_DIR
+    if [ ! -f $SERVICE_KEY_DIR/$CHAINCODE_NAME.key ]; then
+        openssl genrsa -out $SERVICE_KEY_DIR/$CHAINCODE_NAME.key 2048
+        chmod 600 $SERVICE_KEY_DIR/$CHAINCODE_NAME.key
+    fi
+    SERVICE_KEYS=$(jq -n --rawfile private $SERVICE_KEY_DIR/$CHAINCODE_NAME.key \
+        --arg public "$(openssl rsa -in $SERVICE_KEY_DIR/$CHAINCODE_NAME.key -pubout 2>/dev/null)" \
+        '{privateKey: $private, publicKey: $public}')
+    TRANSIENT="{\"serviceKeys\":\"$(echo -n "$SERVICE_KEYS" | base64 -w 0)\"}"
+    
+    # The admin functions, Initialize among them, are closed until the
+    # instantiating transaction names the admin MSPs
+    echo "Naming the admin MSPs of $CHAINCODE_NAME..."
+    peer chaincode invoke -C chaichis-channel -n $CHAINCODE_NAME -c '{"function":"InitAdminMSPs","Args":["[\"Org1MSP\"]"]}' \
+        --tls --cafile $ORDERER_CA --isInit --waitForEvent \
+        --peerAddresses peer0.org1.example.com:7051 --tlsRootCertFiles $ORG1_TLS_ROOTCERT \
+        --peerAddresses peer0.org2.example.com:9051 --tlsRootCertFiles $ORG2_TLS_ROOTCERT \
+        --peerAddresses peer0.org3.example.com:11051 --tlsRootCertFiles $ORG3_TLS_ROOTCERT
+    
     # Initialize with multi-org endorsement
     echo "Initializing $CHAINCODE_NAME with multi-org endorsement..."
     peer chaincode invoke -C chaichis-channel -n $CHAINCODE_NAME -c '{"function":"Initialize","Args":[]}' \
-        --tls --cafile $ORDERER_CA --isInit \
+        --transient "$TRANSIENT" \
+        --tls --cafile $ORDERER_CA \
         --peerAddresses peer0.org1.example.com:7051 --tlsRootCertFiles $ORG1_TLS_ROOTCERT \
         --peerAddresses peer0.org2.example.com:9051 --tlsRootCertFiles $ORG2_TLS_ROOTCERT \
         --peerAddresses peer0.org3.example.com:11051 --tlsRootCertFiles $ORG3_TLS_ROOTCERT